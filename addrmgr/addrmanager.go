@@ -17,6 +17,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -32,12 +33,19 @@ import (
 type AddrManager struct {
 	mtx            sync.Mutex
 	peersFile      string
+	jsonPeersFile  string
+	anchorsFile    string
+	anchors        []*wire.NetAddress
 	lookupFunc     func(string) ([]net.IP, error)
 	rand           *rand.Rand
 	key            [32]byte
 	addrIndex      map[string]*KnownAddress // address key to ka for all addrs.
 	addrNew        [newBucketCount]map[string]*KnownAddress
 	addrTried      [triedBucketCount]*list.List
+	nNetwork       map[wire.NetworkID]int // number of addrs per network.
+	reachable      map[wire.NetworkID]bool
+	asmap          []byte
+	asmapChecksum  chainhash.Hash
 	started        int32
 	shutdown       int32
 	wg             sync.WaitGroup
@@ -46,7 +54,24 @@ type AddrManager struct {
 	nNew           int
 	lamtx          sync.Mutex
 	localAddresses map[string]*localAddress
-	version        int
+
+	// discouraged maps the IP addresses of misbehaving peers to the time
+	// their discouragement expires.  Discouragement is deliberately not
+	// persisted.
+	discouraged map[string]time.Time
+
+	// getAddrCache houses the cached responses to getaddr requests keyed
+	// by the cache key provided by the caller.  It is protected by its own
+	// mutex since the responses are generated while holding it.
+	getAddrCacheMtx sync.Mutex
+	getAddrCache    map[string]*getAddrResponse
+}
+
+// getAddrResponse houses a cached response to getaddr requests along with the
+// time it expires.
+type getAddrResponse struct {
+	addrs   []*wire.NetAddressV2
+	expires time.Time
 }
 
 type serializedKnownAddress struct {
@@ -58,6 +83,9 @@ type serializedKnownAddress struct {
 	LastSuccess int64
 	Services    wire.ServiceFlag
 	SrcServices wire.ServiceFlag
+	// Network is only set for addresses which can't be represented as a
+	// wire.NetAddress.
+	Network wire.NetworkID `json:",omitempty"`
 	// no refcount or tried, that is available from context.
 }
 
@@ -69,6 +97,18 @@ type serializedAddrManager struct {
 	TriedBuckets [triedBucketCount][]string
 }
 
+// serializedAnchors is the on-disk format of the anchors file.
+type serializedAnchors struct {
+	Version   int
+	Addresses []*serializedAnchor
+}
+
+// serializedAnchor describes a single anchor in the anchors file.
+type serializedAnchor struct {
+	Addr     string
+	Services wire.ServiceFlag
+}
+
 type localAddress struct {
 	na    *wire.NetAddress
 	score AddressPriority
@@ -157,21 +197,66 @@ const (
 	// will share with a call to AddressCache.
 	getAddrPercent = 23
 
+	// getAddrCacheLifetime is the minimum amount of time responses to
+	// getaddr requests are cached for.  Serving the same response for a
+	// long time prevents crawlers from enumerating all known addresses by
+	// repeatedly requesting them.
+	getAddrCacheLifetime = 21 * time.Hour
+
+	// getAddrCacheJitter is the maximum random amount of time added to the
+	// lifetime of each cached getaddr response so the time responses are
+	// regenerated can't be used to correlate them.
+	getAddrCacheJitter = 6 * time.Hour
+
+	// getAddrTimestampPrecision is the precision the timestamps of the
+	// addresses in responses to getaddr requests are rounded down to so
+	// they can't be used to fingerprint the node.
+	getAddrTimestampPrecision = time.Hour
+
+	// discouragedChance is the factor the selection probability of
+	// discouraged addresses is reduced by.  They are not excluded entirely
+	// so selection does not stall when all known addresses are
+	// discouraged.
+	discouragedChance = 0.0001
+
 	// serialisationVersion is the current version of the on-disk format.
-	serialisationVersion = 2
+	// Versions before firstBinaryVersion were JSON encoded.  Version 5
+	// added the checksum of the ASMap the addresses were bucketed with.
+	serialisationVersion = 5
+
+	// firstBinaryVersion is the first version of the on-disk format which
+	// uses the binary encoding of the peers file.
+	firstBinaryVersion = 4
+
+	// anchorsVersion is the current version of the anchors file format.
+	anchorsVersion = 1
+
+	// maxAnchors is the maximum number of anchors which are persisted.
+	maxAnchors = 2
 )
 
+// defaultReachableNetworks are the networks GetAddress selects addresses from
+// unless configured otherwise by way of SetReachableNetworks.  Tor v2
+// addresses are encoded as OnionCat IPv6 addresses, so they are connected to
+// the same way as addresses of the other networks.
+var defaultReachableNetworks = []wire.NetworkID{
+	wire.NetIDIPv4,
+	wire.NetIDIPv6,
+	wire.NetIDTorV2,
+}
+
 // updateAddress is a helper function to either update an address already known
 // to the address manager, or to add the address if not already known.
-func (a *AddrManager) updateAddress(netAddr, srcAddr *wire.NetAddress) {
+func (a *AddrManager) updateAddress(netAddr *wire.NetAddressV2, srcAddr *wire.NetAddress) {
 	// Filter out non-routable addresses. Note that non-routable
-	// also includes invalid and local addresses.
-	if !IsRoutable(netAddr) {
+	// also includes invalid and local addresses as well as addresses of
+	// unknown networks.
+	if !IsRoutableV2(netAddr) {
 		return
 	}
 
-	addr := NetAddressKey(netAddr)
-	ka := a.find(netAddr)
+	addr := NetAddressV2Key(netAddr)
+	ka := a.addrIndex[addr]
 	if ka != nil {
 		// TODO: only update addresses periodically.
 		// Update the last seen time and services.
@@ -179,14 +264,13 @@ func (a *AddrManager) updateAddress(netAddr, srcAddr *wire.NetAddress) {
 		// messages the netaddresses in addrmaanger are *immutable*,
 		// if we need to change them then we replace the pointer with a
 		// new copy so that we don't have to copy every na for getaddr.
-		if netAddr.Timestamp.After(ka.na.Timestamp) ||
-			(ka.na.Services&netAddr.Services) !=
-				netAddr.Services {
-
-			naCopy := *ka.na
-			naCopy.Timestamp = netAddr.Timestamp
-			naCopy.AddService(netAddr.Services)
-			ka.na = &naCopy
+		if netAddr.Timestamp.After(ka.timestamp()) ||
+			(ka.Services()&netAddr.Services) != netAddr.Services {
+
+			addrCopy := *ka.NetAddressV2()
+			addrCopy.Timestamp = netAddr.Timestamp
+			addrCopy.AddService(netAddr.Services)
+			ka.setAddress(&addrCopy)
 		}
 
 		// If already in tried, we have nothing to do here.
@@ -210,8 +294,9 @@ func (a *AddrManager) updateAddress(netAddr, srcAddr *wire.NetAddress) {
 		// updated elsewhere in the addrmanager code and would otherwise
 		// change the actual netaddress on the peer.
 		netAddrCopy := *netAddr
-		ka = &KnownAddress{na: &netAddrCopy, srcAddr: srcAddr}
-		a.addrIndex[addr] = ka
+		ka = &KnownAddress{srcAddr: srcAddr}
+		ka.setAddress(&netAddrCopy)
+		a.addKnown(addr, ka)
 		a.nNew++
 		// XXX time penalty?
 	}
@@ -237,6 +322,24 @@ func (a *AddrManager) updateAddress(netAddr, srcAddr *wire.NetAddress) {
 		a.nTried+a.nNew)
 }
 
+// addKnown adds the passed known address to the index of all known addresses
+// under the passed key.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) addKnown(key string, ka *KnownAddress) {
+	a.addrIndex[key] = ka
+	a.nNetwork[ka.Network()]++
+}
+
+// removeKnown removes the passed known address, which is indexed under the
+// passed key, from the index of all known addresses.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) removeKnown(key string, ka *KnownAddress) {
+	delete(a.addrIndex, key)
+	a.nNetwork[ka.Network()]--
+}
+
 // expireNew makes space in the new buckets by expiring the really bad entries.
 // If no bad entries are available we look at a few and remove the oldest.
 func (a *AddrManager) expireNew(bucket int) {
@@ -253,26 +356,26 @@ func (a *AddrManager) expireNew(bucket int) {
 			v.refs--
 			if v.refs == 0 {
 				a.nNew--
-				delete(a.addrIndex, k)
+				a.removeKnown(k, v)
 			}
 			continue
 		}
 		if oldest == nil {
 			oldest = v
-		} else if !v.na.Timestamp.After(oldest.na.Timestamp) {
+		} else if !v.timestamp().After(oldest.timestamp()) {
 			oldest = v
 		}
 	}
 
 	if oldest != nil {
-		key := NetAddressKey(oldest.na)
+		key := NetAddressV2Key(oldest.NetAddressV2())
 		log.Tracef("expiring oldest address %v", key)
 
 		delete(a.addrNew[bucket], key)
 		oldest.refs--
 		if oldest.refs == 0 {
 			a.nNew--
-			delete(a.addrIndex, key)
+			a.removeKnown(key, oldest)
 		}
 	}
 }
@@ -285,7 +388,7 @@ func (a *AddrManager) pickTried(bucket int) *list.Element {
 	var oldestElem *list.Element
 	for e := a.addrTried[bucket].Front(); e != nil; e = e.Next() {
 		ka := e.Value.(*KnownAddress)
-		if oldest == nil || oldest.na.Timestamp.After(ka.na.Timestamp) {
+		if oldest == nil || oldest.timestamp().After(ka.timestamp()) {
 			oldestElem = e
 			oldest = ka
 		}
@@ -294,14 +397,15 @@ func (a *AddrManager) pickTried(bucket int) *list.Element {
 	return oldestElem
 }
 
-func (a *AddrManager) getNewBucket(netAddr, srcAddr *wire.NetAddress) int {
+func (a *AddrManager) getNewBucket(netAddr *wire.NetAddressV2, srcAddr *wire.NetAddress) int {
 	// bitcoind:
 	// doublesha256(key + sourcegroup + int64(doublesha256(key + group + sourcegroup))%bucket_per_source_group) % num_new_buckets
 
+	srcGroup := a.groupKey(wire.NetAddressV2FromLegacy(srcAddr))
 	data1 := []byte{}
 	data1 = append(data1, a.key[:]...)
-	data1 = append(data1, []byte(GroupKey(netAddr))...)
-	data1 = append(data1, []byte(GroupKey(srcAddr))...)
+	data1 = append(data1, []byte(a.groupKey(netAddr))...)
+	data1 = append(data1, []byte(srcGroup)...)
 	hash1 := chainhash.DoubleHashB(data1)
 	hash64 := binary.LittleEndian.Uint64(hash1)
 	hash64 %= newBucketsPerGroup
@@ -309,19 +413,19 @@ func (a *AddrManager) getNewBucket(netAddr, srcAddr *wire.NetAddress) int {
 	binary.LittleEndian.PutUint64(hashbuf[:], hash64)
 	data2 := []byte{}
 	data2 = append(data2, a.key[:]...)
-	data2 = append(data2, GroupKey(srcAddr)...)
+	data2 = append(data2, srcGroup...)
 	data2 = append(data2, hashbuf[:]...)
 
 	hash2 := chainhash.DoubleHashB(data2)
 	return int(binary.LittleEndian.Uint64(hash2) % newBucketCount)
 }
 
-func (a *AddrManager) getTriedBucket(netAddr *wire.NetAddress) int {
+func (a *AddrManager) getTriedBucket(netAddr *wire.NetAddressV2) int {
 	// bitcoind hashes this as:
 	// doublesha256(key + group + truncate_to_64bits(doublesha256(key)) % buckets_per_group) % num_buckets
 	data1 := []byte{}
 	data1 = append(data1, a.key[:]...)
-	data1 = append(data1, []byte(NetAddressKey(netAddr))...)
+	data1 = append(data1, []byte(NetAddressV2Key(netAddr))...)
 	hash1 := chainhash.DoubleHashB(data1)
 	hash64 := binary.LittleEndian.Uint64(hash1)
 	hash64 %= triedBucketsPerGroup
@@ -329,7 +433,7 @@ func (a *AddrManager) getTriedBucket(netAddr *wire.NetAddress) int {
 	binary.LittleEndian.PutUint64(hashbuf[:], hash64)
 	data2 := []byte{}
 	data2 = append(data2, a.key[:]...)
-	data2 = append(data2, GroupKey(netAddr)...)
+	data2 = append(data2, a.groupKey(netAddr)...)
 	data2 = append(data2, hashbuf[:]...)
 
 	hash2 := chainhash.DoubleHashB(data2)
@@ -352,99 +456,16 @@ out:
 		}
 	}
 	a.savePeers()
+	a.saveAnchors()
 	a.wg.Done()
 	log.Trace("Address handler done")
 }
 
-// savePeers saves all the known addresses to a file so they can be read back
-// in at next run.
-func (a *AddrManager) savePeers() {
-	a.mtx.Lock()
-	defer a.mtx.Unlock()
-
-	// First we make a serialisable datastructure so we can encode it to
-	// json.
-	sam := new(serializedAddrManager)
-	sam.Version = a.version
-	copy(sam.Key[:], a.key[:])
-
-	sam.Addresses = make([]*serializedKnownAddress, len(a.addrIndex))
-	i := 0
-	for k, v := range a.addrIndex {
-		ska := new(serializedKnownAddress)
-		ska.Addr = k
-		ska.TimeStamp = v.na.Timestamp.Unix()
-		ska.Src = NetAddressKey(v.srcAddr)
-		ska.Attempts = v.attempts
-		ska.LastAttempt = v.lastattempt.Unix()
-		ska.LastSuccess = v.lastsuccess.Unix()
-		if a.version > 1 {
-			ska.Services = v.na.Services
-			ska.SrcServices = v.srcAddr.Services
-		}
-		// Tried and refs are implicit in the rest of the structure
-		// and will be worked out from context on unserialisation.
-		sam.Addresses[i] = ska
-		i++
-	}
-	for i := range a.addrNew {
-		sam.NewBuckets[i] = make([]string, len(a.addrNew[i]))
-		j := 0
-		for k := range a.addrNew[i] {
-			sam.NewBuckets[i][j] = k
-			j++
-		}
-	}
-	for i := range a.addrTried {
-		sam.TriedBuckets[i] = make([]string, a.addrTried[i].Len())
-		j := 0
-		for e := a.addrTried[i].Front(); e != nil; e = e.Next() {
-			ka := e.Value.(*KnownAddress)
-			sam.TriedBuckets[i][j] = NetAddressKey(ka.na)
-			j++
-		}
-	}
-
-	w, err := os.Create(a.peersFile)
-	if err != nil {
-		log.Errorf("Error opening file %s: %v", a.peersFile, err)
-		return
-	}
-	enc := json.NewEncoder(w)
-	defer w.Close()
-	if err := enc.Encode(&sam); err != nil {
-		log.Errorf("Failed to encode file %s: %v", a.peersFile, err)
-		return
-	}
-}
-
-// loadPeers loads the known address from the saved file.  If empty, missing, or
-// malformed file, just don't load anything and start fresh
-func (a *AddrManager) loadPeers() {
-	a.mtx.Lock()
-	defer a.mtx.Unlock()
-
-	err := a.deserializePeers(a.peersFile)
-	if err != nil {
-		log.Errorf("Failed to parse file %s: %v", a.peersFile, err)
-		// if it is invalid we nuke the old one unconditionally.
-		err = os.Remove(a.peersFile)
-		if err != nil {
-			log.Warnf("Failed to remove corrupt peers file %s: %v",
-				a.peersFile, err)
-		}
-		a.reset()
-		return
-	}
-	log.Infof("Loaded %d addresses from file '%s'", a.numAddresses(), a.peersFile)
-}
-
-func (a *AddrManager) deserializePeers(filePath string) error {
-
-	_, err := os.Stat(filePath)
-	if os.IsNotExist(err) {
-		return nil
-	}
+// deserializePeersJSON loads the known addresses from a peers file in the
+// JSON format used before version 4 of the serialised address manager.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) deserializePeersJSON(filePath string) error {
 	r, err := os.Open(filePath)
 	if err != nil {
 		return fmt.Errorf("%s error opening file: %v", filePath, err)
@@ -460,8 +481,8 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 
 	// Since decoding JSON is backwards compatible (i.e., only decodes
 	// fields it understands), we'll only return an error upon seeing a
-	// version past our latest supported version.
-	if sam.Version > serialisationVersion {
+	// version past the latest JSON encoded version.
+	if sam.Version >= firstBinaryVersion {
 		return fmt.Errorf("unknown version %v in serialized "+
 			"addrmanager", sam.Version)
 	}
@@ -477,11 +498,12 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 		if sam.Version == 1 {
 			v.Services = wire.SFNodeNetwork
 		}
-		ka.na, err = a.DeserializeNetAddress(v.Addr, v.Services)
+		addr, err := a.deserializeAddress(v.Addr, v.Network, v.Services)
 		if err != nil {
 			return fmt.Errorf("failed to deserialize netaddress "+
 				"%s: %v", v.Addr, err)
 		}
+		ka.setAddress(addr)
 
 		// The first version of the serialized address manager was not
 		// aware of the service bits associated with the source address,
@@ -498,7 +520,7 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 		ka.attempts = v.Attempts
 		ka.lastattempt = time.Unix(v.LastAttempt, 0)
 		ka.lastsuccess = time.Unix(v.LastSuccess, 0)
-		a.addrIndex[NetAddressKey(ka.na)] = ka
+		a.addKnown(NetAddressV2Key(ka.NetAddressV2()), ka)
 	}
 
 	for i := range sam.NewBuckets {
@@ -562,6 +584,197 @@ func (a *AddrManager) DeserializeNetAddress(addr string,
 	return a.HostToNetAddress(host, uint16(port), services)
 }
 
+// addrV2Encoding is the base32 encoding used for the host names of Tor v3 and
+// I2P addresses.
+var addrV2Encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// deserializeAddress converts a given address key of the passed network to a
+// *wire.NetAddressV2.  A zero network ID signifies an address which can be
+// represented as a wire.NetAddress.
+func (a *AddrManager) deserializeAddress(addr string, netID wire.NetworkID,
+	services wire.ServiceFlag) (*wire.NetAddressV2, error) {
+
+	if netID == 0 {
+		na, err := a.DeserializeNetAddress(addr, services)
+		if err != nil {
+			return nil, err
+		}
+		return wire.NetAddressV2FromLegacy(na), nil
+	}
+
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw []byte
+	switch netID {
+	case wire.NetIDTorV3:
+		// The host name also encodes a checksum and version which are
+		// verified by comparing the keys below.
+		if !strings.HasSuffix(host, ".onion") {
+			return nil, fmt.Errorf("invalid %v host %s", netID, host)
+		}
+		raw, err = addrV2Encoding.DecodeString(strings.ToUpper(
+			strings.TrimSuffix(host, ".onion")))
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) > 32 {
+			raw = raw[:32]
+		}
+
+	case wire.NetIDI2P:
+		if !strings.HasSuffix(host, ".b32.i2p") {
+			return nil, fmt.Errorf("invalid %v host %s", netID, host)
+		}
+		raw, err = addrV2Encoding.DecodeString(strings.ToUpper(
+			strings.TrimSuffix(host, ".b32.i2p")))
+		if err != nil {
+			return nil, err
+		}
+
+	case wire.NetIDCJDNS:
+		raw = net.ParseIP(host).To16()
+
+	default:
+		return nil, fmt.Errorf("unsupported network %v", netID)
+	}
+
+	na := wire.NewNetAddressV2(time.Now(), services, netID, raw,
+		uint16(port))
+	if !IsRoutableV2(na) || NetAddressV2Key(na) != addr {
+		return nil, fmt.Errorf("invalid %v address %s", netID, addr)
+	}
+	return na, nil
+}
+
+// saveAnchors saves the anchors to a file so they can be reconnected to first
+// at next run.  Nothing is written when there are no anchors.
+func (a *AddrManager) saveAnchors() {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	if len(a.anchors) == 0 {
+		return
+	}
+
+	sa := serializedAnchors{Version: anchorsVersion}
+	for _, na := range a.anchors {
+		sa.Addresses = append(sa.Addresses, &serializedAnchor{
+			Addr:     NetAddressKey(na),
+			Services: na.Services,
+		})
+	}
+
+	w, err := os.Create(a.anchorsFile)
+	if err != nil {
+		log.Errorf("Error opening file %s: %v", a.anchorsFile, err)
+		return
+	}
+	defer w.Close()
+	if err := json.NewEncoder(w).Encode(&sa); err != nil {
+		log.Errorf("Failed to encode file %s: %v", a.anchorsFile, err)
+	}
+}
+
+// loadAnchors loads the anchors from the saved file, if any.  The file is
+// removed once it was read, so a node which keeps crashing does not keep
+// reconnecting to the same peers.
+func (a *AddrManager) loadAnchors() {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	anchors, err := a.deserializeAnchors(a.anchorsFile)
+	if err != nil {
+		log.Errorf("Failed to parse file %s: %v", a.anchorsFile, err)
+	}
+	if err := os.Remove(a.anchorsFile); err != nil && !os.IsNotExist(err) {
+		log.Warnf("Failed to remove anchors file %s: %v",
+			a.anchorsFile, err)
+	}
+	if len(anchors) > maxAnchors {
+		anchors = anchors[:maxAnchors]
+	}
+	a.anchors = anchors
+	if len(anchors) > 0 {
+		log.Infof("Loaded %d anchors from file '%s'", len(anchors),
+			a.anchorsFile)
+	}
+}
+
+func (a *AddrManager) deserializeAnchors(filePath string) ([]*wire.NetAddress, error) {
+	r, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s error opening file: %v", filePath, err)
+	}
+	defer r.Close()
+
+	var sa serializedAnchors
+	if err := json.NewDecoder(r).Decode(&sa); err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", filePath, err)
+	}
+	if sa.Version > anchorsVersion {
+		return nil, fmt.Errorf("unknown version %v in serialized "+
+			"anchors", sa.Version)
+	}
+
+	anchors := make([]*wire.NetAddress, 0, len(sa.Addresses))
+	for _, v := range sa.Addresses {
+		na, err := a.DeserializeNetAddress(v.Addr, v.Services)
+		if err != nil {
+			return nil, fmt.Errorf("failed to deserialize netaddress "+
+				"%s: %v", v.Addr, err)
+		}
+		if !IsRoutable(na) {
+			continue
+		}
+		anchors = append(anchors, na)
+	}
+	return anchors, nil
+}
+
+// Anchors returns the addresses of the peers which were persisted as anchors
+// by the previous run, or since set by SetAnchors.  Callers are expected to
+// connect to them before making any other outbound connections, which makes
+// it harder for an attacker to take over all of the outbound connections of a
+// node by forcing it to restart.
+//
+// This function is safe for concurrent access.
+func (a *AddrManager) Anchors() []*wire.NetAddress {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	anchors := make([]*wire.NetAddress, len(a.anchors))
+	copy(anchors, a.anchors)
+	return anchors
+}
+
+// SetAnchors sets the addresses of the peers which are persisted as anchors
+// when the address manager is stopped.  The addresses are expected to be
+// ordered from most to least preferred, and only up to the first two of them
+// are kept.  Typically, they are the addresses of the outbound peers which
+// relayed blocks when shutting down.
+//
+// This function is safe for concurrent access.
+func (a *AddrManager) SetAnchors(addrs []*wire.NetAddress) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	if len(addrs) > maxAnchors {
+		addrs = addrs[:maxAnchors]
+	}
+	a.anchors = make([]*wire.NetAddress, len(addrs))
+	copy(a.anchors, addrs)
+}
+
 // Start begins the core address handler which manages a pool of known
 // addresses, timeouts, and interval based writes.
 func (a *AddrManager) Start() {
@@ -574,6 +787,7 @@ func (a *AddrManager) Start() {
 
 	// Load peers we already know about from file.
 	a.loadPeers()
+	a.loadAnchors()
 
 	// Start the address ticker to save addresses periodically.
 	a.wg.Add(1)
@@ -602,7 +816,7 @@ func (a *AddrManager) AddAddresses(addrs []*wire.NetAddress, srcAddr *wire.NetAd
 	defer a.mtx.Unlock()
 
 	for _, na := range addrs {
-		a.updateAddress(na, srcAddr)
+		a.updateAddress(wire.NetAddressV2FromLegacy(na), srcAddr)
 	}
 }
 
@@ -613,7 +827,23 @@ func (a *AddrManager) AddAddress(addr, srcAddr *wire.NetAddress) {
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
-	a.updateAddress(addr, srcAddr)
+	a.updateAddress(wire.NetAddressV2FromLegacy(addr), srcAddr)
+}
+
+// AddAddressesV2 adds new addresses received by way of addrv2 messages to the
+// address manager.  Unlike AddAddresses, it also adds the addresses which can
+// only be represented in addrv2 messages, such as Tor v3, I2P and CJDNS
+// addresses.  Addresses of networks which are not reachable are retained so
+// they can be relayed to other peers, but they are never returned by
+// GetAddress.  Addresses of unknown networks are silently ignored.  It is
+// safe for concurrent access.
+func (a *AddrManager) AddAddressesV2(addrs []*wire.NetAddressV2, srcAddr *wire.NetAddress) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	for _, na := range addrs {
+		a.updateAddress(na, srcAddr)
+	}
 }
 
 // AddAddressByIP adds an address where we are given an ip:port and not a
@@ -682,8 +912,112 @@ func (a *AddrManager) AddressCache() []*wire.NetAddress {
 	return allAddr[0:numAddresses]
 }
 
+// AddressCacheV2 returns the current address cache in the form used by addrv2
+// messages.  Unlike AddressCache, the result also includes the addresses which
+// can only be represented in addrv2 messages.  The addresses are copies which
+// the caller may modify.
+func (a *AddrManager) AddressCacheV2() []*wire.NetAddressV2 {
+	allAddr := a.getAddressesV2()
+
+	numAddresses := len(allAddr) * getAddrPercent / 100
+	if numAddresses > getAddrMax {
+		numAddresses = getAddrMax
+	}
+
+	// Fisher-Yates shuffle the array. We only need to do the first
+	// `numAddresses' since we are throwing the rest.
+	for i := 0; i < numAddresses; i++ {
+		// pick a number between current index and the end
+		j := rand.Intn(len(allAddr)-i) + i
+		allAddr[i], allAddr[j] = allAddr[j], allAddr[i]
+	}
+
+	// slice off the limit we are willing to share.
+	return allAddr[0:numAddresses]
+}
+
+// GetAddrResponse returns the addresses to send in response to a getaddr
+// request from a peer that does not support addrv2 messages.  It is the same
+// as GetAddrResponseV2 except the addresses which can only be represented in
+// addrv2 messages are omitted.
+func (a *AddrManager) GetAddrResponse(key string) []*wire.NetAddress {
+	cached := a.GetAddrResponseV2(key)
+	addrs := make([]*wire.NetAddress, 0, len(cached))
+	for _, na := range cached {
+		if legacy, ok := na.ToLegacy(); ok {
+			addrs = append(addrs, legacy)
+		}
+	}
+	return addrs
+}
+
+// GetAddrResponseV2 returns the addresses to send in response to a getaddr
+// request in the form used by addrv2 messages.
+//
+// Rather than selecting a fresh random subset of the known addresses for every
+// request as AddressCacheV2 does, responses are cached per provided key for
+// roughly a day, so repeated requests can't be used to enumerate all of the
+// known addresses.  Callers typically derive the key from the local address and
+// network the request was received on, so the responses can't be used to link
+// the identities of a node reachable on multiple networks either.  In addition,
+// the timestamps of the addresses are rounded down to the nearest hour.
+//
+// The returned slice is a copy which the caller may modify, however, the
+// addresses it refers to must be treated as read-only.
+//
+// This function is safe for concurrent access.
+func (a *AddrManager) GetAddrResponseV2(key string) []*wire.NetAddressV2 {
+	a.getAddrCacheMtx.Lock()
+	defer a.getAddrCacheMtx.Unlock()
+
+	now := time.Now()
+	cached, ok := a.getAddrCache[key]
+	if !ok || !now.Before(cached.expires) {
+		// Remove all expired responses so responses for keys that are
+		// no longer used don't accumulate.
+		for k, resp := range a.getAddrCache {
+			if !now.Before(resp.expires) {
+				delete(a.getAddrCache, k)
+			}
+		}
+
+		// The addresses are copies, so rounding their timestamps does
+		// not affect the known addresses.
+		addrs := a.AddressCacheV2()
+		for _, na := range addrs {
+			na.Timestamp = na.Timestamp.Truncate(getAddrTimestampPrecision)
+		}
+		jitter := time.Duration(rand.Int63n(int64(getAddrCacheJitter)))
+		cached = &getAddrResponse{
+			addrs:   addrs,
+			expires: now.Add(getAddrCacheLifetime + jitter),
+		}
+		a.getAddrCache[key] = cached
+	}
+
+	addrs := make([]*wire.NetAddressV2, len(cached.addrs))
+	copy(addrs, cached.addrs)
+	return addrs
+}
+
+// getAddressesV2 returns copies of all of the addresses currently found within
+// the manager's address cache, including the addrv2-only addresses, in their
+// addrv2 form.
+func (a *AddrManager) getAddressesV2() []*wire.NetAddressV2 {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	addrs := make([]*wire.NetAddressV2, 0, len(a.addrIndex))
+	for _, v := range a.addrIndex {
+		addrCopy := *v.NetAddressV2()
+		addrs = append(addrs, &addrCopy)
+	}
+
+	return addrs
+}
+
 // getAddresses returns all of the addresses currently found within the
-// manager's address cache.
+// manager's address cache which can be represented as a wire.NetAddress.
 func (a *AddrManager) getAddresses() []*wire.NetAddress {
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
@@ -695,7 +1029,9 @@ func (a *AddrManager) getAddresses() []*wire.NetAddress {
 
 	addrs := make([]*wire.NetAddress, 0, addrIndexLen)
 	for _, v := range a.addrIndex {
-		addrs = append(addrs, v.na)
+		if v.na != nil {
+			addrs = append(addrs, v.na)
+		}
 	}
 
 	return addrs
@@ -706,6 +1042,7 @@ func (a *AddrManager) getAddresses() []*wire.NetAddress {
 func (a *AddrManager) reset() {
 
 	a.addrIndex = make(map[string]*KnownAddress)
+	a.nNetwork = make(map[wire.NetworkID]int)
 
 	// fill key with bytes from a good random source.
 	io.ReadFull(crand.Reader, a.key[:])
@@ -769,18 +1106,108 @@ func NetAddressKey(na *wire.NetAddress) string {
 	return net.JoinHostPort(ipString(na), port)
 }
 
+// NetAddressV2Key returns a string key in the form of host:port for the
+// provided NetAddressV2, where host is an IPv4 address, a bracketed IPv6
+// address or a .onion or .b32.i2p host name.  Addresses which can be
+// represented as a wire.NetAddress have the same key as returned by
+// NetAddressKey.
+func NetAddressV2Key(na *wire.NetAddressV2) string {
+	if legacy, ok := na.ToLegacy(); ok {
+		return NetAddressKey(legacy)
+	}
+	port := strconv.FormatUint(uint64(na.Port), 10)
+
+	return net.JoinHostPort(na.AddrString(), port)
+}
+
+// SetReachableNetworks sets the networks GetAddress selects addresses from to
+// the passed networks.  Addresses of the other networks are still stored and
+// relayed.  By default, the IPv4, IPv6 and Tor v2 networks are reachable.
+//
+// Note that addresses which can only be represented in addrv2 messages, such
+// as Tor v3 and I2P addresses, have no wire.NetAddress, so callers making
+// their networks reachable must use the NetAddressV2 of the known addresses.
+//
+// This function is safe for concurrent access.
+func (a *AddrManager) SetReachableNetworks(networks ...wire.NetworkID) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	a.reachable = make(map[wire.NetworkID]bool, len(networks))
+	for _, netID := range networks {
+		a.reachable[netID] = true
+	}
+}
+
+// ReachableNetworks returns the networks GetAddress selects addresses from in
+// ascending order.
+//
+// This function is safe for concurrent access.
+func (a *AddrManager) ReachableNetworks() []wire.NetworkID {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	networks := make([]wire.NetworkID, 0, len(a.reachable))
+	for netID := range a.reachable {
+		networks = append(networks, netID)
+	}
+	sort.Slice(networks, func(i, j int) bool {
+		return networks[i] < networks[j]
+	})
+	return networks
+}
+
 // GetAddress returns a single address that should be routable.  It picks a
-// random one from the possible addresses with preference given to ones that
-// have not been used recently and should not pick 'close' addresses
-// consecutively.
+// random one from the possible addresses of the reachable networks with
+// preference given to ones that have not been used recently and should not
+// pick 'close' addresses consecutively.
 func (a *AddrManager) GetAddress() *KnownAddress {
 	// Protect concurrent access.
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
-	if a.numAddresses() == 0 {
+	return a.getAddress(a.reachable)
+}
+
+// GetAddressForNetwork returns a single address of the passed network the same
+// way GetAddress does.  It allows callers to connect to peers on each of the
+// reachable networks rather than only on the network most known addresses
+// belong to.  Nil is returned when the network is not reachable or no address
+// of it is known.
+//
+// This function is safe for concurrent access.
+func (a *AddrManager) GetAddressForNetwork(netID wire.NetworkID) *KnownAddress {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	if !a.reachable[netID] {
 		return nil
 	}
+	return a.getAddress(map[wire.NetworkID]bool{netID: true})
+}
+
+// getAddress returns a single address of the passed networks.  See GetAddress
+// for details.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) getAddress(networks map[wire.NetworkID]bool) *KnownAddress {
+	var numAddrs int
+	for netID, n := range a.nNetwork {
+		if networks[netID] {
+			numAddrs += n
+		}
+	}
+	if numAddrs == 0 {
+		return nil
+	}
+
+	// Picking random entries from the buckets until one of the passed
+	// networks is found could take very long when most of the addresses
+	// belong to other networks, so select among the addresses of the
+	// passed networks directly in that case.
+	if numAddrs != a.numAddresses() {
+		return a.getAddressFiltered(networks)
+	}
 
 	// Use a 50% chance for choosing between tried and new table entries.
 	if a.nTried > 0 && (a.nNew == 0 || a.rand.Intn(2) == 0) {
@@ -802,9 +1229,9 @@ func (a *AddrManager) GetAddress() *KnownAddress {
 			}
 			ka := e.Value.(*KnownAddress)
 			randval := a.rand.Intn(large)
-			if float64(randval) < (factor * ka.chance() * float64(large)) {
+			if float64(randval) < (factor * a.chance(ka) * float64(large)) {
 				log.Tracef("Selected %v from tried bucket",
-					NetAddressKey(ka.na))
+					NetAddressV2Key(ka.NetAddressV2()))
 				return ka
 			}
 			factor *= 1.2
@@ -830,9 +1257,9 @@ func (a *AddrManager) GetAddress() *KnownAddress {
 				nth--
 			}
 			randval := a.rand.Intn(large)
-			if float64(randval) < (factor * ka.chance() * float64(large)) {
+			if float64(randval) < (factor * a.chance(ka) * float64(large)) {
 				log.Tracef("Selected %v from new bucket",
-					NetAddressKey(ka.na))
+					NetAddressV2Key(ka.NetAddressV2()))
 				return ka
 			}
 			factor *= 1.2
@@ -840,6 +1267,96 @@ func (a *AddrManager) GetAddress() *KnownAddress {
 	}
 }
 
+// getAddressFiltered returns a single address of the passed networks using the
+// same selection probabilities as getAddress, but by considering all known
+// addresses of the networks instead of picking random entries from the
+// buckets.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) getAddressFiltered(networks map[wire.NetworkID]bool) *KnownAddress {
+	var tried, untried []*KnownAddress
+	for _, ka := range a.addrIndex {
+		if !networks[ka.Network()] {
+			continue
+		}
+		if ka.tried {
+			tried = append(tried, ka)
+		} else {
+			untried = append(untried, ka)
+		}
+	}
+
+	// Use a 50% chance for choosing between tried and new table entries.
+	candidates := untried
+	if len(tried) > 0 && (len(untried) == 0 || a.rand.Intn(2) == 0) {
+		candidates = tried
+	}
+
+	ka := a.selectAddress(candidates)
+	log.Tracef("Selected %v of network %v", NetAddressV2Key(ka.NetAddressV2()),
+		ka.Network())
+	return ka
+}
+
+// selectAddress returns one of the passed candidates, which must not be empty,
+// chosen at random according to their selection probabilities.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) selectAddress(candidates []*KnownAddress) *KnownAddress {
+	large := 1 << 30
+	factor := 1.0
+	for {
+		ka := candidates[a.rand.Intn(len(candidates))]
+		randval := a.rand.Intn(large)
+		if float64(randval) < (factor * a.chance(ka) * float64(large)) {
+			return ka
+		}
+		factor *= 1.2
+	}
+}
+
+// GetFeelerAddress returns a single address of the reachable networks from the
+// new buckets to test with a short-lived feeler connection, so it is moved to
+// the tried buckets when it turns out to be reachable.  Nil is returned when
+// there is no such address.
+//
+// This function is safe for concurrent access.
+func (a *AddrManager) GetFeelerAddress() *KnownAddress {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	if a.nNew == 0 {
+		return nil
+	}
+
+	var candidates []*KnownAddress
+	for _, ka := range a.addrIndex {
+		if !ka.tried && a.reachable[ka.Network()] {
+			candidates = append(candidates, ka)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	ka := a.selectAddress(candidates)
+	log.Tracef("Selected %v from new bucket for feeler",
+		NetAddressV2Key(ka.NetAddressV2()))
+	return ka
+}
+
+// chance returns the selection probability for the given known address, which
+// is greatly reduced while the address is discouraged.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) chance(ka *KnownAddress) float64 {
+	c := ka.chance()
+	if ka.na != nil && a.isDiscouraged(ka.na) {
+		c *= discouragedChance
+	}
+	return c
+}
+
 func (a *AddrManager) find(addr *wire.NetAddress) *KnownAddress {
 	return a.addrIndex[NetAddressKey(addr)]
 }
@@ -876,11 +1393,11 @@ func (a *AddrManager) Connected(addr *wire.NetAddress) {
 	// Update the time as long as it has been 20 minutes since last we did
 	// so.
 	now := time.Now()
-	if now.After(ka.na.Timestamp.Add(time.Minute * 20)) {
-		// ka.na is immutable, so replace it.
-		naCopy := *ka.na
-		naCopy.Timestamp = time.Now()
-		ka.na = &naCopy
+	if now.After(ka.timestamp().Add(time.Minute * 20)) {
+		// The address is immutable, so replace it.
+		addrCopy := *ka.NetAddressV2()
+		addrCopy.Timestamp = time.Now()
+		ka.setAddress(&addrCopy)
 	}
 }
 
@@ -895,7 +1412,14 @@ func (a *AddrManager) Good(addr *wire.NetAddress) {
 	if ka == nil {
 		return
 	}
+	a.good(ka)
+}
 
+// good marks the passed known address as good and moves it to the tried
+// buckets.  See Good for details.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) good(ka *KnownAddress) {
 	// ka.Timestamp is not updated here to avoid leaking information
 	// about currently connected peers.
 	now := time.Now()
@@ -912,7 +1436,7 @@ func (a *AddrManager) Good(addr *wire.NetAddress) {
 
 	// remove from all new buckets.
 	// record one of the buckets in question and call it the `first'
-	addrKey := NetAddressKey(addr)
+	addrKey := NetAddressV2Key(ka.NetAddressV2())
 	oldBucket := -1
 	for i := range a.addrNew {
 		// we check for existence so we can record the first one
@@ -931,7 +1455,7 @@ func (a *AddrManager) Good(addr *wire.NetAddress) {
 		return
 	}
 
-	bucket := a.getTriedBucket(ka.na)
+	bucket := a.getTriedBucket(ka.NetAddressV2())
 
 	// Room in this tried bucket?
 	if a.addrTried[bucket].Len() < triedBucketSize {
@@ -946,7 +1470,7 @@ func (a *AddrManager) Good(addr *wire.NetAddress) {
 	rmka := entry.Value.(*KnownAddress)
 
 	// First bucket it would have been put in.
-	newBucket := a.getNewBucket(rmka.na, rmka.srcAddr)
+	newBucket := a.getNewBucket(rmka.NetAddressV2(), rmka.srcAddr)
 
 	// If no room in the original bucket, we put it in a bucket we just
 	// freed up a space in.
@@ -966,7 +1490,7 @@ func (a *AddrManager) Good(addr *wire.NetAddress) {
 	// something back.
 	a.nNew++
 
-	rmkey := NetAddressKey(rmka.na)
+	rmkey := NetAddressV2Key(rmka.NetAddressV2())
 	log.Tracef("Replacing %s with %s in tried", rmkey, addrKey)
 
 	// We made sure there is space here just above.
@@ -984,14 +1508,54 @@ func (a *AddrManager) SetServices(addr *wire.NetAddress, services wire.ServiceFl
 	}
 
 	// Update the services if needed.
-	if ka.na.Services != services {
-		// ka.na is immutable, so replace it.
-		naCopy := *ka.na
-		naCopy.Services = services
-		ka.na = &naCopy
+	if ka.Services() != services {
+		// The address is immutable, so replace it.
+		addrCopy := *ka.NetAddressV2()
+		addrCopy.Services = services
+		ka.setAddress(&addrCopy)
 	}
 }
 
+// Discourage marks the IP address of the given address as belonging to a
+// misbehaving peer for the provided duration.  Discouraged addresses are very
+// unlikely to be returned by GetAddress while they are discouraged, regardless
+// of their port.
+//
+// This function is safe for concurrent access.
+func (a *AddrManager) Discourage(addr *wire.NetAddress, d time.Duration) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	// Remove all expired entries so they don't accumulate.
+	now := time.Now()
+	for ip, expires := range a.discouraged {
+		if !now.Before(expires) {
+			delete(a.discouraged, ip)
+		}
+	}
+	a.discouraged[addr.IP.String()] = now.Add(d)
+}
+
+// isDiscouraged returns whether or not the IP address of the given address is
+// currently discouraged.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) isDiscouraged(addr *wire.NetAddress) bool {
+	expires, ok := a.discouraged[addr.IP.String()]
+	return ok && time.Now().Before(expires)
+}
+
+// IsDiscouraged returns whether or not the IP address of the given address is
+// currently discouraged.
+//
+// This function is safe for concurrent access.
+func (a *AddrManager) IsDiscouraged(addr *wire.NetAddress) bool {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	return a.isDiscouraged(addr)
+}
+
 // AddLocalAddress adds na to the list of known local addresses to advertise
 // with the given priority.
 func (a *AddrManager) AddLocalAddress(na *wire.NetAddress, priority AddressPriority) error {
@@ -1139,13 +1703,17 @@ func (a *AddrManager) GetBestLocalAddress(remoteAddr *wire.NetAddress) *wire.Net
 // Use Start to begin processing asynchronous address updates.
 func New(dataDir string, lookupFunc func(string) ([]net.IP, error)) *AddrManager {
 	am := AddrManager{
-		peersFile:      filepath.Join(dataDir, "peers.json"),
+		peersFile:      filepath.Join(dataDir, "peers.dat"),
+		jsonPeersFile:  filepath.Join(dataDir, "peers.json"),
+		anchorsFile:    filepath.Join(dataDir, "anchors.json"),
 		lookupFunc:     lookupFunc,
 		rand:           rand.New(rand.NewSource(time.Now().UnixNano())),
 		quit:           make(chan struct{}),
 		localAddresses: make(map[string]*localAddress),
-		version:        serialisationVersion,
+		getAddrCache:   make(map[string]*getAddrResponse),
+		discouraged:    make(map[string]time.Time),
 	}
 	am.reset()
+	am.SetReachableNetworks(defaultReachableNetworks...)
 	return &am
 }
@@ -1,39 +1,50 @@
 package addrmgr
 
 import (
+	"bytes"
+	"encoding/json"
 	"io/ioutil"
 	"math/rand"
 	"net"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/ifishnet/hdfd/wire"
 )
 
-// randAddr generates a *wire.NetAddress backed by a random IPv4/IPv6 address.
+// randAddr generates a routable *wire.NetAddress backed by a random IPv4/IPv6
+// address.
 func randAddr(t *testing.T) *wire.NetAddress {
 	t.Helper()
 
-	ipv4 := rand.Intn(2) == 0
-	var ip net.IP
-	if ipv4 {
-		var b [4]byte
-		if _, err := rand.Read(b[:]); err != nil {
-			t.Fatal(err)
+	// The address manager ignores non-routable addresses, so keep
+	// generating addresses until a routable one is found.
+	for {
+		ipv4 := rand.Intn(2) == 0
+		var ip net.IP
+		if ipv4 {
+			var b [4]byte
+			if _, err := rand.Read(b[:]); err != nil {
+				t.Fatal(err)
+			}
+			ip = b[:]
+		} else {
+			var b [16]byte
+			if _, err := rand.Read(b[:]); err != nil {
+				t.Fatal(err)
+			}
+			ip = b[:]
 		}
-		ip = b[:]
-	} else {
-		var b [16]byte
-		if _, err := rand.Read(b[:]); err != nil {
-			t.Fatal(err)
-		}
-		ip = b[:]
-	}
 
-	return &wire.NetAddress{
-		Services: wire.ServiceFlag(rand.Uint64()),
-		IP:       ip,
-		Port:     uint16(rand.Uint32()),
+		na := &wire.NetAddress{
+			Services: wire.ServiceFlag(rand.Uint64()),
+			IP:       ip,
+			Port:     uint16(rand.Uint32()),
+		}
+		if IsRoutable(na) {
+			return na
+		}
 	}
 }
 
@@ -118,8 +129,129 @@ func TestAddrManagerSerialization(t *testing.T) {
 	assertAddrs(t, addrMgr, expectedAddrs)
 }
 
+// TestAddrManagerSerializationV2 ensures that addresses which can only be
+// represented in addrv2 messages are properly serialized and deserialized
+// along with the other addresses.
+func TestAddrManagerSerializationV2(t *testing.T) {
+	t.Parallel()
+
+	tempDir, err := ioutil.TempDir("", "addrmgr")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	addrMgr := New(tempDir, nil)
+
+	now := time.Now()
+	pubKey := make([]byte, 32)
+	rand.Read(pubKey)
+	addrs := []*wire.NetAddressV2{
+		wire.NewNetAddressV2(now, wire.SFNodeNetwork, wire.NetIDIPv4,
+			[]byte{173, 194, 115, 66}, 8333),
+		wire.NewNetAddressV2(now, wire.SFNodeNetwork, wire.NetIDTorV3,
+			pubKey, 8333),
+		wire.NewNetAddressV2(now, wire.SFNodeWitness, wire.NetIDI2P,
+			pubKey, 0),
+		wire.NewNetAddressV2(now, wire.SFNodeNetwork, wire.NetIDCJDNS,
+			net.ParseIP("fc32:17ea:e415:c3bf:9808:149d:b5a2:c9aa"),
+			8333),
+	}
+	addrMgr.AddAddressesV2(addrs, randAddr(t))
+
+	// Mark the Tor v3 address as good so it is stored in a tried bucket.
+	addrMgr.mtx.Lock()
+	ka := addrMgr.addrIndex[NetAddressV2Key(addrs[1])]
+	if ka == nil {
+		addrMgr.mtx.Unlock()
+		t.Fatalf("Tor v3 address was not added")
+	}
+	addrMgr.good(ka)
+	addrMgr.mtx.Unlock()
+
+	addrMgr.savePeers()
+	addrMgr = New(tempDir, nil)
+	addrMgr.loadPeers()
+
+	loaded := make(map[string]*wire.NetAddressV2)
+	for _, na := range addrMgr.getAddressesV2() {
+		loaded[NetAddressV2Key(na)] = na
+	}
+	if len(loaded) != len(addrs) {
+		t.Fatalf("expected to find %d addresses, found %d",
+			len(addrs), len(loaded))
+	}
+	for _, want := range addrs {
+		got, ok := loaded[NetAddressV2Key(want)]
+		if !ok {
+			t.Fatalf("expected to find address %v",
+				NetAddressV2Key(want))
+		}
+		if got.NetworkID != want.NetworkID ||
+			!bytes.Equal(got.Addr, want.Addr) ||
+			got.Services != want.Services || got.Port != want.Port {
+
+			t.Fatalf("unexpected address %v, want %v", got, want)
+		}
+	}
+	if addrMgr.nTried != 1 || addrMgr.nNew != len(addrs)-1 {
+		t.Fatalf("unexpected number of tried %d and new %d addresses",
+			addrMgr.nTried, addrMgr.nNew)
+	}
+	if n := addrMgr.nNetwork[wire.NetIDTorV3]; n != 1 {
+		t.Fatalf("unexpected number of Tor v3 addresses %d", n)
+	}
+}
+
+// saveJSONPeers writes the addresses known to the passed address manager to
+// its peers file in the JSON format of the passed version, which was used
+// before the binary format.
+func saveJSONPeers(t *testing.T, a *AddrManager, version int) {
+	t.Helper()
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	sam := &serializedAddrManager{Version: version, Key: a.key}
+	for k, v := range a.addrIndex {
+		ska := &serializedKnownAddress{
+			Addr:        k,
+			Src:         NetAddressKey(v.srcAddr),
+			Attempts:    v.attempts,
+			TimeStamp:   v.timestamp().Unix(),
+			LastAttempt: v.lastattempt.Unix(),
+			LastSuccess: v.lastsuccess.Unix(),
+		}
+		if version > 1 {
+			ska.Services = v.Services()
+			ska.SrcServices = v.srcAddr.Services
+		}
+		sam.Addresses = append(sam.Addresses, ska)
+	}
+	for i := range a.addrNew {
+		for k := range a.addrNew[i] {
+			sam.NewBuckets[i] = append(sam.NewBuckets[i], k)
+		}
+	}
+	for i := range a.addrTried {
+		for e := a.addrTried[i].Front(); e != nil; e = e.Next() {
+			ka := e.Value.(*KnownAddress)
+			sam.TriedBuckets[i] = append(sam.TriedBuckets[i],
+				NetAddressV2Key(ka.NetAddressV2()))
+		}
+	}
+
+	data, err := json.Marshal(sam)
+	if err != nil {
+		t.Fatalf("unable to encode peers: %v", err)
+	}
+	if err := ioutil.WriteFile(a.jsonPeersFile, data, 0644); err != nil {
+		t.Fatalf("unable to write peers file: %v", err)
+	}
+}
+
 // TestAddrManagerV1ToV2 ensures that we can properly upgrade the serialized
-// version of the address manager from v1 to v2.
+// version of the address manager from v1 to the current binary format.
 func TestAddrManagerV1ToV2(t *testing.T) {
 	t.Parallel()
 
@@ -133,12 +265,9 @@ func TestAddrManagerV1ToV2(t *testing.T) {
 
 	addrMgr := New(tempDir, nil)
 
-	// As we're interested in testing the upgrade path from v1 to v2, we'll
-	// override the manager's current version.
-	addrMgr.version = 1
-
-	// We'll be adding 5 random addresses to the manager. Since this is v1,
-	// each addresses' services will not be stored.
+	// We'll be adding 5 random addresses to the manager. Since they are
+	// persisted in the v1 format, each addresses' services will not be
+	// stored.
 	const numAddrs = 5
 
 	expectedAddrs := make(map[string]*wire.NetAddress, numAddrs)
@@ -148,11 +277,10 @@ func TestAddrManagerV1ToV2(t *testing.T) {
 		addrMgr.AddAddress(addr, randAddr(t))
 	}
 
-	// Then, we'll persist these addresses to disk and restart the address
-	// manager - overriding its version back to v1.
-	addrMgr.savePeers()
+	// Then, we'll persist these addresses to disk in the v1 format and
+	// restart the address manager.
+	saveJSONPeers(t, addrMgr, 1)
 	addrMgr = New(tempDir, nil)
-	addrMgr.version = 1
 
 	// When we read all of the addresses back from disk, we should expect to
 	// find all of them, but their services will be set to a default of
@@ -180,11 +308,12 @@ func TestAddrManagerV1ToV2(t *testing.T) {
 		addrMgr.SetServices(addr, expectedAddr.Services)
 	}
 
-	// We'll also bump up the manager's version to v2, which should signal
-	// that it should include the address services when persisting its
-	// state.
-	addrMgr.version = 2
+	// Saving the addresses should write them in the current format, which
+	// includes the address services, and remove the old peers file.
 	addrMgr.savePeers()
+	if _, err := os.Stat(addrMgr.jsonPeersFile); !os.IsNotExist(err) {
+		t.Fatalf("old peers file was not removed: %v", err)
+	}
 
 	// Finally, we'll recreate the manager and ensure that the services were
 	// persisted correctly.
@@ -192,3 +321,106 @@ func TestAddrManagerV1ToV2(t *testing.T) {
 	addrMgr.loadPeers()
 	assertAddrs(t, addrMgr, expectedAddrs)
 }
+
+// TestPeersFileRecovery ensures that the backup of the peers file is loaded
+// when the peers file is corrupt or missing.
+func TestPeersFileRecovery(t *testing.T) {
+	t.Parallel()
+
+	tempDir, err := ioutil.TempDir("", "addrmgr")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	addrMgr := New(tempDir, nil)
+	expectedAddrs := make(map[string]*wire.NetAddress)
+	for i := 0; i < 5; i++ {
+		addr := randAddr(t)
+		expectedAddrs[NetAddressKey(addr)] = addr
+		addrMgr.AddAddress(addr, randAddr(t))
+	}
+	addrMgr.savePeers()
+
+	// Save another address, so the previous peers file becomes the backup,
+	// and corrupt the new peers file.
+	addrMgr.AddAddress(randAddr(t), randAddr(t))
+	addrMgr.savePeers()
+	data, err := ioutil.ReadFile(addrMgr.peersFile)
+	if err != nil {
+		t.Fatalf("unable to read peers file: %v", err)
+	}
+	data[len(data)/2] ^= 0xff
+	if err := ioutil.WriteFile(addrMgr.peersFile, data, 0644); err != nil {
+		t.Fatalf("unable to write peers file: %v", err)
+	}
+
+	addrMgr = New(tempDir, nil)
+	addrMgr.loadPeers()
+	assertAddrs(t, addrMgr, expectedAddrs)
+	if _, err := os.Stat(addrMgr.peersFile); !os.IsNotExist(err) {
+		t.Fatalf("corrupt peers file was not removed: %v", err)
+	}
+
+	// A truncated peers file must be detected the same way.
+	addrMgr.savePeers()
+	data, err = ioutil.ReadFile(addrMgr.peersFile)
+	if err != nil {
+		t.Fatalf("unable to read peers file: %v", err)
+	}
+	err = ioutil.WriteFile(addrMgr.peersFile, data[:len(data)-1], 0644)
+	if err != nil {
+		t.Fatalf("unable to write peers file: %v", err)
+	}
+	addrMgr = New(tempDir, nil)
+	addrMgr.loadPeers()
+	assertAddrs(t, addrMgr, expectedAddrs)
+}
+
+// TestAnchors ensures the anchors are persisted up to the maximum number of
+// them and that the anchors file is removed once it was loaded.
+func TestAnchors(t *testing.T) {
+	t.Parallel()
+
+	tempDir, err := ioutil.TempDir("", "addrmgr")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	addrMgr := New(tempDir, nil)
+	anchors := []*wire.NetAddress{
+		wire.NewNetAddressIPPort(net.IPv4(173, 194, 115, 66), 8333,
+			wire.SFNodeNetwork),
+		wire.NewNetAddressIPPort(net.ParseIP("2602:100::1"), 8333,
+			wire.SFNodeNetwork|wire.SFNodeWitness),
+		wire.NewNetAddressIPPort(net.IPv4(173, 194, 115, 67), 8333,
+			wire.SFNodeNetwork),
+	}
+	addrMgr.SetAnchors(anchors)
+	if got := addrMgr.Anchors(); len(got) != maxAnchors {
+		t.Fatalf("expected %d anchors, got %d", maxAnchors, len(got))
+	}
+	addrMgr.saveAnchors()
+
+	addrMgr = New(tempDir, nil)
+	addrMgr.loadAnchors()
+	got := addrMgr.Anchors()
+	if len(got) != maxAnchors {
+		t.Fatalf("expected %d loaded anchors, got %d", maxAnchors,
+			len(got))
+	}
+	for i, na := range got {
+		assertAddr(t, na, anchors[i])
+	}
+	if _, err := os.Stat(addrMgr.anchorsFile); !os.IsNotExist(err) {
+		t.Fatalf("anchors file was not removed after loading: %v", err)
+	}
+
+	// Loading without an anchors file must not result in any anchors.
+	addrMgr = New(tempDir, nil)
+	addrMgr.loadAnchors()
+	if got := addrMgr.Anchors(); len(got) != 0 {
+		t.Fatalf("expected no anchors, got %d", len(got))
+	}
+}
@@ -351,6 +351,73 @@ func TestGetAddress(t *testing.T) {
 	}
 }
 
+// TestGetFeelerAddress ensures only addresses in the new buckets are returned
+// to test with feeler connections.
+func TestGetFeelerAddress(t *testing.T) {
+	n := addrmgr.New("testgetfeeleraddress", lookupFunc)
+
+	// Get an address from an empty set.
+	if rv := n.GetFeelerAddress(); rv != nil {
+		t.Errorf("GetFeelerAddress failed: got: %v want: %v\n", rv, nil)
+	}
+
+	// Add a new address and get it.
+	err := n.AddAddressByIP(someIP + ":8333")
+	if err != nil {
+		t.Fatalf("Adding address failed: %v", err)
+	}
+	ka := n.GetFeelerAddress()
+	if ka == nil {
+		t.Fatalf("Did not get an address where there is one in the pool")
+	}
+	if ka.NetAddress().IP.String() != someIP {
+		t.Errorf("Wrong IP: got %v, want %v", ka.NetAddress().IP.String(), someIP)
+	}
+
+	// Mark this as a good address, which moves it to a tried bucket so it
+	// is no longer returned.
+	n.Good(ka.NetAddress())
+	if rv := n.GetFeelerAddress(); rv != nil {
+		t.Errorf("GetFeelerAddress failed: got: %v want: %v\n", rv, nil)
+	}
+}
+
+// TestDiscourage ensures addresses are discouraged by IP address regardless of
+// their port and only until their discouragement expires, and that discouraged
+// addresses are still returned when they are the only known addresses.
+func TestDiscourage(t *testing.T) {
+	n := addrmgr.New("testdiscourage", lookupFunc)
+
+	err := n.AddAddressByIP(someIP + ":8333")
+	if err != nil {
+		t.Fatalf("Adding address failed: %v", err)
+	}
+	ka := n.GetAddress()
+	if ka == nil {
+		t.Fatalf("Did not get an address where there is one in the pool")
+	}
+
+	otherPort := wire.NewNetAddressIPPort(ka.NetAddress().IP, 18333, 0)
+	otherIP := wire.NewNetAddressIPPort(net.ParseIP("173.194.115.67"),
+		8333, 0)
+	n.Discourage(otherPort, time.Hour)
+	if !n.IsDiscouraged(ka.NetAddress()) {
+		t.Errorf("Address with discouraged IP is not discouraged")
+	}
+	if n.IsDiscouraged(otherIP) {
+		t.Errorf("Address with other IP is discouraged")
+	}
+	if ka := n.GetAddress(); ka == nil {
+		t.Fatalf("Did not get the only address while it is discouraged")
+	}
+
+	// Discouragement which already expired must not apply.
+	n.Discourage(otherIP, -time.Second)
+	if n.IsDiscouraged(otherIP) {
+		t.Errorf("Address with expired discouragement is discouraged")
+	}
+}
+
 func TestGetBestLocalAddress(t *testing.T) {
 	localAddrs := []wire.NetAddress{
 		{IP: net.ParseIP("192.168.0.100")},
@@ -470,3 +537,165 @@ func TestNetAddressKey(t *testing.T) {
 	}
 
 }
+
+func TestAddAddressesV2(t *testing.T) {
+	n := addrmgr.New("testaddaddressesv2", lookupFunc)
+
+	// Add one address that can be represented as a legacy address along
+	// with a Tor v3 address, an I2P address, and an address of an unknown
+	// network.
+	now := time.Now()
+	ipv4 := wire.NewNetAddressV2(now, wire.SFNodeNetwork, wire.NetIDIPv4,
+		[]byte{173, 194, 115, 66}, 8333)
+	torV3 := wire.NewNetAddressV2(now, wire.SFNodeNetwork, wire.NetIDTorV3,
+		make([]byte, 32), 8333)
+	i2p := wire.NewNetAddressV2(now, wire.SFNodeNetwork, wire.NetIDI2P,
+		make([]byte, 32), 0)
+	unknown := wire.NewNetAddressV2(now, wire.SFNodeNetwork,
+		wire.NetworkID(0xaa), []byte{0x01}, 8333)
+	srcAddr := wire.NewNetAddressIPPort(net.IPv4(173, 144, 173, 111), 8333, 0)
+	n.AddAddressesV2([]*wire.NetAddressV2{ipv4, torV3, i2p, unknown},
+		srcAddr)
+
+	// All addresses of known networks are stored, but only the legacy
+	// address is reachable by default.
+	if numAddrs := n.NumAddresses(); numAddrs != 3 {
+		t.Fatalf("Number of addresses: got %d, want 3", numAddrs)
+	}
+	for i := 0; i < 10; i++ {
+		ka := n.GetAddress()
+		if ka == nil {
+			t.Fatalf("Did not get an address where there is one " +
+				"in the pool")
+		}
+		if key := addrmgr.NetAddressKey(ka.NetAddress()); key !=
+			"173.194.115.66:8333" {
+
+			t.Fatalf("Wrong address: got %v, want %v", key,
+				"173.194.115.66:8333")
+		}
+	}
+	if ka := n.GetAddressForNetwork(wire.NetIDTorV3); ka != nil {
+		t.Fatalf("Got address %v of unreachable network",
+			addrmgr.NetAddressV2Key(ka.NetAddressV2()))
+	}
+
+	// Ensure addresses of a network are returned once it is reachable.
+	n.SetReachableNetworks(wire.NetIDIPv4, wire.NetIDTorV3)
+	ka := n.GetAddressForNetwork(wire.NetIDTorV3)
+	if ka == nil {
+		t.Fatalf("Did not get an address of reachable network")
+	}
+	if ka.NetAddress() != nil || ka.Network() != wire.NetIDTorV3 ||
+		addrmgr.NetAddressV2Key(ka.NetAddressV2()) !=
+			addrmgr.NetAddressV2Key(torV3) {
+
+		t.Fatalf("Wrong address: got %v, want %v",
+			addrmgr.NetAddressV2Key(ka.NetAddressV2()),
+			addrmgr.NetAddressV2Key(torV3))
+	}
+	want := []wire.NetworkID{wire.NetIDIPv4, wire.NetIDTorV3}
+	if got := n.ReachableNetworks(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Reachable networks: got %v, want %v", got, want)
+	}
+
+	// Ensure the cache is sized based on all addresses of known networks,
+	// including the addrv2-only addresses, and that addresses of unknown
+	// networks are not included.
+	addrs := make([]*wire.NetAddressV2, 0, 10)
+	for i := 0; i < 10; i++ {
+		addrs = append(addrs, wire.NewNetAddressV2(now,
+			wire.SFNodeNetwork, wire.NetIDTorV3,
+			append(make([]byte, 31), byte(i+1)), 8333))
+	}
+	n.AddAddressesV2(addrs, srcAddr)
+	cache := n.AddressCacheV2()
+	wantLen := (len(addrs) + 3) * 23 / 100
+	if len(cache) != wantLen {
+		t.Fatalf("Number of addresses in cache: got %d, want %d",
+			len(cache), wantLen)
+	}
+	for _, na := range cache {
+		if !na.IsKnownNetwork() {
+			t.Errorf("Unexpected address of unknown network %v in "+
+				"cache", na.NetworkID)
+		}
+	}
+
+	// Ensure the textual keys of addrv2-only addresses use their network
+	// specific host names.
+	wantKey := "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa.b32.i2p:0"
+	if key := addrmgr.NetAddressV2Key(i2p); key != wantKey {
+		t.Errorf("NetAddressV2Key: got %s, want %s", key, wantKey)
+	}
+}
+
+func TestGetAddrResponse(t *testing.T) {
+	n := addrmgr.New("testgetaddrresponse", lookupFunc)
+
+	// Add addresses with timestamps that are not rounded to the hour.
+	timestamp := time.Unix(time.Now().Truncate(time.Hour).Unix()-1, 0)
+	addrsToAdd := 1000
+	addrs := make([]*wire.NetAddress, 0, addrsToAdd)
+	for i := 0; i < addrsToAdd; i++ {
+		ip := net.IPv4(byte(i/128+60), byte(i%128+60), 173, 147)
+		na := wire.NewNetAddressIPPort(ip, 8333, wire.SFNodeNetwork)
+		na.Timestamp = timestamp
+		addrs = append(addrs, na)
+	}
+	srcAddr := wire.NewNetAddressIPPort(net.IPv4(173, 144, 173, 111), 8333, 0)
+	n.AddAddresses(addrs, srcAddr)
+
+	// Ensure the response has the expected size and the timestamps of its
+	// addresses are rounded down to the hour.
+	resp := n.GetAddrResponseV2("ipv4|10.0.0.1:8333")
+	wantLen := n.NumAddresses() * 23 / 100
+	if len(resp) != wantLen {
+		t.Fatalf("Number of addresses in response: got %d, want %d",
+			len(resp), wantLen)
+	}
+	wantTimestamp := timestamp.Truncate(time.Hour)
+	for _, na := range resp {
+		if !na.Timestamp.Equal(wantTimestamp) {
+			t.Fatalf("Unexpected timestamp: got %v, want %v",
+				na.Timestamp, wantTimestamp)
+		}
+	}
+
+	// Ensure the timestamps of the known addresses are not modified.
+	for _, na := range n.AddressCache() {
+		if !na.Timestamp.Equal(timestamp) {
+			t.Fatalf("Known address timestamp modified: got %v, "+
+				"want %v", na.Timestamp, timestamp)
+		}
+	}
+
+	// Ensure repeated requests with the same key receive the same response
+	// and modifying it does not affect the cached response.
+	resp2 := n.GetAddrResponseV2("ipv4|10.0.0.1:8333")
+	if !reflect.DeepEqual(resp, resp2) {
+		t.Fatalf("Repeated request did not receive the same response")
+	}
+	resp2[0], resp2[1] = resp2[1], resp2[0]
+	if !reflect.DeepEqual(resp, n.GetAddrResponseV2("ipv4|10.0.0.1:8333")) {
+		t.Fatalf("Modifying response affected cached response")
+	}
+
+	// Ensure the legacy response consists of the same addresses.
+	legacy := n.GetAddrResponse("ipv4|10.0.0.1:8333")
+	if len(legacy) != len(resp) {
+		t.Fatalf("Number of addresses in legacy response: got %d, "+
+			"want %d", len(legacy), len(resp))
+	}
+	for i, na := range legacy {
+		if !reflect.DeepEqual(wire.NetAddressV2FromLegacy(na), resp[i]) {
+			t.Fatalf("Legacy address %d mismatch: got %v, want %v",
+				i, na, resp[i])
+		}
+	}
+
+	// Ensure requests with a different key receive a different response.
+	if reflect.DeepEqual(resp, n.GetAddrResponseV2("ipv6|[::1]:8333")) {
+		t.Fatalf("Request with different key received same response")
+	}
+}
@@ -0,0 +1,487 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package addrmgr
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"net"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// An ASMap maps IP address prefixes to the numbers of the autonomous systems
+// (ASes) that announce them.  It is encoded as a compact program for a small
+// virtual machine which consumes the bits of an IPv6 address, most
+// significant first, until it returns an AS number.  IPv4 addresses are
+// looked up as IPv4-mapped IPv6 addresses.  The format is the same one used by
+// Bitcoin Core, so the same ASMap files may be used.
+//
+// The bits of the program are read from each byte of the ASMap least
+// significant first.  Each instruction starts with its type which is followed
+// by its argument:
+//
+//   RETURN   return the AS number argument
+//   JUMP     consume one bit and skip the argument number of bits of the
+//            program when it is set
+//   MATCH    consume the bits of the argument after its leading one bit and
+//            return the default AS number unless all of them match
+//   DEFAULT  set the default AS number to the argument
+//
+// The arguments are encoded in a variable length format which is parametrized
+// by a minimum value and a list of bit sizes for each instruction, see
+// decodeBits.
+
+// asmapInstruction identifies the type of an ASMap instruction.
+type asmapInstruction uint32
+
+const (
+	asmapReturn asmapInstruction = iota
+	asmapJump
+	asmapMatch
+	asmapDefault
+)
+
+// asmapInvalid is returned by decodeBits when the program ends before the
+// value is complete.
+const asmapInvalid = 0xffffffff
+
+var (
+	// asmapTypeBitSizes, asmapASNBitSizes, asmapMatchBitSizes and
+	// asmapJumpBitSizes are the bit sizes used to encode instruction types
+	// and the arguments of each instruction.
+	asmapTypeBitSizes  = []uint8{0, 0, 1}
+	asmapASNBitSizes   = []uint8{15, 16, 17, 18, 19, 20, 21, 22, 23, 24}
+	asmapMatchBitSizes = []uint8{1, 2, 3, 4, 5, 6, 7, 8}
+	asmapJumpBitSizes  = []uint8{5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30}
+)
+
+// asmap is the program of an ASMap along with the position of the next bit to
+// be read while it is interpreted.
+type asmap struct {
+	data []byte
+	pos  int
+}
+
+// len returns the number of bits of the program.
+func (m *asmap) len() int {
+	return len(m.data) * 8
+}
+
+// bit returns the next bit of the program.  The caller must ensure the end of
+// the program has not been reached.
+func (m *asmap) bit() uint32 {
+	b := uint32(m.data[m.pos/8]>>(uint(m.pos)%8)) & 1
+	m.pos++
+	return b
+}
+
+// decodeBits decodes a value in the variable length encoding used by ASMaps.
+// Each of the passed bit sizes but the last is preceded by a bit which is set
+// when the value is too large to be encoded with it, in which case 1 shifted
+// by the size is added to the minimum value and the next size is tried.
+// Otherwise, that many bits follow which are added to it.  asmapInvalid is
+// returned when the end of the program is reached first.
+func (m *asmap) decodeBits(minVal uint32, bitSizes []uint8) uint32 {
+	val := minVal
+	for i, size := range bitSizes {
+		var bit uint32
+		if i != len(bitSizes)-1 {
+			if m.pos == m.len() {
+				break
+			}
+			bit = m.bit()
+		}
+		if bit == 1 {
+			val += 1 << size
+			continue
+		}
+		for b := uint8(0); b < size; b++ {
+			if m.pos == m.len() {
+				return asmapInvalid
+			}
+			val += m.bit() << (size - 1 - b)
+		}
+		return val
+	}
+	return asmapInvalid
+}
+
+func (m *asmap) decodeType() asmapInstruction {
+	return asmapInstruction(m.decodeBits(0, asmapTypeBitSizes))
+}
+
+func (m *asmap) decodeASN() uint32 {
+	return m.decodeBits(1, asmapASNBitSizes)
+}
+
+func (m *asmap) decodeMatch() uint32 {
+	return m.decodeBits(2, asmapMatchBitSizes)
+}
+
+func (m *asmap) decodeJump() uint32 {
+	return m.decodeBits(17, asmapJumpBitSizes)
+}
+
+// checkASMap ensures the passed ASMap is well formed for lookups of IPv6
+// addresses, which guarantees that every lookup returns an AS number.  Besides
+// instructions which would read past the end of the ASMap or the address, it
+// rejects ASMaps which are not encoded in the canonical way, such as those
+// with jumps into other instructions, unreachable instructions or excessive
+// padding.
+func checkASMap(data []byte) error {
+	type jump struct {
+		pos      int
+		bitsLeft int
+	}
+
+	m := &asmap{data: data}
+	bitsLeft := 128
+	var jumps []jump
+	prevOpcode := asmapJump
+	hadIncompleteMatch := false
+	for m.pos != m.len() {
+		if len(jumps) > 0 && m.pos >= jumps[len(jumps)-1].pos {
+			return errors.New("jump into the middle of an instruction")
+		}
+
+		switch opcode := m.decodeType(); opcode {
+		case asmapReturn:
+			if prevOpcode == asmapDefault {
+				return errors.New("return after default")
+			}
+			if m.decodeASN() == asmapInvalid {
+				return errors.New("AS number past the end")
+			}
+			if len(jumps) == 0 {
+				// Nothing to execute anymore, so only the
+				// padding to a full byte may follow.
+				if m.len()-m.pos > 7 {
+					return errors.New("excessive padding")
+				}
+				for m.pos != m.len() {
+					if m.bit() != 0 {
+						return errors.New("nonzero padding")
+					}
+				}
+				return nil
+			}
+
+			// Continue as if the most recent jump was taken.
+			last := jumps[len(jumps)-1]
+			if m.pos != last.pos {
+				return errors.New("unreachable instruction")
+			}
+			bitsLeft = last.bitsLeft
+			jumps = jumps[:len(jumps)-1]
+			prevOpcode = asmapJump
+
+		case asmapJump:
+			offset := m.decodeJump()
+			if offset == asmapInvalid {
+				return errors.New("jump offset past the end")
+			}
+			if int64(offset) > int64(m.len()-m.pos) {
+				return errors.New("jump past the end")
+			}
+			if bitsLeft == 0 {
+				return errors.New("jump past the end of the address")
+			}
+			bitsLeft--
+			target := m.pos + int(offset)
+			if len(jumps) > 0 && target >= jumps[len(jumps)-1].pos {
+				return errors.New("intersecting jumps")
+			}
+			jumps = append(jumps, jump{pos: target, bitsLeft: bitsLeft})
+			prevOpcode = asmapJump
+
+		case asmapMatch:
+			match := m.decodeMatch()
+			if match == asmapInvalid {
+				return errors.New("match past the end")
+			}
+			matchLen := bits.Len32(match) - 1
+			if prevOpcode != asmapMatch {
+				hadIncompleteMatch = false
+			}
+			if matchLen < 8 && hadIncompleteMatch {
+				return errors.New("more than one incomplete match")
+			}
+			hadIncompleteMatch = matchLen < 8
+			if bitsLeft < matchLen {
+				return errors.New("match past the end of the address")
+			}
+			bitsLeft -= matchLen
+			prevOpcode = asmapMatch
+
+		case asmapDefault:
+			if prevOpcode == asmapDefault {
+				return errors.New("successive defaults")
+			}
+			if m.decodeASN() == asmapInvalid {
+				return errors.New("AS number past the end")
+			}
+			prevOpcode = asmapDefault
+
+		default:
+			return errors.New("instruction past the end")
+		}
+	}
+	return errors.New("missing return")
+}
+
+// lookupASMap returns the AS number the passed IPv6 address is mapped to by
+// the passed ASMap.  The ASMap must have been checked with checkASMap.  Zero,
+// which is not a valid AS number, is returned for malformed ASMaps.
+func lookupASMap(data []byte, ip net.IP) uint32 {
+	m := &asmap{data: data}
+	bitsLeft := 128
+	ipBit := func() uint32 {
+		i := 128 - bitsLeft
+		return uint32(ip[i/8]>>(7-uint(i)%8)) & 1
+	}
+
+	var defaultASN uint32
+	for m.pos != m.len() {
+		switch m.decodeType() {
+		case asmapReturn:
+			asn := m.decodeASN()
+			if asn == asmapInvalid {
+				return 0
+			}
+			return asn
+
+		case asmapJump:
+			offset := m.decodeJump()
+			if offset == asmapInvalid || bitsLeft == 0 ||
+				int64(offset) >= int64(m.len()-m.pos) {
+
+				return 0
+			}
+			if ipBit() == 1 {
+				m.pos += int(offset)
+			}
+			bitsLeft--
+
+		case asmapMatch:
+			match := m.decodeMatch()
+			if match == asmapInvalid {
+				return 0
+			}
+			matchLen := bits.Len32(match) - 1
+			if bitsLeft < matchLen {
+				return 0
+			}
+			for i := 0; i < matchLen; i++ {
+				if ipBit() != (match>>uint(matchLen-1-i))&1 {
+					return defaultASN
+				}
+				bitsLeft--
+			}
+
+		case asmapDefault:
+			defaultASN = m.decodeASN()
+			if defaultASN == asmapInvalid {
+				return 0
+			}
+
+		default:
+			return 0
+		}
+	}
+	return 0
+}
+
+// asmapIP returns the IP address the AS number of the passed address is
+// looked up by in an ASMap.  IPv4 addresses, including those embedded in IPv6
+// transition addresses, are returned as IPv4-mapped IPv6 addresses.  Nil is
+// returned for addresses which are not mapped to an AS number, such as those
+// of overlay networks like Tor.
+func asmapIP(addr *wire.NetAddressV2) net.IP {
+	na, ok := addr.ToLegacy()
+	if !ok || !IsRoutable(na) || IsOnionCatTor(na) {
+		return nil
+	}
+
+	switch {
+	case IsIPv4(na):
+		return na.IP.To16()
+
+	case IsRFC6145(na) || IsRFC6052(na):
+		return net.IP(na.IP[12:16]).To16()
+
+	case IsRFC3964(na):
+		return net.IP(na.IP[2:6]).To16()
+
+	case IsRFC4380(na):
+		// Teredo tunnels have the last 4 bytes as the IPv4 address
+		// XOR 0xff.
+		ip := make(net.IP, 4)
+		for i, b := range na.IP[12:16] {
+			ip[i] = b ^ 0xff
+		}
+		return ip.To16()
+	}
+	return na.IP.To16()
+}
+
+// ASMapInfo describes the ASMap used by an address manager.
+type ASMapInfo struct {
+	// Loaded is whether an ASMap is used.  The other fields are only set
+	// when it is.
+	Loaded bool
+
+	// Size is the size of the ASMap in bytes.
+	Size int
+
+	// Checksum is the sha256 hash of the ASMap, which identifies it.
+	Checksum chainhash.Hash
+}
+
+// SetASMap sets the ASMap the address manager uses to group addresses by the
+// autonomous systems announcing them rather than by their /16 (IPv4) or /32
+// (IPv6) networks.  This way the addresses an attacker is able to control the
+// routing of cover fewer buckets, and callers may use GroupKey to diversify
+// their outbound connections across autonomous systems.  Addresses which are
+// not mapped to an autonomous system are grouped as before.
+//
+// It must be called before Start.  The known addresses are moved to the
+// buckets they belong in when they were bucketed with a different ASMap, or
+// without one, before.
+func (a *AddrManager) SetASMap(data []byte) error {
+	if err := checkASMap(data); err != nil {
+		return fmt.Errorf("malformed ASMap: %v", err)
+	}
+
+	a.mtx.Lock()
+	a.asmap = data
+	a.asmapChecksum = chainhash.HashH(data)
+	a.mtx.Unlock()
+	return nil
+}
+
+// ASMapInfo returns a description of the ASMap used by the address manager.
+//
+// This function is safe for concurrent access.
+func (a *AddrManager) ASMapInfo() ASMapInfo {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	if a.asmap == nil {
+		return ASMapInfo{}
+	}
+	return ASMapInfo{
+		Loaded:   true,
+		Size:     len(a.asmap),
+		Checksum: a.asmapChecksum,
+	}
+}
+
+// asn returns the number of the autonomous system the passed address is mapped
+// to by the ASMap, or zero when it is not mapped or there is no ASMap.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) asn(addr *wire.NetAddressV2) uint32 {
+	if a.asmap == nil {
+		return 0
+	}
+	ip := asmapIP(addr)
+	if ip == nil {
+		return 0
+	}
+	return lookupASMap(a.asmap, ip)
+}
+
+// ASN returns the number of the autonomous system the passed address is
+// mapped to by the ASMap.  Zero is returned when there is no ASMap or the
+// address is not mapped to an autonomous system.
+//
+// This function is safe for concurrent access.
+func (a *AddrManager) ASN(addr *wire.NetAddressV2) uint32 {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	return a.asn(addr)
+}
+
+// groupKey returns a string representing the network group the passed address
+// is part of.  Addresses mapped to an autonomous system by the ASMap are
+// grouped by it, and the others the same way as by GroupKeyV2.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) groupKey(addr *wire.NetAddressV2) string {
+	if asn := a.asn(addr); asn != 0 {
+		return fmt.Sprintf("as%d", asn)
+	}
+	return GroupKeyV2(addr)
+}
+
+// GroupKey returns a string representing the network group the passed address
+// is part of.  Unlike the GroupKey function, it groups the addresses mapped to
+// an autonomous system by the ASMap by that autonomous system.
+//
+// This function is safe for concurrent access.
+func (a *AddrManager) GroupKey(na *wire.NetAddress) string {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	return a.groupKey(wire.NetAddressV2FromLegacy(na))
+}
+
+// rebucket moves all known addresses to the buckets they belong in given the
+// current ASMap.  Addresses which no longer fit in a tried bucket are moved to
+// a new bucket instead, and addresses which no longer fit in a new bucket are
+// forgotten.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) rebucket() {
+	var tried, fresh []*KnownAddress
+	for i := range a.addrTried {
+		for e := a.addrTried[i].Front(); e != nil; e = e.Next() {
+			tried = append(tried, e.Value.(*KnownAddress))
+		}
+		a.addrTried[i].Init()
+	}
+	for i := range a.addrNew {
+		for _, ka := range a.addrNew[i] {
+			// Addresses in several buckets are only added once.
+			if ka.refs > 0 {
+				fresh = append(fresh, ka)
+				ka.refs = 0
+			}
+		}
+		a.addrNew[i] = make(map[string]*KnownAddress)
+	}
+	a.nTried = 0
+	a.nNew = 0
+
+	for _, ka := range tried {
+		bucket := a.getTriedBucket(ka.NetAddressV2())
+		if a.addrTried[bucket].Len() < triedBucketSize {
+			a.addrTried[bucket].PushBack(ka)
+			a.nTried++
+			continue
+		}
+		ka.tried = false
+		fresh = append(fresh, ka)
+	}
+	for _, ka := range fresh {
+		key := NetAddressV2Key(ka.NetAddressV2())
+		bucket := a.getNewBucket(ka.NetAddressV2(), ka.srcAddr)
+		if len(a.addrNew[bucket]) >= newBucketSize {
+			a.removeKnown(key, ka)
+			continue
+		}
+		ka.refs = 1
+		a.addrNew[bucket][key] = ka
+		a.nNew++
+	}
+
+	log.Infof("Moved %d addresses to the buckets of the ASMap",
+		a.numAddresses())
+}
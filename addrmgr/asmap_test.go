@@ -0,0 +1,161 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package addrmgr
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// encodeASMapBits returns the ASMap encoded by the passed string of zeros and
+// ones, which may contain spaces for readability.
+func encodeASMapBits(bits string) []byte {
+	bits = strings.Replace(bits, " ", "", -1)
+	data := make([]byte, (len(bits)+7)/8)
+	for i, c := range bits {
+		if c == '1' {
+			data[i/8] |= 1 << (uint(i) % 8)
+		}
+	}
+	return data
+}
+
+// testASMap maps all IPv6 addresses with the most significant bit set to AS
+// 200 and all other addresses, including IPv4 addresses, to AS 100.
+var testASMap = encodeASMapBits(
+	// JUMP 17 bits when the first bit is set.
+	"10 0 00000" +
+		// RETURN 100.
+		"0 0 000000001100011" +
+		// RETURN 200.
+		"0 0 000000011000111")
+
+// TestASMap ensures well formed ASMaps are accepted, malformed ones rejected,
+// and addresses looked up properly.
+func TestASMap(t *testing.T) {
+	t.Parallel()
+
+	if err := checkASMap(testASMap); err != nil {
+		t.Fatalf("unexpected error checking ASMap: %v", err)
+	}
+
+	malformed := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "truncated", data: testASMap[:len(testASMap)-1]},
+		{name: "nonzero padding", data: encodeASMapBits(
+			"10 0 00000 0 0 000000001100011 0 0 000000011000111 1")},
+		{name: "excessive padding", data: append(append([]byte(nil),
+			testASMap...), 0)},
+		{name: "return after default", data: encodeASMapBits(
+			"111 0 000000001100011 0 0 000000001100011")},
+	}
+	for _, test := range malformed {
+		if err := checkASMap(test.data); err == nil {
+			t.Errorf("%s: malformed ASMap was accepted", test.name)
+		}
+	}
+
+	tests := []struct {
+		ip  string
+		asn uint32
+	}{
+		{ip: "173.194.115.66", asn: 100},
+		{ip: "2001:470::1", asn: 100},
+		{ip: "c000::1", asn: 200},
+	}
+	for _, test := range tests {
+		ip := net.ParseIP(test.ip).To16()
+		if asn := lookupASMap(testASMap, ip); asn != test.asn {
+			t.Errorf("%s: unexpected AS number %d, want %d", test.ip,
+				asn, test.asn)
+		}
+	}
+}
+
+// TestASMapGroupKey ensures the address manager groups addresses by the AS
+// numbers they are mapped to when it uses an ASMap.
+func TestASMapGroupKey(t *testing.T) {
+	t.Parallel()
+
+	addrMgr := New("", nil)
+	if info := addrMgr.ASMapInfo(); info.Loaded {
+		t.Fatalf("unexpected ASMap info %+v", info)
+	}
+	if err := addrMgr.SetASMap(testASMap); err != nil {
+		t.Fatalf("unable to set ASMap: %v", err)
+	}
+	if info := addrMgr.ASMapInfo(); !info.Loaded ||
+		info.Size != len(testASMap) {
+
+		t.Fatalf("unexpected ASMap info %+v", info)
+	}
+
+	tests := []struct {
+		ip       string
+		expected string
+	}{
+		{ip: "173.194.115.66", expected: "as100"},
+		{ip: "12.1.2.3", expected: "as100"},
+		// 6to4 addresses are looked up by their embedded IPv4 address.
+		{ip: "2002:0c01:0203::", expected: "as100"},
+		{ip: "c000::1", expected: "as200"},
+		// Tor addresses are not mapped to an AS.
+		{ip: "fd87:d87e:eb43:1234::", expected: "tor:2"},
+		{ip: "127.0.0.1", expected: "local"},
+	}
+	for _, test := range tests {
+		na := wire.NewNetAddressIPPort(net.ParseIP(test.ip), 8333, 0)
+		if key := addrMgr.GroupKey(na); key != test.expected {
+			t.Errorf("%s: unexpected group key %s, want %s", test.ip,
+				key, test.expected)
+		}
+	}
+}
+
+// TestASMapRebucket ensures addresses which were bucketed without an ASMap
+// are moved to the buckets they belong in once it is used.
+func TestASMapRebucket(t *testing.T) {
+	t.Parallel()
+
+	tempDir, err := ioutil.TempDir("", "addrmgr")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	addrMgr := New(tempDir, nil)
+	expectedAddrs := make(map[string]*wire.NetAddress)
+	for i := 0; i < 5; i++ {
+		addr := randAddr(t)
+		expectedAddrs[NetAddressKey(addr)] = addr
+		addrMgr.AddAddress(addr, randAddr(t))
+	}
+	addrMgr.savePeers()
+
+	addrMgr = New(tempDir, nil)
+	if err := addrMgr.SetASMap(testASMap); err != nil {
+		t.Fatalf("unable to set ASMap: %v", err)
+	}
+	addrMgr.loadPeers()
+	assertAddrs(t, addrMgr, expectedAddrs)
+
+	addrMgr.mtx.Lock()
+	defer addrMgr.mtx.Unlock()
+	for key, ka := range addrMgr.addrIndex {
+		bucket := addrMgr.getNewBucket(ka.NetAddressV2(), ka.srcAddr)
+		if addrMgr.addrNew[bucket][key] != ka {
+			t.Fatalf("address %s is not in new bucket %d", key,
+				bucket)
+		}
+	}
+}
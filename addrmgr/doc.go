@@ -34,5 +34,52 @@ provided by the caller about connected, known good, and attempted addresses to
 periodically purge peers which no longer appear to be good peers as well as
 bias the selection toward known good peers.  The general idea is to make a best
 effort at only providing usable addresses.
+
+Address Networks
+
+Besides IPv4, IPv6 and OnionCat encoded Tor addresses, the address manager
+stores the addresses of the other networks which are relayed in addrv2 messages
+(BIP0155), such as Tor v3, I2P and CJDNS addresses.  They are bucketed and
+persisted the same way as the other addresses, however, only addresses of the
+networks the caller marked as reachable with SetReachableNetworks are selected
+by GetAddress.  GetAddressForNetwork allows callers to select an address of a
+specific network, for example so they are connected to at least one peer on
+each reachable network.
+
+Peers File
+
+The known addresses are periodically saved to the peers.dat file in the data
+directory in a compact binary format.  Each save writes a new file which
+replaces the previous one only once it is completely written, and the previous
+file is kept as a backup.  The file includes a checksum, so when it was
+corrupted, the addresses are loaded from the backup instead.  A peers.json file
+written by previous versions is loaded when there is no peers.dat file yet.
+
+Autonomous Systems
+
+By default, addresses are grouped by their /16 (IPv4) or /32 (IPv6) networks.
+When the caller provides an ASMap, which maps IP address prefixes to the
+autonomous systems announcing them, with SetASMap, they are grouped by their
+autonomous systems instead.  GroupKey returns the group of an address so
+callers are able to spread their outbound connections across groups.
+
+Anchors
+
+The caller may provide the addresses of its most valuable outbound peers as
+anchors with SetAnchors when shutting down.  They are written to a separate
+file when the address manager is stopped and returned by Anchors after the next
+start, so the caller is able to reconnect to them before making any other
+outbound connections.  This makes it harder for an attacker to take over all
+outbound connections of a node by forcing it to restart.  The file is removed
+once it was read, so a node which keeps crashing does not keep reconnecting to
+the same peers.
+
+Portable Address Export
+
+The addresses known to an address manager may be written with Export and read
+back into another address manager with Import.  The portable format is
+versioned, compressed, and does not depend on the secret bucketing key of the
+exporting address manager, so it may be used to pre-seed new nodes with a
+curated list of peers or to migrate known addresses between nodes.
 */
 package addrmgr
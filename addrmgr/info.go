@@ -0,0 +1,181 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package addrmgr
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// AddressInfo describes an address known to the address manager along with
+// the metadata it keeps about the address.  It is a copy which is not updated
+// when the address manager learns more about the address.
+type AddressInfo struct {
+	// Addr is the address along with the time it was last seen and the
+	// services it was last known to support.
+	Addr *wire.NetAddressV2
+
+	// Network is the network the address belongs to as returned by
+	// AddrNetwork.
+	Network wire.NetworkID
+
+	// Source is the address of the peer the address was first received
+	// from.
+	Source *wire.NetAddress
+
+	// Attempts is the number of connection attempts since the last
+	// successful connection to the address.
+	Attempts int
+
+	// LastAttempt and LastSuccess are the times of the most recent
+	// connection attempt and successful connection.  They are zero when
+	// there was none.
+	LastAttempt time.Time
+	LastSuccess time.Time
+
+	// Tried is whether the address is in a tried bucket.  NewBuckets is the
+	// number of new buckets the address is in otherwise.
+	Tried      bool
+	NewBuckets int
+
+	// ASN is the number of the autonomous system the address is mapped to
+	// by the ASMap, or zero when it isn't.
+	ASN uint32
+}
+
+// NetworkCounts holds the number of addresses of a network in the new and
+// tried buckets.
+type NetworkCounts struct {
+	New   int
+	Tried int
+}
+
+// BucketContents holds the addresses in each of the new and tried buckets of
+// the address manager.  The addresses in each tried bucket are in the order
+// they were added to it, and those in each new bucket are sorted by their
+// keys.
+type BucketContents struct {
+	New   [][]*AddressInfo
+	Tried [][]*AddressInfo
+}
+
+// addressInfo returns a description of the passed known address.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) addressInfo(ka *KnownAddress) *AddressInfo {
+	kaAddr := ka.NetAddressV2()
+	addr := *kaAddr
+	addr.Addr = make([]byte, len(kaAddr.Addr))
+	copy(addr.Addr, kaAddr.Addr)
+
+	var src *wire.NetAddress
+	if ka.srcAddr != nil {
+		srcAddr := *ka.srcAddr
+		src = &srcAddr
+	}
+
+	info := &AddressInfo{
+		Addr:       &addr,
+		Network:    ka.Network(),
+		Source:     src,
+		Attempts:   ka.attempts,
+		Tried:      ka.tried,
+		NewBuckets: ka.refs,
+		ASN:        a.asn(kaAddr),
+	}
+	// Persisted addresses which were never attempted have the zero Unix
+	// time rather than the zero time.
+	if ka.lastattempt.Unix() > 0 {
+		info.LastAttempt = ka.lastattempt
+	}
+	if ka.lastsuccess.Unix() > 0 {
+		info.LastSuccess = ka.lastsuccess
+	}
+	return info
+}
+
+// AddressInfo returns a description of the passed address along with the
+// metadata the address manager keeps about it.  Nil is returned when the
+// address is not known.
+//
+// This function is safe for concurrent access.
+func (a *AddrManager) AddressInfo(addr *wire.NetAddressV2) *AddressInfo {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	ka := a.addrIndex[NetAddressV2Key(addr)]
+	if ka == nil {
+		return nil
+	}
+	return a.addressInfo(ka)
+}
+
+// NetworkCounts returns the number of addresses in the new and tried buckets
+// for each network the address manager knows addresses of.
+//
+// This function is safe for concurrent access.
+func (a *AddrManager) NetworkCounts() map[wire.NetworkID]NetworkCounts {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	counts := make(map[wire.NetworkID]NetworkCounts, len(a.nNetwork))
+	for _, ka := range a.addrIndex {
+		netCounts := counts[ka.Network()]
+		if ka.tried {
+			netCounts.Tried++
+		} else {
+			netCounts.New++
+		}
+		counts[ka.Network()] = netCounts
+	}
+	return counts
+}
+
+// BucketContents returns the addresses in each of the new and tried buckets.
+// Addresses in several new buckets are included in each of them.  It is
+// intended for debugging, for example to find out whether the buckets were
+// polluted by the addresses of a single source.
+//
+// This function is safe for concurrent access.
+func (a *AddrManager) BucketContents() *BucketContents {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	// Addresses in several new buckets share the same description.
+	infos := make(map[*KnownAddress]*AddressInfo, len(a.addrIndex))
+	info := func(ka *KnownAddress) *AddressInfo {
+		if info, ok := infos[ka]; ok {
+			return info
+		}
+		info := a.addressInfo(ka)
+		infos[ka] = info
+		return info
+	}
+
+	contents := &BucketContents{
+		New:   make([][]*AddressInfo, len(a.addrNew)),
+		Tried: make([][]*AddressInfo, len(a.addrTried)),
+	}
+	for i := range a.addrNew {
+		keys := make([]string, 0, len(a.addrNew[i]))
+		for k := range a.addrNew[i] {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			contents.New[i] = append(contents.New[i],
+				info(a.addrNew[i][k]))
+		}
+	}
+	for i := range a.addrTried {
+		for e := a.addrTried[i].Front(); e != nil; e = e.Next() {
+			contents.Tried[i] = append(contents.Tried[i],
+				info(e.Value.(*KnownAddress)))
+		}
+	}
+	return contents
+}
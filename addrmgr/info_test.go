@@ -0,0 +1,100 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package addrmgr
+
+import (
+	"net"
+	"testing"
+
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// TestAddrManagerInfo ensures the introspection methods of the address manager
+// describe the addresses it knows and the buckets they are in.
+func TestAddrManagerInfo(t *testing.T) {
+	t.Parallel()
+
+	addrMgr := New("", nil)
+	srcAddr := wire.NewNetAddressIPPort(net.ParseIP("173.144.173.111"),
+		8333, 0)
+	newAddr := wire.NewNetAddressIPPort(net.ParseIP("173.194.115.66"),
+		8333, wire.SFNodeNetwork)
+	triedAddr := wire.NewNetAddressIPPort(net.ParseIP("2001:470::1"),
+		8333, wire.SFNodeNetwork)
+	addrMgr.AddAddress(newAddr, srcAddr)
+	addrMgr.AddAddress(triedAddr, srcAddr)
+	addrMgr.Attempt(triedAddr)
+	addrMgr.Good(triedAddr)
+
+	info := addrMgr.AddressInfo(wire.NetAddressV2FromLegacy(newAddr))
+	if info == nil {
+		t.Fatalf("no info for known address %s", NetAddressKey(newAddr))
+	}
+	if info.Tried || info.NewBuckets != 1 || info.Attempts != 0 ||
+		!info.LastAttempt.IsZero() || !info.LastSuccess.IsZero() {
+
+		t.Fatalf("unexpected info for new address %+v", info)
+	}
+	if info.Network != wire.NetIDIPv4 || NetAddressKey(info.Source) !=
+		NetAddressKey(srcAddr) {
+
+		t.Fatalf("unexpected info for new address %+v", info)
+	}
+
+	info = addrMgr.AddressInfo(wire.NetAddressV2FromLegacy(triedAddr))
+	if info == nil {
+		t.Fatalf("no info for known address %s",
+			NetAddressKey(triedAddr))
+	}
+	if !info.Tried || info.NewBuckets != 0 || info.Network != wire.NetIDIPv6 ||
+		info.LastAttempt.IsZero() || info.LastSuccess.IsZero() {
+
+		t.Fatalf("unexpected info for tried address %+v", info)
+	}
+
+	unknown := wire.NetAddressV2FromLegacy(wire.NewNetAddressIPPort(
+		net.ParseIP("12.1.2.3"), 8333, 0))
+	if info := addrMgr.AddressInfo(unknown); info != nil {
+		t.Fatalf("unexpected info for unknown address %+v", info)
+	}
+
+	counts := addrMgr.NetworkCounts()
+	if len(counts) != 2 || counts[wire.NetIDIPv4] != (NetworkCounts{New: 1}) ||
+		counts[wire.NetIDIPv6] != (NetworkCounts{Tried: 1}) {
+
+		t.Fatalf("unexpected network counts %+v", counts)
+	}
+
+	contents := addrMgr.BucketContents()
+	if len(contents.New) != newBucketCount ||
+		len(contents.Tried) != triedBucketCount {
+
+		t.Fatalf("unexpected number of buckets %d new, %d tried",
+			len(contents.New), len(contents.Tried))
+	}
+	var numNew, numTried int
+	for _, bucket := range contents.New {
+		for _, info := range bucket {
+			numNew++
+			if NetAddressV2Key(info.Addr) != NetAddressKey(newAddr) {
+				t.Fatalf("unexpected address %s in new bucket",
+					NetAddressV2Key(info.Addr))
+			}
+		}
+	}
+	for _, bucket := range contents.Tried {
+		for _, info := range bucket {
+			numTried++
+			if NetAddressV2Key(info.Addr) != NetAddressKey(triedAddr) {
+				t.Fatalf("unexpected address %s in tried bucket",
+					NetAddressV2Key(info.Addr))
+			}
+		}
+	}
+	if numNew != 1 || numTried != 1 {
+		t.Fatalf("unexpected number of addresses %d new, %d tried",
+			numNew, numTried)
+	}
+}
@@ -13,7 +13,8 @@ import (
 // KnownAddress tracks information about a known network address that is used
 // to determine how viable an address is.
 type KnownAddress struct {
-	na          *wire.NetAddress
+	na          *wire.NetAddress   // nil when not representable.
+	addrV2      *wire.NetAddressV2 // nil when na is set.
 	srcAddr     *wire.NetAddress
 	attempts    int
 	lastattempt time.Time
@@ -22,12 +23,51 @@ type KnownAddress struct {
 	refs        int // reference count of new buckets
 }
 
+// setAddress replaces the address of the known address.  The addresses are
+// treated as immutable, so they are replaced rather than modified in place.
+//
+// Addresses which can be represented by a wire.NetAddress are only stored in
+// that form so the address returned by NetAddress is the one which is updated
+// by the address manager.
+func (ka *KnownAddress) setAddress(addr *wire.NetAddressV2) {
+	if na, ok := addr.ToLegacy(); ok {
+		ka.na = na
+		ka.addrV2 = nil
+		return
+	}
+	ka.na = nil
+	ka.addrV2 = addr
+}
+
 // NetAddress returns the underlying wire.NetAddress associated with the
-// known address.
+// known address.  It is nil for addresses which can only be represented in
+// addrv2 messages, such as Tor v3 and I2P addresses.
 func (ka *KnownAddress) NetAddress() *wire.NetAddress {
 	return ka.na
 }
 
+// NetAddressV2 returns the address associated with the known address in the
+// form used by addrv2 messages.
+func (ka *KnownAddress) NetAddressV2() *wire.NetAddressV2 {
+	if ka.na != nil {
+		return wire.NetAddressV2FromLegacy(ka.na)
+	}
+	return ka.addrV2
+}
+
+// timestamp returns the last time the known address was seen.
+func (ka *KnownAddress) timestamp() time.Time {
+	if ka.na != nil {
+		return ka.na.Timestamp
+	}
+	return ka.addrV2.Timestamp
+}
+
+// Network returns the network the known address belongs to.
+func (ka *KnownAddress) Network() wire.NetworkID {
+	return AddrNetwork(ka.NetAddressV2())
+}
+
 // LastAttempt returns the last time the known address was attempted.
 func (ka *KnownAddress) LastAttempt() time.Time {
 	return ka.lastattempt
@@ -35,7 +75,10 @@ func (ka *KnownAddress) LastAttempt() time.Time {
 
 // Services returns the services supported by the peer with the known address.
 func (ka *KnownAddress) Services() wire.ServiceFlag {
-	return ka.na.Services
+	if ka.na != nil {
+		return ka.na.Services
+	}
+	return ka.addrV2.Services
 }
 
 // chance returns the selection probability for a known address.  The priority
@@ -78,12 +121,12 @@ func (ka *KnownAddress) isBad() bool {
 	}
 
 	// From the future?
-	if ka.na.Timestamp.After(time.Now().Add(10 * time.Minute)) {
+	if ka.timestamp().After(time.Now().Add(10 * time.Minute)) {
 		return true
 	}
 
 	// Over a month old?
-	if ka.na.Timestamp.Before(time.Now().Add(-1 * numMissingDays * time.Hour * 24)) {
+	if ka.timestamp().Before(time.Now().Add(-1 * numMissingDays * time.Hour * 24)) {
 		return true
 	}
 
@@ -279,3 +279,65 @@ func GroupKey(na *wire.NetAddress) string {
 
 	return na.IP.Mask(net.CIDRMask(bits, 128)).String()
 }
+
+// AddrNetwork returns the network the passed address belongs to.  Unlike the
+// network ID of the address itself, IPv6 addresses in the range used by
+// OnionCat to encode Tor v2 addresses are reported as part of the Tor v2
+// network.
+func AddrNetwork(addr *wire.NetAddressV2) wire.NetworkID {
+	if addr.NetworkID == wire.NetIDIPv6 &&
+		onionCatNet.Contains(net.IP(addr.Addr)) {
+
+		return wire.NetIDTorV2
+	}
+	return addr.NetworkID
+}
+
+// IsRoutableV2 returns whether or not the passed address is routable over
+// its network.  Addresses which can be represented as a wire.NetAddress are
+// routable under the same conditions as for IsRoutable.  Tor v3 and I2P
+// addresses are always routable, CJDNS addresses are routable when they are
+// within the fc00::/8 range used by CJDNS, and addresses of other networks,
+// including Tor v2 addresses which are not encoded by way of OnionCat, are
+// never routable.
+func IsRoutableV2(addr *wire.NetAddressV2) bool {
+	if na, ok := addr.ToLegacy(); ok {
+		return IsRoutable(na)
+	}
+
+	switch addr.NetworkID {
+	case wire.NetIDTorV3, wire.NetIDI2P:
+		return len(addr.Addr) == 32
+
+	case wire.NetIDCJDNS:
+		return len(addr.Addr) == net.IPv6len && addr.Addr[0] == 0xfc
+	}
+
+	return false
+}
+
+// GroupKeyV2 returns a string representing the network group the passed
+// address is part of.  It is the same as GroupKey for addresses which can be
+// represented as a wire.NetAddress.  Tor v3 and I2P addresses are grouped by
+// the first 4 bits of their public key the same way OnionCat addresses are,
+// and CJDNS addresses are grouped by their /16 since the whole network shares
+// the same /8.
+func GroupKeyV2(addr *wire.NetAddressV2) string {
+	if na, ok := addr.ToLegacy(); ok {
+		return GroupKey(na)
+	}
+	if !IsRoutableV2(addr) {
+		return "unroutable"
+	}
+
+	switch addr.NetworkID {
+	case wire.NetIDTorV3:
+		return fmt.Sprintf("torv3:%d", addr.Addr[0]&((1<<4)-1))
+
+	case wire.NetIDI2P:
+		return fmt.Sprintf("i2p:%d", addr.Addr[0]&((1<<4)-1))
+	}
+
+	// OK, so now we know ourselves to be a CJDNS address.
+	return "cjdns:" + net.IP(addr.Addr).Mask(net.CIDRMask(16, 128)).String()
+}
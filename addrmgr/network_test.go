@@ -7,6 +7,7 @@ package addrmgr_test
 import (
 	"net"
 	"testing"
+	"time"
 
 	"github.com/ifishnet/hdfd/addrmgr"
 	"github.com/ifishnet/hdfd/wire"
@@ -200,3 +201,54 @@ func TestGroupKey(t *testing.T) {
 		}
 	}
 }
+
+// TestGroupKeyV2 tests the GroupKeyV2 function to ensure it properly groups
+// addresses of the networks which can only be represented in addrv2 messages
+// and groups the other addresses the same way as GroupKey.
+func TestGroupKeyV2(t *testing.T) {
+	cjdns := net.ParseIP("fc32:17ea:e415:c3bf:9808:149d:b5a2:c9aa")
+	tests := []struct {
+		name     string
+		netID    wire.NetworkID
+		addr     []byte
+		network  wire.NetworkID
+		expected string
+	}{
+		{name: "ipv4", netID: wire.NetIDIPv4, addr: []byte{12, 1, 2, 3},
+			network: wire.NetIDIPv4, expected: "12.1.0.0"},
+		{name: "ipv6 tor onioncat", netID: wire.NetIDIPv6,
+			addr:    net.ParseIP("fd87:d87e:eb43:1234::5678"),
+			network: wire.NetIDTorV2, expected: "tor:2"},
+		{name: "tor v3", netID: wire.NetIDTorV3,
+			addr:    append([]byte{0x35}, make([]byte, 31)...),
+			network: wire.NetIDTorV3, expected: "torv3:5"},
+		{name: "i2p", netID: wire.NetIDI2P,
+			addr:    append([]byte{0x4a}, make([]byte, 31)...),
+			network: wire.NetIDI2P, expected: "i2p:10"},
+		{name: "cjdns", netID: wire.NetIDCJDNS, addr: cjdns,
+			network: wire.NetIDCJDNS, expected: "cjdns:fc32::"},
+		{name: "cjdns outside fc00::/8", netID: wire.NetIDCJDNS,
+			addr:    net.ParseIP("fd32::1"),
+			network: wire.NetIDCJDNS, expected: "unroutable"},
+		{name: "tor v2", netID: wire.NetIDTorV2, addr: make([]byte, 10),
+			network: wire.NetIDTorV2, expected: "unroutable"},
+		{name: "unknown network", netID: wire.NetworkID(0xaa),
+			addr: []byte{0x01}, network: wire.NetworkID(0xaa),
+			expected: "unroutable"},
+	}
+
+	for i, test := range tests {
+		na := wire.NewNetAddressV2(time.Now(), wire.SFNodeNetwork,
+			test.netID, test.addr, 8333)
+		if key := addrmgr.GroupKeyV2(na); key != test.expected {
+			t.Errorf("TestGroupKeyV2 #%d (%s): unexpected group key "+
+				"- got '%s', want '%s'", i, test.name,
+				key, test.expected)
+		}
+		if netID := addrmgr.AddrNetwork(na); netID != test.network {
+			t.Errorf("TestGroupKeyV2 #%d (%s): unexpected network "+
+				"- got %v, want %v", i, test.name, netID,
+				test.network)
+		}
+	}
+}
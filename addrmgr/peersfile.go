@@ -0,0 +1,483 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package addrmgr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// The peers file starts with peersFileMagic followed by the serialisation
+// version as a little endian uint32.  It ends with the sha256 checksum of all
+// of the data preceding it, which allows detecting files that were truncated
+// or otherwise corrupted, for example by a crash while they were written.
+//
+// The data in between is the bucket key, the checksum of the ASMap the
+// addresses were bucketed with, which is all zeros when there was none and
+// missing before version 5, the number of addresses as a variable length
+// integer and then each address in the following form:
+//
+//   address    network id uint8, port uint16, services uint64, raw address
+//              var bytes, timestamp int64
+//   source     network id uint8, port uint16, services uint64, raw address
+//              var bytes
+//   attempts   uint32
+//   lastattempt, lastsuccess
+//              int64 unix times
+//   tried      uint8, 1 for addresses in a tried bucket
+//   buckets    the tried bucket as a variable length integer for tried
+//              addresses, otherwise the number of new buckets followed by
+//              each of them as variable length integers
+//
+// The addresses in tried buckets are stored first and in the order of their
+// buckets, so the order within each tried bucket is retained.
+//
+// Rather than rewriting the peers file in place, a new file is written next to
+// it and renamed over it once it was synced to disk.  The previous file is
+// kept as a backup which is loaded instead when the peers file turns out to be
+// corrupt.
+
+// peersFileMagic identifies a peers file in the binary format.
+var peersFileMagic = [8]byte{'h', 'd', 'f', 'p', 'e', 'e', 'r', 's'}
+
+const (
+	// peersFileHeaderLen is the length of the magic and version at the
+	// start of the peers file.
+	peersFileHeaderLen = len(peersFileMagic) + 4
+
+	// peersFileMaxAddresses is the maximum number of addresses a valid
+	// peers file can contain given the number and size of the buckets.
+	peersFileMaxAddresses = newBucketCount*newBucketSize +
+		triedBucketCount*triedBucketSize
+)
+
+// errPeersFileChecksum indicates the checksum of a peers file does not match
+// its contents.
+var errPeersFileChecksum = errors.New("peers file checksum mismatch")
+
+// writePeersElements writes the passed fixed size elements to w in little
+// endian.
+func writePeersElements(w io.Writer, elements ...interface{}) error {
+	for _, element := range elements {
+		err := binary.Write(w, binary.LittleEndian, element)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readPeersElements reads the passed fixed size elements from r in little
+// endian.
+func readPeersElements(r io.Reader, elements ...interface{}) error {
+	for _, element := range elements {
+		err := binary.Read(r, binary.LittleEndian, element)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePeersAddress writes the passed address, without its timestamp, to w.
+func writePeersAddress(w io.Writer, na *wire.NetAddressV2) error {
+	err := writePeersElements(w, uint8(na.NetworkID), na.Port,
+		uint64(na.Services))
+	if err != nil {
+		return err
+	}
+	return wire.WriteVarBytes(w, 0, na.Addr)
+}
+
+// readPeersAddress reads an address written by writePeersAddress from r.
+func readPeersAddress(r io.Reader) (*wire.NetAddressV2, error) {
+	var (
+		netID    uint8
+		port     uint16
+		services uint64
+	)
+	if err := readPeersElements(r, &netID, &port, &services); err != nil {
+		return nil, err
+	}
+	raw, err := wire.ReadVarBytes(r, 0, wire.MaxAddrV2Size, "address")
+	if err != nil {
+		return nil, err
+	}
+
+	na := &wire.NetAddressV2{
+		Services:  wire.ServiceFlag(services),
+		NetworkID: wire.NetworkID(netID),
+		Addr:      raw,
+		Port:      port,
+	}
+	switch na.NetworkID {
+	case wire.NetIDIPv4, wire.NetIDIPv6:
+		legacy, _ := na.ToLegacy()
+		if legacy.IP.To16() == nil {
+			return nil, fmt.Errorf("invalid %v address %x",
+				na.NetworkID, raw)
+		}
+		return wire.NetAddressV2FromLegacy(legacy), nil
+	}
+	if !IsRoutableV2(na) {
+		return nil, fmt.Errorf("invalid %v address %x", na.NetworkID,
+			raw)
+	}
+	return na, nil
+}
+
+// serializePeers returns the known addresses in the binary peers file format.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) serializePeers() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(peersFileMagic[:])
+	err := writePeersElements(&buf, uint32(serialisationVersion), a.key,
+		a.asmapChecksum)
+	if err != nil {
+		return nil, err
+	}
+	err = wire.WriteVarInt(&buf, 0, uint64(len(a.addrIndex)))
+	if err != nil {
+		return nil, err
+	}
+
+	writeKnownAddress := func(ka *KnownAddress) error {
+		err := writePeersAddress(&buf, ka.NetAddressV2())
+		if err != nil {
+			return err
+		}
+		err = writePeersElements(&buf, ka.timestamp().Unix())
+		if err != nil {
+			return err
+		}
+		err = writePeersAddress(&buf, wire.NetAddressV2FromLegacy(
+			ka.srcAddr))
+		if err != nil {
+			return err
+		}
+		return writePeersElements(&buf, uint32(ka.attempts),
+			ka.lastattempt.Unix(), ka.lastsuccess.Unix(), ka.tried)
+	}
+
+	for i := range a.addrTried {
+		for e := a.addrTried[i].Front(); e != nil; e = e.Next() {
+			if err := writeKnownAddress(e.Value.(*KnownAddress)); err != nil {
+				return nil, err
+			}
+			if err := wire.WriteVarInt(&buf, 0, uint64(i)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	newBuckets := make(map[*KnownAddress][]int, a.nNew)
+	for i := range a.addrNew {
+		for _, ka := range a.addrNew[i] {
+			newBuckets[ka] = append(newBuckets[ka], i)
+		}
+	}
+	for ka, buckets := range newBuckets {
+		if err := writeKnownAddress(ka); err != nil {
+			return nil, err
+		}
+		err := wire.WriteVarInt(&buf, 0, uint64(len(buckets)))
+		if err != nil {
+			return nil, err
+		}
+		for _, bucket := range buckets {
+			err := wire.WriteVarInt(&buf, 0, uint64(bucket))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	buf.Write(chainhash.HashB(buf.Bytes()))
+	return buf.Bytes(), nil
+}
+
+// deserializePeers loads the known addresses from the passed data in the
+// binary peers file format.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) deserializePeers(data []byte) error {
+	if len(data) < peersFileHeaderLen+chainhash.HashSize ||
+		!bytes.Equal(data[:len(peersFileMagic)], peersFileMagic[:]) {
+
+		return errors.New("data is not in the peers file format")
+	}
+	checksum := data[len(data)-chainhash.HashSize:]
+	data = data[:len(data)-chainhash.HashSize]
+	if !bytes.Equal(chainhash.HashB(data), checksum) {
+		return errPeersFileChecksum
+	}
+
+	r := bytes.NewReader(data[len(peersFileMagic):])
+	var version uint32
+	if err := readPeersElements(r, &version, &a.key); err != nil {
+		return err
+	}
+	if version < firstBinaryVersion || version > serialisationVersion {
+		return fmt.Errorf("unknown version %v in serialized "+
+			"addrmanager", version)
+	}
+	var asmapChecksum chainhash.Hash
+	if version >= 5 {
+		if err := readPeersElements(r, &asmapChecksum); err != nil {
+			return err
+		}
+	}
+	numAddrs, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return err
+	}
+	if numAddrs > peersFileMaxAddresses {
+		return fmt.Errorf("too many addresses in peers file: max %d, "+
+			"got %d", peersFileMaxAddresses, numAddrs)
+	}
+
+	for i := uint64(0); i < numAddrs; i++ {
+		addr, err := readPeersAddress(r)
+		if err != nil {
+			return err
+		}
+		var timestamp int64
+		if err := readPeersElements(r, &timestamp); err != nil {
+			return err
+		}
+		addr.Timestamp = time.Unix(timestamp, 0)
+		src, err := readPeersAddress(r)
+		if err != nil {
+			return err
+		}
+		srcAddr, ok := src.ToLegacy()
+		if !ok {
+			return fmt.Errorf("invalid source address %v for %s",
+				src.NetworkID, NetAddressV2Key(addr))
+		}
+
+		var (
+			attempts                 uint32
+			lastAttempt, lastSuccess int64
+			tried                    bool
+		)
+		err = readPeersElements(r, &attempts, &lastAttempt, &lastSuccess,
+			&tried)
+		if err != nil {
+			return err
+		}
+
+		key := NetAddressV2Key(addr)
+		if _, ok := a.addrIndex[key]; ok {
+			return fmt.Errorf("duplicate address %s", key)
+		}
+		ka := &KnownAddress{
+			srcAddr:     srcAddr,
+			attempts:    int(attempts),
+			lastattempt: time.Unix(lastAttempt, 0),
+			lastsuccess: time.Unix(lastSuccess, 0),
+		}
+		ka.setAddress(addr)
+
+		if tried {
+			bucket, err := wire.ReadVarInt(r, 0)
+			if err != nil {
+				return err
+			}
+			if bucket >= triedBucketCount ||
+				a.addrTried[bucket].Len() >= triedBucketSize {
+
+				return fmt.Errorf("invalid tried bucket %d for %s",
+					bucket, key)
+			}
+			ka.tried = true
+			a.nTried++
+			a.addrTried[bucket].PushBack(ka)
+			a.addKnown(key, ka)
+			continue
+		}
+
+		numBuckets, err := wire.ReadVarInt(r, 0)
+		if err != nil {
+			return err
+		}
+		if numBuckets == 0 || numBuckets > newBucketsPerAddress {
+			return fmt.Errorf("address %s is in %d new buckets", key,
+				numBuckets)
+		}
+		for j := uint64(0); j < numBuckets; j++ {
+			bucket, err := wire.ReadVarInt(r, 0)
+			if err != nil {
+				return err
+			}
+			if bucket >= newBucketCount {
+				return fmt.Errorf("invalid new bucket %d for %s",
+					bucket, key)
+			}
+			if _, ok := a.addrNew[bucket][key]; ok {
+				return fmt.Errorf("address %s is in new bucket "+
+					"%d more than once", key, bucket)
+			}
+			ka.refs++
+			a.addrNew[bucket][key] = ka
+		}
+		a.nNew++
+		a.addKnown(key, ka)
+	}
+
+	if r.Len() != 0 {
+		return fmt.Errorf("%d bytes of unexpected data after the "+
+			"addresses", r.Len())
+	}
+
+	// The addresses need to be moved to other buckets when they were
+	// bucketed with a different ASMap.
+	if asmapChecksum != a.asmapChecksum {
+		a.rebucket()
+	}
+	return nil
+}
+
+// backupPeersFile returns the path of the backup of the passed peers file.
+func backupPeersFile(peersFile string) string {
+	return peersFile + ".bak"
+}
+
+// writePeersFile atomically replaces the passed peers file with one that
+// holds the passed data.  The previous peers file, if any, is kept as its
+// backup.
+func writePeersFile(peersFile string, data []byte) error {
+	tmpFile := peersFile + ".tmp"
+	w, err := os.Create(tmpFile)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		os.Remove(tmpFile)
+		return err
+	}
+	if err := w.Sync(); err != nil {
+		w.Close()
+		os.Remove(tmpFile)
+		return err
+	}
+	if err := w.Close(); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+
+	// The peers file is only missing between the renames below when a
+	// crash occurs, in which case the backup is loaded instead.
+	err = os.Rename(peersFile, backupPeersFile(peersFile))
+	if err != nil && !os.IsNotExist(err) {
+		os.Remove(tmpFile)
+		return err
+	}
+	return os.Rename(tmpFile, peersFile)
+}
+
+// savePeers saves all the known addresses to a file so they can be read back
+// in at next run.
+func (a *AddrManager) savePeers() {
+	a.mtx.Lock()
+	data, err := a.serializePeers()
+	a.mtx.Unlock()
+	if err != nil {
+		log.Errorf("Failed to serialize addresses: %v", err)
+		return
+	}
+
+	if err := writePeersFile(a.peersFile, data); err != nil {
+		log.Errorf("Failed to write file %s: %v", a.peersFile, err)
+		return
+	}
+
+	// The addresses of a peers file in the JSON format used by previous
+	// versions are part of the new file now.
+	err = os.Remove(a.jsonPeersFile)
+	if err != nil && !os.IsNotExist(err) {
+		log.Warnf("Failed to remove old peers file %s: %v",
+			a.jsonPeersFile, err)
+	}
+}
+
+// loadPeersFile loads the known addresses from the passed peers file in the
+// binary format.  It returns false without an error when the file does not
+// exist.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) loadPeersFile(filePath string) (bool, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := a.deserializePeers(data); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// loadPeers loads the known address from the saved file.  A corrupt peers file
+// is replaced by its backup when that is intact, and a peers file in the JSON
+// format of previous versions is loaded when there is none in the binary
+// format.  If all of them are missing or malformed, just don't load anything
+// and start fresh.
+func (a *AddrManager) loadPeers() {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	for _, filePath := range []string{a.peersFile,
+		backupPeersFile(a.peersFile)} {
+
+		loaded, err := a.loadPeersFile(filePath)
+		if err == nil && !loaded {
+			continue
+		}
+		if err == nil {
+			log.Infof("Loaded %d addresses from file '%s'",
+				a.numAddresses(), filePath)
+			return
+		}
+
+		log.Errorf("Failed to parse file %s: %v", filePath, err)
+		a.reset()
+
+		// if it is invalid we nuke it unconditionally, so it does not
+		// replace the backup when the addresses are saved next.
+		err = os.Remove(filePath)
+		if err != nil {
+			log.Warnf("Failed to remove corrupt peers file %s: %v",
+				filePath, err)
+		}
+	}
+
+	if _, err := os.Stat(a.jsonPeersFile); os.IsNotExist(err) {
+		return
+	}
+	if err := a.deserializePeersJSON(a.jsonPeersFile); err != nil {
+		log.Errorf("Failed to parse file %s: %v", a.jsonPeersFile, err)
+		a.reset()
+		return
+	}
+	if a.asmap != nil {
+		a.rebucket()
+	}
+	log.Infof("Loaded %d addresses from file '%s'", a.numAddresses(),
+		a.jsonPeersFile)
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package addrmgr
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/ifishnet/hdfd/wire"
+)
+
+const (
+	// portableVersion is the current version of the portable address
+	// format produced by Export.  Version 2 added addresses which can only
+	// be represented in addrv2 messages.
+	portableVersion = 2
+
+	// maxPortableAddresses is the maximum number of addresses Import will
+	// accept from a single portable address file.  It is well above the
+	// number of addresses the address manager is able to hold.
+	maxPortableAddresses = 1 << 20
+)
+
+// portableMagic identifies data in the portable address format.  It is
+// followed by a single version byte and the gzip compressed JSON encoding of
+// a portableAddrs value.
+var portableMagic = [8]byte{'h', 'd', 'f', 'a', 'd', 'd', 'r', 's'}
+
+// portableAddress describes a single address in the portable address format.
+// Unlike the peers file, it does not include any state that depends on the
+// secret bucket key of the address manager that produced it, so it can be
+// imported by any address manager.
+type portableAddress struct {
+	Addr        string           `json:"addr"`
+	Network     wire.NetworkID   `json:"network,omitempty"`
+	Src         string           `json:"src,omitempty"`
+	Services    wire.ServiceFlag `json:"services"`
+	TimeStamp   int64            `json:"timestamp"`
+	LastSuccess int64            `json:"lastsuccess,omitempty"`
+}
+
+// portableAddrs is the JSON document contained in the portable address
+// format.
+type portableAddrs struct {
+	Addresses []portableAddress `json:"addresses"`
+}
+
+// Export writes all of the addresses known to the address manager to the
+// passed writer in a versioned, compressed format which is independent of
+// the way the address manager stores them.  The output may be passed to
+// Import of another address manager, for example to pre-seed a new node with
+// a curated list of peers.
+//
+// This function is safe for concurrent access.
+func (a *AddrManager) Export(w io.Writer) error {
+	a.mtx.Lock()
+	addrs := make([]portableAddress, 0, len(a.addrIndex))
+	for k, v := range a.addrIndex {
+		pa := portableAddress{
+			Addr:      k,
+			Services:  v.Services(),
+			TimeStamp: v.timestamp().Unix(),
+		}
+		if v.na == nil {
+			pa.Network = v.addrV2.NetworkID
+		}
+		if v.srcAddr != nil {
+			pa.Src = NetAddressKey(v.srcAddr)
+		}
+		if !v.lastsuccess.IsZero() {
+			pa.LastSuccess = v.lastsuccess.Unix()
+		}
+		addrs = append(addrs, pa)
+	}
+	a.mtx.Unlock()
+
+	var header [len(portableMagic) + 1]byte
+	copy(header[:], portableMagic[:])
+	header[len(portableMagic)] = portableVersion
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(w)
+	err := json.NewEncoder(zw).Encode(&portableAddrs{Addresses: addrs})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Import reads addresses in the format written by Export from the passed
+// reader and adds them to the address manager as if they had been received
+// from their original source.  Addresses which are already known only have
+// their last seen time and services updated and addresses which are not
+// routable are ignored.  The number of addresses that were not previously
+// known to the address manager is returned.
+//
+// This function is safe for concurrent access.
+func (a *AddrManager) Import(r io.Reader) (int, error) {
+	var header [len(portableMagic) + 1]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, fmt.Errorf("unable to read portable address "+
+			"header: %v", err)
+	}
+	if !bytes.Equal(header[:len(portableMagic)], portableMagic[:]) {
+		return 0, fmt.Errorf("data is not in the portable address " +
+			"format")
+	}
+	if version := header[len(portableMagic)]; version > portableVersion {
+		return 0, fmt.Errorf("unknown portable address format "+
+			"version %d", version)
+	}
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, fmt.Errorf("unable to decompress portable "+
+			"addresses: %v", err)
+	}
+	defer zr.Close()
+
+	var pas portableAddrs
+	if err := json.NewDecoder(zr).Decode(&pas); err != nil {
+		return 0, fmt.Errorf("unable to decode portable "+
+			"addresses: %v", err)
+	}
+	if len(pas.Addresses) > maxPortableAddresses {
+		return 0, fmt.Errorf("too many portable addresses: max %d, "+
+			"got %d", maxPortableAddresses, len(pas.Addresses))
+	}
+
+	// Parse all of the addresses before adding any of them so a malformed
+	// entry doesn't result in a partial import.
+	type importedAddr struct {
+		na          *wire.NetAddressV2
+		srcAddr     *wire.NetAddress
+		lastSuccess time.Time
+	}
+	imported := make([]importedAddr, 0, len(pas.Addresses))
+	for _, pa := range pas.Addresses {
+		na, err := a.deserializeAddress(pa.Addr, pa.Network, pa.Services)
+		if err != nil {
+			return 0, fmt.Errorf("failed to deserialize netaddress "+
+				"%s: %v", pa.Addr, err)
+		}
+		na.Timestamp = time.Unix(pa.TimeStamp, 0)
+
+		// Addresses without a source, such as those in hand curated
+		// lists, are treated as their own source.  Addresses which
+		// have no wire.NetAddress use an unroutable source instead.
+		srcAddr, _ := na.ToLegacy()
+		if srcAddr == nil {
+			srcAddr = wire.NewNetAddressIPPort(net.IPv4zero, 0, 0)
+		}
+		if pa.Src != "" {
+			srcAddr, err = a.DeserializeNetAddress(pa.Src,
+				pa.Services)
+			if err != nil {
+				return 0, fmt.Errorf("failed to deserialize "+
+					"netaddress %s: %v", pa.Src, err)
+			}
+		}
+
+		ia := importedAddr{na: na, srcAddr: srcAddr}
+		if pa.LastSuccess != 0 {
+			ia.lastSuccess = time.Unix(pa.LastSuccess, 0)
+		}
+		imported = append(imported, ia)
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	var numNew int
+	for _, ia := range imported {
+		key := NetAddressV2Key(ia.na)
+		_, known := a.addrIndex[key]
+		a.updateAddress(ia.na, ia.srcAddr)
+
+		ka := a.addrIndex[key]
+		if ka == nil {
+			continue
+		}
+		if !known {
+			numNew++
+		}
+		if ka.lastsuccess.Before(ia.lastSuccess) {
+			ka.lastsuccess = ia.lastSuccess
+		}
+	}
+
+	log.Infof("Imported %d new addresses (%d total)", numNew,
+		a.numAddresses())
+
+	return numNew, nil
+}
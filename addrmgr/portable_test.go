@@ -0,0 +1,111 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package addrmgr_test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ifishnet/hdfd/addrmgr"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// TestExportImport ensures addresses exported by one address manager are
+// imported into another one along with their services and timestamps.
+func TestExportImport(t *testing.T) {
+	n := addrmgr.New("testexport", lookupFunc)
+
+	timestamp := time.Unix(time.Now().Unix()-3600, 0)
+	addrsToAdd := 100
+	addrs := make([]*wire.NetAddress, 0, addrsToAdd)
+	for i := 0; i < addrsToAdd; i++ {
+		ip := net.IPv4(byte(i/128+60), byte(i%128+60), 173, 147)
+		na := wire.NewNetAddressIPPort(ip, 8333, wire.SFNodeNetwork)
+		na.Timestamp = timestamp
+		addrs = append(addrs, na)
+	}
+	srcAddr := wire.NewNetAddressIPPort(net.IPv4(173, 144, 173, 111), 8333, 0)
+	n.AddAddresses(addrs, srcAddr)
+	n.Good(addrs[0])
+
+	var buf bytes.Buffer
+	if err := n.Export(&buf); err != nil {
+		t.Fatalf("Export: unexpected error: %v", err)
+	}
+	exported := buf.Bytes()
+
+	// Ensure all addresses are imported into an empty address manager.
+	m := addrmgr.New("testimport", lookupFunc)
+	numNew, err := m.Import(bytes.NewReader(exported))
+	if err != nil {
+		t.Fatalf("Import: unexpected error: %v", err)
+	}
+	if numNew != addrsToAdd {
+		t.Fatalf("Import: new addresses: got %d, want %d", numNew,
+			addrsToAdd)
+	}
+	if m.NumAddresses() != n.NumAddresses() {
+		t.Fatalf("Number of addresses: got %d, want %d",
+			m.NumAddresses(), n.NumAddresses())
+	}
+	for _, na := range m.AddressCache() {
+		if !na.Timestamp.Equal(timestamp) {
+			t.Fatalf("Imported address timestamp: got %v, want %v",
+				na.Timestamp, timestamp)
+		}
+		if na.Services != wire.SFNodeNetwork {
+			t.Fatalf("Imported address services: got %v, want %v",
+				na.Services, wire.SFNodeNetwork)
+		}
+	}
+
+	// Ensure importing the same addresses again does not report any new
+	// addresses.
+	numNew, err = m.Import(bytes.NewReader(exported))
+	if err != nil {
+		t.Fatalf("Import: unexpected error: %v", err)
+	}
+	if numNew != 0 {
+		t.Fatalf("Repeated import: new addresses: got %d, want 0",
+			numNew)
+	}
+
+	// Ensure malformed data is rejected without adding any addresses.
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{
+			name: "empty",
+			data: nil,
+		},
+		{
+			name: "bad magic",
+			data: append([]byte("notaddrs"), exported[8:]...),
+		},
+		{
+			name: "unknown version",
+			data: append(append([]byte(nil), exported[:8]...),
+				append([]byte{0xff}, exported[9:]...)...),
+		},
+		{
+			name: "truncated",
+			data: exported[:len(exported)/2],
+		},
+	}
+	for _, test := range tests {
+		m := addrmgr.New("testimportbad", lookupFunc)
+		if _, err := m.Import(bytes.NewReader(test.data)); err == nil {
+			t.Errorf("%s: expected error", test.name)
+			continue
+		}
+		if m.NumAddresses() != 0 {
+			t.Errorf("%s: number of addresses: got %d, want 0",
+				test.name, m.NumAddresses())
+		}
+	}
+}
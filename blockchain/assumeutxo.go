@@ -0,0 +1,832 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/database"
+	"github.com/ifishnet/hdfd/wire"
+	"github.com/ifishnet/hdfutil"
+)
+
+const (
+	// snapshotVersion is the current version of the utxo set snapshot
+	// serialization format.
+	snapshotVersion = 2
+
+	// snapshotHeaderSize is the size of the serialized header of a utxo set
+	// snapshot.  It consists of the magic bytes, the version, the network,
+	// the hash of the block the snapshot was taken at, its height, and the
+	// total number of transactions up to and including it.
+	snapshotHeaderSize = 4 + 4 + 4 + chainhash.HashSize + 4 + 8
+
+	// snapshotBatchSize is the number of utxos that are written to the
+	// database in a single transaction while loading a utxo set snapshot.
+	snapshotBatchSize = 50000
+
+	// historicalBlockWindow is the maximum number of blocks past the last
+	// block validated in the background that are requested while the
+	// historical chain leading up to a loaded utxo snapshot is validated.
+	// It limits the number of blocks waiting to be validated.
+	historicalBlockWindow = 1024
+)
+
+var (
+	// snapshotMagic is the magic bytes that identify a utxo set snapshot.
+	snapshotMagic = [4]byte{'u', 't', 'x', 'o'}
+
+	// snapshotStateKeyName is the name of the db key used to store the state
+	// of the background validation of the historical chain leading up to a
+	// loaded utxo snapshot.
+	snapshotStateKeyName = []byte("utxosnapshotstate")
+
+	// snapshotUtxoSetBucketName is the name of the db bucket used to house
+	// the utxo set that is built while validating the historical chain
+	// leading up to a loaded utxo snapshot.
+	snapshotUtxoSetBucketName = []byte("utxosnapshotset")
+)
+
+// -----------------------------------------------------------------------------
+// A utxo set snapshot consists of a header that identifies the block the
+// snapshot was taken at, the headers of all blocks in the main chain after the
+// genesis block up to and including that block, the entries of the utxo set
+// as of that block, and the hash of the utxo set.
+//
+// The serialized format is:
+//
+//   <magic><version><network><block hash><block height><total txns><headers>
+//   <utxos><end><utxo set hash>
+//
+//   Field          Type                Size
+//   magic          [4]byte             4 bytes
+//   version        uint32              4 bytes
+//   network        wire.BitcoinNet     4 bytes
+//   block hash     chainhash.Hash      chainhash.HashSize
+//   block height   uint32              4 bytes
+//   total txns     uint64              8 bytes
+//   headers        []wire.BlockHeader  80 bytes * block height
+//   utxos          []utxo              variable
+//   end            byte                1 byte (always zero)
+//   utxo set hash  chainhash.Hash      chainhash.HashSize
+//
+// Each utxo is serialized as its key and value in the utxo set bucket, each
+// prefixed by its length as a variable length integer, and the utxos are
+// ordered by their keys, so the serialization of a given utxo set is
+// deterministic.  The utxo set hash is the double sha256 of the serialized
+// utxos.  A snapshot is only loaded when its utxo set hash is committed to by
+// the chain parameters or was provided by the operator.
+// -----------------------------------------------------------------------------
+
+// UTXOSnapshotInfo houses details about a utxo set snapshot.
+type UTXOSnapshotInfo struct {
+	// Hash and Height identify the block the snapshot was taken at.
+	Hash   chainhash.Hash
+	Height int32
+
+	// UTXOSetHash is the hash of the serialized utxo set and NumUTXOs is
+	// the number of utxos in it.
+	UTXOSetHash chainhash.Hash
+	NumUTXOs    uint64
+
+	// TotalTxns is the total number of transactions in the main chain up to
+	// and including the block the snapshot was taken at.
+	TotalTxns uint64
+}
+
+// snapshotState houses the state of the background validation of the
+// historical chain leading up to a loaded utxo snapshot.  It is protected by
+// the chain lock.
+type snapshotState struct {
+	// base is the block the loaded utxo snapshot was taken at and
+	// utxoSetHash is the hash of its utxo set.
+	base        *blockNode
+	utxoSetHash chainhash.Hash
+
+	// validatedHeight is the height of the last block that has been
+	// validated in the background.
+	validatedHeight int32
+
+	// failed is set when the historical chain turned out to be invalid or
+	// did not produce the utxo set of the snapshot.
+	failed bool
+
+	// blockStored is used to signal the background validation when the
+	// data of a historical block has been stored.
+	blockStored chan struct{}
+}
+
+// serializeSnapshotState returns the serialization of the passed background
+// validation state.  The serialized format is the hash of the base block, the
+// utxo set hash, and the validated height as a uint32.
+func serializeSnapshotState(state *snapshotState) []byte {
+	serialized := make([]byte, chainhash.HashSize*2+4)
+	copy(serialized, state.base.hash[:])
+	copy(serialized[chainhash.HashSize:], state.utxoSetHash[:])
+	byteOrder.PutUint32(serialized[chainhash.HashSize*2:],
+		uint32(state.validatedHeight))
+	return serialized
+}
+
+// dbPutSnapshotState uses an existing database transaction to store the passed
+// background validation state.
+func dbPutSnapshotState(dbTx database.Tx, state *snapshotState) error {
+	return dbTx.Metadata().Put(snapshotStateKeyName,
+		serializeSnapshotState(state))
+}
+
+// dbFetchSnapshotState uses an existing database transaction to load the
+// background validation state, if any, using the block index to look up the
+// base block.  Nil is returned for both the state and the error when there is
+// no stored state.
+func (b *BlockChain) dbFetchSnapshotState(dbTx database.Tx) (*snapshotState, error) {
+	serialized := dbTx.Metadata().Get(snapshotStateKeyName)
+	if serialized == nil {
+		return nil, nil
+	}
+	if len(serialized) != chainhash.HashSize*2+4 {
+		return nil, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt utxo snapshot state",
+		}
+	}
+
+	var baseHash chainhash.Hash
+	copy(baseHash[:], serialized[:chainhash.HashSize])
+	base := b.index.LookupNode(&baseHash)
+	if base == nil {
+		return nil, AssertError(fmt.Sprintf("cannot find utxo snapshot "+
+			"block %s in block index", baseHash))
+	}
+	state := &snapshotState{
+		base:        base,
+		blockStored: make(chan struct{}, 1),
+	}
+	copy(state.utxoSetHash[:], serialized[chainhash.HashSize:])
+	state.validatedHeight = int32(byteOrder.Uint32(
+		serialized[chainhash.HashSize*2:]))
+	return state, nil
+}
+
+// writeSnapshotUtxo writes the passed utxo set bucket key and serialized utxo
+// entry to w in the utxo set snapshot format.
+func writeSnapshotUtxo(w io.Writer, key, serialized []byte) error {
+	if err := wire.WriteVarBytes(w, 0, key); err != nil {
+		return err
+	}
+	return wire.WriteVarBytes(w, 0, serialized)
+}
+
+// dbWriteUtxoSet uses an existing database transaction to serialize all of the
+// utxos in the utxo set housed in the bucket with the provided name to w in the
+// utxo set snapshot format and returns the hash of the serialized utxos along
+// with their number.  The utxos are only hashed when w is nil.
+func dbWriteUtxoSet(dbTx database.Tx, bucketName []byte, w io.Writer) (chainhash.Hash, uint64, error) {
+	hasher := sha256.New()
+	out := io.Writer(hasher)
+	if w != nil {
+		out = io.MultiWriter(w, hasher)
+	}
+
+	var numUtxos uint64
+	cursor := dbTx.Metadata().Bucket(bucketName).Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		err := writeSnapshotUtxo(out, cursor.Key(), cursor.Value())
+		if err != nil {
+			return chainhash.Hash{}, 0, err
+		}
+		numUtxos++
+	}
+
+	return chainhash.HashH(hasher.Sum(nil)), numUtxos, nil
+}
+
+// DumpUTXOSnapshot writes a snapshot of the utxo set as of the current best
+// block to w.  The returned details include the utxo set hash that the chain
+// parameters must commit to in order for the snapshot to be loadable.
+//
+// The utxo set can't be dumped while the historical chain leading up to a
+// loaded utxo snapshot is still being validated.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) DumpUTXOSnapshot(w io.Writer) (*UTXOSnapshotInfo, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	if b.snapshot != nil {
+		return nil, fmt.Errorf("the utxo set can't be dumped until the " +
+			"historical chain leading up to the utxo snapshot it " +
+			"was loaded from has been validated")
+	}
+
+	// Write the header followed by the headers of all blocks in the main
+	// chain after the genesis block.
+	tip := b.bestChain.Tip()
+	var header [snapshotHeaderSize]byte
+	copy(header[:], snapshotMagic[:])
+	byteOrder.PutUint32(header[4:], snapshotVersion)
+	byteOrder.PutUint32(header[8:], uint32(b.chainParams.Net))
+	copy(header[12:], tip.hash[:])
+	byteOrder.PutUint32(header[12+chainhash.HashSize:], uint32(tip.height))
+	byteOrder.PutUint64(header[16+chainhash.HashSize:],
+		b.stateSnapshot.TotalTxns)
+	if _, err := w.Write(header[:]); err != nil {
+		return nil, err
+	}
+	// The headers are loaded in batches since they are not all held in
+	// memory.
+	nodes := make([]*blockNode, 0, wire.MaxBlockHeadersPerMsg)
+	for height := int32(1); height <= tip.height; {
+		nodes = nodes[:0]
+		for ; height <= tip.height && len(nodes) < cap(nodes); height++ {
+			nodes = append(nodes, b.bestChain.NodeByHeight(height))
+		}
+		blockHeaders, err := b.index.NodeHeaders(nodes)
+		if err != nil {
+			return nil, err
+		}
+		for i := range blockHeaders {
+			if err := blockHeaders[i].Serialize(w); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Write the utxo set followed by the end marker and its hash once all
+	// of the modifications held in the utxo cache have been written to it.
+	if err := b.utxoCache.flush(false); err != nil {
+		return nil, err
+	}
+	info := &UTXOSnapshotInfo{
+		Hash:      tip.hash,
+		Height:    tip.height,
+		TotalTxns: b.stateSnapshot.TotalTxns,
+	}
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		info.UTXOSetHash, info.NumUTXOs, err = dbWriteUtxoSet(dbTx,
+			utxoSetBucketName, w)
+		if err != nil {
+			return err
+		}
+		if err := wire.WriteVarBytes(w, 0, nil); err != nil {
+			return err
+		}
+		_, err = w.Write(info.UTXOSetHash[:])
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// dbResetUtxoSet uses an existing database transaction to remove all entries
+// from the utxo set.
+func dbResetUtxoSet(dbTx database.Tx) error {
+	meta := dbTx.Metadata()
+	if err := meta.DeleteBucket(utxoSetBucketName); err != nil {
+		return err
+	}
+	_, err := meta.CreateBucket(utxoSetBucketName)
+	return err
+}
+
+// loadUTXOSnapshot bootstraps the chain state from the utxo set snapshot read
+// from r so the best chain immediately extends to the block the snapshot was
+// taken at.  The hash of the utxo set in the snapshot must either be committed
+// to by the chain parameters or match the passed utxo set hash, which may be
+// nil.  The historical chain leading up to the snapshot is then validated in
+// the background as its blocks are provided via ProcessHistoricalBlock.
+//
+// The snapshot is ignored and nil is returned for both the details and the
+// error when the chain state has already been initialized beyond the genesis
+// block.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) loadUTXOSnapshot(r io.Reader, utxoSetHash *chainhash.Hash) (*UTXOSnapshotInfo, error) {
+	genesis := b.bestChain.Tip()
+	if genesis.height != 0 {
+		log.Infof("Ignoring utxo snapshot since the chain state is "+
+			"already initialized (height %d)", genesis.height)
+		return nil, nil
+	}
+
+	// Ensure the snapshot is for the active network and is committed to by
+	// the chain parameters.
+	var header [snapshotHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:4], snapshotMagic[:]) {
+		return nil, fmt.Errorf("invalid utxo snapshot magic %x",
+			header[:4])
+	}
+	if version := byteOrder.Uint32(header[4:]); version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported utxo snapshot version %d",
+			version)
+	}
+	net := wire.BitcoinNet(byteOrder.Uint32(header[8:]))
+	if net != b.chainParams.Net {
+		return nil, fmt.Errorf("utxo snapshot is for network %v "+
+			"instead of %v", net, b.chainParams.Net)
+	}
+	var baseHash chainhash.Hash
+	copy(baseHash[:], header[12:])
+	baseHeight := int32(byteOrder.Uint32(header[12+chainhash.HashSize:]))
+	totalTxns := byteOrder.Uint64(header[16+chainhash.HashSize:])
+
+	// Determine the utxo set hash the snapshot must match.  A commitment
+	// by the chain parameters takes precedence over the provided hash.
+	expectedHash := utxoSetHash
+	for i := range b.chainParams.AssumeUTXO {
+		assumed := &b.chainParams.AssumeUTXO[i]
+		if !assumed.Hash.IsEqual(&baseHash) {
+			continue
+		}
+		if assumed.Height != baseHeight ||
+			assumed.TotalTxns != totalTxns {
+
+			return nil, fmt.Errorf("utxo snapshot at block %v "+
+				"(height %d) does not match the chain "+
+				"parameters", baseHash, baseHeight)
+		}
+		expectedHash = assumed.UTXOSetHash
+		break
+	}
+	if expectedHash == nil {
+		return nil, fmt.Errorf("utxo snapshot at block %v (height %d) "+
+			"is not known to be valid", baseHash, baseHeight)
+	}
+
+	// Read the headers and ensure they link together from the genesis block
+	// to the block the snapshot was taken at.  The blocks are assumed to be
+	// valid until the historical chain has been validated in the
+	// background.
+	log.Infof("Loading utxo snapshot at block %v (height %d)...", baseHash,
+		baseHeight)
+	nodes := make([]*blockNode, 0, baseHeight)
+	parent := genesis
+	for i := int32(0); i < baseHeight; i++ {
+		var blockHeader wire.BlockHeader
+		if err := blockHeader.Deserialize(r); err != nil {
+			return nil, err
+		}
+		if blockHeader.PrevBlock != parent.hash {
+			return nil, fmt.Errorf("utxo snapshot header at height "+
+				"%d does not connect to the previous header",
+				parent.height+1)
+		}
+		err := checkProofOfWork(&blockHeader, b.chainParams.PowLimit,
+			BFNone)
+		if err != nil {
+			return nil, err
+		}
+
+		node := b.index.newNode(&blockHeader, parent)
+		node.status = statusValid
+		nodes = append(nodes, node)
+		parent = node
+	}
+	base := parent
+	if base.hash != baseHash {
+		return nil, fmt.Errorf("utxo snapshot headers do not lead to "+
+			"block %v", baseHash)
+	}
+
+	// Load the utxo set in batches while hashing it.  The utxos must be
+	// ordered by their keys which ensures there are no duplicates and that
+	// the hash matches the one of the utxo set that was dumped.  The utxo
+	// set is reset beforehand since it might contain entries from a
+	// previous attempt that was interrupted.
+	err := b.db.Update(dbResetUtxoSet)
+	if err != nil {
+		return nil, err
+	}
+	maxKeySize := uint32(chainhash.HashSize + maxUint32VLQSerializeSize)
+	hasher := sha256.New()
+	var prevKey []byte
+	var numUtxos uint64
+	for done := false; !done; {
+		err := b.db.Update(func(dbTx database.Tx) error {
+			utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+			for i := 0; i < snapshotBatchSize; i++ {
+				key, err := wire.ReadVarBytes(r, 0, maxKeySize,
+					"utxo key")
+				if err != nil {
+					return err
+				}
+				if len(key) == 0 {
+					done = true
+					return nil
+				}
+				serialized, err := wire.ReadVarBytes(r, 0,
+					wire.MaxBlockPayload, "utxo entry")
+				if err != nil {
+					return err
+				}
+
+				if prevKey != nil && bytes.Compare(key, prevKey) <= 0 {
+					return fmt.Errorf("utxo snapshot entries " +
+						"are not ordered by key")
+				}
+				if _, err := deserializeUtxoEntry(serialized); err != nil {
+					return err
+				}
+				err = writeSnapshotUtxo(hasher, key, serialized)
+				if err != nil {
+					return err
+				}
+				if err := utxoBucket.Put(key, serialized); err != nil {
+					return err
+				}
+
+				prevKey = key
+				numUtxos++
+			}
+			return nil
+		})
+		if err != nil {
+			b.db.Update(dbResetUtxoSet)
+			return nil, err
+		}
+	}
+
+	// Ensure the utxo set hash at the end of the snapshot matches the
+	// loaded utxos, which detects corrupt snapshots, and the expected
+	// hash.
+	var storedHash chainhash.Hash
+	if _, err := io.ReadFull(r, storedHash[:]); err != nil {
+		b.db.Update(dbResetUtxoSet)
+		return nil, err
+	}
+	loadedHash := chainhash.HashH(hasher.Sum(nil))
+	if loadedHash != storedHash {
+		b.db.Update(dbResetUtxoSet)
+		return nil, fmt.Errorf("utxo snapshot is corrupt -- hash of "+
+			"the loaded utxos %v does not match the stored hash %v",
+			loadedHash, storedHash)
+	}
+	if !loadedHash.IsEqual(expectedHash) {
+		b.db.Update(dbResetUtxoSet)
+		return nil, fmt.Errorf("utxo snapshot hash %v does not match "+
+			"the expected hash %v", loadedHash, expectedHash)
+	}
+
+	// Store the block index entries for the headers along with the best
+	// chain state and the state of the background validation.
+	state := &snapshotState{
+		base:        base,
+		utxoSetHash: loadedHash,
+		blockStored: make(chan struct{}, 1),
+	}
+	bestState := newBestState(base, 0, 0, 0, totalTxns,
+		base.CalcPastMedianTime())
+	err = b.db.Update(func(dbTx database.Tx) error {
+		for _, node := range nodes {
+			if err := dbStoreBlockNode(dbTx, node); err != nil {
+				return err
+			}
+			err := dbPutBlockIndex(dbTx, &node.hash, node.height)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err := dbTx.Metadata().CreateBucket(snapshotUtxoSetBucketName)
+		if err != nil {
+			return err
+		}
+		if err := dbPutSnapshotState(dbTx, state); err != nil {
+			return err
+		}
+		if err := dbPutUtxoStateConsistency(dbTx, &base.hash); err != nil {
+			return err
+		}
+
+		return dbPutBestState(dbTx, bestState, &base.workSum)
+	})
+	if err != nil {
+		b.db.Update(dbResetUtxoSet)
+		return nil, err
+	}
+
+	for _, node := range nodes {
+		b.index.addStoredNode(node)
+	}
+	b.bestChain.SetTip(base)
+	b.stateSnapshot = bestState
+	b.snapshot = state
+	b.utxoCache.reset(&base.hash)
+
+	log.Infof("Loaded utxo snapshot with %d utxos at block %v (height "+
+		"%d) -- the historical chain will be validated in the "+
+		"background", numUtxos, baseHash, baseHeight)
+	return &UTXOSnapshotInfo{
+		Hash:        baseHash,
+		Height:      baseHeight,
+		UTXOSetHash: loadedHash,
+		NumUTXOs:    numUtxos,
+		TotalTxns:   totalTxns,
+	}, nil
+}
+
+// LoadUTXOSnapshot bootstraps the chain state from the utxo set snapshot read
+// from r as produced by DumpUTXOSnapshot so the best chain immediately extends
+// to the block the snapshot was taken at.  This allows operators to migrate the
+// chain state of a node they control to another one.  The hash of the utxo set
+// in the snapshot must either be committed to by the chain parameters or match
+// the passed utxo set hash, which may be nil.
+//
+// The historical chain leading up to the snapshot is validated in the
+// background as its blocks are provided via ProcessHistoricalBlock.  The chain
+// state must not have been initialized beyond the genesis block and optional
+// indexes can't be used since they rely on all blocks being available.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) LoadUTXOSnapshot(r io.Reader, utxoSetHash *chainhash.Hash) (*UTXOSnapshotInfo, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	if height := b.bestChain.Tip().height; height != 0 {
+		return nil, fmt.Errorf("a utxo snapshot can't be loaded since "+
+			"the chain state is already initialized (height %d)",
+			height)
+	}
+	if b.indexManager != nil {
+		return nil, fmt.Errorf("a utxo snapshot can't be loaded while " +
+			"optional indexes are in use")
+	}
+
+	info, err := b.loadUTXOSnapshot(r, utxoSetHash)
+	if err != nil {
+		return nil, err
+	}
+	go b.validateHistoricalChain()
+	return info, nil
+}
+
+// historicalNode returns the block node for the passed hash when it is part of
+// the historical chain leading up to a loaded utxo snapshot and its data is
+// still needed to validate that chain in the background.  Otherwise nil is
+// returned.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) historicalNode(hash *chainhash.Hash) *blockNode {
+	state := b.snapshot
+	if state == nil || state.failed {
+		return nil
+	}
+
+	node := b.index.LookupNode(hash)
+	if node == nil || node.height <= state.validatedHeight ||
+		node.height > state.base.height || !b.bestChain.Contains(node) ||
+		b.index.NodeStatus(node).HaveData() {
+
+		return nil
+	}
+	return node
+}
+
+// IsHistoricalBlock returns whether or not the block with the passed hash is
+// part of the historical chain leading up to a loaded utxo snapshot and its
+// data is still needed to validate that chain in the background.  Such blocks
+// must be provided via ProcessHistoricalBlock.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) IsHistoricalBlock(hash *chainhash.Hash) bool {
+	b.chainLock.RLock()
+	node := b.historicalNode(hash)
+	b.chainLock.RUnlock()
+	return node != nil
+}
+
+// MissingHistoricalBlocks returns the hashes of up to the passed maximum number
+// of blocks in the historical chain leading up to a loaded utxo snapshot whose
+// data is needed next to continue validating that chain in the background.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) MissingHistoricalBlocks(maxBlocks int) []chainhash.Hash {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	state := b.snapshot
+	if state == nil || state.failed {
+		return nil
+	}
+
+	endHeight := state.validatedHeight + historicalBlockWindow
+	if endHeight > state.base.height {
+		endHeight = state.base.height
+	}
+	var hashes []chainhash.Hash
+	for height := state.validatedHeight + 1; height <= endHeight &&
+		len(hashes) < maxBlocks; height++ {
+
+		node := b.bestChain.NodeByHeight(height)
+		if !b.index.NodeStatus(node).HaveData() {
+			hashes = append(hashes, node.hash)
+		}
+	}
+	return hashes
+}
+
+// ProcessHistoricalBlock stores the data of the passed block which must be part
+// of the historical chain leading up to a loaded utxo snapshot as reported by
+// IsHistoricalBlock so it can be validated in the background.  Only the
+// context-free checks are performed before it is stored.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ProcessHistoricalBlock(block *hdfutil.Block) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	blockHash := block.Hash()
+	node := b.historicalNode(blockHash)
+	if node == nil {
+		str := fmt.Sprintf("already have block %v", blockHash)
+		return ruleError(ErrDuplicateBlock, str)
+	}
+
+	err := checkBlockSanity(block, b.chainParams.PowLimit, b.timeSource,
+		BFNone)
+	if err != nil {
+		return err
+	}
+
+	err = b.db.Update(func(dbTx database.Tx) error {
+		return dbStoreBlock(dbTx, block)
+	})
+	if err != nil {
+		return err
+	}
+	b.index.SetStatusFlags(node, statusDataStored)
+	if err := b.index.flushToDB(); err != nil {
+		return err
+	}
+
+	// Wake up the background validation.
+	select {
+	case b.snapshot.blockStored <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// validateNextHistoricalBlock validates the next block of the historical chain
+// leading up to a loaded utxo snapshot when its data is available and applies
+// it to the utxo set that is built in the background.  Once the block the
+// snapshot was taken at has been validated, the resulting utxo set is compared
+// against the one of the snapshot and the background state is removed when
+// they match.
+//
+// It returns whether or not a block was validated.  Invalid blocks and a
+// mismatched utxo set mark the background validation as failed rather than
+// returning an error.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) validateNextHistoricalBlock() (bool, error) {
+	state := b.snapshot
+	if state == nil || state.failed {
+		return false, nil
+	}
+	node := b.bestChain.NodeByHeight(state.validatedHeight + 1)
+	if !b.index.NodeStatus(node).HaveData() {
+		return false, nil
+	}
+
+	var block *hdfutil.Block
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		block, err = dbFetchBlockByNode(dbTx, node)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	// Validate the block against the utxo set built in the background.
+	view := NewUtxoViewpoint()
+	view.bucketName = snapshotUtxoSetBucketName
+	view.SetBestHash(&node.parent.hash)
+	err = b.checkBlockContext(block, node.parent, BFNone)
+	if err == nil {
+		err = b.checkConnectBlock(node, block, view, nil, BFNone)
+	}
+	if _, ok := err.(RuleError); ok {
+		log.Errorf("Historical block %v (height %d) leading up to the "+
+			"utxo snapshot is invalid: %v -- the chain state can't "+
+			"be trusted", node.hash, node.height, err)
+		state.failed = true
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	err = b.db.Update(func(dbTx database.Tx) error {
+		err := dbPutBucketUtxoView(dbTx, snapshotUtxoSetBucketName, view)
+		if err != nil {
+			return err
+		}
+		state.validatedHeight = node.height
+		return dbPutSnapshotState(dbTx, state)
+	})
+	if err != nil {
+		state.validatedHeight = node.height - 1
+		return false, err
+	}
+	if node != state.base {
+		if node.height%10000 == 0 {
+			log.Infof("Validated historical block %v (height %d "+
+				"of %d) in the background", node.hash,
+				node.height, state.base.height)
+		}
+		return true, nil
+	}
+
+	// The historical chain has been fully validated, so ensure it produced
+	// the utxo set of the snapshot.
+	var utxoSetHash chainhash.Hash
+	err = b.db.View(func(dbTx database.Tx) error {
+		var err error
+		utxoSetHash, _, err = dbWriteUtxoSet(dbTx,
+			snapshotUtxoSetBucketName, nil)
+		return err
+	})
+	if err != nil {
+		return true, err
+	}
+	if utxoSetHash != state.utxoSetHash {
+		log.Errorf("The historical chain leading up to the utxo "+
+			"snapshot at block %v (height %d) results in utxo set "+
+			"hash %v instead of %v -- the chain state can't be "+
+			"trusted", node.hash, node.height, utxoSetHash,
+			state.utxoSetHash)
+		state.failed = true
+		return true, nil
+	}
+
+	err = b.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if err := meta.DeleteBucket(snapshotUtxoSetBucketName); err != nil {
+			return err
+		}
+		return meta.Delete(snapshotStateKeyName)
+	})
+	if err != nil {
+		return true, err
+	}
+	b.snapshot = nil
+
+	log.Infof("Validated the historical chain leading up to the utxo "+
+		"snapshot at block %v (height %d)", node.hash, node.height)
+	return true, nil
+}
+
+// validateHistoricalChain validates the historical chain leading up to a loaded
+// utxo snapshot in the background as the data of its blocks becomes available
+// until it is done, it fails, or the chain is interrupted.
+//
+// This MUST be run as a goroutine.
+func (b *BlockChain) validateHistoricalChain() {
+	b.chainLock.RLock()
+	blockStored := b.snapshot.blockStored
+	b.chainLock.RUnlock()
+
+	for {
+		b.chainLock.Lock()
+		validated, err := b.validateNextHistoricalBlock()
+		done := b.snapshot == nil || b.snapshot.failed
+		b.chainLock.Unlock()
+		if err != nil {
+			select {
+			case <-b.interrupt:
+			default:
+				log.Errorf("Failed to validate the historical "+
+					"chain leading up to the utxo snapshot: %v",
+					err)
+			}
+			return
+		}
+		if done {
+			return
+		}
+		if validated {
+			continue
+		}
+
+		select {
+		case <-blockStored:
+		case <-b.interrupt:
+			return
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfutil"
+)
+
+// dumpTestSnapshot creates a chain instance with the passed blocks and returns
+// a snapshot of its utxo set.  The chain instance is torn down before
+// returning since the teardown of every test database removes the shared test
+// database root.
+func dumpTestSnapshot(blocks []*hdfutil.Block) ([]byte, *UTXOSnapshotInfo, error) {
+	chain, teardownFunc, err := chainSetup("utxosnapshotdump",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer teardownFunc()
+
+	// Since we're not dealing with the real block chain, set the coinbase
+	// maturity to 1.
+	chain.TstSetCoinbaseMaturity(1)
+
+	for i := 1; i < len(blocks); i++ {
+		_, _, err := chain.ProcessBlock(blocks[i], BFNone)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	var snapshot bytes.Buffer
+	info, err := chain.DumpUTXOSnapshot(&snapshot)
+	if err != nil {
+		return nil, nil, err
+	}
+	return snapshot.Bytes(), info, nil
+}
+
+// TestUTXOSnapshot ensures a utxo set snapshot dumped from one chain instance
+// can be loaded into a fresh chain instance when it is committed to by the
+// chain parameters, that the historical chain leading up to it is validated in
+// the background once its blocks are provided, and that snapshots which are
+// not committed to or are corrupt are rejected.
+func TestUTXOSnapshot(t *testing.T) {
+	blocks, err := loadBlocks("blk_0_to_4.dat.bz2")
+	if err != nil {
+		t.Fatalf("Error loading file: %v", err)
+	}
+
+	// Create a chain with the test blocks and dump its utxo set.
+	snapshot, info, err := dumpTestSnapshot(blocks)
+	if err != nil {
+		t.Fatalf("DumpUTXOSnapshot: unexpected error: %v", err)
+	}
+	tip := blocks[len(blocks)-1]
+	if info.Hash != *tip.Hash() || info.Height != int32(len(blocks)-1) {
+		t.Fatalf("DumpUTXOSnapshot: unexpected block %v (height %d)",
+			info.Hash, info.Height)
+	}
+	if info.NumUTXOs == 0 {
+		t.Fatal("DumpUTXOSnapshot: no utxos written")
+	}
+
+	// Create a fresh chain and ensure the snapshot is rejected when it is
+	// not committed to by the chain parameters.
+	snapChain, teardownFunc, err := chainSetup("utxosnapshotload",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Since we're not dealing with the real block chain, set the coinbase
+	// maturity to 1.
+	snapChain.TstSetCoinbaseMaturity(1)
+	loadSnapshot := func(utxoSetHash *chainhash.Hash) error {
+		snapChain.chainParams.AssumeUTXO = []chaincfg.AssumeUTXO{{
+			Height:      info.Height,
+			Hash:        &info.Hash,
+			UTXOSetHash: utxoSetHash,
+			TotalTxns:   info.TotalTxns,
+		}}
+		snapChain.chainLock.Lock()
+		defer snapChain.chainLock.Unlock()
+		_, err := snapChain.loadUTXOSnapshot(bytes.NewReader(snapshot),
+			nil)
+		return err
+	}
+	if err := loadSnapshot(&chainhash.Hash{}); err == nil {
+		t.Fatal("loadUTXOSnapshot: did not reject snapshot with " +
+			"mismatched hash")
+	}
+	if snapChain.BestSnapshot().Height != 0 {
+		t.Fatal("loadUTXOSnapshot: chain state modified by rejected " +
+			"snapshot")
+	}
+
+	// Ensure a snapshot that is neither committed to by the chain
+	// parameters nor matches a provided hash is rejected as well as one
+	// whose stored utxo set hash does not match its utxos.
+	snapChain.chainParams.AssumeUTXO = nil
+	snapChain.chainLock.Lock()
+	_, err = snapChain.loadUTXOSnapshot(bytes.NewReader(snapshot),
+		nil)
+	snapChain.chainLock.Unlock()
+	if err == nil {
+		t.Fatal("loadUTXOSnapshot: did not reject snapshot without " +
+			"commitment")
+	}
+	corrupt := append([]byte(nil), snapshot...)
+	corrupt[len(corrupt)-1] ^= 0x01
+	_, err = snapChain.LoadUTXOSnapshot(bytes.NewReader(corrupt),
+		&info.UTXOSetHash)
+	if err == nil {
+		t.Fatal("LoadUTXOSnapshot: did not reject corrupt snapshot")
+	}
+	if snapChain.BestSnapshot().Height != 0 {
+		t.Fatal("LoadUTXOSnapshot: chain state modified by rejected " +
+			"snapshot")
+	}
+
+	// Load the snapshot with the correct commitment and ensure the chain
+	// state reflects it.
+	if err := loadSnapshot(&info.UTXOSetHash); err != nil {
+		t.Fatalf("loadUTXOSnapshot: unexpected error: %v", err)
+	}
+	best := snapChain.BestSnapshot()
+	if best.Hash != info.Hash || best.TotalTxns != info.TotalTxns {
+		t.Fatalf("unexpected best state %v (total txns %d)", best.Hash,
+			best.TotalTxns)
+	}
+	missing := snapChain.MissingHistoricalBlocks(len(blocks))
+	if len(missing) != len(blocks)-1 {
+		t.Fatalf("MissingHistoricalBlocks: got %d blocks, want %d",
+			len(missing), len(blocks)-1)
+	}
+
+	// Provide the historical blocks and ensure they are validated in the
+	// background and the background state is removed once done.
+	for i := 1; i < len(blocks); i++ {
+		if !snapChain.IsHistoricalBlock(blocks[i].Hash()) {
+			t.Fatalf("IsHistoricalBlock: block %d is not historical",
+				i)
+		}
+		if err := snapChain.ProcessHistoricalBlock(blocks[i]); err != nil {
+			t.Fatalf("ProcessHistoricalBlock fail on block %v: %v",
+				i, err)
+		}
+	}
+	for i := 1; i < len(blocks); i++ {
+		snapChain.chainLock.Lock()
+		validated, err := snapChain.validateNextHistoricalBlock()
+		snapChain.chainLock.Unlock()
+		if err != nil || !validated {
+			t.Fatalf("validateNextHistoricalBlock fail on block %v: "+
+				"validated %v, err %v", i, validated, err)
+		}
+	}
+	if snapChain.snapshot != nil {
+		t.Fatal("background validation state not removed after the " +
+			"historical chain was validated")
+	}
+	if snapChain.IsHistoricalBlock(blocks[1].Hash()) {
+		t.Fatal("IsHistoricalBlock: block is historical after the " +
+			"historical chain was validated")
+	}
+}
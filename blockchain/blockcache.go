@@ -0,0 +1,177 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/database"
+	"github.com/ifishnet/hdfutil"
+)
+
+// recentBlock houses a recently connected block along with its spend journal
+// entry.  It is the value stored in the least recently used list of the recent
+// block cache.
+type recentBlock struct {
+	block *hdfutil.Block
+
+	// stxos is the spend journal entry of the block.  It is only valid
+	// when haveStxos is set since the spend journal entry of a block is
+	// removed when it is disconnected from the main chain.
+	stxos     []SpentTxOut
+	haveStxos bool
+}
+
+// recentBlockCache provides a concurrency safe least recently used cache of the
+// most recently connected blocks along with their spend journal entries.  It
+// allows repeated requests for blocks near the tip of the main chain, such as
+// when serving them via RPC or detaching them during a reorganization, to avoid
+// loading and deserializing them from the database each time.
+//
+// The cached blocks and spend journal entries are shared with all callers, so
+// they MUST NOT be modified.
+type recentBlockCache struct {
+	mtx        sync.Mutex
+	maxEntries int
+	lru        *list.List // Contains *recentBlock.
+	entries    map[chainhash.Hash]*list.Element
+}
+
+// newRecentBlockCache returns a new recent block cache which is limited to the
+// provided max number of blocks.
+func newRecentBlockCache(maxEntries int) *recentBlockCache {
+	return &recentBlockCache{
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		entries:    make(map[chainhash.Hash]*list.Element),
+	}
+}
+
+// lookupBlock returns the cached block with the provided hash or nil when it is
+// not in the cache.  Found entries are marked as the most recently used.
+//
+// This function is safe for concurrent access.
+func (c *recentBlockCache) lookupBlock(hash *chainhash.Hash) *hdfutil.Block {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, ok := c.entries[*hash]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*recentBlock).block
+}
+
+// lookupSpendJournal returns the cached spend journal entry of the block with
+// the provided hash along with whether or not it was found.  Found entries are
+// marked as the most recently used.
+//
+// This function is safe for concurrent access.
+func (c *recentBlockCache) lookupSpendJournal(hash *chainhash.Hash) ([]SpentTxOut, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, ok := c.entries[*hash]
+	if !ok || !elem.Value.(*recentBlock).haveStxos {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*recentBlock).stxos, true
+}
+
+// add adds the provided block along with its spend journal entry to the cache
+// as the most recently used entry and evicts the least recently used entry when
+// the cache is full.
+//
+// The block lazily caches its serialized bytes and transaction hashes, so they
+// are generated prior to adding it to ensure callers sharing the cached block
+// only ever read them.  The block must not be shared with other goroutines yet.
+//
+// This function is safe for concurrent access.
+func (c *recentBlockCache) add(block *hdfutil.Block, stxos []SpentTxOut) {
+	if c.maxEntries == 0 {
+		return
+	}
+	if _, err := block.Bytes(); err != nil {
+		return
+	}
+	for _, tx := range block.Transactions() {
+		tx.Hash()
+		tx.WitnessHash()
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	entry := &recentBlock{block: block, stxos: stxos, haveStxos: true}
+	if elem, ok := c.entries[*block.Hash()]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	if c.lru.Len() >= c.maxEntries {
+		evicted := c.lru.Remove(c.lru.Back()).(*recentBlock)
+		delete(c.entries, *evicted.block.Hash())
+	}
+	c.entries[*block.Hash()] = c.lru.PushFront(entry)
+}
+
+// removeSpendJournal removes the cached spend journal entry of the block with
+// the provided hash, if any, while keeping the block itself since it remains
+// valid.  It must be called when the block is disconnected from the main chain
+// since its spend journal entry is removed from the database at that point.
+//
+// This function is safe for concurrent access.
+func (c *recentBlockCache) removeSpendJournal(hash *chainhash.Hash) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if elem, ok := c.entries[*hash]; ok {
+		entry := elem.Value.(*recentBlock)
+		elem.Value = &recentBlock{block: entry.block}
+	}
+}
+
+// fetchBlockByNode returns the block associated with the provided node from the
+// recent block cache when it is available and loads it from the database
+// otherwise.  The height of the returned block is set to the height of the
+// node.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) fetchBlockByNode(node *blockNode) (*hdfutil.Block, error) {
+	if block := b.recentBlocks.lookupBlock(&node.hash); block != nil {
+		return block, nil
+	}
+
+	var block *hdfutil.Block
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		block, err = dbFetchBlockByNode(dbTx, node)
+		return err
+	})
+	return block, err
+}
+
+// fetchSpendJournal returns the spend journal entry of the provided block from
+// the recent block cache when it is available and loads it from the database
+// otherwise.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) fetchSpendJournal(block *hdfutil.Block) ([]SpentTxOut, error) {
+	if stxos, ok := b.recentBlocks.lookupSpendJournal(block.Hash()); ok {
+		return stxos, nil
+	}
+
+	var stxos []SpentTxOut
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		stxos, err = dbFetchSpendJournalEntry(dbTx, block)
+		return err
+	})
+	return stxos, err
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/ifishnet/hdfd/wire"
+	"github.com/ifishnet/hdfutil"
+)
+
+// TestRecentBlockCache ensures the recent block cache evicts the least recently
+// used blocks once it is full and that spend journal entries removed from it
+// are no longer returned while the blocks themselves are.
+func TestRecentBlockCache(t *testing.T) {
+	t.Parallel()
+
+	blocks := make([]*hdfutil.Block, 4)
+	for i := range blocks {
+		blocks[i] = hdfutil.NewBlock(&wire.MsgBlock{
+			Header: wire.BlockHeader{Nonce: uint32(i)},
+		})
+	}
+	stxos := []SpentTxOut{{Amount: 5000, Height: 1}}
+
+	cache := newRecentBlockCache(3)
+	for _, block := range blocks[:3] {
+		cache.add(block, stxos)
+	}
+
+	// Mark the first block as the most recently used and ensure adding
+	// another block evicts the second one instead.
+	if cache.lookupBlock(blocks[0].Hash()) != blocks[0] {
+		t.Fatal("lookupBlock: block 0 not found")
+	}
+	cache.add(blocks[3], nil)
+	if cache.lookupBlock(blocks[1].Hash()) != nil {
+		t.Fatal("lookupBlock: least recently used block 1 not evicted")
+	}
+	for _, i := range []int{0, 2, 3} {
+		if cache.lookupBlock(blocks[i].Hash()) != blocks[i] {
+			t.Fatalf("lookupBlock: block %d not found", i)
+		}
+	}
+
+	// Ensure the spend journal entries are returned, including the empty
+	// entry of a block that does not spend any outputs.
+	got, ok := cache.lookupSpendJournal(blocks[2].Hash())
+	if !ok || len(got) != 1 || got[0].Amount != 5000 {
+		t.Fatalf("lookupSpendJournal: unexpected entry %v (found %v)",
+			got, ok)
+	}
+	if got, ok := cache.lookupSpendJournal(blocks[3].Hash()); !ok ||
+		len(got) != 0 {
+
+		t.Fatalf("lookupSpendJournal: unexpected entry %v (found %v)",
+			got, ok)
+	}
+
+	// Ensure removing the spend journal entry of a block keeps the block.
+	cache.removeSpendJournal(blocks[2].Hash())
+	if _, ok := cache.lookupSpendJournal(blocks[2].Hash()); ok {
+		t.Fatal("lookupSpendJournal: removed entry still found")
+	}
+	if cache.lookupBlock(blocks[2].Hash()) != blocks[2] {
+		t.Fatal("lookupBlock: block 2 not found after removing its " +
+			"spend journal entry")
+	}
+
+	// Ensure a cache with no entries allowed does not cache anything.
+	cache = newRecentBlockCache(0)
+	cache.add(blocks[0], stxos)
+	if cache.lookupBlock(blocks[0].Hash()) != nil {
+		t.Fatal("lookupBlock: block found in disabled cache")
+	}
+}
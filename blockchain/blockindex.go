@@ -6,9 +6,11 @@ package blockchain
 
 import (
 	"math/big"
+	"math/bits"
 	"sort"
 	"sync"
 	"time"
+	"unsafe"
 
 	"github.com/ifishnet/hdfd/chaincfg"
 	"github.com/ifishnet/hdfd/chaincfg/chainhash"
@@ -68,31 +70,41 @@ type blockNode struct {
 	// definitions in this struct should not be changed without considering
 	// how it affects alignment on 64-bit platforms.  The current order is
 	// specifically crafted to result in minimal padding.  There will be
-	// hundreds of thousands of these in memory, so a few extra bytes of
-	// padding adds up.
+	// millions of these in memory, so a few extra bytes of padding adds up.
 
-	// parent is the parent block for this node.
+	// parent is the parent block for this node.  The hash of the previous
+	// block is not stored separately since it is the hash of the parent.
 	parent *blockNode
 
+	// header is the full header of the block until the node has been
+	// written to the block index in the database.  Afterwards, only the
+	// fields of the header needed for validation are kept in memory and
+	// the full header is loaded from the database on demand.  It is
+	// protected by the block index lock once the node has been added to
+	// the index and must only be accessed via the NodeHeader and
+	// NodeHeaders methods on blockIndex.
+	header *wire.BlockHeader
+
 	// hash is the double sha 256 of the block.
 	hash chainhash.Hash
 
 	// workSum is the total amount of work in the chain up to and including
-	// this node.
-	workSum *big.Int
+	// this node.  It is stored inline rather than as a pointer and the
+	// nodes in the block index carve its backing words from a slab to
+	// avoid separate allocations for every node.
+	workSum big.Int
 
 	// height is the position in the block chain.
 	height int32
 
 	// Some fields from block headers to aid in best chain selection and
-	// reconstructing headers from memory.  These must be treated as
-	// immutable and are intentionally ordered to avoid padding on 64-bit
-	// platforms.
-	version    int32
-	bits       uint32
-	nonce      uint32
-	timestamp  int64
-	merkleRoot chainhash.Hash
+	// validation.  These must be treated as immutable.  The timestamp is
+	// stored as the 32-bit value that is serialized in the header.  The
+	// merkle root and nonce are not needed once the block has been
+	// validated, so they are only available via the full header.
+	version   int32
+	bits      uint32
+	timestamp uint32
 
 	// status is a bitfield representing the validation state of the block. The
 	// status field, unlike the other fields, may be written to and so should
@@ -103,22 +115,27 @@ type blockNode struct {
 
 // initBlockNode initializes a block node from the given header and parent node,
 // calculating the height and workSum from the respective fields on the parent.
+// Any storage already assigned to the workSum of the node is reused.  A copy of
+// the header is kept in the node until it is written to the database.
 // This function is NOT safe for concurrent access.  It must only be called when
 // initially creating a node.
 func initBlockNode(node *blockNode, blockHeader *wire.BlockHeader, parent *blockNode) {
-	*node = blockNode{
-		hash:       blockHeader.BlockHash(),
-		workSum:    CalcWork(blockHeader.Bits),
-		version:    blockHeader.Version,
-		bits:       blockHeader.Bits,
-		nonce:      blockHeader.Nonce,
-		timestamp:  blockHeader.Timestamp.Unix(),
-		merkleRoot: blockHeader.MerkleRoot,
-	}
+	header := *blockHeader
+	node.parent = parent
+	node.header = &header
+	node.hash = blockHeader.BlockHash()
+	node.height = 0
+	node.version = blockHeader.Version
+	node.bits = blockHeader.Bits
+	node.timestamp = uint32(blockHeader.Timestamp.Unix())
+	node.status = statusNone
+
+	work := CalcWork(blockHeader.Bits)
 	if parent != nil {
-		node.parent = parent
 		node.height = parent.height + 1
-		node.workSum = node.workSum.Add(parent.workSum, node.workSum)
+		node.workSum.Add(&parent.workSum, work)
+	} else {
+		node.workSum.Set(work)
 	}
 }
 
@@ -131,25 +148,6 @@ func newBlockNode(blockHeader *wire.BlockHeader, parent *blockNode) *blockNode {
 	return &node
 }
 
-// Header constructs a block header from the node and returns it.
-//
-// This function is safe for concurrent access.
-func (node *blockNode) Header() wire.BlockHeader {
-	// No lock is needed because all accessed fields are immutable.
-	prevHash := &zeroHash
-	if node.parent != nil {
-		prevHash = &node.parent.hash
-	}
-	return wire.BlockHeader{
-		Version:    node.version,
-		PrevBlock:  *prevHash,
-		MerkleRoot: node.merkleRoot,
-		Timestamp:  time.Unix(node.timestamp, 0),
-		Bits:       node.bits,
-		Nonce:      node.nonce,
-	}
-}
-
 // Ancestor returns the ancestor block node at the provided height by following
 // the chain backwards from this node.  The returned block will be nil when a
 // height is requested that is after the height of the passed node or is less
@@ -183,38 +181,7 @@ func (node *blockNode) RelativeAncestor(distance int32) *blockNode {
 //
 // This function is safe for concurrent access.
 func (node *blockNode) CalcPastMedianTime() time.Time {
-	// Create a slice of the previous few block timestamps used to calculate
-	// the median per the number defined by the constant medianTimeBlocks.
-	timestamps := make([]int64, medianTimeBlocks)
-	numNodes := 0
-	iterNode := node
-	for i := 0; i < medianTimeBlocks && iterNode != nil; i++ {
-		timestamps[i] = iterNode.timestamp
-		numNodes++
-
-		iterNode = iterNode.parent
-	}
-
-	// Prune the slice to the actual number of available timestamps which
-	// will be fewer than desired near the beginning of the block chain
-	// and sort them.
-	timestamps = timestamps[:numNodes]
-	sort.Sort(timeSorter(timestamps))
-
-	// NOTE: The consensus rules incorrectly calculate the median for even
-	// numbers of blocks.  A true median averages the middle two elements
-	// for a set with an even number of elements in it.   Since the constant
-	// for the previous number of blocks to be used is odd, this is only an
-	// issue for a few blocks near the beginning of the chain.  I suspect
-	// this is an optimization even though the result is slightly wrong for
-	// a few of the first blocks since after the first few blocks, there
-	// will always be an odd number of blocks in the set per the constant.
-	//
-	// This code follows suit to ensure the same rules are used, however, be
-	// aware that should the medianTimeBlocks constant ever be changed to an
-	// even number, this code will be wrong.
-	medianTimestamp := timestamps[numNodes/2]
-	return time.Unix(medianTimestamp, 0)
+	return CalcPastMedianTime(node)
 }
 
 // blockIndex provides facilities for keeping track of an in-memory index of the
@@ -232,6 +199,20 @@ type blockIndex struct {
 	sync.RWMutex
 	index map[chainhash.Hash]*blockNode
 	dirty map[*blockNode]struct{}
+
+	// bestHeader is the node with the most cumulative work in the index
+	// which is not known to be invalid.  It is nil when it has to be
+	// determined again since the node it referred to, or one of its
+	// ancestors, was marked invalid or nodes were marked valid again.
+	bestHeader *blockNode
+
+	// nodeSlab and wordSlab house the remaining preallocated storage the
+	// nodes added to the index and the work sums of those nodes are carved
+	// from.  numSlabNodes is the total number of nodes all slabs that
+	// were allocated have room for.
+	nodeSlab     []blockNode
+	wordSlab     []big.Word
+	numSlabNodes int
 }
 
 // newBlockIndex returns a new empty instance of a block index.  The index will
@@ -246,6 +227,110 @@ func newBlockIndex(db database.DB, chainParams *chaincfg.Params) *blockIndex {
 	}
 }
 
+const (
+	// blockNodeSlabSize is the number of block nodes that are allocated
+	// at once by the block index.  Allocating the nodes in slabs rather
+	// than individually avoids the per allocation overhead and reduces the
+	// number of objects the garbage collector must track.
+	blockNodeSlabSize = 4096
+
+	// workSumWords is the number of words reserved for the work sum of
+	// each block node allocated by the block index, which is enough to
+	// house any work sum that fits in 256 bits along with the extra word
+	// needed to add to it.  Work sums that exceed it are transparently
+	// reallocated.
+	workSumWords = 256/bits.UintSize + 1
+
+	// blockNodeSize is the size of a block node in bytes.
+	blockNodeSize = int(unsafe.Sizeof(blockNode{}))
+
+	// wordSize is the size of a big.Word in bytes.
+	wordSize = bits.UintSize / 8
+)
+
+// newNode returns a new block node for the given block header and parent node
+// that is carved from the slab storage of the block index.  The node is NOT
+// added to the index.  See newBlockNode for details.
+//
+// This function is safe for concurrent access.
+func (bi *blockIndex) newNode(blockHeader *wire.BlockHeader, parent *blockNode) *blockNode {
+	bi.Lock()
+	if len(bi.nodeSlab) == 0 {
+		bi.nodeSlab = make([]blockNode, blockNodeSlabSize)
+		bi.wordSlab = make([]big.Word, blockNodeSlabSize*workSumWords)
+		bi.numSlabNodes += blockNodeSlabSize
+	}
+	node := &bi.nodeSlab[0]
+	words := bi.wordSlab[:0:workSumWords]
+	bi.nodeSlab = bi.nodeSlab[1:]
+	bi.wordSlab = bi.wordSlab[workSumWords:]
+	bi.Unlock()
+
+	node.workSum.SetBits(words)
+	initBlockNode(node, blockHeader, parent)
+	return node
+}
+
+// BlockIndexMemStats houses details about the memory used by the block index.
+// The sizes are estimates since the exact memory used by the runtime depends on
+// implementation details such as the layout of maps.
+type BlockIndexMemStats struct {
+	// Nodes is the number of block nodes in the index.
+	Nodes int
+
+	// NodeBytes is the memory used by the block nodes, including the
+	// preallocated storage that is not used by any nodes yet.
+	NodeBytes uint64
+
+	// WorkSumBytes is the memory used by the cumulative work sums of the
+	// block nodes.
+	WorkSumBytes uint64
+
+	// IndexBytes is the memory used by the map to look up the block nodes
+	// by their hash.
+	IndexBytes uint64
+
+	// TotalBytes is the total memory used by the block index.
+	TotalBytes uint64
+}
+
+// MemStats returns details about the memory used by the block index.
+//
+// This function is safe for concurrent access.
+func (bi *blockIndex) MemStats() BlockIndexMemStats {
+	bi.RLock()
+	defer bi.RUnlock()
+
+	// Account for all allocated slabs as well as any nodes in the index
+	// that were not carved from them.
+	usedSlabNodes := bi.numSlabNodes - len(bi.nodeSlab)
+	numNodes := bi.numSlabNodes
+	if len(bi.index) > usedSlabNodes {
+		numNodes += len(bi.index) - usedSlabNodes
+	}
+
+	// Account for the work sums that outgrew the space reserved for them
+	// and therefore had to be allocated separately.
+	var extraWords int
+	for _, node := range bi.index {
+		if words := cap(node.workSum.Bits()); words > workSumWords {
+			extraWords += words
+		}
+	}
+
+	// Each map entry consists of the hash, the pointer to the node, and a
+	// byte of metadata, and maps are on average around 80% full.
+	const entrySize = chainhash.HashSize + int(unsafe.Sizeof(uintptr(0))) + 1
+	stats := BlockIndexMemStats{
+		Nodes:        len(bi.index),
+		NodeBytes:    uint64(numNodes * blockNodeSize),
+		WorkSumBytes: uint64((numNodes*workSumWords + extraWords) * wordSize),
+		IndexBytes:   uint64(len(bi.index) * entrySize * 5 / 4),
+	}
+	stats.TotalBytes = stats.NodeBytes + stats.WorkSumBytes + stats.IndexBytes
+	return stats
+}
+
 // HaveBlock returns whether or not the block index contains the provided hash.
 //
 // This function is safe for concurrent access.
@@ -279,11 +364,143 @@ func (bi *blockIndex) AddNode(node *blockNode) {
 }
 
 // addNode adds the provided node to the block index, but does not mark it as
-// dirty. This can be used while initializing the block index.
+// dirty.  The full header of the node is kept until the node is written to the
+// database by flushToDB.
 //
 // This function is NOT safe for concurrent access.
 func (bi *blockIndex) addNode(node *blockNode) {
 	bi.index[node.hash] = node
+
+	if bi.bestHeader != nil && !node.status.KnownInvalid() &&
+		(node.parent == nil || !node.parent.status.KnownInvalid()) &&
+		node.workSum.Cmp(&bi.bestHeader.workSum) > 0 {
+
+		bi.bestHeader = node
+	}
+}
+
+// addStoredNode adds the provided node, which must already be stored in the
+// database, to the block index without marking it as dirty.  Its full header is
+// released since it is loaded from the database on demand.  This can be used
+// while initializing the block index.
+//
+// This function is NOT safe for concurrent access.
+func (bi *blockIndex) addStoredNode(node *blockNode) {
+	node.header = nil
+	bi.addNode(node)
+}
+
+// BestHeader returns the block node with the most cumulative work in the index
+// which is not known to be invalid and does not have an ancestor which is known
+// to be invalid.  Since the index contains blocks which have not been validated
+// yet, such as the blocks of side chains, the returned node may have more work
+// than the tip of the main chain, for example when the validation of the chain
+// lags behind.
+//
+// This function is safe for concurrent access.
+func (bi *blockIndex) BestHeader() *blockNode {
+	bi.Lock()
+	defer bi.Unlock()
+
+	if bi.bestHeader == nil {
+		bi.bestHeader = bi.findBestHeader()
+	}
+	return bi.bestHeader
+}
+
+// findBestHeader scans the index for the block node with the most cumulative
+// work which neither is nor descends from a block known to be invalid.  The
+// descendants of invalid blocks are not necessarily marked as such, so the
+// ancestors of the candidates are checked as well.  The result of the check is
+// remembered for every visited node so each node is only visited once.
+//
+// This function MUST be called with the block index lock held (for reads).
+func (bi *blockIndex) findBestHeader() *blockNode {
+	candidates := make([]*blockNode, 0, len(bi.index))
+	for _, node := range bi.index {
+		if !node.status.KnownInvalid() {
+			candidates = append(candidates, node)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].workSum.Cmp(&candidates[j].workSum) > 0
+	})
+
+	invalidChain := make(map[*blockNode]bool)
+	for _, candidate := range candidates {
+		var path []*blockNode
+		invalid := false
+		for n := candidate; n != nil; n = n.parent {
+			if known, ok := invalidChain[n]; ok {
+				invalid = known
+				break
+			}
+			path = append(path, n)
+			if n.status.KnownInvalid() {
+				invalid = true
+				break
+			}
+		}
+		for _, n := range path {
+			invalidChain[n] = invalid
+		}
+		if !invalid {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// NodeHeader returns the full header of the block associated with the provided
+// node.  It is loaded from the database when it is no longer held by the node.
+//
+// This function is safe for concurrent access.
+func (bi *blockIndex) NodeHeader(node *blockNode) (wire.BlockHeader, error) {
+	headers, err := bi.NodeHeaders([]*blockNode{node})
+	if err != nil {
+		return wire.BlockHeader{}, err
+	}
+	return headers[0], nil
+}
+
+// NodeHeaders returns the full headers of the blocks associated with the
+// provided nodes.  The headers which are no longer held by the nodes are
+// loaded from the database using a single transaction.
+//
+// This function is safe for concurrent access.
+func (bi *blockIndex) NodeHeaders(nodes []*blockNode) ([]wire.BlockHeader, error) {
+	// The headers held by the nodes must be obtained prior to opening the
+	// database transaction since they are only released once they have
+	// been written to the database.
+	headers := make([]wire.BlockHeader, len(nodes))
+	var missing []int
+	bi.RLock()
+	for i, node := range nodes {
+		if node.header == nil {
+			missing = append(missing, i)
+			continue
+		}
+		headers[i] = *node.header
+	}
+	bi.RUnlock()
+	if len(missing) == 0 {
+		return headers, nil
+	}
+
+	err := bi.db.View(func(dbTx database.Tx) error {
+		for _, i := range missing {
+			header, err := dbFetchNodeHeader(dbTx, nodes[i])
+			if err != nil {
+				return err
+			}
+			headers[i] = *header
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return headers, nil
 }
 
 // NodeStatus provides concurrent-safe access to the status field of a node.
@@ -305,6 +522,14 @@ func (bi *blockIndex) SetStatusFlags(node *blockNode, flags blockStatus) {
 	bi.Lock()
 	node.status |= flags
 	bi.dirty[node] = struct{}{}
+
+	// The best header has to be determined again when it is no longer
+	// valid.
+	if node.status.KnownInvalid() && bi.bestHeader != nil &&
+		bi.bestHeader.Ancestor(node.height) == node {
+
+		bi.bestHeader = nil
+	}
 	bi.Unlock()
 }
 
@@ -316,6 +541,12 @@ func (bi *blockIndex) UnsetStatusFlags(node *blockNode, flags blockStatus) {
 	bi.Lock()
 	node.status &^= flags
 	bi.dirty[node] = struct{}{}
+
+	// Nodes which are no longer known to be invalid might have more work
+	// than the best header, so it has to be determined again.
+	if flags&(statusValidateFailed|statusInvalidAncestor) != 0 {
+		bi.bestHeader = nil
+	}
 	bi.Unlock()
 }
 
@@ -338,8 +569,12 @@ func (bi *blockIndex) flushToDB() error {
 		return nil
 	})
 
-	// If write was successful, clear the dirty set.
+	// If write was successful, release the full headers that are now
+	// stored in the database and clear the dirty set.
 	if err == nil {
+		for node := range bi.dirty {
+			node.header = nil
+		}
 		bi.dirty = make(map[*blockNode]struct{})
 	}
 
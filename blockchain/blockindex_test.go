@@ -0,0 +1,167 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfd/database"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// TestBlockIndexNewNode ensures block nodes carved from the slab storage of the
+// block index are identical to individually allocated nodes and that the
+// memory used by them is accounted for.
+func TestBlockIndexNewNode(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	index := newBlockIndex(nil, params)
+
+	// Create enough nodes to require more than one slab, alternating the
+	// difficulty so the work sums differ.
+	numNodes := blockNodeSlabSize + 10
+	header := params.GenesisBlock.Header
+	var parent, wantParent *blockNode
+	for i := 0; i < numNodes; i++ {
+		if parent != nil {
+			header = wire.BlockHeader{
+				Version:   1,
+				PrevBlock: parent.hash,
+				Bits:      params.PowLimitBits - uint32(i%2),
+				Timestamp: time.Unix(1401292357+int64(i), 0),
+				Nonce:     uint32(i),
+			}
+		}
+		node := index.newNode(&header, parent)
+		wantNode := newBlockNode(&header, wantParent)
+		if node.hash != wantNode.hash || node.height != wantNode.height ||
+			node.workSum.Cmp(&wantNode.workSum) != 0 ||
+			*node.header != *wantNode.header {
+
+			t.Fatalf("node %d mismatch: got hash %v height %d work %v, "+
+				"want hash %v height %d work %v", i, node.hash,
+				node.height, &node.workSum, wantNode.hash,
+				wantNode.height, &wantNode.workSum)
+		}
+		index.AddNode(node)
+		parent, wantParent = node, wantNode
+	}
+
+	// Ensure the nodes previously carved from the slab were not modified by
+	// the creation of subsequent nodes.
+	for node, height := parent, int32(numNodes-1); node != nil; node,
+		height = node.parent, height-1 {
+
+		if node.height != height {
+			t.Fatalf("node at height %d has height %d", height,
+				node.height)
+		}
+		if index.LookupNode(&node.hash) != node {
+			t.Fatalf("node at height %d not found in index", height)
+		}
+	}
+
+	stats := index.MemStats()
+	if stats.Nodes != numNodes {
+		t.Fatalf("MemStats: got %d nodes, want %d", stats.Nodes, numNodes)
+	}
+	wantNodeBytes := uint64(2 * blockNodeSlabSize * blockNodeSize)
+	if stats.NodeBytes != wantNodeBytes {
+		t.Fatalf("MemStats: got %d node bytes, want %d", stats.NodeBytes,
+			wantNodeBytes)
+	}
+	wantWorkSumBytes := uint64(2 * blockNodeSlabSize * workSumWords *
+		wordSize)
+	if stats.WorkSumBytes != wantWorkSumBytes {
+		t.Fatalf("MemStats: got %d work sum bytes, want %d",
+			stats.WorkSumBytes, wantWorkSumBytes)
+	}
+	wantTotal := stats.NodeBytes + stats.WorkSumBytes + stats.IndexBytes
+	if stats.IndexBytes == 0 || stats.TotalBytes != wantTotal {
+		t.Fatalf("MemStats: got %d index bytes and %d total bytes, "+
+			"want nonzero and %d", stats.IndexBytes, stats.TotalBytes,
+			wantTotal)
+	}
+}
+
+// TestBlockIndexNodeHeaders ensures the full headers of the nodes are released
+// once they are written to the database and loaded from it on demand, including
+// after the validation status of a node changes.
+func TestBlockIndexNodeHeaders(t *testing.T) {
+	blocks, err := loadBlocks("blk_0_to_4.dat.bz2")
+	if err != nil {
+		t.Fatalf("Error loading file: %v\n", err)
+	}
+
+	// Create a new database and chain instance to run tests against.
+	chain, teardownFunc, err := chainSetup("nodeheaders",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Since we're not dealing with the real block chain, set the coinbase
+	// maturity to 1.
+	chain.TstSetCoinbaseMaturity(1)
+
+	for i := 1; i < len(blocks); i++ {
+		_, _, err := chain.ProcessBlock(blocks[i], BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock fail on block %d: %v\n", i, err)
+		}
+	}
+
+	nodes := make([]*blockNode, 0, len(blocks))
+	for i, block := range blocks {
+		node := chain.index.LookupNode(block.Hash())
+		if node.header != nil {
+			t.Fatalf("node %d still holds its header after being "+
+				"stored", i)
+		}
+		nodes = append(nodes, node)
+	}
+	headers, err := chain.index.NodeHeaders(nodes)
+	if err != nil {
+		t.Fatalf("NodeHeaders: unexpected error: %v", err)
+	}
+	for i, block := range blocks {
+		if headers[i] != block.MsgBlock().Header {
+			t.Fatalf("NodeHeaders: mismatched header %d - got %v, "+
+				"want %v", i, headers[i], block.MsgBlock().Header)
+		}
+	}
+
+	// Ensure changing the status of a node that no longer holds its header
+	// keeps the stored header intact.
+	chain.index.UnsetStatusFlags(nodes[4], statusValid)
+	if err := chain.index.flushToDB(); err != nil {
+		t.Fatalf("flushToDB: unexpected error: %v", err)
+	}
+	header, err := chain.index.NodeHeader(nodes[4])
+	if err != nil {
+		t.Fatalf("NodeHeader: unexpected error: %v", err)
+	}
+	if header != blocks[4].MsgBlock().Header {
+		t.Fatalf("NodeHeader: mismatched header - got %v, want %v",
+			header, blocks[4].MsgBlock().Header)
+	}
+	err = chain.db.View(func(dbTx database.Tx) error {
+		blockIndexBucket := dbTx.Metadata().Bucket(blockIndexBucketName)
+		key := blockIndexKey(&nodes[4].hash, uint32(nodes[4].height))
+		_, status, err := deserializeBlockRow(blockIndexBucket.Get(key))
+		if err != nil {
+			return err
+		}
+		if status.KnownValid() {
+			t.Fatalf("stored status %v was not updated", status)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error loading stored status: %v", err)
+	}
+}
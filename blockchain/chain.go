@@ -8,6 +8,8 @@ package blockchain
 import (
 	"container/list"
 	"fmt"
+	"io"
+	"math/big"
 	"sync"
 	"time"
 
@@ -95,12 +97,18 @@ type BlockChain struct {
 	// separate mutex.
 	checkpoints         []chaincfg.Checkpoint
 	checkpointsByHeight map[int32]*chaincfg.Checkpoint
+	minimumChainWork    *big.Int
+	assumeValid         *chaincfg.Checkpoint
 	db                  database.DB
 	chainParams         *chaincfg.Params
 	timeSource          MedianTimeSource
 	sigCache            *txscript.SigCache
 	indexManager        IndexManager
 	hashCache           *txscript.HashCache
+	utxoCache           *utxoCache
+	recentBlocks        *recentBlockCache
+	pruneTarget         uint64
+	interrupt           <-chan struct{}
 
 	// The following fields are calculated based upon the provided chain
 	// parameters.  They are also set when the instance is created and
@@ -114,6 +122,10 @@ type BlockChain struct {
 	// fields in this struct below this point.
 	chainLock sync.RWMutex
 
+	// checkpointMode defines how the checkpoints are used.  Unlike the
+	// checkpoints themselves, it may be changed while the chain is in use.
+	checkpointMode CheckpointMode
+
 	// These fields are related to the memory block index.  They both have
 	// their own locks, however they are often also protected by the chain
 	// lock to help prevent logic races when blocks are being processed.
@@ -180,10 +192,24 @@ type BlockChain struct {
 	unknownRulesWarned    bool
 	unknownVersionsWarned bool
 
+	// nextPruneHeight is the height the best chain has to reach before the
+	// next attempt to prune the stored block data.  It is protected by the
+	// chain lock.
+	nextPruneHeight int32
+
+	// snapshot houses the state of the background validation of the
+	// historical chain leading up to a loaded utxo snapshot.  It is nil
+	// when no snapshot was loaded or the historical chain has been
+	// validated.  It is protected by the chain lock.
+	snapshot *snapshotState
+
 	// The notifications field stores a slice of callbacks to be executed on
-	// certain blockchain events.
-	notificationsLock sync.RWMutex
-	notifications     []NotificationCallback
+	// certain blockchain events.  Similarly, the chainViewCallbacks field
+	// stores a slice of callbacks to be executed when the best chain
+	// changes.  Both are protected by the notifications lock.
+	notificationsLock  sync.RWMutex
+	notifications      []NotificationCallback
+	chainViewCallbacks []ChainViewCallback
 }
 
 // HaveBlock returns whether or not the chain instance has the block represented
@@ -406,7 +432,8 @@ func (b *BlockChain) calcSequenceLock(node *blockNode, tx *hdfutil.Tx, utxoView
 				"transaction %s:%d either does not exist or "+
 				"has already been spent", txIn.PreviousOutPoint,
 				tx.Hash(), txInIndex)
-			return sequenceLock, ruleError(ErrMissingTxOut, str)
+			return sequenceLock, inputRuleError(ErrMissingTxOut, str,
+				tx.Hash(), txInIndex)
 		}
 
 		// If the input height is set to the mempool height, then we
@@ -610,7 +637,7 @@ func (b *BlockChain) connectBlock(node *blockNode, block *hdfutil.Block,
 	// Atomically insert info into the database.
 	err = b.db.Update(func(dbTx database.Tx) error {
 		// Update best block state.
-		err := dbPutBestState(dbTx, state, node.workSum)
+		err := dbPutBestState(dbTx, state, &node.workSum)
 		if err != nil {
 			return err
 		}
@@ -622,14 +649,6 @@ func (b *BlockChain) connectBlock(node *blockNode, block *hdfutil.Block,
 			return err
 		}
 
-		// Update the utxo set using the state of the utxo view.  This
-		// entails removing all of the utxos spent and adding the new
-		// ones created by the block.
-		err = dbPutUtxoView(dbTx, view)
-		if err != nil {
-			return err
-		}
-
 		// Update the transaction spend journal by adding a record for
 		// the block that contains all txos spent by it.
 		err = dbPutSpendJournalEntry(dbTx, block.Hash(), stxos)
@@ -653,10 +672,19 @@ func (b *BlockChain) connectBlock(node *blockNode, block *hdfutil.Block,
 		return err
 	}
 
+	// Update the utxo cache using the state of the utxo view.  This entails
+	// marking all of the utxos spent and adding the new ones created by the
+	// block.
+	b.utxoCache.commit(view)
+
 	// Prune fully spent entries and mark all entries in the view unmodified
-	// now that the modifications have been committed to the database.
+	// now that the modifications have been committed to the utxo cache.
 	view.commit()
 
+	// Cache the block along with its spend journal entry since blocks near
+	// the tip are the most frequently requested ones.
+	b.recentBlocks.add(block, stxos)
+
 	// This node is now the end of the best chain.
 	b.bestChain.SetTip(node)
 
@@ -669,6 +697,13 @@ func (b *BlockChain) connectBlock(node *blockNode, block *hdfutil.Block,
 	b.stateSnapshot = state
 	b.stateLock.Unlock()
 
+	// Flush the utxo cache to the database as needed.  Errors are only
+	// logged since the modifications are kept in the cache and the next
+	// flush will write them.
+	if err := b.utxoCache.maybeFlush(); err != nil {
+		log.Errorf("Unable to flush the utxo cache: %v", err)
+	}
+
 	// Notify the caller that the block was connected to the main chain.
 	// The caller would typically want to react with actions such as
 	// updating wallets.
@@ -692,12 +727,7 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *hdfutil.Block, view
 
 	// Load the previous block since some details for it are needed below.
 	prevNode := node.parent
-	var prevBlock *hdfutil.Block
-	err := b.db.View(func(dbTx database.Tx) error {
-		var err error
-		prevBlock, err = dbFetchBlockByNode(dbTx, prevNode)
-		return err
-	})
+	prevBlock, err := b.fetchBlockByNode(prevNode)
 	if err != nil {
 		return err
 	}
@@ -708,6 +738,12 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *hdfutil.Block, view
 		return err
 	}
 
+	// The utxo set in the database is updated directly below, so ensure all
+	// of the modifications held in the utxo cache have been written first.
+	if err := b.utxoCache.flush(false); err != nil {
+		return err
+	}
+
 	// Generate a new best state snapshot that will be used to update the
 	// database and later memory if all database updates are successful.
 	b.stateLock.RLock()
@@ -722,7 +758,7 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *hdfutil.Block, view
 
 	err = b.db.Update(func(dbTx database.Tx) error {
 		// Update best block state.
-		err := dbPutBestState(dbTx, state, node.workSum)
+		err := dbPutBestState(dbTx, state, &node.workSum)
 		if err != nil {
 			return err
 		}
@@ -741,6 +777,10 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *hdfutil.Block, view
 		if err != nil {
 			return err
 		}
+		err = dbPutUtxoStateConsistency(dbTx, &prevNode.hash)
+		if err != nil {
+			return err
+		}
 
 		// Before we delete the spend journal entry for this back,
 		// we'll fetch it as is so the indexers can utilize if needed.
@@ -772,10 +812,15 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *hdfutil.Block, view
 		return err
 	}
 
-	// Prune fully spent entries and mark all entries in the view unmodified
-	// now that the modifications have been committed to the database.
+	// Update the utxo cache to reflect the modifications which have been
+	// committed to the database.  Then prune fully spent entries and mark
+	// all entries in the view unmodified.
+	b.utxoCache.updateFlushed(view)
 	view.commit()
 
+	// The spend journal entry of the block no longer exists.
+	b.recentBlocks.removeSpendJournal(block.Hash())
+
 	// This node's parent is now the end of the best chain.
 	b.bestChain.SetTip(node.parent)
 
@@ -852,6 +897,21 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 	oldBest := tip
 	newBest := tip
 
+	// Notify the chain view subscribers about all of the blocks which were
+	// disconnected and connected once done, including when an error
+	// prevents the reorganize from completing, so they remain in sync with
+	// the best chain.
+	chainView := b.newReorgNotification()
+	if chainView != nil {
+		defer func() {
+			if len(chainView.Disconnected) != 0 ||
+				len(chainView.Connected) != 0 {
+
+				b.sendChainViewNotification(chainView)
+			}
+		}()
+	}
+
 	// All of the blocks to detach and related spend journal entries needed
 	// to unspend transaction outputs in the blocks being disconnected must
 	// be loaded from the database during the reorg check phase below and
@@ -861,6 +921,15 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 	detachSpentTxOuts := make([][]SpentTxOut, 0, detachNodes.Len())
 	attachBlocks := make([]*hdfutil.Block, 0, attachNodes.Len())
 
+	// Disconnecting blocks requires the utxo set in the database to be up
+	// to date since legacy spend journal entries are resolved by searching
+	// it directly.
+	if detachNodes.Len() > 0 {
+		if err := b.utxoCache.flush(false); err != nil {
+			return err
+		}
+	}
+
 	// Disconnect all of the blocks back to the point of the fork.  This
 	// entails loading the blocks and their associated spent txos from the
 	// database and using that information to unspend all of the spent txos
@@ -869,12 +938,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 	view.SetBestHash(&oldBest.hash)
 	for e := detachNodes.Front(); e != nil; e = e.Next() {
 		n := e.Value.(*blockNode)
-		var block *hdfutil.Block
-		err := b.db.View(func(dbTx database.Tx) error {
-			var err error
-			block, err = dbFetchBlockByNode(dbTx, n)
-			return err
-		})
+		block, err := b.fetchBlockByNode(n)
 		if err != nil {
 			return err
 		}
@@ -886,18 +950,14 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err = view.fetchInputUtxos(b.db, block)
+		err = view.fetchInputUtxos(b.utxoCache, block)
 		if err != nil {
 			return err
 		}
 
 		// Load all of the spent txos for the block from the spend
 		// journal.
-		var stxos []SpentTxOut
-		err = b.db.View(func(dbTx database.Tx) error {
-			stxos, err = dbFetchSpendJournalEntry(dbTx, block)
-			return err
-		})
+		stxos, err := b.fetchSpendJournal(block)
 		if err != nil {
 			return err
 		}
@@ -906,7 +966,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		detachBlocks = append(detachBlocks, block)
 		detachSpentTxOuts = append(detachSpentTxOuts, stxos)
 
-		err = view.disconnectTransactions(b.db, block, stxos)
+		err = view.disconnectTransactions(b.utxoCache, block, stxos)
 		if err != nil {
 			return err
 		}
@@ -936,12 +996,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 	for e := attachNodes.Front(); e != nil; e = e.Next() {
 		n := e.Value.(*blockNode)
 
-		var block *hdfutil.Block
-		err := b.db.View(func(dbTx database.Tx) error {
-			var err error
-			block, err = dbFetchBlockByNode(dbTx, n)
-			return err
-		})
+		block, err := b.fetchBlockByNode(n)
 		if err != nil {
 			return err
 		}
@@ -953,7 +1008,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		// checkConnectBlock gets skipped, we still need to update the UTXO
 		// view.
 		if b.index.NodeStatus(n).KnownValid() {
-			err = view.fetchInputUtxos(b.db, block)
+			err = view.fetchInputUtxos(b.utxoCache, block)
 			if err != nil {
 				return err
 			}
@@ -974,8 +1029,9 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		// In the case the block is determined to be invalid due to a
 		// rule violation, mark it as invalid and mark all of its
 		// descendants as having an invalid ancestor.
-		err = b.checkConnectBlock(n, block, view, nil)
+		err = b.checkConnectBlock(n, block, view, nil, BFNone)
 		if err != nil {
+			err = withBlockContext(err, &n.hash, n.height)
 			if _, ok := err.(RuleError); ok {
 				b.index.SetStatusFlags(n, statusValidateFailed)
 				for de := e.Next(); de != nil; de = de.Next() {
@@ -1005,14 +1061,14 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err := view.fetchInputUtxos(b.db, block)
+		err := view.fetchInputUtxos(b.utxoCache, block)
 		if err != nil {
 			return err
 		}
 
 		// Update the view to unspend all of the spent txos and remove
 		// the utxos created by the block.
-		err = view.disconnectTransactions(b.db, block,
+		err = view.disconnectTransactions(b.utxoCache, block,
 			detachSpentTxOuts[i])
 		if err != nil {
 			return err
@@ -1023,6 +1079,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		if err != nil {
 			return err
 		}
+		chainView.addDisconnected(block, n.height, detachSpentTxOuts[i])
 	}
 
 	// Connect the new best chain blocks.
@@ -1032,7 +1089,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err := view.fetchInputUtxos(b.db, block)
+		err := view.fetchInputUtxos(b.utxoCache, block)
 		if err != nil {
 			return err
 		}
@@ -1052,6 +1109,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		if err != nil {
 			return err
 		}
+		chainView.addConnected(block, n.height, stxos)
 	}
 
 	// Log the point where the chain forked and old and new best chain
@@ -1110,7 +1168,7 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *hdfutil.Block, fla
 		view.SetBestHash(parentHash)
 		stxos := make([]SpentTxOut, 0, countSpentOutputs(block))
 		if !fastAdd {
-			err := b.checkConnectBlock(node, block, view, &stxos)
+			err := b.checkConnectBlock(node, block, view, &stxos, flags)
 			if err == nil {
 				b.index.SetStatusFlags(node, statusValid)
 			} else if _, ok := err.(RuleError); ok {
@@ -1131,7 +1189,7 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *hdfutil.Block, fla
 		// utxos, spend them, and add the new utxos being created by
 		// this block.
 		if fastAdd {
-			err := view.fetchInputUtxos(b.db, block)
+			err := view.fetchInputUtxos(b.utxoCache, block)
 			if err != nil {
 				return false, err
 			}
@@ -1166,6 +1224,12 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *hdfutil.Block, fla
 			flushIndexState()
 		}
 
+		// Notify the chain view subscribers about the connected block.
+		if chainView := b.newReorgNotification(); chainView != nil {
+			chainView.addConnected(block, node.height, stxos)
+			b.sendChainViewNotification(chainView)
+		}
+
 		return true, nil
 	}
 	if fastAdd {
@@ -1175,7 +1239,7 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *hdfutil.Block, fla
 
 	// We're extending (or creating) a side chain, but the cumulative
 	// work for this new side chain is not enough to make it the new chain.
-	if node.workSum.Cmp(b.bestChain.Tip().workSum) <= 0 {
+	if node.workSum.Cmp(&b.bestChain.Tip().workSum) <= 0 {
 		// Log information about how the block is forking the chain.
 		fork := b.bestChain.FindFork(node)
 		if fork.hash.IsEqual(parentHash) {
@@ -1219,6 +1283,7 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *hdfutil.Block, fla
 // factors are used to guess, but the key factors that allow the chain to
 // believe it is current are:
 //  - Latest block height is after the latest checkpoint (if enabled)
+//  - Latest block has at least the minimum chain work (if enabled)
 //  - Latest block has a timestamp newer than 24 hours ago
 //
 // This function MUST be called with the chain state lock held (for reads).
@@ -1230,19 +1295,26 @@ func (b *BlockChain) isCurrent() bool {
 		return false
 	}
 
+	// Not current if the latest main (best) chain has less work than the
+	// main chain is known to have.
+	if !b.hasMinimumChainWork(b.bestChain.Tip()) {
+		return false
+	}
+
 	// Not current if the latest best block has a timestamp before 24 hours
 	// ago.
 	//
 	// The chain appears to be current if none of the checks reported
 	// otherwise.
 	minus24Hours := b.timeSource.AdjustedTime().Add(-24 * time.Hour).Unix()
-	return b.bestChain.Tip().timestamp >= minus24Hours
+	return int64(b.bestChain.Tip().timestamp) >= minus24Hours
 }
 
 // IsCurrent returns whether or not the chain believes it is current.  Several
 // factors are used to guess, but the key factors that allow the chain to
 // believe it is current are:
 //  - Latest block height is after the latest checkpoint (if enabled)
+//  - Latest block has at least the minimum chain work (if enabled)
 //  - Latest block has a timestamp newer than 24 hours ago
 //
 // This function is safe for concurrent access.
@@ -1265,6 +1337,68 @@ func (b *BlockChain) BestSnapshot() *BestState {
 	return snapshot
 }
 
+// BlockIndexMemStats returns details about the memory used by the in-memory
+// index of all known block headers.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BlockIndexMemStats() BlockIndexMemStats {
+	return b.index.MemStats()
+}
+
+// ChainWork houses details about the cumulative work of the tip of the main
+// chain and of the best known header, which is the block in the index with the
+// most cumulative work that is not known to be invalid.  The main chain is
+// behind the best header when the blocks leading to it have not been validated
+// yet, so monitoring how far it is behind reveals stuck or lagging validation.
+type ChainWork struct {
+	TipHash          chainhash.Hash // The hash of the main chain tip.
+	TipHeight        int32          // The height of the main chain tip.
+	TipWork          *big.Int       // The total work of the main chain.
+	BestHeaderHash   chainhash.Hash // The hash of the best header.
+	BestHeaderHeight int32          // The height of the best header.
+	BestHeaderWork   *big.Int       // The total work of the best header.
+}
+
+// BlocksBehind returns the number of blocks the tip of the main chain is behind
+// the best known header.  It is zero when the tip is the best header.
+func (w *ChainWork) BlocksBehind() int32 {
+	if w.BestHeaderHeight <= w.TipHeight {
+		return 0
+	}
+	return w.BestHeaderHeight - w.TipHeight
+}
+
+// WorkBehind returns the amount of work the main chain is behind the best known
+// header.  It is zero when the tip is the best header.
+func (w *ChainWork) WorkBehind() *big.Int {
+	behind := new(big.Int).Sub(w.BestHeaderWork, w.TipWork)
+	if behind.Sign() < 0 {
+		behind.SetInt64(0)
+	}
+	return behind
+}
+
+// ChainWork returns details about the cumulative work of the tip of the main
+// chain compared to the best known header.  See ChainWork for details.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ChainWork() *ChainWork {
+	tip := b.bestChain.Tip()
+	best := b.index.BestHeader()
+	if best == nil || best.workSum.Cmp(&tip.workSum) < 0 {
+		best = tip
+	}
+
+	return &ChainWork{
+		TipHash:          tip.hash,
+		TipHeight:        tip.height,
+		TipWork:          new(big.Int).Set(&tip.workSum),
+		BestHeaderHash:   best.hash,
+		BestHeaderHeight: best.height,
+		BestHeaderWork:   new(big.Int).Set(&best.workSum),
+	}
+}
+
 // HeaderByHash returns the block header identified by the given hash or an
 // error if it doesn't exist. Note that this will return headers from both the
 // main and side chains.
@@ -1275,7 +1409,7 @@ func (b *BlockChain) HeaderByHash(hash *chainhash.Hash) (wire.BlockHeader, error
 		return wire.BlockHeader{}, err
 	}
 
-	return node.Header(), nil
+	return b.index.NodeHeader(node)
 }
 
 // MainChainHasBlock returns whether or not the block with the given hash is in
@@ -1597,11 +1731,16 @@ func (b *BlockChain) locateHeaders(locator BlockLocator, hashStop *chainhash.Has
 	}
 
 	// Populate and return the found headers.
-	headers := make([]wire.BlockHeader, 0, total)
+	nodes := make([]*blockNode, 0, total)
 	for i := uint32(0); i < total; i++ {
-		headers = append(headers, node.Header())
+		nodes = append(nodes, node)
 		node = b.bestChain.Next(node)
 	}
+	headers, err := b.index.NodeHeaders(nodes)
+	if err != nil {
+		log.Errorf("Unable to load located headers: %v", err)
+		return nil
+	}
 	return headers
 }
 
@@ -1678,6 +1817,25 @@ type Config struct {
 	// checkpoints.
 	Checkpoints []chaincfg.Checkpoint
 
+	// CheckpointMode defines how the checkpoints are used.  The zero value
+	// enforces them, which allows skipping validation of the blocks before
+	// the latest checkpoint.
+	CheckpointMode CheckpointMode
+
+	// MinimumChainWork overrides the minimum cumulative work the main chain
+	// is known to have defined by the chain parameters.  A value of zero
+	// disables the checks.
+	//
+	// This field can be nil to use the value of the chain parameters.
+	MinimumChainWork *big.Int
+
+	// AssumeValid overrides the block whose ancestors are assumed to have
+	// valid scripts defined by the chain parameters.  A block with a zero
+	// hash disables the assumption.
+	//
+	// This field can be nil to use the value of the chain parameters.
+	AssumeValid *chaincfg.Checkpoint
+
 	// TimeSource defines the median time source to use for things such as
 	// block processing and determining whether or not the chain is current.
 	//
@@ -1711,6 +1869,52 @@ type Config struct {
 	// This field can be nil if the caller is not interested in using a
 	// signature cache.
 	HashCache *txscript.HashCache
+
+	// Prune specifies the target size in bytes for the stored block data.
+	// The data of the oldest blocks is removed once it is exceeded while
+	// always keeping the data of at least the most recent MinBlocksToKeep
+	// blocks.  It must be at least MinPruneTarget.
+	//
+	// This field can be zero to disable pruning, however, a database that
+	// has already been pruned can't be used with pruning disabled.
+	Prune uint64
+
+	// UtxoCacheMaxSize specifies the max size in bytes of the in-memory
+	// cache of the utxo set.  The modifications made to the utxo set by
+	// connected blocks are held in the cache and written to the database
+	// once it exceeds this size, or periodically otherwise.
+	//
+	// This field can be zero to write the modifications after every block.
+	UtxoCacheMaxSize uint64
+
+	// RecentBlockCacheSize specifies the max number of the most recently
+	// connected blocks to keep in memory along with their spend journal
+	// entries so requests for blocks near the tip of the main chain do not
+	// need to load them from the database.
+	//
+	// This field can be zero to disable the cache.
+	RecentBlockCacheSize int
+
+	// UTXOSnapshot specifies a utxo set snapshot as produced by
+	// DumpUTXOSnapshot to bootstrap the chain state from.  The snapshot
+	// must be committed to by the chain parameters or match
+	// UTXOSnapshotHash and is ignored when the chain state has already been
+	// initialized beyond the genesis block.  The historical chain leading
+	// up to the snapshot is validated in the background as its blocks are
+	// provided via ProcessHistoricalBlock.
+	//
+	// This field can be nil if the caller does not wish to load a utxo set
+	// snapshot.
+	UTXOSnapshot io.Reader
+
+	// UTXOSnapshotHash specifies the hash of the utxo set in UTXOSnapshot
+	// the caller trusts for snapshots that are not committed to by the
+	// chain parameters, such as one dumped from another node of the same
+	// operator.
+	//
+	// This field can be nil to only accept snapshots committed to by the
+	// chain parameters.
+	UTXOSnapshotHash *chainhash.Hash
 }
 
 // New returns a BlockChain instance using the provided configuration details.
@@ -1725,6 +1929,25 @@ func New(config *Config) (*BlockChain, error) {
 	if config.TimeSource == nil {
 		return nil, AssertError("blockchain.New timesource is nil")
 	}
+	if config.Prune != 0 && config.Prune < MinPruneTarget {
+		return nil, fmt.Errorf("prune target of %d bytes is below the "+
+			"minimum of %d bytes", config.Prune, MinPruneTarget)
+	}
+
+	// Block data that has been pruned can't be recovered, so ensure pruning
+	// is not disabled for a database which has already been pruned.
+	if config.Prune == 0 {
+		pruned, err := config.DB.BeenPruned()
+		if err != nil {
+			return nil, err
+		}
+		if pruned {
+			return nil, fmt.Errorf("pruning can't be disabled since " +
+				"the database has already been pruned -- the " +
+				"database must be deleted and the chain " +
+				"downloaded again to disable it")
+		}
+	}
 
 	// Generate a checkpoint by height map from the provided checkpoints
 	// and assert the provided checkpoints are sorted by height as required.
@@ -1744,13 +1967,35 @@ func New(config *Config) (*BlockChain, error) {
 		}
 	}
 
+	// Apply the overrides of the minimum chain work and the assumed valid
+	// block.
 	params := config.ChainParams
+	minimumChainWork := params.MinimumChainWork
+	if config.MinimumChainWork != nil {
+		minimumChainWork = config.MinimumChainWork
+	}
+	if minimumChainWork != nil && minimumChainWork.Sign() == 0 {
+		minimumChainWork = nil
+	}
+	assumeValid := params.AssumeValid
+	if config.AssumeValid != nil {
+		assumeValid = config.AssumeValid
+	}
+	if assumeValid != nil && (assumeValid.Hash == nil ||
+		*assumeValid.Hash == (chainhash.Hash{})) {
+
+		assumeValid = nil
+	}
+
 	targetTimespan := int64(params.TargetTimespan / time.Second)
 	targetTimePerBlock := int64(params.TargetTimePerBlock / time.Second)
 	adjustmentFactor := params.RetargetAdjustmentFactor
 	b := BlockChain{
 		checkpoints:         config.Checkpoints,
 		checkpointsByHeight: checkpointsByHeight,
+		minimumChainWork:    minimumChainWork,
+		assumeValid:         assumeValid,
+		checkpointMode:      config.CheckpointMode,
 		db:                  config.DB,
 		chainParams:         params,
 		timeSource:          config.TimeSource,
@@ -1761,6 +2006,10 @@ func New(config *Config) (*BlockChain, error) {
 		blocksPerRetarget:   int32(targetTimespan / targetTimePerBlock),
 		index:               newBlockIndex(config.DB, params),
 		hashCache:           config.HashCache,
+		utxoCache:           newUtxoCache(config.DB, config.UtxoCacheMaxSize),
+		recentBlocks:        newRecentBlockCache(config.RecentBlockCacheSize),
+		pruneTarget:         config.Prune,
+		interrupt:           config.Interrupt,
 		bestChain:           newChainView(nil),
 		orphans:             make(map[chainhash.Hash]*orphanBlock),
 		prevOrphans:         make(map[chainhash.Hash][]*orphanBlock),
@@ -1780,6 +2029,21 @@ func New(config *Config) (*BlockChain, error) {
 		return nil, err
 	}
 
+	// Initialize the utxo cache and bring the utxo set up to date with the
+	// best chain as needed.
+	if err := b.initUtxoCache(); err != nil {
+		return nil, err
+	}
+
+	// Bootstrap the chain state from the utxo set snapshot when requested.
+	if config.UTXOSnapshot != nil {
+		_, err := b.loadUTXOSnapshot(config.UTXOSnapshot,
+			config.UTXOSnapshotHash)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Initialize and catch up all of the currently active optional indexes
 	// as needed.
 	if config.IndexManager != nil {
@@ -1797,7 +2061,13 @@ func New(config *Config) (*BlockChain, error) {
 	bestNode := b.bestChain.Tip()
 	log.Infof("Chain state (height %d, hash %v, totaltx %d, work %v)",
 		bestNode.height, bestNode.hash, b.stateSnapshot.TotalTxns,
-		bestNode.workSum)
+		&bestNode.workSum)
+
+	// Validate the historical chain leading up to a loaded utxo snapshot
+	// in the background.
+	if b.snapshot != nil {
+		go b.validateHistoricalChain()
+	}
 
 	return &b, nil
 }
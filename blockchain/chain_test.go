@@ -5,6 +5,7 @@
 package blockchain
 
 import (
+	"math/big"
 	"reflect"
 	"testing"
 	"time"
@@ -127,7 +128,7 @@ func TestCalcSequenceLock(t *testing.T) {
 	// Generate enough synthetic blocks to activate CSV.
 	chain := newFakeChain(netParams)
 	node := chain.bestChain.Tip()
-	blockTime := node.Header().Timestamp
+	blockTime := time.Unix(int64(node.timestamp), 0)
 	numBlocksToActivate := (netParams.MinerConfirmationWindow * 3)
 	for i := uint32(0); i < numBlocksToActivate; i++ {
 		blockTime = blockTime.Add(time.Second)
@@ -456,7 +457,7 @@ func nodeHashes(nodes []*blockNode, indexes ...int) []chainhash.Hash {
 func nodeHeaders(nodes []*blockNode, indexes ...int) []wire.BlockHeader {
 	headers := make([]wire.BlockHeader, 0, len(indexes))
 	for _, idx := range indexes {
-		headers = append(headers, nodes[idx].Header())
+		headers = append(headers, *nodes[idx].header)
 	}
 	return headers
 }
@@ -964,3 +965,91 @@ func TestIntervalBlockHashes(t *testing.T) {
 		}
 	}
 }
+
+// TestChainWork ensures the cumulative work of the main chain tip is properly
+// compared to the best known header, including when blocks are marked invalid
+// and valid again.
+func TestChainWork(t *testing.T) {
+	// Construct a synthetic block chain with a block index consisting of
+	// the following structure where the main chain tip is 3.
+	// 	genesis -> 1 -> 2 -> 3 -> 4 -> 5
+	// 	                     \-> 3a -> 4a -> 5a -> 6a
+	params := &chaincfg.MainNetParams
+	chain := newFakeChain(params)
+	chainNodes := func(parent *blockNode, numNodes int) []*blockNode {
+		nodes := make([]*blockNode, numNodes)
+		for i := range nodes {
+			nodes[i] = newFakeNode(parent, 1, params.PowLimitBits,
+				time.Unix(int64(i), 0))
+			chain.index.AddNode(nodes[i])
+			parent = nodes[i]
+		}
+		return nodes
+	}
+	branch0Nodes := chainNodes(chain.bestChain.Genesis(), 5)
+	branch1Nodes := chainNodes(branch0Nodes[1], 4)
+	chain.bestChain.SetTip(branch0Nodes[2])
+
+	assertChainWork := func(name string, best *blockNode, blocksBehind int32) {
+		t.Helper()
+
+		tip := chain.bestChain.Tip()
+		chainWork := chain.ChainWork()
+		if chainWork.TipHash != tip.hash ||
+			chainWork.TipHeight != tip.height ||
+			chainWork.TipWork.Cmp(&tip.workSum) != 0 {
+
+			t.Fatalf("%s: unexpected tip: got %v (height %d, work %v)",
+				name, chainWork.TipHash, chainWork.TipHeight,
+				chainWork.TipWork)
+		}
+		if chainWork.BestHeaderHash != best.hash ||
+			chainWork.BestHeaderHeight != best.height ||
+			chainWork.BestHeaderWork.Cmp(&best.workSum) != 0 {
+
+			t.Fatalf("%s: unexpected best header: got %v (height "+
+				"%d), want %v (height %d)", name,
+				chainWork.BestHeaderHash,
+				chainWork.BestHeaderHeight, best.hash, best.height)
+		}
+		if got := chainWork.BlocksBehind(); got != blocksBehind {
+			t.Fatalf("%s: unexpected blocks behind: got %d, want %d",
+				name, got, blocksBehind)
+		}
+		wantWorkBehind := new(big.Int).Sub(&best.workSum, &tip.workSum)
+		if got := chainWork.WorkBehind(); got.Cmp(wantWorkBehind) != 0 {
+			t.Fatalf("%s: unexpected work behind: got %v, want %v",
+				name, got, wantWorkBehind)
+		}
+	}
+
+	assertChainWork("side chain best", tstTip(branch1Nodes), 3)
+
+	// Adding a block with more work to the side chain must be reflected.
+	branch1Nodes = append(branch1Nodes, chainNodes(tstTip(branch1Nodes), 1)...)
+	assertChainWork("side chain extended", tstTip(branch1Nodes), 4)
+
+	// Marking a block of the side chain invalid must make the main chain
+	// the best one.
+	chain.index.SetStatusFlags(branch1Nodes[1], statusValidateFailed)
+	assertChainWork("side chain invalid", tstTip(branch0Nodes), 2)
+
+	// Blocks added to the invalid side chain must be ignored.
+	for _, node := range branch1Nodes[2:] {
+		chain.index.SetStatusFlags(node, statusInvalidAncestor)
+	}
+	invalidNodes := chainNodes(tstTip(branch1Nodes), 1)
+	chain.index.SetStatusFlags(invalidNodes[0], statusInvalidAncestor)
+	assertChainWork("invalid side chain extended", tstTip(branch0Nodes), 2)
+
+	// Marking the side chain valid again must make it the best one.
+	const invalidFlags = statusValidateFailed | statusInvalidAncestor
+	for _, node := range append(branch1Nodes, invalidNodes...) {
+		chain.index.UnsetStatusFlags(node, invalidFlags)
+	}
+	assertChainWork("side chain valid", tstTip(invalidNodes), 5)
+
+	// The tip must be reported as the best header once it is.
+	chain.bestChain.SetTip(tstTip(invalidNodes))
+	assertChainWork("side chain tip", tstTip(invalidNodes), 0)
+}
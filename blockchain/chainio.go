@@ -67,6 +67,12 @@ var (
 	// unspent transaction output set.
 	utxoSetBucketName = []byte("utxosetv2")
 
+	// utxoStateConsistencyKeyName is the name of the db key used to store
+	// the hash of the block the utxo set in the database is consistent
+	// with.  It lags behind the best chain state while modifications to the
+	// utxo set are held in the utxo cache.
+	utxoStateConsistencyKeyName = []byte("utxostateconsistency")
+
 	// byteOrder is the preferred byte order used for serializing numeric
 	// fields for storage in the database.
 	byteOrder = binary.LittleEndian
@@ -263,18 +269,7 @@ func (b *BlockChain) FetchSpendJournal(targetBlock *hdfutil.Block) ([]SpentTxOut
 	b.chainLock.RLock()
 	defer b.chainLock.RUnlock()
 
-	var spendEntries []SpentTxOut
-	err := b.db.View(func(dbTx database.Tx) error {
-		var err error
-
-		spendEntries, err = dbFetchSpendJournalEntry(dbTx, targetBlock)
-		return err
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	return spendEntries, nil
+	return b.fetchSpendJournal(targetBlock)
 }
 
 // spentTxOutHeaderCode returns the calculated header code to be used when
@@ -730,10 +725,20 @@ func dbFetchUtxoEntryByHash(dbTx database.Tx, hash *chainhash.Hash) (*UtxoEntry,
 // When there is no entry for the provided output, nil will be returned for both
 // the entry and the error.
 func dbFetchUtxoEntry(dbTx database.Tx, outpoint wire.OutPoint) (*UtxoEntry, error) {
+	return dbFetchBucketUtxoEntry(dbTx, utxoSetBucketName, outpoint)
+}
+
+// dbFetchBucketUtxoEntry uses an existing database transaction to fetch the
+// specified transaction output from the utxo set housed in the bucket with the
+// provided name.
+//
+// When there is no entry for the provided output, nil will be returned for both
+// the entry and the error.
+func dbFetchBucketUtxoEntry(dbTx database.Tx, bucketName []byte, outpoint wire.OutPoint) (*UtxoEntry, error) {
 	// Fetch the unspent transaction output information for the passed
 	// transaction output.  Return now when there is no entry.
 	key := outpointKey(outpoint)
-	utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+	utxoBucket := dbTx.Metadata().Bucket(bucketName)
 	serializedUtxo := utxoBucket.Get(*key)
 	recycleOutpointKey(key)
 	if serializedUtxo == nil {
@@ -771,7 +776,14 @@ func dbFetchUtxoEntry(dbTx database.Tx, outpoint wire.OutPoint) (*UtxoEntry, err
 // particular, only the entries that have been marked as modified are written
 // to the database.
 func dbPutUtxoView(dbTx database.Tx, view *UtxoViewpoint) error {
-	utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+	return dbPutBucketUtxoView(dbTx, utxoSetBucketName, view)
+}
+
+// dbPutBucketUtxoView uses an existing database transaction to update the utxo
+// set housed in the bucket with the provided name based on the provided utxo
+// view contents and state.
+func dbPutBucketUtxoView(dbTx database.Tx, bucketName []byte, view *UtxoViewpoint) error {
+	utxoBucket := dbTx.Metadata().Bucket(bucketName)
 	for outpoint, entry := range view.entries {
 		// No need to update the database if the entry was not modified.
 		if entry == nil || !entry.isModified() {
@@ -1007,20 +1019,17 @@ func (b *BlockChain) createChainState() error {
 	genesisBlock := hdfutil.NewBlock(b.chainParams.GenesisBlock)
 	genesisBlock.SetHeight(0)
 	header := &genesisBlock.MsgBlock().Header
-	node := newBlockNode(header, nil)
+	node := b.index.newNode(header, nil)
 	node.status = statusDataStored | statusValid
 	b.bestChain.SetTip(node)
 
-	// Add the new node to the index which is used for faster lookups.
-	b.index.addNode(node)
-
 	// Initialize the state related to the best block.  Since it is the
 	// genesis block, use its timestamp for the median time.
 	numTxns := uint64(len(genesisBlock.MsgBlock().Transactions))
 	blockSize := uint64(genesisBlock.MsgBlock().SerializeSize())
 	blockWeight := uint64(GetBlockWeight(genesisBlock))
 	b.stateSnapshot = newBestState(node, blockSize, blockWeight, numTxns,
-		numTxns, time.Unix(node.timestamp, 0))
+		numTxns, time.Unix(int64(node.timestamp), 0))
 
 	// Create the initial the database chain state including creating the
 	// necessary index buckets and inserting the genesis block.
@@ -1086,8 +1095,13 @@ func (b *BlockChain) createChainState() error {
 			return err
 		}
 
-		// Store the current best chain state into the database.
-		err = dbPutBestState(dbTx, b.stateSnapshot, node.workSum)
+		// Store the current best chain state into the database along
+		// with the block the empty utxo set is consistent with.
+		err = dbPutBestState(dbTx, b.stateSnapshot, &node.workSum)
+		if err != nil {
+			return err
+		}
+		err = dbPutUtxoStateConsistency(dbTx, &node.hash)
 		if err != nil {
 			return err
 		}
@@ -1095,7 +1109,14 @@ func (b *BlockChain) createChainState() error {
 		// Store the genesis block into the database.
 		return dbStoreBlock(dbTx, genesisBlock)
 	})
-	return err
+	if err != nil {
+		return err
+	}
+
+	// Add the new node to the index which is used for faster lookups now
+	// that it has been stored.
+	b.index.addStoredNode(node)
+	return nil
 }
 
 // initChainState attempts to load and initialize the chain state from the
@@ -1184,14 +1205,16 @@ func (b *BlockChain) initChainState() error {
 
 			// Initialize the block node for the block, connect it,
 			// and add it to the block index.
-			node := new(blockNode)
-			initBlockNode(node, header, parent)
+			node := b.index.newNode(header, parent)
 			node.status = status
-			b.index.addNode(node)
+			b.index.addStoredNode(node)
 
 			lastNode = node
 			i++
 		}
+		memStats := b.index.MemStats()
+		log.Debugf("Loaded %d block index nodes using approximately %d "+
+			"bytes", memStats.Nodes, memStats.TotalBytes)
 
 		// Set the best chain view to the stored best state.
 		tip := b.index.LookupNode(&state.hash)
@@ -1201,15 +1224,27 @@ func (b *BlockChain) initChainState() error {
 		}
 		b.bestChain.SetTip(tip)
 
-		// Load the raw block bytes for the best block.
-		blockBytes, err := dbTx.FetchBlock(&state.hash)
+		// Load the state of the background validation of the historical
+		// chain leading up to a loaded utxo snapshot, if any.
+		b.snapshot, err = b.dbFetchSnapshotState(dbTx)
 		if err != nil {
 			return err
 		}
+
+		// Load the raw block bytes for the best block.  The data of the
+		// block a utxo snapshot was taken at is not available until it
+		// is provided as a historical block.
+		var blockBytes []byte
 		var block wire.MsgBlock
-		err = block.Deserialize(bytes.NewReader(blockBytes))
-		if err != nil {
-			return err
+		if tip.status.HaveData() {
+			blockBytes, err = dbTx.FetchBlock(&state.hash)
+			if err != nil {
+				return err
+			}
+			err = block.Deserialize(bytes.NewReader(blockBytes))
+			if err != nil {
+				return err
+			}
 		}
 
 		// As a final consistency check, we'll run through all the
@@ -1232,8 +1267,11 @@ func (b *BlockChain) initChainState() error {
 		}
 
 		// Initialize the state related to the best block.
+		var blockWeight uint64
+		if blockBytes != nil {
+			blockWeight = uint64(GetBlockWeight(hdfutil.NewBlock(&block)))
+		}
 		blockSize := uint64(len(blockBytes))
-		blockWeight := uint64(GetBlockWeight(hdfutil.NewBlock(&block)))
 		numTxns := uint64(len(block.Transactions))
 		b.stateSnapshot = newBestState(tip, blockSize, blockWeight,
 			numTxns, state.totalTxns, tip.CalcPastMedianTime())
@@ -1317,25 +1355,54 @@ func dbFetchBlockByNode(dbTx database.Tx, node *blockNode) (*hdfutil.Block, erro
 	return block, nil
 }
 
+// dbFetchNodeHeader uses an existing database transaction to retrieve the
+// block header associated with the provided node from the block index bucket.
+func dbFetchNodeHeader(dbTx database.Tx, node *blockNode) (*wire.BlockHeader, error) {
+	blockIndexBucket := dbTx.Metadata().Bucket(blockIndexBucketName)
+	key := blockIndexKey(&node.hash, uint32(node.height))
+	blockRow := blockIndexBucket.Get(key)
+	if blockRow == nil {
+		return nil, AssertError(fmt.Sprintf("block index entry for %v "+
+			"(height %d) does not exist", node.hash, node.height))
+	}
+	header, _, err := deserializeBlockRow(blockRow)
+	return header, err
+}
+
 // dbStoreBlockNode stores the block header and validation status to the block
-// index bucket. This overwrites the current entry if there exists one.
+// index bucket. This overwrites the current entry if there exists one.  Only
+// the validation status is updated when the node no longer holds its full
+// header since it was already stored.
 func dbStoreBlockNode(dbTx database.Tx, node *blockNode) error {
+	blockIndexBucket := dbTx.Metadata().Bucket(blockIndexBucketName)
+	key := blockIndexKey(&node.hash, uint32(node.height))
+
 	// Serialize block data to be stored.
-	w := bytes.NewBuffer(make([]byte, 0, blockHdrSize+1))
-	header := node.Header()
-	err := header.Serialize(w)
-	if err != nil {
-		return err
-	}
-	err = w.WriteByte(byte(node.status))
-	if err != nil {
-		return err
+	var value []byte
+	if node.header == nil {
+		blockRow := blockIndexBucket.Get(key)
+		if len(blockRow) != blockHdrSize+1 {
+			return AssertError(fmt.Sprintf("block index entry for %v "+
+				"(height %d) does not exist", node.hash,
+				node.height))
+		}
+		value = make([]byte, len(blockRow))
+		copy(value, blockRow)
+		value[blockHdrSize] = byte(node.status)
+	} else {
+		w := bytes.NewBuffer(make([]byte, 0, blockHdrSize+1))
+		err := node.header.Serialize(w)
+		if err != nil {
+			return err
+		}
+		err = w.WriteByte(byte(node.status))
+		if err != nil {
+			return err
+		}
+		value = w.Bytes()
 	}
-	value := w.Bytes()
 
 	// Write block header data to block index bucket.
-	blockIndexBucket := dbTx.Metadata().Bucket(blockIndexBucketName)
-	key := blockIndexKey(&node.hash, uint32(node.height))
 	return blockIndexBucket.Put(key, value)
 }
 
@@ -1373,14 +1440,9 @@ func (b *BlockChain) BlockByHeight(blockHeight int32) (*hdfutil.Block, error) {
 		return nil, errNotInMainChain(str)
 	}
 
-	// Load the block from the database and return it.
-	var block *hdfutil.Block
-	err := b.db.View(func(dbTx database.Tx) error {
-		var err error
-		block, err = dbFetchBlockByNode(dbTx, node)
-		return err
-	})
-	return block, err
+	// Load the block from the recent block cache or the database and
+	// return it.
+	return b.fetchBlockByNode(node)
 }
 
 // BlockByHash returns the block from the main chain with the given hash with
@@ -1396,12 +1458,7 @@ func (b *BlockChain) BlockByHash(hash *chainhash.Hash) (*hdfutil.Block, error) {
 		return nil, errNotInMainChain(str)
 	}
 
-	// Load the block from the database and return it.
-	var block *hdfutil.Block
-	err := b.db.View(func(dbTx database.Tx) error {
-		var err error
-		block, err = dbFetchBlockByNode(dbTx, node)
-		return err
-	})
-	return block, err
+	// Load the block from the recent block cache or the database and
+	// return it.
+	return b.fetchBlockByNode(node)
 }
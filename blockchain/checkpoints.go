@@ -18,6 +18,38 @@ import (
 // best block chain that a good checkpoint candidate must be.
 const CheckpointConfirmations = 2016
 
+// CheckpointMode defines how the checkpoints of a chain are used.
+type CheckpointMode uint8
+
+const (
+	// CheckpointsEnforced uses the checkpoints to reject blocks which don't
+	// match them and also to skip validation of the blocks before the
+	// latest checkpoint, such as running their scripts and the checks
+	// avoided by BFFastAdd.
+	CheckpointsEnforced CheckpointMode = iota
+
+	// CheckpointsAdvisory only uses the checkpoints to estimate the sync
+	// progress and to assume the chain leading up to them, so blocks which
+	// don't match them and forks before them are still rejected, but every
+	// block is fully validated.  BFFastAdd has no effect in this mode.
+	CheckpointsAdvisory
+)
+
+// checkpointModeStrings is a map of checkpoint modes back to their constant
+// names for pretty printing.
+var checkpointModeStrings = map[CheckpointMode]string{
+	CheckpointsEnforced: "CheckpointsEnforced",
+	CheckpointsAdvisory: "CheckpointsAdvisory",
+}
+
+// String returns the CheckpointMode as a human-readable name.
+func (m CheckpointMode) String() string {
+	if s := checkpointModeStrings[m]; s != "" {
+		return s
+	}
+	return fmt.Sprintf("Unknown CheckpointMode (%d)", int(m))
+}
+
 // newHashFromStr converts the passed big-endian hex string into a
 // chainhash.Hash.  It only differs from the one available in chainhash in that
 // it ignores the error since it will only (and must only) be called with
@@ -43,6 +75,45 @@ func (b *BlockChain) HasCheckpoints() bool {
 	return len(b.checkpoints) > 0
 }
 
+// CheckpointMode returns how the checkpoints of the chain are used.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CheckpointMode() CheckpointMode {
+	b.chainLock.RLock()
+	mode := b.checkpointMode
+	b.chainLock.RUnlock()
+	return mode
+}
+
+// SetCheckpointMode changes how the checkpoints of the chain are used.  It
+// takes effect starting with the next block which is processed, so switching
+// to CheckpointsAdvisory fully validates all blocks processed afterwards while
+// switching to CheckpointsEnforced allows skipping validation of the blocks
+// before the latest checkpoint again.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SetCheckpointMode(mode CheckpointMode) error {
+	if _, ok := checkpointModeStrings[mode]; !ok {
+		return fmt.Errorf("unknown checkpoint mode %d", int(mode))
+	}
+
+	b.chainLock.Lock()
+	b.checkpointMode = mode
+	b.chainLock.Unlock()
+	return nil
+}
+
+// checkpointsSkipValidation returns whether or not the checkpoints may be used
+// to skip validation of the blocks before them while processing a block with
+// the passed behavior flags.  This is only the case when the checkpoints are
+// enforced and the flags don't request full validation via BFNoCheckpointSkip.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) checkpointsSkipValidation(flags BehaviorFlags) bool {
+	return b.checkpointMode == CheckpointsEnforced &&
+		flags&BFNoCheckpointSkip != BFNoCheckpointSkip
+}
+
 // LatestCheckpoint returns the most recent checkpoint (regardless of whether it
 // is already known). When there are no defined checkpoints for the active chain
 // instance, it will return nil.
@@ -78,6 +149,52 @@ func (b *BlockChain) verifyCheckpoint(height int32, hash *chainhash.Hash) bool {
 	return true
 }
 
+// verifyAssumeValid returns whether the passed block height and hash
+// combination match the block whose ancestors are assumed to have valid
+// scripts.  It also returns true if there is no such block or it is at a
+// different height.
+func (b *BlockChain) verifyAssumeValid(height int32, hash *chainhash.Hash) bool {
+	if b.assumeValid == nil || b.assumeValid.Height != height {
+		return true
+	}
+
+	if !b.assumeValid.Hash.IsEqual(hash) {
+		return false
+	}
+
+	log.Infof("Verified assumed valid block at height %d/block %s",
+		b.assumeValid.Height, b.assumeValid.Hash)
+	return true
+}
+
+// isAssumedValid returns whether or not the scripts of the passed block node
+// are assumed to be valid since it is the assumed valid block or one of its
+// ancestors.  Once the assumed valid block is known, this is checked directly.
+// Before then, every block up to its height is assumed valid since any other
+// block at its height is rejected, which is the same assumption made for the
+// blocks before a checkpoint.
+//
+// This function MUST be called with the chain lock held (for reads).
+func (b *BlockChain) isAssumedValid(node *blockNode) bool {
+	if b.assumeValid == nil || node.height > b.assumeValid.Height {
+		return false
+	}
+
+	assumeValidNode := b.index.LookupNode(b.assumeValid.Hash)
+	if assumeValidNode != nil {
+		return assumeValidNode.Ancestor(node.height) == node
+	}
+	return true
+}
+
+// hasMinimumChainWork returns whether or not the passed block node has at least
+// the minimum cumulative work the main chain is known to have.  It always
+// returns true when there is no minimum chain work.
+func (b *BlockChain) hasMinimumChainWork(node *blockNode) bool {
+	return b.minimumChainWork == nil ||
+		node.workSum.Cmp(b.minimumChainWork) >= 0
+}
+
 // findPreviousCheckpoint finds the most recent checkpoint that is already
 // available in the downloaded portion of the block chain and returns the
 // associated block node.  It returns nil if a checkpoint can't be found (this
@@ -241,9 +358,9 @@ func (b *BlockChain) IsCheckpointCandidate(block *hdfutil.Block) (bool, error) {
 	// A checkpoint must have timestamps for the block and the blocks on
 	// either side of it in order (due to the median time allowance this is
 	// not always the case).
-	prevTime := time.Unix(node.parent.timestamp, 0)
+	prevTime := time.Unix(int64(node.parent.timestamp), 0)
 	curTime := block.MsgBlock().Header.Timestamp
-	nextTime := time.Unix(nextNode.timestamp, 0)
+	nextTime := time.Unix(int64(nextNode.timestamp), 0)
 	if prevTime.After(curTime) || nextTime.Before(curTime) {
 		return false, nil
 	}
@@ -0,0 +1,131 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+)
+
+// TestAssumeValidAndMinimumChainWork ensures the ancestors of the assumed valid
+// block are assumed to have valid scripts, other blocks at its height are
+// rejected, and the minimum chain work is compared against the cumulative work
+// of blocks.
+func TestAssumeValidAndMinimumChainWork(t *testing.T) {
+	blocks, err := loadBlocks("blk_0_to_4.dat.bz2")
+	if err != nil {
+		t.Fatalf("Error loading file: %v\n", err)
+	}
+
+	// Create a new database and chain instance to run tests against.
+	chain, teardownFunc, err := chainSetup("assumevalid",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Since we're not dealing with the real block chain, set the coinbase
+	// maturity to 1.
+	chain.TstSetCoinbaseMaturity(1)
+
+	// Ensure a block which does not match the assumed valid block at its
+	// height is rejected.
+	chain.assumeValid = &chaincfg.Checkpoint{
+		Height: 1,
+		Hash:   blocks[2].Hash(),
+	}
+	_, _, err = chain.ProcessBlock(blocks[1], BFNone)
+	if !errors.Is(err, ErrBadAssumeValid) {
+		t.Fatalf("ProcessBlock: unexpected error - got %v, want %v",
+			err, ErrBadAssumeValid)
+	}
+
+	// Ensure the blocks up to the assumed valid block are assumed to have
+	// valid scripts and later ones are not.
+	chain.assumeValid = &chaincfg.Checkpoint{
+		Height: 2,
+		Hash:   blocks[2].Hash(),
+	}
+	for i := 1; i < len(blocks); i++ {
+		_, _, err := chain.ProcessBlock(blocks[i], BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock fail on block %d: %v\n", i, err)
+		}
+	}
+	for i := 1; i < len(blocks); i++ {
+		node := chain.index.LookupNode(blocks[i].Hash())
+		want := i <= 2
+		if got := chain.isAssumedValid(node); got != want {
+			t.Fatalf("isAssumedValid: block %d - got %v, want %v",
+				i, got, want)
+		}
+	}
+
+	// Ensure the cumulative work of blocks is compared against the minimum
+	// chain work.
+	node2 := chain.index.LookupNode(blocks[2].Hash())
+	chain.minimumChainWork = new(big.Int).Set(&node2.workSum)
+	for i := 1; i < len(blocks); i++ {
+		node := chain.index.LookupNode(blocks[i].Hash())
+		want := i >= 2
+		if got := chain.hasMinimumChainWork(node); got != want {
+			t.Fatalf("hasMinimumChainWork: block %d - got %v, "+
+				"want %v", i, got, want)
+		}
+	}
+}
+
+// TestCheckpointsSkipValidation ensures the checkpoints are only allowed to
+// skip validation when they are enforced and full validation is not requested
+// via the behavior flags.
+func TestCheckpointsSkipValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		mode  CheckpointMode
+		flags BehaviorFlags
+		want  bool
+	}{
+		{"enforced", CheckpointsEnforced, BFNone, true},
+		{"enforced fast add", CheckpointsEnforced, BFFastAdd, true},
+		{"enforced no skip", CheckpointsEnforced, BFNoCheckpointSkip, false},
+		{"advisory", CheckpointsAdvisory, BFNone, false},
+		{"advisory fast add", CheckpointsAdvisory, BFFastAdd, false},
+	}
+
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	for _, test := range tests {
+		chain.checkpointMode = test.mode
+		got := chain.checkpointsSkipValidation(test.flags)
+		if got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// TestSetCheckpointMode ensures the checkpoint mode may be changed at runtime
+// and unknown modes are rejected.
+func TestSetCheckpointMode(t *testing.T) {
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	if err := chain.SetCheckpointMode(CheckpointsAdvisory); err != nil {
+		t.Fatalf("SetCheckpointMode: unexpected error: %v", err)
+	}
+	if mode := chain.CheckpointMode(); mode != CheckpointsAdvisory {
+		t.Fatalf("unexpected checkpoint mode %v", mode)
+	}
+	if chain.checkpointsSkipValidation(BFNone) {
+		t.Fatal("advisory checkpoints skip validation")
+	}
+
+	if err := chain.SetCheckpointMode(CheckpointMode(100)); err == nil {
+		t.Fatal("SetCheckpointMode: did not reject unknown mode")
+	}
+	if mode := chain.CheckpointMode(); mode != CheckpointsAdvisory {
+		t.Fatalf("unknown mode changed checkpoint mode to %v", mode)
+	}
+}
@@ -67,8 +67,10 @@ Errors returned by this package are either the raw errors provided by underlying
 calls or of type blockchain.RuleError.  This allows the caller to differentiate
 between unexpected errors, such as database errors, versus errors due to rule
 violations through type assertions.  In addition, callers can programmatically
-determine the specific rule violation by examining the ErrorCode field of the
-type asserted blockchain.RuleError.
+determine the specific rule violation with errors.Is and one of the ErrorKind
+constants.  A blockchain.RuleError also identifies the offending block,
+transaction, and input when they are known, which is available via its fields
+or summarized by its Context method.
 
 Bitcoin Improvement Proposals
 
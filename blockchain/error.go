@@ -6,6 +6,9 @@ package blockchain
 
 import (
 	"fmt"
+	"strings"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
 )
 
 // DeploymentError identifies an error that indicates a deployment ID was
@@ -28,14 +31,16 @@ func (e AssertError) Error() string {
 	return "assertion failed: " + string(e)
 }
 
-// ErrorCode identifies a kind of error.
-type ErrorCode int
+// ErrorKind identifies a kind of error.  It has full support for errors.Is
+// and errors.As, so the caller can directly check against an error kind when
+// determining the reason for an error.
+type ErrorKind int
 
 // These constants are used to identify a specific RuleError.
 const (
 	// ErrDuplicateBlock indicates a block with the same hash already
 	// exists.
-	ErrDuplicateBlock ErrorCode = iota
+	ErrDuplicateBlock ErrorKind = iota
 
 	// ErrBlockTooBig indicates the serialized block size exceeds the
 	// maximum allowed size.
@@ -220,10 +225,24 @@ const (
 	// current chain tip. This is not a block validation rule, but is required
 	// for block proposals submitted via getblocktemplate RPC.
 	ErrPrevBlockNotBest
+
+	// ErrHeadersCommitmentMismatch indicates a header redownloaded while
+	// syncing headers does not match the commitment made to the headers
+	// when they were first downloaded.
+	ErrHeadersCommitmentMismatch
+
+	// ErrBadAssumeValid indicates a block at the height of the block whose
+	// ancestors are assumed to have valid scripts does not match it.
+	ErrBadAssumeValid
+
+	// ErrForkTooLowWork indicates a block is attempting to fork the block
+	// chain at a block with less than the minimum chain work once the main
+	// chain has at least that much work.
+	ErrForkTooLowWork
 )
 
-// Map of ErrorCode values back to their constant names for pretty printing.
-var errorCodeStrings = map[ErrorCode]string{
+// Map of ErrorKind values back to their constant names for pretty printing.
+var errorKindStrings = map[ErrorKind]string{
 	ErrDuplicateBlock:            "ErrDuplicateBlock",
 	ErrBlockTooBig:               "ErrBlockTooBig",
 	ErrBlockVersionTooOld:        "ErrBlockVersionTooOld",
@@ -267,24 +286,48 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrPreviousBlockUnknown:      "ErrPreviousBlockUnknown",
 	ErrInvalidAncestorBlock:      "ErrInvalidAncestorBlock",
 	ErrPrevBlockNotBest:          "ErrPrevBlockNotBest",
+	ErrHeadersCommitmentMismatch: "ErrHeadersCommitmentMismatch",
+	ErrBadAssumeValid:            "ErrBadAssumeValid",
+	ErrForkTooLowWork:            "ErrForkTooLowWork",
 }
 
-// String returns the ErrorCode as a human-readable name.
-func (e ErrorCode) String() string {
-	if s := errorCodeStrings[e]; s != "" {
+// String returns the ErrorKind as a human-readable name.
+func (e ErrorKind) String() string {
+	if s := errorKindStrings[e]; s != "" {
 		return s
 	}
-	return fmt.Sprintf("Unknown ErrorCode (%d)", int(e))
+	return fmt.Sprintf("Unknown ErrorKind (%d)", int(e))
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e ErrorKind) Error() string {
+	return e.String()
 }
 
 // RuleError identifies a rule violation.  It is used to indicate that
 // processing of a block or transaction failed due to one of the many validation
-// rules.  The caller can use type assertions to determine if a failure was
-// specifically due to a rule violation and access the ErrorCode field to
-// ascertain the specific reason for the rule violation.
+// rules.  The caller can use errors.Is with one of the ErrorKind constants to
+// determine if a failure was specifically due to a given rule violation, or
+// errors.As to access the ErrorKind and the context of the violation.
+//
+// The context fields are populated when they are known at the point the
+// violation is detected, so they allow callers to report which block,
+// transaction, and input caused a rejection without parsing the description.
 type RuleError struct {
-	ErrorCode   ErrorCode // Describes the kind of error
-	Description string    // Human readable description of the issue
+	Err         error  // Underlying ErrorKind
+	Description string // Human readable description of the issue
+
+	// BlockHash is the hash of the block being validated when the
+	// violation was detected, if any.  BlockHeight is the height of that
+	// block or -1 when its height is not yet known.
+	BlockHash   *chainhash.Hash
+	BlockHeight int32
+
+	// TxHash is the hash of the offending transaction, if any.
+	// InputIndex is the index of the offending input of that transaction
+	// or -1 when the violation does not involve a specific input.
+	TxHash     *chainhash.Hash
+	InputIndex int
 }
 
 // Error satisfies the error interface and prints human-readable errors.
@@ -292,7 +335,70 @@ func (e RuleError) Error() string {
 	return e.Description
 }
 
-// ruleError creates an RuleError given a set of arguments.
-func ruleError(c ErrorCode, desc string) RuleError {
-	return RuleError{ErrorCode: c, Description: desc}
+// Unwrap returns the underlying wrapped error kind.
+func (e RuleError) Unwrap() error {
+	return e.Err
+}
+
+// Context returns a human-readable summary of the block, transaction, and
+// input the rule violation applies to, or an empty string when none of them
+// are known.
+func (e RuleError) Context() string {
+	var parts []string
+	if e.BlockHash != nil {
+		parts = append(parts, fmt.Sprintf("block %v", e.BlockHash))
+		if e.BlockHeight >= 0 {
+			parts = append(parts, fmt.Sprintf("height %d",
+				e.BlockHeight))
+		}
+	}
+	if e.TxHash != nil {
+		parts = append(parts, fmt.Sprintf("transaction %v", e.TxHash))
+		if e.InputIndex >= 0 {
+			parts = append(parts, fmt.Sprintf("input %d",
+				e.InputIndex))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ruleError creates a RuleError given a set of arguments.
+func ruleError(kind ErrorKind, desc string) RuleError {
+	return RuleError{
+		Err:         kind,
+		Description: desc,
+		BlockHeight: -1,
+		InputIndex:  -1,
+	}
+}
+
+// txRuleError creates a RuleError for a violation by the transaction with the
+// provided hash.
+func txRuleError(kind ErrorKind, desc string, txHash *chainhash.Hash) RuleError {
+	err := ruleError(kind, desc)
+	err.TxHash = txHash
+	return err
+}
+
+// inputRuleError creates a RuleError for a violation by the input at the
+// provided index of the transaction with the provided hash.
+func inputRuleError(kind ErrorKind, desc string, txHash *chainhash.Hash,
+	inputIndex int) RuleError {
+
+	err := txRuleError(kind, desc, txHash)
+	err.InputIndex = inputIndex
+	return err
+}
+
+// withBlockContext attaches the hash and height of the block being validated
+// to the passed error when it is a RuleError that does not already identify a
+// block.  All other errors are returned unmodified.
+func withBlockContext(err error, blockHash *chainhash.Hash, height int32) error {
+	rErr, ok := err.(RuleError)
+	if !ok || rErr.BlockHash != nil {
+		return err
+	}
+	rErr.BlockHash = blockHash
+	rErr.BlockHeight = height
+	return rErr
 }
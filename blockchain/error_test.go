@@ -5,13 +5,16 @@
 package blockchain
 
 import (
+	"errors"
 	"testing"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
 )
 
-// TestErrorCodeStringer tests the stringized output for the ErrorCode type.
-func TestErrorCodeStringer(t *testing.T) {
+// TestErrorKindStringer tests the stringized output for the ErrorKind type.
+func TestErrorKindStringer(t *testing.T) {
 	tests := []struct {
-		in   ErrorCode
+		in   ErrorKind
 		want string
 	}{
 		{ErrDuplicateBlock, "ErrDuplicateBlock"},
@@ -58,7 +61,10 @@ func TestErrorCodeStringer(t *testing.T) {
 		{ErrPreviousBlockUnknown, "ErrPreviousBlockUnknown"},
 		{ErrInvalidAncestorBlock, "ErrInvalidAncestorBlock"},
 		{ErrPrevBlockNotBest, "ErrPrevBlockNotBest"},
-		{0xffff, "Unknown ErrorCode (65535)"},
+		{ErrHeadersCommitmentMismatch, "ErrHeadersCommitmentMismatch"},
+		{ErrBadAssumeValid, "ErrBadAssumeValid"},
+		{ErrForkTooLowWork, "ErrForkTooLowWork"},
+		{0xffff, "Unknown ErrorKind (65535)"},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -99,6 +105,109 @@ func TestRuleError(t *testing.T) {
 	}
 }
 
+// TestRuleErrorKind ensures RuleError can be matched against its ErrorKind
+// with errors.Is and errors.As.
+func TestRuleErrorKind(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		target  error
+		wantIs  bool
+		wantErr ErrorKind
+	}{{
+		name:    "ErrDuplicateBlock == ErrDuplicateBlock",
+		err:     ruleError(ErrDuplicateBlock, ""),
+		target:  ErrDuplicateBlock,
+		wantIs:  true,
+		wantErr: ErrDuplicateBlock,
+	}, {
+		name:    "ErrMissingTxOut == ErrMissingTxOut with context",
+		err:     inputRuleError(ErrMissingTxOut, "", &chainhash.Hash{}, 1),
+		target:  ErrMissingTxOut,
+		wantIs:  true,
+		wantErr: ErrMissingTxOut,
+	}, {
+		name:    "ErrDuplicateBlock != ErrBlockTooBig",
+		err:     ruleError(ErrDuplicateBlock, ""),
+		target:  ErrBlockTooBig,
+		wantIs:  false,
+		wantErr: ErrDuplicateBlock,
+	}}
+
+	for _, test := range tests {
+		if got := errors.Is(test.err, test.target); got != test.wantIs {
+			t.Errorf("%s: mismatched errors.Is result -- got %v, "+
+				"want %v", test.name, got, test.wantIs)
+			continue
+		}
+
+		var kind ErrorKind
+		if !errors.As(test.err, &kind) {
+			t.Errorf("%s: unable to extract error kind", test.name)
+			continue
+		}
+		if kind != test.wantErr {
+			t.Errorf("%s: unexpected error kind -- got %v, want %v",
+				test.name, kind, test.wantErr)
+			continue
+		}
+	}
+}
+
+// TestRuleErrorContext tests the context output for the RuleError type.
+func TestRuleErrorContext(t *testing.T) {
+	blockHash := chainhash.Hash{0x01}
+	txHash := chainhash.Hash{0x02}
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{{
+		name: "no context",
+		err:  ruleError(ErrBlockTooBig, ""),
+		want: "",
+	}, {
+		name: "transaction",
+		err:  txRuleError(ErrNoTxInputs, "", &txHash),
+		want: "transaction " + txHash.String(),
+	}, {
+		name: "transaction input",
+		err:  inputRuleError(ErrMissingTxOut, "", &txHash, 2),
+		want: "transaction " + txHash.String() + ", input 2",
+	}, {
+		name: "block with unknown height",
+		err: withBlockContext(ruleError(ErrBlockTooBig, ""),
+			&blockHash, -1),
+		want: "block " + blockHash.String(),
+	}, {
+		name: "block, transaction, and input",
+		err: withBlockContext(inputRuleError(ErrScriptValidation, "",
+			&txHash, 0), &blockHash, 100),
+		want: "block " + blockHash.String() + ", height 100, " +
+			"transaction " + txHash.String() + ", input 0",
+	}, {
+		name: "existing block context is preserved",
+		err: withBlockContext(withBlockContext(ruleError(
+			ErrBadMerkleRoot, ""), &blockHash, 5), &txHash, 6),
+		want: "block " + blockHash.String() + ", height 5",
+	}}
+
+	for _, test := range tests {
+		var rerr RuleError
+		if !errors.As(test.err, &rerr) {
+			t.Errorf("%s: unexpected error type %T", test.name,
+				test.err)
+			continue
+		}
+		if got := rerr.Context(); got != test.want {
+			t.Errorf("%s: mismatched context\n got: %s\nwant: %s",
+				test.name, got, test.want)
+			continue
+		}
+	}
+}
+
 // TestDeploymentError tests the stringized output for the DeploymentError type.
 func TestDeploymentError(t *testing.T) {
 	t.Parallel()
@@ -7,6 +7,7 @@ package blockchain_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -206,11 +207,11 @@ func TestFullBlocks(t *testing.T) {
 				"blockchain.RuleError", item.Name, block.Hash(),
 				blockHeight, err)
 		}
-		if rerr.ErrorCode != item.RejectCode {
+		if !errors.Is(rerr, item.RejectCode) {
 			t.Fatalf("block %q (hash %s, height %d) does not have "+
 				"expected reject code -- got %v, want %v",
 				item.Name, block.Hash(), blockHeight,
-				rerr.ErrorCode, item.RejectCode)
+				rerr.Err, item.RejectCode)
 		}
 	}
 
@@ -0,0 +1,238 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+)
+
+// HeaderCtx describes the details of a block header and its ancestors that are
+// needed to calculate the consensus values which only depend on the headers of
+// the chain, such as the required difficulty and the past median time.  It
+// allows packages which only validate headers, such as light clients, to reuse
+// the consensus code without constructing a full BlockChain.
+type HeaderCtx interface {
+	// Height returns the height of the block in the chain.
+	Height() int32
+
+	// Bits returns the difficulty bits of the block header.
+	Bits() uint32
+
+	// Timestamp returns the timestamp of the block header as the number of
+	// seconds since the unix epoch.
+	Timestamp() int64
+
+	// Parent returns the context of the previous block or nil for the
+	// genesis block.
+	Parent() HeaderCtx
+
+	// RelativeAncestorCtx returns the context of the ancestor the given
+	// number of blocks before the block or nil when there is no such
+	// ancestor.
+	RelativeAncestorCtx(distance int32) HeaderCtx
+}
+
+// ChainCtx describes the parameters of a chain that are needed to calculate the
+// required difficulty of its blocks.
+type ChainCtx interface {
+	// ChainParams returns the parameters of the chain.
+	ChainParams() *chaincfg.Params
+
+	// BlocksPerRetarget returns the number of blocks between each
+	// difficulty retarget.
+	BlocksPerRetarget() int32
+
+	// MinRetargetTimespan returns the minimum number of seconds a retarget
+	// period is considered to have taken when adjusting the difficulty.
+	MinRetargetTimespan() int64
+
+	// MaxRetargetTimespan returns the maximum number of seconds a retarget
+	// period is considered to have taken when adjusting the difficulty.
+	MaxRetargetTimespan() int64
+}
+
+// CalcPastMedianTime calculates the median time of the previous few blocks
+// prior to, and including, the passed block header.
+//
+// Unlike the method of the same name on block nodes, this function only relies
+// on the headers of the chain, so it may be used by callers which only validate
+// headers.
+func CalcPastMedianTime(node HeaderCtx) time.Time {
+	// Create a slice of the previous few block timestamps used to calculate
+	// the median per the number defined by the constant medianTimeBlocks.
+	timestamps := make([]int64, medianTimeBlocks)
+	numNodes := 0
+	iterNode := node
+	for i := 0; i < medianTimeBlocks && iterNode != nil; i++ {
+		timestamps[i] = iterNode.Timestamp()
+		numNodes++
+
+		iterNode = iterNode.Parent()
+	}
+
+	// Prune the slice to the actual number of available timestamps which
+	// will be fewer than desired near the beginning of the block chain
+	// and sort them.
+	timestamps = timestamps[:numNodes]
+	sort.Sort(timeSorter(timestamps))
+
+	// NOTE: The consensus rules incorrectly calculate the median for even
+	// numbers of blocks.  A true median averages the middle two elements
+	// for a set with an even number of elements in it.   Since the constant
+	// for the previous number of blocks to be used is odd, this is only an
+	// issue for a few blocks near the beginning of the chain.  I suspect
+	// this is an optimization even though the result is slightly wrong for
+	// a few of the first blocks since after the first few blocks, there
+	// will always be an odd number of blocks in the set per the constant.
+	//
+	// This code follows suit to ensure the same rules are used, however, be
+	// aware that should the medianTimeBlocks constant ever be changed to an
+	// even number, this code will be wrong.
+	medianTimestamp := timestamps[numNodes/2]
+	return time.Unix(medianTimestamp, 0)
+}
+
+// Ensure blockNode implements the HeaderCtx interface.
+var _ HeaderCtx = (*blockNode)(nil)
+
+// Height returns the height of the block node.
+//
+// This is part of the HeaderCtx interface implementation.
+func (node *blockNode) Height() int32 {
+	return node.height
+}
+
+// Bits returns the difficulty bits of the block node.
+//
+// This is part of the HeaderCtx interface implementation.
+func (node *blockNode) Bits() uint32 {
+	return node.bits
+}
+
+// Timestamp returns the timestamp of the block node as the number of seconds
+// since the unix epoch.
+//
+// This is part of the HeaderCtx interface implementation.
+func (node *blockNode) Timestamp() int64 {
+	return int64(node.timestamp)
+}
+
+// Parent returns the parent of the block node or nil when it does not have one.
+//
+// This is part of the HeaderCtx interface implementation.
+func (node *blockNode) Parent() HeaderCtx {
+	// Avoid returning a nil block node wrapped in a non-nil interface.
+	if node.parent == nil {
+		return nil
+	}
+	return node.parent
+}
+
+// RelativeAncestorCtx returns the ancestor block node a relative 'distance'
+// blocks before this node or nil when there is no such ancestor.
+//
+// This is part of the HeaderCtx interface implementation.
+func (node *blockNode) RelativeAncestorCtx(distance int32) HeaderCtx {
+	ancestor := node.RelativeAncestor(distance)
+	if ancestor == nil {
+		return nil
+	}
+	return ancestor
+}
+
+// Ensure BlockChain implements the ChainCtx interface.
+var _ ChainCtx = (*BlockChain)(nil)
+
+// ChainParams returns the parameters of the chain.
+//
+// This is part of the ChainCtx interface implementation.
+func (b *BlockChain) ChainParams() *chaincfg.Params {
+	return b.chainParams
+}
+
+// BlocksPerRetarget returns the number of blocks between each difficulty
+// retarget.
+//
+// This is part of the ChainCtx interface implementation.
+func (b *BlockChain) BlocksPerRetarget() int32 {
+	return b.blocksPerRetarget
+}
+
+// MinRetargetTimespan returns the minimum number of seconds a retarget period
+// is considered to have taken when adjusting the difficulty.
+//
+// This is part of the ChainCtx interface implementation.
+func (b *BlockChain) MinRetargetTimespan() int64 {
+	return b.minRetargetTimespan
+}
+
+// MaxRetargetTimespan returns the maximum number of seconds a retarget period
+// is considered to have taken when adjusting the difficulty.
+//
+// This is part of the ChainCtx interface implementation.
+func (b *BlockChain) MaxRetargetTimespan() int64 {
+	return b.maxRetargetTimespan
+}
+
+// paramsChainCtx provides a ChainCtx which derives the retarget values from
+// the chain parameters.
+type paramsChainCtx struct {
+	params              *chaincfg.Params
+	blocksPerRetarget   int32
+	minRetargetTimespan int64
+	maxRetargetTimespan int64
+}
+
+// Ensure paramsChainCtx implements the ChainCtx interface.
+var _ ChainCtx = (*paramsChainCtx)(nil)
+
+// NewChainCtx returns a ChainCtx for the chain with the given parameters for
+// use with CalcNextRequiredDifficulty by callers which do not have a
+// BlockChain instance.
+func NewChainCtx(params *chaincfg.Params) ChainCtx {
+	targetTimespan := int64(params.TargetTimespan / time.Second)
+	targetTimePerBlock := int64(params.TargetTimePerBlock / time.Second)
+	adjustmentFactor := params.RetargetAdjustmentFactor
+	return &paramsChainCtx{
+		params:              params,
+		blocksPerRetarget:   int32(targetTimespan / targetTimePerBlock),
+		minRetargetTimespan: targetTimespan / adjustmentFactor,
+		maxRetargetTimespan: targetTimespan * adjustmentFactor,
+	}
+}
+
+// ChainParams returns the parameters of the chain.
+//
+// This is part of the ChainCtx interface implementation.
+func (c *paramsChainCtx) ChainParams() *chaincfg.Params {
+	return c.params
+}
+
+// BlocksPerRetarget returns the number of blocks between each difficulty
+// retarget.
+//
+// This is part of the ChainCtx interface implementation.
+func (c *paramsChainCtx) BlocksPerRetarget() int32 {
+	return c.blocksPerRetarget
+}
+
+// MinRetargetTimespan returns the minimum number of seconds a retarget period
+// is considered to have taken when adjusting the difficulty.
+//
+// This is part of the ChainCtx interface implementation.
+func (c *paramsChainCtx) MinRetargetTimespan() int64 {
+	return c.minRetargetTimespan
+}
+
+// MaxRetargetTimespan returns the maximum number of seconds a retarget period
+// is considered to have taken when adjusting the difficulty.
+//
+// This is part of the ChainCtx interface implementation.
+func (c *paramsChainCtx) MaxRetargetTimespan() int64 {
+	return c.maxRetargetTimespan
+}
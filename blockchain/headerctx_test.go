@@ -0,0 +1,137 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+)
+
+// testHeaderCtx provides a minimal HeaderCtx which is independent of block
+// nodes, such as one a light client would use.
+type testHeaderCtx struct {
+	parent    *testHeaderCtx
+	height    int32
+	bits      uint32
+	timestamp int64
+}
+
+// Height returns the height of the header.
+func (h *testHeaderCtx) Height() int32 {
+	return h.height
+}
+
+// Bits returns the difficulty bits of the header.
+func (h *testHeaderCtx) Bits() uint32 {
+	return h.bits
+}
+
+// Timestamp returns the timestamp of the header.
+func (h *testHeaderCtx) Timestamp() int64 {
+	return h.timestamp
+}
+
+// Parent returns the previous header or nil for the first header.
+func (h *testHeaderCtx) Parent() HeaderCtx {
+	if h.parent == nil {
+		return nil
+	}
+	return h.parent
+}
+
+// RelativeAncestorCtx returns the header the given distance before the header
+// or nil when there is no such header.
+func (h *testHeaderCtx) RelativeAncestorCtx(distance int32) HeaderCtx {
+	ancestor := h
+	for i := int32(0); i < distance && ancestor != nil; i++ {
+		ancestor = ancestor.parent
+	}
+	if ancestor == nil {
+		return nil
+	}
+	return ancestor
+}
+
+// TestHeaderCtxCalculations ensures the required difficulty and past median
+// time calculated from a chain of headers which does not involve block nodes
+// or a BlockChain instance match the values calculated by the chain.
+func TestHeaderCtxCalculations(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		params *chaincfg.Params
+	}{
+		{name: "mainnet", params: &chaincfg.MainNetParams},
+		{name: "testnet3", params: &chaincfg.TestNet3Params},
+	}
+
+	for _, test := range tests {
+		chain := newFakeChain(test.params)
+		chainCtx := NewChainCtx(test.params)
+		if chainCtx.BlocksPerRetarget() != chain.BlocksPerRetarget() ||
+			chainCtx.MinRetargetTimespan() != chain.MinRetargetTimespan() ||
+			chainCtx.MaxRetargetTimespan() != chain.MaxRetargetTimespan() {
+
+			t.Fatalf("%s: mismatched chain context", test.name)
+		}
+
+		// Ensure the genesis block requires the proof of work limit.
+		bits, err := CalcNextRequiredDifficulty(nil, time.Now(), chainCtx)
+		if err != nil || bits != test.params.PowLimitBits {
+			t.Fatalf("%s: unexpected genesis difficulty %08x: %v",
+				test.name, bits, err)
+		}
+
+		// Extend both chains past a retarget with blocks which are
+		// mostly found faster than the target, and occasionally slow
+		// enough for the testnet minimum difficulty rule to apply.
+		node := chain.bestChain.Tip()
+		header := &testHeaderCtx{
+			height:    node.height,
+			bits:      node.bits,
+			timestamp: int64(node.timestamp),
+		}
+		numBlocks := int(chain.blocksPerRetarget) + 10
+		for i := 0; i < numBlocks; i++ {
+			spacing := 5 * time.Minute
+			if i%50 == 49 {
+				spacing = 25 * time.Minute
+			}
+			blockTime := time.Unix(header.timestamp, 0).Add(spacing)
+
+			wantBits, err := chain.calcNextRequiredDifficulty(node,
+				blockTime)
+			if err != nil {
+				t.Fatalf("%s: calcNextRequiredDifficulty: %v",
+					test.name, err)
+			}
+			bits, err := CalcNextRequiredDifficulty(header, blockTime,
+				chainCtx)
+			if err != nil || bits != wantBits {
+				t.Fatalf("%s: mismatched difficulty at height %d "+
+					"- got %08x (err %v), want %08x", test.name,
+					header.height+1, bits, err, wantBits)
+			}
+
+			node = newFakeNode(node, 1, bits, blockTime)
+			header = &testHeaderCtx{
+				parent:    header,
+				height:    header.height + 1,
+				bits:      bits,
+				timestamp: blockTime.Unix(),
+			}
+
+			got := CalcPastMedianTime(header)
+			if want := node.CalcPastMedianTime(); !got.Equal(want) {
+				t.Fatalf("%s: mismatched median time at height "+
+					"%d - got %v, want %v", test.name,
+					header.height, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,446 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+const (
+	// headerCommitmentPeriod is the number of headers between the headers
+	// which are committed to while presyncing headers.  A single bit is
+	// stored for each commitment, so the memory needed to presync a chain
+	// is tiny compared to storing its headers.
+	headerCommitmentPeriod = 600
+
+	// headersRedownloadBufferSize is the number of redownloaded headers
+	// which must have been checked against the commitments before the
+	// earliest of them are released to be stored.  It covers 24
+	// commitments, so a peer which presynced one chain and then attempts
+	// to feed a different one when the headers are redownloaded has a one
+	// in 2^24 chance of getting any of its headers stored.
+	headersRedownloadBufferSize = 24 * headerCommitmentPeriod
+)
+
+// HeadersSyncPhase identifies the phase of a HeadersSync.
+type HeadersSyncPhase int
+
+// These constants define the phases of a HeadersSync.
+const (
+	// HeadersPresync is the phase where the headers are downloaded and
+	// checked, but only a commitment to them is stored.
+	HeadersPresync HeadersSyncPhase = iota
+
+	// HeadersRedownload is the phase where the headers are downloaded
+	// again and checked against the commitments before being released to
+	// be stored.
+	HeadersRedownload
+
+	// HeadersSyncDone is the phase once all of the headers up to the target
+	// have been released to be stored.
+	HeadersSyncDone
+)
+
+// Map of HeadersSyncPhase values back to their constant names for pretty
+// printing.
+var headersSyncPhaseStrings = map[HeadersSyncPhase]string{
+	HeadersPresync:    "HeadersPresync",
+	HeadersRedownload: "HeadersRedownload",
+	HeadersSyncDone:   "HeadersSyncDone",
+}
+
+// String returns the HeadersSyncPhase as a human-readable name.
+func (p HeadersSyncPhase) String() string {
+	if s := headersSyncPhaseStrings[p]; s != "" {
+		return s
+	}
+	return fmt.Sprintf("Unknown HeadersSyncPhase (%d)", int(p))
+}
+
+// HeadersSync downloads the headers of a chain from a peer in two passes so the
+// peer is not able to exhaust the memory or disk space of the node with a long
+// chain of headers which does not lead to the target.  The target is either a
+// checkpoint or, when the headers sync is created via NewHeadersSyncToWork, the
+// first header at which the chain has at least a minimum amount of cumulative
+// work, which protects against the same attack without relying on checkpoints.
+//
+// During the first pass, the presync, the headers are checked to connect and to
+// have valid proof of work with permitted difficulty transitions, but only a
+// single salted bit for every headerCommitmentPeriod headers is kept as a
+// commitment to them.  Once the chain is proven to lead to the target, which
+// also commits to the work of the chain, the headers are downloaded again and
+// checked against the commitments.  Since the salt and the heights of the
+// commitments are random, a peer is not able to build a different chain which
+// matches the commitments.  The redownloaded headers are only released to be
+// stored once enough of the following headers have been checked against the
+// commitments as well.
+//
+// A HeadersSync is not safe for concurrent access.
+type HeadersSync struct {
+	chainParams          *chaincfg.Params
+	target               chaincfg.Checkpoint
+	minWork              *big.Int
+	blocksPerRetarget    int32
+	minRetargetTimespan  int64
+	maxRetargetTimespan  int64
+	commitPeriod         int32
+	redownloadBufferSize int
+
+	// The following fields describe the block the headers build on.
+	startHash   chainhash.Hash
+	startHeight int32
+	startBits   uint32
+	startWork   big.Int
+
+	// salt and commitOffset randomize the commitments so they can't be
+	// predicted by the peer.  A commitment is made to the headers with a
+	// height which is commitOffset modulo the commitment period.
+	salt         [16]byte
+	commitOffset int32
+	commitments  []byte
+	numCommits   int
+	phase        HeadersSyncPhase
+
+	// The following fields track the last header which was checked in the
+	// current phase along with the total work of the chain up to it.
+	lastHash   chainhash.Hash
+	lastHeight int32
+	lastBits   uint32
+	work       *big.Int
+
+	// redownloaded houses the redownloaded headers which have not been
+	// released yet and nextCommit is the index of the next commitment to
+	// check them against.
+	redownloaded []*wire.BlockHeader
+	nextCommit   int
+}
+
+// NewHeadersSync returns a headers sync which downloads the headers of the chain
+// building on the current best chain tip up to the provided target checkpoint.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) NewHeadersSync(target *chaincfg.Checkpoint) (*HeadersSync, error) {
+	b.chainLock.RLock()
+	tip := b.bestChain.Tip()
+	b.chainLock.RUnlock()
+
+	if target.Height <= tip.height {
+		str := fmt.Sprintf("headers sync target height %d is not "+
+			"after the best chain height %d", target.Height,
+			tip.height)
+		return nil, AssertError(str)
+	}
+
+	s, err := b.newHeadersSync(tip)
+	if err != nil {
+		return nil, err
+	}
+	s.target = *target
+	return s, nil
+}
+
+// NewHeadersSyncToWork returns a headers sync which downloads the headers of the
+// chain building on the current best chain tip up to the first header at which
+// the chain has at least the provided cumulative work.  Unlike NewHeadersSync,
+// it does not rely on checkpoints, so it is suitable to protect against peers
+// sending long chains of low work headers when the checkpoints are not enforced.
+// The minimum chain work of the chain is typically used as the minimum work.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) NewHeadersSyncToWork(minWork *big.Int) (*HeadersSync, error) {
+	b.chainLock.RLock()
+	tip := b.bestChain.Tip()
+	b.chainLock.RUnlock()
+
+	if minWork == nil || tip.workSum.Cmp(minWork) >= 0 {
+		str := fmt.Sprintf("headers sync minimum work %v does not "+
+			"exceed the best chain work %v", minWork, &tip.workSum)
+		return nil, AssertError(str)
+	}
+
+	s, err := b.newHeadersSync(tip)
+	if err != nil {
+		return nil, err
+	}
+	s.minWork = new(big.Int).Set(minWork)
+	return s, nil
+}
+
+// newHeadersSync returns a headers sync building on the passed block node
+// without a target.
+func (b *BlockChain) newHeadersSync(tip *blockNode) (*HeadersSync, error) {
+	s := &HeadersSync{
+		chainParams:          b.chainParams,
+		blocksPerRetarget:    b.blocksPerRetarget,
+		minRetargetTimespan:  b.minRetargetTimespan,
+		maxRetargetTimespan:  b.maxRetargetTimespan,
+		commitPeriod:         headerCommitmentPeriod,
+		redownloadBufferSize: headersRedownloadBufferSize,
+		startHash:            tip.hash,
+		startHeight:          tip.height,
+		startBits:            tip.bits,
+	}
+	s.startWork.Set(&tip.workSum)
+	if _, err := rand.Read(s.salt[:]); err != nil {
+		return nil, err
+	}
+	offset := binary.LittleEndian.Uint32(s.salt[:4])
+	s.commitOffset = int32(offset % uint32(s.commitPeriod))
+	s.resetToStart()
+	return s, nil
+}
+
+// resetToStart resets the last checked header and the total work to the block
+// the headers build on.
+func (s *HeadersSync) resetToStart() {
+	s.lastHash = s.startHash
+	s.lastHeight = s.startHeight
+	s.lastBits = s.startBits
+	s.work = new(big.Int)
+}
+
+// Phase returns the current phase of the headers sync.
+func (s *HeadersSync) Phase() HeadersSyncPhase {
+	return s.phase
+}
+
+// Target returns the target of the headers sync.  When the headers sync was
+// created via NewHeadersSyncToWork, the target is only known once the presync
+// reached the minimum work, so the hash is nil until then.
+func (s *HeadersSync) Target() chaincfg.Checkpoint {
+	return s.target
+}
+
+// Height returns the height of the last header which was checked in the current
+// phase.
+func (s *HeadersSync) Height() int32 {
+	return s.lastHeight
+}
+
+// NextLocatorHash returns the hash of the header the next batch of headers must
+// be requested from.  It is the hash of the block the headers build on when the
+// headers sync just switched to redownloading them.
+func (s *HeadersSync) NextLocatorHash() *chainhash.Hash {
+	hash := s.lastHash
+	return &hash
+}
+
+// commitmentBit returns the salted commitment bit for the header with the
+// provided hash.
+func (s *HeadersSync) commitmentBit(hash *chainhash.Hash) byte {
+	var buf [len(s.salt) + chainhash.HashSize]byte
+	copy(buf[:], s.salt[:])
+	copy(buf[len(s.salt):], hash[:])
+	return chainhash.HashB(buf[:])[0] & 1
+}
+
+// isCommitmentHeight returns whether or not a commitment is made to the header
+// at the provided height.
+func (s *HeadersSync) isCommitmentHeight(height int32) bool {
+	return height%s.commitPeriod == s.commitOffset
+}
+
+// permittedDifficultyTransition returns whether or not the difficulty of a block
+// at the provided height is allowed to change from the passed old bits to the
+// new bits.  It is less strict than calculating the required difficulty since
+// it doesn't need the timestamps of the previous blocks, but it ensures the
+// difficulty of a chain can only change by the permitted amount at each
+// retarget.
+func (s *HeadersSync) permittedDifficultyTransition(height int32, oldBits, newBits uint32) bool {
+	// The difficulty may be reduced to the minimum at any time on the
+	// networks which support it, so any transition is permitted.
+	if s.chainParams.ReduceMinDifficulty {
+		return true
+	}
+
+	// The difficulty must not change outside of retarget intervals.
+	if height%s.blocksPerRetarget != 0 {
+		return oldBits == newBits
+	}
+
+	// Determine the largest and smallest targets which are reachable from
+	// the old target by limiting the adjustment in the same way as the
+	// required difficulty calculation does, including the precision lost
+	// by converting to the compact representation.
+	powLimit := s.chainParams.PowLimit
+	targetTimespan := int64(s.chainParams.TargetTimespan / time.Second)
+	oldTarget := CompactToBig(oldBits)
+	largest := new(big.Int).Mul(oldTarget, big.NewInt(s.maxRetargetTimespan))
+	largest.Div(largest, big.NewInt(targetTimespan))
+	if largest.Cmp(powLimit) > 0 {
+		largest.Set(powLimit)
+	}
+	largest = CompactToBig(BigToCompact(largest))
+	smallest := new(big.Int).Mul(oldTarget, big.NewInt(s.minRetargetTimespan))
+	smallest.Div(smallest, big.NewInt(targetTimespan))
+	if smallest.Cmp(powLimit) > 0 {
+		smallest.Set(powLimit)
+	}
+	smallest = CompactToBig(BigToCompact(smallest))
+
+	newTarget := CompactToBig(newBits)
+	return newTarget.Cmp(largest) <= 0 && newTarget.Cmp(smallest) >= 0
+}
+
+// checkNextHeader ensures the passed header connects to the last checked header,
+// has valid proof of work with a permitted difficulty transition, and does not
+// pass the target.  It updates the last checked header and the total work
+// accordingly and returns the hash and height of the header.
+func (s *HeadersSync) checkNextHeader(header *wire.BlockHeader) (chainhash.Hash, int32, error) {
+	hash := header.BlockHash()
+	height := s.lastHeight + 1
+	if header.PrevBlock != s.lastHash {
+		str := fmt.Sprintf("header %v at height %d does not connect "+
+			"to the previous header %v", hash, height, s.lastHash)
+		return hash, height, ruleError(ErrPreviousBlockUnknown, str)
+	}
+	err := checkProofOfWork(header, s.chainParams.PowLimit, BFNone)
+	if err != nil {
+		return hash, height, err
+	}
+	if !s.permittedDifficultyTransition(height, s.lastBits, header.Bits) {
+		str := fmt.Sprintf("header %v at height %d changes the "+
+			"difficulty from %08x to %08x which is not permitted",
+			hash, height, s.lastBits, header.Bits)
+		return hash, height, ruleError(ErrUnexpectedDifficulty, str)
+	}
+	if s.target.Hash != nil && height == s.target.Height &&
+		hash != *s.target.Hash {
+
+
+		str := fmt.Sprintf("header at height %d has hash %v which does "+
+			"not match the expected checkpoint hash of %v", height,
+			hash, s.target.Hash)
+		return hash, height, ruleError(ErrBadCheckpoint, str)
+	}
+
+	s.lastHash = hash
+	s.lastHeight = height
+	s.lastBits = header.Bits
+	s.work.Add(s.work, CalcWork(header.Bits))
+	return hash, height, nil
+}
+
+// presyncHeader checks the passed header during the presync phase and stores a
+// commitment to it as needed.  The headers sync switches to redownloading the
+// headers once the target is reached.  When the headers sync is to a minimum
+// amount of work, the header at which the chain reaches it becomes the target,
+// so the redownload stops at the same header.
+func (s *HeadersSync) presyncHeader(header *wire.BlockHeader) error {
+	hash, height, err := s.checkNextHeader(header)
+	if err != nil {
+		return err
+	}
+	if s.isCommitmentHeight(height) {
+		if s.numCommits%8 == 0 {
+			s.commitments = append(s.commitments, 0)
+		}
+		bit := s.commitmentBit(&hash)
+		s.commitments[s.numCommits/8] |= bit << uint(s.numCommits%8)
+		s.numCommits++
+	}
+
+	if s.minWork != nil && s.target.Hash == nil {
+		chainWork := new(big.Int).Add(&s.startWork, s.work)
+		if chainWork.Cmp(s.minWork) >= 0 {
+			s.target = chaincfg.Checkpoint{Height: height, Hash: &hash}
+		}
+	}
+	if height == s.target.Height {
+		log.Infof("Presynced headers to height %d with total work %v "+
+			"(%d commitments) -- redownloading headers", height,
+			s.work, s.numCommits)
+		s.phase = HeadersRedownload
+		s.resetToStart()
+	}
+	return nil
+}
+
+// redownloadHeader checks the passed header against the commitments during the
+// redownload phase and buffers it until it can be released.  The headers sync
+// is done once the target is reached.
+func (s *HeadersSync) redownloadHeader(header *wire.BlockHeader) error {
+	hash, height, err := s.checkNextHeader(header)
+	if err != nil {
+		return err
+	}
+	if s.isCommitmentHeight(height) {
+		if s.nextCommit >= s.numCommits {
+			str := fmt.Sprintf("header %v at height %d exceeds the "+
+				"presynced commitments", hash, height)
+			return ruleError(ErrHeadersCommitmentMismatch, str)
+		}
+		commitment := s.commitments[s.nextCommit/8] >>
+			uint(s.nextCommit%8) & 1
+		if s.commitmentBit(&hash) != commitment {
+			str := fmt.Sprintf("header %v at height %d does not "+
+				"match the presynced commitment", hash, height)
+			return ruleError(ErrHeadersCommitmentMismatch, str)
+		}
+		s.nextCommit++
+	}
+	s.redownloaded = append(s.redownloaded, header)
+
+	if height == s.target.Height {
+		s.phase = HeadersSyncDone
+	}
+	return nil
+}
+
+// ProcessHeaders processes the passed batch of headers received from the peer
+// according to the current phase of the headers sync.  It returns the headers,
+// in order, which have been fully verified and are ready to be stored.  No
+// headers are returned during the presync phase.  Any remaining headers after
+// the target is reached in the presync phase are ignored since they are
+// redownloaded.
+//
+// An error is returned when the peer provided headers which are not valid or
+// don't lead to the target, in which case the peer is misbehaving and the
+// headers sync must not be used any longer.
+func (s *HeadersSync) ProcessHeaders(headers []*wire.BlockHeader) ([]*wire.BlockHeader, error) {
+	for _, header := range headers {
+		switch s.phase {
+		case HeadersPresync:
+			if err := s.presyncHeader(header); err != nil {
+				return nil, err
+			}
+			if s.phase != HeadersPresync {
+				return nil, nil
+			}
+
+		case HeadersRedownload:
+			if err := s.redownloadHeader(header); err != nil {
+				return nil, err
+			}
+
+		case HeadersSyncDone:
+			str := fmt.Sprintf("received header %v after the "+
+				"headers sync target", header.BlockHash())
+			return nil, ruleError(ErrBadCheckpoint, str)
+		}
+	}
+
+	// Release all remaining headers once the target is reached and
+	// otherwise only those which are followed by enough headers that were
+	// checked against the commitments.
+	numRelease := len(s.redownloaded)
+	if s.phase != HeadersSyncDone {
+		numRelease -= s.redownloadBufferSize
+	}
+	if numRelease <= 0 {
+		return nil, nil
+	}
+	released := s.redownloaded[:numRelease:numRelease]
+	s.redownloaded = s.redownloaded[numRelease:]
+	return released, nil
+}
@@ -0,0 +1,276 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// TestHeadersSync ensures headers are only released by a headers sync once they
+// have been presynced up to the target and redownloaded, and that headers which
+// are invalid, don't lead to the target, or don't match the commitments are
+// rejected.
+func TestHeadersSync(t *testing.T) {
+	blocks, err := loadBlocks("blk_0_to_4.dat.bz2")
+	if err != nil {
+		t.Fatalf("Error loading file: %v", err)
+	}
+	chain, teardownFunc, err := chainSetup("headerssync",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	headers := make([]*wire.BlockHeader, 0, len(blocks)-1)
+	for _, block := range blocks[1:] {
+		headers = append(headers, &block.MsgBlock().Header)
+	}
+	target := chaincfg.Checkpoint{
+		Height: int32(len(headers)),
+		Hash:   blocks[len(blocks)-1].Hash(),
+	}
+
+	// newHeadersSync returns a headers sync to the target which commits to
+	// every other header starting at height 1 and releases redownloaded
+	// headers once they are followed by a single checked header.
+	newHeadersSync := func(target *chaincfg.Checkpoint) *HeadersSync {
+		t.Helper()
+		s, err := chain.NewHeadersSync(target)
+		if err != nil {
+			t.Fatalf("NewHeadersSync: unexpected error: %v", err)
+		}
+		s.commitPeriod = 2
+		s.commitOffset = 1
+		s.redownloadBufferSize = 1
+		return s
+	}
+
+	// Presync the headers up to the target and ensure none are released
+	// until they are redownloaded.
+	s := newHeadersSync(&target)
+	released, err := s.ProcessHeaders(headers)
+	if err != nil {
+		t.Fatalf("ProcessHeaders: unexpected presync error: %v", err)
+	}
+	if len(released) != 0 || s.Phase() != HeadersRedownload {
+		t.Fatalf("ProcessHeaders: unexpected presync result -- got %d "+
+			"released headers in phase %v", len(released), s.Phase())
+	}
+	if s.numCommits != 2 {
+		t.Fatalf("ProcessHeaders: unexpected number of commitments -- "+
+			"got %d, want 2", s.numCommits)
+	}
+	genesisHash := chain.chainParams.GenesisHash
+	if *s.NextLocatorHash() != *genesisHash {
+		t.Fatalf("NextLocatorHash: got %v, want %v", s.NextLocatorHash(),
+			genesisHash)
+	}
+
+	// Redownload the headers in two batches and ensure the headers of the
+	// first batch are held back until enough headers have been checked.
+	released, err = s.ProcessHeaders(headers[:2])
+	if err != nil {
+		t.Fatalf("ProcessHeaders: unexpected redownload error: %v", err)
+	}
+	if len(released) != 1 || released[0] != headers[0] {
+		t.Fatalf("ProcessHeaders: got %d released headers, want 1",
+			len(released))
+	}
+	released, err = s.ProcessHeaders(headers[2:])
+	if err != nil {
+		t.Fatalf("ProcessHeaders: unexpected redownload error: %v", err)
+	}
+	if len(released) != 3 || s.Phase() != HeadersSyncDone {
+		t.Fatalf("ProcessHeaders: unexpected redownload result -- got "+
+			"%d released headers in phase %v", len(released),
+			s.Phase())
+	}
+	for i, header := range released {
+		if header != headers[i+1] {
+			t.Fatalf("ProcessHeaders: released header #%d is not "+
+				"the expected header", i)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		target  chaincfg.Checkpoint
+		headers []*wire.BlockHeader
+		modify  func(s *HeadersSync)
+		want    error
+	}{{
+		name:    "presync header does not connect",
+		target:  target,
+		headers: headers[1:],
+		want:    ErrPreviousBlockUnknown,
+	}, {
+		name: "presync target hash mismatch",
+		target: chaincfg.Checkpoint{
+			Height: target.Height,
+			Hash:   &chainhash.Hash{},
+		},
+		headers: headers,
+		want:    ErrBadCheckpoint,
+	}, {
+		name:    "redownload commitment mismatch",
+		target:  target,
+		headers: headers,
+		modify: func(s *HeadersSync) {
+			s.commitments[0] ^= 1
+		},
+		want: ErrHeadersCommitmentMismatch,
+	}}
+	for _, test := range tests {
+		s := newHeadersSync(&test.target)
+		_, err := s.ProcessHeaders(test.headers)
+		if err == nil && test.modify != nil {
+			test.modify(s)
+			_, err = s.ProcessHeaders(test.headers)
+		}
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: unexpected error -- got %v, want %v",
+				test.name, err, test.want)
+		}
+	}
+}
+
+// TestHeadersSyncToWork ensures a headers sync to a minimum amount of work
+// targets the first header at which the chain reaches it and only releases the
+// headers up to it once they are redownloaded.
+func TestHeadersSyncToWork(t *testing.T) {
+	blocks, err := loadBlocks("blk_0_to_4.dat.bz2")
+	if err != nil {
+		t.Fatalf("Error loading file: %v", err)
+	}
+	chain, teardownFunc, err := chainSetup("headerssynctowork",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	headers := make([]*wire.BlockHeader, 0, len(blocks)-1)
+	for _, block := range blocks[1:] {
+		headers = append(headers, &block.MsgBlock().Header)
+	}
+
+	// Ensure the minimum work must exceed the work of the best chain.
+	tipWork := new(big.Int).Set(&chain.bestChain.Tip().workSum)
+	if _, err := chain.NewHeadersSyncToWork(tipWork); err == nil {
+		t.Fatal("NewHeadersSyncToWork: accepted minimum work which " +
+			"does not exceed the best chain work")
+	}
+
+	// Require the work of the chain up to the third header and ensure the
+	// presync switches to redownloading at it.
+	minWork := new(big.Int).Set(tipWork)
+	for _, header := range headers[:3] {
+		minWork.Add(minWork, CalcWork(header.Bits))
+	}
+	s, err := chain.NewHeadersSyncToWork(minWork)
+	if err != nil {
+		t.Fatalf("NewHeadersSyncToWork: unexpected error: %v", err)
+	}
+	s.redownloadBufferSize = 1
+	if s.Target().Hash != nil {
+		t.Fatalf("Target: got hash %v before the presync",
+			s.Target().Hash)
+	}
+	released, err := s.ProcessHeaders(headers)
+	if err != nil {
+		t.Fatalf("ProcessHeaders: unexpected presync error: %v", err)
+	}
+	if len(released) != 0 || s.Phase() != HeadersRedownload {
+		t.Fatalf("ProcessHeaders: unexpected presync result -- got %d "+
+			"released headers in phase %v", len(released), s.Phase())
+	}
+	target := s.Target()
+	if target.Height != 3 || *target.Hash != headers[2].BlockHash() {
+		t.Fatalf("Target: got %d/%v, want 3/%v", target.Height,
+			target.Hash, headers[2].BlockHash())
+	}
+
+	// Ensure the headers up to the target are released once redownloaded
+	// and any headers after it are rejected.
+	released, err = s.ProcessHeaders(headers[:3])
+	if err != nil {
+		t.Fatalf("ProcessHeaders: unexpected redownload error: %v", err)
+	}
+	if len(released) != 3 || s.Phase() != HeadersSyncDone {
+		t.Fatalf("ProcessHeaders: unexpected redownload result -- got "+
+			"%d released headers in phase %v", len(released),
+			s.Phase())
+	}
+	_, err = s.ProcessHeaders(headers[3:])
+	if !errors.Is(err, ErrBadCheckpoint) {
+		t.Fatalf("ProcessHeaders: unexpected error -- got %v, want %v",
+			err, ErrBadCheckpoint)
+	}
+}
+
+// TestPermittedDifficultyTransition ensures the difficulty transitions which are
+// permitted while syncing headers are limited to the allowed adjustment at each
+// retarget.
+func TestPermittedDifficultyTransition(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("permitteddifficulty",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	s, err := chain.NewHeadersSync(&chaincfg.Checkpoint{
+		Height: 1,
+		Hash:   &chainhash.Hash{},
+	})
+	if err != nil {
+		t.Fatalf("NewHeadersSync: unexpected error: %v", err)
+	}
+
+	// scaleBits returns the passed bits with the target scaled by the
+	// provided fraction.
+	oldBits := uint32(0x1b0404cb)
+	scaleBits := func(num, denom int64) uint32 {
+		target := CompactToBig(oldBits)
+		target.Mul(target, big.NewInt(num))
+		target.Div(target, big.NewInt(denom))
+		return BigToCompact(target)
+	}
+
+	retargetHeight := chain.blocksPerRetarget
+	tests := []struct {
+		name    string
+		height  int32
+		newBits uint32
+		want    bool
+	}{
+		{"unchanged outside retarget", retargetHeight + 1, oldBits, true},
+		{"changed outside retarget", retargetHeight + 1,
+			scaleBits(2, 1), false},
+		{"unchanged at retarget", retargetHeight, oldBits, true},
+		{"max decrease at retarget", retargetHeight,
+			scaleBits(4, 1), true},
+		{"excessive decrease at retarget", retargetHeight,
+			scaleBits(5, 1), false},
+		{"max increase at retarget", retargetHeight,
+			scaleBits(1, 4), true},
+		{"excessive increase at retarget", retargetHeight,
+			scaleBits(1, 5), false},
+	}
+	for _, test := range tests {
+		got := s.permittedDifficultyTransition(test.height, oldBits,
+			test.newBits)
+		if got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -130,8 +130,20 @@ func dbIndexDisconnectBlock(dbTx database.Tx, indexer Indexer, block *hdfutil.Bl
 // implements the blockchain.IndexManager interface so it can be seamlessly
 // plugged into normal chain processing.
 type Manager struct {
-	db             database.DB
-	enabledIndexes []Indexer
+	db              database.DB
+	enabledIndexes  []Indexer
+	catchUpProgress CatchUpProgressFunc
+}
+
+// CatchUpProgressFunc is the signature of the function which is notified of the
+// height of each block that is indexed while the indexes are caught up to the
+// best chain during initialization along with the height of the best chain.
+type CatchUpProgressFunc func(height, bestHeight int32)
+
+// SetCatchUpProgressFunc sets the function which is notified of the progress of
+// catching up the indexes to the best chain.  It must be called before Init.
+func (m *Manager) SetCatchUpProgressFunc(fn CatchUpProgressFunc) {
+	m.catchUpProgress = fn
 }
 
 // Ensure the Manager type implements the blockchain.IndexManager interface.
@@ -444,8 +456,11 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 			indexerHeights[i] = height
 		}
 
-		// Log indexing progress.
+		// Log indexing progress and notify the caller of it as needed.
 		progressLogger.LogBlockHeight(block)
+		if m.catchUpProgress != nil {
+			m.catchUpProgress(height, bestHeight)
+		}
 
 		if interruptRequested(interrupt) {
 			return errInterruptRequested
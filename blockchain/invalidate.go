@@ -0,0 +1,189 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+)
+
+// descendants returns all of the block nodes in the index which descend from
+// the passed node.
+//
+// This function is safe for concurrent access.
+func (bi *blockIndex) descendants(node *blockNode) []*blockNode {
+	bi.RLock()
+	defer bi.RUnlock()
+
+	children := make(map[*blockNode][]*blockNode)
+	for _, n := range bi.index {
+		if n.parent != nil && n.height > node.height {
+			children[n.parent] = append(children[n.parent], n)
+		}
+	}
+
+	var descendants []*blockNode
+	pending := children[node]
+	for len(pending) > 0 {
+		n := pending[len(pending)-1]
+		pending = append(pending[:len(pending)-1], children[n]...)
+		descendants = append(descendants, n)
+	}
+	return descendants
+}
+
+// findBestCandidate returns the block node with the most cumulative work which
+// is able to become the tip of the main chain when the passed main chain node,
+// which MUST NOT be known to be invalid, is the most recent valid block in the
+// main chain.  A node is able to become the tip when neither it nor any of its
+// ancestors are known to be invalid and the data of all of the blocks that
+// would have to be connected is available.  The passed node is returned when
+// there is no candidate with more work.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) findBestCandidate(validTip *blockNode) *blockNode {
+	b.index.RLock()
+	defer b.index.RUnlock()
+
+	best := validTip
+	for _, node := range b.index.index {
+		if node.workSum.Cmp(&best.workSum) <= 0 ||
+			b.bestChain.Contains(node) {
+
+			continue
+		}
+
+		connectable := true
+		n := node
+		for ; !b.bestChain.Contains(n); n = n.parent {
+			if n.status.KnownInvalid() || !n.status.HaveData() {
+				connectable = false
+				break
+			}
+		}
+		if connectable && n.height <= validTip.height {
+			best = node
+		}
+	}
+	return best
+}
+
+// selectBestValidTip reorganizes the chain to the known branch with the most
+// cumulative work which is not known to be invalid and has the data of its
+// blocks available.  This involves disconnecting the blocks at the end of the
+// main chain which are known to be invalid.  When a block of the selected
+// branch fails validation, it is marked invalid and the next best branch is
+// selected.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) selectBestValidTip() error {
+	for {
+		validTip := b.bestChain.Tip()
+		for b.index.NodeStatus(validTip).KnownInvalid() {
+			validTip = validTip.parent
+		}
+
+		candidate := b.findBestCandidate(validTip)
+		if candidate == b.bestChain.Tip() {
+			return nil
+		}
+
+		detachNodes, attachNodes := b.getReorganizeNodes(candidate)
+		err := b.reorganizeChain(detachNodes, attachNodes)
+		if _, ok := err.(RuleError); ok {
+			// The failed block has been marked invalid, so try the
+			// next best branch.
+			log.Infof("Unable to reorganize to block %v (height %d): "+
+				"%v", candidate.hash, candidate.height, err)
+			continue
+		}
+		return err
+	}
+}
+
+// InvalidateBlock marks the block with the passed hash as invalid along with all
+// of its descendants.  When the block is part of the main chain, it is
+// disconnected along with all blocks after it and the chain is reorganized to
+// the known branch with the most cumulative work that is not known to be
+// invalid.  The usual notifications are sent for the disconnected and connected
+// blocks.
+//
+// The genesis block can't be invalidated and the data of all of the blocks that
+// have to be disconnected must be available.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) InvalidateBlock(hash *chainhash.Hash) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return fmt.Errorf("block %s is not known", hash)
+	}
+	if node.parent == nil {
+		return fmt.Errorf("the genesis block can't be invalidated")
+	}
+
+	// Disconnecting blocks requires their data, so ensure it is available
+	// before modifying anything.
+	if b.bestChain.Contains(node) {
+		for n := b.bestChain.Tip(); n != node.parent; n = n.parent {
+			if !b.index.NodeStatus(n).HaveData() {
+				return fmt.Errorf("block %s can't be invalidated "+
+					"since the data of block %s (height %d) "+
+					"that would have to be disconnected is not "+
+					"available", hash, n.hash, n.height)
+			}
+		}
+	}
+
+	b.index.SetStatusFlags(node, statusValidateFailed)
+	for _, n := range b.index.descendants(node) {
+		b.index.SetStatusFlags(n, statusInvalidAncestor)
+	}
+
+	err := b.selectBestValidTip()
+	if writeErr := b.index.flushToDB(); err == nil {
+		err = writeErr
+	}
+	return err
+}
+
+// ReconsiderBlock removes the invalid status from the block with the passed
+// hash along with its ancestors and descendants, which undoes the effects of
+// InvalidateBlock.  The chain is then reorganized to the known branch with the
+// most cumulative work that is not known to be invalid, which might involve
+// validating blocks again.  The usual notifications are sent for the
+// disconnected and connected blocks.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ReconsiderBlock(hash *chainhash.Hash) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return fmt.Errorf("block %s is not known", hash)
+	}
+
+	const invalidFlags = statusValidateFailed | statusInvalidAncestor
+	for n := node; n != nil; n = n.parent {
+		if b.index.NodeStatus(n).KnownInvalid() {
+			b.index.UnsetStatusFlags(n, invalidFlags)
+		}
+	}
+	for _, n := range b.index.descendants(node) {
+		if b.index.NodeStatus(n).KnownInvalid() {
+			b.index.UnsetStatusFlags(n, invalidFlags)
+		}
+	}
+
+	err := b.selectBestValidTip()
+	if writeErr := b.index.flushToDB(); err == nil {
+		err = writeErr
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+)
+
+// TestInvalidateReconsiderBlock ensures invalidating a block of the main chain
+// disconnects it along with its descendants and reconsidering it connects them
+// again.
+func TestInvalidateReconsiderBlock(t *testing.T) {
+	blocks, err := loadBlocks("blk_0_to_4.dat.bz2")
+	if err != nil {
+		t.Fatalf("Error loading file: %v\n", err)
+	}
+
+	// Create a new database and chain instance to run tests against.
+	chain, teardownFunc, err := chainSetup("invalidatereconsider",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Since we're not dealing with the real block chain, set the coinbase
+	// maturity to 1.
+	chain.TstSetCoinbaseMaturity(1)
+
+	for i := 1; i < len(blocks); i++ {
+		_, _, err := chain.ProcessBlock(blocks[i], BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock fail on block %d: %v\n", i, err)
+		}
+	}
+
+	assertTip := func(wantIdx int) {
+		t.Helper()
+		best := chain.BestSnapshot()
+		if best.Hash != *blocks[wantIdx].Hash() {
+			t.Fatalf("unexpected tip - got %v (height %d), want %v "+
+				"(height %d)", best.Hash, best.Height,
+				blocks[wantIdx].Hash(), wantIdx)
+		}
+	}
+	assertTip(len(blocks) - 1)
+
+	// Ensure the genesis block can't be invalidated.
+	if err := chain.InvalidateBlock(blocks[0].Hash()); err == nil {
+		t.Fatal("InvalidateBlock: invalidated the genesis block")
+	}
+
+	// Ensure invalidating a block disconnects it along with its descendants
+	// and marks them invalid.
+	if err := chain.InvalidateBlock(blocks[3].Hash()); err != nil {
+		t.Fatalf("InvalidateBlock: unexpected error: %v", err)
+	}
+	assertTip(2)
+	node3 := chain.index.LookupNode(blocks[3].Hash())
+	node4 := chain.index.LookupNode(blocks[4].Hash())
+	status3 := chain.index.NodeStatus(node3)
+	if status3&statusValidateFailed == 0 {
+		t.Fatalf("invalidated block has unexpected status %v", status3)
+	}
+	status4 := chain.index.NodeStatus(node4)
+	if status4&statusInvalidAncestor == 0 {
+		t.Fatalf("descendant block has unexpected status %v", status4)
+	}
+
+	// Ensure reconsidering a descendant of the invalidated block connects
+	// all of the blocks again.
+	if err := chain.ReconsiderBlock(blocks[4].Hash()); err != nil {
+		t.Fatalf("ReconsiderBlock: unexpected error: %v", err)
+	}
+	assertTip(4)
+	if status := chain.index.NodeStatus(node3); status.KnownInvalid() {
+		t.Fatalf("reconsidered block has unexpected status %v", status)
+	}
+}
@@ -6,6 +6,8 @@ package blockchain
 
 import (
 	"fmt"
+
+	"github.com/ifishnet/hdfutil"
 )
 
 // NotificationType represents the type of a notification message.
@@ -67,6 +69,104 @@ func (b *BlockChain) Subscribe(callback NotificationCallback) {
 	b.notificationsLock.Unlock()
 }
 
+// BlockDelta describes the changes a block that was connected to or
+// disconnected from the main chain made to the utxo set.  SpentTxOuts houses
+// the details of all of the outputs spent by the block in the order they were
+// spent, which is the undo data needed to restore them when the block is
+// disconnected.  Together with the outputs created by the block, this allows
+// the changes to be applied or unwound without loading anything from the
+// database.
+//
+// The spent outputs are shared with the chain and MUST NOT be modified.
+type BlockDelta struct {
+	Block       *hdfutil.Block
+	Height      int32
+	SpentTxOuts []SpentTxOut
+}
+
+// ReorgNotification describes a change to the main chain.  Disconnected houses
+// the blocks which were removed from the end of the main chain in the order
+// they were disconnected (from the old tip backwards) and Connected houses the
+// blocks which were then added in the order they were connected.  The typical
+// case of a block extending the main chain consists of a single connected
+// block, while a reorganize consists of both.
+type ReorgNotification struct {
+	Disconnected []BlockDelta
+	Connected    []BlockDelta
+}
+
+// addDisconnected adds the passed block to the disconnected blocks of the
+// notification.  It is a no-op for a nil notification to allow callers to
+// avoid tracking changes when there are no subscribers.
+func (n *ReorgNotification) addDisconnected(block *hdfutil.Block, height int32, stxos []SpentTxOut) {
+	if n == nil {
+		return
+	}
+	n.Disconnected = append(n.Disconnected, BlockDelta{
+		Block:       block,
+		Height:      height,
+		SpentTxOuts: stxos,
+	})
+}
+
+// addConnected adds the passed block to the connected blocks of the
+// notification.  It is a no-op for a nil notification to allow callers to
+// avoid tracking changes when there are no subscribers.
+func (n *ReorgNotification) addConnected(block *hdfutil.Block, height int32, stxos []SpentTxOut) {
+	if n == nil {
+		return
+	}
+	n.Connected = append(n.Connected, BlockDelta{
+		Block:       block,
+		Height:      height,
+		SpentTxOuts: stxos,
+	})
+}
+
+// ChainViewCallback is used for a caller to provide a callback for
+// notifications about changes to the main chain.
+type ChainViewCallback func(*ReorgNotification)
+
+// SubscribeChainView registers a callback to be executed whenever blocks are
+// connected to or disconnected from the main chain.  Unlike the notifications
+// registered with Subscribe, all of the blocks disconnected and connected by a
+// reorganize are delivered together along with the spent outputs of each block
+// so subscribers such as indexers can apply or unwind their state without
+// loading the blocks or their spend journal entries from the database.
+func (b *BlockChain) SubscribeChainView(callback ChainViewCallback) {
+	b.notificationsLock.Lock()
+	b.chainViewCallbacks = append(b.chainViewCallbacks, callback)
+	b.notificationsLock.Unlock()
+}
+
+// newReorgNotification returns a new empty notification to track changes to
+// the main chain in when there are chain view subscribers and nil otherwise.
+func (b *BlockChain) newReorgNotification() *ReorgNotification {
+	b.notificationsLock.RLock()
+	numCallbacks := len(b.chainViewCallbacks)
+	b.notificationsLock.RUnlock()
+	if numCallbacks == 0 {
+		return nil
+	}
+	return &ReorgNotification{}
+}
+
+// sendChainViewNotification sends the passed notification to all of the chain
+// view subscribers.
+//
+// This function MUST be called with the chain state lock held (for writes).
+// The lock is released while the callbacks are executed so they may query the
+// chain.
+func (b *BlockChain) sendChainViewNotification(n *ReorgNotification) {
+	b.chainLock.Unlock()
+	b.notificationsLock.RLock()
+	for _, callback := range b.chainViewCallbacks {
+		callback(n)
+	}
+	b.notificationsLock.RUnlock()
+	b.chainLock.Lock()
+}
+
 // sendNotification sends a notification with the passed type and data if the
 // caller requested notifications by providing a callback function in the call
 // to New.
@@ -49,3 +49,64 @@ func TestNotifications(t *testing.T) {
 			"times, found %d", numSubscribers, notificationCount)
 	}
 }
+
+// TestChainViewNotifications ensures that chain view callbacks are fired with
+// the expected deltas when blocks are connected to the main chain.
+func TestChainViewNotifications(t *testing.T) {
+	blocks, err := loadBlocks("blk_0_to_4.dat.bz2")
+	if err != nil {
+		t.Fatalf("Error loading file: %v\n", err)
+	}
+
+	// Create a new database and chain instance to run tests against.
+	chain, teardownFunc, err := chainSetup("chainviewnotifications",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Since we're not dealing with the real block chain, set the coinbase
+	// maturity to 1.
+	chain.TstSetCoinbaseMaturity(1)
+
+	var notifications []*ReorgNotification
+	chain.SubscribeChainView(func(n *ReorgNotification) {
+		notifications = append(notifications, n)
+	})
+
+	for i := 1; i < len(blocks); i++ {
+		_, _, err := chain.ProcessBlock(blocks[i], BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock fail on block %d: %v\n", i, err)
+		}
+	}
+
+	// Ensure a notification with a single connected block was delivered
+	// for each block in order.
+	if len(notifications) != len(blocks)-1 {
+		t.Fatalf("Expected %d chain view notifications, found %d",
+			len(blocks)-1, len(notifications))
+	}
+	for i, n := range notifications {
+		if len(n.Disconnected) != 0 || len(n.Connected) != 1 {
+			t.Fatalf("Notification #%d: got %d disconnected and %d "+
+				"connected blocks, want 0 and 1", i,
+				len(n.Disconnected), len(n.Connected))
+		}
+		delta := n.Connected[0]
+		wantBlock := blocks[i+1]
+		if *delta.Block.Hash() != *wantBlock.Hash() ||
+			delta.Height != int32(i+1) {
+
+			t.Fatalf("Notification #%d: got block %v (height %d), "+
+				"want %v (height %d)", i, delta.Block.Hash(),
+				delta.Height, wantBlock.Hash(), i+1)
+		}
+		if len(delta.SpentTxOuts) != countSpentOutputs(wantBlock) {
+			t.Fatalf("Notification #%d: got %d spent outputs, want "+
+				"%d", i, len(delta.SpentTxOuts),
+				countSpentOutputs(wantBlock))
+		}
+	}
+}
@@ -29,6 +29,12 @@ const (
 	// not be performed.
 	BFNoPoWCheck
 
+	// BFNoCheckpointSkip may be set to indicate the checkpoints must not be
+	// used to skip validation of the block, such as running its scripts,
+	// even when the checkpoints of the chain are enforced.  BFFastAdd is
+	// ignored when this flag is set.
+	BFNoCheckpointSkip
+
 	// BFNone is a convenience value to specifically indicate no flags.
 	BFNone BehaviorFlags = 0
 )
@@ -117,7 +123,8 @@ func (b *BlockChain) processOrphans(hash *chainhash.Hash, flags BehaviorFlags) e
 			// Potentially accept the block into the block chain.
 			_, err := b.maybeAcceptBlock(orphan.block, flags)
 			if err != nil {
-				return err
+				return withBlockContext(err, orphanHash,
+					orphan.block.Height())
 			}
 
 			// Add this block to the list of blocks to process so
@@ -138,11 +145,33 @@ func (b *BlockChain) processOrphans(hash *chainhash.Hash, flags BehaviorFlags) e
 // whether or not the block is on the main chain and the second indicates
 // whether or not the block is an orphan.
 //
+// Any rule violations that are returned identify the block they apply to.
+//
 // This function is safe for concurrent access.
 func (b *BlockChain) ProcessBlock(block *hdfutil.Block, flags BehaviorFlags) (bool, bool, error) {
 	b.chainLock.Lock()
 	defer b.chainLock.Unlock()
 
+	isMainChain, isOrphan, err := b.processBlock(block, flags)
+	if err != nil {
+		// The height is only known once the block has been connected to
+		// its parent, otherwise it remains unknown.
+		err = withBlockContext(err, block.Hash(), block.Height())
+	}
+	return isMainChain, isOrphan, err
+}
+
+// processBlock houses the implementation of ProcessBlock.  See its comments
+// for details.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) processBlock(block *hdfutil.Block, flags BehaviorFlags) (bool, bool, error) {
+	// The checks avoided by BFFastAdd are only skipped since the block is
+	// known to lead to a checkpoint, so they must be performed when the
+	// checkpoints are not allowed to skip validation.
+	if !b.checkpointsSkipValidation(flags) {
+		flags &^= BFFastAdd
+	}
 	fastAdd := flags&BFFastAdd == BFFastAdd
 
 	blockHash := block.Hash()
@@ -183,7 +212,7 @@ func (b *BlockChain) ProcessBlock(block *hdfutil.Block, flags BehaviorFlags) (bo
 	}
 	if checkpointNode != nil {
 		// Ensure the block timestamp is after the checkpoint timestamp.
-		checkpointTime := time.Unix(checkpointNode.timestamp, 0)
+		checkpointTime := time.Unix(int64(checkpointNode.timestamp), 0)
 		if blockHeader.Timestamp.Before(checkpointTime) {
 			str := fmt.Sprintf("block %v has timestamp %v before "+
 				"last checkpoint timestamp %v", blockHash,
@@ -238,6 +267,15 @@ func (b *BlockChain) ProcessBlock(block *hdfutil.Block, flags BehaviorFlags) (bo
 		return false, false, err
 	}
 
+	// Prune the data of the oldest blocks as needed now that the best
+	// chain might have been extended.  The block has already been accepted
+	// at this point, so failure to prune is only logged.
+	if isMainChain {
+		if err := b.maybePruneBlocks(); err != nil {
+			log.Warnf("Unable to prune block data: %v", err)
+		}
+	}
+
 	log.Debugf("Accepted block %v", blockHash)
 
 	return isMainChain, false, nil
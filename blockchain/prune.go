@@ -0,0 +1,121 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/database"
+)
+
+const (
+	// MinBlocksToKeep is the minimum number of the most recent main chain
+	// blocks that have their data kept when pruning.  This is the number of
+	// blocks a node signalling the NODE_NETWORK_LIMITED service is expected
+	// to be able to serve (BIP0159) and also limits the depth of the
+	// reorganizations a pruned node is able to perform since disconnecting
+	// a block requires its data along with its spend journal entry.
+	MinBlocksToKeep = 288
+
+	// MinPruneTarget is the minimum allowed target size in bytes for the
+	// stored block data when pruning.  It allows the data of at least
+	// MinBlocksToKeep blocks to be stored in addition to some room for the
+	// block files not being evenly filled.
+	MinPruneTarget = 550 * 1024 * 1024 // 550 MiB
+
+	// pruneInterval is the number of blocks the best chain has to be
+	// extended by between attempts to prune the stored block data.
+	pruneInterval = 6
+)
+
+// keepBlockData returns whether or not the data of the block with the provided
+// hash must be kept when pruning.  The data of all blocks within the most
+// recent MinBlocksToKeep blocks of the best chain, including any side chain
+// blocks at those heights, is kept.  Blocks which are not in the block index
+// are never needed.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) keepBlockData(hash *chainhash.Hash) bool {
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return false
+	}
+	return node.height > b.bestChain.Tip().height-MinBlocksToKeep
+}
+
+// maybePruneBlocks removes the data of the oldest blocks from the database once
+// the best chain has been extended by enough blocks since the last attempt when
+// pruning is enabled and the stored block data exceeds the prune target.
+//
+// The pruned blocks remain in the block index, so their headers are still
+// available, and the utxo set is not affected.  However, the blocks no longer
+// have their data stored and the spend journal entries for them are removed
+// since they are only needed to disconnect the blocks which is no longer
+// possible without their data.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) maybePruneBlocks() error {
+	// The data of the historical blocks leading up to a loaded utxo
+	// snapshot is needed until they have been validated in the background.
+	tipHeight := b.bestChain.Tip().height
+	if b.pruneTarget == 0 || tipHeight < b.nextPruneHeight ||
+		b.snapshot != nil {
+
+		return nil
+	}
+	b.nextPruneHeight = tipHeight + pruneInterval
+
+	// The blocks connected since the utxo cache was last flushed are
+	// replayed on startup after an unclean shutdown, so ensure none of
+	// them can be pruned.
+	consistentHash := b.utxoCache.consistentHash()
+	consistentNode := b.index.LookupNode(&consistentHash)
+	if consistentNode == nil ||
+		consistentNode.height <= tipHeight-MinBlocksToKeep {
+
+		if err := b.utxoCache.flush(false); err != nil {
+			return err
+		}
+	}
+
+	prunedHashes, err := b.db.Prune(b.pruneTarget, b.keepBlockData)
+	if err != nil || len(prunedHashes) == 0 {
+		return err
+	}
+
+	// Remove the spend journal entries for the pruned blocks and update the
+	// block index to reflect they no longer have their data stored.
+	err = b.db.Update(func(dbTx database.Tx) error {
+		for i := range prunedHashes {
+			err := dbRemoveSpendJournalEntry(dbTx, &prunedHashes[i])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := range prunedHashes {
+		node := b.index.LookupNode(&prunedHashes[i])
+		if node != nil {
+			b.index.UnsetStatusFlags(node, statusDataStored)
+		}
+	}
+	if err := b.index.flushToDB(); err != nil {
+		return err
+	}
+
+	log.Infof("Pruned the data of %d blocks (best height %d)",
+		len(prunedHashes), tipHeight)
+	return nil
+}
+
+// IsPruned returns whether or not pruning of the stored block data is enabled.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) IsPruned() bool {
+	return b.pruneTarget != 0
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+)
+
+// TestKeepBlockData ensures the data of the most recent blocks, including side
+// chain blocks at the same heights, is kept when pruning while older blocks
+// and blocks not in the block index are not.
+func TestKeepBlockData(t *testing.T) {
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	genesis := chain.bestChain.Genesis()
+
+	// Create a main chain along with side chains that fork from it both
+	// deep in the chain and within the most recent blocks to keep.
+	const numNodes = MinBlocksToKeep + 100
+	mainNodes := chainedNodes(genesis, numNodes)
+	oldSideNodes := chainedNodes(mainNodes[9], 2)
+	recentSideNodes := chainedNodes(mainNodes[numNodes-10], 2)
+	for _, nodes := range [][]*blockNode{mainNodes, oldSideNodes,
+		recentSideNodes} {
+
+		for _, node := range nodes {
+			chain.index.AddNode(node)
+		}
+	}
+	chain.bestChain.SetTip(tstTip(mainNodes))
+	orphanNode := chainedNodes(nil, 1)[0]
+
+	tests := []struct {
+		name string
+		node *blockNode
+		want bool
+	}{
+		{"genesis", genesis, false},
+		{"old main chain", mainNodes[numNodes-MinBlocksToKeep-1], false},
+		{"oldest kept main chain", mainNodes[numNodes-MinBlocksToKeep], true},
+		{"tip", tstTip(mainNodes), true},
+		{"old side chain", tstTip(oldSideNodes), false},
+		{"recent side chain", tstTip(recentSideNodes), true},
+		{"not in index", orphanNode, false},
+	}
+	for _, test := range tests {
+		got := chain.keepBlockData(&test.node.hash)
+		if got != test.want {
+			t.Errorf("%s: unexpected result - got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+
+	// Ensure pruning is not attempted when it is disabled.  The fake chain
+	// does not have a database, so any attempt would panic.
+	if chain.IsPruned() {
+		t.Fatal("IsPruned: pruning unexpectedly enabled")
+	}
+	if err := chain.maybePruneBlocks(); err != nil {
+		t.Fatalf("maybePruneBlocks: unexpected error: %v", err)
+	}
+}
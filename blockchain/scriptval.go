@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"math"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/ifishnet/hdfd/txscript"
@@ -15,25 +16,121 @@ import (
 	"github.com/ifishnet/hdfutil"
 )
 
-// txValidateItem holds a transaction along with which input to validate.
+// maxScriptValBatchSize is the maximum number of transaction inputs handed to
+// a script validation worker at once.  Handing out inputs in batches reduces
+// the synchronization overhead of validating blocks with many inputs while
+// still allowing the work to be spread evenly across the workers.
+const maxScriptValBatchSize = 32
+
+// txSigHashes lazily computes the sighash midstate of a transaction the first
+// time it is needed by a script validation worker so that it is computed once
+// and shared by all of the inputs of the transaction, regardless of which
+// workers end up validating them.
+type txSigHashes struct {
+	once      sync.Once
+	tx        *hdfutil.Tx
+	hashCache *txscript.HashCache
+	sigHashes *txscript.TxSigHashes
+}
+
+// newTxSigHashes returns a lazily computed sighash midstate for the passed
+// transaction which is stored in the provided hash cache, when there is one, so
+// it can be reused.
+func newTxSigHashes(tx *hdfutil.Tx, hashCache *txscript.HashCache) *txSigHashes {
+	return &txSigHashes{tx: tx, hashCache: hashCache}
+}
+
+// get returns the sighash midstate of the transaction, computing it on the first
+// call.
+//
+// This function is safe for concurrent access.
+func (s *txSigHashes) get() *txscript.TxSigHashes {
+	s.once.Do(func() {
+		msgTx := s.tx.MsgTx()
+		if s.hashCache != nil {
+			s.sigHashes = s.hashCache.GetOrAddSigHashes(msgTx)
+			return
+		}
+		s.sigHashes = txscript.NewTxSigHashes(msgTx)
+	})
+	return s.sigHashes
+}
+
+// txValidateItem holds a transaction along with which input to validate.  The
+// sighash midstate is nil when it is not needed to validate the input.
 type txValidateItem struct {
 	txInIndex int
 	txIn      *wire.TxIn
 	tx        *hdfutil.Tx
-	sigHashes *txscript.TxSigHashes
+	sigHashes *txSigHashes
+}
+
+// scriptValJob is a batch of transaction inputs handed to the script validation
+// workers along with the validator they belong to.
+type scriptValJob struct {
+	v     *txValidator
+	items []*txValidateItem
+}
+
+// scriptValPool houses a persistent pool of workers which validate the scripts
+// of transaction inputs.  The pool is shared by all validators so the workers
+// don't need to be started for every block and transaction that is validated.
+type scriptValPool struct {
+	numWorkers int
+	jobs       chan scriptValJob
+}
+
+var (
+	// scriptValPoolOnce ensures the shared script validation pool is only
+	// started once.
+	scriptValPoolOnce sync.Once
+
+	// sharedScriptValPool is the script validation pool used by all
+	// validators.  It must only be accessed through scriptValidationPool.
+	sharedScriptValPool *scriptValPool
+)
+
+// scriptValidationPool returns the shared script validation pool, starting its
+// workers on the first call.  The number of workers is limited to the number of
+// processor cores since script validation is CPU bound and more workers would
+// only contend with each other.
+//
+// This function is safe for concurrent access.
+func scriptValidationPool() *scriptValPool {
+	scriptValPoolOnce.Do(func() {
+		numWorkers := runtime.NumCPU()
+		if numWorkers <= 0 {
+			numWorkers = 1
+		}
+		sharedScriptValPool = &scriptValPool{
+			numWorkers: numWorkers,
+			jobs:       make(chan scriptValJob),
+		}
+		for i := 0; i < numWorkers; i++ {
+			go sharedScriptValPool.worker()
+		}
+	})
+	return sharedScriptValPool
+}
+
+// worker validates the batches of transaction inputs sent to the pool.  It must
+// be run as a goroutine.
+func (p *scriptValPool) worker() {
+	for job := range p.jobs {
+		job.v.validateBatch(job.items)
+	}
 }
 
 // txValidator provides a type which asynchronously validates transaction
-// inputs.  It provides several channels for communication and a processing
-// function that is intended to be in run multiple goroutines.
+// inputs using the shared script validation pool.  It provides channels for
+// communicating with the workers validating its inputs.
 type txValidator struct {
-	validateChan chan *txValidateItem
-	quitChan     chan struct{}
-	resultChan   chan error
-	utxoView     *UtxoViewpoint
-	flags        txscript.ScriptFlags
-	sigCache     *txscript.SigCache
-	hashCache    *txscript.HashCache
+	quitChan   chan struct{}
+	resultChan chan error
+	utxoView   *UtxoViewpoint
+	flags      txscript.ScriptFlags
+	sigCache   *txscript.SigCache
+	hashCache  *txscript.HashCache
 }
 
 // sendResult sends the result of a script pair validation on the internal
@@ -47,119 +144,176 @@ func (v *txValidator) sendResult(result error) {
 	}
 }
 
-// validateHandler consumes items to validate from the internal validate channel
-// and returns the result of the validation on the internal result channel. It
-// must be run as a goroutine.
-func (v *txValidator) validateHandler() {
-out:
-	for {
-		select {
-		case txVI := <-v.validateChan:
-			// Ensure the referenced input utxo is available.
-			txIn := txVI.txIn
-			utxo := v.utxoView.LookupEntry(txIn.PreviousOutPoint)
-			if utxo == nil {
-				str := fmt.Sprintf("unable to find unspent "+
-					"output %v referenced from "+
-					"transaction %s:%d",
-					txIn.PreviousOutPoint, txVI.tx.Hash(),
-					txVI.txInIndex)
-				err := ruleError(ErrMissingTxOut, str)
-				v.sendResult(err)
-				break out
+// validateItem validates the script pair of the passed transaction input.  When
+// a batch verifier is passed, the signature checks of the scripts are deferred
+// to it, so a nil error is only conclusive once it verified them.
+func (v *txValidator) validateItem(txVI *txValidateItem,
+	batchVerifier *txscript.BatchVerifier) error {
+
+	// Ensure the referenced input utxo is available.
+	txIn := txVI.txIn
+	utxo := v.utxoView.LookupEntry(txIn.PreviousOutPoint)
+	if utxo == nil {
+		str := fmt.Sprintf("unable to find unspent output %v "+
+			"referenced from transaction %s:%d",
+			txIn.PreviousOutPoint, txVI.tx.Hash(), txVI.txInIndex)
+		return inputRuleError(ErrMissingTxOut, str, txVI.tx.Hash(),
+			txVI.txInIndex)
+	}
+
+	// Create a new script engine for the script pair.
+	sigScript := txIn.SignatureScript
+	witness := txIn.Witness
+	pkScript := utxo.PkScript()
+	inputAmount := utxo.Amount()
+	var sigHashes *txscript.TxSigHashes
+	if txVI.sigHashes != nil {
+		sigHashes = txVI.sigHashes.get()
+	}
+	vm, err := txscript.NewEngine(pkScript, txVI.tx.MsgTx(),
+		txVI.txInIndex, v.flags, v.sigCache, sigHashes, inputAmount)
+	if err != nil {
+		str := fmt.Sprintf("failed to parse input %s:%d which "+
+			"references output %v - %v (input witness %x, input "+
+			"script bytes %x, prev output script bytes %x)",
+			txVI.tx.Hash(), txVI.txInIndex, txIn.PreviousOutPoint,
+			err, witness, sigScript, pkScript)
+		return inputRuleError(ErrScriptMalformed, str, txVI.tx.Hash(),
+			txVI.txInIndex)
+	}
+	if batchVerifier != nil {
+		vm.SetBatchVerifier(batchVerifier)
+	}
+
+	// Execute the script pair.
+	if err := vm.Execute(); err != nil {
+		str := fmt.Sprintf("failed to validate input %s:%d which "+
+			"references output %v - %v (input witness %x, input "+
+			"script bytes %x, prev output script bytes %x)",
+			txVI.tx.Hash(), txVI.txInIndex, txIn.PreviousOutPoint,
+			err, witness, sigScript, pkScript)
+		return inputRuleError(ErrScriptValidation, str, txVI.tx.Hash(),
+			txVI.txInIndex)
+	}
+
+	return nil
+}
+
+// validateBatch validates the passed batch of transaction inputs and sends a
+// single result for the entire batch on the internal result channel.  The
+// batch is abandoned without sending a result when the validation process has
+// been aborted due to a validation error in another batch.
+//
+// When taproot is enforced, the Schnorr signature checks of all of the inputs
+// are deferred and verified together once their scripts have been executed,
+// which is considerably faster than verifying them one at a time.  Only when
+// that fails are the inputs validated again without deferring the checks to
+// find out which of them is invalid.
+func (v *txValidator) validateBatch(items []*txValidateItem) {
+	if v.flags&txscript.ScriptVerifyTaproot == 0 {
+		for _, txVI := range items {
+			select {
+			case <-v.quitChan:
+				return
+			default:
 			}
 
-			// Create a new script engine for the script pair.
-			sigScript := txIn.SignatureScript
-			witness := txIn.Witness
-			pkScript := utxo.PkScript()
-			inputAmount := utxo.Amount()
-			vm, err := txscript.NewEngine(pkScript, txVI.tx.MsgTx(),
-				txVI.txInIndex, v.flags, v.sigCache, txVI.sigHashes,
-				inputAmount)
-			if err != nil {
-				str := fmt.Sprintf("failed to parse input "+
-					"%s:%d which references output %v - "+
-					"%v (input witness %x, input script "+
-					"bytes %x, prev output script bytes %x)",
-					txVI.tx.Hash(), txVI.txInIndex,
-					txIn.PreviousOutPoint, err, witness,
-					sigScript, pkScript)
-				err := ruleError(ErrScriptMalformed, str)
+			if err := v.validateItem(txVI, nil); err != nil {
 				v.sendResult(err)
-				break out
+				return
 			}
+		}
+		v.sendResult(nil)
+		return
+	}
 
-			// Execute the script pair.
-			if err := vm.Execute(); err != nil {
-				str := fmt.Sprintf("failed to validate input "+
-					"%s:%d which references output %v - "+
-					"%v (input witness %x, input script "+
-					"bytes %x, prev output script bytes %x)",
-					txVI.tx.Hash(), txVI.txInIndex,
-					txIn.PreviousOutPoint, err, witness,
-					sigScript, pkScript)
-				err := ruleError(ErrScriptValidation, str)
+	batchVerifier := txscript.NewBatchVerifier()
+	for _, txVI := range items {
+		select {
+		case <-v.quitChan:
+			return
+		default:
+		}
+
+		// A script failure is only conclusive when the deferred
+		// signature checks didn't change its execution, so validate
+		// the input again without deferring them to be sure.
+		if err := v.validateItem(txVI, batchVerifier); err != nil {
+			if err := v.validateItem(txVI, nil); err != nil {
 				v.sendResult(err)
-				break out
+				return
 			}
+		}
+	}
+	if batchVerifier.Verify() {
+		v.sendResult(nil)
+		return
+	}
 
-			// Validation succeeded.
-			v.sendResult(nil)
-
+	for _, txVI := range items {
+		select {
 		case <-v.quitChan:
-			break out
+			return
+		default:
+		}
+
+		if err := v.validateItem(txVI, nil); err != nil {
+			v.sendResult(err)
+			return
 		}
 	}
+
+	// Validation succeeded.
+	v.sendResult(nil)
 }
 
 // Validate validates the scripts for all of the passed transaction inputs using
-// multiple goroutines.
+// the shared script validation pool.
 func (v *txValidator) Validate(items []*txValidateItem) error {
 	if len(items) == 0 {
 		return nil
 	}
 
-	// Limit the number of goroutines to do script validation based on the
-	// number of processor cores.  This helps ensure the system stays
-	// reasonably responsive under heavy load.
-	maxGoRoutines := runtime.NumCPU() * 3
-	if maxGoRoutines <= 0 {
-		maxGoRoutines = 1
-	}
-	if maxGoRoutines > len(items) {
-		maxGoRoutines = len(items)
+	// Split the inputs into batches that are small enough for every worker
+	// to receive several of them so the load stays balanced when some
+	// inputs are more expensive to validate than others.
+	pool := scriptValidationPool()
+	numInputs := len(items)
+	batchSize := numInputs / (pool.numWorkers * 4)
+	if batchSize < 1 {
+		batchSize = 1
 	}
-
-	// Start up validation handlers that are used to asynchronously
-	// validate each transaction input.
-	for i := 0; i < maxGoRoutines; i++ {
-		go v.validateHandler()
+	if batchSize > maxScriptValBatchSize {
+		batchSize = maxScriptValBatchSize
 	}
+	numBatches := (numInputs + batchSize - 1) / batchSize
 
-	// Validate each of the inputs.  The quit channel is closed when any
-	// errors occur so all processing goroutines exit regardless of which
-	// input had the validation error.
-	numInputs := len(items)
+	// Validate each of the batches.  The quit channel is closed when any
+	// errors occur so all workers abandon the remaining inputs of this
+	// validator regardless of which input had the validation error.
 	currentItem := 0
-	processedItems := 0
-	for processedItems < numInputs {
-		// Only send items while there are still items that need to
+	processedBatches := 0
+	for processedBatches < numBatches {
+		// Only send batches while there are still inputs that need to
 		// be processed.  The select statement will never select a nil
 		// channel.
-		var validateChan chan *txValidateItem
-		var item *txValidateItem
+		var jobs chan scriptValJob
+		var job scriptValJob
+		batchEnd := currentItem + batchSize
+		if batchEnd > numInputs {
+			batchEnd = numInputs
+		}
 		if currentItem < numInputs {
-			validateChan = v.validateChan
-			item = items[currentItem]
+			jobs = pool.jobs
+			job = scriptValJob{v: v, items: items[currentItem:batchEnd]}
 		}
 
 		select {
-		case validateChan <- item:
-			currentItem++
+		case jobs <- job:
+			currentItem = batchEnd
 
 		case err := <-v.resultChan:
-			processedItems++
+			processedBatches++
 			if err != nil {
 				close(v.quitChan)
 				return err
@@ -176,42 +330,29 @@ func (v *txValidator) Validate(items []*txValidateItem) error {
 func newTxValidator(utxoView *UtxoViewpoint, flags txscript.ScriptFlags,
 	sigCache *txscript.SigCache, hashCache *txscript.HashCache) *txValidator {
 	return &txValidator{
-		validateChan: make(chan *txValidateItem),
-		quitChan:     make(chan struct{}),
-		resultChan:   make(chan error),
-		utxoView:     utxoView,
-		sigCache:     sigCache,
-		hashCache:    hashCache,
-		flags:        flags,
+		quitChan:   make(chan struct{}),
+		resultChan: make(chan error),
+		utxoView:   utxoView,
+		sigCache:   sigCache,
+		hashCache:  hashCache,
+		flags:      flags,
 	}
 }
 
 // ValidateTransactionScripts validates the scripts for the passed transaction
-// using multiple goroutines.
+// using the shared script validation pool.
 func ValidateTransactionScripts(tx *hdfutil.Tx, utxoView *UtxoViewpoint,
 	flags txscript.ScriptFlags, sigCache *txscript.SigCache,
 	hashCache *txscript.HashCache) error {
 
-	// First determine if segwit is active according to the scriptFlags. If
-	// it isn't then we don't need to interact with the HashCache.
+	// The sighash midstate is only needed when segwit is active according
+	// to the script flags and the transaction has witness data.  The same
+	// lazily computed midstate is shared by all of the inputs, so it is
+	// only computed once, and is added to the hash cache for later reuse.
+	var cachedHashes *txSigHashes
 	segwitActive := flags&txscript.ScriptVerifyWitness == txscript.ScriptVerifyWitness
-
-	// If the hashcache doesn't yet has the sighash midstate for this
-	// transaction, then we'll compute them now so we can re-use them
-	// amongst all worker validation goroutines.
-	if segwitActive && tx.MsgTx().HasWitness() &&
-		!hashCache.ContainsHashes(tx.Hash()) {
-		hashCache.AddSigHashes(tx.MsgTx())
-	}
-
-	var cachedHashes *txscript.TxSigHashes
 	if segwitActive && tx.MsgTx().HasWitness() {
-		// The same pointer to the transaction's sighash midstate will
-		// be re-used amongst all validation goroutines. By
-		// pre-computing the sighash here instead of during validation,
-		// we ensure the sighashes
-		// are only computed once.
-		cachedHashes, _ = hashCache.GetSigHashes(tx.Hash())
+		cachedHashes = newTxSigHashes(tx, hashCache)
 	}
 
 	// Collect all of the transaction inputs and required information for
@@ -239,7 +380,7 @@ func ValidateTransactionScripts(tx *hdfutil.Tx, utxoView *UtxoViewpoint,
 }
 
 // checkBlockScripts executes and validates the scripts for all transactions in
-// the passed block using multiple goroutines.
+// the passed block using the shared script validation pool.
 func checkBlockScripts(block *hdfutil.Block, utxoView *UtxoViewpoint,
 	scriptFlags txscript.ScriptFlags, sigCache *txscript.SigCache,
 	hashCache *txscript.HashCache) error {
@@ -256,26 +397,14 @@ func checkBlockScripts(block *hdfutil.Block, utxoView *UtxoViewpoint,
 	}
 	txValItems := make([]*txValidateItem, 0, numInputs)
 	for _, tx := range block.Transactions() {
-		hash := tx.Hash()
-
-		// If the HashCache is present, and it doesn't yet contain the
-		// partial sighashes for this transaction, then we add the
-		// sighashes for the transaction. This allows us to take
-		// advantage of the potential speed savings due to the new
-		// digest algorithm (BIP0143).
-		if segwitActive && tx.HasWitness() && hashCache != nil &&
-			!hashCache.ContainsHashes(hash) {
-
-			hashCache.AddSigHashes(tx.MsgTx())
-		}
-
-		var cachedHashes *txscript.TxSigHashes
+		// The sighash midstate of the transaction is computed by the
+		// first worker which needs it and shared by all of its inputs.
+		// When the HashCache is present, the midstate is added to it
+		// which allows us to take advantage of the potential speed
+		// savings due to the new digest algorithm (BIP0143).
+		var cachedHashes *txSigHashes
 		if segwitActive && tx.HasWitness() {
-			if hashCache != nil {
-				cachedHashes, _ = hashCache.GetSigHashes(hash)
-			} else {
-				cachedHashes = txscript.NewTxSigHashes(tx.MsgTx())
-			}
+			cachedHashes = newTxSigHashes(tx, hashCache)
 		}
 
 		for txInIdx, txIn := range tx.MsgTx().TxIn {
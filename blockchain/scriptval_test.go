@@ -47,3 +47,32 @@ func TestCheckBlockScripts(t *testing.T) {
 		return
 	}
 }
+
+// BenchmarkCheckBlockScripts benchmarks validating all of the scripts in a
+// known-good mainnet block using the shared script validation pool.
+func BenchmarkCheckBlockScripts(b *testing.B) {
+	testBlockNum := 277647
+	blockDataFile := fmt.Sprintf("%d.dat.bz2", testBlockNum)
+	blocks, err := loadBlocks(blockDataFile)
+	if err != nil {
+		b.Fatalf("Error loading file: %v", err)
+	}
+	if len(blocks) != 1 {
+		b.Fatalf("The test block file must have exactly one block in it")
+	}
+
+	storeDataFile := fmt.Sprintf("%d.utxostore.bz2", testBlockNum)
+	view, err := loadUtxoView(storeDataFile)
+	if err != nil {
+		b.Fatalf("Error loading txstore: %v", err)
+	}
+
+	scriptFlags := txscript.ScriptBip16
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := checkBlockScripts(blocks[0], view, scriptFlags, nil, nil)
+		if err != nil {
+			b.Fatalf("Transaction script validation failed: %v", err)
+		}
+	}
+}
@@ -286,6 +286,114 @@ func (b *BlockChain) IsDeploymentActive(deploymentID uint32) (bool, error) {
 	return state == ThresholdActive, nil
 }
 
+// DeploymentStats houses the signalling statistics of a deployment over the
+// rule change confirmation window the next block belongs to.
+type DeploymentStats struct {
+	// Period is the number of blocks in each confirmation window.
+	Period uint32
+
+	// Threshold is the number of blocks within a window which must signal
+	// for the deployment in order for it to lock in.
+	Threshold uint32
+
+	// Elapsed is the number of blocks of the window already in the chain.
+	Elapsed uint32
+
+	// Count is the number of blocks of the window already in the chain
+	// which signal for the deployment.
+	Count uint32
+
+	// Possible is whether or not the deployment can still lock in at the
+	// end of the window.
+	Possible bool
+}
+
+// DeploymentStatus houses details about the current state of a rule change
+// deployment as of the block AFTER the end of the current best chain.
+type DeploymentStatus struct {
+	// State is the threshold state of the deployment.
+	State ThresholdState
+
+	// Since is the height of the first block with the current state.
+	Since int32
+
+	// Stats houses the signalling statistics for the current window.  It
+	// is only set while the deployment is in the ThresholdStarted state.
+	Stats *DeploymentStats
+}
+
+// DeploymentStatus returns the current threshold state of the given deployment
+// ID for the block AFTER the end of the current best chain along with the
+// height since when it has been in that state and, while it is being voted on,
+// the signalling statistics of the current confirmation window.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) DeploymentStatus(deploymentID uint32) (*DeploymentStatus, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	if deploymentID >= uint32(len(b.chainParams.Deployments)) {
+		return nil, DeploymentError(deploymentID)
+	}
+
+	prevNode := b.bestChain.Tip()
+	state, err := b.deploymentState(prevNode, deploymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The state is the same for all blocks within a confirmation window,
+	// so step back through the previous windows until the state differs
+	// in order to find the first block with the current state.
+	window := b.chainParams.MinerConfirmationWindow
+	windowStart := (prevNode.height + 1) - (prevNode.height+1)%int32(window)
+	since := windowStart
+	windowEnd := prevNode.Ancestor(windowStart - 1)
+	for windowEnd != nil {
+		prevWindowEnd := windowEnd.RelativeAncestor(int32(window))
+		prevState, err := b.deploymentState(prevWindowEnd, deploymentID)
+		if err != nil {
+			return nil, err
+		}
+		if prevState != state {
+			break
+		}
+		since -= int32(window)
+		windowEnd = prevWindowEnd
+	}
+
+	status := &DeploymentStatus{State: state, Since: since}
+	if state != ThresholdStarted {
+		return status, nil
+	}
+
+	// Count the blocks of the current window that signal for the
+	// deployment.
+	deployment := &b.chainParams.Deployments[deploymentID]
+	checker := deploymentChecker{deployment: deployment, chain: b}
+	stats := &DeploymentStats{
+		Period:    window,
+		Threshold: checker.RuleChangeActivationThreshold(),
+		Elapsed:   uint32(prevNode.height + 1 - windowStart),
+	}
+	for node := prevNode; node != nil && node.height >= windowStart; {
+		condition, err := checker.Condition(node)
+		if err != nil {
+			return nil, err
+		}
+		if condition {
+			stats.Count++
+		}
+
+		node = node.parent
+	}
+	stats.Possible = stats.Count+(stats.Period-stats.Elapsed) >=
+		stats.Threshold
+	status.Stats = stats
+
+	return status, nil
+}
+
 // deploymentState returns the current rule change threshold for a given
 // deploymentID. The threshold is evaluated from the point of view of the block
 // node passed in as the first argument to this method.
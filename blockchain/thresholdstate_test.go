@@ -5,8 +5,12 @@
 package blockchain
 
 import (
+	"math"
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/ifishnet/hdfd/chaincfg"
 	"github.com/ifishnet/hdfd/chaincfg/chainhash"
 )
 
@@ -132,3 +136,119 @@ nextTest:
 		}
 	}
 }
+
+// TestDeploymentStatus ensures the status of a deployment reports the expected
+// state, the height since when it has been in that state and the signalling
+// statistics of the current window as blocks are added to the chain.
+func TestDeploymentStatus(t *testing.T) {
+	t.Parallel()
+
+	// Use small confirmation windows and a deployment which starts voting
+	// immediately.
+	params := chaincfg.RegressionNetParams
+	params.RuleChangeActivationThreshold = 8
+	params.MinerConfirmationWindow = 10
+	params.Deployments[chaincfg.DeploymentTestDummy] =
+		chaincfg.ConsensusDeployment{
+			BitNumber:  28,
+			StartTime:  0,
+			ExpireTime: math.MaxInt64,
+		}
+	chain := newFakeChain(&params)
+
+	tests := []struct {
+		name      string
+		numBlocks int
+		signal    bool
+		state     ThresholdState
+		since     int32
+		stats     *DeploymentStats
+	}{{
+		name:  "genesis window",
+		state: ThresholdDefined,
+	}, {
+		name:      "window start",
+		numBlocks: 9,
+		state:     ThresholdStarted,
+		since:     10,
+		stats:     &DeploymentStats{10, 8, 0, 0, true},
+	}, {
+		name:      "signalling blocks",
+		numBlocks: 5,
+		signal:    true,
+		state:     ThresholdStarted,
+		since:     10,
+		stats:     &DeploymentStats{10, 8, 5, 5, true},
+	}, {
+		name:      "threshold not reached",
+		numBlocks: 5,
+		state:     ThresholdStarted,
+		since:     10,
+		stats:     &DeploymentStats{10, 8, 0, 0, true},
+	}, {
+		name:      "threshold no longer possible",
+		numBlocks: 3,
+		state:     ThresholdStarted,
+		since:     10,
+		stats:     &DeploymentStats{10, 8, 3, 0, false},
+	}, {
+		name:      "still started",
+		numBlocks: 7,
+		signal:    true,
+		state:     ThresholdStarted,
+		since:     10,
+		stats:     &DeploymentStats{10, 8, 0, 0, true},
+	}, {
+		name:      "locked in",
+		numBlocks: 10,
+		signal:    true,
+		state:     ThresholdLockedIn,
+		since:     40,
+	}, {
+		name:      "active",
+		numBlocks: 10,
+		state:     ThresholdActive,
+		since:     50,
+	}, {
+		name:      "still active",
+		numBlocks: 25,
+		state:     ThresholdActive,
+		since:     50,
+	}}
+
+	node := chain.bestChain.Tip()
+	blockTime := time.Unix(int64(node.timestamp), 0)
+	for _, test := range tests {
+		version := int32(vbTopBits)
+		if test.signal {
+			version |= 1 << 28
+		}
+		for i := 0; i < test.numBlocks; i++ {
+			blockTime = blockTime.Add(time.Second)
+			node = newFakeNode(node, version, 0, blockTime)
+			chain.index.AddNode(node)
+			chain.bestChain.SetTip(node)
+		}
+
+		status, err := chain.DeploymentStatus(chaincfg.DeploymentTestDummy)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if status.State != test.state || status.Since != test.since {
+			t.Fatalf("%s: mismatched status - got %v since %d, want "+
+				"%v since %d", test.name, status.State,
+				status.Since, test.state, test.since)
+		}
+		if !reflect.DeepEqual(status.Stats, test.stats) {
+			t.Fatalf("%s: mismatched stats - got %+v, want %+v",
+				test.name, status.Stats, test.stats)
+		}
+	}
+
+	// Ensure unknown deployments are rejected.
+	_, err := chain.DeploymentStatus(chaincfg.DefinedDeployments)
+	if _, ok := err.(DeploymentError); !ok {
+		t.Fatalf("DeploymentStatus: unexpected error for unknown "+
+			"deployment: %v", err)
+	}
+}
@@ -0,0 +1,404 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/database"
+	"github.com/ifishnet/hdfd/wire"
+	"github.com/ifishnet/hdfutil"
+)
+
+const (
+	// baseUtxoCacheEntrySize is the approximate number of bytes each entry
+	// in the utxo cache takes excluding its public key script.  It accounts
+	// for the outpoint key, the pointer to and fields of the entry, and the
+	// overhead of the map.
+	baseUtxoCacheEntrySize = chainhash.HashSize + 4 + 8 + 40 + 16
+
+	// utxoFlushPeriodicInterval is the max amount of time modifications to
+	// the utxo set are held in the utxo cache before they are flushed to
+	// the database.  It limits the number of blocks that have to be
+	// replayed on startup after an unclean shutdown.
+	utxoFlushPeriodicInterval = 10 * time.Minute
+)
+
+// utxoCacheEntrySize returns the approximate number of bytes the passed entry
+// takes in the utxo cache.
+func utxoCacheEntrySize(entry *UtxoEntry) uint64 {
+	return baseUtxoCacheEntrySize + uint64(len(entry.pkScript))
+}
+
+// cloneUnmodified returns a shallow copy of the utxo entry which is marked as
+// unmodified.
+func (entry *UtxoEntry) cloneUnmodified() *UtxoEntry {
+	clone := entry.Clone()
+	clone.packedFlags &^= tfModified
+	return clone
+}
+
+// dbPutUtxoStateConsistency uses an existing database transaction to store the
+// hash of the block the utxo set in the database is consistent with.
+func dbPutUtxoStateConsistency(dbTx database.Tx, hash *chainhash.Hash) error {
+	return dbTx.Metadata().Put(utxoStateConsistencyKeyName, hash[:])
+}
+
+// dbFetchUtxoStateConsistency uses an existing database transaction to load the
+// hash of the block the utxo set in the database is consistent with.  Nil is
+// returned for both the hash and the error when it has not been stored yet.
+func dbFetchUtxoStateConsistency(dbTx database.Tx) (*chainhash.Hash, error) {
+	serialized := dbTx.Metadata().Get(utxoStateConsistencyKeyName)
+	if serialized == nil {
+		return nil, nil
+	}
+	if len(serialized) != chainhash.HashSize {
+		return nil, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt utxo state consistency",
+		}
+	}
+
+	var hash chainhash.Hash
+	copy(hash[:], serialized)
+	return &hash, nil
+}
+
+// utxoCache houses unspent transaction outputs from the point of view of the
+// end of the main chain in memory so connecting blocks does not require a
+// database round trip for every output they spend and create.
+//
+// The modifications made by connected blocks are held in the cache and written
+// to the database in batches, either when the cache exceeds its max size, in
+// which case it is also emptied, or once the periodic flush interval has
+// elapsed.  Spent outputs are kept as modified entries until they have been
+// removed from the database.  Along with the modifications, the hash of the
+// block the utxo set is then consistent with is stored so the blocks connected
+// since the last flush can be replayed on startup after an unclean shutdown.
+type utxoCache struct {
+	db      database.DB
+	maxSize uint64
+
+	// The following fields are protected by the mutex.  All modifications
+	// additionally require the chain state lock to be held for writes.
+	mtx         sync.Mutex
+	entries     map[wire.OutPoint]*UtxoEntry
+	totalSize   uint64
+	bestHash    chainhash.Hash
+	flushedHash chainhash.Hash
+	lastFlush   time.Time
+}
+
+// newUtxoCache returns a new empty utxo cache backed by the passed database
+// which is flushed and emptied once it exceeds the provided max size in bytes.
+func newUtxoCache(db database.DB, maxSize uint64) *utxoCache {
+	return &utxoCache{
+		db:        db,
+		maxSize:   maxSize,
+		entries:   make(map[wire.OutPoint]*UtxoEntry),
+		lastFlush: time.Now(),
+	}
+}
+
+// reset empties the cache and marks the utxo set in the database as consistent
+// with the block with the passed hash.
+func (c *utxoCache) reset(hash *chainhash.Hash) {
+	c.mtx.Lock()
+	c.entries = make(map[wire.OutPoint]*UtxoEntry)
+	c.totalSize = 0
+	c.bestHash = *hash
+	c.flushedHash = *hash
+	c.lastFlush = time.Now()
+	c.mtx.Unlock()
+}
+
+// fetchEntries loads the entries for the provided outpoints into the passed
+// view from the cache and falls back to the database for the ones which are not
+// cached.  The entries loaded from the database are added to the cache.  Spent
+// outputs, or those which otherwise don't exist, result in a nil entry in the
+// view.
+//
+// This function is safe for concurrent access.
+func (c *utxoCache) fetchEntries(view *UtxoViewpoint, outpoints map[wire.OutPoint]struct{}) error {
+	var missing []wire.OutPoint
+	c.mtx.Lock()
+	for outpoint := range outpoints {
+		entry, ok := c.entries[outpoint]
+		switch {
+		case !ok:
+			missing = append(missing, outpoint)
+		case entry.IsSpent():
+			view.entries[outpoint] = nil
+		default:
+			view.entries[outpoint] = entry.cloneUnmodified()
+		}
+	}
+	c.mtx.Unlock()
+	if len(missing) == 0 {
+		return nil
+	}
+
+	// NOTE: Outputs which are not cached are not modified in the cache, so
+	// the database is up to date for them even when it is being flushed
+	// concurrently.
+	loaded := make([]*UtxoEntry, len(missing))
+	err := c.db.View(func(dbTx database.Tx) error {
+		for i, outpoint := range missing {
+			entry, err := dbFetchUtxoEntry(dbTx, outpoint)
+			if err != nil {
+				return err
+			}
+			loaded[i] = entry
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.mtx.Lock()
+	for i, outpoint := range missing {
+		entry := loaded[i]
+		view.entries[outpoint] = entry
+		if entry == nil {
+			continue
+		}
+		if _, ok := c.entries[outpoint]; !ok {
+			c.entries[outpoint] = entry.Clone()
+			c.totalSize += utxoCacheEntrySize(entry)
+		}
+	}
+	c.mtx.Unlock()
+	return nil
+}
+
+// commit applies the modified entries in the passed view to the cache without
+// writing them to the database and marks the cache as being from the point of
+// view of the best hash of the view.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (c *utxoCache) commit(view *UtxoViewpoint) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for outpoint, entry := range view.entries {
+		if entry == nil || !entry.isModified() {
+			continue
+		}
+
+		if cached, ok := c.entries[outpoint]; ok {
+			c.totalSize -= utxoCacheEntrySize(cached)
+		}
+
+		// The public key script of spent outputs is not needed to
+		// remove them from the database.
+		cached := &UtxoEntry{packedFlags: tfSpent | tfModified}
+		if !entry.IsSpent() {
+			cached = entry.Clone()
+		}
+		c.entries[outpoint] = cached
+		c.totalSize += utxoCacheEntrySize(cached)
+	}
+	c.bestHash = view.bestHash
+}
+
+// flush writes all modified entries in the cache to the database along with the
+// hash of the block the utxo set is then consistent with.  Spent entries are
+// removed from the cache while the others are marked unmodified, unless clear
+// is set, in which case all entries are removed.
+//
+// This function is safe for concurrent access.
+func (c *utxoCache) flush(clear bool) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.bestHash != c.flushedHash {
+		// Store a copy of the best hash since the database requires the
+		// stored value to remain unmodified while the cache updates it
+		// as blocks are connected.
+		bestHash := c.bestHash
+		err := c.db.Update(func(dbTx database.Tx) error {
+			err := dbPutUtxoView(dbTx, &UtxoViewpoint{entries: c.entries})
+			if err != nil {
+				return err
+			}
+			return dbPutUtxoStateConsistency(dbTx, &bestHash)
+		})
+		if err != nil {
+			return err
+		}
+
+		for outpoint, entry := range c.entries {
+			if !entry.isModified() {
+				continue
+			}
+			if entry.IsSpent() {
+				c.totalSize -= utxoCacheEntrySize(entry)
+				delete(c.entries, outpoint)
+				continue
+			}
+			entry.packedFlags &^= tfModified
+		}
+		c.flushedHash = c.bestHash
+
+		log.Debugf("Flushed the utxo cache to the database at block %v",
+			c.bestHash)
+	}
+
+	if clear {
+		c.entries = make(map[wire.OutPoint]*UtxoEntry)
+		c.totalSize = 0
+	}
+	c.lastFlush = time.Now()
+	return nil
+}
+
+// maybeFlush flushes and empties the cache when it exceeds its max size or only
+// flushes it when the periodic flush interval has elapsed since the last flush.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (c *utxoCache) maybeFlush() error {
+	c.mtx.Lock()
+	totalSize, lastFlush := c.totalSize, c.lastFlush
+	c.mtx.Unlock()
+
+	switch {
+	case totalSize > c.maxSize:
+		return c.flush(true)
+	case time.Since(lastFlush) >= utxoFlushPeriodicInterval:
+		return c.flush(false)
+	}
+	return nil
+}
+
+// updateFlushed updates the cache to reflect the modified entries in the passed
+// view which have been written directly to the database along with the best
+// hash of the view as the block the utxo set is consistent with.
+//
+// The cache MUST NOT have any modifications which have not been flushed.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (c *utxoCache) updateFlushed(view *UtxoViewpoint) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for outpoint, entry := range view.entries {
+		if entry == nil || !entry.isModified() {
+			continue
+		}
+
+		if cached, ok := c.entries[outpoint]; ok {
+			c.totalSize -= utxoCacheEntrySize(cached)
+			delete(c.entries, outpoint)
+		}
+		if !entry.IsSpent() {
+			c.entries[outpoint] = entry.cloneUnmodified()
+			c.totalSize += utxoCacheEntrySize(entry)
+		}
+	}
+	c.bestHash = view.bestHash
+	c.flushedHash = view.bestHash
+}
+
+// consistentHash returns the hash of the block the utxo set in the database is
+// consistent with.
+//
+// This function is safe for concurrent access.
+func (c *utxoCache) consistentHash() chainhash.Hash {
+	c.mtx.Lock()
+	hash := c.flushedHash
+	c.mtx.Unlock()
+	return hash
+}
+
+// initUtxoCache initializes the utxo cache from the hash of the block the utxo
+// set in the database is consistent with.  The blocks connected since then,
+// which is only the case after an unclean shutdown, are replayed to bring the
+// utxo set up to date with the best chain.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) initUtxoCache() error {
+	tip := b.bestChain.Tip()
+	var consistentHash *chainhash.Hash
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		consistentHash, err = dbFetchUtxoStateConsistency(dbTx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// The utxo set of databases created prior to the introduction of the
+	// utxo cache is always consistent with the best chain.
+	if consistentHash == nil {
+		err := b.db.Update(func(dbTx database.Tx) error {
+			return dbPutUtxoStateConsistency(dbTx, &tip.hash)
+		})
+		if err != nil {
+			return err
+		}
+		consistentHash = &tip.hash
+	}
+	b.utxoCache.reset(consistentHash)
+	if *consistentHash == tip.hash {
+		return nil
+	}
+
+	node := b.index.LookupNode(consistentHash)
+	if node == nil || !b.bestChain.Contains(node) {
+		return AssertError(fmt.Sprintf("utxo set is consistent with "+
+			"block %v which is not in the main chain", consistentHash))
+	}
+
+	log.Infof("Replaying %d blocks to bring the utxo set up to date with "+
+		"the best chain", tip.height-node.height)
+	for node = b.bestChain.Next(node); node != nil; node = b.bestChain.Next(node) {
+		if interruptRequested(b.interrupt) {
+			return errInterruptRequested
+		}
+
+		var block *hdfutil.Block
+		err := b.db.View(func(dbTx database.Tx) error {
+			var err error
+			block, err = dbFetchBlockByNode(dbTx, node)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		view := NewUtxoViewpoint()
+		view.SetBestHash(&node.parent.hash)
+		if err := view.fetchInputUtxos(b.utxoCache, block); err != nil {
+			return err
+		}
+		if err := view.connectTransactions(block, nil); err != nil {
+			return err
+		}
+		b.utxoCache.commit(view)
+		if err := b.utxoCache.maybeFlush(); err != nil {
+			return err
+		}
+	}
+
+	return b.utxoCache.flush(false)
+}
+
+// FlushUtxoCache writes all modifications to the utxo set which are held in
+// memory to the database.  It should be called prior to shutting down so the
+// blocks connected since the last flush don't have to be replayed on the next
+// startup.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FlushUtxoCache() error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	return b.utxoCache.flush(false)
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/database"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// TestUtxoCache ensures the modifications made to the utxo set by connected
+// blocks are held in the utxo cache until it is flushed and that the blocks
+// connected since the last flush are replayed after an unclean shutdown.
+func TestUtxoCache(t *testing.T) {
+	blocks, err := loadBlocks("blk_0_to_4.dat.bz2")
+	if err != nil {
+		t.Fatalf("Error loading file: %v\n", err)
+	}
+
+	// Create a new database and chain instance to run tests against.
+	chain, teardownFunc, err := chainSetup("utxocache",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Since we're not dealing with the real block chain, set the coinbase
+	// maturity to 1.
+	chain.TstSetCoinbaseMaturity(1)
+
+	// Use a cache which is large enough to never be flushed due to its
+	// size.
+	const maxSize = 1 << 30
+	chain.utxoCache = newUtxoCache(chain.db, maxSize)
+	chain.utxoCache.reset(&chain.bestChain.Tip().hash)
+
+	// fetchDB returns the hash of the block the utxo set in the database is
+	// consistent with along with the entry for the coinbase output of the
+	// block at the passed index from the database.
+	fetchDB := func(blockIdx int) (*chainhash.Hash, *UtxoEntry) {
+		t.Helper()
+		outpoint := wire.OutPoint{
+			Hash: *blocks[blockIdx].Transactions()[0].Hash(),
+		}
+		var hash *chainhash.Hash
+		var entry *UtxoEntry
+		err := chain.db.View(func(dbTx database.Tx) error {
+			var err error
+			hash, err = dbFetchUtxoStateConsistency(dbTx)
+			if err != nil {
+				return err
+			}
+			entry, err = dbFetchUtxoEntry(dbTx, outpoint)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Unable to fetch from database: %v", err)
+		}
+		return hash, entry
+	}
+
+	processBlocks := func(start, end int) {
+		t.Helper()
+		for i := start; i <= end; i++ {
+			_, _, err := chain.ProcessBlock(blocks[i], BFNone)
+			if err != nil {
+				t.Fatalf("ProcessBlock fail on block %d: %v\n", i,
+					err)
+			}
+		}
+	}
+
+	// Ensure the modifications are only held in the cache after connecting
+	// blocks while they are available from the point of view of the end of
+	// the main chain.
+	processBlocks(1, 2)
+	hash, entry := fetchDB(2)
+	if hash == nil || *hash != *blocks[0].Hash() {
+		t.Fatalf("unexpected consistent hash - got %v, want %v", hash,
+			blocks[0].Hash())
+	}
+	if entry != nil {
+		t.Fatal("coinbase output of block 2 unexpectedly in database")
+	}
+	outpoint := wire.OutPoint{Hash: *blocks[2].Transactions()[0].Hash()}
+	entry, err = chain.FetchUtxoEntry(outpoint)
+	if err != nil {
+		t.Fatalf("FetchUtxoEntry: unexpected error: %v", err)
+	}
+	if entry == nil || entry.BlockHeight() != 2 || !entry.IsCoinBase() {
+		t.Fatalf("FetchUtxoEntry: unexpected entry %+v", entry)
+	}
+
+	// Ensure flushing writes the modifications to the database.
+	if err := chain.FlushUtxoCache(); err != nil {
+		t.Fatalf("FlushUtxoCache: unexpected error: %v", err)
+	}
+	hash, entry = fetchDB(2)
+	if hash == nil || *hash != *blocks[2].Hash() {
+		t.Fatalf("unexpected consistent hash - got %v, want %v", hash,
+			blocks[2].Hash())
+	}
+	if entry == nil {
+		t.Fatal("coinbase output of block 2 not in database")
+	}
+
+	// Simulate an unclean shutdown by discarding the cache after connecting
+	// more blocks and ensure they are replayed.
+	processBlocks(3, 4)
+	if hash, _ := fetchDB(4); hash == nil || *hash != *blocks[2].Hash() {
+		t.Fatalf("unexpected consistent hash - got %v, want %v", hash,
+			blocks[2].Hash())
+	}
+	chain.utxoCache = newUtxoCache(chain.db, maxSize)
+	chain.chainLock.Lock()
+	err = chain.initUtxoCache()
+	chain.chainLock.Unlock()
+	if err != nil {
+		t.Fatalf("initUtxoCache: unexpected error: %v", err)
+	}
+	hash, entry = fetchDB(4)
+	if hash == nil || *hash != *blocks[4].Hash() {
+		t.Fatalf("unexpected consistent hash - got %v, want %v", hash,
+			blocks[4].Hash())
+	}
+	if entry == nil || entry.BlockHeight() != 4 {
+		t.Fatalf("unexpected replayed entry %+v", entry)
+	}
+
+	// Ensure exceeding the max size flushes and empties the cache.
+	chain.utxoCache.maxSize = 0
+	_, err = chain.FetchUtxoView(blocks[4].Transactions()[0])
+	if err != nil {
+		t.Fatalf("FetchUtxoView: unexpected error: %v", err)
+	}
+	if len(chain.utxoCache.entries) == 0 {
+		t.Fatal("fetched entries not added to the cache")
+	}
+	chain.chainLock.Lock()
+	err = chain.utxoCache.maybeFlush()
+	chain.chainLock.Unlock()
+	if err != nil {
+		t.Fatalf("maybeFlush: unexpected error: %v", err)
+	}
+	if len(chain.utxoCache.entries) != 0 {
+		t.Fatalf("cache not emptied - %d entries remain",
+			len(chain.utxoCache.entries))
+	}
+}
@@ -206,12 +206,14 @@ func CheckTransactionSanity(tx *hdfutil.Tx) error {
 	// A transaction must have at least one input.
 	msgTx := tx.MsgTx()
 	if len(msgTx.TxIn) == 0 {
-		return ruleError(ErrNoTxInputs, "transaction has no inputs")
+		return txRuleError(ErrNoTxInputs, "transaction has no inputs",
+			tx.Hash())
 	}
 
 	// A transaction must have at least one output.
 	if len(msgTx.TxOut) == 0 {
-		return ruleError(ErrNoTxOutputs, "transaction has no outputs")
+		return txRuleError(ErrNoTxOutputs, "transaction has no outputs",
+			tx.Hash())
 	}
 
 	// A transaction must not exceed the maximum allowed block payload when
@@ -220,7 +222,7 @@ func CheckTransactionSanity(tx *hdfutil.Tx) error {
 	if serializedTxSize > MaxBlockBaseSize {
 		str := fmt.Sprintf("serialized transaction is too big - got "+
 			"%d, max %d", serializedTxSize, MaxBlockBaseSize)
-		return ruleError(ErrTxTooBig, str)
+		return txRuleError(ErrTxTooBig, str, tx.Hash())
 	}
 
 	// Ensure the transaction amounts are in range.  Each transaction
@@ -235,13 +237,13 @@ func CheckTransactionSanity(tx *hdfutil.Tx) error {
 		if satoshi < 0 {
 			str := fmt.Sprintf("transaction output has negative "+
 				"value of %v", satoshi)
-			return ruleError(ErrBadTxOutValue, str)
+			return txRuleError(ErrBadTxOutValue, str, tx.Hash())
 		}
 		if satoshi > hdfutil.MaxSatoshi {
 			str := fmt.Sprintf("transaction output value of %v is "+
 				"higher than max allowed value of %v", satoshi,
 				hdfutil.MaxSatoshi)
-			return ruleError(ErrBadTxOutValue, str)
+			return txRuleError(ErrBadTxOutValue, str, tx.Hash())
 		}
 
 		// Two's complement int64 overflow guarantees that any overflow
@@ -252,23 +254,23 @@ func CheckTransactionSanity(tx *hdfutil.Tx) error {
 			str := fmt.Sprintf("total value of all transaction "+
 				"outputs exceeds max allowed value of %v",
 				hdfutil.MaxSatoshi)
-			return ruleError(ErrBadTxOutValue, str)
+			return txRuleError(ErrBadTxOutValue, str, tx.Hash())
 		}
 		if totalSatoshi > hdfutil.MaxSatoshi {
 			str := fmt.Sprintf("total value of all transaction "+
 				"outputs is %v which is higher than max "+
 				"allowed value of %v", totalSatoshi,
 				hdfutil.MaxSatoshi)
-			return ruleError(ErrBadTxOutValue, str)
+			return txRuleError(ErrBadTxOutValue, str, tx.Hash())
 		}
 	}
 
 	// Check for duplicate transaction inputs.
 	existingTxOut := make(map[wire.OutPoint]struct{})
-	for _, txIn := range msgTx.TxIn {
+	for txInIndex, txIn := range msgTx.TxIn {
 		if _, exists := existingTxOut[txIn.PreviousOutPoint]; exists {
-			return ruleError(ErrDuplicateTxInputs, "transaction "+
-				"contains duplicate inputs")
+			return inputRuleError(ErrDuplicateTxInputs, "transaction "+
+				"contains duplicate inputs", tx.Hash(), txInIndex)
 		}
 		existingTxOut[txIn.PreviousOutPoint] = struct{}{}
 	}
@@ -280,16 +282,16 @@ func CheckTransactionSanity(tx *hdfutil.Tx) error {
 			str := fmt.Sprintf("coinbase transaction script length "+
 				"of %d is out of range (min: %d, max: %d)",
 				slen, MinCoinbaseScriptLen, MaxCoinbaseScriptLen)
-			return ruleError(ErrBadCoinbaseScriptLen, str)
+			return txRuleError(ErrBadCoinbaseScriptLen, str, tx.Hash())
 		}
 	} else {
 		// Previous transaction outputs referenced by the inputs to this
 		// transaction must not be null.
-		for _, txIn := range msgTx.TxIn {
+		for txInIndex, txIn := range msgTx.TxIn {
 			if isNullOutpoint(&txIn.PreviousOutPoint) {
-				return ruleError(ErrBadTxInput, "transaction "+
+				return inputRuleError(ErrBadTxInput, "transaction "+
 					"input refers to previous output that "+
-					"is null")
+					"is null", tx.Hash(), txInIndex)
 			}
 		}
 	}
@@ -390,7 +392,8 @@ func CountP2SHSigOps(tx *hdfutil.Tx, isCoinBaseTx bool, utxoView *UtxoViewpoint)
 				"transaction %s:%d either does not exist or "+
 				"has already been spent", txIn.PreviousOutPoint,
 				tx.Hash(), txInIndex)
-			return 0, ruleError(ErrMissingTxOut, str)
+			return 0, inputRuleError(ErrMissingTxOut, str, tx.Hash(),
+				txInIndex)
 		}
 
 		// We're only interested in pay-to-script-hash types, so skip
@@ -414,7 +417,8 @@ func CountP2SHSigOps(tx *hdfutil.Tx, isCoinBaseTx bool, utxoView *UtxoViewpoint)
 			str := fmt.Sprintf("the public key script from output "+
 				"%v contains too many signature operations - "+
 				"overflow", txIn.PreviousOutPoint)
-			return 0, ruleError(ErrTooManySigOps, str)
+			return 0, inputRuleError(ErrTooManySigOps, str,
+				tx.Hash(), txInIndex)
 		}
 	}
 
@@ -545,7 +549,7 @@ func checkBlockSanity(block *hdfutil.Block, powLimit *big.Int, timeSource Median
 		if _, exists := existingTxHashes[*hash]; exists {
 			str := fmt.Sprintf("block contains duplicate "+
 				"transaction %v", hash)
-			return ruleError(ErrDuplicateTx, str)
+			return txRuleError(ErrDuplicateTx, str, hash)
 		}
 		existingTxHashes[*hash] = struct{}{}
 	}
@@ -685,17 +689,49 @@ func (b *BlockChain) checkBlockHeaderContext(header *wire.BlockHeader, prevNode
 	// chain before it.  This prevents storage of new, otherwise valid,
 	// blocks which build off of old blocks that are likely at a much easier
 	// difficulty and therefore could be used to waste cache and disk space.
+	// Blocks that are ancestors of the checkpoint, such as those in the
+	// historical chain leading up to a loaded utxo snapshot, don't fork it.
 	checkpointNode, err := b.findPreviousCheckpoint()
 	if err != nil {
 		return err
 	}
-	if checkpointNode != nil && blockHeight < checkpointNode.height {
+	if checkpointNode != nil && blockHeight < checkpointNode.height &&
+		checkpointNode.Ancestor(blockHeight).hash != blockHash {
+
 		str := fmt.Sprintf("block at height %d forks the main chain "+
 			"before the previous checkpoint at height %d",
 			blockHeight, checkpointNode.height)
 		return ruleError(ErrForkTooOld, str)
 	}
 
+	// Ensure the chain matches the block whose ancestors are assumed to
+	// have valid scripts.
+	if !b.verifyAssumeValid(blockHeight, &blockHash) {
+		str := fmt.Sprintf("block at height %d does not match the "+
+			"assumed valid block hash", blockHeight)
+		return ruleError(ErrBadAssumeValid, str)
+	}
+
+	// Prevent blocks which fork the main chain at a block with less than
+	// the minimum chain work once the main chain has at least that much
+	// work.  Much like the checkpoint check above, this prevents storage of
+	// blocks building off of old blocks at a much easier difficulty without
+	// requiring checkpoints.  Blocks that are part of the main chain, such
+	// as those in the historical chain leading up to a loaded utxo
+	// snapshot, don't fork it.
+	if b.minimumChainWork != nil && b.hasMinimumChainWork(b.bestChain.Tip()) {
+		forkNode := b.bestChain.FindFork(prevNode)
+		mainNode := b.bestChain.NodeByHeight(blockHeight)
+		forks := forkNode != prevNode ||
+			(mainNode != nil && mainNode.hash != blockHash)
+		if forks && !b.hasMinimumChainWork(forkNode) {
+			str := fmt.Sprintf("block at height %d forks the main "+
+				"chain at height %d which has less than the "+
+				"minimum chain work", blockHeight, forkNode.height)
+			return ruleError(ErrForkTooLowWork, str)
+		}
+	}
+
 	// Reject outdated block versions once a majority of the network
 	// has upgraded.  These were originally voted on by BIP0034,
 	// BIP0065, and BIP0066.
@@ -712,6 +748,61 @@ func (b *BlockChain) checkBlockHeaderContext(header *wire.BlockHeader, prevNode
 	return nil
 }
 
+// CheckBlockHeaderSanity performs some preliminary checks on a block header to
+// ensure it is sane.  These checks are context free.
+//
+// It is exported for callers which only validate headers, such as those which
+// sync the headers of the chain without downloading its blocks.
+func CheckBlockHeaderSanity(header *wire.BlockHeader, powLimit *big.Int,
+	timeSource MedianTimeSource, flags BehaviorFlags) error {
+
+	return checkBlockHeaderSanity(header, powLimit, timeSource, flags)
+}
+
+// CheckBlockHeaderContext performs the validation checks on the block header
+// which only depend on the headers of the chain it extends, as described by
+// the passed context of the previous block.  That is, the difficulty must match
+// the required difficulty, the timestamp must be after the median time of the
+// previous blocks, and the version must not be outdated.
+//
+// Unlike the checks performed when blocks are processed, the header is not
+// compared against checkpoints or the assumed valid block since they are
+// specific to a BlockChain instance, so callers are expected to do so.
+func CheckBlockHeaderContext(header *wire.BlockHeader, prevNode HeaderCtx,
+	c ChainCtx) error {
+
+	expectedDifficulty, err := CalcNextRequiredDifficulty(prevNode,
+		header.Timestamp, c)
+	if err != nil {
+		return err
+	}
+	if header.Bits != expectedDifficulty {
+		str := "block difficulty of %d is not the expected value of %d"
+		str = fmt.Sprintf(str, header.Bits, expectedDifficulty)
+		return ruleError(ErrUnexpectedDifficulty, str)
+	}
+
+	medianTime := CalcPastMedianTime(prevNode)
+	if !header.Timestamp.After(medianTime) {
+		str := "block timestamp of %v is not after expected %v"
+		str = fmt.Sprintf(str, header.Timestamp, medianTime)
+		return ruleError(ErrTimeTooOld, str)
+	}
+
+	blockHeight := prevNode.Height() + 1
+	params := c.ChainParams()
+	if header.Version < 2 && blockHeight >= params.BIP0034Height ||
+		header.Version < 3 && blockHeight >= params.BIP0066Height ||
+		header.Version < 4 && blockHeight >= params.BIP0065Height {
+
+		str := "new blocks with version %d are no longer valid"
+		str = fmt.Sprintf(str, header.Version)
+		return ruleError(ErrBlockVersionTooOld, str)
+	}
+
+	return nil
+}
+
 // checkBlockContext peforms several validation checks on the block which depend
 // on its position within the block chain.
 //
@@ -760,7 +851,8 @@ func (b *BlockChain) checkBlockContext(block *hdfutil.Block, prevNode *blockNode
 
 				str := fmt.Sprintf("block contains unfinalized "+
 					"transaction %v", tx.Hash())
-				return ruleError(ErrUnfinalizedTx, str)
+				return txRuleError(ErrUnfinalizedTx, str,
+					tx.Hash())
 			}
 		}
 
@@ -840,7 +932,7 @@ func (b *BlockChain) checkBIP0030(node *blockNode, block *hdfutil.Block, view *U
 			fetchSet[prevOut] = struct{}{}
 		}
 	}
-	err := view.fetchUtxos(b.db, fetchSet)
+	err := view.fetchUtxos(b.utxoCache, fetchSet)
 	if err != nil {
 		return err
 	}
@@ -853,7 +945,7 @@ func (b *BlockChain) checkBIP0030(node *blockNode, block *hdfutil.Block, view *U
 			str := fmt.Sprintf("tried to overwrite transaction %v "+
 				"at block height %d that is not fully spent",
 				outpoint.Hash, utxo.BlockHeight())
-			return ruleError(ErrOverwriteTx, str)
+			return txRuleError(ErrOverwriteTx, str, &outpoint.Hash)
 		}
 	}
 
@@ -887,7 +979,8 @@ func CheckTransactionInputs(tx *hdfutil.Tx, txHeight int32, utxoView *UtxoViewpo
 				"transaction %s:%d either does not exist or "+
 				"has already been spent", txIn.PreviousOutPoint,
 				tx.Hash(), txInIndex)
-			return 0, ruleError(ErrMissingTxOut, str)
+			return 0, inputRuleError(ErrMissingTxOut, str, txHash,
+				txInIndex)
 		}
 
 		// Ensure the transaction is not spending coins which have not
@@ -903,7 +996,8 @@ func CheckTransactionInputs(tx *hdfutil.Tx, txHeight int32, utxoView *UtxoViewpo
 					"of %v blocks", txIn.PreviousOutPoint,
 					originHeight, txHeight,
 					coinbaseMaturity)
-				return 0, ruleError(ErrImmatureSpend, str)
+				return 0, inputRuleError(ErrImmatureSpend, str,
+					txHash, txInIndex)
 			}
 		}
 
@@ -917,14 +1011,16 @@ func CheckTransactionInputs(tx *hdfutil.Tx, txHeight int32, utxoView *UtxoViewpo
 		if originTxSatoshi < 0 {
 			str := fmt.Sprintf("transaction output has negative "+
 				"value of %v", hdfutil.Amount(originTxSatoshi))
-			return 0, ruleError(ErrBadTxOutValue, str)
+			return 0, inputRuleError(ErrBadTxOutValue, str, txHash,
+				txInIndex)
 		}
 		if originTxSatoshi > hdfutil.MaxSatoshi {
 			str := fmt.Sprintf("transaction output value of %v is "+
 				"higher than max allowed value of %v",
 				hdfutil.Amount(originTxSatoshi),
 				hdfutil.MaxSatoshi)
-			return 0, ruleError(ErrBadTxOutValue, str)
+			return 0, inputRuleError(ErrBadTxOutValue, str, txHash,
+				txInIndex)
 		}
 
 		// The total of all outputs must not be more than the max
@@ -938,7 +1034,8 @@ func CheckTransactionInputs(tx *hdfutil.Tx, txHeight int32, utxoView *UtxoViewpo
 				"inputs is %v which is higher than max "+
 				"allowed value of %v", totalSatoshiIn,
 				hdfutil.MaxSatoshi)
-			return 0, ruleError(ErrBadTxOutValue, str)
+			return 0, inputRuleError(ErrBadTxOutValue, str, txHash,
+				txInIndex)
 		}
 	}
 
@@ -955,7 +1052,7 @@ func CheckTransactionInputs(tx *hdfutil.Tx, txHeight int32, utxoView *UtxoViewpo
 		str := fmt.Sprintf("total value of all transaction inputs for "+
 			"transaction %v is %v which is less than the amount "+
 			"spent of %v", txHash, totalSatoshiIn, totalSatoshiOut)
-		return 0, ruleError(ErrSpendTooHigh, str)
+		return 0, txRuleError(ErrSpendTooHigh, str, txHash)
 	}
 
 	// NOTE: bitcoind checks if the transaction fees are < 0 here, but that
@@ -985,8 +1082,12 @@ func CheckTransactionInputs(tx *hdfutil.Tx, txHeight int32, utxoView *UtxoViewpo
 // connects to the end of the current main chain and then calls this function
 // with that node.
 //
+// The flags modify the behavior of this function as follows:
+//  - BFNoCheckpointSkip: The scripts are run even when the block is before the
+//    latest checkpoint.
+//
 // This function MUST be called with the chain state lock held (for writes).
-func (b *BlockChain) checkConnectBlock(node *blockNode, block *hdfutil.Block, view *UtxoViewpoint, stxos *[]SpentTxOut) error {
+func (b *BlockChain) checkConnectBlock(node *blockNode, block *hdfutil.Block, view *UtxoViewpoint, stxos *[]SpentTxOut, flags BehaviorFlags) error {
 	// If the side chain blocks end up in the database, a call to
 	// CheckBlockSanity should be done here in case a previous version
 	// allowed a block that is no longer valid.  However, since the
@@ -1036,7 +1137,7 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *hdfutil.Block, vi
 	//
 	// These utxo entries are needed for verification of things such as
 	// transaction inputs, counting pay-to-script-hashes, and scripts.
-	err := view.fetchInputUtxos(b.db, block)
+	err := view.fetchInputUtxos(b.utxoCache, block)
 	if err != nil {
 		return err
 	}
@@ -1045,7 +1146,7 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *hdfutil.Block, vi
 	// "standard" type.  The rules for this BIP only apply to transactions
 	// after the timestamp defined by txscript.Bip16Activation.  See
 	// https://en.bitcoin.it/wiki/BIP_0016 for more details.
-	enforceBIP0016 := node.timestamp >= txscript.Bip16Activation.Unix()
+	enforceBIP0016 := int64(node.timestamp) >= txscript.Bip16Activation.Unix()
 
 	// Query for the Version Bits state for the segwit soft-fork
 	// deployment. If segwit is active, we'll switch over to enforcing all
@@ -1085,7 +1186,7 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *hdfutil.Block, vi
 			str := fmt.Sprintf("block contains too many "+
 				"signature operations - got %v, max %v",
 				totalSigOpCost, MaxBlockSigOpsCost)
-			return ruleError(ErrTooManySigOps, str)
+			return txRuleError(ErrTooManySigOps, str, tx.Hash())
 		}
 	}
 
@@ -1146,10 +1247,17 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *hdfutil.Block, vi
 	// transactions are included in the merkle root hash and any changes
 	// will therefore be detected by the next checkpoint).  This is a huge
 	// optimization because running the scripts is the most time consuming
-	// portion of block handling.
+	// portion of block handling.  The same applies to the ancestors of the
+	// block which is assumed to have valid scripts.  Only the latter is
+	// done when the checkpoints are not allowed to skip validation.
 	checkpoint := b.LatestCheckpoint()
 	runScripts := true
-	if checkpoint != nil && node.height <= checkpoint.Height {
+	if checkpoint != nil && node.height <= checkpoint.Height &&
+		b.checkpointsSkipValidation(flags) {
+
+		runScripts = false
+	}
+	if b.isAssumedValid(node) {
 		runScripts = false
 	}
 
@@ -1207,7 +1315,8 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *hdfutil.Block, vi
 				str := fmt.Sprintf("block contains " +
 					"transaction whose input sequence " +
 					"locks are not met")
-				return ruleError(ErrUnfinalizedTx, str)
+				return txRuleError(ErrUnfinalizedTx, str,
+					tx.Hash())
 			}
 		}
 	}
@@ -1260,14 +1369,17 @@ func (b *BlockChain) CheckConnectBlockTemplate(block *hdfutil.Block) error {
 		return ruleError(ErrPrevBlockNotBest, str)
 	}
 
+	// Rule violations identify the template block and the height it would
+	// have if it were connected.
+	blockHeight := tip.height + 1
 	err := checkBlockSanity(block, b.chainParams.PowLimit, b.timeSource, flags)
 	if err != nil {
-		return err
+		return withBlockContext(err, block.Hash(), blockHeight)
 	}
 
 	err = b.checkBlockContext(block, tip, flags)
 	if err != nil {
-		return err
+		return withBlockContext(err, block.Hash(), blockHeight)
 	}
 
 	// Leave the spent txouts entry nil in the state since the information
@@ -1275,5 +1387,6 @@ func (b *BlockChain) CheckConnectBlockTemplate(block *hdfutil.Block) error {
 	view := NewUtxoViewpoint()
 	view.SetBestHash(&tip.hash)
 	newNode := newBlockNode(&header, tip)
-	return b.checkConnectBlock(newNode, block, view, nil)
+	err = b.checkConnectBlock(newNode, block, view, nil, flags)
+	return withBlockContext(err, block.Hash(), blockHeight)
 }
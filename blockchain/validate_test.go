@@ -5,6 +5,7 @@
 package blockchain
 
 import (
+	"errors"
 	"math"
 	"reflect"
 	"testing"
@@ -180,10 +181,10 @@ func TestCheckSerializedHeight(t *testing.T) {
 
 	// Expected rule errors.
 	missingHeightError := RuleError{
-		ErrorCode: ErrMissingCoinbaseHeight,
+		Err: ErrMissingCoinbaseHeight,
 	}
 	badHeightError := RuleError{
-		ErrorCode: ErrBadCoinbaseHeight,
+		Err: ErrBadCoinbaseHeight,
 	}
 
 	tests := []struct {
@@ -224,10 +225,10 @@ func TestCheckSerializedHeight(t *testing.T) {
 
 		if rerr, ok := err.(RuleError); ok {
 			trerr := test.err.(RuleError)
-			if rerr.ErrorCode != trerr.ErrorCode {
+			if !errors.Is(rerr, trerr.Err) {
 				t.Errorf("checkSerializedHeight #%d wrong "+
-					"error code got: %v, want: %v", i,
-					rerr.ErrorCode, trerr.ErrorCode)
+					"error kind got: %v, want: %v", i,
+					rerr.Err, trerr.Err)
 				continue
 			}
 		}
@@ -102,7 +102,8 @@ func GetSigOpCost(tx *hdfutil.Tx, isCoinBaseTx bool, utxoView *UtxoViewpoint, bi
 					"exist or has already been spent",
 					txIn.PreviousOutPoint, tx.Hash(),
 					txInIndex)
-				return 0, ruleError(ErrMissingTxOut, str)
+				return 0, inputRuleError(ErrMissingTxOut, str,
+					tx.Hash(), txInIndex)
 			}
 
 			witness := txIn.Witness
@@ -6,6 +6,7 @@ package chaincfg
 
 import (
 	"errors"
+	"fmt"
 	"math"
 	"math/big"
 	"strings"
@@ -52,6 +53,22 @@ type Checkpoint struct {
 	Hash   *chainhash.Hash
 }
 
+// AssumeUTXO identifies a known good snapshot of the utxo set as of a block in
+// the main chain.  Nodes are allowed to bootstrap their chain state from a utxo
+// set snapshot that matches one of these commitments, which allows them to
+// serve the tip immediately while the historical chain leading up to the
+// snapshot is validated in the background.
+//
+// The UTXOSetHash is the hash of the serialized utxo set as produced by the
+// dumptxoutset RPC and TotalTxns is the total number of transactions in the
+// main chain up to and including the snapshot block.
+type AssumeUTXO struct {
+	Height      int32
+	Hash        *chainhash.Hash
+	UTXOSetHash *chainhash.Hash
+	TotalTxns   uint64
+}
+
 // DNSSeed identifies a DNS seed.
 type DNSSeed struct {
 	// Host defines the hostname of the seed.
@@ -103,6 +120,36 @@ const (
 	DefinedDeployments
 )
 
+// deploymentNames houses the names used to refer to each of the defined
+// deployments, such as when overriding their schedule via configuration.
+var deploymentNames = [DefinedDeployments]string{
+	DeploymentTestDummy: "testdummy",
+	DeploymentCSV:       "csv",
+	DeploymentSegwit:    "segwit",
+}
+
+// DeploymentID returns the deployment ID, such as DeploymentCSV, of the
+// deployment with the provided name and whether or not the name is known.
+// Names are case insensitive.
+func DeploymentID(name string) (int, bool) {
+	name = strings.ToLower(name)
+	for id, deploymentName := range deploymentNames {
+		if name == deploymentName {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// DeploymentName returns the name of the deployment with the provided
+// deployment ID, or an empty string when it is not a defined deployment.
+func DeploymentName(deploymentID int) string {
+	if deploymentID < 0 || deploymentID >= DefinedDeployments {
+		return ""
+	}
+	return deploymentNames[deploymentID]
+}
+
 // Params defines a Bitcoin network by its parameters.  These parameters may be
 // used by Bitcoin applications to differentiate networks as well as addresses
 // and keys for one network from those intended for use on another network.
@@ -181,6 +228,27 @@ type Params struct {
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints []Checkpoint
 
+	// MinimumChainWork is the minimum cumulative work the main chain is
+	// known to have.  The chain is not considered current until its best
+	// chain has at least this much work and, once it does, blocks which
+	// fork the best chain at a block with less work are rejected.  This
+	// protects against low-work chains without requiring checkpoints.
+	//
+	// It can be nil to disable the checks.
+	MinimumChainWork *big.Int
+
+	// AssumeValid identifies a block in the main chain whose ancestors are
+	// assumed to have valid scripts, so their scripts are not checked when
+	// syncing the chain.  Any other block at its height is rejected.
+	//
+	// It can be nil to check the scripts of all blocks after the latest
+	// checkpoint.
+	AssumeValid *Checkpoint
+
+	// AssumeUTXO defines the utxo set snapshots that are allowed to be
+	// loaded to bootstrap the chain state ordered from oldest to newest.
+	AssumeUTXO []AssumeUTXO
+
 	// These fields are related to voting on consensus rule changes as
 	// defined by BIP0009.
 	//
@@ -201,6 +269,13 @@ type Params struct {
 	// Mempool parameters
 	RelayNonStdTxs bool
 
+	// BulletinKeys are the serialized secp256k1 public keys which are
+	// allowed to sign network bulletins (wire.MsgBulletin).  Nodes only
+	// relay bulletins signed by one of these keys and do not support
+	// bulletins at all when there are none, which is the case for all of
+	// the public networks.
+	BulletinKeys [][]byte
+
 	// Human-readable part for Bech32 encoded segwit addresses, as defined
 	// in BIP 173.
 	Bech32HRPSegwit string
@@ -588,6 +663,13 @@ var (
 	// is intended to identify the network for a hierarchical deterministic
 	// private extended key is not registered.
 	ErrUnknownHDKeyID = errors.New("unknown hd private extended key bytes")
+
+	// ErrOverrideNotAllowed describes an error where the consensus rule
+	// change parameters of a network other than the regression test or
+	// simulation test networks were attempted to be overridden.
+	ErrOverrideNotAllowed = errors.New("consensus rule change parameters " +
+		"may only be overridden on the regression and simulation test " +
+		"networks")
 )
 
 var (
@@ -598,6 +680,73 @@ var (
 	hdPrivToPubKeyIDs    = make(map[[4]byte][]byte)
 )
 
+// overridesAllowed returns whether or not the consensus rule change parameters
+// of the network may be overridden.  Only the regression test and simulation
+// test networks allow it since they are used for testing and the parameters
+// of all other networks must be agreed upon by everyone.
+func (p *Params) overridesAllowed() bool {
+	return p.Net == wire.TestNet || p.Net == wire.SimNet
+}
+
+// OverrideDeployment replaces the times that voting on the deployment with the
+// provided ID starts and expires.  This allows integration tests to exercise
+// the deployment activation boundaries deterministically.
+//
+// An ErrOverrideNotAllowed error is returned for networks other than the
+// regression test and simulation test networks.
+//
+// NOTE: The parameters must be overridden before they are used to create a
+// chain instance since they are not expected to change afterwards.
+func (p *Params) OverrideDeployment(deploymentID int, startTime,
+	expireTime uint64) error {
+
+	if !p.overridesAllowed() {
+		return ErrOverrideNotAllowed
+	}
+	if deploymentID < 0 || deploymentID >= DefinedDeployments {
+		return fmt.Errorf("deployment ID %d does not exist", deploymentID)
+	}
+	if startTime > expireTime {
+		return fmt.Errorf("start time %d of deployment %q is after its "+
+			"expire time %d", startTime, deploymentNames[deploymentID],
+			expireTime)
+	}
+
+	p.Deployments[deploymentID].StartTime = startTime
+	p.Deployments[deploymentID].ExpireTime = expireTime
+	return nil
+}
+
+// OverrideRuleChangeWindow replaces the number of blocks in each rule change
+// confirmation window along with the number of blocks within a window that
+// must signal for a deployment in order to lock it in.  Smaller windows allow
+// integration tests to activate deployments without mining thousands of
+// blocks.
+//
+// An ErrOverrideNotAllowed error is returned for networks other than the
+// regression test and simulation test networks.
+//
+// NOTE: The parameters must be overridden before they are used to create a
+// chain instance since they are not expected to change afterwards.
+func (p *Params) OverrideRuleChangeWindow(threshold, window uint32) error {
+	if !p.overridesAllowed() {
+		return ErrOverrideNotAllowed
+	}
+	if window == 0 {
+		return fmt.Errorf("rule change confirmation window must not be " +
+			"zero")
+	}
+	if threshold == 0 || threshold > window {
+		return fmt.Errorf("rule change activation threshold %d must be "+
+			"between 1 and the confirmation window %d", threshold,
+			window)
+	}
+
+	p.RuleChangeActivationThreshold = threshold
+	p.MinerConfirmationWindow = window
+	return nil
+}
+
 // String returns the hostname of the DNS seed in human-readable form.
 func (d DNSSeed) String() string {
 	return d.Host
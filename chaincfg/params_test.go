@@ -4,7 +4,10 @@
 
 package chaincfg
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 // TestInvalidHashStr ensures the newShaHashFromStr function panics when used to
 // with an invalid hash string.
@@ -33,3 +36,109 @@ func TestMustRegisterPanic(t *testing.T) {
 	// Intentionally try to register duplicate params to force a panic.
 	mustRegister(&MainNetParams)
 }
+
+// TestDeploymentNames ensures the deployment names and IDs map to each other.
+func TestDeploymentNames(t *testing.T) {
+	t.Parallel()
+
+	for id := 0; id < DefinedDeployments; id++ {
+		name := DeploymentName(id)
+		if name == "" {
+			t.Errorf("deployment %d does not have a name", id)
+			continue
+		}
+		gotID, ok := DeploymentID(strings.ToUpper(name))
+		if !ok || gotID != id {
+			t.Errorf("DeploymentID(%q): got %d, %v -- want %d, true",
+				name, gotID, ok, id)
+		}
+	}
+
+	if _, ok := DeploymentID("taproot"); ok {
+		t.Error("DeploymentID: unknown deployment reported as known")
+	}
+	if name := DeploymentName(DefinedDeployments); name != "" {
+		t.Errorf("DeploymentName: got %q for undefined deployment", name)
+	}
+}
+
+// TestOverrideDeployment ensures the deployment schedule and rule change
+// window may only be overridden with sane values on the test networks.
+func TestOverrideDeployment(t *testing.T) {
+	t.Parallel()
+
+	// Ensure overrides are rejected for networks other than the regression
+	// and simulation test networks.
+	for _, params := range []Params{MainNetParams, TestNet3Params} {
+		err := params.OverrideDeployment(DeploymentCSV, 0, 100)
+		if err != ErrOverrideNotAllowed {
+			t.Errorf("%s: OverrideDeployment: unexpected error -- "+
+				"got %v, want %v", params.Name, err,
+				ErrOverrideNotAllowed)
+		}
+		err = params.OverrideRuleChangeWindow(75, 100)
+		if err != ErrOverrideNotAllowed {
+			t.Errorf("%s: OverrideRuleChangeWindow: unexpected error "+
+				"-- got %v, want %v", params.Name, err,
+				ErrOverrideNotAllowed)
+		}
+	}
+
+	for _, params := range []Params{RegressionNetParams, SimNetParams} {
+		// Ensure invalid deployment schedules are rejected.
+		err := params.OverrideDeployment(DefinedDeployments, 0, 100)
+		if err == nil {
+			t.Errorf("%s: OverrideDeployment: did not reject unknown "+
+				"deployment", params.Name)
+		}
+		err = params.OverrideDeployment(DeploymentCSV, 100, 99)
+		if err == nil {
+			t.Errorf("%s: OverrideDeployment: did not reject start "+
+				"time after expire time", params.Name)
+		}
+
+		// Ensure valid deployment schedules are applied.
+		err = params.OverrideDeployment(DeploymentSegwit, 10, 20)
+		if err != nil {
+			t.Errorf("%s: OverrideDeployment: unexpected error: %v",
+				params.Name, err)
+			continue
+		}
+		deployment := params.Deployments[DeploymentSegwit]
+		if deployment.StartTime != 10 || deployment.ExpireTime != 20 {
+			t.Errorf("%s: OverrideDeployment: got start %d, expire "+
+				"%d -- want start 10, expire 20", params.Name,
+				deployment.StartTime, deployment.ExpireTime)
+		}
+
+		// Ensure invalid rule change windows are rejected.
+		if err := params.OverrideRuleChangeWindow(1, 0); err == nil {
+			t.Errorf("%s: OverrideRuleChangeWindow: did not reject "+
+				"zero window", params.Name)
+		}
+		if err := params.OverrideRuleChangeWindow(0, 10); err == nil {
+			t.Errorf("%s: OverrideRuleChangeWindow: did not reject "+
+				"zero threshold", params.Name)
+		}
+		if err := params.OverrideRuleChangeWindow(11, 10); err == nil {
+			t.Errorf("%s: OverrideRuleChangeWindow: did not reject "+
+				"threshold larger than window", params.Name)
+		}
+
+		// Ensure valid rule change windows are applied.
+		err = params.OverrideRuleChangeWindow(108, 144)
+		if err != nil {
+			t.Errorf("%s: OverrideRuleChangeWindow: unexpected error: "+
+				"%v", params.Name, err)
+			continue
+		}
+		if params.RuleChangeActivationThreshold != 108 ||
+			params.MinerConfirmationWindow != 144 {
+
+			t.Errorf("%s: OverrideRuleChangeWindow: got threshold "+
+				"%d, window %d -- want threshold 108, window 144",
+				params.Name, params.RuleChangeActivationThreshold,
+				params.MinerConfirmationWindow)
+		}
+	}
+}
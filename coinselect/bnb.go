@@ -0,0 +1,113 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package coinselect
+
+import (
+	"math"
+	"sort"
+
+	"github.com/ifishnet/hdfutil"
+)
+
+// maxBnBTries is the maximum number of steps of the depth-first search of the
+// branch and bound algorithm.
+const maxBnBTries = 100000
+
+// SelectBnB selects coins with the branch and bound algorithm, which searches
+// for a combination of coins whose effective values pay for the target and fees
+// of the transaction with an excess below the cost of creating and later
+// spending a change output.  Such a selection has no change output and the
+// excess is added to the fee.  Among the combinations found within a bounded
+// number of steps, the one with the lowest waste is returned.
+//
+// ErrInsufficientFunds is returned when the coins can't fund the transaction
+// and ErrNoExactMatch when no such combination is found.
+func SelectBnB(coins []Coin, params *Params) (*Selection, error) {
+	cands, available := candidates(coins, params)
+	target := params.selectionTarget()
+	if available < target {
+		return nil, ErrInsufficientFunds
+	}
+	costOfChange := params.costOfChange()
+
+	// Explore the largest coins first so the search quickly reaches
+	// combinations which pay for the target.
+	sort.SliceStable(cands, func(i, j int) bool {
+		return cands[i].effValue > cands[j].effValue
+	})
+
+	// When the fee rate is above the long-term fee rate, every additional
+	// input increases the waste, so branches whose waste already exceeds
+	// the best one can be skipped.
+	feeRateHigh := params.FeeRate > params.LongTermFeeRate
+
+	var (
+		selected  []int
+		best      []int
+		bestWaste hdfutil.Amount = math.MaxInt64
+		value     hdfutil.Amount
+		waste     hdfutil.Amount
+		index     int
+	)
+	for try := 0; try < maxBnBTries; try, index = try+1, index+1 {
+		backtrack := false
+		switch {
+		case value+available < target || value > target+costOfChange ||
+			(waste > bestWaste && feeRateHigh):
+
+			backtrack = true
+
+		case value >= target:
+			// The selection pays for the target, so record it when
+			// it is the best one so far.  Adding more coins would
+			// only increase the excess.
+			if waste+value-target <= bestWaste {
+				best = append(best[:0], selected...)
+				bestWaste = waste + value - target
+			}
+			backtrack = true
+		}
+
+		if backtrack {
+			if len(selected) == 0 {
+				break
+			}
+
+			// Make the coins after the last selected one available
+			// again and explore the branch which omits it.
+			last := selected[len(selected)-1]
+			for index--; index > last; index-- {
+				available += cands[index].effValue
+			}
+			value -= cands[last].effValue
+			waste -= cands[last].fee - cands[last].longTermFee
+			selected = selected[:len(selected)-1]
+			continue
+		}
+
+		// Continue down the branch which includes the coin unless the
+		// previous coin is an equivalent one which was omitted, since
+		// that branch has already been explored.
+		cand := &cands[index]
+		available -= cand.effValue
+		if len(selected) == 0 || selected[len(selected)-1] == index-1 ||
+			cand.effValue != cands[index-1].effValue ||
+			cand.fee != cands[index-1].fee {
+
+			selected = append(selected, index)
+			value += cand.effValue
+			waste += cand.fee - cand.longTermFee
+		}
+	}
+
+	if best == nil {
+		return nil, ErrNoExactMatch
+	}
+	bestCands := make([]candidate, 0, len(best))
+	for _, i := range best {
+		bestCands = append(bestCands, cands[i])
+	}
+	return newSelection(bestCands, params, false), nil
+}
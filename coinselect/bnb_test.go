@@ -0,0 +1,109 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package coinselect
+
+import (
+	"testing"
+
+	"github.com/ifishnet/hdfutil"
+)
+
+// TestSelectBnB ensures the branch and bound algorithm finds the combinations
+// with the lowest waste within the cost of change.
+func TestSelectBnB(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		params *Params
+		coins  []hdfutil.Amount
+		err    error
+		values []hdfutil.Amount
+		fee    hdfutil.Amount
+		waste  hdfutil.Amount
+	}{{
+		name:   "exact match without fees",
+		params: testParams(5, 0, 0),
+		coins:  []hdfutil.Amount{1, 2, 3, 4},
+		values: []hdfutil.Amount{2, 3},
+	}, {
+		name:   "no exact match without fees",
+		params: testParams(5, 0, 0),
+		coins:  []hdfutil.Amount{4, 6},
+		err:    ErrNoExactMatch,
+	}, {
+		name:   "insufficient funds without fees",
+		params: testParams(11, 0, 0),
+		coins:  []hdfutil.Amount{1, 2, 3, 4},
+		err:    ErrInsufficientFunds,
+	}, {
+		// The effective values are 50000, 50010, and 199932.
+		name:   "exact match",
+		params: testParams(100000, 1000, 1000),
+		coins:  []hdfutil.Amount{50068, 50078, 200000},
+		values: []hdfutil.Amount{50068, 50078},
+		fee:    146,
+	}, {
+		// The excess of 40 is below the cost of change of 99.
+		name:   "match within cost of change",
+		params: testParams(100000, 1000, 1000),
+		coins:  []hdfutil.Amount{50068, 50118, 200000},
+		values: []hdfutil.Amount{50068, 50118},
+		fee:    186,
+		waste:  40,
+	}, {
+		// The excess of 100 is above the cost of change of 99.
+		name:   "excess above cost of change",
+		params: testParams(100000, 1000, 1000),
+		coins:  []hdfutil.Amount{50068, 50178},
+		err:    ErrNoExactMatch,
+	}, {
+		// The effective value of the smallest coin is not positive.
+		name:   "uneconomical coin",
+		params: testParams(100000, 1000, 1000),
+		coins:  []hdfutil.Amount{68, 100078},
+		values: []hdfutil.Amount{100078},
+		fee:    78,
+	}, {
+		// Both the single coin and the pair of coins have an
+		// effective value of 100020, but every input wastes 68 at a
+		// fee rate above the long-term fee rate.
+		name:   "fewer inputs at high fee rate",
+		params: testParams(100000, 2000, 1000),
+		coins:  []hdfutil.Amount{50136, 50156, 100156},
+		values: []hdfutil.Amount{100156},
+		fee:    156,
+		waste:  68,
+	}, {
+		// Both the single coin and the pair of coins have an
+		// effective value of 100010, but every input saves 136 at a
+		// fee rate below the long-term fee rate.
+		name:   "more inputs at low fee rate",
+		params: testParams(100000, 1000, 3000),
+		coins:  []hdfutil.Amount{50068, 50078, 100078},
+		values: []hdfutil.Amount{50068, 50078},
+		fee:    146,
+		waste:  -272,
+	}, {
+		name:   "equivalent coins",
+		params: testParams(30, 0, 0),
+		coins:  []hdfutil.Amount{10, 10, 10, 10, 10, 10, 10, 10},
+		values: []hdfutil.Amount{10, 10, 10},
+	}}
+
+	for _, test := range tests {
+		sel, err := SelectBnB(testCoins(test.coins...), test.params)
+		if err != test.err {
+			t.Errorf("%s: mismatched error -- got %v, want %v",
+				test.name, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		checkSelection(t, test.name, sel, test.values, test.fee, 0,
+			test.waste)
+	}
+}
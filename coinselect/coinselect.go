@@ -0,0 +1,198 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package coinselect
+
+import (
+	"errors"
+
+	"github.com/ifishnet/hdfutil"
+)
+
+var (
+	// ErrInsufficientFunds is returned when the effective values of all the
+	// coins, which are their values minus the fees to spend them, are not
+	// enough to pay for the target and the fees of the transaction.
+	ErrInsufficientFunds = errors.New("insufficient funds")
+
+	// ErrNoExactMatch is returned by SelectBnB when no combination of coins
+	// pays for the target and fees without leaving enough to be worth a
+	// change output.
+	ErrNoExactMatch = errors.New("no exact match found")
+)
+
+// Coin is an unspent transaction output which may be selected to fund a
+// transaction.  Callers implement it for their own output types so the coins
+// returned in a Selection can be used directly.
+type Coin interface {
+	// Value returns the value of the output.
+	Value() hdfutil.Amount
+
+	// InputSize returns the virtual size of the transaction input which
+	// spends the output, including its signature script and witness.
+	InputSize() int64
+}
+
+// Params describes the transaction to fund and the fee rates to use.
+type Params struct {
+	// Target is the total value of the outputs of the transaction.
+	Target hdfutil.Amount
+
+	// FeeRate is the fee rate of the transaction in satoshi per 1000
+	// virtual bytes.
+	FeeRate hdfutil.Amount
+
+	// LongTermFeeRate is the fee rate in satoshi per 1000 virtual bytes the
+	// coins are expected to be spent at otherwise.  Selecting more inputs
+	// than needed is considered wasteful when the fee rate is above it and
+	// a way to consolidate coins cheaply when it is below.
+	LongTermFeeRate hdfutil.Amount
+
+	// BaseSize is the virtual size of the transaction without any inputs.
+	BaseSize int64
+
+	// ChangeOutputSize is the virtual size of the change output.
+	ChangeOutputSize int64
+
+	// ChangeSpendSize is the virtual size of the input which eventually
+	// spends the change output.
+	ChangeSpendSize int64
+
+	// MinChange is the minimum value of a change output.  Any smaller
+	// excess is added to the fee instead.
+	MinChange hdfutil.Amount
+}
+
+// Selection is the result of a coin selection.
+type Selection struct {
+	// Coins are the selected coins.
+	Coins []Coin
+
+	// Fee is the fee the transaction pays, including the fees of the
+	// selected inputs and of the change output when there is one.
+	Fee hdfutil.Amount
+
+	// Change is the value of the change output or zero when the
+	// transaction has none.
+	Change hdfutil.Amount
+
+	// Waste is the waste metric of the selection.  It is the difference
+	// between the fees of the inputs at the fee rate and at the long-term
+	// fee rate plus, when there is a change output, the cost of creating
+	// and spending it or, otherwise, the excess added to the fee.
+	Waste hdfutil.Amount
+}
+
+// calcFee returns the fee of the passed virtual size at the passed fee rate in
+// satoshi per 1000 virtual bytes.
+func calcFee(size int64, feeRate hdfutil.Amount) hdfutil.Amount {
+	return hdfutil.Amount(size * int64(feeRate) / 1000)
+}
+
+// candidate is a coin along with the values coin selection is based on.
+type candidate struct {
+	coin Coin
+
+	// effValue is the value of the coin minus the fee of spending it.
+	effValue hdfutil.Amount
+
+	// fee and longTermFee are the fees of spending the coin at the fee
+	// rate and the long-term fee rate.
+	fee         hdfutil.Amount
+	longTermFee hdfutil.Amount
+}
+
+// candidates returns the coins which are worth spending at the fee rate, that
+// is those with a positive effective value, along with their total effective
+// value.
+func candidates(coins []Coin, params *Params) ([]candidate, hdfutil.Amount) {
+	cands := make([]candidate, 0, len(coins))
+	var total hdfutil.Amount
+	for _, coin := range coins {
+		fee := calcFee(coin.InputSize(), params.FeeRate)
+		effValue := coin.Value() - fee
+		if effValue <= 0 {
+			continue
+		}
+		cands = append(cands, candidate{
+			coin:        coin,
+			effValue:    effValue,
+			fee:         fee,
+			longTermFee: calcFee(coin.InputSize(), params.LongTermFeeRate),
+		})
+		total += effValue
+	}
+	return cands, total
+}
+
+// changeFee returns the fee of adding the change output to the transaction.
+func (p *Params) changeFee() hdfutil.Amount {
+	return calcFee(p.ChangeOutputSize, p.FeeRate)
+}
+
+// costOfChange returns the cost of creating the change output and spending it
+// later at the long-term fee rate.
+func (p *Params) costOfChange() hdfutil.Amount {
+	return p.changeFee() + calcFee(p.ChangeSpendSize, p.LongTermFeeRate)
+}
+
+// selectionTarget returns the effective value the selected coins must have to
+// pay for the outputs and the fee of the transaction without any inputs.
+func (p *Params) selectionTarget() hdfutil.Amount {
+	return p.Target + calcFee(p.BaseSize, p.FeeRate)
+}
+
+// newSelection returns the selection of the passed candidates, which must pay
+// for the selection target.  When allowChange is set, the excess over the
+// target becomes a change output if it is enough to pay for the output and
+// leave at least the minimum change.  Otherwise it is added to the fee.
+func newSelection(cands []candidate, params *Params, allowChange bool) *Selection {
+	sel := &Selection{
+		Coins: make([]Coin, 0, len(cands)),
+		Fee:   calcFee(params.BaseSize, params.FeeRate),
+	}
+	var effValue hdfutil.Amount
+	for _, cand := range cands {
+		sel.Coins = append(sel.Coins, cand.coin)
+		sel.Fee += cand.fee
+		sel.Waste += cand.fee - cand.longTermFee
+		effValue += cand.effValue
+	}
+
+	excess := effValue - params.selectionTarget()
+	change := excess - params.changeFee()
+	if allowChange && change >= params.MinChange && change > 0 {
+		sel.Change = change
+		sel.Fee += params.changeFee()
+		sel.Waste += params.costOfChange()
+	} else {
+		sel.Fee += excess
+		sel.Waste += excess
+	}
+	return sel
+}
+
+// Select selects coins to fund the transaction described by the passed
+// parameters.  It runs both the branch and bound and the knapsack algorithms
+// and returns the selection with the lowest waste, preferring the one without
+// a change output when they are equal.
+//
+// ErrInsufficientFunds is returned when the coins can't fund the transaction.
+func Select(coins []Coin, params *Params) (*Selection, error) {
+	knapsack, err := SelectKnapsack(coins, params)
+	if err != nil {
+		return nil, err
+	}
+	bnb, err := SelectBnB(coins, params)
+	if err != nil {
+		// The knapsack solver finds a selection whenever there are
+		// enough funds, so the only possible error is the lack of an
+		// exact match.
+		return knapsack, nil
+	}
+	if bnb.Waste <= knapsack.Waste {
+		return bnb, nil
+	}
+	return knapsack, nil
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package coinselect
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/ifishnet/hdfutil"
+)
+
+const (
+	// testInputSize is the virtual size of a P2WPKH input.
+	testInputSize = 68
+
+	// testBaseSize is the virtual size of the test transactions without
+	// any inputs.
+	testBaseSize = 10
+
+	// testChangeSize is the virtual size of a P2WPKH change output.
+	testChangeSize = 31
+)
+
+// testCoin is a Coin with a P2WPKH input size.
+type testCoin hdfutil.Amount
+
+// Value returns the value of the coin.
+func (c testCoin) Value() hdfutil.Amount {
+	return hdfutil.Amount(c)
+}
+
+// InputSize returns the virtual size of a P2WPKH input.
+func (c testCoin) InputSize() int64 {
+	return testInputSize
+}
+
+// testCoins returns coins with the passed values.
+func testCoins(values ...hdfutil.Amount) []Coin {
+	coins := make([]Coin, 0, len(values))
+	for _, value := range values {
+		coins = append(coins, testCoin(value))
+	}
+	return coins
+}
+
+// testParams returns the parameters of a transaction paying the passed target
+// with P2WPKH inputs and change at the passed fee rates.
+func testParams(target, feeRate, longTermFeeRate hdfutil.Amount) *Params {
+	return &Params{
+		Target:           target,
+		FeeRate:          feeRate,
+		LongTermFeeRate:  longTermFeeRate,
+		BaseSize:         testBaseSize,
+		ChangeOutputSize: testChangeSize,
+		ChangeSpendSize:  testInputSize,
+	}
+}
+
+// selectedValues returns the values of the selected coins in ascending order.
+func selectedValues(sel *Selection) []hdfutil.Amount {
+	values := make([]hdfutil.Amount, 0, len(sel.Coins))
+	for _, coin := range sel.Coins {
+		values = append(values, coin.Value())
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i] < values[j]
+	})
+	return values
+}
+
+// checkSelection ensures the selection has the passed coin values, fee, change,
+// and waste.
+func checkSelection(t *testing.T, name string, sel *Selection,
+	values []hdfutil.Amount, fee, change, waste hdfutil.Amount) {
+
+	t.Helper()
+
+	gotValues := selectedValues(sel)
+	if len(gotValues) != len(values) {
+		t.Errorf("%s: mismatched coins -- got %v, want %v", name,
+			gotValues, values)
+		return
+	}
+	for i := range values {
+		if gotValues[i] != values[i] {
+			t.Errorf("%s: mismatched coins -- got %v, want %v", name,
+				gotValues, values)
+			return
+		}
+	}
+	if sel.Fee != fee {
+		t.Errorf("%s: mismatched fee -- got %d, want %d", name,
+			sel.Fee, fee)
+	}
+	if sel.Change != change {
+		t.Errorf("%s: mismatched change -- got %d, want %d", name,
+			sel.Change, change)
+	}
+	if sel.Waste != waste {
+		t.Errorf("%s: mismatched waste -- got %d, want %d", name,
+			sel.Waste, waste)
+	}
+}
+
+// TestSelect ensures Select prefers exact matches and falls back to the
+// knapsack algorithm.
+func TestSelect(t *testing.T) {
+	t.Parallel()
+
+	// An exact match of two coins with effective values of 50000 and
+	// 50010 pays for the target of 100000 and the base fee of 10.
+	params := testParams(100000, 1000, 1000)
+	coins := testCoins(50068, 50078, 200000)
+	sel, err := Select(coins, params)
+	if err != nil {
+		t.Fatalf("exact match: unexpected error: %v", err)
+	}
+	checkSelection(t, "exact match", sel, []hdfutil.Amount{50068, 50078},
+		146, 0, 0)
+
+	// Without an exact match the largest coin is selected with change.
+	coins = testCoins(50068, 200000)
+	sel, err = Select(coins, params)
+	if err != nil {
+		t.Fatalf("no exact match: unexpected error: %v", err)
+	}
+	checkSelection(t, "no exact match", sel, []hdfutil.Amount{200000},
+		10+68+31, 200000-100000-10-68-31, 31+68)
+
+	// The coins can't pay for the target and fees.
+	coins = testCoins(50068, 50077)
+	if _, err := Select(coins, params); err != ErrInsufficientFunds {
+		t.Fatalf("insufficient funds: mismatched error -- got %v, want "+
+			"%v", err, ErrInsufficientFunds)
+	}
+}
+
+// TestSelectInvariants ensures the selections of random coins pay exactly for
+// the target, fee, and change and leave either no change or at least the
+// minimum change.
+func TestSelectInvariants(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		values := make([]hdfutil.Amount, 1+rng.Intn(20))
+		var total hdfutil.Amount
+		for j := range values {
+			values[j] = hdfutil.Amount(1000 + rng.Int63n(1000000))
+			total += values[j]
+		}
+		params := testParams(hdfutil.Amount(rng.Int63n(int64(total))),
+			hdfutil.Amount(1000+rng.Int63n(50000)),
+			hdfutil.Amount(1000+rng.Int63n(10000)))
+		params.MinChange = 546
+
+		sel, err := Select(testCoins(values...), params)
+		if err == ErrInsufficientFunds {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("#%d: unexpected error: %v", i, err)
+		}
+
+		var selected hdfutil.Amount
+		for _, coin := range sel.Coins {
+			selected += coin.Value()
+		}
+		if selected != params.Target+sel.Fee+sel.Change {
+			t.Fatalf("#%d: selected %d, want target %d + fee %d + "+
+				"change %d", i, selected, params.Target, sel.Fee,
+				sel.Change)
+		}
+		if sel.Change != 0 && sel.Change < params.MinChange {
+			t.Fatalf("#%d: change %d below the minimum %d", i,
+				sel.Change, params.MinChange)
+		}
+		minFee := calcFee(testBaseSize+testInputSize*
+			int64(len(sel.Coins)), params.FeeRate)
+		if sel.Fee < minFee {
+			t.Fatalf("#%d: fee %d below the minimum %d", i, sel.Fee,
+				minFee)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package coinselect implements selection of the unspent outputs which fund a
+transaction.
+
+Coins are selected by their effective value, which is their value minus the fee
+of the input spending them at the fee rate of the transaction.  Coins whose
+effective value is not positive cost more to spend than they are worth and are
+never selected.
+
+Algorithms
+
+SelectBnB implements the branch and bound algorithm, which searches for a
+combination of coins paying for the outputs and fees so closely that the excess
+is smaller than the cost of a change output.  Avoiding the change output saves
+its fees and does not create a new output linking the transaction to the
+sender.
+
+SelectKnapsack implements the knapsack algorithm, which is used when no such
+combination exists.  It selects the smallest subset of coins it finds which
+pays for the outputs and fees as well as a change output of at least the
+minimum change, or else the smallest coin which does.
+
+Select runs both algorithms and picks the selection with the lowest waste.
+
+Waste
+
+The waste metric measures how much a selection costs compared to spending the
+same coins at the long-term fee rate.  It is the sum of the differences between
+the fees of the inputs at the fee rate and at the long-term fee rate plus either
+the cost of creating and later spending the change output, or the excess which
+is added to the fee when there is no change output.  At fee rates above the
+long-term fee rate, selections with fewer inputs have less waste, while at
+lower fee rates selections with more inputs do, which consolidates coins when
+fees are cheap.
+*/
+package coinselect
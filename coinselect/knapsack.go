@@ -0,0 +1,149 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package coinselect
+
+import (
+	"math/rand"
+	"sort"
+
+	"github.com/ifishnet/hdfutil"
+)
+
+// knapsackIterations is the number of random subsets the knapsack algorithm
+// tries to approximate the best subset of coins.
+const knapsackIterations = 1000
+
+// SelectKnapsack selects coins with the knapsack algorithm, which is used as a
+// fallback when no exact match exists.  It looks for a single coin which pays
+// for the target and fees exactly, then for the smallest subset of the coins
+// smaller than the target plus a change output of at least the minimum change,
+// and falls back to the smallest coin larger than that.  The subset is
+// approximated by trying random combinations, so the selection may differ
+// between calls.  The excess of the selection becomes a change output when it
+// is large enough.
+//
+// ErrInsufficientFunds is returned when the coins can't fund the transaction.
+func SelectKnapsack(coins []Coin, params *Params) (*Selection, error) {
+	cands, _ := candidates(coins, params)
+	target := params.selectionTarget()
+	changeTarget := target + params.changeFee() + params.MinChange
+
+	rand.Shuffle(len(cands), func(i, j int) {
+		cands[i], cands[j] = cands[j], cands[i]
+	})
+
+	var (
+		applicable   []candidate
+		total        hdfutil.Amount
+		lowestLarger *candidate
+	)
+	for i := range cands {
+		cand := &cands[i]
+		switch {
+		case cand.effValue == target:
+			return newSelection(cands[i:i+1], params, true), nil
+
+		case cand.effValue < changeTarget:
+			applicable = append(applicable, *cand)
+			total += cand.effValue
+
+		case lowestLarger == nil || cand.effValue < lowestLarger.effValue:
+			lowestLarger = cand
+		}
+	}
+
+	if total == target {
+		return newSelection(applicable, params, true), nil
+	}
+	if total < target {
+		if lowestLarger == nil {
+			return nil, ErrInsufficientFunds
+		}
+		return newSelection([]candidate{*lowestLarger}, params, true), nil
+	}
+
+	// Look for the subset which is closest to the target, or to the target
+	// with a change output when there is no exact match and enough value
+	// for a change output.
+	sort.SliceStable(applicable, func(i, j int) bool {
+		return applicable[i].effValue > applicable[j].effValue
+	})
+	best, bestValue := approximateBestSubset(applicable, total, target)
+	if bestValue != target && total >= changeTarget {
+		best, bestValue = approximateBestSubset(applicable, total,
+			changeTarget)
+	}
+
+	// Prefer the smallest larger coin when the subset leaves an excess too
+	// small for a change output or is not smaller than the coin anyway.
+	if lowestLarger != nil && ((bestValue != target &&
+		bestValue < changeTarget) || lowestLarger.effValue <= bestValue) {
+
+		return newSelection([]candidate{*lowestLarger}, params, true), nil
+	}
+
+	selected := make([]candidate, 0, len(best))
+	for i, include := range best {
+		if include {
+			selected = append(selected, applicable[i])
+		}
+	}
+	return newSelection(selected, params, true), nil
+}
+
+// approximateBestSubset returns the smallest subset of the passed candidates,
+// sorted by descending effective value, whose total effective value is at
+// least the target, along with that value, among a number of random subsets.
+// The passed total must be the total effective value of the candidates, which
+// is the value of the initial subset of all candidates.
+func approximateBestSubset(cands []candidate, total,
+	target hdfutil.Amount) ([]bool, hdfutil.Amount) {
+
+	best := make([]bool, len(cands))
+	for i := range best {
+		best[i] = true
+	}
+	bestValue := total
+
+	included := make([]bool, len(cands))
+	for rep := 0; rep < knapsackIterations && bestValue != target; rep++ {
+		for i := range included {
+			included[i] = false
+		}
+		var value hdfutil.Amount
+		reachedTarget := false
+
+		// Randomly include candidates in the first pass and include
+		// the remaining ones in the second pass.  Whenever the target
+		// is reached, the last candidate is removed again to look for
+		// smaller subsets.
+		for pass := 0; pass < 2 && !reachedTarget; pass++ {
+			for i := range cands {
+				var include bool
+				if pass == 0 {
+					include = rand.Intn(2) == 0
+				} else {
+					include = !included[i]
+				}
+				if !include {
+					continue
+				}
+
+				value += cands[i].effValue
+				included[i] = true
+				if value >= target {
+					reachedTarget = true
+					if value < bestValue {
+						bestValue = value
+						copy(best, included)
+					}
+					value -= cands[i].effValue
+					included[i] = false
+				}
+			}
+		}
+	}
+	return best, bestValue
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package coinselect
+
+import (
+	"testing"
+
+	"github.com/ifishnet/hdfutil"
+)
+
+// TestSelectKnapsack ensures the knapsack algorithm selects exact matches,
+// the smallest subsets, and the smallest larger coins as expected.
+func TestSelectKnapsack(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		target    hdfutil.Amount
+		minChange hdfutil.Amount
+		coins     []hdfutil.Amount
+		err       error
+		values    []hdfutil.Amount
+		change    hdfutil.Amount
+	}{{
+		name:   "single exact match",
+		target: 10,
+		coins:  []hdfutil.Amount{5, 10, 21},
+		values: []hdfutil.Amount{10},
+	}, {
+		name:   "all smaller coins",
+		target: 10,
+		coins:  []hdfutil.Amount{2, 3, 5, 21},
+		values: []hdfutil.Amount{2, 3, 5},
+	}, {
+		name:   "smallest subset",
+		target: 13,
+		coins:  []hdfutil.Amount{6, 7, 8, 20},
+		values: []hdfutil.Amount{6, 7},
+	}, {
+		name:   "smaller coins are not enough",
+		target: 10,
+		coins:  []hdfutil.Amount{2, 3, 4, 20, 30},
+		values: []hdfutil.Amount{20},
+		change: 10,
+	}, {
+		// The pair of coins leaves change below the minimum.
+		name:      "smallest larger coin",
+		target:    10,
+		minChange: 5,
+		coins:     []hdfutil.Amount{6, 7, 16},
+		values:    []hdfutil.Amount{16},
+		change:    6,
+	}, {
+		name:      "subset with change",
+		target:    10,
+		minChange: 5,
+		coins:     []hdfutil.Amount{6, 9, 40},
+		values:    []hdfutil.Amount{6, 9},
+		change:    5,
+	}, {
+		name:   "insufficient funds",
+		target: 10,
+		coins:  []hdfutil.Amount{2, 3, 4},
+		err:    ErrInsufficientFunds,
+	}}
+
+	for _, test := range tests {
+		params := testParams(test.target, 0, 0)
+		params.MinChange = test.minChange
+		sel, err := SelectKnapsack(testCoins(test.coins...), params)
+		if err != test.err {
+			t.Errorf("%s: mismatched error -- got %v, want %v",
+				test.name, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		// Without fees, an excess too small for change is the fee and
+		// the waste is the fee or the zero cost of change.
+		var fee hdfutil.Amount
+		if test.change == 0 {
+			for _, value := range test.values {
+				fee += value
+			}
+			fee -= test.target
+		}
+		checkSelection(t, test.name, sel, test.values, fee,
+			test.change, fee)
+	}
+}
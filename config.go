@@ -8,11 +8,15 @@ import (
 	"bufio"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"net"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
 	"sort"
@@ -26,8 +30,11 @@ import (
 	"github.com/ifishnet/hdfd/connmgr"
 	"github.com/ifishnet/hdfd/database"
 	_ "github.com/ifishnet/hdfd/database/ffldb"
+	"github.com/ifishnet/hdfd/hdfec"
 	"github.com/ifishnet/hdfd/mempool"
+	"github.com/ifishnet/hdfd/mining"
 	"github.com/ifishnet/hdfd/peer"
+	"github.com/ifishnet/hdfd/txscript"
 	"github.com/ifishnet/hdfutil"
 	"github.com/ifishnet/go-socks/socks"
 	flags "github.com/jessevdk/go-flags"
@@ -42,11 +49,16 @@ const (
 	defaultMaxPeers              = 125
 	defaultBanDuration           = time.Hour * 24
 	defaultBanThreshold          = 100
+	defaultBlockRelayConns       = 2
+	defaultExtraBlockRelay       = time.Minute * 5
 	defaultConnectTimeout        = time.Second * 30
 	defaultMaxRPCClients         = 10
 	defaultMaxRPCWebsockets      = 25
 	defaultMaxRPCConcurrentReqs  = 20
+	defaultMaxRPCWSFilterSize    = 1000000
+	defaultMaxRPCWSSubs          = 100000
 	defaultDbType                = "ffldb"
+	defaultCheckpointMode        = "enforce"
 	defaultFreeTxRelayLimit      = 15.0
 	defaultTrickleInterval       = peer.DefaultTrickleInterval
 	defaultBlockMinSize          = 0
@@ -58,12 +70,16 @@ const (
 	blockMaxWeightMin            = 4000
 	blockMaxWeightMax            = blockchain.MaxBlockWeight - 4000
 	defaultGenerate              = false
+	defaultMaxMempool            = mempool.DefaultMaxPoolSize / 1000000
 	defaultMaxOrphanTransactions = 100
 	defaultMaxOrphanTxSize       = 100000
 	defaultSigCacheMaxSize       = 100000
+	defaultUtxoCacheMaxSizeMiB   = 250
+	defaultRecentBlockCacheSize  = 12
 	sampleConfigFilename         = "sample-hdfd.conf"
 	defaultTxIndex               = false
 	defaultAddrIndex             = false
+	defaultUnixSocketMode        = "0600"
 )
 
 var (
@@ -93,11 +109,14 @@ func minUint32(a, b uint32) uint32 {
 //
 // See loadConfig for details on the configuration load process.
 type config struct {
+	AcceptReplacement    bool          `long:"acceptreplacement" description:"Accept transactions that replace existing transactions within the mempool through the Replace-By-Fee (RBF) signaling policy"`
 	AddCheckpoints       []string      `long:"addcheckpoint" description:"Add a custom checkpoint.  Format: '<height>:<hash>'"`
 	AddPeers             []string      `short:"a" long:"addpeer" description:"Add a peer to connect with at startup"`
 	AddrIndex            bool          `long:"addrindex" description:"Maintain a full address-based transaction index which makes the searchrawtransactions RPC available"`
 	AgentBlacklist       []string      `long:"agentblacklist" description:"A comma separated list of user-agent substrings which will cause hdfd to reject any peers whose user-agent contains any of the blacklisted substrings."`
 	AgentWhitelist       []string      `long:"agentwhitelist" description:"A comma separated list of user-agent substrings which will cause hdfd to require all peers' user-agents to contain one of the whitelisted substrings. The blacklist is applied before the blacklist, and an empty whitelist will allow all agents that do not fail the blacklist."`
+	ASMap                string        `long:"asmap" description:"Path to an ASMap file in the format used by Bitcoin Core to group peer addresses by the autonomous systems announcing them rather than by their /16 or /32 networks"`
+	AssumeValid          string        `long:"assumevalid" description:"Assume the scripts of the specified block and its ancestors are valid instead of the block defined by the network parameters -- Format: '<height>:<hash>' or '0' to check the scripts of all blocks after the latest checkpoint"`
 	BanDuration          time.Duration `long:"banduration" description:"How long to ban misbehaving peers.  Valid time units are {s, m, h}.  Minimum 1 second"`
 	BanThreshold         uint32        `long:"banthreshold" description:"Maximum allowed ban score before disconnecting and banning misbehaving peers."`
 	BlockMaxSize         uint32        `long:"blockmaxsize" description:"Maximum block size in bytes to be used when creating a block"`
@@ -105,24 +124,49 @@ type config struct {
 	BlockMaxWeight       uint32        `long:"blockmaxweight" description:"Maximum block weight to be used when creating a block"`
 	BlockMinWeight       uint32        `long:"blockminweight" description:"Mininum block weight to be used when creating a block"`
 	BlockPrioritySize    uint32        `long:"blockprioritysize" description:"Size in bytes for high-priority/low-fee transactions when creating a block"`
+	BlockRelayConns      int           `long:"blockrelayconns" description:"Number of outbound peers to maintain in addition to the full-relay ones which only relay blocks, to make it harder to isolate the node from the network -- They are limited by --maxpeers"`
 	BlocksOnly           bool          `long:"blocksonly" description:"Do not accept transactions from remote peers."`
+	BulletinKeys         []string      `long:"bulletinkey" description:"Add a hex encoded public key which is allowed to sign network bulletins in addition to the keys defined by the network parameters -- Bulletins are only supported and relayed when at least one key is known"`
+	BytesPerSigOp        int           `long:"bytespersigop" description:"Number of virtual bytes each unit of signature operation cost of a transaction is counted as when calculating its fee rate and size limits in the mempool -- 0 disables the adjustment"`
+	CheckpointMode       string        `long:"checkpointmode" description:"How the checkpoints are used {enforce, advisory} -- Enforced checkpoints also skip validating the scripts of the blocks before them, while advisory checkpoints are only used to estimate the sync progress and reject forks before them so every block is fully validated"`
 	ConfigFile           string        `short:"C" long:"configfile" description:"Path to configuration file"`
 	ConnectPeers         []string      `long:"connect" description:"Connect only to the specified peers at startup"`
 	CPUProfile           string        `long:"cpuprofile" description:"Write CPU profile to the specified file"`
+	DataCarrierSize      int           `long:"datacarriersize" description:"Maximum number of bytes of data carried by the null data (OP_RETURN) outputs of relayed and mined transactions"`
 	DataDir              string        `short:"b" long:"datadir" description:"Directory to store data"`
+	DbBlockFileSize      uint32        `long:"dbblockfilesize" description:"Maximum size of each block file in MiB -- 0 uses the default of 512 MiB (ffldb only)"`
+	DbMmap               bool          `long:"dbmmap" description:"Memory map the block files to speed up concurrent historical block reads (ffldb only)"`
+	DbPrealloc           bool          `long:"dbprealloc" description:"Preallocate the disk space of the block files to reduce their fragmentation (ffldb only)"`
 	DbType               string        `long:"dbtype" description:"Database backend to use for the Block Chain"`
 	DebugLevel           string        `short:"d" long:"debuglevel" description:"Logging level for all subsystems {trace, debug, info, warn, error, critical} -- You may also specify <subsystem>=<level>,<subsystem2>=<level>,... to set the log level for individual subsystems -- Use show to list available subsystems"`
 	DropAddrIndex        bool          `long:"dropaddrindex" description:"Deletes the address-based transaction index from the database on start up and then exits."`
 	DropCfIndex          bool          `long:"dropcfindex" description:"Deletes the index used for committed filtering (CF) support from the database on start up and then exits."`
 	DropTxIndex          bool          `long:"droptxindex" description:"Deletes the hash-based transaction index from the database on start up and then exits."`
+	ExtraBlockRelay      time.Duration `long:"extrablockrelayinterval" description:"Periodically connect to an extra block-relay-only peer to find out whether the others are withholding blocks, then disconnect the one which provided a block least recently -- 0 disables it"`
 	ExternalIPs          []string      `long:"externalip" description:"Add an ip to the list of local addresses we claim to listen on to peers"`
 	Generate             bool          `long:"generate" description:"Generate (mine) bitcoins using the CPU"`
+	HeadersOnly          bool          `long:"headersonly" description:"Only download and validate the headers of the chain instead of its blocks, which implies --blocksonly and --nocfilters -- NOTE: Can't be used with --generate, --prune, --utxosnapshot, --txindex or --addrindex"`
+	LimitAncestorCount   int           `long:"limitancestorcount" description:"Max number of unconfirmed transactions, including itself, a transaction accepted to the mempool may depend on -- 0 disables the limit"`
+	LimitAncestorSize    int64         `long:"limitancestorsize" description:"Max total virtual size in bytes of a transaction accepted to the mempool together with all of its unconfirmed ancestors -- 0 disables the limit"`
+	LimitDescendantCount int           `long:"limitdescendantcount" description:"Max number of unconfirmed transactions, including itself, that may depend on a transaction in the mempool -- 0 disables the limit"`
+	LimitDescendantSize  int64         `long:"limitdescendantsize" description:"Max total virtual size in bytes of a transaction in the mempool together with all of its unconfirmed descendants -- 0 disables the limit"`
 	FreeTxRelayLimit     float64       `long:"limitfreerelay" description:"Limit relay of transactions with no transaction fee to the given amount in thousands of bytes per minute"`
 	Listeners            []string      `long:"listen" description:"Add an interface/port to listen for connections (default all interfaces port: 8333, testnet: 18333)"`
 	LogDir               string        `long:"logdir" description:"Directory to log output."`
+	MaxDownloadRate      int64         `long:"maxdownloadrate" description:"Max rate in KiB per second for the bytes received from all non-whitelisted peers -- 0 disables the limit"`
+	MaxDownloadTarget    uint64        `long:"maxdownloadtarget" description:"Target in MiB for the bytes received from all peers per 24 hours -- The progress towards it is reported by getnettotals -- 0 disables the target"`
+	MaxMempool           int           `long:"maxmempool" description:"Max total virtual size in megabytes of the transactions in the mempool -- The transactions with the lowest fee rates are evicted when it is exceeded and the minimum fee rate for new transactions is raised accordingly -- 0 disables the limit"`
+	MaxOrphanPeerBytes   int64         `long:"maxorphanpeerbytes" description:"Max total size in bytes of the orphan transactions relayed by a single peer to keep in memory -- The oldest orphans of the peer are evicted when it is exceeded -- 0 disables the limit"`
 	MaxOrphanTxs         int           `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
 	MaxPeers             int           `long:"maxpeers" description:"Max number of inbound and outbound peers"`
+	MaxUploadRate        int64         `long:"maxuploadrate" description:"Max rate in KiB per second for the bytes sent to all non-whitelisted peers -- 0 disables the limit"`
+	MaxUploadTarget      uint64        `long:"maxuploadtarget" description:"Target in MiB for the bytes sent to all peers per 24 hours -- Once it is almost reached, blocks older than a week are no longer served to non-whitelisted peers while relay continues -- The progress towards it is reported by getnettotals -- 0 disables the target"`
+	MempoolExpiry        time.Duration `long:"mempoolexpiry" description:"Max amount of time a transaction may stay in the mempool before it is evicted along with its descendants -- 0 disables expiry"`
+	MinimumChainWork     string        `long:"minimumchainwork" description:"Override the minimum cumulative work the main chain is known to have defined by the network parameters as a hex number -- The chain is not considered current until it has this much work and blocks which fork it at a block with less work are rejected -- Use '0' to disable"`
 	MiningAddrs          []string      `long:"miningaddr" description:"Add the specified payment address to the list of addresses to use for generated blocks -- At least one address is required if the generate option is set"`
+	MiningCoinbaseData   string        `long:"miningcoinbasedata" description:"Hex encoded data to add to the coinbase transaction script of generated blocks -- NOTE: Limited to 73 bytes"`
+	MiningMinTxFee       float64       `long:"miningmintxfee" description:"The minimum fee rate in BTC/kB of the transactions to include in generated blocks regardless of the minimum block size and their priority"`
+	MiningVersionBits    []uint32      `long:"miningversionbit" description:"Signal for the specified version bit (0-28) in generated blocks in addition to the bits of the rule change deployments"`
 	MinRelayTxFee        float64       `long:"minrelaytxfee" description:"The minimum transaction fee in BTC/kB to be considered a non-zero fee."`
 	DisableBanning       bool          `long:"nobanning" description:"Disable banning of misbehaving peers"`
 	NoCFilters           bool          `long:"nocfilters" description:"Disable committed filtering (CF) support"`
@@ -131,6 +175,7 @@ type config struct {
 	DisableListen        bool          `long:"nolisten" description:"Disable listening for incoming connections -- NOTE: Listening is automatically disabled if the --connect or --proxy options are used without also specifying listen interfaces via --listen"`
 	NoOnion              bool          `long:"noonion" description:"Disable connecting to tor hidden services"`
 	NoPeerBloomFilters   bool          `long:"nopeerbloomfilters" description:"Disable bloom filtering support"`
+	NoPersistMempool     bool          `long:"nopersistmempool" description:"Do not save the mempool on shutdown and restore it on startup"`
 	NoRelayPriority      bool          `long:"norelaypriority" description:"Do not require free or low-fee transactions to have high priority for relaying"`
 	NoWinService         bool          `long:"nowinservice" description:"Do not start as a background service on Windows -- NOTE: This flag only works on the command line, not in the config file"`
 	DisableRPC           bool          `long:"norpc" description:"Disable built-in RPC server -- NOTE: The RPC server is disabled by default if no rpcuser/rpcpass or rpclimituser/rpclimitpass is specified"`
@@ -138,41 +183,73 @@ type config struct {
 	OnionProxy           string        `long:"onion" description:"Connect to tor hidden services via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
 	OnionProxyPass       string        `long:"onionpass" default-mask:"-" description:"Password for onion proxy server"`
 	OnionProxyUser       string        `long:"onionuser" description:"Username for onion proxy server"`
-	Profile              string        `long:"profile" description:"Enable HTTP profiling on given port -- NOTE port must be between 1024 and 65536"`
+	PeerCompression      bool          `long:"peercompression" description:"Enable experimental compression of block and committed filter messages exchanged with peers which enable it as well"`
+	PeerMaxDownloadRate  int64         `long:"peermaxdownloadrate" description:"Max rate in KiB per second for the bytes received from each non-whitelisted peer -- 0 disables the limit"`
+	PeerMaxUploadRate    int64         `long:"peermaxuploadrate" description:"Max rate in KiB per second for the bytes sent to each non-whitelisted peer -- 0 disables the limit"`
+	PeerRotateInterval   time.Duration `long:"peerrotateinterval" description:"Periodically replace the longest connected outbound peer with a new peer in a different network group to improve privacy -- NOTE: Must be at least 1m when enabled"`
+	Profile              string        `long:"profile" description:"Enable HTTP profiling and chain metrics in the Prometheus format at /metrics on given port -- NOTE port must be between 1024 and 65536"`
 	Proxy                string        `long:"proxy" description:"Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
 	ProxyPass            string        `long:"proxypass" default-mask:"-" description:"Password for proxy server"`
 	ProxyUser            string        `long:"proxyuser" description:"Username for proxy server"`
+	Prune                uint64        `long:"prune" description:"Reduce storage requirements by removing the oldest blocks to keep the stored block data below the specified target size in MiB -- NOTE: Must be at least 550 and can't be used with --txindex or --addrindex"`
+	RebroadcastInterval  time.Duration `long:"rebroadcastinterval" description:"Average amount of time in between rebroadcasts of the mempool transactions which pay high enough fees to have been mined but were not, suggesting they are missing from the mempools of other peers -- 0 disables rebroadcasting"`
+	RecentBlockCacheSize uint          `long:"recentblockcachesize" description:"The maximum number of the most recently connected blocks to keep in memory along with their spend journals to serve RPC requests and reorganizations without loading them from the database"`
 	RegressionTest       bool          `long:"regtest" description:"Use the regression test network"`
 	RejectNonStd         bool          `long:"rejectnonstd" description:"Reject non-standard transactions regardless of the default settings for the active network."`
-	RejectReplacement    bool          `long:"rejectreplacement" description:"Reject transactions that attempt to replace existing transactions within the mempool through the Replace-By-Fee (RBF) signaling policy."`
+	RejectReplacement    bool          `long:"rejectreplacement" description:"Reject transactions that attempt to replace existing transactions within the mempool through the Replace-By-Fee (RBF) signaling policy -- NOTE: This is the default unless --acceptreplacement is specified"`
 	RelayNonStd          bool          `long:"relaynonstd" description:"Relay non-standard transactions regardless of the default settings for the active network."`
+	RPCAllowOrigins      []string      `long:"rpcalloworigin" description:"Allow cross-origin (CORS) requests to the RPC server from the given origin, e.g. https://example.com -- may be specified multiple times and * allows all origins"`
+	RPCBasePath          string        `long:"rpcbasepath" description:"Path prefix to serve the RPC server endpoints under, e.g. /hdfd to serve them at /hdfd/ and /hdfd/ws behind a reverse proxy"`
 	RPCCert              string        `long:"rpccert" description:"File containing the certificate file"`
 	RPCKey               string        `long:"rpckey" description:"File containing the certificate key"`
 	RPCLimitPass         string        `long:"rpclimitpass" default-mask:"-" description:"Password for limited RPC connections"`
 	RPCLimitUser         string        `long:"rpclimituser" description:"Username for limited RPC connections"`
 	RPCListeners         []string      `long:"rpclisten" description:"Add an interface/port to listen for RPC connections (default port: 8334, testnet: 18334)"`
+	RPCUnixListeners     []string      `long:"rpcunixlisten" description:"Add a unix domain socket path to listen for RPC connections -- NOTE: TLS is not used for unix domain sockets"`
 	RPCMaxClients        int           `long:"rpcmaxclients" description:"Max number of RPC clients for standard connections"`
 	RPCMaxConcurrentReqs int           `long:"rpcmaxconcurrentreqs" description:"Max number of concurrent RPC requests that may be processed concurrently"`
 	RPCMaxWebsockets     int           `long:"rpcmaxwebsockets" description:"Max number of RPC websocket connections"`
+	RPCMaxWSFilterSize   int           `long:"rpcmaxwsfiltersize" description:"Max number of addresses and outpoints a single RPC websocket client may load into its transaction filter -- 0 disables the limit"`
+	RPCMaxWSSubs         int           `long:"rpcmaxwssubscriptions" description:"Max number of addresses and outpoints a single RPC websocket client may request notifications for -- 0 disables the limit"`
 	RPCQuirks            bool          `long:"rpcquirks" description:"Mirror some JSON-RPC quirks of Bitcoin Core -- NOTE: Discouraged unless interoperability issues need to be worked around"`
+	RPCTrustedProxies    []string      `long:"rpctrustedproxy" description:"Add an IP network or IP of a reverse proxy whose X-Forwarded-For header is trusted to identify RPC clients (eg. 192.168.1.0/24 or ::1)"`
 	RPCPass              string        `short:"P" long:"rpcpass" default-mask:"-" description:"Password for RPC connections"`
 	RPCUser              string        `short:"u" long:"rpcuser" description:"Username for RPC connections"`
 	SigCacheMaxSize      uint          `long:"sigcachemaxsize" description:"The maximum number of entries in the signature verification cache"`
 	SimNet               bool          `long:"simnet" description:"Use the simulation test network"`
+	SkipLocalChecksums   bool          `long:"skiplocalchecksums" description:"Do not calculate or verify message checksums for peers connected over unix sockets -- NOTE: The remote end must also skip checksums"`
+	SyncCFHeaders        bool          `long:"synccfheaders" description:"Also download the committed filter headers of the header chain from peers -- NOTE: Requires --headersonly"`
 	TestNet3             bool          `long:"testnet" description:"Use the test network"`
 	TorIsolation         bool          `long:"torisolation" description:"Enable Tor stream isolation by randomizing user credentials for each connection."`
-	TrickleInterval      time.Duration `long:"trickleinterval" description:"Minimum time between attempts to send new inventory to a connected peer"`
+	TrickleInterval      time.Duration `long:"trickleinterval" description:"Average time between attempts to send new inventory to a connected peer -- the actual times are randomized"`
 	TxIndex              bool          `long:"txindex" description:"Maintain a full hash-based transaction index which makes all transactions available via the getrawtransaction RPC"`
+	UnixListeners        []string      `long:"unixlisten" description:"Add a unix domain socket path to listen for peer connections from applications on the same host"`
+	UnixSocketMode       string        `long:"unixsocketmode" description:"File permission mode, in octal, of the unix domain sockets created by --unixlisten and --rpcunixlisten"`
 	UserAgentComments    []string      `long:"uacomment" description:"Comment to add to the user agent -- See BIP 14 for more information."`
 	Upnp                 bool          `long:"upnp" description:"Use UPnP to map our listening port outside of NAT"`
+	UtxoCacheMaxSize     uint64        `long:"utxocachemaxsize" description:"The maximum size in MiB of the in-memory utxo cache -- Modifications to the utxo set are written to the database once it is exceeded or periodically otherwise"`
+	UTXOSnapshot         string        `long:"utxosnapshot" description:"Bootstrap the chain state from the specified utxo set snapshot file and validate the historical chain in the background -- NOTE: Only used when the chain has not been synced yet and requires --nocfilters while it can't be used with --txindex or --addrindex"`
+	UTXOSnapshotHash     string        `long:"utxosnapshothash" description:"Trust the utxo set snapshot specified by --utxosnapshot when its utxo set hash matches this one even if the chain parameters do not commit to it, such as a snapshot dumped from another node you control"`
+	VBParams             []string      `long:"vbparams" description:"Override the start and expire times of a deployment on the regtest and simnet networks -- Format: '<deployment>:<starttime>:<expiretime>' where deployment is one of {testdummy, csv, segwit} and the times are unix timestamps"`
+	VBWindow             string        `long:"vbwindow" description:"Override the rule change activation threshold and confirmation window on the regtest and simnet networks -- Format: '<threshold>:<window>'"`
 	ShowVersion          bool          `short:"V" long:"version" description:"Display version information and exit"`
 	Whitelists           []string      `long:"whitelist" description:"Add an IP network or IP that will not be banned. (eg. 192.168.1.0/24 or ::1)"`
 	lookup               func(string) ([]net.IP, error)
 	oniondial            func(string, string, time.Duration) (net.Conn, error)
 	dial                 func(string, string, time.Duration) (net.Conn, error)
 	addCheckpoints       []chaincfg.Checkpoint
+	assumeValid          *chaincfg.Checkpoint
+	bulletinKeys         [][]byte
+	checkpointMode       blockchain.CheckpointMode
+	minimumChainWork     *big.Int
 	miningAddrs          []hdfutil.Address
+	miningCoinbaseData   []byte
+	miningMinTxFee       hdfutil.Amount
+	miningVersionBits    uint32
 	minRelayTxFee        hdfutil.Amount
+	rpcTrustedProxies    []*net.IPNet
+	unixSocketMode       os.FileMode
+	utxoSnapshotHash     *chainhash.Hash
 	whitelists           []*net.IPNet
 }
 
@@ -305,6 +382,32 @@ func removeDuplicateAddresses(addrs []string) []string {
 	return result
 }
 
+// parseIPNet parses the passed IP network in CIDR notation or IP address, which
+// is treated as a network containing only that address.  It returns nil when
+// the passed string is neither.
+func parseIPNet(addr string) *net.IPNet {
+	_, ipnet, err := net.ParseCIDR(addr)
+	if err == nil {
+		return ipnet
+	}
+
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil
+	}
+	var bits int
+	if ip.To4() == nil {
+		// IPv6
+		bits = 128
+	} else {
+		bits = 32
+	}
+	return &net.IPNet{
+		IP:   ip,
+		Mask: net.CIDRMask(bits, bits),
+	}
+}
+
 // normalizeAddress returns addr with the passed default port appended if
 // there is not already a port specified.
 func normalizeAddress(addr, defaultPort string) string {
@@ -373,6 +476,68 @@ func parseCheckpoints(checkpointStrings []string) ([]chaincfg.Checkpoint, error)
 	return checkpoints, nil
 }
 
+// applyDeploymentOverrides checks the deployment override strings for valid
+// syntax ('<deployment>:<starttime>:<expiretime>') and applies them to the
+// provided network parameters.
+func applyDeploymentOverrides(params *chaincfg.Params, overrides []string) error {
+	for _, override := range overrides {
+		parts := strings.Split(override, ":")
+		if len(parts) != 3 {
+			return fmt.Errorf("unable to parse deployment override %q "+
+				"-- use the syntax <deployment>:<starttime>:"+
+				"<expiretime>", override)
+		}
+
+		deploymentID, ok := chaincfg.DeploymentID(parts[0])
+		if !ok {
+			return fmt.Errorf("unable to parse deployment override %q "+
+				"due to unknown deployment", override)
+		}
+		startTime, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("unable to parse deployment override %q "+
+				"due to malformed start time", override)
+		}
+		expireTime, err := strconv.ParseUint(parts[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("unable to parse deployment override %q "+
+				"due to malformed expire time", override)
+		}
+
+		err = params.OverrideDeployment(deploymentID, startTime,
+			expireTime)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyRuleChangeWindowOverride checks the rule change window override string
+// for valid syntax ('<threshold>:<window>') and applies it to the provided
+// network parameters.
+func applyRuleChangeWindowOverride(params *chaincfg.Params, override string) error {
+	parts := strings.Split(override, ":")
+	if len(parts) != 2 {
+		return fmt.Errorf("unable to parse rule change window override "+
+			"%q -- use the syntax <threshold>:<window>", override)
+	}
+
+	threshold, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return fmt.Errorf("unable to parse rule change window override "+
+			"%q due to malformed threshold", override)
+	}
+	window, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return fmt.Errorf("unable to parse rule change window override "+
+			"%q due to malformed window", override)
+	}
+
+	return params.OverrideRuleChangeWindow(uint32(threshold),
+		uint32(window))
+}
+
 // filesExists reports whether the named file or directory exists.
 func fileExists(name string) bool {
 	if _, err := os.Stat(name); err != nil {
@@ -412,12 +577,17 @@ func loadConfig() (*config, []string, error) {
 		MaxPeers:             defaultMaxPeers,
 		BanDuration:          defaultBanDuration,
 		BanThreshold:         defaultBanThreshold,
+		BlockRelayConns:      defaultBlockRelayConns,
+		ExtraBlockRelay:      defaultExtraBlockRelay,
 		RPCMaxClients:        defaultMaxRPCClients,
 		RPCMaxWebsockets:     defaultMaxRPCWebsockets,
+		RPCMaxWSFilterSize:   defaultMaxRPCWSFilterSize,
+		RPCMaxWSSubs:         defaultMaxRPCWSSubs,
 		RPCMaxConcurrentReqs: defaultMaxRPCConcurrentReqs,
 		DataDir:              defaultDataDir,
 		LogDir:               defaultLogDir,
 		DbType:               defaultDbType,
+		CheckpointMode:       defaultCheckpointMode,
 		RPCKey:               defaultRPCKeyFile,
 		RPCCert:              defaultRPCCertFile,
 		MinRelayTxFee:        mempool.DefaultMinRelayTxFee.ToHDF(),
@@ -428,11 +598,24 @@ func loadConfig() (*config, []string, error) {
 		BlockMinWeight:       defaultBlockMinWeight,
 		BlockMaxWeight:       defaultBlockMaxWeight,
 		BlockPrioritySize:    mempool.DefaultBlockPrioritySize,
+		MaxMempool:           defaultMaxMempool,
+		MaxOrphanPeerBytes:   mempool.DefaultMaxOrphanBytesPerTag,
+		BytesPerSigOp:        mempool.DefaultBytesPerSigOp,
+		DataCarrierSize:      txscript.MaxDataCarrierSize,
 		MaxOrphanTxs:         defaultMaxOrphanTransactions,
+		MempoolExpiry:        mempool.DefaultMaxTxAge,
+		RebroadcastInterval:  mempool.DefaultRebroadcastInterval,
+		LimitAncestorCount:   mempool.DefaultMaxAncestorCount,
+		LimitAncestorSize:    mempool.DefaultMaxAncestorSize,
+		LimitDescendantCount: mempool.DefaultMaxDescendantCount,
+		LimitDescendantSize:  mempool.DefaultMaxDescendantSize,
 		SigCacheMaxSize:      defaultSigCacheMaxSize,
+		UtxoCacheMaxSize:     defaultUtxoCacheMaxSizeMiB,
+		RecentBlockCacheSize: defaultRecentBlockCacheSize,
 		Generate:             defaultGenerate,
 		TxIndex:              defaultTxIndex,
 		AddrIndex:            defaultAddrIndex,
+		UnixSocketMode:       defaultUnixSocketMode,
 	}
 
 	// Service options which are only added on Windows.
@@ -559,6 +742,32 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Override the deployment schedule and rule change window of the
+	// active network when requested.  This is only allowed on the
+	// regression and simulation test networks.
+	if len(cfg.VBParams) > 0 {
+		err := applyDeploymentOverrides(activeNetParams.Params,
+			cfg.VBParams)
+		if err != nil {
+			str := "%s: Error applying vbparams: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+	if cfg.VBWindow != "" {
+		err := applyRuleChangeWindowOverride(activeNetParams.Params,
+			cfg.VBWindow)
+		if err != nil {
+			str := "%s: Error applying vbwindow: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
 	// Set the default policy for relaying non-standard transactions
 	// according to the default of the active network. The set
 	// configuration value takes precedence over the default value for the
@@ -579,6 +788,17 @@ func loadConfig() (*config, []string, error) {
 	}
 	cfg.RelayNonStd = relayNonStd
 
+	// Replacement transactions are only accepted when opted in to, so
+	// rejecting them as well is contradictory.
+	if cfg.AcceptReplacement && cfg.RejectReplacement {
+		str := "%s: acceptreplacement and rejectreplacement cannot be " +
+			"used together -- choose only one"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Append the network type to the data directory so it is "namespaced"
 	// per network.  In addition to the block database, there are other
 	// pieces of data that are saved to disk such as address manager state.
@@ -621,6 +841,37 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Memory-mapped reads are only supported by the ffldb backend.
+	if cfg.DbMmap && cfg.DbType != "ffldb" {
+		str := "%s: The --dbmmap option is only supported by the " +
+			"ffldb database type -- selected type [%v]"
+		err := fmt.Errorf(str, funcName, cfg.DbType)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The block file size and preallocation are only supported by the
+	// ffldb backend.  The offsets into the block files are 32 bits, so
+	// their size must be less than 4 GiB.
+	if (cfg.DbBlockFileSize != 0 || cfg.DbPrealloc) && cfg.DbType != "ffldb" {
+		str := "%s: The --dbblockfilesize and --dbprealloc options are " +
+			"only supported by the ffldb database type -- selected " +
+			"type [%v]"
+		err := fmt.Errorf(str, funcName, cfg.DbType)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.DbBlockFileSize >= 4096 {
+		str := "%s: The --dbblockfilesize option must be less than " +
+			"4096 MiB -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.DbBlockFileSize)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Validate profile port number
 	if cfg.Profile != "" {
 		profilePort, err := strconv.Atoi(cfg.Profile)
@@ -644,31 +895,16 @@ func loadConfig() (*config, []string, error) {
 
 	// Validate any given whitelisted IP addresses and networks.
 	if len(cfg.Whitelists) > 0 {
-		var ip net.IP
 		cfg.whitelists = make([]*net.IPNet, 0, len(cfg.Whitelists))
 
 		for _, addr := range cfg.Whitelists {
-			_, ipnet, err := net.ParseCIDR(addr)
-			if err != nil {
-				ip = net.ParseIP(addr)
-				if ip == nil {
-					str := "%s: The whitelist value of '%s' is invalid"
-					err = fmt.Errorf(str, funcName, addr)
-					fmt.Fprintln(os.Stderr, err)
-					fmt.Fprintln(os.Stderr, usageMessage)
-					return nil, nil, err
-				}
-				var bits int
-				if ip.To4() == nil {
-					// IPv6
-					bits = 128
-				} else {
-					bits = 32
-				}
-				ipnet = &net.IPNet{
-					IP:   ip,
-					Mask: net.CIDRMask(bits, bits),
-				}
+			ipnet := parseIPNet(addr)
+			if ipnet == nil {
+				str := "%s: The whitelist value of '%s' is invalid"
+				err := fmt.Errorf(str, funcName, addr)
+				fmt.Fprintln(os.Stderr, err)
+				fmt.Fprintln(os.Stderr, usageMessage)
+				return nil, nil, err
 			}
 			cfg.whitelists = append(cfg.whitelists, ipnet)
 		}
@@ -756,6 +992,75 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// The websocket subscription and filter limits may not be negative.  A
+	// value of 0 disables the respective limit.
+	if cfg.RPCMaxWSSubs < 0 {
+		str := "%s: The rpcmaxwssubscriptions option may not be less " +
+			"than 0 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.RPCMaxWSSubs)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.RPCMaxWSFilterSize < 0 {
+		str := "%s: The rpcmaxwsfiltersize option may not be less " +
+			"than 0 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.RPCMaxWSFilterSize)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Validate any given trusted reverse proxy IP addresses and networks.
+	if len(cfg.RPCTrustedProxies) > 0 {
+		cfg.rpcTrustedProxies = make([]*net.IPNet, 0,
+			len(cfg.RPCTrustedProxies))
+
+		for _, addr := range cfg.RPCTrustedProxies {
+			ipnet := parseIPNet(addr)
+			if ipnet == nil {
+				str := "%s: The rpctrustedproxy value of '%s' is " +
+					"invalid"
+				err := fmt.Errorf(str, funcName, addr)
+				fmt.Fprintln(os.Stderr, err)
+				fmt.Fprintln(os.Stderr, usageMessage)
+				return nil, nil, err
+			}
+			cfg.rpcTrustedProxies = append(cfg.rpcTrustedProxies, ipnet)
+		}
+	}
+
+	// Validate the allowed cross-origin request origins.  Origins are
+	// compared case-insensitively, so they are stored in lower case.
+	for i, origin := range cfg.RPCAllowOrigins {
+		origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+		if origin != "*" {
+			u, err := url.Parse(origin)
+			if err != nil || u.Scheme == "" || u.Host == "" ||
+				u.Path != "" || u.RawQuery != "" || u.Fragment != "" {
+
+				str := "%s: The rpcalloworigin value of '%s' is " +
+					"invalid -- origins must be of the form " +
+					"scheme://host[:port] or *"
+				err := fmt.Errorf(str, funcName,
+					cfg.RPCAllowOrigins[i])
+				fmt.Fprintln(os.Stderr, err)
+				fmt.Fprintln(os.Stderr, usageMessage)
+				return nil, nil, err
+			}
+		}
+		cfg.RPCAllowOrigins[i] = origin
+	}
+
+	// Normalize the RPC base path to start with a slash and to not end
+	// with one, so the root path is represented by the empty string.
+	if cfg.RPCBasePath != "" {
+		cfg.RPCBasePath = path.Clean("/" + cfg.RPCBasePath)
+		if cfg.RPCBasePath == "/" {
+			cfg.RPCBasePath = ""
+		}
+	}
+
 	// Validate the the minrelaytxfee.
 	cfg.minRelayTxFee, err = hdfutil.NewAmount(cfg.MinRelayTxFee)
 	if err != nil {
@@ -766,6 +1071,39 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Validate the mining template options.
+	cfg.miningCoinbaseData, err = hex.DecodeString(cfg.MiningCoinbaseData)
+	if err != nil {
+		str := "%s: invalid miningcoinbasedata: %v"
+		err := fmt.Errorf(str, funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	cfg.miningMinTxFee, err = hdfutil.NewAmount(cfg.MiningMinTxFee)
+	if err == nil && cfg.miningMinTxFee < 0 {
+		err = errors.New("fee rate may not be negative")
+	}
+	if err != nil {
+		str := "%s: invalid miningmintxfee: %v"
+		err := fmt.Errorf(str, funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	for _, bit := range cfg.MiningVersionBits {
+		if bit >= mining.NumVersionBits {
+			str := "%s: the miningversionbit option must be less " +
+				"than %d -- parsed [%d]"
+			err := fmt.Errorf(str, funcName, mining.NumVersionBits,
+				bit)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.miningVersionBits |= 1 << bit
+	}
+
 	// Limit the max block size to a sane value.
 	if cfg.BlockMaxSize < blockMaxSizeMin || cfg.BlockMaxSize >
 		blockMaxSizeMax {
@@ -792,6 +1130,16 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// The maximum mempool size may not be negative.
+	if cfg.MaxMempool < 0 {
+		str := "%s: The maxmempool option may not be less than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxMempool)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Limit the max orphan count to a sane vlue.
 	if cfg.MaxOrphanTxs < 0 {
 		str := "%s: The maxorphantx option may not be less than 0 " +
@@ -802,6 +1150,109 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// The maximum size of the orphans of a single peer may not be negative.
+	if cfg.MaxOrphanPeerBytes < 0 {
+		str := "%s: The maxorphanpeerbytes option may not be less " +
+			"than 0 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxOrphanPeerBytes)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The upload rate limit of all peers may not be negative.
+	if cfg.MaxUploadRate < 0 {
+		str := "%s: The maxuploadrate option may not be less " +
+			"than 0 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxUploadRate)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The download rate limit of all peers may not be negative.
+	if cfg.MaxDownloadRate < 0 {
+		str := "%s: The maxdownloadrate option may not be less " +
+			"than 0 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxDownloadRate)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The upload rate limit of each peer may not be negative.
+	if cfg.PeerMaxUploadRate < 0 {
+		str := "%s: The peermaxuploadrate option may not be less " +
+			"than 0 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.PeerMaxUploadRate)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The download rate limit of each peer may not be negative.
+	if cfg.PeerMaxDownloadRate < 0 {
+		str := "%s: The peermaxdownloadrate option may not be less " +
+			"than 0 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.PeerMaxDownloadRate)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The number of bytes per signature operation may not be negative.
+	if cfg.BytesPerSigOp < 0 {
+		str := "%s: The bytespersigop option may not be less than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.BytesPerSigOp)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The maximum size of the data carried by null data outputs may not be
+	// negative.
+	if cfg.DataCarrierSize < 0 {
+		str := "%s: The datacarriersize option may not be less than " +
+			"0 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.DataCarrierSize)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The mempool expiry and rebroadcast interval may not be negative.  A
+	// value of 0 disables expiry and rebroadcasting, respectively.
+	if cfg.MempoolExpiry < 0 {
+		str := "%s: The mempoolexpiry option may not be less than 0 " +
+			"-- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.MempoolExpiry)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.RebroadcastInterval < 0 {
+		str := "%s: The rebroadcastinterval option may not be less " +
+			"than 0 -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.RebroadcastInterval)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Ensure the mempool package limits are sane.
+	if cfg.LimitAncestorCount < 0 || cfg.LimitAncestorSize < 0 ||
+		cfg.LimitDescendantCount < 0 || cfg.LimitDescendantSize < 0 {
+
+		str := "%s: The limitancestorcount, limitancestorsize, " +
+			"limitdescendantcount, and limitdescendantsize options " +
+			"may not be less than 0"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Limit the block priority and minimum block sizes to max block size.
 	cfg.BlockPrioritySize = minUint32(cfg.BlockPrioritySize, cfg.BlockMaxSize)
 	cfg.BlockMinSize = minUint32(cfg.BlockMinSize, cfg.BlockMaxSize)
@@ -868,6 +1319,138 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// --blockrelayconns must not be negative.
+	if cfg.BlockRelayConns < 0 {
+		err := fmt.Errorf("%s: the --blockrelayconns option may not be "+
+			"less than 0 -- parsed [%d]", funcName,
+			cfg.BlockRelayConns)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --peerrotateinterval must not cause outbound peers to be churned too
+	// frequently.
+	if cfg.PeerRotateInterval != 0 && cfg.PeerRotateInterval < time.Minute {
+		err := fmt.Errorf("%s: the --peerrotateinterval option must be "+
+			"at least 1m when enabled -- parsed [%v]", funcName,
+			cfg.PeerRotateInterval)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --prune must allow enough block data to be stored to keep the most
+	// recent blocks.
+	minPruneTargetMiB := uint64(blockchain.MinPruneTarget / (1024 * 1024))
+	if cfg.Prune != 0 && cfg.Prune < minPruneTargetMiB {
+		err := fmt.Errorf("%s: the --prune option must be at least "+
+			"%d MiB -- parsed [%d]", funcName, minPruneTargetMiB,
+			cfg.Prune)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --prune does not mix with the indexes since they rely on all blocks
+	// being available.
+	if cfg.Prune != 0 && (cfg.TxIndex || cfg.AddrIndex) {
+		err := fmt.Errorf("%s: the --prune option may not be "+
+			"activated at the same time as the --txindex or "+
+			"--addrindex options", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --utxosnapshot does not mix with the indexes since they rely on all
+	// blocks being available.
+	if cfg.UTXOSnapshot != "" && (cfg.TxIndex || cfg.AddrIndex ||
+		!cfg.NoCFilters) {
+
+		err := fmt.Errorf("%s: the --utxosnapshot option may not be "+
+			"activated at the same time as the --txindex or "+
+			"--addrindex options and requires the --nocfilters "+
+			"option", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.UTXOSnapshot != "" {
+		cfg.UTXOSnapshot = cleanAndExpandPath(cfg.UTXOSnapshot)
+	}
+	if cfg.ASMap != "" {
+		cfg.ASMap = cleanAndExpandPath(cfg.ASMap)
+	}
+
+	// --headersonly does not mix with the options which rely on the blocks
+	// being downloaded.
+	if cfg.HeadersOnly && (cfg.Generate || cfg.Prune != 0 ||
+		cfg.UTXOSnapshot != "" || cfg.TxIndex || cfg.AddrIndex) {
+
+		err := fmt.Errorf("%s: the --headersonly option may not be "+
+			"activated at the same time as the --generate, --prune, "+
+			"--utxosnapshot, --txindex or --addrindex options",
+			funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.HeadersOnly {
+		cfg.BlocksOnly = true
+		cfg.NoCFilters = true
+	}
+
+	// --synccfheaders requires --headersonly.
+	if cfg.SyncCFHeaders && !cfg.HeadersOnly {
+		err := fmt.Errorf("%s: the --synccfheaders option requires "+
+			"the --headersonly option", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Parse the trusted utxo set hash of the snapshot when specified.
+	if cfg.UTXOSnapshotHash != "" {
+		if cfg.UTXOSnapshot == "" {
+			str := "%s: the --utxosnapshothash option requires the " +
+				"--utxosnapshot option"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		hash, err := chainhash.NewHashFromStr(cfg.UTXOSnapshotHash)
+		if err != nil {
+			str := "%s: the --utxosnapshothash option is not a " +
+				"valid hash: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.utxoSnapshotHash = hash
+	}
+
+	// Check the additional bulletin keys are valid public keys and save
+	// the serialized versions.
+	cfg.bulletinKeys = make([][]byte, 0, len(cfg.BulletinKeys))
+	for _, strKey := range cfg.BulletinKeys {
+		serializedKey, err := hex.DecodeString(strKey)
+		if err == nil {
+			_, err = hdfec.ParsePubKey(serializedKey, hdfec.S256())
+		}
+		if err != nil {
+			str := "%s: the bulletin key '%s' is not a valid public " +
+				"key: %v"
+			err := fmt.Errorf(str, funcName, strKey, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.bulletinKeys = append(cfg.bulletinKeys, serializedKey)
+	}
+
 	// Check mining addresses are valid and saved parsed versions.
 	cfg.miningAddrs = make([]hdfutil.Address, 0, len(cfg.MiningAddrs))
 	for _, strAddr := range cfg.MiningAddrs {
@@ -940,6 +1523,25 @@ func loadConfig() (*config, []string, error) {
 		}
 	}
 
+	// Expand the unix domain socket paths and validate the permission mode
+	// used when creating them.
+	for i, path := range cfg.UnixListeners {
+		cfg.UnixListeners[i] = cleanAndExpandPath(path)
+	}
+	for i, path := range cfg.RPCUnixListeners {
+		cfg.RPCUnixListeners[i] = cleanAndExpandPath(path)
+	}
+	unixSocketMode, err := strconv.ParseUint(cfg.UnixSocketMode, 8, 32)
+	if err != nil || os.FileMode(unixSocketMode)&^os.ModePerm != 0 {
+		str := "%s: the unixsocketmode option is not a valid octal " +
+			"permission mode: %v"
+		err := fmt.Errorf(str, funcName, cfg.UnixSocketMode)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	cfg.unixSocketMode = os.FileMode(unixSocketMode)
+
 	// Add default port to all added peer addresses if needed and remove
 	// duplicate addresses.
 	cfg.AddPeers = normalizeAddresses(cfg.AddPeers,
@@ -966,6 +1568,54 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Parse how the checkpoints are used.
+	switch cfg.CheckpointMode {
+	case "enforce":
+		cfg.checkpointMode = blockchain.CheckpointsEnforced
+	case "advisory":
+		cfg.checkpointMode = blockchain.CheckpointsAdvisory
+	default:
+		str := "%s: The specified checkpoint mode [%v] is invalid -- " +
+			"supported modes {enforce, advisory}"
+		err := fmt.Errorf(str, funcName, cfg.CheckpointMode)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Parse the assumed valid block override.  A zero hash disables the
+	// assumption.
+	switch cfg.AssumeValid {
+	case "":
+	case "0":
+		cfg.assumeValid = &chaincfg.Checkpoint{Hash: &chainhash.Hash{}}
+	default:
+		assumeValid, err := newCheckpointFromStr(cfg.AssumeValid)
+		if err != nil {
+			str := "%s: Error parsing assumevalid: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.assumeValid = &assumeValid
+	}
+
+	// Parse the minimum chain work override.
+	if cfg.MinimumChainWork != "" {
+		workStr := strings.TrimPrefix(cfg.MinimumChainWork, "0x")
+		work, ok := new(big.Int).SetString(workStr, 16)
+		if !ok || work.Sign() < 0 {
+			str := "%s: The minimumchainwork option must be a " +
+				"non-negative hex number -- parsed [%v]"
+			err := fmt.Errorf(str, funcName, cfg.MinimumChainWork)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.minimumChainWork = work
+	}
+
 	// Tor stream isolation requires either proxy or onion proxy to be set.
 	if cfg.TorIsolation && cfg.Proxy == "" && cfg.OnionProxy == "" {
 		str := "%s: Tor stream isolation requires either proxy or " +
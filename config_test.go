@@ -7,6 +7,8 @@ import (
 	"regexp"
 	"runtime"
 	"testing"
+
+	"github.com/ifishnet/hdfd/chaincfg"
 )
 
 var (
@@ -70,3 +72,63 @@ func TestCreateDefaultConfigFile(t *testing.T) {
 		t.Error("Could not find rpcpass in generated default config file.")
 	}
 }
+
+// TestConsensusOverrides ensures the deployment schedule and rule change window
+// overrides are parsed and applied as expected.
+func TestConsensusOverrides(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+
+	err := applyDeploymentOverrides(&params, []string{"csv:10:20",
+		"SegWit:30:40"})
+	if err != nil {
+		t.Fatalf("applyDeploymentOverrides: unexpected error: %v", err)
+	}
+	csv := params.Deployments[chaincfg.DeploymentCSV]
+	segwit := params.Deployments[chaincfg.DeploymentSegwit]
+	if csv.StartTime != 10 || csv.ExpireTime != 20 ||
+		segwit.StartTime != 30 || segwit.ExpireTime != 40 {
+
+		t.Errorf("applyDeploymentOverrides: unexpected deployments: "+
+			"csv %+v, segwit %+v", csv, segwit)
+	}
+
+	badOverrides := []string{"csv:10", "taproot:10:20", "csv:a:20",
+		"csv:10:b", "csv:20:10"}
+	for _, override := range badOverrides {
+		err := applyDeploymentOverrides(&params, []string{override})
+		if err == nil {
+			t.Errorf("applyDeploymentOverrides: did not reject %q",
+				override)
+		}
+	}
+
+	err = applyRuleChangeWindowOverride(&params, "108:144")
+	if err != nil {
+		t.Fatalf("applyRuleChangeWindowOverride: unexpected error: %v",
+			err)
+	}
+	if params.RuleChangeActivationThreshold != 108 ||
+		params.MinerConfirmationWindow != 144 {
+
+		t.Errorf("applyRuleChangeWindowOverride: got threshold %d, "+
+			"window %d -- want threshold 108, window 144",
+			params.RuleChangeActivationThreshold,
+			params.MinerConfirmationWindow)
+	}
+
+	for _, override := range []string{"108", "a:144", "108:b", "145:144"} {
+		err := applyRuleChangeWindowOverride(&params, override)
+		if err == nil {
+			t.Errorf("applyRuleChangeWindowOverride: did not reject %q",
+				override)
+		}
+	}
+
+	// Ensure overrides are rejected on the main network.
+	mainParams := chaincfg.MainNetParams
+	err = applyDeploymentOverrides(&mainParams, []string{"csv:10:20"})
+	if err != chaincfg.ErrOverrideNotAllowed {
+		t.Errorf("applyDeploymentOverrides: unexpected error on mainnet "+
+			"-- got %v, want %v", err, chaincfg.ErrOverrideNotAllowed)
+	}
+}
@@ -0,0 +1,315 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package connmgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// banListVersion is the version of the format the ban list is persisted in.
+const banListVersion = 1
+
+// Ban describes a banned subnet.  Bans of single IP addresses are represented
+// by subnets which only contain that address.
+type Ban struct {
+	// Subnet is the banned subnet.
+	Subnet *net.IPNet
+
+	// Created is the time the ban was created.
+	Created time.Time
+
+	// Expires is the time the ban expires.
+	Expires time.Time
+}
+
+// serializedBan is the format a ban is persisted in.
+type serializedBan struct {
+	Subnet  string `json:"subnet"`
+	Created int64  `json:"created"`
+	Expires int64  `json:"expires"`
+}
+
+// serializedBanList is the format the ban list is persisted in.
+type serializedBanList struct {
+	Version int             `json:"version"`
+	Bans    []serializedBan `json:"bans"`
+}
+
+// BanManager keeps track of the banned IP addresses and subnets along with the
+// times their bans expire.  The bans are saved to a file whenever they change
+// so they persist across restarts.
+type BanManager struct {
+	mtx  sync.Mutex
+	path string
+	bans map[string]*Ban
+}
+
+// ParseSubnet parses the passed IP address or subnet in CIDR notation, such as
+// 192.168.0.1, 192.168.0.0/16, ::1 or 2001:db8::/32.  IP addresses are returned
+// as subnets which only contain that address.
+func ParseSubnet(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", s)
+		}
+		return IPSubnet(ip), nil
+	}
+
+	_, subnet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subnet %q", s)
+	}
+	return subnet, nil
+}
+
+// IPSubnet returns the subnet which only contains the passed IP address.
+func IPSubnet(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip.To16(), Mask: net.CIDRMask(128, 128)}
+}
+
+// NewBanManager returns a new ban manager which saves the bans to the passed
+// file.  The bans are only kept in memory when the path is empty.  Use Load to
+// load the bans saved by a previous run.
+func NewBanManager(path string) *BanManager {
+	return &BanManager{
+		path: path,
+		bans: make(map[string]*Ban),
+	}
+}
+
+// Load loads the bans from the file of the ban manager, replacing the current
+// ones.  Bans which expired in the meantime are discarded.  It is not an error
+// when the file does not exist.
+//
+// This function is safe for concurrent access.
+func (bm *BanManager) Load() error {
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	if bm.path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(bm.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var banList serializedBanList
+	if err := json.Unmarshal(data, &banList); err != nil {
+		return fmt.Errorf("unable to decode ban list %s: %v", bm.path,
+			err)
+	}
+	if banList.Version != banListVersion {
+		return fmt.Errorf("unknown version %d of ban list %s",
+			banList.Version, bm.path)
+	}
+
+	now := time.Now()
+	bans := make(map[string]*Ban, len(banList.Bans))
+	for _, sb := range banList.Bans {
+		subnet, err := ParseSubnet(sb.Subnet)
+		if err != nil {
+			return fmt.Errorf("unable to decode ban list %s: %v",
+				bm.path, err)
+		}
+		ban := &Ban{
+			Subnet:  subnet,
+			Created: time.Unix(sb.Created, 0),
+			Expires: time.Unix(sb.Expires, 0),
+		}
+		if !ban.Expires.After(now) {
+			continue
+		}
+		bans[subnet.String()] = ban
+	}
+	bm.bans = bans
+
+	log.Infof("Loaded %d bans from %s", len(bans), bm.path)
+	return nil
+}
+
+// save writes the bans which have not expired to the file of the ban manager.
+// The file is replaced atomically so it is never left partially written.
+//
+// This function MUST be called with the ban manager lock held.
+func (bm *BanManager) save() error {
+	if bm.path == "" {
+		return nil
+	}
+
+	now := time.Now()
+	banList := serializedBanList{
+		Version: banListVersion,
+		Bans:    make([]serializedBan, 0, len(bm.bans)),
+	}
+	for _, ban := range bm.sortedBans() {
+		if !ban.Expires.After(now) {
+			continue
+		}
+		banList.Bans = append(banList.Bans, serializedBan{
+			Subnet:  ban.Subnet.String(),
+			Created: ban.Created.Unix(),
+			Expires: ban.Expires.Unix(),
+		})
+	}
+	data, err := json.MarshalIndent(&banList, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := bm.path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, bm.path)
+}
+
+// sortedBans returns the bans ordered by their subnets.
+//
+// This function MUST be called with the ban manager lock held.
+func (bm *BanManager) sortedBans() []*Ban {
+	bans := make([]*Ban, 0, len(bm.bans))
+	for _, ban := range bm.bans {
+		bans = append(bans, ban)
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Subnet.String() < bans[j].Subnet.String()
+	})
+	return bans
+}
+
+// pruneExpired removes the bans which have expired.
+//
+// This function MUST be called with the ban manager lock held.
+func (bm *BanManager) pruneExpired() {
+	now := time.Now()
+	for key, ban := range bm.bans {
+		if !ban.Expires.After(now) {
+			log.Infof("Ban of %s expired", key)
+			delete(bm.bans, key)
+		}
+	}
+}
+
+// Ban bans the passed subnet until the passed time, replacing any existing
+// ban of the same subnet, and saves the bans.
+//
+// This function is safe for concurrent access.
+func (bm *BanManager) Ban(subnet *net.IPNet, expires time.Time) error {
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	bm.bans[subnet.String()] = &Ban{
+		Subnet:  subnet,
+		Created: time.Now(),
+		Expires: expires,
+	}
+	return bm.save()
+}
+
+// BanIP bans the passed IP address for the passed duration and saves the bans.
+//
+// This function is safe for concurrent access.
+func (bm *BanManager) BanIP(ip net.IP, duration time.Duration) error {
+	return bm.Ban(IPSubnet(ip), time.Now().Add(duration))
+}
+
+// Unban removes the ban of the passed subnet and saves the bans.  It returns
+// whether the subnet was banned.  Bans of other subnets containing it are not
+// affected.
+//
+// This function is safe for concurrent access.
+func (bm *BanManager) Unban(subnet *net.IPNet) (bool, error) {
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	bm.pruneExpired()
+	key := subnet.String()
+	if _, ok := bm.bans[key]; !ok {
+		return false, nil
+	}
+	delete(bm.bans, key)
+	return true, bm.save()
+}
+
+// IsBanned returns whether the passed subnet has been banned.  Unlike
+// BanExpiry, it only considers bans of that exact subnet.
+//
+// This function is safe for concurrent access.
+func (bm *BanManager) IsBanned(subnet *net.IPNet) bool {
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	bm.pruneExpired()
+	_, ok := bm.bans[subnet.String()]
+	return ok
+}
+
+// BanExpiry returns the time the ban of the passed IP address expires along
+// with whether it is banned at all.  The address is banned when any of the
+// banned subnets contains it, in which case the latest expiry of them is
+// returned.
+//
+// This function is safe for concurrent access.
+func (bm *BanManager) BanExpiry(ip net.IP) (time.Time, bool) {
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	bm.pruneExpired()
+	var expires time.Time
+	var banned bool
+	for _, ban := range bm.bans {
+		if ban.Subnet.Contains(ip) {
+			if !banned || ban.Expires.After(expires) {
+				expires = ban.Expires
+			}
+			banned = true
+		}
+	}
+	return expires, banned
+}
+
+// Bans returns the bans which have not expired ordered by their subnets.
+//
+// This function is safe for concurrent access.
+func (bm *BanManager) Bans() []Ban {
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	bm.pruneExpired()
+	sorted := bm.sortedBans()
+	bans := make([]Ban, 0, len(sorted))
+	for _, ban := range sorted {
+		bans = append(bans, *ban)
+	}
+	return bans
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package connmgr
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestParseSubnet ensures IP addresses and subnets are parsed properly.
+func TestParseSubnet(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in       string
+		expected string
+		valid    bool
+	}{
+		{in: "192.168.0.1", expected: "192.168.0.1/32", valid: true},
+		{in: "192.168.1.1/16", expected: "192.168.0.0/16", valid: true},
+		{in: "::1", expected: "::1/128", valid: true},
+		{in: "2001:db8::1/32", expected: "2001:db8::/32", valid: true},
+		{in: "::ffff:10.0.0.1", expected: "10.0.0.1/32", valid: true},
+		{in: "192.168.0.256", valid: false},
+		{in: "192.168.0.0/33", valid: false},
+		{in: "example.com", valid: false},
+	}
+	for _, test := range tests {
+		subnet, err := ParseSubnet(test.in)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("%s: invalid subnet was accepted", test.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.in, err)
+			continue
+		}
+		if subnet.String() != test.expected {
+			t.Errorf("%s: unexpected subnet %s, want %s", test.in,
+				subnet, test.expected)
+		}
+	}
+}
+
+// TestBanManager ensures the ban manager bans IP addresses and subnets, lets
+// the bans expire and persists them across restarts.
+func TestBanManager(t *testing.T) {
+	t.Parallel()
+
+	tempDir, err := ioutil.TempDir("", "banmanager")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, "banlist.json")
+
+	bm := NewBanManager(path)
+	if err := bm.Load(); err != nil {
+		t.Fatalf("unable to load missing ban list: %v", err)
+	}
+
+	subnet, _ := ParseSubnet("10.0.0.0/8")
+	subnetExpires := time.Now().Add(time.Hour)
+	if err := bm.Ban(subnet, subnetExpires); err != nil {
+		t.Fatalf("unable to ban subnet: %v", err)
+	}
+	if err := bm.BanIP(net.ParseIP("10.1.2.3"), 2*time.Hour); err != nil {
+		t.Fatalf("unable to ban IP: %v", err)
+	}
+	expired, _ := ParseSubnet("192.168.0.1")
+	if err := bm.Ban(expired, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("unable to ban IP: %v", err)
+	}
+
+	if !bm.IsBanned(subnet) || bm.IsBanned(expired) {
+		t.Fatal("unexpected ban state of subnets")
+	}
+	if expires, ok := bm.BanExpiry(net.ParseIP("10.9.9.9")); !ok ||
+		expires.Unix() != subnetExpires.Unix() {
+
+		t.Fatalf("unexpected ban expiry %v (banned %v)", expires, ok)
+	}
+	expires, ok := bm.BanExpiry(net.ParseIP("10.1.2.3"))
+	if !ok || !expires.After(subnetExpires) {
+		t.Fatalf("unexpected ban expiry %v (banned %v)", expires, ok)
+	}
+	for _, ip := range []string{"11.0.0.1", "192.168.0.1", "::1"} {
+		if _, ok := bm.BanExpiry(net.ParseIP(ip)); ok {
+			t.Fatalf("%s is unexpectedly banned", ip)
+		}
+	}
+
+	// Only the bans which have not expired are persisted.
+	bm = NewBanManager(path)
+	if err := bm.Load(); err != nil {
+		t.Fatalf("unable to load ban list: %v", err)
+	}
+	bans := bm.Bans()
+	if len(bans) != 2 || bans[0].Subnet.String() != "10.0.0.0/8" ||
+		bans[1].Subnet.String() != "10.1.2.3/32" {
+
+		t.Fatalf("unexpected bans after reload %v", bans)
+	}
+	if bans[0].Expires.Unix() != subnetExpires.Unix() ||
+		bans[0].Created.After(time.Now()) {
+
+		t.Fatalf("unexpected times of ban after reload %+v", bans[0])
+	}
+
+	// Unbanning an IP address does not affect the subnets containing it.
+	ipSubnet, _ := ParseSubnet("10.1.2.3")
+	if ok, err := bm.Unban(ipSubnet); !ok || err != nil {
+		t.Fatalf("unable to unban IP (unbanned %v): %v", ok, err)
+	}
+	if ok, err := bm.Unban(ipSubnet); ok || err != nil {
+		t.Fatalf("unexpected unban of unbanned IP (unbanned %v): %v",
+			ok, err)
+	}
+	if _, ok := bm.BanExpiry(net.ParseIP("10.1.2.3")); !ok {
+		t.Fatal("IP in banned subnet is not banned")
+	}
+	if ok, err := bm.Unban(subnet); !ok || err != nil {
+		t.Fatalf("unable to unban subnet (unbanned %v): %v", ok, err)
+	}
+
+	bm = NewBanManager(path)
+	if err := bm.Load(); err != nil {
+		t.Fatalf("unable to load ban list: %v", err)
+	}
+	if bans := bm.Bans(); len(bans) != 0 {
+		t.Fatalf("unexpected bans after unbanning %v", bans)
+	}
+}
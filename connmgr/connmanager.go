@@ -53,13 +53,18 @@ const (
 )
 
 // ConnReq is the connection request to a network address. If permanent, the
-// connection will be retried on disconnection.
+// connection will be retried on disconnection.  If block-relay-only, the
+// connection is only used to relay blocks and is maintained separately from
+// the full-relay connections.  If feeler, the connection is only made to test
+// whether the address is reachable and is never retried or replaced.
 type ConnReq struct {
 	// The following variables must only be used atomically.
 	id uint64
 
-	Addr      net.Addr
-	Permanent bool
+	Addr           net.Addr
+	Permanent      bool
+	BlockRelayOnly bool
+	Feeler         bool
 
 	conn       net.Conn
 	state      ConnState
@@ -124,6 +129,29 @@ type Config struct {
 	// maintain. Defaults to 8.
 	TargetOutbound uint32
 
+	// TargetBlockRelayOnly is the number of outbound block-relay-only
+	// connections to maintain in addition to TargetOutbound.  Those
+	// connections do not relay transactions or addresses, which makes it
+	// harder for an attacker to learn about them and isolate the node from
+	// the rest of the network.  Defaults to 0.
+	TargetBlockRelayOnly uint32
+
+	// ExtraBlockRelayInterval is the interval at which an extra
+	// block-relay-only connection is made once all TargetBlockRelayOnly
+	// connections are established, so the node learns about blocks its
+	// other peers may not be announcing.  It is the caller's
+	// responsibility to disconnect either the extra connection or one of
+	// the others afterwards.  Zero disables the extra connections.
+	ExtraBlockRelayInterval time.Duration
+
+	// FeelerInterval is the interval at which a feeler connection is made
+	// to an address returned by GetFeelerAddress once all TargetOutbound
+	// connections are established.  Feeler connections do not count
+	// toward TargetOutbound and only one is made at a time.  It is the
+	// caller's responsibility to disconnect them once the address is known
+	// to be reachable.  Zero disables feeler connections.
+	FeelerInterval time.Duration
+
 	// RetryDuration is the duration to wait before retrying connection
 	// requests. Defaults to 5s.
 	RetryDuration time.Duration
@@ -140,6 +168,19 @@ type Config struct {
 	// to.  If nil, no new connections will be made automatically.
 	GetNewAddress func() (net.Addr, error)
 
+	// GetFeelerAddress is a way to get an address to make a feeler
+	// connection to.  It typically returns an address which was never
+	// connected to before.  If nil, no feeler connections will be made.
+	GetFeelerAddress func() (net.Addr, error)
+
+	// GetAnchors returns the addresses to connect to when the connection
+	// manager is started, before any addresses are requested from
+	// GetNewAddress.  They typically are the addresses of peers the node
+	// was connected to before it was restarted.  The connections count
+	// toward TargetOutbound and are not retried should they fail.  It may
+	// be nil.
+	GetAnchors func() []net.Addr
+
 	// Dial connects to the address on the named network. It cannot be nil.
 	Dial func(net.Addr) (net.Conn, error)
 }
@@ -211,14 +252,59 @@ func (cm *ConnManager) handleFailedConn(c *ConnReq) {
 				"-- retrying connection in: %v", maxFailedAttempts,
 				cm.cfg.RetryDuration)
 			time.AfterFunc(cm.cfg.RetryDuration, func() {
-				cm.NewConnReq()
+				cm.newConnReq(&ConnReq{
+					BlockRelayOnly: c.BlockRelayOnly,
+				}, cm.cfg.GetNewAddress)
 			})
 		} else {
-			go cm.NewConnReq()
+			go cm.newConnReq(&ConnReq{
+				BlockRelayOnly: c.BlockRelayOnly,
+			}, cm.cfg.GetNewAddress)
 		}
 	}
 }
 
+// countActive returns the number of connection requests in the passed map
+// which match the passed function and are either established or being
+// attempted.
+func countActive(reqs map[uint64]*ConnReq, match func(*ConnReq) bool) uint32 {
+	var count uint32
+	for _, c := range reqs {
+		if !match(c) {
+			continue
+		}
+		switch c.State() {
+		case ConnPending, ConnEstablished:
+			count++
+		}
+	}
+	return count
+}
+
+// countBlockRelayOnly returns the number of block-relay-only connection
+// requests in the passed map which are either established or being attempted.
+func countBlockRelayOnly(reqs map[uint64]*ConnReq) uint32 {
+	return countActive(reqs, func(c *ConnReq) bool {
+		return c.BlockRelayOnly
+	})
+}
+
+// countFeelers returns the number of feeler connection requests in the passed
+// map which are either established or being attempted.
+func countFeelers(reqs map[uint64]*ConnReq) uint32 {
+	return countActive(reqs, func(c *ConnReq) bool {
+		return c.Feeler
+	})
+}
+
+// countFullRelay returns the number of full-relay connection requests in the
+// passed map which are either established or being attempted.
+func countFullRelay(reqs map[uint64]*ConnReq) uint32 {
+	return countActive(reqs, func(c *ConnReq) bool {
+		return !c.BlockRelayOnly && !c.Feeler
+	})
+}
+
 // connHandler handles all connection related requests.  It must be run as a
 // goroutine.
 //
@@ -236,6 +322,24 @@ func (cm *ConnManager) connHandler() {
 		conns = make(map[uint64]*ConnReq, cm.cfg.TargetOutbound)
 	)
 
+	// Periodically make an extra block-relay-only connection when enabled.
+	var extraBlockRelayChan <-chan time.Time
+	if cm.cfg.ExtraBlockRelayInterval > 0 &&
+		cm.cfg.TargetBlockRelayOnly > 0 && cm.cfg.GetNewAddress != nil {
+
+		extraBlockRelayTicker := time.NewTicker(cm.cfg.ExtraBlockRelayInterval)
+		defer extraBlockRelayTicker.Stop()
+		extraBlockRelayChan = extraBlockRelayTicker.C
+	}
+
+	// Periodically make a feeler connection when enabled.
+	var feelerChan <-chan time.Time
+	if cm.cfg.FeelerInterval > 0 && cm.cfg.GetFeelerAddress != nil {
+		feelerTicker := time.NewTicker(cm.cfg.FeelerInterval)
+		defer feelerTicker.Stop()
+		feelerChan = feelerTicker.C
+	}
+
 out:
 	for {
 		select {
@@ -317,19 +421,36 @@ out:
 				}
 
 				// Otherwise, we will attempt a reconnection if
-				// we do not have enough peers, or if this is a
-				// persistent peer. The connection request is
-				// re added to the pending map, so that
-				// subsequent processing of connections and
+				// this is a persistent peer. The connection
+				// request is re added to the pending map, so
+				// that subsequent processing of connections and
 				// failures do not ignore the request.
-				if uint32(len(conns)) < cm.cfg.TargetOutbound ||
-					connReq.Permanent {
-
+				if connReq.Permanent {
 					connReq.updateState(ConnPending)
 					log.Debugf("Reconnecting to %v",
 						connReq)
 					pending[msg.id] = connReq
 					cm.handleFailedConn(connReq)
+					continue
+				}
+
+				// Non-permanent requests are replaced by a new
+				// request of the same kind if we do not have
+				// enough peers of that kind.  Feeler requests
+				// are never replaced.
+				connReq.updateState(ConnDisconnected)
+				var needMore bool
+				switch {
+				case connReq.Feeler:
+				case connReq.BlockRelayOnly:
+					needMore = countBlockRelayOnly(conns) <
+						cm.cfg.TargetBlockRelayOnly
+				default:
+					needMore = countFullRelay(conns) <
+						cm.cfg.TargetOutbound
+				}
+				if needMore {
+					cm.handleFailedConn(connReq)
 				}
 
 			case handleFailed:
@@ -344,9 +465,60 @@ out:
 				connReq.updateState(ConnFailing)
 				log.Debugf("Failed to connect to %v: %v",
 					connReq, msg.err)
+
+				// Failed feeler and extra block-relay-only
+				// connections are not replaced.
+				if connReq.Feeler {
+					delete(pending, connReq.id)
+					continue
+				}
+				if connReq.BlockRelayOnly && !connReq.Permanent &&
+					countBlockRelayOnly(conns)+
+						countBlockRelayOnly(pending) >=
+						cm.cfg.TargetBlockRelayOnly {
+
+					delete(pending, connReq.id)
+					continue
+				}
 				cm.handleFailedConn(connReq)
 			}
 
+		case <-extraBlockRelayChan:
+			// Only make an extra connection once all of the
+			// block-relay-only connections are established and
+			// there is no other extra one, whether established or
+			// being attempted.  The request is registered as
+			// pending right away so it is counted by the next
+			// tick.
+			numBlockRelayOnly := countBlockRelayOnly(conns) +
+				countBlockRelayOnly(pending)
+			if countBlockRelayOnly(conns) < cm.cfg.TargetBlockRelayOnly ||
+				numBlockRelayOnly > cm.cfg.TargetBlockRelayOnly {
+
+				continue
+			}
+			log.Debugf("Making extra block-relay-only connection")
+			connReq := &ConnReq{BlockRelayOnly: true}
+			atomic.StoreUint64(&connReq.id,
+				atomic.AddUint64(&cm.connReqCount, 1))
+			connReq.updateState(ConnPending)
+			pending[connReq.id] = connReq
+			go cm.connectNew(connReq, cm.cfg.GetNewAddress)
+
+		case <-feelerChan:
+			// Only make a feeler connection once all of the
+			// full-relay connections are established, since new
+			// addresses are connected to anyway otherwise, and
+			// when no other one is being made.
+			if countFullRelay(conns) < cm.cfg.TargetOutbound ||
+				countFeelers(conns)+countFeelers(pending) != 0 {
+
+				continue
+			}
+			log.Debugf("Making feeler connection")
+			go cm.newConnReq(&ConnReq{Feeler: true},
+				cm.cfg.GetFeelerAddress)
+
 		case <-cm.quit:
 			break out
 		}
@@ -356,39 +528,62 @@ out:
 	log.Trace("Connection handler done")
 }
 
-// NewConnReq creates a new connection request and connects to the
-// corresponding address.
-func (cm *ConnManager) NewConnReq() {
-	if atomic.LoadInt32(&cm.stop) != 0 {
-		return
-	}
-	if cm.cfg.GetNewAddress == nil {
-		return
-	}
-
-	c := &ConnReq{}
-	atomic.StoreUint64(&c.id, atomic.AddUint64(&cm.connReqCount, 1))
-
-	// Submit a request of a pending connection attempt to the connection
-	// manager. By registering the id before the connection is even
-	// established, we'll be able to later cancel the connection via the
-	// Remove method.
+// register registers the passed connection request, which must already
+// have an id assigned, as a pending connection attempt with the connection
+// manager.  By registering the id before the connection is even established,
+// we'll be able to later cancel the connection via the Remove method.  It
+// returns false when the connection manager is shutting down.
+func (cm *ConnManager) register(c *ConnReq) bool {
 	done := make(chan struct{})
 	select {
 	case cm.requests <- registerPending{c, done}:
 	case <-cm.quit:
-		return
+		return false
 	}
 
 	// Wait for the registration to successfully add the pending conn req to
 	// the conn manager's internal state.
 	select {
 	case <-done:
+		return true
 	case <-cm.quit:
+		return false
+	}
+}
+
+// NewConnReq creates a new connection request and connects to the
+// corresponding address.
+func (cm *ConnManager) NewConnReq() {
+	cm.newConnReq(&ConnReq{}, cm.cfg.GetNewAddress)
+}
+
+// NewBlockRelayOnlyConnReq creates a new block-relay-only connection request
+// and connects to the corresponding address.
+func (cm *ConnManager) NewBlockRelayOnlyConnReq() {
+	cm.newConnReq(&ConnReq{BlockRelayOnly: true}, cm.cfg.GetNewAddress)
+}
+
+// newConnReq assigns an id to the passed new connection request, registers it
+// and connects to the address returned by the passed function.
+func (cm *ConnManager) newConnReq(c *ConnReq, getAddress func() (net.Addr, error)) {
+	if atomic.LoadInt32(&cm.stop) != 0 {
+		return
+	}
+	if getAddress == nil {
+		return
+	}
+
+	atomic.StoreUint64(&c.id, atomic.AddUint64(&cm.connReqCount, 1))
+	if !cm.register(c) {
 		return
 	}
+	cm.connectNew(c, getAddress)
+}
 
-	addr, err := cm.cfg.GetNewAddress()
+// connectNew connects to the address returned by the passed function for the
+// passed connection request, which must already be registered.
+func (cm *ConnManager) connectNew(c *ConnReq, getAddress func() (net.Addr, error)) {
+	addr, err := getAddress()
 	if err != nil {
 		select {
 		case cm.requests <- handleFailed{c, err}:
@@ -418,23 +613,7 @@ func (cm *ConnManager) Connect(c *ConnReq) {
 
 	if atomic.LoadUint64(&c.id) == 0 {
 		atomic.StoreUint64(&c.id, atomic.AddUint64(&cm.connReqCount, 1))
-
-		// Submit a request of a pending connection attempt to the
-		// connection manager. By registering the id before the
-		// connection is even established, we'll be able to later
-		// cancel the connection via the Remove method.
-		done := make(chan struct{})
-		select {
-		case cm.requests <- registerPending{c, done}:
-		case <-cm.quit:
-			return
-		}
-
-		// Wait for the registration to successfully add the pending
-		// conn req to the conn manager's internal state.
-		select {
-		case <-done:
-		case <-cm.quit:
+		if !cm.register(c) {
 			return
 		}
 	}
@@ -526,9 +705,34 @@ func (cm *ConnManager) Start() {
 		}
 	}
 
+	// Connect to the anchors first so they are not displaced by the
+	// addresses returned by GetNewAddress.  Their ids are assigned here, so
+	// they are accounted for when filling the remaining outbound slots.
+	if cm.cfg.GetAnchors != nil {
+		for _, addr := range cm.cfg.GetAnchors() {
+			if atomic.LoadUint64(&cm.connReqCount) >=
+				uint64(cm.cfg.TargetOutbound) {
+
+				break
+			}
+
+			c := &ConnReq{Addr: addr}
+			atomic.StoreUint64(&c.id,
+				atomic.AddUint64(&cm.connReqCount, 1))
+			go func() {
+				if cm.register(c) {
+					cm.Connect(c)
+				}
+			}()
+		}
+	}
+
 	for i := atomic.LoadUint64(&cm.connReqCount); i < uint64(cm.cfg.TargetOutbound); i++ {
 		go cm.NewConnReq()
 	}
+	for i := uint32(0); i < cm.cfg.TargetBlockRelayOnly; i++ {
+		go cm.NewBlockRelayOnlyConnReq()
+	}
 }
 
 // Wait blocks until the connection manager halts gracefully.
@@ -216,6 +216,231 @@ func TestTargetOutbound(t *testing.T) {
 	cmgr.Stop()
 }
 
+// TestAnchors tests that the anchors are connected to before any addresses are
+// requested from GetNewAddress and that they count toward the target number of
+// outbound connections.
+func TestAnchors(t *testing.T) {
+	anchors := []net.Addr{
+		&net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 18555},
+		&net.TCPAddr{IP: net.ParseIP("127.0.0.2"), Port: 18555},
+	}
+	newAddr := &net.TCPAddr{IP: net.ParseIP("127.0.0.3"), Port: 18555}
+	connected := make(chan *ConnReq)
+	cmgr, err := New(&Config{
+		TargetOutbound: 3,
+		Dial:           mockDialer,
+		GetNewAddress: func() (net.Addr, error) {
+			return newAddr, nil
+		},
+		GetAnchors: func() []net.Addr {
+			return anchors
+		},
+		OnConnection: func(c *ConnReq, conn net.Conn) {
+			connected <- c
+		},
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	cmgr.Start()
+	got := make(map[string]uint64)
+	for i := 0; i < 3; i++ {
+		c := <-connected
+		got[c.Addr.String()] = c.ID()
+	}
+	for i, addr := range anchors {
+		id, ok := got[addr.String()]
+		if !ok {
+			t.Fatalf("anchors: anchor %v was not connected", addr)
+		}
+		if id != uint64(i+1) {
+			t.Fatalf("anchors: anchor %v - want ID %v, got ID %v",
+				addr, i+1, id)
+		}
+	}
+	if _, ok := got[newAddr.String()]; !ok {
+		t.Fatalf("anchors: new address %v was not connected", newAddr)
+	}
+
+	select {
+	case c := <-connected:
+		t.Fatalf("anchors: got unexpected connection - %v", c.Addr)
+	case <-time.After(time.Millisecond):
+		break
+	}
+	cmgr.Stop()
+}
+
+// TestTargetBlockRelayOnly tests that the target number of block-relay-only
+// connections is maintained in addition to the full-relay ones and that they
+// are replaced by block-relay-only connections when disconnected.
+func TestTargetBlockRelayOnly(t *testing.T) {
+	connected := make(chan *ConnReq)
+	cmgr, err := New(&Config{
+		TargetOutbound:       2,
+		TargetBlockRelayOnly: 2,
+		Dial:                 mockDialer,
+		GetNewAddress: func() (net.Addr, error) {
+			return &net.TCPAddr{
+				IP:   net.ParseIP("127.0.0.1"),
+				Port: 18555,
+			}, nil
+		},
+		OnConnection: func(c *ConnReq, conn net.Conn) {
+			connected <- c
+		},
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	cmgr.Start()
+	var blockRelayOnly []*ConnReq
+	for i := 0; i < 4; i++ {
+		c := <-connected
+		if c.BlockRelayOnly {
+			blockRelayOnly = append(blockRelayOnly, c)
+		}
+	}
+	if len(blockRelayOnly) != 2 {
+		t.Fatalf("target block-relay-only: got %d block-relay-only "+
+			"connections, want 2", len(blockRelayOnly))
+	}
+
+	select {
+	case c := <-connected:
+		t.Fatalf("target block-relay-only: got unexpected connection - "+
+			"%v", c.Addr)
+	case <-time.After(time.Millisecond):
+		break
+	}
+
+	cmgr.Disconnect(blockRelayOnly[0].ID())
+	select {
+	case c := <-connected:
+		if !c.BlockRelayOnly {
+			t.Fatalf("target block-relay-only: got full-relay " +
+				"replacement connection")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("target block-relay-only: timeout waiting for " +
+			"replacement connection")
+	}
+	cmgr.Stop()
+}
+
+// TestExtraBlockRelayOnly tests that an extra block-relay-only connection is
+// made periodically once all block-relay-only connections are established, and
+// that no other one is made while it is connected.
+func TestExtraBlockRelayOnly(t *testing.T) {
+	connected := make(chan *ConnReq)
+	cmgr, err := New(&Config{
+		TargetOutbound:          1,
+		TargetBlockRelayOnly:    1,
+		ExtraBlockRelayInterval: time.Millisecond * 10,
+		Dial:                    mockDialer,
+		GetNewAddress: func() (net.Addr, error) {
+			return &net.TCPAddr{
+				IP:   net.ParseIP("127.0.0.1"),
+				Port: 18555,
+			}, nil
+		},
+		OnConnection: func(c *ConnReq, conn net.Conn) {
+			connected <- c
+		},
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	cmgr.Start()
+	for i := 0; i < 2; i++ {
+		<-connected
+	}
+
+	select {
+	case c := <-connected:
+		if !c.BlockRelayOnly {
+			t.Fatalf("extra block-relay-only: got full-relay " +
+				"extra connection")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("extra block-relay-only: timeout waiting for extra " +
+			"connection")
+	}
+
+	select {
+	case c := <-connected:
+		t.Fatalf("extra block-relay-only: got unexpected connection - "+
+			"%v", c.Addr)
+	case <-time.After(time.Millisecond * 50):
+		break
+	}
+	cmgr.Stop()
+}
+
+// TestFeeler tests that feeler connections are made periodically once all of
+// the outbound connections are established, that they do not count toward the
+// target number of outbound connections, and that only one is made at a time.
+func TestFeeler(t *testing.T) {
+	feelerAddr := &net.TCPAddr{IP: net.ParseIP("127.0.0.2"), Port: 18555}
+	connected := make(chan *ConnReq)
+	cmgr, err := New(&Config{
+		TargetOutbound: 1,
+		FeelerInterval: time.Millisecond * 10,
+		Dial:           mockDialer,
+		GetNewAddress: func() (net.Addr, error) {
+			return &net.TCPAddr{
+				IP:   net.ParseIP("127.0.0.1"),
+				Port: 18555,
+			}, nil
+		},
+		GetFeelerAddress: func() (net.Addr, error) {
+			return feelerAddr, nil
+		},
+		OnConnection: func(c *ConnReq, conn net.Conn) {
+			connected <- c
+		},
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	cmgr.Start()
+	if c := <-connected; c.Feeler {
+		t.Fatalf("feeler: got feeler connection before outbound one")
+	}
+
+	var feeler *ConnReq
+	select {
+	case feeler = <-connected:
+		if !feeler.Feeler || feeler.Addr.String() != feelerAddr.String() {
+			t.Fatalf("feeler: got unexpected connection - %v",
+				feeler.Addr)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("feeler: timeout waiting for feeler connection")
+	}
+
+	select {
+	case c := <-connected:
+		t.Fatalf("feeler: got unexpected connection - %v", c.Addr)
+	case <-time.After(time.Millisecond * 50):
+		break
+	}
+
+	// Another feeler connection is made once the previous one is
+	// disconnected rather than an outbound one replacing it.
+	cmgr.Disconnect(feeler.ID())
+	select {
+	case c := <-connected:
+		if !c.Feeler {
+			t.Fatalf("feeler: got unexpected connection - %v",
+				c.Addr)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("feeler: timeout waiting for feeler connection")
+	}
+	cmgr.Stop()
+}
+
 // TestRetryPermanent tests that permanent connection requests are retried.
 //
 // We make a permanent connection request using Connect, disconnect it using
@@ -73,6 +73,14 @@ CreateBucket, CreateBucketIfNotExists, and DeleteBucket functions work with
 buckets.  The ForEach function allows the caller to provide a function to be
 called with each key/value pair and nested bucket in the current bucket.
 
+Iterators
+
+The Iterator function on the Tx interface returns an iterator over a range of
+the key/value pairs in a bucket, which can be limited to the keys with a given
+prefix or between a start and limit key and returned in reverse order.  Unlike
+ForEach, an iterator only visits the key/value pairs in its range, which allows
+large buckets such as those of the indexes to be scanned efficiently.
+
 Metadata Bucket
 
 As discussed above, all of the functions which are used to manipulate key/value
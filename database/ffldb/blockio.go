@@ -13,8 +13,11 @@ import (
 	"fmt"
 	"hash/crc32"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/ifishnet/hdfd/chaincfg/chainhash"
@@ -39,8 +42,8 @@ const (
 	// write file, so there will typically be one more than this value open.
 	maxOpenFiles = 25
 
-	// maxBlockFileSize is the maximum size for each file used to store
-	// blocks.
+	// maxBlockFileSize is the default maximum size for each file used to
+	// store blocks.
 	//
 	// NOTE: The current code uses uint32 for all offsets, so this value
 	// must be less than 2^32 (4 GiB).  This is also why it's a typed
@@ -77,9 +80,41 @@ type filer interface {
 // lockableFile represents a block file on disk that has been opened for either
 // read or read/write access.  It also contains a read-write mutex to support
 // multiple concurrent readers.
+//
+// Read-only files may also be memory mapped when memory-mapped reads are
+// enabled in which case reads which are within the mapped region are served
+// from it instead of the file.
 type lockableFile struct {
 	sync.RWMutex
-	file filer
+	file   filer
+	mapped []byte
+}
+
+// readAt reads len(b) bytes from the file starting at the provided offset.  The
+// data is copied from the memory mapped region of the file when it covers the
+// requested bytes and otherwise read from the file.  The latter is the case for
+// files which are not mapped and for any data which was appended to the file
+// after it was mapped.
+//
+// This function MUST be called with the file lock held (reads).
+func (lf *lockableFile) readAt(b []byte, off int64) (int, error) {
+	if off >= 0 && off+int64(len(b)) <= int64(len(lf.mapped)) {
+		return copy(b, lf.mapped[off:]), nil
+	}
+	return lf.file.ReadAt(b, off)
+}
+
+// close unmaps the file when it is memory mapped and closes it.
+//
+// This function MUST be called with the file lock held (writes).
+func (lf *lockableFile) close() error {
+	if lf.mapped != nil {
+		if err := munmapFile(lf.mapped); err != nil {
+			log.Warnf("Failed to unmap block file: %v", err)
+		}
+		lf.mapped = nil
+	}
+	return lf.file.Close()
 }
 
 // writeCursor represents the current file and offset of the block file on disk
@@ -99,6 +134,15 @@ type writeCursor struct {
 	// curOffset is the offset in the current write block file where the
 	// next new block will be written.
 	curOffset uint32
+
+	// buf houses the block data which has been written at the end of the
+	// current write file from the viewpoint of the write cursor, but which
+	// is still buffered in memory.  It always ends at curOffset.
+	buf []byte
+
+	// allocOffset is the offset up to which disk space has been
+	// preallocated for the current write file.
+	allocOffset uint32
 }
 
 // blockStore houses information used to handle reading and writing blocks (and
@@ -116,6 +160,19 @@ type blockStore struct {
 	// override the value.
 	maxBlockFileSize uint32
 
+	// writeBufSize is the maximum number of bytes of block data which are
+	// buffered in memory before they are written to the current write
+	// file.  Zero disables buffering.
+	writeBufSize int
+
+	// syncPolicy specifies when the block files are synced to disk.
+	syncPolicy SyncPolicy
+
+	// preallocSize is the number of bytes the disk space of the current
+	// write file is preallocated in ahead of the written data.  Zero
+	// disables preallocation.
+	preallocSize uint32
+
 	// The following fields are related to the flat files which hold the
 	// actual blocks.   The number of open files is limited by maxOpenFiles.
 	//
@@ -164,6 +221,15 @@ type blockStore struct {
 	fileNumToLRUElem map[uint32]*list.Element
 	openBlockFiles   map[uint32]*lockableFile
 
+	// mmapReads specifies whether the read-only block files are memory
+	// mapped so reads from them do not require a system call.  The current
+	// write file is never mapped.
+	mmapReads bool
+
+	// locCache houses the most recently used block locations so repeated
+	// requests for the same blocks do not require block index lookups.
+	locCache *blockLocCache
+
 	// writeCursor houses the state for the current file and location that
 	// new blocks are written to.
 	writeCursor *writeCursor
@@ -259,6 +325,17 @@ func (s *blockStore) openFile(fileNum uint32) (*lockableFile, error) {
 	}
 	blockFile := &lockableFile{file: file}
 
+	// Memory map the file when memory-mapped reads are enabled.  Failure
+	// to map the file is not fatal since reads fall back to the file.
+	if s.mmapReads {
+		mapped, err := mmapFile(file)
+		if err != nil {
+			log.Debugf("Failed to memory map block file %d: %v",
+				fileNum, err)
+		}
+		blockFile.mapped = mapped
+	}
+
 	// Close the least recently used file if the file exceeds the max
 	// allowed open files.  This is not done until after the file open in
 	// case the file fails to open, there is no need to close any files.
@@ -280,7 +357,7 @@ func (s *blockStore) openFile(fileNum uint32) (*lockableFile, error) {
 		// any readers are currently reading from it so it's not closed
 		// out from under them.
 		oldBlockFile.Lock()
-		_ = oldBlockFile.file.Close()
+		_ = oldBlockFile.close()
 		oldBlockFile.Unlock()
 
 		delete(s.openBlockFiles, lruFileNum)
@@ -307,6 +384,42 @@ func (s *blockStore) deleteFile(fileNum uint32) error {
 	return nil
 }
 
+// closeFile closes the read-only file handle for the passed flat file number
+// when it is open and stops tracking it in the least recently used list.  It is
+// typically used prior to deleting the file.
+func (s *blockStore) closeFile(fileNum uint32) {
+	s.obfMutex.Lock()
+	defer s.obfMutex.Unlock()
+
+	blockFile, ok := s.openBlockFiles[fileNum]
+	if !ok {
+		return
+	}
+
+	s.lruMutex.Lock()
+	s.openBlocksLRU.Remove(s.fileNumToLRUElem[fileNum])
+	delete(s.fileNumToLRUElem, fileNum)
+	s.lruMutex.Unlock()
+
+	// Close the file under the write lock for the file in case any readers
+	// are currently reading from it so it's not closed out from under them.
+	blockFile.Lock()
+	_ = blockFile.close()
+	blockFile.Unlock()
+
+	delete(s.openBlockFiles, fileNum)
+}
+
+// fileSize returns the size of the flat block file for the passed file number.
+func (s *blockStore) fileSize(fileNum uint32) (uint64, error) {
+	st, err := os.Stat(blockFilePath(s.basePath, fileNum))
+	if err != nil {
+		return 0, makeDbErr(database.ErrDriverSpecific, err.Error(), err)
+	}
+
+	return uint64(st.Size()), nil
+}
+
 // blockFile attempts to return an existing file handle for the passed flat file
 // number if it is already open as well as marking it as most recently used.  It
 // will also open the file when it's not already open subject to the rules
@@ -372,11 +485,28 @@ func (s *blockStore) blockFile(fileNum uint32) (*lockableFile, error) {
 // The write cursor will be advanced the number of bytes actually written in the
 // event of failure.
 //
+// The data is buffered in memory instead when write buffering is enabled and it
+// fits into the buffer.  The buffered data is written to the file as needed to
+// make room for it.
+//
 // NOTE: This function MUST be called with the write cursor current file lock
 // held and must only be called during a write transaction so it is effectively
 // locked for writes.  Also, the write cursor current file must NOT be nil.
 func (s *blockStore) writeData(data []byte, fieldName string) error {
 	wc := s.writeCursor
+	if s.writeBufSize > 0 {
+		if len(wc.buf)+len(data) > s.writeBufSize {
+			if err := s.flushWriteBuf(); err != nil {
+				return err
+			}
+		}
+		if len(data) <= s.writeBufSize {
+			wc.buf = append(wc.buf, data...)
+			wc.curOffset += uint32(len(data))
+			return nil
+		}
+	}
+
 	n, err := wc.curFile.file.WriteAt(data, int64(wc.curOffset))
 	wc.curOffset += uint32(n)
 	if err != nil {
@@ -389,6 +519,67 @@ func (s *blockStore) writeData(data []byte, fieldName string) error {
 	return nil
 }
 
+// flushWriteBuf writes the block data which is buffered in memory to the
+// current write file.  The write cursor will be moved back to the end of the
+// data actually written in the event of failure.
+//
+// NOTE: This function MUST be called with the write cursor current file lock
+// held and must only be called during a write transaction so it is effectively
+// locked for writes.  Also, the write cursor current file must NOT be nil.
+func (s *blockStore) flushWriteBuf() error {
+	wc := s.writeCursor
+	if len(wc.buf) == 0 {
+		return nil
+	}
+
+	offset := wc.curOffset - uint32(len(wc.buf))
+	n, err := wc.curFile.file.WriteAt(wc.buf, int64(offset))
+	wc.buf = wc.buf[:0]
+	if err != nil {
+		wc.curOffset = offset + uint32(n)
+		str := fmt.Sprintf("failed to write buffered block data to "+
+			"file %d at offset %d: %v", wc.curFileNum,
+			wc.curOffset, err)
+		return makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+
+	return nil
+}
+
+// preallocate allocates disk space for the current write file ahead of the
+// passed offset, which is the end of the data about to be written, when
+// preallocation is enabled.  The space is allocated in chunks of the
+// preallocation size, but never beyond the max block file size unless the data
+// itself extends past it.  Preallocation is disabled when the file system does
+// not support it since it is only an optimization.
+//
+// NOTE: This function MUST be called with the write cursor current file lock
+// held and must only be called during a write transaction so it is effectively
+// locked for writes.  Also, the write cursor current file must NOT be nil.
+func (s *blockStore) preallocate(endOffset uint32) {
+	wc := s.writeCursor
+	if s.preallocSize == 0 || endOffset <= wc.allocOffset {
+		return
+	}
+
+	allocOffset := endOffset + s.preallocSize
+	if allocOffset < endOffset || allocOffset > s.maxBlockFileSize {
+		allocOffset = s.maxBlockFileSize
+	}
+	if allocOffset < endOffset {
+		allocOffset = endOffset
+	}
+	err := preallocFile(wc.curFile.file, int64(wc.curOffset),
+		int64(allocOffset-wc.curOffset))
+	if err != nil {
+		log.Warnf("Disabling block file preallocation since it "+
+			"failed for file %d: %v", wc.curFileNum, err)
+		s.preallocSize = 0
+		return
+	}
+	wc.allocOffset = allocOffset
+}
+
 // writeBlock appends the specified raw block bytes to the store's write cursor
 // location and increments it accordingly.  When the block would exceed the max
 // file size for the current flat file, this function will close the current
@@ -421,13 +612,47 @@ func (s *blockStore) writeBlock(rawBlock []byte) (blockLocation, error) {
 		// This is done under the write cursor lock since the curFileNum
 		// field is accessed elsewhere by readers.
 		//
-		// Close the current write file to force a read-only reopen
-		// with LRU tracking.  The close is done under the write lock
-		// for the file to prevent it from being closed out from under
-		// any readers currently reading from it.
+		// Write out any buffered data, release the preallocated disk
+		// space which was not used, and then sync and close the
+		// current write file to force a read-only reopen with LRU
+		// tracking.  The sync is necessary since only the current
+		// write file is synced before the metadata is updated, so the
+		// metadata could otherwise reference blocks in this file which
+		// haven't been written yet in unexpected shutdown scenarios.
+		// The close is done under the write lock for the file to
+		// prevent it from being closed out from under any readers
+		// currently reading from it.  Nothing is synced when the sync
+		// policy is SyncNever.
 		wc.Lock()
 		wc.curFile.Lock()
 		if wc.curFile.file != nil {
+			if err := s.flushWriteBuf(); err != nil {
+				wc.curFile.Unlock()
+				wc.Unlock()
+				return blockLocation{}, err
+			}
+			if wc.allocOffset > wc.curOffset {
+				size := int64(wc.curOffset)
+				err := wc.curFile.file.Truncate(size)
+				if err != nil {
+					log.Warnf("Failed to release "+
+						"preallocated space of file "+
+						"%d: %v", wc.curFileNum, err)
+				}
+			}
+			if s.syncPolicy != SyncNever {
+				err := wc.curFile.file.Sync()
+				if err != nil {
+					wc.curFile.Unlock()
+					wc.Unlock()
+					str := fmt.Sprintf("failed to sync "+
+						"file %d: %v", wc.curFileNum,
+						err)
+					return blockLocation{}, makeDbErr(
+						database.ErrDriverSpecific,
+						str, err)
+				}
+			}
 			_ = wc.curFile.file.Close()
 			wc.curFile.file = nil
 		}
@@ -436,6 +661,7 @@ func (s *blockStore) writeBlock(rawBlock []byte) (blockLocation, error) {
 		// Start writes into next file.
 		wc.curFileNum++
 		wc.curOffset = 0
+		wc.allocOffset = 0
 		wc.Unlock()
 	}
 
@@ -455,6 +681,7 @@ func (s *blockStore) writeBlock(rawBlock []byte) (blockLocation, error) {
 		}
 		wc.curFile.file = file
 	}
+	s.preallocate(wc.curOffset + fullLen)
 
 	// Bitcoin network.
 	origOffset := wc.curOffset
@@ -515,7 +742,7 @@ func (s *blockStore) readBlock(hash *chainhash.Hash, loc blockLocation) ([]byte,
 	}
 
 	serializedData := make([]byte, loc.blockLen)
-	n, err := blockFile.file.ReadAt(serializedData, int64(loc.fileOffset))
+	n, err := blockFile.readAt(serializedData, int64(loc.fileOffset))
 	blockFile.RUnlock()
 	if err != nil {
 		str := fmt.Sprintf("failed to read block %s from file %d, "+
@@ -575,7 +802,7 @@ func (s *blockStore) readBlockRegion(loc blockLocation, offset, numBytes uint32)
 	// for block length.  Thus, add 8 bytes to adjust.
 	readOffset := loc.fileOffset + 8 + offset
 	serializedData := make([]byte, numBytes)
-	_, err = blockFile.file.ReadAt(serializedData, int64(readOffset))
+	_, err = blockFile.readAt(serializedData, int64(readOffset))
 	blockFile.RUnlock()
 	if err != nil {
 		str := fmt.Sprintf("failed to read region from block file %d, "+
@@ -594,7 +821,17 @@ func (s *blockStore) readBlockRegion(loc blockLocation, offset, numBytes uint32)
 // This is used when flushing cached metadata updates to disk to ensure all the
 // block data is fully written before updating the metadata.  This ensures the
 // metadata and block data can be properly reconciled in failure scenarios.
+// The previous block files are synced when the write cursor moves on from them,
+// so syncing the current one is sufficient.  Nothing is synced when the sync
+// policy is SyncNever.
+//
+// There is never any buffered block data at this point since it is written out
+// by flushBlocks before each transaction is committed.
 func (s *blockStore) syncBlocks() error {
+	if s.syncPolicy == SyncNever {
+		return nil
+	}
+
 	wc := s.writeCursor
 	wc.RLock()
 	defer wc.RUnlock()
@@ -617,6 +854,39 @@ func (s *blockStore) syncBlocks() error {
 	return nil
 }
 
+// flushBlocks writes the block data which is buffered in memory to the current
+// write file and also syncs the file when the sync policy is SyncOnCommit.  It
+// must be called once all blocks of a transaction have been written and before
+// the metadata which refers to them is committed since readers read the blocks
+// from the files.
+func (s *blockStore) flushBlocks() error {
+	wc := s.writeCursor
+	wc.RLock()
+	defer wc.RUnlock()
+
+	// Nothing to do if there is no current file associated with the write
+	// cursor.
+	wc.curFile.Lock()
+	defer wc.curFile.Unlock()
+	if wc.curFile.file == nil {
+		return nil
+	}
+
+	if err := s.flushWriteBuf(); err != nil {
+		return err
+	}
+	if s.syncPolicy != SyncOnCommit {
+		return nil
+	}
+	if err := wc.curFile.file.Sync(); err != nil {
+		str := fmt.Sprintf("failed to sync file %d: %v", wc.curFileNum,
+			err)
+		return makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+
+	return nil
+}
+
 // handleRollback rolls the block files on disk back to the provided file number
 // and offset.  This involves potentially deleting and truncating the files that
 // were partially written.
@@ -647,6 +917,10 @@ func (s *blockStore) handleRollback(oldBlockFileNum, oldBlockOffset uint32) {
 	wc.Lock()
 	defer wc.Unlock()
 
+	// Discard any buffered block data since it is rolled back as well.
+	// Note that the write cursor already accounts for it.
+	wc.buf = wc.buf[:0]
+
 	// Nothing to do if the rollback point is the same as the current write
 	// cursor.
 	if wc.curFileNum == oldBlockFileNum && wc.curOffset == oldBlockOffset {
@@ -658,6 +932,7 @@ func (s *blockStore) handleRollback(oldBlockFileNum, oldBlockOffset uint32) {
 	defer func() {
 		wc.curFileNum = oldBlockFileNum
 		wc.curOffset = oldBlockOffset
+		wc.allocOffset = 0
 	}()
 
 	log.Debugf("ROLLBACK: Rolling back to file %d, offset %d",
@@ -712,6 +987,35 @@ func (s *blockStore) handleRollback(oldBlockFileNum, oldBlockOffset uint32) {
 	}
 }
 
+// oldestBlockFile searches the database directory for the flat block file with
+// the lowest file number.  Since the oldest block files are removed when the
+// database is pruned, the files do not necessarily start at file number 0.  It
+// returns -1 when there are no block files.
+func oldestBlockFile(dbPath string) int {
+	fileInfos, err := ioutil.ReadDir(dbPath)
+	if err != nil {
+		return -1
+	}
+
+	oldestFile := -1
+	for _, fileInfo := range fileInfos {
+		name := fileInfo.Name()
+		if !strings.HasSuffix(name, ".fdb") {
+			continue
+		}
+		fileNum, err := strconv.ParseUint(strings.TrimSuffix(name, ".fdb"),
+			10, 32)
+		if err != nil || name != fmt.Sprintf(blockFilenameTemplate, fileNum) {
+			continue
+		}
+		if oldestFile == -1 || int(fileNum) < oldestFile {
+			oldestFile = int(fileNum)
+		}
+	}
+
+	return oldestFile
+}
+
 // scanBlockFiles searches the database directory for all flat block files to
 // find the end of the most recent file.  This position is considered the
 // current write cursor which is also stored in the metadata.  Thus, it is used
@@ -720,7 +1024,11 @@ func (s *blockStore) handleRollback(oldBlockFileNum, oldBlockOffset uint32) {
 func scanBlockFiles(dbPath string) (int, uint32) {
 	lastFile := -1
 	fileLen := uint32(0)
-	for i := 0; ; i++ {
+	firstFile := oldestBlockFile(dbPath)
+	if firstFile == -1 {
+		firstFile = 0
+	}
+	for i := firstFile; ; i++ {
 		filePath := blockFilePath(dbPath, uint32(i))
 		st, err := os.Stat(filePath)
 		if err != nil {
@@ -737,8 +1045,8 @@ func scanBlockFiles(dbPath string) (int, uint32) {
 }
 
 // newBlockStore returns a new block store with the current block file number
-// and offset set and all fields initialized.
-func newBlockStore(basePath string, network wire.BitcoinNet) *blockStore {
+// and offset set and all fields initialized according to the passed options.
+func newBlockStore(basePath string, network wire.BitcoinNet, opts *Options) *blockStore {
 	// Look for the end of the latest block to file to determine what the
 	// write cursor position is from the viewpoing of the block files on
 	// disk.
@@ -748,18 +1056,29 @@ func newBlockStore(basePath string, network wire.BitcoinNet) *blockStore {
 		fileOff = 0
 	}
 
+	blockFileSize := opts.BlockFileSize
+	if blockFileSize == 0 {
+		blockFileSize = maxBlockFileSize
+	}
+
 	store := &blockStore{
 		network:          network,
 		basePath:         basePath,
-		maxBlockFileSize: maxBlockFileSize,
+		maxBlockFileSize: blockFileSize,
+		writeBufSize:     opts.WriteBufferSize,
+		syncPolicy:       opts.SyncPolicy,
+		preallocSize:     opts.PreallocSize,
 		openBlockFiles:   make(map[uint32]*lockableFile),
 		openBlocksLRU:    list.New(),
 		fileNumToLRUElem: make(map[uint32]*list.Element),
+		mmapReads:        opts.MmapReads,
+		locCache:         newBlockLocCache(defaultLocCacheSize),
 
 		writeCursor: &writeCursor{
 			curFile:    &lockableFile{},
 			curFileNum: uint32(fileNum),
 			curOffset:  fileOff,
+			buf:        make([]byte, 0, opts.WriteBufferSize),
 		},
 	}
 	store.openFileFunc = store.openFile
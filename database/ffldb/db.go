@@ -74,6 +74,10 @@ var (
 	// writeLocKeyName is the key used to store the current write file
 	// location.
 	writeLocKeyName = []byte("ffldb-writeloc")
+
+	// prunedKeyName is the key used to record that block files have been
+	// removed from the database by pruning.
+	prunedKeyName = []byte("ffldb-pruned")
 )
 
 // Common error strings.
@@ -549,6 +553,147 @@ func newCursor(b *bucket, bucketID []byte, cursorTyp cursorType) *cursor {
 	return &cursor{bucket: b, dbIter: dbIter, pendingIter: pendingIter}
 }
 
+// iterRange returns the range of raw keys which covers the key/value pairs of
+// the bucket with the given ID selected by the passed iterator options.
+func iterRange(bucketID [4]byte, opts *database.IterOptions) *util.Range {
+	keyRange := util.BytesPrefix(bucketizedKey(bucketID, opts.Prefix))
+	if opts.Start != nil {
+		start := bucketizedKey(bucketID, opts.Start)
+		if bytes.Compare(start, keyRange.Start) > 0 {
+			keyRange.Start = start
+		}
+	}
+	if opts.Limit != nil {
+		limit := bucketizedKey(bucketID, opts.Limit)
+		if keyRange.Limit == nil || bytes.Compare(limit, keyRange.Limit) < 0 {
+			keyRange.Limit = limit
+		}
+	}
+
+	// Use an empty range when the bounds do not overlap.
+	if keyRange.Limit != nil && bytes.Compare(keyRange.Start, keyRange.Limit) > 0 {
+		keyRange.Limit = keyRange.Start
+	}
+	return keyRange
+}
+
+// rangeIterator is an internal type used to represent an iterator over a range
+// of the key/value pairs of a bucket and implements the database.Iterator
+// interface.  It is a cursor whose underlying iterators are limited to the
+// range which is only moved in the direction of the iteration.
+type rangeIterator struct {
+	*cursor
+	keyRange   *util.Range
+	reverse    bool
+	positioned bool
+	released   bool
+}
+
+// Enforce rangeIterator implements the database.Iterator interface.
+var _ database.Iterator = (*rangeIterator)(nil)
+
+// Next moves the iterator to the next key/value pair in iteration order and
+// returns whether or not the pair exists.
+//
+// This function is part of the database.Iterator interface implementation.
+func (iter *rangeIterator) Next() bool {
+	if iter.released {
+		return false
+	}
+
+	// The first call positions the iterator at the start of the range.
+	if !iter.positioned {
+		iter.positioned = true
+		if iter.reverse {
+			return iter.cursor.Last()
+		}
+		return iter.cursor.First()
+	}
+
+	if iter.reverse {
+		return iter.cursor.Prev()
+	}
+	return iter.cursor.Next()
+}
+
+// Seek positions the iterator at the first key/value pair in iteration order
+// whose key is not before the passed seek key.  Returns false if no suitable key
+// was found.
+//
+// This function is part of the database.Iterator interface implementation.
+func (iter *rangeIterator) Seek(seek []byte) bool {
+	// Ensure transaction state is valid.
+	c := iter.cursor
+	if err := c.bucket.tx.checkClosed(); err != nil {
+		return false
+	}
+	if iter.released {
+		return false
+	}
+	iter.positioned = true
+
+	// The pending keys iterator is exhausted by seeking before the start
+	// of its range, so clamp the seek key to the range.
+	seekKey := bucketizedKey(c.bucket.id, seek)
+	beforeStart := bytes.Compare(seekKey, iter.keyRange.Start) < 0
+	if !iter.reverse {
+		if beforeStart {
+			seekKey = iter.keyRange.Start
+		}
+		c.dbIter.Seek(seekKey)
+		c.pendingIter.Seek(seekKey)
+		return c.chooseIterator(true)
+	}
+
+	// There are no keys in the range before its start.
+	if beforeStart {
+		c.currentIter = nil
+		return false
+	}
+
+	// Position both the database and pending iterators at the last key
+	// that is less than or equal to the seek key, which is the key before
+	// the first key greater than it, or the last key of the range when
+	// there is none, then choose the iterator that is both valid and has
+	// the larger key.
+	for _, it := range []iterator.Iterator{c.dbIter, c.pendingIter} {
+		if !it.Seek(seekKey) {
+			it.Last()
+		} else if !bytes.Equal(it.Key(), seekKey) {
+			it.Prev()
+		}
+	}
+	return c.chooseIterator(false)
+}
+
+// Release releases the underlying iterators of the iterator.
+//
+// This function is part of the database.Iterator interface implementation.
+func (iter *rangeIterator) Release() {
+	if iter.released {
+		return
+	}
+	iter.released = true
+	runtime.SetFinalizer(iter, nil)
+	cursorFinalizer(iter.cursor)
+	iter.cursor.currentIter = nil
+}
+
+// newRangeIterator returns a new iterator over the key/value pairs of the
+// passed bucket which are selected by the passed options.
+//
+// NOTE: The caller is responsible for calling Release on the returned
+// iterator.
+func newRangeIterator(b *bucket, opts *database.IterOptions) *rangeIterator {
+	keyRange := iterRange(b.id, opts)
+	c := &cursor{
+		bucket:      b,
+		dbIter:      b.tx.snapshot.NewIterator(keyRange),
+		pendingIter: newLdbTreapIter(b.tx, keyRange),
+	}
+	return &rangeIterator{cursor: c, keyRange: keyRange, reverse: opts.Reverse}
+}
+
 // bucket is an internal type used to represent a collection of key/value pairs
 // and implements the database.Bucket interface.
 type bucket struct {
@@ -960,6 +1105,7 @@ type transaction struct {
 	snapshot       *dbCacheSnapshot // Underlying snapshot for txns.
 	metaBucket     *bucket          // The root metadata bucket.
 	blockIdxBucket *bucket          // The block index bucket.
+	locCacheGen    uint64           // Block location cache generation.
 
 	// Blocks that need to be stored on commit.  The pendingBlocks map is
 	// kept to allow quick lookups of pending data by block hash.
@@ -1124,6 +1270,43 @@ func (tx *transaction) Metadata() database.Bucket {
 	return tx.metaBucket
 }
 
+// Iterator returns a new iterator over the key/value pairs of the passed bucket
+// which are in the range specified by the passed options.  Nil options cover
+// all key/value pairs of the bucket in ascending key order.  Nested buckets are
+// not included.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBucketNotFound if the bucket is nil
+//   - ErrIncompatibleValue if the bucket belongs to another transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) Iterator(b database.Bucket, opts *database.IterOptions) (database.Iterator, error) {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return nil, err
+	}
+
+	if b == nil {
+		str := "iterator requires a bucket"
+		return nil, makeDbErr(database.ErrBucketNotFound, str, nil)
+	}
+	bkt, ok := b.(*bucket)
+	if !ok || bkt.tx != tx {
+		str := "bucket does not belong to the transaction"
+		return nil, makeDbErr(database.ErrIncompatibleValue, str, nil)
+	}
+	if opts == nil {
+		opts = &database.IterOptions{}
+	}
+
+	// Create the iterator and setup a runtime finalizer to ensure the
+	// underlying iterators are released when it is garbage collected.
+	iter := newRangeIterator(bkt, opts)
+	runtime.SetFinalizer(iter, (*rangeIterator).Release)
+	return iter, nil
+}
+
 // hasBlock returns whether or not a block with the given hash exists.
 func (tx *transaction) hasBlock(hash *chainhash.Hash) bool {
 	// Return true if the block is pending to be written on commit since
@@ -1238,6 +1421,25 @@ func (tx *transaction) fetchBlockRow(hash *chainhash.Hash) ([]byte, error) {
 	return blockRow, nil
 }
 
+// fetchBlockLocation returns the location of the block with the provided hash
+// in the flat block files.  The location is served from the block location
+// cache when possible and otherwise looked up in the block index and added to
+// the cache.  It will return ErrBlockNotFound if there is no entry.
+func (tx *transaction) fetchBlockLocation(hash *chainhash.Hash) (blockLocation, error) {
+	locCache := tx.db.store.locCache
+	if loc, ok := locCache.lookup(hash); ok {
+		return loc, nil
+	}
+
+	blockRow, err := tx.fetchBlockRow(hash)
+	if err != nil {
+		return blockLocation{}, err
+	}
+	loc := deserializeBlockLoc(blockRow)
+	locCache.add(hash, loc, tx.locCacheGen)
+	return loc, nil
+}
+
 // FetchBlockHeader returns the raw serialized bytes for the block header
 // identified by the given hash.  The raw bytes are in the format returned by
 // Serialize on a wire.BlockHeader.
@@ -1318,11 +1520,10 @@ func (tx *transaction) FetchBlock(hash *chainhash.Hash) ([]byte, error) {
 	}
 
 	// Lookup the location of the block in the files from the block index.
-	blockRow, err := tx.fetchBlockRow(hash)
+	location, err := tx.fetchBlockLocation(hash)
 	if err != nil {
 		return nil, err
 	}
-	location := deserializeBlockLoc(blockRow)
 
 	// Read the block from the appropriate location.  The function also
 	// performs a checksum over the data to detect data corruption.
@@ -1449,11 +1650,10 @@ func (tx *transaction) FetchBlockRegion(region *database.BlockRegion) ([]byte, e
 	}
 
 	// Lookup the location of the block in the files from the block index.
-	blockRow, err := tx.fetchBlockRow(region.Hash)
+	location, err := tx.fetchBlockLocation(region.Hash)
 	if err != nil {
 		return nil, err
 	}
-	location := deserializeBlockLoc(blockRow)
 
 	// Ensure the region is within the bounds of the block.
 	endOffset := region.Offset + region.Len
@@ -1547,11 +1747,10 @@ func (tx *transaction) FetchBlockRegions(regions []database.BlockRegion) ([][]by
 
 		// Lookup the location of the block in the files from the block
 		// index.
-		blockRow, err := tx.fetchBlockRow(region.Hash)
+		location, err := tx.fetchBlockLocation(region.Hash)
 		if err != nil {
 			return nil, err
 		}
-		location := deserializeBlockLoc(blockRow)
 
 		// Ensure the region is within the bounds of the block.
 		endOffset := region.Offset + region.Len
@@ -1657,6 +1856,13 @@ func (tx *transaction) writePendingAndCommit() error {
 		}
 	}
 
+	// Write out any buffered block data since readers read the blocks from
+	// the block files once the metadata refers to them.
+	if err := tx.db.store.flushBlocks(); err != nil {
+		rollback()
+		return err
+	}
+
 	// Update the metadata for the current write file and offset.
 	writeRow := serializeWriteRow(wc.curFileNum, wc.curOffset)
 	if err := tx.metaBucket.Put(writeLocKeyName, writeRow); err != nil {
@@ -1665,8 +1871,14 @@ func (tx *transaction) writePendingAndCommit() error {
 	}
 
 	// Atomically update the database cache.  The cache automatically
-	// handles flushing to the underlying persistent storage database.
-	return tx.db.cache.commitTx(tx)
+	// handles flushing to the underlying persistent storage database.  The
+	// block files are rolled back when the update fails since the metadata
+	// doesn't reference the new block data in that case.
+	if err := tx.db.cache.commitTx(tx); err != nil {
+		rollback()
+		return err
+	}
+	return nil
 }
 
 // Commit commits all changes that have been made to the root metadata bucket
@@ -1774,8 +1986,11 @@ func (db *db) begin(writable bool) (*transaction, error) {
 			nil)
 	}
 
-	// Grab a snapshot of the database cache (which in turn also handles the
-	// underlying database).
+	// Grab the generation of the block location cache prior to the snapshot
+	// of the database cache (which in turn also handles the underlying
+	// database) so locations of blocks removed after the generation was
+	// obtained are not added to the cache.
+	locCacheGen := db.store.locCache.currentGeneration()
 	snapshot, err := db.cache.Snapshot()
 	if err != nil {
 		db.closeLock.RUnlock()
@@ -1792,6 +2007,7 @@ func (db *db) begin(writable bool) (*transaction, error) {
 		writable:      writable,
 		db:            db,
 		snapshot:      snapshot,
+		locCacheGen:   locCacheGen,
 		pendingKeys:   treap.NewMutable(),
 		pendingRemove: treap.NewMutable(),
 	}
@@ -1898,6 +2114,153 @@ func (db *db) Update(fn func(database.Tx) error) error {
 	return tx.Commit()
 }
 
+// Prune removes the oldest flat block files, along with the block index entries
+// of the blocks they house, until the total size of the block files no longer
+// exceeds the provided target size.  Pruning stops at the first file which
+// houses a block the provided function reports must be kept.  The current
+// write file is never removed.  The hashes of the removed blocks are returned.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Prune(targetSize uint64, keepBlock func(hash *chainhash.Hash) bool) ([]chainhash.Hash, error) {
+	// Start a read-write transaction.  This also ensures the write cursor
+	// is not modified while the block files are being examined since it is
+	// only ever updated by write transactions.
+	tx, err := db.begin(true)
+	if err != nil {
+		return nil, err
+	}
+	defer rollbackOnPanic(tx)
+
+	// Determine which of the oldest block files need to be removed in
+	// order to reach the target size.  The current write file can't be
+	// removed, but it counts towards the total size.
+	store := db.store
+	wc := store.writeCursor
+	wc.RLock()
+	curFileNum, curOffset := wc.curFileNum, wc.curOffset
+	wc.RUnlock()
+	firstFileNum := curFileNum
+	if oldestFile := oldestBlockFile(store.basePath); oldestFile != -1 &&
+		uint32(oldestFile) < curFileNum {
+
+		firstFileNum = uint32(oldestFile)
+	}
+	fileSizes := make([]uint64, 0, curFileNum-firstFileNum)
+	totalSize := uint64(curOffset)
+	for fileNum := firstFileNum; fileNum < curFileNum; fileNum++ {
+		size, err := store.fileSize(fileNum)
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+		fileSizes = append(fileSizes, size)
+		totalSize += size
+	}
+	var numPruneFiles uint32
+	for _, size := range fileSizes {
+		if totalSize <= targetSize {
+			break
+		}
+		totalSize -= size
+		numPruneFiles++
+	}
+	if numPruneFiles == 0 {
+		return nil, tx.Rollback()
+	}
+
+	// Group the blocks housed in the files to be removed by file and reduce
+	// the number of files to remove to stop at the first one housing a
+	// block that must be kept.
+	fileBlocks := make([][]chainhash.Hash, numPruneFiles)
+	err = tx.blockIdxBucket.ForEach(func(k, v []byte) error {
+		fileNum := byteOrder.Uint32(v[0:4])
+		if fileNum < firstFileNum || fileNum >= firstFileNum+numPruneFiles {
+			return nil
+		}
+
+		var hash chainhash.Hash
+		copy(hash[:], k)
+		fileIdx := fileNum - firstFileNum
+		fileBlocks[fileIdx] = append(fileBlocks[fileIdx], hash)
+		return nil
+	})
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+keepLoop:
+	for i, hashes := range fileBlocks {
+		for j := range hashes {
+			if keepBlock(&hashes[j]) {
+				numPruneFiles = uint32(i)
+				break keepLoop
+			}
+		}
+	}
+	if numPruneFiles == 0 {
+		return nil, tx.Rollback()
+	}
+
+	// Remove the block index entries for all of the blocks in the files to
+	// be removed and record that the database has been pruned.
+	var prunedHashes []chainhash.Hash
+	for _, hashes := range fileBlocks[:numPruneFiles] {
+		for i := range hashes {
+			err := tx.blockIdxBucket.Delete(hashes[i][:])
+			if err != nil {
+				_ = tx.Rollback()
+				return nil, err
+			}
+		}
+		prunedHashes = append(prunedHashes, hashes...)
+	}
+	if err := tx.metaBucket.Put(prunedKeyName, []byte{1}); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	// Commit the changes and flush them to persistent storage before
+	// removing the files so the block index never references a block
+	// file that no longer exists in unexpected shutdown scenarios.  Any
+	// files which are left behind due to a failure are removed by the
+	// next prune since there are no longer any blocks which reference
+	// them.
+	//
+	// NOTE: The transaction is closed manually here instead of via Commit
+	// so the write lock is still held while the cache is flushed.
+	defer tx.close()
+	if err := tx.writePendingAndCommit(); err != nil {
+		return nil, err
+	}
+	store.locCache.remove(prunedHashes)
+	if err := db.cache.flush(); err != nil {
+		return nil, err
+	}
+	for fileNum := firstFileNum; fileNum < firstFileNum+numPruneFiles; fileNum++ {
+		store.closeFile(fileNum)
+		if err := store.deleteFileFunc(fileNum); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Debugf("Pruned %d block files containing %d blocks", numPruneFiles,
+		len(prunedHashes))
+	return prunedHashes, nil
+}
+
+// BeenPruned returns whether or not block files have ever been removed from the
+// database by Prune.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) BeenPruned() (bool, error) {
+	var pruned bool
+	err := db.View(func(tx database.Tx) error {
+		pruned = tx.Metadata().Get(prunedKeyName) != nil
+		return nil
+	})
+	return pruned, err
+}
+
 // Close cleanly shuts down the database and syncs all data.  It will block
 // until all database transactions have been finalized (rolled back or
 // committed).
@@ -1932,7 +2295,7 @@ func (db *db) Close() error {
 		wc.curFile.file = nil
 	}
 	for _, blockFile := range db.store.openBlockFiles {
-		_ = blockFile.file.Close()
+		_ = blockFile.close()
 	}
 	db.store.openBlockFiles = nil
 	db.store.openBlocksLRU.Init()
@@ -1980,9 +2343,10 @@ func initDB(ldb *leveldb.DB) error {
 	return nil
 }
 
-// openDB opens the database at the provided path.  database.ErrDbDoesNotExist
-// is returned if the database doesn't exist and the create flag is not set.
-func openDB(dbPath string, network wire.BitcoinNet, create bool) (database.DB, error) {
+// openDB opens the database at the provided path with the provided options.
+// database.ErrDbDoesNotExist is returned if the database doesn't exist and the
+// create flag is not set.
+func openDB(dbPath string, network wire.BitcoinNet, create bool, dbOpts *Options) (database.DB, error) {
 	// Error if the database doesn't exist and the create flag is not set.
 	metadataDbPath := filepath.Join(dbPath, metadataDbName)
 	dbExists := fileExists(metadataDbPath)
@@ -2016,7 +2380,7 @@ func openDB(dbPath string, network wire.BitcoinNet, create bool) (database.DB, e
 	// according to the data that is actually on disk.  Also create the
 	// database cache which wraps the underlying leveldb database to provide
 	// write caching.
-	store := newBlockStore(dbPath, network)
+	store := newBlockStore(dbPath, network, dbOpts)
 	cache := newDbCache(ldb, store, defaultCacheSize, defaultFlushSecs)
 	pdb := &db{store: store, cache: cache}
 
@@ -486,6 +486,24 @@ func (c *dbCache) commitTreaps(pendingKeys, pendingRemove TreapForEacher) error
 //
 // This function MUST be called with the database write lock held.
 func (c *dbCache) flush() error {
+	// Since the cached keys to be added and removed use an immutable treap,
+	// a snapshot is simply obtaining the root of the tree under the lock
+	// which is used to atomically swap the root.
+	c.cacheLock.RLock()
+	cachedKeys := c.cachedKeys
+	cachedRemove := c.cachedRemove
+	c.cacheLock.RUnlock()
+
+	return c.flushTreaps(cachedKeys, cachedRemove)
+}
+
+// flushTreaps syncs the block store and then commits the passed keys to add and
+// remove, which must include all of the keys in the cache, to the underlying
+// database in a single atomic transaction.  The cache is only cleared once they
+// have been committed, so it remains unchanged on failure.
+//
+// This function MUST be called with the database write lock held.
+func (c *dbCache) flushTreaps(cachedKeys, cachedRemove *treap.Immutable) error {
 	c.lastFlush = time.Now()
 
 	// Sync the current write file associated with the block store.  This is
@@ -496,14 +514,6 @@ func (c *dbCache) flush() error {
 		return err
 	}
 
-	// Since the cached keys to be added and removed use an immutable treap,
-	// a snapshot is simply obtaining the root of the tree under the lock
-	// which is used to atomically swap the root.
-	c.cacheLock.RLock()
-	cachedKeys := c.cachedKeys
-	cachedRemove := c.cachedRemove
-	c.cacheLock.RUnlock()
-
 	// Nothing to do if there is no data to flush.
 	if cachedKeys.Len() == 0 && cachedRemove.Len() == 0 {
 		return nil
@@ -558,34 +568,20 @@ func (c *dbCache) needsFlush(tx *transaction) bool {
 // the pending keys to add and remove in the transaction will be applied or none
 // of them will.
 //
-// The database cache itself might be flushed to the underlying persistent
-// database even if the transaction fails to apply, but it will only be the
-// state of the cache without the transaction applied.
+// When the cache is flushed, the cache and the transaction are written to the
+// underlying database in a single atomic transaction after the block files are
+// synced.  This ensures the block index entries and the write cursor of the
+// transaction are never persisted without the block data they refer to, nor
+// the block data without them, apart from data past the write cursor which is
+// rolled back when the database is opened again.  The cache remains unchanged
+// when the flush fails.
 //
 // This function MUST be called during a database write transaction which in
 // turn implies the database write lock will be held.
 func (c *dbCache) commitTx(tx *transaction) error {
-	// Flush the cache and write the current transaction directly to the
-	// database if a flush is needed.
-	if c.needsFlush(tx) {
-		if err := c.flush(); err != nil {
-			return err
-		}
-
-		// Perform all leveldb updates using an atomic transaction.
-		err := c.commitTreaps(tx.pendingKeys, tx.pendingRemove)
-		if err != nil {
-			return err
-		}
-
-		// Clear the transaction entries since they have been committed.
-		tx.pendingKeys = nil
-		tx.pendingRemove = nil
-		return nil
-	}
-
-	// At this point a database flush is not needed, so atomically commit
-	// the transaction to the cache.
+	// Determine whether a flush is needed before the pending keys of the
+	// transaction are cleared below.
+	needsFlush := c.needsFlush(tx)
 
 	// Since the cached keys to be added and removed use an immutable treap,
 	// a snapshot is simply obtaining the root of the tree under the lock
@@ -611,6 +607,11 @@ func (c *dbCache) commitTx(tx *transaction) error {
 	})
 	tx.pendingRemove = nil
 
+	// Flush the cache along with the transaction to the database if needed.
+	if needsFlush {
+		return c.flushTreaps(newCachedKeys, newCachedRemove)
+	}
+
 	// Atomically replace the immutable treaps which hold the cached keys to
 	// add and delete.
 	c.cacheLock.Lock()
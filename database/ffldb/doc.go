@@ -25,5 +25,27 @@ database path as a string and the block network:
 	if err != nil {
 		// Handle error
 	}
+
+Options may optionally be provided as a final parameter.  For example, the
+block files which are no longer written to may be memory mapped to reduce the
+number of system calls needed when serving many concurrent block requests:
+
+	opts := &ffldb.Options{MmapReads: true}
+	db, err := database.Open("ffldb", "path/to/database", wire.MainNet, opts)
+	if err != nil {
+		// Handle error
+	}
+
+The options also control how the block files are written.  For example, an
+archival node on a spinning disk might use larger block files with their disk
+space preallocated to reduce fragmentation, and buffer the block data to reduce
+the number of writes:
+
+	opts := &ffldb.Options{
+		BlockFileSize:   1024 * 1024 * 1024,
+		WriteBufferSize: 4 * 1024 * 1024,
+		SyncPolicy:      ffldb.SyncOnFlush,
+		PreallocSize:    ffldb.DefaultPreallocSize,
+	}
 */
 package ffldb
@@ -16,51 +16,148 @@ var log = hdflog.Disabled
 
 const (
 	dbType = "ffldb"
+
+	// DefaultPreallocSize is a reasonable number of bytes to preallocate
+	// the block files in ahead of the written data when preallocation is
+	// desired.
+	DefaultPreallocSize uint32 = 16 * 1024 * 1024 // 16 MiB
 )
 
+// SyncPolicy specifies when the flat block files are synced to disk.
+type SyncPolicy int
+
+const (
+	// SyncOnFlush syncs the current block file before the cached metadata
+	// is flushed to the underlying database as well as each block file
+	// when the writes move on to the next one.  This guarantees the
+	// metadata never refers to block data which is not on disk yet and is
+	// the default.
+	SyncOnFlush SyncPolicy = iota
+
+	// SyncOnCommit additionally syncs the current block file whenever a
+	// transaction which stored blocks is committed.  It trades write
+	// throughput for block data which is durable as soon as the commit
+	// returns.
+	SyncOnCommit
+
+	// SyncNever never syncs the block files and leaves writing them to
+	// disk to the operating system.  A power failure may lose block data
+	// the metadata already refers to, which is detected as corruption the
+	// next time the database is opened, so it should only be used for
+	// databases which can easily be recreated.
+	SyncNever
+)
+
+// String returns the SyncPolicy in human-readable form.
+func (p SyncPolicy) String() string {
+	switch p {
+	case SyncOnFlush:
+		return "SyncOnFlush"
+	case SyncOnCommit:
+		return "SyncOnCommit"
+	case SyncNever:
+		return "SyncNever"
+	}
+	return fmt.Sprintf("Unknown SyncPolicy (%d)", int(p))
+}
+
+// Options houses optional settings for the database which may be passed as the
+// final argument to the database Open/Create methods.
+type Options struct {
+	// MmapReads specifies whether the flat block files which are no longer
+	// being written to are memory mapped so reading blocks from them does
+	// not require a system call.  This is beneficial when serving many
+	// concurrent historical block requests at the cost of higher virtual
+	// memory usage.
+	MmapReads bool
+
+	// BlockFileSize is the maximum size of each flat file used to store
+	// blocks.  Zero selects the default of 512 MiB.  Changing it for an
+	// existing database only affects the block files written afterwards.
+	BlockFileSize uint32
+
+	// WriteBufferSize is the number of bytes of block data which are
+	// collected in memory before being written to the current block file
+	// so storing many blocks in a single transaction requires fewer
+	// system calls.  The buffer is always written out before the
+	// transaction is committed.  Zero disables buffering.
+	WriteBufferSize int
+
+	// SyncPolicy specifies when the block files are synced to disk.
+	SyncPolicy SyncPolicy
+
+	// PreallocSize is the number of bytes the disk space of the current
+	// block file is allocated in ahead of the written data.  Allocating
+	// larger contiguous extents reduces the fragmentation of the block
+	// files, particularly on spinning disks.  The size of the files is not
+	// affected.  Zero disables preallocation, which is also the case on
+	// platforms which do not support it.
+	PreallocSize uint32
+}
+
 // parseArgs parses the arguments from the database Open/Create methods.
-func parseArgs(funcName string, args ...interface{}) (string, wire.BitcoinNet, error) {
-	if len(args) != 2 {
-		return "", 0, fmt.Errorf("invalid arguments to %s.%s -- "+
-			"expected database path and block network", dbType,
-			funcName)
+func parseArgs(funcName string, args ...interface{}) (string, wire.BitcoinNet, *Options, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return "", 0, nil, fmt.Errorf("invalid arguments to %s.%s -- "+
+			"expected database path, block network, and optional "+
+			"database options", dbType, funcName)
 	}
 
 	dbPath, ok := args[0].(string)
 	if !ok {
-		return "", 0, fmt.Errorf("first argument to %s.%s is invalid -- "+
-			"expected database path string", dbType, funcName)
+		return "", 0, nil, fmt.Errorf("first argument to %s.%s is "+
+			"invalid -- expected database path string", dbType,
+			funcName)
 	}
 
 	network, ok := args[1].(wire.BitcoinNet)
 	if !ok {
-		return "", 0, fmt.Errorf("second argument to %s.%s is invalid -- "+
-			"expected block network", dbType, funcName)
+		return "", 0, nil, fmt.Errorf("second argument to %s.%s is "+
+			"invalid -- expected block network", dbType, funcName)
+	}
+
+	opts := &Options{}
+	if len(args) == 3 {
+		opts, ok = args[2].(*Options)
+		if !ok || opts == nil {
+			return "", 0, nil, fmt.Errorf("third argument to %s.%s "+
+				"is invalid -- expected database options",
+				dbType, funcName)
+		}
+	}
+	if opts.WriteBufferSize < 0 {
+		return "", 0, nil, fmt.Errorf("invalid options to %s.%s -- "+
+			"write buffer size %d is negative", dbType, funcName,
+			opts.WriteBufferSize)
+	}
+	if opts.SyncPolicy < SyncOnFlush || opts.SyncPolicy > SyncNever {
+		return "", 0, nil, fmt.Errorf("invalid options to %s.%s -- "+
+			"%v", dbType, funcName, opts.SyncPolicy)
 	}
 
-	return dbPath, network, nil
+	return dbPath, network, opts, nil
 }
 
 // openDBDriver is the callback provided during driver registration that opens
 // an existing database for use.
 func openDBDriver(args ...interface{}) (database.DB, error) {
-	dbPath, network, err := parseArgs("Open", args...)
+	dbPath, network, opts, err := parseArgs("Open", args...)
 	if err != nil {
 		return nil, err
 	}
 
-	return openDB(dbPath, network, false)
+	return openDB(dbPath, network, false, opts)
 }
 
 // createDBDriver is the callback provided during driver registration that
 // creates, initializes, and opens a database for use.
 func createDBDriver(args ...interface{}) (database.DB, error) {
-	dbPath, network, err := parseArgs("Create", args...)
+	dbPath, network, opts, err := parseArgs("Create", args...)
 	if err != nil {
 		return nil, err
 	}
 
-	return openDB(dbPath, network, true)
+	return openDB(dbPath, network, true, opts)
 }
 
 // useLogger is the callback provided during driver registration that sets the
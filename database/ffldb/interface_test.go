@@ -1741,6 +1741,13 @@ func testClosedTxInterface(tc *testContext, tx database.Tx) bool {
 		return false
 	}
 
+	// Ensure Iterator returns expected error.
+	testName = "Iterator on closed tx"
+	_, err = tx.Iterator(bucket, nil)
+	if !checkDbError(tc.t, testName, err, wantErrCode) {
+		return false
+	}
+
 	// Ensure Get returns expected error.
 	testName = "Get on closed tx"
 	if k := bucket.Get(keyName); k != nil {
@@ -2252,6 +2259,198 @@ func testConcurrentClose(tc *testContext) bool {
 	return true
 }
 
+// testIteratorInterface ensures the iterators returned by transactions cover
+// the requested ranges of key/value pairs in the requested order, both for the
+// key/value pairs stored in the database and those pending in the transaction.
+func testIteratorInterface(tc *testContext) bool {
+	bucketName := []byte("iterbucket")
+	committedValues := []keyPair{
+		{[]byte("ab"), []byte("val1")},
+		{[]byte("abc"), []byte("val2")},
+		{[]byte("b"), []byte("val3")},
+		{[]byte("ba"), []byte("val4")},
+		{[]byte("c"), []byte("val5")},
+	}
+	err := tc.db.Update(func(tx database.Tx) error {
+		bucket, err := tx.Metadata().CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+
+		// Nested buckets are not included by iterators.
+		if _, err := bucket.CreateBucket([]byte("bb")); err != nil {
+			return err
+		}
+		if !testPutValues(tc, bucket, committedValues) {
+			return errSubTestFail
+		}
+		return nil
+	})
+	if err != nil {
+		if err != errSubTestFail {
+			tc.t.Errorf("Update: unexpected error: %v", err)
+		}
+		return false
+	}
+
+	err = tc.db.Update(func(tx database.Tx) error {
+		// Mix pending updates with the stored key/value pairs.
+		bucket := tx.Metadata().Bucket(bucketName)
+		pendingValues := []keyPair{
+			{[]byte("a"), []byte("val6")},
+			{[]byte("abd"), []byte("val7")},
+			{[]byte("ba"), []byte("val8")},
+		}
+		if !testPutValues(tc, bucket, pendingValues) {
+			return errSubTestFail
+		}
+		if !testDeleteValues(tc, bucket, []keyPair{{[]byte("b"), nil}}) {
+			return errSubTestFail
+		}
+		values := map[string]string{
+			"a": "val6", "ab": "val1", "abc": "val2", "abd": "val7",
+			"ba": "val8", "c": "val5",
+		}
+
+		tests := []struct {
+			name string
+			opts *database.IterOptions
+			seek []byte
+			keys []string
+		}{{
+			name: "all",
+			keys: []string{"a", "ab", "abc", "abd", "ba", "c"},
+		}, {
+			name: "reverse",
+			opts: &database.IterOptions{Reverse: true},
+			keys: []string{"c", "ba", "abd", "abc", "ab", "a"},
+		}, {
+			name: "prefix",
+			opts: &database.IterOptions{Prefix: []byte("ab")},
+			keys: []string{"ab", "abc", "abd"},
+		}, {
+			name: "prefix reverse",
+			opts: &database.IterOptions{Prefix: []byte("ab"),
+				Reverse: true},
+			keys: []string{"abd", "abc", "ab"},
+		}, {
+			name: "range",
+			opts: &database.IterOptions{Start: []byte("abc"),
+				Limit: []byte("c")},
+			keys: []string{"abc", "abd", "ba"},
+		}, {
+			name: "prefix and range",
+			opts: &database.IterOptions{Prefix: []byte("ab"),
+				Start: []byte("abc")},
+			keys: []string{"abc", "abd"},
+		}, {
+			name: "empty range",
+			opts: &database.IterOptions{Start: []byte("c"),
+				Limit: []byte("b")},
+		}, {
+			name: "missing prefix",
+			opts: &database.IterOptions{Prefix: []byte("d")},
+		}, {
+			name: "seek",
+			seek: []byte("abb"),
+			keys: []string{"abc", "abd", "ba", "c"},
+		}, {
+			name: "seek reverse",
+			opts: &database.IterOptions{Reverse: true},
+			seek: []byte("abb"),
+			keys: []string{"ab", "a"},
+		}, {
+			name: "seek exact key reverse",
+			opts: &database.IterOptions{Reverse: true},
+			seek: []byte("ba"),
+			keys: []string{"ba", "abd", "abc", "ab", "a"},
+		}, {
+			name: "seek before prefix",
+			opts: &database.IterOptions{Prefix: []byte("ab")},
+			seek: []byte("a"),
+			keys: []string{"ab", "abc", "abd"},
+		}, {
+			name: "seek after prefix reverse",
+			opts: &database.IterOptions{Prefix: []byte("ab"),
+				Reverse: true},
+			seek: []byte("b"),
+			keys: []string{"abd", "abc", "ab"},
+		}, {
+			name: "seek before range reverse",
+			opts: &database.IterOptions{Start: []byte("b"),
+				Reverse: true},
+			seek: []byte("abd"),
+		}}
+		for _, test := range tests {
+			iter, err := tx.Iterator(bucket, test.opts)
+			if err != nil {
+				tc.t.Errorf("Iterator (%s): unexpected error: %v",
+					test.name, err)
+				return errSubTestFail
+			}
+
+			var keys []string
+			var ok bool
+			if test.seek != nil {
+				ok = iter.Seek(test.seek)
+			} else {
+				ok = iter.Next()
+			}
+			for ; ok; ok = iter.Next() {
+				k, v := iter.Key(), iter.Value()
+				if string(v) != values[string(k)] {
+					tc.t.Errorf("Iterator (%s): unexpected value "+
+						"for %q - got %q, want %q", test.name,
+						k, v, values[string(k)])
+					return errSubTestFail
+				}
+				keys = append(keys, string(k))
+			}
+			iter.Release()
+			if !reflect.DeepEqual(keys, test.keys) {
+				tc.t.Errorf("Iterator (%s): unexpected keys - got "+
+					"%q, want %q", test.name, keys, test.keys)
+				return errSubTestFail
+			}
+		}
+
+		// Ensure creating an iterator without a bucket returns the
+		// expected error.
+		testName := "Iterator without bucket"
+		wantErrCode := database.ErrBucketNotFound
+		_, err := tx.Iterator(nil, nil)
+		if !checkDbError(tc.t, testName, err, wantErrCode) {
+			return errSubTestFail
+		}
+
+		// Ensure creating an iterator for a bucket of another
+		// transaction returns the expected error.
+		otherTx, err := tc.db.Begin(false)
+		if err != nil {
+			tc.t.Errorf("Begin: unexpected error: %v", err)
+			return errSubTestFail
+		}
+		defer otherTx.Rollback()
+		testName = "Iterator with bucket of other tx"
+		wantErrCode = database.ErrIncompatibleValue
+		_, err = tx.Iterator(otherTx.Metadata(), nil)
+		if !checkDbError(tc.t, testName, err, wantErrCode) {
+			return errSubTestFail
+		}
+
+		// Delete the test bucket to avoid leaving it around.
+		return tx.Metadata().DeleteBucket(bucketName)
+	})
+	if err != nil {
+		if err != errSubTestFail {
+			tc.t.Errorf("Update: unexpected error: %v", err)
+		}
+		return false
+	}
+
+	return true
+}
+
 // testInterface tests performs tests for the various interfaces of the database
 // package which require state in the database for the given database type.
 func testInterface(t *testing.T, db database.DB) {
@@ -2273,6 +2472,12 @@ func testInterface(t *testing.T, db database.DB) {
 		return
 	}
 
+	// Test the iterators over ranges of the metadata using managed
+	// transactions.
+	if !testIteratorInterface(&context) {
+		return
+	}
+
 	// Test the transaction block IO interface using managed and manual
 	// transactions.  This function leaves all of the stored blocks in the
 	// database since they're used later.
@@ -0,0 +1,129 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package ffldb
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+)
+
+const (
+	// defaultLocCacheSize is the default max number of block locations to
+	// keep in the block location cache.  Each entry takes roughly 100 bytes
+	// including the overhead of the map and least recently used list, so
+	// the cache is limited to around 5MiB.
+	defaultLocCacheSize = 50000
+)
+
+// locCacheEntry houses a block hash along with its location in the flat block
+// files.  It is the value stored in the least recently used list of the block
+// location cache.
+type locCacheEntry struct {
+	hash chainhash.Hash
+	loc  blockLocation
+}
+
+// blockLocCache provides a concurrency safe least recently used cache of the
+// locations of blocks in the flat block files.  It allows repeated and
+// concurrent requests for the same blocks, such as when serving historical
+// blocks to syncing peers or during rescans, to avoid looking up the location
+// in the block index each time.
+//
+// Since the cache is shared by all transactions while each transaction has its
+// own view of the block index, the cache maintains a generation which is
+// advanced whenever entries are removed from the block index.  Locations which
+// were looked up by transactions started before the latest generation are not
+// added to the cache since they might refer to removed entries.
+type blockLocCache struct {
+	mtx        sync.Mutex
+	maxEntries int
+	generation uint64
+	lru        *list.List // Contains *locCacheEntry.
+	entries    map[chainhash.Hash]*list.Element
+}
+
+// newBlockLocCache returns a new block location cache which is limited to the
+// provided max number of entries.
+func newBlockLocCache(maxEntries int) *blockLocCache {
+	return &blockLocCache{
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		entries:    make(map[chainhash.Hash]*list.Element),
+	}
+}
+
+// currentGeneration returns the current generation of the cache.  It must be
+// obtained prior to taking the view of the block index the locations which are
+// added to the cache are looked up from.
+//
+// This function is safe for concurrent access.
+func (c *blockLocCache) currentGeneration() uint64 {
+	c.mtx.Lock()
+	generation := c.generation
+	c.mtx.Unlock()
+	return generation
+}
+
+// lookup returns the cached location of the block with the provided hash along
+// with whether or not it was found.  Found entries are marked as the most
+// recently used.
+//
+// This function is safe for concurrent access.
+func (c *blockLocCache) lookup(hash *chainhash.Hash) (blockLocation, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, ok := c.entries[*hash]
+	if !ok {
+		return blockLocation{}, false
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*locCacheEntry).loc, true
+}
+
+// add adds the location of the block with the provided hash to the cache as the
+// most recently used entry and evicts the least recently used entry when the
+// cache is full.  The location is not added when the passed generation, which
+// is the generation the location was looked up at, is no longer current.
+//
+// This function is safe for concurrent access.
+func (c *blockLocCache) add(hash *chainhash.Hash, loc blockLocation, generation uint64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.maxEntries == 0 || generation != c.generation {
+		return
+	}
+	if elem, ok := c.entries[*hash]; ok {
+		elem.Value.(*locCacheEntry).loc = loc
+		c.lru.MoveToFront(elem)
+		return
+	}
+	if c.lru.Len() >= c.maxEntries {
+		entry := c.lru.Remove(c.lru.Back()).(*locCacheEntry)
+		delete(c.entries, entry.hash)
+	}
+	c.entries[*hash] = c.lru.PushFront(&locCacheEntry{hash: *hash, loc: loc})
+}
+
+// remove removes the locations of the blocks with the provided hashes from the
+// cache and advances the generation so locations looked up by transactions
+// which might still see the removed entries are not added back.
+//
+// This function is safe for concurrent access.
+func (c *blockLocCache) remove(hashes []chainhash.Hash) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.generation++
+	for i := range hashes {
+		if elem, ok := c.entries[hashes[i]]; ok {
+			c.lru.Remove(elem)
+			delete(c.entries, hashes[i])
+		}
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// +build windows plan9
+
+package ffldb
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile returns an error since memory-mapped reads are not supported on
+// this platform.  Reads fall back to the file in that case.
+func mmapFile(file *os.File) ([]byte, error) {
+	return nil, errors.New("memory-mapped reads are not supported on " +
+		"this platform")
+}
+
+// munmapFile is a no-op since files are never memory mapped on this platform.
+func munmapFile(mapped []byte) error {
+	return nil
+}
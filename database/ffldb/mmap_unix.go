@@ -0,0 +1,33 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// +build !windows,!plan9
+
+package ffldb
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile memory maps the entire contents of the passed file as read-only.  It
+// returns a nil mapping for empty files since they can't be mapped.
+func mmapFile(file *os.File) ([]byte, error) {
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if size == 0 || int64(int(size)) != size {
+		return nil, nil
+	}
+
+	return syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ,
+		syscall.MAP_SHARED)
+}
+
+// munmapFile unmaps a mapping previously returned by mmapFile.
+func munmapFile(mapped []byte) error {
+	return syscall.Munmap(mapped)
+}
@@ -0,0 +1,29 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package ffldb
+
+import (
+	"os"
+	"syscall"
+)
+
+// fallocKeepSize is the fallocate mode flag which allocates the disk space
+// without changing the size of the file.
+const fallocKeepSize = 0x01
+
+// preallocFile allocates the disk space for the passed region of the file
+// without changing its size, so the block files on disk still end at the last
+// written block.  Files which are not backed by the file system, such as the
+// mock files used by the tests, are left alone.
+func preallocFile(file filer, offset, size int64) error {
+	f, ok := file.(*os.File)
+	if !ok || size <= 0 {
+		return nil
+	}
+
+	return syscall.Fallocate(int(f.Fd()), fallocKeepSize, offset, size)
+}
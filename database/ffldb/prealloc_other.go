@@ -0,0 +1,13 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// +build !linux
+
+package ffldb
+
+// preallocFile is a no-op since allocating disk space without changing the
+// size of a file is not supported on this platform.
+func preallocFile(file filer, offset, size int64) error {
+	return nil
+}
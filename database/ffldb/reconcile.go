@@ -79,9 +79,10 @@ func reconcileDB(pdb *db, create bool) (database.DB, error) {
 	// disk is AFTER the position the metadata believes to be true, truncate
 	// the files on disk to match the metadata.  This can be a fairly common
 	// occurrence in unclean shutdown scenarios while the block files are in
-	// the middle of being written.  Since the metadata isn't updated until
-	// after the block data is written, this is effectively just a rollback
-	// to the known good point before the unclean shutdown.
+	// the middle of being written, including torn writes which only left
+	// part of a block on disk.  Since the metadata isn't updated until after
+	// the block data is written and synced, this is effectively just a
+	// rollback to the known good point before the unclean shutdown.
 	wc := pdb.store.writeCursor
 	if wc.curFileNum > curFileNum || (wc.curFileNum == curFileNum &&
 		wc.curOffset > curOffset) {
@@ -90,6 +91,33 @@ func reconcileDB(pdb *db, create bool) (database.DB, error) {
 		log.Debugf("Metadata claims file %d, offset %d. Block data is "+
 			"at file %d, offset %d", curFileNum, curOffset,
 			wc.curFileNum, wc.curOffset)
+
+		// The file the metadata claims to be the current one must
+		// contain all of the data up to the claimed offset.  Otherwise
+		// the block data the metadata refers to is missing and the
+		// truncation below would extend the file instead.
+		fileLen := uint64(wc.curOffset)
+		if wc.curFileNum > curFileNum {
+			var err error
+			fileLen, err = pdb.store.fileSize(curFileNum)
+			if err != nil || fileLen < uint64(curOffset) {
+				str := fmt.Sprintf("metadata claims file %d, "+
+					"offset %d, but the file is missing or "+
+					"shorter", curFileNum, curOffset)
+				log.Warnf("***Database corruption detected***: %v",
+					str)
+				return nil, makeDbErr(database.ErrCorruption, str,
+					err)
+			}
+			log.Infof("Removing block files %d through %d written "+
+				"after the last database update", curFileNum+1,
+				wc.curFileNum)
+		}
+		if fileLen > uint64(curOffset) {
+			log.Infof("Discarding %d bytes of block data written "+
+				"after the last database update from block "+
+				"file %d", fileLen-uint64(curOffset), curFileNum)
+		}
 		pdb.store.handleRollback(curFileNum, curOffset)
 		log.Infof("Database sync complete")
 	}
@@ -8,6 +8,7 @@
 package ffldb
 
 import (
+	"bytes"
 	"compress/bzip2"
 	"encoding/binary"
 	"fmt"
@@ -15,9 +16,11 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
 	"github.com/ifishnet/hdfd/database"
 	"github.com/ifishnet/hdfd/wire"
 	"github.com/ifishnet/hdfutil"
@@ -179,7 +182,7 @@ func TestCornerCases(t *testing.T) {
 	// directory is needed.
 	testName := "openDB: fail due to file at target location"
 	wantErrCode := database.ErrDriverSpecific
-	idb, err := openDB(dbPath, blockDataNet, true)
+	idb, err := openDB(dbPath, blockDataNet, true, &Options{})
 	if !checkDbError(t, testName, err, wantErrCode) {
 		if err == nil {
 			idb.Close()
@@ -191,7 +194,7 @@ func TestCornerCases(t *testing.T) {
 	// Remove the file and create the database to run tests against.  It
 	// should be successful this time.
 	_ = os.RemoveAll(dbPath)
-	idb, err = openDB(dbPath, blockDataNet, true)
+	idb, err = openDB(dbPath, blockDataNet, true, &Options{})
 	if err != nil {
 		t.Errorf("openDB: unexpected error: %v", err)
 		return
@@ -704,3 +707,544 @@ func TestFailureScenarios(t *testing.T) {
 	// Test various corruption scenarios.
 	testCorruption(tc)
 }
+
+// TestPrune ensures pruning removes the oldest block files along with the
+// blocks they house, stops at blocks which must be kept, and that a pruned
+// database can be reopened.
+func TestPrune(t *testing.T) {
+	t.Parallel()
+
+	// Create a new database to run tests against.
+	dbPath := filepath.Join(os.TempDir(), "ffldb-prune")
+	_ = os.RemoveAll(dbPath)
+	idb, err := database.Create(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("Failed to create test database (%s) %v", dbType, err)
+	}
+	defer os.RemoveAll(dbPath)
+	defer func() {
+		if idb != nil {
+			idb.Close()
+		}
+	}()
+
+	// Change the maximum file size to a small value to force multiple flat
+	// files with the test data set and store the first blocks.
+	blocks, err := loadBlocks(t, blockDataFile, blockDataNet)
+	if err != nil {
+		t.Fatalf("loadBlocks: Unexpected error: %v", err)
+	}
+	blocks = blocks[:100]
+	store := idb.(*db).store
+	store.maxBlockFileSize = 1024 // 1KiB
+	for i, block := range blocks {
+		err := idb.Update(func(tx database.Tx) error {
+			return tx.StoreBlock(block)
+		})
+		if err != nil {
+			t.Fatalf("StoreBlock #%d: unexpected error: %v", i, err)
+		}
+	}
+
+	pruned, err := idb.BeenPruned()
+	if err != nil || pruned {
+		t.Fatalf("BeenPruned: got %v (err %v), want false", pruned, err)
+	}
+
+	// Fetch all of the blocks so their locations are cached.
+	err = idb.View(func(tx database.Tx) error {
+		for _, block := range blocks {
+			if _, err := tx.FetchBlock(block.Hash()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("FetchBlock: unexpected error: %v", err)
+	}
+
+	// Ensure nothing is pruned when the oldest block must be kept.
+	keepAll := func(*chainhash.Hash) bool { return true }
+	prunedHashes, err := idb.Prune(0, keepAll)
+	if err != nil || len(prunedHashes) != 0 {
+		t.Fatalf("Prune: got %d pruned blocks (err %v), want none",
+			len(prunedHashes), err)
+	}
+
+	// Prune to a target size while keeping the most recent blocks and
+	// ensure only the blocks in the removed files are gone.
+	const numKeep = 40
+	keep := make(map[chainhash.Hash]struct{})
+	for _, block := range blocks[len(blocks)-numKeep:] {
+		keep[*block.Hash()] = struct{}{}
+	}
+	keepRecent := func(hash *chainhash.Hash) bool {
+		_, ok := keep[*hash]
+		return ok
+	}
+	prunedHashes, err = idb.Prune(4096, keepRecent)
+	if err != nil {
+		t.Fatalf("Prune: unexpected error: %v", err)
+	}
+	numPruned := len(prunedHashes)
+	if numPruned == 0 || numPruned > len(blocks)-numKeep {
+		t.Fatalf("Prune: unexpected number of pruned blocks %d",
+			numPruned)
+	}
+	prunedSet := make(map[chainhash.Hash]struct{})
+	for _, hash := range prunedHashes {
+		prunedSet[hash] = struct{}{}
+	}
+	for i, block := range blocks {
+		wantExists := i >= numPruned
+		if _, ok := prunedSet[*block.Hash()]; ok == wantExists {
+			t.Fatalf("Prune: block #%d pruned %v, want %v", i, ok,
+				!wantExists)
+		}
+		err := idb.View(func(tx database.Tx) error {
+			exists, err := tx.HasBlock(block.Hash())
+			if err != nil {
+				return err
+			}
+			if exists != wantExists {
+				return fmt.Errorf("HasBlock #%d: got %v, want %v",
+					i, exists, wantExists)
+			}
+
+			// Ensure the cached locations of pruned blocks are no
+			// longer used.
+			_, err = tx.FetchBlock(block.Hash())
+			if !exists {
+				dbErr, ok := err.(database.Error)
+				if !ok || dbErr.ErrorCode != database.ErrBlockNotFound {
+					return fmt.Errorf("FetchBlock #%d: "+
+						"unexpected error: %v", i, err)
+				}
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatalf("View: unexpected error: %v", err)
+		}
+	}
+	if fileExists(blockFilePath(dbPath, 0)) {
+		t.Fatal("Prune: oldest block file still exists")
+	}
+	pruned, err = idb.BeenPruned()
+	if err != nil || !pruned {
+		t.Fatalf("BeenPruned: got %v (err %v), want true", pruned, err)
+	}
+
+	// Ensure the pruned database can be reopened and still provides the
+	// remaining blocks.
+	idb.Close()
+	idb, err = database.Open(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("Open: unexpected error: %v", err)
+	}
+	lastBlock := blocks[len(blocks)-1]
+	err = idb.View(func(tx database.Tx) error {
+		_, err := tx.FetchBlock(lastBlock.Hash())
+		return err
+	})
+	if err != nil {
+		t.Fatalf("FetchBlock: unexpected error: %v", err)
+	}
+}
+
+// TestMmapReads ensures blocks and block regions are read properly from the
+// block files when memory-mapped reads are enabled.
+func TestMmapReads(t *testing.T) {
+	t.Parallel()
+
+	// Create a new database with memory-mapped reads enabled to run tests
+	// against.
+	dbPath := filepath.Join(os.TempDir(), "ffldb-mmapreads")
+	_ = os.RemoveAll(dbPath)
+	idb, err := database.Create(dbType, dbPath, blockDataNet,
+		&Options{MmapReads: true})
+	if err != nil {
+		t.Fatalf("Failed to create test database (%s) %v", dbType, err)
+	}
+	defer os.RemoveAll(dbPath)
+	defer idb.Close()
+
+	// Change the maximum file size to a small value to force multiple flat
+	// files with the test data set and store the blocks.
+	blocks, err := loadBlocks(t, blockDataFile, blockDataNet)
+	if err != nil {
+		t.Fatalf("loadBlocks: Unexpected error: %v", err)
+	}
+	store := idb.(*db).store
+	store.maxBlockFileSize = 1024 // 1KiB
+	for i, block := range blocks {
+		err := idb.Update(func(tx database.Tx) error {
+			return tx.StoreBlock(block)
+		})
+		if err != nil {
+			t.Fatalf("StoreBlock #%d: unexpected error: %v", i, err)
+		}
+	}
+
+	// Ensure the blocks and their headers, which are read as regions, match
+	// the stored blocks.
+	err = idb.View(func(tx database.Tx) error {
+		for i, block := range blocks {
+			wantBytes, err := block.Bytes()
+			if err != nil {
+				return err
+			}
+			gotBytes, err := tx.FetchBlock(block.Hash())
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(gotBytes, wantBytes) {
+				return fmt.Errorf("FetchBlock #%d: bytes mismatch", i)
+			}
+			region := database.BlockRegion{
+				Hash: block.Hash(),
+				Len:  uint32(wire.MaxBlockHeaderPayload),
+			}
+			gotBytes, err = tx.FetchBlockRegion(&region)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(gotBytes, wantBytes[:region.Len]) {
+				return fmt.Errorf("FetchBlockRegion #%d: bytes "+
+					"mismatch", i)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("View: unexpected error: %v", err)
+	}
+
+	// Ensure the files which are no longer written to were mapped on the
+	// platforms that support it.
+	if runtime.GOOS != "windows" && runtime.GOOS != "plan9" {
+		for fileNum, blockFile := range store.openBlockFiles {
+			if blockFile.mapped == nil {
+				t.Fatalf("block file %d is not mapped", fileNum)
+			}
+		}
+	}
+}
+
+// TestBlockFileOptions ensures blocks are stored and read properly when the
+// block file size, write buffering, sync policy and preallocation are
+// configured, and that the block files on disk end at the write cursor.
+func TestBlockFileOptions(t *testing.T) {
+	t.Parallel()
+
+	// Create a new database with small block files, a write buffer which
+	// holds a couple of blocks, syncs on each commit and preallocation to
+	// run tests against.
+	dbPath := filepath.Join(os.TempDir(), "ffldb-blockfileoptions")
+	_ = os.RemoveAll(dbPath)
+	opts := &Options{
+		BlockFileSize:   1024, // 1KiB
+		WriteBufferSize: 512,
+		SyncPolicy:      SyncOnCommit,
+		PreallocSize:    256,
+	}
+	idb, err := database.Create(dbType, dbPath, blockDataNet, opts)
+	if err != nil {
+		t.Fatalf("Failed to create test database (%s) %v", dbType, err)
+	}
+	defer os.RemoveAll(dbPath)
+
+	// Store all of the blocks in a single transaction so the buffered
+	// writes span multiple block files.
+	blocks, err := loadBlocks(t, blockDataFile, blockDataNet)
+	if err != nil {
+		idb.Close()
+		t.Fatalf("loadBlocks: Unexpected error: %v", err)
+	}
+	err = idb.Update(func(tx database.Tx) error {
+		for i, block := range blocks {
+			if err := tx.StoreBlock(block); err != nil {
+				return fmt.Errorf("StoreBlock #%d: %v", i, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		idb.Close()
+		t.Fatalf("Update: unexpected error: %v", err)
+	}
+
+	// Ensure multiple block files were written and that neither buffered
+	// data nor preallocated space is reflected in the size of the files.
+	wc := idb.(*db).store.writeCursor
+	if wc.curFileNum == 0 {
+		idb.Close()
+		t.Fatal("blocks were not written to multiple block files")
+	}
+	fileNum, fileOff := scanBlockFiles(dbPath)
+	if fileNum != int(wc.curFileNum) || fileOff != wc.curOffset {
+		idb.Close()
+		t.Fatalf("block files end at file %d, offset %d - want file "+
+			"%d, offset %d", fileNum, fileOff, wc.curFileNum,
+			wc.curOffset)
+	}
+
+	// Ensure the blocks match the stored ones after reopening the
+	// database.
+	if err := idb.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+	idb, err = database.Open(dbType, dbPath, blockDataNet, opts)
+	if err != nil {
+		t.Fatalf("Failed to open test database (%s) %v", dbType, err)
+	}
+	defer idb.Close()
+	err = idb.View(func(tx database.Tx) error {
+		for i, block := range blocks {
+			wantBytes, err := block.Bytes()
+			if err != nil {
+				return err
+			}
+			gotBytes, err := tx.FetchBlock(block.Hash())
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(gotBytes, wantBytes) {
+				return fmt.Errorf("FetchBlock #%d: bytes mismatch", i)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("View: unexpected error: %v", err)
+	}
+}
+
+// simulateCrash closes the flat block files and the underlying leveldb database
+// of the passed database without flushing the database cache.  This leaves the
+// database on disk in the same state an unexpected shutdown would, where the
+// block files contain blocks which the metadata does not refer to yet.
+func simulateCrash(idb database.DB) {
+	pdb := idb.(*db)
+	pdb.closeLock.Lock()
+	defer pdb.closeLock.Unlock()
+	pdb.closed = true
+
+	wc := pdb.store.writeCursor
+	if wc.curFile.file != nil {
+		_ = wc.curFile.file.Close()
+		wc.curFile.file = nil
+	}
+	for _, blockFile := range pdb.store.openBlockFiles {
+		_ = blockFile.close()
+	}
+	_ = pdb.cache.ldb.Close()
+}
+
+// TestUncleanShutdownRecovery ensures the block files are rolled back to the
+// last update of the metadata when the database is opened after an unexpected
+// shutdown, including torn writes which only left part of a block on disk, and
+// that block data the metadata refers to which is missing is detected as
+// corruption.
+func TestUncleanShutdownRecovery(t *testing.T) {
+	t.Parallel()
+
+	blocks, err := loadBlocks(t, blockDataFile, blockDataNet)
+	if err != nil {
+		t.Fatalf("loadBlocks: Unexpected error: %v", err)
+	}
+	const numFlushed = 20
+	const numStored = 40
+	partialBlock, err := blocks[numStored].Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: unexpected error: %v", err)
+	}
+	partialBlock = partialBlock[:len(partialBlock)/2]
+
+	// appendData appends the passed data to the block file with the passed
+	// number, creating it as needed.
+	appendData := func(dbPath string, fileNum uint32, data []byte) error {
+		filePath := blockFilePath(dbPath, fileNum)
+		file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|
+			os.O_APPEND, 0666)
+		if err != nil {
+			return err
+		}
+		if _, err := file.Write(data); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	}
+
+	// cursor is the position of a write cursor.
+	type cursor struct {
+		fileNum uint32
+		offset  uint32
+	}
+
+	tests := []struct {
+		name string
+
+		// damage modifies the block files after the crash given the
+		// write cursor of the last update of the metadata and the
+		// write cursor at the time of the crash.
+		damage func(dbPath string, flushed, crashed cursor) error
+
+		wantCorruption bool
+	}{{
+		name: "unflushed blocks",
+		damage: func(string, cursor, cursor) error {
+			return nil
+		},
+	}, {
+		name: "torn block write",
+		damage: func(dbPath string, _, crashed cursor) error {
+			return appendData(dbPath, crashed.fileNum, partialBlock)
+		},
+	}, {
+		name: "torn block write to new file",
+		damage: func(dbPath string, _, crashed cursor) error {
+			return appendData(dbPath, crashed.fileNum+1,
+				partialBlock)
+		},
+	}, {
+		name: "missing flushed block data",
+		damage: func(dbPath string, flushed, _ cursor) error {
+			filePath := blockFilePath(dbPath, flushed.fileNum)
+			return os.Truncate(filePath, int64(flushed.offset)-1)
+		},
+		wantCorruption: true,
+	}}
+
+	for i, test := range tests {
+		dbPath := filepath.Join(os.TempDir(),
+			fmt.Sprintf("ffldb-uncleanshutdown-%d", i))
+		_ = os.RemoveAll(dbPath)
+		idb, err := database.Create(dbType, dbPath, blockDataNet)
+		if err != nil {
+			t.Fatalf("%s: failed to create test database: %v",
+				test.name, err)
+		}
+		defer os.RemoveAll(dbPath)
+
+		// Store blocks in several flat files and flush the metadata
+		// part way through so the remaining blocks are only in the
+		// block files when the crash happens.
+		pdb := idb.(*db)
+		pdb.store.maxBlockFileSize = 1024 // 1KiB
+		var flushed cursor
+		for j, block := range blocks[:numStored] {
+			err := idb.Update(func(tx database.Tx) error {
+				return tx.StoreBlock(block)
+			})
+			if err != nil {
+				t.Fatalf("%s: StoreBlock #%d: unexpected "+
+					"error: %v", test.name, j, err)
+			}
+			if j != numFlushed-1 {
+				continue
+			}
+			pdb.writeLock.Lock()
+			err = pdb.cache.flush()
+			pdb.writeLock.Unlock()
+			if err != nil {
+				t.Fatalf("%s: flush: unexpected error: %v",
+					test.name, err)
+			}
+			flushed = cursor{pdb.store.writeCursor.curFileNum,
+				pdb.store.writeCursor.curOffset}
+		}
+		crashed := cursor{pdb.store.writeCursor.curFileNum,
+			pdb.store.writeCursor.curOffset}
+		if crashed.fileNum == flushed.fileNum {
+			t.Fatalf("%s: blocks after the flush were not written "+
+				"to a new file", test.name)
+		}
+
+		simulateCrash(idb)
+		if err := test.damage(dbPath, flushed, crashed); err != nil {
+			t.Fatalf("%s: unexpected error damaging block files: "+
+				"%v", test.name, err)
+		}
+
+		// Ensure the database is repaired or corruption is detected as
+		// expected when it is opened again.
+		idb, err = database.Open(dbType, dbPath, blockDataNet)
+		if test.wantCorruption {
+			if !checkDbError(t, test.name, err, database.ErrCorruption) {
+				if err == nil {
+					idb.Close()
+				}
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: Open: unexpected error: %v", test.name,
+				err)
+		}
+		if fileExists(blockFilePath(dbPath, flushed.fileNum+1)) {
+			t.Fatalf("%s: block files written after the flush "+
+				"were not removed", test.name)
+		}
+		wc := idb.(*db).store.writeCursor
+		if wc.curFileNum != flushed.fileNum ||
+			wc.curOffset != flushed.offset {
+
+			t.Fatalf("%s: write cursor is at file %d, offset %d, "+
+				"want file %d, offset %d", test.name,
+				wc.curFileNum, wc.curOffset, flushed.fileNum,
+				flushed.offset)
+		}
+
+		// Ensure only the flushed blocks exist and the remaining ones
+		// can be stored again and read back.
+		err = idb.Update(func(tx database.Tx) error {
+			for j, block := range blocks[:numStored] {
+				exists, err := tx.HasBlock(block.Hash())
+				if err != nil {
+					return err
+				}
+				if exists != (j < numFlushed) {
+					return fmt.Errorf("HasBlock #%d: got "+
+						"%v, want %v", j, exists,
+						j < numFlushed)
+				}
+				if !exists {
+					if err := tx.StoreBlock(block); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: Update: unexpected error: %v", test.name,
+				err)
+		}
+		err = idb.View(func(tx database.Tx) error {
+			for j, block := range blocks[:numStored] {
+				wantBytes, err := block.Bytes()
+				if err != nil {
+					return err
+				}
+				gotBytes, err := tx.FetchBlock(block.Hash())
+				if err != nil {
+					return err
+				}
+				if !bytes.Equal(gotBytes, wantBytes) {
+					return fmt.Errorf("FetchBlock #%d: "+
+						"bytes mismatch", j)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: View: unexpected error: %v", test.name,
+				err)
+		}
+		idb.Close()
+	}
+}
@@ -63,6 +63,57 @@ type Cursor interface {
 	Value() []byte
 }
 
+// IterOptions specifies the range of key/value pairs an iterator covers and the
+// order it returns them in.  The zero value covers all key/value pairs of a
+// bucket in ascending key order.
+type IterOptions struct {
+	// Prefix limits the iterator to the keys which start with it.
+	Prefix []byte
+
+	// Start and Limit further limit the iterator to the keys which are
+	// greater than or equal to Start and less than Limit.  Either of them
+	// may be nil to leave that end of the range unbounded.
+	Start []byte
+	Limit []byte
+
+	// Reverse causes the key/value pairs to be returned in descending key
+	// order.
+	Reverse bool
+}
+
+// Iterator represents an ordered iterator over a range of the key/value pairs
+// of a bucket.  Unlike a cursor, it does not include nested buckets and never
+// moves outside of its range, which allows drivers to avoid reading the rest
+// of the bucket.
+//
+// An iterator is not positioned when it is created.  The first call to Next
+// positions it at the first key/value pair of its range in iteration order.
+//
+// Note that iterators are invalidated by modifications to the bucket the same
+// way cursors are.
+type Iterator interface {
+	// Next moves the iterator to the next key/value pair in iteration
+	// order and returns whether or not the pair exists.
+	Next() bool
+
+	// Seek positions the iterator at the first key/value pair in iteration
+	// order whose key is not before the passed seek key.  That is the first
+	// key greater than or equal to it, or the last key less than or equal
+	// to it when iterating in reverse.  Returns whether or not the pair
+	// exists.
+	Seek(seek []byte) bool
+
+	// Key returns the current key the iterator is pointing to.
+	Key() []byte
+
+	// Value returns the current value the iterator is pointing to.
+	Value() []byte
+
+	// Release releases the resources associated with the iterator.  The
+	// iterator must not be used afterwards.
+	Release()
+}
+
 // Bucket represents a collection of key/value pairs.
 type Bucket interface {
 	// Bucket retrieves a nested bucket with the given key.  Returns nil if
@@ -215,6 +266,26 @@ type Tx interface {
 	// Metadata returns the top-most bucket for all metadata storage.
 	Metadata() Bucket
 
+	// Iterator returns a new iterator over the key/value pairs of the
+	// passed bucket which are in the range specified by the passed options.
+	// Nil options cover all key/value pairs of the bucket in ascending key
+	// order.  Nested buckets are not included.
+	//
+	// This allows scanning the keys of a bucket from a given key or with a
+	// given prefix, such as those of an index, without visiting every
+	// key/value pair of the bucket as ForEach does.
+	//
+	// The interface contract guarantees at least the following errors will
+	// be returned (other implementation-specific errors are possible):
+	//   - ErrBucketNotFound if the bucket is nil
+	//   - ErrIncompatibleValue if the bucket belongs to another transaction
+	//   - ErrTxClosed if the transaction has already been closed
+	//
+	// NOTE: The iterator must be released by calling Release on it when it
+	// is no longer needed.  The keys and values it returns are only valid
+	// during the transaction and must NOT be modified by the caller.
+	Iterator(bucket Bucket, opts *IterOptions) (Iterator, error)
+
 	// StoreBlock stores the provided block into the database.  There are no
 	// checks to ensure the block connects to a previous block, contains
 	// double spends, or any additional functionality such as transaction
@@ -459,6 +530,22 @@ type DB interface {
 	// user-supplied function will result in a panic.
 	Update(fn func(tx Tx) error) error
 
+	// Prune removes the oldest stored blocks until the total size of the
+	// stored blocks no longer exceeds the provided target size in bytes.
+	// Since blocks are typically grouped together in storage, more blocks
+	// than strictly necessary may be removed and the target size may not
+	// be reached when the blocks which are not allowed to be removed take
+	// up more space.  Pruning stops at the first block the provided
+	// function reports must be kept.
+	//
+	// The hashes of the removed blocks are returned.  Any data other than
+	// the blocks themselves, such as the metadata, is not affected.
+	Prune(targetSize uint64, keepBlock func(hash *chainhash.Hash) bool) ([]chainhash.Hash, error)
+
+	// BeenPruned returns whether or not blocks have ever been removed from
+	// the database by Prune.
+	BeenPruned() (bool, error)
+
 	// Close cleanly shuts down the database and syncs all data.  It will
 	// block until all database transactions have been finalized (rolled
 	// back or committed).
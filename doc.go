@@ -21,12 +21,24 @@ Usage:
   hdfd [OPTIONS]
 
 Application Options:
+      --acceptreplacement     Accept transactions that replace existing
+                              transactions within the mempool through the
+                              Replace-By-Fee (RBF) signaling policy
       --addcheckpoint=        Add a custom checkpoint.  Format:
                               '<height>:<hash>'
   -a, --addpeer=              Add a peer to connect with at startup
       --addrindex             Maintain a full address-based transaction index
                               which makes the searchrawtransactions RPC
                               available
+      --asmap=                Path to an ASMap file in the format used by
+                              Bitcoin Core to group peer addresses by the
+                              autonomous systems announcing them rather than by
+                              their /16 or /32 networks
+      --assumevalid=          Assume the scripts of the specified block and its
+                              ancestors are valid instead of the block defined
+                              by the network parameters -- Format:
+                              '<height>:<hash>' or '0' to check the scripts of
+                              all blocks after the latest checkpoint
       --banduration=          How long to ban misbehaving peers.  Valid time
                               units are {s, m, h}.  Minimum 1 second (default:
                               24h0m0s)
@@ -43,11 +55,41 @@ Application Options:
       --blockprioritysize=    Size in bytes for high-priority/low-fee
                               transactions when creating a block (default:
                               50000)
+      --blockrelayconns=      Number of outbound peers to maintain in addition
+                              to the full-relay ones which only relay blocks,
+                              to make it harder to isolate the node from the
+                              network -- They are limited by --maxpeers
+                              (default: 2)
       --blocksonly            Do not accept transactions from remote peers.
+      --bulletinkey=          Add a hex encoded public key which is allowed to
+                              sign network bulletins in addition to the keys
+                              defined by the network parameters -- Bulletins
+                              are only supported and relayed when at least one
+                              key is known
+      --bytespersigop=        Number of virtual bytes each unit of signature
+                              operation cost of a transaction is counted as
+                              when calculating its fee rate and size limits in
+                              the mempool -- 0 disables the adjustment
+                              (default: 20)
+      --checkpointmode=       How the checkpoints are used {enforce, advisory}
+                              -- Enforced checkpoints also skip validating the
+                              scripts of the blocks before them, while advisory
+                              checkpoints are only used to estimate the sync
+                              progress and reject forks before them so every
+                              block is fully validated (default: enforce)
   -C, --configfile=           Path to configuration file
       --connect=              Connect only to the specified peers at startup
       --cpuprofile=           Write CPU profile to the specified file
-  -b, --datadir=              Directory to store data
+      --datacarriersize=      Maximum number of bytes of data carried by the
+                              null data (OP_RETURN) outputs of relayed and
+                              mined transactions (default: 80)
+  -b, --datadir=            Directory to store data
+      --dbblockfilesize=      Maximum size of each block file in MiB -- 0 uses
+                              the default of 512 MiB (ffldb only)
+      --dbmmap                Memory map the block files to speed up concurrent
+                              historical block reads (ffldb only)
+      --dbprealloc            Preallocate the disk space of the block files to
+                              reduce their fragmentation (ffldb only)
       --dbtype=               Database backend to use for the Block Chain
                               (default: ffldb)
   -d, --debuglevel=           Logging level for all subsystems {trace, debug,
@@ -64,9 +106,34 @@ Application Options:
                               then exits.
       --droptxindex           Deletes the hash-based transaction index from the
                               database on start up and then exits.
+      --extrablockrelayinterval=
+                              Periodically connect to an extra block-relay-only
+                              peer to find out whether the others are
+                              withholding blocks, then disconnect the one which
+                              provided a block least recently -- 0 disables it
+                              (default: 5m0s)
       --externalip=           Add an ip to the list of local addresses we claim
                               to listen on to peers
       --generate              Generate (mine) bitcoins using the CPU
+      --headersonly           Only download and validate the headers of the
+                              chain instead of its blocks, which implies
+                              --blocksonly and --nocfilters -- NOTE: Can't be
+                              used with --generate, --prune, --utxosnapshot,
+                              --txindex or --addrindex
+      --limitancestorcount=   Max number of unconfirmed transactions, including
+                              itself, a transaction accepted to the mempool may
+                              depend on -- 0 disables the limit (default: 25)
+      --limitancestorsize=    Max total virtual size in bytes of a transaction
+                              accepted to the mempool together with all of its
+                              unconfirmed ancestors -- 0 disables the limit
+                              (default: 101000)
+      --limitdescendantcount= Max number of unconfirmed transactions, including
+                              itself, that may depend on a transaction in the
+                              mempool -- 0 disables the limit (default: 25)
+      --limitdescendantsize=  Max total virtual size in bytes of a transaction
+                              in the mempool together with all of its
+                              unconfirmed descendants -- 0 disables the limit
+                              (default: 101000)
       --limitfreerelay=       Limit relay of transactions with no transaction
                               fee to the given amount in thousands of bytes per
                               minute (default: 15)
@@ -74,14 +141,58 @@ Application Options:
                               (default all interfaces port: 8333, testnet:
                               18333)
       --logdir=               Directory to log output
+      --maxdownloadrate=      Max rate in KiB per second for the bytes received
+                              from all non-whitelisted peers -- 0 disables the
+                              limit
+      --maxdownloadtarget=    Target in MiB for the bytes received from all
+                              peers per 24 hours -- The progress towards it is
+                              reported by getnettotals -- 0 disables the target
+      --maxmempool=           Max total virtual size in megabytes of the
+                              transactions in the mempool -- The transactions
+                              with the lowest fee rates are evicted when it is
+                              exceeded and the minimum fee rate for new
+                              transactions is raised accordingly -- 0 disables
+                              the limit (default: 300)
+      --maxorphanpeerbytes=   Max total size in bytes of the orphan
+                              transactions relayed by a single peer to keep in
+                              memory -- The oldest orphans of the peer are
+                              evicted when it is exceeded -- 0 disables the
+                              limit (default: 1000000)
       --maxorphantx=          Max number of orphan transactions to keep in
                               memory (default: 100)
       --maxpeers=             Max number of inbound and outbound peers
                               (default: 125)
+      --maxuploadrate=        Max rate in KiB per second for the bytes sent to
+                              all non-whitelisted peers -- 0 disables the limit
+      --maxuploadtarget=      Target in MiB for the bytes sent to all peers per
+                              24 hours -- Once it is almost reached, blocks
+                              older than a week are no longer served to
+                              non-whitelisted peers while relay continues --
+                              The progress towards it is reported by
+                              getnettotals -- 0 disables the target
+      --mempoolexpiry=        Max amount of time a transaction may stay in the
+                              mempool before it is evicted along with its
+                              descendants -- 0 disables expiry (default:
+                              336h0m0s)
+      --minimumchainwork=     Override the minimum cumulative work the main
+                              chain is known to have defined by the network
+                              parameters as a hex number -- The chain is not
+                              considered current until it has this much work
+                              and blocks which fork it at a block with less work
+                              are rejected -- Use '0' to disable
       --miningaddr=           Add the specified payment address to the list of
                               addresses to use for generated blocks -- At least
                               one address is required if the generate option is
                               set
+      --miningcoinbasedata=   Hex encoded data to add to the coinbase
+                              transaction script of generated blocks -- NOTE:
+                              Limited to 73 bytes
+      --miningmintxfee=       The minimum fee rate in BTC/kB of the transactions
+                              to include in generated blocks regardless of the
+                              minimum block size and their priority
+      --miningversionbit=     Signal for the specified version bit (0-28) in
+                              generated blocks in addition to the bits of the
+                              rule change deployments
       --minrelaytxfee=        The minimum transaction fee in BTC/kB to be
                               considered a non-zero fee. (default: 1e-05)
       --nobanning             Disable banning of misbehaving peers
@@ -95,6 +206,8 @@ Application Options:
                               also specifying listen interfaces via --listen
       --noonion               Disable connecting to tor hidden services
       --nopeerbloomfilters    Disable bloom filtering support
+      --nopersistmempool      Do not save the mempool on shutdown and restore
+                              it on startup
       --norelaypriority       Do not require free or low-fee transactions to
                               have high priority for relaying
       --norpc                 Disable built-in RPC server -- NOTE: The RPC
@@ -108,47 +221,130 @@ Application Options:
                               (eg. 127.0.0.1:9050)
       --onionpass=            Password for onion proxy server
       --onionuser=            Username for onion proxy server
-      --profile=              Enable HTTP profiling on given port -- NOTE port
-                              must be between 1024 and 65536
+      --peercompression       Enable experimental compression of block and
+                              committed filter messages exchanged with peers
+                              which enable it as well
+      --peermaxdownloadrate=  Max rate in KiB per second for the bytes received
+                              from each non-whitelisted peer -- 0 disables the
+                              limit
+      --peermaxuploadrate=    Max rate in KiB per second for the bytes sent to
+                              each non-whitelisted peer -- 0 disables the limit
+      --peerrotateinterval=   Periodically replace the longest connected
+                              outbound peer with a new peer in a different
+                              network group to improve privacy -- NOTE: Must be
+                              at least 1m when enabled
+      --profile=              Enable HTTP profiling and chain metrics in the
+                              Prometheus format at /metrics on given port --
+                              NOTE port must be between 1024 and 65536
       --proxy=                Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)
       --proxypass=            Password for proxy server
       --proxyuser=            Username for proxy server
+      --prune=                Reduce storage requirements by removing the oldest
+                              blocks to keep the stored block data below the
+                              specified target size in MiB -- NOTE: Must be at
+                              least 550 and can't be used with --txindex or
+                              --addrindex
+      --rebroadcastinterval=  Average amount of time in between rebroadcasts of
+                              the mempool transactions which pay high enough
+                              fees to have been mined but were not, suggesting
+                              they are missing from the mempools of other peers
+                              -- 0 disables rebroadcasting (default: 1h0m0s)
+      --recentblockcachesize= The maximum number of the most recently connected
+                              blocks to keep in memory along with their spend
+                              journals to serve RPC requests and
+                              reorganizations without loading them from the
+                              database (default: 12)
       --regtest               Use the regression test network
       --rejectnonstd          Reject non-standard transactions regardless of
                               the default settings for the active network.
       --relaynonstd           Relay non-standard transactions regardless of the
                               default settings for the active network.
+      --rpcalloworigin=       Allow cross-origin (CORS) requests to the RPC
+                              server from the given origin, e.g.
+                              https://example.com -- may be specified multiple
+                              times and * allows all origins
+      --rpcbasepath=          Path prefix to serve the RPC server endpoints
+                              under, e.g. /hdfd to serve them at /hdfd/ and
+                              /hdfd/ws behind a reverse proxy
       --rpccert=              File containing the certificate file
       --rpckey=               File containing the certificate key
       --rpclimitpass=         Password for limited RPC connections
       --rpclimituser=         Username for limited RPC connections
       --rpclisten=            Add an interface/port to listen for RPC
                               connections (default port: 8334, testnet: 18334)
+      --rpcunixlisten=        Add a unix domain socket path to listen for RPC
+                              connections -- NOTE: TLS is not used for unix
+                              domain sockets
       --rpcmaxclients=        Max number of RPC clients for standard
                               connections (default: 10)
       --rpcmaxconcurrentreqs= Max number of concurrent RPC requests that may be
                               processed concurrently (default: 20)
       --rpcmaxwebsockets=     Max number of RPC websocket connections (default:
                               25)
+      --rpcmaxwsfiltersize=   Max number of addresses and outpoints a single
+                              RPC websocket client may load into its
+                              transaction filter -- 0 disables the limit
+                              (default: 1000000)
+      --rpcmaxwssubscriptions= Max number of addresses and outpoints a single
+                              RPC websocket client may request notifications
+                              for -- 0 disables the limit (default: 100000)
       --rpcquirks             Mirror some JSON-RPC quirks of Bitcoin Core --
                               NOTE: Discouraged unless interoperability issues
                               need to be worked around
+      --rpctrustedproxy=      Add an IP network or IP of a reverse proxy whose
+                              X-Forwarded-For header is trusted to identify RPC
+                              clients (eg. 192.168.1.0/24 or ::1)
   -P, --rpcpass=              Password for RPC connections
   -u, --rpcuser=              Username for RPC connections
       --sigcachemaxsize=      The maximum number of entries in the signature
                               verification cache (default: 100000)
       --simnet                Use the simulation test network
+      --skiplocalchecksums    Do not calculate or verify message checksums for
+                              peers connected over unix sockets -- NOTE: The
+                              remote end must also skip checksums
+      --synccfheaders         Also download the committed filter headers of
+                              the header chain from peers -- NOTE: Requires
+                              --headersonly
       --testnet               Use the test network
       --torisolation          Enable Tor stream isolation by randomizing user
                               credentials for each connection.
-      --trickleinterval=      Minimum time between attempts to send new
-                              inventory to a connected peer (default: 10s)
+      --trickleinterval=      Average time between attempts to send new
+                              inventory to a connected peer -- the actual
+                              times are randomized (default: 10s)
       --txindex               Maintain a full hash-based transaction index
                               which makes all transactions available via the
                               getrawtransaction RPC
       --uacomment=            Comment to add to the user agent -- See BIP 14
                               for more information.
+      --unixlisten=           Add a unix domain socket path to listen for peer
+                              connections from applications on the same host
+      --unixsocketmode=       File permission mode, in octal, of the unix domain
+                              sockets created by --unixlisten and
+                              --rpcunixlisten (default: 0600)
       --upnp                  Use UPnP to map our listening port outside of NAT
+      --utxocachemaxsize=     The maximum size in MiB of the in-memory utxo
+                              cache -- Modifications to the utxo set are
+                              written to the database once it is exceeded or
+                              periodically otherwise (default: 250)
+      --utxosnapshot=         Bootstrap the chain state from the specified utxo
+                              set snapshot file and validate the historical
+                              chain in the background -- NOTE: Only used when
+                              the chain has not been synced yet and requires
+                              --nocfilters while it can't be used with
+                              --txindex or --addrindex
+      --utxosnapshothash=     Trust the utxo set snapshot specified by
+                              --utxosnapshot when its utxo set hash matches
+                              this one even if the chain parameters do not
+                              commit to it, such as a snapshot dumped from
+                              another node you control
+      --vbparams=             Override the start and expire times of a
+                              deployment on the regtest and simnet networks --
+                              Format: '<deployment>:<starttime>:<expiretime>'
+                              where deployment is one of {testdummy, csv,
+                              segwit} and the times are unix timestamps
+      --vbwindow=             Override the rule change activation threshold
+                              and confirmation window on the regtest and
+                              simnet networks -- Format: '<threshold>:<window>'
   -V, --version               Display version information and exit
       --whitelist=            Add an IP network or IP that will not be banned.
                               (eg. 192.168.1.0/24 or ::1)
@@ -17,6 +17,7 @@ import (
 
 	"github.com/ifishnet/hdfd/blockchain/indexers"
 	"github.com/ifishnet/hdfd/database"
+	"github.com/ifishnet/hdfd/database/ffldb"
 	"github.com/ifishnet/hdfd/limits"
 )
 
@@ -158,7 +159,18 @@ func hdfdMain(serverChan chan<- *server) error {
 		server.Stop()
 		server.WaitForShutdown()
 		srvrLog.Infof("Server shutdown complete")
+
+		// Write the modifications to the utxo set held in memory to the
+		// database now that no more blocks are being processed.
+		if err := server.chain.FlushUtxoCache(); err != nil {
+			hdfdLog.Errorf("Unable to flush the utxo cache: %v", err)
+		}
 	}()
+	// Serve the chain metrics from the profile server when it is enabled.
+	if cfg.Profile != "" {
+		http.Handle("/metrics", chainMetricsHandler(server.chain))
+	}
+
 	server.Start()
 	if serverChan != nil {
 		serverChan <- server
@@ -270,8 +282,21 @@ func loadBlockDB() (database.DB, error) {
 	// each run, so remove it now if it already exists.
 	removeRegressionDB(dbPath)
 
+	// The ffldb backend accepts additional options.
+	dbArgs := []interface{}{dbPath, activeNetParams.Net}
+	if cfg.DbType == "ffldb" {
+		opts := &ffldb.Options{
+			MmapReads:     cfg.DbMmap,
+			BlockFileSize: cfg.DbBlockFileSize * 1024 * 1024,
+		}
+		if cfg.DbPrealloc {
+			opts.PreallocSize = ffldb.DefaultPreallocSize
+		}
+		dbArgs = append(dbArgs, opts)
+	}
+
 	hdfdLog.Infof("Loading block database from '%s'", dbPath)
-	db, err := database.Open(cfg.DbType, dbPath, activeNetParams.Net)
+	db, err := database.Open(cfg.DbType, dbArgs...)
 	if err != nil {
 		// Return the error if it's not because the database doesn't
 		// exist.
@@ -286,7 +311,7 @@ func loadBlockDB() (database.DB, error) {
 		if err != nil {
 			return nil, err
 		}
-		db, err = database.Create(cfg.DbType, dbPath, activeNetParams.Net)
+		db, err = database.Create(cfg.DbType, dbArgs...)
 		if err != nil {
 			return nil, err
 		}
@@ -6,6 +6,7 @@ package hdfec
 
 import (
 	"encoding/hex"
+	"math/big"
 	"testing"
 )
 
@@ -77,6 +78,25 @@ func BenchmarkScalarMult(b *testing.B) {
 	}
 }
 
+// BenchmarkMultiScalarMult benchmarks the secp256k1 curve MultiScalarMult
+// function with 64 points, which is comparable to 64 calls to ScalarMult.
+func BenchmarkMultiScalarMult(b *testing.B) {
+	x := fromHex("34f9460f0e4f08393d192b3c5133a6ba099aa0ad9fd54ebccfacdfa239ff49c6")
+	y := fromHex("0b71ea9bd730fd8923f6d25a7a91e7dd7728a960686cb5a901bb419e0f2ca232")
+	k := fromHex("d74bf844b0862475103d96a611cf2d898447e288d34b360bc885cb8ce7c00575")
+	xs := make([]*big.Int, 64)
+	ys := make([]*big.Int, 64)
+	ks := make([][]byte, 64)
+	for i := range ks {
+		xs[i], ys[i], ks[i] = x, y, k.Bytes()
+	}
+	curve := S256()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		curve.MultiScalarMult(xs, ys, ks)
+	}
+}
+
 // BenchmarkNAF benchmarks the NAF function.
 func BenchmarkNAF(b *testing.B) {
 	k := fromHex("d74bf844b0862475103d96a611cf2d898447e288d34b360bc885cb8ce7c00575")
@@ -864,6 +864,87 @@ func (curve *KoblitzCurve) ScalarMult(Bx, By *big.Int, k []byte) (*big.Int, *big
 	return curve.fieldJacobianToBigAffine(qx, qy, qz)
 }
 
+// nafTerm is a point along with the NAF representation of the scalar it is
+// multiplied by in MultiScalarMult.
+type nafTerm struct {
+	x, y, yNeg, z fieldVal
+	pos, neg      []byte
+}
+
+// MultiScalarMult returns the sum of ks[i]*(xs[i], ys[i]) for all of the passed
+// points and big endian integers.  The point at infinity is returned as (0, 0).
+//
+// It is considerably faster than summing the results of ScalarMult since all
+// of the products share the same doublings.  This is known as Strauss' or
+// Shamir's trick.
+func (curve *KoblitzCurve) MultiScalarMult(xs, ys []*big.Int, ks [][]byte) (*big.Int, *big.Int) {
+	// Decompose every scalar into k1 and k2 and every point P into P and
+	// ϕ(P) the same way ScalarMult does, so each product is the sum of two
+	// products with scalars of half the size.
+	terms := make([]nafTerm, 0, 2*len(ks))
+	var m int
+	for i, k := range ks {
+		k1, k2, signK1, signK2 := curve.splitK(curve.moduloReduce(k))
+
+		var t1, t2 nafTerm
+		px, py := curve.bigAffineToField(xs[i], ys[i])
+		t1.x.Set(px)
+		t1.y.Set(py)
+		t1.yNeg.NegateVal(py, 1)
+		t1.z.SetInt(1)
+		t2.x.Mul2(px, curve.beta)
+		t2.y.Set(py)
+		t2.yNeg.NegateVal(py, 1)
+		t2.z.SetInt(1)
+		if signK1 == -1 {
+			t1.y, t1.yNeg = t1.yNeg, t1.y
+		}
+		if signK2 == -1 {
+			t2.y, t2.yNeg = t2.yNeg, t2.y
+		}
+		t1.pos, t1.neg = NAF(k1)
+		t2.pos, t2.neg = NAF(k2)
+		for _, t := range []nafTerm{t1, t2} {
+			if len(t.pos) > m {
+				m = len(t.pos)
+			}
+			terms = append(terms, t)
+		}
+	}
+
+	// Add left-to-right using the NAF optimization like ScalarMult, but
+	// double only once per bit for all of the terms.
+	qx, qy, qz := new(fieldVal), new(fieldVal), new(fieldVal)
+	for i := 0; i < m; i++ {
+		for j := 7; j >= 0; j-- {
+			// Q = 2 * Q
+			curve.doubleJacobian(qx, qy, qz, qx, qy, qz)
+
+			mask := byte(1) << uint(j)
+			for ti := range terms {
+				t := &terms[ti]
+
+				// Since we're going left-to-right, the shorter
+				// representations are padded with 0s in front.
+				idx := i - (m - len(t.pos))
+				if idx < 0 {
+					continue
+				}
+				if t.pos[idx]&mask != 0 {
+					curve.addJacobian(qx, qy, qz, &t.x, &t.y,
+						&t.z, qx, qy, qz)
+				} else if t.neg[idx]&mask != 0 {
+					curve.addJacobian(qx, qy, qz, &t.x,
+						&t.yNeg, &t.z, qx, qy, qz)
+				}
+			}
+		}
+	}
+
+	// Convert the Jacobian coordinate field values back to affine big.Ints.
+	return curve.fieldJacobianToBigAffine(qx, qy, qz)
+}
+
 // ScalarBaseMult returns k*G where G is the base point of the group and k is a
 // big endian integer.
 // Part of the elliptic.Curve interface.
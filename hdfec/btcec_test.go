@@ -663,6 +663,64 @@ func TestScalarMultRand(t *testing.T) {
 	}
 }
 
+// TestMultiScalarMultRand ensures MultiScalarMult returns the same sum as
+// adding the results of ScalarMult for random points and scalars.
+func TestMultiScalarMultRand(t *testing.T) {
+	s256 := S256()
+	for i := 0; i < 64; i++ {
+		numPoints := i%8 + 1
+		xs := make([]*big.Int, 0, numPoints)
+		ys := make([]*big.Int, 0, numPoints)
+		ks := make([][]byte, 0, numPoints)
+		xWant, yWant := new(big.Int), new(big.Int)
+		for j := 0; j < numPoints; j++ {
+			data := make([]byte, 64)
+			if _, err := rand.Read(data); err != nil {
+				t.Fatalf("failed to read random data at %d", i)
+			}
+			x, y := s256.ScalarBaseMult(data[:32])
+			xs = append(xs, x)
+			ys = append(ys, y)
+			ks = append(ks, data[32:])
+
+			px, py := s256.ScalarMult(x, y, data[32:])
+			if j == 0 {
+				xWant, yWant = px, py
+			} else {
+				xWant, yWant = s256.Add(xWant, yWant, px, py)
+			}
+		}
+
+		xGot, yGot := s256.MultiScalarMult(xs, ys, ks)
+		if xGot.Cmp(xWant) != 0 || yGot.Cmp(yWant) != 0 {
+			t.Fatalf("%d: bad output: got (%X, %X), want (%X, %X)",
+				i, xGot, yGot, xWant, yWant)
+		}
+	}
+}
+
+// TestMultiScalarMultInfinity ensures MultiScalarMult returns the point at
+// infinity when the products cancel out and when there are no points.
+func TestMultiScalarMultInfinity(t *testing.T) {
+	s256 := S256()
+	k := big.NewInt(0x1234567890)
+	negK := new(big.Int).Sub(s256.N, k)
+	xs := []*big.Int{s256.Gx, s256.Gx}
+	ys := []*big.Int{s256.Gy, s256.Gy}
+	ks := [][]byte{k.Bytes(), negK.Bytes()}
+	x, y := s256.MultiScalarMult(xs, ys, ks)
+	if x.Sign() != 0 || y.Sign() != 0 {
+		t.Fatalf("bad output for canceling products: got (%X, %X), "+
+			"want (0, 0)", x, y)
+	}
+
+	x, y = s256.MultiScalarMult(nil, nil, nil)
+	if x.Sign() != 0 || y.Sign() != 0 {
+		t.Fatalf("bad output for no points: got (%X, %X), want (0, 0)",
+			x, y)
+	}
+}
+
 func TestSplitK(t *testing.T) {
 	tests := []struct {
 		k      string
@@ -89,6 +89,17 @@ func NewGenerateCmd(numBlocks uint32) *GenerateCmd {
 	}
 }
 
+// GetAddrManInfoCmd defines the getaddrmaninfo JSON-RPC command.  This
+// command is not a standard Bitcoin command.  It is an extension for hdfd.
+type GetAddrManInfoCmd struct{}
+
+// NewGetAddrManInfoCmd returns a new instance which can be used to issue a
+// getaddrmaninfo JSON-RPC command.  This command is not a standard Bitcoin
+// command.  It is an extension for hdfd.
+func NewGetAddrManInfoCmd() *GetAddrManInfoCmd {
+	return &GetAddrManInfoCmd{}
+}
+
 // GetBestBlockCmd defines the getbestblock JSON-RPC command.
 type GetBestBlockCmd struct{}
 
@@ -107,6 +118,48 @@ func NewGetCurrentNetCmd() *GetCurrentNetCmd {
 	return &GetCurrentNetCmd{}
 }
 
+// GetPeerRotationsCmd defines the getpeerrotations JSON-RPC command.  This
+// command is not a standard Bitcoin command.  It is an extension for hdfd.
+type GetPeerRotationsCmd struct{}
+
+// NewGetPeerRotationsCmd returns a new instance which can be used to issue a
+// getpeerrotations JSON-RPC command.  This command is not a standard Bitcoin
+// command.  It is an extension for hdfd.
+func NewGetPeerRotationsCmd() *GetPeerRotationsCmd {
+	return &GetPeerRotationsCmd{}
+}
+
+// GetRawAddrManCmd defines the getrawaddrman JSON-RPC command.  This command is
+// not a standard Bitcoin command.  It is an extension for hdfd.
+type GetRawAddrManCmd struct{}
+
+// NewGetRawAddrManCmd returns a new instance which can be used to issue a
+// getrawaddrman JSON-RPC command.  This command is not a standard Bitcoin
+// command.  It is an extension for hdfd.
+func NewGetRawAddrManCmd() *GetRawAddrManCmd {
+	return &GetRawAddrManCmd{}
+}
+
+// GetRPCACLCmd defines the getrpcacl JSON-RPC command.  This command is not a
+// standard Bitcoin command.  It is an extension for hdfd.
+type GetRPCACLCmd struct{}
+
+// NewGetRPCACLCmd returns a new instance which can be used to issue a
+// getrpcacl JSON-RPC command.  This command is not a standard Bitcoin command.
+// It is an extension for hdfd.
+func NewGetRPCACLCmd() *GetRPCACLCmd {
+	return &GetRPCACLCmd{}
+}
+
+// GetRPCWhitelistCmd defines the getrpcwhitelist JSON-RPC command.
+type GetRPCWhitelistCmd struct{}
+
+// NewGetRPCWhitelistCmd returns a new instance which can be used to issue a
+// getrpcwhitelist JSON-RPC command.
+func NewGetRPCWhitelistCmd() *GetRPCWhitelistCmd {
+	return &GetRPCWhitelistCmd{}
+}
+
 // GetHeadersCmd defines the getheaders JSON-RPC command.
 //
 // NOTE: This is a ifishnet extension ported from
@@ -128,6 +181,52 @@ func NewGetHeadersCmd(blockLocators []string, hashStop string) *GetHeadersCmd {
 	}
 }
 
+// SetTemplateOptionsCmd defines the settemplateoptions JSON-RPC command.  The
+// options which are not specified are left unchanged.  This command is not a
+// standard Bitcoin command.  It is an extension for hdfd.
+type SetTemplateOptionsCmd struct {
+	CoinbaseData *string
+	VersionBits  *[]uint32
+	MinTxFee     *float64
+}
+
+// NewSetTemplateOptionsCmd returns a new instance which can be used to issue a
+// settemplateoptions JSON-RPC command.  This command is not a standard Bitcoin
+// command.  It is an extension for hdfd.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewSetTemplateOptionsCmd(coinbaseData *string, versionBits *[]uint32,
+	minTxFee *float64) *SetTemplateOptionsCmd {
+
+	return &SetTemplateOptionsCmd{
+		CoinbaseData: coinbaseData,
+		VersionBits:  versionBits,
+		MinTxFee:     minTxFee,
+	}
+}
+
+// SetSyncOptionsCmd defines the setsyncoptions JSON-RPC command.  The options
+// which are not specified are left unchanged.  This command is not a standard
+// Bitcoin command.  It is an extension for hdfd.
+type SetSyncOptionsCmd struct {
+	MaxSyncPeers   *int32
+	CheckpointMode *string
+}
+
+// NewSetSyncOptionsCmd returns a new instance which can be used to issue a
+// setsyncoptions JSON-RPC command.  This command is not a standard Bitcoin
+// command.  It is an extension for hdfd.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewSetSyncOptionsCmd(maxSyncPeers *int32, checkpointMode *string) *SetSyncOptionsCmd {
+	return &SetSyncOptionsCmd{
+		MaxSyncPeers:   maxSyncPeers,
+		CheckpointMode: checkpointMode,
+	}
+}
+
 // VersionCmd defines the version JSON-RPC command.
 //
 // NOTE: This is a ifishnet extension ported from
@@ -149,8 +248,15 @@ func init() {
 	MustRegisterCmd("node", (*NodeCmd)(nil), flags)
 	MustRegisterCmd("generate", (*GenerateCmd)(nil), flags)
 	MustRegisterCmd("generatetoaddress", (*GenerateToAddressCmd)(nil), flags)
+	MustRegisterCmd("getaddrmaninfo", (*GetAddrManInfoCmd)(nil), flags)
 	MustRegisterCmd("getbestblock", (*GetBestBlockCmd)(nil), flags)
 	MustRegisterCmd("getcurrentnet", (*GetCurrentNetCmd)(nil), flags)
 	MustRegisterCmd("getheaders", (*GetHeadersCmd)(nil), flags)
+	MustRegisterCmd("getpeerrotations", (*GetPeerRotationsCmd)(nil), flags)
+	MustRegisterCmd("getrawaddrman", (*GetRawAddrManCmd)(nil), flags)
+	MustRegisterCmd("getrpcacl", (*GetRPCACLCmd)(nil), flags)
+	MustRegisterCmd("getrpcwhitelist", (*GetRPCWhitelistCmd)(nil), flags)
+	MustRegisterCmd("setsyncoptions", (*SetSyncOptionsCmd)(nil), flags)
+	MustRegisterCmd("settemplateoptions", (*SetTemplateOptionsCmd)(nil), flags)
 	MustRegisterCmd("version", (*VersionCmd)(nil), flags)
 }
@@ -194,6 +194,117 @@ func TestHdfdExtCmds(t *testing.T) {
 				HashStop: "000000000000000000ba33b33e1fad70b69e234fc24414dd47113bff38f523f7",
 			},
 		},
+		{
+			name: "getaddrmaninfo",
+			newCmd: func() (interface{}, error) {
+				return hdfjson.NewCmd("getaddrmaninfo")
+			},
+			staticCmd: func() interface{} {
+				return hdfjson.NewGetAddrManInfoCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getaddrmaninfo","params":[],"id":1}`,
+			unmarshalled: &hdfjson.GetAddrManInfoCmd{},
+		},
+		{
+			name: "getpeerrotations",
+			newCmd: func() (interface{}, error) {
+				return hdfjson.NewCmd("getpeerrotations")
+			},
+			staticCmd: func() interface{} {
+				return hdfjson.NewGetPeerRotationsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getpeerrotations","params":[],"id":1}`,
+			unmarshalled: &hdfjson.GetPeerRotationsCmd{},
+		},
+		{
+			name: "getrawaddrman",
+			newCmd: func() (interface{}, error) {
+				return hdfjson.NewCmd("getrawaddrman")
+			},
+			staticCmd: func() interface{} {
+				return hdfjson.NewGetRawAddrManCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getrawaddrman","params":[],"id":1}`,
+			unmarshalled: &hdfjson.GetRawAddrManCmd{},
+		},
+		{
+			name: "getrpcacl",
+			newCmd: func() (interface{}, error) {
+				return hdfjson.NewCmd("getrpcacl")
+			},
+			staticCmd: func() interface{} {
+				return hdfjson.NewGetRPCACLCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getrpcacl","params":[],"id":1}`,
+			unmarshalled: &hdfjson.GetRPCACLCmd{},
+		},
+		{
+			name: "getrpcwhitelist",
+			newCmd: func() (interface{}, error) {
+				return hdfjson.NewCmd("getrpcwhitelist")
+			},
+			staticCmd: func() interface{} {
+				return hdfjson.NewGetRPCWhitelistCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getrpcwhitelist","params":[],"id":1}`,
+			unmarshalled: &hdfjson.GetRPCWhitelistCmd{},
+		},
+		{
+			name: "setsyncoptions",
+			newCmd: func() (interface{}, error) {
+				return hdfjson.NewCmd("setsyncoptions")
+			},
+			staticCmd: func() interface{} {
+				return hdfjson.NewSetSyncOptionsCmd(nil, nil)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"setsyncoptions","params":[],"id":1}`,
+			unmarshalled: &hdfjson.SetSyncOptionsCmd{},
+		},
+		{
+			name: "setsyncoptions optional",
+			newCmd: func() (interface{}, error) {
+				return hdfjson.NewCmd("setsyncoptions", 8, "advisory")
+			},
+			staticCmd: func() interface{} {
+				return hdfjson.NewSetSyncOptionsCmd(hdfjson.Int32(8),
+					hdfjson.String("advisory"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setsyncoptions","params":[8,"advisory"],"id":1}`,
+			unmarshalled: &hdfjson.SetSyncOptionsCmd{
+				MaxSyncPeers:   hdfjson.Int32(8),
+				CheckpointMode: hdfjson.String("advisory"),
+			},
+		},
+		{
+			name: "settemplateoptions",
+			newCmd: func() (interface{}, error) {
+				return hdfjson.NewCmd("settemplateoptions")
+			},
+			staticCmd: func() interface{} {
+				return hdfjson.NewSetTemplateOptionsCmd(nil, nil, nil)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"settemplateoptions","params":[],"id":1}`,
+			unmarshalled: &hdfjson.SetTemplateOptionsCmd{},
+		},
+		{
+			name: "settemplateoptions optional",
+			newCmd: func() (interface{}, error) {
+				return hdfjson.NewCmd("settemplateoptions", "2f706f6f6c2f",
+					[]uint32{1, 4}, 0.0001)
+			},
+			staticCmd: func() interface{} {
+				versionBits := []uint32{1, 4}
+				return hdfjson.NewSetTemplateOptionsCmd(
+					hdfjson.String("2f706f6f6c2f"), &versionBits,
+					hdfjson.Float64(0.0001))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"settemplateoptions","params":["2f706f6f6c2f",[1,4],0.0001],"id":1}`,
+			unmarshalled: &hdfjson.SetTemplateOptionsCmd{
+				CoinbaseData: hdfjson.String("2f706f6f6c2f"),
+				VersionBits:  &[]uint32{1, 4},
+				MinTxFee:     hdfjson.Float64(0.0001),
+			},
+		},
 		{
 			name: "version",
 			newCmd: func() (interface{}, error) {
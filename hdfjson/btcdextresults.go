@@ -6,15 +6,139 @@
 package hdfjson
 
 // VersionResult models objects included in the version response.  In the actual
-// result, these objects are keyed by the program or API name.
+// result, these objects are keyed by the program or API name.  The git commit,
+// build date, and features are only included for the program itself so callers
+// can detect which optional subsystems, such as the transaction and address
+// indexes, are enabled.
 //
 // NOTE: This is a ifishnet extension ported from
 // github.com/decred/dcrd/dcrjson.
 type VersionResult struct {
-	VersionString string `json:"versionstring"`
-	Major         uint32 `json:"major"`
-	Minor         uint32 `json:"minor"`
-	Patch         uint32 `json:"patch"`
-	Prerelease    string `json:"prerelease"`
-	BuildMetadata string `json:"buildmetadata"`
+	VersionString string   `json:"versionstring"`
+	Major         uint32   `json:"major"`
+	Minor         uint32   `json:"minor"`
+	Patch         uint32   `json:"patch"`
+	Prerelease    string   `json:"prerelease"`
+	BuildMetadata string   `json:"buildmetadata"`
+	GitCommit     string   `json:"gitcommit,omitempty"`
+	BuildDate     string   `json:"builddate,omitempty"`
+	Features      []string `json:"features,omitempty"`
+}
+
+// GetRPCWhitelistResult models the data from the getrpcwhitelist command.  The
+// methods are the keys of the map so the result has the same form as the
+// response of Bitcoin Core.
+type GetRPCWhitelistResult struct {
+	Methods map[string]struct{} `json:"methods"`
+}
+
+// RPCUserACL models the authorization policy of a single RPC user that is
+// included in the getrpcacl command result.  The methods are omitted for admin
+// users since they are authorized to use every method.
+type RPCUserACL struct {
+	User    string   `json:"user"`
+	Admin   bool     `json:"admin"`
+	Methods []string `json:"methods,omitempty"`
+}
+
+// RPCLimitsResult models the limits the RPC server imposes on clients that
+// are included in the getrpcacl command result.
+type RPCLimitsResult struct {
+	MaxClients         int `json:"maxclients"`
+	MaxWebsockets      int `json:"maxwebsockets"`
+	MaxConcurrentReqs  int `json:"maxconcurrentreqs"`
+	MaxWSSubscriptions int `json:"maxwssubscriptions"`
+	MaxWSFilterSize    int `json:"maxwsfiltersize"`
+}
+
+// GetRPCACLResult models the data from the getrpcacl command.
+type GetRPCACLResult struct {
+	Users  []RPCUserACL    `json:"users"`
+	Limits RPCLimitsResult `json:"limits"`
+}
+
+// PeerRotationResult models an outbound peer which was disconnected by the
+// periodic peer rotation that is included in the getpeerrotations command
+// result.
+type PeerRotationResult struct {
+	Time     int64  `json:"time"`
+	ID       int32  `json:"id"`
+	Addr     string `json:"addr"`
+	NetGroup string `json:"netgroup"`
+}
+
+// GetPeerRotationsResult models the data from the getpeerrotations command.
+// The interval is zero when the periodic peer rotation is disabled.
+type GetPeerRotationsResult struct {
+	Interval  int64                `json:"interval"`
+	Rotations []PeerRotationResult `json:"rotations"`
+}
+
+// AddrManNetworkResult models the number of addresses of a single network
+// known to the address manager that is included in the getaddrmaninfo command
+// result.
+type AddrManNetworkResult struct {
+	Network string `json:"network"`
+	New     int    `json:"new"`
+	Tried   int    `json:"tried"`
+	Total   int    `json:"total"`
+}
+
+// ASMapResult models the ASMap used by the address manager that is included in
+// the getaddrmaninfo command result.
+type ASMapResult struct {
+	Size     int    `json:"size"`
+	Checksum string `json:"checksum"`
+}
+
+// GetAddrManInfoResult models the data from the getaddrmaninfo command.  The
+// ASMap is omitted when the address manager doesn't use one.
+type GetAddrManInfoResult struct {
+	Networks []AddrManNetworkResult `json:"networks"`
+	New      int                    `json:"new"`
+	Tried    int                    `json:"tried"`
+	Total    int                    `json:"total"`
+	ASMap    *ASMapResult           `json:"asmap,omitempty"`
+}
+
+// RawAddrManEntry models an address in a bucket of the address manager that
+// is included in the getrawaddrman command result.  The times are zero when
+// there was no connection attempt or successful connection, and the mapped AS
+// is omitted when the address is not mapped to an autonomous system.
+type RawAddrManEntry struct {
+	Bucket        int    `json:"bucket"`
+	Position      int    `json:"position"`
+	Address       string `json:"address"`
+	Port          uint16 `json:"port"`
+	Network       string `json:"network"`
+	Services      string `json:"services"`
+	Time          int64  `json:"time"`
+	Attempts      int    `json:"attempts"`
+	LastAttempt   int64  `json:"lastattempt"`
+	LastSuccess   int64  `json:"lastsuccess"`
+	Source        string `json:"source"`
+	SourceNetwork string `json:"source_network"`
+	MappedAS      uint32 `json:"mapped_as,omitempty"`
+}
+
+// GetRawAddrManResult models the data from the getrawaddrman command.
+type GetRawAddrManResult struct {
+	New   []RawAddrManEntry `json:"new"`
+	Tried []RawAddrManEntry `json:"tried"`
+}
+
+// SyncOptionsResult models the data from the setsyncoptions command.  It
+// contains the options of the sync manager after the command was applied.
+type SyncOptionsResult struct {
+	MaxSyncPeers   int32  `json:"maxsyncpeers"`
+	CheckpointMode string `json:"checkpointmode"`
+}
+
+// TemplateOptionsResult models the data from the settemplateoptions command.
+// It contains the options used to customize the block templates after the
+// command was applied.
+type TemplateOptionsResult struct {
+	CoinbaseData string   `json:"coinbasedata"`
+	VersionBits  []uint32 `json:"versionbits"`
+	MinTxFee     float64  `json:"mintxfee"`
 }
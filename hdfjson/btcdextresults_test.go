@@ -35,6 +35,114 @@ func TestHdfdExtCustomResults(t *testing.T) {
 			},
 			expected: `{"versionstring":"1.0.0","major":1,"minor":0,"patch":0,"prerelease":"pr","buildmetadata":"bm"}`,
 		},
+		{
+			name: "versionresult with build info",
+			result: &hdfjson.VersionResult{
+				VersionString: "0.20.1-beta",
+				Major:         0,
+				Minor:         20,
+				Patch:         1,
+				Prerelease:    "beta",
+				GitCommit:     "8bd7c32",
+				BuildDate:     "2021-06-01",
+				Features:      []string{"txindex", "prune"},
+			},
+			expected: `{"versionstring":"0.20.1-beta","major":0,"minor":20,"patch":1,"prerelease":"beta","buildmetadata":"","gitcommit":"8bd7c32","builddate":"2021-06-01","features":["txindex","prune"]}`,
+		},
+		{
+			name: "getrpcwhitelistresult",
+			result: &hdfjson.GetRPCWhitelistResult{
+				Methods: map[string]struct{}{
+					"getbestblockhash": {},
+					"help":             {},
+				},
+			},
+			expected: `{"methods":{"getbestblockhash":{},"help":{}}}`,
+		},
+		{
+			name: "getrpcaclresult",
+			result: &hdfjson.GetRPCACLResult{
+				Users: []hdfjson.RPCUserACL{
+					{User: "admin", Admin: true},
+					{
+						User:    "limited",
+						Methods: []string{"getbestblockhash", "help"},
+					},
+				},
+				Limits: hdfjson.RPCLimitsResult{
+					MaxClients:         10,
+					MaxWebsockets:      25,
+					MaxConcurrentReqs:  20,
+					MaxWSSubscriptions: 100000,
+					MaxWSFilterSize:    1000000,
+				},
+			},
+			expected: `{"users":[{"user":"admin","admin":true},{"user":"limited","admin":false,"methods":["getbestblockhash","help"]}],"limits":{"maxclients":10,"maxwebsockets":25,"maxconcurrentreqs":20,"maxwssubscriptions":100000,"maxwsfiltersize":1000000}}`,
+		},
+		{
+			name: "getpeerrotationsresult",
+			result: &hdfjson.GetPeerRotationsResult{
+				Interval: 1800,
+				Rotations: []hdfjson.PeerRotationResult{{
+					Time:     1600000000,
+					ID:       7,
+					Addr:     "203.0.113.5:8333",
+					NetGroup: "203.0.0.0",
+				}},
+			},
+			expected: `{"interval":1800,"rotations":[{"time":1600000000,"id":7,"addr":"203.0.113.5:8333","netgroup":"203.0.0.0"}]}`,
+		},
+		{
+			name: "getaddrmaninforesult",
+			result: &hdfjson.GetAddrManInfoResult{
+				Networks: []hdfjson.AddrManNetworkResult{{
+					Network: "ipv4",
+					New:     10,
+					Tried:   2,
+					Total:   12,
+				}},
+				New:   10,
+				Tried: 2,
+				Total: 12,
+			},
+			expected: `{"networks":[{"network":"ipv4","new":10,"tried":2,"total":12}],"new":10,"tried":2,"total":12}`,
+		},
+		{
+			name: "getrawaddrmanresult",
+			result: &hdfjson.GetRawAddrManResult{
+				New: []hdfjson.RawAddrManEntry{{
+					Bucket:        5,
+					Position:      1,
+					Address:       "203.0.113.5",
+					Port:          8333,
+					Network:       "ipv4",
+					Services:      "00000009",
+					Time:          1600000000,
+					Source:        "198.51.100.7",
+					SourceNetwork: "ipv4",
+					MappedAS:      64496,
+				}},
+				Tried: []hdfjson.RawAddrManEntry{},
+			},
+			expected: `{"new":[{"bucket":5,"position":1,"address":"203.0.113.5","port":8333,"network":"ipv4","services":"00000009","time":1600000000,"attempts":0,"lastattempt":0,"lastsuccess":0,"source":"198.51.100.7","source_network":"ipv4","mapped_as":64496}],"tried":[]}`,
+		},
+		{
+			name: "syncoptionsresult",
+			result: &hdfjson.SyncOptionsResult{
+				MaxSyncPeers:   8,
+				CheckpointMode: "advisory",
+			},
+			expected: `{"maxsyncpeers":8,"checkpointmode":"advisory"}`,
+		},
+		{
+			name: "templateoptionsresult",
+			result: &hdfjson.TemplateOptionsResult{
+				CoinbaseData: "2f706f6f6c2f",
+				VersionBits:  []uint32{1, 4},
+				MinTxFee:     0.0001,
+			},
+			expected: `{"coinbasedata":"2f706f6f6c2f","versionbits":[1,4],"mintxfee":0.0001}`,
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
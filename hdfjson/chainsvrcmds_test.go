@@ -217,8 +217,37 @@ func TestChainSvrCmds(t *testing.T) {
 			staticCmd: func() interface{} {
 				return hdfjson.NewDecodeScriptCmd("00")
 			},
-			marshalled:   `{"jsonrpc":"1.0","method":"decodescript","params":["00"],"id":1}`,
-			unmarshalled: &hdfjson.DecodeScriptCmd{HexScript: "00"},
+			marshalled: `{"jsonrpc":"1.0","method":"decodescript","params":["00"],"id":1}`,
+			unmarshalled: &hdfjson.DecodeScriptCmd{
+				HexScript: "00",
+				Verbosity: hdfjson.Int(0),
+			},
+		},
+		{
+			name: "decodescript verbosity",
+			newCmd: func() (interface{}, error) {
+				return hdfjson.NewCmd("decodescript", "00", 1)
+			},
+			staticCmd: func() interface{} {
+				return hdfjson.NewDecodeScriptCmdWithVerbosity("00",
+					hdfjson.Int(1))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"decodescript","params":["00",1],"id":1}`,
+			unmarshalled: &hdfjson.DecodeScriptCmd{
+				HexScript: "00",
+				Verbosity: hdfjson.Int(1),
+			},
+		},
+		{
+			name: "dumptxoutset",
+			newCmd: func() (interface{}, error) {
+				return hdfjson.NewCmd("dumptxoutset", "utxo.dat")
+			},
+			staticCmd: func() interface{} {
+				return hdfjson.NewDumpTxOutSetCmd("utxo.dat")
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"dumptxoutset","params":["utxo.dat"],"id":1}`,
+			unmarshalled: &hdfjson.DumpTxOutSetCmd{Path: "utxo.dat"},
 		},
 		{
 			name: "getaddednodeinfo",
@@ -588,6 +617,17 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getconnectioncount","params":[],"id":1}`,
 			unmarshalled: &hdfjson.GetConnectionCountCmd{},
 		},
+		{
+			name: "getdeploymentinfo",
+			newCmd: func() (interface{}, error) {
+				return hdfjson.NewCmd("getdeploymentinfo")
+			},
+			staticCmd: func() interface{} {
+				return hdfjson.NewGetDeploymentInfoCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getdeploymentinfo","params":[],"id":1}`,
+			unmarshalled: &hdfjson.GetDeploymentInfoCmd{},
+		},
 		{
 			name: "getdifficulty",
 			newCmd: func() (interface{}, error) {
@@ -932,6 +972,17 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "123",
 			},
 		},
+		{
+			name: "listbanned",
+			newCmd: func() (interface{}, error) {
+				return hdfjson.NewCmd("listbanned")
+			},
+			staticCmd: func() interface{} {
+				return hdfjson.NewListBannedCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"listbanned","params":[],"id":1}`,
+			unmarshalled: &hdfjson.ListBannedCmd{},
+		},
 		{
 			name: "ping",
 			newCmd: func() (interface{}, error) {
@@ -1136,6 +1187,41 @@ func TestChainSvrCmds(t *testing.T) {
 				AllowHighFees: hdfjson.Bool(false),
 			},
 		},
+		{
+			name: "setban",
+			newCmd: func() (interface{}, error) {
+				return hdfjson.NewCmd("setban", "10.0.0.0/8", "add")
+			},
+			staticCmd: func() interface{} {
+				return hdfjson.NewSetBanCmd("10.0.0.0/8", hdfjson.SBAdd,
+					nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setban","params":["10.0.0.0/8","add"],"id":1}`,
+			unmarshalled: &hdfjson.SetBanCmd{
+				Subnet:   "10.0.0.0/8",
+				Command:  hdfjson.SBAdd,
+				BanTime:  hdfjson.Int64(0),
+				Absolute: hdfjson.Bool(false),
+			},
+		},
+		{
+			name: "setban optional",
+			newCmd: func() (interface{}, error) {
+				return hdfjson.NewCmd("setban", "10.1.2.3", "add",
+					1700000000, true)
+			},
+			staticCmd: func() interface{} {
+				return hdfjson.NewSetBanCmd("10.1.2.3", hdfjson.SBAdd,
+					hdfjson.Int64(1700000000), hdfjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setban","params":["10.1.2.3","add",1700000000,true],"id":1}`,
+			unmarshalled: &hdfjson.SetBanCmd{
+				Subnet:   "10.1.2.3",
+				Command:  hdfjson.SBAdd,
+				BanTime:  hdfjson.Int64(1700000000),
+				Absolute: hdfjson.Bool(true),
+			},
+		},
 		{
 			name: "setgenerate",
 			newCmd: func() (interface{}, error) {
@@ -1208,6 +1294,19 @@ func TestChainSvrCmds(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "submitpackage",
+			newCmd: func() (interface{}, error) {
+				return hdfjson.NewCmd("submitpackage", []string{"1122", "3344"})
+			},
+			staticCmd: func() interface{} {
+				return hdfjson.NewSubmitPackageCmd([]string{"1122", "3344"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"submitpackage","params":[["1122","3344"]],"id":1}`,
+			unmarshalled: &hdfjson.SubmitPackageCmd{
+				RawTxs: []string{"1122", "3344"},
+			},
+		},
 		{
 			name: "uptime",
 			newCmd: func() (interface{}, error) {
@@ -133,13 +133,39 @@ type CreateMultiSigResult struct {
 	RedeemScript string `json:"redeemScript"`
 }
 
+// ScriptTraceStep models a single executed opcode of the trace returned by the
+// decodescript command.
+type ScriptTraceStep struct {
+	Script   int      `json:"script"`
+	Index    int      `json:"index"`
+	Opcode   string   `json:"opcode"`
+	Executed bool     `json:"executed"`
+	Stack    []string `json:"stack"`
+	AltStack []string `json:"altstack,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
 // DecodeScriptResult models the data returned from the decodescript command.
+//
+// The Trace and TraceResult fields are only set for a verbosity of 1.
 type DecodeScriptResult struct {
-	Asm       string   `json:"asm"`
-	ReqSigs   int32    `json:"reqSigs,omitempty"`
-	Type      string   `json:"type"`
-	Addresses []string `json:"addresses,omitempty"`
-	P2sh      string   `json:"p2sh,omitempty"`
+	Asm         string            `json:"asm"`
+	ReqSigs     int32             `json:"reqSigs,omitempty"`
+	Type        string            `json:"type"`
+	Addresses   []string          `json:"addresses,omitempty"`
+	P2sh        string            `json:"p2sh,omitempty"`
+	Trace       []ScriptTraceStep `json:"trace,omitempty"`
+	TraceResult string            `json:"traceresult,omitempty"`
+}
+
+// DumpTxOutSetResult models the data returned from the dumptxoutset command.
+type DumpTxOutSetResult struct {
+	CoinsWritten uint64 `json:"coins_written"`
+	BaseHash     string `json:"base_hash"`
+	BaseHeight   int32  `json:"base_height"`
+	Path         string `json:"path"`
+	TxOutSetHash string `json:"txoutset_hash"`
+	NChainTx     uint64 `json:"nchaintx"`
 }
 
 // GetAddedNodeInfoResultAddr models the data of the addresses portion of the
@@ -222,10 +248,51 @@ type GetBlockChainInfoResult struct {
 	Pruned               bool    `json:"pruned"`
 	PruneHeight          int32   `json:"pruneheight,omitempty"`
 	ChainWork            string  `json:"chainwork,omitempty"`
+	BestHeaderHash       string  `json:"bestheaderhash,omitempty"`
+	HeadersChainWork     string  `json:"headerschainwork,omitempty"`
+	BlocksBehind         int32   `json:"blocksbehind"`
 	*SoftForks
 	*UnifiedSoftForks
 }
 
+// Bip9DeploymentStatistics models the signalling statistics over the current
+// confirmation window of a BIP0009 deployment that is being voted on.
+type Bip9DeploymentStatistics struct {
+	Period    uint32 `json:"period"`
+	Threshold uint32 `json:"threshold"`
+	Elapsed   uint32 `json:"elapsed"`
+	Count     uint32 `json:"count"`
+	Possible  bool   `json:"possible"`
+}
+
+// Bip9DeploymentInfo models the BIP0009 specific details of a deployment
+// returned by the getdeploymentinfo command.
+type Bip9DeploymentInfo struct {
+	Bit        uint8                     `json:"bit"`
+	StartTime  int64                     `json:"start_time"`
+	Timeout    int64                     `json:"timeout"`
+	Status     string                    `json:"status"`
+	Since      int32                     `json:"since"`
+	Statistics *Bip9DeploymentStatistics `json:"statistics,omitempty"`
+}
+
+// DeploymentInfo models a single deployment returned by the getdeploymentinfo
+// command.  The height is only set once the deployment is active.
+type DeploymentInfo struct {
+	Type   string              `json:"type"`
+	Active bool                `json:"active"`
+	Height int32               `json:"height,omitempty"`
+	Bip9   *Bip9DeploymentInfo `json:"bip9"`
+}
+
+// GetDeploymentInfoResult models the data returned from the getdeploymentinfo
+// command.
+type GetDeploymentInfoResult struct {
+	Hash        string                     `json:"hash"`
+	Height      int32                      `json:"height"`
+	Deployments map[string]*DeploymentInfo `json:"deployments"`
+}
+
 // GetBlockTemplateResultTx models the transactions field of the
 // getblocktemplate command.
 type GetBlockTemplateResultTx struct {
@@ -285,9 +352,8 @@ type GetBlockTemplateResult struct {
 	RejectReasion string   `json:"reject-reason,omitempty"`
 }
 
-// GetMempoolEntryResult models the data returned from the getmempoolentry's
-// fee field
-
+// MempoolFees models the fees field of the data returned from the
+// getmempoolentry command.  All fees are denominated in the base unit.
 type MempoolFees struct {
 	Base       float64 `json:"base"`
 	Modified   float64 `json:"modified"`
@@ -297,23 +363,29 @@ type MempoolFees struct {
 
 // GetMempoolEntryResult models the data returned from the getmempoolentry
 // command.
+//
+// The Fee, ModifiedFee, DescendantFees and AncestorFees fields are deprecated
+// in favor of the Fees field and are only retained for compatibility with
+// older clients.
 type GetMempoolEntryResult struct {
-	VSize           int32       `json:"vsize"`
-	Size            int32       `json:"size"`
-	Weight          int64       `json:"weight"`
-	Fee             float64     `json:"fee"`
-	ModifiedFee     float64     `json:"modifiedfee"`
-	Time            int64       `json:"time"`
-	Height          int64       `json:"height"`
-	DescendantCount int64       `json:"descendantcount"`
-	DescendantSize  int64       `json:"descendantsize"`
-	DescendantFees  float64     `json:"descendantfees"`
-	AncestorCount   int64       `json:"ancestorcount"`
-	AncestorSize    int64       `json:"ancestorsize"`
-	AncestorFees    float64     `json:"ancestorfees"`
-	WTxId           string      `json:"wtxid"`
-	Fees            MempoolFees `json:"fees"`
-	Depends         []string    `json:"depends"`
+	VSize             int32       `json:"vsize"`
+	Size              int32       `json:"size"`
+	Weight            int64       `json:"weight"`
+	Fee               float64     `json:"fee"`
+	ModifiedFee       float64     `json:"modifiedfee"`
+	Time              int64       `json:"time"`
+	Height            int64       `json:"height"`
+	DescendantCount   int64       `json:"descendantcount"`
+	DescendantSize    int64       `json:"descendantsize"`
+	DescendantFees    float64     `json:"descendantfees"`
+	AncestorCount     int64       `json:"ancestorcount"`
+	AncestorSize      int64       `json:"ancestorsize"`
+	AncestorFees      float64     `json:"ancestorfees"`
+	WTxId             string      `json:"wtxid"`
+	Fees              MempoolFees `json:"fees"`
+	Depends           []string    `json:"depends"`
+	BIP125Replaceable bool        `json:"bip125-replaceable"`
+	Unbroadcast       bool        `json:"unbroadcast"`
 }
 
 // GetMempoolInfoResult models the data returned from the getmempoolinfo
@@ -360,27 +432,33 @@ type GetNetworkInfoResult struct {
 
 // GetPeerInfoResult models the data returned from the getpeerinfo command.
 type GetPeerInfoResult struct {
-	ID             int32   `json:"id"`
-	Addr           string  `json:"addr"`
-	AddrLocal      string  `json:"addrlocal,omitempty"`
-	Services       string  `json:"services"`
-	RelayTxes      bool    `json:"relaytxes"`
-	LastSend       int64   `json:"lastsend"`
-	LastRecv       int64   `json:"lastrecv"`
-	BytesSent      uint64  `json:"bytessent"`
-	BytesRecv      uint64  `json:"bytesrecv"`
-	ConnTime       int64   `json:"conntime"`
-	TimeOffset     int64   `json:"timeoffset"`
-	PingTime       float64 `json:"pingtime"`
-	PingWait       float64 `json:"pingwait,omitempty"`
-	Version        uint32  `json:"version"`
-	SubVer         string  `json:"subver"`
-	Inbound        bool    `json:"inbound"`
-	StartingHeight int32   `json:"startingheight"`
-	CurrentHeight  int32   `json:"currentheight,omitempty"`
-	BanScore       int32   `json:"banscore"`
-	FeeFilter      int64   `json:"feefilter"`
-	SyncNode       bool    `json:"syncnode"`
+	ID              int32             `json:"id"`
+	Addr            string            `json:"addr"`
+	AddrLocal       string            `json:"addrlocal,omitempty"`
+	Services        string            `json:"services"`
+	RelayTxes       bool              `json:"relaytxes"`
+	LastSend        int64             `json:"lastsend"`
+	LastRecv        int64             `json:"lastrecv"`
+	BytesSent       uint64            `json:"bytessent"`
+	BytesRecv       uint64            `json:"bytesrecv"`
+	ConnTime        int64             `json:"conntime"`
+	TimeOffset      int64             `json:"timeoffset"`
+	PingTime        float64           `json:"pingtime"`
+	PingWait        float64           `json:"pingwait,omitempty"`
+	MinPing         float64           `json:"minping,omitempty"`
+	PingP90         float64           `json:"pingp90,omitempty"`
+	Version         uint32            `json:"version"`
+	SubVer          string            `json:"subver"`
+	Inbound         bool              `json:"inbound"`
+	StartingHeight  int32             `json:"startingheight"`
+	CurrentHeight   int32             `json:"currentheight,omitempty"`
+	BanScore        int32             `json:"banscore"`
+	FeeFilter       int64             `json:"feefilter"`
+	SyncNode        bool              `json:"syncnode"`
+	Bip152HBTo      bool              `json:"bip152_hb_to"`
+	Bip152HBFrom    bool              `json:"bip152_hb_from"`
+	BytesSentPerMsg map[string]uint64 `json:"bytessent_per_msg"`
+	BytesRecvPerMsg map[string]uint64 `json:"bytesrecv_per_msg"`
 }
 
 // GetRawMempoolVerboseResult models the data returned from the getrawmempool
@@ -417,11 +495,39 @@ type GetTxOutResult struct {
 	Coinbase      bool               `json:"coinbase"`
 }
 
+// NetTargetResult models the progress towards an upload or download target
+// returned as part of the getnettotals command.  ServeHistoricalBlocks is only
+// set for the upload target.
+type NetTargetResult struct {
+	TimeFrame             int64  `json:"timeframe"`
+	Target                uint64 `json:"target"`
+	TargetReached         bool   `json:"target_reached"`
+	ServeHistoricalBlocks *bool  `json:"serve_historical_blocks,omitempty"`
+	BytesLeftInCycle      uint64 `json:"bytes_left_in_cycle"`
+	TimeLeftInCycle       int64  `json:"time_left_in_cycle"`
+}
+
+// RateLimitResult models the throttling performed by an upload or download rate
+// limit returned as part of the getnettotals command.
+type RateLimitResult struct {
+	Rate           int64   `json:"rate"`
+	ThrottledBytes uint64  `json:"throttled_bytes"`
+	ThrottledTime  float64 `json:"throttled_time"`
+}
+
 // GetNetTotalsResult models the data returned from the getnettotals command.
 type GetNetTotalsResult struct {
-	TotalBytesRecv uint64 `json:"totalbytesrecv"`
-	TotalBytesSent uint64 `json:"totalbytessent"`
-	TimeMillis     int64  `json:"timemillis"`
+	TotalBytesRecv    uint64            `json:"totalbytesrecv"`
+	TotalBytesSent    uint64            `json:"totalbytessent"`
+	TimeMillis        int64             `json:"timemillis"`
+	UploadTarget      NetTargetResult   `json:"uploadtarget"`
+	DownloadTarget    NetTargetResult   `json:"downloadtarget"`
+	BytesSentPerMsg   map[string]uint64 `json:"bytessent_per_msg"`
+	BytesRecvPerMsg   map[string]uint64 `json:"bytesrecv_per_msg"`
+	SendRate          float64           `json:"sendrate"`
+	RecvRate          float64           `json:"recvrate"`
+	UploadRateLimit   RateLimitResult   `json:"uploadratelimit"`
+	DownloadRateLimit RateLimitResult   `json:"downloadratelimit"`
 }
 
 // ScriptSig models a signature script.  It is defined separately since it only
@@ -623,6 +729,16 @@ type InfoChainResult struct {
 	Errors          string  `json:"errors"`
 }
 
+// ListBannedResult models the data of a ban returned from the listbanned
+// command.  All times are Unix times and all durations are in seconds.
+type ListBannedResult struct {
+	Address       string `json:"address"`
+	BanCreated    int64  `json:"ban_created"`
+	BannedUntil   int64  `json:"banned_until"`
+	BanDuration   int64  `json:"ban_duration"`
+	TimeRemaining int64  `json:"time_remaining"`
+}
+
 // TxRawResult models the data from the getrawtransaction command.
 type TxRawResult struct {
 	Hex           string `json:"hex"`
@@ -684,6 +800,23 @@ type EstimateSmartFeeResult struct {
 	Blocks  int64    `json:"blocks"`
 }
 
+// SubmitPackageTxResult models a transaction of the package that is included
+// in the submitpackage command result.  The fee is only set for the
+// transactions which were accepted by the command as opposed to already being
+// in the mempool.
+type SubmitPackageTxResult struct {
+	TxID  string   `json:"txid"`
+	WTxID string   `json:"wtxid"`
+	VSize int64    `json:"vsize"`
+	Fee   *float64 `json:"fee,omitempty"`
+}
+
+// SubmitPackageResult models the data returned by the chain server
+// submitpackage command.
+type SubmitPackageResult struct {
+	Transactions []SubmitPackageTxResult `json:"transactions"`
+}
+
 var _ json.Unmarshaler = &FundRawTransactionResult{}
 
 type rawFundRawTransactionResult struct {
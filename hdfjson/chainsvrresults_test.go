@@ -68,6 +68,90 @@ func TestChainSvrCustomResults(t *testing.T) {
 			},
 			expected: `{"txid":"123","vout":1,"scriptSig":{"asm":"0","hex":"00"},"prevOut":{"addresses":["addr1"],"value":0},"sequence":4294967295}`,
 		},
+		{
+			name: "getmempoolentry result with fees object",
+			result: &hdfjson.GetMempoolEntryResult{
+				VSize:           141,
+				Size:            141,
+				Weight:          564,
+				Fee:             0.0001,
+				ModifiedFee:     0.0001,
+				Time:            12345678,
+				Height:          100,
+				DescendantCount: 1,
+				DescendantSize:  141,
+				DescendantFees:  0.0001,
+				AncestorCount:   1,
+				AncestorSize:    141,
+				AncestorFees:    0.0001,
+				WTxId:           "123",
+				Fees: hdfjson.MempoolFees{
+					Base:       0.0001,
+					Modified:   0.0001,
+					Ancestor:   0.0001,
+					Descendant: 0.0001,
+				},
+				Depends:           []string{},
+				BIP125Replaceable: true,
+				Unbroadcast:       false,
+			},
+			expected: `{"vsize":141,"size":141,"weight":564,"fee":0.0001,"modifiedfee":0.0001,"time":12345678,"height":100,"descendantcount":1,"descendantsize":141,"descendantfees":0.0001,"ancestorcount":1,"ancestorsize":141,"ancestorfees":0.0001,"wtxid":"123","fees":{"base":0.0001,"modified":0.0001,"ancestor":0.0001,"descendant":0.0001},"depends":[],"bip125-replaceable":true,"unbroadcast":false}`,
+		},
+		{
+			name: "getdeploymentinfo",
+			result: &hdfjson.GetDeploymentInfoResult{
+				Hash:   "123",
+				Height: 100,
+				Deployments: map[string]*hdfjson.DeploymentInfo{
+					"csv": {
+						Type:   "bip9",
+						Active: true,
+						Height: 50,
+						Bip9: &hdfjson.Bip9DeploymentInfo{
+							Bit:       0,
+							StartTime: 1462060800,
+							Timeout:   1493596800,
+							Status:    "active",
+							Since:     50,
+						},
+					},
+					"segwit": {
+						Type: "bip9",
+						Bip9: &hdfjson.Bip9DeploymentInfo{
+							Bit:       1,
+							StartTime: 1479168000,
+							Timeout:   1510704000,
+							Status:    "started",
+							Since:     90,
+							Statistics: &hdfjson.Bip9DeploymentStatistics{
+								Period:    10,
+								Threshold: 8,
+								Elapsed:   1,
+								Count:     1,
+								Possible:  true,
+							},
+						},
+					},
+				},
+			},
+			expected: `{"hash":"123","height":100,"deployments":{"csv":{"type":"bip9","active":true,"height":50,"bip9":{"bit":0,"start_time":1462060800,"timeout":1493596800,"status":"active","since":50}},"segwit":{"type":"bip9","active":false,"bip9":{"bit":1,"start_time":1479168000,"timeout":1510704000,"status":"started","since":90,"statistics":{"period":10,"threshold":8,"elapsed":1,"count":1,"possible":true}}}}}`,
+		},
+		{
+			name: "submitpackage",
+			result: &hdfjson.SubmitPackageResult{
+				Transactions: []hdfjson.SubmitPackageTxResult{{
+					TxID:  "123",
+					WTxID: "123",
+					VSize: 141,
+				}, {
+					TxID:  "456",
+					WTxID: "789",
+					VSize: 153,
+					Fee:   hdfjson.Float64(0.0001),
+				}},
+			},
+			expected: `{"transactions":[{"txid":"123","wtxid":"123","vsize":141},{"txid":"456","wtxid":"789","vsize":153,"fee":0.0001}]}`,
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -24,12 +24,25 @@ func NewAuthenticateCmd(username, passphrase string) *AuthenticateCmd {
 }
 
 // NotifyBlocksCmd defines the notifyblocks JSON-RPC command.
-type NotifyBlocksCmd struct{}
+//
+// Providing a ResumeToken opts the client into sequenced block and
+// transaction notifications.  An empty token only enables the sequence
+// numbers, while a non-empty token is the sequence of the last block
+// notification the client processed, in which case any block notifications
+// the client missed since are replayed before new ones are delivered.
+type NotifyBlocksCmd struct {
+	ResumeToken *string
+}
 
 // NewNotifyBlocksCmd returns a new instance which can be used to issue a
 // notifyblocks JSON-RPC command.
-func NewNotifyBlocksCmd() *NotifyBlocksCmd {
-	return &NotifyBlocksCmd{}
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewNotifyBlocksCmd(resumeToken *string) *NotifyBlocksCmd {
+	return &NotifyBlocksCmd{
+		ResumeToken: resumeToken,
+	}
 }
 
 // StopNotifyBlocksCmd defines the stopnotifyblocks JSON-RPC command.
@@ -105,24 +118,36 @@ type OutPoint struct {
 // LoadTxFilterCmd defines the loadtxfilter request parameters to load or
 // reload a transaction filter.
 //
+// The optional ResumeToken has the same semantics as for NotifyBlocksCmd,
+// except that only the filteredblockconnected and filteredblockdisconnected
+// notifications the client missed are replayed, matched against the loaded
+// filter.
+//
 // NOTE: This is a hdfd extension ported from github.com/decred/dcrd/dcrjson
 // and requires a websocket connection.
 type LoadTxFilterCmd struct {
-	Reload    bool
-	Addresses []string
-	OutPoints []OutPoint
+	Reload      bool
+	Addresses   []string
+	OutPoints   []OutPoint
+	ResumeToken *string
 }
 
 // NewLoadTxFilterCmd returns a new instance which can be used to issue a
 // loadtxfilter JSON-RPC command.
 //
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+//
 // NOTE: This is a hdfd extension ported from github.com/decred/dcrd/dcrjson
 // and requires a websocket connection.
-func NewLoadTxFilterCmd(reload bool, addresses []string, outPoints []OutPoint) *LoadTxFilterCmd {
+func NewLoadTxFilterCmd(reload bool, addresses []string, outPoints []OutPoint,
+	resumeToken *string) *LoadTxFilterCmd {
+
 	return &LoadTxFilterCmd{
-		Reload:    reload,
-		Addresses: addresses,
-		OutPoints: outPoints,
+		Reload:      reload,
+		Addresses:   addresses,
+		OutPoints:   outPoints,
+		ResumeToken: resumeToken,
 	}
 }
 
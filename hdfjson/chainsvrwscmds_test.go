@@ -47,11 +47,24 @@ func TestChainSvrWsCmds(t *testing.T) {
 				return hdfjson.NewCmd("notifyblocks")
 			},
 			staticCmd: func() interface{} {
-				return hdfjson.NewNotifyBlocksCmd()
+				return hdfjson.NewNotifyBlocksCmd(nil)
 			},
 			marshalled:   `{"jsonrpc":"1.0","method":"notifyblocks","params":[],"id":1}`,
 			unmarshalled: &hdfjson.NotifyBlocksCmd{},
 		},
+		{
+			name: "notifyblocks resume",
+			newCmd: func() (interface{}, error) {
+				return hdfjson.NewCmd("notifyblocks", "1234")
+			},
+			staticCmd: func() interface{} {
+				return hdfjson.NewNotifyBlocksCmd(hdfjson.String("1234"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"notifyblocks","params":["1234"],"id":1}`,
+			unmarshalled: &hdfjson.NotifyBlocksCmd{
+				ResumeToken: hdfjson.String("1234"),
+			},
+		},
 		{
 			name: "stopnotifyblocks",
 			newCmd: func() (interface{}, error) {
@@ -204,7 +217,7 @@ func TestChainSvrWsCmds(t *testing.T) {
 					Hash:  "0000000000000000000000000000000000000000000000000000000000000123",
 					Index: 0,
 				}}
-				return hdfjson.NewLoadTxFilterCmd(false, addrs, ops)
+				return hdfjson.NewLoadTxFilterCmd(false, addrs, ops, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"loadtxfilter","params":[false,["1Address"],[{"hash":"0000000000000000000000000000000000000000000000000000000000000123","index":0}]],"id":1}`,
 			unmarshalled: &hdfjson.LoadTxFilterCmd{
@@ -213,6 +226,25 @@ func TestChainSvrWsCmds(t *testing.T) {
 				OutPoints: []hdfjson.OutPoint{{Hash: "0000000000000000000000000000000000000000000000000000000000000123", Index: 0}},
 			},
 		},
+		{
+			name: "loadtxfilter resume",
+			newCmd: func() (interface{}, error) {
+				return hdfjson.NewCmd("loadtxfilter", true, `["1Address"]`, `[]`, "1234")
+			},
+			staticCmd: func() interface{} {
+				addrs := []string{"1Address"}
+				ops := []hdfjson.OutPoint{}
+				return hdfjson.NewLoadTxFilterCmd(true, addrs, ops,
+					hdfjson.String("1234"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"loadtxfilter","params":[true,["1Address"],[],"1234"],"id":1}`,
+			unmarshalled: &hdfjson.LoadTxFilterCmd{
+				Reload:      true,
+				Addresses:   []string{"1Address"},
+				OutPoints:   []hdfjson.OutPoint{},
+				ResumeToken: hdfjson.String("1234"),
+			},
+		},
 		{
 			name: "rescanblocks",
 			newCmd: func() (interface{}, error) {
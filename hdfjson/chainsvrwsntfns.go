@@ -75,15 +75,21 @@ const (
 	// from the chain server that inform a client that a transaction that
 	// matches the loaded filter was accepted by the mempool.
 	RelevantTxAcceptedNtfnMethod = "relevanttxaccepted"
+
+	// TxReplacedNtfnMethod is the method used for notifications from the
+	// chain server that a transaction has been evicted from the mempool
+	// because it was replaced through the Replace-By-Fee (RBF) policy.
+	TxReplacedNtfnMethod = "txreplaced"
 )
 
 // BlockConnectedNtfn defines the blockconnected JSON-RPC notification.
 //
 // Deprecated: Use FilteredBlockConnectedNtfn instead.
 type BlockConnectedNtfn struct {
-	Hash   string
-	Height int32
-	Time   int64
+	Hash     string
+	Height   int32
+	Time     int64
+	Sequence *uint64
 }
 
 // NewBlockConnectedNtfn returns a new instance which can be used to issue a
@@ -102,9 +108,10 @@ func NewBlockConnectedNtfn(hash string, height int32, time int64) *BlockConnecte
 //
 // Deprecated: Use FilteredBlockDisconnectedNtfn instead.
 type BlockDisconnectedNtfn struct {
-	Hash   string
-	Height int32
-	Time   int64
+	Hash     string
+	Height   int32
+	Time     int64
+	Sequence *uint64
 }
 
 // NewBlockDisconnectedNtfn returns a new instance which can be used to issue a
@@ -121,10 +128,18 @@ func NewBlockDisconnectedNtfn(hash string, height int32, time int64) *BlockDisco
 
 // FilteredBlockConnectedNtfn defines the filteredblockconnected JSON-RPC
 // notification.
+//
+// The optional Sequence is the position of the notification in the stream of
+// block notifications and is only set for clients that requested sequenced
+// notifications by providing a resume token to notifyblocks or loadtxfilter.
+// The block notification sequence increases by exactly one for every
+// connected and disconnected block, so a client may detect missed
+// notifications by checking for gaps.
 type FilteredBlockConnectedNtfn struct {
 	Height        int32
 	Header        string
 	SubscribedTxs []string
+	Sequence      *uint64
 }
 
 // NewFilteredBlockConnectedNtfn returns a new instance which can be used to
@@ -140,8 +155,9 @@ func NewFilteredBlockConnectedNtfn(height int32, header string, subscribedTxs []
 // FilteredBlockDisconnectedNtfn defines the filteredblockdisconnected JSON-RPC
 // notification.
 type FilteredBlockDisconnectedNtfn struct {
-	Height int32
-	Header string
+	Height   int32
+	Header   string
+	Sequence *uint64
 }
 
 // NewFilteredBlockDisconnectedNtfn returns a new instance which can be used to
@@ -246,9 +262,14 @@ func NewRescanProgressNtfn(hash string, height int32, time int64) *RescanProgres
 }
 
 // TxAcceptedNtfn defines the txaccepted JSON-RPC notification.
+//
+// The optional Sequence is the position of the notification in the stream of
+// transactions newly accepted to the mempool and, like the block notification
+// sequence, is only set for clients that requested sequenced notifications.
 type TxAcceptedNtfn struct {
-	TxID   string
-	Amount float64
+	TxID     string
+	Amount   float64
+	Sequence *uint64
 }
 
 // NewTxAcceptedNtfn returns a new instance which can be used to issue a
@@ -262,7 +283,8 @@ func NewTxAcceptedNtfn(txHash string, amount float64) *TxAcceptedNtfn {
 
 // TxAcceptedVerboseNtfn defines the txacceptedverbose JSON-RPC notification.
 type TxAcceptedVerboseNtfn struct {
-	RawTx TxRawResult
+	RawTx    TxRawResult
+	Sequence *uint64
 }
 
 // NewTxAcceptedVerboseNtfn returns a new instance which can be used to issue a
@@ -285,6 +307,21 @@ func NewRelevantTxAcceptedNtfn(txHex string) *RelevantTxAcceptedNtfn {
 	return &RelevantTxAcceptedNtfn{Transaction: txHex}
 }
 
+// TxReplacedNtfn defines the txreplaced JSON-RPC notification.
+type TxReplacedNtfn struct {
+	ReplacedTxID    string
+	ReplacementTxID string
+}
+
+// NewTxReplacedNtfn returns a new instance which can be used to issue a
+// txreplaced JSON-RPC notification.
+func NewTxReplacedNtfn(replacedTxID, replacementTxID string) *TxReplacedNtfn {
+	return &TxReplacedNtfn{
+		ReplacedTxID:    replacedTxID,
+		ReplacementTxID: replacementTxID,
+	}
+}
+
 func init() {
 	// The commands in this file are only usable by websockets and are
 	// notifications.
@@ -301,4 +338,5 @@ func init() {
 	MustRegisterCmd(TxAcceptedNtfnMethod, (*TxAcceptedNtfn)(nil), flags)
 	MustRegisterCmd(TxAcceptedVerboseNtfnMethod, (*TxAcceptedVerboseNtfn)(nil), flags)
 	MustRegisterCmd(RelevantTxAcceptedNtfnMethod, (*RelevantTxAcceptedNtfn)(nil), flags)
+	MustRegisterCmd(TxReplacedNtfnMethod, (*TxReplacedNtfn)(nil), flags)
 }
@@ -44,6 +44,24 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				Time:   123456789,
 			},
 		},
+		{
+			name: "blockconnected sequenced",
+			newNtfn: func() (interface{}, error) {
+				return hdfjson.NewCmd("blockconnected", "123", 100000, 123456789, 42)
+			},
+			staticNtfn: func() interface{} {
+				ntfn := hdfjson.NewBlockConnectedNtfn("123", 100000, 123456789)
+				ntfn.Sequence = hdfjson.Uint64(42)
+				return ntfn
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"blockconnected","params":["123",100000,123456789,42],"id":null}`,
+			unmarshalled: &hdfjson.BlockConnectedNtfn{
+				Hash:     "123",
+				Height:   100000,
+				Time:     123456789,
+				Sequence: hdfjson.Uint64(42),
+			},
+		},
 		{
 			name: "blockdisconnected",
 			newNtfn: func() (interface{}, error) {
@@ -74,6 +92,24 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				SubscribedTxs: []string{"tx0", "tx1"},
 			},
 		},
+		{
+			name: "filteredblockconnected sequenced",
+			newNtfn: func() (interface{}, error) {
+				return hdfjson.NewCmd("filteredblockconnected", 100000, "header", []string{"tx0"}, 42)
+			},
+			staticNtfn: func() interface{} {
+				ntfn := hdfjson.NewFilteredBlockConnectedNtfn(100000, "header", []string{"tx0"})
+				ntfn.Sequence = hdfjson.Uint64(42)
+				return ntfn
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"filteredblockconnected","params":[100000,"header",["tx0"],42],"id":null}`,
+			unmarshalled: &hdfjson.FilteredBlockConnectedNtfn{
+				Height:        100000,
+				Header:        "header",
+				SubscribedTxs: []string{"tx0"},
+				Sequence:      hdfjson.Uint64(42),
+			},
+		},
 		{
 			name: "filteredblockdisconnected",
 			newNtfn: func() (interface{}, error) {
@@ -182,6 +218,23 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				Amount: 1.5,
 			},
 		},
+		{
+			name: "txaccepted sequenced",
+			newNtfn: func() (interface{}, error) {
+				return hdfjson.NewCmd("txaccepted", "123", 1.5, 7)
+			},
+			staticNtfn: func() interface{} {
+				ntfn := hdfjson.NewTxAcceptedNtfn("123", 1.5)
+				ntfn.Sequence = hdfjson.Uint64(7)
+				return ntfn
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"txaccepted","params":["123",1.5,7],"id":null}`,
+			unmarshalled: &hdfjson.TxAcceptedNtfn{
+				TxID:     "123",
+				Amount:   1.5,
+				Sequence: hdfjson.Uint64(7),
+			},
+		},
 		{
 			name: "txacceptedverbose",
 			newNtfn: func() (interface{}, error) {
@@ -225,6 +278,20 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				Transaction: "001122",
 			},
 		},
+		{
+			name: "txreplaced",
+			newNtfn: func() (interface{}, error) {
+				return hdfjson.NewCmd("txreplaced", "123", "456")
+			},
+			staticNtfn: func() interface{} {
+				return hdfjson.NewTxReplacedNtfn("123", "456")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"txreplaced","params":["123","456"],"id":null}`,
+			unmarshalled: &hdfjson.TxReplacedNtfn{
+				ReplacedTxID:    "123",
+				ReplacementTxID: "456",
+			},
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
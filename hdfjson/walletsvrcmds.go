@@ -407,6 +407,7 @@ type ListSinceBlockCmd struct {
 	BlockHash           *string
 	TargetConfirmations *int  `jsonrpcdefault:"1"`
 	IncludeWatchOnly    *bool `jsonrpcdefault:"false"`
+	IncludeRemoved      *bool `jsonrpcdefault:"true"`
 }
 
 // NewListSinceBlockCmd returns a new instance which can be used to issue a
@@ -414,11 +415,12 @@ type ListSinceBlockCmd struct {
 //
 // The parameters which are pointers indicate they are optional.  Passing nil
 // for optional parameters will use the default value.
-func NewListSinceBlockCmd(blockHash *string, targetConfirms *int, includeWatchOnly *bool) *ListSinceBlockCmd {
+func NewListSinceBlockCmd(blockHash *string, targetConfirms *int, includeWatchOnly, includeRemoved *bool) *ListSinceBlockCmd {
 	return &ListSinceBlockCmd{
 		BlockHash:           blockHash,
 		TargetConfirmations: targetConfirms,
 		IncludeWatchOnly:    includeWatchOnly,
+		IncludeRemoved:      includeRemoved,
 	}
 }
 
@@ -653,13 +653,14 @@ func TestWalletSvrCmds(t *testing.T) {
 				return hdfjson.NewCmd("listsinceblock")
 			},
 			staticCmd: func() interface{} {
-				return hdfjson.NewListSinceBlockCmd(nil, nil, nil)
+				return hdfjson.NewListSinceBlockCmd(nil, nil, nil, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"listsinceblock","params":[],"id":1}`,
 			unmarshalled: &hdfjson.ListSinceBlockCmd{
 				BlockHash:           nil,
 				TargetConfirmations: hdfjson.Int(1),
 				IncludeWatchOnly:    hdfjson.Bool(false),
+				IncludeRemoved:      hdfjson.Bool(true),
 			},
 		},
 		{
@@ -668,13 +669,14 @@ func TestWalletSvrCmds(t *testing.T) {
 				return hdfjson.NewCmd("listsinceblock", "123")
 			},
 			staticCmd: func() interface{} {
-				return hdfjson.NewListSinceBlockCmd(hdfjson.String("123"), nil, nil)
+				return hdfjson.NewListSinceBlockCmd(hdfjson.String("123"), nil, nil, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"listsinceblock","params":["123"],"id":1}`,
 			unmarshalled: &hdfjson.ListSinceBlockCmd{
 				BlockHash:           hdfjson.String("123"),
 				TargetConfirmations: hdfjson.Int(1),
 				IncludeWatchOnly:    hdfjson.Bool(false),
+				IncludeRemoved:      hdfjson.Bool(true),
 			},
 		},
 		{
@@ -683,13 +685,14 @@ func TestWalletSvrCmds(t *testing.T) {
 				return hdfjson.NewCmd("listsinceblock", "123", 6)
 			},
 			staticCmd: func() interface{} {
-				return hdfjson.NewListSinceBlockCmd(hdfjson.String("123"), hdfjson.Int(6), nil)
+				return hdfjson.NewListSinceBlockCmd(hdfjson.String("123"), hdfjson.Int(6), nil, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"listsinceblock","params":["123",6],"id":1}`,
 			unmarshalled: &hdfjson.ListSinceBlockCmd{
 				BlockHash:           hdfjson.String("123"),
 				TargetConfirmations: hdfjson.Int(6),
 				IncludeWatchOnly:    hdfjson.Bool(false),
+				IncludeRemoved:      hdfjson.Bool(true),
 			},
 		},
 		{
@@ -698,13 +701,30 @@ func TestWalletSvrCmds(t *testing.T) {
 				return hdfjson.NewCmd("listsinceblock", "123", 6, true)
 			},
 			staticCmd: func() interface{} {
-				return hdfjson.NewListSinceBlockCmd(hdfjson.String("123"), hdfjson.Int(6), hdfjson.Bool(true))
+				return hdfjson.NewListSinceBlockCmd(hdfjson.String("123"), hdfjson.Int(6), hdfjson.Bool(true), nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"listsinceblock","params":["123",6,true],"id":1}`,
 			unmarshalled: &hdfjson.ListSinceBlockCmd{
 				BlockHash:           hdfjson.String("123"),
 				TargetConfirmations: hdfjson.Int(6),
 				IncludeWatchOnly:    hdfjson.Bool(true),
+				IncludeRemoved:      hdfjson.Bool(true),
+			},
+		},
+		{
+			name: "listsinceblock optional4",
+			newCmd: func() (interface{}, error) {
+				return hdfjson.NewCmd("listsinceblock", "123", 6, true, false)
+			},
+			staticCmd: func() interface{} {
+				return hdfjson.NewListSinceBlockCmd(hdfjson.String("123"), hdfjson.Int(6), hdfjson.Bool(true), hdfjson.Bool(false))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"listsinceblock","params":["123",6,true,false],"id":1}`,
+			unmarshalled: &hdfjson.ListSinceBlockCmd{
+				BlockHash:           hdfjson.String("123"),
+				TargetConfirmations: hdfjson.Int(6),
+				IncludeWatchOnly:    hdfjson.Bool(true),
+				IncludeRemoved:      hdfjson.Bool(false),
 			},
 		},
 		{
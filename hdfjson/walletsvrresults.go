@@ -101,8 +101,15 @@ type ListReceivedByAddressResult struct {
 }
 
 // ListSinceBlockResult models the data from the listsinceblock command.
+//
+// The removed transactions are those of blocks which were disconnected from
+// the main chain since the requested block, and are only set when the
+// include_removed parameter of the command is true.  The last block is the hash
+// of the block the target confirmations were reached at, which is to be passed
+// to the next invocation of the command to continue where this one ended.
 type ListSinceBlockResult struct {
 	Transactions []ListTransactionsResult `json:"transactions"`
+	Removed      []ListTransactionsResult `json:"removed,omitempty"`
 	LastBlock    string                   `json:"lastblock"`
 }
 
@@ -0,0 +1,89 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package hdfjson_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/ifishnet/hdfd/hdfjson"
+)
+
+// TestListSinceBlockResult ensures the listsinceblock result only includes
+// the removed transactions when there are any and round trips through JSON.
+func TestListSinceBlockResult(t *testing.T) {
+	t.Parallel()
+
+	tx := hdfjson.ListTransactionsResult{
+		Account:         "",
+		Address:         "1Address",
+		Amount:          0.5,
+		Category:        "receive",
+		Confirmations:   1,
+		Time:            12345,
+		TimeReceived:    12345,
+		TxID:            "123",
+		WalletConflicts: []string{},
+	}
+	txJSON := `{"abandoned":false,"account":"","address":"1Address",` +
+		`"amount":0.5,"category":"receive","confirmations":1,` +
+		`"time":12345,"timereceived":12345,"trusted":false,` +
+		`"txid":"123","vout":0,"walletconflicts":[]}`
+
+	tests := []struct {
+		name     string
+		result   *hdfjson.ListSinceBlockResult
+		expected string
+	}{
+		{
+			name: "without removed transactions",
+			result: &hdfjson.ListSinceBlockResult{
+				Transactions: []hdfjson.ListTransactionsResult{tx},
+				LastBlock:    "456",
+			},
+			expected: `{"transactions":[` + txJSON + `],` +
+				`"lastblock":"456"}`,
+		},
+		{
+			name: "with removed transactions",
+			result: &hdfjson.ListSinceBlockResult{
+				Transactions: []hdfjson.ListTransactionsResult{},
+				Removed:      []hdfjson.ListTransactionsResult{tx},
+				LastBlock:    "456",
+			},
+			expected: `{"transactions":[],"removed":[` + txJSON +
+				`],"lastblock":"456"}`,
+		},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		marshalled, err := json.Marshal(test.result)
+		if err != nil {
+			t.Errorf("Test #%d (%s) unexpected error: %v", i,
+				test.name, err)
+			continue
+		}
+		if string(marshalled) != test.expected {
+			t.Errorf("Test #%d (%s) unexpected marshalled data - "+
+				"got %s, want %s", i, test.name, marshalled,
+				test.expected)
+			continue
+		}
+
+		var result hdfjson.ListSinceBlockResult
+		if err := json.Unmarshal(marshalled, &result); err != nil {
+			t.Errorf("Test #%d (%s) unexpected error: %v", i,
+				test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(&result, test.result) {
+			t.Errorf("Test #%d (%s) unexpected unmarshalled result "+
+				"- got %v, want %v", i, test.name, result,
+				test.result)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpctest
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/ifishnet/hdfd/txscript"
+	"github.com/ifishnet/hdfd/wire"
+	"github.com/ifishnet/hdfutil"
+)
+
+const (
+	// scenarioFundValue is the value of each of the outputs created to
+	// fund the transactions of a fee scenario.
+	scenarioFundValue = hdfutil.Amount(10000000)
+
+	// scenarioPaymentValue is the value each transaction of a fee scenario
+	// pays back to the wallet of the harness.  The rest of the funding
+	// output, minus the fee, is returned as change.
+	scenarioPaymentValue = hdfutil.Amount(1000000)
+
+	// maxFundingOutputs is the maximum number of outputs created by a
+	// single transaction funding a fee scenario.
+	maxFundingOutputs = 500
+
+	// fundingFeeRate is the fee rate, in satoshis per byte, paid by the
+	// transactions funding a fee scenario.
+	fundingFeeRate = 10
+
+	// walletSyncTimeout is the maximum amount of time to wait for the
+	// wallet of a harness to sync to a newly generated block.
+	walletSyncTimeout = time.Second * 30
+)
+
+// FeeRateDistribution returns a random fee rate, in satoshis per byte, for a
+// transaction of a fee scenario using the passed source of randomness.
+type FeeRateDistribution func(r *rand.Rand) hdfutil.Amount
+
+// UniformFeeRates returns a fee rate distribution which chooses fee rates, in
+// satoshis per byte, uniformly between min and max, inclusive.
+func UniformFeeRates(min, max hdfutil.Amount) FeeRateDistribution {
+	return func(r *rand.Rand) hdfutil.Amount {
+		return min + hdfutil.Amount(r.Int63n(int64(max-min)+1))
+	}
+}
+
+// FeeRateBucket is a fee rate, in satoshis per byte, together with the
+// relative frequency at which it is chosen by a weighted fee rate
+// distribution.
+type FeeRateBucket struct {
+	FeeRate hdfutil.Amount
+	Weight  int
+}
+
+// WeightedFeeRates returns a fee rate distribution which chooses the fee rates
+// of the passed buckets with a probability proportional to their weights.  This
+// allows modeling realistic mempool load, such as many transactions paying the
+// minimum fee rate and a few paying a premium for quick confirmation.
+func WeightedFeeRates(buckets []FeeRateBucket) FeeRateDistribution {
+	var totalWeight int
+	for _, bucket := range buckets {
+		totalWeight += bucket.Weight
+	}
+
+	return func(r *rand.Rand) hdfutil.Amount {
+		target := r.Intn(totalWeight)
+		for _, bucket := range buckets {
+			target -= bucket.Weight
+			if target < 0 {
+				return bucket.FeeRate
+			}
+		}
+
+		// Not reachable with positive weights.
+		return buckets[len(buckets)-1].FeeRate
+	}
+}
+
+// ScenarioTx is a transaction submitted to the mempool while running a fee
+// scenario along with the details needed to derive the expected results of
+// fee estimation.
+type ScenarioTx struct {
+	// Tx is the submitted transaction.
+	Tx *hdfutil.Tx
+
+	// FeeRate is the fee rate, in satoshis per byte, the transaction was
+	// created with.
+	FeeRate hdfutil.Amount
+
+	// SubmitHeight is the height of the best chain when the transaction
+	// was submitted.
+	SubmitHeight int32
+
+	// ConfirmHeight is the height of the block which confirmed the
+	// transaction.  It is zero when the transaction is unconfirmed.
+	ConfirmHeight int32
+}
+
+// ConfirmationPattern returns which of the passed pending transactions of a
+// fee scenario are included in its next block.  The passed block number
+// starts at zero for the first block of the scenario.
+type ConfirmationPattern func(blockNum int, pending []*ScenarioTx) []*ScenarioTx
+
+// ConfirmHighestFeeRates returns a confirmation pattern which includes at most
+// the passed number of pending transactions with the highest fee rates in each
+// block, like a miner would when blocks are full.
+func ConfirmHighestFeeRates(maxTxns int) ConfirmationPattern {
+	return func(blockNum int, pending []*ScenarioTx) []*ScenarioTx {
+		sorted := make([]*ScenarioTx, len(pending))
+		copy(sorted, pending)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].FeeRate > sorted[j].FeeRate
+		})
+		if len(sorted) > maxTxns {
+			sorted = sorted[:maxTxns]
+		}
+		return sorted
+	}
+}
+
+// ConfirmAboveFeeRate returns a confirmation pattern which includes all of the
+// pending transactions that pay at least the passed fee rate, in satoshis per
+// byte, in each block.
+func ConfirmAboveFeeRate(minFeeRate hdfutil.Amount) ConfirmationPattern {
+	return func(blockNum int, pending []*ScenarioTx) []*ScenarioTx {
+		var included []*ScenarioTx
+		for _, stx := range pending {
+			if stx.FeeRate >= minFeeRate {
+				included = append(included, stx)
+			}
+		}
+		return included
+	}
+}
+
+// FeeScenario describes mempool load generated over a number of mined blocks
+// in order to integration test fee estimation against known targets.
+type FeeScenario struct {
+	// Blocks is the number of blocks to mine.
+	Blocks int
+
+	// TxnsPerBlock is the number of transactions submitted to the mempool
+	// before each block is mined.
+	TxnsPerBlock int
+
+	// FeeRates chooses the fee rate of each submitted transaction.
+	FeeRates FeeRateDistribution
+
+	// Confirm chooses the pending transactions included in each block.
+	// The transactions which are not included remain in the mempool.
+	Confirm ConfirmationPattern
+
+	// Seed is the seed of the source of randomness passed to FeeRates so
+	// scenarios are reproducible.
+	Seed int64
+}
+
+// FeeScenarioResult houses the transactions submitted while running a fee
+// scenario.
+type FeeScenarioResult struct {
+	Txns []*ScenarioTx
+}
+
+// Pending returns the transactions of the scenario which are unconfirmed.
+func (r *FeeScenarioResult) Pending() []*ScenarioTx {
+	var pending []*ScenarioTx
+	for _, stx := range r.Txns {
+		if stx.ConfirmHeight == 0 {
+			pending = append(pending, stx)
+		}
+	}
+	return pending
+}
+
+// MinFeeRateForTarget returns the lowest fee rate, in satoshis per byte, for
+// which at least the passed fraction of the scenario transactions paying that
+// fee rate or more were confirmed within the passed number of blocks.  This is
+// the fee rate an estimator which observed the scenario is expected to return
+// for the target.  Zero is returned when no fee rate meets the threshold.
+func (r *FeeScenarioResult) MinFeeRateForTarget(target int32,
+	threshold float64) hdfutil.Amount {
+
+	// Consider the transactions from the highest fee rate to the lowest so
+	// the fraction at each fee rate includes all of the higher ones.
+	sorted := make([]*ScenarioTx, len(r.Txns))
+	copy(sorted, r.Txns)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].FeeRate > sorted[j].FeeRate
+	})
+
+	var minFeeRate hdfutil.Amount
+	var numTxns, numConfirmed int
+	for i, stx := range sorted {
+		numTxns++
+		if stx.ConfirmHeight != 0 &&
+			stx.ConfirmHeight-stx.SubmitHeight <= target {
+
+			numConfirmed++
+		}
+
+		// Only evaluate the threshold once all of the transactions with
+		// the same fee rate have been counted.
+		if i+1 < len(sorted) && sorted[i+1].FeeRate == stx.FeeRate {
+			continue
+		}
+		if float64(numConfirmed)/float64(numTxns) < threshold {
+			break
+		}
+		minFeeRate = stx.FeeRate
+	}
+
+	return minFeeRate
+}
+
+// waitForWalletSync blocks until the wallet of the harness has synced to the
+// passed height or the wallet sync timeout elapses.
+func (h *Harness) waitForWalletSync(height int32) error {
+	ticker := time.NewTicker(time.Millisecond * 100)
+	defer ticker.Stop()
+	timeout := time.After(walletSyncTimeout)
+	for h.wallet.SyncedHeight() < height {
+		select {
+		case <-ticker.C:
+		case <-timeout:
+			return fmt.Errorf("wallet failed to sync to height %d "+
+				"within %v", height, walletSyncTimeout)
+		}
+	}
+	return nil
+}
+
+// generateBlock mines a block including the passed transactions and blocks
+// until the wallet of the harness has ingested it.
+func (h *Harness) generateBlock(txns []*hdfutil.Tx) (*hdfutil.Block, error) {
+	block, err := h.GenerateAndSubmitBlock(txns, -1, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	if err := h.waitForWalletSync(block.Height()); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// paymentOutputs returns the passed number of outputs with the passed value
+// paying to new addresses of the wallet of the harness.
+func (h *Harness) paymentOutputs(num int, value hdfutil.Amount) ([]*wire.TxOut, error) {
+	outputs := make([]*wire.TxOut, 0, num)
+	for i := 0; i < num; i++ {
+		addr, err := h.NewAddress()
+		if err != nil {
+			return nil, err
+		}
+		pkScript, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, wire.NewTxOut(int64(value), pkScript))
+	}
+	return outputs, nil
+}
+
+// fundFeeScenario mines a block creating the passed number of wallet outputs
+// to fund the transactions of a fee scenario, so the scenario does not depend
+// on the number of mature coinbase outputs of the harness.
+func (h *Harness) fundFeeScenario(numTxns int) error {
+	var fundingTxns []*hdfutil.Tx
+	for numTxns > 0 {
+		numOutputs := numTxns
+		if numOutputs > maxFundingOutputs {
+			numOutputs = maxFundingOutputs
+		}
+		outputs, err := h.paymentOutputs(numOutputs, scenarioFundValue)
+		if err != nil {
+			return err
+		}
+		tx, err := h.CreateTransaction(outputs, fundingFeeRate, true)
+		if err != nil {
+			return err
+		}
+		fundingTxns = append(fundingTxns, hdfutil.NewTx(tx))
+		numTxns -= numOutputs
+	}
+
+	_, err := h.generateBlock(fundingTxns)
+	return err
+}
+
+// RunFeeScenario generates the mempool load described by the passed scenario.
+// Before each of the blocks of the scenario is mined, the configured number of
+// transactions with fee rates chosen by the fee rate distribution are submitted
+// to the mempool of the node.  Each block then includes the pending
+// transactions chosen by the confirmation pattern.  The returned result records
+// when each transaction was submitted and confirmed so the expected fee
+// estimates can be derived from it.
+//
+// This function is safe for concurrent access.
+func (h *Harness) RunFeeScenario(s *FeeScenario) (*FeeScenarioResult, error) {
+	if err := h.fundFeeScenario(s.Blocks * s.TxnsPerBlock); err != nil {
+		return nil, fmt.Errorf("unable to fund fee scenario: %v", err)
+	}
+
+	rng := rand.New(rand.NewSource(s.Seed))
+	result := &FeeScenarioResult{
+		Txns: make([]*ScenarioTx, 0, s.Blocks*s.TxnsPerBlock),
+	}
+	var pending []*ScenarioTx
+	for blockNum := 0; blockNum < s.Blocks; blockNum++ {
+		_, height, err := h.Node.GetBestBlock()
+		if err != nil {
+			return nil, err
+		}
+
+		// Submit the transactions of this round to the mempool.
+		for i := 0; i < s.TxnsPerBlock; i++ {
+			outputs, err := h.paymentOutputs(1, scenarioPaymentValue)
+			if err != nil {
+				return nil, err
+			}
+			feeRate := s.FeeRates(rng)
+			tx, err := h.CreateTransaction(outputs, feeRate, true)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := h.Node.SendRawTransaction(tx, true); err != nil {
+				h.UnlockOutputs(tx.TxIn)
+				return nil, fmt.Errorf("unable to submit "+
+					"transaction with fee rate %d sat/byte: %v",
+					feeRate, err)
+			}
+
+			stx := &ScenarioTx{
+				Tx:           hdfutil.NewTx(tx),
+				FeeRate:      feeRate,
+				SubmitHeight: height,
+			}
+			result.Txns = append(result.Txns, stx)
+			pending = append(pending, stx)
+		}
+
+		// Mine the transactions chosen by the confirmation pattern and
+		// keep the rest pending.
+		included := s.Confirm(blockNum, pending)
+		confirmed := make(map[*ScenarioTx]struct{}, len(included))
+		txns := make([]*hdfutil.Tx, 0, len(included))
+		for _, stx := range included {
+			confirmed[stx] = struct{}{}
+			txns = append(txns, stx.Tx)
+		}
+		block, err := h.generateBlock(txns)
+		if err != nil {
+			return nil, err
+		}
+
+		remaining := pending[:0]
+		for _, stx := range pending {
+			if _, ok := confirmed[stx]; ok {
+				stx.ConfirmHeight = block.Height()
+				continue
+			}
+			remaining = append(remaining, stx)
+		}
+		pending = remaining
+	}
+
+	return result, nil
+}
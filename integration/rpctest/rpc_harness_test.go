@@ -391,6 +391,58 @@ func testGenerateAndSubmitBlock(r *Harness, t *testing.T) {
 	}
 }
 
+func testMineToActivation(r *Harness, t *testing.T) {
+	// Create a fresh regression test harness with a small rule change
+	// confirmation window so the deployment activates quickly.  The
+	// harness parameters are a copy that is overridden to match the node.
+	const threshold, window = 3, 4
+	params := chaincfg.RegressionNetParams
+	err := params.OverrideRuleChangeWindow(threshold, window)
+	if err != nil {
+		t.Fatalf("unable to override rule change window: %v", err)
+	}
+	extraArgs := []string{fmt.Sprintf("--vbwindow=%d:%d", threshold,
+		window)}
+	harness, err := New(&params, nil, extraArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := harness.SetUp(false, 0); err != nil {
+		t.Fatalf("unable to complete harness setup: %v", err)
+	}
+	defer harness.TearDown()
+
+	const forkKey = "dummy"
+	err = harness.MineToActivation(forkKey, chaincfg.DeploymentTestDummy)
+	if err != nil {
+		t.Fatalf("unable to activate deployment: %v", err)
+	}
+	status, err := harness.DeploymentStatus(forkKey)
+	if err != nil {
+		t.Fatalf("unable to query deployment status: %v", err)
+	}
+	if status != "active" {
+		t.Fatalf("deployment status is %q instead of active", status)
+	}
+
+	// The deployment moves through the started, locked in, and active
+	// states at the end of each of the first three windows.  Ensure no
+	// more blocks than that were mined, including when the deployment is
+	// already active.
+	err = harness.MineToActivation(forkKey, chaincfg.DeploymentTestDummy)
+	if err != nil {
+		t.Fatalf("unable to activate deployment: %v", err)
+	}
+	_, height, err := harness.Node.GetBestBlock()
+	if err != nil {
+		t.Fatalf("unable to get best block: %v", err)
+	}
+	if height != 3*window-1 {
+		t.Fatalf("activation mined to height %d instead of %d", height,
+			3*window-1)
+	}
+}
+
 func testGenerateAndSubmitBlockWithCustomCoinbaseOutputs(r *Harness,
 	t *testing.T) {
 	// Generate a few test spend transactions.
@@ -546,6 +598,60 @@ func testMemWalletLockedOutputs(r *Harness, t *testing.T) {
 	}
 }
 
+func testFeeScenario(r *Harness, t *testing.T) {
+	const (
+		numBlocks    = 3
+		txnsPerBlock = 5
+		maxBlockTxns = 3
+	)
+	scenario := &FeeScenario{
+		Blocks:       numBlocks,
+		TxnsPerBlock: txnsPerBlock,
+		FeeRates:     UniformFeeRates(2, 50),
+		Confirm:      ConfirmHighestFeeRates(maxBlockTxns),
+		Seed:         1,
+	}
+	result, err := r.RunFeeScenario(scenario)
+	if err != nil {
+		t.Fatalf("unable to run fee scenario: %v", err)
+	}
+
+	// Ensure all of the transactions were submitted and only the allowed
+	// number of them were confirmed in each block.
+	if len(result.Txns) != numBlocks*txnsPerBlock {
+		t.Fatalf("unexpected number of scenario transactions -- got "+
+			"%d, want %d", len(result.Txns), numBlocks*txnsPerBlock)
+	}
+	pending := result.Pending()
+	wantPending := numBlocks * (txnsPerBlock - maxBlockTxns)
+	if len(pending) != wantPending {
+		t.Fatalf("unexpected number of pending transactions -- got "+
+			"%d, want %d", len(pending), wantPending)
+	}
+
+	// Ensure the pending transactions remain in the mempool.
+	mempool, err := r.Node.GetRawMempool()
+	if err != nil {
+		t.Fatalf("unable to get mempool: %v", err)
+	}
+	inMempool := make(map[chainhash.Hash]struct{}, len(mempool))
+	for _, txHash := range mempool {
+		inMempool[*txHash] = struct{}{}
+	}
+	for _, stx := range pending {
+		if _, ok := inMempool[*stx.Tx.Hash()]; !ok {
+			t.Fatalf("pending transaction %v is not in the mempool",
+				stx.Tx.Hash())
+		}
+	}
+
+	// The transaction with the highest fee rate is always confirmed in the
+	// next block, so there must be an expected fee rate for that target.
+	if feeRate := result.MinFeeRateForTarget(1, 0.5); feeRate == 0 {
+		t.Fatal("no expected fee rate for a target of one block")
+	}
+}
+
 var harnessTestCases = []HarnessTestCase{
 	testSendOutputs,
 	testConnectNode,
@@ -556,6 +662,8 @@ var harnessTestCases = []HarnessTestCase{
 	testGenerateAndSubmitBlockWithCustomCoinbaseOutputs,
 	testMemWalletReorg,
 	testMemWalletLockedOutputs,
+	testMineToActivation,
+	testFeeScenario,
 }
 
 var mainHarness *Harness
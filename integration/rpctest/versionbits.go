@@ -0,0 +1,125 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpctest
+
+import (
+	"fmt"
+	"time"
+)
+
+// vbTopBits defines the bits to set in the block version to signal that the
+// version bits scheme is being used.
+const vbTopBits = 0x20000000
+
+// deploymentStatuses houses the statuses a BIP0009 deployment reported by the
+// getblockchaininfo RPC moves through in order to become active.
+var deploymentStatuses = []string{"defined", "started", "lockedin", "active"}
+
+// deploymentStatusIndex returns the index of the provided status within the
+// statuses a deployment moves through to become active, or -1 when it is not
+// one of them.
+func deploymentStatusIndex(status string) int {
+	for i, s := range deploymentStatuses {
+		if s == status {
+			return i
+		}
+	}
+	return -1
+}
+
+// DeploymentStatus returns the status of the BIP0009 deployment identified by
+// the provided key, such as "csv", as reported by the getblockchaininfo RPC.
+//
+// NOTE: The status is that of the block AFTER the current best block.
+func (h *Harness) DeploymentStatus(forkKey string) (string, error) {
+	info, err := h.Node.GetBlockChainInfo()
+	if err != nil {
+		return "", err
+	}
+	if info.SoftForks == nil {
+		return "", fmt.Errorf("getblockchaininfo did not return any " +
+			"soft fork details")
+	}
+	desc, ok := info.SoftForks.Bip9SoftForks[forkKey]
+	if !ok {
+		return "", fmt.Errorf("deployment %q is not in getblockchaininfo "+
+			"results", forkKey)
+	}
+	return desc.Status, nil
+}
+
+// MineToActivation mines exactly enough blocks that signal support for the
+// BIP0009 deployment identified by the provided key, such as "csv", and
+// deployment ID, such as chaincfg.DeploymentCSV, to move it through each of
+// the defined, started, and locked in states until it is active.  The key is
+// the one the deployment is reported under by the getblockchaininfo RPC.
+//
+// Since the state of a deployment only changes at the end of each rule change
+// confirmation window, every block up to the end of the current window is
+// mined, after which the deployment is required to have moved to the next
+// state.  An error is returned when it did not, such as when the start time of
+// the deployment has not been reached or when it has failed.  The deployment
+// schedule of the regression test network may be overridden via the
+// --vbparams and --vbwindow options in order to control this.  When the
+// window is overridden, the harness parameters must be updated accordingly.
+//
+// Nothing is mined when the deployment is already active.
+//
+// This function is safe for concurrent access.
+func (h *Harness) MineToActivation(forkKey string, deploymentID uint32) error {
+	if deploymentID >= uint32(len(h.ActiveNet.Deployments)) {
+		return fmt.Errorf("deployment ID %d does not exist", deploymentID)
+	}
+	deployment := &h.ActiveNet.Deployments[deploymentID]
+	signalVersion := int32(1<<deployment.BitNumber) | vbTopBits
+	window := int64(h.ActiveNet.MinerConfirmationWindow)
+
+	status, err := h.DeploymentStatus(forkKey)
+	if err != nil {
+		return err
+	}
+	for {
+		stateIdx := deploymentStatusIndex(status)
+		if stateIdx == -1 {
+			return fmt.Errorf("deployment %q is in unexpected state "+
+				"%q", forkKey, status)
+		}
+		if stateIdx == len(deploymentStatuses)-1 {
+			return nil
+		}
+
+		// Mine the remaining blocks of the current confirmation window
+		// with all of them signalling support.  The status reported by
+		// getblockchaininfo is for the block after the best block, so
+		// the window ends when the height of that block is a multiple
+		// of the window size.
+		_, height, err := h.Node.GetBestBlock()
+		if err != nil {
+			return err
+		}
+		numBlocks := window - (int64(height)+1)%window
+		for i := int64(0); i < numBlocks; i++ {
+			_, err := h.GenerateAndSubmitBlock(nil, signalVersion,
+				time.Time{})
+			if err != nil {
+				return fmt.Errorf("failed to generate block: %v",
+					err)
+			}
+		}
+
+		// Ensure the deployment moved to the next state.
+		nextStatus, err := h.DeploymentStatus(forkKey)
+		if err != nil {
+			return err
+		}
+		if nextStatus != deploymentStatuses[stateIdx+1] {
+			return fmt.Errorf("deployment %q moved from state %q to "+
+				"%q instead of %q at height %d", forkKey, status,
+				nextStatus, deploymentStatuses[stateIdx+1],
+				int64(height)+numBlocks)
+		}
+		status = nextStatus
+	}
+}
@@ -43,8 +43,14 @@ be an exhaustive list.
    - Reject invalid transactions according to the network consensus rules
    - Full script execution and validation with signature cache support
    - Individual transaction query support
+   - Immutable snapshots of the pool along with a histogram of the fee rates
+     which can be queried without blocking the pool
  - Orphan transaction support (transactions that spend from unknown outputs)
    - Configurable limits (see transaction acceptance policy)
+   - Per-source limit on the total size of orphans, which are typically tagged
+     with the peer that relayed them, evicting the oldest orphans of the source
+   - Random eviction weighted by size when the orphan pool is full
+   - Tracking of the missing parents of each orphan so they can be requested
    - Automatic addition of orphan transactions that are no longer orphans as new
      transactions are added to the pool
    - Individual orphan transaction query support
@@ -54,15 +60,37 @@ be an exhaustive list.
    - Rate limiting of low-fee and free transactions
    - Non-zero fee threshold
    - Max signature operations per transaction
+   - Virtual bytes each signature operation is counted as for fee rates
    - Max orphan transaction size
    - Max number of orphan transactions allowed
+   - Max total size of the orphan transactions with the same tag
+   - Option to accept replacement transactions
+   - Max number and total size of unconfirmed ancestors and descendants
+   - Max total size of the pool with eviction of the transactions with the
+     lowest fee rates, including their descendants, and a decaying minimum
+     fee rate for new transactions suitable for feefilter messages
+   - Max age of the transactions in the pool
+ - Opt-in Replace-By-Fee (BIP125) support
+   - Replacement of transactions signaling replaceability either explicitly
+     or through an unconfirmed ancestor
+   - Fee rate and absolute fee improvement checks
+   - Limit on the number of transactions evicted by a single replacement
+   - Optional callback notifying the caller about evicted transactions
+ - Package acceptance
+   - Atomic acceptance of a set of related transactions
+   - Fee requirements evaluated for the package as a whole so transactions
+     paying low fees can be fee bumped by their children (CPFP)
  - Additional metadata tracking for each transaction
    - Timestamp when the transaction was added to the pool
    - Most recent block height when the transaction was added to the pool
    - The fee the transaction pays
    - The starting priority for the transaction
+   - The count, total size, and total fees of the transaction together with
+     its unconfirmed ancestors and descendants
  - Manual control of transaction removal
    - Recursive removal of all dependent transactions
+ - Periodic rebroadcasting of transactions which pay high enough fees to have
+   been mined already, suggesting they are missing from the pools of peers
 
 Errors
 
@@ -76,6 +104,14 @@ consensus acceptance rules.  This allows the caller to easily differentiate
 between unexpected errors, such as database errors, versus errors due to rule
 violations through type assertions.  In addition, callers can programmatically
 determine the specific rule violation by type asserting the Err field to one of
-the aforementioned types and examining their underlying ErrorCode field.
+the aforementioned types and examining the RejectCode field of the former, or by
+using errors.Is with one of the blockchain.ErrorKind constants for the latter.
+
+Transactions which fail the standardness checks, which are also available to
+callers via CheckTransactionStandard, additionally report the reason as one of
+the mempool.RejectReason constants in the Reason field of the TxRuleError, so
+errors.Is may be used with them as well.  The string form of each reason
+matches the reject reasons of the reference implementation, which makes them
+suitable for machine-readable RPC responses.
 */
 package mempool
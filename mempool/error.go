@@ -5,6 +5,9 @@
 package mempool
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/ifishnet/hdfd/blockchain"
 	"github.com/ifishnet/hdfd/wire"
 )
@@ -27,13 +30,109 @@ func (e RuleError) Error() string {
 	return e.Err.Error()
 }
 
+// Unwrap returns the underlying wrapped error so that errors.Is and errors.As
+// are able to match against a blockchain.ErrorKind.
+func (e RuleError) Unwrap() error {
+	return e.Err
+}
+
+// RejectReason identifies the reason a transaction is not standard.  It has
+// full support for errors.Is, so the caller can directly check a rule error
+// against a reason.  The string form of each reason matches the reject reason
+// reported by the reference implementation, which makes it suitable for
+// machine-readable RPC responses.
+type RejectReason int
+
+// These constants are used to identify the reason a transaction is not
+// standard.
+const (
+	// ReasonNone indicates the rejection is not due to a specific
+	// standardness rule.
+	ReasonNone RejectReason = iota
+
+	// ReasonVersion indicates the transaction version is not in the range
+	// of supported versions.
+	ReasonVersion
+
+	// ReasonNonFinal indicates the transaction is not finalized.
+	ReasonNonFinal
+
+	// ReasonTxSize indicates the weight of the transaction exceeds the
+	// maximum standard weight.
+	ReasonTxSize
+
+	// ReasonSigScriptSize indicates a signature script exceeds the maximum
+	// standard size.
+	ReasonSigScriptSize
+
+	// ReasonSigScriptNotPushOnly indicates a signature script contains
+	// opcodes other than data pushes.
+	ReasonSigScriptNotPushOnly
+
+	// ReasonPkScript indicates an output script is not of a standard form.
+	ReasonPkScript
+
+	// ReasonDust indicates an output pays an amount that costs more to
+	// spend than it is worth.
+	ReasonDust
+
+	// ReasonMultiOpReturn indicates the transaction has more than one
+	// output that only carries data.
+	ReasonMultiOpReturn
+
+	// ReasonNonStandardInputs indicates an input spends an output script
+	// of a non-standard form or with too many signature operations.
+	ReasonNonStandardInputs
+
+	// ReasonTooLongMempoolChain indicates accepting the transaction would
+	// exceed the limits on the number or total size of unconfirmed
+	// ancestors or descendants of a transaction in the mempool.
+	ReasonTooLongMempoolChain
+
+	// numRejectReasons is the maximum number of reject reasons used in
+	// tests.
+	numRejectReasons
+)
+
+// rejectReasonStrings is a map of RejectReason values back to the reject
+// reasons reported by the reference implementation.
+var rejectReasonStrings = map[RejectReason]string{
+	ReasonNone:                 "none",
+	ReasonVersion:              "version",
+	ReasonNonFinal:             "non-final",
+	ReasonTxSize:               "tx-size",
+	ReasonSigScriptSize:        "scriptsig-size",
+	ReasonSigScriptNotPushOnly: "scriptsig-not-pushonly",
+	ReasonPkScript:             "scriptpubkey",
+	ReasonDust:                 "dust",
+	ReasonMultiOpReturn:        "multi-op-return",
+	ReasonNonStandardInputs:    "bad-txns-nonstandard-inputs",
+	ReasonTooLongMempoolChain:  "too-long-mempool-chain",
+}
+
+// String returns the RejectReason as a machine-readable reason.
+func (r RejectReason) String() string {
+	if s := rejectReasonStrings[r]; s != "" {
+		return s
+	}
+	return fmt.Sprintf("Unknown RejectReason (%d)", int(r))
+}
+
+// Error satisfies the error interface so reasons can be matched with
+// errors.Is.
+func (r RejectReason) Error() string {
+	return r.String()
+}
+
 // TxRuleError identifies a rule violation.  It is used to indicate that
 // processing of a transaction failed due to one of the many validation
 // rules.  The caller can use type assertions to determine if a failure was
-// specifically due to a rule violation and access the ErrorCode field to
-// ascertain the specific reason for the rule violation.
+// specifically due to a rule violation and access the RejectCode field to
+// ascertain the specific reason for the rule violation.  Failures of the
+// standardness checks additionally set the Reason field.
 type TxRuleError struct {
 	RejectCode  wire.RejectCode // The code to send with reject messages
+	Reason      RejectReason    // Why the transaction is not standard
 	Description string          // Human readable description of the issue
 }
 
@@ -42,6 +141,15 @@ func (e TxRuleError) Error() string {
 	return e.Description
 }
 
+// Unwrap returns the reason the transaction is not standard, if any, so that
+// errors.Is is able to match against a RejectReason.
+func (e TxRuleError) Unwrap() error {
+	if e.Reason == ReasonNone {
+		return nil
+	}
+	return e.Reason
+}
+
 // txRuleError creates an underlying TxRuleError with the given a set of
 // arguments and returns a RuleError that encapsulates it.
 func txRuleError(c wire.RejectCode, desc string) RuleError {
@@ -50,6 +158,25 @@ func txRuleError(c wire.RejectCode, desc string) RuleError {
 	}
 }
 
+// nonStandardError creates an underlying TxRuleError for a transaction that is
+// not standard for the given reason and returns a RuleError that encapsulates
+// it.
+func nonStandardError(c wire.RejectCode, reason RejectReason, desc string) RuleError {
+	return RuleError{
+		Err: TxRuleError{RejectCode: c, Reason: reason, Description: desc},
+	}
+}
+
+// extractRejectReason returns the reason a transaction is not standard for the
+// given error or ReasonNone when the error is not due to a standardness rule.
+func extractRejectReason(err error) RejectReason {
+	var txErr TxRuleError
+	if errors.As(err, &txErr) {
+		return txErr.Reason
+	}
+	return ReasonNone
+}
+
 // chainRuleError returns a RuleError that encapsulates the given
 // blockchain.RuleError.
 func chainRuleError(chainErr blockchain.RuleError) RuleError {
@@ -71,7 +198,7 @@ func extractRejectCode(err error) (wire.RejectCode, bool) {
 	case blockchain.RuleError:
 		// Convert the chain error to a reject code.
 		var code wire.RejectCode
-		switch err.ErrorCode {
+		switch err.Err {
 		// Rejected due to duplicate.
 		case blockchain.ErrDuplicateBlock:
 			code = wire.RejectDuplicate
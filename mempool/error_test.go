@@ -0,0 +1,78 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// TestRejectReasonStringer tests the stringized output for the RejectReason
+// type.
+func TestRejectReasonStringer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in   RejectReason
+		want string
+	}{
+		{ReasonNone, "none"},
+		{ReasonVersion, "version"},
+		{ReasonNonFinal, "non-final"},
+		{ReasonTxSize, "tx-size"},
+		{ReasonSigScriptSize, "scriptsig-size"},
+		{ReasonSigScriptNotPushOnly, "scriptsig-not-pushonly"},
+		{ReasonPkScript, "scriptpubkey"},
+		{ReasonDust, "dust"},
+		{ReasonMultiOpReturn, "multi-op-return"},
+		{ReasonNonStandardInputs, "bad-txns-nonstandard-inputs"},
+		{ReasonTooLongMempoolChain, "too-long-mempool-chain"},
+		{0xff, "Unknown RejectReason (255)"},
+	}
+
+	// Detect additional reject reasons that don't have the stringer added.
+	if len(tests)-1 != int(numRejectReasons) {
+		t.Errorf("It appears a reject reason was added without adding " +
+			"an associated stringer test")
+	}
+
+	for i, test := range tests {
+		result := test.in.String()
+		if result != test.want {
+			t.Errorf("String #%d\n got: %s want: %s", i, result,
+				test.want)
+		}
+	}
+}
+
+// TestRejectReasonWrapping ensures the reason of a rule error survives being
+// wrapped and is matched by errors.Is while errors without a reason are not.
+func TestRejectReasonWrapping(t *testing.T) {
+	t.Parallel()
+
+	err := nonStandardError(wire.RejectDust, ReasonDust, "dust")
+	wrapped := nonStandardError(wire.RejectDust, extractRejectReason(err),
+		"transaction is not standard: "+err.Error())
+	if !errors.Is(wrapped, ReasonDust) {
+		t.Fatalf("errors.Is: wrapped error %v does not match %v",
+			wrapped, ReasonDust)
+	}
+	if errors.Is(wrapped, ReasonTxSize) {
+		t.Fatalf("errors.Is: wrapped error %v matches %v", wrapped,
+			ReasonTxSize)
+	}
+
+	plain := txRuleError(wire.RejectInvalid, "invalid")
+	if reason := extractRejectReason(plain); reason != ReasonNone {
+		t.Fatalf("extractRejectReason: got %v, want %v", reason,
+			ReasonNone)
+	}
+	if errors.Is(plain, ReasonNone) {
+		t.Fatalf("errors.Is: error without a reason matches %v",
+			ReasonNone)
+	}
+}
@@ -11,9 +11,7 @@ import (
 	"fmt"
 	"io"
 	"math"
-	"math/rand"
 	"sort"
-	"strings"
 	"sync"
 
 	"github.com/ifishnet/hdfd/chaincfg/chainhash"
@@ -21,29 +19,69 @@ import (
 	"github.com/ifishnet/hdfutil"
 )
 
-// TODO incorporate Alex Morcos' modifications to Gavin's initial model
-// https://lists.linuxfoundation.org/pipermail/bitcoin-dev/2014-October/006824.html
+// The fee estimator follows the design of the reference implementation.
+// Transactions are grouped into buckets by fee rate, and the number of
+// transactions of each bucket that were confirmed within, or failed to be
+// confirmed within, a number of blocks are tracked as exponentially decaying
+// moving averages.  This is done for three time horizons which differ in how
+// quickly old data decays and how many blocks they track.  An estimate for a
+// confirmation target is the median fee rate of the cheapest range of buckets
+// whose transactions were confirmed within the target often enough.
 
 const (
-	// estimateFeeDepth is the maximum number of blocks before a transaction
-	// is confirmed that we want to track.
-	estimateFeeDepth = 25
-
-	// estimateFeeBinSize is the number of txs stored in each bin.
-	estimateFeeBinSize = 100
-
-	// estimateFeeMaxReplacements is the max number of replacements that
-	// can be made by the txs found in a given block.
-	estimateFeeMaxReplacements = 10
-
-	// DefaultEstimateFeeMaxRollback is the default number of rollbacks
-	// allowed by the fee estimator for orphaned blocks.
-	DefaultEstimateFeeMaxRollback = 2
-
-	// DefaultEstimateFeeMinRegisteredBlocks is the default minimum
-	// number of blocks which must be observed by the fee estimator before
-	// it will provide fee estimations.
-	DefaultEstimateFeeMinRegisteredBlocks = 3
+	// minBucketFeeRate is the fee rate, in satoshis per byte, of the
+	// lowest fee rate bucket.
+	minBucketFeeRate = 1
+
+	// maxBucketFeeRate is the fee rate, in satoshis per byte, of the
+	// highest bounded fee rate bucket.  Higher fee rates are tracked by a
+	// final bucket without an upper bound.
+	maxBucketFeeRate = 10000
+
+	// feeBucketSpacing is the ratio between the fee rates of consecutive
+	// buckets.
+	feeBucketSpacing = 1.05
+
+	// shortBlockPeriods, shortScale, and shortDecay define the short time
+	// horizon which tracks confirmation within up to 12 blocks with a half
+	// life of 18 blocks.
+	shortBlockPeriods = 12
+	shortScale        = 1
+	shortDecay        = .962
+
+	// medBlockPeriods, medScale, and medDecay define the medium time
+	// horizon which tracks confirmation within up to 48 blocks with a half
+	// life of 144 blocks.
+	medBlockPeriods = 24
+	medScale        = 2
+	medDecay        = .9952
+
+	// longBlockPeriods, longScale, and longDecay define the long time
+	// horizon which tracks confirmation within up to 1008 blocks with a
+	// half life of 1008 blocks.
+	longBlockPeriods = 42
+	longScale        = 24
+	longDecay        = .99931
+
+	// halfSuccessPct, successPct, and doubleSuccessPct are the fractions
+	// of transactions which must be confirmed within half the target, the
+	// target, and double the target, respectively, for a fee rate to be
+	// considered sufficient.
+	halfSuccessPct   = .6
+	successPct       = .85
+	doubleSuccessPct = .95
+
+	// sufficientFeeTxns and sufficientTxnsShort are the average number of
+	// transactions per block a range of buckets must have in order to be
+	// considered for an estimate by the medium and long horizons and by
+	// the short horizon, respectively.
+	sufficientFeeTxns   = 0.1
+	sufficientTxnsShort = 0.5
+
+	// oldestEstimateHistory is the maximum number of blocks the data
+	// restored from a previous session may be behind the best chain for it
+	// to still count towards the number of blocks that were observed.
+	oldestEstimateHistory = 6 * 1008
 
 	bytePerKb = 1000
 
@@ -54,6 +92,10 @@ var (
 	// EstimateFeeDatabaseKey is the key that we use to
 	// store the fee estimator in the database.
 	EstimateFeeDatabaseKey = []byte("estimatefee")
+
+	// errInsufficientFeeData is returned when there is not enough data to
+	// provide a fee estimate.
+	errInsufficientFeeData = errors.New("insufficient data or no feerate found")
 )
 
 // SatoshiPerByte is number with units of satoshis per byte.
@@ -90,588 +132,711 @@ func NewSatoshiPerByte(fee hdfutil.Amount, size uint32) SatoshiPerByte {
 	return SatoshiPerByte(float64(fee) / float64(size))
 }
 
-// observedTransaction represents an observed transaction and some
-// additional data required for the fee estimation algorithm.
-type observedTransaction struct {
-	// A transaction hash.
-	hash chainhash.Hash
-
-	// The fee per byte of the transaction in satoshis.
-	feeRate SatoshiPerByte
-
-	// The block height when it was observed.
-	observed int32
-
-	// The height of the block in which it was mined.
-	// If the transaction has not yet been mined, it is zero.
-	mined int32
+// txConfirmStats tracks, for a single time horizon, how quickly the
+// transactions of each fee rate bucket were confirmed.  The horizon tracks
+// confirmation within up to scale * the number of periods blocks in periods of
+// scale blocks.
+type txConfirmStats struct {
+	decay float64
+	scale uint32
+
+	// feeRateAvg is the decaying sum of the fee rates of the confirmed
+	// transactions of each bucket and txCtAvg is the decaying number of
+	// them.
+	feeRateAvg []float64
+	txCtAvg    []float64
+
+	// confAvg is the decaying number of transactions of each bucket which
+	// were confirmed within each number of periods and failAvg is the
+	// decaying number of them which left the mempool unconfirmed after at
+	// least each number of periods.  They are indexed by period and then
+	// by bucket.
+	confAvg [][]float64
+	failAvg [][]float64
+
+	// unconfTxs is the number of unconfirmed transactions of each bucket
+	// which entered the mempool at each of the heights tracked by the
+	// horizon, indexed by height modulo the number of tracked blocks, and
+	// oldUnconfTxs is the number of them which entered the mempool before.
+	unconfTxs    [][]int
+	oldUnconfTxs []int
 }
 
-func (o *observedTransaction) Serialize(w io.Writer) {
-	binary.Write(w, binary.BigEndian, o.hash)
-	binary.Write(w, binary.BigEndian, o.feeRate)
-	binary.Write(w, binary.BigEndian, o.observed)
-	binary.Write(w, binary.BigEndian, o.mined)
+// newTxConfirmStats returns a new time horizon tracking the passed number of
+// fee rate buckets for the passed number of periods of scale blocks.
+func newTxConfirmStats(numBuckets, numPeriods int, decay float64,
+	scale uint32) *txConfirmStats {
+
+	s := &txConfirmStats{
+		decay:        decay,
+		scale:        scale,
+		feeRateAvg:   make([]float64, numBuckets),
+		txCtAvg:      make([]float64, numBuckets),
+		confAvg:      make([][]float64, numPeriods),
+		failAvg:      make([][]float64, numPeriods),
+		unconfTxs:    make([][]int, numPeriods*int(scale)),
+		oldUnconfTxs: make([]int, numBuckets),
+	}
+	for i := 0; i < numPeriods; i++ {
+		s.confAvg[i] = make([]float64, numBuckets)
+		s.failAvg[i] = make([]float64, numBuckets)
+	}
+	for i := range s.unconfTxs {
+		s.unconfTxs[i] = make([]int, numBuckets)
+	}
+	return s
 }
 
-func deserializeObservedTransaction(r io.Reader) (*observedTransaction, error) {
-	ot := observedTransaction{}
-
-	// The first 32 bytes should be a hash.
-	binary.Read(r, binary.BigEndian, &ot.hash)
-
-	// The next 8 are SatoshiPerByte
-	binary.Read(r, binary.BigEndian, &ot.feeRate)
-
-	// And next there are two uint32's.
-	binary.Read(r, binary.BigEndian, &ot.observed)
-	binary.Read(r, binary.BigEndian, &ot.mined)
-
-	return &ot, nil
+// maxConfirms returns the maximum number of blocks to confirmation tracked by
+// the horizon.
+func (s *txConfirmStats) maxConfirms() int {
+	return len(s.confAvg) * int(s.scale)
 }
 
-// registeredBlock has the hash of a block and the list of transactions
-// it mined which had been previously observed by the FeeEstimator. It
-// is used if Rollback is called to reverse the effect of registering
-// a block.
-type registeredBlock struct {
-	hash         chainhash.Hash
-	transactions []*observedTransaction
+// unconfIndex returns the index into the unconfirmed transactions for the
+// passed height.
+func (s *txConfirmStats) unconfIndex(height int32) int {
+	bins := int32(len(s.unconfTxs))
+	return int(((height % bins) + bins) % bins)
 }
 
-func (rb *registeredBlock) serialize(w io.Writer, txs map[*observedTransaction]uint32) {
-	binary.Write(w, binary.BigEndian, rb.hash)
-
-	binary.Write(w, binary.BigEndian, uint32(len(rb.transactions)))
-	for _, o := range rb.transactions {
-		binary.Write(w, binary.BigEndian, txs[o])
+// clearCurrent moves the unconfirmed transactions which entered the mempool at
+// the height that is reused for the passed height to the old unconfirmed
+// transactions.
+func (s *txConfirmStats) clearCurrent(height int32) {
+	current := s.unconfTxs[s.unconfIndex(height)]
+	for bucket, numTxns := range current {
+		s.oldUnconfTxs[bucket] += numTxns
+		current[bucket] = 0
 	}
 }
 
-// FeeEstimator manages the data necessary to create
-// fee estimations. It is safe for concurrent access.
-type FeeEstimator struct {
-	maxRollback uint32
-	binSize     int32
-
-	// The maximum number of replacements that can be made in a single
-	// bin per block. Default is estimateFeeMaxReplacements
-	maxReplacements int32
-
-	// The minimum number of blocks that can be registered with the fee
-	// estimator before it will provide answers.
-	minRegisteredBlocks uint32
-
-	// The last known height.
-	lastKnownHeight int32
-
-	// The number of blocks that have been registered.
-	numBlocksRegistered uint32
-
-	mtx      sync.RWMutex
-	observed map[chainhash.Hash]*observedTransaction
-	bin      [estimateFeeDepth][]*observedTransaction
-
-	// The cached estimates.
-	cached []SatoshiPerByte
-
-	// Transactions that have been removed from the bins. This allows us to
-	// revert in case of an orphaned block.
-	dropped []*registeredBlock
-}
-
-// NewFeeEstimator creates a FeeEstimator for which at most maxRollback blocks
-// can be unregistered and which returns an error unless minRegisteredBlocks
-// have been registered with it.
-func NewFeeEstimator(maxRollback, minRegisteredBlocks uint32) *FeeEstimator {
-	return &FeeEstimator{
-		maxRollback:         maxRollback,
-		minRegisteredBlocks: minRegisteredBlocks,
-		lastKnownHeight:     mining.UnminedHeight,
-		binSize:             estimateFeeBinSize,
-		maxReplacements:     estimateFeeMaxReplacements,
-		observed:            make(map[chainhash.Hash]*observedTransaction),
-		dropped:             make([]*registeredBlock, 0, maxRollback),
+// updateMovingAverages decays all of the moving averages of the horizon.  It
+// is invoked once for every new block.
+func (s *txConfirmStats) updateMovingAverages() {
+	for bucket := range s.txCtAvg {
+		for period := range s.confAvg {
+			s.confAvg[period][bucket] *= s.decay
+			s.failAvg[period][bucket] *= s.decay
+		}
+		s.feeRateAvg[bucket] *= s.decay
+		s.txCtAvg[bucket] *= s.decay
 	}
 }
 
-// ObserveTransaction is called when a new transaction is observed in the mempool.
-func (ef *FeeEstimator) ObserveTransaction(t *TxDesc) {
-	ef.mtx.Lock()
-	defer ef.mtx.Unlock()
+// record records a transaction of the passed bucket and fee rate which was
+// confirmed after the passed number of blocks.
+func (s *txConfirmStats) record(blocksToConfirm int32, bucket int,
+	feeRate SatoshiPerByte) {
 
-	// If we haven't seen a block yet we don't know when this one arrived,
-	// so we ignore it.
-	if ef.lastKnownHeight == mining.UnminedHeight {
+	if blocksToConfirm < 1 {
 		return
 	}
 
-	hash := *t.Tx.Hash()
-	if _, ok := ef.observed[hash]; !ok {
-		size := uint32(GetTxVirtualSize(t.Tx))
-
-		ef.observed[hash] = &observedTransaction{
-			hash:     hash,
-			feeRate:  NewSatoshiPerByte(hdfutil.Amount(t.Fee), size),
-			observed: t.Height,
-			mined:    mining.UnminedHeight,
-		}
+	periodsToConfirm := (int(blocksToConfirm) + int(s.scale) - 1) /
+		int(s.scale)
+	for period := periodsToConfirm; period <= len(s.confAvg); period++ {
+		s.confAvg[period-1][bucket]++
 	}
+	s.txCtAvg[bucket]++
+	s.feeRateAvg[bucket] += float64(feeRate)
 }
 
-// RegisterBlock informs the fee estimator of a new block to take into account.
-func (ef *FeeEstimator) RegisterBlock(block *hdfutil.Block) error {
-	ef.mtx.Lock()
-	defer ef.mtx.Unlock()
+// newTx records an unconfirmed transaction of the passed bucket which entered
+// the mempool at the passed height.
+func (s *txConfirmStats) newTx(height int32, bucket int) {
+	s.unconfTxs[s.unconfIndex(height)][bucket]++
+}
 
-	// The previous sorted list is invalid, so delete it.
-	ef.cached = nil
+// removeTx removes an unconfirmed transaction of the passed bucket which
+// entered the mempool at the passed entry height from the horizon.  When the
+// transaction was not included in a block, it is recorded as having failed to
+// be confirmed within the number of periods it was in the mempool.
+func (s *txConfirmStats) removeTx(entryHeight, bestHeight int32, bucket int,
+	inBlock bool) {
 
-	height := block.Height()
-	if height != ef.lastKnownHeight+1 && ef.lastKnownHeight != mining.UnminedHeight {
-		return fmt.Errorf("intermediate block not recorded; current height is %d; new height is %d",
-			ef.lastKnownHeight, height)
+	blocksAgo := bestHeight - entryHeight
+	if blocksAgo < 0 {
+		return
 	}
 
-	// Update the last known height.
-	ef.lastKnownHeight = height
-	ef.numBlocksRegistered++
-
-	// Randomly order txs in block.
-	transactions := make(map[*hdfutil.Tx]struct{})
-	for _, t := range block.Transactions() {
-		transactions[t] = struct{}{}
+	if int(blocksAgo) >= len(s.unconfTxs) {
+		if s.oldUnconfTxs[bucket] > 0 {
+			s.oldUnconfTxs[bucket]--
+		}
+	} else {
+		unconf := s.unconfTxs[s.unconfIndex(entryHeight)]
+		if unconf[bucket] > 0 {
+			unconf[bucket]--
+		}
 	}
 
-	// Count the number of replacements we make per bin so that we don't
-	// replace too many.
-	var replacementCounts [estimateFeeDepth]int
-
-	// Keep track of which txs were dropped in case of an orphan block.
-	dropped := &registeredBlock{
-		hash:         *block.Hash(),
-		transactions: make([]*observedTransaction, 0, 100),
+	if !inBlock && blocksAgo >= int32(s.scale) {
+		periodsAgo := int(blocksAgo) / int(s.scale)
+		for period := 0; period < periodsAgo && period < len(s.failAvg); period++ {
+			s.failAvg[period][bucket]++
+		}
 	}
+}
 
-	// Go through the txs in the block.
-	for t := range transactions {
-		hash := *t.Hash()
-
-		// Have we observed this tx in the mempool?
-		o, ok := ef.observed[hash]
-		if !ok {
-			continue
+// estimateMedianVal returns the median fee rate, in satoshis per byte, of the
+// cheapest range of buckets which have enough transactions to be meaningful and
+// at least the passed fraction of whose transactions were confirmed within the
+// passed target.  The unconfirmed transactions which have already been in the
+// mempool for longer than the target count as not being confirmed within it.
+// It returns -1 when there is no such range.
+func (s *txConfirmStats) estimateMedianVal(confTarget int,
+	sufficientTxVal, successBreakPoint float64, bestHeight int32) float64 {
+
+	periodTarget := (confTarget + int(s.scale) - 1) / int(s.scale)
+	maxBucket := len(s.txCtAvg) - 1
+
+	// Start from the highest fee rate bucket and combine buckets until
+	// there are enough transactions to judge whether they pass.  The
+	// cheapest passing range is the answer.
+	var nConf, totalNum, failNum, extraNum float64
+	var curNearBucket, curFarBucket int
+	var bestNearBucket, bestFarBucket int
+	newBucketRange := true
+	foundAnswer := false
+	for bucket := maxBucket; bucket >= 0; bucket-- {
+		if newBucketRange {
+			curNearBucket = bucket
+			newBucketRange = false
 		}
-
-		// Put the observed tx in the oppropriate bin.
-		blocksToConfirm := height - o.observed - 1
-
-		// This shouldn't happen if the fee estimator works correctly,
-		// but return an error if it does.
-		if o.mined != mining.UnminedHeight {
-			log.Error("Estimate fee: transaction ", hash.String(), " has already been mined")
-			return errors.New("Transaction has already been mined")
+		curFarBucket = bucket
+		nConf += s.confAvg[periodTarget-1][bucket]
+		totalNum += s.txCtAvg[bucket]
+		failNum += s.failAvg[periodTarget-1][bucket]
+		for confct := confTarget; confct < s.maxConfirms(); confct++ {
+			index := s.unconfIndex(bestHeight - int32(confct))
+			extraNum += float64(s.unconfTxs[index][bucket])
 		}
+		extraNum += float64(s.oldUnconfTxs[bucket])
 
-		// This shouldn't happen but check just in case to avoid
-		// an out-of-bounds array index later.
-		if blocksToConfirm >= estimateFeeDepth {
+		// Keep combining buckets until there are enough transactions.
+		if totalNum < sufficientTxVal/(1-s.decay) {
 			continue
 		}
 
-		// Make sure we do not replace too many transactions per min.
-		if replacementCounts[blocksToConfirm] == int(ef.maxReplacements) {
+		curPct := nConf / (totalNum + failNum + extraNum)
+		if curPct < successBreakPoint {
 			continue
 		}
 
-		o.mined = height
-
-		replacementCounts[blocksToConfirm]++
-
-		bin := ef.bin[blocksToConfirm]
-
-		// Remove a random element and replace it with this new tx.
-		if len(bin) == int(ef.binSize) {
-			// Don't drop transactions we have just added from this same block.
-			l := int(ef.binSize) - replacementCounts[blocksToConfirm]
-			drop := rand.Intn(l)
-			dropped.transactions = append(dropped.transactions, bin[drop])
-
-			bin[drop] = bin[l-1]
-			bin[l-1] = o
-		} else {
-			bin = append(bin, o)
-		}
-		ef.bin[blocksToConfirm] = bin
+		// The range passes, so remember it and start a new range.
+		foundAnswer = true
+		bestNearBucket = curNearBucket
+		bestFarBucket = curFarBucket
+		nConf, totalNum, failNum, extraNum = 0, 0, 0, 0
+		newBucketRange = true
 	}
-
-	// Go through the mempool for txs that have been in too long.
-	for hash, o := range ef.observed {
-		if o.mined == mining.UnminedHeight && height-o.observed >= estimateFeeDepth {
-			delete(ef.observed, hash)
-		}
+	if !foundAnswer {
+		return -1
 	}
 
-	// Add dropped list to history.
-	if ef.maxRollback == 0 {
-		return nil
+	// Find the bucket which contains the median transaction of the passing
+	// range and use the average fee rate of that bucket.
+	var txSum float64
+	for bucket := bestFarBucket; bucket <= bestNearBucket; bucket++ {
+		txSum += s.txCtAvg[bucket]
 	}
-
-	if uint32(len(ef.dropped)) == ef.maxRollback {
-		ef.dropped = append(ef.dropped[1:], dropped)
-	} else {
-		ef.dropped = append(ef.dropped, dropped)
+	if txSum == 0 {
+		return -1
 	}
-
-	return nil
+	txSum /= 2
+	for bucket := bestFarBucket; bucket <= bestNearBucket; bucket++ {
+		if s.txCtAvg[bucket] < txSum {
+			txSum -= s.txCtAvg[bucket]
+			continue
+		}
+		return s.feeRateAvg[bucket] / s.txCtAvg[bucket]
+	}
+	return -1
 }
 
-// LastKnownHeight returns the height of the last block which was registered.
-func (ef *FeeEstimator) LastKnownHeight() int32 {
-	ef.mtx.Lock()
-	defer ef.mtx.Unlock()
-
-	return ef.lastKnownHeight
+// serialize writes the moving averages of the horizon to the passed writer.
+// The unconfirmed transactions are not written since they are tracked again
+// as transactions enter the mempool.
+func (s *txConfirmStats) serialize(w io.Writer) {
+	binary.Write(w, binary.BigEndian, s.decay)
+	binary.Write(w, binary.BigEndian, s.scale)
+	binary.Write(w, binary.BigEndian, uint32(len(s.confAvg)))
+	binary.Write(w, binary.BigEndian, s.feeRateAvg)
+	binary.Write(w, binary.BigEndian, s.txCtAvg)
+	for _, avgs := range s.confAvg {
+		binary.Write(w, binary.BigEndian, avgs)
+	}
+	for _, avgs := range s.failAvg {
+		binary.Write(w, binary.BigEndian, avgs)
+	}
 }
 
-// Rollback unregisters a recently registered block from the FeeEstimator.
-// This can be used to reverse the effect of an orphaned block on the fee
-// estimator. The maximum number of rollbacks allowed is given by
-// maxRollbacks.
-//
-// Note: not everything can be rolled back because some transactions are
-// deleted if they have been observed too long ago. That means the result
-// of Rollback won't always be exactly the same as if the last block had not
-// happened, but it should be close enough.
-func (ef *FeeEstimator) Rollback(hash *chainhash.Hash) error {
-	ef.mtx.Lock()
-	defer ef.mtx.Unlock()
+// deserializeTxConfirmStats reads the moving averages of a horizon with the
+// passed parameters and number of buckets from the passed reader.  An error is
+// returned when the parameters of the serialized horizon differ.
+func deserializeTxConfirmStats(r io.Reader, numBuckets, numPeriods int,
+	decay float64, scale uint32) (*txConfirmStats, error) {
 
-	// Find this block in the stack of recent registered blocks.
-	var n int
-	for n = 1; n <= len(ef.dropped); n++ {
-		if ef.dropped[len(ef.dropped)-n].hash.IsEqual(hash) {
-			break
-		}
+	var savedDecay float64
+	var savedScale, savedPeriods uint32
+	if err := binary.Read(r, binary.BigEndian, &savedDecay); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.BigEndian, &savedScale); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.BigEndian, &savedPeriods); err != nil {
+		return nil, err
 	}
+	if savedDecay != decay || savedScale != scale ||
+		savedPeriods != uint32(numPeriods) {
 
-	if n > len(ef.dropped) {
-		return errors.New("no such block was recently registered")
+		return nil, fmt.Errorf("mismatched time horizon: decay %v, "+
+			"scale %d, periods %d", savedDecay, savedScale,
+			savedPeriods)
 	}
 
-	for i := 0; i < n; i++ {
-		ef.rollback()
+	s := newTxConfirmStats(numBuckets, numPeriods, decay, scale)
+	if err := binary.Read(r, binary.BigEndian, s.feeRateAvg); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.BigEndian, s.txCtAvg); err != nil {
+		return nil, err
+	}
+	for _, avgs := range s.confAvg {
+		if err := binary.Read(r, binary.BigEndian, avgs); err != nil {
+			return nil, err
+		}
+	}
+	for _, avgs := range s.failAvg {
+		if err := binary.Read(r, binary.BigEndian, avgs); err != nil {
+			return nil, err
+		}
 	}
+	return s, nil
+}
 
-	return nil
+// observedTransaction represents an unconfirmed transaction which is tracked
+// by the fee estimator.
+type observedTransaction struct {
+	// The block height when it was observed.
+	height int32
+
+	// The fee per byte of the transaction in satoshis and the index of the
+	// fee rate bucket it belongs to.
+	feeRate SatoshiPerByte
+	bucket  int
 }
 
-// rollback rolls back the effect of the last block in the stack
-// of registered blocks.
-func (ef *FeeEstimator) rollback() {
-	// The previous sorted list is invalid, so delete it.
-	ef.cached = nil
+// FeeEstimator manages the data necessary to create
+// fee estimations. It is safe for concurrent access.
+type FeeEstimator struct {
+	mtx sync.Mutex
 
-	// pop the last list of dropped txs from the stack.
-	last := len(ef.dropped) - 1
-	if last == -1 {
-		// Cannot really happen because the exported calling function
-		// only rolls back a block already known to be in the list
-		// of dropped transactions.
-		return
-	}
+	// buckets are the upper bounds of the fee rate buckets in satoshis per
+	// byte.  The last one is infinite.
+	buckets []float64
 
-	dropped := ef.dropped[last]
+	// The short, medium, and long time horizons.
+	short  *txConfirmStats
+	medium *txConfirmStats
+	long   *txConfirmStats
 
-	// where we are in each bin as we replace txs?
-	var replacementCounters [estimateFeeDepth]int
+	// observed houses the unconfirmed transactions which are tracked.
+	observed map[chainhash.Hash]*observedTransaction
 
-	// Go through the txs in the dropped block.
-	for _, o := range dropped.transactions {
-		// Which bin was this tx in?
-		blocksToConfirm := o.mined - o.observed - 1
+	// bestSeenHeight is the height of the last registered block.
+	bestSeenHeight int32
 
-		bin := ef.bin[blocksToConfirm]
+	// firstRecordedHeight is the height of the first block which confirmed
+	// tracked transactions during this session.  historicalFirst and
+	// historicalBest are the heights of the first and last such blocks of
+	// the session the estimator was restored from.
+	firstRecordedHeight int32
+	historicalFirst     int32
+	historicalBest      int32
+}
 
-		var counter = replacementCounters[blocksToConfirm]
+// feeRateBuckets returns the upper bounds of the fee rate buckets in satoshis
+// per byte.
+func feeRateBuckets() []float64 {
+	var buckets []float64
+	for feeRate := float64(minBucketFeeRate); feeRate <= maxBucketFeeRate; feeRate *= feeBucketSpacing {
+		buckets = append(buckets, feeRate)
+	}
+	return append(buckets, math.Inf(1))
+}
 
-		// Continue to go through that bin where we left off.
-		for {
-			if counter >= len(bin) {
-				// Panic, as we have entered an unrecoverable invalid state.
-				panic(errors.New("illegal state: cannot rollback dropped transaction"))
-			}
+// NewFeeEstimator creates a FeeEstimator which has not observed any blocks or
+// transactions.
+func NewFeeEstimator() *FeeEstimator {
+	buckets := feeRateBuckets()
+	return &FeeEstimator{
+		buckets: buckets,
+		short: newTxConfirmStats(len(buckets), shortBlockPeriods,
+			shortDecay, shortScale),
+		medium: newTxConfirmStats(len(buckets), medBlockPeriods,
+			medDecay, medScale),
+		long: newTxConfirmStats(len(buckets), longBlockPeriods,
+			longDecay, longScale),
+		observed:       make(map[chainhash.Hash]*observedTransaction),
+		bestSeenHeight: mining.UnminedHeight,
+	}
+}
 
-			prev := bin[counter]
+// horizons returns the short, medium, and long time horizons.
+func (ef *FeeEstimator) horizons() [3]*txConfirmStats {
+	return [3]*txConfirmStats{ef.short, ef.medium, ef.long}
+}
 
-			if prev.mined == ef.lastKnownHeight {
-				prev.mined = mining.UnminedHeight
+// bucketIndex returns the index of the bucket the passed fee rate belongs to.
+func (ef *FeeEstimator) bucketIndex(feeRate SatoshiPerByte) int {
+	return sort.SearchFloat64s(ef.buckets, float64(feeRate))
+}
 
-				bin[counter] = o
+// ObserveTransaction is called when a new transaction is observed in the mempool.
+func (ef *FeeEstimator) ObserveTransaction(t *TxDesc) {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
 
-				counter++
-				break
-			}
+	// Only track transactions which entered the mempool at the height of
+	// the last registered block since it is not known how long the others
+	// have been waiting for confirmation.  This also ignores transactions
+	// which were added back to the mempool due to a reorganization.
+	if ef.bestSeenHeight == mining.UnminedHeight ||
+		t.Height != ef.bestSeenHeight {
 
-			counter++
-		}
+		return
+	}
 
-		replacementCounters[blocksToConfirm] = counter
+	hash := *t.Tx.Hash()
+	if _, ok := ef.observed[hash]; ok {
+		return
 	}
 
-	// Continue going through bins to find other txs to remove
-	// which did not replace any other when they were entered.
-	for i, j := range replacementCounters {
-		for {
-			l := len(ef.bin[i])
-			if j >= l {
-				break
-			}
+	size := uint32(GetTxVirtualSize(t.Tx))
+	feeRate := NewSatoshiPerByte(hdfutil.Amount(t.Fee), size)
+	bucket := ef.bucketIndex(feeRate)
+	for _, stats := range ef.horizons() {
+		stats.newTx(t.Height, bucket)
+	}
+	ef.observed[hash] = &observedTransaction{
+		height:  t.Height,
+		feeRate: feeRate,
+		bucket:  bucket,
+	}
+}
 
-			prev := ef.bin[i][j]
+// removeTransaction stops tracking the transaction with the passed hash.  When
+// it was not included in a block, it is recorded as having failed to be
+// confirmed.
+//
+// This function MUST be called with the fee estimator lock held.
+func (ef *FeeEstimator) removeTransaction(hash *chainhash.Hash, inBlock bool) *observedTransaction {
+	o, ok := ef.observed[*hash]
+	if !ok {
+		return nil
+	}
 
-			if prev.mined == ef.lastKnownHeight {
-				prev.mined = mining.UnminedHeight
+	for _, stats := range ef.horizons() {
+		stats.removeTx(o.height, ef.bestSeenHeight, o.bucket, inBlock)
+	}
+	delete(ef.observed, *hash)
+	return o
+}
 
-				newBin := append(ef.bin[i][0:j], ef.bin[i][j+1:l]...)
-				// TODO This line should prevent an unintentional memory
-				// leak but it causes a panic when it is uncommented.
-				// ef.bin[i][j] = nil
-				ef.bin[i] = newBin
+// RemoveTransaction is called when a transaction is removed from the mempool
+// for any reason other than being included in a registered block, such as
+// being evicted, replaced, or double spent.  The transaction is recorded as
+// having failed to be confirmed in the time it was in the mempool.
+func (ef *FeeEstimator) RemoveTransaction(hash *chainhash.Hash) {
+	ef.mtx.Lock()
+	ef.removeTransaction(hash, false)
+	ef.mtx.Unlock()
+}
 
-				continue
-			}
+// RegisterBlock informs the fee estimator of a new block to take into account.
+// Blocks at or below the height of the last registered block, such as those
+// connected during a reorganization, are ignored to avoid counting their
+// transactions twice.
+func (ef *FeeEstimator) RegisterBlock(block *hdfutil.Block) {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
 
-			j++
-		}
-	}
+	height := block.Height()
+	if ef.bestSeenHeight != mining.UnminedHeight &&
+		height <= ef.bestSeenHeight {
 
-	ef.dropped = ef.dropped[0:last]
+		return
+	}
+	ef.bestSeenHeight = height
 
-	// The number of blocks the fee estimator has seen is decrimented.
-	ef.numBlocksRegistered--
-	ef.lastKnownHeight--
-}
+	// Retire the unconfirmed transactions which are now too old to be
+	// tracked individually and decay the moving averages.
+	for _, stats := range ef.horizons() {
+		stats.clearCurrent(height)
+		stats.updateMovingAverages()
+	}
 
-// estimateFeeSet is a set of txs that can that is sorted
-// by the fee per kb rate.
-type estimateFeeSet struct {
-	feeRate []SatoshiPerByte
-	bin     [estimateFeeDepth]uint32
-}
+	// Record how long it took the tracked transactions of the block to be
+	// confirmed.
+	var numRecorded int
+	for _, tx := range block.Transactions() {
+		o := ef.removeTransaction(tx.Hash(), true)
+		if o == nil {
+			continue
+		}
 
-func (b *estimateFeeSet) Len() int { return len(b.feeRate) }
+		blocksToConfirm := height - o.height
+		if blocksToConfirm <= 0 {
+			continue
+		}
+		for _, stats := range ef.horizons() {
+			stats.record(blocksToConfirm, o.bucket, o.feeRate)
+		}
+		numRecorded++
+	}
 
-func (b *estimateFeeSet) Less(i, j int) bool {
-	return b.feeRate[i] > b.feeRate[j]
+	if ef.firstRecordedHeight == 0 && numRecorded > 0 {
+		ef.firstRecordedHeight = height
+	}
 }
 
-func (b *estimateFeeSet) Swap(i, j int) {
-	b.feeRate[i], b.feeRate[j] = b.feeRate[j], b.feeRate[i]
-}
+// LastKnownHeight returns the height of the last block which was registered.
+func (ef *FeeEstimator) LastKnownHeight() int32 {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
 
-// estimateFee returns the estimated fee for a transaction
-// to confirm in confirmations blocks from now, given
-// the data set we have collected.
-func (b *estimateFeeSet) estimateFee(confirmations int) SatoshiPerByte {
-	if confirmations <= 0 {
-		return SatoshiPerByte(math.Inf(1))
-	}
+	return ef.bestSeenHeight
+}
 
-	if confirmations > estimateFeeDepth {
+// blockSpan returns the number of blocks confirming tracked transactions that
+// were registered during this session.
+func (ef *FeeEstimator) blockSpan() int32 {
+	if ef.firstRecordedHeight == 0 {
 		return 0
 	}
+	return ef.bestSeenHeight - ef.firstRecordedHeight
+}
 
-	// We don't have any transactions!
-	if len(b.feeRate) == 0 {
+// historicalBlockSpan returns the number of blocks confirming tracked
+// transactions that were registered during the session the estimator was
+// restored from, unless that data is too old.
+func (ef *FeeEstimator) historicalBlockSpan() int32 {
+	if ef.historicalFirst == 0 {
 		return 0
 	}
-
-	var min, max int = 0, 0
-	for i := 0; i < confirmations-1; i++ {
-		min += int(b.bin[i])
+	if ef.bestSeenHeight-ef.historicalBest > oldestEstimateHistory {
+		return 0
 	}
+	return ef.historicalBest - ef.historicalFirst
+}
 
-	max = min + int(b.bin[confirmations-1]) - 1
-	if max < min {
-		max = min
+// maxUsableEstimate returns the highest confirmation target for which enough
+// blocks have been observed to provide an estimate.
+func (ef *FeeEstimator) maxUsableEstimate() int {
+	span := ef.blockSpan()
+	if historical := ef.historicalBlockSpan(); historical > span {
+		span = historical
 	}
-	feeIndex := (min + max) / 2
-	if feeIndex >= len(b.feeRate) {
-		feeIndex = len(b.feeRate) - 1
+	maxUsable := int(span / 2)
+	if maxConfirms := ef.long.maxConfirms(); maxUsable > maxConfirms {
+		maxUsable = maxConfirms
 	}
-
-	return b.feeRate[feeIndex]
+	return maxUsable
 }
 
-// newEstimateFeeSet creates a temporary data structure that
-// can be used to find all fee estimates.
-func (ef *FeeEstimator) newEstimateFeeSet() *estimateFeeSet {
-	set := &estimateFeeSet{}
-
-	capacity := 0
-	for i, b := range ef.bin {
-		l := len(b)
-		set.bin[i] = uint32(l)
-		capacity += l
+// estimateCombinedFee returns the fee rate estimate for the passed target and
+// success threshold from the shortest time horizon which tracks the target.
+// When requested, the estimates for the longest targets tracked by the shorter
+// horizons are used instead when they are lower.  It returns -1 when there is
+// no estimate.
+func (ef *FeeEstimator) estimateCombinedFee(confTarget int,
+	successThreshold float64, checkShorterHorizon bool) float64 {
+
+	estimate := -1.0
+	if confTarget < 1 || confTarget > ef.long.maxConfirms() {
+		return estimate
+	}
+
+	best := ef.bestSeenHeight
+	switch {
+	case confTarget <= ef.short.maxConfirms():
+		estimate = ef.short.estimateMedianVal(confTarget,
+			sufficientTxnsShort, successThreshold, best)
+	case confTarget <= ef.medium.maxConfirms():
+		estimate = ef.medium.estimateMedianVal(confTarget,
+			sufficientFeeTxns, successThreshold, best)
+	default:
+		estimate = ef.long.estimateMedianVal(confTarget,
+			sufficientFeeTxns, successThreshold, best)
+	}
+
+	if checkShorterHorizon {
+		if confTarget > ef.medium.maxConfirms() {
+			medMax := ef.medium.estimateMedianVal(
+				ef.medium.maxConfirms(), sufficientFeeTxns,
+				successThreshold, best)
+			if medMax > 0 && (estimate == -1 || medMax < estimate) {
+				estimate = medMax
+			}
+		}
+		if confTarget > ef.short.maxConfirms() {
+			shortMax := ef.short.estimateMedianVal(
+				ef.short.maxConfirms(), sufficientTxnsShort,
+				successThreshold, best)
+			if shortMax > 0 && (estimate == -1 || shortMax < estimate) {
+				estimate = shortMax
+			}
+		}
 	}
 
-	set.feeRate = make([]SatoshiPerByte, capacity)
+	return estimate
+}
 
-	i := 0
-	for _, b := range ef.bin {
-		for _, o := range b {
-			set.feeRate[i] = o.feeRate
-			i++
+// estimateConservativeFee returns the highest estimate of the medium and long
+// time horizons for the passed doubled target which requires the highest
+// success threshold.  It returns -1 when there is no estimate.
+func (ef *FeeEstimator) estimateConservativeFee(doubleTarget int) float64 {
+	estimate := -1.0
+	best := ef.bestSeenHeight
+	if doubleTarget <= ef.short.maxConfirms() {
+		estimate = ef.medium.estimateMedianVal(doubleTarget,
+			sufficientFeeTxns, doubleSuccessPct, best)
+	}
+	if doubleTarget <= ef.medium.maxConfirms() {
+		longEstimate := ef.long.estimateMedianVal(doubleTarget,
+			sufficientFeeTxns, doubleSuccessPct, best)
+		if longEstimate > estimate {
+			estimate = longEstimate
 		}
 	}
+	return estimate
+}
 
-	sort.Sort(set)
+// EstimateSmartFee estimates the fee per kilobyte for a transaction to be
+// confirmed within the passed number of blocks.  The estimate is the highest of
+// the estimates for half the target, the target, and double the target with
+// increasing success thresholds.  Conservative estimates additionally take the
+// longer time horizons into account, which makes them less responsive to short
+// term drops in fee rates.
+//
+// Since there must be enough data for the requested target, the estimate may be
+// for a different target, which is returned along with it.
+func (ef *FeeEstimator) EstimateSmartFee(confTarget uint32,
+	conservative bool) (HdfPerKilobyte, uint32, error) {
 
-	return set
-}
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
 
-// estimates returns the set of all fee estimates from 1 to estimateFeeDepth
-// confirmations from now.
-func (ef *FeeEstimator) estimates() []SatoshiPerByte {
-	set := ef.newEstimateFeeSet()
+	if confTarget == 0 {
+		return -1, 0, errors.New("cannot confirm transaction in zero blocks")
+	}
 
-	estimates := make([]SatoshiPerByte, estimateFeeDepth)
-	for i := 0; i < estimateFeeDepth; i++ {
-		estimates[i] = set.estimateFee(i + 1)
+	// It is not possible to reliably estimate the fee for the next block,
+	// so use the estimate for two blocks instead.  Also limit the target
+	// to the number of blocks that have been observed.
+	target := int(confTarget)
+	if target == 1 {
+		target = 2
+	}
+	if maxUsable := ef.maxUsableEstimate(); target > maxUsable {
+		target = maxUsable
+	}
+	if target <= 1 {
+		return -1, 0, errInsufficientFeeData
 	}
 
-	return estimates
+	halfEstimate := ef.estimateCombinedFee(target/2, halfSuccessPct, true)
+	estimate := ef.estimateCombinedFee(target, successPct, true)
+	if halfEstimate > estimate {
+		estimate = halfEstimate
+	}
+	doubleTarget := target * 2
+	if doubleTarget <= ef.long.maxConfirms() {
+		doubleEstimate := ef.estimateCombinedFee(doubleTarget,
+			doubleSuccessPct, !conservative)
+		if doubleEstimate > estimate {
+			estimate = doubleEstimate
+		}
+	}
+	if conservative || estimate == -1 {
+		consEstimate := ef.estimateConservativeFee(doubleTarget)
+		if consEstimate > estimate {
+			estimate = consEstimate
+		}
+	}
+
+	if estimate < 0 {
+		return -1, uint32(target), errInsufficientFeeData
+	}
+	return SatoshiPerByte(estimate).ToHdfPerKb(), uint32(target), nil
 }
 
-// EstimateFee estimates the fee per byte to have a tx confirmed a given
-// number of blocks from now.
+// EstimateFee estimates the fee per kilobyte to have a tx confirmed a given
+// number of blocks from now using the medium time horizon.  It returns -1 when
+// there is not enough data.  Use EstimateSmartFee for more reliable estimates.
 func (ef *FeeEstimator) EstimateFee(numBlocks uint32) (HdfPerKilobyte, error) {
 	ef.mtx.Lock()
 	defer ef.mtx.Unlock()
 
-	// If the number of registered blocks is below the minimum, return
-	// an error.
-	if ef.numBlocksRegistered < ef.minRegisteredBlocks {
-		return -1, errors.New("not enough blocks have been observed")
-	}
-
 	if numBlocks == 0 {
 		return -1, errors.New("cannot confirm transaction in zero blocks")
 	}
 
-	if numBlocks > estimateFeeDepth {
+	if maxConfirms := ef.medium.maxConfirms(); int(numBlocks) > maxConfirms {
 		return -1, fmt.Errorf(
 			"can only estimate fees for up to %d blocks from now",
-			estimateFeeBinSize)
+			maxConfirms)
 	}
 
-	// If there are no cached results, generate them.
-	if ef.cached == nil {
-		ef.cached = ef.estimates()
+	estimate := ef.medium.estimateMedianVal(int(numBlocks),
+		sufficientFeeTxns, doubleSuccessPct, ef.bestSeenHeight)
+	if estimate < 0 {
+		return -1, nil
 	}
-
-	return ef.cached[int(numBlocks)-1].ToHdfPerKb(), nil
+	return SatoshiPerByte(estimate).ToHdfPerKb(), nil
 }
 
 // In case the format for the serialized version of the FeeEstimator changes,
 // we use a version number. If the version number changes, it does not make
 // sense to try to upgrade a previous version to a new version. Instead, just
 // start fee estimation over.
-const estimateFeeSaveVersion = 1
-
-func deserializeRegisteredBlock(r io.Reader, txs map[uint32]*observedTransaction) (*registeredBlock, error) {
-	var lenTransactions uint32
-
-	rb := &registeredBlock{}
-	binary.Read(r, binary.BigEndian, &rb.hash)
-	binary.Read(r, binary.BigEndian, &lenTransactions)
-
-	rb.transactions = make([]*observedTransaction, lenTransactions)
-
-	for i := uint32(0); i < lenTransactions; i++ {
-		var index uint32
-		binary.Read(r, binary.BigEndian, &index)
-		rb.transactions[i] = txs[index]
-	}
-
-	return rb, nil
-}
+const estimateFeeSaveVersion = 2
 
 // FeeEstimatorState represents a saved FeeEstimator that can be
 // restored with data from an earlier session of the program.
 type FeeEstimatorState []byte
 
-// observedTxSet is a set of txs that can that is sorted
-// by hash. It exists for serialization purposes so that
-// a serialized state always comes out the same.
-type observedTxSet []*observedTransaction
-
-func (q observedTxSet) Len() int { return len(q) }
-
-func (q observedTxSet) Less(i, j int) bool {
-	return strings.Compare(q[i].hash.String(), q[j].hash.String()) < 0
-}
-
-func (q observedTxSet) Swap(i, j int) {
-	q[i], q[j] = q[j], q[i]
-}
-
 // Save records the current state of the FeeEstimator to a []byte that
-// can be restored later.
+// can be restored later.  Only the moving averages are saved since the
+// unconfirmed transactions are tracked again as they enter the mempool.
 func (ef *FeeEstimator) Save() FeeEstimatorState {
 	ef.mtx.Lock()
 	defer ef.mtx.Unlock()
 
-	// TODO figure out what the capacity should be.
 	w := bytes.NewBuffer(make([]byte, 0))
 
 	binary.Write(w, binary.BigEndian, uint32(estimateFeeSaveVersion))
+	binary.Write(w, binary.BigEndian, ef.bestSeenHeight)
 
-	// Insert basic parameters.
-	binary.Write(w, binary.BigEndian, &ef.maxRollback)
-	binary.Write(w, binary.BigEndian, &ef.binSize)
-	binary.Write(w, binary.BigEndian, &ef.maxReplacements)
-	binary.Write(w, binary.BigEndian, &ef.minRegisteredBlocks)
-	binary.Write(w, binary.BigEndian, &ef.lastKnownHeight)
-	binary.Write(w, binary.BigEndian, &ef.numBlocksRegistered)
-
-	// Put all the observed transactions in a sorted list.
-	var txCount uint32
-	ots := make([]*observedTransaction, len(ef.observed))
-	for hash := range ef.observed {
-		ots[txCount] = ef.observed[hash]
-		txCount++
-	}
-
-	sort.Sort(observedTxSet(ots))
-
-	txCount = 0
-	observed := make(map[*observedTransaction]uint32)
-	binary.Write(w, binary.BigEndian, uint32(len(ef.observed)))
-	for _, ot := range ots {
-		ot.Serialize(w)
-		observed[ot] = txCount
-		txCount++
-	}
-
-	// Save all the right bins.
-	for _, list := range ef.bin {
-
-		binary.Write(w, binary.BigEndian, uint32(len(list)))
-
-		for _, o := range list {
-			binary.Write(w, binary.BigEndian, observed[o])
-		}
+	// Save the span of blocks with the most data, which is either the one
+	// of this session or the one the estimator was restored from.
+	if ef.blockSpan() > ef.historicalBlockSpan() {
+		binary.Write(w, binary.BigEndian, ef.firstRecordedHeight)
+		binary.Write(w, binary.BigEndian, ef.bestSeenHeight)
+	} else {
+		binary.Write(w, binary.BigEndian, ef.historicalFirst)
+		binary.Write(w, binary.BigEndian, ef.historicalBest)
 	}
 
-	// Dropped transactions.
-	binary.Write(w, binary.BigEndian, uint32(len(ef.dropped)))
-	for _, registered := range ef.dropped {
-		registered.serialize(w, observed)
+	binary.Write(w, binary.BigEndian, uint32(len(ef.buckets)))
+	binary.Write(w, binary.BigEndian, ef.buckets)
+	for _, stats := range ef.horizons() {
+		stats.serialize(w)
 	}
 
-	// Commit the tx and return.
 	return FeeEstimatorState(w.Bytes())
 }
 
@@ -690,60 +855,53 @@ func RestoreFeeEstimator(data FeeEstimatorState) (*FeeEstimator, error) {
 		return nil, fmt.Errorf("Incorrect version: expected %d found %d", estimateFeeSaveVersion, version)
 	}
 
-	ef := &FeeEstimator{
-		observed: make(map[chainhash.Hash]*observedTransaction),
-	}
-
-	// Read basic parameters.
-	binary.Read(r, binary.BigEndian, &ef.maxRollback)
-	binary.Read(r, binary.BigEndian, &ef.binSize)
-	binary.Read(r, binary.BigEndian, &ef.maxReplacements)
-	binary.Read(r, binary.BigEndian, &ef.minRegisteredBlocks)
-	binary.Read(r, binary.BigEndian, &ef.lastKnownHeight)
-	binary.Read(r, binary.BigEndian, &ef.numBlocksRegistered)
+	ef := NewFeeEstimator()
+	for _, field := range []*int32{&ef.bestSeenHeight, &ef.historicalFirst,
+		&ef.historicalBest} {
 
-	// Read transactions.
-	var numObserved uint32
-	observed := make(map[uint32]*observedTransaction)
-	binary.Read(r, binary.BigEndian, &numObserved)
-	for i := uint32(0); i < numObserved; i++ {
-		ot, err := deserializeObservedTransaction(r)
-		if err != nil {
+		if err := binary.Read(r, binary.BigEndian, field); err != nil {
 			return nil, err
 		}
-		observed[i] = ot
-		ef.observed[ot.hash] = ot
-	}
-
-	// Read bins.
-	for i := 0; i < estimateFeeDepth; i++ {
-		var numTransactions uint32
-		binary.Read(r, binary.BigEndian, &numTransactions)
-		bin := make([]*observedTransaction, numTransactions)
-		for j := uint32(0); j < numTransactions; j++ {
-			var index uint32
-			binary.Read(r, binary.BigEndian, &index)
-
-			var exists bool
-			bin[j], exists = observed[index]
-			if !exists {
-				return nil, fmt.Errorf("Invalid transaction reference %d", index)
-			}
-		}
-		ef.bin[i] = bin
 	}
 
-	// Read dropped transactions.
-	var numDropped uint32
-	binary.Read(r, binary.BigEndian, &numDropped)
-	ef.dropped = make([]*registeredBlock, numDropped)
-	for i := uint32(0); i < numDropped; i++ {
-		var err error
-		ef.dropped[int(i)], err = deserializeRegisteredBlock(r, observed)
-		if err != nil {
-			return nil, err
+	// The fee rate buckets must match the current ones.
+	var numBuckets uint32
+	if err := binary.Read(r, binary.BigEndian, &numBuckets); err != nil {
+		return nil, err
+	}
+	if numBuckets != uint32(len(ef.buckets)) {
+		return nil, fmt.Errorf("mismatched number of fee rate buckets: "+
+			"expected %d found %d", len(ef.buckets), numBuckets)
+	}
+	buckets := make([]float64, numBuckets)
+	if err := binary.Read(r, binary.BigEndian, buckets); err != nil {
+		return nil, err
+	}
+	for i := range buckets {
+		if buckets[i] != ef.buckets[i] {
+			return nil, fmt.Errorf("mismatched fee rate bucket %d: "+
+				"expected %v found %v", i, ef.buckets[i],
+				buckets[i])
 		}
 	}
 
+	// Read the time horizons.
+	numBucketsInt := int(numBuckets)
+	ef.short, err = deserializeTxConfirmStats(r, numBucketsInt,
+		shortBlockPeriods, shortDecay, shortScale)
+	if err != nil {
+		return nil, err
+	}
+	ef.medium, err = deserializeTxConfirmStats(r, numBucketsInt,
+		medBlockPeriods, medDecay, medScale)
+	if err != nil {
+		return nil, err
+	}
+	ef.long, err = deserializeTxConfirmStats(r, numBucketsInt,
+		longBlockPeriods, longDecay, longScale)
+	if err != nil {
+		return nil, err
+	}
+
 	return ef, nil
 }
@@ -5,37 +5,14 @@
 package mempool
 
 import (
-	"bytes"
-	"math/rand"
+	"math"
 	"testing"
 
-	"github.com/ifishnet/hdfd/chaincfg/chainhash"
 	"github.com/ifishnet/hdfd/mining"
 	"github.com/ifishnet/hdfd/wire"
 	"github.com/ifishnet/hdfutil"
 )
 
-// newTestFeeEstimator creates a feeEstimator with some different parameters
-// for testing purposes.
-func newTestFeeEstimator(binSize, maxReplacements, maxRollback uint32) *FeeEstimator {
-	return &FeeEstimator{
-		maxRollback:         maxRollback,
-		lastKnownHeight:     0,
-		binSize:             int32(binSize),
-		minRegisteredBlocks: 0,
-		maxReplacements:     int32(maxReplacements),
-		observed:            make(map[chainhash.Hash]*observedTransaction),
-		dropped:             make([]*registeredBlock, 0, maxRollback),
-	}
-}
-
-// lastBlock is a linked list of the block hashes which have been
-// processed by the test FeeEstimator.
-type lastBlock struct {
-	hash *chainhash.Hash
-	prev *lastBlock
-}
-
 // estimateFeeTester interacts with the FeeEstimator to keep track
 // of its expected state.
 type estimateFeeTester struct {
@@ -43,9 +20,11 @@ type estimateFeeTester struct {
 	t       *testing.T
 	version int32
 	height  int32
-	last    *lastBlock
 }
 
+// testTx returns a transaction which pays the passed fee and entered the
+// mempool at the current height of the tester.  The transactions have a
+// virtual size of 10 bytes.
 func (eft *estimateFeeTester) testTx(fee hdfutil.Amount) *TxDesc {
 	eft.version++
 	return &TxDesc{
@@ -60,365 +39,229 @@ func (eft *estimateFeeTester) testTx(fee hdfutil.Amount) *TxDesc {
 	}
 }
 
-func expectedFeePerKilobyte(t *TxDesc) HdfPerKilobyte {
-	size := float64(t.TxDesc.Tx.MsgTx().SerializeSize())
-	fee := float64(t.TxDesc.Fee)
-
-	return SatoshiPerByte(fee / size).ToHdfPerKb()
-}
-
-func (eft *estimateFeeTester) newBlock(txs []*wire.MsgTx) {
+// newBlock registers a block with the passed transactions at the next height
+// with the fee estimator.
+func (eft *estimateFeeTester) newBlock(txs []*TxDesc) {
 	eft.height++
 
+	msgTxs := make([]*wire.MsgTx, 0, len(txs))
+	for _, txD := range txs {
+		msgTxs = append(msgTxs, txD.Tx.MsgTx())
+	}
 	block := hdfutil.NewBlock(&wire.MsgBlock{
-		Transactions: txs,
+		Transactions: msgTxs,
 	})
 	block.SetHeight(eft.height)
 
-	eft.last = &lastBlock{block.Hash(), eft.last}
-
 	eft.ef.RegisterBlock(block)
 }
 
-func (eft *estimateFeeTester) rollback() {
-	if eft.last == nil {
-		return
-	}
-
-	err := eft.ef.Rollback(eft.last.hash)
-
-	if err != nil {
-		eft.t.Errorf("Could not rollback: %v", err)
-	}
-
-	eft.height--
-	eft.last = eft.last.prev
-}
-
-// TestEstimateFee tests basic functionality in the FeeEstimator.
-func TestEstimateFee(t *testing.T) {
-	ef := newTestFeeEstimator(5, 3, 1)
-	eft := estimateFeeTester{ef: ef, t: t}
-
-	// Try with no txs and get zero for all queries.
-	expected := HdfPerKilobyte(0.0)
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
-
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f when estimator is empty; got %f", expected, estimated)
+// simulate observes the passed number of rounds of transactions paying a high
+// fee rate, which are always confirmed in the next block, and transactions
+// paying a low fee rate, which are never confirmed and are eventually removed
+// from the mempool.
+func (eft *estimateFeeTester) simulate(rounds int) {
+	const (
+		txnsPerRound   = 10
+		highFee        = 1000 // 100 satoshis per byte
+		lowFee         = 20   // 2 satoshis per byte
+		lowTxnLifetime = 5
+	)
+
+	var lowTxns [][]*TxDesc
+	for i := 0; i < rounds; i++ {
+		var high, low []*TxDesc
+		for j := 0; j < txnsPerRound; j++ {
+			high = append(high, eft.testTx(highFee))
+			low = append(low, eft.testTx(lowFee))
 		}
-	}
-
-	// Now insert a tx.
-	tx := eft.testTx(1000000)
-	ef.ObserveTransaction(tx)
-
-	// Expected should still be zero because this is still in the mempool.
-	expected = HdfPerKilobyte(0.0)
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
-
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f when estimator has one tx in mempool; got %f", expected, estimated)
+		for _, txD := range append(high, low...) {
+			eft.ef.ObserveTransaction(txD)
 		}
-	}
 
-	// Change minRegisteredBlocks to make sure that works. Error return
-	// value expected.
-	ef.minRegisteredBlocks = 1
-	expected = HdfPerKilobyte(-1.0)
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
-
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f before any blocks have been registered; got %f", expected, estimated)
+		// Remove the oldest low fee rate transactions from the
+		// mempool as they would be when it is full.
+		lowTxns = append(lowTxns, low)
+		if len(lowTxns) > lowTxnLifetime {
+			for _, txD := range lowTxns[0] {
+				eft.ef.RemoveTransaction(txD.Tx.Hash())
+			}
+			lowTxns = lowTxns[1:]
 		}
-	}
 
-	// Record a block with the new tx.
-	eft.newBlock([]*wire.MsgTx{tx.Tx.MsgTx()})
-	expected = expectedFeePerKilobyte(tx)
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
-
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f when one tx is binned; got %f", expected, estimated)
-		}
+		eft.newBlock(high)
 	}
+}
 
-	// Roll back the last block; this was an orphan block.
-	ef.minRegisteredBlocks = 0
-	eft.rollback()
-	expected = HdfPerKilobyte(0.0)
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
-
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f after rolling back block; got %f", expected, estimated)
-		}
-	}
+// TestEstimateSmartFee ensures the fee estimator provides the expected
+// estimates once enough transactions have been observed.
+func TestEstimateSmartFee(t *testing.T) {
+	t.Parallel()
 
-	// Record an empty block and then a block with the new tx.
-	// This test was made because of a bug that only appeared when there
-	// were no transactions in the first bin.
-	eft.newBlock([]*wire.MsgTx{})
-	eft.newBlock([]*wire.MsgTx{tx.Tx.MsgTx()})
-	expected = expectedFeePerKilobyte(tx)
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
+	eft := &estimateFeeTester{ef: NewFeeEstimator(), t: t}
+	ef := eft.ef
 
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f when one tx is binned; got %f", expected, estimated)
-		}
+	// Ensure there are no estimates before any blocks are observed.
+	if _, _, err := ef.EstimateSmartFee(2, false); err == nil {
+		t.Fatal("EstimateSmartFee: provided estimate without data")
 	}
-
-	// Create some more transactions.
-	txA := eft.testTx(500000)
-	txB := eft.testTx(2000000)
-	txC := eft.testTx(4000000)
-	ef.ObserveTransaction(txA)
-	ef.ObserveTransaction(txB)
-	ef.ObserveTransaction(txC)
-
-	// Record 7 empty blocks.
-	for i := 0; i < 7; i++ {
-		eft.newBlock([]*wire.MsgTx{})
+	if estimated, err := ef.EstimateFee(1); err != nil || estimated != -1 {
+		t.Fatalf("EstimateFee: unexpected estimate without data -- "+
+			"got %v (err %v), want -1", estimated, err)
 	}
 
-	// Mine the first tx.
-	eft.newBlock([]*wire.MsgTx{txA.Tx.MsgTx()})
-
-	// Now the estimated amount should depend on the value
-	// of the argument to estimate fee.
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
-		if i > 2 {
-			expected = expectedFeePerKilobyte(txA)
-		} else {
-			expected = expectedFeePerKilobyte(tx)
-		}
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f on round %d; got %f", expected, i, estimated)
-		}
+	// Transactions are only tracked once a block has been registered.
+	ef.ObserveTransaction(eft.testTx(1000))
+	if len(ef.observed) != 0 {
+		t.Fatal("ObserveTransaction: tracked transaction before any " +
+			"block was registered")
 	}
-
-	// Record 5 more empty blocks.
-	for i := 0; i < 5; i++ {
-		eft.newBlock([]*wire.MsgTx{})
+	eft.newBlock(nil)
+
+	// Observe enough blocks for the estimates of all tested targets.
+	const rounds = 100
+	eft.simulate(rounds)
+
+	// All transactions paying the high fee rate were confirmed in the next
+	// block while all transactions paying the low fee rate failed to be
+	// confirmed, so the estimates must be the high fee rate.
+	wantFeeRate := SatoshiPerByte(100).ToHdfPerKb()
+	tests := []struct {
+		target     uint32
+		wantBlocks uint32
+	}{
+		{target: 1, wantBlocks: 2},
+		{target: 2, wantBlocks: 2},
+		{target: 6, wantBlocks: 6},
+		{target: 24, wantBlocks: 24},
+		{target: 1008, wantBlocks: (rounds - 1) / 2},
 	}
-
-	// Mine the next tx.
-	eft.newBlock([]*wire.MsgTx{txB.Tx.MsgTx()})
-
-	// Now the estimated amount should depend on the value
-	// of the argument to estimate fee.
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
-		if i <= 2 {
-			expected = expectedFeePerKilobyte(txB)
-		} else if i <= 8 {
-			expected = expectedFeePerKilobyte(tx)
-		} else {
-			expected = expectedFeePerKilobyte(txA)
-		}
-
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f on round %d; got %f", expected, i, estimated)
+	for _, test := range tests {
+		for _, conservative := range []bool{false, true} {
+			estimated, blocks, err := ef.EstimateSmartFee(test.target,
+				conservative)
+			if err != nil {
+				t.Fatalf("EstimateSmartFee(%d, %v): unexpected "+
+					"error: %v", test.target, conservative, err)
+			}
+			if blocks != test.wantBlocks {
+				t.Fatalf("EstimateSmartFee(%d, %v): unexpected "+
+					"target -- got %d, want %d", test.target,
+					conservative, blocks, test.wantBlocks)
+			}
+			if math.Abs(float64(estimated-wantFeeRate)) > 1e-9 {
+				t.Fatalf("EstimateSmartFee(%d, %v): unexpected "+
+					"estimate -- got %v, want %v", test.target,
+					conservative, estimated, wantFeeRate)
+			}
 		}
 	}
 
-	// Record 9 more empty blocks.
-	for i := 0; i < 10; i++ {
-		eft.newBlock([]*wire.MsgTx{})
+	// Ensure the legacy estimates agree.
+	estimated, err := ef.EstimateFee(1)
+	if err != nil {
+		t.Fatalf("EstimateFee: unexpected error: %v", err)
 	}
-
-	// Mine txC.
-	eft.newBlock([]*wire.MsgTx{txC.Tx.MsgTx()})
-
-	// This should have no effect on the outcome because too
-	// many blocks have been mined for txC to be recorded.
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
-		if i <= 2 {
-			expected = expectedFeePerKilobyte(txC)
-		} else if i <= 8 {
-			expected = expectedFeePerKilobyte(txB)
-		} else if i <= 8+6 {
-			expected = expectedFeePerKilobyte(tx)
-		} else {
-			expected = expectedFeePerKilobyte(txA)
-		}
-
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f on round %d; got %f", expected, i, estimated)
-		}
+	if math.Abs(float64(estimated-wantFeeRate)) > 1e-9 {
+		t.Fatalf("EstimateFee: unexpected estimate -- got %v, want %v",
+			estimated, wantFeeRate)
 	}
-}
-
-func (eft *estimateFeeTester) estimates() [estimateFeeDepth]HdfPerKilobyte {
-
-	// Generate estimates
-	var estimates [estimateFeeDepth]HdfPerKilobyte
-	for i := 0; i < estimateFeeDepth; i++ {
-		estimates[i], _ = eft.ef.EstimateFee(uint32(i + 1))
+	if _, err := ef.EstimateFee(medBlockPeriods*medScale + 1); err == nil {
+		t.Fatal("EstimateFee: provided estimate for target beyond the " +
+			"medium time horizon")
 	}
 
-	// Check that all estimated fee results go in descending order.
-	for i := 1; i < estimateFeeDepth; i++ {
-		if estimates[i] > estimates[i-1] {
-			eft.t.Error("Estimates not in descending order; got ",
-				estimates[i], " for estimate ", i, " and ", estimates[i-1], " for ", (i - 1))
-			panic("invalid state.")
-		}
+	// Ensure removed and confirmed transactions are no longer tracked.
+	if len(ef.observed) > 5*10 {
+		t.Fatalf("unexpected number of tracked transactions %d",
+			len(ef.observed))
 	}
-
-	return estimates
 }
 
-func (eft *estimateFeeTester) round(txHistory [][]*TxDesc,
-	estimateHistory [][estimateFeeDepth]HdfPerKilobyte,
-	txPerRound, txPerBlock uint32) ([][]*TxDesc, [][estimateFeeDepth]HdfPerKilobyte) {
+// TestEstimateFeeReorg ensures blocks at or below the height of the last
+// registered block are ignored so transactions are not counted twice.
+func TestEstimateFeeReorg(t *testing.T) {
+	t.Parallel()
 
-	// generate new txs.
-	var newTxs []*TxDesc
-	for i := uint32(0); i < txPerRound; i++ {
-		newTx := eft.testTx(hdfutil.Amount(rand.Intn(1000000)))
-		eft.ef.ObserveTransaction(newTx)
-		newTxs = append(newTxs, newTx)
-	}
+	eft := &estimateFeeTester{ef: NewFeeEstimator(), t: t}
+	eft.newBlock(nil)
+	txD := eft.testTx(1000)
+	eft.ef.ObserveTransaction(txD)
 
-	// Generate mempool.
-	mempool := make(map[*observedTransaction]*TxDesc)
-	for _, h := range txHistory {
-		for _, t := range h {
-			if o, exists := eft.ef.observed[*t.Tx.Hash()]; exists && o.mined == mining.UnminedHeight {
-				mempool[o] = t
-			}
-		}
+	// Register a block at the same height, as happens when a block is
+	// replaced during a reorganization, and ensure the transaction is still
+	// tracked as unconfirmed.
+	eft.height--
+	eft.newBlock([]*TxDesc{txD})
+	if _, ok := eft.ef.observed[*txD.Tx.Hash()]; !ok {
+		t.Fatal("RegisterBlock: replacement block confirmed transaction")
 	}
-
-	// generate new block, with no duplicates.
-	i := uint32(0)
-	newBlockList := make([]*wire.MsgTx, 0, txPerBlock)
-	for _, t := range mempool {
-		newBlockList = append(newBlockList, t.TxDesc.Tx.MsgTx())
-		i++
-
-		if i == txPerBlock {
-			break
-		}
+	if eft.ef.short.txCtAvg[eft.ef.bucketIndex(100)] != 0 {
+		t.Fatal("RegisterBlock: replacement block recorded confirmation")
 	}
 
-	// Register a new block.
-	eft.newBlock(newBlockList)
-
-	// return results.
-	estimates := eft.estimates()
-
-	// Return results
-	return append(txHistory, newTxs), append(estimateHistory, estimates)
-}
-
-// TestEstimateFeeRollback tests the rollback function, which undoes the
-// effect of a adding a new block.
-func TestEstimateFeeRollback(t *testing.T) {
-	txPerRound := uint32(7)
-	txPerBlock := uint32(5)
-	binSize := uint32(6)
-	maxReplacements := uint32(4)
-	stepsBack := 2
-	rounds := 30
-
-	eft := estimateFeeTester{ef: newTestFeeEstimator(binSize, maxReplacements, uint32(stepsBack)), t: t}
-	var txHistory [][]*TxDesc
-	estimateHistory := [][estimateFeeDepth]HdfPerKilobyte{eft.estimates()}
-
-	for round := 0; round < rounds; round++ {
-		// Go forward a few rounds.
-		for step := 0; step <= stepsBack; step++ {
-			txHistory, estimateHistory =
-				eft.round(txHistory, estimateHistory, txPerRound, txPerBlock)
-		}
-
-		// Now go back.
-		for step := 0; step < stepsBack; step++ {
-			eft.rollback()
-
-			// After rolling back, we should have the same estimated
-			// fees as before.
-			expected := estimateHistory[len(estimateHistory)-step-2]
-			estimates := eft.estimates()
-
-			// Ensure that these are both the same.
-			for i := 0; i < estimateFeeDepth; i++ {
-				if expected[i] != estimates[i] {
-					t.Errorf("Rollback value mismatch. Expected %f, got %f. ",
-						expected[i], estimates[i])
-					return
-				}
-			}
-		}
-
-		// Erase history.
-		txHistory = txHistory[0 : len(txHistory)-stepsBack]
-		estimateHistory = estimateHistory[0 : len(estimateHistory)-stepsBack]
+	// Ensure the transaction is confirmed by the next block.
+	eft.newBlock([]*TxDesc{txD})
+	if _, ok := eft.ef.observed[*txD.Tx.Hash()]; ok {
+		t.Fatal("RegisterBlock: transaction still tracked after " +
+			"confirmation")
 	}
 }
 
-func (eft *estimateFeeTester) checkSaveAndRestore(
-	previousEstimates [estimateFeeDepth]HdfPerKilobyte) {
+// TestDatabase ensures the fee estimator is restored with the same estimates
+// it was saved with and that invalid saved states are rejected.
+func TestDatabase(t *testing.T) {
+	t.Parallel()
 
-	// Get the save state.
-	save := eft.ef.Save()
+	eft := &estimateFeeTester{ef: NewFeeEstimator(), t: t}
+	eft.newBlock(nil)
+	eft.simulate(50)
 
-	// Save and restore database.
-	var err error
-	eft.ef, err = RestoreFeeEstimator(save)
+	saved := eft.ef.Save()
+	restored, err := RestoreFeeEstimator(saved)
 	if err != nil {
-		eft.t.Fatalf("Could not restore database: %s", err)
+		t.Fatalf("RestoreFeeEstimator: unexpected error: %v", err)
 	}
-
-	// Save again and check that it matches the previous one.
-	redo := eft.ef.Save()
-	if !bytes.Equal(save, redo) {
-		eft.t.Fatalf("Restored states do not match: %v %v", save, redo)
+	if got, want := restored.LastKnownHeight(), eft.ef.LastKnownHeight(); got != want {
+		t.Fatalf("unexpected last known height -- got %d, want %d",
+			got, want)
 	}
 
-	// Check that the results match.
-	newEstimates := eft.estimates()
-
-	for i, prev := range previousEstimates {
-		if prev != newEstimates[i] {
-			eft.t.Error("Mismatch in estimate ", i, " after restore; got ", newEstimates[i], " but expected ", prev)
+	// The restored estimator must provide the same estimates based on the
+	// span of blocks observed by the saved one.
+	for _, target := range []uint32{2, 6, 12, 24, 48} {
+		for _, conservative := range []bool{false, true} {
+			want, wantBlocks, wantErr := eft.ef.EstimateSmartFee(
+				target, conservative)
+			got, gotBlocks, gotErr := restored.EstimateSmartFee(
+				target, conservative)
+			if got != want || gotBlocks != wantBlocks ||
+				(gotErr == nil) != (wantErr == nil) {
+
+				t.Fatalf("EstimateSmartFee(%d, %v): mismatched "+
+					"restored estimate -- got %v, %d, %v, "+
+					"want %v, %d, %v", target, conservative,
+					got, gotBlocks, gotErr, want, wantBlocks,
+					wantErr)
+			}
 		}
 	}
-}
-
-// TestSave tests saving and restoring to a []byte.
-func TestDatabase(t *testing.T) {
 
-	txPerRound := uint32(7)
-	txPerBlock := uint32(5)
-	binSize := uint32(6)
-	maxReplacements := uint32(4)
-	rounds := 8
-
-	eft := estimateFeeTester{ef: newTestFeeEstimator(binSize, maxReplacements, uint32(rounds)+1), t: t}
-	var txHistory [][]*TxDesc
-	estimateHistory := [][estimateFeeDepth]HdfPerKilobyte{eft.estimates()}
-
-	for round := 0; round < rounds; round++ {
-		eft.checkSaveAndRestore(estimateHistory[len(estimateHistory)-1])
-
-		// Go forward one step.
-		txHistory, estimateHistory =
-			eft.round(txHistory, estimateHistory, txPerRound, txPerBlock)
+	// Saving the restored estimator must result in the same state.
+	if resaved := restored.Save(); string(resaved) != string(saved) {
+		t.Fatal("Save: restored estimator saved a different state")
 	}
 
-	// Reverse the process and try again.
-	for round := 1; round <= rounds; round++ {
-		eft.rollback()
-		eft.checkSaveAndRestore(estimateHistory[len(estimateHistory)-round-1])
+	// Ensure invalid states are rejected.
+	invalid := []FeeEstimatorState{
+		{0x00, 0x00, 0x00, 0x01},
+		saved[:len(saved)-1],
+		saved[:4],
+	}
+	for i, state := range invalid {
+		if _, err := RestoreFeeEstimator(state); err == nil {
+			t.Fatalf("RestoreFeeEstimator #%d: restored invalid "+
+				"state", i)
+		}
 	}
 }
@@ -39,6 +39,11 @@ const (
 	// scans of the orphan pool to evict expired transactions.
 	orphanExpireScanInterval = time.Minute * 5
 
+	// DefaultMaxOrphanBytesPerTag is the default maximum total size in
+	// bytes of the orphan transactions with the same tag, which is
+	// typically the ID of the peer that relayed them.
+	DefaultMaxOrphanBytesPerTag = 1000000
+
 	// MaxRBFSequence is the maximum sequence number an input can use to
 	// signal that the transaction spending it can be replaced using the
 	// Replace-By-Fee (RBF) policy.
@@ -48,6 +53,47 @@ const (
 	// can be evicted from the mempool when accepting a transaction
 	// replacement.
 	MaxReplacementEvictions = 100
+
+	// DefaultMaxAncestorCount is the default maximum number of unconfirmed
+	// transactions, including itself, a transaction in the mempool may
+	// depend on.
+	DefaultMaxAncestorCount = 25
+
+	// DefaultMaxAncestorSize is the default maximum total virtual size of a
+	// transaction in the mempool together with all of its unconfirmed
+	// ancestors.
+	DefaultMaxAncestorSize = 101000
+
+	// DefaultMaxDescendantCount is the default maximum number of
+	// unconfirmed transactions, including itself, that may depend on a
+	// transaction in the mempool.
+	DefaultMaxDescendantCount = 25
+
+	// DefaultMaxDescendantSize is the default maximum total virtual size of
+	// a transaction in the mempool together with all of its unconfirmed
+	// descendants.
+	DefaultMaxDescendantSize = 101000
+
+	// DefaultMaxPoolSize is the default maximum total virtual size of the
+	// transactions in the mempool.
+	DefaultMaxPoolSize = 300000000
+
+	// rollingFeeHalfLife is the time it takes for the minimum fee rate
+	// raised by evicting transactions from a full mempool to decay by half.
+	// It decays faster when the mempool is less than half full.
+	rollingFeeHalfLife = time.Hour * 12
+
+	// rollingFeeUpdateInterval is the minimum amount of time in between
+	// updates of the decaying minimum fee rate.
+	rollingFeeUpdateInterval = time.Second * 10
+
+	// DefaultMaxTxAge is the default maximum amount of time a transaction
+	// may stay in the mempool before it expires.
+	DefaultMaxTxAge = time.Hour * 336
+
+	// txExpireScanInterval is the minimum amount of time in between scans
+	// of the mempool to evict expired transactions.
+	txExpireScanInterval = time.Minute * 5
 )
 
 // Tag represents an identifier to use for tagging orphan transactions.  The
@@ -103,6 +149,16 @@ type Config struct {
 	// FeeEstimatator provides a feeEstimator. If it is not nil, the mempool
 	// records all new transactions it observes into the feeEstimator.
 	FeeEstimator *FeeEstimator
+
+	// OnTxReplaced, if not nil, is invoked for every transaction evicted
+	// from the pool because it, or one of its ancestors, was replaced by
+	// the passed replacement transaction through the Replace-By-Fee (RBF)
+	// policy.  It is invoked after the replacement has been added to the
+	// pool.
+	//
+	// NOTE: The callback is invoked with the mempool lock held, so it MUST
+	// NOT block or call back into the mempool.
+	OnTxReplaced func(replaced, replacement *hdfutil.Tx)
 }
 
 // Policy houses the policy (configuration parameters) which is used to
@@ -135,19 +191,110 @@ type Policy struct {
 	// of big orphans.
 	MaxOrphanTxSize int
 
+	// MaxOrphanBytesPerTag is the maximum total size in bytes of the
+	// orphan transactions with the same tag.  Since orphans are tagged
+	// with the ID of the peer that relayed them, this limits the space a
+	// single peer may use in the orphan pool.  Zero disables the limit.
+	MaxOrphanBytesPerTag int64
+
 	// MaxSigOpCostPerTx is the cumulative maximum cost of all the signature
 	// operations in a single transaction we will relay or mine.  It is a
 	// fraction of the max signature operations for a block.
 	MaxSigOpCostPerTx int
 
+	// BytesPerSigOp is the number of virtual bytes each unit of signature
+	// operation cost of a transaction is counted as when its virtual size
+	// is greater than the actual one.  The sigop-adjusted virtual size is
+	// used for all fee rate calculations and limits.  Zero disables the
+	// adjustment.
+	BytesPerSigOp int
+
 	// MinRelayTxFee defines the minimum transaction fee in BTC/kB to be
 	// considered a non-zero fee.
 	MinRelayTxFee hdfutil.Amount
 
-	// RejectReplacement, if true, rejects accepting replacement
-	// transactions using the Replace-By-Fee (RBF) signaling policy into
-	// the mempool.
-	RejectReplacement bool
+	// MaxDataCarrierSize is the maximum total number of bytes of data a
+	// null data output may carry to be considered standard.  A value of
+	// zero only allows null data outputs which do not carry any data.
+	MaxDataCarrierSize int
+
+	// AcceptReplacement, if true, accepts replacement transactions using
+	// the Replace-By-Fee (RBF) signaling policy into the mempool.
+	// Transactions which spend outputs already spent by transactions in
+	// the mempool are rejected otherwise.
+	AcceptReplacement bool
+
+	// MaxRejectedTxs is the maximum number of recently rejected
+	// transactions to remember so they are not validated again when they
+	// are announced repeatedly.  Zero disables the rejection cache.
+	MaxRejectedTxs int
+
+	// MaxAncestorCount is the maximum number of unconfirmed transactions,
+	// including itself, a transaction accepted to the mempool may depend
+	// on.  Zero disables the limit.
+	MaxAncestorCount int
+
+	// MaxAncestorSize is the maximum total virtual size of a transaction
+	// accepted to the mempool together with all of its unconfirmed
+	// ancestors.  Zero disables the limit.
+	MaxAncestorSize int64
+
+	// MaxDescendantCount is the maximum number of unconfirmed
+	// transactions, including itself, that may depend on any transaction
+	// in the mempool.  Zero disables the limit.
+	MaxDescendantCount int
+
+	// MaxDescendantSize is the maximum total virtual size of any
+	// transaction in the mempool together with all of its unconfirmed
+	// descendants.  Zero disables the limit.
+	MaxDescendantSize int64
+
+	// MaxPoolSize is the maximum total virtual size of the transactions in
+	// the mempool.  When it is exceeded, the transactions with the lowest
+	// fee rates, taking their descendants into account, are evicted and
+	// the minimum fee rate required to enter the mempool is raised above
+	// theirs.  Zero disables the limit.
+	MaxPoolSize int64
+
+	// MaxTxAge is the maximum amount of time a transaction may stay in the
+	// mempool.  Transactions which have been in the mempool for longer are
+	// evicted along with all of their descendants.  Zero disables expiry.
+	MaxTxAge time.Duration
+}
+
+// PackageStats houses aggregate statistics about a transaction in the mempool
+// together with either all of its unconfirmed ancestors or all of its
+// unconfirmed descendants.
+type PackageStats struct {
+	// Count is the number of transactions in the package, including the
+	// transaction itself.
+	Count int
+
+	// VSize is the total virtual size of the transactions in the package.
+	VSize int64
+
+	// Fees is the total fees, in satoshi, paid by the transactions in the
+	// package.
+	Fees int64
+}
+
+// add adds the passed statistics to the package statistics.
+func (s *PackageStats) add(other PackageStats) {
+	s.Count += other.Count
+	s.VSize += other.VSize
+	s.Fees += other.Fees
+}
+
+// sub removes the passed statistics from the package statistics.
+func (s *PackageStats) sub(other PackageStats) {
+	s.Count -= other.Count
+	s.VSize -= other.VSize
+	s.Fees -= other.Fees
+}
+
+// feeRate returns the fee rate of the package in satoshi per kilobyte.
+func (s *PackageStats) feeRate() float64 {
+	return float64(s.Fees) * 1000 / float64(s.VSize)
 }
 
 // TxDesc is a descriptor containing a transaction in the mempool along with
@@ -158,15 +305,22 @@ type TxDesc struct {
 	// StartingPriority is the priority of the transaction when it was added
 	// to the pool.
 	StartingPriority float64
+
+	// vsize is the virtual size of the transaction adjusted for its
+	// signature operations.  See GetSigOpAdjustedVirtualSize.
+	vsize int64
+
+	// ancestorStats and descendantStats are the aggregate statistics of
+	// the transaction together with all of its unconfirmed ancestors and
+	// descendants, respectively.  They are maintained by the mempool and
+	// must only be accessed with the mempool lock held.
+	ancestorStats   PackageStats
+	descendantStats PackageStats
 }
 
-// orphanTx is normal transaction that references an ancestor transaction
-// that is not yet available.  It also contains additional information related
-// to it such as an expiration time to help prevent caching the orphan forever.
-type orphanTx struct {
-	tx         *hdfutil.Tx
-	tag        Tag
-	expiration time.Time
+// stats returns the statistics of the transaction on its own.
+func (txD *TxDesc) stats() PackageStats {
+	return PackageStats{Count: 1, VSize: txD.vsize, Fees: txD.Fee}
 }
 
 // TxPool is used as a source of transactions that need to be mined into blocks
@@ -179,16 +333,24 @@ type TxPool struct {
 	mtx           sync.RWMutex
 	cfg           Config
 	pool          map[chainhash.Hash]*TxDesc
-	orphans       map[chainhash.Hash]*orphanTx
-	orphansByPrev map[wire.OutPoint]map[chainhash.Hash]*hdfutil.Tx
+	orphans       *orphanPool
 	outpoints     map[wire.OutPoint]*hdfutil.Tx
 	pennyTotal    float64 // exponentially decaying total for penny spends.
 	lastPennyUnix int64   // unix time of last ``penny spend''
+	rejected      *RejectionCache
+
+	// totalVSize is the total virtual size of the transactions in the
+	// pool.
+	totalVSize int64
 
-	// nextExpireScan is the time after which the orphan pool will be
-	// scanned in order to evict orphans.  This is NOT a hard deadline as
-	// the scan will only run when an orphan is added to the pool as opposed
-	// to on an unconditional timer.
+	// rollingMinFee is the minimum fee rate, in satoshi per kilobyte, that
+	// was raised by evicting transactions from the full pool.  It decays
+	// over time and is last updated at lastRollingFeeUpdate.
+	rollingMinFee        float64
+	lastRollingFeeUpdate time.Time
+
+	// nextExpireScan is the time after which the pool will be scanned for
+	// expired transactions.
 	nextExpireScan time.Time
 }
 
@@ -200,40 +362,7 @@ var _ mining.TxSource = (*TxPool)(nil)
 //
 // This function MUST be called with the mempool lock held (for writes).
 func (mp *TxPool) removeOrphan(tx *hdfutil.Tx, removeRedeemers bool) {
-	// Nothing to do if passed tx is not an orphan.
-	txHash := tx.Hash()
-	otx, exists := mp.orphans[*txHash]
-	if !exists {
-		return
-	}
-
-	// Remove the reference from the previous orphan index.
-	for _, txIn := range otx.tx.MsgTx().TxIn {
-		orphans, exists := mp.orphansByPrev[txIn.PreviousOutPoint]
-		if exists {
-			delete(orphans, *txHash)
-
-			// Remove the map entry altogether if there are no
-			// longer any orphans which depend on it.
-			if len(orphans) == 0 {
-				delete(mp.orphansByPrev, txIn.PreviousOutPoint)
-			}
-		}
-	}
-
-	// Remove any orphans that redeem outputs from this one if requested.
-	if removeRedeemers {
-		prevOut := wire.OutPoint{Hash: *txHash}
-		for txOutIdx := range tx.MsgTx().TxOut {
-			prevOut.Index = uint32(txOutIdx)
-			for _, orphan := range mp.orphansByPrev[prevOut] {
-				mp.removeOrphan(orphan, true)
-			}
-		}
-	}
-
-	// Remove the transaction from the orphan pool.
-	delete(mp.orphans, *txHash)
+	mp.orphans.remove(tx, removeRedeemers)
 }
 
 // RemoveOrphan removes the passed orphan transaction from the orphan pool and
@@ -251,128 +380,20 @@ func (mp *TxPool) RemoveOrphan(tx *hdfutil.Tx) {
 //
 // This function is safe for concurrent access.
 func (mp *TxPool) RemoveOrphansByTag(tag Tag) uint64 {
-	var numEvicted uint64
 	mp.mtx.Lock()
-	for _, otx := range mp.orphans {
-		if otx.tag == tag {
-			mp.removeOrphan(otx.tx, true)
-			numEvicted++
-		}
-	}
+	numEvicted := mp.orphans.removeByTag(tag)
 	mp.mtx.Unlock()
 	return numEvicted
 }
 
-// limitNumOrphans limits the number of orphan transactions by evicting a random
-// orphan if adding a new one would cause it to overflow the max allowed.
-//
-// This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) limitNumOrphans() error {
-	// Scan through the orphan pool and remove any expired orphans when it's
-	// time.  This is done for efficiency so the scan only happens
-	// periodically instead of on every orphan added to the pool.
-	if now := time.Now(); now.After(mp.nextExpireScan) {
-		origNumOrphans := len(mp.orphans)
-		for _, otx := range mp.orphans {
-			if now.After(otx.expiration) {
-				// Remove redeemers too because the missing
-				// parents are very unlikely to ever materialize
-				// since the orphan has already been around more
-				// than long enough for them to be delivered.
-				mp.removeOrphan(otx.tx, true)
-			}
-		}
-
-		// Set next expiration scan to occur after the scan interval.
-		mp.nextExpireScan = now.Add(orphanExpireScanInterval)
-
-		numOrphans := len(mp.orphans)
-		if numExpired := origNumOrphans - numOrphans; numExpired > 0 {
-			log.Debugf("Expired %d %s (remaining: %d)", numExpired,
-				pickNoun(numExpired, "orphan", "orphans"),
-				numOrphans)
-		}
-	}
-
-	// Nothing to do if adding another orphan will not cause the pool to
-	// exceed the limit.
-	if len(mp.orphans)+1 <= mp.cfg.Policy.MaxOrphanTxs {
-		return nil
-	}
-
-	// Remove a random entry from the map.  For most compilers, Go's
-	// range statement iterates starting at a random item although
-	// that is not 100% guaranteed by the spec.  The iteration order
-	// is not important here because an adversary would have to be
-	// able to pull off preimage attacks on the hashing function in
-	// order to target eviction of specific entries anyways.
-	for _, otx := range mp.orphans {
-		// Don't remove redeemers in the case of a random eviction since
-		// it is quite possible it might be needed again shortly.
-		mp.removeOrphan(otx.tx, false)
-		break
-	}
-
-	return nil
-}
-
-// addOrphan adds an orphan transaction to the orphan pool.
+// maybeAddOrphan potentially adds an orphan to the orphan pool along with the
+// hashes of its missing parents.
 //
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) addOrphan(tx *hdfutil.Tx, tag Tag) {
-	// Nothing to do if no orphans are allowed.
-	if mp.cfg.Policy.MaxOrphanTxs <= 0 {
-		return
-	}
-
-	// Limit the number orphan transactions to prevent memory exhaustion.
-	// This will periodically remove any expired orphans and evict a random
-	// orphan if space is still needed.
-	mp.limitNumOrphans()
-
-	mp.orphans[*tx.Hash()] = &orphanTx{
-		tx:         tx,
-		tag:        tag,
-		expiration: time.Now().Add(orphanTTL),
-	}
-	for _, txIn := range tx.MsgTx().TxIn {
-		if _, exists := mp.orphansByPrev[txIn.PreviousOutPoint]; !exists {
-			mp.orphansByPrev[txIn.PreviousOutPoint] =
-				make(map[chainhash.Hash]*hdfutil.Tx)
-		}
-		mp.orphansByPrev[txIn.PreviousOutPoint][*tx.Hash()] = tx
-	}
-
-	log.Debugf("Stored orphan transaction %v (total: %d)", tx.Hash(),
-		len(mp.orphans))
-}
+func (mp *TxPool) maybeAddOrphan(tx *hdfutil.Tx, tag Tag,
+	missingParents []*chainhash.Hash) error {
 
-// maybeAddOrphan potentially adds an orphan to the orphan pool.
-//
-// This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) maybeAddOrphan(tx *hdfutil.Tx, tag Tag) error {
-	// Ignore orphan transactions that are too large.  This helps avoid
-	// a memory exhaustion attack based on sending a lot of really large
-	// orphans.  In the case there is a valid transaction larger than this,
-	// it will ultimtely be rebroadcast after the parent transactions
-	// have been mined or otherwise received.
-	//
-	// Note that the number of orphan transactions in the orphan pool is
-	// also limited, so this equates to a maximum memory used of
-	// mp.cfg.Policy.MaxOrphanTxSize * mp.cfg.Policy.MaxOrphanTxs (which is ~5MB
-	// using the default values at the time this comment was written).
-	serializedLen := tx.MsgTx().SerializeSize()
-	if serializedLen > mp.cfg.Policy.MaxOrphanTxSize {
-		str := fmt.Sprintf("orphan transaction size of %d bytes is "+
-			"larger than max allowed size of %d bytes",
-			serializedLen, mp.cfg.Policy.MaxOrphanTxSize)
-		return txRuleError(wire.RejectNonstandard, str)
-	}
-
-	// Add the orphan if the none of the above disqualified it.
-	mp.addOrphan(tx, tag)
-
-	return nil
+	return mp.orphans.maybeAdd(tx, tag, missingParents)
 }
 
 // removeOrphanDoubleSpends removes all orphans which spend outputs spent by the
@@ -383,12 +404,7 @@ func (mp *TxPool) maybeAddOrphan(tx *hdfutil.Tx, tag Tag) error {
 //
 // This function MUST be called with the mempool lock held (for writes).
 func (mp *TxPool) removeOrphanDoubleSpends(tx *hdfutil.Tx) {
-	msgTx := tx.MsgTx()
-	for _, txIn := range msgTx.TxIn {
-		for _, orphan := range mp.orphansByPrev[txIn.PreviousOutPoint] {
-			mp.removeOrphan(orphan, true)
-		}
-	}
+	mp.orphans.removeDoubleSpends(tx)
 }
 
 // isTransactionInPool returns whether or not the passed transaction already
@@ -421,11 +437,7 @@ func (mp *TxPool) IsTransactionInPool(hash *chainhash.Hash) bool {
 //
 // This function MUST be called with the mempool lock held (for reads).
 func (mp *TxPool) isOrphanInPool(hash *chainhash.Hash) bool {
-	if _, exists := mp.orphans[*hash]; exists {
-		return true
-	}
-
-	return false
+	return mp.orphans.have(hash)
 }
 
 // IsOrphanInPool returns whether or not the passed transaction already exists
@@ -441,6 +453,20 @@ func (mp *TxPool) IsOrphanInPool(hash *chainhash.Hash) bool {
 	return inPool
 }
 
+// OrphanMissingParents returns the hashes of the parents of the passed orphan
+// transaction that were missing when it was added to the orphan pool.  It
+// returns nil when the transaction is not in the orphan pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) OrphanMissingParents(hash *chainhash.Hash) []*chainhash.Hash {
+	// Protect concurrent access.
+	mp.mtx.RLock()
+	parents := mp.orphans.missingParents(hash)
+	mp.mtx.RUnlock()
+
+	return parents
+}
+
 // haveTransaction returns whether or not the passed transaction already exists
 // in the main pool or in the orphan pool.
 //
@@ -491,6 +517,19 @@ func (mp *TxPool) removeTransaction(tx *hdfutil.Tx, removeRedeemers bool) {
 			delete(mp.outpoints, txIn.PreviousOutPoint)
 		}
 		delete(mp.pool, *txHash)
+		mp.totalVSize -= txDesc.vsize
+
+		// Inform the fee estimator the transaction left the pool.  The
+		// transactions included in blocks were already accounted for
+		// when the block was registered with it.
+		if mp.cfg.FeeEstimator != nil {
+			mp.cfg.FeeEstimator.RemoveTransaction(txHash)
+		}
+
+		// Remove the transaction from the package statistics of its
+		// remaining ancestors and descendants.
+		mp.updatePackageStats(txDesc, false)
+
 		atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
 	}
 }
@@ -530,10 +569,11 @@ func (mp *TxPool) RemoveDoubleSpends(tx *hdfutil.Tx) {
 
 // addTransaction adds the passed transaction to the memory pool.  It should
 // not be called directly as it doesn't perform any validation.  This is a
-// helper for maybeAcceptTransaction.
+// helper for maybeAcceptTransaction.  The passed virtual size is the
+// sigop-adjusted virtual size of the transaction.
 //
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *hdfutil.Tx, height int32, fee int64) *TxDesc {
+func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *hdfutil.Tx, height int32, fee, vsize int64) *TxDesc {
 	// Add the transaction to the pool and mark the referenced outpoints
 	// as spent by the pool.
 	txD := &TxDesc{
@@ -542,12 +582,20 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *hdfutil
 			Added:    time.Now(),
 			Height:   height,
 			Fee:      fee,
-			FeePerKB: fee * 1000 / GetTxVirtualSize(tx),
+			FeePerKB: fee * 1000 / vsize,
 		},
 		StartingPriority: mining.CalcPriority(tx.MsgTx(), utxoView, height),
+		vsize:            vsize,
 	}
 
+	// Add the transaction to the package statistics of its unconfirmed
+	// ancestors and descendants before it is added to the pool.
+	// Transactions which are added back to the pool from disconnected
+	// blocks may already have descendants in the pool.
+	mp.updatePackageStats(txD, true)
+
 	mp.pool[*tx.Hash()] = txD
+	mp.totalVSize += vsize
 	for _, txIn := range tx.MsgTx().TxIn {
 		mp.outpoints[txIn.PreviousOutPoint] = tx
 	}
@@ -559,21 +607,16 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *hdfutil
 		mp.cfg.AddrIndex.AddUnconfirmedTx(tx, utxoView)
 	}
 
-	// Record this tx for fee estimation if enabled.
-	if mp.cfg.FeeEstimator != nil {
-		mp.cfg.FeeEstimator.ObserveTransaction(txD)
-	}
-
 	return txD
 }
 
 // checkPoolDoubleSpend checks whether or not the passed transaction is
 // attempting to spend coins already spent by other transactions in the pool.
-// If it does, we'll check whether each of those transactions are signaling for
-// replacement. If just one of them isn't, an error is returned. Otherwise, a
-// boolean is returned signaling that the transaction is a replacement. Note it
-// does not check for double spends against transactions already in the main
-// chain.
+// If it does and the policy accepts replacements, we'll check whether each of
+// those transactions are signaling for replacement. If just one of them isn't,
+// an error is returned. Otherwise, a boolean is returned signaling that the
+// transaction is a replacement. Note it does not check for double spends
+// against transactions already in the main chain.
 //
 // This function MUST be called with the mempool lock held (for reads).
 func (mp *TxPool) checkPoolDoubleSpend(tx *hdfutil.Tx) (bool, error) {
@@ -586,7 +629,7 @@ func (mp *TxPool) checkPoolDoubleSpend(tx *hdfutil.Tx) (bool, error) {
 
 		// Reject the transaction if we don't accept replacement
 		// transactions or if it doesn't signal replacement.
-		if mp.cfg.Policy.RejectReplacement ||
+		if !mp.cfg.Policy.AcceptReplacement ||
 			!mp.signalsReplacement(conflict, nil) {
 			str := fmt.Sprintf("output %v already spent by "+
 				"transaction %v in the memory pool",
@@ -765,6 +808,313 @@ func (mp *TxPool) txConflicts(tx *hdfutil.Tx) map[chainhash.Hash]*hdfutil.Tx {
 	return conflicts
 }
 
+// packageAncestors returns the descriptors of all of the unconfirmed ancestors
+// of the passed transaction in the pool.  Unlike txAncestors, each ancestor is
+// only visited once, so the cost is linear in the number of ancestors.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) packageAncestors(tx *hdfutil.Tx) map[chainhash.Hash]*TxDesc {
+	ancestors := make(map[chainhash.Hash]*TxDesc)
+	stack := []*hdfutil.Tx{tx}
+	for len(stack) > 0 {
+		tx := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, txIn := range tx.MsgTx().TxIn {
+			parentHash := txIn.PreviousOutPoint.Hash
+			if _, ok := ancestors[parentHash]; ok {
+				continue
+			}
+			parent, ok := mp.pool[parentHash]
+			if !ok {
+				continue
+			}
+			ancestors[parentHash] = parent
+			stack = append(stack, parent.Tx)
+		}
+	}
+	return ancestors
+}
+
+// packageDescendants returns the descriptors of all of the unconfirmed
+// descendants of the passed transaction in the pool.  Unlike txDescendants,
+// each descendant is only visited once, so the cost is linear in the number of
+// descendants.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) packageDescendants(tx *hdfutil.Tx) map[chainhash.Hash]*TxDesc {
+	descendants := make(map[chainhash.Hash]*TxDesc)
+	stack := []*hdfutil.Tx{tx}
+	for len(stack) > 0 {
+		tx := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		op := wire.OutPoint{Hash: *tx.Hash()}
+		for i := range tx.MsgTx().TxOut {
+			op.Index = uint32(i)
+			child, ok := mp.outpoints[op]
+			if !ok {
+				continue
+			}
+			childHash := *child.Hash()
+			if _, ok := descendants[childHash]; ok {
+				continue
+			}
+			descendants[childHash] = mp.pool[childHash]
+			stack = append(stack, child)
+		}
+	}
+	return descendants
+}
+
+// updatePackageStats adds the passed transaction to, or removes it from, the
+// ancestor and descendant statistics of its unconfirmed ancestors and
+// descendants in the pool.  When the transaction is added, its own statistics
+// are initialized as well.
+//
+// The transaction must not be in the pool, that is, this must be called before
+// adding it or after removing it, so ancestors and descendants which are also
+// related through other transactions can be told apart.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) updatePackageStats(txD *TxDesc, add bool) {
+	update := func(s *PackageStats, other PackageStats) {
+		if add {
+			s.add(other)
+		} else {
+			s.sub(other)
+		}
+	}
+
+	ancestors := mp.packageAncestors(txD.Tx)
+	descendants := mp.packageDescendants(txD.Tx)
+	stats := txD.stats()
+	if add {
+		txD.ancestorStats = stats
+		for _, ancestor := range ancestors {
+			txD.ancestorStats.add(ancestor.stats())
+		}
+		txD.descendantStats = stats
+		for _, descendant := range descendants {
+			txD.descendantStats.add(descendant.stats())
+		}
+	}
+	for _, ancestor := range ancestors {
+		update(&ancestor.descendantStats, stats)
+	}
+	for _, descendant := range descendants {
+		update(&descendant.ancestorStats, stats)
+	}
+
+	// The ancestors of the transaction are ancestors of its descendants
+	// through it as well.  Such pairs are only related by the transaction
+	// unless there is another path between them, so this is only done
+	// for transactions which have both, such as those added back to the
+	// pool from disconnected blocks.
+	if len(ancestors) == 0 || len(descendants) == 0 {
+		return
+	}
+	for _, ancestor := range ancestors {
+		related := mp.packageDescendants(ancestor.Tx)
+		for hash, descendant := range descendants {
+			if _, ok := related[hash]; ok {
+				continue
+			}
+			update(&ancestor.descendantStats, descendant.stats())
+			update(&descendant.ancestorStats, ancestor.stats())
+		}
+	}
+}
+
+// checkPackageLimits ensures adding the passed transaction, which has the
+// passed virtual size, to the pool would neither exceed the ancestor limits
+// for the transaction nor the descendant limits for any of its unconfirmed
+// ancestors as defined by the mempool policy.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) checkPackageLimits(tx *hdfutil.Tx, vsize int64) error {
+	policy := &mp.cfg.Policy
+	ancestors := mp.packageAncestors(tx)
+	if policy.MaxAncestorCount > 0 &&
+		len(ancestors)+1 > policy.MaxAncestorCount {
+
+		str := fmt.Sprintf("transaction %v has too many unconfirmed "+
+			"ancestors: %d > %d", tx.Hash(), len(ancestors)+1,
+			policy.MaxAncestorCount)
+		return nonStandardError(wire.RejectNonstandard,
+			ReasonTooLongMempoolChain, str)
+	}
+
+	ancestorSize := vsize
+	for hash, ancestor := range ancestors {
+		ancestorSize += ancestor.vsize
+
+		if policy.MaxDescendantCount > 0 &&
+			ancestor.descendantStats.Count+1 > policy.MaxDescendantCount {
+
+			str := fmt.Sprintf("transaction %v would exceed the "+
+				"descendant limit of %d for unconfirmed "+
+				"ancestor %v", tx.Hash(),
+				policy.MaxDescendantCount, hash)
+			return nonStandardError(wire.RejectNonstandard,
+				ReasonTooLongMempoolChain, str)
+		}
+		if policy.MaxDescendantSize > 0 &&
+			ancestor.descendantStats.VSize+vsize > policy.MaxDescendantSize {
+
+			str := fmt.Sprintf("transaction %v would exceed the "+
+				"descendant size limit of %d for unconfirmed "+
+				"ancestor %v", tx.Hash(),
+				policy.MaxDescendantSize, hash)
+			return nonStandardError(wire.RejectNonstandard,
+				ReasonTooLongMempoolChain, str)
+		}
+	}
+	if policy.MaxAncestorSize > 0 && ancestorSize > policy.MaxAncestorSize {
+		str := fmt.Sprintf("transaction %v exceeds the ancestor size "+
+			"limit: %d > %d", tx.Hash(), ancestorSize,
+			policy.MaxAncestorSize)
+		return nonStandardError(wire.RejectNonstandard,
+			ReasonTooLongMempoolChain, str)
+	}
+
+	return nil
+}
+
+// rollingMinFeeRate returns the minimum fee rate, in satoshi per kilobyte, that
+// was raised by evicting transactions from the full pool after applying the
+// decay since it was last updated.  It is zero when no transactions were
+// evicted recently.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) rollingMinFeeRate() float64 {
+	if mp.rollingMinFee == 0 {
+		return 0
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(mp.lastRollingFeeUpdate)
+	if elapsed < rollingFeeUpdateInterval {
+		return mp.rollingMinFee
+	}
+
+	// Decay faster when the pool has plenty of room left since there is
+	// less reason to keep the fee rate raised.
+	halfLife := rollingFeeHalfLife
+	switch maxSize := mp.cfg.Policy.MaxPoolSize; {
+	case mp.totalVSize < maxSize/4:
+		halfLife /= 4
+	case mp.totalVSize < maxSize/2:
+		halfLife /= 2
+	}
+	mp.rollingMinFee /= math.Pow(2, elapsed.Seconds()/halfLife.Seconds())
+	mp.lastRollingFeeUpdate = now
+
+	// Stop requiring a raised fee rate once it is close enough to the
+	// minimum relay fee.
+	if mp.rollingMinFee < float64(mp.cfg.Policy.MinRelayTxFee)/2 {
+		mp.rollingMinFee = 0
+	}
+	return mp.rollingMinFee
+}
+
+// MinFeeRate returns the minimum fee rate, in satoshi per kilobyte, a
+// transaction currently must pay to be accepted to the mempool.  It is the
+// minimum relay fee unless transactions were recently evicted from the full
+// mempool, in which case it is raised above their fee rate and decays over
+// time.  It is suitable for announcing to peers via feefilter messages.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MinFeeRate() hdfutil.Amount {
+	mp.mtx.Lock()
+	minFee := hdfutil.Amount(mp.rollingMinFeeRate())
+	mp.mtx.Unlock()
+
+	if minFee < mp.cfg.Policy.MinRelayTxFee {
+		minFee = mp.cfg.Policy.MinRelayTxFee
+	}
+	return minFee
+}
+
+// trimToSize evicts the transactions with the lowest fee rates, taking their
+// descendants into account, along with all of their descendants from the pool
+// until the total virtual size of the transactions in the pool no longer
+// exceeds the maximum allowed by the mempool policy.  The rolling minimum fee
+// rate is raised above the fee rates of the evicted packages so transactions
+// which would be evicted again right away are rejected.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) trimToSize() {
+	maxSize := mp.cfg.Policy.MaxPoolSize
+	if maxSize <= 0 {
+		return
+	}
+
+	var numEvicted int
+	for mp.totalVSize > maxSize {
+		// Find the transaction whose package of descendants has the
+		// lowest fee rate.  Evicting it along with its descendants
+		// removes the transactions which are least likely to be
+		// mined.
+		var worst *TxDesc
+		var worstFeeRate float64
+		for _, txD := range mp.pool {
+			feeRate := txD.descendantStats.feeRate()
+			if worst == nil || feeRate < worstFeeRate {
+				worst, worstFeeRate = txD, feeRate
+			}
+		}
+
+		feeRate := worstFeeRate + float64(mp.cfg.Policy.MinRelayTxFee)
+		if feeRate > mp.rollingMinFee {
+			mp.rollingMinFee = feeRate
+			mp.lastRollingFeeUpdate = time.Now()
+		}
+
+		numEvicted += worst.descendantStats.Count
+		mp.removeTransaction(worst.Tx, true)
+	}
+
+	if numEvicted > 0 {
+		log.Debugf("Evicted %d %s from the full mempool (minimum fee "+
+			"rate: %v sat/kb)", numEvicted,
+			pickNoun(numEvicted, "transaction", "transactions"),
+			int64(mp.rollingMinFee))
+	}
+}
+
+// expire evicts the transactions which have been in the pool for longer than
+// the maximum transaction age allowed by the mempool policy along with all of
+// their descendants.  The pool is only scanned when the expire scan interval
+// has passed since the previous scan.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) expire() {
+	maxAge := mp.cfg.Policy.MaxTxAge
+	now := time.Now()
+	if maxAge <= 0 || now.Before(mp.nextExpireScan) {
+		return
+	}
+	mp.nextExpireScan = now.Add(txExpireScanInterval)
+
+	var expired []*hdfutil.Tx
+	cutoff := now.Add(-maxAge)
+	for _, txD := range mp.pool {
+		if txD.Added.Before(cutoff) {
+			expired = append(expired, txD.Tx)
+		}
+	}
+
+	origNumTxns := len(mp.pool)
+	for _, tx := range expired {
+		mp.removeTransaction(tx, true)
+	}
+
+	if numExpired := origNumTxns - len(mp.pool); numExpired > 0 {
+		log.Debugf("Expired %d %s (remaining: %d)", numExpired,
+			pickNoun(numExpired, "transaction", "transactions"),
+			len(mp.pool))
+	}
+}
+
 // CheckSpend checks whether the passed outpoint is already spent by a
 // transaction in the mempool. If that's the case the spending transaction will
 // be returned, if not nil will be returned.
@@ -825,14 +1175,55 @@ func (mp *TxPool) FetchTransaction(txHash *chainhash.Hash) (*hdfutil.Tx, error)
 	return nil, fmt.Errorf("transaction is not in the pool")
 }
 
+// AncestorStats returns the aggregate statistics of the transaction with the
+// passed hash together with all of its unconfirmed ancestors in the pool.  An
+// error is returned if the transaction is not in the pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) AncestorStats(txHash *chainhash.Hash) (PackageStats, error) {
+	mp.mtx.RLock()
+	txDesc, exists := mp.pool[*txHash]
+	var stats PackageStats
+	if exists {
+		stats = txDesc.ancestorStats
+	}
+	mp.mtx.RUnlock()
+
+	if !exists {
+		return PackageStats{}, fmt.Errorf("transaction is not in the pool")
+	}
+	return stats, nil
+}
+
+// DescendantStats returns the aggregate statistics of the transaction with the
+// passed hash together with all of its unconfirmed descendants in the pool.
+// An error is returned if the transaction is not in the pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) DescendantStats(txHash *chainhash.Hash) (PackageStats, error) {
+	mp.mtx.RLock()
+	txDesc, exists := mp.pool[*txHash]
+	var stats PackageStats
+	if exists {
+		stats = txDesc.descendantStats
+	}
+	mp.mtx.RUnlock()
+
+	if !exists {
+		return PackageStats{}, fmt.Errorf("transaction is not in the pool")
+	}
+	return stats, nil
+}
+
 // validateReplacement determines whether a transaction is deemed as a valid
 // replacement of all of its conflicts according to the RBF policy. If it is
 // valid, no error is returned. Otherwise, an error is returned indicating what
-// went wrong.
+// went wrong.  The passed size is the sigop-adjusted virtual size of the
+// transaction.
 //
 // This function MUST be called with the mempool lock held (for reads).
 func (mp *TxPool) validateReplacement(tx *hdfutil.Tx,
-	txFee int64) (map[chainhash.Hash]*hdfutil.Tx, error) {
+	txFee, txSize int64) (map[chainhash.Hash]*hdfutil.Tx, error) {
 
 	// First, we'll make sure the set of conflicting transactions doesn't
 	// exceed the maximum allowed.
@@ -865,7 +1256,6 @@ func (mp *TxPool) validateReplacement(tx *hdfutil.Tx,
 	// block. Requiring that the fee rate always be increased is also an
 	// easy-to-reason about way to prevent DoS attacks via replacements.
 	var (
-		txSize           = GetTxVirtualSize(tx)
 		txFeeRate        = txFee * 1000 / txSize
 		conflictsFee     int64
 		conflictsParents = make(map[chainhash.Hash]struct{})
@@ -923,8 +1313,14 @@ func (mp *TxPool) validateReplacement(tx *hdfutil.Tx,
 // MaybeAcceptTransaction.  See the comment for MaybeAcceptTransaction for
 // more details.
 //
+// When the in package flag is set, the transaction is accepted as part of a
+// package by AcceptPackage.  In that case the fee requirements are not enforced
+// since they apply to the package as a whole, replacements are rejected, the
+// transaction is not observed by the fee estimator, and the pool is not trimmed
+// so the caller is able to evaluate the entire package first.
+//
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) maybeAcceptTransaction(tx *hdfutil.Tx, isNew, rateLimit, rejectDupOrphans bool) ([]*chainhash.Hash, *TxDesc, error) {
+func (mp *TxPool) maybeAcceptTransaction(tx *hdfutil.Tx, isNew, rateLimit, rejectDupOrphans, inPackage bool) ([]*chainhash.Hash, *TxDesc, error) {
 	txHash := tx.Hash()
 
 	// If a transaction has witness data, and segwit isn't active yet, If
@@ -989,9 +1385,10 @@ func (mp *TxPool) maybeAcceptTransaction(tx *hdfutil.Tx, isNew, rateLimit, rejec
 	// Don't allow non-standard transactions if the network parameters
 	// forbid their acceptance.
 	if !mp.cfg.Policy.AcceptNonStd {
-		err = checkTransactionStandard(tx, nextBlockHeight,
+		err = CheckTransactionStandard(tx, nextBlockHeight,
 			medianTimePast, mp.cfg.Policy.MinRelayTxFee,
-			mp.cfg.Policy.MaxTxVersion)
+			mp.cfg.Policy.MaxTxVersion,
+			mp.cfg.Policy.MaxDataCarrierSize)
 		if err != nil {
 			// Attempt to extract a reject code from the error so
 			// it can be retained.  When not possible, fall back to
@@ -1002,7 +1399,8 @@ func (mp *TxPool) maybeAcceptTransaction(tx *hdfutil.Tx, isNew, rateLimit, rejec
 			}
 			str := fmt.Sprintf("transaction %v is not standard: %v",
 				txHash, err)
-			return nil, nil, txRuleError(rejectCode, str)
+			return nil, nil, nonStandardError(rejectCode,
+				extractRejectReason(err), str)
 		}
 	}
 
@@ -1019,6 +1417,12 @@ func (mp *TxPool) maybeAcceptTransaction(tx *hdfutil.Tx, isNew, rateLimit, rejec
 	if err != nil {
 		return nil, nil, err
 	}
+	if isReplacement && inPackage {
+		str := fmt.Sprintf("package transaction %v spends outputs "+
+			"already spent by transactions in the pool, which is "+
+			"not supported for packages", txHash)
+		return nil, nil, txRuleError(wire.RejectNonstandard, str)
+	}
 
 	// Fetch all of the unspent transaction outputs referenced by the inputs
 	// to this transaction.  This function also attempts to fetch the
@@ -1107,7 +1511,8 @@ func (mp *TxPool) maybeAcceptTransaction(tx *hdfutil.Tx, isNew, rateLimit, rejec
 			}
 			str := fmt.Sprintf("transaction %v has a non-standard "+
 				"input: %v", txHash, err)
-			return nil, nil, txRuleError(rejectCode, str)
+			return nil, nil, nonStandardError(rejectCode,
+				extractRejectReason(err), str)
 		}
 	}
 
@@ -1145,21 +1550,46 @@ func (mp *TxPool) maybeAcceptTransaction(tx *hdfutil.Tx, isNew, rateLimit, rejec
 	// which is more desirable.  Therefore, as long as the size of the
 	// transaction does not exceeed 1000 less than the reserved space for
 	// high-priority transactions, don't require a fee for it.
-	serializedSize := GetTxVirtualSize(tx)
+	//
+	// The size of transactions with many signature operations relative to
+	// their size is adjusted so they pay for the share of the signature
+	// operations of a block they use up.
+	serializedSize := GetSigOpAdjustedVirtualSize(tx, sigOpCost,
+		mp.cfg.Policy.BytesPerSigOp)
 	minFee := calcMinRequiredTxRelayFee(serializedSize,
 		mp.cfg.Policy.MinRelayTxFee)
-	if serializedSize >= (DefaultBlockPrioritySize-1000) && txFee < minFee {
+	if !inPackage && serializedSize >= (DefaultBlockPrioritySize-1000) &&
+		txFee < minFee {
+
 		str := fmt.Sprintf("transaction %v has %d fees which is under "+
 			"the required amount of %d", txHash, txFee,
 			minFee)
 		return nil, nil, txRuleError(wire.RejectInsufficientFee, str)
 	}
 
+	// Don't allow transactions with fees too low to stay in the pool when
+	// it is full.  The minimum fee rate is only raised above the minimum
+	// relay fee after transactions were evicted from the full pool, so
+	// free and low-fee transactions are accepted otherwise.
+	rollingMinFee := mp.rollingMinFeeRate()
+	if !inPackage && rollingMinFee > 0 {
+		reqFee := calcMinRequiredTxRelayFee(serializedSize,
+			hdfutil.Amount(rollingMinFee))
+		if txFee < reqFee {
+			str := fmt.Sprintf("transaction %v has %d fees which is "+
+				"under the required amount of %d for the full "+
+				"mempool", txHash, txFee, reqFee)
+			return nil, nil, txRuleError(wire.RejectInsufficientFee, str)
+		}
+	}
+
 	// Require that free transactions have sufficient priority to be mined
 	// in the next block.  Transactions which are being added back to the
 	// memory pool from blocks that have been disconnected during a reorg
 	// are exempted.
-	if isNew && !mp.cfg.Policy.DisableRelayPriority && txFee < minFee {
+	if isNew && !inPackage && !mp.cfg.Policy.DisableRelayPriority &&
+		txFee < minFee {
+
 		currentPriority := mining.CalcPriority(tx.MsgTx(), utxoView,
 			nextBlockHeight)
 		if currentPriority <= mining.MinHighPriority {
@@ -1172,7 +1602,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *hdfutil.Tx, isNew, rateLimit, rejec
 
 	// Free-to-relay transactions are rate limited here to prevent
 	// penny-flooding with tiny transactions as a form of attack.
-	if rateLimit && txFee < minFee {
+	if rateLimit && !inPackage && txFee < minFee {
 		nowUnix := time.Now().Unix()
 		// Decay passed data with an exponentially decaying ~10 minute
 		// window - matches bitcoind handling.
@@ -1194,11 +1624,20 @@ func (mp *TxPool) maybeAcceptTransaction(tx *hdfutil.Tx, isNew, rateLimit, rejec
 			mp.cfg.Policy.FreeTxRelayLimit*10*1000)
 	}
 
+	// Don't allow the transaction to create unconfirmed chains that exceed
+	// the package limits.  Note that any transactions the transaction
+	// replaces are still counted since they are only removed once it is
+	// accepted.
+	if err := mp.checkPackageLimits(tx, serializedSize); err != nil {
+		return nil, nil, err
+	}
+
 	// If the transaction has any conflicts and we've made it this far, then
 	// we're processing a potential replacement.
 	var conflicts map[chainhash.Hash]*hdfutil.Tx
 	if isReplacement {
-		conflicts, err = mp.validateReplacement(tx, txFee)
+		conflicts, err = mp.validateReplacement(tx, txFee,
+			serializedSize)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -1230,7 +1669,36 @@ func (mp *TxPool) maybeAcceptTransaction(tx *hdfutil.Tx, isNew, rateLimit, rejec
 		// this call as they'll be removed eventually.
 		mp.removeTransaction(conflict, false)
 	}
-	txD := mp.addTransaction(utxoView, tx, bestHeight, txFee)
+	txD := mp.addTransaction(utxoView, tx, bestHeight, txFee,
+		serializedSize)
+
+	// Record the transaction for fee estimation if enabled.  Package
+	// transactions are excluded since the fee rates of their parents do not
+	// reflect the fee rates they are confirmed at.
+	if mp.cfg.FeeEstimator != nil && !inPackage {
+		mp.cfg.FeeEstimator.ObserveTransaction(txD)
+	}
+
+	// Let the caller know about the transactions that were evicted by the
+	// replacement so it can notify any interested parties.
+	if mp.cfg.OnTxReplaced != nil {
+		for _, conflict := range conflicts {
+			mp.cfg.OnTxReplaced(conflict, tx)
+		}
+	}
+
+	// Evict the transactions with the lowest fee rates when the pool is
+	// full.  The transaction is rejected when it is among them.  Packages
+	// are trimmed by the caller once all of their transactions were added.
+	if inPackage {
+		return nil, txD, nil
+	}
+	mp.trimToSize()
+	if !mp.isTransactionInPool(txHash) {
+		str := fmt.Sprintf("transaction %v was evicted from the full "+
+			"mempool due to its low fee rate", txHash)
+		return nil, nil, txRuleError(wire.RejectInsufficientFee, str)
+	}
 
 	log.Debugf("Accepted transaction %v (pool size: %v)", txHash,
 		len(mp.pool))
@@ -1252,7 +1720,9 @@ func (mp *TxPool) maybeAcceptTransaction(tx *hdfutil.Tx, isNew, rateLimit, rejec
 func (mp *TxPool) MaybeAcceptTransaction(tx *hdfutil.Tx, isNew, rateLimit bool) ([]*chainhash.Hash, *TxDesc, error) {
 	// Protect concurrent access.
 	mp.mtx.Lock()
-	hashes, txD, err := mp.maybeAcceptTransaction(tx, isNew, rateLimit, true)
+	mp.expire()
+	hashes, txD, err := mp.maybeAcceptTransaction(tx, isNew, rateLimit,
+		true, false)
 	mp.mtx.Unlock()
 
 	return hashes, txD, err
@@ -1287,15 +1757,15 @@ func (mp *TxPool) processOrphans(acceptedTx *hdfutil.Tx) []*TxDesc {
 			//
 			// Skip to the next available output if there are none.
 			prevOut.Index = uint32(txOutIdx)
-			orphans, exists := mp.orphansByPrev[prevOut]
-			if !exists {
+			orphans := mp.orphans.redeemers(prevOut)
+			if len(orphans) == 0 {
 				continue
 			}
 
 			// Potentially accept an orphan into the tx pool.
 			for _, tx := range orphans {
 				missing, txD, err := mp.maybeAcceptTransaction(
-					tx, true, true, false)
+					tx, true, true, false, false)
 				if err != nil {
 					// The orphan is now invalid, so there
 					// is no way any other orphans which
@@ -1377,10 +1847,29 @@ func (mp *TxPool) ProcessTransaction(tx *hdfutil.Tx, allowOrphan, rateLimit bool
 	mp.mtx.Lock()
 	defer mp.mtx.Unlock()
 
+	// Periodically remove any expired transactions so they don't
+	// accumulate in pools which never fill up.
+	mp.expire()
+
+	// Avoid validating the transaction again when it was recently rejected.
+	// The witness hash is used so that a valid transaction can't be
+	// prevented from being accepted by relaying copies of it with invalid
+	// witness data.
+	wtxHash := tx.MsgTx().WitnessHash()
+	bestHeight := mp.cfg.BestHeight()
+	if rejected, ok := mp.rejected.Lookup(&wtxHash, bestHeight); ok {
+		log.Debugf("Rejecting recently rejected transaction %v",
+			tx.Hash())
+		str := fmt.Sprintf("transaction %v was recently rejected: %s",
+			tx.Hash(), rejected.Reason)
+		return nil, txRuleError(rejected.RejectCode, str)
+	}
+
 	// Potentially accept the transaction to the memory pool.
 	missingParents, txD, err := mp.maybeAcceptTransaction(tx, true, rateLimit,
-		true)
+		true, false)
 	if err != nil {
+		mp.maybeCacheRejection(&wtxHash, err, bestHeight)
 		return nil, err
 	}
 
@@ -1419,10 +1908,44 @@ func (mp *TxPool) ProcessTransaction(tx *hdfutil.Tx, allowOrphan, rateLimit bool
 	}
 
 	// Potentially add the orphan transaction to the orphan pool.
-	err = mp.maybeAddOrphan(tx, tag)
+	err = mp.maybeAddOrphan(tx, tag, missingParents)
 	return nil, err
 }
 
+// maybeCacheRejection adds the transaction with the provided witness hash to
+// the rejection cache when the passed error indicates that it was rejected for
+// a reason that will not change until the best chain does.  Duplicate
+// transactions and those that were rejected due to insufficient fees are not
+// cached since their acceptance may change at any time.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) maybeCacheRejection(wtxHash *chainhash.Hash, err error,
+	bestHeight int32) {
+
+	if _, ok := err.(RuleError); !ok {
+		return
+	}
+
+	code, found := extractRejectCode(err)
+	if !found {
+		return
+	}
+	switch code {
+	case wire.RejectDuplicate, wire.RejectInsufficientFee:
+		return
+	}
+
+	mp.rejected.Add(wtxHash, code, err.Error(), bestHeight)
+}
+
+// RejectionCache returns the cache of recently rejected transactions used by
+// the memory pool, which provides statistics such as the number of cache hits.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) RejectionCache() *RejectionCache {
+	return mp.rejected
+}
+
 // Count returns the number of transactions in the main pool.  It does not
 // include the orphan pool.
 //
@@ -1489,24 +2012,27 @@ func (mp *TxPool) MiningDescs() []*mining.TxDesc {
 }
 
 // RawMempoolVerbose returns all of the entries in the mempool as a fully
-// populated hdfjson result.
+// populated hdfjson result.  The result is built from a snapshot of the
+// mempool, so the mempool is not blocked while it is built.
 //
 // This function is safe for concurrent access.
 func (mp *TxPool) RawMempoolVerbose() map[string]*hdfjson.GetRawMempoolVerboseResult {
-	mp.mtx.RLock()
-	defer mp.mtx.RUnlock()
-
+	snapshot := mp.Snapshot()
 	result := make(map[string]*hdfjson.GetRawMempoolVerboseResult,
-		len(mp.pool))
+		snapshot.Count())
 	bestHeight := mp.cfg.BestHeight()
 
-	for _, desc := range mp.pool {
+	for _, hash := range snapshot.hashes {
+		entry := snapshot.entries[hash]
+
 		// Calculate the current priority based on the inputs to
 		// the transaction.  Use zero if one or more of the
-		// input transactions can't be found for some reason.
-		tx := desc.Tx
+		// input transactions can't be found for some reason.  The
+		// inputs which spend transactions in the pool don't add to the
+		// priority, so only the utxos in the main chain are needed.
+		tx := entry.Tx
 		var currentPriority float64
-		utxos, err := mp.fetchInputUtxos(tx)
+		utxos, err := mp.cfg.FetchUtxoView(tx)
 		if err == nil {
 			currentPriority = mining.CalcPriority(tx.MsgTx(), utxos,
 				bestHeight+1)
@@ -1514,29 +2040,85 @@ func (mp *TxPool) RawMempoolVerbose() map[string]*hdfjson.GetRawMempoolVerboseRe
 
 		mpd := &hdfjson.GetRawMempoolVerboseResult{
 			Size:             int32(tx.MsgTx().SerializeSize()),
-			Vsize:            int32(GetTxVirtualSize(tx)),
+			Vsize:            int32(entry.VSize),
 			Weight:           int32(blockchain.GetTransactionWeight(tx)),
-			Fee:              hdfutil.Amount(desc.Fee).ToHDF(),
-			Time:             desc.Added.Unix(),
-			Height:           int64(desc.Height),
-			StartingPriority: desc.StartingPriority,
+			Fee:              hdfutil.Amount(entry.Fee).ToHDF(),
+			Time:             entry.Added.Unix(),
+			Height:           int64(entry.Height),
+			StartingPriority: entry.StartingPriority,
 			CurrentPriority:  currentPriority,
-			Depends:          make([]string, 0),
+			Depends:          make([]string, 0, len(entry.Depends)),
 		}
-		for _, txIn := range tx.MsgTx().TxIn {
-			hash := &txIn.PreviousOutPoint.Hash
-			if mp.haveTransaction(hash) {
-				mpd.Depends = append(mpd.Depends,
-					hash.String())
-			}
+		for i := range entry.Depends {
+			mpd.Depends = append(mpd.Depends,
+				entry.Depends[i].String())
 		}
 
-		result[tx.Hash().String()] = mpd
+		result[hash.String()] = mpd
 	}
 
 	return result
 }
 
+// RawMempoolEntry returns information about the transaction with the passed
+// hash in the pool, including the statistics of its ancestor and descendant
+// packages, as returned by the getmempoolentry RPC.  An error is returned if
+// the transaction is not in the pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) RawMempoolEntry(txHash *chainhash.Hash) (*hdfjson.GetMempoolEntryResult, error) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	txD, exists := mp.pool[*txHash]
+	if !exists {
+		return nil, fmt.Errorf("transaction is not in the pool")
+	}
+
+	tx := txD.Tx
+	fee := hdfutil.Amount(txD.Fee).ToHDF()
+	ancestorFees := hdfutil.Amount(txD.ancestorStats.Fees).ToHDF()
+	descendantFees := hdfutil.Amount(txD.descendantStats.Fees).ToHDF()
+	entry := &hdfjson.GetMempoolEntryResult{
+		VSize:           int32(txD.vsize),
+		Size:            int32(tx.MsgTx().SerializeSize()),
+		Weight:          blockchain.GetTransactionWeight(tx),
+		Fee:             fee,
+		ModifiedFee:     fee,
+		Time:            txD.Added.Unix(),
+		Height:          int64(txD.Height),
+		DescendantCount: int64(txD.descendantStats.Count),
+		DescendantSize:  txD.descendantStats.VSize,
+		DescendantFees:  descendantFees,
+		AncestorCount:   int64(txD.ancestorStats.Count),
+		AncestorSize:    txD.ancestorStats.VSize,
+		AncestorFees:    ancestorFees,
+		WTxId:           tx.MsgTx().WitnessHash().String(),
+		Fees: hdfjson.MempoolFees{
+			Base:       fee,
+			Modified:   fee,
+			Ancestor:   ancestorFees,
+			Descendant: descendantFees,
+		},
+		Depends:           make([]string, 0),
+		BIP125Replaceable: mp.signalsReplacement(tx, nil),
+	}
+	seen := make(map[chainhash.Hash]struct{})
+	for _, txIn := range tx.MsgTx().TxIn {
+		parentHash := txIn.PreviousOutPoint.Hash
+		if _, ok := seen[parentHash]; ok {
+			continue
+		}
+		if _, ok := mp.pool[parentHash]; !ok {
+			continue
+		}
+		seen[parentHash] = struct{}{}
+		entry.Depends = append(entry.Depends, parentHash.String())
+	}
+
+	return entry, nil
+}
+
 // LastUpdated returns the last time a transaction was added to or removed from
 // the main pool.  It does not include the orphan pool.
 //
@@ -1548,12 +2130,14 @@ func (mp *TxPool) LastUpdated() time.Time {
 // New returns a new memory pool for validating and storing standalone
 // transactions until they are mined into a block.
 func New(cfg *Config) *TxPool {
-	return &TxPool{
-		cfg:            *cfg,
-		pool:           make(map[chainhash.Hash]*TxDesc),
-		orphans:        make(map[chainhash.Hash]*orphanTx),
-		orphansByPrev:  make(map[wire.OutPoint]map[chainhash.Hash]*hdfutil.Tx),
-		nextExpireScan: time.Now().Add(orphanExpireScanInterval),
-		outpoints:      make(map[wire.OutPoint]*hdfutil.Tx),
+	mp := &TxPool{
+		cfg:       *cfg,
+		pool:      make(map[chainhash.Hash]*TxDesc),
+		outpoints: make(map[wire.OutPoint]*hdfutil.Tx),
+		rejected:  NewRejectionCache(cfg.Policy.MaxRejectedTxs),
+
+		nextExpireScan: time.Now().Add(txExpireScanInterval),
 	}
+	mp.orphans = newOrphanPool(&mp.cfg.Policy)
+	return mp
 }
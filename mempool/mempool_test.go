@@ -323,7 +323,9 @@ func newPoolHarness(chainParams *chaincfg.Params) (*poolHarness, []spendableOutp
 				MaxOrphanTxSize:      1000,
 				MaxSigOpCostPerTx:    blockchain.MaxBlockSigOpsCost / 4,
 				MinRelayTxFee:        1000, // 1 Satoshi per byte
+				MaxDataCarrierSize:   txscript.MaxDataCarrierSize,
 				MaxTxVersion:         1,
+				AcceptReplacement:    true,
 			},
 			ChainParams:      chainParams,
 			FetchUtxoView:    chain.FetchUtxoView,
@@ -571,6 +573,66 @@ func TestOrphanReject(t *testing.T) {
 	}
 }
 
+// TestRecentlyRejected ensures transactions that were rejected are served from
+// the rejection cache until the best chain height changes.
+func TestRecentlyRejected(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	harness.txPool.rejected = NewRejectionCache(10)
+	cache := harness.txPool.RejectionCache()
+
+	// Create a transaction with a version that is not allowed by the
+	// mempool policy so it is rejected as nonstandard.
+	tx, err := harness.CreateSignedTx(outputs, 1, 1000, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	msgTx := tx.MsgTx().Copy()
+	msgTx.Version = harness.txPool.cfg.Policy.MaxTxVersion + 1
+	tx = hdfutil.NewTx(msgTx)
+
+	process := func(wantHits uint64) {
+		t.Helper()
+
+		_, err := harness.txPool.ProcessTransaction(tx, false, false, 0)
+		code, extracted := extractRejectCode(err)
+		if !extracted {
+			t.Fatalf("ProcessTransaction: failed to extract reject "+
+				"code from error %q", err)
+		}
+		if code != wire.RejectNonstandard {
+			t.Fatalf("ProcessTransaction: unexpected reject code "+
+				"-- got %v, want %v", code, wire.RejectNonstandard)
+		}
+		if hits := cache.Hits(); hits != wantHits {
+			t.Fatalf("unexpected rejection cache hits -- got %d, "+
+				"want %d", hits, wantHits)
+		}
+		if count := cache.Count(); count != 1 {
+			t.Fatalf("unexpected rejection cache count -- got %d, "+
+				"want 1", count)
+		}
+	}
+
+	// Ensure the first rejection is cached and the second one is served
+	// from the cache.
+	process(0)
+	process(1)
+
+	// Ensure the transaction is validated again once the best chain height
+	// changes.
+	harness.chain.SetHeight(harness.chain.BestHeight() + 1)
+	process(1)
+	if misses := cache.Misses(); misses != 2 {
+		t.Fatalf("unexpected rejection cache misses -- got %d, want 2",
+			misses)
+	}
+}
+
 // TestOrphanEviction ensures that exceeding the maximum number of orphans
 // evicts entries to make room for the new ones.
 func TestOrphanEviction(t *testing.T) {
@@ -862,6 +924,101 @@ func TestMultiInputOrphanDoubleSpend(t *testing.T) {
 	testPoolMembership(tc, doubleSpendTx, false, false)
 }
 
+// TestOrphanTagQuota ensures that the total size of the orphans with the same
+// tag is limited by evicting the oldest orphans with that tag, without affecting
+// the orphans with other tags, and that the missing parents of the orphans are
+// tracked.
+func TestOrphanTagQuota(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	// Create a transaction that fans out the spendable output provided by
+	// the harness into two outputs to root two chains of transactions
+	// with.  The first one is relayed by a peer that floods the orphan pool
+	// while the second one is relayed by a well-behaved peer.
+	fanOutTx, err := harness.CreateSignedTx(outputs, 2, 1000, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	floodTxns, err := harness.CreateTxChain(
+		txOutToSpendableOut(fanOutTx, 0), 6)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	otherTxns, err := harness.CreateTxChain(
+		txOutToSpendableOut(fanOutTx, 1), 3)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+
+	// Allow enough orphans so only the quota causes evictions and limit the
+	// orphans of a single tag to roughly two transactions.
+	const floodTag, otherTag = Tag(1), Tag(2)
+	maxTagBytes := int64(floodTxns[1].MsgTx().SerializeSize() +
+		floodTxns[2].MsgTx().SerializeSize())
+	harness.txPool.cfg.Policy.MaxOrphanTxs = 20
+	harness.txPool.cfg.Policy.MaxOrphanBytesPerTag = maxTagBytes
+
+	_, err = harness.txPool.ProcessTransaction(otherTxns[1], true, false,
+		otherTag)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid orphan %v",
+			err)
+	}
+	for _, tx := range floodTxns[1:] {
+		_, err := harness.txPool.ProcessTransaction(tx, true, false,
+			floodTag)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"orphan %v", err)
+		}
+
+		// The most recent orphan must always be kept.
+		testPoolMembership(tc, tx, true, false)
+	}
+
+	// Ensure the orphans of the flooding peer do not exceed the quota and
+	// that the orphan of the other peer was not evicted.
+	harness.txPool.mtx.RLock()
+	tagBytes := harness.txPool.orphans.tagBytes[floodTag]
+	harness.txPool.mtx.RUnlock()
+	if tagBytes > maxTagBytes {
+		t.Fatalf("orphans of tag %d use %d bytes which exceeds the "+
+			"quota of %d bytes", floodTag, tagBytes, maxTagBytes)
+	}
+	testPoolMembership(tc, otherTxns[1], true, false)
+
+	// Ensure the missing parents of the orphans are reported.
+	lastTx := floodTxns[len(floodTxns)-1]
+	parents := harness.txPool.OrphanMissingParents(lastTx.Hash())
+	wantParent := floodTxns[len(floodTxns)-2].Hash()
+	if len(parents) != 1 || *parents[0] != *wantParent {
+		t.Fatalf("OrphanMissingParents: unexpected parents -- got %v, "+
+			"want [%v]", parents, wantParent)
+	}
+	if parents := harness.txPool.OrphanMissingParents(
+		floodTxns[0].Hash()); parents != nil {
+
+		t.Fatalf("OrphanMissingParents: unexpected parents %v for "+
+			"transaction not in the orphan pool", parents)
+	}
+
+	// Ensure an orphan larger than the quota is rejected.
+	harness.txPool.cfg.Policy.MaxOrphanBytesPerTag = 10
+	_, err = harness.txPool.ProcessTransaction(otherTxns[2], true, false,
+		otherTag)
+	if err == nil {
+		t.Fatal("ProcessTransaction: accepted orphan larger than the " +
+			"quota")
+	}
+	testPoolMembership(tc, otherTxns[2], false, false)
+}
+
 // TestCheckSpend tests that CheckSpend returns the expected spends found in
 // the mempool.
 func TestCheckSpend(t *testing.T) {
@@ -1120,7 +1277,7 @@ func TestCheckPoolDoubleSpend(t *testing.T) {
 				// replacements. Even if we have a transaction
 				// that spends inputs that signal replacement,
 				// it should still be rejected.
-				ctx.harness.txPool.cfg.Policy.RejectReplacement = true
+				ctx.harness.txPool.cfg.Policy.AcceptReplacement = false
 
 				coinbase := ctx.addCoinbaseTx(1)
 
@@ -1452,6 +1609,359 @@ func TestAncestorsDescendants(t *testing.T) {
 	}
 }
 
+// TestPackageStats ensures the ancestor and descendant statistics of the
+// transactions in the mempool are tracked properly as transactions are added
+// to and removed from the pool.
+func TestPackageStats(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+
+	// We'll be creating the following chain of unconfirmed transactions,
+	// each paying a different fee:
+	//
+	//       B ----
+	//     /        \
+	//   A            E
+	//     \        /
+	//       C -- D
+	//
+	// where B and C spend A, D spends C, and E spends B and D.
+	a := ctx.addSignedTx(outputs[:1], 2, 1000, false, false)
+	b := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(a, 0)}, 1, 2000, false,
+		false,
+	)
+	c := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(a, 1)}, 1, 3000, false,
+		false,
+	)
+	d := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(c, 0)}, 1, 4000, false,
+		false,
+	)
+	e := ctx.addSignedTx([]spendableOutput{
+		txOutToSpendableOut(b, 0), txOutToSpendableOut(d, 0),
+	}, 1, 5000, false, false)
+
+	// stats returns the combined statistics of the passed transactions.
+	stats := func(txns ...*hdfutil.Tx) PackageStats {
+		var s PackageStats
+		for _, tx := range txns {
+			s.add(PackageStats{
+				Count: 1,
+				VSize: GetTxVirtualSize(tx),
+				Fees:  harness.txPool.pool[*tx.Hash()].Fee,
+			})
+		}
+		return s
+	}
+
+	// testStats ensures the ancestor and descendant statistics of the
+	// passed transaction match the expected ones.
+	testStats := func(tx *hdfutil.Tx, ancestors, descendants PackageStats) {
+		t.Helper()
+
+		gotAncestors, err := harness.txPool.AncestorStats(tx.Hash())
+		if err != nil {
+			t.Fatalf("AncestorStats: unexpected error: %v", err)
+		}
+		if gotAncestors != ancestors {
+			t.Fatalf("AncestorStats for %v: got %+v, want %+v",
+				tx.Hash(), gotAncestors, ancestors)
+		}
+		gotDescendants, err := harness.txPool.DescendantStats(tx.Hash())
+		if err != nil {
+			t.Fatalf("DescendantStats: unexpected error: %v", err)
+		}
+		if gotDescendants != descendants {
+			t.Fatalf("DescendantStats for %v: got %+v, want %+v",
+				tx.Hash(), gotDescendants, descendants)
+		}
+	}
+
+	testStats(a, stats(a), stats(a, b, c, d, e))
+	testStats(b, stats(a, b), stats(b, e))
+	testStats(c, stats(a, c), stats(c, d, e))
+	testStats(d, stats(a, c, d), stats(d, e))
+	testStats(e, stats(a, b, c, d, e), stats(e))
+
+	// The statistics should also be reported by the getmempoolentry
+	// result of the transactions.
+	entry, err := harness.txPool.RawMempoolEntry(d.Hash())
+	if err != nil {
+		t.Fatalf("RawMempoolEntry: unexpected error: %v", err)
+	}
+	if entry.AncestorCount != 3 || entry.AncestorSize != stats(a, c, d).VSize ||
+		entry.DescendantCount != 2 ||
+		entry.DescendantSize != stats(d, e).VSize {
+
+		t.Fatalf("RawMempoolEntry: unexpected package statistics %+v",
+			entry)
+	}
+	if len(entry.Depends) != 1 || entry.Depends[0] != c.Hash().String() {
+		t.Fatalf("RawMempoolEntry: unexpected depends %v", entry.Depends)
+	}
+
+	// Removing C without its redeemers should remove D from the descendant
+	// statistics of A while E remains a descendant of A through B.
+	harness.txPool.RemoveTransaction(c, false)
+	testStats(a, stats(a), stats(a, b, e))
+	testStats(b, stats(a, b), stats(b, e))
+	testStats(d, stats(d), stats(d, e))
+	testStats(e, stats(a, b, d, e), stats(e))
+
+	// Adding C back, as happens when the block it was included in is
+	// disconnected, should restore the statistics of the whole package.
+	_, err = harness.txPool.ProcessTransaction(c, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+	}
+	testStats(a, stats(a), stats(a, b, c, d, e))
+	testStats(b, stats(a, b), stats(b, e))
+	testStats(c, stats(a, c), stats(c, d, e))
+	testStats(d, stats(a, c, d), stats(d, e))
+	testStats(e, stats(a, b, c, d, e), stats(e))
+
+	// Removing E should remove it from the descendant statistics of all of
+	// its ancestors.
+	harness.txPool.RemoveTransaction(e, false)
+	testStats(a, stats(a), stats(a, b, c, d))
+	testStats(b, stats(a, b), stats(b))
+	testStats(c, stats(a, c), stats(c, d))
+	testStats(d, stats(a, c, d), stats(d))
+
+	// Removing A without its redeemers, as happens when it is included in
+	// a block, should remove it from the ancestor statistics of all of its
+	// descendants.
+	harness.txPool.RemoveTransaction(a, false)
+	testStats(b, stats(b), stats(b))
+	testStats(c, stats(c), stats(c, d))
+	testStats(d, stats(c, d), stats(d))
+
+	// Removing C along with its redeemers should leave only B.
+	harness.txPool.RemoveTransaction(c, true)
+	testStats(b, stats(b), stats(b))
+	if _, err := harness.txPool.AncestorStats(d.Hash()); err == nil {
+		t.Fatalf("AncestorStats: expected error for removed transaction")
+	}
+	if _, err := harness.txPool.DescendantStats(c.Hash()); err == nil {
+		t.Fatalf("DescendantStats: expected error for removed " +
+			"transaction")
+	}
+}
+
+// TestPackageLimits ensures transactions that would exceed the ancestor or
+// descendant package limits of the mempool policy are rejected.
+func TestPackageLimits(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		policy func(*Policy, int64)
+	}{
+		{
+			name: "ancestor count",
+			policy: func(p *Policy, _ int64) {
+				p.MaxAncestorCount = 3
+			},
+		},
+		{
+			name: "ancestor size",
+			policy: func(p *Policy, size int64) {
+				p.MaxAncestorSize = size
+			},
+		},
+		{
+			name: "descendant count",
+			policy: func(p *Policy, _ int64) {
+				p.MaxDescendantCount = 3
+			},
+		},
+		{
+			name: "descendant size",
+			policy: func(p *Policy, size int64) {
+				p.MaxDescendantSize = size
+			},
+		},
+	}
+
+	for _, test := range tests {
+		harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatalf("unable to create test pool: %v", err)
+		}
+
+		// Create a chain of four transactions and configure the limits
+		// to allow exactly the first three of them.
+		chain, err := harness.CreateTxChain(outputs[0], 4)
+		if err != nil {
+			t.Fatalf("unable to create transaction chain: %v", err)
+		}
+		var size int64
+		for _, tx := range chain[:3] {
+			size += GetTxVirtualSize(tx)
+		}
+		test.policy(&harness.txPool.cfg.Policy, size)
+
+		for i, tx := range chain[:3] {
+			_, err := harness.txPool.ProcessTransaction(tx, false,
+				false, 0)
+			if err != nil {
+				t.Fatalf("%s: ProcessTransaction #%d: unexpected "+
+					"error: %v", test.name, i, err)
+			}
+		}
+
+		_, err = harness.txPool.ProcessTransaction(chain[3], false,
+			false, 0)
+		if err == nil {
+			t.Fatalf("%s: ProcessTransaction: expected error",
+				test.name)
+		}
+		reason := extractRejectReason(err)
+		if reason != ReasonTooLongMempoolChain {
+			t.Fatalf("%s: unexpected reject reason: got %v, want %v",
+				test.name, reason, ReasonTooLongMempoolChain)
+		}
+		if harness.txPool.IsTransactionInPool(chain[3].Hash()) {
+			t.Fatalf("%s: transaction exceeding limits was "+
+				"accepted", test.name)
+		}
+	}
+}
+
+// TestTrimToSize ensures the transactions with the lowest fee rates, taking
+// their descendants into account, are evicted when the pool exceeds its maximum
+// size and that the minimum fee rate for new transactions is raised above them.
+func TestTrimToSize(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+	coinbase := ctx.addCoinbaseTx(4)
+
+	// Create three independent transactions paying increasing fees and a
+	// child paying a high fee for the transaction paying the lowest fee.
+	// The package of the lowest fee transaction and its child therefore has
+	// a higher fee rate than the transaction paying the middle fee.
+	createTx := func(output spendableOutput, fee hdfutil.Amount) *hdfutil.Tx {
+		tx, err := harness.CreateSignedTx([]spendableOutput{output}, 1,
+			fee, false)
+		if err != nil {
+			t.Fatalf("unable to create transaction: %v", err)
+		}
+		return tx
+	}
+	lowFeeTx := createTx(txOutToSpendableOut(coinbase, 0), 1000)
+	midFeeTx := createTx(txOutToSpendableOut(coinbase, 1), 2000)
+	highFeeTx := createTx(txOutToSpendableOut(coinbase, 2), 3000)
+	childTx := createTx(txOutToSpendableOut(lowFeeTx, 0), 10000)
+	for _, tx := range []*hdfutil.Tx{lowFeeTx, midFeeTx, highFeeTx, childTx} {
+		_, err := harness.txPool.ProcessTransaction(tx, false, false, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+		}
+	}
+	if minFee := harness.txPool.MinFeeRate(); minFee != 1000 {
+		t.Fatalf("MinFeeRate: got %v, want 1000 before eviction",
+			int64(minFee))
+	}
+
+	// Shrink the pool by a single byte and ensure only the transaction
+	// paying the middle fee is evicted.
+	harness.txPool.mtx.Lock()
+	harness.txPool.cfg.Policy.MaxPoolSize = harness.txPool.totalVSize - 1
+	harness.txPool.trimToSize()
+	harness.txPool.mtx.Unlock()
+	if harness.txPool.IsTransactionInPool(midFeeTx.Hash()) {
+		t.Fatal("transaction with the lowest package fee rate was not " +
+			"evicted")
+	}
+	for _, tx := range []*hdfutil.Tx{lowFeeTx, highFeeTx, childTx} {
+		if !harness.txPool.IsTransactionInPool(tx.Hash()) {
+			t.Fatalf("transaction %v was unexpectedly evicted",
+				tx.Hash())
+		}
+	}
+
+	// The minimum fee rate must be raised above the fee rate of the
+	// evicted transaction by the minimum relay fee.
+	wantMinFee := hdfutil.Amount(float64(2000)*1000/
+		float64(GetTxVirtualSize(midFeeTx)) + 1000)
+	if minFee := harness.txPool.MinFeeRate(); minFee != wantMinFee {
+		t.Fatalf("MinFeeRate: got %v, want %v", int64(minFee),
+			int64(wantMinFee))
+	}
+
+	// Transactions paying less than the raised minimum fee rate must be
+	// rejected even though they pay the minimum relay fee.
+	harness.txPool.cfg.Policy.MaxPoolSize = 0
+	tx := createTx(txOutToSpendableOut(coinbase, 3), 1000)
+	_, err = harness.txPool.ProcessTransaction(tx, false, false, 0)
+	if err == nil {
+		t.Fatal("ProcessTransaction: accepted transaction paying less " +
+			"than the minimum fee rate")
+	}
+	if code, _ := extractRejectCode(err); code != wire.RejectInsufficientFee {
+		t.Fatalf("ProcessTransaction: unexpected reject code: got %v, "+
+			"want %v", code, wire.RejectInsufficientFee)
+	}
+}
+
+// TestExpire ensures transactions which have been in the mempool for longer
+// than the maximum transaction age are evicted along with their descendants.
+func TestExpire(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+	coinbase := ctx.addCoinbaseTx(3)
+
+	parent := ctx.addSignedTx([]spendableOutput{
+		txOutToSpendableOut(coinbase, 0),
+	}, 1, 1000, false, false)
+	child := ctx.addSignedTx([]spendableOutput{
+		txOutToSpendableOut(parent, 0),
+	}, 1, 1000, false, false)
+	unrelated := ctx.addSignedTx([]spendableOutput{
+		txOutToSpendableOut(coinbase, 1),
+	}, 1, 1000, false, false)
+
+	// Make the parent transaction older than the maximum transaction age
+	// and ensure the pool isn't scanned before the scan interval passed.
+	mp := harness.txPool
+	mp.mtx.Lock()
+	mp.cfg.Policy.MaxTxAge = time.Hour
+	mp.pool[*parent.Hash()].Added = time.Now().Add(-time.Hour * 2)
+	mp.expire()
+	mp.mtx.Unlock()
+	testPoolMembership(ctx, parent, false, true)
+
+	// Ensure the parent is evicted along with its child once the pool is
+	// scanned while the unrelated transaction is kept.
+	mp.mtx.Lock()
+	mp.nextExpireScan = time.Now()
+	mp.mtx.Unlock()
+	tx := ctx.addSignedTx([]spendableOutput{
+		txOutToSpendableOut(coinbase, 2),
+	}, 1, 1000, false, false)
+	testPoolMembership(ctx, parent, false, false)
+	testPoolMembership(ctx, child, false, false)
+	testPoolMembership(ctx, unrelated, false, true)
+	testPoolMembership(ctx, tx, false, true)
+}
+
 // TestRBF tests the different cases required for a transaction to properly
 // replace its conflicts given that they all signal replacement.
 func TestRBF(t *testing.T) {
@@ -1498,7 +2008,7 @@ func TestRBF(t *testing.T) {
 			// allow accepting replacement transactions.
 			name: "reject replacement policy",
 			setup: func(ctx *testContext) (*hdfutil.Tx, []*hdfutil.Tx) {
-				ctx.harness.txPool.cfg.Policy.RejectReplacement = true
+				ctx.harness.txPool.cfg.Policy.AcceptReplacement = false
 
 				coinbase := ctx.addCoinbaseTx(1)
 
@@ -1765,6 +2275,13 @@ func TestRBF(t *testing.T) {
 			// transactions it replaces.
 			harness.txPool.cfg.Policy.DisableRelayPriority = false
 
+			// Track the transactions reported as replaced to ensure
+			// the callback is only invoked for the evicted ones.
+			replaced := make(map[chainhash.Hash]struct{})
+			harness.txPool.cfg.OnTxReplaced = func(tx, replacement *hdfutil.Tx) {
+				replaced[*tx.Hash()] = struct{}{}
+			}
+
 			// Each test includes a setup method, which will set up
 			// its required dependencies. The transaction returned
 			// is the intended replacement, which should replace the
@@ -1804,6 +2321,26 @@ func TestRBF(t *testing.T) {
 				testPoolMembership(ctx, tx, false, !valid)
 			}
 			testPoolMembership(ctx, replacementTx, false, valid)
+
+			// Only a valid replacement should have evicted the
+			// expected transactions.
+			wantReplaced := 0
+			if valid {
+				wantReplaced = len(replacedTxs)
+			}
+			if len(replaced) != wantReplaced {
+				ctx.t.Fatalf("expected %d replaced transactions, "+
+					"got %d", wantReplaced, len(replaced))
+			}
+			if valid {
+				for _, tx := range replacedTxs {
+					if _, ok := replaced[*tx.Hash()]; !ok {
+						ctx.t.Fatalf("transaction %v was "+
+							"not reported as replaced",
+							tx.Hash())
+					}
+				}
+			}
 		})
 		if !success {
 			break
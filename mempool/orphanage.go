@@ -0,0 +1,314 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/wire"
+	"github.com/ifishnet/hdfutil"
+)
+
+// orphanTx is normal transaction that references an ancestor transaction
+// that is not yet available.  It also contains additional information related
+// to it such as an expiration time to help prevent caching the orphan forever.
+type orphanTx struct {
+	tx             *hdfutil.Tx
+	tag            Tag
+	size           int64
+	missingParents []*chainhash.Hash
+	expiration     time.Time
+}
+
+// orphanPool houses the orphan transactions of the mempool and enforces the
+// limits of the mempool policy on them.  In addition to the total number of
+// orphans, the total size of the orphans with the same tag, which is typically
+// the ID of the peer that relayed them, is limited so a single peer is not able
+// to fill the pool with orphans that will never be accepted and thereby evict
+// the orphans relayed by other peers.
+//
+// The orphan pool is NOT safe for concurrent access.  It is protected by the
+// mempool lock.
+type orphanPool struct {
+	policy  *Policy
+	orphans map[chainhash.Hash]*orphanTx
+	byPrev  map[wire.OutPoint]map[chainhash.Hash]*hdfutil.Tx
+
+	// tagBytes is the total size of the orphans with each tag and
+	// totalBytes is the total size of all orphans.
+	tagBytes   map[Tag]int64
+	totalBytes int64
+
+	// rand is used to choose the orphans to evict when the pool is full.
+	rand *rand.Rand
+
+	// nextExpireScan is the time after which the orphan pool will be
+	// scanned in order to evict orphans.  This is NOT a hard deadline as
+	// the scan will only run when an orphan is added to the pool as opposed
+	// to on an unconditional timer.
+	nextExpireScan time.Time
+}
+
+// newOrphanPool returns a new empty orphan pool which enforces the limits of the
+// passed mempool policy.
+func newOrphanPool(policy *Policy) *orphanPool {
+	return &orphanPool{
+		policy:         policy,
+		orphans:        make(map[chainhash.Hash]*orphanTx),
+		byPrev:         make(map[wire.OutPoint]map[chainhash.Hash]*hdfutil.Tx),
+		tagBytes:       make(map[Tag]int64),
+		rand:           rand.New(rand.NewSource(time.Now().UnixNano())),
+		nextExpireScan: time.Now().Add(orphanExpireScanInterval),
+	}
+}
+
+// have returns whether or not the transaction with the passed hash is in the
+// orphan pool.
+func (op *orphanPool) have(hash *chainhash.Hash) bool {
+	_, exists := op.orphans[*hash]
+	return exists
+}
+
+// count returns the number of orphans in the pool.
+func (op *orphanPool) count() int {
+	return len(op.orphans)
+}
+
+// redeemers returns the orphans which spend the passed outpoint.
+func (op *orphanPool) redeemers(prevOut wire.OutPoint) map[chainhash.Hash]*hdfutil.Tx {
+	return op.byPrev[prevOut]
+}
+
+// missingParents returns the hashes of the parents of the orphan with the
+// passed hash that were missing when it was added to the pool.  It returns nil
+// when the transaction is not in the orphan pool.
+func (op *orphanPool) missingParents(hash *chainhash.Hash) []*chainhash.Hash {
+	otx, exists := op.orphans[*hash]
+	if !exists {
+		return nil
+	}
+	return otx.missingParents
+}
+
+// remove removes the passed orphan transaction from the orphan pool and its
+// indexes.  When the removeRedeemers flag is set, the orphans which spend its
+// outputs are removed recursively as well.
+func (op *orphanPool) remove(tx *hdfutil.Tx, removeRedeemers bool) {
+	// Nothing to do if passed tx is not an orphan.
+	txHash := tx.Hash()
+	otx, exists := op.orphans[*txHash]
+	if !exists {
+		return
+	}
+
+	// Remove the reference from the previous orphan index.
+	for _, txIn := range otx.tx.MsgTx().TxIn {
+		orphans, exists := op.byPrev[txIn.PreviousOutPoint]
+		if exists {
+			delete(orphans, *txHash)
+
+			// Remove the map entry altogether if there are no
+			// longer any orphans which depend on it.
+			if len(orphans) == 0 {
+				delete(op.byPrev, txIn.PreviousOutPoint)
+			}
+		}
+	}
+
+	// Remove any orphans that redeem outputs from this one if requested.
+	if removeRedeemers {
+		prevOut := wire.OutPoint{Hash: *txHash}
+		for txOutIdx := range tx.MsgTx().TxOut {
+			prevOut.Index = uint32(txOutIdx)
+			for _, orphan := range op.byPrev[prevOut] {
+				op.remove(orphan, true)
+			}
+		}
+	}
+
+	// Remove the transaction from the orphan pool and account for its size
+	// no longer being used by its tag.
+	delete(op.orphans, *txHash)
+	op.totalBytes -= otx.size
+	op.tagBytes[otx.tag] -= otx.size
+	if op.tagBytes[otx.tag] <= 0 {
+		delete(op.tagBytes, otx.tag)
+	}
+}
+
+// removeByTag removes all orphans tagged with the provided identifier along
+// with the orphans which spend their outputs.  It returns the number of orphans
+// tagged with the identifier that were removed.
+func (op *orphanPool) removeByTag(tag Tag) uint64 {
+	var numEvicted uint64
+	for _, otx := range op.orphans {
+		if otx.tag == tag {
+			op.remove(otx.tx, true)
+			numEvicted++
+		}
+	}
+	return numEvicted
+}
+
+// removeDoubleSpends removes all orphans which spend outputs spent by the
+// passed transaction from the orphan pool.  Removing those orphans then leads
+// to removing all orphans which rely on them, recursively.
+func (op *orphanPool) removeDoubleSpends(tx *hdfutil.Tx) {
+	for _, txIn := range tx.MsgTx().TxIn {
+		for _, orphan := range op.byPrev[txIn.PreviousOutPoint] {
+			op.remove(orphan, true)
+		}
+	}
+}
+
+// expire removes the orphans which have been in the pool for longer than
+// allowed when it is time to scan for them.  This is done for efficiency so the
+// scan only happens periodically instead of on every orphan added to the pool.
+func (op *orphanPool) expire() {
+	now := time.Now()
+	if !now.After(op.nextExpireScan) {
+		return
+	}
+
+	origNumOrphans := len(op.orphans)
+	for _, otx := range op.orphans {
+		if now.After(otx.expiration) {
+			// Remove redeemers too because the missing parents are
+			// very unlikely to ever materialize since the orphan
+			// has already been around more than long enough for
+			// them to be delivered.
+			op.remove(otx.tx, true)
+		}
+	}
+
+	// Set next expiration scan to occur after the scan interval.
+	op.nextExpireScan = now.Add(orphanExpireScanInterval)
+
+	numOrphans := len(op.orphans)
+	if numExpired := origNumOrphans - numOrphans; numExpired > 0 {
+		log.Debugf("Expired %d %s (remaining: %d)", numExpired,
+			pickNoun(numExpired, "orphan", "orphans"), numOrphans)
+	}
+}
+
+// limitTagBytes evicts the oldest orphans with the passed tag until adding an
+// orphan of the passed size with the tag no longer exceeds the maximum total
+// size of the orphans with the same tag.
+func (op *orphanPool) limitTagBytes(tag Tag, size int64) {
+	maxTagBytes := op.policy.MaxOrphanBytesPerTag
+	if maxTagBytes <= 0 {
+		return
+	}
+
+	for op.tagBytes[tag] > 0 && op.tagBytes[tag]+size > maxTagBytes {
+		var oldest *orphanTx
+		for _, otx := range op.orphans {
+			if otx.tag != tag {
+				continue
+			}
+			if oldest == nil || otx.expiration.Before(oldest.expiration) {
+				oldest = otx
+			}
+		}
+
+		// Don't remove redeemers since the orphans are only evicted
+		// to make room for the new one.
+		op.remove(oldest.tx, false)
+	}
+}
+
+// limitNumOrphans evicts random orphans until adding another one no longer
+// exceeds the maximum number of orphans.  The orphans are chosen with a
+// probability proportional to their size, so the orphans of peers which use
+// the most space are the most likely to be evicted.
+func (op *orphanPool) limitNumOrphans() {
+	for len(op.orphans) > 0 && len(op.orphans)+1 > op.policy.MaxOrphanTxs {
+		// Choose a random byte of all of the orphans and evict the
+		// orphan it belongs to.  The iteration order of the map does
+		// not influence the probability of an orphan being chosen.
+		target := op.rand.Int63n(op.totalBytes)
+		for _, otx := range op.orphans {
+			target -= otx.size
+			if target < 0 {
+				// Don't remove redeemers in the case of a random
+				// eviction since it is quite possible it might
+				// be needed again shortly.
+				op.remove(otx.tx, false)
+				break
+			}
+		}
+	}
+}
+
+// maybeAdd potentially adds the passed orphan transaction with the passed tag
+// and missing parents to the orphan pool.  Orphans which exceed the maximum
+// size of an orphan transaction or the maximum total size of the orphans with
+// the same tag are rejected.  Otherwise, expired orphans and, when needed to
+// make room for the new one, other orphans are evicted.
+func (op *orphanPool) maybeAdd(tx *hdfutil.Tx, tag Tag,
+	missingParents []*chainhash.Hash) error {
+
+	// Nothing to do if no orphans are allowed.
+	if op.policy.MaxOrphanTxs <= 0 {
+		return nil
+	}
+
+	// Ignore orphan transactions that are too large.  This helps avoid
+	// a memory exhaustion attack based on sending a lot of really large
+	// orphans.  In the case there is a valid transaction larger than this,
+	// it will ultimtely be rebroadcast after the parent transactions
+	// have been mined or otherwise received.
+	//
+	// Note that the number of orphan transactions in the orphan pool is
+	// also limited, so this equates to a maximum memory used of
+	// MaxOrphanTxSize * MaxOrphanTxs (which is ~10MB using the default
+	// values at the time this comment was written).
+	size := int64(tx.MsgTx().SerializeSize())
+	if size > int64(op.policy.MaxOrphanTxSize) {
+		str := fmt.Sprintf("orphan transaction size of %d bytes is "+
+			"larger than max allowed size of %d bytes", size,
+			op.policy.MaxOrphanTxSize)
+		return txRuleError(wire.RejectNonstandard, str)
+	}
+	maxTagBytes := op.policy.MaxOrphanBytesPerTag
+	if maxTagBytes > 0 && size > maxTagBytes {
+		str := fmt.Sprintf("orphan transaction size of %d bytes is "+
+			"larger than max allowed total size of %d bytes of "+
+			"the orphans from a single source", size, maxTagBytes)
+		return txRuleError(wire.RejectNonstandard, str)
+	}
+
+	// Limit the orphans to prevent memory exhaustion.  This will
+	// periodically remove any expired orphans, evict the oldest orphans
+	// with the same tag when they use too much space, and evict random
+	// orphans if space is still needed.
+	op.expire()
+	op.limitTagBytes(tag, size)
+	op.limitNumOrphans()
+
+	op.orphans[*tx.Hash()] = &orphanTx{
+		tx:             tx,
+		tag:            tag,
+		size:           size,
+		missingParents: missingParents,
+		expiration:     time.Now().Add(orphanTTL),
+	}
+	for _, txIn := range tx.MsgTx().TxIn {
+		if _, exists := op.byPrev[txIn.PreviousOutPoint]; !exists {
+			op.byPrev[txIn.PreviousOutPoint] =
+				make(map[chainhash.Hash]*hdfutil.Tx)
+		}
+		op.byPrev[txIn.PreviousOutPoint][*tx.Hash()] = tx
+	}
+	op.totalBytes += size
+	op.tagBytes[tag] += size
+
+	log.Debugf("Stored orphan transaction %v (total: %d)", tx.Hash(),
+		len(op.orphans))
+	return nil
+}
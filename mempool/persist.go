@@ -0,0 +1,149 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/ifishnet/hdfd/wire"
+	"github.com/ifishnet/hdfutil"
+)
+
+const (
+	// mempoolSaveVersion is the version of the format written by Save.
+	mempoolSaveVersion = 1
+
+	// maxSavedTxns is the maximum number of transactions Load will read
+	// from saved mempool data.  It only serves to reject corrupt data
+	// before allocating memory for it.
+	maxSavedTxns = 10000000
+)
+
+// Save writes all of the transactions in the pool along with the time they
+// were added to the passed writer in a versioned format that can be read back
+// with Load, for example to persist the pool across restarts.
+//
+// Transactions are written after all of their unconfirmed ancestors so they
+// can be added back to the pool in order.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Save(w io.Writer) error {
+	mp.mtx.RLock()
+	descs := make([]*TxDesc, 0, len(mp.pool))
+	for _, desc := range mp.pool {
+		descs = append(descs, desc)
+	}
+
+	// A transaction always has fewer ancestors than any of its
+	// descendants, so sorting by the number of ancestors ensures parents
+	// come before their children.
+	sort.Slice(descs, func(i, j int) bool {
+		return descs[i].ancestorStats.Count < descs[j].ancestorStats.Count
+	})
+	mp.mtx.RUnlock()
+
+	err := binary.Write(w, binary.BigEndian, uint32(mempoolSaveVersion))
+	if err != nil {
+		return err
+	}
+	err = binary.Write(w, binary.BigEndian, uint32(len(descs)))
+	if err != nil {
+		return err
+	}
+	for _, desc := range descs {
+		err := binary.Write(w, binary.BigEndian, desc.Added.Unix())
+		if err != nil {
+			return err
+		}
+		if err := desc.Tx.MsgTx().Serialize(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Load reads transactions written by Save from the passed reader and attempts
+// to add them back to the pool, retaining the time they were originally added.
+// Transactions which are no longer valid, for example because they, or a
+// conflicting transaction, have been mined in the meantime, or whose parents
+// are not available are silently skipped.  The transactions that were added
+// to the pool are returned.
+//
+// An error is only returned when the data can't be read or is not in the
+// expected format, in which case the transactions read so far are still added
+// to the pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Load(r io.Reader) ([]*TxDesc, error) {
+	var version uint32
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return nil, err
+	}
+	if version != mempoolSaveVersion {
+		return nil, fmt.Errorf("unsupported saved mempool version %d",
+			version)
+	}
+
+	var numTxns uint32
+	if err := binary.Read(r, binary.BigEndian, &numTxns); err != nil {
+		return nil, err
+	}
+	if numTxns > maxSavedTxns {
+		return nil, fmt.Errorf("too many saved mempool transactions: "+
+			"max %d, got %d", maxSavedTxns, numTxns)
+	}
+
+	var accepted []*TxDesc
+	for i := uint32(0); i < numTxns; i++ {
+		var added int64
+		if err := binary.Read(r, binary.BigEndian, &added); err != nil {
+			return accepted, err
+		}
+		var msgTx wire.MsgTx
+		if err := msgTx.Deserialize(r); err != nil {
+			return accepted, err
+		}
+		tx := hdfutil.NewTx(&msgTx)
+
+		// Skip transactions which expired while the pool was not
+		// running.
+		maxAge := mp.cfg.Policy.MaxTxAge
+		if maxAge > 0 && time.Since(time.Unix(added, 0)) > maxAge {
+			log.Debugf("Skipping expired saved mempool transaction "+
+				"%v", tx.Hash())
+			continue
+		}
+
+		// The transaction is not new since it was already accepted
+		// once, so it is neither rate limited nor required to have
+		// sufficient priority.
+		mp.mtx.Lock()
+		missingParents, txD, err := mp.maybeAcceptTransaction(tx,
+			false, false, true, false)
+		if err == nil && len(missingParents) == 0 {
+			txD.Added = time.Unix(added, 0)
+		}
+		mp.mtx.Unlock()
+		if err != nil {
+			log.Debugf("Skipping saved mempool transaction %v: %v",
+				tx.Hash(), err)
+			continue
+		}
+		if len(missingParents) > 0 {
+			log.Debugf("Skipping saved mempool transaction %v: "+
+				"missing parents", tx.Hash())
+			continue
+		}
+
+		accepted = append(accepted, txD)
+	}
+
+	return accepted, nil
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+)
+
+// TestSaveLoad ensures transactions saved from the mempool are restored
+// properly, including the time they were added to the pool.
+func TestSaveLoad(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+
+	// Add a chain of transactions to the pool so the saved data has to
+	// retain the order of parents and children.
+	chain, err := harness.CreateTxChain(outputs[0], 5)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	for i, tx := range chain {
+		_, err := harness.txPool.ProcessTransaction(tx, false, false, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction #%d: unexpected error: %v",
+				i, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := harness.txPool.Save(&buf); err != nil {
+		t.Fatalf("Save: unexpected error: %v", err)
+	}
+	saved := buf.Bytes()
+
+	// Restore the saved transactions into an empty pool bound to the same
+	// chain.
+	restored := New(&harness.txPool.cfg)
+	txDescs, err := restored.Load(bytes.NewReader(saved))
+	if err != nil {
+		t.Fatalf("Load: unexpected error: %v", err)
+	}
+	if len(txDescs) != len(chain) {
+		t.Fatalf("Load: got %d transactions, want %d", len(txDescs),
+			len(chain))
+	}
+	for _, tx := range chain {
+		want := harness.txPool.pool[*tx.Hash()]
+		got, ok := restored.pool[*tx.Hash()]
+		if !ok {
+			t.Fatalf("transaction %v was not restored", tx.Hash())
+		}
+		if got.Added.Unix() != want.Added.Unix() {
+			t.Fatalf("transaction %v added time: got %v, want %v",
+				tx.Hash(), got.Added, want.Added)
+		}
+	}
+
+	// Loading the same transactions again must not add anything.
+	txDescs, err = restored.Load(bytes.NewReader(saved))
+	if err != nil {
+		t.Fatalf("Load: unexpected error: %v", err)
+	}
+	if len(txDescs) != 0 {
+		t.Fatalf("Load: got %d transactions, want 0", len(txDescs))
+	}
+
+	// Ensure malformed data is rejected.
+	badVersion := append([]byte{0xff}, saved[1:]...)
+	_, err = New(&harness.txPool.cfg).Load(bytes.NewReader(badVersion))
+	if err == nil {
+		t.Fatalf("Load: expected error for unsupported version")
+	}
+	truncated := saved[:len(saved)-1]
+	txDescs, err = New(&harness.txPool.cfg).Load(bytes.NewReader(truncated))
+	if err == nil {
+		t.Fatalf("Load: expected error for truncated data")
+	}
+	if len(txDescs) != len(chain)-1 {
+		t.Fatalf("Load: got %d transactions from truncated data, "+
+			"want %d", len(txDescs), len(chain)-1)
+	}
+}
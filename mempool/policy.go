@@ -49,6 +49,11 @@ const (
 	// for larger transactions.  This value is in Satoshi/1000 bytes.
 	DefaultMinRelayTxFee = hdfutil.Amount(1000)
 
+	// DefaultBytesPerSigOp is the default number of virtual bytes each unit
+	// of signature operation cost of a transaction is counted as when
+	// calculating its sigop-adjusted virtual size.
+	DefaultBytesPerSigOp = 20
+
 	// maxStandardMultiSigKeys is the maximum number of public keys allowed
 	// in a multi-signature transaction output script for it to be
 	// considered standard.
@@ -109,13 +114,15 @@ func checkInputsStandard(tx *hdfutil.Tx, utxoView *blockchain.UtxoViewpoint) err
 					"%d signature operations which is more "+
 					"than the allowed max amount of %d",
 					i, numSigOps, maxStandardP2SHSigOps)
-				return txRuleError(wire.RejectNonstandard, str)
+				return nonStandardError(wire.RejectNonstandard,
+					ReasonNonStandardInputs, str)
 			}
 
-		case txscript.NonStandardTy:
+		case txscript.NonStandardTy, txscript.WitnessUnknownTy:
 			str := fmt.Sprintf("transaction input #%d has a "+
 				"non-standard script form", i)
-			return txRuleError(wire.RejectNonstandard, str)
+			return nonStandardError(wire.RejectNonstandard,
+				ReasonNonStandardInputs, str)
 		}
 	}
 
@@ -134,38 +141,43 @@ func checkPkScriptStandard(pkScript []byte, scriptClass txscript.ScriptClass) er
 		if err != nil {
 			str := fmt.Sprintf("multi-signature script parse "+
 				"failure: %v", err)
-			return txRuleError(wire.RejectNonstandard, str)
+			return nonStandardError(wire.RejectNonstandard,
+				ReasonPkScript, str)
 		}
 
 		// A standard multi-signature public key script must contain
 		// from 1 to maxStandardMultiSigKeys public keys.
 		if numPubKeys < 1 {
 			str := "multi-signature script with no pubkeys"
-			return txRuleError(wire.RejectNonstandard, str)
+			return nonStandardError(wire.RejectNonstandard,
+				ReasonPkScript, str)
 		}
 		if numPubKeys > maxStandardMultiSigKeys {
 			str := fmt.Sprintf("multi-signature script with %d "+
 				"public keys which is more than the allowed "+
 				"max of %d", numPubKeys, maxStandardMultiSigKeys)
-			return txRuleError(wire.RejectNonstandard, str)
+			return nonStandardError(wire.RejectNonstandard,
+				ReasonPkScript, str)
 		}
 
 		// A standard multi-signature public key script must have at
 		// least 1 signature and no more signatures than available
 		// public keys.
 		if numSigs < 1 {
-			return txRuleError(wire.RejectNonstandard,
-				"multi-signature script with no signatures")
+			return nonStandardError(wire.RejectNonstandard,
+				ReasonPkScript, "multi-signature script with "+
+					"no signatures")
 		}
 		if numSigs > numPubKeys {
 			str := fmt.Sprintf("multi-signature script with %d "+
 				"signatures which is more than the available "+
 				"%d public keys", numSigs, numPubKeys)
-			return txRuleError(wire.RejectNonstandard, str)
+			return nonStandardError(wire.RejectNonstandard,
+				ReasonPkScript, str)
 		}
 
 	case txscript.NonStandardTy:
-		return txRuleError(wire.RejectNonstandard,
+		return nonStandardError(wire.RejectNonstandard, ReasonPkScript,
 			"non-standard script form")
 	}
 
@@ -268,16 +280,21 @@ func isDust(txOut *wire.TxOut, minRelayTxFee hdfutil.Amount) bool {
 	return txOut.Value*1000/(3*int64(totalSize)) < int64(minRelayTxFee)
 }
 
-// checkTransactionStandard performs a series of checks on a transaction to
+// CheckTransactionStandard performs a series of checks on a transaction to
 // ensure it is a "standard" transaction.  A standard transaction is one that
 // conforms to several additional limiting cases over what is considered a
 // "sane" transaction such as having a version in the supported range, being
 // finalized, conforming to more stringent size constraints, having scripts
 // of recognized forms, and not containing "dust" outputs (those that are
-// so small it costs more to process them than they are worth).
-func checkTransactionStandard(tx *hdfutil.Tx, height int32,
+// so small it costs more to process them than they are worth).  Null data
+// outputs may carry up to maxDataCarrierSize bytes of data in total.
+//
+// The returned error is a RuleError which wraps a TxRuleError with its Reason
+// field set to the RejectReason of the first failed check, so the caller can
+// use errors.Is to determine why the transaction is not standard.
+func CheckTransactionStandard(tx *hdfutil.Tx, height int32,
 	medianTimePast time.Time, minRelayTxFee hdfutil.Amount,
-	maxTxVersion int32) error {
+	maxTxVersion int32, maxDataCarrierSize int) error {
 
 	// The transaction must be a currently supported version.
 	msgTx := tx.MsgTx()
@@ -285,13 +302,14 @@ func checkTransactionStandard(tx *hdfutil.Tx, height int32,
 		str := fmt.Sprintf("transaction version %d is not in the "+
 			"valid range of %d-%d", msgTx.Version, 1,
 			maxTxVersion)
-		return txRuleError(wire.RejectNonstandard, str)
+		return nonStandardError(wire.RejectNonstandard, ReasonVersion,
+			str)
 	}
 
 	// The transaction must be finalized to be standard and therefore
 	// considered for inclusion in a block.
 	if !blockchain.IsFinalizedTransaction(tx, height, medianTimePast) {
-		return txRuleError(wire.RejectNonstandard,
+		return nonStandardError(wire.RejectNonstandard, ReasonNonFinal,
 			"transaction is not finalized")
 	}
 
@@ -303,7 +321,8 @@ func checkTransactionStandard(tx *hdfutil.Tx, height int32,
 	if txWeight > maxStandardTxWeight {
 		str := fmt.Sprintf("weight of transaction %v is larger than max "+
 			"allowed weight of %v", txWeight, maxStandardTxWeight)
-		return txRuleError(wire.RejectNonstandard, str)
+		return nonStandardError(wire.RejectNonstandard, ReasonTxSize,
+			str)
 	}
 
 	for i, txIn := range msgTx.TxIn {
@@ -316,7 +335,8 @@ func checkTransactionStandard(tx *hdfutil.Tx, height int32,
 				"script size of %d bytes is large than max "+
 				"allowed size of %d bytes", i, sigScriptLen,
 				maxStandardSigScriptSize)
-			return txRuleError(wire.RejectNonstandard, str)
+			return nonStandardError(wire.RejectNonstandard,
+				ReasonSigScriptSize, str)
 		}
 
 		// Each transaction input signature script must only contain
@@ -324,7 +344,8 @@ func checkTransactionStandard(tx *hdfutil.Tx, height int32,
 		if !txscript.IsPushOnlyScript(txIn.SignatureScript) {
 			str := fmt.Sprintf("transaction input %d: signature "+
 				"script is not push only", i)
-			return txRuleError(wire.RejectNonstandard, str)
+			return nonStandardError(wire.RejectNonstandard,
+				ReasonSigScriptNotPushOnly, str)
 		}
 	}
 
@@ -332,7 +353,8 @@ func checkTransactionStandard(tx *hdfutil.Tx, height int32,
 	// be "dust" (except when the script is a null data script).
 	numNullDataOutputs := 0
 	for i, txOut := range msgTx.TxOut {
-		scriptClass := txscript.GetScriptClass(txOut.PkScript)
+		scriptClass := txscript.GetScriptClassWithDataCarrierSize(
+			txOut.PkScript, maxDataCarrierSize)
 		err := checkPkScriptStandard(txOut.PkScript, scriptClass)
 		if err != nil {
 			// Attempt to extract a reject code from the error so
@@ -343,7 +365,7 @@ func checkTransactionStandard(tx *hdfutil.Tx, height int32,
 				rejectCode = rejCode
 			}
 			str := fmt.Sprintf("transaction output %d: %v", i, err)
-			return txRuleError(rejectCode, str)
+			return nonStandardError(rejectCode, ReasonPkScript, str)
 		}
 
 		// Accumulate the number of outputs which only carry data.  For
@@ -354,7 +376,7 @@ func checkTransactionStandard(tx *hdfutil.Tx, height int32,
 		} else if isDust(txOut, minRelayTxFee) {
 			str := fmt.Sprintf("transaction output %d: payment "+
 				"of %d is dust", i, txOut.Value)
-			return txRuleError(wire.RejectDust, str)
+			return nonStandardError(wire.RejectDust, ReasonDust, str)
 		}
 	}
 
@@ -362,7 +384,8 @@ func checkTransactionStandard(tx *hdfutil.Tx, height int32,
 	// only carries data.
 	if numNullDataOutputs > 1 {
 		str := "more than one transaction output in a nulldata script"
-		return txRuleError(wire.RejectNonstandard, str)
+		return nonStandardError(wire.RejectNonstandard,
+			ReasonMultiOpReturn, str)
 	}
 
 	return nil
@@ -380,3 +403,21 @@ func GetTxVirtualSize(tx *hdfutil.Tx) int64 {
 	return (blockchain.GetTransactionWeight(tx) + (blockchain.WitnessScaleFactor - 1)) /
 		blockchain.WitnessScaleFactor
 }
+
+// GetSigOpAdjustedVirtualSize computes the virtual size of a given transaction
+// with the passed signature operation cost, where each unit of the cost is
+// counted as the passed number of virtual bytes whenever they outweigh the
+// transaction itself.  This prevents transactions which are dense in signature
+// operations, and thus use up a disproportionate share of the signature
+// operations a block may contain, from paying fees as if they only used block
+// space according to their size.  A zero number of bytes per signature
+// operation results in the plain virtual size.
+func GetSigOpAdjustedVirtualSize(tx *hdfutil.Tx, sigOpCost, bytesPerSigOp int) int64 {
+	weight := blockchain.GetTransactionWeight(tx)
+	sigOpWeight := int64(sigOpCost) * int64(bytesPerSigOp)
+	if sigOpWeight > weight {
+		weight = sigOpWeight
+	}
+	return (weight + (blockchain.WitnessScaleFactor - 1)) /
+		blockchain.WitnessScaleFactor
+}
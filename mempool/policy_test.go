@@ -6,6 +6,7 @@ package mempool
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 	"time"
 
@@ -94,6 +95,39 @@ func TestCalcMinRequiredTxRelayFee(t *testing.T) {
 	}
 }
 
+// TestGetSigOpAdjustedVirtualSize ensures the virtual size of a transaction is
+// only adjusted for its signature operations when they outweigh it.
+func TestGetSigOpAdjustedVirtualSize(t *testing.T) {
+	// The transaction has a virtual size of 60 bytes.
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	prevOut := wire.NewOutPoint(&chainhash.Hash{}, 0)
+	msgTx.AddTxIn(wire.NewTxIn(prevOut, nil, nil))
+	msgTx.AddTxOut(wire.NewTxOut(0, nil))
+	tx := hdfutil.NewTx(msgTx)
+
+	tests := []struct {
+		name          string
+		sigOpCost     int
+		bytesPerSigOp int
+		want          int64
+	}{
+		{"no sigops", 0, DefaultBytesPerSigOp, 60},
+		{"sigops below size", 10, DefaultBytesPerSigOp, 60},
+		{"sigops equal to size", 12, DefaultBytesPerSigOp, 60},
+		{"sigops above size rounded up", 13, DefaultBytesPerSigOp, 65},
+		{"sigops above size", 20, DefaultBytesPerSigOp, 100},
+		{"adjustment disabled", 20, 0, 60},
+	}
+
+	for _, test := range tests {
+		got := GetSigOpAdjustedVirtualSize(tx, test.sigOpCost,
+			test.bytesPerSigOp)
+		if got != test.want {
+			t.Errorf("%s: got %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
 // TestCheckPkScriptStandard tests the checkPkScriptStandard API.
 func TestCheckPkScriptStandard(t *testing.T) {
 	var pubKeys [][]byte
@@ -277,7 +311,7 @@ func TestDust(t *testing.T) {
 	}
 }
 
-// TestCheckTransactionStandard tests the checkTransactionStandard API.
+// TestCheckTransactionStandard tests the CheckTransactionStandard API.
 func TestCheckTransactionStandard(t *testing.T) {
 	// Create some dummy, but otherwise standard, data for transactions.
 	prevOutHash, err := chainhash.NewHashFromStr("01")
@@ -312,6 +346,7 @@ func TestCheckTransactionStandard(t *testing.T) {
 		height     int32
 		isStandard bool
 		code       wire.RejectCode
+		reason     RejectReason
 	}{
 		{
 			name: "Typical pay-to-pubkey-hash transaction",
@@ -335,6 +370,7 @@ func TestCheckTransactionStandard(t *testing.T) {
 			height:     300000,
 			isStandard: false,
 			code:       wire.RejectNonstandard,
+			reason:     ReasonVersion,
 		},
 		{
 			name: "Transaction is not finalized",
@@ -351,6 +387,7 @@ func TestCheckTransactionStandard(t *testing.T) {
 			height:     300000,
 			isStandard: false,
 			code:       wire.RejectNonstandard,
+			reason:     ReasonNonFinal,
 		},
 		{
 			name: "Transaction size is too large",
@@ -367,6 +404,7 @@ func TestCheckTransactionStandard(t *testing.T) {
 			height:     300000,
 			isStandard: false,
 			code:       wire.RejectNonstandard,
+			reason:     ReasonTxSize,
 		},
 		{
 			name: "Signature script size is too large",
@@ -384,6 +422,7 @@ func TestCheckTransactionStandard(t *testing.T) {
 			height:     300000,
 			isStandard: false,
 			code:       wire.RejectNonstandard,
+			reason:     ReasonSigScriptSize,
 		},
 		{
 			name: "Signature script that does more than push data",
@@ -401,6 +440,7 @@ func TestCheckTransactionStandard(t *testing.T) {
 			height:     300000,
 			isStandard: false,
 			code:       wire.RejectNonstandard,
+			reason:     ReasonSigScriptNotPushOnly,
 		},
 		{
 			name: "Valid but non standard public key script",
@@ -416,6 +456,7 @@ func TestCheckTransactionStandard(t *testing.T) {
 			height:     300000,
 			isStandard: false,
 			code:       wire.RejectNonstandard,
+			reason:     ReasonPkScript,
 		},
 		{
 			name: "More than one nulldata output",
@@ -434,6 +475,7 @@ func TestCheckTransactionStandard(t *testing.T) {
 			height:     300000,
 			isStandard: false,
 			code:       wire.RejectNonstandard,
+			reason:     ReasonMultiOpReturn,
 		},
 		{
 			name: "Dust output",
@@ -449,6 +491,7 @@ func TestCheckTransactionStandard(t *testing.T) {
 			height:     300000,
 			isStandard: false,
 			code:       wire.RejectDust,
+			reason:     ReasonDust,
 		},
 		{
 			name: "One nulldata output with 0 amount (standard)",
@@ -464,25 +507,82 @@ func TestCheckTransactionStandard(t *testing.T) {
 			height:     300000,
 			isStandard: true,
 		},
+		{
+			name: "Nulldata output with multiple pushes (standard)",
+			tx: wire.MsgTx{
+				Version: 1,
+				TxIn:    []*wire.TxIn{&dummyTxIn},
+				TxOut: []*wire.TxOut{{
+					Value: 0,
+					PkScript: append(append([]byte{
+						txscript.OP_RETURN,
+						txscript.OP_DATA_40},
+						bytes.Repeat([]byte{0x01}, 40)...),
+						append([]byte{txscript.OP_DATA_40},
+							bytes.Repeat([]byte{0x02}, 40)...)...),
+				}},
+				LockTime: 0,
+			},
+			height:     300000,
+			isStandard: true,
+		},
+		{
+			name: "Nulldata output exceeding the data carrier size",
+			tx: wire.MsgTx{
+				Version: 1,
+				TxIn:    []*wire.TxIn{&dummyTxIn},
+				TxOut: []*wire.TxOut{{
+					Value: 0,
+					PkScript: append(append([]byte{
+						txscript.OP_RETURN,
+						txscript.OP_DATA_40},
+						bytes.Repeat([]byte{0x01}, 40)...),
+						append([]byte{txscript.OP_DATA_41},
+							bytes.Repeat([]byte{0x02}, 41)...)...),
+				}},
+				LockTime: 0,
+			},
+			height:     300000,
+			isStandard: false,
+			code:       wire.RejectNonstandard,
+			reason:     ReasonPkScript,
+		},
+		{
+			name: "Pay-to-taproot output (standard)",
+			tx: wire.MsgTx{
+				Version: 1,
+				TxIn:    []*wire.TxIn{&dummyTxIn},
+				TxOut: []*wire.TxOut{{
+					Value: 100000000,
+					PkScript: append([]byte{txscript.OP_1,
+						txscript.OP_DATA_32},
+						bytes.Repeat([]byte{0x01}, 32)...),
+				}},
+				LockTime: 0,
+			},
+			height:     300000,
+			isStandard: true,
+		},
 	}
 
 	pastMedianTime := time.Now()
 	for _, test := range tests {
 		// Ensure standardness is as expected.
-		err := checkTransactionStandard(hdfutil.NewTx(&test.tx),
-			test.height, pastMedianTime, DefaultMinRelayTxFee, 1)
+		err := CheckTransactionStandard(hdfutil.NewTx(&test.tx),
+			test.height, pastMedianTime, DefaultMinRelayTxFee, 1,
+			txscript.MaxDataCarrierSize)
 		if err == nil && test.isStandard {
 			// Test passes since function returned standard for a
 			// transaction which is intended to be standard.
 			continue
 		}
 		if err == nil && !test.isStandard {
-			t.Errorf("checkTransactionStandard (%s): standard when "+
+			t.Errorf("CheckTransactionStandard (%s): standard when "+
 				"it should not be", test.name)
 			continue
 		}
 		if err != nil && test.isStandard {
-			t.Errorf("checkTransactionStandard (%s): nonstandard "+
+			t.Errorf("CheckTransactionStandard (%s): nonstandard "+
 				"when it should not be: %v", test.name, err)
 			continue
 		}
@@ -490,23 +590,32 @@ func TestCheckTransactionStandard(t *testing.T) {
 		// Ensure error type is a TxRuleError inside of a RuleError.
 		rerr, ok := err.(RuleError)
 		if !ok {
-			t.Errorf("checkTransactionStandard (%s): unexpected "+
+			t.Errorf("CheckTransactionStandard (%s): unexpected "+
 				"error type - got %T", test.name, err)
 			continue
 		}
 		txrerr, ok := rerr.Err.(TxRuleError)
 		if !ok {
-			t.Errorf("checkTransactionStandard (%s): unexpected "+
+			t.Errorf("CheckTransactionStandard (%s): unexpected "+
 				"error type - got %T", test.name, rerr.Err)
 			continue
 		}
 
 		// Ensure the reject code is the expected one.
 		if txrerr.RejectCode != test.code {
-			t.Errorf("checkTransactionStandard (%s): unexpected "+
+			t.Errorf("CheckTransactionStandard (%s): unexpected "+
 				"error code - got %v, want %v", test.name,
 				txrerr.RejectCode, test.code)
 			continue
 		}
+
+		// Ensure the reject reason is the expected one and that it can
+		// be matched with errors.Is.
+		if txrerr.Reason != test.reason || !errors.Is(err, test.reason) {
+			t.Errorf("CheckTransactionStandard (%s): unexpected "+
+				"reject reason - got %v, want %v", test.name,
+				txrerr.Reason, test.reason)
+			continue
+		}
 	}
 }
@@ -0,0 +1,258 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ifishnet/hdfd/blockchain"
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+)
+
+const (
+	// DefaultRebroadcastInterval is the default average amount of time in
+	// between scans of the mempool for transactions to rebroadcast.
+	DefaultRebroadcastInterval = time.Hour
+
+	// rebroadcastMinAge is the minimum amount of time a transaction must
+	// have been in the mempool before it is rebroadcast.  Newer
+	// transactions are likely still propagating through the network.
+	rebroadcastMinAge = time.Minute * 30
+
+	// rebroadcastMaxVSize is the total virtual size of the transactions
+	// with the highest fee rates in the mempool that are considered for
+	// rebroadcasting.  It is three quarters of the maximum block size, so
+	// only transactions which are expected to have been mined already if
+	// miners knew about them are rebroadcast.
+	rebroadcastMaxVSize = blockchain.MaxBlockWeight /
+		blockchain.WitnessScaleFactor * 3 / 4
+
+	// rebroadcastRetryInterval is the minimum amount of time in between
+	// rebroadcasts of the same transaction.
+	rebroadcastRetryInterval = time.Hour * 4
+
+	// maxRebroadcastAttempts is the maximum number of times the same
+	// transaction is rebroadcast.  Transactions which are still not mined
+	// by then are most likely rejected by the rest of the network.
+	maxRebroadcastAttempts = 6
+)
+
+// rebroadcastCandidates returns the transactions which are likely missing
+// from the mempools of other peers, and miners in particular, since they have
+// been in the pool for at least the passed minimum age even though they pay
+// fee rates high enough to be among the transactions with the passed total
+// virtual size which would be mined next.  The fee rates of the transactions
+// take their unconfirmed ancestors into account, and transactions paying less
+// than the current minimum fee rate of the pool are excluded since they would
+// be rejected by peers.
+//
+// The transactions are sorted so they come after all of their unconfirmed
+// ancestors.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) rebroadcastCandidates(now time.Time, minAge time.Duration,
+	maxVSize int64) []*TxDesc {
+
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	minFeeRate := mp.rollingMinFeeRate()
+	if relayFeeRate := float64(mp.cfg.Policy.MinRelayTxFee); relayFeeRate > minFeeRate {
+		minFeeRate = relayFeeRate
+	}
+
+	descs := make([]*TxDesc, 0, len(mp.pool))
+	for _, txD := range mp.pool {
+		descs = append(descs, txD)
+	}
+	sort.Slice(descs, func(i, j int) bool {
+		return descs[i].ancestorStats.feeRate() >
+			descs[j].ancestorStats.feeRate()
+	})
+
+	var candidates []*TxDesc
+	var vsize int64
+	cutoff := now.Add(-minAge)
+	for _, txD := range descs {
+		vsize += txD.vsize
+		if vsize > maxVSize || txD.ancestorStats.feeRate() < minFeeRate {
+			break
+		}
+		if txD.Added.After(cutoff) {
+			continue
+		}
+		candidates = append(candidates, txD)
+	}
+
+	// A transaction always has fewer ancestors than any of its
+	// descendants, so sorting by the number of ancestors ensures parents
+	// come before their children.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].ancestorStats.Count <
+			candidates[j].ancestorStats.Count
+	})
+	return candidates
+}
+
+// RebroadcastConfig is a descriptor containing the rebroadcast manager
+// configuration.
+type RebroadcastConfig struct {
+	// TxPool is the mempool whose transactions are rebroadcast.
+	TxPool *TxPool
+
+	// Interval is the average amount of time in between scans of the
+	// mempool for transactions to rebroadcast.  The actual time is
+	// randomized to make the origin of the transactions harder to infer.
+	Interval time.Duration
+
+	// Announce relays the passed transactions to the connected peers.
+	Announce func(txns []*TxDesc)
+}
+
+// rebroadcastAttempts tracks how often a transaction has been rebroadcast.
+type rebroadcastAttempts struct {
+	count int
+	last  time.Time
+}
+
+// RebroadcastManager periodically rebroadcasts the transactions in the mempool
+// which pay fee rates high enough to have been mined already, but were not,
+// which suggests they are missing from the mempools of other peers, for
+// example because they restarted or evicted them.
+//
+// Each transaction is rebroadcast a limited number of times at most once per
+// rebroadcastRetryInterval, so transactions which are rejected by the rest of
+// the network are not announced over and over again.
+type RebroadcastManager struct {
+	sync.Mutex
+	cfg      RebroadcastConfig
+	attempts map[chainhash.Hash]*rebroadcastAttempts
+	started  bool
+	quit     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewRebroadcastManager returns a new rebroadcast manager for the passed
+// configuration.  Use Start to begin rebroadcasting transactions.
+func NewRebroadcastManager(cfg *RebroadcastConfig) *RebroadcastManager {
+	return &RebroadcastManager{
+		cfg:      *cfg,
+		attempts: make(map[chainhash.Hash]*rebroadcastAttempts),
+	}
+}
+
+// rebroadcast announces the transactions in the mempool which are due to be
+// rebroadcast and returns them.
+//
+// This function MUST be called with the manager lock held.
+func (m *RebroadcastManager) rebroadcast(now time.Time) []*TxDesc {
+	candidates := m.cfg.TxPool.rebroadcastCandidates(now,
+		rebroadcastMinAge, rebroadcastMaxVSize)
+
+	// Forget about the transactions which left the mempool.
+	for hash := range m.attempts {
+		if !m.cfg.TxPool.IsTransactionInPool(&hash) {
+			delete(m.attempts, hash)
+		}
+	}
+
+	var txns []*TxDesc
+	for _, txD := range candidates {
+		attempts, ok := m.attempts[*txD.Tx.Hash()]
+		if !ok {
+			attempts = &rebroadcastAttempts{}
+			m.attempts[*txD.Tx.Hash()] = attempts
+		}
+		if attempts.count >= maxRebroadcastAttempts ||
+			now.Sub(attempts.last) < rebroadcastRetryInterval {
+
+			continue
+		}
+		attempts.count++
+		attempts.last = now
+		txns = append(txns, txD)
+	}
+
+	if len(txns) > 0 {
+		log.Debugf("Rebroadcasting %d %s", len(txns),
+			pickNoun(len(txns), "transaction", "transactions"))
+		m.cfg.Announce(txns)
+	}
+	return txns
+}
+
+// nextScan returns the randomized amount of time until the next scan of the
+// mempool, which is between half and one and a half times the configured
+// interval.
+func (m *RebroadcastManager) nextScan() time.Duration {
+	interval := m.cfg.Interval
+	return interval/2 + time.Duration(rand.Int63n(int64(interval)))
+}
+
+// handler periodically rebroadcasts the transactions which are due until the
+// manager is stopped.  It must be run as a goroutine.
+func (m *RebroadcastManager) handler() {
+	timer := time.NewTimer(m.nextScan())
+
+out:
+	for {
+		select {
+		case now := <-timer.C:
+			m.Lock()
+			m.rebroadcast(now)
+			m.Unlock()
+			timer.Reset(m.nextScan())
+
+		case <-m.quit:
+			break out
+		}
+	}
+
+	timer.Stop()
+	m.wg.Done()
+}
+
+// Start begins periodically rebroadcasting transactions.  Calling this
+// function when the manager has already been started has no effect.
+//
+// This function is safe for concurrent access.
+func (m *RebroadcastManager) Start() {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.started || m.cfg.Interval <= 0 {
+		return
+	}
+
+	m.quit = make(chan struct{})
+	m.wg.Add(1)
+	go m.handler()
+
+	m.started = true
+	log.Debugf("Transaction rebroadcast manager started")
+}
+
+// Stop stops rebroadcasting transactions and waits for the manager to finish.
+// Calling this function when the manager has not been started has no effect.
+//
+// This function is safe for concurrent access.
+func (m *RebroadcastManager) Stop() {
+	m.Lock()
+	if !m.started {
+		m.Unlock()
+		return
+	}
+	close(m.quit)
+	m.started = false
+	m.Unlock()
+
+	// The handler acquires the lock to rebroadcast, so it must be waited
+	// for without holding it.
+	m.wg.Wait()
+	log.Debugf("Transaction rebroadcast manager stopped")
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfutil"
+)
+
+// TestRebroadcast ensures only transactions which have been in the mempool for
+// a while and pay high enough fees to have been mined are rebroadcast, and that
+// the number of rebroadcasts of each transaction is limited.
+func TestRebroadcast(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+	coinbase := ctx.addCoinbaseTx(3)
+
+	// Create two transactions, a child of the first one, and a recent
+	// transaction paying the highest fee.  The fee rate of the package of
+	// the child and its parent is between the fee rates of the other
+	// transactions.
+	addTx := func(output spendableOutput, fee hdfutil.Amount) *hdfutil.Tx {
+		return ctx.addSignedTx([]spendableOutput{output}, 1, fee, false,
+			false)
+	}
+	highFeeTx := addTx(txOutToSpendableOut(coinbase, 0), 5000)
+	lowFeeTx := addTx(txOutToSpendableOut(coinbase, 1), 1000)
+	childTx := addTx(txOutToSpendableOut(highFeeTx, 0), 1000)
+	recentTx := addTx(txOutToSpendableOut(coinbase, 2), 20000)
+
+	mp := harness.txPool
+	now := time.Now()
+	mp.mtx.Lock()
+	for _, tx := range []*hdfutil.Tx{highFeeTx, lowFeeTx, childTx} {
+		mp.pool[*tx.Hash()].Added = now.Add(-time.Hour)
+	}
+	mp.mtx.Unlock()
+
+	checkTxns := func(desc string, got []*TxDesc, want []*hdfutil.Tx) {
+		t.Helper()
+
+		if len(got) != len(want) {
+			t.Fatalf("%s: got %d transactions, want %d", desc,
+				len(got), len(want))
+		}
+		for i, txD := range got {
+			if *txD.Tx.Hash() != *want[i].Hash() {
+				t.Fatalf("%s: transaction #%d is %v, want %v",
+					desc, i, txD.Tx.Hash(), want[i].Hash())
+			}
+		}
+	}
+
+	// Ensure the transaction paying the lowest fee rate is not a candidate
+	// when it doesn't fit into the virtual size of the transactions which
+	// would be mined next and that the recent transaction is never one.
+	maxVSize := GetTxVirtualSize(recentTx) + GetTxVirtualSize(highFeeTx) +
+		GetTxVirtualSize(childTx)
+	candidates := mp.rebroadcastCandidates(now, rebroadcastMinAge,
+		maxVSize)
+	checkTxns("rebroadcastCandidates", candidates,
+		[]*hdfutil.Tx{highFeeTx, childTx})
+
+	var announced []*TxDesc
+	mgr := NewRebroadcastManager(&RebroadcastConfig{
+		TxPool:   mp,
+		Interval: time.Hour,
+		Announce: func(txns []*TxDesc) {
+			announced = txns
+		},
+	})
+
+	// Ensure all of the transactions except the recent one are announced
+	// in the order of their fee rates, but with the parent before its
+	// child.
+	mgr.rebroadcast(now)
+	checkTxns("first rebroadcast", announced,
+		[]*hdfutil.Tx{highFeeTx, lowFeeTx, childTx})
+
+	// Ensure the transactions are not rebroadcast again before the retry
+	// interval passed and that the recent transaction is not rebroadcast
+	// before it has been in the pool for the minimum age.
+	announced = nil
+	mgr.rebroadcast(now.Add(rebroadcastMinAge / 2))
+	checkTxns("early rebroadcast", announced, nil)
+
+	// Ensure the recent transaction is rebroadcast once it is old enough
+	// while the others are still not due before the retry interval passed.
+	mgr.rebroadcast(now.Add(rebroadcastRetryInterval / 2))
+	checkTxns("recent transaction rebroadcast", announced,
+		[]*hdfutil.Tx{recentTx})
+
+	// Ensure the transactions are rebroadcast once the retry interval
+	// passed since their last rebroadcast until they reach the maximum
+	// number of attempts.
+	for i := 1; i < maxRebroadcastAttempts; i++ {
+		announced = nil
+		mgr.rebroadcast(now.Add(rebroadcastRetryInterval*
+			time.Duration(i) + rebroadcastRetryInterval/2))
+		checkTxns("repeated rebroadcast", announced,
+			[]*hdfutil.Tx{recentTx, highFeeTx, lowFeeTx, childTx})
+	}
+	announced = nil
+	mgr.rebroadcast(now.Add(rebroadcastRetryInterval*
+		maxRebroadcastAttempts + rebroadcastRetryInterval/2))
+	checkTxns("final rebroadcast", announced, nil)
+
+	// Ensure the attempts of transactions which left the pool are
+	// forgotten.
+	mp.RemoveTransaction(highFeeTx, true)
+	mgr.rebroadcast(now.Add(rebroadcastRetryInterval *
+		(maxRebroadcastAttempts + 1)))
+	for _, tx := range []*hdfutil.Tx{highFeeTx, childTx} {
+		if _, ok := mgr.attempts[*tx.Hash()]; ok {
+			t.Fatalf("attempts of removed transaction %v were not "+
+				"forgotten", tx.Hash())
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+const (
+	// DefaultMaxRejectedTxs is the default maximum number of recently
+	// rejected transactions that are tracked by a RejectionCache.
+	DefaultMaxRejectedTxs = 5000
+)
+
+// RejectedTx houses the details about why a transaction was rejected.
+type RejectedTx struct {
+	// Hash is the hash the rejected transaction is tracked by.
+	Hash chainhash.Hash
+
+	// RejectCode is the code that was sent with the reject message for
+	// the transaction.
+	RejectCode wire.RejectCode
+
+	// Reason is the human readable description of the rejection.
+	Reason string
+}
+
+// RejectionCache is a bounded cache of recently rejected transactions along
+// with the reason they were rejected.  It is used to avoid the cost of fully
+// validating transactions that peers repeatedly announce even though they are
+// already known to be invalid.
+//
+// Whether or not a transaction is acceptable may depend on the state of the
+// main chain, so the entire cache is rolled over whenever the best chain
+// height it was populated at changes.  When the cache is full, the least
+// recently rejected entry is evicted to make room for new entries.
+//
+// A RejectionCache is safe for concurrent access.
+type RejectionCache struct {
+	// The following variables must only be used atomically.
+	hits   uint64
+	misses uint64
+
+	mtx     sync.Mutex
+	limit   int
+	height  int32
+	entries map[chainhash.Hash]*list.Element
+	order   *list.List // least recently rejected at the front
+}
+
+// NewRejectionCache returns a new rejection cache that tracks up to the
+// provided number of rejected transactions.
+func NewRejectionCache(limit int) *RejectionCache {
+	return &RejectionCache{
+		limit:   limit,
+		entries: make(map[chainhash.Hash]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// rollover removes all entries from the cache when it was populated at a
+// different best chain height than the one provided.
+//
+// This function MUST be called with the cache lock held.
+func (c *RejectionCache) rollover(height int32) {
+	if c.height == height {
+		return
+	}
+
+	if len(c.entries) > 0 {
+		log.Debugf("Rolling over rejection cache with %d entries at "+
+			"height %d", len(c.entries), height)
+		c.entries = make(map[chainhash.Hash]*list.Element)
+		c.order.Init()
+	}
+	c.height = height
+}
+
+// Add records that the transaction with the provided hash was rejected with
+// the given reject code and reason while the best chain was at the provided
+// height.
+func (c *RejectionCache) Add(hash *chainhash.Hash, code wire.RejectCode,
+	reason string, height int32) {
+
+	if c.limit <= 0 {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.rollover(height)
+
+	// Update the details of the rejection and mark it as the most recent
+	// when it is already known.
+	if elem, ok := c.entries[*hash]; ok {
+		rejected := elem.Value.(*RejectedTx)
+		rejected.RejectCode = code
+		rejected.Reason = reason
+		c.order.MoveToBack(elem)
+		return
+	}
+
+	// Evict the least recently rejected entry when the cache is full.
+	if len(c.entries) >= c.limit {
+		oldest := c.order.Front()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*RejectedTx).Hash)
+	}
+
+	c.entries[*hash] = c.order.PushBack(&RejectedTx{
+		Hash:       *hash,
+		RejectCode: code,
+		Reason:     reason,
+	})
+}
+
+// Lookup returns the details of the rejection of the transaction with the
+// provided hash and true when it was rejected since the best chain was last
+// at a height other than the one provided.  Otherwise, false is returned.
+// Every lookup is counted as either a hit or a miss.
+func (c *RejectionCache) Lookup(hash *chainhash.Hash, height int32) (RejectedTx, bool) {
+	c.mtx.Lock()
+	c.rollover(height)
+	elem, ok := c.entries[*hash]
+	var rejected RejectedTx
+	if ok {
+		rejected = *elem.Value.(*RejectedTx)
+	}
+	c.mtx.Unlock()
+
+	if !ok {
+		atomic.AddUint64(&c.misses, 1)
+		return RejectedTx{}, false
+	}
+
+	atomic.AddUint64(&c.hits, 1)
+	return rejected, true
+}
+
+// Remove removes the transaction with the provided hash from the cache.  It
+// does nothing when the transaction is not in the cache.
+func (c *RejectionCache) Remove(hash *chainhash.Hash) {
+	c.mtx.Lock()
+	if elem, ok := c.entries[*hash]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, *hash)
+	}
+	c.mtx.Unlock()
+}
+
+// Count returns the number of rejected transactions in the cache.
+func (c *RejectionCache) Count() int {
+	c.mtx.Lock()
+	count := len(c.entries)
+	c.mtx.Unlock()
+
+	return count
+}
+
+// Hits returns the number of lookups that found a rejected transaction.
+func (c *RejectionCache) Hits() uint64 {
+	return atomic.LoadUint64(&c.hits)
+}
+
+// Misses returns the number of lookups that did not find a rejected
+// transaction.
+func (c *RejectionCache) Misses() uint64 {
+	return atomic.LoadUint64(&c.misses)
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"testing"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// TestRejectionCache ensures the rejection cache tracks rejected transactions,
+// evicts the least recently rejected entries, and rolls over when the best
+// chain height changes.
+func TestRejectionCache(t *testing.T) {
+	t.Parallel()
+
+	hashes := make([]chainhash.Hash, 4)
+	for i := range hashes {
+		hashes[i] = chainhash.HashH([]byte{byte(i)})
+	}
+
+	cache := NewRejectionCache(3)
+	for i := 0; i < 3; i++ {
+		cache.Add(&hashes[i], wire.RejectNonstandard, "nonstandard", 100)
+	}
+	if count := cache.Count(); count != 3 {
+		t.Fatalf("Count: unexpected count -- got %d, want 3", count)
+	}
+
+	// Ensure a rejected transaction is found along with its details.
+	rejected, ok := cache.Lookup(&hashes[0], 100)
+	if !ok {
+		t.Fatalf("Lookup: did not find rejected transaction %v",
+			hashes[0])
+	}
+	if rejected.Hash != hashes[0] ||
+		rejected.RejectCode != wire.RejectNonstandard ||
+		rejected.Reason != "nonstandard" {
+
+		t.Fatalf("Lookup: unexpected rejection details %+v", rejected)
+	}
+
+	// Ensure adding a new entry to the full cache evicts the least
+	// recently rejected one.
+	cache.Add(&hashes[3], wire.RejectInvalid, "invalid", 100)
+	if count := cache.Count(); count != 3 {
+		t.Fatalf("Count: unexpected count -- got %d, want 3", count)
+	}
+	if _, ok := cache.Lookup(&hashes[0], 100); ok {
+		t.Fatalf("Lookup: found evicted transaction %v", hashes[0])
+	}
+	if _, ok := cache.Lookup(&hashes[3], 100); !ok {
+		t.Fatalf("Lookup: did not find rejected transaction %v",
+			hashes[3])
+	}
+
+	// Ensure removed entries are no longer found.
+	cache.Remove(&hashes[1])
+	if _, ok := cache.Lookup(&hashes[1], 100); ok {
+		t.Fatalf("Lookup: found removed transaction %v", hashes[1])
+	}
+
+	// Ensure hits and misses are counted.
+	if hits := cache.Hits(); hits != 2 {
+		t.Fatalf("Hits: unexpected hits -- got %d, want 2", hits)
+	}
+	if misses := cache.Misses(); misses != 2 {
+		t.Fatalf("Misses: unexpected misses -- got %d, want 2", misses)
+	}
+
+	// Ensure the cache is rolled over when the best chain height changes.
+	if _, ok := cache.Lookup(&hashes[2], 101); ok {
+		t.Fatalf("Lookup: found transaction %v after rollover",
+			hashes[2])
+	}
+	if count := cache.Count(); count != 0 {
+		t.Fatalf("Count: unexpected count after rollover -- got %d, "+
+			"want 0", count)
+	}
+
+	// Ensure a cache with a zero limit never tracks anything.
+	disabled := NewRejectionCache(0)
+	disabled.Add(&hashes[0], wire.RejectInvalid, "invalid", 100)
+	if _, ok := disabled.Lookup(&hashes[0], 100); ok {
+		t.Fatal("Lookup: disabled cache found rejected transaction")
+	}
+	if count := disabled.Count(); count != 0 {
+		t.Fatalf("Count: unexpected count for disabled cache -- got "+
+			"%d, want 0", count)
+	}
+}
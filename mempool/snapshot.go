@@ -0,0 +1,203 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfutil"
+)
+
+// feeHistogramRates are the lowest fee rates, in satoshi per virtual byte, of
+// the fee rate ranges the transactions in a snapshot are grouped by.
+var feeHistogramRates = []float64{
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 10, 12, 14, 17, 20, 25, 30, 40, 50, 60, 70,
+	80, 100, 120, 140, 170, 200, 250, 300, 400, 500, 600, 700, 800, 1000,
+	1200, 1400, 1700, 2000, 2500, 3000, 4000, 5000, 6000, 7000, 8000, 10000,
+}
+
+// FeeHistogramBucket describes the transactions in a snapshot which pay a fee
+// rate within a range.
+type FeeHistogramBucket struct {
+	// FeeRate is the lowest fee rate of the range in satoshi per virtual
+	// byte.  The range extends up to the fee rate of the next bucket.
+	FeeRate float64
+
+	// Count is the number of transactions within the range.
+	Count int
+
+	// VSize is the total virtual size of the transactions within the
+	// range.
+	VSize int64
+
+	// Fees is the total fees paid by the transactions within the range.
+	Fees int64
+}
+
+// SnapshotEntry describes a transaction in a snapshot of the mempool.
+type SnapshotEntry struct {
+	// Tx is the transaction.
+	Tx *hdfutil.Tx
+
+	// Added is the time when the transaction was added to the pool.
+	Added time.Time
+
+	// Height is the block height when the transaction was added to the
+	// pool.
+	Height int32
+
+	// Fee is the total fee the transaction pays.
+	Fee int64
+
+	// VSize is the sigop-adjusted virtual size of the transaction.
+	VSize int64
+
+	// StartingPriority is the priority of the transaction when it was
+	// added to the pool.
+	StartingPriority float64
+
+	// Depends are the hashes of the unique transactions in the pool the
+	// transaction spends outputs of.  It must not be modified.
+	Depends []chainhash.Hash
+
+	// AncestorStats and DescendantStats are the aggregate statistics of
+	// the transaction together with all of its unconfirmed ancestors and
+	// descendants, respectively.
+	AncestorStats   PackageStats
+	DescendantStats PackageStats
+}
+
+// Snapshot is an immutable view of the transactions in the mempool at the time
+// it was taken.  Since it is independent of the mempool, it may be iterated
+// without holding up the acceptance of new transactions, which makes it well
+// suited for serving potentially large results such as verbose mempool queries.
+//
+// A Snapshot is safe for concurrent access.
+type Snapshot struct {
+	entries    map[chainhash.Hash]*SnapshotEntry
+	hashes     []chainhash.Hash
+	histogram  []FeeHistogramBucket
+	totalVSize int64
+}
+
+// Count returns the number of transactions in the snapshot.
+func (s *Snapshot) Count() int {
+	return len(s.hashes)
+}
+
+// TotalVSize returns the total virtual size of the transactions in the
+// snapshot.
+func (s *Snapshot) TotalVSize() int64 {
+	return s.totalVSize
+}
+
+// TxHashes returns the hashes of all of the transactions in the snapshot.
+func (s *Snapshot) TxHashes() []chainhash.Hash {
+	hashes := make([]chainhash.Hash, len(s.hashes))
+	copy(hashes, s.hashes)
+	return hashes
+}
+
+// Entry returns the entry for the transaction with the passed hash and whether
+// or not it is in the snapshot.
+func (s *Snapshot) Entry(hash *chainhash.Hash) (SnapshotEntry, bool) {
+	entry, ok := s.entries[*hash]
+	if !ok {
+		return SnapshotEntry{}, false
+	}
+	return *entry, true
+}
+
+// Entries returns the entries for all of the transactions in the snapshot in
+// the same order as TxHashes.
+func (s *Snapshot) Entries() []SnapshotEntry {
+	entries := make([]SnapshotEntry, len(s.hashes))
+	for i := range s.hashes {
+		entries[i] = *s.entries[s.hashes[i]]
+	}
+	return entries
+}
+
+// FeeHistogram returns the number, total virtual size and total fees of the
+// transactions in the snapshot grouped by ranges of their fee rates, ordered
+// by increasing fee rate.  The fee rate of each transaction is based on its
+// own fee and sigop-adjusted virtual size.  The ranges without transactions
+// are included as well.
+func (s *Snapshot) FeeHistogram() []FeeHistogramBucket {
+	histogram := make([]FeeHistogramBucket, len(s.histogram))
+	copy(histogram, s.histogram)
+	return histogram
+}
+
+// newFeeHistogram returns the fee histogram of the passed snapshot entries.
+func newFeeHistogram(entries map[chainhash.Hash]*SnapshotEntry) []FeeHistogramBucket {
+	histogram := make([]FeeHistogramBucket, len(feeHistogramRates))
+	for i, feeRate := range feeHistogramRates {
+		histogram[i].FeeRate = feeRate
+	}
+	for _, entry := range entries {
+		feeRate := float64(entry.Fee) / float64(entry.VSize)
+		i := sort.Search(len(feeHistogramRates), func(i int) bool {
+			return feeHistogramRates[i] > feeRate
+		}) - 1
+		if i < 0 {
+			i = 0
+		}
+		histogram[i].Count++
+		histogram[i].VSize += entry.VSize
+		histogram[i].Fees += entry.Fee
+	}
+	return histogram
+}
+
+// Snapshot returns an immutable view of the transactions in the mempool.  The
+// mempool lock is only held while the entries are copied, so the returned
+// snapshot may be used without blocking the mempool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Snapshot() *Snapshot {
+	mp.mtx.RLock()
+	s := &Snapshot{
+		entries:    make(map[chainhash.Hash]*SnapshotEntry, len(mp.pool)),
+		hashes:     make([]chainhash.Hash, 0, len(mp.pool)),
+		totalVSize: mp.totalVSize,
+	}
+	for hash, txD := range mp.pool {
+		entry := &SnapshotEntry{
+			Tx:               txD.Tx,
+			Added:            txD.Added,
+			Height:           txD.Height,
+			Fee:              txD.Fee,
+			VSize:            txD.vsize,
+			StartingPriority: txD.StartingPriority,
+			AncestorStats:    txD.ancestorStats,
+			DescendantStats:  txD.descendantStats,
+		}
+		for _, txIn := range txD.Tx.MsgTx().TxIn {
+			parentHash := txIn.PreviousOutPoint.Hash
+			if _, ok := mp.pool[parentHash]; !ok {
+				continue
+			}
+			var seen bool
+			for i := range entry.Depends {
+				if entry.Depends[i] == parentHash {
+					seen = true
+					break
+				}
+			}
+			if !seen {
+				entry.Depends = append(entry.Depends, parentHash)
+			}
+		}
+		s.entries[hash] = entry
+		s.hashes = append(s.hashes, hash)
+	}
+	mp.mtx.RUnlock()
+
+	s.histogram = newFeeHistogram(s.entries)
+	return s
+}
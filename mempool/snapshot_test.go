@@ -0,0 +1,117 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"testing"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+)
+
+// TestFeeHistogram ensures transactions are grouped by the fee rate range they
+// fall into.
+func TestFeeHistogram(t *testing.T) {
+	t.Parallel()
+
+	entries := map[chainhash.Hash]*SnapshotEntry{
+		{0x01}: {Fee: 50, VSize: 100},
+		{0x02}: {Fee: 100, VSize: 100},
+		{0x03}: {Fee: 199, VSize: 100},
+		{0x04}: {Fee: 900, VSize: 100},
+		{0x05}: {Fee: 2000000, VSize: 100},
+	}
+	want := map[float64]FeeHistogramBucket{
+		0:     {FeeRate: 0, Count: 1, VSize: 100, Fees: 50},
+		1:     {FeeRate: 1, Count: 2, VSize: 200, Fees: 299},
+		8:     {FeeRate: 8, Count: 1, VSize: 100, Fees: 900},
+		10000: {FeeRate: 10000, Count: 1, VSize: 100, Fees: 2000000},
+	}
+
+	histogram := newFeeHistogram(entries)
+	if len(histogram) != len(feeHistogramRates) {
+		t.Fatalf("got %d buckets, want %d", len(histogram),
+			len(feeHistogramRates))
+	}
+	for i, bucket := range histogram {
+		wantBucket, ok := want[feeHistogramRates[i]]
+		if !ok {
+			wantBucket = FeeHistogramBucket{FeeRate: feeHistogramRates[i]}
+		}
+		if bucket != wantBucket {
+			t.Errorf("bucket %d: got %+v, want %+v", i, bucket,
+				wantBucket)
+		}
+	}
+}
+
+// TestSnapshot ensures a snapshot reflects the transactions in the pool at the
+// time it was taken and is not affected by later changes to the pool.
+func TestSnapshot(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+
+	// Create a parent with two outputs which are both spent by its child.
+	parent := ctx.addSignedTx(outputs[:1], 2, 1000, false, false)
+	child := ctx.addSignedTx([]spendableOutput{
+		txOutToSpendableOut(parent, 0), txOutToSpendableOut(parent, 1),
+	}, 1, 2000, false, false)
+
+	snapshot := harness.txPool.Snapshot()
+	harness.txPool.RemoveTransaction(child, false)
+
+	if snapshot.Count() != 2 {
+		t.Fatalf("Count: got %d, want 2", snapshot.Count())
+	}
+	var wantVSize int64
+	for _, hash := range snapshot.TxHashes() {
+		entry, ok := snapshot.Entry(&hash)
+		if !ok {
+			t.Fatalf("Entry: transaction %v is missing", hash)
+		}
+		wantVSize += entry.VSize
+	}
+	if snapshot.TotalVSize() != wantVSize {
+		t.Fatalf("TotalVSize: got %d, want %d", snapshot.TotalVSize(),
+			wantVSize)
+	}
+
+	// Ensure the child is still in the snapshot after it was removed from
+	// the pool and depends on its parent only once.
+	entry, ok := snapshot.Entry(child.Hash())
+	if !ok {
+		t.Fatal("Entry: child is missing")
+	}
+	if entry.Fee != 2000 || entry.AncestorStats.Count != 2 {
+		t.Fatalf("Entry: unexpected child entry %+v", entry)
+	}
+	if len(entry.Depends) != 1 || entry.Depends[0] != *parent.Hash() {
+		t.Fatalf("Entry: got dependencies %v, want [%v]", entry.Depends,
+			parent.Hash())
+	}
+	entry, ok = snapshot.Entry(parent.Hash())
+	if !ok || len(entry.Depends) != 0 ||
+		entry.DescendantStats.Count != 2 {
+
+		t.Fatalf("Entry: unexpected parent entry %+v", entry)
+	}
+
+	// Ensure both transactions are accounted for in the fee histogram.
+	var count int
+	for _, bucket := range snapshot.FeeHistogram() {
+		count += bucket.Count
+	}
+	if count != 2 {
+		t.Fatalf("FeeHistogram: got %d transactions, want 2", count)
+	}
+	if harness.txPool.Snapshot().Count() != 1 {
+		t.Fatal("Snapshot: removed transaction is still in the pool")
+	}
+}
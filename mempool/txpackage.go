@@ -0,0 +1,235 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"fmt"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/wire"
+	"github.com/ifishnet/hdfutil"
+)
+
+const (
+	// MaxPackageCount is the maximum number of transactions a package
+	// accepted via AcceptPackage may contain.
+	MaxPackageCount = 25
+
+	// MaxPackageVSize is the maximum total virtual size of the
+	// transactions of a package accepted via AcceptPackage.
+	MaxPackageVSize = 101000
+)
+
+// checkPackageSanity ensures the passed transactions form a package which may
+// be accepted via AcceptPackage.  The package must contain between one and
+// MaxPackageCount transactions which do not exceed MaxPackageVSize in total.
+// Further, the transactions must be unique, sorted so every transaction comes
+// after the package transactions it spends, free of conflicts with each other,
+// and connected, meaning that every transaction spends or is spent by another
+// transaction of the package.
+func checkPackageSanity(txns []*hdfutil.Tx) error {
+	if len(txns) == 0 {
+		return txRuleError(wire.RejectInvalid, "package is empty")
+	}
+	if len(txns) > MaxPackageCount {
+		str := fmt.Sprintf("package has too many transactions: %d > %d",
+			len(txns), MaxPackageCount)
+		return txRuleError(wire.RejectNonstandard, str)
+	}
+
+	var vsize int64
+	indexes := make(map[chainhash.Hash]int, len(txns))
+	for i, tx := range txns {
+		if _, exists := indexes[*tx.Hash()]; exists {
+			str := fmt.Sprintf("package contains duplicate "+
+				"transaction %v", tx.Hash())
+			return txRuleError(wire.RejectInvalid, str)
+		}
+		indexes[*tx.Hash()] = i
+		vsize += GetTxVirtualSize(tx)
+	}
+	if vsize > MaxPackageVSize {
+		str := fmt.Sprintf("package virtual size is too large: %d > %d",
+			vsize, MaxPackageVSize)
+		return txRuleError(wire.RejectNonstandard, str)
+	}
+
+	// Link every transaction to the package transactions it spends while
+	// ensuring they come before it and that no outpoint is spent twice.
+	// The links are tracked as a disjoint set forest so the connectivity of
+	// the package can be checked afterwards.
+	parents := make([]int, len(txns))
+	for i := range parents {
+		parents[i] = i
+	}
+	root := func(i int) int {
+		for parents[i] != i {
+			i = parents[i]
+		}
+		return i
+	}
+	spent := make(map[wire.OutPoint]struct{})
+	for i, tx := range txns {
+		for _, txIn := range tx.MsgTx().TxIn {
+			prevOut := txIn.PreviousOutPoint
+			if _, exists := spent[prevOut]; exists {
+				str := fmt.Sprintf("package transaction %v "+
+					"spends output %v which is spent by "+
+					"another package transaction",
+					tx.Hash(), prevOut)
+				return txRuleError(wire.RejectInvalid, str)
+			}
+			spent[prevOut] = struct{}{}
+
+			j, exists := indexes[prevOut.Hash]
+			if !exists {
+				continue
+			}
+			if j > i {
+				str := fmt.Sprintf("package transaction %v "+
+					"spends output %v of a later package "+
+					"transaction", tx.Hash(), prevOut)
+				return txRuleError(wire.RejectNonstandard, str)
+			}
+			parents[root(j)] = root(i)
+		}
+	}
+	for i := range txns {
+		if root(i) != root(0) {
+			str := fmt.Sprintf("package transaction %v is not "+
+				"connected to the other package transactions",
+				txns[i].Hash())
+			return txRuleError(wire.RejectNonstandard, str)
+		}
+	}
+
+	return nil
+}
+
+// acceptPackage is the internal function which implements the public
+// AcceptPackage.  See the comment for AcceptPackage for more details.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) acceptPackage(txns []*hdfutil.Tx) ([]*TxDesc, error) {
+	if err := checkPackageSanity(txns); err != nil {
+		return nil, err
+	}
+
+	// Add the transactions of the package which are not already in the
+	// pool one by one so each one is able to spend the outputs of the
+	// previous ones.  The transactions which were added are removed again
+	// when the package is rejected so it is accepted atomically.
+	var added []*TxDesc
+	rollback := func() {
+		for i := len(added) - 1; i >= 0; i-- {
+			mp.removeTransaction(added[i].Tx, false)
+		}
+	}
+	for _, tx := range txns {
+		if mp.isTransactionInPool(tx.Hash()) {
+			continue
+		}
+
+		missingParents, txD, err := mp.maybeAcceptTransaction(tx, true,
+			false, false, true)
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+		if len(missingParents) > 0 {
+			rollback()
+			str := fmt.Sprintf("package transaction %v references "+
+				"outputs of unknown or fully-spent transaction "+
+				"%v", tx.Hash(), missingParents[0])
+			return nil, txRuleError(wire.RejectDuplicate, str)
+		}
+		added = append(added, txD)
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	// Evaluate the fee rate of the package as a whole, excluding the
+	// transactions which were already in the pool, against the minimum
+	// relay fee and the minimum fee rate required by the full pool.  Unlike
+	// free-standing transactions, packages are not exempt from the minimum
+	// relay fee based on their priority.
+	var fees, vsize int64
+	for _, txD := range added {
+		fees += txD.Fee
+		vsize += txD.vsize
+	}
+	minFeeRate := mp.cfg.Policy.MinRelayTxFee
+	rollingMinFee := hdfutil.Amount(mp.rollingMinFeeRate())
+	if rollingMinFee > minFeeRate {
+		minFeeRate = rollingMinFee
+	}
+	minFee := calcMinRequiredTxRelayFee(vsize, minFeeRate)
+	if fees < minFee {
+		rollback()
+		str := fmt.Sprintf("package has %d fees which is under the "+
+			"required amount of %d", fees, minFee)
+		return nil, txRuleError(wire.RejectInsufficientFee, str)
+	}
+
+	// Evict the transactions with the lowest fee rates when the pool is
+	// full.  The package is rejected when any of its transactions are
+	// among them.
+	mp.trimToSize()
+	for _, txD := range added {
+		if !mp.isTransactionInPool(txD.Tx.Hash()) {
+			rollback()
+			str := fmt.Sprintf("package transaction %v was evicted "+
+				"from the full mempool due to the low fee rate "+
+				"of the package", txD.Tx.Hash())
+			return nil, txRuleError(wire.RejectInsufficientFee, str)
+		}
+	}
+
+	// The package transactions may have been in the orphan pool while
+	// their parents were missing.  Remove them along with the orphans that
+	// double spend them and accept any orphans which spend their outputs.
+	for _, txD := range added {
+		mp.removeOrphan(txD.Tx, false)
+	}
+	acceptedTxns := make([]*TxDesc, len(added))
+	copy(acceptedTxns, added)
+	for _, txD := range added {
+		acceptedTxns = append(acceptedTxns, mp.processOrphans(txD.Tx)...)
+	}
+
+	log.Debugf("Accepted package of %d %s (package fees: %d, pool size: "+
+		"%v)", len(added), pickNoun(len(added), "transaction",
+		"transactions"), fees, len(mp.pool))
+
+	return acceptedTxns, nil
+}
+
+// AcceptPackage validates the passed package of related transactions and adds
+// it to the memory pool atomically, meaning either all of its transactions
+// which are not already in the pool are accepted or none of them are.
+//
+// The fee requirements are evaluated for the package as a whole instead of for
+// each transaction individually, so a transaction paying a low or no fee is
+// accepted along with its children when they pay enough for the package.  This
+// allows fee bumping a transaction via child-pays-for-parent (CPFP) even when
+// it would not be accepted on its own.  See checkPackageSanity for the
+// requirements on the structure of the package.
+//
+// It returns a slice of transactions added to the mempool.  When the error is
+// nil, the list includes the package transactions which were not already in the
+// pool in package order, followed by any orphan transactions that were accepted
+// as a result.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) AcceptPackage(txns []*hdfutil.Tx) ([]*TxDesc, error) {
+	// Protect concurrent access.
+	mp.mtx.Lock()
+	mp.expire()
+	acceptedTxns, err := mp.acceptPackage(txns)
+	mp.mtx.Unlock()
+
+	return acceptedTxns, err
+}
@@ -0,0 +1,196 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/wire"
+	"github.com/ifishnet/hdfutil"
+)
+
+// TestCheckPackageSanity ensures packages which are not properly structured
+// are rejected.
+func TestCheckPackageSanity(t *testing.T) {
+	t.Parallel()
+
+	// newTx returns a transaction with two outputs which spends the passed
+	// outputs, or an output of an unrelated transaction when none are
+	// passed.
+	var nonce uint32
+	newTx := func(prevOuts ...*wire.OutPoint) *hdfutil.Tx {
+		nonce++
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		if len(prevOuts) == 0 {
+			prevOut := wire.NewOutPoint(&chainhash.Hash{0x01}, nonce)
+			msgTx.AddTxIn(wire.NewTxIn(prevOut, nil, nil))
+		}
+		for _, prevOut := range prevOuts {
+			msgTx.AddTxIn(wire.NewTxIn(prevOut, nil, nil))
+		}
+		msgTx.AddTxOut(wire.NewTxOut(int64(nonce), nil))
+		msgTx.AddTxOut(wire.NewTxOut(int64(nonce), nil))
+		return hdfutil.NewTx(msgTx)
+	}
+
+	// output returns the outpoint of the output of the passed transaction
+	// with the passed index.
+	output := func(tx *hdfutil.Tx, index uint32) *wire.OutPoint {
+		return wire.NewOutPoint(tx.Hash(), index)
+	}
+
+	parent := newTx()
+	parent2 := newTx()
+	child := newTx(output(parent, 0))
+	child2 := newTx(output(parent, 1))
+	grandchild := newTx(output(child, 0), output(parent2, 0))
+	unrelated := newTx()
+
+	// Spend the same output of the parent twice.
+	conflictMsgTx := child.MsgTx().Copy()
+	conflictMsgTx.TxOut[0].Value++
+	conflict := hdfutil.NewTx(conflictMsgTx)
+
+	tooMany := []*hdfutil.Tx{newTx()}
+	for len(tooMany) <= MaxPackageCount {
+		prev := tooMany[len(tooMany)-1]
+		tooMany = append(tooMany, newTx(output(prev, 0)))
+	}
+
+	tests := []struct {
+		name  string
+		txns  []*hdfutil.Tx
+		valid bool
+	}{
+		{"single transaction", []*hdfutil.Tx{parent}, true},
+		{"parent and child", []*hdfutil.Tx{parent, child}, true},
+		{"parent and children", []*hdfutil.Tx{parent, child, child2}, true},
+		{"parents and child", []*hdfutil.Tx{parent, child, parent2,
+			grandchild}, true},
+		{"max transactions", tooMany[:MaxPackageCount], true},
+		{"empty", nil, false},
+		{"too many transactions", tooMany, false},
+		{"duplicate", []*hdfutil.Tx{parent, child, child}, false},
+		{"child before parent", []*hdfutil.Tx{child, parent}, false},
+		{"conflicting children", []*hdfutil.Tx{parent, child, conflict},
+			false},
+		{"disconnected", []*hdfutil.Tx{parent, child, unrelated}, false},
+	}
+
+	for _, test := range tests {
+		err := checkPackageSanity(test.txns)
+		if test.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s: invalid package was not rejected",
+				test.name)
+		}
+	}
+}
+
+// TestAcceptPackage ensures a parent which pays too little fees to be accepted
+// on its own is accepted along with a child which pays enough fees for both of
+// them, and that packages are accepted atomically.
+func TestAcceptPackage(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+	coinbase := ctx.addCoinbaseTx(2)
+
+	createTx := func(output spendableOutput, fee hdfutil.Amount) *hdfutil.Tx {
+		tx, err := harness.CreateSignedTx([]spendableOutput{output}, 1,
+			fee, false)
+		if err != nil {
+			t.Fatalf("unable to create transaction: %v", err)
+		}
+		return tx
+	}
+
+	// Raise the minimum fee rate as if the pool was full so a transaction
+	// paying no fee is rejected on its own.
+	harness.txPool.mtx.Lock()
+	harness.txPool.rollingMinFee = 5000
+	harness.txPool.lastRollingFeeUpdate = time.Now()
+	harness.txPool.mtx.Unlock()
+
+	parent := createTx(txOutToSpendableOut(coinbase, 0), 0)
+	_, err = harness.txPool.ProcessTransaction(parent, false, false, 0)
+	if err == nil {
+		t.Fatal("ProcessTransaction: accepted parent paying no fee")
+	}
+
+	// Ensure a package whose child does not pay enough fees for the
+	// package is rejected without adding any of its transactions.
+	lowFeeChild := createTx(txOutToSpendableOut(parent, 0), 1000)
+	_, err = harness.txPool.AcceptPackage([]*hdfutil.Tx{parent, lowFeeChild})
+	if err == nil {
+		t.Fatal("AcceptPackage: accepted package paying too little fees")
+	}
+	if code, _ := extractRejectCode(err); code != wire.RejectInsufficientFee {
+		t.Fatalf("AcceptPackage: unexpected reject code: got %v, want "+
+			"%v", code, wire.RejectInsufficientFee)
+	}
+	testPoolMembership(ctx, parent, false, false)
+	testPoolMembership(ctx, lowFeeChild, false, false)
+
+	// Add a child which pays enough fees for the package to the orphan
+	// pool and ensure the package is accepted along with an orphan which
+	// spends the child.
+	child := createTx(txOutToSpendableOut(parent, 0), 10000)
+	grandchild := createTx(txOutToSpendableOut(child, 0), 10000)
+	for _, tx := range []*hdfutil.Tx{child, grandchild} {
+		_, err := harness.txPool.ProcessTransaction(tx, true, false, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+		}
+		testPoolMembership(ctx, tx, true, false)
+	}
+	accepted, err := harness.txPool.AcceptPackage([]*hdfutil.Tx{parent,
+		child})
+	if err != nil {
+		t.Fatalf("AcceptPackage: unexpected error: %v", err)
+	}
+	wantAccepted := []*hdfutil.Tx{parent, child, grandchild}
+	if len(accepted) != len(wantAccepted) {
+		t.Fatalf("AcceptPackage: got %d accepted transactions, want %d",
+			len(accepted), len(wantAccepted))
+	}
+	for i, txD := range accepted {
+		if *txD.Tx.Hash() != *wantAccepted[i].Hash() {
+			t.Fatalf("AcceptPackage: accepted transaction #%d is %v, "+
+				"want %v", i, txD.Tx.Hash(), wantAccepted[i].Hash())
+		}
+		testPoolMembership(ctx, txD.Tx, false, true)
+	}
+
+	// Ensure a package whose transactions are all in the pool already is
+	// accepted without reporting any transactions.
+	accepted, err = harness.txPool.AcceptPackage([]*hdfutil.Tx{parent,
+		child})
+	if err != nil {
+		t.Fatalf("AcceptPackage: unexpected error: %v", err)
+	}
+	if len(accepted) != 0 {
+		t.Fatalf("AcceptPackage: got %d accepted transactions, want 0",
+			len(accepted))
+	}
+
+	// Ensure packages which replace transactions in the pool are rejected.
+	replacement := createTx(txOutToSpendableOut(coinbase, 0), 20000)
+	_, err = harness.txPool.AcceptPackage([]*hdfutil.Tx{replacement})
+	if err == nil {
+		t.Fatal("AcceptPackage: accepted replacement package")
+	}
+	testPoolMembership(ctx, replacement, false, false)
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+
+	"github.com/ifishnet/hdfd/blockchain"
+)
+
+// writeGauge writes a gauge with the passed name, help text, and value to w in
+// the Prometheus text exposition format.
+func writeGauge(w io.Writer, name, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+	fmt.Fprintf(w, "%s %g\n", name, value)
+}
+
+// workToFloat returns the passed cumulative work as a float64.  The precision
+// lost by the conversion is irrelevant for monitoring purposes.
+func workToFloat(work *big.Int) float64 {
+	f, _ := new(big.Float).SetInt(work).Float64()
+	return f
+}
+
+// chainMetricsHandler returns an HTTP handler which serves gauges describing
+// how far the main chain is behind the best known header in the Prometheus text
+// exposition format.  An alert on the number of blocks behind which does not
+// decrease over time reveals stuck block validation.
+func chainMetricsHandler(chain *blockchain.BlockChain) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chainWork := chain.ChainWork()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeGauge(w, "hdfd_chain_tip_height",
+			"Height of the main chain tip.",
+			float64(chainWork.TipHeight))
+		writeGauge(w, "hdfd_chain_tip_work",
+			"Total cumulative work of the main chain.",
+			workToFloat(chainWork.TipWork))
+		writeGauge(w, "hdfd_chain_best_header_height",
+			"Height of the best known header.",
+			float64(chainWork.BestHeaderHeight))
+		writeGauge(w, "hdfd_chain_best_header_work",
+			"Total cumulative work of the best known header.",
+			workToFloat(chainWork.BestHeaderWork))
+		writeGauge(w, "hdfd_chain_blocks_behind",
+			"Number of blocks the main chain is behind the best "+
+				"known header.",
+			float64(chainWork.BlocksBehind()))
+		writeGauge(w, "hdfd_chain_work_behind",
+			"Amount of work the main chain is behind the best known "+
+				"header.",
+			workToFloat(chainWork.WorkBehind()))
+	})
+}
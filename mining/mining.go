@@ -8,6 +8,8 @@ import (
 	"bytes"
 	"container/heap"
 	"fmt"
+	"math"
+	"sync"
 	"time"
 
 	"github.com/ifishnet/hdfd/blockchain"
@@ -31,6 +33,10 @@ const (
 	// and is used to monitor BIP16 support as well as blocks that are
 	// generated via hdfd.
 	CoinbaseFlags = "/P2SH/hdfd/"
+
+	// NumVersionBits is the number of bits of the block version which are
+	// available to signal for rule change deployments as defined by BIP9.
+	NumVersionBits = 29
 )
 
 // TxDesc is a descriptor about a transaction in a transaction source along with
@@ -50,6 +56,9 @@ type TxDesc struct {
 	Fee int64
 
 	// FeePerKB is the fee the transaction pays in Satoshi per 1000 bytes.
+	// Sources may count the size of transactions with many signature
+	// operations relative to their size as larger than it is, so they are
+	// not favored over other transactions when building block templates.
 	FeePerKB int64
 }
 
@@ -237,11 +246,15 @@ func mergeUtxoView(viewA *blockchain.UtxoViewpoint, viewB *blockchain.UtxoViewpo
 // standardCoinbaseScript returns a standard script suitable for use as the
 // signature script of the coinbase transaction of a new block.  In particular,
 // it starts with the block height that is required by version 2 blocks and adds
-// the extra nonce as well as additional coinbase flags.
-func standardCoinbaseScript(nextBlockHeight int32, extraNonce uint64) ([]byte, error) {
-	return txscript.NewScriptBuilder().AddInt64(int64(nextBlockHeight)).
-		AddInt64(int64(extraNonce)).AddData([]byte(CoinbaseFlags)).
-		Script()
+// the extra nonce as well as additional coinbase flags followed by the passed
+// coinbase data when it is not empty.
+func standardCoinbaseScript(nextBlockHeight int32, extraNonce uint64, coinbaseData []byte) ([]byte, error) {
+	builder := txscript.NewScriptBuilder().AddInt64(int64(nextBlockHeight)).
+		AddInt64(int64(extraNonce)).AddData([]byte(CoinbaseFlags))
+	if len(coinbaseData) > 0 {
+		builder.AddData(coinbaseData)
+	}
+	return builder.Script()
 }
 
 // createCoinbaseTx returns a coinbase transaction paying an appropriate subsidy
@@ -341,6 +354,27 @@ func medianAdjustedTime(chainState *blockchain.BestState, timeSource blockchain.
 	return newTimestamp
 }
 
+// TemplateOptions houses the options used to customize the block templates
+// created by a block template generator.  Unlike the mining policy, they may be
+// changed while the generator is in use.
+type TemplateOptions struct {
+	// CoinbaseData is additional data to add to the end of the signature
+	// script of the coinbase transaction.
+	CoinbaseData []byte
+
+	// VersionBits is a mask of the version bits to set in the version of
+	// the block in addition to the ones set for the rule change
+	// deployments.  Only the bits available for version bits signalling
+	// as defined by NumVersionBits may be set.
+	VersionBits uint32
+
+	// MinTxFeeRate is the minimum fee in Satoshi/1000 bytes of the
+	// transactions to include.  Unlike the TxMinFreeFee policy setting, it
+	// applies regardless of the minimum block size and the priority of the
+	// transactions.
+	MinTxFeeRate hdfutil.Amount
+}
+
 // BlkTmplGenerator provides a type that can be used to generate block templates
 // based on a given mining policy and source of transactions to choose from.
 // It also houses additional state required in order to ensure the templates
@@ -353,6 +387,9 @@ type BlkTmplGenerator struct {
 	timeSource  blockchain.MedianTimeSource
 	sigCache    *txscript.SigCache
 	hashCache   *txscript.HashCache
+
+	optionsMtx sync.RWMutex
+	options    TemplateOptions
 }
 
 // NewBlkTmplGenerator returns a new block template generator for the given
@@ -378,6 +415,62 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 	}
 }
 
+// SetTemplateOptions replaces the options used to customize the block templates
+// created by the generator with the passed options.  An error is returned when
+// the coinbase data would cause the coinbase script to exceed the maximum
+// allowed length or when version bits which are not available for signalling
+// are set.
+//
+// This function is safe for concurrent access.
+func (g *BlkTmplGenerator) SetTemplateOptions(opts *TemplateOptions) error {
+	// Ensure the coinbase script with the largest possible height and extra
+	// nonce does not exceed the maximum length once the data is added.
+	coinbaseScript, err := standardCoinbaseScript(math.MaxInt32, math.MaxInt64,
+		opts.CoinbaseData)
+	if err != nil {
+		return err
+	}
+	if len(coinbaseScript) > blockchain.MaxCoinbaseScriptLen {
+		return fmt.Errorf("coinbase data of %d bytes causes the "+
+			"coinbase transaction script to exceed the max length "+
+			"of %d bytes", len(opts.CoinbaseData),
+			blockchain.MaxCoinbaseScriptLen)
+	}
+
+	if opts.VersionBits>>NumVersionBits != 0 {
+		return fmt.Errorf("version bits %#08x include bits which are "+
+			"not available for signalling", opts.VersionBits)
+	}
+	if opts.MinTxFeeRate < 0 {
+		return fmt.Errorf("minimum transaction fee rate %d may not be "+
+			"negative", opts.MinTxFeeRate)
+	}
+
+	coinbaseData := make([]byte, len(opts.CoinbaseData))
+	copy(coinbaseData, opts.CoinbaseData)
+
+	g.optionsMtx.Lock()
+	g.options = TemplateOptions{
+		CoinbaseData: coinbaseData,
+		VersionBits:  opts.VersionBits,
+		MinTxFeeRate: opts.MinTxFeeRate,
+	}
+	g.optionsMtx.Unlock()
+	return nil
+}
+
+// TemplateOptions returns the options currently used to customize the block
+// templates created by the generator.  The returned coinbase data must be
+// treated as immutable since it is shared by all callers.
+//
+// This function is safe for concurrent access.
+func (g *BlkTmplGenerator) TemplateOptions() TemplateOptions {
+	g.optionsMtx.RLock()
+	opts := g.options
+	g.optionsMtx.RUnlock()
+	return opts
+}
+
 // NewBlockTemplate returns a new block template that is ready to be solved
 // using the transactions from the passed transaction source pool and a coinbase
 // that either pays to the passed address if it is not nil, or a coinbase that
@@ -414,6 +507,9 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 // nonzero, in which case the block will be filled with the low-fee/free
 // transactions until the block size reaches that minimum size.
 //
+// Transactions which pay less than the minimum fee rate of the template options
+// set via SetTemplateOptions are always skipped.
+//
 // Any transactions which would cause the block to exceed the BlockMaxSize
 // policy setting, exceed the maximum allowed signature operations per block, or
 // otherwise cause the block to be invalid are skipped.
@@ -445,6 +541,10 @@ func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress hdfutil.Address) (*Bloc
 	best := g.chain.BestSnapshot()
 	nextBlockHeight := best.Height + 1
 
+	// Use the same template options for the entire template even if they
+	// are changed concurrently.
+	opts := g.TemplateOptions()
+
 	// Create a standard coinbase transaction paying to the provided
 	// address.  NOTE: The coinbase value will be updated to include the
 	// fees from the selected transactions later after they have actually
@@ -454,7 +554,8 @@ func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress hdfutil.Address) (*Bloc
 	// same value to the same public key address would otherwise be an
 	// identical transaction for block version 1).
 	extraNonce := uint64(0)
-	coinbaseScript, err := standardCoinbaseScript(nextBlockHeight, extraNonce)
+	coinbaseScript, err := standardCoinbaseScript(nextBlockHeight,
+		extraNonce, opts.CoinbaseData)
 	if err != nil {
 		return nil, err
 	}
@@ -663,6 +764,16 @@ mempoolLoop:
 		// Grab any transactions which depend on this one.
 		deps := dependers[*tx.Hash()]
 
+		// Skip transactions which pay less than the minimum fee rate of
+		// the template options.
+		if prioItem.feePerKB < int64(opts.MinTxFeeRate) {
+			log.Tracef("Skipping tx %s with feePerKB %d < "+
+				"MinTxFeeRate %d", tx.Hash(), prioItem.feePerKB,
+				opts.MinTxFeeRate)
+			logSkippedDeps(tx, deps)
+			continue
+		}
+
 		// Enforce maximum block size.  Also check for overflow.
 		txWeight := uint32(blockchain.GetTransactionWeight(tx))
 		blockPlusTxWeight := blockWeight + txWeight
@@ -855,6 +966,9 @@ mempoolLoop:
 		return nil, err
 	}
 
+	// Additionally signal for the version bits of the template options.
+	nextBlockVersion |= int32(opts.VersionBits)
+
 	// Create a new block ready to be solved.
 	merkles := blockchain.BuildMerkleTreeStore(blockTxns, false)
 	var msgBlock wire.MsgBlock
@@ -922,10 +1036,13 @@ func (g *BlkTmplGenerator) UpdateBlockTime(msgBlock *wire.MsgBlock) error {
 
 // UpdateExtraNonce updates the extra nonce in the coinbase script of the passed
 // block by regenerating the coinbase script with the passed value and block
-// height.  It also recalculates and updates the new merkle root that results
-// from changing the coinbase script.
+// height along with the coinbase data of the current template options.  It
+// also recalculates and updates the new merkle root that results from changing
+// the coinbase script.
 func (g *BlkTmplGenerator) UpdateExtraNonce(msgBlock *wire.MsgBlock, blockHeight int32, extraNonce uint64) error {
-	coinbaseScript, err := standardCoinbaseScript(blockHeight, extraNonce)
+	coinbaseData := g.TemplateOptions().CoinbaseData
+	coinbaseScript, err := standardCoinbaseScript(blockHeight, extraNonce,
+		coinbaseData)
 	if err != nil {
 		return err
 	}
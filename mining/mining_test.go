@@ -5,6 +5,7 @@
 package mining
 
 import (
+	"bytes"
 	"container/heap"
 	"math/rand"
 	"testing"
@@ -108,3 +109,66 @@ func TestTxFeePrioHeap(t *testing.T) {
 		highest = prioItem
 	}
 }
+
+// TestSetTemplateOptions ensures the template options are validated and that
+// the coinbase data is copied when they are set.
+func TestSetTemplateOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    TemplateOptions
+		wantErr bool
+	}{{
+		name: "no options",
+		opts: TemplateOptions{},
+	}, {
+		name: "all options",
+		opts: TemplateOptions{
+			CoinbaseData: []byte("/pool/"),
+			VersionBits:  1<<0 | 1<<28,
+			MinTxFeeRate: 1000,
+		},
+	}, {
+		name: "max coinbase data",
+		opts: TemplateOptions{CoinbaseData: make([]byte, 73)},
+	}, {
+		name:    "coinbase data too long",
+		opts:    TemplateOptions{CoinbaseData: make([]byte, 74)},
+		wantErr: true,
+	}, {
+		name:    "version bit not available for signalling",
+		opts:    TemplateOptions{VersionBits: 1 << NumVersionBits},
+		wantErr: true,
+	}, {
+		name:    "negative min tx fee rate",
+		opts:    TemplateOptions{MinTxFeeRate: -1},
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		var g BlkTmplGenerator
+		err := g.SetTemplateOptions(&test.opts)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: unexpected error -- got %v, want error %v",
+				test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		opts := g.TemplateOptions()
+		if !bytes.Equal(opts.CoinbaseData, test.opts.CoinbaseData) ||
+			opts.VersionBits != test.opts.VersionBits ||
+			opts.MinTxFeeRate != test.opts.MinTxFeeRate {
+
+			t.Errorf("%s: unexpected options -- got %+v, want %+v",
+				test.name, opts, test.opts)
+			continue
+		}
+		if len(opts.CoinbaseData) > 0 &&
+			&opts.CoinbaseData[0] == &test.opts.CoinbaseData[0] {
+
+			t.Errorf("%s: coinbase data was not copied", test.name)
+		}
+	}
+}
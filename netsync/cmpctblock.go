@@ -0,0 +1,210 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+
+	"github.com/ifishnet/hdfd/blockchain"
+	peerpkg "github.com/ifishnet/hdfd/peer"
+	"github.com/ifishnet/hdfd/wire"
+	"github.com/ifishnet/hdfutil"
+)
+
+// maxPartialBlocks is the maximum number of blocks announced by way of compact
+// blocks which may wait for their missing transactions at once.  Blocks are
+// requested in full instead once the limit is reached.
+const maxPartialBlocks = 16
+
+// CmpctBlockStats describes the outcomes of reconstructing the blocks announced
+// by way of compact blocks (BIP0152).
+type CmpctBlockStats struct {
+	// Received is the number of compact blocks which were attempted to be
+	// reconstructed.
+	Received uint64
+
+	// Reconstructed is the number of blocks which were reconstructed from
+	// the compact block and the mempool alone.
+	Reconstructed uint64
+
+	// ReconstructedWithBlockTxn is the number of blocks which were
+	// reconstructed after requesting the transactions missing from the
+	// mempool by way of getblocktxn.
+	ReconstructedWithBlockTxn uint64
+
+	// RequestedTxns is the total number of transactions which were missing
+	// from the mempool and requested by way of getblocktxn.
+	RequestedTxns uint64
+
+	// Fallbacks is the number of blocks which were requested in full
+	// because they could not be reconstructed.
+	Fallbacks uint64
+}
+
+// cmpctBlockStats tracks the outcomes of reconstructing compact blocks.
+//
+// It is safe for concurrent access.
+type cmpctBlockStats struct {
+	received                  uint64 // atomic
+	reconstructed             uint64 // atomic
+	reconstructedWithBlockTxn uint64 // atomic
+	requestedTxns             uint64 // atomic
+	fallbacks                 uint64 // atomic
+}
+
+// snapshot returns the current stats.
+//
+// This function is safe for concurrent access.
+func (s *cmpctBlockStats) snapshot() CmpctBlockStats {
+	return CmpctBlockStats{
+		Received:                  atomic.LoadUint64(&s.received),
+		Reconstructed:             atomic.LoadUint64(&s.reconstructed),
+		ReconstructedWithBlockTxn: atomic.LoadUint64(&s.reconstructedWithBlockTxn),
+		RequestedTxns:             atomic.LoadUint64(&s.requestedTxns),
+		Fallbacks:                 atomic.LoadUint64(&s.fallbacks),
+	}
+}
+
+// partialBlock is a block announced by way of a compact block which is being
+// reconstructed from the transactions in the mempool and those requested from
+// the peer that announced it.
+type partialBlock struct {
+	header        wire.BlockHeader
+	txns          []*wire.MsgTx
+	missing       []uint32
+	peer          *peerpkg.Peer
+	requestedTxns bool
+}
+
+// newPartialBlock returns a partial block for the passed compact block, which
+// must use witness transaction hashes for its short ids, with the prefilled
+// transactions and the matching passed mempool transactions filled in.
+//
+// Transactions whose short id is matched by more than one of the mempool
+// transactions are left missing so they are requested from the peer.  An error
+// is returned when the compact block is malformed or contains duplicate short
+// ids, in which case the block must be requested in full.
+func newPartialBlock(msg *wire.MsgCmpctBlock, peer *peerpkg.Peer,
+	mempoolTxns []*hdfutil.Tx) (*partialBlock, error) {
+
+	numTxns := msg.TotalTxns()
+	if numTxns == 0 {
+		return nil, fmt.Errorf("compact block does not have any " +
+			"transactions")
+	}
+	if numTxns > math.MaxUint16+1 {
+		// BIP0152 requires the transaction indexes to fit into a
+		// uint16.
+		return nil, fmt.Errorf("compact block has too many "+
+			"transactions (%d)", numTxns)
+	}
+
+	pb := &partialBlock{
+		header: msg.Header,
+		txns:   make([]*wire.MsgTx, numTxns),
+		peer:   peer,
+	}
+	for _, prefilled := range msg.PrefilledTxns {
+		if int(prefilled.Index) >= numTxns || prefilled.Tx == nil {
+			return nil, fmt.Errorf("invalid prefilled transaction "+
+				"at index %d", prefilled.Index)
+		}
+		pb.txns[prefilled.Index] = prefilled.Tx
+	}
+
+	// The short ids describe the transactions which were not prefilled in
+	// the order they appear in the block.
+	slots := make(map[uint64]int, len(msg.ShortIDs))
+	slot := 0
+	for _, id := range msg.ShortIDs {
+		for pb.txns[slot] != nil {
+			slot++
+		}
+		if _, ok := slots[id]; ok {
+			return nil, fmt.Errorf("duplicate short id %x", id)
+		}
+		slots[id] = slot
+		slot++
+	}
+
+	// Fill in the mempool transactions which match a short id unless the
+	// short id is ambiguous.
+	k0, k1 := msg.ShortIDKeys()
+	ambiguous := make(map[int]struct{})
+	for _, tx := range mempoolTxns {
+		slot, ok := slots[wire.CalcShortTxID(k0, k1, tx.WitnessHash())]
+		if !ok {
+			continue
+		}
+		if _, ok := ambiguous[slot]; ok {
+			continue
+		}
+		if pb.txns[slot] != nil {
+			pb.txns[slot] = nil
+			ambiguous[slot] = struct{}{}
+			continue
+		}
+		pb.txns[slot] = tx.MsgTx()
+	}
+
+	for i, tx := range pb.txns {
+		if tx == nil {
+			pb.missing = append(pb.missing, uint32(i))
+		}
+	}
+	return pb, nil
+}
+
+// fill fills in the missing transactions of the partial block with the passed
+// transactions, which must be provided in the order they appear in the block.
+func (pb *partialBlock) fill(txns []*wire.MsgTx) error {
+	if len(txns) != len(pb.missing) {
+		return fmt.Errorf("received %d transactions instead of the %d "+
+			"missing ones", len(txns), len(pb.missing))
+	}
+	for i, index := range pb.missing {
+		if txns[i] == nil {
+			return fmt.Errorf("missing transaction at index %d",
+				index)
+		}
+		pb.txns[index] = txns[i]
+	}
+	pb.missing = nil
+	pb.requestedTxns = true
+	return nil
+}
+
+// block returns the reconstructed block once all of its transactions are
+// known.  An error is returned when the transactions do not match the merkle
+// root or witness commitment of the block, which happens when a short id
+// matched the wrong transaction, in which case the block must be requested in
+// full.
+func (pb *partialBlock) block() (*hdfutil.Block, error) {
+	if len(pb.missing) != 0 {
+		return nil, fmt.Errorf("%d transactions are still missing",
+			len(pb.missing))
+	}
+
+	msgBlock := wire.NewMsgBlock(&pb.header)
+	for _, tx := range pb.txns {
+		if err := msgBlock.AddTransaction(tx); err != nil {
+			return nil, err
+		}
+	}
+	block := hdfutil.NewBlock(msgBlock)
+
+	merkles := blockchain.BuildMerkleTreeStore(block.Transactions(), false)
+	merkleRoot := merkles[len(merkles)-1]
+	if !pb.header.MerkleRoot.IsEqual(merkleRoot) {
+		return nil, fmt.Errorf("reconstructed transactions do not "+
+			"match the merkle root %v", pb.header.MerkleRoot)
+	}
+	if err := blockchain.ValidateWitnessCommitment(block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/ifishnet/hdfd/blockchain"
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/wire"
+	"github.com/ifishnet/hdfutil"
+)
+
+// testCmpctTx returns a unique transaction for the passed number.  Number 0
+// returns a coinbase transaction.
+func testCmpctTx(n uint32) *wire.MsgTx {
+	prevOut := wire.NewOutPoint(&chainhash.Hash{byte(n)}, n)
+	if n == 0 {
+		prevOut = wire.NewOutPoint(&chainhash.Hash{}, math.MaxUint32)
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(prevOut, []byte{byte(n)}, nil))
+	tx.AddTxOut(wire.NewTxOut(int64(n)+1, nil))
+	return tx
+}
+
+// testCmpctBlock returns a block made up of a coinbase and the passed number
+// of transactions along with a compact block for it with the coinbase
+// prefilled.
+func testCmpctBlock(numTxns uint32) (*wire.MsgBlock, *wire.MsgCmpctBlock) {
+	txns := []*hdfutil.Tx{hdfutil.NewTx(testCmpctTx(0))}
+	for i := uint32(1); i <= numTxns; i++ {
+		txns = append(txns, hdfutil.NewTx(testCmpctTx(i)))
+	}
+	merkles := blockchain.BuildMerkleTreeStore(txns, false)
+	header := wire.BlockHeader{Version: 4, MerkleRoot: *merkles[len(merkles)-1]}
+	block := wire.NewMsgBlock(&header)
+	for _, tx := range txns {
+		block.AddTransaction(tx.MsgTx())
+	}
+
+	msg := &wire.MsgCmpctBlock{Header: header, Nonce: 42}
+	msg.AddPrefilledTx(0, block.Transactions[0])
+	k0, k1 := msg.ShortIDKeys()
+	for _, tx := range block.Transactions[1:] {
+		wtxid := tx.WitnessHash()
+		msg.AddShortID(wire.CalcShortTxID(k0, k1, &wtxid))
+	}
+	return block, msg
+}
+
+// TestPartialBlock ensures blocks are reconstructed from compact blocks with
+// the transactions in the mempool and the requested missing transactions.
+func TestPartialBlock(t *testing.T) {
+	t.Parallel()
+
+	block, msg := testCmpctBlock(3)
+	mempool := []*hdfutil.Tx{
+		hdfutil.NewTx(block.Transactions[1]),
+		hdfutil.NewTx(block.Transactions[3]),
+		hdfutil.NewTx(testCmpctTx(10)),
+	}
+	pb, err := newPartialBlock(msg, nil, mempool)
+	if err != nil {
+		t.Fatalf("newPartialBlock: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(pb.missing, []uint32{2}) {
+		t.Fatalf("unexpected missing transactions %v", pb.missing)
+	}
+	if _, err := pb.block(); err == nil {
+		t.Fatal("block: did not fail with missing transactions")
+	}
+
+	if err := pb.fill(nil); err == nil {
+		t.Fatal("fill: did not reject wrong number of transactions")
+	}
+	err = pb.fill([]*wire.MsgTx{block.Transactions[2]})
+	if err != nil {
+		t.Fatalf("fill: unexpected error: %v", err)
+	}
+	reconstructed, err := pb.block()
+	if err != nil {
+		t.Fatalf("block: unexpected error: %v", err)
+	}
+	if *reconstructed.Hash() != block.BlockHash() ||
+		len(reconstructed.Transactions()) != 4 {
+
+		t.Fatalf("reconstructed block does not match the original")
+	}
+
+	// Transactions which do not match the merkle root must be rejected.
+	pb, err = newPartialBlock(msg, nil, mempool)
+	if err != nil {
+		t.Fatalf("newPartialBlock: unexpected error: %v", err)
+	}
+	if err := pb.fill([]*wire.MsgTx{testCmpctTx(11)}); err != nil {
+		t.Fatalf("fill: unexpected error: %v", err)
+	}
+	if _, err := pb.block(); err == nil {
+		t.Fatal("block: did not reject mismatched transactions")
+	}
+}
+
+// TestPartialBlockShortIDs ensures duplicate short ids in a compact block are
+// rejected and short ids matched by several mempool transactions are treated
+// as missing.
+func TestPartialBlockShortIDs(t *testing.T) {
+	t.Parallel()
+
+	block, msg := testCmpctBlock(2)
+	ambiguous := hdfutil.NewTx(block.Transactions[1])
+	mempool := []*hdfutil.Tx{
+		ambiguous,
+		hdfutil.NewTx(block.Transactions[2]),
+		ambiguous,
+		ambiguous,
+	}
+	pb, err := newPartialBlock(msg, nil, mempool)
+	if err != nil {
+		t.Fatalf("newPartialBlock: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(pb.missing, []uint32{1}) {
+		t.Fatalf("unexpected missing transactions %v", pb.missing)
+	}
+
+	msg.AddShortID(msg.ShortIDs[0])
+	if _, err := newPartialBlock(msg, nil, mempool); err == nil {
+		t.Fatal("newPartialBlock: did not reject duplicate short ids")
+	}
+}
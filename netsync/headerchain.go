@@ -0,0 +1,574 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ifishnet/hdfd/blockchain"
+	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// chainHeader is a block header in a HeaderChain along with the details needed
+// to validate the headers which extend it.
+type chainHeader struct {
+	header       wire.BlockHeader
+	hash         chainhash.Hash
+	height       int32
+	workSum      *big.Int
+	parent       *chainHeader
+	filterHeader *chainhash.Hash
+}
+
+// Ensure chainHeader implements the blockchain.HeaderCtx interface.
+var _ blockchain.HeaderCtx = (*chainHeader)(nil)
+
+// Height returns the height of the header in the chain.
+//
+// This is part of the blockchain.HeaderCtx interface implementation.
+func (h *chainHeader) Height() int32 {
+	return h.height
+}
+
+// Bits returns the difficulty bits of the header.
+//
+// This is part of the blockchain.HeaderCtx interface implementation.
+func (h *chainHeader) Bits() uint32 {
+	return h.header.Bits
+}
+
+// Timestamp returns the timestamp of the header as the number of seconds since
+// the unix epoch.
+//
+// This is part of the blockchain.HeaderCtx interface implementation.
+func (h *chainHeader) Timestamp() int64 {
+	return h.header.Timestamp.Unix()
+}
+
+// Parent returns the previous header or nil when it is not known.
+//
+// This is part of the blockchain.HeaderCtx interface implementation.
+func (h *chainHeader) Parent() blockchain.HeaderCtx {
+	// Avoid returning a nil header wrapped in a non-nil interface.
+	if h.parent == nil {
+		return nil
+	}
+	return h.parent
+}
+
+// RelativeAncestorCtx returns the ancestor header a relative 'distance' headers
+// before this one or nil when it is not known.
+//
+// This is part of the blockchain.HeaderCtx interface implementation.
+func (h *chainHeader) RelativeAncestorCtx(distance int32) blockchain.HeaderCtx {
+	ancestor := h
+	for i := int32(0); i < distance && ancestor != nil; i++ {
+		ancestor = ancestor.parent
+	}
+	if ancestor == nil {
+		return nil
+	}
+	return ancestor
+}
+
+// HeaderChain houses the validated block headers of a chain without its
+// blocks.  It is used by the sync manager in headers-only mode to track the
+// best chain of headers known to the connected peers, and exposes it to
+// consumers such as header relaying and filter serving.
+//
+// The chain is built on top of a window of trusted base headers.  Every header
+// which extends it is checked to have valid proof of work, the required
+// difficulty, a valid timestamp and version, and to match the checkpoints.  The
+// best chain is the one with the most cumulative work, which is only
+// comparable between chains sharing the same base.
+//
+// It is safe for concurrent access.
+type HeaderChain struct {
+	mtx         sync.RWMutex
+	chainCtx    blockchain.ChainCtx
+	timeSource  blockchain.MedianTimeSource
+	checkpoints []chaincfg.Checkpoint
+	index       map[chainhash.Hash]*chainHeader
+	mainChain   []*chainHeader // indexed by height less the base height
+	baseHeight  int32
+	filterTip   int32
+}
+
+// NewHeaderChain returns a header chain for the chain with the passed
+// parameters built on top of the passed base headers, the first of which is at
+// the passed height.  The base headers must connect to each other and are
+// trusted, so they are typically loaded from the block chain.  At least the
+// number of headers in a difficulty retarget period must be provided unless
+// the first one is the genesis block so the required difficulty of the headers
+// which extend them can be calculated.
+//
+// Headers which extend the chain are checked against the passed checkpoints,
+// which may be nil to disable them.
+func NewHeaderChain(params *chaincfg.Params, checkpoints []chaincfg.Checkpoint,
+	timeSource blockchain.MedianTimeSource, baseHeight int32,
+	base []*wire.BlockHeader) (*HeaderChain, error) {
+
+	if len(base) == 0 {
+		return nil, fmt.Errorf("no base headers provided")
+	}
+
+	c := &HeaderChain{
+		chainCtx:    blockchain.NewChainCtx(params),
+		timeSource:  timeSource,
+		checkpoints: checkpoints,
+		index:       make(map[chainhash.Hash]*chainHeader),
+		baseHeight:  baseHeight,
+		filterTip:   baseHeight - 1,
+	}
+	var parent *chainHeader
+	for i, header := range base {
+		node := &chainHeader{
+			header:  *header,
+			hash:    header.BlockHash(),
+			height:  baseHeight + int32(i),
+			workSum: blockchain.CalcWork(header.Bits),
+			parent:  parent,
+		}
+		if parent != nil {
+			if header.PrevBlock != parent.hash {
+				return nil, fmt.Errorf("base header %v does "+
+					"not connect to the previous header",
+					node.hash)
+			}
+			node.workSum.Add(node.workSum, parent.workSum)
+		}
+		c.index[node.hash] = node
+		c.mainChain = append(c.mainChain, node)
+		parent = node
+	}
+
+	return c, nil
+}
+
+// newHeaderChainFromBlockChain returns a header chain built on top of the
+// most recent headers of the main chain of the passed block chain.
+func newHeaderChainFromBlockChain(chain *blockchain.BlockChain,
+	checkpoints []chaincfg.Checkpoint,
+	timeSource blockchain.MedianTimeSource) (*HeaderChain, error) {
+
+	best := chain.BestSnapshot()
+	baseHeight := best.Height - chain.BlocksPerRetarget()
+	if baseHeight < 0 {
+		baseHeight = 0
+	}
+	base := make([]*wire.BlockHeader, 0, best.Height-baseHeight+1)
+	for height := baseHeight; height <= best.Height; height++ {
+		hash, err := chain.BlockHashByHeight(height)
+		if err != nil {
+			return nil, err
+		}
+		header, err := chain.HeaderByHash(hash)
+		if err != nil {
+			return nil, err
+		}
+		base = append(base, &header)
+	}
+
+	return NewHeaderChain(chain.ChainParams(), checkpoints, timeSource,
+		baseHeight, base)
+}
+
+// tip returns the best header of the chain.
+//
+// This function MUST be called with the chain lock held (for reads).
+func (c *HeaderChain) tip() *chainHeader {
+	return c.mainChain[len(c.mainChain)-1]
+}
+
+// inMainChain returns whether or not the passed header is part of the best
+// chain.
+//
+// This function MUST be called with the chain lock held (for reads).
+func (c *HeaderChain) inMainChain(node *chainHeader) bool {
+	i := node.height - c.baseHeight
+	return i >= 0 && int(i) < len(c.mainChain) && c.mainChain[i] == node
+}
+
+// checkCheckpoints ensures the passed header matches the checkpoint at its
+// height, if any, and does not fork from the best chain before the most recent
+// checkpoint the best chain has passed.
+//
+// This function MUST be called with the chain lock held (for reads).
+func (c *HeaderChain) checkCheckpoints(node *chainHeader) error {
+	tipHeight := c.tip().height
+	for i := len(c.checkpoints) - 1; i >= 0; i-- {
+		checkpoint := &c.checkpoints[i]
+		if checkpoint.Height == node.height &&
+			!checkpoint.Hash.IsEqual(&node.hash) {
+
+			return fmt.Errorf("header %v at height %d does not "+
+				"match the checkpoint hash of %v", node.hash,
+				node.height, checkpoint.Hash)
+		}
+		if checkpoint.Height <= tipHeight && node.height < checkpoint.Height {
+			return fmt.Errorf("header %v at height %d forks the "+
+				"chain before the checkpoint at height %d",
+				node.hash, node.height, checkpoint.Height)
+		}
+	}
+	return nil
+}
+
+// setTip makes the passed header the tip of the best chain, replacing the
+// headers of the previous best chain after the fork point with its ancestors.
+//
+// This function MUST be called with the chain lock held (for writes).
+func (c *HeaderChain) setTip(node *chainHeader) {
+	var attach []*chainHeader
+	for ; !c.inMainChain(node); node = node.parent {
+		attach = append(attach, node)
+	}
+	c.mainChain = c.mainChain[:node.height-c.baseHeight+1]
+	for i := len(attach) - 1; i >= 0; i-- {
+		c.mainChain = append(c.mainChain, attach[i])
+	}
+
+	// The filter headers of the replaced headers no longer apply, though
+	// those already known for the attached headers still do.
+	if c.filterTip > node.height {
+		c.filterTip = node.height
+	}
+	c.advanceFilterTip()
+}
+
+// advanceFilterTip moves the filter tip to the last header of the uninterrupted
+// run of headers in the best chain with known filter headers.
+//
+// This function MUST be called with the chain lock held (for writes).
+func (c *HeaderChain) advanceFilterTip() {
+	for next := c.filterTip + 1 - c.baseHeight; int(next) < len(c.mainChain); next++ {
+		if c.mainChain[next].filterHeader == nil {
+			break
+		}
+		c.filterTip++
+	}
+}
+
+// AddHeaders validates the passed headers, which must each extend a known
+// header, and adds them to the chain.  Headers which are already known are
+// skipped.  The best chain is switched to the chain with the most cumulative
+// work once all of the headers have been added.
+//
+// An error is returned for the first header which does not pass validation, in
+// which case the headers before it remain added.
+//
+// This function is safe for concurrent access.
+func (c *HeaderChain) AddHeaders(headers []*wire.BlockHeader) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	best := c.tip()
+	var err error
+	for _, header := range headers {
+		hash := header.BlockHash()
+		if _, ok := c.index[hash]; ok {
+			continue
+		}
+
+		parent, ok := c.index[header.PrevBlock]
+		if !ok {
+			err = fmt.Errorf("header %v does not connect to a "+
+				"known header", hash)
+			break
+		}
+		node := &chainHeader{
+			header:  *header,
+			hash:    hash,
+			height:  parent.height + 1,
+			workSum: blockchain.CalcWork(header.Bits),
+			parent:  parent,
+		}
+		node.workSum.Add(node.workSum, parent.workSum)
+
+		err = blockchain.CheckBlockHeaderSanity(header,
+			c.chainCtx.ChainParams().PowLimit, c.timeSource,
+			blockchain.BFNone)
+		if err != nil {
+			break
+		}
+		err = blockchain.CheckBlockHeaderContext(header, parent,
+			c.chainCtx)
+		if err != nil {
+			break
+		}
+		if err = c.checkCheckpoints(node); err != nil {
+			break
+		}
+
+		c.index[hash] = node
+		if node.workSum.Cmp(best.workSum) > 0 {
+			best = node
+		}
+	}
+
+	if best != c.tip() {
+		c.setTip(best)
+	}
+	return err
+}
+
+// HaveHeader returns whether or not the header with the passed hash is known,
+// regardless of whether or not it is part of the best chain.
+//
+// This function is safe for concurrent access.
+func (c *HeaderChain) HaveHeader(hash *chainhash.Hash) bool {
+	c.mtx.RLock()
+	_, ok := c.index[*hash]
+	c.mtx.RUnlock()
+	return ok
+}
+
+// BestHeader returns the header at the tip of the best chain along with its
+// height.
+//
+// This function is safe for concurrent access.
+func (c *HeaderChain) BestHeader() (wire.BlockHeader, int32) {
+	c.mtx.RLock()
+	tip := c.tip()
+	c.mtx.RUnlock()
+	return tip.header, tip.height
+}
+
+// BestHeaderWork returns the cumulative work of the best chain since the base
+// headers of the header chain.
+//
+// This function is safe for concurrent access.
+func (c *HeaderChain) BestHeaderWork() *big.Int {
+	c.mtx.RLock()
+	work := new(big.Int).Set(c.tip().workSum)
+	c.mtx.RUnlock()
+	return work
+}
+
+// HeaderByHash returns the header with the passed hash, regardless of whether
+// or not it is part of the best chain, along with its height.
+//
+// This function is safe for concurrent access.
+func (c *HeaderChain) HeaderByHash(hash *chainhash.Hash) (wire.BlockHeader, int32, error) {
+	c.mtx.RLock()
+	node, ok := c.index[*hash]
+	c.mtx.RUnlock()
+	if !ok {
+		return wire.BlockHeader{}, 0, fmt.Errorf("header %v is not "+
+			"known", hash)
+	}
+	return node.header, node.height, nil
+}
+
+// HeaderByHeight returns the header at the passed height in the best chain.
+//
+// This function is safe for concurrent access.
+func (c *HeaderChain) HeaderByHeight(height int32) (wire.BlockHeader, error) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	i := height - c.baseHeight
+	if i < 0 || int(i) >= len(c.mainChain) {
+		return wire.BlockHeader{}, fmt.Errorf("no header at height %d "+
+			"is known", height)
+	}
+	return c.mainChain[i].header, nil
+}
+
+// IsCurrent returns whether or not the best header is recent enough for the
+// chain to be considered synced, which is the case when its timestamp is no
+// more than 24 hours old and it is not before the final checkpoint.
+//
+// This function is safe for concurrent access.
+func (c *HeaderChain) IsCurrent() bool {
+	c.mtx.RLock()
+	tip := c.tip()
+	c.mtx.RUnlock()
+
+	if len(c.checkpoints) > 0 &&
+		tip.height < c.checkpoints[len(c.checkpoints)-1].Height {
+
+		return false
+	}
+	minus24Hours := c.timeSource.AdjustedTime().Add(-24 * time.Hour)
+	return !tip.header.Timestamp.Before(minus24Hours)
+}
+
+// BlockLocator returns a block locator for the tip of the best chain.  See the
+// BlockLocator type of the blockchain package for details on the algorithm
+// used.  Since the headers before the base headers are not known, the locator
+// ends with the first base header rather than the genesis block.
+//
+// This function is safe for concurrent access.
+func (c *HeaderChain) BlockLocator() blockchain.BlockLocator {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	var locator blockchain.BlockLocator
+	step := int32(1)
+	for i := int32(len(c.mainChain) - 1); ; i -= step {
+		if i < 0 {
+			i = 0
+		}
+		locator = append(locator, &c.mainChain[i].hash)
+		if i == 0 {
+			break
+		}
+
+		// Once 11 entries have been included, start doubling the
+		// distance between included hashes.
+		if len(locator) > 10 {
+			step *= 2
+		}
+	}
+	return locator
+}
+
+// LocateHeaders returns the headers of the best chain after the first known
+// header in the locator until the provided stop hash is reached, or up to a max
+// of wire.MaxBlockHeadersPerMsg headers.  It mirrors the method of the same
+// name on the block chain so header chains are able to serve headers to peers.
+//
+// This function is safe for concurrent access.
+func (c *HeaderChain) LocateHeaders(locator blockchain.BlockLocator,
+	hashStop *chainhash.Hash) []wire.BlockHeader {
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	// When no locators are provided, the stop hash is treated as a request
+	// for that header.
+	stopNode := c.index[*hashStop]
+	if len(locator) == 0 {
+		if stopNode == nil {
+			return nil
+		}
+		return []wire.BlockHeader{stopNode.header}
+	}
+
+	// Find the most recent locator hash in the best chain, falling back to
+	// the first base header when none of them are.
+	start := int32(0)
+	for _, hash := range locator {
+		node := c.index[*hash]
+		if node != nil && c.inMainChain(node) {
+			start = node.height - c.baseHeight
+			break
+		}
+	}
+
+	end := int32(len(c.mainChain) - 1)
+	if stopNode != nil && c.inMainChain(stopNode) &&
+		stopNode.height-c.baseHeight > start {
+
+		end = stopNode.height - c.baseHeight
+	}
+	if end-start > wire.MaxBlockHeadersPerMsg {
+		end = start + wire.MaxBlockHeadersPerMsg
+	}
+
+	headers := make([]wire.BlockHeader, 0, end-start)
+	for i := start + 1; i <= end; i++ {
+		headers = append(headers, c.mainChain[i].header)
+	}
+	return headers
+}
+
+// FilterTip returns the height of the last header in the best chain for which
+// the filter header, as well as those of all of the headers before it, is
+// known.  It is one less than the height of the first base header when no
+// filter headers are known.
+//
+// This function is safe for concurrent access.
+func (c *HeaderChain) FilterTip() int32 {
+	c.mtx.RLock()
+	filterTip := c.filterTip
+	c.mtx.RUnlock()
+	return filterTip
+}
+
+// FilterHeaderByHash returns the committed filter header (BIP0157) of the block
+// with the passed hash.
+//
+// This function is safe for concurrent access.
+func (c *HeaderChain) FilterHeaderByHash(hash *chainhash.Hash) (*chainhash.Hash, error) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	node, ok := c.index[*hash]
+	if !ok || node.filterHeader == nil {
+		return nil, fmt.Errorf("filter header for block %v is not "+
+			"known", hash)
+	}
+	filterHeader := *node.filterHeader
+	return &filterHeader, nil
+}
+
+// AddFilterHeaders derives the committed filter headers (BIP0157) of the
+// headers of the best chain from the passed filter hashes, the last of which
+// belongs to the block with the passed stop hash, and the passed filter header
+// of the block before them.  The filter headers must directly follow the
+// filter tip and the previous filter header must match the known one.
+//
+// Since the blocks are not downloaded, the filter headers are only checked to
+// link together, so they are as trustworthy as the peer which provided them.
+//
+// This function is safe for concurrent access.
+func (c *HeaderChain) AddFilterHeaders(stopHash, prevFilterHeader *chainhash.Hash,
+	filterHashes []*chainhash.Hash) error {
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	stopNode, ok := c.index[*stopHash]
+	if !ok || !c.inMainChain(stopNode) {
+		return fmt.Errorf("stop header %v is not in the best chain",
+			stopHash)
+	}
+	startHeight := stopNode.height - int32(len(filterHashes)) + 1
+	if len(filterHashes) == 0 || startHeight != c.filterTip+1 {
+		return fmt.Errorf("filter headers for heights %d to %d do not "+
+			"follow the filter tip at height %d", startHeight,
+			stopNode.height, c.filterTip)
+	}
+
+	// The filter header before the genesis block is defined to be zero,
+	// while the one before the base headers is not known, so it is trusted.
+	switch {
+	case startHeight == 0:
+		if *prevFilterHeader != zeroHash {
+			return fmt.Errorf("previous filter header of the " +
+				"genesis block is not zero")
+		}
+
+	case startHeight > c.baseHeight:
+		prev := c.mainChain[startHeight-1-c.baseHeight].filterHeader
+		if *prevFilterHeader != *prev {
+			return fmt.Errorf("previous filter header %v does not "+
+				"match the known filter header %v",
+				prevFilterHeader, prev)
+		}
+	}
+
+	// Each filter header commits to the hash of the filter and the
+	// previous filter header.
+	prev := *prevFilterHeader
+	var buf [chainhash.HashSize * 2]byte
+	for i, filterHash := range filterHashes {
+		copy(buf[:], filterHash[:])
+		copy(buf[chainhash.HashSize:], prev[:])
+		filterHeader := chainhash.DoubleHashH(buf[:])
+		c.mainChain[startHeight+int32(i)-c.baseHeight].filterHeader =
+			&filterHeader
+		prev = filterHeader
+	}
+	c.advanceFilterTip()
+	return nil
+}
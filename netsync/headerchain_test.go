@@ -0,0 +1,234 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"testing"
+
+	"github.com/ifishnet/hdfd/blockchain"
+	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// solveTestHeader returns a header which extends the passed one on the
+// regression test network and has valid proof of work.  The passed extra
+// nonce allows creating different headers which extend the same one.
+func solveTestHeader(t *testing.T, prev *wire.BlockHeader, extraNonce uint32) *wire.BlockHeader {
+	params := &chaincfg.RegressionNetParams
+	header := &wire.BlockHeader{
+		Version:   4,
+		PrevBlock: prev.BlockHash(),
+		Timestamp: prev.Timestamp.Add(params.TargetTimePerBlock),
+		Bits:      params.PowLimitBits,
+	}
+	header.MerkleRoot[0] = byte(extraNonce)
+	header.MerkleRoot[1] = byte(extraNonce >> 8)
+
+	target := blockchain.CompactToBig(header.Bits)
+	for nonce := uint32(0); nonce < 1<<16; nonce++ {
+		header.Nonce = nonce
+		hash := header.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+			return header
+		}
+	}
+	t.Fatalf("unable to solve header extending %v", prev.BlockHash())
+	return nil
+}
+
+// solveTestHeaders returns the passed number of headers which extend the
+// passed one in order.
+func solveTestHeaders(t *testing.T, prev *wire.BlockHeader, n int, extraNonce uint32) []*wire.BlockHeader {
+	headers := make([]*wire.BlockHeader, 0, n)
+	for i := 0; i < n; i++ {
+		prev = solveTestHeader(t, prev, extraNonce)
+		headers = append(headers, prev)
+	}
+	return headers
+}
+
+// newTestHeaderChain returns a header chain for the regression test network
+// built on top of its genesis block.
+func newTestHeaderChain(t *testing.T, checkpoints []chaincfg.Checkpoint) *HeaderChain {
+	params := &chaincfg.RegressionNetParams
+	c, err := NewHeaderChain(params, checkpoints, blockchain.NewMedianTime(),
+		0, []*wire.BlockHeader{&params.GenesisBlock.Header})
+	if err != nil {
+		t.Fatalf("NewHeaderChain: unexpected error: %v", err)
+	}
+	return c
+}
+
+// TestHeaderChain ensures the header chain accepts valid headers, follows the
+// chain with the most work, and serves the headers of its best chain.
+func TestHeaderChain(t *testing.T) {
+	t.Parallel()
+
+	genesis := &chaincfg.RegressionNetParams.GenesisBlock.Header
+	c := newTestHeaderChain(t, nil)
+	headers := solveTestHeaders(t, genesis, 10, 0)
+	if err := c.AddHeaders(headers); err != nil {
+		t.Fatalf("AddHeaders: unexpected error: %v", err)
+	}
+	best, height := c.BestHeader()
+	if height != 10 || best.BlockHash() != headers[9].BlockHash() {
+		t.Fatalf("unexpected best header %v at height %d",
+			best.BlockHash(), height)
+	}
+
+	// Adding known headers again must not change anything.
+	if err := c.AddHeaders(headers[:5]); err != nil {
+		t.Fatalf("AddHeaders: unexpected error re-adding headers: %v",
+			err)
+	}
+	if _, height := c.BestHeader(); height != 10 {
+		t.Fatalf("unexpected best height %d after re-adding headers",
+			height)
+	}
+
+	// Headers must be served starting after the most recent locator hash
+	// in the best chain.
+	locator := blockchain.BlockLocator{&headers[2].PrevBlock}
+	located := c.LocateHeaders(locator, &chainhash.Hash{})
+	if len(located) != 8 || located[0].BlockHash() != headers[2].BlockHash() {
+		t.Fatalf("unexpected located headers: got %d", len(located))
+	}
+	tipLocator := c.BlockLocator()
+	if *tipLocator[0] != headers[9].BlockHash() ||
+		*tipLocator[len(tipLocator)-1] != genesis.BlockHash() {
+
+		t.Fatalf("block locator does not span from the tip to the " +
+			"genesis block")
+	}
+
+	// A side chain forking at height 5 with more work must become the
+	// best chain while the replaced headers remain known.
+	fork := solveTestHeaders(t, headers[4], 7, 1)
+	if err := c.AddHeaders(fork); err != nil {
+		t.Fatalf("AddHeaders: unexpected error adding fork: %v", err)
+	}
+	if _, height := c.BestHeader(); height != 12 {
+		t.Fatalf("unexpected best height %d after reorg", height)
+	}
+	header, err := c.HeaderByHeight(6)
+	if err != nil || header.BlockHash() != fork[0].BlockHash() {
+		t.Fatalf("header at height 6 is not from the fork")
+	}
+	replaced := headers[9].BlockHash()
+	if !c.HaveHeader(&replaced) {
+		t.Fatalf("replaced header is no longer known")
+	}
+	if _, height, err := c.HeaderByHash(&replaced); err != nil || height != 10 {
+		t.Fatalf("unexpected height %d for replaced header", height)
+	}
+}
+
+// TestHeaderChainInvalid ensures the header chain rejects headers which do
+// not connect, have an unexpected difficulty, or do not match a checkpoint.
+func TestHeaderChainInvalid(t *testing.T) {
+	t.Parallel()
+
+	genesis := &chaincfg.RegressionNetParams.GenesisBlock.Header
+	headers := solveTestHeaders(t, genesis, 3, 0)
+
+	c := newTestHeaderChain(t, nil)
+	if err := c.AddHeaders(headers[1:]); err == nil {
+		t.Fatal("AddHeaders: did not reject unconnected header")
+	}
+
+	badBits := *headers[0]
+	badBits.Bits--
+	if err := c.AddHeaders([]*wire.BlockHeader{&badBits}); err == nil {
+		t.Fatal("AddHeaders: did not reject unexpected difficulty")
+	}
+
+	tooOld := *headers[0]
+	tooOld.Timestamp = genesis.Timestamp
+	if err := c.AddHeaders([]*wire.BlockHeader{&tooOld}); err == nil {
+		t.Fatal("AddHeaders: did not reject timestamp before median")
+	}
+
+	// The headers before an invalid one must remain added.
+	checkpointHash := chainhash.Hash{0x01}
+	c = newTestHeaderChain(t, []chaincfg.Checkpoint{
+		{Height: 2, Hash: &checkpointHash},
+	})
+	if err := c.AddHeaders(headers); err == nil {
+		t.Fatal("AddHeaders: did not reject checkpoint mismatch")
+	}
+	if _, height := c.BestHeader(); height != 1 {
+		t.Fatalf("unexpected best height %d after checkpoint mismatch",
+			height)
+	}
+}
+
+// TestHeaderChainFilterHeaders ensures the committed filter headers are
+// derived from the filter hashes and must connect to the known ones.
+func TestHeaderChainFilterHeaders(t *testing.T) {
+	t.Parallel()
+
+	genesis := &chaincfg.RegressionNetParams.GenesisBlock.Header
+	c := newTestHeaderChain(t, nil)
+	headers := solveTestHeaders(t, genesis, 4, 0)
+	if err := c.AddHeaders(headers); err != nil {
+		t.Fatalf("AddHeaders: unexpected error: %v", err)
+	}
+	if tip := c.FilterTip(); tip != -1 {
+		t.Fatalf("unexpected initial filter tip %d", tip)
+	}
+
+	filterHashes := make([]*chainhash.Hash, 3)
+	for i := range filterHashes {
+		filterHash := testHash(uint64(i))
+		filterHashes[i] = &filterHash
+	}
+
+	// The filter header before the genesis block must be zero.
+	stopHash := headers[1].BlockHash()
+	badPrev := chainhash.Hash{0x01}
+	err := c.AddFilterHeaders(&stopHash, &badPrev, filterHashes)
+	if err == nil {
+		t.Fatal("AddFilterHeaders: did not reject nonzero previous " +
+			"filter header of the genesis block")
+	}
+	err = c.AddFilterHeaders(&stopHash, &zeroHash, filterHashes)
+	if err != nil {
+		t.Fatalf("AddFilterHeaders: unexpected error: %v", err)
+	}
+	if tip := c.FilterTip(); tip != 2 {
+		t.Fatalf("unexpected filter tip %d", tip)
+	}
+
+	var buf [chainhash.HashSize * 2]byte
+	copy(buf[:], filterHashes[0][:])
+	want := chainhash.DoubleHashH(buf[:])
+	genesisHash := genesis.BlockHash()
+	got, err := c.FilterHeaderByHash(&genesisHash)
+	if err != nil || *got != want {
+		t.Fatalf("unexpected genesis filter header %v, want %v", got,
+			want)
+	}
+
+	// The next filter headers must connect to the known ones.
+	stopHash = headers[3].BlockHash()
+	err = c.AddFilterHeaders(&stopHash, &badPrev, filterHashes[:2])
+	if err == nil {
+		t.Fatal("AddFilterHeaders: did not reject mismatched previous " +
+			"filter header")
+	}
+	prevHash := headers[1].BlockHash()
+	prev, err := c.FilterHeaderByHash(&prevHash)
+	if err != nil {
+		t.Fatalf("FilterHeaderByHash: unexpected error: %v", err)
+	}
+	err = c.AddFilterHeaders(&stopHash, prev, filterHashes[:2])
+	if err != nil {
+		t.Fatalf("AddFilterHeaders: unexpected error: %v", err)
+	}
+	if tip := c.FilterTip(); tip != 4 {
+		t.Fatalf("unexpected filter tip %d", tip)
+	}
+}
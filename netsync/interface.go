@@ -25,6 +25,12 @@ type PeerNotifier interface {
 	RelayInventory(invVect *wire.InvVect, data interface{})
 
 	TransactionConfirmed(tx *hdfutil.Tx)
+
+	// BlockRelayedByPeer notifies that the passed peer was the first to
+	// deliver a block which extended the main chain while the chain was
+	// current.  It is used to select the peers which announce new blocks
+	// in high-bandwidth compact block mode.
+	BlockRelayedByPeer(peer *peer.Peer)
 }
 
 // Config is a configuration struct used to initialize a new SyncManager.
@@ -38,4 +44,33 @@ type Config struct {
 	MaxPeers           int
 
 	FeeEstimator *mempool.FeeEstimator
+
+	// HeadersOnly only downloads and validates the headers of the chain
+	// instead of its blocks.  The best chain of headers is exposed by way
+	// of the HeaderChain method of the sync manager.
+	HeadersOnly bool
+
+	// SyncCFHeaders additionally downloads the committed filter headers
+	// (BIP0157) of the header chain in headers-only mode.
+	SyncCFHeaders bool
+
+	// TimeSource is the median time source used to validate the headers
+	// in headers-only mode.
+	TimeSource blockchain.MedianTimeSource
+}
+
+// SyncOptions houses the options of a SyncManager which may be adjusted while
+// it is running by way of its SetSyncOptions method.
+type SyncOptions struct {
+	// MaxSyncPeers is the maximum number of candidate peers the sync peer
+	// is selected from.  The candidates which have been connected the
+	// longest are preferred.  It is initialized to the MaxPeers value of
+	// the Config.
+	MaxSyncPeers int
+
+	// CheckpointMode defines how the checkpoints of the chain are used.
+	// Enforced checkpoints allow skipping validation of the blocks before
+	// the latest checkpoint while advisory checkpoints fully validate all
+	// blocks.
+	CheckpointMode blockchain.CheckpointMode
 }
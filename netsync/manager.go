@@ -6,8 +6,10 @@ package netsync
 
 import (
 	"container/list"
+	"fmt"
 	"math/rand"
 	"net"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -36,8 +38,8 @@ const (
 	// hashes to store in memory.
 	maxRequestedBlocks = wire.MaxInvPerMsg
 
-	// maxRequestedTxns is the maximum number of requested transactions
-	// hashes to store in memory.
+	// maxRequestedTxns is the maximum number of announced transactions
+	// to track requests for.
 	maxRequestedTxns = wire.MaxInvPerMsg
 
 	// maxStallDuration is the time after which we will disconnect our
@@ -47,6 +49,16 @@ const (
 	// stallSampleInterval the interval at which we will check to see if our
 	// sync has stalled.
 	stallSampleInterval = 30 * time.Second
+
+	// txRequestTimeout is the duration after which a pending request for a
+	// transaction is considered failed so the transaction is requested
+	// from another peer that announced it instead.
+	txRequestTimeout = time.Minute
+
+	// txRequestCheckInterval is the interval at which pending transaction
+	// requests are checked for timeouts and delayed announcements are
+	// requested.
+	txRequestCheckInterval = time.Second
 )
 
 // zeroHash is the zero value hash (all zeros).  It is defined as a convenience.
@@ -79,6 +91,20 @@ type headersMsg struct {
 	peer    *peerpkg.Peer
 }
 
+// cmpctBlockMsg packages a bitcoin cmpctblock message and the peer it came from
+// together so the block handler has access to that information.
+type cmpctBlockMsg struct {
+	cmpctBlock *wire.MsgCmpctBlock
+	peer       *peerpkg.Peer
+}
+
+// blockTxnMsg packages a bitcoin blocktxn message and the peer it came from
+// together so the block handler has access to that information.
+type blockTxnMsg struct {
+	blockTxn *wire.MsgBlockTxn
+	peer     *peerpkg.Peer
+}
+
 // notFoundMsg packages a bitcoin notfound message and the peer it came from
 // together so the block handler has access to that information.
 type notFoundMsg struct {
@@ -86,6 +112,13 @@ type notFoundMsg struct {
 	peer     *peerpkg.Peer
 }
 
+// cfHeadersMsg packages a bitcoin cfheaders message and the peer it came from
+// together so the block handler has access to that information.
+type cfHeadersMsg struct {
+	cfHeaders *wire.MsgCFHeaders
+	peer      *peerpkg.Peer
+}
+
 // donePeerMsg signifies a newly disconnected peer to the block handler.
 type donePeerMsg struct {
 	peer *peerpkg.Peer
@@ -105,6 +138,19 @@ type getSyncPeerMsg struct {
 	reply chan int32
 }
 
+// getSyncOptionsMsg is a message type to be sent across the message channel for
+// retrieving the options of the sync manager.
+type getSyncOptionsMsg struct {
+	reply chan SyncOptions
+}
+
+// setSyncOptionsMsg is a message type to be sent across the message channel for
+// replacing the options of the sync manager.
+type setSyncOptionsMsg struct {
+	opts  SyncOptions
+	reply chan error
+}
+
 // processBlockResponse is a response sent to the reply channel of a
 // processBlockMsg.
 type processBlockResponse struct {
@@ -150,7 +196,6 @@ type headerNode struct {
 type peerSyncState struct {
 	syncCandidate   bool
 	requestQueue    []*wire.InvVect
-	requestedTxns   map[chainhash.Hash]struct{}
 	requestedBlocks map[chainhash.Hash]struct{}
 }
 
@@ -192,18 +237,40 @@ type SyncManager struct {
 
 	// These fields should only be accessed from the blockHandler thread
 	rejectedTxns     map[chainhash.Hash]struct{}
-	requestedTxns    map[chainhash.Hash]struct{}
+	txRequests       *txRequestTracker
 	requestedBlocks  map[chainhash.Hash]struct{}
 	syncPeer         *peerpkg.Peer
 	peerStates       map[*peerpkg.Peer]*peerSyncState
 	lastProgressTime time.Time
+	maxSyncPeers     int
 
 	// The following fields are used for headers-first mode.
 	headersFirstMode bool
+	headersSync      *blockchain.HeadersSync
 	headerList       *list.List
 	startHeader      *list.Element
 	nextCheckpoint   *chaincfg.Checkpoint
 
+	// The following fields are used for headers-only mode.
+	headersOnly        bool
+	headerChain        *HeaderChain
+	syncCFHeaders      bool
+	requestedCFHeaders *chainhash.Hash
+
+	// partialBlocks houses the blocks announced by way of compact blocks
+	// which are waiting for the transactions missing from the mempool.
+	partialBlocks map[chainhash.Hash]*partialBlock
+	cmpctStats    cmpctBlockStats
+
+	// progress tracks the progress of syncing the chain and delivers it to
+	// the subscribers.
+	progress *syncProgress
+
+	// recentlyConfirmed tracks the transactions confirmed in the most
+	// recent blocks to avoid requesting them again when they are
+	// announced.
+	recentlyConfirmed *recentlyConfirmedTxns
+
 	// An optional fee estimator.
 	feeEstimator *mempool.FeeEstimator
 }
@@ -212,6 +279,7 @@ type SyncManager struct {
 // syncing from a new peer.
 func (sm *SyncManager) resetHeaderState(newestHash *chainhash.Hash, newestHeight int32) {
 	sm.headersFirstMode = false
+	sm.headersSync = nil
 	sm.headerList.Init()
 	sm.startHeader = nil
 
@@ -252,6 +320,16 @@ func (sm *SyncManager) findNextHeaderCheckpoint(height int32) *chaincfg.Checkpoi
 	return nextCheckpoint
 }
 
+// bestHeight returns the height of the tip of the best chain, which is the best
+// header in headers-only mode and the best block otherwise.
+func (sm *SyncManager) bestHeight() int32 {
+	if sm.headersOnly {
+		_, height := sm.headerChain.BestHeader()
+		return height
+	}
+	return sm.chain.BestSnapshot().Height
+}
+
 // startSync will choose the best peer among the available candidate peers to
 // download/sync the blockchain from.  When syncing is already running, it
 // simply returns.  It also examines the candidates for any which are no longer
@@ -272,7 +350,8 @@ func (sm *SyncManager) startSync() {
 	}
 
 	best := sm.chain.BestSnapshot()
-	var higherPeers, equalPeers []*peerpkg.Peer
+	bestHeight := sm.bestHeight()
+	var candidates []*peerpkg.Peer
 	for peer, state := range sm.peerStates {
 		if !state.syncCandidate {
 			continue
@@ -289,16 +368,30 @@ func (sm *SyncManager) startSync() {
 		// doesn't have a later block when it's equal, it will likely
 		// have one soon so it is a reasonable choice.  It also allows
 		// the case where both are at 0 such as during regression test.
-		if peer.LastBlock() < best.Height {
+		if peer.LastBlock() < bestHeight {
 			state.syncCandidate = false
 			continue
 		}
 
+		candidates = append(candidates, peer)
+	}
+
+	// Only consider the candidates which have been connected the longest
+	// up to the maximum number of peers used for syncing.
+	if len(candidates) > sm.maxSyncPeers {
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].ID() < candidates[j].ID()
+		})
+		candidates = candidates[:sm.maxSyncPeers]
+	}
+
+	var higherPeers, equalPeers []*peerpkg.Peer
+	for _, peer := range candidates {
 		// If the peer is at the same height as us, we'll add it a set
 		// of backup peers in case we do not find one with a higher
 		// height. If we are synced up with all of our peers, all of
 		// them will be in this set.
-		if peer.LastBlock() == best.Height {
+		if peer.LastBlock() == bestHeight {
 			equalPeers = append(equalPeers, peer)
 			continue
 		}
@@ -323,6 +416,20 @@ func (sm *SyncManager) startSync() {
 		bestPeer = equalPeers[rand.Intn(len(equalPeers))]
 	}
 
+	// Start syncing the headers from the best peer if one was selected
+	// in headers-only mode.  The blocks are never downloaded.
+	if bestPeer != nil && sm.headersOnly {
+		log.Infof("Syncing headers to height %d from peer %v",
+			bestPeer.LastBlock(), bestPeer.Addr())
+
+		locator := sm.headerChain.BlockLocator()
+		bestPeer.PushGetHeadersMsg(locator, &zeroHash)
+		sm.syncPeer = bestPeer
+		sm.requestedCFHeaders = nil
+		sm.lastProgressTime = time.Now()
+		return
+	}
+
 	// Start syncing from the best peer if one was selected.
 	if bestPeer != nil {
 		// Clear the requestedBlocks if the sync peer changes, otherwise
@@ -352,6 +459,12 @@ func (sm *SyncManager) startSync() {
 		// and compared against the value in the header which proves the
 		// full block hasn't been tampered with.
 		//
+		// The headers are downloaded twice, first to prove they lead to
+		// the checkpoint while only keeping a commitment to them and
+		// then to add them to the list of headers, so the peer is not
+		// able to exhaust our memory with a long chain of headers which
+		// doesn't.
+		//
 		// Once we have passed the final checkpoint, or checkpoints are
 		// disabled, use standard inv messages learn about the blocks
 		// and fully validate them.  Finally, regression test mode does
@@ -361,8 +474,14 @@ func (sm *SyncManager) startSync() {
 			best.Height < sm.nextCheckpoint.Height &&
 			sm.chainParams != &chaincfg.RegressionNetParams {
 
+			headersSync, err := sm.chain.NewHeadersSync(sm.nextCheckpoint)
+			if err != nil {
+				log.Errorf("Failed to start headers sync: %v", err)
+				return
+			}
 			bestPeer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
 			sm.headersFirstMode = true
+			sm.headersSync = headersSync
 			log.Infof("Downloading headers for blocks %d to "+
 				"%d from peer %s", best.Height+1,
 				sm.nextCheckpoint.Height, bestPeer.Addr())
@@ -375,6 +494,10 @@ func (sm *SyncManager) startSync() {
 		// syncPeer to avoid instantly detecting it as stalled in the
 		// event the progress time hasn't been updated recently.
 		sm.lastProgressTime = time.Now()
+
+		// Request the blocks needed to validate the historical chain
+		// leading up to a loaded utxo snapshot in the background.
+		sm.fetchHistoricalBlocks()
 	} else {
 		log.Warnf("No sync peer candidates available")
 	}
@@ -407,8 +530,11 @@ func (sm *SyncManager) isSyncCandidate(peer *peerpkg.Peer) bool {
 				"soft-fork state: %v", err)
 		}
 		nodeServices := peer.Services()
-		if nodeServices&wire.SFNodeNetwork != wire.SFNodeNetwork ||
-			(segwitActive && !peer.IsWitnessEnabled()) {
+		if nodeServices&wire.SFNodeNetwork != wire.SFNodeNetwork &&
+			!sm.isLimitedSyncCandidate(peer) {
+			return false
+		}
+		if segwitActive && !peer.IsWitnessEnabled() {
 			return false
 		}
 	}
@@ -417,6 +543,24 @@ func (sm *SyncManager) isSyncCandidate(peer *peerpkg.Peer) bool {
 	return true
 }
 
+// isLimitedSyncCandidate returns whether or not a peer which signals it only
+// serves the most recent blocks, such as a pruned node, is able to provide all
+// of the blocks needed to catch up to the best height it announced (BIP0159).
+func (sm *SyncManager) isLimitedSyncCandidate(peer *peerpkg.Peer) bool {
+	if peer.Services()&wire.SFNodeNetworkLimited == 0 {
+		return false
+	}
+
+	// Peers which only serve the most recent blocks still serve all of
+	// the headers.
+	if sm.headersOnly {
+		return true
+	}
+
+	best := sm.chain.BestSnapshot()
+	return best.Height+blockchain.MinBlocksToKeep >= peer.LastBlock()
+}
+
 // handleNewPeerMsg deals with new peers that have signalled they may
 // be considered as a sync peer (they have already successfully negotiated).  It
 // also starts syncing if needed.  It is invoked from the syncHandler goroutine.
@@ -432,7 +576,6 @@ func (sm *SyncManager) handleNewPeerMsg(peer *peerpkg.Peer) {
 	isSyncCandidate := sm.isSyncCandidate(peer)
 	sm.peerStates[peer] = &peerSyncState{
 		syncCandidate:   isSyncCandidate,
-		requestedTxns:   make(map[chainhash.Hash]struct{}),
 		requestedBlocks: make(map[chainhash.Hash]struct{}),
 	}
 
@@ -491,8 +634,7 @@ func (sm *SyncManager) shouldDCStalledSyncPeer() bool {
 	// If we've stalled out yet the sync peer reports having more blocks for
 	// us we will disconnect them. This allows us at tip to not disconnect
 	// peers when we are equal or they temporarily lag behind us.
-	best := sm.chain.BestSnapshot()
-	return peerHeight > best.Height
+	return peerHeight > sm.bestHeight()
 }
 
 // handleDonePeerMsg deals with peers that have signalled they are done.  It
@@ -512,6 +654,13 @@ func (sm *SyncManager) handleDonePeerMsg(peer *peerpkg.Peer) {
 	log.Infof("Lost peer %s", peer)
 
 	sm.clearRequestedState(state)
+	sm.txRequests.removePeer(peer)
+	sm.requestTxns()
+	for hash, pb := range sm.partialBlocks {
+		if pb.peer == peer {
+			delete(sm.partialBlocks, hash)
+		}
+	}
 
 	if peer == sm.syncPeer {
 		// Update the sync peer. The server has already disconnected the
@@ -520,16 +669,10 @@ func (sm *SyncManager) handleDonePeerMsg(peer *peerpkg.Peer) {
 	}
 }
 
-// clearRequestedState wipes all expected transactions and blocks from the sync
-// manager's requested maps that were requested under a peer's sync state, This
-// allows them to be rerequested by a subsequent sync peer.
+// clearRequestedState wipes all expected blocks from the sync manager's
+// requested maps that were requested under a peer's sync state, This allows
+// them to be rerequested by a subsequent sync peer.
 func (sm *SyncManager) clearRequestedState(state *peerSyncState) {
-	// Remove requested transactions from the global map so that they will
-	// be fetched from elsewhere next time we get an inv.
-	for txHash := range state.requestedTxns {
-		delete(sm.requestedTxns, txHash)
-	}
-
 	// Remove requested blocks from the global map so that they will be
 	// fetched from elsewhere next time we get an inv.
 	// TODO: we could possibly here check which peers have these blocks
@@ -539,6 +682,91 @@ func (sm *SyncManager) clearRequestedState(state *peerSyncState) {
 	}
 }
 
+// requestTxns requests the announced transactions which are not currently
+// requested from the peers selected by the transaction request tracker.  It is
+// invoked from the syncHandler goroutine.
+func (sm *SyncManager) requestTxns() {
+	for peer, txHashes := range sm.txRequests.requestable(time.Now()) {
+		// If the peer is capable, request the txns including all
+		// witness data.
+		invType := wire.InvTypeTx
+		if peer.IsWitnessEnabled() {
+			invType = wire.InvTypeWitnessTx
+		}
+
+		gdmsg := wire.NewMsgGetDataSizeHint(uint(len(txHashes)))
+		for i := range txHashes {
+			gdmsg.AddInvVect(wire.NewInvVect(invType, &txHashes[i]))
+		}
+		peer.QueueMessage(gdmsg, nil)
+	}
+}
+
+// handleTxRequestTimeouts requests the transactions whose pending requests
+// have not been answered in time from the next best peer that announced them,
+// along with the transactions whose announcements were delayed.  It is invoked
+// from the syncHandler goroutine.
+func (sm *SyncManager) handleTxRequestTimeouts() {
+	sm.txRequests.expire(time.Now())
+	sm.requestTxns()
+}
+
+// handleSetSyncOptions replaces the options of the sync manager with the passed
+// ones.  A lower maximum number of sync peers takes effect once the next sync
+// peer is selected, so the current sync peer is kept.  It is invoked from the
+// syncHandler goroutine.
+func (sm *SyncManager) handleSetSyncOptions(opts *SyncOptions) error {
+	if opts.MaxSyncPeers < 1 {
+		return fmt.Errorf("the maximum number of sync peers must be at "+
+			"least 1 (got %d)", opts.MaxSyncPeers)
+	}
+	if err := sm.chain.SetCheckpointMode(opts.CheckpointMode); err != nil {
+		return err
+	}
+
+	log.Infof("Syncing from up to %d peers with checkpoint mode %v",
+		opts.MaxSyncPeers, opts.CheckpointMode)
+	sm.maxSyncPeers = opts.MaxSyncPeers
+
+	// Start syncing in case no sync peer could be selected due to the
+	// previous limit.
+	sm.startSync()
+	return nil
+}
+
+// headersHeight returns the height of the best known header, which is ahead of
+// the best block while the blocks for the headers are being synced.
+func (sm *SyncManager) headersHeight() int32 {
+	if sm.headersOnly {
+		return sm.bestHeight()
+	}
+
+	height := sm.chain.ChainWork().BestHeaderHeight
+	if sm.headersFirstMode && sm.headerList.Len() > 0 {
+		node, ok := sm.headerList.Back().Value.(*headerNode)
+		if ok && node.height > height {
+			height = node.height
+		}
+	}
+	return height
+}
+
+// updateSyncProgress records the passed number of processed blocks and
+// transactions along with the current state of the chain and notifies the
+// sync progress subscribers as needed.  It is invoked from the syncHandler
+// goroutine.
+func (sm *SyncManager) updateSyncProgress(numBlocks, numTxns int) {
+	best := sm.chain.BestSnapshot()
+	header, err := sm.chain.HeaderByHash(&best.Hash)
+	if err != nil {
+		log.Warnf("Unable to fetch header of best block %v: %v",
+			best.Hash, err)
+		return
+	}
+	sm.progress.update(best, header.Timestamp, sm.headersHeight(),
+		numBlocks, numTxns, time.Now())
+}
+
 // updateSyncPeer choose a new sync peer to replace the current one. If
 // dcSyncPeer is true, this method will also disconnect the current sync peer.
 // If we are in header first mode, any header state related to prefetching is
@@ -565,8 +793,7 @@ func (sm *SyncManager) updateSyncPeer(dcSyncPeer bool) {
 // handleTxMsg handles transaction messages from all peers.
 func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
 	peer := tmsg.peer
-	state, exists := sm.peerStates[peer]
-	if !exists {
+	if _, exists := sm.peerStates[peer]; !exists {
 		log.Warnf("Received tx message from unknown peer %s", peer)
 		return
 	}
@@ -584,7 +811,7 @@ func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
 	// Ignore transactions that we have already rejected.  Do not
 	// send a reject message here because if the transaction was already
 	// rejected, the transaction was unsolicited.
-	if _, exists = sm.rejectedTxns[*txHash]; exists {
+	if _, exists := sm.rejectedTxns[*txHash]; exists {
 		log.Debugf("Ignoring unsolicited previously rejected "+
 			"transaction %v from %s", txHash, peer)
 		return
@@ -595,12 +822,11 @@ func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
 	acceptedTxs, err := sm.txMemPool.ProcessTransaction(tmsg.tx,
 		true, true, mempool.Tag(peer.ID()))
 
-	// Remove transaction from request maps. Either the mempool/chain
+	// Stop tracking requests for the transaction. Either the mempool/chain
 	// already knows about it and as such we shouldn't have any more
 	// instances of trying to fetch it, or we failed to insert and thus
 	// we'll retry next time we get an inv.
-	delete(state.requestedTxns, *txHash)
-	delete(sm.requestedTxns, *txHash)
+	sm.txRequests.received(*txHash)
 
 	if err != nil {
 		// Do not request this transaction again until a new block
@@ -626,13 +852,53 @@ func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
 		return
 	}
 
+	// Request the missing parents of the transaction from the peer that
+	// relayed it when it was added to the orphan pool.
+	if len(acceptedTxs) == 0 {
+		sm.requestOrphanParents(peer, txHash)
+	}
+
 	sm.peerNotifier.AnnounceNewTransactions(acceptedTxs)
 }
 
+// requestOrphanParents requests the parents of the orphan transaction with the
+// provided hash that are missing from the provided peer which relayed it.  The
+// peer is considered to have announced the parents, so they are requested from
+// it right away unless they are already pending from another peer.  The
+// parents that have been rejected or are no longer missing are not requested
+// again.
+func (sm *SyncManager) requestOrphanParents(peer *peerpkg.Peer,
+	txHash *chainhash.Hash) {
+
+	now := time.Now()
+	var numParents int
+	for _, parentHash := range sm.txMemPool.OrphanMissingParents(txHash) {
+		if _, exists := sm.rejectedTxns[*parentHash]; exists {
+			continue
+		}
+		if sm.txMemPool.HaveTransaction(parentHash) {
+			continue
+		}
+
+		sm.txRequests.announce(*parentHash, peer, true,
+			peer.IsWTxIdRelayEnabled(), now)
+		numParents++
+	}
+	if numParents > 0 {
+		log.Debugf("Requesting %d missing parent(s) of orphan "+
+			"transaction %v from %s", numParents, txHash, peer)
+		sm.requestTxns()
+	}
+}
+
 // current returns true if we believe we are synced with our peers, false if we
 // still have blocks to check
 func (sm *SyncManager) current() bool {
-	if !sm.chain.IsCurrent() {
+	if sm.headersOnly {
+		if !sm.headerChain.IsCurrent() {
+			return false
+		}
+	} else if !sm.chain.IsCurrent() {
 		return false
 	}
 
@@ -644,7 +910,7 @@ func (sm *SyncManager) current() bool {
 
 	// No matter what chain thinks, if we are below the block we are syncing
 	// to we are not current.
-	if sm.chain.BestSnapshot().Height < sm.syncPeer.LastBlock() {
+	if sm.bestHeight() < sm.syncPeer.LastBlock() {
 		return false
 	}
 	return true
@@ -704,6 +970,15 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 	// will fail the insert and thus we'll retry next time we get an inv.
 	delete(state.requestedBlocks, *blockHash)
 	delete(sm.requestedBlocks, *blockHash)
+	delete(sm.partialBlocks, *blockHash)
+
+	// Blocks in the historical chain leading up to a loaded utxo snapshot
+	// are already part of the main chain, so they are handed to the chain
+	// separately to be validated in the background.
+	if sm.chain.IsHistoricalBlock(blockHash) {
+		sm.handleHistoricalBlock(bmsg.block, peer)
+		return
+	}
 
 	// Process the block to include validation, best chain selection, orphan
 	// handling, etc.
@@ -713,9 +988,10 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		// rejected as opposed to something actually going wrong, so log
 		// it as such.  Otherwise, something really did go wrong, so log
 		// it as an actual error.
-		if _, ok := err.(blockchain.RuleError); ok {
-			log.Infof("Rejected block %v from %s: %v", blockHash,
-				peer, err)
+		if ruleErr, ok := err.(blockchain.RuleError); ok {
+			log.Infof("Rejected block %v from %s: %v (%v: %s)",
+				blockHash, peer, err, ruleErr.Err,
+				ruleErr.Context())
 		} else {
 			log.Errorf("Failed to process block %v: %v",
 				blockHash, err)
@@ -782,6 +1058,7 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		// When the block is not an orphan, log information about it and
 		// update the chain state.
 		sm.progressLogger.LogBlockHeight(bmsg.block)
+		sm.updateSyncProgress(1, len(bmsg.block.Transactions()))
 
 		// Update this peer's latest block height, for future
 		// potential sync node candidacy.
@@ -789,6 +1066,13 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		heightUpdate = best.Height
 		blkHashUpdate = &best.Hash
 
+		// Let the server know the peer relayed a new block which
+		// extended the main chain so it may be asked to announce
+		// new blocks in high-bandwidth compact block mode.
+		if best.Hash == *blockHash && sm.current() {
+			sm.peerNotifier.BlockRelayedByPeer(peer)
+		}
+
 		// Clear the rejected transactions.
 		sm.rejectedTxns = make(map[chainhash.Hash]struct{})
 	}
@@ -829,8 +1113,13 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 	prevHash := sm.nextCheckpoint.Hash
 	sm.nextCheckpoint = sm.findNextHeaderCheckpoint(prevHeight)
 	if sm.nextCheckpoint != nil {
+		sm.headersSync, err = sm.chain.NewHeadersSync(sm.nextCheckpoint)
+		if err != nil {
+			log.Errorf("Failed to start headers sync: %v", err)
+			return
+		}
 		locator := blockchain.BlockLocator([]*chainhash.Hash{prevHash})
-		err := peer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
+		err = peer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
 		if err != nil {
 			log.Warnf("Failed to send getheaders message to "+
 				"peer %s: %v", peer.Addr(), err)
@@ -846,6 +1135,7 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 	// no more checkpoints, so switch to normal mode by requesting blocks
 	// from the block after this one up to the end of the chain (zero hash).
 	sm.headersFirstMode = false
+	sm.headersSync = nil
 	sm.headerList.Init()
 	log.Infof("Reached the final checkpoint -- switching to normal mode")
 	locator := blockchain.BlockLocator([]*chainhash.Hash{blockHash})
@@ -911,6 +1201,72 @@ func (sm *SyncManager) fetchHeaderBlocks() {
 	}
 }
 
+// handleHistoricalBlock passes the provided block, which is part of the
+// historical chain leading up to a loaded utxo snapshot, to the chain and
+// requests more historical blocks when needed.
+func (sm *SyncManager) handleHistoricalBlock(block *hdfutil.Block, peer *peerpkg.Peer) {
+	blockHash := block.Hash()
+	err := sm.chain.ProcessHistoricalBlock(block)
+	if err != nil {
+		if ruleErr, ok := err.(blockchain.RuleError); ok {
+			log.Infof("Rejected historical block %v from %s: %v "+
+				"(%v: %s)", blockHash, peer, err, ruleErr.Err,
+				ruleErr.Context())
+		} else {
+			log.Errorf("Failed to process historical block %v: %v",
+				blockHash, err)
+		}
+		if dbErr, ok := err.(database.Error); ok && dbErr.ErrorCode ==
+			database.ErrCorruption {
+			panic(dbErr)
+		}
+
+		code, reason := mempool.ErrToRejectErr(err)
+		peer.PushRejectMsg(wire.CmdBlock, code, reason, blockHash, false)
+		return
+	}
+
+	if peer == sm.syncPeer {
+		sm.lastProgressTime = time.Now()
+	}
+	sm.fetchHistoricalBlocks()
+}
+
+// fetchHistoricalBlocks requests the next blocks in the historical chain
+// leading up to a loaded utxo snapshot that are needed to validate it in the
+// background from the sync peer when it is not already busy with enough of
+// them.  Only peers that serve the full chain are able to provide them.
+func (sm *SyncManager) fetchHistoricalBlocks() {
+	if sm.syncPeer == nil ||
+		sm.syncPeer.Services()&wire.SFNodeNetwork != wire.SFNodeNetwork {
+		return
+	}
+	state, exists := sm.peerStates[sm.syncPeer]
+	if !exists || len(state.requestedBlocks) >= minInFlightBlocks {
+		return
+	}
+
+	hashes := sm.chain.MissingHistoricalBlocks(wire.MaxInvPerMsg)
+	gdmsg := wire.NewMsgGetDataSizeHint(uint(len(hashes)))
+	for i := range hashes {
+		hash := &hashes[i]
+		if _, exists := sm.requestedBlocks[*hash]; exists {
+			continue
+		}
+
+		sm.requestedBlocks[*hash] = struct{}{}
+		state.requestedBlocks[*hash] = struct{}{}
+		iv := wire.NewInvVect(wire.InvTypeBlock, hash)
+		if sm.syncPeer.IsWitnessEnabled() {
+			iv.Type = wire.InvTypeWitnessBlock
+		}
+		gdmsg.AddInvVect(iv)
+	}
+	if len(gdmsg.InvList) > 0 {
+		sm.syncPeer.QueueMessage(gdmsg, nil)
+	}
+}
+
 // handleHeadersMsg handles block header messages from all peers.  Headers are
 // requested when performing a headers-first sync.
 func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
@@ -921,6 +1277,13 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 		return
 	}
 
+	// All headers are accepted in headers-only mode, including those
+	// which announce new blocks.
+	if sm.headersOnly {
+		sm.handleHeadersOnly(peer, hmsg.headers.Headers)
+		return
+	}
+
 	// The remote peer is misbehaving if we didn't request headers.
 	msg := hmsg.headers
 	numHeaders := len(msg.Headers)
@@ -936,13 +1299,27 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 		return
 	}
 
-	// Process all of the received headers ensuring each one connects to the
+	// Process the received headers with the headers sync which presyncs
+	// them up to the next checkpoint before they are downloaded again.
+	// Only the headers which have been verified to lead to the checkpoint
+	// are returned to be added to the list of headers.
+	headers, err := sm.headersSync.ProcessHeaders(msg.Headers)
+	if err != nil {
+		log.Warnf("Received invalid block headers from peer %s: %v "+
+			"-- disconnecting", peer.Addr(), err)
+		peer.Disconnect()
+		return
+	}
+
+	// Valid headers are progress since the headers are downloaded twice
+	// before any of the blocks are requested.
+	sm.lastProgressTime = time.Now()
+
+	// Add all of the verified headers ensuring each one connects to the
 	// previous and that checkpoints match.
 	receivedCheckpoint := false
-	var finalHash *chainhash.Hash
-	for _, blockHeader := range msg.Headers {
+	for _, blockHeader := range headers {
 		blockHash := blockHeader.BlockHash()
-		finalHash = &blockHash
 
 		// Ensure there is a previous header to compare against.
 		prevNodeEl := sm.headerList.Back()
@@ -1003,15 +1380,18 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 		log.Infof("Received %v block headers: Fetching blocks",
 			sm.headerList.Len())
 		sm.progressLogger.SetLastLogTime(time.Now())
+		sm.progress.resetWindow(time.Now())
 		sm.fetchHeaderBlocks()
 		return
 	}
 
 	// This header is not a checkpoint, so request the next batch of
-	// headers starting from the latest known header and ending with the
-	// next checkpoint.
-	locator := blockchain.BlockLocator([]*chainhash.Hash{finalHash})
-	err := peer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
+	// headers starting from the latest header processed by the headers
+	// sync and ending with the next checkpoint.
+	locator := blockchain.BlockLocator([]*chainhash.Hash{
+		sm.headersSync.NextLocatorHash(),
+	})
+	err = peer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
 	if err != nil {
 		log.Warnf("Failed to send getheaders message to "+
 			"peer %s: %v", peer.Addr(), err)
@@ -1019,6 +1399,304 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 	}
 }
 
+// handleHeadersOnly adds the passed headers received from the passed peer to
+// the header chain in headers-only mode.  The headers leading up to headers
+// which do not connect to the header chain, such as those announcing new
+// blocks after others were missed, are requested from the peer.  More headers
+// are requested when a full headers message is received, and once the headers
+// are synced with the sync peer, their committed filter headers are requested
+// when enabled.
+func (sm *SyncManager) handleHeadersOnly(peer *peerpkg.Peer, headers []*wire.BlockHeader) {
+	numHeaders := len(headers)
+	if numHeaders == 0 {
+		return
+	}
+
+	if !sm.headerChain.HaveHeader(&headers[0].PrevBlock) {
+		locator := sm.headerChain.BlockLocator()
+		err := peer.PushGetHeadersMsg(locator, &zeroHash)
+		if err != nil {
+			log.Warnf("Failed to send getheaders message to "+
+				"peer %s: %v", peer.Addr(), err)
+		}
+		return
+	}
+
+	if err := sm.headerChain.AddHeaders(headers); err != nil {
+		log.Warnf("Received invalid block headers from peer %s: %v "+
+			"-- disconnecting", peer.Addr(), err)
+		peer.Disconnect()
+		return
+	}
+
+	// Update the best known block of the peer since it has the headers
+	// it sent.
+	lastHash := headers[numHeaders-1].BlockHash()
+	peer.UpdateLastAnnouncedBlock(&lastHash)
+	if _, height, err := sm.headerChain.HeaderByHash(&lastHash); err == nil &&
+		height > peer.LastBlock() {
+
+		peer.UpdateLastBlockHeight(height)
+	}
+	if peer == sm.syncPeer {
+		sm.lastProgressTime = time.Now()
+	}
+	sm.updateSyncProgress(0, 0)
+
+	// Request the next batch of headers when the peer sent as many as it
+	// is allowed to since it likely has more.
+	if numHeaders == wire.MaxBlockHeadersPerMsg {
+		locator := blockchain.BlockLocator([]*chainhash.Hash{&lastHash})
+		err := peer.PushGetHeadersMsg(locator, &zeroHash)
+		if err != nil {
+			log.Warnf("Failed to send getheaders message to "+
+				"peer %s: %v", peer.Addr(), err)
+		}
+		return
+	}
+
+	if peer == sm.syncPeer {
+		_, height := sm.headerChain.BestHeader()
+		log.Infof("Synced headers to height %d from peer %s", height,
+			peer.Addr())
+		sm.fetchFilterHeaders()
+	}
+}
+
+// fetchFilterHeaders requests the next batch of committed filter headers of
+// the header chain from the sync peer in headers-only mode when enabled, the
+// sync peer serves them, and there is not already a pending request.
+func (sm *SyncManager) fetchFilterHeaders() {
+	if !sm.syncCFHeaders || sm.syncPeer == nil ||
+		sm.syncPeer.Services()&wire.SFNodeCF != wire.SFNodeCF ||
+		sm.requestedCFHeaders != nil {
+
+		return
+	}
+
+	filterTip := sm.headerChain.FilterTip()
+	_, bestHeight := sm.headerChain.BestHeader()
+	if filterTip >= bestHeight {
+		return
+	}
+	stopHeight := filterTip + wire.MaxCFHeadersPerMsg
+	if stopHeight > bestHeight {
+		stopHeight = bestHeight
+	}
+	stopHeader, err := sm.headerChain.HeaderByHeight(stopHeight)
+	if err != nil {
+		log.Errorf("Failed to look up header at height %d: %v",
+			stopHeight, err)
+		return
+	}
+
+	stopHash := stopHeader.BlockHash()
+	sm.requestedCFHeaders = &stopHash
+	sm.syncPeer.QueueMessage(wire.NewMsgGetCFHeaders(wire.GCSFilterRegular,
+		uint32(filterTip+1), &stopHash), nil)
+}
+
+// handleCFHeadersMsg handles cfheaders messages from all peers.  The committed
+// filter headers are requested from the sync peer in headers-only mode when
+// enabled.
+func (sm *SyncManager) handleCFHeadersMsg(cfmsg *cfHeadersMsg) {
+	peer := cfmsg.peer
+	if _, exists := sm.peerStates[peer]; !exists {
+		log.Warnf("Received cfheaders message from unknown peer %s",
+			peer)
+		return
+	}
+
+	// Ignore filter headers which were not requested.
+	msg := cfmsg.cfHeaders
+	if peer != sm.syncPeer || sm.requestedCFHeaders == nil ||
+		msg.FilterType != wire.GCSFilterRegular ||
+		msg.StopHash != *sm.requestedCFHeaders {
+
+		log.Debugf("Ignoring unrequested cfheaders from %s", peer)
+		return
+	}
+	sm.requestedCFHeaders = nil
+
+	err := sm.headerChain.AddFilterHeaders(&msg.StopHash,
+		&msg.PrevFilterHeader, msg.FilterHashes)
+	if err != nil {
+		log.Warnf("Received invalid filter headers from peer %s: %v "+
+			"-- disconnecting", peer.Addr(), err)
+		peer.Disconnect()
+		return
+	}
+
+	sm.lastProgressTime = time.Now()
+	sm.fetchFilterHeaders()
+}
+
+// handleCmpctBlockMsg handles cmpctblock messages from all peers.  Blocks
+// announced by way of compact blocks which are not already known, and which are
+// not already requested from another peer, are reconstructed from the
+// transactions in the mempool.  The transactions missing from the mempool are
+// requested from the peer that announced the block by way of getblocktxn, and
+// the block is requested in full when it can't be reconstructed.
+func (sm *SyncManager) handleCmpctBlockMsg(cmsg *cmpctBlockMsg) {
+	peer := cmsg.peer
+	state, exists := sm.peerStates[peer]
+	if !exists {
+		log.Warnf("Received cmpctblock message from unknown peer %s",
+			peer)
+		return
+	}
+
+	// Only the header of compact blocks is used in headers-only mode.
+	if sm.headersOnly {
+		header := cmsg.cmpctBlock.Header
+		sm.handleHeadersOnly(peer, []*wire.BlockHeader{&header})
+		return
+	}
+
+	// Compact blocks are only used to relay new blocks, so ignore them
+	// while the chain is not current.  The blocks are fetched as part of
+	// the initial block download instead.
+	if !sm.current() {
+		return
+	}
+
+	blockHash := cmsg.cmpctBlock.Header.BlockHash()
+	iv := wire.NewInvVect(wire.InvTypeBlock, &blockHash)
+	peer.AddKnownInventory(iv)
+	peer.UpdateLastAnnouncedBlock(&blockHash)
+
+	haveInv, err := sm.haveInventory(iv)
+	if err != nil {
+		log.Warnf("Unexpected failure when checking for existing "+
+			"inventory during cmpctblock processing: %v", err)
+		return
+	}
+	if haveInv {
+		return
+	}
+	if _, exists := sm.requestedBlocks[blockHash]; exists {
+		return
+	}
+
+	limitAdd(sm.requestedBlocks, blockHash, maxRequestedBlocks)
+	limitAdd(state.requestedBlocks, blockHash, maxRequestedBlocks)
+
+	// Only compact blocks which use witness transaction hashes for their
+	// short ids can be reconstructed since the prefilled and requested
+	// transactions lack their witnesses otherwise.
+	if peer.CmpctBlockVersion() < 2 || len(sm.partialBlocks) >= maxPartialBlocks {
+		sm.requestFullBlock(peer, &blockHash)
+		return
+	}
+
+	atomic.AddUint64(&sm.cmpctStats.received, 1)
+	pb, err := newPartialBlock(cmsg.cmpctBlock, peer, sm.mempoolTxns())
+	if err != nil {
+		log.Debugf("Unable to reconstruct compact block %v from %s: "+
+			"%v", blockHash, peer, err)
+		atomic.AddUint64(&sm.cmpctStats.fallbacks, 1)
+		sm.requestFullBlock(peer, &blockHash)
+		return
+	}
+	if len(pb.missing) == 0 {
+		sm.processPartialBlock(pb)
+		return
+	}
+
+	// Request the transactions missing from the mempool.
+	gbmsg := wire.NewMsgGetBlockTxn(&blockHash)
+	for _, index := range pb.missing {
+		if err := gbmsg.AddIndex(index); err != nil {
+			log.Errorf("Failed to request transaction %d of block "+
+				"%v: %v", index, blockHash, err)
+			atomic.AddUint64(&sm.cmpctStats.fallbacks, 1)
+			sm.requestFullBlock(peer, &blockHash)
+			return
+		}
+	}
+	log.Debugf("Requesting %d transactions of compact block %v missing "+
+		"from the mempool from %s", len(pb.missing), blockHash, peer)
+	atomic.AddUint64(&sm.cmpctStats.requestedTxns, uint64(len(pb.missing)))
+	sm.partialBlocks[blockHash] = pb
+	peer.QueueMessage(gbmsg, nil)
+}
+
+// mempoolTxns returns the transactions in the mempool, which are used to
+// reconstruct blocks announced by way of compact blocks.
+func (sm *SyncManager) mempoolTxns() []*hdfutil.Tx {
+	descs := sm.txMemPool.TxDescs()
+	txns := make([]*hdfutil.Tx, 0, len(descs))
+	for _, desc := range descs {
+		txns = append(txns, desc.Tx)
+	}
+	return txns
+}
+
+// requestFullBlock requests the block with the passed hash in full from the
+// passed peer.  It is used when a block announced by way of a compact block
+// can't be reconstructed.
+func (sm *SyncManager) requestFullBlock(peer *peerpkg.Peer, hash *chainhash.Hash) {
+	iv := wire.NewInvVect(wire.InvTypeBlock, hash)
+	if peer.IsWitnessEnabled() {
+		iv.Type = wire.InvTypeWitnessBlock
+	}
+	gdmsg := wire.NewMsgGetDataSizeHint(1)
+	gdmsg.AddInvVect(iv)
+	peer.QueueMessage(gdmsg, nil)
+}
+
+// processPartialBlock processes the block reconstructed from the passed
+// partial block, which must not have any missing transactions, as if it had
+// been received in full.  The block is requested in full from the peer that
+// announced it instead when the reconstructed transactions do not match it.
+func (sm *SyncManager) processPartialBlock(pb *partialBlock) {
+	blockHash := pb.header.BlockHash()
+	block, err := pb.block()
+	if err != nil {
+		log.Debugf("Failed to reconstruct compact block %v from %s: %v",
+			blockHash, pb.peer, err)
+		atomic.AddUint64(&sm.cmpctStats.fallbacks, 1)
+		sm.requestFullBlock(pb.peer, &blockHash)
+		return
+	}
+
+	if pb.requestedTxns {
+		atomic.AddUint64(&sm.cmpctStats.reconstructedWithBlockTxn, 1)
+	} else {
+		atomic.AddUint64(&sm.cmpctStats.reconstructed, 1)
+	}
+	sm.handleBlockMsg(&blockMsg{block: block, peer: pb.peer})
+}
+
+// handleBlockTxnMsg handles blocktxn messages from all peers.  The transactions
+// complete the blocks announced by way of compact blocks for which the
+// transactions missing from the mempool were requested.
+func (sm *SyncManager) handleBlockTxnMsg(bmsg *blockTxnMsg) {
+	peer := bmsg.peer
+	if _, exists := sm.peerStates[peer]; !exists {
+		log.Warnf("Received blocktxn message from unknown peer %s", peer)
+		return
+	}
+
+	msg := bmsg.blockTxn
+	pb, exists := sm.partialBlocks[msg.BlockHash]
+	if !exists || pb.peer != peer {
+		log.Debugf("Ignoring unrequested blocktxn for block %v from %s",
+			msg.BlockHash, peer)
+		return
+	}
+	delete(sm.partialBlocks, msg.BlockHash)
+
+	if err := pb.fill(msg.Transactions); err != nil {
+		log.Debugf("Received invalid blocktxn for block %v from %s: %v",
+			msg.BlockHash, peer, err)
+		atomic.AddUint64(&sm.cmpctStats.fallbacks, 1)
+		sm.requestFullBlock(peer, &msg.BlockHash)
+		return
+	}
+	sm.processPartialBlock(pb)
+}
+
 // handleNotFoundMsg handles notfound messages from all peers.
 func (sm *SyncManager) handleNotFoundMsg(nfmsg *notFoundMsg) {
 	peer := nfmsg.peer
@@ -1036,13 +1714,15 @@ func (sm *SyncManager) handleNotFoundMsg(nfmsg *notFoundMsg) {
 				delete(state.requestedBlocks, inv.Hash)
 				delete(sm.requestedBlocks, inv.Hash)
 			}
+		case wire.InvTypeWitnessTx:
+			fallthrough
 		case wire.InvTypeTx:
-			if _, exists := state.requestedTxns[inv.Hash]; exists {
-				delete(state.requestedTxns, inv.Hash)
-				delete(sm.requestedTxns, inv.Hash)
-			}
+			// Request the transaction from the next best peer
+			// that announced it, if any.
+			sm.txRequests.notFound(inv.Hash, peer)
 		}
 	}
+	sm.requestTxns()
 }
 
 // haveInventory returns whether or not the inventory represented by the passed
@@ -1068,6 +1748,15 @@ func (sm *SyncManager) haveInventory(invVect *wire.InvVect) (bool, error) {
 			return true, nil
 		}
 
+		// Peers which have not yet learned about a new block commonly
+		// keep announcing the transactions it confirmed.  Check the
+		// recently confirmed transactions before the more expensive
+		// utxo lookups below, which also miss the transactions whose
+		// outputs have already been spent.
+		if sm.recentlyConfirmed.Contains(&invVect.Hash) {
+			return true, nil
+		}
+
 		// Check if the transaction exists from the point of view of the
 		// end of the main chain.  Note that this is only a best effort
 		// since it is expensive to check existence of every output and
@@ -1132,6 +1821,18 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 		return
 	}
 
+	// Only the headers of announced blocks are requested in headers-only
+	// mode and all other inventory is ignored.
+	if sm.headersOnly {
+		if lastBlock != -1 &&
+			!sm.headerChain.HaveHeader(&invVects[lastBlock].Hash) {
+
+			locator := sm.headerChain.BlockLocator()
+			peer.PushGetHeadersMsg(locator, &invVects[lastBlock].Hash)
+		}
+		return
+	}
+
 	// If our chain is current and a peer announces a block we already
 	// know of, then update their current block height.
 	if lastBlock != -1 && sm.current() {
@@ -1145,6 +1846,7 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 	// request parent blocks of orphans if we receive one we already have.
 	// Finally, attempt to detect potential stalls due to long side chains
 	// we already have and request more blocks to prevent them.
+	now := time.Now()
 	for i, iv := range invVects {
 		// Ignore unsupported inventory types.
 		switch iv.Type {
@@ -1174,12 +1876,19 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 			continue
 		}
 		if !haveInv {
-			if iv.Type == wire.InvTypeTx {
+			if iv.Type == wire.InvTypeTx || iv.Type == wire.InvTypeWitnessTx {
 				// Skip the transaction if it has already been
 				// rejected.
 				if _, exists := sm.rejectedTxns[iv.Hash]; exists {
 					continue
 				}
+
+				// Track the announcement so the transaction is
+				// requested from the best peer announcing it.
+				sm.txRequests.announce(iv.Hash, peer,
+					!peer.Inbound(),
+					peer.IsWTxIdRelayEnabled(), now)
+				continue
 			}
 
 			// Ignore invs block invs from non-witness enabled
@@ -1264,24 +1973,6 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 				numRequested++
 			}
 
-		case wire.InvTypeWitnessTx:
-			fallthrough
-		case wire.InvTypeTx:
-			// Request the transaction if there is not already a
-			// pending request.
-			if _, exists := sm.requestedTxns[iv.Hash]; !exists {
-				limitAdd(sm.requestedTxns, iv.Hash, maxRequestedTxns)
-				limitAdd(state.requestedTxns, iv.Hash, maxRequestedTxns)
-
-				// If the peer is capable, request the txn
-				// including all witness data.
-				if peer.IsWitnessEnabled() {
-					iv.Type = wire.InvTypeWitnessTx
-				}
-
-				gdmsg.AddInvVect(iv)
-				numRequested++
-			}
 		}
 
 		if numRequested >= wire.MaxInvPerMsg {
@@ -1292,6 +1983,9 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 	if len(gdmsg.InvList) > 0 {
 		peer.QueueMessage(gdmsg, nil)
 	}
+
+	// Request the announced transactions from the selected peers.
+	sm.requestTxns()
 }
 
 // blockHandler is the main handler for the sync manager.  It must be run as a
@@ -1303,6 +1997,8 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 func (sm *SyncManager) blockHandler() {
 	stallTicker := time.NewTicker(stallSampleInterval)
 	defer stallTicker.Stop()
+	txRequestTicker := time.NewTicker(txRequestCheckInterval)
+	defer txRequestTicker.Stop()
 
 out:
 	for {
@@ -1326,12 +2022,30 @@ out:
 			case *headersMsg:
 				sm.handleHeadersMsg(msg)
 
+			case *cmpctBlockMsg:
+				sm.handleCmpctBlockMsg(msg)
+
 			case *notFoundMsg:
 				sm.handleNotFoundMsg(msg)
 
+			case *blockTxnMsg:
+				sm.handleBlockTxnMsg(msg)
+
+			case *cfHeadersMsg:
+				sm.handleCFHeadersMsg(msg)
+
 			case *donePeerMsg:
 				sm.handleDonePeerMsg(msg.peer)
 
+			case getSyncOptionsMsg:
+				msg.reply <- SyncOptions{
+					MaxSyncPeers:   sm.maxSyncPeers,
+					CheckpointMode: sm.chain.CheckpointMode(),
+				}
+
+			case setSyncOptionsMsg:
+				msg.reply <- sm.handleSetSyncOptions(&msg.opts)
+
 			case getSyncPeerMsg:
 				var peerID int32
 				if sm.syncPeer != nil {
@@ -1368,6 +2082,10 @@ out:
 
 		case <-stallTicker.C:
 			sm.handleStallSample()
+			sm.fetchHistoricalBlocks()
+
+		case <-txRequestTicker.C:
+			sm.handleTxRequestTimeouts()
 
 		case <-sm.quit:
 			break out
@@ -1410,6 +2128,14 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 			break
 		}
 
+		// Register block with the fee estimator, if it exists.  This
+		// must be done before the transactions of the block are removed
+		// from the transaction pool so they are recorded as confirmed
+		// rather than as having left the pool unconfirmed.
+		if sm.feeEstimator != nil {
+			sm.feeEstimator.RegisterBlock(block)
+		}
+
 		// Remove all of the transactions (except the coinbase) in the
 		// connected block from the transaction pool.  Secondly, remove any
 		// transactions which are now double spends as a result of these
@@ -1418,6 +2144,7 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 		// transaction are NOT removed recursively because they are still
 		// valid.
 		for _, tx := range block.Transactions()[1:] {
+			sm.recentlyConfirmed.Add(tx.Hash())
 			sm.txMemPool.RemoveTransaction(tx, false)
 			sm.txMemPool.RemoveDoubleSpends(tx)
 			sm.txMemPool.RemoveOrphan(tx)
@@ -1426,20 +2153,6 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 			sm.peerNotifier.AnnounceNewTransactions(acceptedTxs)
 		}
 
-		// Register block with the fee estimator, if it exists.
-		if sm.feeEstimator != nil {
-			err := sm.feeEstimator.RegisterBlock(block)
-
-			// If an error is somehow generated then the fee estimator
-			// has entered an invalid state. Since it doesn't know how
-			// to recover, create a new one.
-			if err != nil {
-				sm.feeEstimator = mempool.NewFeeEstimator(
-					mempool.DefaultEstimateFeeMaxRollback,
-					mempool.DefaultEstimateFeeMinRegisteredBlocks)
-			}
-		}
-
 	// A block has been disconnected from the main block chain.
 	case blockchain.NTBlockDisconnected:
 		block, ok := notification.Data.(*hdfutil.Block)
@@ -1448,6 +2161,11 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 			break
 		}
 
+		// The transactions of the block are no longer confirmed, so
+		// they must be requested again if they are announced and are
+		// not reinserted into the transaction pool below.
+		sm.recentlyConfirmed.Reset()
+
 		// Reinsert all of the transactions (except the coinbase) into
 		// the transaction pool.
 		for _, tx := range block.Transactions()[1:] {
@@ -1461,10 +2179,9 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 			}
 		}
 
-		// Rollback previous block recorded by the fee estimator.
-		if sm.feeEstimator != nil {
-			sm.feeEstimator.Rollback(block.Hash())
-		}
+		// Note that the fee estimator is not informed about
+		// disconnected blocks.  It ignores the blocks which replace
+		// them, so the transactions are not counted twice.
 	}
 }
 
@@ -1526,6 +2243,30 @@ func (sm *SyncManager) QueueHeaders(headers *wire.MsgHeaders, peer *peerpkg.Peer
 	sm.msgChan <- &headersMsg{headers: headers, peer: peer}
 }
 
+// QueueCmpctBlock adds the passed cmpctblock message and peer to the block
+// handling queue.
+func (sm *SyncManager) QueueCmpctBlock(cmpctBlock *wire.MsgCmpctBlock, peer *peerpkg.Peer) {
+	// No channel handling here because peers do not need to block on
+	// cmpctblock messages.
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return
+	}
+
+	sm.msgChan <- &cmpctBlockMsg{cmpctBlock: cmpctBlock, peer: peer}
+}
+
+// QueueBlockTxn adds the passed blocktxn message and peer to the block handling
+// queue.
+func (sm *SyncManager) QueueBlockTxn(blockTxn *wire.MsgBlockTxn, peer *peerpkg.Peer) {
+	// No channel handling here because peers do not need to block on
+	// blocktxn messages.
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return
+	}
+
+	sm.msgChan <- &blockTxnMsg{blockTxn: blockTxn, peer: peer}
+}
+
 // QueueNotFound adds the passed notfound message and peer to the block handling
 // queue.
 func (sm *SyncManager) QueueNotFound(notFound *wire.MsgNotFound, peer *peerpkg.Peer) {
@@ -1538,6 +2279,18 @@ func (sm *SyncManager) QueueNotFound(notFound *wire.MsgNotFound, peer *peerpkg.P
 	sm.msgChan <- &notFoundMsg{notFound: notFound, peer: peer}
 }
 
+// QueueCFHeaders adds the passed cfheaders message and peer to the block
+// handling queue.
+func (sm *SyncManager) QueueCFHeaders(cfHeaders *wire.MsgCFHeaders, peer *peerpkg.Peer) {
+	// No channel handling here because peers do not need to block on
+	// cfheaders messages.
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return
+	}
+
+	sm.msgChan <- &cfHeadersMsg{cfHeaders: cfHeaders, peer: peer}
+}
+
 // DonePeer informs the blockmanager that a peer has disconnected.
 func (sm *SyncManager) DonePeer(peer *peerpkg.Peer) {
 	// Ignore if we are shutting down.
@@ -1575,6 +2328,23 @@ func (sm *SyncManager) Stop() error {
 	return nil
 }
 
+// SyncOptions returns the options of the sync manager which may be adjusted
+// while it is running.
+func (sm *SyncManager) SyncOptions() SyncOptions {
+	reply := make(chan SyncOptions)
+	sm.msgChan <- getSyncOptionsMsg{reply: reply}
+	return <-reply
+}
+
+// SetSyncOptions replaces the options of the sync manager with the passed ones
+// without restarting it.  An error is returned when the maximum number of sync
+// peers is less than 1 or the checkpoint mode is unknown.
+func (sm *SyncManager) SetSyncOptions(opts *SyncOptions) error {
+	reply := make(chan error)
+	sm.msgChan <- setSyncOptionsMsg{opts: *opts, reply: reply}
+	return <-reply
+}
+
 // SyncPeerID returns the ID of the current sync peer, or 0 if there is none.
 func (sm *SyncManager) SyncPeerID() int32 {
 	reply := make(chan int32)
@@ -1599,6 +2369,49 @@ func (sm *SyncManager) IsCurrent() bool {
 	return <-reply
 }
 
+// RecentlyConfirmedStats returns statistics about the filter of recently
+// confirmed transactions which suppresses requests for transactions announced
+// after they were already confirmed.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) RecentlyConfirmedStats() RecentlyConfirmedStats {
+	return sm.recentlyConfirmed.Stats()
+}
+
+// CmpctBlockStats returns statistics about the reconstruction of the blocks
+// announced by way of compact blocks.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) CmpctBlockStats() CmpctBlockStats {
+	return sm.cmpctStats.snapshot()
+}
+
+// SyncProgress returns the most recent progress of syncing and validating the
+// chain.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) SyncProgress() SyncProgress {
+	return sm.progress.snapshot()
+}
+
+// SubscribeSyncProgress registers a callback to be executed with progress
+// events while the chain is synced.  The events are delivered at most once
+// every 10 seconds, and only when progress was made, from the goroutine which
+// processes blocks, so callbacks must not block.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) SubscribeSyncProgress(callback SyncProgressCallback) {
+	sm.progress.subscribe(callback)
+}
+
+// HeaderChain returns the chain of headers synced in headers-only mode or nil
+// when the sync manager is not in headers-only mode.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) HeaderChain() *HeaderChain {
+	return sm.headerChain
+}
+
 // Pause pauses the sync manager until the returned channel is closed.
 //
 // Note that while paused, all peer and block processing is halted.  The
@@ -1613,19 +2426,28 @@ func (sm *SyncManager) Pause() chan<- struct{} {
 // block, tx, and inv updates.
 func New(config *Config) (*SyncManager, error) {
 	sm := SyncManager{
-		peerNotifier:    config.PeerNotifier,
-		chain:           config.Chain,
-		txMemPool:       config.TxMemPool,
-		chainParams:     config.ChainParams,
-		rejectedTxns:    make(map[chainhash.Hash]struct{}),
-		requestedTxns:   make(map[chainhash.Hash]struct{}),
-		requestedBlocks: make(map[chainhash.Hash]struct{}),
-		peerStates:      make(map[*peerpkg.Peer]*peerSyncState),
-		progressLogger:  newBlockProgressLogger("Processed", log),
-		msgChan:         make(chan interface{}, config.MaxPeers*3),
-		headerList:      list.New(),
-		quit:            make(chan struct{}),
-		feeEstimator:    config.FeeEstimator,
+		peerNotifier:      config.PeerNotifier,
+		chain:             config.Chain,
+		txMemPool:         config.TxMemPool,
+		chainParams:       config.ChainParams,
+		rejectedTxns:      make(map[chainhash.Hash]struct{}),
+		txRequests:        newTxRequestTracker(maxRequestedTxns, txRequestTimeout),
+		requestedBlocks:   make(map[chainhash.Hash]struct{}),
+		partialBlocks:     make(map[chainhash.Hash]*partialBlock),
+		progress:          newSyncProgress(config.ChainParams.TargetTimePerBlock),
+		peerStates:        make(map[*peerpkg.Peer]*peerSyncState),
+		progressLogger:    newBlockProgressLogger("Processed", log),
+		msgChan:           make(chan interface{}, config.MaxPeers*3),
+		headerList:        list.New(),
+		recentlyConfirmed: newRecentlyConfirmedTxns(),
+		quit:              make(chan struct{}),
+		feeEstimator:      config.FeeEstimator,
+		headersOnly:       config.HeadersOnly,
+		syncCFHeaders:     config.HeadersOnly && config.SyncCFHeaders,
+		maxSyncPeers:      config.MaxPeers,
+	}
+	if sm.maxSyncPeers < 1 {
+		sm.maxSyncPeers = 1
 	}
 
 	best := sm.chain.BestSnapshot()
@@ -1639,6 +2461,23 @@ func New(config *Config) (*SyncManager, error) {
 		log.Info("Checkpoints are disabled")
 	}
 
+	// Build the header chain on top of the most recent blocks in
+	// headers-only mode.
+	if sm.headersOnly {
+		var checkpoints []chaincfg.Checkpoint
+		if !config.DisableCheckpoints {
+			checkpoints = sm.chain.Checkpoints()
+		}
+		headerChain, err := newHeaderChainFromBlockChain(sm.chain,
+			checkpoints, config.TimeSource)
+		if err != nil {
+			return nil, err
+		}
+		sm.headerChain = headerChain
+		sm.nextCheckpoint = nil
+		log.Info("Syncing headers only")
+	}
+
 	sm.chain.Subscribe(sm.handleBlockchainNotification)
 
 	return &sm, nil
@@ -0,0 +1,201 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ifishnet/hdfd/blockchain"
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+)
+
+// syncProgressInterval is the minimum interval between the sync progress
+// events delivered to subscribers.  It also is the window the throughput is
+// measured over.
+const syncProgressInterval = 10 * time.Second
+
+// SyncProgress describes the progress of syncing and validating the block
+// chain.
+type SyncProgress struct {
+	// HeadersHeight is the height of the best known header.  It may be
+	// ahead of the validated height while syncing.
+	HeadersHeight int32
+
+	// ValidatedHeight and ValidatedHash identify the tip of the validated
+	// main chain.
+	ValidatedHeight int32
+	ValidatedHash   chainhash.Hash
+
+	// BlockTime is the timestamp of the block at the tip of the validated
+	// main chain.
+	BlockTime time.Time
+
+	// VerificationProgress is an estimate between 0 and 1 of how much of
+	// the chain has been validated.  It is based on the number of
+	// transactions validated so far compared to the number expected in the
+	// remaining blocks.
+	VerificationProgress float64
+
+	// WindowBlocks and WindowTxns are the number of blocks and transactions
+	// processed during the most recent throughput window, which lasted
+	// WindowDuration.
+	WindowBlocks   int64
+	WindowTxns     int64
+	WindowDuration time.Duration
+
+	// BlocksPerSecond and TxnsPerSecond are the processing rates during the
+	// most recent throughput window.
+	BlocksPerSecond float64
+	TxnsPerSecond   float64
+}
+
+// SyncProgressCallback is used for a caller to provide a callback for sync
+// progress events.
+type SyncProgressCallback func(*SyncProgress)
+
+// estimateVerificationProgress returns an estimate between 0 and 1 of how much
+// of the chain has been validated given the passed best chain state, the
+// timestamp of its tip, and the height of the best known header.
+//
+// The number of remaining blocks is the larger of the number of known headers
+// which are not validated yet and the number of blocks expected to have been
+// mined since the tip, so the estimate is meaningful before all headers are
+// known.  The remaining blocks are expected to contain as many transactions as
+// the larger of the passed recent average and the historical average.
+func estimateVerificationProgress(best *blockchain.BestState, blockTime time.Time,
+	headersHeight int32, txnsPerBlock float64, targetTimePerBlock time.Duration,
+	now time.Time) float64 {
+
+	remaining := float64(headersHeight - best.Height)
+	if targetTimePerBlock > 0 {
+		elapsed := float64(now.Sub(blockTime)) / float64(targetTimePerBlock)
+		if elapsed > remaining {
+			remaining = elapsed
+		}
+	}
+	if remaining <= 0 {
+		return 1
+	}
+
+	validated := float64(best.TotalTxns)
+	if avg := validated / float64(best.Height+1); avg > txnsPerBlock {
+		txnsPerBlock = avg
+	}
+	return validated / (validated + remaining*txnsPerBlock)
+}
+
+// syncProgress tracks the progress of syncing the block chain and delivers
+// progress events to subscribers at most once per syncProgressInterval.
+//
+// It is safe for concurrent access.
+type syncProgress struct {
+	targetTimePerBlock time.Duration
+
+	mtx          sync.Mutex
+	latest       SyncProgress
+	callbacks    []SyncProgressCallback
+	windowStart  time.Time
+	windowBlocks int64
+	windowTxns   int64
+	lastHeaders  int32
+}
+
+// newSyncProgress returns a new sync progress tracker for a chain with the
+// passed target time between blocks.
+func newSyncProgress(targetTimePerBlock time.Duration) *syncProgress {
+	return &syncProgress{
+		targetTimePerBlock: targetTimePerBlock,
+		windowStart:        time.Now(),
+	}
+}
+
+// subscribe registers the passed callback to be executed with each progress
+// event.
+//
+// This function is safe for concurrent access.
+func (p *syncProgress) subscribe(callback SyncProgressCallback) {
+	p.mtx.Lock()
+	p.callbacks = append(p.callbacks, callback)
+	p.mtx.Unlock()
+}
+
+// snapshot returns the most recent progress.
+//
+// This function is safe for concurrent access.
+func (p *syncProgress) snapshot() SyncProgress {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.latest
+}
+
+// resetWindow starts a new throughput window at the passed time without
+// delivering an event for the current one.
+//
+// This function is safe for concurrent access.
+func (p *syncProgress) resetWindow(now time.Time) {
+	p.mtx.Lock()
+	p.windowStart = now
+	p.windowBlocks = 0
+	p.windowTxns = 0
+	p.mtx.Unlock()
+}
+
+// update records the passed number of processed blocks and transactions along
+// with the current best chain state, the timestamp of its tip, and the height
+// of the best known header.  The subscribers are notified when the throughput
+// window ended and progress was made during it.
+//
+// This function is safe for concurrent access.
+func (p *syncProgress) update(best *blockchain.BestState, blockTime time.Time,
+	headersHeight int32, numBlocks, numTxns int, now time.Time) {
+
+	p.mtx.Lock()
+	p.windowBlocks += int64(numBlocks)
+	p.windowTxns += int64(numTxns)
+
+	// Estimate the transactions in the remaining blocks from the most
+	// recent window with processed blocks.
+	var txnsPerBlock float64
+	if p.latest.WindowBlocks > 0 {
+		txnsPerBlock = float64(p.latest.WindowTxns) /
+			float64(p.latest.WindowBlocks)
+	}
+	p.latest.HeadersHeight = headersHeight
+	p.latest.ValidatedHeight = best.Height
+	p.latest.ValidatedHash = best.Hash
+	p.latest.BlockTime = blockTime
+	p.latest.VerificationProgress = estimateVerificationProgress(best,
+		blockTime, headersHeight, txnsPerBlock, p.targetTimePerBlock, now)
+
+	duration := now.Sub(p.windowStart)
+	if duration < syncProgressInterval ||
+		(p.windowBlocks == 0 && headersHeight == p.lastHeaders) {
+
+		p.mtx.Unlock()
+		return
+	}
+
+	seconds := duration.Seconds()
+	p.latest.WindowBlocks = p.windowBlocks
+	p.latest.WindowTxns = p.windowTxns
+	p.latest.WindowDuration = duration
+	p.latest.BlocksPerSecond = float64(p.windowBlocks) / seconds
+	p.latest.TxnsPerSecond = float64(p.windowTxns) / seconds
+	p.windowStart = now
+	p.windowBlocks = 0
+	p.windowTxns = 0
+	p.lastHeaders = headersHeight
+
+	event := p.latest
+	callbacks := p.callbacks
+	p.mtx.Unlock()
+
+	// Deliver the event outside of the lock so subscribers may query the
+	// progress.
+	for _, callback := range callbacks {
+		callback(&event)
+	}
+}
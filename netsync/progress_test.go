@@ -0,0 +1,104 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ifishnet/hdfd/blockchain"
+)
+
+// TestEstimateVerificationProgress ensures the verification progress is
+// estimated from the remaining known headers or the time since the tip,
+// whichever implies more remaining blocks.
+func TestEstimateVerificationProgress(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1600000000, 0)
+	best := &blockchain.BestState{Height: 99, TotalTxns: 1000}
+	tests := []struct {
+		name          string
+		blockTime     time.Time
+		headersHeight int32
+		txnsPerBlock  float64
+		want          float64
+	}{{
+		name:          "synced",
+		blockTime:     now,
+		headersHeight: 99,
+		want:          1,
+	}, {
+		name:          "remaining headers",
+		blockTime:     now,
+		headersHeight: 199,
+		want:          0.5,
+	}, {
+		name:          "remaining headers with busier recent blocks",
+		blockTime:     now,
+		headersHeight: 199,
+		txnsPerBlock:  30,
+		want:          0.25,
+	}, {
+		name:          "headers not yet known",
+		blockTime:     now.Add(-100 * 10 * time.Minute),
+		headersHeight: 99,
+		want:          0.5,
+	}}
+
+	for _, test := range tests {
+		got := estimateVerificationProgress(best, test.blockTime,
+			test.headersHeight, test.txnsPerBlock, 10*time.Minute, now)
+		if math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("%s: unexpected progress %v, want %v", test.name,
+				got, test.want)
+		}
+	}
+}
+
+// TestSyncProgress ensures progress events are only delivered once the
+// throughput window ended and progress was made during it.
+func TestSyncProgress(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(1600000000, 0)
+	p := newSyncProgress(10 * time.Minute)
+	p.resetWindow(start)
+
+	var events []SyncProgress
+	p.subscribe(func(event *SyncProgress) {
+		events = append(events, *event)
+	})
+
+	best := &blockchain.BestState{Height: 10, TotalTxns: 20}
+	p.update(best, start, 20, 5, 10, start.Add(time.Second))
+	if len(events) != 0 {
+		t.Fatalf("event delivered before the window ended")
+	}
+	if got := p.snapshot(); got.ValidatedHeight != 10 ||
+		got.HeadersHeight != 20 {
+
+		t.Fatalf("unexpected progress %+v", got)
+	}
+
+	end := start.Add(syncProgressInterval)
+	p.update(best, start, 20, 5, 10, end)
+	if len(events) != 1 {
+		t.Fatalf("unexpected %d events", len(events))
+	}
+	event := events[0]
+	if event.WindowBlocks != 10 || event.WindowTxns != 20 ||
+		event.BlocksPerSecond != 1 || event.TxnsPerSecond != 2 {
+
+		t.Fatalf("unexpected throughput in event %+v", event)
+	}
+
+	// No event is delivered for a window without progress.
+	p.update(best, start, 20, 0, 0, end.Add(syncProgressInterval))
+	if len(events) != 1 {
+		t.Fatalf("unexpected event without progress")
+	}
+}
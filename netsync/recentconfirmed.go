@@ -0,0 +1,248 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"sync"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+)
+
+const (
+	// maxRecentlyConfirmedTxns is the number of the most recently
+	// confirmed transactions which are guaranteed to be remembered by the
+	// recently confirmed transaction filter.  It covers the transactions
+	// of the last few blocks.
+	maxRecentlyConfirmedTxns = 48000
+
+	// recentlyConfirmedFPRate is the target false positive rate of the
+	// recently confirmed transaction filter.  A false positive causes an
+	// announced transaction not to be requested, so it is kept very low.
+	recentlyConfirmedFPRate = 0.000001
+
+	// rollingBloomGenerations is the number of generations a rolling bloom
+	// filter is split into.
+	rollingBloomGenerations = 3
+)
+
+// RecentlyConfirmedStats describes the state and effectiveness of the filter of
+// recently confirmed transactions kept by the sync manager.
+type RecentlyConfirmedStats struct {
+	// Entries is the number of transactions currently in the filter.
+	Entries int
+
+	// Capacity is the number of the most recently confirmed transactions
+	// which are guaranteed to be in the filter.
+	Capacity int
+
+	// Lookups is the number of announced transactions which were checked
+	// against the filter.
+	Lookups uint64
+
+	// Hits is the number of announced transactions which were not
+	// requested because they were found in the filter.
+	Hits uint64
+
+	// Resets is the number of times the filter was cleared because a block
+	// was disconnected from the main chain.
+	Resets uint64
+}
+
+// rollingBloom is a bloom filter which remembers at least the most recently
+// added entries up to its capacity while using a bounded amount of memory.
+//
+// It is split into generations which each hold half of the capacity.  Entries
+// are added to the current generation, and once it is full, the oldest
+// generation is cleared and becomes the current one.  This means the entries
+// added to the last full generations and the current generation are always
+// remembered.
+//
+// The filter is keyed with random values, so the transactions which are false
+// positives differ between nodes.
+type rollingBloom struct {
+	generations [rollingBloomGenerations][]uint64
+	counts      [rollingBloomGenerations]int
+	current     int
+	genCapacity int
+	numBits     uint64
+	numHashes   uint32
+	key0, key1  uint64
+}
+
+// newRollingBloom returns a rolling bloom filter which remembers at least the
+// passed number of the most recently added entries with the passed false
+// positive rate.
+func newRollingBloom(capacity int, fpRate float64) *rollingBloom {
+	genCapacity := (capacity + 1) / 2
+	if genCapacity < 1 {
+		genCapacity = 1
+	}
+
+	// Size each generation such that a lookup, which consults all of
+	// them, has the requested false positive rate overall.
+	genFPRate := fpRate / rollingBloomGenerations
+	numBits := uint64(math.Ceil(-float64(genCapacity) *
+		math.Log(genFPRate) / (math.Ln2 * math.Ln2)))
+	numBits = (numBits + 63) &^ 63
+	numHashes := uint32(math.Round(float64(numBits) /
+		float64(genCapacity) * math.Ln2))
+	if numHashes < 1 {
+		numHashes = 1
+	}
+
+	rb := &rollingBloom{
+		genCapacity: genCapacity,
+		numBits:     numBits,
+		numHashes:   numHashes,
+		key0:        rand.Uint64(),
+		key1:        rand.Uint64(),
+	}
+	for i := range rb.generations {
+		rb.generations[i] = make([]uint64, numBits/64)
+	}
+	return rb
+}
+
+// bitIndex returns the index of the bit set for the passed hash by the passed
+// hash function number.  Since transaction hashes are uniformly distributed,
+// the hash functions are derived from the hash itself by double hashing.
+func (rb *rollingBloom) bitIndex(hash *chainhash.Hash, n uint32) uint64 {
+	h1 := binary.LittleEndian.Uint64(hash[0:8]) ^ rb.key0
+	h2 := binary.LittleEndian.Uint64(hash[8:16]) ^ rb.key1
+	return (h1 + uint64(n)*h2) % rb.numBits
+}
+
+// Add adds the passed hash to the filter.
+func (rb *rollingBloom) Add(hash *chainhash.Hash) {
+	if rb.counts[rb.current] == rb.genCapacity {
+		rb.current = (rb.current + 1) % rollingBloomGenerations
+		gen := rb.generations[rb.current]
+		for i := range gen {
+			gen[i] = 0
+		}
+		rb.counts[rb.current] = 0
+	}
+
+	gen := rb.generations[rb.current]
+	for n := uint32(0); n < rb.numHashes; n++ {
+		idx := rb.bitIndex(hash, n)
+		gen[idx/64] |= 1 << (idx % 64)
+	}
+	rb.counts[rb.current]++
+}
+
+// Contains returns whether or not the passed hash is in the filter.  It may
+// return false positives, but never false negatives for the entries it is
+// guaranteed to remember.
+func (rb *rollingBloom) Contains(hash *chainhash.Hash) bool {
+	for i := range rb.generations {
+		if rb.counts[i] == 0 {
+			continue
+		}
+		gen := rb.generations[i]
+		found := true
+		for n := uint32(0); n < rb.numHashes; n++ {
+			idx := rb.bitIndex(hash, n)
+			if gen[idx/64]&(1<<(idx%64)) == 0 {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// Count returns the number of entries in the filter.
+func (rb *rollingBloom) Count() int {
+	var count int
+	for _, n := range rb.counts {
+		count += n
+	}
+	return count
+}
+
+// Reset removes all entries from the filter.
+func (rb *rollingBloom) Reset() {
+	for i, gen := range rb.generations {
+		for j := range gen {
+			gen[j] = 0
+		}
+		rb.counts[i] = 0
+	}
+	rb.current = 0
+}
+
+// recentlyConfirmedTxns tracks the hashes of the transactions confirmed in the
+// most recent blocks, so announcements of transactions which were just removed
+// from the mempool because they were mined are not requested and validated
+// again.
+//
+// It is safe for concurrent access.
+type recentlyConfirmedTxns struct {
+	mtx     sync.Mutex
+	filter  *rollingBloom
+	lookups uint64
+	hits    uint64
+	resets  uint64
+}
+
+// newRecentlyConfirmedTxns returns a new empty recently confirmed transaction
+// filter.
+func newRecentlyConfirmedTxns() *recentlyConfirmedTxns {
+	return &recentlyConfirmedTxns{
+		filter: newRollingBloom(maxRecentlyConfirmedTxns,
+			recentlyConfirmedFPRate),
+	}
+}
+
+// Add records the passed transaction hash as confirmed.
+func (r *recentlyConfirmedTxns) Add(hash *chainhash.Hash) {
+	r.mtx.Lock()
+	r.filter.Add(hash)
+	r.mtx.Unlock()
+}
+
+// Contains returns whether or not the passed transaction hash was recently
+// confirmed and updates the statistics accordingly.
+func (r *recentlyConfirmedTxns) Contains(hash *chainhash.Hash) bool {
+	r.mtx.Lock()
+	found := r.filter.Contains(hash)
+	r.lookups++
+	if found {
+		r.hits++
+	}
+	r.mtx.Unlock()
+	return found
+}
+
+// Reset forgets all recently confirmed transactions.  It must be called when a
+// block is disconnected, since its transactions are no longer confirmed and
+// might need to be requested again.
+func (r *recentlyConfirmedTxns) Reset() {
+	r.mtx.Lock()
+	r.filter.Reset()
+	r.resets++
+	r.mtx.Unlock()
+}
+
+// Stats returns the current statistics of the filter.
+func (r *recentlyConfirmedTxns) Stats() RecentlyConfirmedStats {
+	r.mtx.Lock()
+	stats := RecentlyConfirmedStats{
+		Entries:  r.filter.Count(),
+		Capacity: maxRecentlyConfirmedTxns,
+		Lookups:  r.lookups,
+		Hits:     r.hits,
+		Resets:   r.resets,
+	}
+	r.mtx.Unlock()
+	return stats
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+)
+
+// testHash returns a unique hash for the passed number.
+func testHash(n uint64) chainhash.Hash {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], n)
+	return chainhash.HashH(buf[:])
+}
+
+// TestRollingBloom ensures the rolling bloom filter remembers at least the
+// most recently added entries up to its capacity and forgets older ones.
+func TestRollingBloom(t *testing.T) {
+	t.Parallel()
+
+	const capacity = 1000
+	rb := newRollingBloom(capacity, 0.000001)
+
+	// Add several times the capacity and ensure the most recent entries
+	// are all remembered throughout.
+	const total = capacity * 5
+	for i := uint64(0); i < total; i++ {
+		hash := testHash(i)
+		rb.Add(&hash)
+
+		first := uint64(0)
+		if i >= capacity {
+			first = i - capacity + 1
+		}
+		if i%capacity != 0 {
+			continue
+		}
+		for j := first; j <= i; j++ {
+			hash := testHash(j)
+			if !rb.Contains(&hash) {
+				t.Fatalf("entry %d is missing after adding %d", j,
+					i)
+			}
+		}
+	}
+
+	// The filter holds at most one and a half times its capacity.
+	if count := rb.Count(); count < capacity || count > capacity*3/2 {
+		t.Fatalf("Count: got %d, want between %d and %d", count,
+			capacity, capacity*3/2)
+	}
+
+	// Ensure the oldest entries were forgotten.  Allow for a few false
+	// positives even though they are extremely unlikely.
+	var found int
+	for i := uint64(0); i < capacity; i++ {
+		hash := testHash(i)
+		if rb.Contains(&hash) {
+			found++
+		}
+	}
+	if found > 1 {
+		t.Fatalf("%d of the oldest entries were not forgotten", found)
+	}
+
+	rb.Reset()
+	if rb.Count() != 0 {
+		t.Fatalf("Count: got %d after reset, want 0", rb.Count())
+	}
+	hash := testHash(total - 1)
+	if rb.Contains(&hash) {
+		t.Fatal("Contains: entry found after reset")
+	}
+}
+
+// TestRecentlyConfirmedStats ensures the recently confirmed transaction filter
+// keeps track of its lookups, hits, and resets.
+func TestRecentlyConfirmedStats(t *testing.T) {
+	t.Parallel()
+
+	r := newRecentlyConfirmedTxns()
+	confirmed, unconfirmed := testHash(1), testHash(2)
+	r.Add(&confirmed)
+	if !r.Contains(&confirmed) {
+		t.Fatal("Contains: confirmed transaction not found")
+	}
+	if r.Contains(&unconfirmed) {
+		t.Fatal("Contains: unconfirmed transaction found")
+	}
+	r.Reset()
+	if r.Contains(&confirmed) {
+		t.Fatal("Contains: transaction found after reset")
+	}
+
+	want := RecentlyConfirmedStats{
+		Entries:  0,
+		Capacity: maxRecentlyConfirmedTxns,
+		Lookups:  3,
+		Hits:     1,
+		Resets:   1,
+	}
+	if stats := r.Stats(); stats != want {
+		t.Fatalf("Stats: got %+v, want %+v", stats, want)
+	}
+}
@@ -0,0 +1,337 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	peerpkg "github.com/ifishnet/hdfd/peer"
+)
+
+const (
+	// maxTxInFlightPerPeer is the maximum number of transactions which may
+	// be requested from a single peer at once.  The remaining transactions
+	// the peer announced are requested once earlier requests complete,
+	// unless they are requested from other peers first.
+	maxTxInFlightPerPeer = 100
+
+	// maxTxAnnouncementsPerPeer is the maximum number of announced
+	// transactions which are tracked for a single peer.  Further
+	// announcements from the peer are ignored until some of them complete.
+	maxTxAnnouncementsPerPeer = 5000
+
+	// nonPreferredTxDelay is the time announcements from peers which are
+	// not preferred, such as inbound peers, are held back before the
+	// transaction is requested from them.  This gives preferred peers
+	// which announced the same transaction a chance to be asked first.
+	nonPreferredTxDelay = 2 * time.Second
+)
+
+// txAnnouncer describes a peer which announced a transaction that was not yet
+// requested from it.
+type txAnnouncer struct {
+	peer       *peerpkg.Peer
+	preferred  bool
+	wtxidRelay bool
+	readyAt    time.Time
+	seq        uint64
+}
+
+// better returns whether or not the announcer is preferred over the passed
+// one.  Preferred peers come first, followed by peers which relay
+// transactions by their witness hash, and finally the peers which announced
+// the transaction first.
+func (a *txAnnouncer) better(other *txAnnouncer) bool {
+	if a.preferred != other.preferred {
+		return a.preferred
+	}
+	if a.wtxidRelay != other.wtxidRelay {
+		return a.wtxidRelay
+	}
+	return a.seq < other.seq
+}
+
+// trackedTx is a transaction which was announced by at least one peer along
+// with its pending request, if any.  The sequence number orders the tracked
+// transactions by their first announcement.
+type trackedTx struct {
+	announcers []*txAnnouncer
+	peer       *peerpkg.Peer
+	expires    time.Time
+	seq        uint64
+}
+
+// txRequestTracker decides which peer each announced transaction is requested
+// from.  Announcements are shared across all peers so a transaction announced
+// by many peers is only requested from one of them at a time, and the other
+// peers are remembered so it can be requested from them instead should the
+// pending request time out or the peer report it as not found.
+//
+// Transactions are requested from the best peer which announced them, which
+// prefers outbound peers since they are harder for an attacker to control, and
+// then peers relaying transactions by their witness hash.  Announcements from
+// peers which are not preferred are only acted upon after a short delay, and
+// the number of transactions which are in flight, as well as tracked, for each
+// peer is limited so a single peer is not able to stall or exhaust the
+// requests.
+//
+// It is not safe for concurrent access.  It is only used from the blockHandler
+// goroutine of the sync manager.
+type txRequestTracker struct {
+	txns      map[chainhash.Hash]*trackedTx
+	inFlight  map[*peerpkg.Peer]int
+	announced map[*peerpkg.Peer]int
+	maxTxns   int
+	timeout   time.Duration
+	seq       uint64
+}
+
+// newTxRequestTracker returns a tracker which tracks up to the passed number
+// of transactions and considers requests failed after the passed timeout.
+func newTxRequestTracker(maxTxns int, timeout time.Duration) *txRequestTracker {
+	return &txRequestTracker{
+		txns:      make(map[chainhash.Hash]*trackedTx),
+		inFlight:  make(map[*peerpkg.Peer]int),
+		announced: make(map[*peerpkg.Peer]int),
+		maxTxns:   maxTxns,
+		timeout:   timeout,
+	}
+}
+
+// pendingFrom returns the peer the transaction with the passed hash is
+// currently requested from or nil when there is no pending request.
+func (t *txRequestTracker) pendingFrom(hash *chainhash.Hash) *peerpkg.Peer {
+	if tx, ok := t.txns[*hash]; ok {
+		return tx.peer
+	}
+	return nil
+}
+
+// decrement decrements the count of the passed peer in the passed per-peer
+// counters.  Peers which are no longer tracked, because they disconnected, are
+// left alone so their counts do not become negative.
+func decrement(counts map[*peerpkg.Peer]int, peer *peerpkg.Peer) {
+	if _, ok := counts[peer]; ok {
+		counts[peer]--
+	}
+}
+
+// remove stops tracking the passed transaction.
+func (t *txRequestTracker) remove(hash chainhash.Hash, tx *trackedTx) {
+	for _, a := range tx.announcers {
+		decrement(t.announced, a.peer)
+	}
+	if tx.peer != nil {
+		decrement(t.inFlight, tx.peer)
+		decrement(t.announced, tx.peer)
+	}
+	delete(t.txns, hash)
+}
+
+// announce records that the passed peer announced the transaction with the
+// passed hash.  Preferred peers, typically outbound peers, and peers which
+// relay transactions by their witness hash are favored when deciding which
+// peer to request the transaction from.
+//
+// A random transaction which is not currently requested is evicted when
+// tracking the transaction would exceed the maximum number of them.
+func (t *txRequestTracker) announce(hash chainhash.Hash, peer *peerpkg.Peer,
+	preferred, wtxidRelay bool, now time.Time) {
+
+	if t.announced[peer] >= maxTxAnnouncementsPerPeer {
+		return
+	}
+
+	tx, ok := t.txns[hash]
+	if !ok {
+		if len(t.txns) >= t.maxTxns {
+			// Evict a random transaction.  See limitAdd for
+			// details on the iteration order.
+			for evictHash, evictTx := range t.txns {
+				if evictTx.peer == nil {
+					t.remove(evictHash, evictTx)
+					break
+				}
+			}
+			if len(t.txns) >= t.maxTxns {
+				return
+			}
+		}
+		tx = &trackedTx{seq: t.seq + 1}
+		t.txns[hash] = tx
+	}
+
+	// Ignore peers which already announced the transaction.
+	if tx.peer == peer {
+		return
+	}
+	for _, a := range tx.announcers {
+		if a.peer == peer {
+			return
+		}
+	}
+
+	readyAt := now
+	if !preferred {
+		readyAt = now.Add(nonPreferredTxDelay)
+	}
+	t.seq++
+	tx.announcers = append(tx.announcers, &txAnnouncer{
+		peer:       peer,
+		preferred:  preferred,
+		wtxidRelay: wtxidRelay,
+		readyAt:    readyAt,
+		seq:        t.seq,
+	})
+	t.announced[peer]++
+}
+
+// requestable selects the peer to request each announced transaction which is
+// not currently requested from, as of the passed time, and marks the requests
+// as pending.  It returns the hashes of the transactions to request grouped by
+// peer, in the order they were announced.
+//
+// The transactions are considered in the order they were first announced so
+// the earliest announced ones are requested first when the number of
+// transactions in flight for a peer is limited.
+func (t *txRequestTracker) requestable(now time.Time) map[*peerpkg.Peer][]chainhash.Hash {
+	type candidate struct {
+		hash chainhash.Hash
+		tx   *trackedTx
+	}
+	var candidates []candidate
+	for hash, tx := range t.txns {
+		if tx.peer == nil {
+			candidates = append(candidates, candidate{hash, tx})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].tx.seq < candidates[j].tx.seq
+	})
+
+	type selection struct {
+		hash chainhash.Hash
+		seq  uint64
+	}
+	selected := make(map[*peerpkg.Peer][]selection)
+	for _, c := range candidates {
+		hash, tx := c.hash, c.tx
+
+		// Give up on the transaction once no peer which announced it
+		// is left.
+		if len(tx.announcers) == 0 {
+			delete(t.txns, hash)
+			continue
+		}
+
+		best := -1
+		for i, a := range tx.announcers {
+			if now.Before(a.readyAt) ||
+				t.inFlight[a.peer] >= maxTxInFlightPerPeer {
+				continue
+			}
+			if best == -1 || a.better(tx.announcers[best]) {
+				best = i
+			}
+		}
+		if best == -1 {
+			continue
+		}
+
+		a := tx.announcers[best]
+		tx.announcers = append(tx.announcers[:best],
+			tx.announcers[best+1:]...)
+		tx.peer = a.peer
+		tx.expires = now.Add(t.timeout)
+		t.inFlight[a.peer]++
+		selected[a.peer] = append(selected[a.peer], selection{hash, a.seq})
+	}
+
+	requests := make(map[*peerpkg.Peer][]chainhash.Hash, len(selected))
+	for peer, selections := range selected {
+		sort.Slice(selections, func(i, j int) bool {
+			return selections[i].seq < selections[j].seq
+		})
+		hashes := make([]chainhash.Hash, 0, len(selections))
+		for _, s := range selections {
+			hashes = append(hashes, s.hash)
+		}
+		requests[peer] = hashes
+	}
+	return requests
+}
+
+// failRequest marks the pending request of the passed transaction as failed so
+// the transaction is requested from the next best peer which announced it.
+func (t *txRequestTracker) failRequest(tx *trackedTx) {
+	decrement(t.inFlight, tx.peer)
+	decrement(t.announced, tx.peer)
+	tx.peer = nil
+}
+
+// expire marks the pending requests which were not answered by the passed
+// time as failed.  The transactions are still accepted should the peers
+// provide them late.  It returns the number of expired requests.
+func (t *txRequestTracker) expire(now time.Time) int {
+	var numExpired int
+	for hash, tx := range t.txns {
+		if tx.peer == nil || now.Before(tx.expires) {
+			continue
+		}
+
+		log.Debugf("Request for transaction %v from %s timed out",
+			hash, tx.peer)
+		t.failRequest(tx)
+		numExpired++
+	}
+	return numExpired
+}
+
+// notFound marks the pending request of the transaction with the passed hash
+// as failed when it is pending from the passed peer, which reported it does
+// not have the transaction.
+func (t *txRequestTracker) notFound(hash chainhash.Hash, peer *peerpkg.Peer) {
+	tx, ok := t.txns[hash]
+	if !ok || tx.peer != peer {
+		return
+	}
+	t.failRequest(tx)
+}
+
+// received stops tracking the transaction with the passed hash since it was
+// received or is otherwise no longer needed.
+func (t *txRequestTracker) received(hash chainhash.Hash) {
+	if tx, ok := t.txns[hash]; ok {
+		t.remove(hash, tx)
+	}
+}
+
+// removePeer forgets all announcements of the passed peer, which
+// disconnected, and marks the pending requests to it as failed.
+func (t *txRequestTracker) removePeer(peer *peerpkg.Peer) {
+	for _, tx := range t.txns {
+		if tx.peer == peer {
+			tx.peer = nil
+			continue
+		}
+		for i, a := range tx.announcers {
+			if a.peer == peer {
+				tx.announcers = append(tx.announcers[:i],
+					tx.announcers[i+1:]...)
+				break
+			}
+		}
+	}
+	delete(t.inFlight, peer)
+	delete(t.announced, peer)
+}
+
+// numInFlight returns the number of transactions currently requested from the
+// passed peer.
+func (t *txRequestTracker) numInFlight(peer *peerpkg.Peer) int {
+	return t.inFlight[peer]
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	peerpkg "github.com/ifishnet/hdfd/peer"
+)
+
+// TestTxRequestTracker ensures transactions announced by several peers are
+// requested from the best of them one at a time and from the next best peer
+// once a request fails.
+func TestTxRequestTracker(t *testing.T) {
+	t.Parallel()
+
+	// Whether or not peers are preferred is passed along with their
+	// announcements, so the peers only serve as distinct identities.
+	inbound := peerpkg.NewInboundPeer(&peerpkg.Config{})
+	outbound := peerpkg.NewInboundPeer(&peerpkg.Config{})
+	wtxidOutbound := peerpkg.NewInboundPeer(&peerpkg.Config{})
+
+	now := time.Unix(1600000000, 0)
+	tracker := newTxRequestTracker(10, time.Minute)
+	hash := testHash(1)
+	tracker.announce(hash, inbound, false, true, now)
+	tracker.announce(hash, outbound, true, false, now)
+	tracker.announce(hash, wtxidOutbound, true, true, now)
+	tracker.announce(hash, outbound, true, false, now)
+
+	// The outbound peer relaying by witness hash must be preferred.
+	want := map[*peerpkg.Peer][]chainhash.Hash{wtxidOutbound: {hash}}
+	if got := tracker.requestable(now); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected requests %v, want %v", got, want)
+	}
+	if got := tracker.requestable(now); len(got) != 0 {
+		t.Fatalf("transaction requested again while pending: %v", got)
+	}
+
+	// A not found response from another peer must be ignored.
+	tracker.notFound(hash, outbound)
+	if peer := tracker.pendingFrom(&hash); peer != wtxidOutbound {
+		t.Fatalf("unexpected pending peer %v", peer)
+	}
+	tracker.notFound(hash, wtxidOutbound)
+	want = map[*peerpkg.Peer][]chainhash.Hash{outbound: {hash}}
+	if got := tracker.requestable(now); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected requests after not found %v, want %v",
+			got, want)
+	}
+
+	// The inbound peer is only asked once the request timed out.
+	if n := tracker.expire(now.Add(time.Second)); n != 0 {
+		t.Fatalf("unexpected %d expired requests", n)
+	}
+	later := now.Add(time.Minute)
+	if n := tracker.expire(later); n != 1 {
+		t.Fatalf("unexpected %d expired requests", n)
+	}
+	want = map[*peerpkg.Peer][]chainhash.Hash{inbound: {hash}}
+	if got := tracker.requestable(later); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected requests after timeout %v, want %v",
+			got, want)
+	}
+
+	// The transaction must be forgotten once it was received.
+	tracker.received(hash)
+	if n := tracker.numInFlight(inbound); n != 0 {
+		t.Fatalf("unexpected %d requests in flight", n)
+	}
+	if got := tracker.requestable(later); len(got) != 0 {
+		t.Fatalf("unexpected requests after receiving: %v", got)
+	}
+	if len(tracker.txns) != 0 {
+		t.Fatalf("unexpected %d tracked transactions", len(tracker.txns))
+	}
+}
+
+// TestTxRequestTrackerLimits ensures announcements from peers which are not
+// preferred are delayed, the transactions in flight for each peer are limited,
+// and disconnected peers are forgotten.
+func TestTxRequestTrackerLimits(t *testing.T) {
+	t.Parallel()
+
+	inbound := peerpkg.NewInboundPeer(&peerpkg.Config{})
+	outbound := peerpkg.NewInboundPeer(&peerpkg.Config{})
+
+	now := time.Unix(1600000000, 0)
+	tracker := newTxRequestTracker(maxTxInFlightPerPeer*2, time.Minute)
+	var hashes []chainhash.Hash
+	for i := 0; i < maxTxInFlightPerPeer+1; i++ {
+		hash := testHash(uint64(i))
+		hashes = append(hashes, hash)
+		tracker.announce(hash, inbound, false, false, now)
+	}
+	if got := tracker.requestable(now); len(got) != 0 {
+		t.Fatalf("inbound announcements were not delayed: %v", got)
+	}
+
+	// Only up to the in flight limit may be requested, in the order the
+	// transactions were announced.
+	ready := now.Add(nonPreferredTxDelay)
+	got := tracker.requestable(ready)
+	want := map[*peerpkg.Peer][]chainhash.Hash{
+		inbound: hashes[:maxTxInFlightPerPeer],
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected requests for %d transactions",
+			len(got[inbound]))
+	}
+
+	// The remaining transaction must be requested from another peer which
+	// announced it, and so must the transactions pending from a peer which
+	// disconnected.
+	last := hashes[maxTxInFlightPerPeer]
+	tracker.announce(last, outbound, true, false, ready)
+	tracker.announce(hashes[0], outbound, true, false, ready)
+	want = map[*peerpkg.Peer][]chainhash.Hash{outbound: {last}}
+	if got := tracker.requestable(ready); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected requests %v, want %v", got, want)
+	}
+	tracker.removePeer(inbound)
+	want = map[*peerpkg.Peer][]chainhash.Hash{outbound: {hashes[0]}}
+	if got := tracker.requestable(ready); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected requests after disconnect %v, want %v",
+			got, want)
+	}
+	if len(tracker.txns) != 2 {
+		t.Fatalf("unexpected %d tracked transactions after disconnect",
+			len(tracker.txns))
+	}
+
+	// Removing the transactions after the peer disconnected must not
+	// track the peer again.
+	for _, hash := range hashes {
+		tracker.received(hash)
+	}
+	if len(tracker.inFlight) != 1 || len(tracker.announced) != 1 ||
+		tracker.inFlight[outbound] != 0 || tracker.announced[outbound] != 0 {
+
+		t.Fatalf("unexpected counts after removal %v, %v",
+			tracker.inFlight, tracker.announced)
+	}
+}
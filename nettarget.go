@@ -0,0 +1,160 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ifishnet/hdfd/wire"
+)
+
+const (
+	// netTargetTimeFrame is the length of the cycles over which the bytes
+	// transferred are measured against the upload and download targets.
+	netTargetTimeFrame = 24 * time.Hour
+
+	// historicalBlockAge is the age after which blocks are considered
+	// historical.  Historical blocks are no longer served to
+	// non-whitelisted peers once the upload target is almost reached.
+	historicalBlockAge = 7 * 24 * time.Hour
+)
+
+// netTargetState describes the bytes transferred in one direction during the
+// current cycle relative to a target.
+type netTargetState struct {
+	// TimeFrame is the length of a cycle.
+	TimeFrame time.Duration
+
+	// Target is the number of bytes which may be transferred per cycle.  It
+	// is zero when there is no target.
+	Target uint64
+
+	// TargetReached is whether or not the bytes transferred during the
+	// current cycle reached the target.
+	TargetReached bool
+
+	// BytesLeftInCycle is the number of bytes which may still be
+	// transferred during the current cycle.  It is zero when there is no
+	// target.
+	BytesLeftInCycle uint64
+
+	// TimeLeftInCycle is the time until the current cycle ends.
+	TimeLeftInCycle time.Duration
+
+	// ServeHistoricalBlocks is whether or not historical blocks are still
+	// served to non-whitelisted peers during the current cycle.  It is only
+	// meaningful for the upload target.
+	ServeHistoricalBlocks bool
+}
+
+// netTarget tracks the bytes transferred in one direction during consecutive
+// cycles of a fixed length and compares them against a target.
+//
+// It is safe for concurrent access.
+type netTarget struct {
+	mtx        sync.Mutex
+	target     uint64
+	timeFrame  time.Duration
+	cycleStart time.Time
+	cycleBytes uint64
+	timeSource func() time.Time
+
+	// historicalBuffer is the number of bytes which must be left in the
+	// cycle for historical blocks to be served.  It is the maximum size of
+	// a block so serving one can't overshoot the target by much.
+	historicalBuffer uint64
+}
+
+// newNetTarget returns a new net target which allows the passed number of bytes
+// per cycle of the passed length.  A target of zero means there is no target
+// and only tracks the bytes transferred.
+func newNetTarget(target uint64, timeFrame time.Duration) *netTarget {
+	return &netTarget{
+		target:           target,
+		timeFrame:        timeFrame,
+		cycleStart:       time.Now(),
+		timeSource:       time.Now,
+		historicalBuffer: wire.MaxBlockPayload,
+	}
+}
+
+// advanceCycle starts a new cycle when the current one ended before the passed
+// time.
+//
+// This function MUST be called with the mutex held (for writes).
+func (t *netTarget) advanceCycle(now time.Time) {
+	elapsed := now.Sub(t.cycleStart)
+	if elapsed < t.timeFrame {
+		return
+	}
+	cycles := elapsed / t.timeFrame
+	t.cycleStart = t.cycleStart.Add(cycles * t.timeFrame)
+	t.cycleBytes = 0
+}
+
+// servesHistoricalBlocks returns whether or not enough bytes are left in the
+// current cycle to serve historical blocks.
+//
+// This function MUST be called with the mutex held (for reads).
+func (t *netTarget) servesHistoricalBlocks() bool {
+	if t.target == 0 {
+		return true
+	}
+	return t.target >= t.historicalBuffer &&
+		t.cycleBytes <= t.target-t.historicalBuffer
+}
+
+// Add accounts for the passed number of bytes transferred.  It returns true
+// when the bytes transferred cause historical blocks to no longer be served
+// during the current cycle.
+//
+// This function is safe for concurrent access.
+func (t *netTarget) Add(n uint64) bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.advanceCycle(t.timeSource())
+	served := t.servesHistoricalBlocks()
+	t.cycleBytes += n
+	return served && !t.servesHistoricalBlocks()
+}
+
+// ServesHistoricalBlocks returns whether or not historical blocks are still
+// served to non-whitelisted peers during the current cycle.
+//
+// This function is safe for concurrent access.
+func (t *netTarget) ServesHistoricalBlocks() bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.advanceCycle(t.timeSource())
+	return t.servesHistoricalBlocks()
+}
+
+// State returns the bytes transferred during the current cycle relative to the
+// target.
+//
+// This function is safe for concurrent access.
+func (t *netTarget) State() netTargetState {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	now := t.timeSource()
+	t.advanceCycle(now)
+	state := netTargetState{
+		TimeFrame:             t.timeFrame,
+		Target:                t.target,
+		TimeLeftInCycle:       t.cycleStart.Add(t.timeFrame).Sub(now),
+		ServeHistoricalBlocks: t.servesHistoricalBlocks(),
+	}
+	if t.target != 0 {
+		state.TargetReached = t.cycleBytes >= t.target
+		if !state.TargetReached {
+			state.BytesLeftInCycle = t.target - t.cycleBytes
+		}
+	}
+	return state
+}
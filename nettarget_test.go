@@ -0,0 +1,99 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestNetTarget ensures the bytes transferred are tracked per cycle and
+// compared against the target and the limit for serving historical blocks.
+func TestNetTarget(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(1600000000, 0)
+	now := start
+	target := newNetTarget(1000, time.Hour)
+	target.cycleStart = start
+	target.timeSource = func() time.Time { return now }
+	target.historicalBuffer = 200
+
+	tests := []struct {
+		name     string
+		advance  time.Duration
+		add      uint64
+		stops    bool
+		expected netTargetState
+	}{{
+		name: "nothing transferred",
+		expected: netTargetState{TimeFrame: time.Hour, Target: 1000,
+			BytesLeftInCycle: 1000, TimeLeftInCycle: time.Hour,
+			ServeHistoricalBlocks: true},
+	}, {
+		name:    "below target",
+		advance: 10 * time.Minute,
+		add:     600,
+		expected: netTargetState{TimeFrame: time.Hour, Target: 1000,
+			BytesLeftInCycle: 400, TimeLeftInCycle: 50 * time.Minute,
+			ServeHistoricalBlocks: true},
+	}, {
+		name:    "historical block limit reached",
+		advance: 5 * time.Minute,
+		add:     300,
+		stops:   true,
+		expected: netTargetState{TimeFrame: time.Hour, Target: 1000,
+			BytesLeftInCycle: 100, TimeLeftInCycle: 45 * time.Minute},
+	}, {
+		name:    "target reached",
+		advance: 5 * time.Minute,
+		add:     200,
+		expected: netTargetState{TimeFrame: time.Hour, Target: 1000,
+			TargetReached: true, TimeLeftInCycle: 40 * time.Minute},
+	}, {
+		name:    "next cycle",
+		advance: 45 * time.Minute,
+		add:     100,
+		expected: netTargetState{TimeFrame: time.Hour, Target: 1000,
+			BytesLeftInCycle: 900, TimeLeftInCycle: 55 * time.Minute,
+			ServeHistoricalBlocks: true},
+	}, {
+		name:    "skipped cycles",
+		advance: 3 * time.Hour,
+		expected: netTargetState{TimeFrame: time.Hour, Target: 1000,
+			BytesLeftInCycle: 1000, TimeLeftInCycle: 55 * time.Minute,
+			ServeHistoricalBlocks: true},
+	}}
+	for _, test := range tests {
+		now = now.Add(test.advance)
+		if test.add != 0 {
+			if stops := target.Add(test.add); stops != test.stops {
+				t.Errorf("%s: mismatched add result -- got %v, "+
+					"want %v", test.name, stops, test.stops)
+			}
+		}
+		if serves := target.ServesHistoricalBlocks(); serves !=
+			test.expected.ServeHistoricalBlocks {
+
+			t.Errorf("%s: mismatched historical block serving -- "+
+				"got %v, want %v", test.name, serves,
+				test.expected.ServeHistoricalBlocks)
+		}
+		if state := target.State(); state != test.expected {
+			t.Errorf("%s: got %+v, want %+v", test.name, state,
+				test.expected)
+		}
+	}
+
+	// A target of zero only tracks the cycles.
+	target = newNetTarget(0, time.Hour)
+	target.Add(5000)
+	if state := target.State(); state.TargetReached ||
+		state.BytesLeftInCycle != 0 || state.Target != 0 ||
+		!state.ServeHistoricalBlocks {
+
+		t.Errorf("no target: unexpected state %+v", state)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ifishnet/hdfd/wire"
+)
+
+const (
+	// BandwidthRateWindow is the duration over which the rolling send and
+	// receive rates of a BandwidthCounter are averaged.
+	BandwidthRateWindow = time.Minute
+
+	// OtherMessagesCommand is the command under which bytes are accounted
+	// when the message they belong to is not known, such as when reading
+	// a message fails.
+	OtherMessagesCommand = "*other*"
+
+	// rateBuckets is the number of one second buckets the rate window is
+	// split into.
+	rateBuckets = int(BandwidthRateWindow / time.Second)
+)
+
+// BandwidthStats is a snapshot of the bandwidth accounted for by a
+// BandwidthCounter.
+type BandwidthStats struct {
+	// BytesSentPerMsg and BytesRecvPerMsg are the total number of bytes
+	// sent and received keyed by message command.
+	BytesSentPerMsg map[string]uint64
+	BytesRecvPerMsg map[string]uint64
+
+	// SendRate and RecvRate are the number of bytes per second sent and
+	// received averaged over the last BandwidthRateWindow.
+	SendRate float64
+	RecvRate float64
+}
+
+// rollingRate tracks the number of bytes transferred during each second of the
+// rate window.
+type rollingRate struct {
+	bytes   [rateBuckets]uint64
+	seconds [rateBuckets]int64
+}
+
+// add accounts for the passed number of bytes transferred at the passed time.
+func (r *rollingRate) add(n uint64, now time.Time) {
+	sec := now.Unix()
+	idx := int(sec % int64(rateBuckets))
+	if r.seconds[idx] != sec {
+		r.seconds[idx] = sec
+		r.bytes[idx] = 0
+	}
+	r.bytes[idx] += n
+}
+
+// rate returns the number of bytes per second transferred during the rate
+// window ending at the passed time.
+func (r *rollingRate) rate(now time.Time) float64 {
+	sec := now.Unix()
+	var total uint64
+	for i := range r.bytes {
+		if age := sec - r.seconds[i]; age >= 0 && age < int64(rateBuckets) {
+			total += r.bytes[i]
+		}
+	}
+	return float64(total) / BandwidthRateWindow.Seconds()
+}
+
+// BandwidthCounter accounts for the bytes sent and received per message
+// command and tracks the rolling send and receive rates.  Each peer has one
+// for its own traffic, and callers may use others to aggregate the traffic of
+// several peers.
+//
+// It is safe for concurrent access.
+type BandwidthCounter struct {
+	mtx        sync.Mutex
+	sentPerMsg map[string]uint64
+	recvPerMsg map[string]uint64
+	sent       rollingRate
+	recv       rollingRate
+	timeSource func() time.Time
+}
+
+// NewBandwidthCounter returns a new bandwidth counter with no bytes accounted
+// for.
+func NewBandwidthCounter() *BandwidthCounter {
+	return &BandwidthCounter{
+		sentPerMsg: make(map[string]uint64),
+		recvPerMsg: make(map[string]uint64),
+		timeSource: time.Now,
+	}
+}
+
+// msgCommand returns the command the bytes of the passed message are accounted
+// under.
+func msgCommand(msg wire.Message) string {
+	if msg == nil {
+		return OtherMessagesCommand
+	}
+	return msg.Command()
+}
+
+// AddSent accounts for the passed number of bytes sent for the passed message.
+// A nil message accounts for the bytes under OtherMessagesCommand.
+//
+// This function is safe for concurrent access.
+func (c *BandwidthCounter) AddSent(msg wire.Message, n int) {
+	if n <= 0 {
+		return
+	}
+	c.mtx.Lock()
+	c.sentPerMsg[msgCommand(msg)] += uint64(n)
+	c.sent.add(uint64(n), c.timeSource())
+	c.mtx.Unlock()
+}
+
+// AddReceived accounts for the passed number of bytes received for the passed
+// message.  A nil message accounts for the bytes under OtherMessagesCommand.
+//
+// This function is safe for concurrent access.
+func (c *BandwidthCounter) AddReceived(msg wire.Message, n int) {
+	if n <= 0 {
+		return
+	}
+	c.mtx.Lock()
+	c.recvPerMsg[msgCommand(msg)] += uint64(n)
+	c.recv.add(uint64(n), c.timeSource())
+	c.mtx.Unlock()
+}
+
+// Stats returns a snapshot of the bandwidth accounted for so far.
+//
+// This function is safe for concurrent access.
+func (c *BandwidthCounter) Stats() BandwidthStats {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	now := c.timeSource()
+	stats := BandwidthStats{
+		BytesSentPerMsg: make(map[string]uint64, len(c.sentPerMsg)),
+		BytesRecvPerMsg: make(map[string]uint64, len(c.recvPerMsg)),
+		SendRate:        c.sent.rate(now),
+		RecvRate:        c.recv.rate(now),
+	}
+	for cmd, n := range c.sentPerMsg {
+		stats.BytesSentPerMsg[cmd] = n
+	}
+	for cmd, n := range c.recvPerMsg {
+		stats.BytesRecvPerMsg[cmd] = n
+	}
+	return stats
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ifishnet/hdfd/peer"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// TestBandwidthCounter ensures the bandwidth counter accounts for bytes per
+// message command and direction and averages its rates over the rate window.
+func TestBandwidthCounter(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1600000000, 0)
+	c := peer.NewBandwidthCounter()
+	peer.TstSetBandwidthTimeSource(c, func() time.Time { return now })
+
+	c.AddSent(wire.NewMsgPing(1), 32)
+	c.AddSent(wire.NewMsgPing(2), 32)
+	c.AddReceived(wire.NewMsgPong(1), 32)
+	c.AddReceived(nil, 24)
+	c.AddReceived(&wire.MsgVerAck{}, 0)
+	now = now.Add(10 * time.Second)
+	c.AddSent(&wire.MsgVerAck{}, 56)
+
+	stats := c.Stats()
+	wantSent := map[string]uint64{wire.CmdPing: 64, wire.CmdVerAck: 56}
+	wantRecv := map[string]uint64{wire.CmdPong: 32,
+		peer.OtherMessagesCommand: 24}
+	if !reflect.DeepEqual(stats.BytesSentPerMsg, wantSent) {
+		t.Errorf("BytesSentPerMsg: got %v, want %v",
+			stats.BytesSentPerMsg, wantSent)
+	}
+	if !reflect.DeepEqual(stats.BytesRecvPerMsg, wantRecv) {
+		t.Errorf("BytesRecvPerMsg: got %v, want %v",
+			stats.BytesRecvPerMsg, wantRecv)
+	}
+	window := peer.BandwidthRateWindow.Seconds()
+	if want := 120 / window; stats.SendRate != want {
+		t.Errorf("SendRate: got %v, want %v", stats.SendRate, want)
+	}
+	if want := 56 / window; stats.RecvRate != want {
+		t.Errorf("RecvRate: got %v, want %v", stats.RecvRate, want)
+	}
+
+	// Bytes transferred before the rate window no longer count towards
+	// the rates, but are still accounted for per command.
+	now = now.Add(peer.BandwidthRateWindow - 5*time.Second)
+	stats = c.Stats()
+	if want := 56 / window; stats.SendRate != want {
+		t.Errorf("SendRate: got %v, want %v", stats.SendRate, want)
+	}
+	if stats.RecvRate != 0 {
+		t.Errorf("RecvRate: got %v, want 0", stats.RecvRate)
+	}
+	if stats.BytesSentPerMsg[wire.CmdPing] != 64 {
+		t.Errorf("BytesSentPerMsg: got %v", stats.BytesSentPerMsg)
+	}
+
+	// Modifying a snapshot must not affect the counter.
+	stats.BytesSentPerMsg[wire.CmdPing] = 0
+	if c.Stats().BytesSentPerMsg[wire.CmdPing] != 64 {
+		t.Error("Stats: snapshot shares state with the counter")
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import "sync"
+
+// MaxHighBandwidthPeers is the maximum number of peers which are asked to
+// announce new blocks in high-bandwidth compact block mode as recommended by
+// BIP0152.
+const MaxHighBandwidthPeers = 3
+
+// HighBandwidthPeers maintains the set of peers which are asked to announce new
+// blocks by sending cmpctblock messages directly as defined by BIP0152.
+//
+// Peers are promoted to the set when they are the first to deliver a new block,
+// which replaces the peer that was promoted least recently once the set is
+// full.  At least one outbound peer is kept in the set when possible so inbound
+// peers, which are cheap for an attacker to create, are not able to take it
+// over entirely.
+//
+// It is safe for concurrent access.
+type HighBandwidthPeers struct {
+	mtx   sync.Mutex
+	max   int
+	peers []*Peer // ordered from least to most recently promoted
+}
+
+// NewHighBandwidthPeers returns a new empty set which contains at most the
+// passed number of peers.  A value of 0 or less uses MaxHighBandwidthPeers.
+func NewHighBandwidthPeers(max int) *HighBandwidthPeers {
+	if max <= 0 {
+		max = MaxHighBandwidthPeers
+	}
+	return &HighBandwidthPeers{max: max}
+}
+
+// index returns the position of the passed peer in the set or -1 when it is not
+// a member.
+//
+// This function MUST be called with the set lock held.
+func (h *HighBandwidthPeers) index(p *Peer) int {
+	for i, member := range h.peers {
+		if member == p {
+			return i
+		}
+	}
+	return -1
+}
+
+// Promote adds the passed peer to the set as its most recently promoted member
+// and asks it to announce new blocks in high-bandwidth mode.  When the set is
+// full, the least recently promoted peer is removed from it and asked to switch
+// back to low-bandwidth mode, unless it is the only outbound member and the
+// promoted peer is inbound, in which case the next least recently promoted peer
+// is removed instead.
+//
+// Peers which do not use compact blocks are ignored.  It returns whether or not
+// the peer is a member of the set afterwards.
+//
+// This function is safe for concurrent access.
+func (h *HighBandwidthPeers) Promote(p *Peer) bool {
+	if p.CmpctBlockVersion() == 0 {
+		return false
+	}
+
+	h.mtx.Lock()
+	if i := h.index(p); i != -1 {
+		// Move the peer to the end as the most recently promoted one.
+		h.peers = append(h.peers[:i], h.peers[i+1:]...)
+		h.peers = append(h.peers, p)
+		h.mtx.Unlock()
+		return true
+	}
+
+	var demoted *Peer
+	if len(h.peers) >= h.max {
+		evict := 0
+		if p.Inbound() {
+			var numOutbound int
+			for _, member := range h.peers {
+				if !member.Inbound() {
+					numOutbound++
+				}
+			}
+			if numOutbound == 1 && !h.peers[0].Inbound() {
+				evict = 1
+			}
+		}
+		demoted = h.peers[evict]
+		h.peers = append(h.peers[:evict], h.peers[evict+1:]...)
+	}
+	h.peers = append(h.peers, p)
+	h.mtx.Unlock()
+
+	if demoted != nil {
+		demoted.SetCmpctHighBandwidth(false)
+		log.Debugf("Demoted %v from high-bandwidth compact block peer",
+			demoted)
+	}
+	p.SetCmpctHighBandwidth(true)
+	log.Debugf("Promoted %v to high-bandwidth compact block peer", p)
+	return true
+}
+
+// Remove removes the passed peer from the set.  It is typically called once the
+// peer disconnects, so the peer is not asked to switch modes.
+//
+// This function is safe for concurrent access.
+func (h *HighBandwidthPeers) Remove(p *Peer) {
+	h.mtx.Lock()
+	if i := h.index(p); i != -1 {
+		h.peers = append(h.peers[:i], h.peers[i+1:]...)
+	}
+	h.mtx.Unlock()
+}
+
+// Peers returns the members of the set ordered from least to most recently
+// promoted.
+//
+// This function is safe for concurrent access.
+func (h *HighBandwidthPeers) Peers() []*Peer {
+	h.mtx.Lock()
+	peers := make([]*Peer, len(h.peers))
+	copy(peers, h.peers)
+	h.mtx.Unlock()
+
+	return peers
+}
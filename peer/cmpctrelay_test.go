@@ -0,0 +1,78 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfd/peer"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// TestHighBandwidthPeers ensures the set of high-bandwidth compact block peers
+// replaces its least recently promoted member once it is full while keeping an
+// outbound peer when possible.
+func TestHighBandwidthPeers(t *testing.T) {
+	t.Parallel()
+
+	peerCfg := &peer.Config{ChainParams: &chaincfg.MainNetParams}
+	newPeer := func(inbound bool) *peer.Peer {
+		var p *peer.Peer
+		if inbound {
+			p = peer.NewInboundPeer(peerCfg)
+		} else {
+			var err error
+			p, err = peer.NewOutboundPeer(peerCfg, "10.0.0.1:8333")
+			if err != nil {
+				t.Fatalf("NewOutboundPeer: unexpected err: %v", err)
+			}
+		}
+		peer.TstSetCmpctBlockVersion(p, wire.CmpctBlockVersionWTxID)
+		return p
+	}
+	out1, in1, in2, in3 := newPeer(false), newPeer(true), newPeer(true),
+		newPeer(true)
+
+	hb := peer.NewHighBandwidthPeers(0)
+	check := func(desc string, want ...*peer.Peer) {
+		t.Helper()
+		if got := hb.Peers(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: unexpected peers: got %v, want %v", desc,
+				got, want)
+		}
+		for _, p := range want {
+			if !p.IsCmpctHighBandwidth() {
+				t.Fatalf("%s: %v is not in high-bandwidth mode",
+					desc, p)
+			}
+		}
+	}
+
+	// Peers which do not use compact blocks are never promoted.
+	if hb.Promote(peer.NewInboundPeer(peerCfg)) {
+		t.Fatal("promoted peer which does not use compact blocks")
+	}
+
+	hb.Promote(out1)
+	hb.Promote(in1)
+	hb.Promote(in2)
+	check("full set", out1, in1, in2)
+
+	// The only outbound peer is kept when an inbound peer is promoted.
+	hb.Promote(in3)
+	check("inbound promoted", out1, in2, in3)
+	if in1.IsCmpctHighBandwidth() {
+		t.Fatal("demoted peer is still in high-bandwidth mode")
+	}
+
+	// Promoting a member makes it the most recently promoted one.
+	hb.Promote(out1)
+	check("member promoted", in2, in3, out1)
+
+	hb.Remove(in3)
+	check("member removed", in2, out1)
+}
@@ -11,8 +11,94 @@ The functions are only exported while the tests are being run.
 
 package peer
 
+import (
+	"time"
+
+	"github.com/ifishnet/hdfd/wire"
+)
+
 // TstAllowSelfConns allows the test package to allow self connections by
 // disabling the detection logic.
 func TstAllowSelfConns() {
 	allowSelfConns = true
 }
+
+// TstSetBandwidthTimeSource replaces the function used by the passed bandwidth
+// counter to obtain the current time.
+func TstSetBandwidthTimeSource(c *BandwidthCounter, timeSource func() time.Time) {
+	c.timeSource = timeSource
+}
+
+// TstSetRateLimiterTimeSource replaces the function used by the passed rate
+// limiter to obtain the current time.
+func TstSetRateLimiterTimeSource(r *RateLimiter, timeSource func() time.Time) {
+	r.mtx.Lock()
+	r.timeSource = timeSource
+	r.last = timeSource()
+	r.mtx.Unlock()
+}
+
+// TstReserve exposes the reserve method of the passed rate limiter to the test
+// package.
+func TstReserve(r *RateLimiter, n int) time.Duration {
+	return r.reserve(n)
+}
+
+// TstSetCmpctBlockVersion sets the compact block version used with the passed
+// peer as if it was signalled by the remote peer.
+func TstSetCmpctBlockVersion(p *Peer, version uint64) {
+	p.flagsMtx.Lock()
+	p.cmpctBlockVersion = version
+	p.flagsMtx.Unlock()
+}
+
+// TstAddPing records the passed ping round trip time with the passed peer.
+func TstAddPing(p *Peer, d time.Duration) {
+	p.metrics.addPing(d)
+}
+
+// TstAddSendLatency records the passed send latency with the passed peer.
+func TstAddSendLatency(p *Peer, d time.Duration) {
+	p.metrics.addSendLatency(d)
+}
+
+// TstInvQueue exposes an inventory send queue to the test package.
+type TstInvQueue struct {
+	q *invQueue
+}
+
+// TstNewInvQueue returns a new empty inventory send queue.
+func TstNewInvQueue() *TstInvQueue {
+	return &TstInvQueue{q: newInvQueue()}
+}
+
+// Len returns the number of queued inventory vectors.
+func (q *TstInvQueue) Len() int {
+	return q.q.Len()
+}
+
+// Push queues the passed inventory vector with the passed fee rate.  A negative
+// fee rate queues it without one.
+func (q *TstInvQueue) Push(iv *wire.InvVect, feePerKB int64) {
+	if feePerKB < 0 {
+		feePerKB = unknownFeeRate
+	}
+	q.q.push(iv, feePerKB)
+}
+
+// NextBatch exposes the nextBatch method of the inventory send queue.
+func (q *TstInvQueue) NextBatch(max int, feeFilter int64,
+	known func(*wire.InvVect) bool) []*wire.InvVect {
+
+	return q.q.nextBatch(max, feeFilter, known)
+}
+
+// TstRandomTrickleDelay exposes randomTrickleDelay to the test package.
+func TstRandomTrickleDelay(interval time.Duration) time.Duration {
+	return randomTrickleDelay(interval)
+}
+
+// TstIsPriorityMessage exposes isPriorityMessage to the test package.
+func TstIsPriorityMessage(msg wire.Message) bool {
+	return isPriorityMessage(msg)
+}
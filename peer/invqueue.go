@@ -0,0 +1,121 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/ifishnet/hdfd/wire"
+)
+
+const (
+	// unknownFeeRate is the fee rate of queued inventory which is not
+	// subject to fee filtering, such as inventory other than transactions.
+	unknownFeeRate = -1
+
+	// maxTrickleFactor is the maximum multiple of the trickle interval a
+	// single randomized trickle delay may take.
+	maxTrickleFactor = 4
+)
+
+// queuedInv is inventory queued to be trickled to a peer along with the fee
+// rate, in satoshi per kilobyte, of the transaction it refers to.
+type queuedInv struct {
+	iv       *wire.InvVect
+	feePerKB int64
+}
+
+// invQueue houses the inventory queued to be trickled to a peer.  Inventory
+// is announced in batches ordered by fee rate, highest first, so the most
+// valuable transactions propagate first when more inventory is queued than fits
+// into a single batch.  Inventory without a fee rate is announced before all
+// transactions, and inventory with the same fee rate in the order it was
+// queued.
+//
+// It is not safe for concurrent access.
+type invQueue struct {
+	items  []queuedInv
+	queued map[wire.InvVect]struct{}
+}
+
+// newInvQueue returns a new empty inventory queue.
+func newInvQueue() *invQueue {
+	return &invQueue{queued: make(map[wire.InvVect]struct{})}
+}
+
+// Len returns the number of queued inventory vectors.
+func (q *invQueue) Len() int {
+	return len(q.items)
+}
+
+// push adds the passed inventory vector to the queue.  Inventory which is
+// already queued is ignored.
+func (q *invQueue) push(iv *wire.InvVect, feePerKB int64) {
+	if _, ok := q.queued[*iv]; ok {
+		return
+	}
+	q.queued[*iv] = struct{}{}
+	q.items = append(q.items, queuedInv{iv: iv, feePerKB: feePerKB})
+}
+
+// nextBatch removes and returns up to the passed maximum number of queued
+// inventory vectors in announcement order.  Inventory the passed function
+// reports as already known to the peer, as well as transactions with a fee
+// rate below the passed fee filter, are removed from the queue without being
+// returned.  The remaining inventory stays queued for the next batch.
+func (q *invQueue) nextBatch(max int, feeFilter int64,
+	known func(*wire.InvVect) bool) []*wire.InvVect {
+
+	priority := func(i int) int64 {
+		if q.items[i].feePerKB == unknownFeeRate {
+			return math.MaxInt64
+		}
+		return q.items[i].feePerKB
+	}
+	sort.SliceStable(q.items, func(i, j int) bool {
+		return priority(i) > priority(j)
+	})
+
+	var batch []*wire.InvVect
+	remaining := q.items[:0]
+	for _, item := range q.items {
+		switch {
+		case len(batch) >= max:
+			remaining = append(remaining, item)
+			continue
+
+		case known(item.iv):
+
+		case feeFilter > 0 && item.feePerKB != unknownFeeRate &&
+			item.feePerKB < feeFilter:
+
+		default:
+			batch = append(batch, item.iv)
+		}
+		delete(q.queued, *item.iv)
+	}
+
+	// Clear the references held by the unused tail of the backing array.
+	for i := len(remaining); i < len(q.items); i++ {
+		q.items[i] = queuedInv{}
+	}
+	q.items = remaining
+	return batch
+}
+
+// randomTrickleDelay returns a random delay until the next inventory trickle.
+// The delays are drawn from an exponential distribution with a mean of the
+// passed interval, capped to a multiple of it, so the times inventory is
+// announced at can't be used to infer where it originated.
+func randomTrickleDelay(interval time.Duration) time.Duration {
+	delay := time.Duration(rand.ExpFloat64() * float64(interval))
+	if max := maxTrickleFactor * interval; delay > max {
+		delay = max
+	}
+	return delay
+}
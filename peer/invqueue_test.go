@@ -0,0 +1,91 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/peer"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// TestInvQueue ensures queued inventory is announced in batches ordered by fee
+// rate and that duplicate, known and fee-filtered inventory is never announced.
+func TestInvQueue(t *testing.T) {
+	t.Parallel()
+
+	newInv := func(typ wire.InvType, b byte) *wire.InvVect {
+		return wire.NewInvVect(typ, &chainhash.Hash{b})
+	}
+	block := newInv(wire.InvTypeBlock, 0)
+	low, mid, mid2, high := newInv(wire.InvTypeTx, 1),
+		newInv(wire.InvTypeTx, 2), newInv(wire.InvTypeTx, 3),
+		newInv(wire.InvTypeTx, 4)
+	known := newInv(wire.InvTypeTx, 5)
+	isKnown := func(iv *wire.InvVect) bool { return *iv == *known }
+
+	q := peer.TstNewInvQueue()
+	q.Push(low, 1000)
+	q.Push(mid, 5000)
+	q.Push(known, 9000)
+	q.Push(high, 10000)
+	q.Push(mid2, 5000)
+	q.Push(block, -1)
+	q.Push(mid, 5000)
+	if q.Len() != 6 {
+		t.Fatalf("unexpected queue length: got %d, want 6", q.Len())
+	}
+
+	// The first batch must start with the inventory without a fee rate and
+	// continue with the highest fee rates while skipping known inventory.
+	want := []*wire.InvVect{block, high, mid}
+	if got := q.NextBatch(3, 0, isKnown); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected first batch: got %v, want %v", got, want)
+	}
+	if q.Len() != 2 {
+		t.Fatalf("unexpected queue length: got %d, want 2", q.Len())
+	}
+
+	// The fee filter must drop the transactions below it.
+	want = []*wire.InvVect{mid2}
+	if got := q.NextBatch(3, 2000, isKnown); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected second batch: got %v, want %v", got, want)
+	}
+	if q.Len() != 0 {
+		t.Fatalf("unexpected queue length: got %d, want 0", q.Len())
+	}
+
+	// Inventory which was announced may be queued again.
+	q.Push(mid, 5000)
+	want = []*wire.InvVect{mid}
+	if got := q.NextBatch(3, 0, isKnown); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected third batch: got %v, want %v", got, want)
+	}
+}
+
+// TestRandomTrickleDelay ensures the randomized trickle delays are capped and
+// average out around the trickle interval.
+func TestRandomTrickleDelay(t *testing.T) {
+	t.Parallel()
+
+	const interval = time.Second
+	const samples = 10000
+	var total time.Duration
+	for i := 0; i < samples; i++ {
+		delay := peer.TstRandomTrickleDelay(interval)
+		if delay < 0 || delay > 4*interval {
+			t.Fatalf("delay %v is out of range", delay)
+		}
+		total += delay
+	}
+	mean := total / samples
+	if mean < interval*3/4 || mean > interval*5/4 {
+		t.Fatalf("unexpected mean delay: got %v, want about %v", mean,
+			interval)
+	}
+}
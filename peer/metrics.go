@@ -0,0 +1,184 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// PingSampleWindow is the number of most recent ping round trips the
+	// ping percentiles of a peer are calculated from.
+	PingSampleWindow = 32
+
+	// LatencySampleWindow is the number of most recently sent messages
+	// the send latency of a peer is calculated from.
+	LatencySampleWindow = 100
+)
+
+// PingStats describes the round trip times of the most recent pings of a peer.
+// All durations are zero when no ping has completed yet.
+type PingStats struct {
+	// Samples is the number of round trips the stats are calculated from.
+	// It is at most PingSampleWindow.
+	Samples int
+
+	// Min, Median, P90 and Max are the minimum, median, 90th percentile
+	// and maximum round trip times, respectively.
+	Min    time.Duration
+	Median time.Duration
+	P90    time.Duration
+	Max    time.Duration
+}
+
+// LatencyStats describes the time the most recently sent messages of a peer
+// spent between being queued and being written to the connection.  All
+// durations are zero when no message has been sent yet.
+type LatencyStats struct {
+	// Samples is the number of messages the stats are calculated from.  It
+	// is at most LatencySampleWindow.
+	Samples int
+
+	// Mean and Max are the mean and maximum latency, respectively.
+	Mean time.Duration
+	Max  time.Duration
+}
+
+// StatsSnap2 is a structured snapshot of the stats of a peer at a point in
+// time.  It extends StatsSnap with connection-level metrics so callers such as
+// the RPC server and monitoring are able to draw on consistent data.
+type StatsSnap2 struct {
+	StatsSnap
+
+	// Ping describes the round trip times of the most recent pings.
+	Ping PingStats
+
+	// Bandwidth holds the bytes sent and received per message command
+	// along with the current send and receive rates.
+	Bandwidth BandwidthStats
+
+	// SendLatency describes the time the most recently sent messages
+	// spent queued before being written to the connection.
+	SendLatency LatencyStats
+
+	// MisbehaviorScore is the current misbehavior score of the peer.
+	MisbehaviorScore uint32
+}
+
+// durationWindow is a fixed size ring buffer of the most recent duration
+// samples.
+type durationWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+// newDurationWindow returns a window which holds up to the passed number of
+// samples.
+func newDurationWindow(size int) durationWindow {
+	return durationWindow{samples: make([]time.Duration, 0, size)}
+}
+
+// add adds the passed sample to the window, replacing the oldest sample once
+// the window is full.
+func (w *durationWindow) add(d time.Duration) {
+	if len(w.samples) < cap(w.samples) {
+		w.samples = append(w.samples, d)
+		return
+	}
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % len(w.samples)
+}
+
+// percentile returns the sample at the passed percentile of the passed sorted
+// samples using the nearest-rank method.
+func percentile(sorted []time.Duration, pct int) time.Duration {
+	rank := (pct*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// connMetrics tracks the connection-level metrics of a peer which are not
+// kept by other means.
+//
+// It is safe for concurrent access.
+type connMetrics struct {
+	mtx         sync.Mutex
+	pings       durationWindow
+	sendLatency durationWindow
+}
+
+// newConnMetrics returns a new empty set of connection metrics.
+func newConnMetrics() *connMetrics {
+	return &connMetrics{
+		pings:       newDurationWindow(PingSampleWindow),
+		sendLatency: newDurationWindow(LatencySampleWindow),
+	}
+}
+
+// addPing records the round trip time of a completed ping.
+//
+// This function is safe for concurrent access.
+func (m *connMetrics) addPing(d time.Duration) {
+	m.mtx.Lock()
+	m.pings.add(d)
+	m.mtx.Unlock()
+}
+
+// addSendLatency records the time a sent message spent queued.
+//
+// This function is safe for concurrent access.
+func (m *connMetrics) addSendLatency(d time.Duration) {
+	m.mtx.Lock()
+	m.sendLatency.add(d)
+	m.mtx.Unlock()
+}
+
+// pingStats returns the stats of the recorded ping round trip times.
+//
+// This function is safe for concurrent access.
+func (m *connMetrics) pingStats() PingStats {
+	m.mtx.Lock()
+	sorted := make([]time.Duration, len(m.pings.samples))
+	copy(sorted, m.pings.samples)
+	m.mtx.Unlock()
+
+	if len(sorted) == 0 {
+		return PingStats{}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return PingStats{
+		Samples: len(sorted),
+		Min:     sorted[0],
+		Median:  percentile(sorted, 50),
+		P90:     percentile(sorted, 90),
+		Max:     sorted[len(sorted)-1],
+	}
+}
+
+// sendLatencyStats returns the stats of the recorded send latencies.
+//
+// This function is safe for concurrent access.
+func (m *connMetrics) sendLatencyStats() LatencyStats {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	var stats LatencyStats
+	var total time.Duration
+	for _, d := range m.sendLatency.samples {
+		total += d
+		if d > stats.Max {
+			stats.Max = d
+		}
+	}
+	stats.Samples = len(m.sendLatency.samples)
+	if stats.Samples > 0 {
+		stats.Mean = total / time.Duration(stats.Samples)
+	}
+	return stats
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfd/peer"
+)
+
+// TestStatsSnapshot2 ensures the ping percentiles and send latency of a peer
+// are calculated from the most recent samples only and that the misbehavior
+// score is included.
+func TestStatsSnapshot2(t *testing.T) {
+	t.Parallel()
+
+	var score uint32 = 42
+	p := peer.NewInboundPeer(&peer.Config{ChainParams: &chaincfg.MainNetParams})
+	p.Misbehaving(score, 0, "test")
+
+	snap := p.StatsSnapshot2()
+	if snap.Ping != (peer.PingStats{}) {
+		t.Fatalf("unexpected ping stats without samples: %+v", snap.Ping)
+	}
+	if snap.SendLatency != (peer.LatencyStats{}) {
+		t.Fatalf("unexpected send latency without samples: %+v",
+			snap.SendLatency)
+	}
+	if snap.MisbehaviorScore != score {
+		t.Fatalf("unexpected misbehavior score: got %d, want %d",
+			snap.MisbehaviorScore, score)
+	}
+
+	// Record an outlier which must fall out of the window followed by a
+	// full window of round trips from 1ms to PingSampleWindow ms.
+	peer.TstAddPing(p, time.Hour)
+	for i := peer.PingSampleWindow; i > 0; i-- {
+		peer.TstAddPing(p, time.Duration(i)*time.Millisecond)
+	}
+	wantPing := peer.PingStats{
+		Samples: peer.PingSampleWindow,
+		Min:     time.Millisecond,
+		Median:  16 * time.Millisecond,
+		P90:     29 * time.Millisecond,
+		Max:     peer.PingSampleWindow * time.Millisecond,
+	}
+	if got := p.StatsSnapshot2().Ping; got != wantPing {
+		t.Fatalf("unexpected ping stats: got %+v, want %+v", got,
+			wantPing)
+	}
+
+	for i := 0; i < peer.LatencySampleWindow+10; i++ {
+		latency := time.Millisecond
+		if i%2 == 0 {
+			latency = 3 * time.Millisecond
+		}
+		peer.TstAddSendLatency(p, latency)
+	}
+	wantLatency := peer.LatencyStats{
+		Samples: peer.LatencySampleWindow,
+		Mean:    2 * time.Millisecond,
+		Max:     3 * time.Millisecond,
+	}
+	if got := p.StatsSnapshot2().SendLatency; got != wantLatency {
+		t.Fatalf("unexpected send latency: got %+v, want %+v", got,
+			wantLatency)
+	}
+}
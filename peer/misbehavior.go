@@ -0,0 +1,80 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import "sync/atomic"
+
+// DefaultDiscourageThreshold is the default misbehavior score above which a
+// peer is discouraged and disconnected.
+const DefaultDiscourageThreshold = 100
+
+// Misbehaving increases the persistent and decaying misbehavior scores of the
+// peer by the values passed as parameters.  If the resulting score exceeds half
+// of the discourage threshold, a warning is logged including the reason
+// provided.  Further, if the score is above the discourage threshold, the peer
+// is discouraged by way of the OnDiscourage callback of its config and
+// disconnected.  It returns whether or not the peer has been discouraged.
+//
+// No score is calculated when misbehavior scoring is disabled for the peer, in
+// which case the misbehavior is only logged at debug level.
+//
+// This function is safe for concurrent access.
+func (p *Peer) Misbehaving(persistent, transient uint32, reason string) bool {
+	if p.cfg.DisableMisbehavior {
+		log.Debugf("Ignoring misbehavior of peer %s: %s", p, reason)
+		return false
+	}
+
+	threshold := p.cfg.DiscourageThreshold
+	warnThreshold := threshold >> 1
+	if transient == 0 && persistent == 0 {
+		// The score is not being increased, but a warning message is
+		// still logged if the score is above the warn threshold.
+		score := p.misbehavior.Int()
+		if score > warnThreshold {
+			log.Warnf("Misbehaving peer %s: %s -- misbehavior score "+
+				"is %d, it was not increased this time", p, reason,
+				score)
+		}
+		return false
+	}
+	score := p.misbehavior.Increase(persistent, transient)
+	if score <= warnThreshold {
+		return false
+	}
+	log.Warnf("Misbehaving peer %s: %s -- misbehavior score increased to %d",
+		p, reason, score)
+	if score <= threshold {
+		return false
+	}
+
+	// Only discourage the peer once regardless of how many more messages
+	// are processed before it is disconnected.
+	if atomic.AddInt32(&p.discouraged, 1) == 1 {
+		log.Warnf("Misbehaving peer %s -- discouraging and disconnecting",
+			p)
+		if p.cfg.OnDiscourage != nil {
+			p.cfg.OnDiscourage(p, score, reason)
+		}
+	}
+	p.Disconnect()
+	return true
+}
+
+// MisbehaviorScore returns the current misbehavior score of the peer, the sum
+// of its persistent and decaying scores.
+//
+// This function is safe for concurrent access.
+func (p *Peer) MisbehaviorScore() uint32 {
+	return p.misbehavior.Int()
+}
+
+// IsDiscouraged returns whether or not the misbehavior score of the peer has
+// exceeded the discourage threshold.
+//
+// This function is safe for concurrent access.
+func (p *Peer) IsDiscouraged() bool {
+	return atomic.LoadInt32(&p.discouraged) != 0
+}
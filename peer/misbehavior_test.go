@@ -0,0 +1,72 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer_test
+
+import (
+	"testing"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfd/peer"
+)
+
+// TestMisbehaving ensures peers are discouraged exactly once when their
+// misbehavior score exceeds the configured threshold and never when
+// misbehavior scoring is disabled.
+func TestMisbehaving(t *testing.T) {
+	t.Parallel()
+
+	var discouraged int
+	var lastScore uint32
+	p := peer.NewInboundPeer(&peer.Config{
+		ChainParams:         &chaincfg.MainNetParams,
+		DiscourageThreshold: 10,
+		OnDiscourage: func(_ *peer.Peer, score uint32, reason string) {
+			discouraged++
+			lastScore = score
+		},
+	})
+
+	tests := []struct {
+		persistent  uint32
+		discouraged bool
+		score       uint32
+	}{
+		{persistent: 4, discouraged: false, score: 4},
+		{persistent: 0, discouraged: false, score: 4},
+		{persistent: 6, discouraged: false, score: 10},
+		{persistent: 1, discouraged: true, score: 11},
+		{persistent: 5, discouraged: true, score: 16},
+	}
+	for i, test := range tests {
+		got := p.Misbehaving(test.persistent, 0, "test")
+		if got != test.discouraged {
+			t.Fatalf("#%d: unexpected discouraged result: got %v, "+
+				"want %v", i, got, test.discouraged)
+		}
+		if score := p.MisbehaviorScore(); score != test.score {
+			t.Fatalf("#%d: unexpected score: got %d, want %d", i,
+				score, test.score)
+		}
+	}
+	if discouraged != 1 || lastScore != 11 {
+		t.Fatalf("unexpected discouragement: got %d calls with score "+
+			"%d, want 1 call with score 11", discouraged, lastScore)
+	}
+	if !p.IsDiscouraged() {
+		t.Fatal("peer is not flagged as discouraged")
+	}
+
+	// Peers with misbehavior scoring disabled must never be discouraged.
+	p = peer.NewInboundPeer(&peer.Config{
+		ChainParams:        &chaincfg.MainNetParams,
+		DisableMisbehavior: true,
+		OnDiscourage: func(*peer.Peer, uint32, string) {
+			t.Fatal("discouraged peer with misbehavior disabled")
+		},
+	})
+	if p.Misbehaving(1000, 0, "test") || p.MisbehaviorScore() != 0 {
+		t.Fatal("scored peer with misbehavior disabled")
+	}
+}
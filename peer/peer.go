@@ -21,6 +21,7 @@ import (
 	"github.com/ifishnet/hdfd/blockchain"
 	"github.com/ifishnet/hdfd/chaincfg"
 	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/connmgr"
 	"github.com/ifishnet/hdfd/wire"
 	"github.com/ifishnet/go-socks/socks"
 	"github.com/davecgh/go-spew/spew"
@@ -29,10 +30,10 @@ import (
 
 const (
 	// MaxProtocolVersion is the max protocol version the peer supports.
-	MaxProtocolVersion = wire.FeeFilterVersion
+	MaxProtocolVersion = wire.WTxIdRelayVersion
 
-	// DefaultTrickleInterval is the min time between attempts to send an
-	// inv message to a peer.
+	// DefaultTrickleInterval is the average time between attempts to send
+	// an inv message to a peer.
 	DefaultTrickleInterval = 10 * time.Second
 
 	// MinAcceptableProtocolVersion is the lowest protocol version that a
@@ -42,8 +43,8 @@ const (
 	// outputBufferSize is the number of elements the output channels use.
 	outputBufferSize = 50
 
-	// invTrickleSize is the maximum amount of inventory to send in a single
-	// message when trickling inventory to remote peers.
+	// maxInvTrickleSize is the maximum amount of inventory to send with a
+	// single trickle to remote peers.
 	maxInvTrickleSize = 1000
 
 	// maxKnownInventory is the maximum number of items to keep in the known
@@ -107,6 +108,9 @@ type MessageListeners struct {
 	// OnAddr is invoked when a peer receives an addr bitcoin message.
 	OnAddr func(p *Peer, msg *wire.MsgAddr)
 
+	// OnAddrV2 is invoked when a peer receives an addrv2 bitcoin message.
+	OnAddrV2 func(p *Peer, msg *wire.MsgAddrV2)
+
 	// OnPing is invoked when a peer receives a ping bitcoin message.
 	OnPing func(p *Peer, msg *wire.MsgPing)
 
@@ -202,6 +206,25 @@ type MessageListeners struct {
 	// message.
 	OnSendHeaders func(p *Peer, msg *wire.MsgSendHeaders)
 
+	// OnBulletin is invoked when a peer receives a bulletin message.
+	OnBulletin func(p *Peer, msg *wire.MsgBulletin)
+
+	// OnSendCmpct is invoked when a peer receives a sendcmpct bitcoin
+	// message with a compact block version supported by the local peer.
+	OnSendCmpct func(p *Peer, msg *wire.MsgSendCmpct)
+
+	// OnCmpctBlock is invoked when a peer receives a cmpctblock bitcoin
+	// message.
+	OnCmpctBlock func(p *Peer, msg *wire.MsgCmpctBlock)
+
+	// OnGetBlockTxn is invoked when a peer receives a getblocktxn bitcoin
+	// message.
+	OnGetBlockTxn func(p *Peer, msg *wire.MsgGetBlockTxn)
+
+	// OnBlockTxn is invoked when a peer receives a blocktxn bitcoin
+	// message.
+	OnBlockTxn func(p *Peer, msg *wire.MsgBlockTxn)
+
 	// OnRead is invoked when a peer receives a bitcoin message.  It
 	// consists of the number of bytes read, the message, and whether or not
 	// an error in the read occurred.  Typically, callers will opt to use
@@ -273,18 +296,88 @@ type Config struct {
 	// messages.
 	Listeners MessageListeners
 
-	// TrickleInterval is the duration of the ticker which trickles down the
-	// inventory to a peer.
+	// TrickleInterval is the average time between the randomized trickles
+	// of inventory to a peer.
 	TrickleInterval time.Duration
-}
 
-// minUint32 is a helper function to return the minimum of two uint32s.
-// This avoids a math import and the need to cast to floats.
-func minUint32(a, b uint32) uint32 {
-	if a < b {
-		return a
-	}
-	return b
+	// SkipLocalChecksums specifies that message payload checksums are
+	// neither calculated for outgoing messages nor verified for incoming
+	// messages when the peer is connected over a unix socket.  Since the
+	// remote end will reject messages with an invalid checksum, this must
+	// only be set when the remote end is configured to skip checksums as
+	// well.
+	//
+	// NOTE: Loopback TCP connections are intentionally not covered since
+	// they include connections forwarded from remote peers, such as those
+	// to onion services, which would otherwise be sent invalid checksums.
+	//
+	// It only applies to the default transport and is ignored when
+	// NewTransport is set.
+	SkipLocalChecksums bool
+
+	// NewTransport specifies the factory used to create the transport
+	// messages are exchanged over once a connection is associated with the
+	// peer.  The unencrypted transport returned by NewV1Transport is used
+	// when it is nil.
+	NewTransport TransportFactory
+
+	// WTxIdRelay specifies whether remote peers should be informed that
+	// transactions may be announced and requested by their witness hash
+	// by way of MSG_WTX inventory vectors as defined by BIP0339.  The
+	// caller must be able to handle MSG_WTX inventory vectors for peers
+	// that report IsWTxIdRelayEnabled when this is set.
+	WTxIdRelay bool
+
+	// Compression specifies whether the experimental compression of block
+	// and cfilter messages should be negotiated with remote peers which
+	// advertise the wire.SFNodeCompression service flag.  Compression is
+	// only used when both peers signal support for it by way of a sendcompr
+	// message during the version negotiation.  The caller should advertise
+	// wire.SFNodeCompression in Services when this is set.
+	Compression bool
+
+	// DiscourageThreshold is the misbehavior score above which the peer
+	// is discouraged and disconnected.  DefaultDiscourageThreshold is used
+	// when it is 0.
+	DiscourageThreshold uint32
+
+	// DisableMisbehavior disables misbehavior scoring for the peer, so it
+	// is never discouraged.  Callers typically set it for whitelisted
+	// peers.
+	DisableMisbehavior bool
+
+	// OnDiscourage is invoked once when the misbehavior score of the peer
+	// exceeds DiscourageThreshold, right before the peer is disconnected.
+	// Callers typically use it to ban the address of the peer and to
+	// discourage it in the address manager.  It may be nil.
+	OnDiscourage func(p *Peer, score uint32, reason string)
+
+	// CmpctBlockVersion is the highest compact block version as defined by
+	// BIP0152 supported by the local peer.  When set, and the negotiated
+	// protocol version supports compact blocks, a sendcmpct message is sent
+	// once the version negotiation completes to signal support for them in
+	// low-bandwidth mode.  A value of 0 disables compact block relay.
+	CmpctBlockVersion uint64
+
+	// MaxUploadRate and MaxDownloadRate are the maximum number of bytes
+	// per second sent to and received from the peer, respectively.  A
+	// value of 0 does not limit the rate.
+	MaxUploadRate   int64
+	MaxDownloadRate int64
+
+	// UploadLimiter and DownloadLimiter optionally limit the rate of the
+	// bytes sent to and received from the peer in addition to the
+	// per-peer rates.  They are typically shared by all peers to limit
+	// the total bandwidth used.
+	UploadLimiter   *RateLimiter
+	DownloadLimiter *RateLimiter
+}
+
+// isUnixConn returns whether or not the passed connection is over a unix
+// socket, and therefore necessarily to a process on the local host.
+func isUnixConn(conn net.Conn) bool {
+	_, ok := conn.RemoteAddr().(*net.UnixAddr)
+	return ok
 }
 
 // newNetAddress attempts to extract the IP address and port from the passed
@@ -310,6 +403,13 @@ func newNetAddress(addr net.Addr, services wire.ServiceFlag) (*wire.NetAddress,
 		return na, nil
 	}
 
+	// Unix domain socket connections do not have an IP address or port, so
+	// treat them as coming from the loopback interface.
+	if _, ok := addr.(*net.UnixAddr); ok {
+		na := wire.NewNetAddressIPPort(net.IPv4(127, 0, 0, 1), 0, services)
+		return na, nil
+	}
+
 	// For the most part, addr should be one of the two above cases, but
 	// to be safe, fall back to trying to parse the information from the
 	// address string as a last resort.
@@ -333,6 +433,29 @@ type outMsg struct {
 	msg      wire.Message
 	doneChan chan<- struct{}
 	encoding wire.MessageEncoding
+	queued   time.Time
+}
+
+// isPriorityMessage returns whether or not the passed message is sent in the
+// priority lane of the output queue.  These are small messages whose latency
+// matters, such as pings and pongs which are used to measure it, and messages
+// which announce or help relaying new blocks.
+func isPriorityMessage(msg wire.Message) bool {
+	switch msg := msg.(type) {
+	case *wire.MsgPing, *wire.MsgPong, *wire.MsgHeaders,
+		*wire.MsgCmpctBlock, *wire.MsgBlockTxn, *wire.MsgSendCmpct:
+		return true
+
+	case *wire.MsgInv:
+		for _, iv := range msg.InvList {
+			if iv.Type == wire.InvTypeBlock ||
+				iv.Type == wire.InvTypeWitnessBlock {
+
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // stallControlCmd represents the command of a stall control message.
@@ -380,6 +503,19 @@ type StatsSnap struct {
 	LastPingNonce  uint64
 	LastPingTime   time.Time
 	LastPingMicros int64
+	FeeFilter      int64
+
+	// UploadThrottle and DownloadThrottle describe the throttling of the
+	// bytes sent to and received from the peer by its per-peer rate
+	// limits.  They are zero when the rates are not limited.
+	UploadThrottle   RateLimiterStats
+	DownloadThrottle RateLimiterStats
+
+	// CmpctHBTo reports whether the local peer selected the peer as one
+	// of its high-bandwidth compact block peers, and CmpctHBFrom whether
+	// the peer selected the local peer as one of its own.
+	CmpctHBTo   bool
+	CmpctHBFrom bool
 }
 
 // HashFunc is a function which returns a block hash, height and error
@@ -428,8 +564,16 @@ type Peer struct {
 	lastSend      int64
 	connected     int32
 	disconnect    int32
+	discouraged   int32
+	feeFilter     int64
 
-	conn net.Conn
+	// transport is set when the connection is associated and never
+	// modified afterwards.  All messages are exchanged by way of it.
+	//
+	// writeMtx serializes the writes to the transport since messages are
+	// written concurrently with reject messages during the negotiation.
+	transport Transport
+	writeMtx  sync.Mutex
 
 	// These fields are set at creation time and never modified, so they are
 	// safe to read from concurrently without a mutex.
@@ -445,7 +589,14 @@ type Peer struct {
 	versionKnown         bool
 	advertisedProtoVer   uint32 // protocol version advertised by remote
 	protocolVersion      uint32 // negotiated protocol version
+	capabilities         wire.CapabilitySet
 	sendHeadersPreferred bool   // peer sent a sendheaders message
+	sendAddrV2           bool   // peer sent a sendaddrv2 message
+	wtxIdRelay           bool   // peer sent a wtxidrelay message
+	sendCompr            bool   // peer sent a usable sendcompr message
+	cmpctBlockVersion    uint64 // compact block version sent by the peer
+	cmpctHBFrom          bool   // peer asked for cmpctblock announcements
+	cmpctHBTo            bool   // we asked for cmpctblock announcements
 	verAckReceived       bool
 	witnessEnabled       bool
 
@@ -471,11 +622,29 @@ type Peer struct {
 	lastPingTime       time.Time // Time we sent last ping.
 	lastPingMicros     int64     // Time for last ping to return.
 
+	// bandwidth accounts for the bytes sent and received per message
+	// command.  It is safe for concurrent access.
+	bandwidth *BandwidthCounter
+
+	// metrics tracks the ping round trip times and send latencies.  It is
+	// safe for concurrent access.
+	metrics *connMetrics
+
+	// misbehavior is the misbehavior score of the peer.  It is safe for
+	// concurrent access.
+	misbehavior connmgr.DynamicBanScore
+
+	// uploadLimiter and downloadLimiter enforce the per-peer rate limits.
+	// They are nil when the rates are not limited and are safe for
+	// concurrent access.
+	uploadLimiter   *RateLimiter
+	downloadLimiter *RateLimiter
+
 	stallControl  chan stallControlMsg
 	outputQueue   chan outMsg
 	sendQueue     chan outMsg
 	sendDoneQueue chan struct{}
-	outputInvChan chan *wire.InvVect
+	outputInvChan chan queuedInv
 	inQuit        chan struct{}
 	queueQuit     chan struct{}
 	outQuit       chan struct{}
@@ -521,6 +690,14 @@ func (p *Peer) AddKnownInventory(invVect *wire.InvVect) {
 	p.knownInventory.Add(invVect)
 }
 
+// IsKnownInventory returns whether or not the passed inventory is in the cache
+// of known inventory for the peer.
+//
+// This function is safe for concurrent access.
+func (p *Peer) IsKnownInventory(invVect *wire.InvVect) bool {
+	return p.knownInventory.Contains(invVect)
+}
+
 // StatsSnapshot returns a snapshot of the current peer flags and statistics.
 //
 // This function is safe for concurrent access.
@@ -533,6 +710,8 @@ func (p *Peer) StatsSnapshot() *StatsSnap {
 	userAgent := p.userAgent
 	services := p.services
 	protocolVersion := p.advertisedProtoVer
+	cmpctHBTo := p.cmpctHBTo
+	cmpctHBFrom := p.cmpctBlockVersion != 0 && p.cmpctHBFrom
 	p.flagsMtx.Unlock()
 
 	// Get a copy of all relevant flags and stats.
@@ -554,12 +733,35 @@ func (p *Peer) StatsSnapshot() *StatsSnap {
 		LastPingNonce:  p.lastPingNonce,
 		LastPingMicros: p.lastPingMicros,
 		LastPingTime:   p.lastPingTime,
+		FeeFilter:      p.FeeFilter(),
+		CmpctHBTo:      cmpctHBTo,
+		CmpctHBFrom:    cmpctHBFrom,
+	}
+	if p.uploadLimiter != nil {
+		statsSnap.UploadThrottle = p.uploadLimiter.Stats()
+	}
+	if p.downloadLimiter != nil {
+		statsSnap.DownloadThrottle = p.downloadLimiter.Stats()
 	}
 
 	p.statsMtx.RUnlock()
 	return statsSnap
 }
 
+// StatsSnapshot2 returns a structured snapshot of the current peer flags and
+// statistics along with its connection-level metrics.
+//
+// This function is safe for concurrent access.
+func (p *Peer) StatsSnapshot2() *StatsSnap2 {
+	return &StatsSnap2{
+		StatsSnap:        *p.StatsSnapshot(),
+		Ping:             p.metrics.pingStats(),
+		Bandwidth:        p.bandwidth.Stats(),
+		SendLatency:      p.metrics.sendLatencyStats(),
+		MisbehaviorScore: p.misbehavior.Int(),
+	}
+}
+
 // ID returns the peer id.
 //
 // This function is safe for concurrent access.
@@ -699,6 +901,26 @@ func (p *Peer) ProtocolVersion() uint32 {
 	return protocolVersion
 }
 
+// Capabilities returns the protocol capabilities available as a result of the
+// negotiated protocol version.
+//
+// This function is safe for concurrent access.
+func (p *Peer) Capabilities() wire.CapabilitySet {
+	p.flagsMtx.Lock()
+	capabilities := p.capabilities
+	p.flagsMtx.Unlock()
+
+	return capabilities
+}
+
+// HasCapability returns whether or not the provided protocol capability is
+// available as a result of the negotiated protocol version.
+//
+// This function is safe for concurrent access.
+func (p *Peer) HasCapability(c wire.Capability) bool {
+	return p.Capabilities().Has(c)
+}
+
 // LastBlock returns the last block of the peer.
 //
 // This function is safe for concurrent access.
@@ -730,7 +952,7 @@ func (p *Peer) LastRecv() time.Time {
 func (p *Peer) LocalAddr() net.Addr {
 	var localAddr net.Addr
 	if atomic.LoadInt32(&p.connected) != 0 {
-		localAddr = p.conn.LocalAddr()
+		localAddr = p.transport.LocalAddr()
 	}
 	return localAddr
 }
@@ -749,6 +971,14 @@ func (p *Peer) BytesReceived() uint64 {
 	return atomic.LoadUint64(&p.bytesReceived)
 }
 
+// BandwidthStats returns the bytes sent and received by the peer per message
+// command along with its current send and receive rates.
+//
+// This function is safe for concurrent access.
+func (p *Peer) BandwidthStats() BandwidthStats {
+	return p.bandwidth.Stats()
+}
+
 // TimeConnected returns the time at which the peer connected.
 //
 // This function is safe for concurrent access.
@@ -797,6 +1027,143 @@ func (p *Peer) WantsHeaders() bool {
 	return sendHeadersPreferred
 }
 
+// WantsAddrV2 returns if the peer supports addrv2 messages and prefers to
+// receive addresses by way of them instead of addr messages.
+//
+// This function is safe for concurrent access.
+func (p *Peer) WantsAddrV2() bool {
+	p.flagsMtx.Lock()
+	sendAddrV2 := p.sendAddrV2
+	p.flagsMtx.Unlock()
+
+	return sendAddrV2
+}
+
+// IsWTxIdRelayEnabled returns true if both the local and remote peer have
+// signalled that they support announcing and requesting transactions by their
+// witness hash as defined by BIP0339.
+//
+// This function is safe for concurrent access.
+func (p *Peer) IsWTxIdRelayEnabled() bool {
+	p.flagsMtx.Lock()
+	wtxIdRelay := p.wtxIdRelay
+	p.flagsMtx.Unlock()
+
+	return p.cfg.WTxIdRelay && wtxIdRelay
+}
+
+// IsCompressionEnabled returns true if both the local and remote peer have
+// signalled that they support the experimental compression of block and
+// cfilter messages.
+//
+// This function is safe for concurrent access.
+func (p *Peer) IsCompressionEnabled() bool {
+	p.flagsMtx.Lock()
+	sendCompr := p.sendCompr
+	p.flagsMtx.Unlock()
+
+	return p.cfg.Compression && sendCompr
+}
+
+// CmpctBlockVersion returns the compact block version as defined by BIP0152
+// used with the peer.  It is the highest version signalled by the remote peer
+// by way of a sendcmpct message which is also supported by the local peer, or 0
+// when compact blocks are not used with the peer.
+//
+// This function is safe for concurrent access.
+func (p *Peer) CmpctBlockVersion() uint64 {
+	p.flagsMtx.Lock()
+	version := p.cmpctBlockVersion
+	p.flagsMtx.Unlock()
+
+	return version
+}
+
+// WantsCmpctBlocks returns whether or not the remote peer selected the local
+// peer as one of its high-bandwidth peers, in which case new blocks should be
+// announced to it by sending a cmpctblock message directly as opposed to an inv
+// or headers message.
+//
+// This function is safe for concurrent access.
+func (p *Peer) WantsCmpctBlocks() bool {
+	p.flagsMtx.Lock()
+	wants := p.cmpctBlockVersion != 0 && p.cmpctHBFrom
+	p.flagsMtx.Unlock()
+
+	return wants
+}
+
+// IsCmpctHighBandwidth returns whether or not the local peer asked the remote
+// peer to announce new blocks by sending cmpctblock messages directly.  See
+// SetCmpctHighBandwidth.
+//
+// This function is safe for concurrent access.
+func (p *Peer) IsCmpctHighBandwidth() bool {
+	p.flagsMtx.Lock()
+	hb := p.cmpctHBTo
+	p.flagsMtx.Unlock()
+
+	return hb
+}
+
+// SetCmpctHighBandwidth asks the remote peer to announce new blocks by sending
+// cmpctblock messages directly (high-bandwidth mode) when enable is true, or
+// by way of inv or headers messages (low-bandwidth mode) otherwise, by queuing
+// a sendcmpct message.  It returns false without doing anything when compact
+// blocks are not used with the peer.  Nothing is sent when the peer is already
+// in the requested mode.
+//
+// This function is safe for concurrent access.
+func (p *Peer) SetCmpctHighBandwidth(enable bool) bool {
+	p.flagsMtx.Lock()
+	version := p.cmpctBlockVersion
+	if version == 0 {
+		p.flagsMtx.Unlock()
+		return false
+	}
+	changed := p.cmpctHBTo != enable
+	p.cmpctHBTo = enable
+	p.flagsMtx.Unlock()
+
+	if changed {
+		p.QueueMessage(wire.NewMsgSendCmpct(enable, version), nil)
+	}
+	return true
+}
+
+// handleSendCmpctMsg is invoked when a peer receives a sendcmpct bitcoin
+// message.  Messages for compact block versions which are not supported by the
+// local peer are ignored as defined by BIP0152.  It returns whether or not the
+// message was accepted.
+func (p *Peer) handleSendCmpctMsg(msg *wire.MsgSendCmpct) bool {
+	version := msg.CmpctBlockVersion
+	if version == 0 || version > p.cfg.CmpctBlockVersion ||
+		version > wire.CmpctBlockVersionWTxID {
+
+		log.Debugf("Ignoring sendcmpct message with unsupported "+
+			"version %d from %v", version, p)
+		return false
+	}
+
+	p.flagsMtx.Lock()
+	if version > p.cmpctBlockVersion {
+		p.cmpctBlockVersion = version
+	}
+	p.cmpctHBFrom = msg.AnnounceUsingCmpctBlock
+	p.flagsMtx.Unlock()
+	return true
+}
+
+// FeeFilter returns the minimum fee rate, in satoshi per kilobyte, the remote
+// peer most recently requested via a feefilter message for the transactions
+// announced to it.  Zero is returned when the peer has not sent a valid
+// feefilter message.
+//
+// This function is safe for concurrent access.
+func (p *Peer) FeeFilter() int64 {
+	return atomic.LoadInt64(&p.feeFilter)
+}
+
 // IsWitnessEnabled returns true if the peer has signalled that it supports
 // segregated witness.
 //
@@ -845,6 +1212,43 @@ func (p *Peer) PushAddrMsg(addresses []*wire.NetAddress) ([]*wire.NetAddress, er
 	return msg.AddrList, nil
 }
 
+// PushAddrV2Msg sends an addrv2 message to the connected peer using the
+// provided addresses.  This function is useful over manually sending the
+// message via QueueMessage since it automatically limits the addresses to the
+// maximum number allowed by the message and randomizes the chosen addresses
+// when there are too many.  It returns the addresses that were actually sent
+// and no message will be sent if there are no entries in the provided
+// addresses slice.
+//
+// This function is safe for concurrent access.
+func (p *Peer) PushAddrV2Msg(addresses []*wire.NetAddressV2) ([]*wire.NetAddressV2, error) {
+	addressCount := len(addresses)
+
+	// Nothing to send.
+	if addressCount == 0 {
+		return nil, nil
+	}
+
+	msg := wire.NewMsgAddrV2()
+	msg.AddrList = make([]*wire.NetAddressV2, addressCount)
+	copy(msg.AddrList, addresses)
+
+	// Randomize the addresses sent if there are more than the maximum allowed.
+	if addressCount > wire.MaxAddrPerMsg {
+		// Shuffle the address list.
+		for i := 0; i < wire.MaxAddrPerMsg; i++ {
+			j := i + rand.Intn(addressCount-i)
+			msg.AddrList[i], msg.AddrList[j] = msg.AddrList[j], msg.AddrList[i]
+		}
+
+		// Truncate it to the maximum size.
+		msg.AddrList = msg.AddrList[:wire.MaxAddrPerMsg]
+	}
+
+	p.QueueMessage(msg, nil)
+	return msg.AddrList, nil
+}
+
 // PushGetBlocksMsg sends a getblocks message for the provided block locator
 // and stop hash.  It will ignore back-to-back duplicate requests.
 //
@@ -943,7 +1347,7 @@ func (p *Peer) PushGetHeadersMsg(locator blockchain.BlockLocator, stopHash *chai
 func (p *Peer) PushRejectMsg(command string, code wire.RejectCode, reason string, hash *chainhash.Hash, wait bool) {
 	// Don't bother sending the reject message if the protocol version
 	// is too low.
-	if p.VersionKnown() && p.ProtocolVersion() < wire.RejectVersion {
+	if p.VersionKnown() && !p.HasCapability(wire.CapReject) {
 		return
 	}
 
@@ -976,7 +1380,7 @@ func (p *Peer) PushRejectMsg(command string, code wire.RejectCode, reason string
 // is considered a successful ping.
 func (p *Peer) handlePingMsg(msg *wire.MsgPing) {
 	// Only reply with pong if the message is from a new enough client.
-	if p.ProtocolVersion() > wire.BIP0031Version {
+	if p.HasCapability(wire.CapPong) {
 		// Include nonce from ping so pong can be identified.
 		p.QueueMessage(wire.NewMsgPong(msg.Nonce), nil)
 	}
@@ -994,12 +1398,14 @@ func (p *Peer) handlePongMsg(msg *wire.MsgPong) {
 	// and overlapping pings will be ignored. It is unlikely to occur
 	// without large usage of the ping rpc call since we ping infrequently
 	// enough that if they overlap we would have timed out the peer.
-	if p.ProtocolVersion() > wire.BIP0031Version {
+	if p.HasCapability(wire.CapPong) {
 		p.statsMtx.Lock()
 		if p.lastPingNonce != 0 && msg.Nonce == p.lastPingNonce {
-			p.lastPingMicros = time.Since(p.lastPingTime).Nanoseconds()
+			rtt := time.Since(p.lastPingTime)
+			p.lastPingMicros = rtt.Nanoseconds()
 			p.lastPingMicros /= 1000 // convert to usec.
 			p.lastPingNonce = 0
+			p.metrics.addPing(rtt)
 		}
 		p.statsMtx.Unlock()
 	}
@@ -1007,9 +1413,13 @@ func (p *Peer) handlePongMsg(msg *wire.MsgPong) {
 
 // readMessage reads the next bitcoin message from the peer with logging.
 func (p *Peer) readMessage(encoding wire.MessageEncoding) (wire.Message, []byte, error) {
-	n, msg, buf, err := wire.ReadMessageWithEncodingN(p.conn,
-		p.ProtocolVersion(), p.cfg.ChainParams.Net, encoding)
+	n, msg, buf, err := p.transport.ReadMessage(p.ProtocolVersion(),
+		p.cfg.ChainParams.Net, encoding)
 	atomic.AddUint64(&p.bytesReceived, uint64(n))
+	if cmsg, ok := msg.(*wire.MsgCompressed); ok && err == nil {
+		msg, buf, err = p.decompressMessage(cmsg, encoding)
+	}
+	p.bandwidth.AddReceived(msg, n)
 	if p.cfg.Listeners.OnRead != nil {
 		p.cfg.Listeners.OnRead(p, n, msg, err)
 	}
@@ -1017,6 +1427,11 @@ func (p *Peer) readMessage(encoding wire.MessageEncoding) (wire.Message, []byte,
 		return nil, nil, err
 	}
 
+	// Delay reading the next message as needed to honor the download rate
+	// limits.  The remote peer is throttled by way of TCP flow control
+	// since nothing is read from the connection in the meantime.
+	waitForLimiters(n, p.quit, p.downloadLimiter, p.cfg.DownloadLimiter)
+
 	// Use closures to log expensive operations so they are only run when
 	// the logging level requires it.
 	log.Debugf("%v", newLogClosure(func() string {
@@ -1038,6 +1453,45 @@ func (p *Peer) readMessage(encoding wire.MessageEncoding) (wire.Message, []byte,
 	return msg, buf, nil
 }
 
+// decompressMessage returns the message wrapped by the passed compressed message
+// along with its raw uncompressed payload.  An error is returned when
+// compression has not been negotiated with the peer or the compressed message
+// is invalid, in which case the peer is disconnected.
+func (p *Peer) decompressMessage(cmsg *wire.MsgCompressed,
+	encoding wire.MessageEncoding) (wire.Message, []byte, error) {
+
+	if !p.IsCompressionEnabled() {
+		return nil, nil, &wire.MessageError{
+			Func: "decompressMessage",
+			Description: "compressed message received without " +
+				"negotiating compression",
+		}
+	}
+
+	return cmsg.Decompress(p.ProtocolVersion(), encoding)
+}
+
+// compressMessage returns a compressed message wrapping the passed message when
+// compression has been negotiated with the peer and the message is
+// compressible.  Otherwise, or when the message can't be compressed, the
+// passed message is returned as is so it is sent uncompressed.
+func (p *Peer) compressMessage(msg wire.Message,
+	enc wire.MessageEncoding) wire.Message {
+
+	if !wire.IsCompressible(msg.Command()) || !p.IsCompressionEnabled() {
+		return msg
+	}
+
+	cmsg, err := wire.NewMsgCompressed(msg, wire.CompressionDeflate,
+		p.ProtocolVersion(), enc)
+	if err != nil {
+		log.Debugf("Unable to compress %v message to %s, sending it "+
+			"uncompressed: %v", msg.Command(), p, err)
+		return msg
+	}
+	return cmsg
+}
+
 // writeMessage sends a bitcoin message to the peer with logging.
 func (p *Peer) writeMessage(msg wire.Message, enc wire.MessageEncoding) error {
 	// Don't do anything if we're disconnecting.
@@ -1069,14 +1523,25 @@ func (p *Peer) writeMessage(msg wire.Message, enc wire.MessageEncoding) error {
 		return spew.Sdump(buf.Bytes())
 	}))
 
-	// Write the message to the peer.
-	n, err := wire.WriteMessageWithEncodingN(p.conn, msg,
+	// Write the message to the peer, compressing it when compression has
+	// been negotiated.
+	p.writeMtx.Lock()
+	n, err := p.transport.WriteMessage(p.compressMessage(msg, enc),
 		p.ProtocolVersion(), p.cfg.ChainParams.Net, enc)
+	p.writeMtx.Unlock()
 	atomic.AddUint64(&p.bytesSent, uint64(n))
+	p.bandwidth.AddSent(msg, n)
 	if p.cfg.Listeners.OnWrite != nil {
 		p.cfg.Listeners.OnWrite(p, n, msg, err)
 	}
-	return err
+	if err != nil {
+		return err
+	}
+
+	// Delay writing the next message as needed to honor the upload rate
+	// limits.
+	waitForLimiters(n, p.quit, p.uploadLimiter, p.cfg.UploadLimiter)
+	return nil
 }
 
 // isAllowedReadError returns whether or not the passed error is allowed without
@@ -1395,6 +1860,32 @@ out:
 				p.cfg.Listeners.OnAddr(p, msg)
 			}
 
+		case *wire.MsgAddrV2:
+			if p.cfg.Listeners.OnAddrV2 != nil {
+				p.cfg.Listeners.OnAddrV2(p, msg)
+			}
+
+		case *wire.MsgSendAddrV2:
+			// The sendaddrv2 message is only meaningful during the
+			// version negotiation, so ignore it afterwards.
+			log.Debugf("Ignoring sendaddrv2 message received after "+
+				"verack from %v", p)
+
+		case *wire.MsgWTxIdRelay:
+			// The wtxidrelay message must be sent prior to the verack
+			// as defined by BIP0339.
+			p.PushRejectMsg(msg.Command(), wire.RejectMalformed,
+				"wtxidrelay message received after verack", nil,
+				true)
+			break out
+
+		case *wire.MsgSendCompr:
+			// The sendcompr message must be sent prior to the verack.
+			p.PushRejectMsg(msg.Command(), wire.RejectMalformed,
+				"sendcompr message received after verack", nil,
+				true)
+			break out
+
 		case *wire.MsgPing:
 			p.handlePingMsg(msg)
 			if p.cfg.Listeners.OnPing != nil {
@@ -1483,6 +1974,12 @@ out:
 			}
 
 		case *wire.MsgFeeFilter:
+			// Track the fee filter requested by the remote peer so
+			// it is available via FeeFilter.  Invalid fee rates are
+			// ignored and left to the listener to deal with.
+			if msg.MinFee >= 0 && msg.MinFee <= wire.MaxFeeFilterRate {
+				atomic.StoreInt64(&p.feeFilter, msg.MinFee)
+			}
 			if p.cfg.Listeners.OnFeeFilter != nil {
 				p.cfg.Listeners.OnFeeFilter(p, msg)
 			}
@@ -1521,6 +2018,33 @@ out:
 				p.cfg.Listeners.OnSendHeaders(p, msg)
 			}
 
+		case *wire.MsgBulletin:
+			if p.cfg.Listeners.OnBulletin != nil {
+				p.cfg.Listeners.OnBulletin(p, msg)
+			}
+
+		case *wire.MsgSendCmpct:
+			if p.handleSendCmpctMsg(msg) &&
+				p.cfg.Listeners.OnSendCmpct != nil {
+
+				p.cfg.Listeners.OnSendCmpct(p, msg)
+			}
+
+		case *wire.MsgCmpctBlock:
+			if p.cfg.Listeners.OnCmpctBlock != nil {
+				p.cfg.Listeners.OnCmpctBlock(p, msg)
+			}
+
+		case *wire.MsgGetBlockTxn:
+			if p.cfg.Listeners.OnGetBlockTxn != nil {
+				p.cfg.Listeners.OnGetBlockTxn(p, msg)
+			}
+
+		case *wire.MsgBlockTxn:
+			if p.cfg.Listeners.OnBlockTxn != nil {
+				p.cfg.Listeners.OnBlockTxn(p, msg)
+			}
+
 		default:
 			log.Debugf("Received unhandled message of type %v "+
 				"from %v", rmsg.Command(), p)
@@ -1546,26 +2070,39 @@ out:
 // handlers will not block on us sending a message.  That data is then passed on
 // to outHandler to be actually written.
 func (p *Peer) queueHandler() {
+	// Pending messages are split into two lanes.  Messages in the priority
+	// lane, such as pings, pongs and block announcements, are handed to
+	// outHandler before all messages in the bulk lane, so they are not
+	// delayed behind large responses such as blocks requested by a peer
+	// which is syncing from us.  Messages in the same lane are sent in the
+	// order they were queued.
+	priorityMsgs := list.New()
 	pendingMsgs := list.New()
-	invSendQueue := list.New()
-	trickleTicker := time.NewTicker(p.cfg.TrickleInterval)
-	defer trickleTicker.Stop()
+	invSendQueue := newInvQueue()
+	trickleTimer := time.NewTimer(randomTrickleDelay(p.cfg.TrickleInterval))
+	defer trickleTimer.Stop()
 
 	// We keep the waiting flag so that we know if we have a message queued
 	// to the outHandler or not.  We could use the presence of a head of
 	// the list for this but then we have rather racy concerns about whether
 	// it has gotten it at cleanup time - and thus who sends on the
 	// message's done channel.  To avoid such confusion we keep a different
-	// flag and pendingMsgs only contains messages that we have not yet
+	// flag and the pending lanes only contain messages that we have not yet
 	// passed to outHandler.
 	waiting := false
 
 	// To avoid duplication below.
-	queuePacket := func(msg outMsg, list *list.List, waiting bool) bool {
-		if !waiting {
+	queuePacket := func(msg outMsg, waiting bool) bool {
+		if msg.queued.IsZero() {
+			msg.queued = time.Now()
+		}
+		switch {
+		case !waiting:
 			p.sendQueue <- msg
-		} else {
-			list.PushBack(msg)
+		case isPriorityMessage(msg.msg):
+			priorityMsgs.PushBack(msg)
+		default:
+			pendingMsgs.PushBack(msg)
 		}
 		// we are always waiting now.
 		return true
@@ -1574,14 +2111,18 @@ out:
 	for {
 		select {
 		case msg := <-p.outputQueue:
-			waiting = queuePacket(msg, pendingMsgs, waiting)
+			waiting = queuePacket(msg, waiting)
 
 		// This channel is notified when a message has been sent across
 		// the network socket.
 		case <-p.sendDoneQueue:
 			// No longer waiting if there are no more messages
-			// in the pending messages queue.
-			next := pendingMsgs.Front()
+			// in either of the pending lanes.
+			lane := priorityMsgs
+			if lane.Len() == 0 {
+				lane = pendingMsgs
+			}
+			next := lane.Front()
 			if next == nil {
 				waiting = false
 				continue
@@ -1589,28 +2130,34 @@ out:
 
 			// Notify the outHandler about the next item to
 			// asynchronously send.
-			val := pendingMsgs.Remove(next)
+			val := lane.Remove(next)
 			p.sendQueue <- val.(outMsg)
 
-		case iv := <-p.outputInvChan:
+		case inv := <-p.outputInvChan:
 			// No handshake?  They'll find out soon enough.
 			if p.VersionKnown() {
 				// If this is a new block, then we'll blast it
 				// out immediately, sipping the inv trickle
 				// queue.
+				iv := inv.iv
 				if iv.Type == wire.InvTypeBlock ||
 					iv.Type == wire.InvTypeWitnessBlock {
 
 					invMsg := wire.NewMsgInvSizeHint(1)
 					invMsg.AddInvVect(iv)
 					waiting = queuePacket(outMsg{msg: invMsg},
-						pendingMsgs, waiting)
+						waiting)
 				} else {
-					invSendQueue.PushBack(iv)
+					invSendQueue.push(iv, inv.feePerKB)
 				}
 			}
 
-		case <-trickleTicker.C:
+		case <-trickleTimer.C:
+			// Randomize the time until the next trickle so the
+			// announcement times can't be used to fingerprint the
+			// node or to infer where transactions originated.
+			trickleTimer.Reset(randomTrickleDelay(p.cfg.TrickleInterval))
+
 			// Don't send anything if we're disconnecting or there
 			// is no queued inventory.
 			// version is known if send queue has any entries.
@@ -1619,34 +2166,28 @@ out:
 				continue
 			}
 
-			// Create and send as many inv messages as needed to
-			// drain the inventory send queue.
-			invMsg := wire.NewMsgInvSizeHint(uint(invSendQueue.Len()))
-			for e := invSendQueue.Front(); e != nil; e = invSendQueue.Front() {
-				iv := invSendQueue.Remove(e).(*wire.InvVect)
-
-				// Don't send inventory that became known after
-				// the initial check.
-				if p.knownInventory.Contains(iv) {
-					continue
-				}
-
+			// Send the next batch of the inventory send queue.
+			// Inventory that became known after the initial check
+			// and transactions below the current fee filter of the
+			// peer are dropped.  Inventory which does not fit into
+			// the batch is sent with the next trickle.
+			isKnown := func(iv *wire.InvVect) bool {
+				return p.knownInventory.Contains(iv)
+			}
+			batch := invSendQueue.nextBatch(maxInvTrickleSize,
+				p.FeeFilter(), isKnown)
+			if len(batch) == 0 {
+				continue
+			}
+			invMsg := wire.NewMsgInvSizeHint(uint(len(batch)))
+			for _, iv := range batch {
 				invMsg.AddInvVect(iv)
-				if len(invMsg.InvList) >= maxInvTrickleSize {
-					waiting = queuePacket(
-						outMsg{msg: invMsg},
-						pendingMsgs, waiting)
-					invMsg = wire.NewMsgInvSizeHint(uint(invSendQueue.Len()))
-				}
 
 				// Add the inventory that is being relayed to
 				// the known inventory for the peer.
 				p.AddKnownInventory(iv)
 			}
-			if len(invMsg.InvList) > 0 {
-				waiting = queuePacket(outMsg{msg: invMsg},
-					pendingMsgs, waiting)
-			}
+			waiting = queuePacket(outMsg{msg: invMsg}, waiting)
 
 		case <-p.quit:
 			break out
@@ -1655,11 +2196,13 @@ out:
 
 	// Drain any wait channels before we go away so we don't leave something
 	// waiting for us.
-	for e := pendingMsgs.Front(); e != nil; e = pendingMsgs.Front() {
-		val := pendingMsgs.Remove(e)
-		msg := val.(outMsg)
-		if msg.doneChan != nil {
-			msg.doneChan <- struct{}{}
+	for _, lane := range []*list.List{priorityMsgs, pendingMsgs} {
+		for e := lane.Front(); e != nil; e = lane.Front() {
+			val := lane.Remove(e)
+			msg := val.(outMsg)
+			if msg.doneChan != nil {
+				msg.doneChan <- struct{}{}
+			}
 		}
 	}
 cleanup:
@@ -1712,7 +2255,7 @@ out:
 			case *wire.MsgPing:
 				// Only expects a pong message in later protocol
 				// versions.  Also set up statistics.
-				if p.ProtocolVersion() > wire.BIP0031Version {
+				if p.HasCapability(wire.CapPong) {
 					p.statsMtx.Lock()
 					p.lastPingNonce = m.Nonce
 					p.lastPingTime = time.Now()
@@ -1740,7 +2283,9 @@ out:
 			// message that it has been sent (if requested), and
 			// signal the send queue to the deliver the next queued
 			// message.
-			atomic.StoreInt64(&p.lastSend, time.Now().Unix())
+			now := time.Now()
+			atomic.StoreInt64(&p.lastSend, now.Unix())
+			p.metrics.addSendLatency(now.Sub(msg.queued))
 			if msg.doneChan != nil {
 				msg.doneChan <- struct{}{}
 			}
@@ -1822,15 +2367,36 @@ func (p *Peer) QueueMessageWithEncoding(msg wire.Message, doneChan chan<- struct
 		}
 		return
 	}
-	p.outputQueue <- outMsg{msg: msg, encoding: encoding, doneChan: doneChan}
+	p.outputQueue <- outMsg{msg: msg, encoding: encoding, doneChan: doneChan,
+		queued: time.Now()}
 }
 
 // QueueInventory adds the passed inventory to the inventory send queue which
-// might not be sent right away, rather it is trickled to the peer in batches.
-// Inventory that the peer is already known to have is ignored.
+// might not be sent right away, rather it is trickled to the peer in batches
+// at randomized intervals.  Inventory that the peer is already known to have is
+// ignored.
 //
 // This function is safe for concurrent access.
 func (p *Peer) QueueInventory(invVect *wire.InvVect) {
+	p.queueInventory(invVect, unknownFeeRate)
+}
+
+// QueueTxInventory adds the passed transaction inventory to the inventory send
+// queue along with the fee rate, in satoshi per kilobyte, of the transaction.
+// Queued transactions are announced in the order of their fee rates, highest
+// first, and dropped when their fee rate is below the fee filter the peer
+// requested by the time they are due to be announced.
+//
+// This function is safe for concurrent access.
+func (p *Peer) QueueTxInventory(invVect *wire.InvVect, feePerKB int64) {
+	p.queueInventory(invVect, feePerKB)
+}
+
+// queueInventory adds the passed inventory to the inventory send queue along
+// with the fee rate of the transaction it refers to, if any.
+//
+// This function is safe for concurrent access.
+func (p *Peer) queueInventory(invVect *wire.InvVect, feePerKB int64) {
 	// Don't add the inventory to the send queue if the peer is already
 	// known to have it.
 	if p.knownInventory.Contains(invVect) {
@@ -1844,7 +2410,7 @@ func (p *Peer) QueueInventory(invVect *wire.InvVect) {
 		return
 	}
 
-	p.outputInvChan <- invVect
+	p.outputInvChan <- queuedInv{iv: invVect, feePerKB: feePerKB}
 }
 
 // Connected returns whether or not the peer is currently connected.
@@ -1865,7 +2431,7 @@ func (p *Peer) Disconnect() {
 
 	log.Tracef("Disconnecting %s", p)
 	if atomic.LoadInt32(&p.connected) != 0 {
-		p.conn.Close()
+		p.transport.Close()
 	}
 	close(p.quit)
 }
@@ -1900,12 +2466,13 @@ func (p *Peer) readRemoteVersionMsg() error {
 	// peer advertised.
 	p.flagsMtx.Lock()
 	p.advertisedProtoVer = uint32(msg.ProtocolVersion)
-	p.protocolVersion = minUint32(p.protocolVersion, p.advertisedProtoVer)
+	p.protocolVersion, p.capabilities = wire.Negotiate(p.protocolVersion,
+		p.advertisedProtoVer)
 	p.versionKnown = true
 	p.services = msg.Services
 	p.flagsMtx.Unlock()
-	log.Debugf("Negotiated protocol version %d for peer %s",
-		p.protocolVersion, p)
+	log.Debugf("Negotiated protocol version %d (capabilities %v) for "+
+		"peer %s", p.protocolVersion, p.capabilities, p)
 
 	// Updating a bunch of stats including block based stats, and the
 	// peer's time offset.
@@ -1972,10 +2539,42 @@ func (p *Peer) readRemoteVersionMsg() error {
 // This method is to be used as part of the version negotiation upon a new
 // connection.
 func (p *Peer) readRemoteVerAckMsg() error {
-	// Read the next message from the wire.
-	remoteMsg, _, err := p.readMessage(wire.LatestEncoding)
-	if err != nil {
-		return err
+	// Read messages from the wire until one that is not used to signal
+	// support for a feature is received.  Peers that support addrv2 and
+	// wtxid-based transaction relay signal so by sending sendaddrv2 and
+	// wtxidrelay messages prior to their verack as defined by BIP0155 and
+	// BIP0339, respectively.  Similarly, peers that support compression
+	// send a sendcompr message prior to their verack.
+	var remoteMsg wire.Message
+	for remoteMsg == nil {
+		rmsg, _, err := p.readMessage(wire.LatestEncoding)
+		if err != nil {
+			return err
+		}
+
+		switch m := rmsg.(type) {
+		case *wire.MsgSendAddrV2:
+			p.flagsMtx.Lock()
+			p.sendAddrV2 = true
+			p.flagsMtx.Unlock()
+
+		case *wire.MsgWTxIdRelay:
+			p.flagsMtx.Lock()
+			p.wtxIdRelay = true
+			p.flagsMtx.Unlock()
+
+		case *wire.MsgSendCompr:
+			// Compression is only used when the remote peer also
+			// advertises it and supports an algorithm we support.
+			usable := p.Services()&wire.SFNodeCompression != 0 &&
+				m.HasAlgorithm(wire.CompressionDeflate)
+			p.flagsMtx.Lock()
+			p.sendCompr = usable
+			p.flagsMtx.Unlock()
+
+		default:
+			remoteMsg = rmsg
+		}
 	}
 
 	// It should be a verack message, otherwise send a reject message to the
@@ -2063,6 +2662,70 @@ func (p *Peer) localVersionMsg() (*wire.MsgVersion, error) {
 	return msg, nil
 }
 
+// featureMsgs returns the messages used to signal support for features to the
+// remote peer.  That is a wtxidrelay message when the local peer is configured
+// to support wtxid-based transaction relay, a sendaddrv2 message to signal that
+// addresses should be relayed by way of addrv2 messages, and a sendcompr
+// message when the local peer is configured to support compression and the
+// remote peer advertises support for it.  The wtxidrelay and sendaddrv2
+// messages are only included when the negotiated protocol version supports
+// them.
+//
+// The messages must be sent after the version of the remote peer is known and
+// before our verack is sent.
+func (p *Peer) featureMsgs() []wire.Message {
+	var msgs []wire.Message
+	if p.cfg.WTxIdRelay && p.HasCapability(wire.CapWTxIdRelay) {
+		msgs = append(msgs, wire.NewMsgWTxIdRelay())
+	}
+	if p.HasCapability(wire.CapAddrV2) {
+		msgs = append(msgs, wire.NewMsgSendAddrV2())
+	}
+	if p.cfg.Compression && p.Services()&wire.SFNodeCompression != 0 {
+		msgs = append(msgs, wire.NewMsgSendCompr(wire.CompressionDeflate))
+	}
+	return msgs
+}
+
+// writeMessagesAsync writes the passed messages to the remote peer in order
+// from a separate goroutine and returns a channel which receives the result
+// once all of them have been written or writing one of them failed.
+//
+// Both peers send their feature messages and verack at the same time during
+// the negotiation, so they are written while the messages of the remote peer
+// are read to ensure neither peer blocks on a write the other one doesn't
+// read.
+func (p *Peer) writeMessagesAsync(msgs []wire.Message) <-chan error {
+	writeErr := make(chan error, 1)
+	go func() {
+		for _, msg := range msgs {
+			err := p.writeMessage(msg, wire.LatestEncoding)
+			if err != nil {
+				writeErr <- err
+				return
+			}
+		}
+		writeErr <- nil
+	}()
+	return writeErr
+}
+
+// writeSendCmpctMsg writes a sendcmpct message to the remote peer when the
+// local peer is configured to support compact blocks and the negotiated
+// protocol version supports them to signal support for compact blocks in
+// low-bandwidth mode.  It must be called after the version negotiation
+// completes since remote peers only expect it after the verack.
+func (p *Peer) writeSendCmpctMsg() error {
+	if p.cfg.CmpctBlockVersion == 0 ||
+		!p.HasCapability(wire.CapCompactBlocks) {
+
+		return nil
+	}
+
+	msg := wire.NewMsgSendCmpct(false, p.cfg.CmpctBlockVersion)
+	return p.writeMessage(msg, wire.LatestEncoding)
+}
+
 // writeLocalVersionMsg writes our version message to the remote peer.
 func (p *Peer) writeLocalVersionMsg() error {
 	localVerMsg, err := p.localVersionMsg()
@@ -2079,8 +2742,9 @@ func (p *Peer) writeLocalVersionMsg() error {
 //
 //   1. Remote peer sends their version.
 //   2. We send our version.
-//   3. We send our verack.
-//   4. Remote peer sends their verack.
+//   3. We send our wtxidrelay, sendaddrv2 and sendcompr if supported followed
+//      by our verack while the remote peer sends their feature messages and
+//      verack.
 func (p *Peer) negotiateInboundProtocol() error {
 	if err := p.readRemoteVersionMsg(); err != nil {
 		return err
@@ -2090,12 +2754,13 @@ func (p *Peer) negotiateInboundProtocol() error {
 		return err
 	}
 
-	err := p.writeMessage(wire.NewMsgVerAck(), wire.LatestEncoding)
-	if err != nil {
+	msgs := append(p.featureMsgs(), wire.NewMsgVerAck())
+	writeErr := p.writeMessagesAsync(msgs)
+	if err := p.readRemoteVerAckMsg(); err != nil {
 		return err
 	}
 
-	return p.readRemoteVerAckMsg()
+	return <-writeErr
 }
 
 // negotiateOutboundProtocol performs the negotiation protocol for an outbound
@@ -2104,7 +2769,8 @@ func (p *Peer) negotiateInboundProtocol() error {
 //
 //   1. We send our version.
 //   2. Remote peer sends their version.
-//   3. Remote peer sends their verack.
+//   3. We send our wtxidrelay, sendaddrv2 and sendcompr if supported while the
+//      remote peer sends their feature messages and verack.
 //   4. We send our verack.
 func (p *Peer) negotiateOutboundProtocol() error {
 	if err := p.writeLocalVersionMsg(); err != nil {
@@ -2115,9 +2781,13 @@ func (p *Peer) negotiateOutboundProtocol() error {
 		return err
 	}
 
+	writeErr := p.writeMessagesAsync(p.featureMsgs())
 	if err := p.readRemoteVerAckMsg(); err != nil {
 		return err
 	}
+	if err := <-writeErr; err != nil {
+		return err
+	}
 
 	return p.writeMessage(wire.NewMsgVerAck(), wire.LatestEncoding)
 }
@@ -2150,8 +2820,16 @@ func (p *Peer) start() error {
 
 	// The protocol has been negotiated successfully so start processing input
 	// and output messages.
+	//
+	// Support for compact blocks is signalled before any queued messages are
+	// sent to the remote peer.  Since the remote peer does the same, input
+	// messages must already be processed while it is written.
 	go p.stallHandler()
 	go p.inHandler()
+	if err := p.writeSendCmpctMsg(); err != nil {
+		p.Disconnect()
+		return err
+	}
 	go p.queueHandler()
 	go p.outHandler()
 	go p.pingHandler()
@@ -2161,28 +2839,65 @@ func (p *Peer) start() error {
 
 // AssociateConnection associates the given conn to the peer.   Calling this
 // function when the peer is already connected will have no effect.
+//
+// Messages are exchanged over the transport created by the NewTransport factory
+// of the peer config, or over the unencrypted transport when it is not set.
+// The peer is disconnected when the transport can't be created.
 func (p *Peer) AssociateConnection(conn net.Conn) {
+	// Already connected?
+	if atomic.LoadInt32(&p.connected) != 0 {
+		return
+	}
+
+	var transport Transport
+	if p.cfg.NewTransport != nil {
+		var err error
+		transport, err = p.cfg.NewTransport(conn, p.inbound)
+		if err != nil {
+			log.Debugf("Cannot create transport for %s: %v",
+				conn.RemoteAddr(), err)
+			conn.Close()
+			p.Disconnect()
+			return
+		}
+	} else {
+		skipChecksum := p.cfg.SkipLocalChecksums && isUnixConn(conn)
+		transport = NewV1Transport(conn, skipChecksum)
+	}
+	p.AssociateTransport(transport)
+}
+
+// AssociateTransport associates the given transport to the peer.  Calling this
+// function when the peer is already connected will have no effect.
+func (p *Peer) AssociateTransport(transport Transport) {
 	// Already connected?
 	if !atomic.CompareAndSwapInt32(&p.connected, 0, 1) {
 		return
 	}
 
-	p.conn = conn
+	p.transport = transport
 	p.timeConnected = time.Now()
 
 	if p.inbound {
-		p.addr = p.conn.RemoteAddr().String()
+		p.addr = p.transport.RemoteAddr().String()
 
 		// Set up a NetAddress for the peer to be used with AddrManager.  We
 		// only do this inbound because outbound set this up at connection time
 		// and no point recomputing.
-		na, err := newNetAddress(p.conn.RemoteAddr(), p.services)
+		na, err := newNetAddress(p.transport.RemoteAddr(), p.services)
 		if err != nil {
 			log.Errorf("Cannot create remote net address: %v", err)
 			p.Disconnect()
 			return
 		}
 		p.na = na
+
+		// Unix domain socket connections do not have a meaningful
+		// remote address, so use the address they map to instead.
+		if _, ok := p.transport.RemoteAddr().(*net.UnixAddr); ok {
+			p.addr = net.JoinHostPort(na.IP.String(),
+				strconv.Itoa(int(na.Port)))
+		}
 	}
 
 	go func() {
@@ -2193,6 +2908,23 @@ func (p *Peer) AssociateConnection(conn net.Conn) {
 	}()
 }
 
+// Connect establishes the connection of an outbound peer to its address by way
+// of the passed dialer and associates it with the peer.  It is an alternative
+// to establishing the connection separately, such as via a connection manager,
+// and passing it to AssociateConnection.
+func (p *Peer) Connect(dial Dialer) error {
+	if p.inbound {
+		return errors.New("inbound peers can't be connected")
+	}
+
+	conn, err := dial("tcp", p.addr)
+	if err != nil {
+		return err
+	}
+	p.AssociateConnection(conn)
+	return nil
+}
+
 // WaitForDisconnect waits until the peer has completely disconnected and all
 // resources are cleaned up.  This will happen if either the local or remote
 // side has been disconnected or the peer is forcibly disconnected via
@@ -2222,6 +2954,11 @@ func newPeerBase(origCfg *Config, inbound bool) *Peer {
 		cfg.TrickleInterval = DefaultTrickleInterval
 	}
 
+	// Set the discourage threshold if it is not specified.
+	if cfg.DiscourageThreshold == 0 {
+		cfg.DiscourageThreshold = DefaultDiscourageThreshold
+	}
+
 	p := Peer{
 		inbound:         inbound,
 		wireEncoding:    wire.BaseEncoding,
@@ -2230,7 +2967,7 @@ func newPeerBase(origCfg *Config, inbound bool) *Peer {
 		outputQueue:     make(chan outMsg, outputBufferSize),
 		sendQueue:       make(chan outMsg, 1),   // nonblocking sync
 		sendDoneQueue:   make(chan struct{}, 1), // nonblocking sync
-		outputInvChan:   make(chan *wire.InvVect, outputBufferSize),
+		outputInvChan:   make(chan queuedInv, outputBufferSize),
 		inQuit:          make(chan struct{}),
 		queueQuit:       make(chan struct{}),
 		outQuit:         make(chan struct{}),
@@ -2238,6 +2975,15 @@ func newPeerBase(origCfg *Config, inbound bool) *Peer {
 		cfg:             cfg, // Copy so caller can't mutate.
 		services:        cfg.Services,
 		protocolVersion: cfg.ProtocolVersion,
+		capabilities:    wire.CapabilitiesForVersion(cfg.ProtocolVersion),
+		bandwidth:       NewBandwidthCounter(),
+		metrics:         newConnMetrics(),
+	}
+	if cfg.MaxUploadRate > 0 {
+		p.uploadLimiter = NewRateLimiter(cfg.MaxUploadRate)
+	}
+	if cfg.MaxDownloadRate > 0 {
+		p.downloadLimiter = NewRateLimiter(cfg.MaxDownloadRate)
 	}
 	return &p
 }
@@ -6,10 +6,13 @@
 package peer_test
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"net"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -154,6 +157,12 @@ func testPeer(t *testing.T, p *peer.Peer, s peerStats) {
 		return
 	}
 
+	wantCaps := wire.CapabilitiesForVersion(s.wantProtocolVersion)
+	if p.Capabilities() != wantCaps {
+		t.Errorf("testPeer: wrong Capabilities - got %v, want %v", p.Capabilities(), wantCaps)
+		return
+	}
+
 	if p.LastBlock() != s.wantLastBlock {
 		t.Errorf("testPeer: wrong LastBlock - got %v, want %v", p.LastBlock(), s.wantLastBlock)
 		return
@@ -606,6 +615,25 @@ func TestPeerListeners(t *testing.T) {
 			return
 		}
 	}
+
+	// Ensure the fee filter sent by the remote peer is tracked and that
+	// invalid fee filters are ignored.
+	if feeFilter := inPeer.FeeFilter(); feeFilter != 15000 {
+		t.Errorf("FeeFilter: wrong fee filter - got %v, want %v",
+			feeFilter, 15000)
+	}
+	outPeer.QueueMessage(wire.NewMsgFeeFilter(-1), nil)
+	select {
+	case <-ok:
+	case <-time.After(time.Second * 1):
+		t.Errorf("TestPeerListeners: OnFeeFilter timeout")
+		return
+	}
+	if feeFilter := inPeer.StatsSnapshot().FeeFilter; feeFilter != 15000 {
+		t.Errorf("StatsSnapshot: wrong fee filter - got %v, want %v",
+			feeFilter, 15000)
+	}
+
 	inPeer.Disconnect()
 	outPeer.Disconnect()
 }
@@ -917,6 +945,329 @@ func TestDuplicateVersionMsg(t *testing.T) {
 	}
 }
 
+// TestCompressionNegotiation ensures compression is only enabled when both
+// peers enable it and that compressed messages are transparently decompressed
+// by the receiving peer.
+func TestCompressionNegotiation(t *testing.T) {
+	tests := []struct {
+		name        string
+		inCompress  bool
+		outCompress bool
+		want        bool
+	}{
+		{"both", true, true, true},
+		{"inbound only", true, false, false},
+		{"outbound only", false, true, false},
+		{"neither", false, false, false},
+	}
+
+	for _, test := range tests {
+		verack := make(chan struct{}, 2)
+		cfilters := make(chan *wire.MsgCFilter, 1)
+		newCfg := func(compress bool) *peer.Config {
+			var services wire.ServiceFlag
+			if compress {
+				services |= wire.SFNodeCompression
+			}
+			return &peer.Config{
+				Listeners: peer.MessageListeners{
+					OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+						verack <- struct{}{}
+					},
+					OnCFilter: func(p *peer.Peer, msg *wire.MsgCFilter) {
+						cfilters <- msg
+					},
+				},
+				UserAgentName:    "peer",
+				UserAgentVersion: "1.0",
+				ChainParams:      &chaincfg.MainNetParams,
+				Services:         services,
+				Compression:      compress,
+			}
+		}
+
+		inConn, outConn := pipe(
+			&conn{laddr: "10.0.0.1:9108", raddr: "10.0.0.2:9108"},
+			&conn{laddr: "10.0.0.2:9108", raddr: "10.0.0.1:9108"},
+		)
+		outPeer, err := peer.NewOutboundPeer(newCfg(test.outCompress),
+			inConn.laddr)
+		if err != nil {
+			t.Fatalf("%s: NewOutboundPeer: unexpected err: %v", test.name,
+				err)
+		}
+		outPeer.AssociateConnection(outConn)
+		inPeer := peer.NewInboundPeer(newCfg(test.inCompress))
+		inPeer.AssociateConnection(inConn)
+
+		// Wait for the veracks from the initial protocol version
+		// negotiation.
+		for i := 0; i < 2; i++ {
+			select {
+			case <-verack:
+			case <-time.After(time.Second):
+				t.Fatalf("%s: verack timeout", test.name)
+			}
+		}
+
+		if got := inPeer.IsCompressionEnabled(); got != test.want {
+			t.Errorf("%s: inbound IsCompressionEnabled: got %v, want %v",
+				test.name, got, test.want)
+		}
+		if got := outPeer.IsCompressionEnabled(); got != test.want {
+			t.Errorf("%s: outbound IsCompressionEnabled: got %v, want %v",
+				test.name, got, test.want)
+		}
+
+		// Ensure a cfilter message sent by the outbound peer is received
+		// intact regardless of whether or not it was compressed.
+		filter := make([]byte, 1024)
+		msg := wire.NewMsgCFilter(wire.GCSFilterRegular, &chainhash.Hash{},
+			filter)
+		outPeer.QueueMessage(msg, nil)
+		select {
+		case got := <-cfilters:
+			if !bytes.Equal(got.Data, filter) {
+				t.Errorf("%s: received cfilter data mismatch",
+					test.name)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: cfilter timeout", test.name)
+		}
+
+		outPeer.Disconnect()
+		inPeer.Disconnect()
+		outPeer.WaitForDisconnect()
+		inPeer.WaitForDisconnect()
+	}
+}
+
+// TestCmpctBlockNegotiation ensures peers which support compact blocks signal
+// so to each other once the negotiation completes and that they are able to
+// switch each other to high-bandwidth mode and back.
+func TestCmpctBlockNegotiation(t *testing.T) {
+	verack := make(chan struct{}, 2)
+	sendCmpct := make(chan *wire.MsgSendCmpct, 2)
+	peerCfg := &peer.Config{
+		Listeners: peer.MessageListeners{
+			OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+				verack <- struct{}{}
+			},
+			OnSendCmpct: func(p *peer.Peer, msg *wire.MsgSendCmpct) {
+				sendCmpct <- msg
+			},
+		},
+		UserAgentName:     "peer",
+		UserAgentVersion:  "1.0",
+		ChainParams:       &chaincfg.MainNetParams,
+		CmpctBlockVersion: wire.CmpctBlockVersionWTxID,
+	}
+
+	inConn, outConn := pipe(
+		&conn{laddr: "10.0.0.1:9108", raddr: "10.0.0.2:9108"},
+		&conn{laddr: "10.0.0.2:9108", raddr: "10.0.0.1:9108"},
+	)
+	outPeer, err := peer.NewOutboundPeer(peerCfg, inConn.laddr)
+	if err != nil {
+		t.Fatalf("NewOutboundPeer: unexpected err: %v", err)
+	}
+	outPeer.AssociateConnection(outConn)
+	inPeer := peer.NewInboundPeer(peerCfg)
+	inPeer.AssociateConnection(inConn)
+
+	// waitSendCmpct waits for the next sendcmpct message and ensures it
+	// requests the passed mode.
+	waitSendCmpct := func(announce bool) {
+		t.Helper()
+		select {
+		case msg := <-sendCmpct:
+			if msg.AnnounceUsingCmpctBlock != announce {
+				t.Fatalf("sendcmpct announce: got %v, want %v",
+					msg.AnnounceUsingCmpctBlock, announce)
+			}
+			if msg.CmpctBlockVersion != wire.CmpctBlockVersionWTxID {
+				t.Fatalf("sendcmpct version: got %d, want %d",
+					msg.CmpctBlockVersion,
+					wire.CmpctBlockVersionWTxID)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("sendcmpct timeout")
+		}
+	}
+
+	// Both peers signal support in low-bandwidth mode after the veracks.
+	for i := 0; i < 2; i++ {
+		select {
+		case <-verack:
+		case <-time.After(time.Second):
+			t.Fatal("verack timeout")
+		}
+	}
+	waitSendCmpct(false)
+	waitSendCmpct(false)
+	for _, p := range []*peer.Peer{inPeer, outPeer} {
+		if got := p.CmpctBlockVersion(); got != wire.CmpctBlockVersionWTxID {
+			t.Errorf("%v: CmpctBlockVersion: got %d, want %d", p,
+				got, wire.CmpctBlockVersionWTxID)
+		}
+		if p.WantsCmpctBlocks() || p.IsCmpctHighBandwidth() {
+			t.Errorf("%v: unexpected high-bandwidth mode", p)
+		}
+	}
+
+	// Switch the inbound peer to high-bandwidth mode and back.
+	if !outPeer.SetCmpctHighBandwidth(true) {
+		t.Fatal("SetCmpctHighBandwidth: compact blocks not used")
+	}
+	waitSendCmpct(true)
+	if !inPeer.WantsCmpctBlocks() || !outPeer.IsCmpctHighBandwidth() {
+		t.Errorf("high-bandwidth mode was not enabled")
+	}
+	if !inPeer.StatsSnapshot().CmpctHBFrom ||
+		!outPeer.StatsSnapshot().CmpctHBTo {
+
+		t.Errorf("high-bandwidth mode is not reported by stats")
+	}
+	outPeer.SetCmpctHighBandwidth(false)
+	waitSendCmpct(false)
+	if inPeer.WantsCmpctBlocks() || outPeer.IsCmpctHighBandwidth() {
+		t.Errorf("high-bandwidth mode was not disabled")
+	}
+
+	outPeer.Disconnect()
+	inPeer.Disconnect()
+	outPeer.WaitForDisconnect()
+	inPeer.WaitForDisconnect()
+}
+
+// countingTransport wraps a transport and counts the messages written by way
+// of it.
+type countingTransport struct {
+	peer.Transport
+	written int32
+}
+
+// WriteMessage writes the passed message by way of the wrapped transport and
+// counts it.
+func (t *countingTransport) WriteMessage(msg wire.Message, pver uint32,
+	hdfnet wire.BitcoinNet, enc wire.MessageEncoding) (int, error) {
+
+	atomic.AddInt32(&t.written, 1)
+	return t.Transport.WriteMessage(msg, pver, hdfnet, enc)
+}
+
+// TestTransport ensures peers exchange their messages over the transports
+// created by the configured factory and that outbound peers are able to
+// establish their connections by way of a dialer.
+func TestTransport(t *testing.T) {
+	verack := make(chan struct{}, 2)
+	var transports []*countingTransport
+	var transportsMtx sync.Mutex
+	peerCfg := &peer.Config{
+		Listeners: peer.MessageListeners{
+			OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+				verack <- struct{}{}
+			},
+		},
+		UserAgentName:    "peer",
+		UserAgentVersion: "1.0",
+		ChainParams:      &chaincfg.MainNetParams,
+		NewTransport: func(c net.Conn, inbound bool) (peer.Transport, error) {
+			transport := &countingTransport{
+				Transport: peer.NewV1Transport(c, false),
+			}
+			transportsMtx.Lock()
+			transports = append(transports, transport)
+			transportsMtx.Unlock()
+			return transport, nil
+		},
+	}
+
+	inConn, outConn := pipe(
+		&conn{laddr: "10.0.0.1:9108", raddr: "10.0.0.2:9108"},
+		&conn{laddr: "10.0.0.2:9108", raddr: "10.0.0.1:9108"},
+	)
+	inPeer := peer.NewInboundPeer(peerCfg)
+	inPeer.AssociateConnection(inConn)
+	outPeer, err := peer.NewOutboundPeer(peerCfg, inConn.laddr)
+	if err != nil {
+		t.Fatalf("NewOutboundPeer: unexpected err: %v", err)
+	}
+
+	var dialed string
+	err = outPeer.Connect(func(network, address string) (net.Conn, error) {
+		dialed = address
+		return outConn, nil
+	})
+	if err != nil {
+		t.Fatalf("Connect: unexpected err: %v", err)
+	}
+	if dialed != inConn.laddr {
+		t.Fatalf("Connect: dialed %v, want %v", dialed, inConn.laddr)
+	}
+	if err := inPeer.Connect(nil); err == nil {
+		t.Fatal("Connect: inbound peer connected")
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-verack:
+		case <-time.After(time.Second):
+			t.Fatal("verack timeout")
+		}
+	}
+	transportsMtx.Lock()
+	if len(transports) != 2 {
+		t.Fatalf("created %d transports, want 2", len(transports))
+	}
+	for i, transport := range transports {
+		if atomic.LoadInt32(&transport.written) == 0 {
+			t.Errorf("transport %d: no messages written", i)
+		}
+	}
+	transportsMtx.Unlock()
+
+	outPeer.Disconnect()
+	inPeer.Disconnect()
+	outPeer.WaitForDisconnect()
+	inPeer.WaitForDisconnect()
+}
+
+// TestPriorityMessages ensures latency sensitive messages and block
+// announcements are sent in the priority lane of the output queue while bulk
+// data is not.
+func TestPriorityMessages(t *testing.T) {
+	t.Parallel()
+
+	blockInv := wire.NewMsgInv()
+	blockInv.AddInvVect(wire.NewInvVect(wire.InvTypeTx, &chainhash.Hash{}))
+	blockInv.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, &chainhash.Hash{}))
+	txInv := wire.NewMsgInv()
+	txInv.AddInvVect(wire.NewInvVect(wire.InvTypeTx, &chainhash.Hash{}))
+
+	tests := []struct {
+		name     string
+		msg      wire.Message
+		priority bool
+	}{
+		{"ping", wire.NewMsgPing(1), true},
+		{"pong", wire.NewMsgPong(1), true},
+		{"headers", wire.NewMsgHeaders(), true},
+		{"block inv", blockInv, true},
+		{"tx inv", txInv, false},
+		{"block", wire.NewMsgBlock(&wire.BlockHeader{}), false},
+		{"tx", wire.NewMsgTx(wire.TxVersion), false},
+		{"getdata", wire.NewMsgGetData(), false},
+	}
+	for _, test := range tests {
+		got := peer.TstIsPriorityMessage(test.msg)
+		if got != test.priority {
+			t.Errorf("%s: unexpected priority: got %v, want %v",
+				test.name, got, test.priority)
+		}
+	}
+}
+
 func init() {
 	// Allow self connection when running the tests.
 	peer.TstAllowSelfConns()
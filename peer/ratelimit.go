@@ -0,0 +1,166 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRateLimitBurst is the duration worth of bytes a rate limiter
+	// allows to be transferred at once after being idle when it is not
+	// given an explicit burst size.
+	DefaultRateLimitBurst = time.Second
+
+	// minRateLimitBurst is the minimum burst size of a rate limiter in
+	// bytes.  It ensures small messages are not throttled individually
+	// when the rate is very low.
+	minRateLimitBurst = 16 * 1024
+)
+
+// RateLimiterStats is a snapshot of the throttling performed by a RateLimiter.
+type RateLimiterStats struct {
+	// Rate is the maximum number of bytes per second, or 0 when the rate
+	// is not limited.
+	Rate int64
+
+	// ThrottledBytes is the total number of bytes whose transfer had to
+	// wait for the rate limit.
+	ThrottledBytes uint64
+
+	// ThrottledTime is the total time transfers waited for the rate limit.
+	ThrottledTime time.Duration
+}
+
+// RateLimiter limits the rate at which bytes are transferred by way of a token
+// bucket which is refilled at the configured rate up to the burst size.
+// Transfers take tokens after the fact, which may leave the bucket in debt, and
+// the next transfer waits until the debt is paid off.  This allows the rate to
+// be enforced without knowing the size of messages before they are read or
+// serialized.
+//
+// Each peer has a limiter for each direction when per-peer limits are
+// configured, and callers may share additional limiters between all peers to
+// enforce global limits.
+//
+// It is safe for concurrent access.
+type RateLimiter struct {
+	mtx            sync.Mutex
+	rate           float64
+	burst          float64
+	tokens         float64
+	last           time.Time
+	throttledBytes uint64
+	throttledTime  time.Duration
+	timeSource     func() time.Time
+}
+
+// NewRateLimiter returns a rate limiter which limits transfers to the passed
+// number of bytes per second.  A rate of 0 or less disables the limit.
+func NewRateLimiter(bytesPerSec int64) *RateLimiter {
+	r := &RateLimiter{timeSource: time.Now}
+	r.SetRate(bytesPerSec)
+	r.tokens = r.burst
+	return r
+}
+
+// SetRate changes the maximum number of bytes per second of the limiter.  A
+// rate of 0 or less disables the limit.
+//
+// This function is safe for concurrent access.
+func (r *RateLimiter) SetRate(bytesPerSec int64) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if bytesPerSec < 0 {
+		bytesPerSec = 0
+	}
+	r.refill(r.timeSource())
+	r.rate = float64(bytesPerSec)
+	r.burst = r.rate * DefaultRateLimitBurst.Seconds()
+	if r.burst < minRateLimitBurst {
+		r.burst = minRateLimitBurst
+	}
+	if r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+}
+
+// refill adds the tokens accumulated since the last refill up to the burst
+// size.
+//
+// This function MUST be called with the limiter lock held.
+func (r *RateLimiter) refill(now time.Time) {
+	if !r.last.IsZero() && now.After(r.last) {
+		r.tokens += now.Sub(r.last).Seconds() * r.rate
+		if r.tokens > r.burst {
+			r.tokens = r.burst
+		}
+	}
+	r.last = now
+}
+
+// reserve takes the passed number of tokens and returns how long the caller
+// must wait before the next transfer to honor the rate limit.
+//
+// This function is safe for concurrent access.
+func (r *RateLimiter) reserve(n int) time.Duration {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.rate == 0 || n <= 0 {
+		return 0
+	}
+	r.refill(r.timeSource())
+	r.tokens -= float64(n)
+	if r.tokens >= 0 {
+		return 0
+	}
+
+	wait := time.Duration(-r.tokens / r.rate * float64(time.Second))
+	r.throttledBytes += uint64(n)
+	r.throttledTime += wait
+	return wait
+}
+
+// Stats returns a snapshot of the throttling performed by the limiter.
+//
+// This function is safe for concurrent access.
+func (r *RateLimiter) Stats() RateLimiterStats {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	return RateLimiterStats{
+		Rate:           int64(r.rate),
+		ThrottledBytes: r.throttledBytes,
+		ThrottledTime:  r.throttledTime,
+	}
+}
+
+// waitForLimiters accounts for the passed number of bytes transferred with
+// each of the passed limiters and then waits until all of them allow the next
+// transfer or the passed quit channel is closed.  Nil limiters are ignored.
+func waitForLimiters(n int, quit <-chan struct{}, limiters ...*RateLimiter) {
+	var wait time.Duration
+	for _, limiter := range limiters {
+		if limiter == nil {
+			continue
+		}
+		if d := limiter.reserve(n); d > wait {
+			wait = d
+		}
+	}
+	if wait <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-quit:
+	}
+}
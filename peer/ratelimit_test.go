@@ -0,0 +1,90 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ifishnet/hdfd/peer"
+)
+
+// TestRateLimiter ensures the rate limiter allows bursts up to its burst size,
+// delays transfers once it is in debt for as long as it takes to pay it off,
+// and accounts for the throttled transfers.
+func TestRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1600000000, 0)
+	r := peer.NewRateLimiter(100000)
+	peer.TstSetRateLimiterTimeSource(r, func() time.Time { return now })
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		bytes   int
+		wait    time.Duration
+	}{
+		{"full burst", 0, 100000, 0},
+		{"into debt", 0, 50000, 500 * time.Millisecond},
+		{"debt paid off", time.Second, 50000, 0},
+		{"refilled up to burst", 10 * time.Second, 100000, 0},
+		{"empty transfer", 0, 0, 0},
+		{"partial refill", 250 * time.Millisecond, 50000, 250 * time.Millisecond},
+	}
+	var throttledBytes uint64
+	var throttledTime time.Duration
+	for _, test := range tests {
+		now = now.Add(test.advance)
+		wait := peer.TstReserve(r, test.bytes)
+		if wait != test.wait {
+			t.Fatalf("%s: got wait %v, want %v", test.name, wait,
+				test.wait)
+		}
+		if wait > 0 {
+			throttledBytes += uint64(test.bytes)
+			throttledTime += wait
+		}
+	}
+
+	stats := r.Stats()
+	if stats.Rate != 100000 {
+		t.Errorf("Rate: got %d, want %d", stats.Rate, 100000)
+	}
+	if stats.ThrottledBytes != throttledBytes {
+		t.Errorf("ThrottledBytes: got %d, want %d",
+			stats.ThrottledBytes, throttledBytes)
+	}
+	if stats.ThrottledTime != throttledTime {
+		t.Errorf("ThrottledTime: got %v, want %v", stats.ThrottledTime,
+			throttledTime)
+	}
+
+	// Removing the limit must no longer delay transfers.
+	r.SetRate(0)
+	if wait := peer.TstReserve(r, 1000000); wait != 0 {
+		t.Errorf("unlimited: got wait %v, want 0", wait)
+	}
+	if stats := r.Stats(); stats.Rate != 0 {
+		t.Errorf("unlimited: got rate %d, want 0", stats.Rate)
+	}
+}
+
+// TestRateLimiterMinBurst ensures very low rates still allow small messages to
+// be transferred without delay.
+func TestRateLimiterMinBurst(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1600000000, 0)
+	r := peer.NewRateLimiter(1000)
+	peer.TstSetRateLimiterTimeSource(r, func() time.Time { return now })
+
+	if wait := peer.TstReserve(r, 16*1024); wait != 0 {
+		t.Fatalf("got wait %v, want 0", wait)
+	}
+	if wait := peer.TstReserve(r, 500); wait != 500*time.Millisecond {
+		t.Fatalf("got wait %v, want %v", wait, 500*time.Millisecond)
+	}
+}
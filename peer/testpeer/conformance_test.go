@@ -0,0 +1,211 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package testpeer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfd/peer"
+	"github.com/ifishnet/hdfd/peer/testpeer"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// disconnectTimeout is how long the conformance tests wait for the peer under
+// test to disconnect a misbehaving fake peer.
+const disconnectTimeout = 2 * time.Second
+
+// TestConformance runs scripted message sequences against inbound and outbound
+// peers to ensure malformed, oversize, and out-of-order messages are rejected
+// and result in a disconnect while well-behaved but slow peers are kept.
+func TestConformance(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		inbound bool
+		script  testpeer.Script
+	}{{
+		name:    "well-behaved inbound peer",
+		inbound: true,
+		script: testpeer.Script{
+			testpeer.Handshake(),
+			testpeer.Send(wire.NewMsgPing(1)),
+			testpeer.Expect(wire.CmdPong),
+			testpeer.ExpectConnected(100 * time.Millisecond),
+		},
+	}, {
+		name: "well-behaved outbound peer",
+		script: testpeer.Script{
+			testpeer.Handshake(),
+			testpeer.Send(wire.NewMsgPing(1)),
+			testpeer.Expect(wire.CmdPong),
+			testpeer.ExpectConnected(100 * time.Millisecond),
+		},
+	}, {
+		name:    "stall mid-message",
+		inbound: true,
+		script: testpeer.Script{
+			testpeer.Handshake(),
+			testpeer.SendRaw(make([]byte, wire.MessageHeaderSize/2)),
+			testpeer.Stall(100 * time.Millisecond),
+			testpeer.ExpectConnected(100 * time.Millisecond),
+		},
+	}, {
+		name:    "verack before version",
+		inbound: true,
+		script: testpeer.Script{
+			testpeer.Send(wire.NewMsgVerAck()),
+			testpeer.ExpectReject(wire.CmdVersion, wire.RejectMalformed),
+			testpeer.ExpectDisconnect(disconnectTimeout),
+		},
+	}, {
+		name: "ping instead of verack",
+		script: testpeer.Script{
+			testpeer.SendVersion(),
+			testpeer.Expect(wire.CmdVersion),
+			testpeer.Send(wire.NewMsgPing(1)),
+			testpeer.ExpectReject(wire.CmdVerAck, wire.RejectMalformed),
+			testpeer.ExpectDisconnect(disconnectTimeout),
+		},
+	}, {
+		name:    "bad checksum during handshake",
+		inbound: true,
+		script: testpeer.Script{
+			testpeer.SendBadChecksum(wire.NewMsgVerAck()),
+			testpeer.ExpectDisconnect(disconnectTimeout),
+		},
+	}, {
+		name:    "bad checksum",
+		inbound: true,
+		script: testpeer.Script{
+			testpeer.Handshake(),
+			testpeer.SendBadChecksum(wire.NewMsgPing(1)),
+			testpeer.ExpectReject("malformed", wire.RejectMalformed),
+			testpeer.ExpectDisconnect(disconnectTimeout),
+		},
+	}, {
+		name:    "payload over the message limit",
+		inbound: true,
+		script: testpeer.Script{
+			testpeer.Handshake(),
+			testpeer.SendOversize(wire.CmdPing, wire.MaxMessagePayload+1),
+			testpeer.ExpectReject("malformed", wire.RejectMalformed),
+			testpeer.ExpectDisconnect(disconnectTimeout),
+		},
+	}, {
+		name: "payload over the command limit",
+		script: testpeer.Script{
+			testpeer.Handshake(),
+			testpeer.SendOversize(wire.CmdVerAck, 1),
+			testpeer.ExpectReject("malformed", wire.RejectMalformed),
+			testpeer.ExpectDisconnect(disconnectTimeout),
+		},
+	}, {
+		name:    "unknown command",
+		inbound: true,
+		script: testpeer.Script{
+			testpeer.Handshake(),
+			testpeer.SendPayload("bogus", nil),
+			testpeer.ExpectReject("malformed", wire.RejectMalformed),
+			testpeer.ExpectDisconnect(disconnectTimeout),
+		},
+	}, {
+		name:    "duplicate version",
+		inbound: true,
+		script: testpeer.Script{
+			testpeer.Handshake(),
+			testpeer.SendVersion(),
+			testpeer.ExpectReject(wire.CmdVersion, wire.RejectDuplicate),
+			testpeer.ExpectDisconnect(disconnectTimeout),
+		},
+	}}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			fp := testpeer.New(&testpeer.Config{
+				ChainParams: &chaincfg.MainNetParams,
+				Services:    wire.SFNodeNetwork | wire.SFNodeWitness,
+			})
+			defer fp.Close()
+
+			p := newPeerUnderTest(t, fp, test.inbound)
+			defer func() {
+				p.Disconnect()
+				p.WaitForDisconnect()
+			}()
+
+			if err := fp.Run(test.script); err != nil {
+				t.Fatalf("%v", err)
+			}
+		})
+	}
+}
+
+// TestDisconnectedPeerStopsProcessing ensures that a peer which disconnected
+// a misbehaving fake peer has shut down completely.
+func TestDisconnectedPeerStopsProcessing(t *testing.T) {
+	t.Parallel()
+
+	fp := testpeer.New(&testpeer.Config{
+		ChainParams: &chaincfg.MainNetParams,
+	})
+	defer fp.Close()
+
+	p := newPeerUnderTest(t, fp, true)
+	err := fp.Run(testpeer.Script{
+		testpeer.Handshake(),
+		testpeer.SendBadChecksum(wire.NewMsgPing(1)),
+		testpeer.ExpectDisconnect(disconnectTimeout),
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.WaitForDisconnect()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(disconnectTimeout):
+		t.Fatal("peer did not shut down after disconnecting")
+	}
+	if p.Connected() {
+		t.Fatal("peer reports being connected after disconnecting")
+	}
+}
+
+// newPeerUnderTest returns a peer of the requested direction which is
+// associated with the connection of the passed fake peer.
+func newPeerUnderTest(t *testing.T, fp *testpeer.FakePeer,
+	inbound bool) *peer.Peer {
+
+	cfg := &peer.Config{
+		UserAgentName:    "peer",
+		UserAgentVersion: "1.0",
+		ChainParams:      &chaincfg.MainNetParams,
+		Services:         wire.SFNodeNetwork | wire.SFNodeWitness,
+		TrickleInterval:  10 * time.Second,
+	}
+
+	var p *peer.Peer
+	if inbound {
+		p = peer.NewInboundPeer(cfg)
+	} else {
+		var err error
+		p, err = peer.NewOutboundPeer(cfg, testpeer.DefaultLocalAddr)
+		if err != nil {
+			t.Fatalf("NewOutboundPeer: unexpected err: %v", err)
+		}
+	}
+	p.AssociateConnection(fp.Conn())
+	return p
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package testpeer provides a scripted fake remote peer for exercising the wire
+protocol handling of peer.Peer instances.
+
+A FakePeer owns one end of an in-memory connection whose other end is handed
+to the peer under test via AssociateConnection.  Scripts made up of steps such
+as sending well-formed messages, sending raw bytes with bad checksums or
+oversize payloads, stalling, and expecting messages from or the disconnection
+of the peer under test are then run against it.  This allows the denial of
+service handling semantics of the peer package, for instance that a peer which
+sends a malformed message is rejected and disconnected, to be locked in by
+tests.
+
+Scripts
+
+A Script is a sequence of Steps which are run in order until one of them fails:
+
+	fp := testpeer.New(&testpeer.Config{ChainParams: &chaincfg.MainNetParams})
+	p := peer.NewInboundPeer(peerCfg)
+	p.AssociateConnection(fp.Conn())
+	err := fp.Run(testpeer.Script{
+		testpeer.SendVersion(),
+		testpeer.Expect(wire.CmdVersion),
+		testpeer.SendBadChecksum(wire.NewMsgVerAck()),
+		testpeer.ExpectReject("malformed", wire.RejectMalformed),
+		testpeer.ExpectDisconnect(time.Second),
+	})
+
+Messages received from the peer under test which a step is not waiting for are
+skipped, so scripts only need to name the messages they care about.  Steps
+which are not provided by this package can be written by implementing the Step
+interface.
+*/
+package testpeer
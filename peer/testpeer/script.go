@@ -0,0 +1,287 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package testpeer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// Step is a single action of a script run by a fake peer against a peer under
+// test.
+type Step interface {
+	// Run performs the step and returns an error when the peer under test
+	// did not behave as expected.
+	Run(fp *FakePeer) error
+
+	// String returns a human-readable description of the step which is
+	// used to identify it when it fails.
+	String() string
+}
+
+// Script is a sequence of steps which are run in order.  A script is itself a
+// step, so common sequences such as the one returned by Handshake can be
+// embedded in other scripts.
+type Script []Step
+
+// Run runs the steps of the script in order.
+//
+// This is part of the Step interface.
+func (s Script) Run(fp *FakePeer) error {
+	return fp.Run(s)
+}
+
+// String returns a human-readable description of the script.
+//
+// This is part of the Step interface.
+func (s Script) String() string {
+	return fmt.Sprintf("script of %d steps", len(s))
+}
+
+// stepFunc is a step implemented by a function.
+type stepFunc struct {
+	desc string
+	fn   func(fp *FakePeer) error
+}
+
+// Run calls the function of the step.
+//
+// This is part of the Step interface.
+func (s *stepFunc) Run(fp *FakePeer) error {
+	return s.fn(fp)
+}
+
+// String returns the description of the step.
+//
+// This is part of the Step interface.
+func (s *stepFunc) String() string {
+	return s.desc
+}
+
+// newStep returns a step with the passed description which runs the passed
+// function.
+func newStep(desc string, fn func(fp *FakePeer) error) Step {
+	return &stepFunc{desc: desc, fn: fn}
+}
+
+// Send returns a step which sends the passed message to the peer under test.
+func Send(msg wire.Message) Step {
+	return newStep("send "+msg.Command(), func(fp *FakePeer) error {
+		return fp.WriteMessage(msg)
+	})
+}
+
+// SendVersion returns a step which sends a version message advertising the
+// protocol version and services of the fake peer to the peer under test.
+func SendVersion() Step {
+	return newStep("send version", func(fp *FakePeer) error {
+		return fp.WriteMessage(fp.versionMsg())
+	})
+}
+
+// SendRaw returns a step which sends the passed bytes to the peer under test
+// as is.
+func SendRaw(b []byte) Step {
+	desc := fmt.Sprintf("send %d raw bytes", len(b))
+	return newStep(desc, func(fp *FakePeer) error {
+		return fp.WriteRaw(b)
+	})
+}
+
+// SendPayload returns a step which sends a message with the passed command and
+// raw payload to the peer under test.  The header of the message is valid, so
+// it can be used to send unknown commands or payloads which do not decode.
+func SendPayload(command string, payload []byte) Step {
+	desc := fmt.Sprintf("send %s with %d byte raw payload", command,
+		len(payload))
+	return newStep(desc, func(fp *FakePeer) error {
+		return fp.WriteRaw(fp.rawMessage(command, uint32(len(payload)),
+			payload))
+	})
+}
+
+// SendBadChecksum returns a step which sends the passed message to the peer
+// under test with an invalid payload checksum in its header.
+func SendBadChecksum(msg wire.Message) Step {
+	desc := fmt.Sprintf("send %s with bad checksum", msg.Command())
+	return newStep(desc, func(fp *FakePeer) error {
+		var buf bytes.Buffer
+		_, err := wire.WriteMessageWithEncodingN(&buf, msg,
+			fp.cfg.ProtocolVersion, fp.cfg.ChainParams.Net,
+			wire.LatestEncoding)
+		if err != nil {
+			return err
+		}
+
+		// The checksum is the last field of the header.
+		raw := buf.Bytes()
+		raw[wire.MessageHeaderSize-1] ^= 0xff
+		return fp.WriteRaw(raw)
+	})
+}
+
+// SendOversize returns a step which sends a message with the passed command to
+// the peer under test whose header announces a payload of the passed size.
+// The payload itself is made up of zeros and is only sent when the size does
+// not exceed wire.MaxMessagePayload, since larger payloads are rejected based
+// on the header alone.
+func SendOversize(command string, size uint32) Step {
+	desc := fmt.Sprintf("send %s with %d byte payload", command, size)
+	return newStep(desc, func(fp *FakePeer) error {
+		var payload []byte
+		if size <= wire.MaxMessagePayload {
+			payload = make([]byte, size)
+		}
+		return fp.WriteRaw(fp.rawMessage(command, size, payload))
+	})
+}
+
+// Stall returns a step which does nothing for the passed duration.
+func Stall(d time.Duration) Step {
+	return newStep("stall for "+d.String(), func(fp *FakePeer) error {
+		time.Sleep(d)
+		return nil
+	})
+}
+
+// Expect returns a step which waits up to DefaultTimeout for a message with
+// the passed command from the peer under test.  Other messages received in
+// the meantime are skipped.
+func Expect(command string) Step {
+	return ExpectFunc("expect "+command, func(msg wire.Message) bool {
+		return msg.Command() == command
+	})
+}
+
+// ExpectReject returns a step which waits up to DefaultTimeout for a reject
+// message for the passed command with the passed code from the peer under
+// test.  Other messages received in the meantime are skipped.
+func ExpectReject(command string, code wire.RejectCode) Step {
+	desc := fmt.Sprintf("expect reject %s (%v)", command, code)
+	return ExpectFunc(desc, func(msg wire.Message) bool {
+		reject, ok := msg.(*wire.MsgReject)
+		return ok && reject.Cmd == command && reject.Code == code
+	})
+}
+
+// ExpectFunc returns a step with the passed description which waits up to
+// DefaultTimeout for a message from the peer under test for which the passed
+// function returns true.  Other messages received in the meantime are
+// skipped.
+func ExpectFunc(desc string, match func(msg wire.Message) bool) Step {
+	return newStep(desc, func(fp *FakePeer) error {
+		deadline := time.Now().Add(DefaultTimeout)
+		for {
+			msg, err := fp.NextMessage(time.Until(deadline))
+			if err != nil {
+				return err
+			}
+			if match(msg) {
+				return nil
+			}
+		}
+	})
+}
+
+// ExpectDisconnect returns a step which waits up to the passed timeout for the
+// peer under test to close the connection.  Messages received in the meantime
+// are skipped.
+func ExpectDisconnect(timeout time.Duration) Step {
+	desc := "expect disconnect within " + timeout.String()
+	return newStep(desc, func(fp *FakePeer) error {
+		deadline := time.Now().Add(timeout)
+		for {
+			_, err := fp.NextMessage(time.Until(deadline))
+			if err == ErrDisconnected {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// ExpectConnected returns a step which fails when the peer under test closes
+// the connection within the passed duration.  Messages received in the
+// meantime are skipped.
+func ExpectConnected(d time.Duration) Step {
+	desc := "expect connected for " + d.String()
+	return newStep(desc, func(fp *FakePeer) error {
+		deadline := time.Now().Add(d)
+		for {
+			_, err := fp.NextMessage(time.Until(deadline))
+			if err == ErrTimeout {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// Handshake returns a script which completes the version handshake with the
+// peer under test regardless of whether it is the inbound or outbound side of
+// the connection.
+func Handshake() Script {
+	return Script{
+		SendVersion(),
+		Expect(wire.CmdVersion),
+		Send(wire.NewMsgVerAck()),
+		Expect(wire.CmdVerAck),
+	}
+}
+
+// versionMsg returns a version message advertising the protocol version and
+// services of the fake peer.
+func (fp *FakePeer) versionMsg() *wire.MsgVersion {
+	me := netAddress(fp.cfg.LocalAddr, fp.cfg.Services)
+	you := netAddress(fp.cfg.RemoteAddr, 0)
+	msg := wire.NewMsgVersion(me, you, rand.Uint64(), 0)
+	msg.ProtocolVersion = int32(fp.cfg.ProtocolVersion)
+	msg.Services = fp.cfg.Services
+	return msg
+}
+
+// rawMessage returns the serialized message with the passed command whose
+// header announces the passed payload length, followed by the passed payload.
+func (fp *FakePeer) rawMessage(command string, length uint32,
+	payload []byte) []byte {
+
+	var cmd [wire.CommandSize]byte
+	copy(cmd[:], command)
+
+	raw := make([]byte, wire.MessageHeaderSize, wire.MessageHeaderSize+
+		len(payload))
+	binary.LittleEndian.PutUint32(raw[0:4], uint32(fp.cfg.ChainParams.Net))
+	copy(raw[4:16], cmd[:])
+	binary.LittleEndian.PutUint32(raw[16:20], length)
+	copy(raw[20:24], chainhash.DoubleHashB(payload)[:4])
+	return append(raw, payload...)
+}
+
+// netAddress returns the network address for the passed host and port string,
+// which falls back to the unspecified address when it can't be parsed.
+func netAddress(hostPort string, services wire.ServiceFlag) *wire.NetAddress {
+	host, portStr, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return wire.NewNetAddressIPPort(net.IPv4zero, 0, services)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		ip = net.IPv4zero
+	}
+	port, _ := strconv.ParseUint(portStr, 10, 16)
+	return wire.NewNetAddressIPPort(ip, uint16(port), services)
+}
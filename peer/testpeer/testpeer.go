@@ -0,0 +1,286 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package testpeer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+const (
+	// DefaultLocalAddr is the address of the fake peer when none is
+	// configured.  It is intentionally not a loopback address since the
+	// peer package tolerates malformed messages from local peers on the
+	// regression test network.
+	DefaultLocalAddr = "10.0.0.2:8333"
+
+	// DefaultRemoteAddr is the address of the peer under test when none
+	// is configured.
+	DefaultRemoteAddr = "10.0.0.1:8333"
+
+	// DefaultTimeout is how long steps wait for the peer under test when
+	// they are not given a timeout.
+	DefaultTimeout = 5 * time.Second
+
+	// maxPendingMsgs is the maximum number of messages received from the
+	// peer under test which are buffered before the fake peer stops
+	// reading from the connection.
+	maxPendingMsgs = 100
+)
+
+var (
+	// ErrDisconnected is returned by steps which expect a message from the
+	// peer under test when it disconnected instead.
+	ErrDisconnected = errors.New("peer under test disconnected")
+
+	// ErrTimeout is returned by steps which wait for the peer under test
+	// when it did not respond in time.
+	ErrTimeout = errors.New("timeout waiting for peer under test")
+)
+
+// Config is the configuration of a fake peer.
+type Config struct {
+	// ChainParams identifies which chain parameters the fake peer is
+	// associated with.  It must be the same as the one of the peer under
+	// test.
+	ChainParams *chaincfg.Params
+
+	// ProtocolVersion is the protocol version used to encode and decode
+	// messages.  It defaults to wire.ProtocolVersion.
+	ProtocolVersion uint32
+
+	// Services are the services advertised by the version messages of the
+	// fake peer.
+	Services wire.ServiceFlag
+
+	// LocalAddr and RemoteAddr are the addresses of the fake peer and the
+	// peer under test, respectively.  They default to DefaultLocalAddr and
+	// DefaultRemoteAddr.
+	LocalAddr  string
+	RemoteAddr string
+}
+
+// FakePeer is a scripted remote peer connected to a peer under test by an
+// in-memory connection.
+type FakePeer struct {
+	cfg    Config
+	local  *conn
+	remote *conn
+
+	msgs chan wire.Message
+
+	// done is closed once reading from the peer under test stopped, in
+	// which case readErr holds the reason.
+	done    chan struct{}
+	readErr error
+
+	closeOnce sync.Once
+}
+
+// New returns a fake peer for the given configuration.  The connection
+// returned by Conn must be associated with the peer under test before a script
+// is run.
+func New(cfg *Config) *FakePeer {
+	fp := FakePeer{
+		cfg:  *cfg,
+		msgs: make(chan wire.Message, maxPendingMsgs),
+		done: make(chan struct{}),
+	}
+	if fp.cfg.ProtocolVersion == 0 {
+		fp.cfg.ProtocolVersion = wire.ProtocolVersion
+	}
+	if fp.cfg.LocalAddr == "" {
+		fp.cfg.LocalAddr = DefaultLocalAddr
+	}
+	if fp.cfg.RemoteAddr == "" {
+		fp.cfg.RemoteAddr = DefaultRemoteAddr
+	}
+	fp.local, fp.remote = newPipe(fp.cfg.LocalAddr, fp.cfg.RemoteAddr)
+
+	go fp.readHandler()
+	return &fp
+}
+
+// Conn returns the end of the connection to associate with the peer under
+// test.
+func (fp *FakePeer) Conn() net.Conn {
+	return fp.remote
+}
+
+// Close closes the connection from the side of the fake peer.
+func (fp *FakePeer) Close() {
+	fp.closeOnce.Do(func() {
+		fp.local.Close()
+	})
+}
+
+// StepError identifies the step of a script which failed along with the
+// reason.
+type StepError struct {
+	Index int
+	Step  Step
+	Err   error
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e *StepError) Error() string {
+	return fmt.Sprintf("step %d (%v): %v", e.Index, e.Step, e.Err)
+}
+
+// Run runs the steps of the passed script in order and returns a StepError for
+// the first step which fails.
+func (fp *FakePeer) Run(script Script) error {
+	for i, step := range script {
+		if err := step.Run(fp); err != nil {
+			return &StepError{Index: i, Step: step, Err: err}
+		}
+	}
+	return nil
+}
+
+// WriteMessage writes the passed message to the peer under test.
+func (fp *FakePeer) WriteMessage(msg wire.Message) error {
+	_, err := wire.WriteMessageWithEncodingN(fp.local, msg,
+		fp.cfg.ProtocolVersion, fp.cfg.ChainParams.Net,
+		wire.LatestEncoding)
+	return err
+}
+
+// WriteRaw writes the passed bytes to the peer under test as is.
+func (fp *FakePeer) WriteRaw(b []byte) error {
+	_, err := fp.local.Write(b)
+	return err
+}
+
+// NextMessage returns the next message received from the peer under test.
+// ErrDisconnected is returned when the peer under test disconnected before
+// sending one and ErrTimeout when it was not received within the passed
+// timeout.
+func (fp *FakePeer) NextMessage(timeout time.Duration) (wire.Message, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	// Drain the received messages before reporting a disconnect so the
+	// messages sent by the peer under test right before disconnecting,
+	// such as reject messages, are not lost.
+	select {
+	case msg := <-fp.msgs:
+		return msg, nil
+	default:
+	}
+	select {
+	case msg := <-fp.msgs:
+		return msg, nil
+	case <-fp.done:
+		select {
+		case msg := <-fp.msgs:
+			return msg, nil
+		default:
+		}
+		return nil, ErrDisconnected
+	case <-timer.C:
+		return nil, ErrTimeout
+	}
+}
+
+// Disconnected returns whether the peer under test closed the connection.
+func (fp *FakePeer) Disconnected() bool {
+	select {
+	case <-fp.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// ReadErr returns the error which stopped reading from the peer under test,
+// which is io.EOF or io.ErrClosedPipe when it closed the connection, or nil
+// while it is still connected.
+func (fp *FakePeer) ReadErr() error {
+	select {
+	case <-fp.done:
+		return fp.readErr
+	default:
+		return nil
+	}
+}
+
+// readHandler reads the messages sent by the peer under test until reading
+// fails, which is usually because it closed the connection.
+//
+// This must be run as a goroutine.
+func (fp *FakePeer) readHandler() {
+	for {
+		_, msg, _, err := wire.ReadMessageWithEncodingN(fp.local,
+			fp.cfg.ProtocolVersion, fp.cfg.ChainParams.Net,
+			wire.LatestEncoding)
+		if err != nil {
+			fp.readErr = err
+			close(fp.done)
+			return
+		}
+		fp.msgs <- msg
+	}
+}
+
+// conn is an in-memory network connection with fake addresses.
+type conn struct {
+	*io.PipeReader
+	*io.PipeWriter
+
+	laddr, raddr addr
+}
+
+// newPipe returns the two ends of a full-duplex in-memory connection between
+// the passed addresses.
+func newPipe(laddr, raddr string) (*conn, *conn) {
+	r1, w1 := io.Pipe()
+	r2, w2 := io.Pipe()
+	c1 := &conn{PipeReader: r1, PipeWriter: w2, laddr: addr(laddr),
+		raddr: addr(raddr)}
+	c2 := &conn{PipeReader: r2, PipeWriter: w1, laddr: addr(raddr),
+		raddr: addr(laddr)}
+	return c1, c2
+}
+
+// Read reads from the connection.
+func (c *conn) Read(b []byte) (int, error) {
+	return c.PipeReader.Read(b)
+}
+
+// Write writes to the connection.
+func (c *conn) Write(b []byte) (int, error) {
+	return c.PipeWriter.Write(b)
+}
+
+// Close closes both directions of the connection so that pending reads and
+// writes on either end fail.
+func (c *conn) Close() error {
+	c.PipeReader.Close()
+	return c.PipeWriter.Close()
+}
+
+// LocalAddr returns the local address of the connection.
+func (c *conn) LocalAddr() net.Addr { return c.laddr }
+
+// RemoteAddr returns the remote address of the connection.
+func (c *conn) RemoteAddr() net.Addr { return c.raddr }
+
+func (c *conn) SetDeadline(t time.Time) error      { return nil }
+func (c *conn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *conn) SetWriteDeadline(t time.Time) error { return nil }
+
+// addr is a fake TCP address.
+type addr string
+
+func (a addr) Network() string { return "tcp" }
+func (a addr) String() string  { return string(a) }
@@ -0,0 +1,117 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"net"
+
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// Transport exchanges the messages of a peer with the remote peer.  It
+// abstracts the connection of the peer so transports which change how messages
+// are framed on the wire, such as encrypted transports, can be used without
+// changes to the peer state machine.
+//
+// Implementations must allow ReadMessage and WriteMessage to be called
+// concurrently with each other, and Close to be called concurrently with both
+// in order to unblock them.
+type Transport interface {
+	// ReadMessage reads, validates, and parses the next message from the
+	// remote peer.  It returns the number of bytes read along with the
+	// message and its raw payload.
+	ReadMessage(pver uint32, hdfnet wire.BitcoinNet,
+		enc wire.MessageEncoding) (int, wire.Message, []byte, error)
+
+	// WriteMessage writes the passed message to the remote peer.  It
+	// returns the number of bytes written.
+	WriteMessage(msg wire.Message, pver uint32, hdfnet wire.BitcoinNet,
+		enc wire.MessageEncoding) (int, error)
+
+	// LocalAddr returns the local address of the underlying connection.
+	LocalAddr() net.Addr
+
+	// RemoteAddr returns the remote address of the underlying connection.
+	RemoteAddr() net.Addr
+
+	// Close closes the underlying connection.
+	Close() error
+}
+
+// TransportFactory returns the transport used to exchange messages over the
+// passed newly established connection of a peer.  Transports which perform a
+// handshake of their own typically do so before returning, and need to know
+// whether or not the connection is inbound to know which side of it to take.
+type TransportFactory func(conn net.Conn, inbound bool) (Transport, error)
+
+// Dialer establishes a connection to the passed address on the named network.
+// Its signature matches net.Dial, so connections can be routed through proxies,
+// such as Tor with stream isolation, or be replaced by in-memory pipes in tests.
+type Dialer func(network, address string) (net.Conn, error)
+
+// v1Transport is the unencrypted transport originally defined by the bitcoin
+// protocol.
+type v1Transport struct {
+	conn         net.Conn
+	skipChecksum bool
+}
+
+// Ensure v1Transport implements the Transport interface.
+var _ Transport = (*v1Transport)(nil)
+
+// NewV1Transport returns the unencrypted transport originally defined by the
+// bitcoin protocol over the passed connection, which frames each message with
+// a header made up of the network magic, command, payload length and checksum.
+// Checksums are neither calculated nor verified when skipChecksum is set, which
+// both ends of the connection must agree on.
+func NewV1Transport(conn net.Conn, skipChecksum bool) Transport {
+	return &v1Transport{conn: conn, skipChecksum: skipChecksum}
+}
+
+// ReadMessage reads, validates, and parses the next message from the remote
+// peer.
+//
+// This is part of the Transport interface implementation.
+func (t *v1Transport) ReadMessage(pver uint32, hdfnet wire.BitcoinNet,
+	enc wire.MessageEncoding) (int, wire.Message, []byte, error) {
+
+	if t.skipChecksum {
+		return wire.ReadMessageNoChecksumN(t.conn, pver, hdfnet, enc)
+	}
+	return wire.ReadMessageWithEncodingN(t.conn, pver, hdfnet, enc)
+}
+
+// WriteMessage writes the passed message to the remote peer.
+//
+// This is part of the Transport interface implementation.
+func (t *v1Transport) WriteMessage(msg wire.Message, pver uint32,
+	hdfnet wire.BitcoinNet, enc wire.MessageEncoding) (int, error) {
+
+	if t.skipChecksum {
+		return wire.WriteMessageNoChecksumN(t.conn, msg, pver, hdfnet, enc)
+	}
+	return wire.WriteMessageWithEncodingN(t.conn, msg, pver, hdfnet, enc)
+}
+
+// LocalAddr returns the local address of the underlying connection.
+//
+// This is part of the Transport interface implementation.
+func (t *v1Transport) LocalAddr() net.Addr {
+	return t.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote address of the underlying connection.
+//
+// This is part of the Transport interface implementation.
+func (t *v1Transport) RemoteAddr() net.Addr {
+	return t.conn.RemoteAddr()
+}
+
+// Close closes the underlying connection.
+//
+// This is part of the Transport interface implementation.
+func (t *v1Transport) Close() error {
+	return t.conn.Close()
+}
@@ -5,10 +5,12 @@
 package main
 
 import (
-	"sync/atomic"
+	"net"
+	"time"
 
 	"github.com/ifishnet/hdfd/blockchain"
 	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/connmgr"
 	"github.com/ifishnet/hdfd/mempool"
 	"github.com/ifishnet/hdfd/netsync"
 	"github.com/ifishnet/hdfd/peer"
@@ -43,22 +45,13 @@ func (p *rpcPeer) IsTxRelayDisabled() bool {
 	return (*serverPeer)(p).disableRelayTx
 }
 
-// BanScore returns the current integer value that represents how close the peer
-// is to being banned.
-//
-// This function is safe for concurrent access and is part of the rpcserverPeer
-// interface implementation.
-func (p *rpcPeer) BanScore() uint32 {
-	return (*serverPeer)(p).banScore.Int()
-}
-
 // FeeFilter returns the requested current minimum fee rate for which
 // transactions should be announced.
 //
 // This function is safe for concurrent access and is part of the rpcserverPeer
 // interface implementation.
 func (p *rpcPeer) FeeFilter() int64 {
-	return atomic.LoadInt64(&(*serverPeer)(p).feeFilter)
+	return (*serverPeer)(p).FeeFilter()
 }
 
 // rpcConnManager provides a connection manager for use with the RPC server and
@@ -164,6 +157,33 @@ func (cm *rpcConnManager) NetTotals() (uint64, uint64) {
 	return cm.server.NetTotals()
 }
 
+// BandwidthStats returns the bytes sent to and received from all peers per
+// message command along with the current send and receive rates.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) BandwidthStats() peer.BandwidthStats {
+	return cm.server.BandwidthStats()
+}
+
+// NetTargets returns the bytes sent and received during the current cycle
+// relative to the upload and download targets.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) NetTargets() (netTargetState, netTargetState) {
+	return cm.server.NetTargets()
+}
+
+// RateLimits returns the throttling performed by the upload and download rate
+// limits of all peers combined.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) RateLimits() (peer.RateLimiterStats, peer.RateLimiterStats) {
+	return cm.server.RateLimits()
+}
+
 // ConnectedPeers returns an array consisting of all connected peers.
 //
 // This function is safe for concurrent access and is part of the
@@ -223,6 +243,55 @@ func (cm *rpcConnManager) RelayTransactions(txns []*mempool.TxDesc) {
 	cm.server.relayTransactions(txns)
 }
 
+// PeerRotations returns the history of the outbound peers disconnected by the
+// periodic outbound peer rotation from oldest to newest.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) PeerRotations() []peerRotation {
+	return cm.server.PeerRotations()
+}
+
+// SetBan bans the provided subnet until the provided time and disconnects the
+// connected peers in it.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) SetBan(subnet *net.IPNet, expires time.Time) error {
+	err := cm.server.banManager.Ban(subnet, expires)
+	if n := cm.server.DisconnectBanned(); n > 0 {
+		srvrLog.Infof("Disconnected %d %s in banned subnet %s", n,
+			pickNoun(uint64(n), "peer", "peers"), subnet)
+	}
+	return err
+}
+
+// IsBanned returns whether the provided subnet has been banned.  Only bans of
+// that exact subnet are considered.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) IsBanned(subnet *net.IPNet) bool {
+	return cm.server.banManager.IsBanned(subnet)
+}
+
+// Unban removes the ban of the provided subnet and returns whether it was
+// banned.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) Unban(subnet *net.IPNet) (bool, error) {
+	return cm.server.banManager.Unban(subnet)
+}
+
+// ListBanned returns the bans which have not expired.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) ListBanned() []connmgr.Ban {
+	return cm.server.banManager.Bans()
+}
+
 // rpcSyncMgr provides a block manager for use with the RPC server and
 // implements the rpcserverSyncManager interface.
 type rpcSyncMgr struct {
@@ -275,5 +344,51 @@ func (b *rpcSyncMgr) SyncPeerID() int32 {
 // This function is safe for concurrent access and is part of the
 // rpcserverSyncManager interface implementation.
 func (b *rpcSyncMgr) LocateHeaders(locators []*chainhash.Hash, hashStop *chainhash.Hash) []wire.BlockHeader {
+	if headerChain := b.syncMgr.HeaderChain(); headerChain != nil {
+		return headerChain.LocateHeaders(locators, hashStop)
+	}
 	return b.server.chain.LocateHeaders(locators, hashStop)
 }
+
+// BestHeader returns the hash and height of the best header synced in
+// headers-only mode.  The final return value is false when the node is not in
+// headers-only mode.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverSyncManager interface implementation.
+func (b *rpcSyncMgr) BestHeader() (*chainhash.Hash, int32, bool) {
+	headerChain := b.syncMgr.HeaderChain()
+	if headerChain == nil {
+		return nil, 0, false
+	}
+	header, height := headerChain.BestHeader()
+	hash := header.BlockHash()
+	return &hash, height, true
+}
+
+// VerificationProgress returns an estimate between 0 and 1 of how much of the
+// chain has been validated.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverSyncManager interface implementation.
+func (b *rpcSyncMgr) VerificationProgress() float64 {
+	return b.syncMgr.SyncProgress().VerificationProgress
+}
+
+// SyncOptions returns the options of the sync manager which may be adjusted
+// while it is running.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverSyncManager interface implementation.
+func (b *rpcSyncMgr) SyncOptions() netsync.SyncOptions {
+	return b.syncMgr.SyncOptions()
+}
+
+// SetSyncOptions replaces the options of the sync manager with the provided
+// ones.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverSyncManager interface implementation.
+func (b *rpcSyncMgr) SetSyncOptions(opts *netsync.SyncOptions) error {
+	return b.syncMgr.SetSyncOptions(opts)
+}
@@ -0,0 +1,284 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpcclient
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ifishnet/hdfd/blockchain"
+	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// HeaderStore is an optional client-side store of the headers of the blocks in
+// the main chain of the node the client is connected to.  It is brought up to
+// date with the node via Sync, which fast-forwards it using the getheaders RPC,
+// and allows the height and hash of blocks in the main chain to be queried
+// without contacting the node.
+//
+// Each header is verified to connect to the previous one and to satisfy the
+// proof of work it claims, which is sufficient for SPV-style consumers to
+// detect a node serving headers that are not part of a real chain.  The
+// difficulty retargeting rules are not enforced.
+//
+// The store is held in memory and is safe for concurrent access.
+type HeaderStore struct {
+	client *Client
+	params *chaincfg.Params
+
+	// syncMtx ensures only a single sync is in progress at once.
+	syncMtx sync.Mutex
+
+	// mtx protects the fields below.  The headers and hashes are indexed by
+	// their height.
+	mtx     sync.RWMutex
+	headers []wire.BlockHeader
+	hashes  []chainhash.Hash
+	heights map[chainhash.Hash]int32
+}
+
+// NewHeaderStore returns a new header store which syncs headers from the node
+// the client is connected to.  It initially only contains the genesis block of
+// the network the client was configured for.
+//
+// NOTE: This is a hdfd extension since syncing relies on the getheaders RPC.
+func (c *Client) NewHeaderStore() *HeaderStore {
+	genesis := c.chainParams.GenesisBlock.Header
+	genesisHash := genesis.BlockHash()
+	return &HeaderStore{
+		client:  c,
+		params:  c.chainParams,
+		headers: []wire.BlockHeader{genesis},
+		hashes:  []chainhash.Hash{genesisHash},
+		heights: map[chainhash.Hash]int32{genesisHash: 0},
+	}
+}
+
+// checkHeaderWork ensures the passed header satisfies the proof of work it
+// claims and that its target does not exceed the proof of work limit of the
+// network.
+func (s *HeaderStore) checkHeaderWork(header *wire.BlockHeader, hash *chainhash.Hash) error {
+	target := blockchain.CompactToBig(header.Bits)
+	if target.Sign() <= 0 || target.Cmp(s.params.PowLimit) > 0 {
+		return fmt.Errorf("header %v has invalid target difficulty %064x",
+			hash, target)
+	}
+	if blockchain.HashToBig(hash).Cmp(target) > 0 {
+		return fmt.Errorf("header %v does not satisfy its target "+
+			"difficulty %064x", hash, target)
+	}
+	return nil
+}
+
+// connectHeaders verifies the passed headers and connects them to the store.
+// The first header must connect to a header in the store and any headers after
+// it are replaced, which handles reorganizations of the node's main chain.  It
+// returns the height of the header the first header connects to.
+//
+// This function MUST be called with the store lock held (for writes).
+func (s *HeaderStore) connectHeaders(headers []wire.BlockHeader) (int32, error) {
+	if len(headers) == 0 {
+		return int32(len(s.headers) - 1), nil
+	}
+
+	forkHeight, ok := s.heights[headers[0].PrevBlock]
+	if !ok {
+		return 0, fmt.Errorf("header %v does not connect to a known "+
+			"header", headers[0].BlockHash())
+	}
+
+	// Verify all headers before modifying the store so it remains intact
+	// when any of them are invalid.
+	hashes := make([]chainhash.Hash, len(headers))
+	prevHash := headers[0].PrevBlock
+	for i := range headers {
+		header := &headers[i]
+		hashes[i] = header.BlockHash()
+		if header.PrevBlock != prevHash {
+			return 0, fmt.Errorf("header %v does not connect to the "+
+				"previous header %v", hashes[i], prevHash)
+		}
+		if err := s.checkHeaderWork(header, &hashes[i]); err != nil {
+			return 0, err
+		}
+		prevHash = hashes[i]
+	}
+
+	// Remove the headers after the fork point and append the new ones.
+	for _, hash := range s.hashes[forkHeight+1:] {
+		delete(s.heights, hash)
+	}
+	s.headers = append(s.headers[:forkHeight+1], headers...)
+	s.hashes = append(s.hashes[:forkHeight+1], hashes...)
+	for i := range hashes {
+		s.heights[hashes[i]] = forkHeight + 1 + int32(i)
+	}
+	return forkHeight, nil
+}
+
+// locator returns a block locator for the tip of the store.  The hashes start
+// with the tip and go backwards with exponentially increasing steps after the
+// first ten, always ending with the genesis block.
+//
+// This function MUST be called with the store lock held (for reads).
+func (s *HeaderStore) locator() []chainhash.Hash {
+	var locator []chainhash.Hash
+	step := int32(1)
+	for height := int32(len(s.hashes) - 1); height > 0; height -= step {
+		locator = append(locator, s.hashes[height])
+		if len(locator) > 10 {
+			step *= 2
+		}
+	}
+	return append(locator, s.hashes[0])
+}
+
+// Sync brings the store up to date with the main chain of the node by
+// repeatedly requesting the headers after the tip of the store via the
+// getheaders RPC.  Headers which are no longer part of the main chain of the
+// node are replaced.
+//
+// It returns the height of the last header that was already part of the store
+// and remains in the main chain, so consumers are able to replay the blocks
+// after it instead of everything they might have missed while disconnected.
+//
+// NOTE: This is a hdfd extension.
+func (s *HeaderStore) Sync() (int32, error) {
+	s.syncMtx.Lock()
+	defer s.syncMtx.Unlock()
+
+	s.mtx.RLock()
+	forkHeight := int32(len(s.headers) - 1)
+	s.mtx.RUnlock()
+	for {
+		s.mtx.RLock()
+		locator := s.locator()
+		s.mtx.RUnlock()
+
+		headers, err := s.client.GetHeaders(locator, nil)
+		if err != nil {
+			return 0, err
+		}
+
+		s.mtx.Lock()
+		height, err := s.connectHeaders(headers)
+		s.mtx.Unlock()
+		if err != nil {
+			return 0, err
+		}
+		if height < forkHeight {
+			forkHeight = height
+		}
+
+		// The node only returns fewer headers than the maximum allowed
+		// per message once the end of its main chain is reached.  The
+		// case where no headers are returned is handled below.
+		if len(headers) == 0 {
+			break
+		}
+		if len(headers) < wire.MaxBlockHeadersPerMsg {
+			return forkHeight, nil
+		}
+	}
+
+	// No headers are returned when the tip of the node is part of the
+	// locator, which includes the case where the main chain of the node
+	// was reorganized to a chain with fewer blocks than the store, so
+	// remove any headers after its tip.
+	bestHash, err := s.client.GetBestBlockHash()
+	if err != nil {
+		return 0, err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	height, ok := s.heights[*bestHash]
+	if !ok {
+		return 0, fmt.Errorf("best block %v of the node does not "+
+			"connect to a known header", bestHash)
+	}
+	for _, hash := range s.hashes[height+1:] {
+		delete(s.heights, hash)
+	}
+	s.headers = s.headers[:height+1]
+	s.hashes = s.hashes[:height+1]
+	if height < forkHeight {
+		forkHeight = height
+	}
+	return forkHeight, nil
+}
+
+// Tip returns the hash and height of the last header in the store.
+func (s *HeaderStore) Tip() (chainhash.Hash, int32) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	height := len(s.hashes) - 1
+	return s.hashes[height], int32(height)
+}
+
+// HeaderByHeight returns the header at the passed height in the store.
+func (s *HeaderStore) HeaderByHeight(height int32) (*wire.BlockHeader, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if height < 0 || height >= int32(len(s.headers)) {
+		return nil, fmt.Errorf("no header at height %d", height)
+	}
+	header := s.headers[height]
+	return &header, nil
+}
+
+// HeaderByHash returns the header with the passed hash in the store.
+func (s *HeaderStore) HeaderByHash(hash *chainhash.Hash) (*wire.BlockHeader, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	height, ok := s.heights[*hash]
+	if !ok {
+		return nil, fmt.Errorf("no header with hash %v", hash)
+	}
+	header := s.headers[height]
+	return &header, nil
+}
+
+// HashByHeight returns the hash of the header at the passed height in the
+// store.
+func (s *HeaderStore) HashByHeight(height int32) (*chainhash.Hash, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if height < 0 || height >= int32(len(s.hashes)) {
+		return nil, fmt.Errorf("no header at height %d", height)
+	}
+	hash := s.hashes[height]
+	return &hash, nil
+}
+
+// HeightByHash returns the height of the header with the passed hash in the
+// store.
+func (s *HeaderStore) HeightByHash(hash *chainhash.Hash) (int32, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	height, ok := s.heights[*hash]
+	if !ok {
+		return 0, fmt.Errorf("no header with hash %v", hash)
+	}
+	return height, nil
+}
+
+// ConnectHeader adds the header of a block connected to the main chain of the
+// node, such as one received via a block connected notification, to the store
+// without contacting the node.  The header must extend a header in the store
+// and any headers after the one it extends are replaced.
+func (s *HeaderStore) ConnectHeader(header *wire.BlockHeader) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	_, err := s.connectHeaders([]wire.BlockHeader{*header})
+	return err
+}
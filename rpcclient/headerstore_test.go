@@ -0,0 +1,121 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpcclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ifishnet/hdfd/blockchain"
+	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// solveHeaders returns a chain of the passed number of headers extending the
+// header with the passed hash that satisfy the regression test network proof
+// of work.  The passed id is used to make the headers of different chains
+// unique.
+func solveHeaders(prevHash chainhash.Hash, num int, id uint32) []wire.BlockHeader {
+	params := &chaincfg.RegressionNetParams
+	target := blockchain.CompactToBig(params.PowLimitBits)
+	headers := make([]wire.BlockHeader, 0, num)
+	for i := 0; i < num; i++ {
+		header := wire.BlockHeader{
+			Version:   int32(id),
+			PrevBlock: prevHash,
+			Timestamp: time.Unix(1600000000+int64(i), 0),
+			Bits:      params.PowLimitBits,
+		}
+		for {
+			hash := header.BlockHash()
+			if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+				break
+			}
+			header.Nonce++
+		}
+		headers = append(headers, header)
+		prevHash = header.BlockHash()
+	}
+	return headers
+}
+
+// TestHeaderStore ensures headers are verified and connected to the header
+// store, including when they replace headers after a fork point.
+func TestHeaderStore(t *testing.T) {
+	t.Parallel()
+
+	client := &Client{chainParams: &chaincfg.RegressionNetParams}
+	store := client.NewHeaderStore()
+	genesisHash := *chaincfg.RegressionNetParams.GenesisHash
+
+	// Ensure a chain of headers extending the genesis block is connected.
+	mainChain := solveHeaders(genesisHash, 20, 1)
+	forkHeight, err := store.connectHeaders(mainChain)
+	if err != nil {
+		t.Fatalf("connectHeaders: unexpected error: %v", err)
+	}
+	if forkHeight != 0 {
+		t.Fatalf("connectHeaders: unexpected fork height %d", forkHeight)
+	}
+	tipHash, tipHeight := store.Tip()
+	if tipHash != mainChain[19].BlockHash() || tipHeight != 20 {
+		t.Fatalf("Tip: unexpected tip %v (height %d)", tipHash,
+			tipHeight)
+	}
+	hash10 := mainChain[9].BlockHash()
+	if height, err := store.HeightByHash(&hash10); err != nil ||
+		height != 10 {
+
+		t.Fatalf("HeightByHash: unexpected height %d (err %v)", height,
+			err)
+	}
+
+	// Ensure the locator starts with the tip and ends with the genesis
+	// block.
+	locator := store.locator()
+	if locator[0] != tipHash || locator[len(locator)-1] != genesisHash {
+		t.Fatalf("locator: unexpected locator %v", locator)
+	}
+
+	// Ensure headers which do not connect or do not satisfy the proof of
+	// work are rejected without modifying the store.
+	orphan := solveHeaders(chainhash.Hash{0x01}, 1, 2)
+	if _, err := store.connectHeaders(orphan); err == nil {
+		t.Fatal("connectHeaders: accepted header that does not connect")
+	}
+	badWork := solveHeaders(tipHash, 1, 2)
+	badWork[0].Bits = 0x1d00ffff
+	if err := store.ConnectHeader(&badWork[0]); err == nil {
+		t.Fatal("ConnectHeader: accepted header with insufficient work")
+	}
+	if _, height := store.Tip(); height != 20 {
+		t.Fatalf("Tip: store modified by rejected headers (height %d)",
+			height)
+	}
+
+	// Ensure a fork from height 15 replaces the headers after it.
+	sideChain := solveHeaders(mainChain[14].BlockHash(), 3, 3)
+	forkHeight, err = store.connectHeaders(sideChain)
+	if err != nil {
+		t.Fatalf("connectHeaders: unexpected error: %v", err)
+	}
+	if forkHeight != 15 {
+		t.Fatalf("connectHeaders: unexpected fork height %d", forkHeight)
+	}
+	tipHash, tipHeight = store.Tip()
+	if tipHash != sideChain[2].BlockHash() || tipHeight != 18 {
+		t.Fatalf("Tip: unexpected tip %v (height %d)", tipHash,
+			tipHeight)
+	}
+	replacedHash := mainChain[19].BlockHash()
+	if _, err := store.HeaderByHash(&replacedHash); err == nil {
+		t.Fatal("HeaderByHash: replaced header still in store")
+	}
+	hash, err := store.HashByHeight(16)
+	if err != nil || *hash != sideChain[0].BlockHash() {
+		t.Fatalf("HashByHeight: unexpected hash %v (err %v)", hash, err)
+	}
+}
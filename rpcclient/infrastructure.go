@@ -160,6 +160,11 @@ type Client struct {
 	// mtx is a mutex to protect access to connection related fields.
 	mtx sync.Mutex
 
+	// authMtx protects the credentials in the connection configuration
+	// since they may be updated via UpdateCredentials while requests are
+	// being sent.
+	authMtx sync.Mutex
+
 	// disconnected indicated whether or not the server is disconnected.
 	disconnected bool
 
@@ -662,7 +667,7 @@ out:
 			default:
 			}
 
-			wsConn, err := dial(c.config)
+			wsConn, err := c.dial()
 			if err != nil {
 				c.retryCount++
 				log.Infof("Failed to connect to %s: %v",
@@ -852,7 +857,7 @@ func (c *Client) sendPost(jReq *jsonRequest) {
 	httpReq.Header.Set("Content-Type", "application/json")
 
 	// Configure basic access authorization.
-	user, pass, err := c.config.getAuth()
+	user, pass, err := c.getAuth()
 	if err != nil {
 		jReq.responseChan <- &response{result: nil, err: err}
 		return
@@ -1203,6 +1208,40 @@ func (config *ConnConfig) retrieveCookie() (username, passphrase string, err err
 	return config.cookieLastUser, config.cookieLastPass, config.cookieLastErr
 }
 
+// getAuth returns the username and passphrase that will actually be used to
+// authenticate to the RPC server.  See ConnConfig.getAuth for details.
+//
+// This function is safe for concurrent access.
+func (c *Client) getAuth() (username, passphrase string, err error) {
+	c.authMtx.Lock()
+	defer c.authMtx.Unlock()
+
+	return c.config.getAuth()
+}
+
+// UpdateCredentials updates the username and passphrase used to authenticate
+// to the RPC server without disconnecting the client, which allows the
+// credentials to be rotated while the client is in use.  Passing an empty
+// passphrase causes the cookie file to be used instead when one is configured.
+//
+// Requests that are already in flight are not affected.  When running in HTTP
+// POST mode, the new credentials are used for all subsequent requests.  When
+// using websockets, the current session remains authenticated since the RPC
+// server only authenticates a websocket connection once when it is
+// established, and the new credentials are used the next time the connection
+// is established, such as when the client automatically reconnects.  Pending
+// requests are resent over the new connection as usual.
+//
+// This function is safe for concurrent access.
+func (c *Client) UpdateCredentials(user, pass string) {
+	c.authMtx.Lock()
+	c.config.User = user
+	c.config.Pass = pass
+	c.authMtx.Unlock()
+
+	log.Debugf("Updated credentials for RPC server %s", c.config.Host)
+}
+
 // newHTTPClient returns a new http client that is configured according to the
 // proxy and TLS settings in the associated connection configuration.
 func newHTTPClient(config *ConnConfig) (*http.Client, error) {
@@ -1239,8 +1278,8 @@ func newHTTPClient(config *ConnConfig) (*http.Client, error) {
 }
 
 // dial opens a websocket connection using the passed connection configuration
-// details.
-func dial(config *ConnConfig) (*websocket.Conn, error) {
+// details and credentials.
+func dial(config *ConnConfig, user, pass string) (*websocket.Conn, error) {
 	// Setup TLS if not disabled.
 	var tlsConfig *tls.Config
 	var scheme = "ws"
@@ -1272,10 +1311,6 @@ func dial(config *ConnConfig) (*websocket.Conn, error) {
 
 	// The RPC server requires basic authorization, so create a custom
 	// request header with the Authorization header set.
-	user, pass, err := config.getAuth()
-	if err != nil {
-		return nil, err
-	}
 	login := user + ":" + pass
 	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
 	requestHeader := make(http.Header)
@@ -1309,6 +1344,16 @@ func dial(config *ConnConfig) (*websocket.Conn, error) {
 	return wsConn, nil
 }
 
+// dial opens a websocket connection to the RPC server using the connection
+// configuration and current credentials of the client.
+func (c *Client) dial() (*websocket.Conn, error) {
+	user, pass, err := c.getAuth()
+	if err != nil {
+		return nil, err
+	}
+	return dial(c.config, user, pass)
+}
+
 // New creates a new RPC client based on the provided connection configuration
 // details.  The notification handlers parameter may be nil if you are not
 // interested in receiving notifications and will be ignored if the
@@ -1332,8 +1377,11 @@ func New(config *ConnConfig, ntfnHandlers *NotificationHandlers) (*Client, error
 		}
 	} else {
 		if !config.DisableConnectOnNew {
-			var err error
-			wsConn, err = dial(config)
+			user, pass, err := config.getAuth()
+			if err != nil {
+				return nil, err
+			}
+			wsConn, err = dial(config, user, pass)
 			if err != nil {
 				return nil, err
 			}
@@ -1415,7 +1463,7 @@ func (c *Client) Connect(tries int) error {
 	var backoff time.Duration
 	for i := 0; tries == 0 || i < tries; i++ {
 		var wsConn *websocket.Conn
-		wsConn, err = dial(c.config)
+		wsConn, err = c.dial()
 		if err != nil {
 			backoff = connectionRetryInterval * time.Duration(i+1)
 			if backoff > time.Minute {
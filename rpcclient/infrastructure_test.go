@@ -0,0 +1,40 @@
+package rpcclient
+
+import "testing"
+
+// TestUpdateCredentials ensures the credentials used to authenticate to the
+// RPC server are updated by UpdateCredentials.
+func TestUpdateCredentials(t *testing.T) {
+	t.Parallel()
+
+	client, err := New(&ConnConfig{
+		Host:         "localhost:8334",
+		User:         "user",
+		Pass:         "pass",
+		HTTPPostMode: true,
+		DisableTLS:   true,
+	}, nil)
+	if err != nil {
+		t.Fatalf("unable to create client: %v", err)
+	}
+	defer client.Shutdown()
+
+	user, pass, err := client.getAuth()
+	if err != nil {
+		t.Fatalf("unable to get credentials: %v", err)
+	}
+	if user != "user" || pass != "pass" {
+		t.Fatalf("unexpected credentials -- got %s:%s, want user:pass",
+			user, pass)
+	}
+
+	client.UpdateCredentials("newuser", "newpass")
+	user, pass, err = client.getAuth()
+	if err != nil {
+		t.Fatalf("unable to get credentials: %v", err)
+	}
+	if user != "newuser" || pass != "newpass" {
+		t.Fatalf("unexpected credentials -- got %s:%s, want "+
+			"newuser:newpass", user, pass)
+	}
+}
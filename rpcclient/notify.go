@@ -179,6 +179,13 @@ type NotificationHandlers struct {
 	// made to register for the notification and the function is non-nil.
 	OnTxAcceptedVerbose func(txDetails *hdfjson.TxRawResult)
 
+	// OnTxReplaced is invoked when a transaction is evicted from the
+	// memory pool because it was replaced through the Replace-By-Fee (RBF)
+	// policy.  It will only be invoked if a preceding call to
+	// NotifyNewTransactions has been made to register for the
+	// notification and the function is non-nil.
+	OnTxReplaced func(replaced, replacement *chainhash.Hash)
+
 	// OnHdfdConnected is invoked when a wallet connects or disconnects from
 	// hdfd.
 	//
@@ -409,6 +416,23 @@ func (c *Client) handleNotification(ntfn *rawNotification) {
 
 		c.ntfnHandlers.OnTxAcceptedVerbose(rawTx)
 
+	// OnTxReplaced
+	case hdfjson.TxReplacedNtfnMethod:
+		// Ignore the notification if the client is not interested in
+		// it.
+		if c.ntfnHandlers.OnTxReplaced == nil {
+			return
+		}
+
+		replaced, replacement, err := parseTxReplacedNtfnParams(ntfn.Params)
+		if err != nil {
+			log.Warnf("Received invalid tx replaced "+
+				"notification: %v", err)
+			return
+		}
+
+		c.ntfnHandlers.OnTxReplaced(replaced, replacement)
+
 	// OnHdfdConnected
 	case hdfjson.HdfdConnectedNtfnMethod:
 		// Ignore the notification if the client is not interested in
@@ -484,11 +508,13 @@ func (e wrongNumParams) Error() string {
 }
 
 // parseChainNtfnParams parses out the block hash and height from the parameters
-// of blockconnected and blockdisconnected notifications.
+// of blockconnected and blockdisconnected notifications.  The optional
+// trailing sequence number sent to clients that requested sequenced
+// notifications is ignored.
 func parseChainNtfnParams(params []json.RawMessage) (*chainhash.Hash,
 	int32, time.Time, error) {
 
-	if len(params) != 3 {
+	if len(params) != 3 && len(params) != 4 {
 		return nil, 0, time.Time{}, wrongNumParams(len(params))
 	}
 
@@ -716,11 +742,12 @@ func parseRescanProgressParams(params []json.RawMessage) (*chainhash.Hash, int32
 }
 
 // parseTxAcceptedNtfnParams parses out the transaction hash and total amount
-// from the parameters of a txaccepted notification.
+// from the parameters of a txaccepted notification.  The optional trailing
+// sequence number is ignored.
 func parseTxAcceptedNtfnParams(params []json.RawMessage) (*chainhash.Hash,
 	hdfutil.Amount, error) {
 
-	if len(params) != 2 {
+	if len(params) != 2 && len(params) != 3 {
 		return nil, 0, wrongNumParams(len(params))
 	}
 
@@ -753,12 +780,46 @@ func parseTxAcceptedNtfnParams(params []json.RawMessage) (*chainhash.Hash,
 	return txHash, amt, nil
 }
 
+// parseTxReplacedNtfnParams parses out the hashes of the replaced and the
+// replacement transaction from the parameters of a txreplaced notification.
+func parseTxReplacedNtfnParams(params []json.RawMessage) (*chainhash.Hash,
+	*chainhash.Hash, error) {
+
+	if len(params) != 2 {
+		return nil, nil, wrongNumParams(len(params))
+	}
+
+	// Unmarshal both parameters as strings.
+	var replacedStr, replacementStr string
+	err := json.Unmarshal(params[0], &replacedStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = json.Unmarshal(params[1], &replacementStr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Decode string encodings of the transaction hashes.
+	replaced, err := chainhash.NewHashFromStr(replacedStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	replacement, err := chainhash.NewHashFromStr(replacementStr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return replaced, replacement, nil
+}
+
 // parseTxAcceptedVerboseNtfnParams parses out details about a raw transaction
-// from the parameters of a txacceptedverbose notification.
+// from the parameters of a txacceptedverbose notification.  The optional
+// trailing sequence number is ignored.
 func parseTxAcceptedVerboseNtfnParams(params []json.RawMessage) (*hdfjson.TxRawResult,
 	error) {
 
-	if len(params) != 1 {
+	if len(params) != 1 && len(params) != 2 {
 		return nil, wrongNumParams(len(params))
 	}
 
@@ -884,7 +945,7 @@ func (c *Client) NotifyBlocksAsync() FutureNotifyBlocksResult {
 		return newNilFutureResult()
 	}
 
-	cmd := hdfjson.NewNotifyBlocksCmd()
+	cmd := hdfjson.NewNotifyBlocksCmd(nil)
 	return c.sendCmd(cmd)
 }
 
@@ -1342,7 +1403,7 @@ func (c *Client) LoadTxFilterAsync(reload bool, addresses []hdfutil.Address,
 		}
 	}
 
-	cmd := hdfjson.NewLoadTxFilterCmd(reload, addrStrs, outPointObjects)
+	cmd := hdfjson.NewLoadTxFilterCmd(reload, addrStrs, outPointObjects, nil)
 	return c.sendCmd(cmd)
 }
 
@@ -739,3 +739,22 @@ func (c *Client) DecodeScriptAsync(serializedScript []byte) FutureDecodeScriptRe
 func (c *Client) DecodeScript(serializedScript []byte) (*hdfjson.DecodeScriptResult, error) {
 	return c.DecodeScriptAsync(serializedScript).Receive()
 }
+
+// DecodeScriptTraceAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See DecodeScriptTrace for the blocking version and more details.
+func (c *Client) DecodeScriptTraceAsync(serializedScript []byte) FutureDecodeScriptResult {
+	scriptHex := hex.EncodeToString(serializedScript)
+	cmd := hdfjson.NewDecodeScriptCmdWithVerbosity(scriptHex, hdfjson.Int(1))
+	return c.sendCmd(cmd)
+}
+
+// DecodeScriptTrace returns information about a script given its serialized
+// bytes along with the trace of executing it on its own.
+//
+// NOTE: This is a hdfd extension.
+func (c *Client) DecodeScriptTrace(serializedScript []byte) (*hdfjson.DecodeScriptResult, error) {
+	return c.DecodeScriptTraceAsync(serializedScript).Receive()
+}
@@ -0,0 +1,612 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpcclient
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfd/coinselect"
+	"github.com/ifishnet/hdfd/hdfjson"
+	"github.com/ifishnet/hdfd/txscript"
+	"github.com/ifishnet/hdfd/wire"
+	"github.com/ifishnet/hdfutil"
+)
+
+const (
+	// defaultLongTermFeeRate is the default fee rate in satoshi per 1000
+	// virtual bytes unspent outputs are expected to be spent at otherwise.
+	defaultLongTermFeeRate = hdfutil.Amount(10000)
+
+	// defaultMinRelayTxFee is the minimum relay fee in satoshi per 1000
+	// bytes used to determine the default minimum change.
+	defaultMinRelayTxFee = hdfutil.Amount(1000)
+
+	// maxSigSize is the maximum size of a DER encoded ECDSA signature with
+	// a low S value, including the appended signature hash type.
+	maxSigSize = 72
+
+	// witnessScaleFactor is the factor by which non-witness data counts
+	// more towards the weight of a transaction than witness data.
+	witnessScaleFactor = 4
+)
+
+// ErrNoChangeAddress is returned by CreateFundedRawTransaction when the funding
+// requires a change output but no change address was provided.
+var ErrNoChangeAddress = errors.New("no change address provided")
+
+// UnspentOutput is an unspent transaction output which may be used to fund and
+// is needed to sign raw transactions.
+type UnspentOutput struct {
+	// OutPoint is the outpoint of the output.
+	OutPoint wire.OutPoint
+
+	// Amount is the value of the output.
+	Amount hdfutil.Amount
+
+	// PkScript is the public key script of the output.
+	PkScript []byte
+
+	// RedeemScript is the redeem script of a pay-to-script-hash output,
+	// which may be a witness program for nested segwit outputs.
+	RedeemScript []byte
+
+	// WitnessScript is the witness script of a pay-to-witness-script-hash
+	// output, including one nested in a pay-to-script-hash output.
+	WitnessScript []byte
+}
+
+// UTXOSource is the interface which provides the unspent outputs used to fund
+// raw transactions.
+type UTXOSource interface {
+	// UnspentOutputs returns the unspent outputs which may be spent.
+	UnspentOutputs() ([]*UnspentOutput, error)
+}
+
+// UTXOClosure implements UTXOSource with a closure.
+type UTXOClosure func() ([]*UnspentOutput, error)
+
+// UnspentOutputs implements UTXOSource by returning the result of calling the
+// closure.
+func (c UTXOClosure) UnspentOutputs() ([]*UnspentOutput, error) {
+	return c()
+}
+
+// RawTxFundingOpts are the options used to fund raw transactions with
+// CreateFundedRawTransaction.
+type RawTxFundingOpts struct {
+	// ChangeAddress is the address which receives the change, if any.
+	ChangeAddress hdfutil.Address
+
+	// FeeRate is the fee rate in satoshi per 1000 virtual bytes.
+	FeeRate hdfutil.Amount
+
+	// LongTermFeeRate is the fee rate in satoshi per 1000 virtual bytes the
+	// unspent outputs are expected to be spent at otherwise.  It defaults
+	// to 10000 when zero.
+	LongTermFeeRate hdfutil.Amount
+
+	// MinChange is the minimum value of the change output.  Any smaller
+	// change is added to the fee instead.  It defaults to the dust
+	// threshold of the change output at the default minimum relay fee when
+	// zero.
+	MinChange hdfutil.Amount
+
+	// LockTime is the lock time of the transaction.
+	LockTime *int64
+}
+
+// fundingCoin is an unspent output along with the estimated virtual size of
+// the input which spends it, which makes it eligible for coin selection.
+type fundingCoin struct {
+	utxo *UnspentOutput
+	size int64
+}
+
+// Value returns the value of the unspent output.
+//
+// This is part of the coinselect.Coin interface.
+func (c *fundingCoin) Value() hdfutil.Amount {
+	return c.utxo.Amount
+}
+
+// InputSize returns the virtual size of the input which spends the unspent
+// output.
+//
+// This is part of the coinselect.Coin interface.
+func (c *fundingCoin) InputSize() int64 {
+	return c.size
+}
+
+// pushSize returns the size of the canonical push of data of the passed size.
+func pushSize(dataSize int) int {
+	switch {
+	case dataSize < txscript.OP_PUSHDATA1:
+		return 1 + dataSize
+	case dataSize <= 0xff:
+		return 2 + dataSize
+	case dataSize <= 0xffff:
+		return 3 + dataSize
+	}
+	return 5 + dataSize
+}
+
+// witnessItemSize returns the serialized size of a witness stack item of the
+// passed size.
+func witnessItemSize(itemSize int) int {
+	return wire.VarIntSerializeSize(uint64(itemSize)) + itemSize
+}
+
+// signatureSizes returns the maximum size of the signature script which
+// satisfies the passed script along with whether or not the script is a witness
+// program, in which case the size of its witness is not included.
+func signatureSizes(script []byte) (int, bool, error) {
+	class, _, nRequired, err := txscript.ExtractPkScriptAddrs(script,
+		&chaincfg.MainNetParams)
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch class {
+	case txscript.PubKeyTy:
+		return pushSize(maxSigSize), false, nil
+
+	case txscript.PubKeyHashTy:
+		// Assume a compressed public key.
+		return pushSize(maxSigSize) + pushSize(33), false, nil
+
+	case txscript.MultiSigTy:
+		// The signatures follow the extra item consumed by
+		// OP_CHECKMULTISIG.
+		return 1 + nRequired*pushSize(maxSigSize), false, nil
+
+	case txscript.WitnessV0PubKeyHashTy, txscript.WitnessV0ScriptHashTy:
+		return 0, true, nil
+	}
+	return 0, false, fmt.Errorf("unsupported script class %v", class)
+}
+
+// inputSize returns the estimated virtual size of an input which spends the
+// passed unspent output.
+func inputSize(utxo *UnspentOutput) (int64, error) {
+	// The witness program is either the public key script or the redeem
+	// script of a nested segwit output.
+	var sigScriptSize int
+	var isWitness bool
+	var err error
+	program := utxo.PkScript
+	if txscript.IsPayToScriptHash(utxo.PkScript) {
+		if utxo.RedeemScript == nil {
+			return 0, errors.New("missing redeem script")
+		}
+		sigScriptSize, isWitness, err = signatureSizes(utxo.RedeemScript)
+		if err != nil {
+			return 0, err
+		}
+		sigScriptSize += pushSize(len(utxo.RedeemScript))
+		program = utxo.RedeemScript
+	} else {
+		sigScriptSize, isWitness, err = signatureSizes(utxo.PkScript)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// The outpoint, sequence, and signature script are non-witness data.
+	weight := int64(36+4+wire.VarIntSerializeSize(uint64(sigScriptSize))+
+		sigScriptSize) * witnessScaleFactor
+	if isWitness {
+		var witnessSize int
+		switch {
+		case txscript.IsPayToWitnessPubKeyHash(program):
+			// Assume a compressed public key.
+			witnessSize = 1 + witnessItemSize(maxSigSize) +
+				witnessItemSize(33)
+
+		case txscript.IsPayToWitnessScriptHash(program):
+			if utxo.WitnessScript == nil {
+				return 0, errors.New("missing witness script")
+			}
+			class, _, nRequired, err := txscript.ExtractPkScriptAddrs(
+				utxo.WitnessScript, &chaincfg.MainNetParams)
+			if err != nil {
+				return 0, err
+			}
+			if class != txscript.MultiSigTy {
+				return 0, fmt.Errorf("unsupported witness "+
+					"script class %v", class)
+			}
+			witnessSize = 1 + witnessItemSize(0) +
+				nRequired*witnessItemSize(maxSigSize) +
+				witnessItemSize(len(utxo.WitnessScript))
+
+		default:
+			return 0, errors.New("unsupported witness program")
+		}
+		weight += int64(witnessSize)
+	}
+	return (weight + witnessScaleFactor - 1) / witnessScaleFactor, nil
+}
+
+// outputSize returns the serialized size of an output with the passed public
+// key script.
+func outputSize(pkScript []byte) int64 {
+	return int64(8 + wire.VarIntSerializeSize(uint64(len(pkScript))) +
+		len(pkScript))
+}
+
+// selectFundingInputs selects unspent outputs from the passed ones which pay
+// for the passed amounts and the fees of the transaction at the fee rate of the
+// passed options.  It returns the selected outputs along with the change,
+// which is zero when the transaction has no change output.  Unspent outputs
+// which can't be signed are never selected.
+func selectFundingInputs(amounts map[hdfutil.Address]hdfutil.Amount,
+	utxos []*UnspentOutput, opts *RawTxFundingOpts) ([]*UnspentOutput,
+	hdfutil.Amount, error) {
+
+	coins := make([]coinselect.Coin, 0, len(utxos))
+	hasWitness := false
+	for _, utxo := range utxos {
+		size, err := inputSize(utxo)
+		if err != nil {
+			continue
+		}
+		coins = append(coins, &fundingCoin{utxo: utxo, size: size})
+		if txscript.IsWitnessProgram(utxo.PkScript) ||
+			txscript.IsWitnessProgram(utxo.RedeemScript) {
+
+			hasWitness = true
+		}
+	}
+
+	// The transaction consists of the version, lock time, input and output
+	// counts, and the outputs.  The input count is assumed to fit a single
+	// byte and the segwit marker and flag are accounted for when any of
+	// the unspent outputs may be a segwit input.
+	params := &coinselect.Params{
+		FeeRate:         opts.FeeRate,
+		LongTermFeeRate: opts.LongTermFeeRate,
+		BaseSize: int64(4 + 4 + 1 + wire.VarIntSerializeSize(
+			uint64(len(amounts)+1))),
+		MinChange: opts.MinChange,
+	}
+	if params.LongTermFeeRate == 0 {
+		params.LongTermFeeRate = defaultLongTermFeeRate
+	}
+	if hasWitness {
+		params.BaseSize++
+	}
+	for addr, amount := range amounts {
+		pkScript, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			return nil, 0, err
+		}
+		params.Target += amount
+		params.BaseSize += outputSize(pkScript)
+	}
+
+	// Without a change address, selections which need a change output are
+	// rejected below.
+	if opts.ChangeAddress != nil {
+		changeScript, err := txscript.PayToAddrScript(opts.ChangeAddress)
+		if err != nil {
+			return nil, 0, err
+		}
+		params.ChangeOutputSize = outputSize(changeScript)
+		params.ChangeSpendSize, err = inputSize(&UnspentOutput{
+			PkScript: changeScript,
+		})
+		if err != nil {
+			// Assume the change is spent by a pay-to-pubkey-hash
+			// input when it can't be estimated.
+			params.ChangeSpendSize = 148
+		}
+		if params.MinChange == 0 {
+			// The dust threshold is three times the minimum relay
+			// fee of creating and spending the change output.
+			params.MinChange = 3 * defaultMinRelayTxFee *
+				hdfutil.Amount(params.ChangeOutputSize+
+					params.ChangeSpendSize) / 1000
+		}
+	}
+
+	selection, err := coinselect.Select(coins, params)
+	if err != nil {
+		return nil, 0, err
+	}
+	if selection.Change != 0 && opts.ChangeAddress == nil {
+		return nil, 0, ErrNoChangeAddress
+	}
+	selected := make([]*UnspentOutput, 0, len(selection.Coins))
+	for _, coin := range selection.Coins {
+		selected = append(selected, coin.(*fundingCoin).utxo)
+	}
+	return selected, selection.Change, nil
+}
+
+// CreateFundedRawTransaction returns a new transaction sending the provided
+// amounts to the provided addresses, which is funded with unspent outputs of
+// the provided source instead of the outputs of a wallet.  The outputs are
+// selected to pay the fee rate of the options, and any change is sent to the
+// change address of the options.  The unspent outputs spent by the inputs of
+// the transaction are returned in the same order, so they can be passed to
+// SignRawTransactionWithKeys.
+//
+// The transaction itself is created by the createrawtransaction RPC, which
+// does not require a wallet.  Only unspent outputs which SignRawTransactionWithKeys
+// can sign are selected, so pay-to-script-hash outputs must have their redeem
+// script and pay-to-witness-script-hash outputs their witness script.
+//
+// NOTE: This function blocks until the RPC server responds.
+func (c *Client) CreateFundedRawTransaction(
+	amounts map[hdfutil.Address]hdfutil.Amount, source UTXOSource,
+	opts *RawTxFundingOpts) (*wire.MsgTx, []*UnspentOutput, error) {
+
+	utxos, err := source.UnspentOutputs()
+	if err != nil {
+		return nil, nil, err
+	}
+	selected, change, err := selectFundingInputs(amounts, utxos, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Add the change to the amounts, which might already include the
+	// change address.
+	outputs := make(map[hdfutil.Address]hdfutil.Amount, len(amounts)+1)
+	var total hdfutil.Amount
+	for addr, amount := range amounts {
+		if change != 0 && addr.String() == opts.ChangeAddress.String() {
+			amount += change
+			change = 0
+		}
+		outputs[addr] = amount
+		total += amount
+	}
+	if change != 0 {
+		outputs[opts.ChangeAddress] = change
+		total += change
+	}
+
+	inputs := make([]hdfjson.TransactionInput, 0, len(selected))
+	byOutPoint := make(map[wire.OutPoint]*UnspentOutput, len(selected))
+	for _, utxo := range selected {
+		inputs = append(inputs, hdfjson.TransactionInput{
+			Txid: utxo.OutPoint.Hash.String(),
+			Vout: utxo.OutPoint.Index,
+		})
+		byOutPoint[utxo.OutPoint] = utxo
+	}
+	tx, err := c.CreateRawTransaction(inputs, outputs, opts.LockTime)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Ensure the server created the requested transaction since signing
+	// anything else might lose funds.
+	if len(tx.TxIn) != len(selected) {
+		return nil, nil, fmt.Errorf("created transaction has %d "+
+			"inputs instead of %d", len(tx.TxIn), len(selected))
+	}
+	prevOuts := make([]*UnspentOutput, 0, len(tx.TxIn))
+	for _, txIn := range tx.TxIn {
+		utxo, ok := byOutPoint[txIn.PreviousOutPoint]
+		if !ok {
+			return nil, nil, fmt.Errorf("created transaction spends "+
+				"unexpected output %v", txIn.PreviousOutPoint)
+		}
+		delete(byOutPoint, txIn.PreviousOutPoint)
+		prevOuts = append(prevOuts, utxo)
+	}
+	var outputTotal hdfutil.Amount
+	for _, txOut := range tx.TxOut {
+		outputTotal += hdfutil.Amount(txOut.Value)
+	}
+	if len(tx.TxOut) != len(outputs) || outputTotal != total {
+		return nil, nil, fmt.Errorf("created transaction sends %v in "+
+			"%d outputs instead of %v in %d", outputTotal,
+			len(tx.TxOut), total, len(outputs))
+	}
+	return tx, prevOuts, nil
+}
+
+// signWitnessMultiSig returns the witness which satisfies the passed
+// multi-signature witness script with the signatures of as many of the
+// required keys as the passed key database provides.
+func signWitnessMultiSig(chainParams *chaincfg.Params, tx *wire.MsgTx,
+	sigHashes *txscript.TxSigHashes, idx int, amt int64,
+	witnessScript []byte, hashType txscript.SigHashType,
+	kdb txscript.KeyDB) (wire.TxWitness, error) {
+
+	class, addrs, nRequired, err := txscript.ExtractPkScriptAddrs(
+		witnessScript, chainParams)
+	if err != nil {
+		return nil, err
+	}
+	if class != txscript.MultiSigTy {
+		return nil, fmt.Errorf("unsupported witness script class %v",
+			class)
+	}
+
+	// The signatures must be in the order of the public keys and follow
+	// the extra item consumed by OP_CHECKMULTISIG.
+	witness := wire.TxWitness{nil}
+	for _, addr := range addrs {
+		if len(witness) > nRequired {
+			break
+		}
+		key, _, err := kdb.GetKey(addr)
+		if err != nil {
+			continue
+		}
+		sig, err := txscript.RawTxInWitnessSignature(tx, sigHashes, idx,
+			amt, witnessScript, hashType, key)
+		if err != nil {
+			return nil, err
+		}
+		witness = append(witness, sig)
+	}
+	return append(witness, witnessScript), nil
+}
+
+// signWitnessProgram returns the witness which satisfies the passed witness
+// program of the passed unspent output with keys of the passed key database.
+func signWitnessProgram(chainParams *chaincfg.Params, tx *wire.MsgTx,
+	sigHashes *txscript.TxSigHashes, idx int, utxo *UnspentOutput,
+	program []byte, hashType txscript.SigHashType,
+	kdb txscript.KeyDB) (wire.TxWitness, error) {
+
+	if txscript.IsPayToWitnessScriptHash(program) {
+		if utxo.WitnessScript == nil {
+			return nil, errors.New("missing witness script")
+		}
+		return signWitnessMultiSig(chainParams, tx, sigHashes, idx,
+			int64(utxo.Amount), utxo.WitnessScript, hashType, kdb)
+	}
+
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(program, chainParams)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) != 1 {
+		return nil, errors.New("unsupported witness program")
+	}
+	key, compressed, err := kdb.GetKey(addrs[0])
+	if err != nil {
+		return nil, err
+	}
+	return txscript.WitnessSignature(tx, sigHashes, idx,
+		int64(utxo.Amount), program, hashType, key, compressed)
+}
+
+// signRawTransaction signs all of the inputs of the passed transaction, which
+// spend the passed unspent outputs, with keys of the passed key database and
+// returns whether or not the signatures of all of the inputs are complete.
+func signRawTransaction(chainParams *chaincfg.Params, tx *wire.MsgTx,
+	prevOuts []*UnspentOutput, hashType txscript.SigHashType,
+	kdb txscript.KeyDB) (bool, error) {
+
+	if len(prevOuts) != len(tx.TxIn) {
+		return false, fmt.Errorf("%d unspent outputs provided for %d "+
+			"inputs", len(prevOuts), len(tx.TxIn))
+	}
+
+	sigHashes := txscript.NewTxSigHashes(tx)
+	complete := true
+	for i, utxo := range prevOuts {
+		if tx.TxIn[i].PreviousOutPoint != utxo.OutPoint {
+			return false, fmt.Errorf("input %d spends %v instead of "+
+				"%v", i, tx.TxIn[i].PreviousOutPoint, utxo.OutPoint)
+		}
+
+		// Witness programs, including nested ones, are signed here and
+		// anything else by txscript.SignTxOutput.
+		var err error
+		switch {
+		case txscript.IsWitnessProgram(utxo.PkScript):
+			tx.TxIn[i].Witness, err = signWitnessProgram(chainParams,
+				tx, sigHashes, i, utxo, utxo.PkScript, hashType, kdb)
+
+		case txscript.IsPayToScriptHash(utxo.PkScript) &&
+			txscript.IsWitnessProgram(utxo.RedeemScript):
+
+			tx.TxIn[i].Witness, err = signWitnessProgram(chainParams,
+				tx, sigHashes, i, utxo, utxo.RedeemScript, hashType,
+				kdb)
+			if err == nil {
+				tx.TxIn[i].SignatureScript, err = txscript.
+					NewScriptBuilder().AddData(utxo.RedeemScript).
+					Script()
+			}
+
+		default:
+			sdb := txscript.ScriptClosure(func(hdfutil.Address) ([]byte,
+				error) {
+
+				if utxo.RedeemScript == nil {
+					return nil, errors.New("missing redeem script")
+				}
+				return utxo.RedeemScript, nil
+			})
+			tx.TxIn[i].SignatureScript, err = txscript.SignTxOutput(
+				chainParams, tx, i, utxo.PkScript, hashType, kdb, sdb,
+				tx.TxIn[i].SignatureScript)
+		}
+		if err != nil {
+			return false, fmt.Errorf("unable to sign input %d: %v", i,
+				err)
+		}
+
+		// The signatures are incomplete when not enough keys of a
+		// multi-signature script are known.
+		vm, err := txscript.NewEngine(utxo.PkScript, tx, i,
+			txscript.StandardVerifyFlags, nil, sigHashes,
+			int64(utxo.Amount))
+		if err != nil {
+			return false, err
+		}
+		if vm.Execute() != nil {
+			complete = false
+		}
+	}
+	return complete, nil
+}
+
+// SignRawTransactionWithKeys signs the inputs of the passed transaction with the
+// keys of the passed key database instead of the keys of a wallet and returns
+// the signed transaction along with whether or not all of the inputs are
+// signed.  The passed unspent outputs must be the outputs the inputs spend in
+// the same order, as returned by CreateFundedRawTransaction.
+//
+// Pay-to-pubkey, pay-to-pubkey-hash, and multi-signature outputs as well as
+// pay-to-witness-pubkey-hash and multi-signature pay-to-witness-script-hash
+// outputs are supported, including those nested in pay-to-script-hash outputs.
+// Multi-signature inputs are only partially signed when not all of the
+// required keys are known, so the signed transaction can be passed to another
+// signer.  Any other unknown key results in an error.
+//
+// Unlike SignRawTransaction3, the transaction is signed locally, so the keys
+// are never sent to the RPC server.  The passed transaction is not modified.
+func (c *Client) SignRawTransactionWithKeys(tx *wire.MsgTx,
+	prevOuts []*UnspentOutput, kdb txscript.KeyDB,
+	hashType txscript.SigHashType) (*wire.MsgTx, bool, error) {
+
+	signedTx := tx.Copy()
+	complete, err := signRawTransaction(c.chainParams, signedTx, prevOuts,
+		hashType, kdb)
+	if err != nil {
+		return nil, false, err
+	}
+	return signedTx, complete, nil
+}
+
+// CreateSignedRawTransaction returns a new transaction sending the provided
+// amounts to the provided addresses which is funded with unspent outputs of
+// the provided source and signed with keys of the provided key database.  An
+// error is returned when not all of the inputs could be signed.
+//
+// See CreateFundedRawTransaction and SignRawTransactionWithKeys for more
+// details.
+//
+// NOTE: This function blocks until the RPC server responds.
+func (c *Client) CreateSignedRawTransaction(
+	amounts map[hdfutil.Address]hdfutil.Amount, source UTXOSource,
+	kdb txscript.KeyDB, opts *RawTxFundingOpts) (*wire.MsgTx, error) {
+
+	tx, prevOuts, err := c.CreateFundedRawTransaction(amounts, source, opts)
+	if err != nil {
+		return nil, err
+	}
+	signedTx, complete, err := c.SignRawTransactionWithKeys(tx, prevOuts,
+		kdb, txscript.SigHashAll)
+	if err != nil {
+		return nil, err
+	}
+	if !complete {
+		return nil, errors.New("transaction is not completely signed")
+	}
+	return signedTx, nil
+}
@@ -0,0 +1,352 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpcclient
+
+import (
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfd/coinselect"
+	"github.com/ifishnet/hdfd/hdfec"
+	"github.com/ifishnet/hdfd/txscript"
+	"github.com/ifishnet/hdfd/wire"
+	"github.com/ifishnet/hdfutil"
+)
+
+// testKey is a private key along with the addresses it is looked up by.
+type testKey struct {
+	privKey *hdfec.PrivateKey
+	pubKey  []byte
+	p2pkh   hdfutil.Address
+	p2wpkh  hdfutil.Address
+}
+
+// newTestKey returns a test key derived from the passed seed.
+func newTestKey(t *testing.T, seed byte) *testKey {
+	t.Helper()
+
+	privKey, pubKey := hdfec.PrivKeyFromBytes(hdfec.S256(), []byte{seed})
+	pkHash := hdfutil.Hash160(pubKey.SerializeCompressed())
+	p2pkh, err := hdfutil.NewAddressPubKeyHash(pkHash,
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("NewAddressPubKeyHash: %v", err)
+	}
+	p2wpkh, err := hdfutil.NewAddressWitnessPubKeyHash(pkHash,
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("NewAddressWitnessPubKeyHash: %v", err)
+	}
+	return &testKey{privKey, pubKey.SerializeCompressed(), p2pkh, p2wpkh}
+}
+
+// testKeyDB returns a key database which provides the passed keys.
+func testKeyDB(keys ...*testKey) txscript.KeyDB {
+	byAddr := make(map[string]*hdfec.PrivateKey)
+	for _, key := range keys {
+		byAddr[key.p2pkh.EncodeAddress()] = key.privKey
+		byAddr[key.p2wpkh.EncodeAddress()] = key.privKey
+		pkAddr, _ := hdfutil.NewAddressPubKey(key.pubKey,
+			&chaincfg.RegressionNetParams)
+		byAddr[pkAddr.EncodeAddress()] = key.privKey
+	}
+	return txscript.KeyClosure(func(addr hdfutil.Address) (*hdfec.PrivateKey,
+		bool, error) {
+
+		privKey, ok := byAddr[addr.EncodeAddress()]
+		if !ok {
+			return nil, false, errors.New("unknown key")
+		}
+		return privKey, true, nil
+	})
+}
+
+// mustPayToAddrScript returns the public key script paying to the passed
+// address or fails the test.
+func mustPayToAddrScript(t *testing.T, addr hdfutil.Address) []byte {
+	t.Helper()
+
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("PayToAddrScript: %v", err)
+	}
+	return pkScript
+}
+
+// testMultiSigOutput returns an unspent output paying to a multi-signature
+// witness script of the passed keys, which is nested in a pay-to-script-hash
+// output when requested.
+func testMultiSigOutput(t *testing.T, nRequired int, nested bool,
+	keys ...*testKey) *UnspentOutput {
+
+	t.Helper()
+
+	builder := txscript.NewScriptBuilder().AddInt64(int64(nRequired))
+	for _, key := range keys {
+		builder.AddData(key.pubKey)
+	}
+	witnessScript, err := builder.AddInt64(int64(len(keys))).
+		AddOp(txscript.OP_CHECKMULTISIG).Script()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	scriptHash := sha256.Sum256(witnessScript)
+	addr, err := hdfutil.NewAddressWitnessScriptHash(scriptHash[:],
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("NewAddressWitnessScriptHash: %v", err)
+	}
+	utxo := &UnspentOutput{
+		PkScript:      mustPayToAddrScript(t, addr),
+		WitnessScript: witnessScript,
+	}
+	if nested {
+		nestOutput(t, utxo)
+	}
+	return utxo
+}
+
+// nestOutput nests the public key script of the passed unspent output in a
+// pay-to-script-hash output.
+func nestOutput(t *testing.T, utxo *UnspentOutput) {
+	t.Helper()
+
+	addr, err := hdfutil.NewAddressScriptHash(utxo.PkScript,
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("NewAddressScriptHash: %v", err)
+	}
+	utxo.RedeemScript = utxo.PkScript
+	utxo.PkScript = mustPayToAddrScript(t, addr)
+}
+
+// TestInputSize ensures the virtual sizes of the inputs which spend unspent
+// outputs are estimated as expected.
+func TestInputSize(t *testing.T) {
+	t.Parallel()
+
+	key := newTestKey(t, 0x01)
+	p2sh := &UnspentOutput{PkScript: mustPayToAddrScript(t, key.p2wpkh)}
+	nestOutput(t, p2sh)
+	p2pk, err := txscript.NewScriptBuilder().AddData(key.pubKey).
+		AddOp(txscript.OP_CHECKSIG).Script()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	keys := []*testKey{key, newTestKey(t, 0x02), newTestKey(t, 0x03)}
+
+	tests := []struct {
+		name  string
+		utxo  *UnspentOutput
+		size  int64
+		valid bool
+	}{{
+		name:  "pay-to-pubkey",
+		utxo:  &UnspentOutput{PkScript: p2pk},
+		size:  114,
+		valid: true,
+	}, {
+		name:  "pay-to-pubkey-hash",
+		utxo:  &UnspentOutput{PkScript: mustPayToAddrScript(t, key.p2pkh)},
+		size:  148,
+		valid: true,
+	}, {
+		name:  "pay-to-witness-pubkey-hash",
+		utxo:  &UnspentOutput{PkScript: mustPayToAddrScript(t, key.p2wpkh)},
+		size:  68,
+		valid: true,
+	}, {
+		name:  "nested pay-to-witness-pubkey-hash",
+		utxo:  p2sh,
+		size:  91,
+		valid: true,
+	}, {
+		// The witness consists of the item count, the empty item, two
+		// signatures, and the 105 byte witness script.
+		name:  "2-of-3 pay-to-witness-script-hash",
+		utxo:  testMultiSigOutput(t, 2, false, keys...),
+		size:  105,
+		valid: true,
+	}, {
+		name:  "nested 2-of-3 pay-to-witness-script-hash",
+		utxo:  testMultiSigOutput(t, 2, true, keys...),
+		size:  105 + 35,
+		valid: true,
+	}, {
+		name: "missing redeem script",
+		utxo: &UnspentOutput{PkScript: p2sh.PkScript},
+	}, {
+		name: "missing witness script",
+		utxo: &UnspentOutput{
+			PkScript: testMultiSigOutput(t, 2, false, keys...).PkScript,
+		},
+	}, {
+		name: "non-standard",
+		utxo: &UnspentOutput{PkScript: []byte{txscript.OP_TRUE}},
+	}}
+
+	for _, test := range tests {
+		size, err := inputSize(test.utxo)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if size != test.size {
+			t.Errorf("%s: mismatched size -- got %d, want %d",
+				test.name, size, test.size)
+		}
+	}
+}
+
+// TestSelectFundingInputs ensures unspent outputs are selected to fund raw
+// transactions as expected.
+func TestSelectFundingInputs(t *testing.T) {
+	t.Parallel()
+
+	key := newTestKey(t, 0x01)
+	utxo := func(amount hdfutil.Amount, addr hdfutil.Address) *UnspentOutput {
+		return &UnspentOutput{
+			OutPoint: wire.OutPoint{Index: uint32(amount)},
+			Amount:   amount,
+			PkScript: mustPayToAddrScript(t, addr),
+		}
+	}
+	amounts := map[hdfutil.Address]hdfutil.Amount{key.p2wpkh: 100000}
+
+	// The unspendable output is never selected.
+	utxos := []*UnspentOutput{
+		utxo(60000, key.p2wpkh),
+		utxo(60000, key.p2pkh),
+		{Amount: 1000000, PkScript: []byte{txscript.OP_TRUE}},
+	}
+	selected, change, err := selectFundingInputs(amounts, utxos,
+		&RawTxFundingOpts{ChangeAddress: key.p2wpkh, FeeRate: 1000})
+	if err != nil {
+		t.Fatalf("selectFundingInputs: %v", err)
+	}
+	if len(selected) != 2 {
+		t.Fatalf("%d outputs selected, want 2", len(selected))
+	}
+
+	// The transaction has a version, lock time, input and output counts,
+	// two 31 byte outputs, a segwit marker, and inputs of 68 and 148
+	// virtual bytes.
+	wantFee := hdfutil.Amount(4 + 4 + 1 + 1 + 2*31 + 1 + 68 + 148)
+	if fee := 120000 - 100000 - change; fee != wantFee {
+		t.Fatalf("mismatched fee -- got %v, want %v", fee, wantFee)
+	}
+
+	_, _, err = selectFundingInputs(amounts, utxos, &RawTxFundingOpts{
+		FeeRate: 1000,
+	})
+	if err != ErrNoChangeAddress {
+		t.Fatalf("mismatched error without change address -- got %v, "+
+			"want %v", err, ErrNoChangeAddress)
+	}
+
+	_, _, err = selectFundingInputs(amounts, utxos[:1], &RawTxFundingOpts{
+		ChangeAddress: key.p2wpkh,
+		FeeRate:       1000,
+	})
+	if err != coinselect.ErrInsufficientFunds {
+		t.Fatalf("mismatched error with insufficient funds -- got %v, "+
+			"want %v", err, coinselect.ErrInsufficientFunds)
+	}
+}
+
+// TestSignRawTransaction ensures inputs spending the supported kinds of outputs
+// are signed with the provided keys.
+func TestSignRawTransaction(t *testing.T) {
+	t.Parallel()
+
+	key1, key2 := newTestKey(t, 0x01), newTestKey(t, 0x02)
+	nestedP2WPKH := &UnspentOutput{PkScript: mustPayToAddrScript(t,
+		key1.p2wpkh)}
+	nestOutput(t, nestedP2WPKH)
+
+	tests := []struct {
+		name     string
+		utxo     *UnspentOutput
+		keys     []*testKey
+		complete bool
+		valid    bool
+	}{{
+		name: "pay-to-pubkey-hash",
+		utxo: &UnspentOutput{
+			PkScript: mustPayToAddrScript(t, key1.p2pkh),
+		},
+		keys:     []*testKey{key1},
+		complete: true,
+		valid:    true,
+	}, {
+		name: "pay-to-witness-pubkey-hash",
+		utxo: &UnspentOutput{
+			PkScript: mustPayToAddrScript(t, key1.p2wpkh),
+		},
+		keys:     []*testKey{key1},
+		complete: true,
+		valid:    true,
+	}, {
+		name:     "nested pay-to-witness-pubkey-hash",
+		utxo:     nestedP2WPKH,
+		keys:     []*testKey{key1},
+		complete: true,
+		valid:    true,
+	}, {
+		name:     "2-of-2 pay-to-witness-script-hash",
+		utxo:     testMultiSigOutput(t, 2, false, key1, key2),
+		keys:     []*testKey{key1, key2},
+		complete: true,
+		valid:    true,
+	}, {
+		name:     "nested 2-of-2 pay-to-witness-script-hash",
+		utxo:     testMultiSigOutput(t, 2, true, key1, key2),
+		keys:     []*testKey{key2, key1},
+		complete: true,
+		valid:    true,
+	}, {
+		name:  "partially signed 2-of-2 pay-to-witness-script-hash",
+		utxo:  testMultiSigOutput(t, 2, false, key1, key2),
+		keys:  []*testKey{key2},
+		valid: true,
+	}, {
+		name: "unknown key",
+		utxo: &UnspentOutput{
+			PkScript: mustPayToAddrScript(t, key1.p2wpkh),
+		},
+		keys: []*testKey{key2},
+	}}
+
+	for _, test := range tests {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(&test.utxo.OutPoint, nil, nil))
+		tx.AddTxOut(wire.NewTxOut(90000, []byte{txscript.OP_TRUE}))
+		test.utxo.Amount = 100000
+
+		complete, err := signRawTransaction(&chaincfg.RegressionNetParams,
+			tx, []*UnspentOutput{test.utxo}, txscript.SigHashAll,
+			testKeyDB(test.keys...))
+		if (err == nil) != test.valid {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if complete != test.complete {
+			t.Errorf("%s: mismatched completeness -- got %v, want %v",
+				test.name, complete, test.complete)
+		}
+	}
+
+	// The unspent outputs must match the inputs.
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil, nil))
+	_, err := signRawTransaction(&chaincfg.RegressionNetParams, tx,
+		[]*UnspentOutput{{PkScript: mustPayToAddrScript(t, key1.p2pkh)}},
+		txscript.SigHashAll, testKeyDB(key1))
+	if err == nil {
+		t.Fatal("signed input spending mismatched output")
+	}
+}
@@ -298,7 +298,7 @@ func (c *Client) ListSinceBlockAsync(blockHash *chainhash.Hash) FutureListSinceB
 		hash = hdfjson.String(blockHash.String())
 	}
 
-	cmd := hdfjson.NewListSinceBlockCmd(hash, nil, nil)
+	cmd := hdfjson.NewListSinceBlockCmd(hash, nil, nil, nil)
 	return c.sendCmd(cmd)
 }
 
@@ -322,7 +322,7 @@ func (c *Client) ListSinceBlockMinConfAsync(blockHash *chainhash.Hash, minConfir
 		hash = hdfjson.String(blockHash.String())
 	}
 
-	cmd := hdfjson.NewListSinceBlockCmd(hash, &minConfirms, nil)
+	cmd := hdfjson.NewListSinceBlockCmd(hash, &minConfirms, nil, nil)
 	return c.sendCmd(cmd)
 }
 
@@ -6,6 +6,7 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/sha256"
 	"crypto/subtle"
@@ -21,22 +22,27 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/ifishnet/hdfd/addrmgr"
 	"github.com/ifishnet/hdfd/blockchain"
 	"github.com/ifishnet/hdfd/blockchain/indexers"
 	"github.com/ifishnet/hdfd/hdfec"
 	"github.com/ifishnet/hdfd/hdfjson"
 	"github.com/ifishnet/hdfd/chaincfg"
 	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/connmgr"
 	"github.com/ifishnet/hdfd/database"
 	"github.com/ifishnet/hdfd/mempool"
 	"github.com/ifishnet/hdfd/mining"
 	"github.com/ifishnet/hdfd/mining/cpuminer"
+	"github.com/ifishnet/hdfd/netsync"
 	"github.com/ifishnet/hdfd/peer"
 	"github.com/ifishnet/hdfd/txscript"
 	"github.com/ifishnet/hdfd/wire"
@@ -46,9 +52,9 @@ import (
 
 // API version constants
 const (
-	jsonrpcSemverString = "1.3.0"
+	jsonrpcSemverString = "1.4.0"
 	jsonrpcSemverMajor  = 1
-	jsonrpcSemverMinor  = 3
+	jsonrpcSemverMinor  = 4
 	jsonrpcSemverPatch  = 0
 )
 
@@ -132,9 +138,12 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"debuglevel":            handleDebugLevel,
 	"decoderawtransaction":  handleDecodeRawTransaction,
 	"decodescript":          handleDecodeScript,
+	"dumptxoutset":          handleDumpTxOutSet,
 	"estimatefee":           handleEstimateFee,
+	"estimatesmartfee":      handleEstimateSmartFee,
 	"generate":              handleGenerate,
 	"getaddednodeinfo":      handleGetAddedNodeInfo,
+	"getaddrmaninfo":        handleGetAddrManInfo,
 	"getbestblock":          handleGetBestBlock,
 	"getbestblockhash":      handleGetBestBlockHash,
 	"getblock":              handleGetBlock,
@@ -147,27 +156,40 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"getcfilterheader":      handleGetCFilterHeader,
 	"getconnectioncount":    handleGetConnectionCount,
 	"getcurrentnet":         handleGetCurrentNet,
+	"getdeploymentinfo":     handleGetDeploymentInfo,
 	"getdifficulty":         handleGetDifficulty,
 	"getgenerate":           handleGetGenerate,
 	"gethashespersec":       handleGetHashesPerSec,
 	"getheaders":            handleGetHeaders,
 	"getinfo":               handleGetInfo,
+	"getmempoolentry":       handleGetMempoolEntry,
 	"getmempoolinfo":        handleGetMempoolInfo,
 	"getmininginfo":         handleGetMiningInfo,
 	"getnettotals":          handleGetNetTotals,
 	"getnetworkhashps":      handleGetNetworkHashPS,
 	"getpeerinfo":           handleGetPeerInfo,
+	"getpeerrotations":      handleGetPeerRotations,
+	"getrawaddrman":         handleGetRawAddrMan,
 	"getrawmempool":         handleGetRawMempool,
 	"getrawtransaction":     handleGetRawTransaction,
+	"getrpcacl":             handleGetRPCACL,
+	"getrpcwhitelist":       handleGetRPCWhitelist,
 	"gettxout":              handleGetTxOut,
 	"help":                  handleHelp,
+	"invalidateblock":       handleInvalidateBlock,
+	"listbanned":            handleListBanned,
 	"node":                  handleNode,
 	"ping":                  handlePing,
+	"reconsiderblock":       handleReconsiderBlock,
 	"searchrawtransactions": handleSearchRawTransactions,
 	"sendrawtransaction":    handleSendRawTransaction,
+	"setban":                handleSetBan,
 	"setgenerate":           handleSetGenerate,
+	"setsyncoptions":        handleSetSyncOptions,
+	"settemplateoptions":    handleSetTemplateOptions,
 	"stop":                  handleStop,
 	"submitblock":           handleSubmitBlock,
+	"submitpackage":         handleSubmitPackage,
 	"uptime":                handleUptime,
 	"validateaddress":       handleValidateAddress,
 	"verifychain":           handleVerifyChain,
@@ -227,12 +249,9 @@ var rpcAskWallet = map[string]struct{}{
 var rpcUnimplemented = map[string]struct{}{
 	"estimatepriority": {},
 	"getchaintips":     {},
-	"getmempoolentry":  {},
 	"getnetworkinfo":   {},
 	"getwork":          {},
-	"invalidateblock":  {},
 	"preciousblock":    {},
-	"reconsiderblock":  {},
 }
 
 // Commands that are available to a limited user
@@ -255,6 +274,7 @@ var rpcLimited = map[string]struct{}{
 	"decoderawtransaction":  {},
 	"decodescript":          {},
 	"estimatefee":           {},
+	"estimatesmartfee":      {},
 	"getbestblock":          {},
 	"getbestblockhash":      {},
 	"getblock":              {},
@@ -264,23 +284,35 @@ var rpcLimited = map[string]struct{}{
 	"getcfilter":            {},
 	"getcfilterheader":      {},
 	"getcurrentnet":         {},
+	"getdeploymentinfo":     {},
 	"getdifficulty":         {},
 	"getheaders":            {},
 	"getinfo":               {},
+	"getmempoolentry":       {},
 	"getnettotals":          {},
 	"getnetworkhashps":      {},
 	"getrawmempool":         {},
 	"getrawtransaction":     {},
+	"getrpcwhitelist":       {},
 	"gettxout":              {},
 	"searchrawtransactions": {},
 	"sendrawtransaction":    {},
 	"submitblock":           {},
+	"submitpackage":         {},
 	"uptime":                {},
 	"validateaddress":       {},
 	"verifymessage":         {},
 	"version":               {},
 }
 
+// Commands that are available while the server is warming up since they don't
+// depend on the chain state or any of the other services that are only
+// available once the startup work is complete.
+var rpcWarmupAllowed = map[string]struct{}{
+	"help": {},
+	"stop": {},
+}
+
 // builderScript is a convenience function which is used for hard-coded scripts
 // built with the script builder.   Any errors are converted to a panic since it
 // is only, and must only, be used with hard-coded, and therefore, known good,
@@ -852,9 +884,123 @@ func handleDecodeScript(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 	if scriptClass != txscript.ScriptHashTy {
 		reply.P2sh = p2sh.EncodeAddress()
 	}
+
+	// Execute the script on its own and include the trace of the execution
+	// when requested.
+	if c.Verbosity != nil && *c.Verbosity != 0 {
+		trace, err := traceScript(script)
+		if err != nil {
+			return nil, &hdfjson.RPCError{
+				Code:    hdfjson.ErrRPCInvalidParameter,
+				Message: "Unable to execute script: " + err.Error(),
+			}
+		}
+		reply.Trace = make([]hdfjson.ScriptTraceStep, 0, len(trace.Steps))
+		for _, step := range trace.Steps {
+			reply.Trace = append(reply.Trace, createScriptTraceStep(step))
+		}
+		reply.TraceResult = "success"
+		if trace.Err != nil {
+			reply.TraceResult = trace.Err.Error()
+		}
+	}
 	return reply, nil
 }
 
+// traceScript executes the passed script as the public key script of an output
+// which is spent by an otherwise empty transaction with an empty signature
+// script and returns the trace of the execution.  The scripts are executed with
+// the standard verification flags.  Signature checks fail since there is
+// nothing meaningful to sign, so it is mostly useful for debugging the logic of
+// scripts.
+func traceScript(script []byte) (*txscript.Trace, error) {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(&wire.TxIn{Sequence: wire.MaxTxInSequenceNum})
+	tx.AddTxOut(wire.NewTxOut(0, nil))
+	vm, err := txscript.NewEngine(script, tx, 0,
+		txscript.StandardVerifyFlags, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	trace, _ := vm.ExecuteWithTrace()
+	return trace, nil
+}
+
+// createScriptTraceStep returns the JSON-RPC representation of the passed
+// script trace step.
+func createScriptTraceStep(step *txscript.TraceStep) hdfjson.ScriptTraceStep {
+	hexItems := func(items [][]byte) []string {
+		strs := make([]string, len(items))
+		for i, item := range items {
+			strs[i] = hex.EncodeToString(item)
+		}
+		return strs
+	}
+	result := hdfjson.ScriptTraceStep{
+		Script:   step.ScriptIdx,
+		Index:    step.OpcodeIdx,
+		Opcode:   step.Opcode,
+		Executed: step.Executed,
+		Stack:    hexItems(step.Stack),
+		AltStack: hexItems(step.AltStack),
+	}
+	if step.Err != nil {
+		result.Error = step.Err.Error()
+	}
+	return result
+}
+
+// handleDumpTxOutSet implements the dumptxoutset command.
+func handleDumpTxOutSet(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*hdfjson.DumpTxOutSetCmd)
+
+	// Relative paths are relative to the data directory.
+	path := cleanAndExpandPath(c.Path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cfg.DataDir, path)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil, &hdfjson.RPCError{
+			Code:    hdfjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("%s already exists", path),
+		}
+	}
+
+	// Write the snapshot to a temporary file that is only renamed once it
+	// is complete so an incomplete snapshot is never left at the path.
+	tmpPath := path + ".incomplete"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		context := "Failed to create utxo snapshot file"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	w := bufio.NewWriter(f)
+	info, err := s.cfg.Chain.DumpUTXOSnapshot(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		context := "Failed to dump utxo set"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	return &hdfjson.DumpTxOutSetResult{
+		CoinsWritten: info.NumUTXOs,
+		BaseHash:     info.Hash.String(),
+		BaseHeight:   info.Height,
+		Path:         path,
+		TxOutSetHash: info.UTXOSetHash.String(),
+		NChainTx:     info.TotalTxns,
+	}, nil
+}
+
 // handleEstimateFee handles estimatefee commands.
 func handleEstimateFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*hdfjson.EstimateFeeCmd)
@@ -877,6 +1023,56 @@ func handleEstimateFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return float64(feeRate), nil
 }
 
+// handleEstimateSmartFee handles estimatesmartfee commands.
+func handleEstimateSmartFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*hdfjson.EstimateSmartFeeCmd)
+
+	if s.cfg.FeeEstimator == nil {
+		return nil, errors.New("Fee estimation disabled")
+	}
+
+	if c.ConfTarget <= 0 {
+		return nil, &hdfjson.RPCError{
+			Code:    hdfjson.ErrRPCInvalidParameter,
+			Message: "Parameter ConfTarget must be positive",
+		}
+	}
+
+	conservative := true
+	if c.EstimateMode != nil {
+		switch *c.EstimateMode {
+		case hdfjson.EstimateModeUnset, hdfjson.EstimateModeConservative:
+		case hdfjson.EstimateModeEconomical:
+			conservative = false
+		default:
+			return nil, &hdfjson.RPCError{
+				Code:    hdfjson.ErrRPCInvalidParameter,
+				Message: "Invalid estimate_mode parameter",
+			}
+		}
+	}
+
+	feeRate, blocks, err := s.cfg.FeeEstimator.EstimateSmartFee(
+		uint32(c.ConfTarget), conservative)
+	if err != nil {
+		return &hdfjson.EstimateSmartFeeResult{
+			Errors: []string{err.Error()},
+			Blocks: int64(blocks),
+		}, nil
+	}
+
+	// Transactions paying less than the minimum fee rate of the mempool
+	// would not be relayed, so never estimate less than it.
+	result := float64(feeRate)
+	if minFeeRate := s.cfg.TxMemPool.MinFeeRate().ToHDF(); result < minFeeRate {
+		result = minFeeRate
+	}
+	return &hdfjson.EstimateSmartFeeResult{
+		FeeRate: &result,
+		Blocks:  int64(blocks),
+	}, nil
+}
+
 // handleGenerate handles generate commands.
 func handleGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Respond with an error if there are no addresses to pay the
@@ -1021,6 +1217,48 @@ func handleGetAddedNodeInfo(s *rpcServer, cmd interface{}, closeChan <-chan stru
 	return results, nil
 }
 
+// addrNetworkName returns the name the passed network of an address is
+// reported as by the RPC server.
+func addrNetworkName(netID wire.NetworkID) string {
+	return strings.ToLower(netID.String())
+}
+
+// handleGetAddrManInfo implements the getaddrmaninfo command.
+func handleGetAddrManInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	counts := s.cfg.AddrManager.NetworkCounts()
+	netIDs := make([]wire.NetworkID, 0, len(counts))
+	for netID := range counts {
+		netIDs = append(netIDs, netID)
+	}
+	sort.Slice(netIDs, func(i, j int) bool {
+		return netIDs[i] < netIDs[j]
+	})
+
+	result := &hdfjson.GetAddrManInfoResult{
+		Networks: make([]hdfjson.AddrManNetworkResult, 0, len(netIDs)),
+	}
+	for _, netID := range netIDs {
+		netCounts := counts[netID]
+		result.Networks = append(result.Networks, hdfjson.AddrManNetworkResult{
+			Network: addrNetworkName(netID),
+			New:     netCounts.New,
+			Tried:   netCounts.Tried,
+			Total:   netCounts.New + netCounts.Tried,
+		})
+		result.New += netCounts.New
+		result.Tried += netCounts.Tried
+	}
+	result.Total = result.New + result.Tried
+
+	if info := s.cfg.AddrManager.ASMapInfo(); info.Loaded {
+		result.ASMap = &hdfjson.ASMapResult{
+			Size:     info.Size,
+			Checksum: hex.EncodeToString(info.Checksum[:]),
+		}
+	}
+	return result, nil
+}
+
 // handleGetBestBlock implements the getbestblock command.
 func handleGetBestBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// All other "get block" commands give either the height, the
@@ -1060,26 +1298,59 @@ func getDifficultyRatio(bits uint32, params *chaincfg.Params) float64 {
 	return diff
 }
 
+// blockNotAvailableError returns an RPC error for a block with the passed hash
+// which could not be loaded from the database.  Blocks which are known, but
+// don't have their data available because it was pruned or has not been
+// downloaded yet, are reported with a distinct error so callers can tell them
+// apart from unknown blocks.
+func blockNotAvailableError(s *rpcServer, hash *chainhash.Hash) *hdfjson.RPCError {
+	if _, err := s.cfg.Chain.HeaderByHash(hash); err == nil {
+		switch {
+		case s.cfg.Chain.IsHistoricalBlock(hash):
+			return &hdfjson.RPCError{
+				Code:    hdfjson.ErrRPCMisc,
+				Message: "Block not available (not yet downloaded)",
+			}
+
+		case s.cfg.Chain.IsPruned():
+			return &hdfjson.RPCError{
+				Code:    hdfjson.ErrRPCMisc,
+				Message: "Block not available (pruned data)",
+			}
+		}
+	}
+
+	return &hdfjson.RPCError{
+		Code:    hdfjson.ErrRPCBlockNotFound,
+		Message: "Block not found",
+	}
+}
+
 // handleGetBlock implements the getblock command.
 func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*hdfjson.GetBlockCmd)
 
-	// Load the raw block bytes from the database.
 	hash, err := chainhash.NewHashFromStr(c.Hash)
 	if err != nil {
 		return nil, rpcDecodeHexError(c.Hash)
 	}
+
+	// Load the block from the chain when it is part of the main chain since
+	// recently connected blocks are served from memory.  Otherwise, load the
+	// raw block bytes from the database.
 	var blkBytes []byte
-	err = s.cfg.DB.View(func(dbTx database.Tx) error {
-		var err error
-		blkBytes, err = dbTx.FetchBlock(hash)
-		return err
-	})
+	blk, err := s.cfg.Chain.BlockByHash(hash)
+	if err == nil {
+		blkBytes, err = blk.Bytes()
+	} else {
+		err = s.cfg.DB.View(func(dbTx database.Tx) error {
+			var err error
+			blkBytes, err = dbTx.FetchBlock(hash)
+			return err
+		})
+	}
 	if err != nil {
-		return nil, &hdfjson.RPCError{
-			Code:    hdfjson.ErrRPCBlockNotFound,
-			Message: "Block not found",
-		}
+		return nil, blockNotAvailableError(s, hash)
 	}
 	// If verbosity is 0, return the serialized block as a hex encoded string.
 	if c.Verbosity != nil && *c.Verbosity == 0 {
@@ -1088,11 +1359,13 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 
 	// Otherwise, generate the JSON object and return it.
 
-	// Deserialize the block.
-	blk, err := hdfutil.NewBlockFromBytes(blkBytes)
-	if err != nil {
-		context := "Failed to deserialize block"
-		return nil, internalRPCError(err.Error(), context)
+	// Deserialize the block unless it was loaded from the chain.
+	if blk == nil {
+		blk, err = hdfutil.NewBlockFromBytes(blkBytes)
+		if err != nil {
+			context := "Failed to deserialize block"
+			return nil, internalRPCError(err.Error(), context)
+		}
 	}
 
 	// Get the block height from chain.
@@ -1101,7 +1374,6 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 		context := "Failed to obtain block height"
 		return nil, internalRPCError(err.Error(), context)
 	}
-	blk.SetHeight(blockHeight)
 	best := s.cfg.Chain.BestSnapshot()
 
 	// Get next block hash unless there are none.
@@ -1187,20 +1459,34 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 	params := s.cfg.ChainParams
 	chain := s.cfg.Chain
 	chainSnapshot := chain.BestSnapshot()
+	chainWork := chain.ChainWork()
 
 	chainInfo := &hdfjson.GetBlockChainInfoResult{
-		Chain:         params.Name,
-		Blocks:        chainSnapshot.Height,
-		Headers:       chainSnapshot.Height,
-		BestBlockHash: chainSnapshot.Hash.String(),
-		Difficulty:    getDifficultyRatio(chainSnapshot.Bits, params),
-		MedianTime:    chainSnapshot.MedianTime.Unix(),
-		Pruned:        false,
+		Chain:                params.Name,
+		Blocks:               chainSnapshot.Height,
+		Headers:              chainWork.BestHeaderHeight,
+		BestBlockHash:        chainSnapshot.Hash.String(),
+		Difficulty:           getDifficultyRatio(chainSnapshot.Bits, params),
+		MedianTime:           chainSnapshot.MedianTime.Unix(),
+		Pruned:               chain.IsPruned(),
+		ChainWork:            fmt.Sprintf("%064x", chainWork.TipWork),
+		BestHeaderHash:       chainWork.BestHeaderHash.String(),
+		HeadersChainWork:     fmt.Sprintf("%064x", chainWork.BestHeaderWork),
+		BlocksBehind:         chainWork.BlocksBehind(),
+		VerificationProgress: s.cfg.SyncMgr.VerificationProgress(),
 		SoftForks: &hdfjson.SoftForks{
 			Bip9SoftForks: make(map[string]*hdfjson.Bip9SoftForkDescription),
 		},
 	}
 
+	// The best header is tracked by the sync manager in headers-only mode
+	// since the headers are never added to the block chain.
+	if hash, height, ok := s.cfg.SyncMgr.BestHeader(); ok {
+		chainInfo.Headers = height
+		chainInfo.BestHeaderHash = hash.String()
+		chainInfo.BlocksBehind = height - chainSnapshot.Height
+	}
+
 	// Next, populate the response with information describing the current
 	// status of soft-forks deployed via the super-majority block
 	// signalling mechanism.
@@ -1261,7 +1547,7 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 
 		// Query the chain for the current status of the deployment as
 		// identified by its deployment ID.
-		deploymentStatus, err := chain.ThresholdState(uint32(deployment))
+		deploymentStatus, err := chain.DeploymentStatus(uint32(deployment))
 		if err != nil {
 			context := "Failed to obtain deployment status"
 			return nil, internalRPCError(err.Error(), context)
@@ -1270,12 +1556,12 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 		// Attempt to convert the current deployment status into a
 		// human readable string. If the status is unrecognized, then a
 		// non-nil error is returned.
-		statusString, err := softForkStatus(deploymentStatus)
+		statusString, err := softForkStatus(deploymentStatus.State)
 		if err != nil {
 			return nil, &hdfjson.RPCError{
 				Code: hdfjson.ErrRPCInternal.Code,
 				Message: fmt.Sprintf("unknown deployment status: %v",
-					deploymentStatus),
+					deploymentStatus.State),
 			}
 		}
 
@@ -1286,6 +1572,7 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 			Bit:        deploymentDetails.BitNumber,
 			StartTime2: int64(deploymentDetails.StartTime),
 			Timeout:    int64(deploymentDetails.ExpireTime),
+			Since:      deploymentStatus.Since,
 		}
 	}
 
@@ -1993,7 +2280,7 @@ func chainErrToGBTErrString(err error) string {
 		return "rejected: " + err.Error()
 	}
 
-	switch ruleErr.ErrorCode {
+	switch ruleErr.Err {
 	case blockchain.ErrDuplicateBlock:
 		return "duplicate"
 	case blockchain.ErrBlockTooBig:
@@ -2129,7 +2416,8 @@ func handleGetBlockTemplateProposal(s *rpcServer, request *hdfjson.TemplateReque
 	}
 
 	if err := s.cfg.Chain.CheckConnectBlockTemplate(block); err != nil {
-		if _, ok := err.(blockchain.RuleError); !ok {
+		ruleErr, ok := err.(blockchain.RuleError)
+		if !ok {
 			errStr := fmt.Sprintf("Failed to process block proposal: %v", err)
 			rpcsLog.Error(errStr)
 			return nil, &hdfjson.RPCError{
@@ -2138,7 +2426,8 @@ func handleGetBlockTemplateProposal(s *rpcServer, request *hdfjson.TemplateReque
 			}
 		}
 
-		rpcsLog.Infof("Rejected block proposal: %v", err)
+		rpcsLog.Infof("Rejected block proposal: %v (%v: %s)", err,
+			ruleErr.Err, ruleErr.Context())
 		return chainErrToGBTErrString(err), nil
 	}
 
@@ -2242,6 +2531,64 @@ func handleGetCurrentNet(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 	return s.cfg.ChainParams.Net, nil
 }
 
+// handleGetDeploymentInfo implements the getdeploymentinfo command.
+func handleGetDeploymentInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	params := s.cfg.ChainParams
+	chain := s.cfg.Chain
+	best := chain.BestSnapshot()
+
+	result := &hdfjson.GetDeploymentInfoResult{
+		Hash:        best.Hash.String(),
+		Height:      best.Height,
+		Deployments: make(map[string]*hdfjson.DeploymentInfo),
+	}
+	for id := range params.Deployments {
+		status, err := chain.DeploymentStatus(uint32(id))
+		if err != nil {
+			context := "Failed to obtain deployment status"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		statusString, err := softForkStatus(status.State)
+		if err != nil {
+			return nil, &hdfjson.RPCError{
+				Code: hdfjson.ErrRPCInternal.Code,
+				Message: fmt.Sprintf("unknown deployment status: %v",
+					status.State),
+			}
+		}
+
+		deployment := &params.Deployments[id]
+		bip9 := &hdfjson.Bip9DeploymentInfo{
+			Bit:       deployment.BitNumber,
+			StartTime: int64(deployment.StartTime),
+			Timeout:   int64(deployment.ExpireTime),
+			Status:    statusString,
+			Since:     status.Since,
+		}
+		if stats := status.Stats; stats != nil {
+			bip9.Statistics = &hdfjson.Bip9DeploymentStatistics{
+				Period:    stats.Period,
+				Threshold: stats.Threshold,
+				Elapsed:   stats.Elapsed,
+				Count:     stats.Count,
+				Possible:  stats.Possible,
+			}
+		}
+
+		info := &hdfjson.DeploymentInfo{
+			Type:   "bip9",
+			Active: status.State == blockchain.ThresholdActive,
+			Bip9:   bip9,
+		}
+		if info.Active {
+			info.Height = status.Since
+		}
+		result.Deployments[chaincfg.DeploymentName(id)] = info
+	}
+
+	return result, nil
+}
+
 // handleGetDifficulty implements the getdifficulty command.
 func handleGetDifficulty(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	best := s.cfg.Chain.BestSnapshot()
@@ -2318,6 +2665,26 @@ func handleGetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (in
 	return ret, nil
 }
 
+// handleGetMempoolEntry implements the getmempoolentry command.
+func handleGetMempoolEntry(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*hdfjson.GetMempoolEntryCmd)
+
+	txHash, err := chainhash.NewHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+
+	entry, err := s.cfg.TxMemPool.RawMempoolEntry(txHash)
+	if err != nil {
+		return nil, &hdfjson.RPCError{
+			Code:    hdfjson.ErrRPCInvalidAddressOrKey,
+			Message: "Transaction not in mempool",
+		}
+	}
+
+	return entry, nil
+}
+
 // handleGetMempoolInfo implements the getmempoolinfo command.
 func handleGetMempoolInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	mempoolTxns := s.cfg.TxMemPool.TxDescs()
@@ -2374,14 +2741,48 @@ func handleGetMiningInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 // handleGetNetTotals implements the getnettotals command.
 func handleGetNetTotals(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	totalBytesRecv, totalBytesSent := s.cfg.ConnMgr.NetTotals()
+	bandwidth := s.cfg.ConnMgr.BandwidthStats()
+	uploadTarget, downloadTarget := s.cfg.ConnMgr.NetTargets()
+	uploadLimit, downloadLimit := s.cfg.ConnMgr.RateLimits()
 	reply := &hdfjson.GetNetTotalsResult{
-		TotalBytesRecv: totalBytesRecv,
-		TotalBytesSent: totalBytesSent,
-		TimeMillis:     time.Now().UTC().UnixNano() / int64(time.Millisecond),
-	}
+		TotalBytesRecv:    totalBytesRecv,
+		TotalBytesSent:    totalBytesSent,
+		TimeMillis:        time.Now().UTC().UnixNano() / int64(time.Millisecond),
+		UploadTarget:      netTargetResult(&uploadTarget),
+		DownloadTarget:    netTargetResult(&downloadTarget),
+		BytesSentPerMsg:   bandwidth.BytesSentPerMsg,
+		BytesRecvPerMsg:   bandwidth.BytesRecvPerMsg,
+		SendRate:          bandwidth.SendRate,
+		RecvRate:          bandwidth.RecvRate,
+		UploadRateLimit:   rateLimitResult(&uploadLimit),
+		DownloadRateLimit: rateLimitResult(&downloadLimit),
+	}
+	reply.UploadTarget.ServeHistoricalBlocks = &uploadTarget.ServeHistoricalBlocks
 	return reply, nil
 }
 
+// netTargetResult converts the passed net target state to the result returned
+// by the getnettotals command.
+func netTargetResult(state *netTargetState) hdfjson.NetTargetResult {
+	return hdfjson.NetTargetResult{
+		TimeFrame:        int64(state.TimeFrame / time.Second),
+		Target:           state.Target,
+		TargetReached:    state.TargetReached,
+		BytesLeftInCycle: state.BytesLeftInCycle,
+		TimeLeftInCycle:  int64(state.TimeLeftInCycle / time.Second),
+	}
+}
+
+// rateLimitResult converts the passed rate limiter stats to the result
+// returned by the getnettotals command.
+func rateLimitResult(stats *peer.RateLimiterStats) hdfjson.RateLimitResult {
+	return hdfjson.RateLimitResult{
+		Rate:           stats.Rate,
+		ThrottledBytes: stats.ThrottledBytes,
+		ThrottledTime:  stats.ThrottledTime.Seconds(),
+	}
+}
+
 // handleGetNetworkHashPS implements the getnetworkhashps command.
 func handleGetNetworkHashPS(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Note: All valid error return paths should return an int64.
@@ -2482,28 +2883,36 @@ func handleGetPeerInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	syncPeerID := s.cfg.SyncMgr.SyncPeerID()
 	infos := make([]*hdfjson.GetPeerInfoResult, 0, len(peers))
 	for _, p := range peers {
-		statsSnap := p.ToPeer().StatsSnapshot()
+		statsSnap := p.ToPeer().StatsSnapshot2()
 		info := &hdfjson.GetPeerInfoResult{
-			ID:             statsSnap.ID,
-			Addr:           statsSnap.Addr,
-			AddrLocal:      p.ToPeer().LocalAddr().String(),
-			Services:       fmt.Sprintf("%08d", uint64(statsSnap.Services)),
-			RelayTxes:      !p.IsTxRelayDisabled(),
-			LastSend:       statsSnap.LastSend.Unix(),
-			LastRecv:       statsSnap.LastRecv.Unix(),
-			BytesSent:      statsSnap.BytesSent,
-			BytesRecv:      statsSnap.BytesRecv,
-			ConnTime:       statsSnap.ConnTime.Unix(),
-			PingTime:       float64(statsSnap.LastPingMicros),
-			TimeOffset:     statsSnap.TimeOffset,
-			Version:        statsSnap.Version,
-			SubVer:         statsSnap.UserAgent,
-			Inbound:        statsSnap.Inbound,
-			StartingHeight: statsSnap.StartingHeight,
-			CurrentHeight:  statsSnap.LastBlock,
-			BanScore:       int32(p.BanScore()),
-			FeeFilter:      p.FeeFilter(),
-			SyncNode:       statsSnap.ID == syncPeerID,
+			ID:              statsSnap.ID,
+			Addr:            statsSnap.Addr,
+			AddrLocal:       p.ToPeer().LocalAddr().String(),
+			Services:        fmt.Sprintf("%08d", uint64(statsSnap.Services)),
+			RelayTxes:       !p.IsTxRelayDisabled(),
+			LastSend:        statsSnap.LastSend.Unix(),
+			LastRecv:        statsSnap.LastRecv.Unix(),
+			BytesSent:       statsSnap.BytesSent,
+			BytesRecv:       statsSnap.BytesRecv,
+			ConnTime:        statsSnap.ConnTime.Unix(),
+			PingTime:        float64(statsSnap.LastPingMicros),
+			TimeOffset:      statsSnap.TimeOffset,
+			Version:         statsSnap.Version,
+			SubVer:          statsSnap.UserAgent,
+			Inbound:         statsSnap.Inbound,
+			StartingHeight:  statsSnap.StartingHeight,
+			CurrentHeight:   statsSnap.LastBlock,
+			BanScore:        int32(statsSnap.MisbehaviorScore),
+			FeeFilter:       p.FeeFilter(),
+			SyncNode:        statsSnap.ID == syncPeerID,
+			Bip152HBTo:      statsSnap.CmpctHBTo,
+			Bip152HBFrom:    statsSnap.CmpctHBFrom,
+			BytesSentPerMsg: statsSnap.Bandwidth.BytesSentPerMsg,
+			BytesRecvPerMsg: statsSnap.Bandwidth.BytesRecvPerMsg,
+		}
+		if statsSnap.Ping.Samples > 0 {
+			info.MinPing = float64(statsSnap.Ping.Min.Nanoseconds()) / 1000
+			info.PingP90 = float64(statsSnap.Ping.P90.Nanoseconds()) / 1000
 		}
 		if p.ToPeer().LastPingNonce() != 0 {
 			wait := float64(time.Since(statsSnap.LastPingTime).Nanoseconds())
@@ -2515,6 +2924,51 @@ func handleGetPeerInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return infos, nil
 }
 
+// rawAddrManEntries returns the passed contents of the new or tried buckets of
+// the address manager as reported by the getrawaddrman command.
+func rawAddrManEntries(buckets [][]*addrmgr.AddressInfo) []hdfjson.RawAddrManEntry {
+	entries := make([]hdfjson.RawAddrManEntry, 0)
+	for bucket, infos := range buckets {
+		for position, info := range infos {
+			entry := hdfjson.RawAddrManEntry{
+				Bucket:   bucket,
+				Position: position,
+				Address:  info.Addr.AddrString(),
+				Port:     info.Addr.Port,
+				Network:  addrNetworkName(info.Network),
+				Services: fmt.Sprintf("%08d",
+					uint64(info.Addr.Services)),
+				Time:     info.Addr.Timestamp.Unix(),
+				Attempts: info.Attempts,
+				MappedAS: info.ASN,
+			}
+			if !info.LastAttempt.IsZero() {
+				entry.LastAttempt = info.LastAttempt.Unix()
+			}
+			if !info.LastSuccess.IsZero() {
+				entry.LastSuccess = info.LastSuccess.Unix()
+			}
+			if info.Source != nil {
+				src := wire.NetAddressV2FromLegacy(info.Source)
+				entry.Source = src.AddrString()
+				entry.SourceNetwork = addrNetworkName(
+					addrmgr.AddrNetwork(src))
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// handleGetRawAddrMan implements the getrawaddrman command.
+func handleGetRawAddrMan(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	contents := s.cfg.AddrManager.BucketContents()
+	return &hdfjson.GetRawAddrManResult{
+		New:   rawAddrManEntries(contents.New),
+		Tried: rawAddrManEntries(contents.Tried),
+	}, nil
+}
+
 // handleGetRawMempool implements the getrawmempool command.
 func handleGetRawMempool(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*hdfjson.GetRawMempoolCmd)
@@ -2654,6 +3108,77 @@ func handleGetRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan str
 	return *rawTxn, nil
 }
 
+// limitedMethods returns a sorted list of the methods that are available to a
+// limited user.
+func limitedMethods() []string {
+	methods := make([]string, 0, len(rpcLimited))
+	for method := range rpcLimited {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// handleGetPeerRotations implements the getpeerrotations command.
+func handleGetPeerRotations(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	rotations := s.cfg.ConnMgr.PeerRotations()
+	results := make([]hdfjson.PeerRotationResult, 0, len(rotations))
+	for _, rotation := range rotations {
+		results = append(results, hdfjson.PeerRotationResult{
+			Time:     rotation.time.Unix(),
+			ID:       rotation.id,
+			Addr:     rotation.addr,
+			NetGroup: rotation.netGroup,
+		})
+	}
+
+	return &hdfjson.GetPeerRotationsResult{
+		Interval:  int64(cfg.PeerRotateInterval / time.Second),
+		Rotations: results,
+	}, nil
+}
+
+// handleGetRPCACL implements the getrpcacl command.
+func handleGetRPCACL(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	// Only include the users that are able to authenticate with the
+	// server.  This mirrors the logic used to set up the authentication
+	// when the server is created.
+	users := make([]hdfjson.RPCUserACL, 0, 2)
+	if cfg.RPCUser != "" && cfg.RPCPass != "" {
+		users = append(users, hdfjson.RPCUserACL{
+			User:  cfg.RPCUser,
+			Admin: true,
+		})
+	}
+	if cfg.RPCLimitUser != "" && cfg.RPCLimitPass != "" {
+		users = append(users, hdfjson.RPCUserACL{
+			User:    cfg.RPCLimitUser,
+			Admin:   false,
+			Methods: limitedMethods(),
+		})
+	}
+
+	return &hdfjson.GetRPCACLResult{
+		Users: users,
+		Limits: hdfjson.RPCLimitsResult{
+			MaxClients:         cfg.RPCMaxClients,
+			MaxWebsockets:      cfg.RPCMaxWebsockets,
+			MaxConcurrentReqs:  cfg.RPCMaxConcurrentReqs,
+			MaxWSSubscriptions: cfg.RPCMaxWSSubs,
+			MaxWSFilterSize:    cfg.RPCMaxWSFilterSize,
+		},
+	}, nil
+}
+
+// handleGetRPCWhitelist implements the getrpcwhitelist command.
+func handleGetRPCWhitelist(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	methods := make(map[string]struct{}, len(rpcLimited))
+	for method := range rpcLimited {
+		methods[method] = struct{}{}
+	}
+	return &hdfjson.GetRPCWhitelistResult{Methods: methods}, nil
+}
+
 // handleGetTxOut handles gettxout commands.
 func handleGetTxOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*hdfjson.GetTxOutCmd)
@@ -2799,6 +3324,45 @@ func handleHelp(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (inter
 	return help, nil
 }
 
+// handleInvalidateBlock implements the invalidateblock command.
+func handleInvalidateBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*hdfjson.InvalidateBlockCmd)
+
+	hash, err := chainhash.NewHashFromStr(c.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+	if _, err := s.cfg.Chain.HeaderByHash(hash); err != nil {
+		return nil, &hdfjson.RPCError{
+			Code:    hdfjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+
+	if err := s.cfg.Chain.InvalidateBlock(hash); err != nil {
+		context := "Failed to invalidate block"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	return nil, nil
+}
+
+// handleListBanned implements the listbanned command.
+func handleListBanned(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	now := time.Now()
+	bans := s.cfg.ConnMgr.ListBanned()
+	result := make([]hdfjson.ListBannedResult, 0, len(bans))
+	for _, ban := range bans {
+		result = append(result, hdfjson.ListBannedResult{
+			Address:       ban.Subnet.String(),
+			BanCreated:    ban.Created.Unix(),
+			BannedUntil:   ban.Expires.Unix(),
+			BanDuration:   int64(ban.Expires.Sub(ban.Created) / time.Second),
+			TimeRemaining: int64(ban.Expires.Sub(now) / time.Second),
+		})
+	}
+	return result, nil
+}
+
 // handlePing implements the ping command.
 func handlePing(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Ask server to ping \o_
@@ -2812,6 +3376,28 @@ func handlePing(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (inter
 	return nil, nil
 }
 
+// handleReconsiderBlock implements the reconsiderblock command.
+func handleReconsiderBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*hdfjson.ReconsiderBlockCmd)
+
+	hash, err := chainhash.NewHashFromStr(c.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+	if _, err := s.cfg.Chain.HeaderByHash(hash); err != nil {
+		return nil, &hdfjson.RPCError{
+			Code:    hdfjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+
+	if err := s.cfg.Chain.ReconsiderBlock(hash); err != nil {
+		context := "Failed to reconsider block"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	return nil, nil
+}
+
 // retrievedTx represents a transaction that was either loaded from the
 // transaction memory pool or from the database.  When a transaction is loaded
 // from the database, it is loaded with the raw serialized bytes while the
@@ -3340,9 +3926,17 @@ func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan st
 		rpcsLog.Debugf("Rejected transaction %v: %v", tx.Hash(), err)
 
 		// We'll then map the rule error to the appropriate RPC error,
-		// matching bitcoind's behavior.
+		// matching bitcoind's behavior.  Transactions which are not
+		// standard report the machine-readable reject reason followed
+		// by the details in the same way bitcoind does.
 		code := hdfjson.ErrRPCTxError
+		message := "TX rejected: " + err.Error()
 		if txRuleErr, ok := ruleErr.Err.(mempool.TxRuleError); ok {
+			if txRuleErr.Reason != mempool.ReasonNone {
+				message = fmt.Sprintf("TX rejected: %v (%v)",
+					txRuleErr.Reason, err)
+			}
+
 			errDesc := txRuleErr.Description
 			switch {
 			case strings.Contains(
@@ -3362,7 +3956,7 @@ func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan st
 
 		return nil, &hdfjson.RPCError{
 			Code:    code,
-			Message: "TX rejected: " + err.Error(),
+			Message: message,
 		}
 	}
 
@@ -3399,6 +3993,80 @@ func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan st
 	return tx.Hash().String(), nil
 }
 
+// handleSetBan implements the setban command.
+func handleSetBan(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*hdfjson.SetBanCmd)
+
+	subnet, err := connmgr.ParseSubnet(c.Subnet)
+	if err != nil {
+		return nil, &hdfjson.RPCError{
+			Code:    hdfjson.ErrRPCClientInvalidIPOrSubnet,
+			Message: "Invalid IP address or subnet: " + c.Subnet,
+		}
+	}
+
+	switch c.Command {
+	case hdfjson.SBAdd:
+		if s.cfg.ConnMgr.IsBanned(subnet) {
+			return nil, &hdfjson.RPCError{
+				Code:    hdfjson.ErrRPCClientNodeAlreadyAdded,
+				Message: "IP address or subnet already banned",
+			}
+		}
+
+		// The ban time is either a duration in seconds or, when it
+		// is absolute, the Unix time the ban expires.  A duration of
+		// zero or less selects the default ban duration.
+		var banTime int64
+		if c.BanTime != nil {
+			banTime = *c.BanTime
+		}
+		var expires time.Time
+		if c.Absolute != nil && *c.Absolute {
+			expires = time.Unix(banTime, 0)
+			if !expires.After(time.Now()) {
+				return nil, &hdfjson.RPCError{
+					Code:    hdfjson.ErrRPCInvalidParameter,
+					Message: "Absolute ban time is in the past",
+				}
+			}
+		} else {
+			duration := time.Duration(banTime) * time.Second
+			if banTime <= 0 {
+				duration = cfg.BanDuration
+			}
+			expires = time.Now().Add(duration)
+		}
+
+		if err := s.cfg.ConnMgr.SetBan(subnet, expires); err != nil {
+			context := "Failed to save ban list"
+			return nil, internalRPCError(err.Error(), context)
+		}
+
+	case hdfjson.SBRemove:
+		unbanned, err := s.cfg.ConnMgr.Unban(subnet)
+		if err != nil {
+			context := "Failed to save ban list"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		if !unbanned {
+			return nil, &hdfjson.RPCError{
+				Code:    hdfjson.ErrRPCClientInvalidIPOrSubnet,
+				Message: "IP address or subnet was not banned",
+			}
+		}
+
+	default:
+		return nil, &hdfjson.RPCError{
+			Code:    hdfjson.ErrRPCInvalidParameter,
+			Message: "invalid subcommand for setban",
+		}
+	}
+
+	// no data returned unless an error.
+	return nil, nil
+}
+
 // handleSetGenerate implements the setgenerate command.
 func handleSetGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*hdfjson.SetGenerateCmd)
@@ -3435,6 +4103,124 @@ func handleSetGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return nil, nil
 }
 
+// checkpointModeNames maps the checkpoint modes to the names used for them by
+// the setsyncoptions command and the --checkpointmode option.
+var checkpointModeNames = map[blockchain.CheckpointMode]string{
+	blockchain.CheckpointsEnforced: "enforce",
+	blockchain.CheckpointsAdvisory: "advisory",
+}
+
+// handleSetSyncOptions implements the setsyncoptions command.
+func handleSetSyncOptions(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*hdfjson.SetSyncOptionsCmd)
+
+	// Start with the current options so the ones which are not specified
+	// remain unchanged.
+	opts := s.cfg.SyncMgr.SyncOptions()
+	if c.MaxSyncPeers != nil {
+		opts.MaxSyncPeers = int(*c.MaxSyncPeers)
+	}
+	if c.CheckpointMode != nil {
+		found := false
+		for mode, name := range checkpointModeNames {
+			if name == *c.CheckpointMode {
+				opts.CheckpointMode = mode
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, &hdfjson.RPCError{
+				Code: hdfjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Invalid checkpoint mode %q "+
+					"-- supported modes {enforce, advisory}",
+					*c.CheckpointMode),
+			}
+		}
+	}
+	if err := s.cfg.SyncMgr.SetSyncOptions(&opts); err != nil {
+		return nil, &hdfjson.RPCError{
+			Code:    hdfjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+
+	opts = s.cfg.SyncMgr.SyncOptions()
+	return &hdfjson.SyncOptionsResult{
+		MaxSyncPeers:   int32(opts.MaxSyncPeers),
+		CheckpointMode: checkpointModeNames[opts.CheckpointMode],
+	}, nil
+}
+
+// handleSetTemplateOptions implements the settemplateoptions command.
+func handleSetTemplateOptions(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*hdfjson.SetTemplateOptionsCmd)
+
+	// Start with the current options so the ones which are not specified
+	// remain unchanged.
+	generator := s.cfg.Generator
+	opts := generator.TemplateOptions()
+	if c.CoinbaseData != nil {
+		coinbaseData, err := hex.DecodeString(*c.CoinbaseData)
+		if err != nil {
+			return nil, rpcDecodeHexError(*c.CoinbaseData)
+		}
+		opts.CoinbaseData = coinbaseData
+	}
+	if c.VersionBits != nil {
+		opts.VersionBits = 0
+		for _, bit := range *c.VersionBits {
+			if bit >= mining.NumVersionBits {
+				return nil, &hdfjson.RPCError{
+					Code: hdfjson.ErrRPCInvalidParameter,
+					Message: fmt.Sprintf("Version bit %d is "+
+						"not available for signalling "+
+						"(max %d)", bit,
+						mining.NumVersionBits-1),
+				}
+			}
+			opts.VersionBits |= 1 << bit
+		}
+	}
+	if c.MinTxFee != nil {
+		minTxFee, err := hdfutil.NewAmount(*c.MinTxFee)
+		if err != nil {
+			return nil, &hdfjson.RPCError{
+				Code:    hdfjson.ErrRPCInvalidParameter,
+				Message: "Invalid minimum fee rate: " + err.Error(),
+			}
+		}
+		opts.MinTxFeeRate = minTxFee
+	}
+	if err := generator.SetTemplateOptions(&opts); err != nil {
+		return nil, &hdfjson.RPCError{
+			Code:    hdfjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+
+	// Reset the previous best hash the current block template was
+	// generated against so the next getblocktemplate request generates a
+	// new template with the updated options.
+	state := s.gbtWorkState
+	state.Lock()
+	state.prevHash = nil
+	state.Unlock()
+
+	opts = generator.TemplateOptions()
+	versionBits := make([]uint32, 0, mining.NumVersionBits)
+	for bit := uint32(0); bit < mining.NumVersionBits; bit++ {
+		if opts.VersionBits&(1<<bit) != 0 {
+			versionBits = append(versionBits, bit)
+		}
+	}
+	return &hdfjson.TemplateOptionsResult{
+		CoinbaseData: hex.EncodeToString(opts.CoinbaseData),
+		VersionBits:  versionBits,
+		MinTxFee:     opts.MinTxFeeRate.ToHDF(),
+	}, nil
+}
+
 // handleStop implements the stop command.
 func handleStop(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	select {
@@ -3482,6 +4268,89 @@ func handleUptime(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (int
 	return time.Now().Unix() - s.cfg.StartupTime, nil
 }
 
+// handleSubmitPackage implements the submitpackage command.
+func handleSubmitPackage(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*hdfjson.SubmitPackageCmd)
+
+	// Deserialize the transactions of the package.
+	txns := make([]*hdfutil.Tx, 0, len(c.RawTxs))
+	for _, hexStr := range c.RawTxs {
+		if len(hexStr)%2 != 0 {
+			hexStr = "0" + hexStr
+		}
+		serializedTx, err := hex.DecodeString(hexStr)
+		if err != nil {
+			return nil, rpcDecodeHexError(hexStr)
+		}
+		var msgTx wire.MsgTx
+		err = msgTx.Deserialize(bytes.NewReader(serializedTx))
+		if err != nil {
+			return nil, &hdfjson.RPCError{
+				Code:    hdfjson.ErrRPCDeserialization,
+				Message: "TX decode failed: " + err.Error(),
+			}
+		}
+		txns = append(txns, hdfutil.NewTx(&msgTx))
+	}
+
+	acceptedTxs, err := s.cfg.TxMemPool.AcceptPackage(txns)
+	if err != nil {
+		// When the error is a rule error, it means the package was
+		// simply rejected as opposed to something actually going
+		// wrong, so log it as such.
+		if _, ok := err.(mempool.RuleError); !ok {
+			rpcsLog.Errorf("Failed to process package: %v", err)
+			return nil, &hdfjson.RPCError{
+				Code:    hdfjson.ErrRPCTxError,
+				Message: "Package rejected: " + err.Error(),
+			}
+		}
+
+		rpcsLog.Debugf("Rejected package: %v", err)
+		return nil, &hdfjson.RPCError{
+			Code:    hdfjson.ErrRPCTxRejected,
+			Message: "Package rejected: " + err.Error(),
+		}
+	}
+
+	// Generate and relay inventory vectors for all newly accepted
+	// transactions and notify both websocket and getblocktemplate long
+	// poll clients of them.
+	if len(acceptedTxs) > 0 {
+		s.cfg.ConnMgr.RelayTransactions(acceptedTxs)
+		s.NotifyNewTransactions(acceptedTxs)
+	}
+	accepted := make(map[chainhash.Hash]*mempool.TxDesc, len(acceptedTxs))
+	for _, txD := range acceptedTxs {
+		accepted[*txD.Tx.Hash()] = txD
+	}
+
+	result := &hdfjson.SubmitPackageResult{
+		Transactions: make([]hdfjson.SubmitPackageTxResult, 0, len(txns)),
+	}
+	for _, tx := range txns {
+		txResult := hdfjson.SubmitPackageTxResult{
+			TxID:  tx.Hash().String(),
+			WTxID: tx.MsgTx().WitnessHash().String(),
+			VSize: mempool.GetTxVirtualSize(tx),
+		}
+
+		// Keep track of the package transactions accepted by the
+		// request so that they can be rebroadcast if they don't make
+		// their way into a block.
+		if txD, ok := accepted[*tx.Hash()]; ok {
+			fee := hdfutil.Amount(txD.Fee).ToHDF()
+			txResult.Fee = &fee
+
+			iv := wire.NewInvVect(wire.InvTypeTx, tx.Hash())
+			s.cfg.ConnMgr.AddRebroadcastInventory(iv, txD)
+		}
+		result.Transactions = append(result.Transactions, txResult)
+	}
+
+	return result, nil
+}
+
 // handleValidateAddress implements the validateaddress command.
 func handleValidateAddress(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*hdfjson.ValidateAddressCmd)
@@ -3617,6 +4486,22 @@ func handleVerifyMessage(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 //
 // NOTE: This is a ifishnet extension ported from github.com/decred/dcrd.
 func handleVersion(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	// Report the optional subsystems which are enabled so callers can
+	// detect them instead of relying on the related RPCs failing.
+	var features []string
+	if s.cfg.TxIndex != nil {
+		features = append(features, "txindex")
+	}
+	if s.cfg.AddrIndex != nil {
+		features = append(features, "addrindex")
+	}
+	if s.cfg.CfIndex != nil {
+		features = append(features, "cfindex")
+	}
+	if s.cfg.Chain.IsPruned() {
+		features = append(features, "prune")
+	}
+
 	result := map[string]hdfjson.VersionResult{
 		"hdfdjsonrpcapi": {
 			VersionString: jsonrpcSemverString,
@@ -3624,6 +4509,17 @@ func handleVersion(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (in
 			Minor:         jsonrpcSemverMinor,
 			Patch:         jsonrpcSemverPatch,
 		},
+		"hdfd": {
+			VersionString: version(),
+			Major:         uint32(appMajor),
+			Minor:         uint32(appMinor),
+			Patch:         uint32(appPatch),
+			Prerelease:    normalizeVerString(appPreRelease),
+			BuildMetadata: normalizeVerString(appBuild),
+			GitCommit:     appGitCommit,
+			BuildDate:     appBuildDate,
+			Features:      features,
+		},
 	}
 	return result, nil
 }
@@ -3644,6 +4540,63 @@ type rpcServer struct {
 	helpCacher             *helpCacher
 	requestProcessShutdown chan struct{}
 	quit                   chan int
+
+	// The following fields track the startup work which is reported to
+	// clients while the server is warming up.  The chain state and related
+	// services in the config are only available once warmupDone is set.
+	warmupLock     sync.RWMutex
+	warmupDone     bool
+	warmupStatus   string
+	warmupProgress float64
+}
+
+// SetWarmupStatus updates the description and progress percentage of the
+// startup work, such as loading the block chain and catching up the optional
+// indexes, which is reported to clients while the server is warming up.
+//
+// This function is safe for concurrent access.
+func (s *rpcServer) SetWarmupStatus(status string, progress float64) {
+	s.warmupLock.Lock()
+	s.warmupStatus = status
+	s.warmupProgress = progress
+	s.warmupLock.Unlock()
+}
+
+// FinishWarmup ends the warm-up period of the server using the passed config
+// which provides the chain state and the related services that are only
+// available once the startup work is complete.  Commands which depend on them
+// are rejected with a warm-up error until this is called.
+//
+// This function is safe for concurrent access.
+func (s *rpcServer) FinishWarmup(config *rpcserverConfig) {
+	s.warmupLock.Lock()
+	s.cfg = *config
+	s.warmupDone = true
+	s.warmupLock.Unlock()
+
+	s.cfg.Chain.Subscribe(s.handleBlockchainNotification)
+}
+
+// warmupError returns an RPC error describing the startup work in progress
+// when the server is still warming up and the passed command is not available
+// until it is done.  It returns nil otherwise.
+//
+// This function is safe for concurrent access.
+func (s *rpcServer) warmupError(method string) error {
+	if _, ok := rpcWarmupAllowed[method]; ok {
+		return nil
+	}
+
+	s.warmupLock.RLock()
+	defer s.warmupLock.RUnlock()
+	if s.warmupDone {
+		return nil
+	}
+	return &hdfjson.RPCError{
+		Code: hdfjson.ErrRPCInWarmup,
+		Message: fmt.Sprintf("Node is loading: %s (%.2f%% complete)",
+			s.warmupStatus, s.warmupProgress),
+	}
 }
 
 // httpStatusLine returns a response Status-Line (RFC 2616 Section 6.1)
@@ -3744,6 +4697,13 @@ func (s *rpcServer) NotifyNewTransactions(txns []*mempool.TxDesc) {
 	}
 }
 
+// NotifyTxReplaced notifies websocket clients that the passed transaction was
+// evicted from the mempool because it was replaced by the passed replacement
+// transaction.
+func (s *rpcServer) NotifyTxReplaced(replaced, replacement *hdfutil.Tx) {
+	s.ntfnMgr.NotifyTxReplaced(replaced, replacement)
+}
+
 // limitConnections responds with a 503 service unavailable and returns true if
 // adding another client would exceed the maximum allow RPC clients.
 //
@@ -3778,6 +4738,95 @@ func (s *rpcServer) decrementClients() {
 	atomic.AddInt32(&s.numClients, -1)
 }
 
+// clientAddr returns the address of the client which sent the passed request.
+// This is the remote address of the connection unless it was made by one of
+// the passed trusted reverse proxies, in which case the addresses of the
+// X-Forwarded-For header are walked from the closest proxy outwards until an
+// address which is not a trusted proxy is found.  Malformed addresses stop the
+// walk, so the client is never identified by an address it fully controls
+// unless every proxy in front of it is trusted.
+func clientAddr(r *http.Request, trustedProxies []*net.IPNet) string {
+	if len(trustedProxies) == 0 {
+		return r.RemoteAddr
+	}
+
+	isTrusted := func(ip net.IP) bool {
+		for _, ipnet := range trustedProxies {
+			if ipnet.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isTrusted(ip) {
+		return r.RemoteAddr
+	}
+
+	var forwarded []string
+	for _, hdr := range r.Header["X-Forwarded-For"] {
+		forwarded = append(forwarded, strings.Split(hdr, ",")...)
+	}
+	addr := r.RemoteAddr
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if ip == nil {
+			break
+		}
+		addr = ip.String()
+		if !isTrusted(ip) {
+			break
+		}
+	}
+	return addr
+}
+
+// originAllowed returns whether cross-origin requests from the passed origin
+// are allowed by the passed list of allowed origins.  The allowed origins are
+// expected to be in lower case, and an allowed origin of * allows all origins.
+func originAllowed(origin string, allowedOrigins []string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// handleCORS sets the cross-origin resource sharing (CORS) headers of the
+// response to the passed request when it is a cross-origin request from an
+// allowed origin.  It returns true when the request is a CORS preflight request
+// which has been responded to, in which case it must not be processed further.
+//
+// Requests from origins which are not allowed are processed as usual without
+// the headers, so browsers refuse to expose their responses to the origin.
+func handleCORS(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || !originAllowed(origin, cfg.RPCAllowOrigins) {
+		return false
+	}
+
+	header := w.Header()
+	header.Set("Access-Control-Allow-Origin", origin)
+	header.Add("Vary", "Origin")
+	if r.Method != http.MethodOptions ||
+		r.Header.Get("Access-Control-Request-Method") == "" {
+
+		return false
+	}
+
+	header.Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	header.Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+	header.Set("Access-Control-Max-Age", "600")
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
 // checkAuth checks the HTTP Basic authentication supplied by a wallet
 // or RPC client in the HTTP request r.  If the supplied authentication
 // does not match the username and password expected, a non-nil error is
@@ -3794,7 +4843,7 @@ func (s *rpcServer) checkAuth(r *http.Request, require bool) (bool, bool, error)
 	if len(authhdr) <= 0 {
 		if require {
 			rpcsLog.Warnf("RPC authentication failure from %s",
-				r.RemoteAddr)
+				clientAddr(r, cfg.rpcTrustedProxies))
 			return false, false, errors.New("auth failure")
 		}
 
@@ -3817,7 +4866,8 @@ func (s *rpcServer) checkAuth(r *http.Request, require bool) (bool, bool, error)
 	}
 
 	// Request's auth doesn't match either user
-	rpcsLog.Warnf("RPC authentication failure from %s", r.RemoteAddr)
+	rpcsLog.Warnf("RPC authentication failure from %s",
+		clientAddr(r, cfg.rpcTrustedProxies))
 	return false, false, errors.New("auth failure")
 }
 
@@ -3836,6 +4886,10 @@ type parsedRPCCmd struct {
 // commands which are not recognized or not implemented will return an error
 // suitable for use in replies.
 func (s *rpcServer) standardCmdResult(cmd *parsedRPCCmd, closeChan <-chan struct{}) (interface{}, error) {
+	if err := s.warmupError(cmd.method); err != nil {
+		return nil, err
+	}
+
 	handler, ok := rpcHandlers[cmd.method]
 	if ok {
 		goto handled
@@ -4058,13 +5112,24 @@ func (s *rpcServer) Start() {
 		// handshake within the allowed timeframe.
 		ReadTimeout: time.Second * rpcAuthTimeoutSeconds,
 	}
-	rpcServeMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+
+	// The endpoints are served under the configured base path so they can
+	// be exposed behind reverse proxies which forward a path prefix.
+	basePath := cfg.RPCBasePath
+	rpcServeMux.HandleFunc(basePath+"/", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Connection", "close")
-		w.Header().Set("Content-Type", "application/json")
 		r.Close = true
 
+		// Respond to CORS preflight requests from allowed origins without
+		// requiring authentication since browsers never send credentials
+		// with them.
+		if handleCORS(w, r) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+
 		// Limit the number of connections to max allowed.
-		if s.limitConnections(w, r.RemoteAddr) {
+		if s.limitConnections(w, clientAddr(r, cfg.rpcTrustedProxies)) {
 			return
 		}
 
@@ -4082,7 +5147,18 @@ func (s *rpcServer) Start() {
 	})
 
 	// Websocket endpoint.
-	rpcServeMux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+	rpcServeMux.HandleFunc(basePath+"/ws", func(w http.ResponseWriter, r *http.Request) {
+		// Browsers do not apply the same-origin policy to websockets, so
+		// reject connections from other origins when cross-origin
+		// requests are restricted to a set of allowed origins.
+		origin := r.Header.Get("Origin")
+		if len(cfg.RPCAllowOrigins) > 0 && origin != "" &&
+			!originAllowed(origin, cfg.RPCAllowOrigins) {
+
+			http.Error(w, "403 Forbidden.", http.StatusForbidden)
+			return
+		}
+
 		authenticated, isAdmin, err := s.checkAuth(r, false)
 		if err != nil {
 			jsonAuthFail(w)
@@ -4100,7 +5176,8 @@ func (s *rpcServer) Start() {
 			http.Error(w, "400 Bad Request.", http.StatusBadRequest)
 			return
 		}
-		s.WebsocketHandler(ws, r.RemoteAddr, authenticated, isAdmin)
+		s.WebsocketHandler(ws, clientAddr(r, cfg.rpcTrustedProxies),
+			authenticated, isAdmin)
 	})
 
 	for _, listener := range s.cfg.Listeners {
@@ -4152,10 +5229,6 @@ type rpcserverPeer interface {
 	// transaction relay.
 	IsTxRelayDisabled() bool
 
-	// BanScore returns the current integer value that represents how close
-	// the peer is to being banned.
-	BanScore() uint32
-
 	// FeeFilter returns the requested current minimum fee rate for which
 	// transactions should be announced.
 	FeeFilter() int64
@@ -4201,6 +5274,19 @@ type rpcserverConnManager interface {
 	// network for all peers.
 	NetTotals() (uint64, uint64)
 
+	// BandwidthStats returns the bytes sent to and received from all
+	// peers per message command along with the current send and receive
+	// rates.
+	BandwidthStats() peer.BandwidthStats
+
+	// NetTargets returns the bytes sent and received during the current
+	// cycle relative to the upload and download targets.
+	NetTargets() (upload, download netTargetState)
+
+	// RateLimits returns the throttling performed by the upload and
+	// download rate limits of all peers combined.
+	RateLimits() (upload, download peer.RateLimiterStats)
+
 	// ConnectedPeers returns an array consisting of all connected peers.
 	ConnectedPeers() []rpcserverPeer
 
@@ -4220,6 +5306,25 @@ type rpcserverConnManager interface {
 	// RelayTransactions generates and relays inventory vectors for all of
 	// the passed transactions to all connected peers.
 	RelayTransactions(txns []*mempool.TxDesc)
+
+	// PeerRotations returns the history of the outbound peers disconnected
+	// by the periodic outbound peer rotation from oldest to newest.
+	PeerRotations() []peerRotation
+
+	// SetBan bans the provided subnet until the provided time and
+	// disconnects the connected peers in it.
+	SetBan(subnet *net.IPNet, expires time.Time) error
+
+	// IsBanned returns whether the provided subnet has been banned.  Only
+	// bans of that exact subnet are considered.
+	IsBanned(subnet *net.IPNet) bool
+
+	// Unban removes the ban of the provided subnet and returns whether it
+	// was banned.
+	Unban(subnet *net.IPNet) (bool, error)
+
+	// ListBanned returns the bans which have not expired.
+	ListBanned() []connmgr.Ban
 }
 
 // rpcserverSyncManager represents a sync manager for use with the RPC server.
@@ -4247,6 +5352,23 @@ type rpcserverSyncManager interface {
 	// current tip is reached, up to a max of wire.MaxBlockHeadersPerMsg
 	// hashes.
 	LocateHeaders(locators []*chainhash.Hash, hashStop *chainhash.Hash) []wire.BlockHeader
+
+	// BestHeader returns the hash and height of the best header synced in
+	// headers-only mode.  The final return value is false when the node is
+	// not in headers-only mode.
+	BestHeader() (*chainhash.Hash, int32, bool)
+
+	// VerificationProgress returns an estimate between 0 and 1 of how much
+	// of the chain has been validated.
+	VerificationProgress() float64
+
+	// SyncOptions returns the options of the sync manager which may be
+	// adjusted while it is running.
+	SyncOptions() netsync.SyncOptions
+
+	// SetSyncOptions replaces the options of the sync manager with the
+	// provided ones.
+	SetSyncOptions(opts *netsync.SyncOptions) error
 }
 
 // rpcserverConfig is a descriptor containing the RPC server configuration.
@@ -4270,6 +5392,10 @@ type rpcserverConfig struct {
 	// SyncMgr defines the sync manager for the RPC server to use.
 	SyncMgr rpcserverSyncManager
 
+	// AddrManager defines the address manager for the RPC server to use
+	// for inspecting the known peer addresses.
+	AddrManager *addrmgr.AddrManager
+
 	// These fields allow the RPC server to interface with the local block
 	// chain data and state.
 	TimeSource  blockchain.MedianTimeSource
@@ -4299,7 +5425,10 @@ type rpcserverConfig struct {
 	FeeEstimator *mempool.FeeEstimator
 }
 
-// newRPCServer returns a new instance of the rpcServer struct.
+// newRPCServer returns a new instance of the rpcServer struct.  The server
+// starts out warming up, so only the listeners, time source, chain parameters,
+// and database of the passed config need to be set.  The rest of the config is
+// provided once the startup work is complete via FinishWarmup.
 func newRPCServer(config *rpcserverConfig) (*rpcServer, error) {
 	rpc := rpcServer{
 		cfg:                    *config,
@@ -4308,6 +5437,7 @@ func newRPCServer(config *rpcserverConfig) (*rpcServer, error) {
 		helpCacher:             newHelpCacher(),
 		requestProcessShutdown: make(chan struct{}),
 		quit:                   make(chan int),
+		warmupStatus:           "Starting",
 	}
 	if cfg.RPCUser != "" && cfg.RPCPass != "" {
 		login := cfg.RPCUser + ":" + cfg.RPCPass
@@ -4320,7 +5450,6 @@ func newRPCServer(config *rpcserverConfig) (*rpcServer, error) {
 		rpc.limitauthsha = sha256.Sum256([]byte(auth))
 	}
 	rpc.ntfnMgr = newWsNotificationManager(&rpc)
-	rpc.cfg.Chain.Subscribe(rpc.handleBlockchainNotification)
 
 	return &rpc, nil
 }
@@ -0,0 +1,129 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net"
+	"net/http"
+	"testing"
+)
+
+// TestClientAddr ensures the client address of requests is only taken from
+// the X-Forwarded-For header as far as the forwarding proxies are trusted.
+func TestClientAddr(t *testing.T) {
+	t.Parallel()
+
+	trustedProxies := []*net.IPNet{
+		parseIPNet("127.0.0.1"),
+		parseIPNet("10.0.0.0/8"),
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		proxies    []*net.IPNet
+		want       string
+	}{{
+		name:       "no trusted proxies",
+		remoteAddr: "127.0.0.1:1234",
+		forwarded:  []string{"1.2.3.4"},
+		want:       "127.0.0.1:1234",
+	}, {
+		name:       "untrusted remote",
+		remoteAddr: "5.6.7.8:1234",
+		forwarded:  []string{"1.2.3.4"},
+		proxies:    trustedProxies,
+		want:       "5.6.7.8:1234",
+	}, {
+		name:       "trusted remote without header",
+		remoteAddr: "127.0.0.1:1234",
+		proxies:    trustedProxies,
+		want:       "127.0.0.1:1234",
+	}, {
+		name:       "trusted remote",
+		remoteAddr: "127.0.0.1:1234",
+		forwarded:  []string{"1.2.3.4"},
+		proxies:    trustedProxies,
+		want:       "1.2.3.4",
+	}, {
+		name:       "spoofed header entries are skipped",
+		remoteAddr: "127.0.0.1:1234",
+		forwarded:  []string{"9.9.9.9, 1.2.3.4, 10.1.2.3"},
+		proxies:    trustedProxies,
+		want:       "1.2.3.4",
+	}, {
+		name:       "multiple headers",
+		remoteAddr: "127.0.0.1:1234",
+		forwarded:  []string{"9.9.9.9", "1.2.3.4", "10.1.2.3"},
+		proxies:    trustedProxies,
+		want:       "1.2.3.4",
+	}, {
+		name:       "all addresses trusted",
+		remoteAddr: "127.0.0.1:1234",
+		forwarded:  []string{"10.1.2.3, 10.3.2.1"},
+		proxies:    trustedProxies,
+		want:       "10.1.2.3",
+	}, {
+		name:       "malformed address",
+		remoteAddr: "127.0.0.1:1234",
+		forwarded:  []string{"1.2.3.4, bogus"},
+		proxies:    trustedProxies,
+		want:       "127.0.0.1:1234",
+	}, {
+		name:       "ipv6",
+		remoteAddr: "127.0.0.1:1234",
+		forwarded:  []string{"2001:db8::1"},
+		proxies:    trustedProxies,
+		want:       "2001:db8::1",
+	}}
+
+	for _, test := range tests {
+		r := &http.Request{
+			RemoteAddr: test.remoteAddr,
+			Header:     make(http.Header),
+		}
+		for _, hdr := range test.forwarded {
+			r.Header.Add("X-Forwarded-For", hdr)
+		}
+		got := clientAddr(r, test.proxies)
+		if got != test.want {
+			t.Errorf("%s: unexpected client address: got %s, want %s",
+				test.name, got, test.want)
+		}
+	}
+}
+
+// TestOriginAllowed ensures cross-origin requests are only allowed from the
+// allowed origins.
+func TestOriginAllowed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		origin  string
+		allowed []string
+		want    bool
+	}{
+		{"no allowed origins", "https://example.com", nil, false},
+		{"allowed", "https://example.com", []string{"https://a.com",
+			"https://example.com"}, true},
+		{"case-insensitive", "HTTPS://Example.com",
+			[]string{"https://example.com"}, true},
+		{"different scheme", "http://example.com",
+			[]string{"https://example.com"}, false},
+		{"different port", "https://example.com:8080",
+			[]string{"https://example.com"}, false},
+		{"wildcard", "https://example.com", []string{"*"}, true},
+	}
+
+	for _, test := range tests {
+		got := originAllowed(test.origin, test.allowed)
+		if got != test.want {
+			t.Errorf("%s: unexpected result: got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+}
@@ -105,15 +105,40 @@ var helpDescsEnUS = map[string]string{
 	"decoderawtransaction-hextx":     "Serialized, hex-encoded transaction",
 
 	// DecodeScriptResult help.
-	"decodescriptresult-asm":       "Disassembly of the script",
-	"decodescriptresult-reqSigs":   "The number of required signatures",
-	"decodescriptresult-type":      "The type of the script (e.g. 'pubkeyhash')",
-	"decodescriptresult-addresses": "The bitcoin addresses associated with this script",
-	"decodescriptresult-p2sh":      "The script hash for use in pay-to-script-hash transactions (only present if the provided redeem script is not already a pay-to-script-hash script)",
+	"decodescriptresult-asm":         "Disassembly of the script",
+	"decodescriptresult-reqSigs":     "The number of required signatures",
+	"decodescriptresult-type":        "The type of the script (e.g. 'pubkeyhash')",
+	"decodescriptresult-addresses":   "The bitcoin addresses associated with this script",
+	"decodescriptresult-p2sh":        "The script hash for use in pay-to-script-hash transactions (only present if the provided redeem script is not already a pay-to-script-hash script)",
+	"decodescriptresult-trace":       "The opcodes executed when the script is executed on its own as the public key script of an output spent with an empty signature script (only present for verbosity=1)",
+	"decodescriptresult-traceresult": "Either success or the error which caused the execution to fail (only present for verbosity=1)",
+
+	// ScriptTraceStep help.
+	"scripttracestep-script":   "The index of the script the opcode is part of (0 = signature script, 1 = public key script, 2+ = redeem or witness scripts)",
+	"scripttracestep-index":    "The index of the opcode within the script",
+	"scripttracestep-opcode":   "Disassembly of the opcode",
+	"scripttracestep-executed": "Whether or not the opcode is part of an executed conditional branch",
+	"scripttracestep-stack":    "The hex-encoded items of the data stack after executing the opcode, top item last",
+	"scripttracestep-altstack": "The hex-encoded items of the alternate stack after executing the opcode, top item last",
+	"scripttracestep-error":    "The error which caused the execution to fail at the opcode",
 
 	// DecodeScriptCmd help.
 	"decodescript--synopsis": "Returns a JSON object with information about the provided hex-encoded script.",
 	"decodescript-hexscript": "Hex-encoded script",
+	"decodescript-verbosity": "Specify 1 to additionally execute the script and include the trace of the execution",
+
+	// DumpTxOutSetCmd help.
+	"dumptxoutset--synopsis": "Writes a snapshot of the utxo set as of the current best block to a file.\n" +
+		"Nodes are able to bootstrap their chain state from it via the --utxosnapshot option once the chain parameters commit to its hash or when its hash is provided via the --utxosnapshothash option.",
+	"dumptxoutset-path": "The path of the file to write the snapshot to which must not exist yet (relative paths are relative to the data directory)",
+
+	// DumpTxOutSetResult help.
+	"dumptxoutsetresult-coins_written": "The number of utxos written to the snapshot",
+	"dumptxoutsetresult-base_hash":     "The hash of the block the snapshot was taken at",
+	"dumptxoutsetresult-base_height":   "The height of the block the snapshot was taken at",
+	"dumptxoutsetresult-path":          "The absolute path of the written snapshot",
+	"dumptxoutsetresult-txoutset_hash": "The hash of the serialized utxo set",
+	"dumptxoutsetresult-nchaintx":      "The total number of transactions in the chain up to and including the block the snapshot was taken at",
 
 	// EstimateFeeCmd help.
 	"estimatefee--synopsis": "Estimate the fee per kilobyte in satoshis " +
@@ -124,6 +149,21 @@ var helpDescsEnUS = map[string]string{
 	"estimatefee--result0": "Estimated fee per kilobyte in satoshis for a block to " +
 		"be mined in the next NumBlocks blocks.",
 
+	// EstimateSmartFeeCmd help.
+	"estimatesmartfee--synopsis": "Estimate the fee per kilobyte in bitcoins " +
+		"required for a transaction to be confirmed within a certain number " +
+		"of blocks.",
+	"estimatesmartfee-conftarget": "The number of blocks the transaction " +
+		"should be confirmed within (1 to 1008)",
+	"estimatesmartfee-estimatemode": "The fee estimation mode, either " +
+		"ECONOMICAL or CONSERVATIVE -- Conservative estimates use a longer " +
+		"history and are less responsive to short term drops in fee rates",
+
+	// EstimateSmartFeeResult help.
+	"estimatesmartfeeresult-feerate": "The estimated fee per kilobyte in bitcoins, if there is enough data",
+	"estimatesmartfeeresult-errors":  "Errors encountered during processing",
+	"estimatesmartfeeresult-blocks":  "The number of blocks the estimate is for, which may differ from the requested target when there is not enough data for it",
+
 	// GenerateCmd help
 	"generate--synopsis": "Generates a set number of blocks (simnet or regtest only) and returns a JSON\n" +
 		" array of their hashes.",
@@ -147,6 +187,26 @@ var helpDescsEnUS = map[string]string{
 	"getaddednodeinfo--condition1": "dns=true",
 	"getaddednodeinfo--result0":    "List of added peers",
 
+	// GetAddrManInfoCmd help.
+	"getaddrmaninfo--synopsis": "Returns the number of addresses the address manager knows for each network along with the ASMap it groups addresses by, if any.",
+
+	// GetAddrManInfoResult help.
+	"getaddrmaninforesult-networks": "The number of addresses of each network the address manager knows addresses of",
+	"getaddrmaninforesult-new":      "The number of addresses in new buckets of all networks",
+	"getaddrmaninforesult-tried":    "The number of addresses in tried buckets of all networks",
+	"getaddrmaninforesult-total":    "The number of addresses of all networks",
+	"getaddrmaninforesult-asmap":    "The ASMap addresses are grouped by (only when --asmap is set)",
+
+	// AddrManNetworkResult help.
+	"addrmannetworkresult-network": "The network (ipv4, ipv6, torv2, torv3, i2p or cjdns)",
+	"addrmannetworkresult-new":     "The number of addresses of the network in new buckets",
+	"addrmannetworkresult-tried":   "The number of addresses of the network in tried buckets",
+	"addrmannetworkresult-total":   "The number of addresses of the network",
+
+	// ASMapResult help.
+	"asmapresult-size":     "The size of the ASMap in bytes",
+	"asmapresult-checksum": "The hex-encoded sha256 hash of the ASMap",
+
 	// GetBestBlockResult help.
 	"getbestblockresult-hash":   "Hex-encoded bytes of the best block hash",
 	"getbestblockresult-height": "Height of the best block",
@@ -181,6 +241,9 @@ var helpDescsEnUS = map[string]string{
 	"getblockchaininforesult-pruned":               "A bool that indicates if the node is pruned or not",
 	"getblockchaininforesult-pruneheight":          "The lowest block retained in the current pruned chain",
 	"getblockchaininforesult-chainwork":            "The total cumulative work in the best chain",
+	"getblockchaininforesult-bestheaderhash":       "The hash of the known block with the most cumulative work that is not known to be invalid",
+	"getblockchaininforesult-headerschainwork":     "The total cumulative work of the best known header",
+	"getblockchaininforesult-blocksbehind":         "The number of blocks the best chain is behind the best known header",
 	"getblockchaininforesult-softforks":            "The status of the super-majority soft-forks",
 	"getblockchaininforesult-unifiedsoftforks":     "The status of the super-majority soft-forks used by bitcoind on or after v0.19.0",
 
@@ -363,6 +426,17 @@ var helpDescsEnUS = map[string]string{
 	"getcurrentnet--synopsis": "Get bitcoin network the server is running on.",
 	"getcurrentnet--result0":  "The network identifer",
 
+	// GetDeploymentInfoCmd help.
+	"getdeploymentinfo--synopsis": "Returns the status of the rule change deployments defined for the network as of the block after the end of the best chain.",
+
+	// GetDeploymentInfoResult help.
+	"getdeploymentinforesult-hash":               "The hash of the best block the deployment states are evaluated from",
+	"getdeploymentinforesult-height":             "The height of the best block the deployment states are evaluated from",
+	"getdeploymentinforesult-deployments":        "JSON object describing each deployment",
+	"getdeploymentinforesult-deployments--key":   "name",
+	"getdeploymentinforesult-deployments--value": "An object describing the deployment",
+	"getdeploymentinforesult-deployments--desc":  "The status of each defined deployment keyed by its name",
+
 	// GetDifficultyCmd help.
 	"getdifficulty--synopsis": "Returns the proof-of-work difficulty as a multiple of the minimum difficulty.",
 	"getdifficulty--result0":  "The difficulty",
@@ -405,6 +479,47 @@ var helpDescsEnUS = map[string]string{
 	"infowalletresult-relayfee":        "The minimum relay fee for non-free transactions in BTC/KB",
 	"infowalletresult-errors":          "Any current errors",
 
+	// GetPeerRotationsCmd help.
+	"getpeerrotations--synopsis": "Returns the history of the outbound peers which were disconnected by the periodic peer rotation in order to be replaced by new peers in different network groups.",
+
+	// GetPeerRotationsResult help.
+	"getpeerrotationsresult-interval":  "The number of seconds between peer rotations (0 when disabled)",
+	"getpeerrotationsresult-rotations": "The most recent rotated peers from oldest to newest",
+
+	// PeerRotationResult help.
+	"peerrotationresult-time":     "The time the peer was rotated in seconds since 1 Jan 1970 GMT",
+	"peerrotationresult-id":       "The unique node ID of the rotated peer",
+	"peerrotationresult-addr":     "The ip address and port of the rotated peer",
+	"peerrotationresult-netgroup": "The network group of the rotated peer",
+
+	// GetRPCACLCmd help.
+	"getrpcacl--synopsis": "Returns the effective authorization policy of the RPC server, which includes the methods each configured user is authorized to use along with the limits imposed on clients.",
+
+	// GetRPCACLResult help.
+	"getrpcaclresult-users":  "The authorization policy of each configured RPC user",
+	"getrpcaclresult-limits": "The limits imposed on RPC clients",
+
+	// RPCUserACL help.
+	"rpcuseracl-user":    "The name of the user",
+	"rpcuseracl-admin":   "Whether or not the user is authorized to use every method",
+	"rpcuseracl-methods": "The methods the user is authorized to use (omitted for admin users)",
+
+	// RPCLimitsResult help.
+	"rpclimitsresult-maxclients":         "The maximum number of concurrent standard clients",
+	"rpclimitsresult-maxwebsockets":      "The maximum number of concurrent websocket clients",
+	"rpclimitsresult-maxconcurrentreqs":  "The maximum number of requests that are processed concurrently",
+	"rpclimitsresult-maxwssubscriptions": "The maximum number of addresses and outpoints a websocket client may request notifications for (0 means unlimited)",
+	"rpclimitsresult-maxwsfiltersize":    "The maximum number of addresses and outpoints a websocket client may load into its transaction filter (0 means unlimited)",
+
+	// GetRPCWhitelistCmd help.
+	"getrpcwhitelist--synopsis": "Returns the methods limited users are authorized to use.",
+
+	// GetRPCWhitelistResult help.
+	"getrpcwhitelistresult-methods":        "The methods limited users are authorized to use as the keys of an object",
+	"getrpcwhitelistresult-methods--key":   "method",
+	"getrpcwhitelistresult-methods--value": "{}",
+	"getrpcwhitelistresult-methods--desc":  "An empty object for each method limited users are authorized to use",
+
 	// GetHeadersCmd help.
 	"getheaders--synopsis":     "Returns block headers starting with the first known block hash from the request",
 	"getheaders-blocklocators": "JSON array of hex-encoded hashes of blocks.  Headers are returned starting from the first known hash in this list",
@@ -414,6 +529,36 @@ var helpDescsEnUS = map[string]string{
 	// GetInfoCmd help.
 	"getinfo--synopsis": "Returns a JSON object containing various state info.",
 
+	// GetMempoolEntryCmd help.
+	"getmempoolentry--synopsis": "Returns information about a transaction in the memory pool.",
+	"getmempoolentry-txid":      "The hash of the transaction",
+
+	// GetMempoolEntryResult help.
+	"getmempoolentryresult-vsize":              "The sigop-adjusted virtual size of the transaction",
+	"getmempoolentryresult-size":               "Transaction size in bytes",
+	"getmempoolentryresult-weight":             "The transaction's weight (between vsize*4-3 and vsize*4)",
+	"getmempoolentryresult-fee":                "Transaction fee in bitcoins (DEPRECATED: use fees.base)",
+	"getmempoolentryresult-modifiedfee":        "Transaction fee with fee deltas used for mining priority in bitcoins (DEPRECATED: use fees.modified)",
+	"getmempoolentryresult-time":               "Local time transaction entered pool in seconds since 1 Jan 1970 GMT",
+	"getmempoolentryresult-height":             "Block height when transaction entered the pool",
+	"getmempoolentryresult-descendantcount":    "Number of in-mempool descendant transactions, including this one",
+	"getmempoolentryresult-descendantsize":     "Virtual size of in-mempool descendants, including this one",
+	"getmempoolentryresult-descendantfees":     "Fees of in-mempool descendants, including this one, in bitcoins (DEPRECATED: use fees.descendant)",
+	"getmempoolentryresult-ancestorcount":      "Number of in-mempool ancestor transactions, including this one",
+	"getmempoolentryresult-ancestorsize":       "Virtual size of in-mempool ancestors, including this one",
+	"getmempoolentryresult-ancestorfees":       "Fees of in-mempool ancestors, including this one, in bitcoins (DEPRECATED: use fees.ancestor)",
+	"getmempoolentryresult-wtxid":              "The hash of the serialized transaction, including witness data",
+	"getmempoolentryresult-fees":               "The fees of the transaction and its packages in bitcoins",
+	"getmempoolentryresult-depends":            "Unconfirmed transactions used as inputs for this transaction",
+	"getmempoolentryresult-bip125-replaceable": "Whether the transaction could be replaced due to BIP125 (replace-by-fee)",
+	"getmempoolentryresult-unbroadcast":        "Whether the transaction is not yet known to have been broadcast to any peer",
+
+	// MempoolFees help.
+	"mempoolfees-base":       "Transaction fee in bitcoins",
+	"mempoolfees-modified":   "Transaction fee with fee deltas used for mining priority in bitcoins",
+	"mempoolfees-ancestor":   "Fees of in-mempool ancestors, including this one, in bitcoins",
+	"mempoolfees-descendant": "Fees of in-mempool descendants, including this one, in bitcoins",
+
 	// GetMempoolInfoCmd help.
 	"getmempoolinfo--synopsis": "Returns memory pool information",
 
@@ -448,32 +593,71 @@ var helpDescsEnUS = map[string]string{
 	"getnettotals--synopsis": "Returns a JSON object containing network traffic statistics.",
 
 	// GetNetTotalsResult help.
-	"getnettotalsresult-totalbytesrecv": "Total bytes received",
-	"getnettotalsresult-totalbytessent": "Total bytes sent",
-	"getnettotalsresult-timemillis":     "Number of milliseconds since 1 Jan 1970 GMT",
+	"getnettotalsresult-totalbytesrecv":           "Total bytes received",
+	"getnettotalsresult-totalbytessent":           "Total bytes sent",
+	"getnettotalsresult-timemillis":               "Number of milliseconds since 1 Jan 1970 GMT",
+	"getnettotalsresult-uploadtarget":             "The bytes sent during the current cycle relative to the upload target",
+	"getnettotalsresult-downloadtarget":           "The bytes received during the current cycle relative to the download target",
+	"getnettotalsresult-bytessent_per_msg":        "The total bytes sent keyed by message command",
+	"getnettotalsresult-bytessent_per_msg--key":   "command",
+	"getnettotalsresult-bytessent_per_msg--value": "The total bytes sent for messages with the command",
+	"getnettotalsresult-bytessent_per_msg--desc":  "Bytes not belonging to a known message are reported as *other*",
+	"getnettotalsresult-bytesrecv_per_msg":        "The total bytes received keyed by message command",
+	"getnettotalsresult-bytesrecv_per_msg--key":   "command",
+	"getnettotalsresult-bytesrecv_per_msg--value": "The total bytes received for messages with the command",
+	"getnettotalsresult-bytesrecv_per_msg--desc":  "Bytes not belonging to a known message are reported as *other*",
+	"getnettotalsresult-sendrate":                 "The bytes per second sent averaged over the last minute",
+	"getnettotalsresult-recvrate":                 "The bytes per second received averaged over the last minute",
+	"getnettotalsresult-uploadratelimit":          "The throttling performed by the upload rate limit of all peers combined",
+	"getnettotalsresult-downloadratelimit":        "The throttling performed by the download rate limit of all peers combined",
+
+	// NetTargetResult help.
+	"nettargetresult-timeframe":               "The length of a cycle in seconds",
+	"nettargetresult-target":                  "The target in bytes per cycle or 0 when there is none",
+	"nettargetresult-target_reached":          "Whether or not the target was reached during the current cycle",
+	"nettargetresult-serve_historical_blocks": "Whether or not blocks older than a week are still served to non-whitelisted peers during the current cycle (upload target only)",
+	"nettargetresult-bytes_left_in_cycle":     "The bytes which may still be transferred during the current cycle or 0 when there is no target",
+	"nettargetresult-time_left_in_cycle":      "The seconds until the current cycle ends",
+
+	// RateLimitResult help.
+	"ratelimitresult-rate":            "The max bytes per second or 0 when the rate is not limited",
+	"ratelimitresult-throttled_bytes": "The total bytes whose transfer was delayed by the limit",
+	"ratelimitresult-throttled_time":  "The total seconds transfers were delayed by the limit",
 
 	// GetPeerInfoResult help.
-	"getpeerinforesult-id":             "A unique node ID",
-	"getpeerinforesult-addr":           "The ip address and port of the peer",
-	"getpeerinforesult-addrlocal":      "Local address",
-	"getpeerinforesult-services":       "Services bitmask which represents the services supported by the peer",
-	"getpeerinforesult-relaytxes":      "Peer has requested transactions be relayed to it",
-	"getpeerinforesult-lastsend":       "Time the last message was received in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-lastrecv":       "Time the last message was sent in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-bytessent":      "Total bytes sent",
-	"getpeerinforesult-bytesrecv":      "Total bytes received",
-	"getpeerinforesult-conntime":       "Time the connection was made in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-timeoffset":     "The time offset of the peer",
-	"getpeerinforesult-pingtime":       "Number of microseconds the last ping took",
-	"getpeerinforesult-pingwait":       "Number of microseconds a queued ping has been waiting for a response",
-	"getpeerinforesult-version":        "The protocol version of the peer",
-	"getpeerinforesult-subver":         "The user agent of the peer",
-	"getpeerinforesult-inbound":        "Whether or not the peer is an inbound connection",
-	"getpeerinforesult-startingheight": "The latest block height the peer knew about when the connection was established",
-	"getpeerinforesult-currentheight":  "The current height of the peer",
-	"getpeerinforesult-banscore":       "The ban score",
-	"getpeerinforesult-feefilter":      "The requested minimum fee a transaction must have to be announced to the peer",
-	"getpeerinforesult-syncnode":       "Whether or not the peer is the sync peer",
+	"getpeerinforesult-id":                       "A unique node ID",
+	"getpeerinforesult-addr":                     "The ip address and port of the peer",
+	"getpeerinforesult-addrlocal":                "Local address",
+	"getpeerinforesult-services":                 "Services bitmask which represents the services supported by the peer",
+	"getpeerinforesult-relaytxes":                "Peer has requested transactions be relayed to it",
+	"getpeerinforesult-lastsend":                 "Time the last message was received in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-lastrecv":                 "Time the last message was sent in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-bytessent":                "Total bytes sent",
+	"getpeerinforesult-bytesrecv":                "Total bytes received",
+	"getpeerinforesult-conntime":                 "Time the connection was made in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-timeoffset":               "The time offset of the peer",
+	"getpeerinforesult-pingtime":                 "Number of microseconds the last ping took",
+	"getpeerinforesult-pingwait":                 "Number of microseconds a queued ping has been waiting for a response",
+	"getpeerinforesult-minping":                  "Number of microseconds the fastest of the recent pings took",
+	"getpeerinforesult-pingp90":                  "Number of microseconds 90 percent of the recent pings took at most",
+	"getpeerinforesult-version":                  "The protocol version of the peer",
+	"getpeerinforesult-subver":                   "The user agent of the peer",
+	"getpeerinforesult-inbound":                  "Whether or not the peer is an inbound connection",
+	"getpeerinforesult-startingheight":           "The latest block height the peer knew about when the connection was established",
+	"getpeerinforesult-currentheight":            "The current height of the peer",
+	"getpeerinforesult-banscore":                 "The ban score",
+	"getpeerinforesult-feefilter":                "The requested minimum fee a transaction must have to be announced to the peer",
+	"getpeerinforesult-syncnode":                 "Whether or not the peer is the sync peer",
+	"getpeerinforesult-bip152_hb_to":             "Whether or not the peer was selected to announce new blocks in high-bandwidth compact block mode",
+	"getpeerinforesult-bip152_hb_from":           "Whether or not the peer selected us to announce new blocks in high-bandwidth compact block mode",
+	"getpeerinforesult-bytessent_per_msg":        "The total bytes sent to the peer keyed by message command",
+	"getpeerinforesult-bytessent_per_msg--key":   "command",
+	"getpeerinforesult-bytessent_per_msg--value": "The total bytes sent for messages with the command",
+	"getpeerinforesult-bytessent_per_msg--desc":  "Bytes not belonging to a known message are reported as *other*",
+	"getpeerinforesult-bytesrecv_per_msg":        "The total bytes received from the peer keyed by message command",
+	"getpeerinforesult-bytesrecv_per_msg--key":   "command",
+	"getpeerinforesult-bytesrecv_per_msg--value": "The total bytes received for messages with the command",
+	"getpeerinforesult-bytesrecv_per_msg--desc":  "Bytes not belonging to a known message are reported as *other*",
 
 	// GetPeerInfoCmd help.
 	"getpeerinfo--synopsis": "Returns data about each connected network peer as an array of json objects.",
@@ -489,6 +673,28 @@ var helpDescsEnUS = map[string]string{
 	"getrawmempoolverboseresult-vsize":            "The virtual size of a transaction",
 	"getrawmempoolverboseresult-weight":           "The transaction's weight (between vsize*4-3 and vsize*4)",
 
+	// GetRawAddrManCmd help.
+	"getrawaddrman--synopsis": "Returns the contents of the new and tried buckets of the address manager for debugging, such as finding out whether they were polluted by the addresses of a single source.",
+
+	// GetRawAddrManResult help.
+	"getrawaddrmanresult-new":   "The addresses in new buckets, which are included once for each bucket they are in",
+	"getrawaddrmanresult-tried": "The addresses in tried buckets",
+
+	// RawAddrManEntry help.
+	"rawaddrmanentry-bucket":         "The bucket the address is in",
+	"rawaddrmanentry-position":       "The position of the address in the bucket",
+	"rawaddrmanentry-address":        "The address without the port",
+	"rawaddrmanentry-port":           "The port of the address",
+	"rawaddrmanentry-network":        "The network of the address (ipv4, ipv6, torv2, torv3, i2p or cjdns)",
+	"rawaddrmanentry-services":       "Services bitmask which represents the services the address was last known to support",
+	"rawaddrmanentry-time":           "The time the address was last seen in seconds since 1 Jan 1970 GMT",
+	"rawaddrmanentry-attempts":       "The number of connection attempts since the last successful connection",
+	"rawaddrmanentry-lastattempt":    "The time of the last connection attempt in seconds since 1 Jan 1970 GMT (0 when there was none)",
+	"rawaddrmanentry-lastsuccess":    "The time of the last successful connection in seconds since 1 Jan 1970 GMT (0 when there was none)",
+	"rawaddrmanentry-source":         "The address of the peer the address was first received from",
+	"rawaddrmanentry-source_network": "The network of the source address",
+	"rawaddrmanentry-mapped_as":      "The autonomous system the address is mapped to by the ASMap (only when it is mapped)",
+
 	// GetRawMempoolCmd help.
 	"getrawmempool--synopsis":   "Returns information about all of the transactions currently in the memory pool.",
 	"getrawmempool-verbose":     "Returns JSON object when true or an array of transaction hashes when false",
@@ -526,10 +732,29 @@ var helpDescsEnUS = map[string]string{
 	"help--result0":    "List of commands",
 	"help--result1":    "Help for specified command",
 
+	// InvalidateBlockCmd help.
+	"invalidateblock--synopsis": "Permanently marks a block as invalid along with all of its descendants and reorganizes the chain to the best remaining valid branch.",
+	"invalidateblock-blockhash": "The hash of the block to invalidate",
+
+	// ListBannedCmd help.
+	"listbanned--synopsis": "Returns the banned IP addresses and subnets.",
+
+	// ListBannedResult help.
+	"listbannedresult-address":        "The banned IP address or subnet in CIDR notation",
+	"listbannedresult-ban_created":    "The time the ban was created in seconds since 1 Jan 1970 GMT",
+	"listbannedresult-banned_until":   "The time the ban expires in seconds since 1 Jan 1970 GMT",
+	"listbannedresult-ban_duration":   "The total duration of the ban in seconds",
+	"listbannedresult-time_remaining": "The remaining duration of the ban in seconds",
+
 	// PingCmd help.
 	"ping--synopsis": "Queues a ping to be sent to each connected peer.\n" +
 		"Ping times are provided by getpeerinfo via the pingtime and pingwait fields.",
 
+	// ReconsiderBlockCmd help.
+	"reconsiderblock--synopsis": "Removes the invalid status from a block along with its ancestors and descendants and reorganizes the chain to the best valid branch.\n" +
+		"This undoes the effects of invalidateblock.",
+	"reconsiderblock-blockhash": "The hash of the block to reconsider",
+
 	// SearchRawTransactionsCmd help.
 	"searchrawtransactions--synopsis": "Returns raw data for transactions involving the passed address.\n" +
 		"Returned transactions are pulled from both the database, and transactions currently in the mempool.\n" +
@@ -554,11 +779,40 @@ var helpDescsEnUS = map[string]string{
 	"sendrawtransaction-maxfeerate":    "Used by bitcoind on or after v0.19.0",
 	"sendrawtransaction--result0":      "The hash of the transaction",
 
+	// SetBanCmd help.
+	"setban--synopsis": "Bans an IP address or subnet, or removes its ban.\n" +
+		"Connected peers in a banned subnet are disconnected and no connections to or from it are accepted until the ban expires.  " +
+		"Bans are kept across restarts.",
+	"setban-subnet":   "The IP address or subnet in CIDR notation, such as 192.168.0.1 or 192.168.0.0/24",
+	"setban-command":  "'add' to ban the IP address or subnet or 'remove' to remove its ban",
+	"setban-bantime":  "The duration of the ban in seconds, or the time it expires in seconds since 1 Jan 1970 GMT when absolute is set (0 or less for the default --banduration)",
+	"setban-absolute": "Whether the ban time is an absolute time rather than a duration",
+
 	// SetGenerateCmd help.
 	"setgenerate--synopsis":    "Set the server to generate coins (mine) or not.",
 	"setgenerate-generate":     "Use true to enable generation, false to disable it",
 	"setgenerate-genproclimit": "The number of processors (cores) to limit generation to or -1 for default",
 
+	// SetSyncOptionsCmd help.
+	"setsyncoptions--synopsis":      "Sets the options of the sync manager without restarting it and returns the resulting options.  The options which are not specified remain unchanged.",
+	"setsyncoptions-maxsyncpeers":   "The maximum number of candidate peers the sync peer is selected from (at least 1)",
+	"setsyncoptions-checkpointmode": "How the checkpoints are used {enforce, advisory} -- Enforced checkpoints skip validating the scripts of the blocks before them",
+
+	// SyncOptionsResult help.
+	"syncoptionsresult-maxsyncpeers":   "The maximum number of candidate peers the sync peer is selected from",
+	"syncoptionsresult-checkpointmode": "How the checkpoints are used (enforce or advisory)",
+
+	// SetTemplateOptionsCmd help.
+	"settemplateoptions--synopsis":    "Sets the options used to customize the generated block templates and returns the resulting options.  The options which are not specified remain unchanged.",
+	"settemplateoptions-coinbasedata": "Hex encoded data to add to the coinbase transaction script (max 73 bytes)",
+	"settemplateoptions-versionbits":  "The version bits (0-28) to signal for in addition to the bits of the rule change deployments",
+	"settemplateoptions-mintxfee":     "The minimum fee rate in BTC/kB of the transactions to include",
+
+	// TemplateOptionsResult help.
+	"templateoptionsresult-coinbasedata": "The hex encoded data added to the coinbase transaction script",
+	"templateoptionsresult-versionbits":  "The version bits signalled for in addition to the bits of the rule change deployments",
+	"templateoptionsresult-mintxfee":     "The minimum fee rate in BTC/kB of the transactions to include",
+
 	// StopCmd help.
 	"stop--synopsis": "Shutdown hdfd.",
 	"stop--result0":  "The string 'hdfd stopping.'",
@@ -574,6 +828,20 @@ var helpDescsEnUS = map[string]string{
 	"submitblock--condition1": "Block rejected",
 	"submitblock--result1":    "The reason the block was rejected",
 
+	// SubmitPackageCmd help.
+	"submitpackage--synopsis": "Submits a package of related transactions which is accepted to the memory pool atomically with the fees evaluated for the package as a whole, so a transaction paying a low fee can be accepted along with a child paying a higher fee.\n" +
+		"The transactions must be sorted so every transaction comes after the package transactions it spends.",
+	"submitpackage-rawtxs": "Serialized, hex-encoded transactions of the package",
+
+	// SubmitPackageResult help.
+	"submitpackageresult-transactions": "The transactions of the package in package order",
+
+	// SubmitPackageTxResult help.
+	"submitpackagetxresult-txid":  "The hash of the transaction",
+	"submitpackagetxresult-wtxid": "The witness hash of the transaction",
+	"submitpackagetxresult-vsize": "The virtual size of the transaction",
+	"submitpackagetxresult-fee":   "The fee paid by the transaction in BTC, omitted when it was already in the memory pool",
+
 	// ValidateAddressResult help.
 	"validateaddresschainresult-isvalid": "Whether or not the address is valid",
 	"validateaddresschainresult-address": "The bitcoin address (only when isvalid is true)",
@@ -606,7 +874,8 @@ var helpDescsEnUS = map[string]string{
 	"sessionresult-sessionid": "The unique session ID for a client's websocket connection.",
 
 	// NotifyBlocksCmd help.
-	"notifyblocks--synopsis": "Request notifications for whenever a block is connected or disconnected from the main (best) chain.",
+	"notifyblocks--synopsis":   "Request notifications for whenever a block is connected or disconnected from the main (best) chain.",
+	"notifyblocks-resumetoken": "Enables sequence numbers in block and new transaction notifications when provided. A non-empty token is the sequence of the last block notification processed and causes the notifications missed since to be replayed",
 
 	// StopNotifyBlocksCmd help.
 	"stopnotifyblocks--synopsis": "Cancel registered notifications for whenever a block is connected or disconnected from the main (best) chain.",
@@ -640,10 +909,11 @@ var helpDescsEnUS = map[string]string{
 	"stopnotifyspent-outpoints": "List of transaction outpoints to stop monitoring.",
 
 	// LoadTxFilterCmd help.
-	"loadtxfilter--synopsis": "Load, add to, or reload a websocket client's transaction filter for mempool transactions, new blocks and rescanblocks.",
-	"loadtxfilter-reload":    "Load a new filter instead of adding data to an existing one",
-	"loadtxfilter-addresses": "Array of addresses to add to the transaction filter",
-	"loadtxfilter-outpoints": "Array of outpoints to add to the transaction filter",
+	"loadtxfilter--synopsis":   "Load, add to, or reload a websocket client's transaction filter for mempool transactions, new blocks and rescanblocks.",
+	"loadtxfilter-reload":      "Load a new filter instead of adding data to an existing one",
+	"loadtxfilter-addresses":   "Array of addresses to add to the transaction filter",
+	"loadtxfilter-outpoints":   "Array of outpoints to add to the transaction filter",
+	"loadtxfilter-resumetoken": "Enables sequence numbers in block and new transaction notifications when provided. A non-empty token is the sequence of the last block notification processed and causes the filtered block notifications missed since to be replayed against the loaded filter",
 
 	// Rescan help.
 	"rescan--synopsis": "Rescan block chain for transactions to addresses.\n" +
@@ -669,7 +939,7 @@ var helpDescsEnUS = map[string]string{
 	"uptime--result0":  "The number of seconds that the server has been running",
 
 	// Version help.
-	"version--synopsis":       "Returns the JSON-RPC API version (semver)",
+	"version--synopsis":       "Returns the JSON-RPC API version (semver) along with the version, build info, and enabled features of the program",
 	"version--result0--desc":  "Version objects keyed by the program or API name",
 	"version--result0--key":   "Program or API name",
 	"version--result0--value": "Object containing the semantic version",
@@ -681,6 +951,9 @@ var helpDescsEnUS = map[string]string{
 	"versionresult-patch":         "The patch component of the JSON-RPC API version",
 	"versionresult-prerelease":    "Prerelease info about the current build",
 	"versionresult-buildmetadata": "Metadata about the current build",
+	"versionresult-gitcommit":     "The git commit the program was built from (only for the program and when known)",
+	"versionresult-builddate":     "The date the program was built (only for the program and when known)",
+	"versionresult-features":      "The optional subsystems enabled in the program: txindex, addrindex, cfindex, and prune (only for the program)",
 }
 
 // rpcResultTypes specifies the result types that each RPC command can return.
@@ -692,9 +965,12 @@ var rpcResultTypes = map[string][]interface{}{
 	"debuglevel":            {(*string)(nil), (*string)(nil)},
 	"decoderawtransaction":  {(*hdfjson.TxRawDecodeResult)(nil)},
 	"decodescript":          {(*hdfjson.DecodeScriptResult)(nil)},
+	"dumptxoutset":          {(*hdfjson.DumpTxOutSetResult)(nil)},
 	"estimatefee":           {(*float64)(nil)},
+	"estimatesmartfee":      {(*hdfjson.EstimateSmartFeeResult)(nil)},
 	"generate":              {(*[]string)(nil)},
 	"getaddednodeinfo":      {(*[]string)(nil), (*[]hdfjson.GetAddedNodeInfoResult)(nil)},
+	"getaddrmaninfo":        {(*hdfjson.GetAddrManInfoResult)(nil)},
 	"getbestblock":          {(*hdfjson.GetBestBlockResult)(nil)},
 	"getbestblockhash":      {(*string)(nil)},
 	"getblock":              {(*string)(nil), (*hdfjson.GetBlockVerboseResult)(nil)},
@@ -707,27 +983,40 @@ var rpcResultTypes = map[string][]interface{}{
 	"getcfilterheader":      {(*string)(nil)},
 	"getconnectioncount":    {(*int32)(nil)},
 	"getcurrentnet":         {(*uint32)(nil)},
+	"getdeploymentinfo":     {(*hdfjson.GetDeploymentInfoResult)(nil)},
 	"getdifficulty":         {(*float64)(nil)},
 	"getgenerate":           {(*bool)(nil)},
 	"gethashespersec":       {(*float64)(nil)},
 	"getheaders":            {(*[]string)(nil)},
 	"getinfo":               {(*hdfjson.InfoChainResult)(nil)},
+	"getmempoolentry":       {(*hdfjson.GetMempoolEntryResult)(nil)},
 	"getmempoolinfo":        {(*hdfjson.GetMempoolInfoResult)(nil)},
 	"getmininginfo":         {(*hdfjson.GetMiningInfoResult)(nil)},
 	"getnettotals":          {(*hdfjson.GetNetTotalsResult)(nil)},
 	"getnetworkhashps":      {(*int64)(nil)},
 	"getpeerinfo":           {(*[]hdfjson.GetPeerInfoResult)(nil)},
+	"getpeerrotations":      {(*hdfjson.GetPeerRotationsResult)(nil)},
+	"getrawaddrman":         {(*hdfjson.GetRawAddrManResult)(nil)},
 	"getrawmempool":         {(*[]string)(nil), (*hdfjson.GetRawMempoolVerboseResult)(nil)},
 	"getrawtransaction":     {(*string)(nil), (*hdfjson.TxRawResult)(nil)},
+	"getrpcacl":             {(*hdfjson.GetRPCACLResult)(nil)},
+	"getrpcwhitelist":       {(*hdfjson.GetRPCWhitelistResult)(nil)},
 	"gettxout":              {(*hdfjson.GetTxOutResult)(nil)},
 	"node":                  nil,
 	"help":                  {(*string)(nil), (*string)(nil)},
+	"invalidateblock":       nil,
+	"listbanned":            {(*[]hdfjson.ListBannedResult)(nil)},
 	"ping":                  nil,
+	"reconsiderblock":       nil,
 	"searchrawtransactions": {(*string)(nil), (*[]hdfjson.SearchRawTransactionsResult)(nil)},
 	"sendrawtransaction":    {(*string)(nil)},
+	"setban":                nil,
 	"setgenerate":           nil,
+	"setsyncoptions":        {(*hdfjson.SyncOptionsResult)(nil)},
+	"settemplateoptions":    {(*hdfjson.TemplateOptionsResult)(nil)},
 	"stop":                  {(*string)(nil)},
 	"submitblock":           {nil, (*string)(nil)},
+	"submitpackage":         {(*hdfjson.SubmitPackageResult)(nil)},
 	"uptime":                {(*int64)(nil)},
 	"validateaddress":       {(*hdfjson.ValidateAddressChainResult)(nil)},
 	"verifychain":           {(*bool)(nil)},
@@ -17,6 +17,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"strconv"
 	"sync"
 	"time"
 
@@ -246,6 +247,25 @@ func (m *wsNotificationManager) NotifyMempoolTx(tx *hdfutil.Tx, isNew bool) {
 	}
 }
 
+// NotifyTxReplaced passes a transaction evicted from the mempool because it
+// was replaced through the RBF policy to the notification manager for
+// transaction notification processing.
+func (m *wsNotificationManager) NotifyTxReplaced(replaced, replacement *hdfutil.Tx) {
+	n := &notificationTxReplaced{
+		replaced:    replaced,
+		replacement: replacement,
+	}
+
+	// As NotifyTxReplaced will be called by mempool and the RPC server
+	// may no longer be running, use a select statement to unblock
+	// enqueuing the notification once the RPC server has begun
+	// shutting down.
+	select {
+	case m.queueNotification <- n:
+	case <-m.quit:
+	}
+}
+
 // wsClientFilter tracks relevant addresses for each websocket client for
 // the `rescanblocks` extension. It is modified by the `loadtxfilter` command.
 //
@@ -292,6 +312,16 @@ func newWSClientFilter(addresses []string, unspentOutPoints []wire.OutPoint, par
 	return filter
 }
 
+// size returns the total number of addresses and unspent outpoints the
+// filter is watching.
+//
+// This function MUST be called with the filter lock held.
+func (f *wsClientFilter) size() int {
+	return len(f.pubKeyHashes) + len(f.scriptHashes) +
+		len(f.compressedPubKeys) + len(f.uncompressedPubKeys) +
+		len(f.otherAddresses) + len(f.unspent)
+}
+
 // addAddress adds an address to a wsClientFilter, treating it correctly based
 // on the type of address passed as an argument.
 //
@@ -451,6 +481,10 @@ type notificationTxAcceptedByMempool struct {
 	isNew bool
 	tx    *hdfutil.Tx
 }
+type notificationTxReplaced struct {
+	replaced    *hdfutil.Tx
+	replacement *hdfutil.Tx
+}
 
 // Notification control requests
 type notificationRegisterClient wsClient
@@ -475,6 +509,37 @@ type notificationUnregisterAddr struct {
 	wsc  *wsClient
 	addr string
 }
+type notificationResumeBlocks struct {
+	wsc          *wsClient
+	resumeToken  string
+	register     bool
+	filteredOnly bool
+	result       chan error
+}
+
+// wsBlockNtfnReplayLimit is the maximum number of recent block connected and
+// disconnected events the notification manager retains so they can be
+// replayed to clients resuming their block notifications.
+const wsBlockNtfnReplayLimit = 32
+
+// blockNtfnEvent describes a block connected or disconnected event along with
+// its position in the block notification sequence.
+type blockNtfnEvent struct {
+	seq       uint64
+	block     *hdfutil.Block
+	connected bool
+}
+
+// initialNtfnSequence returns the sequence number the notification streams
+// start from.  It is derived from the current time so that the sequence keeps
+// increasing across restarts of the server, which causes resume tokens issued
+// by a previous instance to be detected as expired rather than be matched
+// against unrelated events.  Shifting the time by 16 bits leaves room for
+// 65536 events per second of uptime while keeping the values representable
+// as integers by JSON clients that use double precision numbers.
+func initialNtfnSequence() uint64 {
+	return uint64(time.Now().Unix()) << 16
+}
 
 // notificationHandler reads notifications and control messages from the queue
 // handler and processes one at a time.
@@ -494,6 +559,25 @@ func (m *wsNotificationManager) notificationHandler() {
 	watchedOutPoints := make(map[wire.OutPoint]map[chan struct{}]*wsClient)
 	watchedAddrs := make(map[string]map[chan struct{}]*wsClient)
 
+	// The sequence numbers of the most recent block and new mempool
+	// transaction notifications along with the recent block events that
+	// may be replayed to resuming clients.
+	blockSeq := initialNtfnSequence()
+	txSeq := blockSeq
+	recentBlocks := make([]blockNtfnEvent, 0, wsBlockNtfnReplayLimit)
+	addRecentBlock := func(block *hdfutil.Block, connected bool) {
+		blockSeq++
+		if len(recentBlocks) == wsBlockNtfnReplayLimit {
+			copy(recentBlocks, recentBlocks[1:])
+			recentBlocks = recentBlocks[:len(recentBlocks)-1]
+		}
+		recentBlocks = append(recentBlocks, blockNtfnEvent{
+			seq:       blockSeq,
+			block:     block,
+			connected: connected,
+		})
+	}
+
 out:
 	for {
 		select {
@@ -505,6 +589,7 @@ out:
 			switch n := n.(type) {
 			case *notificationBlockConnected:
 				block := (*hdfutil.Block)(n)
+				addRecentBlock(block, true)
 
 				// Skip iterating through all txs if no
 				// tx notification requests exist.
@@ -517,28 +602,39 @@ out:
 
 				if len(blockNotifications) != 0 {
 					m.notifyBlockConnected(blockNotifications,
-						block)
+						block, blockSeq)
 					m.notifyFilteredBlockConnected(blockNotifications,
-						block)
+						block, blockSeq)
 				}
 
 			case *notificationBlockDisconnected:
 				block := (*hdfutil.Block)(n)
+				addRecentBlock(block, false)
 
 				if len(blockNotifications) != 0 {
 					m.notifyBlockDisconnected(blockNotifications,
-						block)
+						block, blockSeq)
 					m.notifyFilteredBlockDisconnected(blockNotifications,
-						block)
+						block, blockSeq)
 				}
 
 			case *notificationTxAcceptedByMempool:
-				if n.isNew && len(txNotifications) != 0 {
-					m.notifyForNewTx(txNotifications, n.tx)
+				if n.isNew {
+					txSeq++
+					if len(txNotifications) != 0 {
+						m.notifyForNewTx(txNotifications,
+							n.tx, txSeq)
+					}
 				}
 				m.notifyForTx(watchedOutPoints, watchedAddrs, n.tx, nil)
 				m.notifyRelevantTxAccepted(n.tx, clients)
 
+			case *notificationTxReplaced:
+				if len(txNotifications) != 0 {
+					m.notifyTxReplaced(txNotifications,
+						n.replaced, n.replacement)
+				}
+
 			case *notificationRegisterBlocks:
 				wsc := (*wsClient)(n)
 				blockNotifications[wsc.quit] = wsc
@@ -547,6 +643,10 @@ out:
 				wsc := (*wsClient)(n)
 				delete(blockNotifications, wsc.quit)
 
+			case *notificationResumeBlocks:
+				n.result <- m.resumeBlocks(n, blockNotifications,
+					recentBlocks, blockSeq)
+
 			case *notificationRegisterClient:
 				wsc := (*wsClient)(n)
 				clients[wsc.quit] = wsc
@@ -568,12 +668,14 @@ out:
 
 			case *notificationRegisterSpent:
 				m.addSpentRequests(watchedOutPoints, n.wsc, n.ops)
+				n.wsc.releaseSubscriptions(len(n.ops))
 
 			case *notificationUnregisterSpent:
 				m.removeSpentRequest(watchedOutPoints, n.wsc, n.op)
 
 			case *notificationRegisterAddr:
 				m.addAddrRequests(watchedAddrs, n.wsc, n.addrs)
+				n.wsc.releaseSubscriptions(len(n.addrs))
 
 			case *notificationUnregisterAddr:
 				m.removeAddrRequest(watchedAddrs, n.wsc, n.addr)
@@ -625,6 +727,96 @@ func (m *wsNotificationManager) UnregisterBlockUpdates(wsc *wsClient) {
 	m.queueNotification <- (*notificationUnregisterBlocks)(wsc)
 }
 
+// ResumeBlockUpdates enables sequenced notifications for the passed websocket
+// client and replays the block notifications that follow the one identified
+// by resumeToken, if it is not empty.  When register is true, the client is
+// also registered for block update notifications, and when filteredOnly is
+// true, only the filtered block notifications are replayed.
+//
+// The request is processed by the notification manager in order with the
+// block events, so no notification is missed or delivered twice between the
+// replayed and the new notifications.  An error is returned when the resume
+// token is invalid or the notifications following it are no longer retained.
+func (m *wsNotificationManager) ResumeBlockUpdates(wsc *wsClient,
+	resumeToken string, register, filteredOnly bool) error {
+
+	result := make(chan error, 1)
+	m.queueNotification <- &notificationResumeBlocks{
+		wsc:          wsc,
+		resumeToken:  resumeToken,
+		register:     register,
+		filteredOnly: filteredOnly,
+		result:       result,
+	}
+	select {
+	case err := <-result:
+		return err
+	case <-m.quit:
+		return nil
+	}
+}
+
+// resumeBlocks handles a notificationResumeBlocks request for the
+// notification handler given the current set of clients registered for block
+// updates, the retained recent block events and the sequence number of the
+// latest block event.
+func (m *wsNotificationManager) resumeBlocks(n *notificationResumeBlocks,
+	blockNotifications map[chan struct{}]*wsClient,
+	recentBlocks []blockNtfnEvent, blockSeq uint64) error {
+
+	// Validate the resume token before modifying any state.  Any events
+	// following the token must still be retained for the client to be able
+	// to resume without missing a notification.
+	after := blockSeq
+	if n.resumeToken != "" {
+		var err error
+		after, err = strconv.ParseUint(n.resumeToken, 10, 64)
+		if err != nil || after > blockSeq {
+			return &hdfjson.RPCError{
+				Code:    hdfjson.ErrRPCInvalidParameter,
+				Message: "Invalid resume token: " + n.resumeToken,
+			}
+		}
+		oldest := blockSeq + 1
+		if len(recentBlocks) != 0 {
+			oldest = recentBlocks[0].seq
+		}
+		if after+1 < oldest {
+			return &ErrWSResumeTokenExpired
+		}
+	}
+
+	wsc := n.wsc
+	wsc.sequencedNtfns = true
+	if n.register {
+		blockNotifications[wsc.quit] = wsc
+	}
+
+	clients := map[chan struct{}]*wsClient{wsc.quit: wsc}
+	for _, event := range recentBlocks {
+		if event.seq <= after {
+			continue
+		}
+		switch {
+		case event.connected && n.filteredOnly:
+			m.notifyFilteredBlockConnected(clients, event.block,
+				event.seq)
+		case event.connected:
+			m.notifyBlockConnected(clients, event.block, event.seq)
+			m.notifyFilteredBlockConnected(clients, event.block,
+				event.seq)
+		case n.filteredOnly:
+			m.notifyFilteredBlockDisconnected(clients, event.block,
+				event.seq)
+		default:
+			m.notifyBlockDisconnected(clients, event.block, event.seq)
+			m.notifyFilteredBlockDisconnected(clients, event.block,
+				event.seq)
+		}
+	}
+	return nil
+}
+
 // subscribedClients returns the set of all websocket client quit channels that
 // are registered to receive notifications regarding tx, either due to tx
 // spending a watched output or outputting to a watched address.  Matching
@@ -688,9 +880,11 @@ func (m *wsNotificationManager) subscribedClients(tx *hdfutil.Tx,
 }
 
 // notifyBlockConnected notifies websocket clients that have registered for
-// block updates when a block is connected to the main chain.
+// block updates when a block is connected to the main chain.  The sequence
+// number of the event is only included for clients that requested sequenced
+// notifications.
 func (*wsNotificationManager) notifyBlockConnected(clients map[chan struct{}]*wsClient,
-	block *hdfutil.Block) {
+	block *hdfutil.Block, seq uint64) {
 
 	// Notify interested websocket clients about the connected block.
 	ntfn := hdfjson.NewBlockConnectedNtfn(block.Hash().String(), block.Height(),
@@ -701,7 +895,18 @@ func (*wsNotificationManager) notifyBlockConnected(clients map[chan struct{}]*ws
 			"%v", err)
 		return
 	}
+	ntfn.Sequence = &seq
+	marshalledSeqJSON, err := hdfjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal block connected notification: "+
+			"%v", err)
+		return
+	}
 	for _, wsc := range clients {
+		if wsc.sequencedNtfns {
+			wsc.QueueNotification(marshalledSeqJSON)
+			continue
+		}
 		wsc.QueueNotification(marshalledJSON)
 	}
 }
@@ -709,7 +914,9 @@ func (*wsNotificationManager) notifyBlockConnected(clients map[chan struct{}]*ws
 // notifyBlockDisconnected notifies websocket clients that have registered for
 // block updates when a block is disconnected from the main chain (due to a
 // reorganize).
-func (*wsNotificationManager) notifyBlockDisconnected(clients map[chan struct{}]*wsClient, block *hdfutil.Block) {
+func (*wsNotificationManager) notifyBlockDisconnected(clients map[chan struct{}]*wsClient,
+	block *hdfutil.Block, seq uint64) {
+
 	// Skip notification creation if no clients have requested block
 	// connected/disconnected notifications.
 	if len(clients) == 0 {
@@ -725,7 +932,18 @@ func (*wsNotificationManager) notifyBlockDisconnected(clients map[chan struct{}]
 			"notification: %v", err)
 		return
 	}
+	ntfn.Sequence = &seq
+	marshalledSeqJSON, err := hdfjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal block disconnected "+
+			"notification: %v", err)
+		return
+	}
 	for _, wsc := range clients {
+		if wsc.sequencedNtfns {
+			wsc.QueueNotification(marshalledSeqJSON)
+			continue
+		}
 		wsc.QueueNotification(marshalledJSON)
 	}
 }
@@ -733,7 +951,7 @@ func (*wsNotificationManager) notifyBlockDisconnected(clients map[chan struct{}]
 // notifyFilteredBlockConnected notifies websocket clients that have registered for
 // block updates when a block is connected to the main chain.
 func (m *wsNotificationManager) notifyFilteredBlockConnected(clients map[chan struct{}]*wsClient,
-	block *hdfutil.Block) {
+	block *hdfutil.Block, seq uint64) {
 
 	// Create the common portion of the notification that is the same for
 	// every client.
@@ -763,6 +981,10 @@ func (m *wsNotificationManager) notifyFilteredBlockConnected(clients map[chan st
 		// Add all discovered transactions for this client. For clients
 		// that have no new-style filter, add the empty string slice.
 		ntfn.SubscribedTxs = subscribedTxs[quitChan]
+		ntfn.Sequence = nil
+		if wsc.sequencedNtfns {
+			ntfn.Sequence = &seq
+		}
 
 		// Marshal and queue notification.
 		marshalledJSON, err := hdfjson.MarshalCmd(nil, ntfn)
@@ -779,7 +1001,7 @@ func (m *wsNotificationManager) notifyFilteredBlockConnected(clients map[chan st
 // block updates when a block is disconnected from the main chain (due to a
 // reorganize).
 func (*wsNotificationManager) notifyFilteredBlockDisconnected(clients map[chan struct{}]*wsClient,
-	block *hdfutil.Block) {
+	block *hdfutil.Block, seq uint64) {
 	// Skip notification creation if no clients have requested block
 	// connected/disconnected notifications.
 	if len(clients) == 0 {
@@ -802,7 +1024,18 @@ func (*wsNotificationManager) notifyFilteredBlockDisconnected(clients map[chan s
 			"notification: %v", err)
 		return
 	}
+	ntfn.Sequence = &seq
+	marshalledSeqJSON, err := hdfjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal filtered block disconnected "+
+			"notification: %v", err)
+		return
+	}
 	for _, wsc := range clients {
+		if wsc.sequencedNtfns {
+			wsc.QueueNotification(marshalledSeqJSON)
+			continue
+		}
 		wsc.QueueNotification(marshalledJSON)
 	}
 }
@@ -820,8 +1053,12 @@ func (m *wsNotificationManager) UnregisterNewMempoolTxsUpdates(wsc *wsClient) {
 }
 
 // notifyForNewTx notifies websocket clients that have registered for updates
-// when a new transaction is added to the memory pool.
-func (m *wsNotificationManager) notifyForNewTx(clients map[chan struct{}]*wsClient, tx *hdfutil.Tx) {
+// when a new transaction is added to the memory pool.  The sequence number of
+// the event is only included for clients that requested sequenced
+// notifications.
+func (m *wsNotificationManager) notifyForNewTx(clients map[chan struct{}]*wsClient,
+	tx *hdfutil.Tx, seq uint64) {
+
 	txHashStr := tx.Hash().String()
 	mtx := tx.MsgTx()
 
@@ -836,16 +1073,26 @@ func (m *wsNotificationManager) notifyForNewTx(clients map[chan struct{}]*wsClie
 		rpcsLog.Errorf("Failed to marshal tx notification: %s", err.Error())
 		return
 	}
+	ntfn.Sequence = &seq
+	marshalledSeqJSON, err := hdfjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal tx notification: %s", err.Error())
+		return
+	}
 
 	var verboseNtfn *hdfjson.TxAcceptedVerboseNtfn
-	var marshalledJSONVerbose []byte
+	var marshalledJSONVerbose, marshalledSeqJSONVerbose []byte
 	for _, wsc := range clients {
-		if wsc.verboseTxUpdates {
-			if marshalledJSONVerbose != nil {
-				wsc.QueueNotification(marshalledJSONVerbose)
-				continue
+		if !wsc.verboseTxUpdates {
+			if wsc.sequencedNtfns {
+				wsc.QueueNotification(marshalledSeqJSON)
+			} else {
+				wsc.QueueNotification(marshalledJSON)
 			}
+			continue
+		}
 
+		if verboseNtfn == nil {
 			net := m.server.cfg.ChainParams
 			rawTx, err := createTxRawResult(net, mtx, txHashStr, nil,
 				"", 0, 0)
@@ -861,13 +1108,42 @@ func (m *wsNotificationManager) notifyForNewTx(clients map[chan struct{}]*wsClie
 					"notification: %s", err.Error())
 				return
 			}
-			wsc.QueueNotification(marshalledJSONVerbose)
+			verboseNtfn.Sequence = &seq
+			marshalledSeqJSONVerbose, err = hdfjson.MarshalCmd(nil,
+				verboseNtfn)
+			if err != nil {
+				rpcsLog.Errorf("Failed to marshal verbose tx "+
+					"notification: %s", err.Error())
+				return
+			}
+		}
+		if wsc.sequencedNtfns {
+			wsc.QueueNotification(marshalledSeqJSONVerbose)
 		} else {
-			wsc.QueueNotification(marshalledJSON)
+			wsc.QueueNotification(marshalledJSONVerbose)
 		}
 	}
 }
 
+// notifyTxReplaced notifies websocket clients that have registered for updates
+// when new transactions are added to the memory pool that a transaction was
+// evicted from it because it was replaced.
+func (*wsNotificationManager) notifyTxReplaced(clients map[chan struct{}]*wsClient,
+	replaced, replacement *hdfutil.Tx) {
+
+	ntfn := hdfjson.NewTxReplacedNtfn(replaced.Hash().String(),
+		replacement.Hash().String())
+	marshalledJSON, err := hdfjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal tx replaced notification: %v",
+			err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
 // RegisterSpentRequests requests a notification when each of the passed
 // outpoints is confirmed spent (contained in a block connected to the main
 // chain) for the passed websocket client.  The request is automatically
@@ -885,10 +1161,14 @@ func (m *wsNotificationManager) RegisterSpentRequests(wsc *wsClient, ops []*wire
 func (m *wsNotificationManager) addSpentRequests(opMap map[wire.OutPoint]map[chan struct{}]*wsClient,
 	wsc *wsClient, ops []*wire.OutPoint) {
 
+	var added int
 	for _, op := range ops {
 		// Track the request in the client as well so it can be quickly
 		// be removed on disconnect.
-		wsc.spentRequests[*op] = struct{}{}
+		if _, ok := wsc.spentRequests[*op]; !ok {
+			wsc.spentRequests[*op] = struct{}{}
+			added++
+		}
 
 		// Add the client to the list to notify when the outpoint is seen.
 		// Create the list as needed.
@@ -899,6 +1179,7 @@ func (m *wsNotificationManager) addSpentRequests(opMap map[wire.OutPoint]map[cha
 		}
 		cmap[wsc.quit] = wsc
 	}
+	wsc.trackSubscriptions(added)
 
 	// Check if any transactions spending these outputs already exists in
 	// the mempool, if so send the notification immediately.
@@ -935,7 +1216,10 @@ func (*wsNotificationManager) removeSpentRequest(ops map[wire.OutPoint]map[chan
 	wsc *wsClient, op *wire.OutPoint) {
 
 	// Remove the request tracking from the client.
-	delete(wsc.spentRequests, *op)
+	if _, ok := wsc.spentRequests[*op]; ok {
+		delete(wsc.spentRequests, *op)
+		wsc.trackSubscriptions(-1)
+	}
 
 	// Remove the client from the list to notify.
 	notifyMap, ok := ops[*op]
@@ -1126,10 +1410,14 @@ func (m *wsNotificationManager) RegisterTxOutAddressRequests(wsc *wsClient, addr
 func (*wsNotificationManager) addAddrRequests(addrMap map[string]map[chan struct{}]*wsClient,
 	wsc *wsClient, addrs []string) {
 
+	var added int
 	for _, addr := range addrs {
 		// Track the request in the client as well so it can be quickly be
 		// removed on disconnect.
-		wsc.addrRequests[addr] = struct{}{}
+		if _, ok := wsc.addrRequests[addr]; !ok {
+			wsc.addrRequests[addr] = struct{}{}
+			added++
+		}
 
 		// Add the client to the set of clients to notify when the
 		// outpoint is seen.  Create map as needed.
@@ -1140,6 +1428,7 @@ func (*wsNotificationManager) addAddrRequests(addrMap map[string]map[chan struct
 		}
 		cmap[wsc.quit] = wsc
 	}
+	wsc.trackSubscriptions(added)
 }
 
 // UnregisterTxOutAddressRequest removes a request from the passed websocket
@@ -1158,7 +1447,10 @@ func (*wsNotificationManager) removeAddrRequest(addrs map[string]map[chan struct
 	wsc *wsClient, addr string) {
 
 	// Remove the request tracking from the client.
-	delete(wsc.addrRequests, addr)
+	if _, ok := wsc.addrRequests[addr]; ok {
+		delete(wsc.addrRequests, addr)
+		wsc.trackSubscriptions(-1)
+	}
 
 	// Remove the client from the list to notify.
 	cmap, ok := addrs[addr]
@@ -1277,6 +1569,11 @@ type wsClient struct {
 	// information about all new transactions.
 	verboseTxUpdates bool
 
+	// sequencedNtfns specifies whether a client has requested sequence
+	// numbers to be included in block and new transaction notifications by
+	// providing a resume token.  Owned by the notification manager.
+	sequencedNtfns bool
+
 	// addrRequests is a set of addresses the caller has requested to be
 	// notified about.  It is maintained here so all requests can be removed
 	// when a wallet disconnects.  Owned by the notification manager.
@@ -1287,6 +1584,13 @@ type wsClient struct {
 	// Owned by the notification manager.
 	spentRequests map[wire.OutPoint]struct{}
 
+	// numSubscriptions is the number of addresses and outpoints the client
+	// is watching via addrRequests and spentRequests plus the number of
+	// registrations which have been accepted but not yet processed by the
+	// notification manager.  It is used to enforce the per-client
+	// subscription limit and is protected by the embedded mutex.
+	numSubscriptions int
+
 	// filterData is the new generation transaction filter backported from
 	// github.com/decred/dcrd for the new backported `loadtxfilter` and
 	// `rescanblocks` methods.
@@ -1488,10 +1792,15 @@ func (c *wsClient) serviceRequest(r *parsedRPCCmd) {
 	)
 
 	// Lookup the websocket extension for the command and if it doesn't
-	// exist fallback to handling the command as a standard command.
+	// exist fallback to handling the command as a standard command.  The
+	// websocket extensions are not available while the server is warming
+	// up unless they don't depend on the chain state.
 	wsHandler, ok := wsHandlers[r.method]
 	if ok {
-		result, err = wsHandler(c, r.cmd)
+		err = c.server.warmupError(r.method)
+		if err == nil {
+			result, err = wsHandler(c, r.cmd)
+		}
 	} else {
 		result, err = c.server.standardCmdResult(r, nil)
 	}
@@ -1702,6 +2011,42 @@ func (c *wsClient) WaitForShutdown() {
 	c.wg.Wait()
 }
 
+// reserveSubscriptions reserves n additional address or outpoint
+// subscriptions for the client.  ErrWSTooManySubscriptions is returned
+// without reserving anything when doing so would exceed the configured
+// per-client limit.  Reservations are released by the notification manager
+// via releaseSubscriptions once the registration has been processed.
+//
+// This function is safe for concurrent access.
+func (c *wsClient) reserveSubscriptions(n int) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if cfg.RPCMaxWSSubs > 0 && c.numSubscriptions+n > cfg.RPCMaxWSSubs {
+		return &ErrWSTooManySubscriptions
+	}
+	c.numSubscriptions += n
+	return nil
+}
+
+// releaseSubscriptions releases n subscriptions previously reserved with
+// reserveSubscriptions.
+//
+// This function is safe for concurrent access.
+func (c *wsClient) releaseSubscriptions(n int) {
+	c.trackSubscriptions(-n)
+}
+
+// trackSubscriptions adjusts the number of subscriptions counted against the
+// client by delta.
+//
+// This function is safe for concurrent access.
+func (c *wsClient) trackSubscriptions(delta int) {
+	c.Lock()
+	c.numSubscriptions += delta
+	c.Unlock()
+}
+
 // newWebsocketClient returns a new websocket client given the notification
 // manager, websocket connection, remote address, and whether or not the client
 // has already been authenticated (via HTTP Basic access authentication).  The
@@ -1803,9 +2148,15 @@ func handleLoadTxFilter(wsc *wsClient, icmd interface{}) (interface{}, error) {
 	}
 
 	params := wsc.server.cfg.ChainParams
+	maxSize := cfg.RPCMaxWSFilterSize
+	numEntries := len(cmd.Addresses) + len(outPoints)
 
 	wsc.Lock()
 	if cmd.Reload || wsc.filterData == nil {
+		if maxSize > 0 && numEntries > maxSize {
+			wsc.Unlock()
+			return nil, &ErrWSFilterTooLarge
+		}
 		wsc.filterData = newWSClientFilter(cmd.Addresses, outPoints,
 			params)
 		wsc.Unlock()
@@ -1813,6 +2164,10 @@ func handleLoadTxFilter(wsc *wsClient, icmd interface{}) (interface{}, error) {
 		wsc.Unlock()
 
 		wsc.filterData.mu.Lock()
+		if maxSize > 0 && wsc.filterData.size()+numEntries > maxSize {
+			wsc.filterData.mu.Unlock()
+			return nil, &ErrWSFilterTooLarge
+		}
 		for _, a := range cmd.Addresses {
 			wsc.filterData.addAddressStr(a, params)
 		}
@@ -1822,12 +2177,34 @@ func handleLoadTxFilter(wsc *wsClient, icmd interface{}) (interface{}, error) {
 		wsc.filterData.mu.Unlock()
 	}
 
+	// Replay the filtered block notifications the client missed since the
+	// provided resume token against the newly loaded filter.
+	if cmd.ResumeToken != nil {
+		err := wsc.server.ntfnMgr.ResumeBlockUpdates(wsc,
+			*cmd.ResumeToken, false, true)
+		return nil, err
+	}
+
 	return nil, nil
 }
 
 // handleNotifyBlocks implements the notifyblocks command extension for
 // websocket connections.
 func handleNotifyBlocks(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	cmd, ok := icmd.(*hdfjson.NotifyBlocksCmd)
+	if !ok {
+		return nil, hdfjson.ErrRPCInternal
+	}
+
+	// Clients providing a resume token are registered along with replaying
+	// any missed notifications by the notification manager so both happen
+	// atomically with respect to new block events.
+	if cmd.ResumeToken != nil {
+		err := wsc.server.ntfnMgr.ResumeBlockUpdates(wsc,
+			*cmd.ResumeToken, true, false)
+		return nil, err
+	}
+
 	wsc.server.ntfnMgr.RegisterBlockUpdates(wsc)
 	return nil, nil
 }
@@ -1858,6 +2235,9 @@ func handleNotifySpent(wsc *wsClient, icmd interface{}) (interface{}, error) {
 		return nil, err
 	}
 
+	if err := wsc.reserveSubscriptions(len(outpoints)); err != nil {
+		return nil, err
+	}
 	wsc.server.ntfnMgr.RegisterSpentRequests(wsc, outpoints)
 	return nil, nil
 }
@@ -1897,6 +2277,9 @@ func handleNotifyReceived(wsc *wsClient, icmd interface{}) (interface{}, error)
 		return nil, err
 	}
 
+	if err := wsc.reserveSubscriptions(len(cmd.Addresses)); err != nil {
+		return nil, err
+	}
 	wsc.server.ntfnMgr.RegisterTxOutAddressRequests(wsc, cmd.Addresses)
 	return nil, nil
 }
@@ -1993,6 +2376,32 @@ func (r *rescanKeys) unspentSlice() []*wire.OutPoint {
 	return ops
 }
 
+// ErrWSTooManySubscriptions defines the error that is returned when a
+// notifyreceived or notifyspent request would cause a websocket client to
+// watch more addresses and outpoints than allowed by the rpcmaxwssubscriptions
+// option.
+var ErrWSTooManySubscriptions = hdfjson.RPCError{
+	Code:    hdfjson.ErrRPCLimitExceeded,
+	Message: "Too many subscriptions for websocket client",
+}
+
+// ErrWSFilterTooLarge defines the error that is returned when a loadtxfilter
+// request would cause the transaction filter of a websocket client to contain
+// more addresses and outpoints than allowed by the rpcmaxwsfiltersize option.
+var ErrWSFilterTooLarge = hdfjson.RPCError{
+	Code:    hdfjson.ErrRPCLimitExceeded,
+	Message: "Transaction filter too large for websocket client",
+}
+
+// ErrWSResumeTokenExpired defines the error that is returned when a client
+// attempts to resume its block notifications with a resume token that is
+// older than the notifications retained by the server.  Clients must perform
+// a rescan in that case instead.
+var ErrWSResumeTokenExpired = hdfjson.RPCError{
+	Code:    hdfjson.ErrRPCMisc,
+	Message: "Resume token expired",
+}
+
 // ErrRescanReorg defines the error that is returned when an unrecoverable
 // reorganize is detected during a rescan.
 var ErrRescanReorg = hdfjson.RPCError{
@@ -6,14 +6,19 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/rand"
 	"crypto/tls"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math"
 	"net"
+	"os"
+	"path/filepath"
 	"runtime"
 	"sort"
 	"strconv"
@@ -29,6 +34,7 @@ import (
 	"github.com/ifishnet/hdfd/chaincfg/chainhash"
 	"github.com/ifishnet/hdfd/connmgr"
 	"github.com/ifishnet/hdfd/database"
+	"github.com/ifishnet/hdfd/hdfec"
 	"github.com/ifishnet/hdfd/mempool"
 	"github.com/ifishnet/hdfd/mining"
 	"github.com/ifishnet/hdfd/mining/cpuminer"
@@ -57,6 +63,57 @@ const (
 	// retries when connecting to persistent peers.  It is adjusted by the
 	// number of retries such that there is a retry backoff.
 	connectionRetryInterval = time.Second * 5
+
+	// extraBlockRelayCheckInterval is the interval at which the server
+	// checks whether an extra outbound block-relay-only peer was connected
+	// and disconnects either it or one of the other block-relay-only peers.
+	extraBlockRelayCheckInterval = time.Second * 45
+
+	// minBlockRelayConnectTime is the minimum amount of time an extra
+	// block-relay-only peer must have been connected before either it or
+	// one of the other block-relay-only peers is disconnected, so it has a
+	// chance to announce the blocks the others did not.
+	minBlockRelayConnectTime = time.Second * 30
+
+	// feelerInterval is the interval at which a short-lived feeler
+	// connection is made to an address which was never connected to before
+	// in order to move it to the tried buckets of the address manager when
+	// it is reachable.
+	feelerInterval = time.Minute * 2
+
+	// maxPeerRotationHistory is the maximum number of peer rotations that
+	// are kept in the history of the periodic outbound peer rotation.
+	maxPeerRotationHistory = 100
+
+	// peerRotationAvoidGroups is the number of most recent peer rotations
+	// whose network groups are avoided when choosing the addresses of new
+	// outbound peers so rotated peers are replaced by peers in different
+	// network segments.
+	peerRotationAvoidGroups = defaultTargetOutbound
+
+	// mempoolFilename is the name of the file in the data directory the
+	// transaction memory pool is saved to on shutdown.
+	mempoolFilename = "mempool.dat"
+
+	// banListFilename is the name of the file in the data directory the
+	// banned IP addresses and subnets are saved to.
+	banListFilename = "banlist.json"
+
+	// feeFilterInterval is the interval at which peers are sent feefilter
+	// messages when the minimum fee rate required to enter the mempool
+	// changed.
+	feeFilterInterval = time.Minute * 10
+
+	// maxCmpctBlockDepth is the maximum depth in the main chain of the
+	// blocks which are sent as cmpctblock messages when requested.  Older
+	// blocks are sent in full since peers are unlikely to be able to
+	// reconstruct them.
+	maxCmpctBlockDepth = 5
+
+	// maxBlockTxnDepth is the maximum depth in the main chain of the
+	// blocks whose transactions are sent as blocktxn messages when
+	// requested.  Older blocks are sent in full instead.
+	maxBlockTxnDepth = 10
 )
 
 var (
@@ -151,12 +208,11 @@ type updatePeerHeightsMsg struct {
 }
 
 // peerState maintains state of inbound, persistent, outbound peers as well
-// as banned peers and outbound groups.
+// as outbound groups.
 type peerState struct {
 	inboundPeers    map[int32]*serverPeer
 	outboundPeers   map[int32]*serverPeer
 	persistentPeers map[int32]*serverPeer
-	banned          map[string]time.Time
 	outboundGroups  map[string]int
 }
 
@@ -186,6 +242,15 @@ func (ps *peerState) forAllPeers(closure func(sp *serverPeer)) {
 	ps.forAllOutboundPeers(closure)
 }
 
+// peerRotation describes an outbound peer which was disconnected by the
+// periodic outbound peer rotation in order to be replaced by a new peer.
+type peerRotation struct {
+	time     time.Time
+	id       int32
+	addr     string
+	netGroup string
+}
+
 // cfHeaderKV is a tuple of a filter header and its associated block hash. The
 // struct is used to cache cfcheckpt responses.
 type cfHeaderKV struct {
@@ -208,6 +273,7 @@ type server struct {
 	chainParams          *chaincfg.Params
 	addrManager          *addrmgr.AddrManager
 	connManager          *connmgr.ConnManager
+	banManager           *connmgr.BanManager
 	sigCache             *txscript.SigCache
 	hashCache            *txscript.HashCache
 	rpcServer            *rpcServer
@@ -242,6 +308,10 @@ type server struct {
 	// the mempool before they are mined into blocks.
 	feeEstimator *mempool.FeeEstimator
 
+	// rebroadcastMgr periodically rebroadcasts the mempool transactions
+	// which are likely missing from the mempools of other peers.
+	rebroadcastMgr *mempool.RebroadcastManager
+
 	// cfCheckptCaches stores a cached slice of filter headers for cfcheckpt
 	// messages for each filter type.
 	cfCheckptCaches    map[wire.FilterType][]cfHeaderKV
@@ -254,14 +324,45 @@ type server struct {
 	// agentWhitelist is a list of whitelisted user agent substrings, no
 	// whitelisting will be applied if the list is empty or nil.
 	agentWhitelist []string
+
+	// peerRotations houses the history of the outbound peers disconnected
+	// by the periodic outbound peer rotation from oldest to newest.
+	peerRotationsMtx sync.Mutex
+	peerRotations    []peerRotation
+
+	// bulletinKeys are the keys which are allowed to sign network
+	// bulletins.  Bulletins are not supported when there are none.
+	// bulletin is the bulletin with the highest ID accepted so far.
+	bulletinKeys []*hdfec.PublicKey
+	bulletinMtx  sync.Mutex
+	bulletin     *wire.MsgBulletin
+
+	// bandwidth accounts for the bytes sent to and received from all
+	// peers per message command.  uploadTarget and downloadTarget track
+	// the bytes sent and received during the current cycle against the
+	// configured targets.  Once the upload target is almost reached,
+	// historical blocks are no longer served to non-whitelisted peers.
+	bandwidth      *peer.BandwidthCounter
+	uploadTarget   *netTarget
+	downloadTarget *netTarget
+
+	// uploadLimiter and downloadLimiter limit the rate of the bytes sent
+	// to and received from all non-whitelisted peers combined.
+	uploadLimiter   *peer.RateLimiter
+	downloadLimiter *peer.RateLimiter
+
+	// hbPeers are the peers which are asked to announce new blocks in
+	// high-bandwidth compact block mode.
+	hbPeers *peer.HighBandwidthPeers
+
+	// targetBlockRelayOnly is the number of outbound block-relay-only
+	// peers the connection manager maintains.
+	targetBlockRelayOnly int
 }
 
 // serverPeer extends the peer to maintain state shared by the server and
 // the blockmanager.
 type serverPeer struct {
-	// The following variables must only be used atomically
-	feeFilter int64
-
 	*peer.Peer
 
 	connReq        *connmgr.ConnReq
@@ -272,11 +373,23 @@ type serverPeer struct {
 	disableRelayTx bool
 	sentAddrs      bool
 	isWhitelisted  bool
+	blockRelayOnly bool
+	feeler         bool
 	filter         *bloom.Filter
 	addressesMtx   sync.RWMutex
 	knownAddresses map[string]struct{}
-	banScore       connmgr.DynamicBanScore
 	quit           chan struct{}
+
+	// lastBlockTime is the time the peer last provided a block which
+	// extended the main chain.  It is only accessed from the peerHandler
+	// goroutine.
+	lastBlockTime time.Time
+
+	// feeFilterSent is the fee rate of the most recent feefilter message
+	// sent to the peer, or -1 when none was sent.  It must be accessed
+	// atomically.
+	feeFilterSent int64
+
 	// The following chans are used to sync blockmanager and server.
 	txProcessed    chan struct{}
 	blockProcessed chan struct{}
@@ -293,6 +406,7 @@ func newServerPeer(s *server, isPersistent bool) *serverPeer {
 		quit:           make(chan struct{}),
 		txProcessed:    make(chan struct{}, 1),
 		blockProcessed: make(chan struct{}, 1),
+		feeFilterSent:  -1,
 	}
 }
 
@@ -303,6 +417,23 @@ func (sp *serverPeer) newestBlock() (*chainhash.Hash, int32, error) {
 	return &best.Hash, best.Height, nil
 }
 
+// pushFeeFilterMsg sends a feefilter message with the passed minimum fee rate
+// to the peer so it does not announce transactions which would not be accepted
+// to the mempool anyways.  Nothing is sent when the peer does not support
+// feefilter messages, transactions are not relayed with the peer, or the fee
+// rate was already sent.
+func (sp *serverPeer) pushFeeFilterMsg(minFee hdfutil.Amount) {
+	if cfg.BlocksOnly || sp.blockRelayOnly ||
+		sp.ProtocolVersion() < wire.FeeFilterVersion {
+
+		return
+	}
+	if atomic.SwapInt64(&sp.feeFilterSent, int64(minFee)) == int64(minFee) {
+		return
+	}
+	sp.QueueMessage(wire.NewMsgFeeFilter(int64(minFee)), nil)
+}
+
 // addKnownAddresses adds the given addresses to the set of known addresses to
 // the peer to prevent sending duplicate addresses.
 func (sp *serverPeer) addKnownAddresses(addresses []*wire.NetAddress) {
@@ -313,6 +444,25 @@ func (sp *serverPeer) addKnownAddresses(addresses []*wire.NetAddress) {
 	sp.addressesMtx.Unlock()
 }
 
+// addKnownAddressesV2 adds the given addrv2 addresses to the set of known
+// addresses to the peer to prevent sending duplicate addresses.
+func (sp *serverPeer) addKnownAddressesV2(addresses []*wire.NetAddressV2) {
+	sp.addressesMtx.Lock()
+	for _, na := range addresses {
+		sp.knownAddresses[addrmgr.NetAddressV2Key(na)] = struct{}{}
+	}
+	sp.addressesMtx.Unlock()
+}
+
+// addressKnownV2 true if the given addrv2 address is already known to the
+// peer.
+func (sp *serverPeer) addressKnownV2(na *wire.NetAddressV2) bool {
+	sp.addressesMtx.RLock()
+	_, exists := sp.knownAddresses[addrmgr.NetAddressV2Key(na)]
+	sp.addressesMtx.RUnlock()
+	return exists
+}
+
 // addressKnown true if the given address is already known to the peer.
 func (sp *serverPeer) addressKnown(na *wire.NetAddress) bool {
 	sp.addressesMtx.RLock()
@@ -341,8 +491,17 @@ func (sp *serverPeer) relayTxDisabled() bool {
 }
 
 // pushAddrMsg sends an addr message to the connected peer using the provided
-// addresses.
+// addresses.  Peers that prefer addrv2 messages are sent one instead.
 func (sp *serverPeer) pushAddrMsg(addresses []*wire.NetAddress) {
+	if sp.WantsAddrV2() {
+		addrs := make([]*wire.NetAddressV2, 0, len(addresses))
+		for _, addr := range addresses {
+			addrs = append(addrs, wire.NetAddressV2FromLegacy(addr))
+		}
+		sp.pushAddrV2Msg(addrs)
+		return
+	}
+
 	// Filter addresses already known to the peer.
 	addrs := make([]*wire.NetAddress, 0, len(addresses))
 	for _, addr := range addresses {
@@ -359,45 +518,34 @@ func (sp *serverPeer) pushAddrMsg(addresses []*wire.NetAddress) {
 	sp.addKnownAddresses(known)
 }
 
-// addBanScore increases the persistent and decaying ban score fields by the
-// values passed as parameters. If the resulting score exceeds half of the ban
-// threshold, a warning is logged including the reason provided. Further, if
-// the score is above the ban threshold, the peer will be banned and
-// disconnected.
-func (sp *serverPeer) addBanScore(persistent, transient uint32, reason string) bool {
-	// No warning is logged and no score is calculated if banning is disabled.
-	if cfg.DisableBanning {
-		return false
+// pushAddrV2Msg sends an addrv2 message to the connected peer using the
+// provided addresses.
+func (sp *serverPeer) pushAddrV2Msg(addresses []*wire.NetAddressV2) {
+	// Filter addresses already known to the peer.
+	addrs := make([]*wire.NetAddressV2, 0, len(addresses))
+	for _, addr := range addresses {
+		if !sp.addressKnownV2(addr) {
+			addrs = append(addrs, addr)
+		}
 	}
-	if sp.isWhitelisted {
-		peerLog.Debugf("Misbehaving whitelisted peer %s: %s", sp, reason)
-		return false
+	known, err := sp.PushAddrV2Msg(addrs)
+	if err != nil {
+		peerLog.Errorf("Can't push addrv2 message to %s: %v", sp.Peer, err)
+		sp.Disconnect()
+		return
 	}
+	sp.addKnownAddressesV2(known)
+}
 
-	warnThreshold := cfg.BanThreshold >> 1
-	if transient == 0 && persistent == 0 {
-		// The score is not being increased, but a warning message is still
-		// logged if the score is above the warn threshold.
-		score := sp.banScore.Int()
-		if score > warnThreshold {
-			peerLog.Warnf("Misbehaving peer %s: %s -- ban score is %d, "+
-				"it was not increased this time", sp, reason, score)
-		}
-		return false
-	}
-	score := sp.banScore.Increase(persistent, transient)
-	if score > warnThreshold {
-		peerLog.Warnf("Misbehaving peer %s: %s -- ban score increased to %d",
-			sp, reason, score)
-		if score > cfg.BanThreshold {
-			peerLog.Warnf("Misbehaving peer %s -- banning and disconnecting",
-				sp)
-			sp.server.BanPeer(sp)
-			sp.Disconnect()
-			return true
-		}
+// OnDiscourage is invoked when the misbehavior score of the peer exceeds the
+// ban threshold.  It bans the peer and discourages its address in the address
+// manager for the configured ban duration.  The peer disconnects itself
+// afterwards.
+func (sp *serverPeer) OnDiscourage(_ *peer.Peer, score uint32, reason string) {
+	if na := sp.NA(); na != nil {
+		sp.server.addrManager.Discourage(na, cfg.BanDuration)
 	}
-	return false
+	sp.server.BanPeer(sp)
 }
 
 // hasServices returns whether or not the provided advertised service flags have
@@ -470,8 +618,9 @@ func (sp *serverPeer) OnVersion(_ *peer.Peer, msg *wire.MsgVersion) *wire.MsgRej
 	sp.server.timeSource.AddTimeSample(sp.Addr(), msg.Timestamp)
 
 	// Choose whether or not to relay transactions before a filter command
-	// is received.
-	sp.setDisableRelayTx(msg.DisableRelayTx)
+	// is received.  Transactions are never relayed to block-relay-only
+	// peers.
+	sp.setDisableRelayTx(msg.DisableRelayTx || sp.blockRelayOnly)
 
 	return nil
 }
@@ -479,7 +628,30 @@ func (sp *serverPeer) OnVersion(_ *peer.Peer, msg *wire.MsgVersion) *wire.MsgRej
 // OnVerAck is invoked when a peer receives a verack bitcoin message and is used
 // to kick start communication with them.
 func (sp *serverPeer) OnVerAck(_ *peer.Peer, _ *wire.MsgVerAck) {
+	// Feeler connections are only made to find out whether the address is
+	// reachable, so move it to the tried buckets of the address manager
+	// and disconnect.
+	if sp.feeler {
+		peerLog.Debugf("Feeler connection to %v succeeded", sp)
+		sp.server.addrManager.Good(sp.NA())
+		sp.Disconnect()
+		return
+	}
+
 	sp.server.AddPeer(sp)
+
+	// Let the peer know the minimum fee rate of the transactions it should
+	// announce.
+	sp.pushFeeFilterMsg(sp.server.txMemPool.MinFeeRate())
+
+	// Send the current network bulletin, if any, to peers that support
+	// them so they learn about it even when they were not connected at
+	// the time it was relayed.
+	if sp.Services()&wire.SFNodeBulletin != 0 {
+		if bulletin := sp.server.currentBulletin(); bulletin != nil {
+			sp.QueueMessage(bulletin, nil)
+		}
+	}
 }
 
 // OnMemPool is invoked when a peer receives a mempool bitcoin message.
@@ -500,7 +672,7 @@ func (sp *serverPeer) OnMemPool(_ *peer.Peer, msg *wire.MsgMemPool) {
 	// The ban score accumulates and passes the ban threshold if a burst of
 	// mempool messages comes from a peer. The score decays each minute to
 	// half of its value.
-	if sp.addBanScore(0, 33, "mempool") {
+	if sp.Misbehaving(0, 33, "mempool") {
 		return
 	}
 
@@ -542,6 +714,11 @@ func (sp *serverPeer) OnTx(_ *peer.Peer, msg *wire.MsgTx) {
 			msg.TxHash(), sp)
 		return
 	}
+	if sp.blockRelayOnly {
+		peerLog.Tracef("Ignoring tx %v from block-relay-only peer %v",
+			msg.TxHash(), sp)
+		return
+	}
 
 	// Add the transaction to the known inventory for the peer.
 	// Convert the raw MsgTx to a hdfutil.Tx which provides some convenience
@@ -585,12 +762,71 @@ func (sp *serverPeer) OnBlock(_ *peer.Peer, msg *wire.MsgBlock, buf []byte) {
 	<-sp.blockProcessed
 }
 
+// OnCmpctBlock is invoked when a peer receives a cmpctblock bitcoin message.
+// The message is passed down to the sync manager which reconstructs or requests
+// the block as needed.
+func (sp *serverPeer) OnCmpctBlock(_ *peer.Peer, msg *wire.MsgCmpctBlock) {
+	sp.server.syncManager.QueueCmpctBlock(msg, sp.Peer)
+}
+
+// OnBlockTxn is invoked when a peer receives a blocktxn bitcoin message.  The
+// message is passed down to the sync manager to complete the block it belongs
+// to.
+func (sp *serverPeer) OnBlockTxn(_ *peer.Peer, msg *wire.MsgBlockTxn) {
+	sp.server.syncManager.QueueBlockTxn(msg, sp.Peer)
+}
+
+// OnGetBlockTxn is invoked when a peer receives a getblocktxn bitcoin message.
+// The requested transactions of recent blocks are sent by way of a blocktxn
+// message, while older blocks are sent in full as recommended by BIP0152.
+func (sp *serverPeer) OnGetBlockTxn(_ *peer.Peer, msg *wire.MsgGetBlockTxn) {
+	version := sp.CmpctBlockVersion()
+	if version == 0 {
+		peerLog.Debugf("Ignoring getblocktxn message from peer %v "+
+			"which does not use compact blocks", sp)
+		return
+	}
+	encoding := cmpctBlockEncoding(version)
+
+	chain := sp.server.chain
+	height, err := chain.BlockHeightByHash(&msg.BlockHash)
+	if err != nil {
+		peerLog.Debugf("Unable to fetch block %v requested by peer %v "+
+			"via getblocktxn: %v", msg.BlockHash, sp, err)
+		return
+	}
+	if chain.BestSnapshot().Height-height >= maxBlockTxnDepth {
+		sp.server.pushBlockMsg(sp, &msg.BlockHash, nil, nil, encoding)
+		return
+	}
+
+	block, err := chain.BlockByHash(&msg.BlockHash)
+	if err != nil {
+		peerLog.Debugf("Unable to fetch block %v requested by peer %v "+
+			"via getblocktxn: %v", msg.BlockHash, sp, err)
+		return
+	}
+	txns := block.MsgBlock().Transactions
+	reply := wire.NewMsgBlockTxn(&msg.BlockHash)
+	for _, index := range msg.Indexes {
+		if int(index) >= len(txns) {
+			sp.Misbehaving(100, 0, fmt.Sprintf("requested "+
+				"transaction index %d of block %v which only "+
+				"has %d transactions", index, msg.BlockHash,
+				len(txns)))
+			return
+		}
+		reply.AddTransaction(txns[index])
+	}
+	sp.QueueMessageWithEncoding(reply, nil, encoding)
+}
+
 // OnInv is invoked when a peer receives an inv bitcoin message and is
 // used to examine the inventory being advertised by the remote peer and react
 // accordingly.  We pass the message down to blockmanager which will call
 // QueueMessage with any appropriate responses.
 func (sp *serverPeer) OnInv(_ *peer.Peer, msg *wire.MsgInv) {
-	if !cfg.BlocksOnly {
+	if !cfg.BlocksOnly && !sp.blockRelayOnly {
 		if len(msg.InvList) > 0 {
 			sp.server.syncManager.QueueInv(msg, sp.Peer)
 		}
@@ -601,8 +837,8 @@ func (sp *serverPeer) OnInv(_ *peer.Peer, msg *wire.MsgInv) {
 	for _, invVect := range msg.InvList {
 		if invVect.Type == wire.InvTypeTx {
 			peerLog.Tracef("Ignoring tx %v in inv from %v -- "+
-				"blocksonly enabled", invVect.Hash, sp)
-			if sp.ProtocolVersion() >= wire.BIP0037Version {
+				"transaction relay disabled", invVect.Hash, sp)
+			if sp.HasCapability(wire.CapBloomFilter) {
 				peerLog.Infof("Peer %v is announcing "+
 					"transactions -- disconnecting", sp)
 				sp.Disconnect()
@@ -628,6 +864,12 @@ func (sp *serverPeer) OnHeaders(_ *peer.Peer, msg *wire.MsgHeaders) {
 	sp.server.syncManager.QueueHeaders(msg, sp.Peer)
 }
 
+// OnCFHeaders is invoked when a peer receives a cfheaders bitcoin message.  The
+// message is passed down to the sync manager.
+func (sp *serverPeer) OnCFHeaders(_ *peer.Peer, msg *wire.MsgCFHeaders) {
+	sp.server.syncManager.QueueCFHeaders(msg, sp.Peer)
+}
+
 // handleGetData is invoked when a peer receives a getdata bitcoin message and
 // is used to deliver block and transaction information.
 func (sp *serverPeer) OnGetData(_ *peer.Peer, msg *wire.MsgGetData) {
@@ -642,7 +884,7 @@ func (sp *serverPeer) OnGetData(_ *peer.Peer, msg *wire.MsgGetData) {
 	// bursts of small requests are not penalized as that would potentially ban
 	// peers performing IBD.
 	// This incremental score decays each minute to half of its value.
-	if sp.addBanScore(0, uint32(length)*99/wire.MaxInvPerMsg, "getdata") {
+	if sp.Misbehaving(0, uint32(length)*99/wire.MaxInvPerMsg, "getdata") {
 		return
 	}
 
@@ -662,6 +904,23 @@ func (sp *serverPeer) OnGetData(_ *peer.Peer, msg *wire.MsgGetData) {
 			// Buffered so as to not make the send goroutine block.
 			c = make(chan struct{}, 1)
 		}
+		// Disconnect peers requesting historical blocks once the upload
+		// target doesn't leave room for them so the bandwidth is kept
+		// for relaying new blocks and transactions.
+		switch iv.Type {
+		case wire.InvTypeWitnessBlock, wire.InvTypeBlock,
+			wire.InvTypeFilteredWitnessBlock, wire.InvTypeFilteredBlock,
+			wire.InvTypeCmpctBlock:
+
+			if !sp.server.servesBlock(sp, &iv.Hash) {
+				peerLog.Infof("Upload target reached, disconnecting "+
+					"peer %v requesting historical block %v", sp,
+					iv.Hash)
+				sp.Disconnect()
+				return
+			}
+		}
+
 		var err error
 		switch iv.Type {
 		case wire.InvTypeWitnessTx:
@@ -676,6 +935,8 @@ func (sp *serverPeer) OnGetData(_ *peer.Peer, msg *wire.MsgGetData) {
 			err = sp.server.pushMerkleBlockMsg(sp, &iv.Hash, c, waitChan, wire.WitnessEncoding)
 		case wire.InvTypeFilteredBlock:
 			err = sp.server.pushMerkleBlockMsg(sp, &iv.Hash, c, waitChan, wire.BaseEncoding)
+		case wire.InvTypeCmpctBlock:
+			err = sp.server.pushCmpctBlockMsg(sp, &iv.Hash, c, waitChan)
 		default:
 			peerLog.Warnf("Unknown type in inventory request %d",
 				iv.Type)
@@ -766,9 +1027,16 @@ func (sp *serverPeer) OnGetHeaders(_ *peer.Peer, msg *wire.MsgGetHeaders) {
 	// provided locator are known.  This does mean the client will start
 	// over with the genesis block if unknown block locators are provided.
 	//
-	// This mirrors the behavior in the reference implementation.
-	chain := sp.server.chain
-	headers := chain.LocateHeaders(msg.BlockLocatorHashes, &msg.HashStop)
+	// This mirrors the behavior in the reference implementation.  The
+	// headers are served from the header chain in headers-only mode.
+	var headers []wire.BlockHeader
+	if headerChain := sp.server.syncManager.HeaderChain(); headerChain != nil {
+		headers = headerChain.LocateHeaders(msg.BlockLocatorHashes,
+			&msg.HashStop)
+	} else {
+		chain := sp.server.chain
+		headers = chain.LocateHeaders(msg.BlockLocatorHashes, &msg.HashStop)
+	}
 
 	// Send found headers to the requesting peer.
 	blockHeaders := make([]*wire.BlockHeader, len(headers))
@@ -1112,16 +1380,16 @@ func (sp *serverPeer) enforceNodeBloomFlag(cmd string) bool {
 		// peer is knowingly violating the protocol and banning is
 		// enabled.
 		//
-		// NOTE: Even though the addBanScore function already examines
-		// whether or not banning is enabled, it is checked here as well
+		// NOTE: Even though misbehavior scoring is already disabled
+		// when banning is disabled, it is checked here as well
 		// to ensure the violation is logged and the peer is
 		// disconnected regardless.
-		if sp.ProtocolVersion() >= wire.BIP0111Version &&
+		if sp.HasCapability(wire.CapBloomService) &&
 			!cfg.DisableBanning {
 
 			// Disconnect the peer regardless of whether it was
 			// banned.
-			sp.addBanScore(100, 0, cmd)
+			sp.Misbehaving(100, 0, cmd)
 			sp.Disconnect()
 			return false
 		}
@@ -1142,15 +1410,90 @@ func (sp *serverPeer) enforceNodeBloomFlag(cmd string) bool {
 // lower than provided value are inventoried to them.  The peer will be
 // disconnected if an invalid fee filter value is provided.
 func (sp *serverPeer) OnFeeFilter(_ *peer.Peer, msg *wire.MsgFeeFilter) {
-	// Check that the passed minimum fee is a valid amount.
-	if msg.MinFee < 0 || msg.MinFee > hdfutil.MaxSatoshi {
+	// Check that the passed minimum fee is a valid amount.  Valid fee
+	// filters are tracked by the peer itself and used when relaying
+	// transactions.
+	if msg.MinFee < 0 || msg.MinFee > wire.MaxFeeFilterRate {
 		peerLog.Debugf("Peer %v sent an invalid feefilter '%v' -- "+
 			"disconnecting", sp, hdfutil.Amount(msg.MinFee))
 		sp.Disconnect()
+	}
+}
+
+// OnBulletin is invoked when a peer receives a bulletin message.  Bulletins
+// which are signed by one of the keys allowed to sign them and replace the
+// current bulletin are logged and relayed to all other peers that support
+// them.  Peers which send bulletins with invalid signatures are banned.
+func (sp *serverPeer) OnBulletin(_ *peer.Peer, msg *wire.MsgBulletin) {
+	if sp.server.services&wire.SFNodeBulletin == 0 {
+		peerLog.Debugf("%s sent an unsupported bulletin -- ignoring", sp)
+		return
+	}
+
+	if !sp.server.verifyBulletin(msg) {
+		peerLog.Debugf("%s sent bulletin %d with an invalid signature",
+			sp, msg.ID)
+		sp.Misbehaving(100, 0, "invalid bulletin signature")
+		return
+	}
+
+	if !sp.server.acceptBulletin(msg) {
 		return
 	}
+	sp.server.BroadcastMessage(msg, sp)
+}
+
+// verifyBulletin returns whether or not the passed bulletin is signed by one of
+// the keys allowed to sign bulletins.
+func (s *server) verifyBulletin(msg *wire.MsgBulletin) bool {
+	sig, err := hdfec.ParseDERSignature(msg.Signature, hdfec.S256())
+	if err != nil {
+		return false
+	}
+	hash, err := msg.SignatureHash()
+	if err != nil {
+		return false
+	}
+	for _, key := range s.bulletinKeys {
+		if sig.Verify(hash[:], key) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptBulletin makes the passed bulletin the current one when it has not
+// expired and has a higher ID than the current one.  It returns whether or not
+// the bulletin was accepted and should therefore be relayed.  The bulletin must
+// already be verified.
+func (s *server) acceptBulletin(msg *wire.MsgBulletin) bool {
+	if !msg.Expiration.After(time.Now()) {
+		return false
+	}
 
-	atomic.StoreInt64(&sp.feeFilter, msg.MinFee)
+	s.bulletinMtx.Lock()
+	if s.bulletin != nil && msg.ID <= s.bulletin.ID {
+		s.bulletinMtx.Unlock()
+		return false
+	}
+	s.bulletin = msg
+	s.bulletinMtx.Unlock()
+
+	srvrLog.Warnf("Network bulletin %d (expires %v): %s", msg.ID,
+		msg.Expiration, msg.Message)
+	return true
+}
+
+// currentBulletin returns the current network bulletin or nil when there is
+// none or it has expired.
+func (s *server) currentBulletin() *wire.MsgBulletin {
+	s.bulletinMtx.Lock()
+	defer s.bulletinMtx.Unlock()
+
+	if s.bulletin == nil || !s.bulletin.Expiration.After(time.Now()) {
+		return nil
+	}
+	return s.bulletin
 }
 
 // OnFilterAdd is invoked when a peer receives a filteradd bitcoin
@@ -1241,11 +1584,38 @@ func (sp *serverPeer) OnGetAddr(_ *peer.Peer, msg *wire.MsgGetAddr) {
 	}
 	sp.sentAddrs = true
 
-	// Get the current known addresses from the address manager.
-	addrCache := sp.server.addrManager.AddressCache()
+	// Get the cached response for the network and local address the
+	// request was received on from the address manager and push it.  Peers
+	// that prefer addrv2 messages are also sent the addresses that can't be
+	// represented in addr messages.
+	key := sp.getAddrCacheKey()
+	if sp.WantsAddrV2() {
+		sp.pushAddrV2Msg(sp.server.addrManager.GetAddrResponseV2(key))
+		return
+	}
+	sp.pushAddrMsg(sp.server.addrManager.GetAddrResponse(key))
+}
+
+// getAddrCacheKey returns the key the responses to getaddr requests from the
+// peer are cached by in the address manager.  Responses are cached separately
+// for each network and local address so that requests made via different ones
+// can't be used to determine they lead to the same node.
+func (sp *serverPeer) getAddrCacheKey() string {
+	network := "ipv6"
+	if na := sp.NA(); na != nil {
+		switch {
+		case addrmgr.IsOnionCatTor(na):
+			network = "onion"
+		case addrmgr.IsIPv4(na):
+			network = "ipv4"
+		}
+	}
 
-	// Push the addresses.
-	sp.pushAddrMsg(addrCache)
+	var localAddr string
+	if addr := sp.LocalAddr(); addr != nil {
+		localAddr = addr.String()
+	}
+	return network + "|" + localAddr
 }
 
 // OnAddr is invoked when a peer receives an addr bitcoin message and is
@@ -1259,8 +1629,16 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 		return
 	}
 
+	// Addresses are not relayed with block-relay-only peers, which keeps
+	// them from being used to learn about the connection.
+	if sp.blockRelayOnly {
+		peerLog.Debugf("Ignoring %s from block-relay-only peer %v",
+			msg.Command(), sp)
+		return
+	}
+
 	// Ignore old style addresses which don't include a timestamp.
-	if sp.ProtocolVersion() < wire.NetAddressTimeVersion {
+	if !sp.HasCapability(wire.CapAddrTimestamp) {
 		return
 	}
 
@@ -1298,16 +1676,69 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 	sp.server.addrManager.AddAddresses(msg.AddrList, sp.NA())
 }
 
+// OnAddrV2 is invoked when a peer receives an addrv2 bitcoin message and is
+// used to notify the server about advertised addresses.
+func (sp *serverPeer) OnAddrV2(_ *peer.Peer, msg *wire.MsgAddrV2) {
+	// Ignore addresses when running on the simulation test network.  This
+	// helps prevent the network from becoming another public test network
+	// since it will not be able to learn about other peers that have not
+	// specifically been provided.
+	if cfg.SimNet {
+		return
+	}
+
+	// Addresses are not relayed with block-relay-only peers, which keeps
+	// them from being used to learn about the connection.
+	if sp.blockRelayOnly {
+		peerLog.Debugf("Ignoring %s from block-relay-only peer %v",
+			msg.Command(), sp)
+		return
+	}
+
+	// A message that has no addresses is invalid.
+	if len(msg.AddrList) == 0 {
+		peerLog.Errorf("Command [%s] from %s does not contain any addresses",
+			msg.Command(), sp.Peer)
+		sp.Disconnect()
+		return
+	}
+
+	for _, na := range msg.AddrList {
+		// Don't add more address if we're disconnecting.
+		if !sp.Connected() {
+			return
+		}
+
+		// Set the timestamp to 5 days ago if it's more than 24 hours
+		// in the future so this address is one of the first to be
+		// removed when space is needed.
+		now := time.Now()
+		if na.Timestamp.After(now.Add(time.Minute * 10)) {
+			na.Timestamp = now.Add(-1 * time.Hour * 24 * 5)
+		}
+
+		// Add address to known addresses for this peer.
+		sp.addKnownAddressesV2([]*wire.NetAddressV2{na})
+	}
+
+	// Add addresses to server address manager.  The address manager handles
+	// the details of things such as preventing duplicate addresses, max
+	// addresses, and last seen updates.
+	sp.server.addrManager.AddAddressesV2(msg.AddrList, sp.NA())
+}
+
 // OnRead is invoked when a peer receives a message and it is used to update
 // the bytes received by the server.
 func (sp *serverPeer) OnRead(_ *peer.Peer, bytesRead int, msg wire.Message, err error) {
 	sp.server.AddBytesReceived(uint64(bytesRead))
+	sp.server.bandwidth.AddReceived(msg, bytesRead)
 }
 
 // OnWrite is invoked when a peer sends a message and it is used to update
 // the bytes sent by the server.
 func (sp *serverPeer) OnWrite(_ *peer.Peer, bytesWritten int, msg wire.Message, err error) {
 	sp.server.AddBytesSent(uint64(bytesWritten))
+	sp.server.bandwidth.AddSent(msg, bytesWritten)
 }
 
 // OnNotFound is invoked when a peer sends a notfound message.
@@ -1333,14 +1764,14 @@ func (sp *serverPeer) OnNotFound(p *peer.Peer, msg *wire.MsgNotFound) {
 	if numBlocks > 0 {
 		blockStr := pickNoun(uint64(numBlocks), "block", "blocks")
 		reason := fmt.Sprintf("%d %v not found", numBlocks, blockStr)
-		if sp.addBanScore(20*numBlocks, 0, reason) {
+		if sp.Misbehaving(20*numBlocks, 0, reason) {
 			return
 		}
 	}
 	if numTxns > 0 {
 		txStr := pickNoun(uint64(numTxns), "transaction", "transactions")
 		reason := fmt.Sprintf("%d %v not found", numBlocks, txStr)
-		if sp.addBanScore(0, 10*numTxns, reason) {
+		if sp.Misbehaving(0, 10*numTxns, reason) {
 			return
 		}
 	}
@@ -1425,6 +1856,26 @@ func (s *server) TransactionConfirmed(tx *hdfutil.Tx) {
 	s.RemoveRebroadcastInventory(iv)
 }
 
+// TransactionReplaced is invoked by the mempool whenever a transaction is
+// evicted because it was replaced through the Replace-By-Fee (RBF) policy.
+// It stops rebroadcasting the replaced transaction and notifies websocket
+// clients about the replacement.
+//
+// This function is invoked with the mempool lock held, so it must not block.
+func (s *server) TransactionReplaced(replaced, replacement *hdfutil.Tx) {
+	// Rebroadcasting is only necessary when the RPC server is active.
+	if s.rpcServer == nil {
+		return
+	}
+
+	// Removing the inventory is done asynchronously since the rebroadcast
+	// handler may be blocked relaying inventory to peers.
+	iv := wire.NewInvVect(wire.InvTypeTx, replaced.Hash())
+	go s.RemoveRebroadcastInventory(iv)
+
+	s.rpcServer.NotifyTxReplaced(replaced, replacement)
+}
+
 // pushTxMsg sends a tx message for the provided transaction hash to the
 // connected peer.  An error is returned if the transaction hash is not known.
 func (s *server) pushTxMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<- struct{},
@@ -1454,6 +1905,23 @@ func (s *server) pushTxMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<-
 	return nil
 }
 
+// servesBlock returns whether or not the block with the provided hash may be
+// served to the peer given the upload target.  Blocks which are not historical
+// are always served so relay is unaffected, as are all blocks to whitelisted
+// peers.
+func (s *server) servesBlock(sp *serverPeer, hash *chainhash.Hash) bool {
+	if sp.isWhitelisted || s.uploadTarget.ServesHistoricalBlocks() {
+		return true
+	}
+
+	// Unknown blocks are answered with a notfound message as usual.
+	header, err := s.chain.HeaderByHash(hash)
+	if err != nil {
+		return true
+	}
+	return time.Since(header.Timestamp) < historicalBlockAge
+}
+
 // pushBlockMsg sends a block message for the provided block hash to the
 // connected peer.  An error is returned if the block hash is not known.
 func (s *server) pushBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<- struct{},
@@ -1520,6 +1988,69 @@ func (s *server) pushBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan cha
 	return nil
 }
 
+// cmpctBlockEncoding returns the encoding of the transactions sent as part of
+// compact block messages of the passed compact block version.
+func cmpctBlockEncoding(version uint64) wire.MessageEncoding {
+	if version == wire.CmpctBlockVersionWTxID {
+		return wire.WitnessEncoding
+	}
+	return wire.BaseEncoding
+}
+
+// newCmpctBlockMsg returns a cmpctblock message of the passed compact block
+// version for the passed block with a random nonce.
+func newCmpctBlockMsg(block *wire.MsgBlock, version uint64) (*wire.MsgCmpctBlock, error) {
+	nonce, err := wire.RandomUint64()
+	if err != nil {
+		return nil, err
+	}
+	return wire.NewMsgCmpctBlockFromBlock(block, nonce, version)
+}
+
+// pushCmpctBlockMsg sends a cmpctblock message for the provided block hash to
+// the connected peer.  Blocks which are too deep in the main chain for the peer
+// to be able to reconstruct them, or which are requested by a peer that does
+// not use compact blocks, are sent in full instead.  An error is returned if
+// the block hash is not known.
+func (s *server) pushCmpctBlockMsg(sp *serverPeer, hash *chainhash.Hash,
+	doneChan chan<- struct{}, waitChan <-chan struct{}) error {
+
+	version := sp.CmpctBlockVersion()
+	height, err := s.chain.BlockHeightByHash(hash)
+	if version == 0 || err != nil ||
+		s.chain.BestSnapshot().Height-height >= maxCmpctBlockDepth {
+
+		encoding := wire.BaseEncoding
+		if sp.IsWitnessEnabled() {
+			encoding = wire.WitnessEncoding
+		}
+		return s.pushBlockMsg(sp, hash, doneChan, waitChan, encoding)
+	}
+
+	block, err := s.chain.BlockByHash(hash)
+	var msg *wire.MsgCmpctBlock
+	if err == nil {
+		msg, err = newCmpctBlockMsg(block.MsgBlock(), version)
+	}
+	if err != nil {
+		peerLog.Tracef("Unable to create compact block for requested "+
+			"block hash %v: %v", hash, err)
+
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return err
+	}
+
+	// Once we have fetched data wait for any previous operation to finish.
+	if waitChan != nil {
+		<-waitChan
+	}
+
+	sp.QueueMessageWithEncoding(msg, doneChan, cmpctBlockEncoding(version))
+	return nil
+}
+
 // pushMerkleBlockMsg sends a merkleblock message for the provided block hash to
 // the connected peer.  Since a merkle block requires the peer to have a filter
 // loaded, this call will simply be ignored if there is no filter loaded.  An
@@ -1585,8 +2116,11 @@ func (s *server) pushMerkleBlockMsg(sp *serverPeer, hash *chainhash.Hash,
 // announce a block we recently accepted.
 func (s *server) handleUpdatePeerHeights(state *peerState, umsg updatePeerHeightsMsg) {
 	state.forAllPeers(func(sp *serverPeer) {
-		// The origin peer should already have the updated height.
+		// The origin peer should already have the updated height.  Keep
+		// track of when it provided the block to decide which extra
+		// block-relay-only peers to keep.
 		if sp.Peer == umsg.originPeer {
+			sp.lastBlockTime = time.Now()
 			return
 		}
 
@@ -1636,16 +2170,13 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 		sp.Disconnect()
 		return false
 	}
-	if banEnd, ok := state.banned[host]; ok {
-		if time.Now().Before(banEnd) {
+	if ip := net.ParseIP(host); ip != nil {
+		if banEnd, ok := s.banManager.BanExpiry(ip); ok {
 			srvrLog.Debugf("Peer %s is banned for another %v - disconnecting",
 				host, time.Until(banEnd))
 			sp.Disconnect()
 			return false
 		}
-
-		srvrLog.Infof("Peer %s is no longer banned", host)
-		delete(state.banned, host)
 	}
 
 	// TODO: Check for max peers from a single IP.
@@ -1665,7 +2196,7 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 	if sp.Inbound() {
 		state.inboundPeers[sp.ID()] = sp
 	} else {
-		state.outboundGroups[addrmgr.GroupKey(sp.NA())]++
+		state.outboundGroups[s.addrManager.GroupKey(sp.NA())]++
 		if sp.persistent {
 			state.persistentPeers[sp.ID()] = sp
 		} else {
@@ -1690,8 +2221,11 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 	if !cfg.SimNet && !sp.Inbound() {
 		// Advertise the local address when the server accepts incoming
 		// connections and it believes itself to be close to the best
-		// known tip.
-		if !cfg.DisableListen && s.syncManager.IsCurrent() {
+		// known tip.  Addresses are not relayed with block-relay-only
+		// peers.
+		if !cfg.DisableListen && !sp.blockRelayOnly &&
+			s.syncManager.IsCurrent() {
+
 			// Get address that best matches.
 			lna := s.addrManager.GetBestLocalAddress(sp.NA())
 			if addrmgr.IsRoutable(lna) {
@@ -1704,8 +2238,10 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 		// Request known addresses if the server address manager needs
 		// more and the peer has a protocol version new enough to
 		// include a timestamp with addresses.
-		hasTimestamp := sp.ProtocolVersion() >= wire.NetAddressTimeVersion
-		if s.addrManager.NeedMoreAddresses() && hasTimestamp {
+		hasTimestamp := sp.HasCapability(wire.CapAddrTimestamp)
+		if s.addrManager.NeedMoreAddresses() && hasTimestamp &&
+			!sp.blockRelayOnly {
+
 			sp.QueueMessage(wire.NewMsgGetAddr(), nil)
 		}
 
@@ -1730,11 +2266,23 @@ func (s *server) handleDonePeerMsg(state *peerState, sp *serverPeer) {
 
 	// Regardless of whether the peer was found in our list, we'll inform
 	// our connection manager about the disconnection. This can happen if we
-	// process a peer's `done` message before its `add`.
+	// process a peer's `done` message before its `add`.  Block-relay-only
+	// peers are only replaced when there are fewer than targeted since the
+	// peer might have been an extra one.
 	if !sp.Inbound() {
-		if sp.persistent {
+		switch {
+		case sp.persistent:
 			s.connManager.Disconnect(sp.connReq.ID())
-		} else {
+		case sp.feeler:
+			s.connManager.Remove(sp.connReq.ID())
+		case sp.blockRelayOnly:
+			s.connManager.Remove(sp.connReq.ID())
+			if len(s.blockRelayOnlyPeers(state, sp)) <
+				s.targetBlockRelayOnly {
+
+				go s.connManager.NewBlockRelayOnlyConnReq()
+			}
+		default:
 			s.connManager.Remove(sp.connReq.ID())
 			go s.connManager.NewConnReq()
 		}
@@ -1742,7 +2290,7 @@ func (s *server) handleDonePeerMsg(state *peerState, sp *serverPeer) {
 
 	if _, ok := list[sp.ID()]; ok {
 		if !sp.Inbound() && sp.VersionKnown() {
-			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+			state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 		}
 		delete(list, sp.ID())
 		srvrLog.Debugf("Removed peer %s", sp)
@@ -1758,25 +2306,76 @@ func (s *server) handleBanPeerMsg(state *peerState, sp *serverPeer) {
 		srvrLog.Debugf("can't split ban peer %s %v", sp.Addr(), err)
 		return
 	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		srvrLog.Debugf("Not banning peer %s without an IP address", host)
+		return
+	}
+	if err := s.banManager.BanIP(ip, cfg.BanDuration); err != nil {
+		srvrLog.Warnf("Unable to save ban list: %v", err)
+	}
 	direction := directionString(sp.Inbound())
 	srvrLog.Infof("Banned peer %s (%s) for %v", host, direction,
 		cfg.BanDuration)
-	state.banned[host] = time.Now().Add(cfg.BanDuration)
 }
 
 // handleRelayInvMsg deals with relaying inventory to peers that are not already
 // known to have it.  It is invoked from the peerHandler goroutine.
 func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
+	// Blocks are announced by way of cmpctblock messages to the peers
+	// which selected us as one of their high-bandwidth compact block
+	// peers.  The messages are only created once per compact block
+	// version, and only when there are peers which want them.
+	var block *hdfutil.Block
+	cmpctBlocks := make(map[uint64]*wire.MsgCmpctBlock)
+	cmpctBlock := func(version uint64) (*wire.MsgCmpctBlock, error) {
+		if cmpctMsg, ok := cmpctBlocks[version]; ok {
+			return cmpctMsg, nil
+		}
+		if block == nil {
+			var err error
+			block, err = s.chain.BlockByHash(&msg.invVect.Hash)
+			if err != nil {
+				return nil, err
+			}
+		}
+		cmpctMsg, err := newCmpctBlockMsg(block.MsgBlock(), version)
+		if err != nil {
+			return nil, err
+		}
+		cmpctBlocks[version] = cmpctMsg
+		return cmpctMsg, nil
+	}
+
 	state.forAllPeers(func(sp *serverPeer) {
 		if !sp.Connected() {
 			return
 		}
 
-		// If the inventory is a block and the peer prefers headers,
-		// generate and send a headers message instead of an inventory
-		// message.
-		if msg.invVect.Type == wire.InvTypeBlock && sp.WantsHeaders() {
-			blockHeader, ok := msg.data.(wire.BlockHeader)
+		// If the inventory is a block and the peer wants new blocks in
+		// high-bandwidth compact block mode, send it a cmpctblock
+		// message instead of an inventory or headers message.
+		if msg.invVect.Type == wire.InvTypeBlock && sp.WantsCmpctBlocks() {
+			if sp.IsKnownInventory(msg.invVect) {
+				return
+			}
+			version := sp.CmpctBlockVersion()
+			cmpctMsg, err := cmpctBlock(version)
+			if err == nil {
+				sp.AddKnownInventory(msg.invVect)
+				sp.QueueMessageWithEncoding(cmpctMsg, nil,
+					cmpctBlockEncoding(version))
+				return
+			}
+			peerLog.Debugf("Unable to create compact block for "+
+				"block %v: %v", msg.invVect.Hash, err)
+		}
+
+		// If the inventory is a block and the peer prefers headers,
+		// generate and send a headers message instead of an inventory
+		// message.
+		if msg.invVect.Type == wire.InvTypeBlock && sp.WantsHeaders() {
+			blockHeader, ok := msg.data.(wire.BlockHeader)
 			if !ok {
 				peerLog.Warnf("Underlying data for headers" +
 					" is not a block header")
@@ -1807,13 +2406,6 @@ func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
 				return
 			}
 
-			// Don't relay the transaction if the transaction fee-per-kb
-			// is less than the peer's feefilter.
-			feeFilter := atomic.LoadInt64(&sp.feeFilter)
-			if feeFilter > 0 && txD.FeePerKB < feeFilter {
-				return
-			}
-
 			// Don't relay the transaction if there is a bloom
 			// filter loaded and the transaction doesn't match it.
 			if sp.filter.IsLoaded() {
@@ -1821,6 +2413,13 @@ func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
 					return
 				}
 			}
+
+			// Queue the transaction to be relayed in the order of
+			// its fee rate.  It will be dropped if its fee rate is
+			// below the feefilter of the peer by the time it is
+			// due to be relayed.
+			sp.QueueTxInventory(msg.invVect, txD.FeePerKB)
+			return
 		}
 
 		// Queue the inventory to be relayed with the next batch.
@@ -1844,6 +2443,14 @@ func (s *server) handleBroadcastMsg(state *peerState, bmsg *broadcastMsg) {
 			}
 		}
 
+		// Bulletins are not part of the bitcoin protocol, so they are
+		// only sent to peers which advertise support for them.
+		if bmsg.message.Command() == wire.CmdBulletin &&
+			sp.Services()&wire.SFNodeBulletin == 0 {
+
+			return
+		}
+
 		sp.QueueMessage(bmsg.message, nil)
 	})
 }
@@ -1861,6 +2468,10 @@ type getOutboundGroup struct {
 	reply chan int
 }
 
+type getOutboundNetworksMsg struct {
+	reply chan map[wire.NetworkID]int
+}
+
 type getAddedNodesMsg struct {
 	reply chan []*serverPeer
 }
@@ -1881,6 +2492,10 @@ type removeNodeMsg struct {
 	reply chan error
 }
 
+type disconnectBannedMsg struct {
+	reply chan int
+}
+
 // handleQuery is the central handler for all queries and commands from other
 // goroutines related to peer state.
 func (s *server) handleQuery(state *peerState, querymsg interface{}) {
@@ -1938,7 +2553,7 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 		found := disconnectPeer(state.persistentPeers, msg.cmp, func(sp *serverPeer) {
 			// Keep group counts ok since we remove from
 			// the list now.
-			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+			state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 		})
 
 		if found {
@@ -1953,6 +2568,15 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 		} else {
 			msg.reply <- 0
 		}
+
+	case getOutboundNetworksMsg:
+		networks := make(map[wire.NetworkID]int)
+		state.forAllOutboundPeers(func(sp *serverPeer) {
+			na := wire.NetAddressV2FromLegacy(sp.NA())
+			networks[addrmgr.AddrNetwork(na)]++
+		})
+		msg.reply <- networks
+
 	// Request a list of the persistent (added) peers.
 	case getAddedNodesMsg:
 		// Respond with a slice of the relevant peers.
@@ -1974,7 +2598,7 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 		found = disconnectPeer(state.outboundPeers, msg.cmp, func(sp *serverPeer) {
 			// Keep group counts ok since we remove from
 			// the list now.
-			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+			state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 		})
 		if found {
 			// If there are multiple outbound connections to the same
@@ -1982,7 +2606,7 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 			// peers are found.
 			for found {
 				found = disconnectPeer(state.outboundPeers, msg.cmp, func(sp *serverPeer) {
-					state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+					state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 				})
 			}
 			msg.reply <- nil
@@ -1990,6 +2614,38 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 		}
 
 		msg.reply <- errors.New("peer not found")
+
+	case disconnectBannedMsg:
+		banned := func(sp *serverPeer) bool {
+			host, _, err := net.SplitHostPort(sp.Addr())
+			if err != nil {
+				return false
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return false
+			}
+			_, ok := s.banManager.BanExpiry(ip)
+			return ok
+		}
+		decrementGroup := func(sp *serverPeer) {
+			state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
+		}
+
+		// Disconnect the peers in each list until no banned peers are
+		// left in it.  Keep the group counts of outbound peers ok
+		// since they are removed from the lists now.
+		var count int
+		for disconnectPeer(state.inboundPeers, banned, nil) {
+			count++
+		}
+		for disconnectPeer(state.outboundPeers, banned, decrementGroup) {
+			count++
+		}
+		for disconnectPeer(state.persistentPeers, banned, decrementGroup) {
+			count++
+		}
+		msg.reply <- count
 	}
 }
 
@@ -2017,9 +2673,180 @@ func disconnectPeer(peerList map[int32]*serverPeer, compareFunc func(*serverPeer
 	return false
 }
 
-// newPeerConfig returns the configuration for the given serverPeer.
+// anchorAddresses returns the addresses of the connected outbound peers which
+// are persisted as anchors, ordered from most to least preferred.  Peers which
+// most recently were the first to relay a new block are preferred, followed by
+// the peers which have been connected the longest.  Persistent peers are not
+// included since they are reconnected to regardless.
+func (s *server) anchorAddresses(state *peerState) []*wire.NetAddress {
+	relayed := make(map[*peer.Peer]int)
+	for i, p := range s.hbPeers.Peers() {
+		relayed[p] = i + 1
+	}
+
+	peers := make([]*serverPeer, 0, len(state.outboundPeers))
+	for _, sp := range state.outboundPeers {
+		if sp.Connected() && sp.VersionKnown() {
+			peers = append(peers, sp)
+		}
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		ri, rj := relayed[peers[i].Peer], relayed[peers[j].Peer]
+		if ri != rj {
+			return ri > rj
+		}
+		return peers[i].TimeConnected().Before(peers[j].TimeConnected())
+	})
+
+	addrs := make([]*wire.NetAddress, 0, len(peers))
+	for _, sp := range peers {
+		addrs = append(addrs, sp.NA())
+	}
+	return addrs
+}
+
+// handleRotatePeer disconnects the outbound peer which has been connected the
+// longest so the connection manager replaces it with a new peer.  Persistent
+// peers, block-relay-only peers and the sync peer are never rotated and no peer is rotated while the
+// chain is not current to avoid disrupting the initial block download.  It is
+// invoked from the peerHandler goroutine.
+func (s *server) handleRotatePeer(state *peerState) {
+	if !s.syncManager.IsCurrent() {
+		return
+	}
+
+	var oldest *serverPeer
+	syncPeerID := s.syncManager.SyncPeerID()
+	for _, sp := range state.outboundPeers {
+		if !sp.Connected() || !sp.VersionKnown() || sp.ID() == syncPeerID ||
+			sp.blockRelayOnly {
+
+			continue
+		}
+		if oldest == nil || sp.TimeConnected().Before(oldest.TimeConnected()) {
+			oldest = sp
+		}
+	}
+	if oldest == nil {
+		return
+	}
+
+	netGroup := s.addrManager.GroupKey(oldest.NA())
+	disconnectPeer(state.outboundPeers, func(sp *serverPeer) bool {
+		return sp == oldest
+	}, func(sp *serverPeer) {
+		// Keep group counts ok since we remove from the list now.
+		state.outboundGroups[netGroup]--
+	})
+
+	s.peerRotationsMtx.Lock()
+	if len(s.peerRotations) == maxPeerRotationHistory {
+		copy(s.peerRotations, s.peerRotations[1:])
+		s.peerRotations = s.peerRotations[:maxPeerRotationHistory-1]
+	}
+	s.peerRotations = append(s.peerRotations, peerRotation{
+		time:     time.Now(),
+		id:       oldest.ID(),
+		addr:     oldest.Addr(),
+		netGroup: netGroup,
+	})
+	s.peerRotationsMtx.Unlock()
+
+	srvrLog.Debugf("Rotated outbound peer %s (netgroup %s)", oldest,
+		netGroup)
+}
+
+// blockRelayOnlyPeers returns the outbound block-relay-only peers other than
+// the passed one, which may be nil.  It is invoked from the peerHandler
+// goroutine.
+func (s *server) blockRelayOnlyPeers(state *peerState, exclude *serverPeer) []*serverPeer {
+	var peers []*serverPeer
+	for _, sp := range state.outboundPeers {
+		if sp.blockRelayOnly && sp != exclude {
+			peers = append(peers, sp)
+		}
+	}
+	return peers
+}
+
+// handleEvictExtraBlockRelay disconnects a block-relay-only peer when there
+// are more than targeted due to an extra connection made by the connection
+// manager to check whether the other peers are withholding blocks.  The newest
+// peer is disconnected unless it provided a block more recently than the next
+// newest one, in which case the latter is disconnected instead.  It is invoked
+// from the peerHandler goroutine.
+func (s *server) handleEvictExtraBlockRelay(state *peerState) {
+	var peers []*serverPeer
+	for _, sp := range s.blockRelayOnlyPeers(state, nil) {
+		if sp.Connected() && sp.VersionKnown() {
+			peers = append(peers, sp)
+		}
+	}
+	if len(peers) <= s.targetBlockRelayOnly || len(peers) < 2 {
+		return
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].TimeConnected().After(peers[j].TimeConnected())
+	})
+	newest, nextNewest := peers[0], peers[1]
+
+	// Give the newest peer a chance to announce blocks first.
+	if time.Since(newest.TimeConnected()) < minBlockRelayConnectTime {
+		return
+	}
+
+	evict := newest
+	if newest.lastBlockTime.After(nextNewest.lastBlockTime) {
+		evict = nextNewest
+	}
+	disconnectPeer(state.outboundPeers, func(sp *serverPeer) bool {
+		return sp == evict
+	}, func(sp *serverPeer) {
+		// Keep group counts ok since we remove from the list now.
+		state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
+	})
+
+	srvrLog.Debugf("Disconnected extra block-relay-only peer %s (last "+
+		"block at %v)", evict, evict.lastBlockTime)
+}
+
+// PeerRotations returns the history of the outbound peers disconnected by the
+// periodic outbound peer rotation from oldest to newest.
+//
+// This function is safe for concurrent access.
+func (s *server) PeerRotations() []peerRotation {
+	s.peerRotationsMtx.Lock()
+	rotations := make([]peerRotation, len(s.peerRotations))
+	copy(rotations, s.peerRotations)
+	s.peerRotationsMtx.Unlock()
+	return rotations
+}
+
+// recentlyRotatedGroup returns whether or not an outbound peer in the passed
+// network group was disconnected by one of the most recent peer rotations.
+//
+// This function is safe for concurrent access.
+func (s *server) recentlyRotatedGroup(key string) bool {
+	s.peerRotationsMtx.Lock()
+	defer s.peerRotationsMtx.Unlock()
+
+	start := len(s.peerRotations) - peerRotationAvoidGroups
+	if start < 0 {
+		start = 0
+	}
+	for _, rotation := range s.peerRotations[start:] {
+		if rotation.netGroup == key {
+			return true
+		}
+	}
+	return false
+}
+
+// newPeerConfig returns the configuration for the given serverPeer.  The
+// whitelisted status of the peer must be set beforehand since whitelisted
+// peers are exempt from the bandwidth rate limits and misbehavior scoring.
 func newPeerConfig(sp *serverPeer) *peer.Config {
-	return &peer.Config{
+	peerCfg := &peer.Config{
 		Listeners: peer.MessageListeners{
 			OnVersion:      sp.OnVersion,
 			OnVerAck:       sp.OnVerAck,
@@ -2034,12 +2861,18 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 			OnGetCFilters:  sp.OnGetCFilters,
 			OnGetCFHeaders: sp.OnGetCFHeaders,
 			OnGetCFCheckpt: sp.OnGetCFCheckpt,
+			OnCFHeaders:    sp.OnCFHeaders,
 			OnFeeFilter:    sp.OnFeeFilter,
 			OnFilterAdd:    sp.OnFilterAdd,
 			OnFilterClear:  sp.OnFilterClear,
 			OnFilterLoad:   sp.OnFilterLoad,
 			OnGetAddr:      sp.OnGetAddr,
 			OnAddr:         sp.OnAddr,
+			OnAddrV2:       sp.OnAddrV2,
+			OnBulletin:     sp.OnBulletin,
+			OnCmpctBlock:   sp.OnCmpctBlock,
+			OnGetBlockTxn:  sp.OnGetBlockTxn,
+			OnBlockTxn:     sp.OnBlockTxn,
 			OnRead:         sp.OnRead,
 			OnWrite:        sp.OnWrite,
 			OnNotFound:     sp.OnNotFound,
@@ -2050,18 +2883,31 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 			// other implementations' alert messages, we will not relay theirs.
 			OnAlert: nil,
 		},
-		NewestBlock:       sp.newestBlock,
-		HostToNetAddress:  sp.server.addrManager.HostToNetAddress,
-		Proxy:             cfg.Proxy,
-		UserAgentName:     userAgentName,
-		UserAgentVersion:  userAgentVersion,
-		UserAgentComments: cfg.UserAgentComments,
-		ChainParams:       sp.server.chainParams,
-		Services:          sp.server.services,
-		DisableRelayTx:    cfg.BlocksOnly,
-		ProtocolVersion:   peer.MaxProtocolVersion,
-		TrickleInterval:   cfg.TrickleInterval,
-	}
+		NewestBlock:         sp.newestBlock,
+		HostToNetAddress:    sp.server.addrManager.HostToNetAddress,
+		Proxy:               cfg.Proxy,
+		UserAgentName:       userAgentName,
+		UserAgentVersion:    userAgentVersion,
+		UserAgentComments:   cfg.UserAgentComments,
+		ChainParams:         sp.server.chainParams,
+		Services:            sp.server.services,
+		DisableRelayTx:      cfg.BlocksOnly || sp.blockRelayOnly || sp.feeler,
+		ProtocolVersion:     peer.MaxProtocolVersion,
+		TrickleInterval:     cfg.TrickleInterval,
+		SkipLocalChecksums:  cfg.SkipLocalChecksums,
+		Compression:         cfg.PeerCompression,
+		CmpctBlockVersion:   wire.CmpctBlockVersionWTxID,
+		DiscourageThreshold: cfg.BanThreshold,
+		DisableMisbehavior:  cfg.DisableBanning || sp.isWhitelisted,
+		OnDiscourage:        sp.OnDiscourage,
+	}
+	if !sp.isWhitelisted {
+		peerCfg.MaxUploadRate = cfg.PeerMaxUploadRate * 1024
+		peerCfg.MaxDownloadRate = cfg.PeerMaxDownloadRate * 1024
+		peerCfg.UploadLimiter = sp.server.uploadLimiter
+		peerCfg.DownloadLimiter = sp.server.downloadLimiter
+	}
+	return peerCfg
 }
 
 // inboundPeerConnected is invoked by the connection manager when a new inbound
@@ -2083,12 +2929,21 @@ func (s *server) inboundPeerConnected(conn net.Conn) {
 // manager of the attempt.
 func (s *server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
 	sp := newServerPeer(s, c.Permanent)
+	sp.isWhitelisted = isWhitelisted(conn.RemoteAddr())
+	sp.blockRelayOnly = c.BlockRelayOnly
+	sp.feeler = c.Feeler
 	p, err := peer.NewOutboundPeer(newPeerConfig(sp), c.Addr.String())
 	if err != nil {
 		srvrLog.Debugf("Cannot create outbound peer %s: %v", c.Addr, err)
-		if c.Permanent {
+		switch {
+		case c.Permanent:
 			s.connManager.Disconnect(c.ID())
-		} else {
+		case c.Feeler:
+			s.connManager.Remove(c.ID())
+		case c.BlockRelayOnly:
+			s.connManager.Remove(c.ID())
+			go s.connManager.NewBlockRelayOnlyConnReq()
+		default:
 			s.connManager.Remove(c.ID())
 			go s.connManager.NewConnReq()
 		}
@@ -2096,7 +2951,6 @@ func (s *server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
 	}
 	sp.Peer = p
 	sp.connReq = c
-	sp.isWhitelisted = isWhitelisted(conn.RemoteAddr())
 	sp.AssociateConnection(conn)
 	go s.peerDoneHandler(sp)
 }
@@ -2106,9 +2960,10 @@ func (s *server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
 func (s *server) peerDoneHandler(sp *serverPeer) {
 	sp.WaitForDisconnect()
 	s.donePeers <- sp
+	s.hbPeers.Remove(sp.Peer)
 
 	// Only tell sync manager we are gone if we ever told it we existed.
-	if sp.VerAckReceived() {
+	if sp.VerAckReceived() && !sp.feeler {
 		s.syncManager.DonePeer(sp.Peer)
 
 		// Evict any remaining orphans that were sent by the peer.
@@ -2140,7 +2995,6 @@ func (s *server) peerHandler() {
 		inboundPeers:    make(map[int32]*serverPeer),
 		persistentPeers: make(map[int32]*serverPeer),
 		outboundPeers:   make(map[int32]*serverPeer),
-		banned:          make(map[string]time.Time),
 		outboundGroups:  make(map[string]int),
 	}
 
@@ -2158,6 +3012,28 @@ func (s *server) peerHandler() {
 	}
 	go s.connManager.Start()
 
+	// Periodically rotate an outbound peer when enabled.
+	var rotatePeerChan <-chan time.Time
+	if cfg.PeerRotateInterval > 0 {
+		rotatePeerTicker := time.NewTicker(cfg.PeerRotateInterval)
+		defer rotatePeerTicker.Stop()
+		rotatePeerChan = rotatePeerTicker.C
+	}
+
+	// Periodically disconnect extra block-relay-only peers when the
+	// connection manager makes them.
+	var extraBlockRelayChan <-chan time.Time
+	if s.targetBlockRelayOnly > 0 && cfg.ExtraBlockRelay > 0 {
+		extraBlockRelayTicker := time.NewTicker(extraBlockRelayCheckInterval)
+		defer extraBlockRelayTicker.Stop()
+		extraBlockRelayChan = extraBlockRelayTicker.C
+	}
+
+	// Periodically update the feefilter of peers since the minimum fee
+	// rate required to enter the mempool changes as it fills up.
+	feeFilterTicker := time.NewTicker(feeFilterInterval)
+	defer feeFilterTicker.Stop()
+
 out:
 	for {
 		select {
@@ -2189,7 +3065,27 @@ out:
 		case qmsg := <-s.query:
 			s.handleQuery(state, qmsg)
 
+		// Outbound peer to rotate.
+		case <-rotatePeerChan:
+			s.handleRotatePeer(state)
+
+		// Extra block-relay-only peer to disconnect.
+		case <-extraBlockRelayChan:
+			s.handleEvictExtraBlockRelay(state)
+
+		// Minimum fee rate to announce to peers.
+		case <-feeFilterTicker.C:
+			minFee := s.txMemPool.MinFeeRate()
+			state.forAllPeers(func(sp *serverPeer) {
+				sp.pushFeeFilterMsg(minFee)
+			})
+
 		case <-s.quit:
+			// Persist the anchors before the peers are
+			// disconnected so they are reconnected to first on
+			// the next start.
+			s.addrManager.SetAnchors(s.anchorAddresses(state))
+
 			// Disconnect all peers on server shutdown.
 			state.forAllPeers(func(sp *serverPeer) {
 				srvrLog.Tracef("Shutdown peer %s", sp)
@@ -2232,6 +3128,14 @@ func (s *server) BanPeer(sp *serverPeer) {
 	s.banPeers <- sp
 }
 
+// DisconnectBanned disconnects all connected peers whose IP addresses are
+// banned and returns the number of peers it disconnected.
+func (s *server) DisconnectBanned() int {
+	replyChan := make(chan int)
+	s.query <- disconnectBannedMsg{reply: replyChan}
+	return <-replyChan
+}
+
 // RelayInventory relays the passed inventory vector to all connected peers
 // that are not already known to have it.
 func (s *server) RelayInventory(invVect *wire.InvVect, data interface{}) {
@@ -2264,16 +3168,32 @@ func (s *server) OutboundGroupCount(key string) int {
 	return <-replyChan
 }
 
+// OutboundNetworkCounts returns the number of outbound peers connected on each
+// network.
+func (s *server) OutboundNetworkCounts() map[wire.NetworkID]int {
+	replyChan := make(chan map[wire.NetworkID]int)
+	s.query <- getOutboundNetworksMsg{reply: replyChan}
+	return <-replyChan
+}
+
 // AddBytesSent adds the passed number of bytes to the total bytes sent counter
 // for the server.  It is safe for concurrent access.
 func (s *server) AddBytesSent(bytesSent uint64) {
 	atomic.AddUint64(&s.bytesSent, bytesSent)
+	if s.uploadTarget.Add(bytesSent) {
+		state := s.uploadTarget.State()
+		srvrLog.Infof("Upload target of %d MiB almost reached -- no "+
+			"longer serving historical blocks to non-whitelisted "+
+			"peers for %v", state.Target/(1024*1024),
+			state.TimeLeftInCycle.Truncate(time.Second))
+	}
 }
 
 // AddBytesReceived adds the passed number of bytes to the total bytes received
 // counter for the server.  It is safe for concurrent access.
 func (s *server) AddBytesReceived(bytesReceived uint64) {
 	atomic.AddUint64(&s.bytesReceived, bytesReceived)
+	s.downloadTarget.Add(bytesReceived)
 }
 
 // NetTotals returns the sum of all bytes received and sent across the network
@@ -2283,6 +3203,34 @@ func (s *server) NetTotals() (uint64, uint64) {
 		atomic.LoadUint64(&s.bytesSent)
 }
 
+// BandwidthStats returns the bytes sent to and received from all peers per
+// message command along with the current send and receive rates.  It is safe
+// for concurrent access.
+func (s *server) BandwidthStats() peer.BandwidthStats {
+	return s.bandwidth.Stats()
+}
+
+// NetTargets returns the bytes sent and received during the current cycle
+// relative to the upload and download targets.  It is safe for concurrent
+// access.
+func (s *server) NetTargets() (netTargetState, netTargetState) {
+	return s.uploadTarget.State(), s.downloadTarget.State()
+}
+
+// BlockRelayedByPeer promotes the passed peer to one of the peers which are
+// asked to announce new blocks in high-bandwidth compact block mode since it
+// was the first to deliver a block which extended the main chain.  It is safe
+// for concurrent access and is part of the netsync.PeerNotifier interface.
+func (s *server) BlockRelayedByPeer(p *peer.Peer) {
+	s.hbPeers.Promote(p)
+}
+
+// RateLimits returns the throttling performed by the upload and download rate
+// limits of all peers combined.  It is safe for concurrent access.
+func (s *server) RateLimits() (peer.RateLimiterStats, peer.RateLimiterStats) {
+	return s.uploadLimiter.Stats(), s.downloadLimiter.Stats()
+}
+
 // UpdatePeerHeights updates the heights of all peers who have have announced
 // the latest connected main chain block, or a recognized orphan. These height
 // updates allow us to dynamically refresh peer heights, ensuring sync peer
@@ -2378,11 +3326,16 @@ func (s *server) Start() {
 
 		// Start the rebroadcastHandler, which ensures user tx received by
 		// the RPC server are rebroadcast until being included in a block.
+		// The RPC server itself is already started when the server is
+		// created so it can report the progress of the startup work.
 		go s.rebroadcastHandler()
-
-		s.rpcServer.Start()
 	}
 
+	// Start rebroadcasting the mempool transactions which are likely
+	// missing from the mempools of other peers.  It has no effect when
+	// rebroadcasting is disabled.
+	s.rebroadcastMgr.Start()
+
 	// Start the CPU miner if generation is enabled.
 	if cfg.Generate {
 		s.cpuMiner.Start()
@@ -2403,11 +3356,20 @@ func (s *server) Stop() error {
 	// Stop the CPU miner if needed
 	s.cpuMiner.Stop()
 
+	// Stop rebroadcasting mempool transactions.
+	s.rebroadcastMgr.Stop()
+
 	// Shutdown the RPC server if it's not disabled.
 	if !cfg.DisableRPC {
 		s.rpcServer.Stop()
 	}
 
+	// Save the transaction memory pool so it can be restored on the next
+	// start.
+	if !cfg.NoPersistMempool {
+		s.saveMempool()
+	}
+
 	// Save fee estimator state in the database.
 	s.db.Update(func(tx database.Tx) error {
 		metadata := tx.Metadata()
@@ -2421,6 +3383,62 @@ func (s *server) Stop() error {
 	return nil
 }
 
+// loadMempool adds the transactions saved by saveMempool, if any, back to the
+// transaction memory pool.
+func (s *server) loadMempool() {
+	path := filepath.Join(cfg.DataDir, mempoolFilename)
+	f, err := os.Open(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			srvrLog.Errorf("Unable to open saved mempool: %v", err)
+		}
+		return
+	}
+	defer f.Close()
+
+	txDescs, err := s.txMemPool.Load(bufio.NewReader(f))
+	if err != nil {
+		srvrLog.Errorf("Unable to load saved mempool from %s: %v",
+			path, err)
+	}
+	srvrLog.Infof("Loaded %d transactions from saved mempool",
+		len(txDescs))
+}
+
+// saveMempool writes the transactions in the transaction memory pool to the
+// data directory so they can be restored by loadMempool on the next start.
+// The file is replaced atomically so a failure doesn't corrupt a previously
+// saved mempool.
+func (s *server) saveMempool() {
+	path := filepath.Join(cfg.DataDir, mempoolFilename)
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		srvrLog.Errorf("Unable to create mempool file: %v", err)
+		return
+	}
+
+	w := bufio.NewWriter(f)
+	err = s.txMemPool.Save(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		srvrLog.Errorf("Unable to save mempool: %v", err)
+		os.Remove(tmpPath)
+		return
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		srvrLog.Errorf("Unable to save mempool: %v", err)
+		return
+	}
+	srvrLog.Infof("Saved %d transactions from the mempool",
+		s.txMemPool.Count())
+}
+
 // WaitForShutdown blocks until the main listener and peer handlers are stopped.
 func (s *server) WaitForShutdown() {
 	s.wg.Wait()
@@ -2610,9 +3628,42 @@ func setupRPCListeners() ([]net.Listener, error) {
 		listeners = append(listeners, listener)
 	}
 
+	// Unix domain sockets are only reachable from the local host, so TLS
+	// is intentionally not used for them.
+	for _, path := range cfg.RPCUnixListeners {
+		listener, err := listenUnix(path, cfg.unixSocketMode)
+		if err != nil {
+			rpcsLog.Warnf("Can't listen on %s: %v", path, err)
+			continue
+		}
+		listeners = append(listeners, listener)
+	}
+
 	return listeners, nil
 }
 
+// listenUnix returns a unix domain socket listener at the passed path with the
+// file permissions set to the provided mode.  Any socket file left behind by a
+// previous instance which was not shut down cleanly is removed first.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	fi, err := os.Lstat(path)
+	if err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
 // newServer returns a new hdfd server configured to listen on addr for the
 // bitcoin network type specified by chainParams.  Use start to begin accepting
 // connections from peers.
@@ -2627,9 +3678,73 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	if cfg.NoCFilters {
 		services &^= wire.SFNodeCF
 	}
+	if cfg.Prune != 0 || cfg.UTXOSnapshot != "" {
+		// Pruned nodes are only able to serve the most recent blocks,
+		// so signal that instead of being a full node (BIP0159).  The
+		// same applies to nodes bootstrapped from a utxo snapshot since
+		// they lack the historical blocks until they are downloaded.
+		services &^= wire.SFNodeNetwork
+		services |= wire.SFNodeNetworkLimited
+	}
+	if cfg.HeadersOnly {
+		// Nodes which only sync the headers are not able to serve any
+		// blocks, nor the data derived from them.
+		services &^= wire.SFNodeNetwork | wire.SFNodeNetworkLimited |
+			wire.SFNodeBloom | wire.SFNodeCF
+	}
+
+	// Network bulletins are only supported when there are keys which are
+	// allowed to sign them.
+	serializedKeys := append([][]byte(nil), chainParams.BulletinKeys...)
+	serializedKeys = append(serializedKeys, cfg.bulletinKeys...)
+	bulletinKeys := make([]*hdfec.PublicKey, 0, len(serializedKeys))
+	for _, serializedKey := range serializedKeys {
+		key, err := hdfec.ParsePubKey(serializedKey, hdfec.S256())
+		if err != nil {
+			return nil, fmt.Errorf("invalid bulletin key %x: %v",
+				serializedKey, err)
+		}
+		bulletinKeys = append(bulletinKeys, key)
+	}
+	if len(bulletinKeys) > 0 {
+		services |= wire.SFNodeBulletin
+	}
+	if cfg.PeerCompression {
+		services |= wire.SFNodeCompression
+	}
 
 	amgr := addrmgr.New(cfg.DataDir, hdfdLookup)
 
+	// Tor hidden services are not reachable when connecting to them is
+	// disabled.
+	if cfg.NoOnion {
+		amgr.SetReachableNetworks(wire.NetIDIPv4, wire.NetIDIPv6)
+	}
+
+	// Group addresses by the autonomous systems announcing them when an
+	// ASMap is provided.
+	if cfg.ASMap != "" {
+		data, err := ioutil.ReadFile(cfg.ASMap)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read ASMap: %v", err)
+		}
+		if err := amgr.SetASMap(data); err != nil {
+			return nil, fmt.Errorf("unable to load ASMap %s: %v",
+				cfg.ASMap, err)
+		}
+		info := amgr.ASMapInfo()
+		srvrLog.Infof("Loaded ASMap %s (%d bytes, checksum %v)",
+			cfg.ASMap, info.Size, info.Checksum)
+	}
+
+	// Bans are kept across restarts.  Failing to load them is not fatal
+	// since the node works without them.
+	banManager := connmgr.NewBanManager(filepath.Join(cfg.DataDir,
+		banListFilename))
+	if err := banManager.Load(); err != nil {
+		srvrLog.Warnf("Unable to load ban list: %v", err)
+	}
+
 	var listeners []net.Listener
 	var nat NAT
 	if !cfg.DisableListen {
@@ -2653,6 +3768,7 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	s := server{
 		chainParams:          chainParams,
 		addrManager:          amgr,
+		banManager:           banManager,
 		newPeers:             make(chan *serverPeer, cfg.MaxPeers),
 		donePeers:            make(chan *serverPeer, cfg.MaxPeers),
 		banPeers:             make(chan *serverPeer, cfg.MaxPeers),
@@ -2671,6 +3787,50 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		cfCheckptCaches:      make(map[wire.FilterType][]cfHeaderKV),
 		agentBlacklist:       agentBlacklist,
 		agentWhitelist:       agentWhitelist,
+		bulletinKeys:         bulletinKeys,
+		bandwidth:            peer.NewBandwidthCounter(),
+		uploadTarget: newNetTarget(cfg.MaxUploadTarget*1024*1024,
+			netTargetTimeFrame),
+		downloadTarget: newNetTarget(cfg.MaxDownloadTarget*1024*1024,
+			netTargetTimeFrame),
+		uploadLimiter:   peer.NewRateLimiter(cfg.MaxUploadRate * 1024),
+		downloadLimiter: peer.NewRateLimiter(cfg.MaxDownloadRate * 1024),
+		hbPeers:         peer.NewHighBandwidthPeers(peer.MaxHighBandwidthPeers),
+	}
+
+	// Start the RPC server before loading the chain so clients are told
+	// that the node is warming up, along with the progress of the startup
+	// work, instead of being unable to connect or receiving misleading
+	// errors while it is done.  The rest of the RPC server config is only
+	// provided once the startup work is complete.
+	if !cfg.DisableRPC {
+		// Setup listeners for the configured RPC listen addresses and
+		// TLS settings.
+		rpcListeners, err := setupRPCListeners()
+		if err != nil {
+			return nil, err
+		}
+		if len(rpcListeners) == 0 {
+			return nil, errors.New("RPCS: No valid listen address")
+		}
+
+		s.rpcServer, err = newRPCServer(&rpcserverConfig{
+			Listeners:   rpcListeners,
+			TimeSource:  s.timeSource,
+			ChainParams: chainParams,
+			DB:          db,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// Signal process shutdown when the RPC server requests it.
+		go func() {
+			<-s.rpcServer.RequestedProcessShutdown()
+			shutdownRequestChannel <- struct{}{}
+		}()
+
+		s.rpcServer.Start()
 	}
 
 	// Create the transaction and address indexes if needed.
@@ -2708,7 +3868,16 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	// Create an index manager if any of the optional indexes are enabled.
 	var indexManager blockchain.IndexManager
 	if len(indexes) > 0 {
-		indexManager = indexers.NewManager(db, indexes)
+		manager := indexers.NewManager(db, indexes)
+		if s.rpcServer != nil {
+			manager.SetCatchUpProgressFunc(func(height, bestHeight int32) {
+				status := fmt.Sprintf("Catching up indexes to "+
+					"height %d", bestHeight)
+				progress := float64(height) * 100 / float64(bestHeight)
+				s.rpcServer.SetWarmupStatus(status, progress)
+			})
+		}
+		indexManager = manager
 	}
 
 	// Merge given checkpoints with the default ones unless they are disabled.
@@ -2717,17 +3886,40 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		checkpoints = mergeCheckpoints(s.chainParams.Checkpoints, cfg.addCheckpoints)
 	}
 
+	// Open the utxo set snapshot to bootstrap the chain state from when
+	// requested.
+	var utxoSnapshot io.Reader
+	if cfg.UTXOSnapshot != "" {
+		f, err := os.Open(cfg.UTXOSnapshot)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		utxoSnapshot = bufio.NewReader(f)
+	}
+
 	// Create a new block chain instance with the appropriate configuration.
+	if s.rpcServer != nil {
+		s.rpcServer.SetWarmupStatus("Loading block chain", 0)
+	}
 	var err error
 	s.chain, err = blockchain.New(&blockchain.Config{
-		DB:           s.db,
-		Interrupt:    interrupt,
-		ChainParams:  s.chainParams,
-		Checkpoints:  checkpoints,
-		TimeSource:   s.timeSource,
-		SigCache:     s.sigCache,
-		IndexManager: indexManager,
-		HashCache:    s.hashCache,
+		DB:                   s.db,
+		Interrupt:            interrupt,
+		ChainParams:          s.chainParams,
+		Checkpoints:          checkpoints,
+		CheckpointMode:       cfg.checkpointMode,
+		MinimumChainWork:     cfg.minimumChainWork,
+		AssumeValid:          cfg.assumeValid,
+		TimeSource:           s.timeSource,
+		SigCache:             s.sigCache,
+		IndexManager:         indexManager,
+		HashCache:            s.hashCache,
+		Prune:                cfg.Prune * 1024 * 1024,
+		UtxoCacheMaxSize:     cfg.UtxoCacheMaxSize * 1024 * 1024,
+		RecentBlockCacheSize: int(cfg.RecentBlockCacheSize),
+		UTXOSnapshot:         utxoSnapshot,
+		UTXOSnapshotHash:     cfg.utxoSnapshotHash,
 	})
 	if err != nil {
 		return nil, err
@@ -2756,11 +3948,11 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	})
 
 	// If no feeEstimator has been found, or if the one that has been found
-	// is behind somehow, create a new one and start over.
-	if s.feeEstimator == nil || s.feeEstimator.LastKnownHeight() != s.chain.BestSnapshot().Height {
-		s.feeEstimator = mempool.NewFeeEstimator(
-			mempool.DefaultEstimateFeeMaxRollback,
-			mempool.DefaultEstimateFeeMinRegisteredBlocks)
+	// is ahead of the chain somehow, create a new one and start over.  An
+	// estimator which is behind is kept since its data is still useful and
+	// decays as new blocks are registered.
+	if s.feeEstimator == nil || s.feeEstimator.LastKnownHeight() > s.chain.BestSnapshot().Height {
+		s.feeEstimator = mempool.NewFeeEstimator()
 	}
 
 	txC := mempool.Config{
@@ -2770,10 +3962,20 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 			FreeTxRelayLimit:     cfg.FreeTxRelayLimit,
 			MaxOrphanTxs:         cfg.MaxOrphanTxs,
 			MaxOrphanTxSize:      defaultMaxOrphanTxSize,
+			MaxOrphanBytesPerTag: cfg.MaxOrphanPeerBytes,
 			MaxSigOpCostPerTx:    blockchain.MaxBlockSigOpsCost / 4,
+			BytesPerSigOp:        cfg.BytesPerSigOp,
 			MinRelayTxFee:        cfg.minRelayTxFee,
+			MaxDataCarrierSize:   cfg.DataCarrierSize,
 			MaxTxVersion:         2,
-			RejectReplacement:    cfg.RejectReplacement,
+			AcceptReplacement:    cfg.AcceptReplacement,
+			MaxRejectedTxs:       mempool.DefaultMaxRejectedTxs,
+			MaxAncestorCount:     cfg.LimitAncestorCount,
+			MaxAncestorSize:      cfg.LimitAncestorSize,
+			MaxDescendantCount:   cfg.LimitDescendantCount,
+			MaxDescendantSize:    cfg.LimitDescendantSize,
+			MaxPoolSize:          int64(cfg.MaxMempool) * 1000000,
+			MaxTxAge:             cfg.MempoolExpiry,
 		},
 		ChainParams:    chainParams,
 		FetchUtxoView:  s.chain.FetchUtxoView,
@@ -2787,8 +3989,17 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		HashCache:          s.hashCache,
 		AddrIndex:          s.addrIndex,
 		FeeEstimator:       s.feeEstimator,
+		OnTxReplaced:       s.TransactionReplaced,
 	}
 	s.txMemPool = mempool.New(&txC)
+	if !cfg.NoPersistMempool {
+		s.loadMempool()
+	}
+	s.rebroadcastMgr = mempool.NewRebroadcastManager(&mempool.RebroadcastConfig{
+		TxPool:   s.txMemPool,
+		Interval: cfg.RebroadcastInterval,
+		Announce: s.relayTransactions,
+	})
 
 	s.syncManager, err = netsync.New(&netsync.Config{
 		PeerNotifier:       &s,
@@ -2798,6 +4009,9 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		DisableCheckpoints: cfg.DisableCheckpoints,
 		MaxPeers:           cfg.MaxPeers,
 		FeeEstimator:       s.feeEstimator,
+		HeadersOnly:        cfg.HeadersOnly,
+		SyncCFHeaders:      cfg.SyncCFHeaders,
+		TimeSource:         s.timeSource,
 	})
 	if err != nil {
 		return nil, err
@@ -2819,6 +4033,14 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	blockTemplateGenerator := mining.NewBlkTmplGenerator(&policy,
 		s.chainParams, s.txMemPool, s.chain, s.timeSource,
 		s.sigCache, s.hashCache)
+	err = blockTemplateGenerator.SetTemplateOptions(&mining.TemplateOptions{
+		CoinbaseData: cfg.miningCoinbaseData,
+		VersionBits:  cfg.miningVersionBits,
+		MinTxFeeRate: cfg.miningMinTxFee,
+	})
+	if err != nil {
+		return nil, err
+	}
 	s.cpuMiner = cpuminer.New(&cpuminer.Config{
 		ChainParams:            chainParams,
 		BlockTemplateGenerator: blockTemplateGenerator,
@@ -2835,10 +4057,31 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	// discovered peers in order to prevent it from becoming a public test
 	// network.
 	var newAddressFunc func() (net.Addr, error)
+	var feelerAddressFunc func() (net.Addr, error)
+	var getAnchorsFunc func() []net.Addr
 	if !cfg.SimNet && len(cfg.ConnectPeers) == 0 {
 		newAddressFunc = func() (net.Addr, error) {
+			// Prefer the reachable networks without any outbound
+			// peers so the node is connected to at least one peer
+			// on each of them rather than only on the network most
+			// known addresses belong to.
+			var missing []wire.NetworkID
+			outbound := s.OutboundNetworkCounts()
+			for _, netID := range s.addrManager.ReachableNetworks() {
+				if outbound[netID] == 0 {
+					missing = append(missing, netID)
+				}
+			}
+
 			for tries := 0; tries < 100; tries++ {
-				addr := s.addrManager.GetAddress()
+				var addr *addrmgr.KnownAddress
+				if tries < 30 && len(missing) > 0 {
+					netID := missing[tries%len(missing)]
+					addr = s.addrManager.GetAddressForNetwork(netID)
+				}
+				if addr == nil {
+					addr = s.addrManager.GetAddress()
+				}
 				if addr == nil {
 					break
 				}
@@ -2849,11 +4092,27 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 				// in the same group so that we are not connecting
 				// to the same network segment at the expense of
 				// others.
-				key := addrmgr.GroupKey(addr.NetAddress())
+				// Never connect to the addresses of peers
+				// which were discouraged for misbehaving.
+				if s.addrManager.IsDiscouraged(addr.NetAddress()) {
+					continue
+				}
+				if _, ok := s.banManager.BanExpiry(addr.NetAddress().IP); ok {
+					continue
+				}
+
+				key := s.addrManager.GroupKey(addr.NetAddress())
 				if s.OutboundGroupCount(key) != 0 {
 					continue
 				}
 
+				// Prefer network groups other than those of
+				// the most recently rotated peers so they are
+				// replaced by peers in different segments.
+				if tries < 30 && s.recentlyRotatedGroup(key) {
+					continue
+				}
+
 				// only allow recent nodes (10mins) after we failed 30
 				// times
 				if tries < 30 && time.Since(addr.LastAttempt()) < 10*time.Minute {
@@ -2875,21 +4134,92 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 
 			return nil, errors.New("no valid connect address")
 		}
+
+		// Test the addresses from the new buckets of the address
+		// manager with feeler connections.  They are chosen the same
+		// way as other addresses except that only new ones are
+		// considered.
+		feelerAddressFunc = func() (net.Addr, error) {
+			for tries := 0; tries < 50; tries++ {
+				addr := s.addrManager.GetFeelerAddress()
+				if addr == nil {
+					break
+				}
+
+				if s.addrManager.IsDiscouraged(addr.NetAddress()) {
+					continue
+				}
+				if _, ok := s.banManager.BanExpiry(addr.NetAddress().IP); ok {
+					continue
+				}
+				key := s.addrManager.GroupKey(addr.NetAddress())
+				if s.OutboundGroupCount(key) != 0 {
+					continue
+				}
+				if tries < 30 && time.Since(addr.LastAttempt()) < 10*time.Minute {
+					continue
+				}
+				if fmt.Sprintf("%d", addr.NetAddress().Port) !=
+					activeNetParams.DefaultPort {
+					continue
+				}
+
+				s.addrManager.Attempt(addr.NetAddress())
+
+				addrString := addrmgr.NetAddressKey(addr.NetAddress())
+				return addrStringToNetAddr(addrString)
+			}
+
+			return nil, errors.New("no valid feeler address")
+		}
+
+		// Reconnect to the anchors persisted by the previous run
+		// before any other outbound connections are made.
+		getAnchorsFunc = func() []net.Addr {
+			var addrs []net.Addr
+			for _, na := range s.addrManager.Anchors() {
+				key := addrmgr.NetAddressKey(na)
+				addr, err := addrStringToNetAddr(key)
+				if err != nil {
+					srvrLog.Debugf("Skipping anchor %s: %v",
+						key, err)
+					continue
+				}
+				s.addrManager.Attempt(na)
+				addrs = append(addrs, addr)
+			}
+			if len(addrs) > 0 {
+				srvrLog.Infof("Reconnecting to %d anchors",
+					len(addrs))
+			}
+			return addrs
+		}
 	}
 
-	// Create a connection manager.
+	// Create a connection manager.  The block-relay-only peers are
+	// maintained in addition to the full-relay ones as long as the max
+	// number of peers allows it.
 	targetOutbound := defaultTargetOutbound
 	if cfg.MaxPeers < targetOutbound {
 		targetOutbound = cfg.MaxPeers
 	}
+	s.targetBlockRelayOnly = cfg.BlockRelayConns
+	if cfg.MaxPeers-targetOutbound < s.targetBlockRelayOnly {
+		s.targetBlockRelayOnly = cfg.MaxPeers - targetOutbound
+	}
 	cmgr, err := connmgr.New(&connmgr.Config{
-		Listeners:      listeners,
-		OnAccept:       s.inboundPeerConnected,
-		RetryDuration:  connectionRetryInterval,
-		TargetOutbound: uint32(targetOutbound),
-		Dial:           hdfdDial,
-		OnConnection:   s.outboundPeerConnected,
-		GetNewAddress:  newAddressFunc,
+		Listeners:               listeners,
+		OnAccept:                s.inboundPeerConnected,
+		RetryDuration:           connectionRetryInterval,
+		TargetOutbound:          uint32(targetOutbound),
+		TargetBlockRelayOnly:    uint32(s.targetBlockRelayOnly),
+		ExtraBlockRelayInterval: cfg.ExtraBlockRelay,
+		Dial:                    hdfdDial,
+		OnConnection:            s.outboundPeerConnected,
+		FeelerInterval:          feelerInterval,
+		GetNewAddress:           newAddressFunc,
+		GetFeelerAddress:        feelerAddressFunc,
+		GetAnchors:              getAnchorsFunc,
 	})
 	if err != nil {
 		return nil, err
@@ -2913,22 +4243,15 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		})
 	}
 
-	if !cfg.DisableRPC {
-		// Setup listeners for the configured RPC listen addresses and
-		// TLS settings.
-		rpcListeners, err := setupRPCListeners()
-		if err != nil {
-			return nil, err
-		}
-		if len(rpcListeners) == 0 {
-			return nil, errors.New("RPCS: No valid listen address")
-		}
-
-		s.rpcServer, err = newRPCServer(&rpcserverConfig{
-			Listeners:    rpcListeners,
+	// Provide the RPC server with the chain state and related services now
+	// that the startup work is complete so it finishes warming up.
+	if s.rpcServer != nil {
+		s.rpcServer.FinishWarmup(&rpcserverConfig{
+			Listeners:    s.rpcServer.cfg.Listeners,
 			StartupTime:  s.startupTime,
 			ConnMgr:      &rpcConnManager{&s},
 			SyncMgr:      &rpcSyncMgr{&s, s.syncManager},
+			AddrManager:  s.addrManager,
 			TimeSource:   s.timeSource,
 			Chain:        s.chain,
 			ChainParams:  chainParams,
@@ -2941,15 +4264,6 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 			CfIndex:      s.cfIndex,
 			FeeEstimator: s.feeEstimator,
 		})
-		if err != nil {
-			return nil, err
-		}
-
-		// Signal process shutdown when the RPC server requests it.
-		go func() {
-			<-s.rpcServer.RequestedProcessShutdown()
-			shutdownRequestChannel <- struct{}{}
-		}()
 	}
 
 	return &s, nil
@@ -3030,6 +4344,18 @@ func initListeners(amgr *addrmgr.AddrManager, listenAddrs []string, services wir
 		}
 	}
 
+	// Listen for unix domain socket connections from applications on the
+	// same host.  These are intentionally added after the bound addresses
+	// are advertised since they are not reachable by remote peers.
+	for _, path := range cfg.UnixListeners {
+		listener, err := listenUnix(path, cfg.unixSocketMode)
+		if err != nil {
+			srvrLog.Warnf("Can't listen on %s: %v", path, err)
+			continue
+		}
+		listeners = append(listeners, listener)
+	}
+
 	return listeners, nat, nil
 }
 
@@ -3152,6 +4478,12 @@ func dynamicTickDuration(remaining time.Duration) time.Duration {
 // isWhitelisted returns whether the IP address is included in the whitelisted
 // networks and IPs.
 func isWhitelisted(addr net.Addr) bool {
+	// Peers connected over a unix domain socket are on the local host and
+	// are therefore always whitelisted.
+	if _, ok := addr.(*net.UnixAddr); ok {
+		return true
+	}
+
 	if len(cfg.whitelists) == 0 {
 		return false
 	}
@@ -0,0 +1,159 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+)
+
+const (
+	// taprootWitnessVersion is the witness version of pay-to-taproot
+	// outputs.
+	taprootWitnessVersion = 1
+
+	// bech32Charset is the set of characters bech32 strings are encoded
+	// with.
+	bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+	// bech32mConst is the constant the checksum of bech32m strings is
+	// xored with as defined by BIP0350.
+	bech32mConst = 0x2bc830a3
+)
+
+// bech32Generator is the generator of the BCH code the bech32 checksum is based
+// on.
+var bech32Generator = [5]uint32{
+	0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3,
+}
+
+// bech32Polymod returns the checksum state of the passed 5-bit values.
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i, gen := range bech32Generator {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= gen
+			}
+		}
+	}
+	return chk
+}
+
+// encodeBech32m encodes the passed 5-bit values with the passed human-readable
+// part as a bech32m string as defined by BIP0350.
+func encodeBech32m(hrp string, data []byte) string {
+	values := make([]byte, 0, len(hrp)*2+1+len(data)+6)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]>>5)
+	}
+	values = append(values, 0)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]&31)
+	}
+	values = append(values, data...)
+	values = append(values, 0, 0, 0, 0, 0, 0)
+	checksum := bech32Polymod(values) ^ bech32mConst
+
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, v := range data {
+		sb.WriteByte(bech32Charset[v])
+	}
+	for i := 0; i < 6; i++ {
+		sb.WriteByte(bech32Charset[(checksum>>(5*uint(5-i)))&31])
+	}
+	return sb.String()
+}
+
+// convertTo5Bit regroups the passed bytes into 5-bit values padded with zero
+// bits.
+func convertTo5Bit(data []byte) []byte {
+	result := make([]byte, 0, (len(data)*8+4)/5)
+	var acc uint32
+	var bits uint
+	for _, b := range data {
+		acc = acc<<8 | uint32(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			result = append(result, byte(acc>>bits)&31)
+		}
+	}
+	if bits > 0 {
+		result = append(result, byte(acc<<(5-bits))&31)
+	}
+	return result
+}
+
+// AddressTaproot is a pay-to-taproot address as defined by BIP0341, which is
+// encoded with bech32m as defined by BIP0350.  It implements the hdfutil.Address
+// interface since hdfutil does not provide an address type for version 1
+// witness programs.
+type AddressTaproot struct {
+	hrp            string
+	witnessProgram [32]byte
+}
+
+// NewAddressTaproot returns a new pay-to-taproot address for the passed 32-byte
+// output key on the passed network.
+func NewAddressTaproot(outputKey []byte, params *chaincfg.Params) (*AddressTaproot, error) {
+	if len(outputKey) != 32 {
+		str := fmt.Sprintf("taproot output key must be 32 bytes, got %d",
+			len(outputKey))
+		return nil, scriptError(ErrWitnessProgramWrongLength, str)
+	}
+	addr := &AddressTaproot{hrp: params.Bech32HRPSegwit}
+	copy(addr.witnessProgram[:], outputKey)
+	return addr, nil
+}
+
+// EncodeAddress returns the bech32m string encoding of the address.
+//
+// This is part of the hdfutil.Address interface implementation.
+func (a *AddressTaproot) EncodeAddress() string {
+	data := append([]byte{taprootWitnessVersion},
+		convertTo5Bit(a.witnessProgram[:])...)
+	return encodeBech32m(a.hrp, data)
+}
+
+// ScriptAddress returns the witness program of the address.
+//
+// This is part of the hdfutil.Address interface implementation.
+func (a *AddressTaproot) ScriptAddress() []byte {
+	return a.witnessProgram[:]
+}
+
+// IsForNet returns whether or not the address is associated with the passed
+// network.
+//
+// This is part of the hdfutil.Address interface implementation.
+func (a *AddressTaproot) IsForNet(params *chaincfg.Params) bool {
+	return a.hrp == params.Bech32HRPSegwit
+}
+
+// String returns a human-readable string for the address.  This is equivalent
+// to calling EncodeAddress.
+//
+// This is part of the hdfutil.Address interface implementation.
+func (a *AddressTaproot) String() string {
+	return a.EncodeAddress()
+}
+
+// WitnessVersion returns the witness version of the address.
+func (a *AddressTaproot) WitnessVersion() byte {
+	return taprootWitnessVersion
+}
+
+// WitnessProgram returns the witness program of the address, which is the
+// taproot output key.
+func (a *AddressTaproot) WitnessProgram() []byte {
+	return a.witnessProgram[:]
+}
@@ -0,0 +1,300 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/ifishnet/hdfd/wire"
+	"github.com/ifishnet/hdfutil"
+)
+
+const (
+	// witnessScaleFactor is the factor the legacy signature operations are
+	// scaled by when calculating the signature operation cost.  It MUST be
+	// the same as the blockchain.WitnessScaleFactor which can't be used
+	// here without creating an import cycle.
+	witnessScaleFactor = 4
+
+	// maxSignatureSize is the maximum size of a DER-encoded signature with
+	// the hash type appended.
+	maxSignatureSize = 72 + 1
+
+	// maxPubKeySize is the size of an uncompressed public key, which is the
+	// largest public key allowed in a signature script.
+	maxPubKeySize = 65
+
+	// compressedPubKeySize is the size of a compressed public key, which is
+	// the only public key type allowed in a standard witness.
+	compressedPubKeySize = 33
+)
+
+// OutputSigOpCost returns the signature operation cost the passed public key
+// script adds to the transaction which creates an output with it.  The
+// signature operations of output scripts are always counted without being
+// precise and scaled by the witness scale factor.
+func OutputSigOpCost(pkScript []byte) int {
+	return GetSigOpCount(pkScript) * witnessScaleFactor
+}
+
+// SpendSigOpCost returns the signature operation cost of spending an output
+// with the passed public key script without executing any scripts.  The redeem
+// script is required when the public key script is a pay-to-script-hash and the
+// witness script is required when the public key script, or the redeem script
+// of a nested witness program, is a pay-to-witness-script-hash.  Both are
+// ignored otherwise.
+//
+// The signature script of a standard spend only pushes data, so the cost only
+// consists of the signature operations of the redeem script scaled by the
+// witness scale factor and the unscaled signature operations of a witness
+// program.
+func SpendSigOpCost(pkScript, redeemScript, witnessScript []byte) (int, error) {
+	pops, err := parseScript(pkScript)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case isScriptHash(pops):
+		if err := checkRedeemScript(pops, redeemScript); err != nil {
+			return 0, err
+		}
+		if IsWitnessProgram(redeemScript) {
+			return witnessProgramSigOpCost(redeemScript, witnessScript)
+		}
+		redeemPops, err := parseScript(redeemScript)
+		if err != nil {
+			return 0, err
+		}
+		return getSigOpCount(redeemPops, true) * witnessScaleFactor, nil
+
+	case isWitnessProgram(pops):
+		return witnessProgramSigOpCost(pkScript, witnessScript)
+	}
+
+	return 0, nil
+}
+
+// witnessProgramSigOpCost returns the signature operation cost of spending the
+// passed witness program where the witness script is the script committed to
+// by a pay-to-witness-script-hash program.  Unknown witness program versions
+// do not have any signature operations.
+func witnessProgramSigOpCost(program, witnessScript []byte) (int, error) {
+	version, witnessProgram, err := ExtractWitnessProgramInfo(program)
+	if err != nil {
+		return 0, err
+	}
+	if version != 0 {
+		return 0, nil
+	}
+
+	switch len(witnessProgram) {
+	case payToWitnessPubKeyHashDataSize:
+		return 1, nil
+
+	case payToWitnessScriptHashDataSize:
+		err := checkWitnessScript(witnessProgram, witnessScript)
+		if err != nil {
+			return 0, err
+		}
+		pops, err := parseScript(witnessScript)
+		if err != nil {
+			return 0, err
+		}
+		return getSigOpCount(pops, true), nil
+	}
+
+	str := fmt.Sprintf("witness program length of %d is invalid",
+		len(witnessProgram))
+	return 0, scriptError(ErrUnsupportedScriptTemplate, str)
+}
+
+// MaxSatisfactionSize returns the maximum size of the signature script and the
+// serialized witness needed to spend an output with the passed public key
+// script without executing any scripts.  The redeem script is required when the
+// public key script is a pay-to-script-hash and the witness script is required
+// when the public key script, or the redeem script of a nested witness program,
+// is a pay-to-witness-script-hash.  Both are ignored otherwise.
+//
+// The sizes assume signatures of the maximum size and uncompressed public keys
+// in signature scripts while the public keys in witnesses are compressed as
+// required by the standardness rules.  The signature script size excludes the
+// length prefix of the script and the witness size is zero when there is no
+// witness.  This allows the fee of unsigned transactions to be estimated.
+//
+// Only pay-to-pubkey, pay-to-pubkey-hash, and multisig scripts, either bare or
+// as the script committed to by a pay-to-script-hash or a version 0 witness
+// program, are supported.  ErrUnsupportedScriptTemplate is returned for all
+// other scripts.
+func MaxSatisfactionSize(pkScript, redeemScript, witnessScript []byte) (int, int, error) {
+	pops, err := parseScript(pkScript)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	switch typeOfScript(pops) {
+	case PubKeyTy, PubKeyHashTy, MultiSigTy:
+		items, err := satisfactionItems(pops, maxPubKeySize)
+		if err != nil {
+			return 0, 0, err
+		}
+		return pushesSize(items), 0, nil
+
+	case ScriptHashTy:
+		if err := checkRedeemScript(pops, redeemScript); err != nil {
+			return 0, 0, err
+		}
+		if IsWitnessProgram(redeemScript) {
+			witnessSize, err := witnessSatisfactionSize(redeemScript,
+				witnessScript)
+			if err != nil {
+				return 0, 0, err
+			}
+			return pushesSize([]int{len(redeemScript)}), witnessSize, nil
+		}
+
+		redeemPops, err := parseScript(redeemScript)
+		if err != nil {
+			return 0, 0, err
+		}
+		items, err := satisfactionItems(redeemPops, maxPubKeySize)
+		if err != nil {
+			return 0, 0, err
+		}
+		items = append(items, len(redeemScript))
+		return pushesSize(items), 0, nil
+
+	case WitnessV0PubKeyHashTy, WitnessV0ScriptHashTy:
+		witnessSize, err := witnessSatisfactionSize(pkScript, witnessScript)
+		if err != nil {
+			return 0, 0, err
+		}
+		return 0, witnessSize, nil
+	}
+
+	return 0, 0, scriptError(ErrUnsupportedScriptTemplate,
+		"public key script is not a supported template")
+}
+
+// witnessSatisfactionSize returns the maximum size of the serialized witness
+// needed to spend the passed version 0 witness program where the witness script
+// is the script committed to by a pay-to-witness-script-hash program.
+func witnessSatisfactionSize(program, witnessScript []byte) (int, error) {
+	version, witnessProgram, err := ExtractWitnessProgramInfo(program)
+	if err != nil {
+		return 0, err
+	}
+	if version != 0 {
+		str := fmt.Sprintf("witness program version %d is not supported",
+			version)
+		return 0, scriptError(ErrUnsupportedScriptTemplate, str)
+	}
+
+	switch len(witnessProgram) {
+	case payToWitnessPubKeyHashDataSize:
+		return witnessItemsSize([]int{maxSignatureSize,
+			compressedPubKeySize}), nil
+
+	case payToWitnessScriptHashDataSize:
+		err := checkWitnessScript(witnessProgram, witnessScript)
+		if err != nil {
+			return 0, err
+		}
+		pops, err := parseScript(witnessScript)
+		if err != nil {
+			return 0, err
+		}
+		items, err := satisfactionItems(pops, compressedPubKeySize)
+		if err != nil {
+			return 0, err
+		}
+		items = append(items, len(witnessScript))
+		return witnessItemsSize(items), nil
+	}
+
+	str := fmt.Sprintf("witness program length of %d is invalid",
+		len(witnessProgram))
+	return 0, scriptError(ErrUnsupportedScriptTemplate, str)
+}
+
+// satisfactionItems returns the maximum sizes of the data items needed to
+// satisfy the passed script where the public keys are of the provided size.
+func satisfactionItems(pops []parsedOpcode, pubKeySize int) ([]int, error) {
+	switch typeOfScript(pops) {
+	case PubKeyTy:
+		return []int{maxSignatureSize}, nil
+
+	case PubKeyHashTy:
+		return []int{maxSignatureSize, pubKeySize}, nil
+
+	case MultiSigTy:
+		// An additional empty item is needed due to the original
+		// bitcoind bug where OP_CHECKMULTISIG pops an additional item
+		// from the stack.
+		numSigs := asSmallInt(pops[0].opcode)
+		items := make([]int, 1, numSigs+1)
+		for i := 0; i < numSigs; i++ {
+			items = append(items, maxSignatureSize)
+		}
+		return items, nil
+	}
+
+	return nil, scriptError(ErrUnsupportedScriptTemplate,
+		"script is not a supported template")
+}
+
+// pushesSize returns the size of a script which pushes data items of the passed
+// sizes using canonical pushes.
+func pushesSize(items []int) int {
+	var size int
+	for _, n := range items {
+		switch {
+		case n == 0:
+			size++
+		case n <= OP_DATA_75:
+			size += 1 + n
+		case n <= 0xff:
+			size += 2 + n
+		case n <= 0xffff:
+			size += 3 + n
+		default:
+			size += 5 + n
+		}
+	}
+	return size
+}
+
+// witnessItemsSize returns the serialized size of a witness which consists of
+// data items of the passed sizes.
+func witnessItemsSize(items []int) int {
+	size := wire.VarIntSerializeSize(uint64(len(items)))
+	for _, n := range items {
+		size += wire.VarIntSerializeSize(uint64(n)) + n
+	}
+	return size
+}
+
+// checkRedeemScript returns an error when the passed redeem script is not the
+// one committed to by the passed pay-to-script-hash script.
+func checkRedeemScript(pops []parsedOpcode, redeemScript []byte) error {
+	if !bytes.Equal(hdfutil.Hash160(redeemScript), pops[1].data) {
+		return scriptError(ErrUnsupportedScriptTemplate,
+			"redeem script does not match the script hash")
+	}
+	return nil
+}
+
+// checkWitnessScript returns an error when the passed witness script is not the
+// one committed to by the passed pay-to-witness-script-hash program.
+func checkWitnessScript(witnessProgram, witnessScript []byte) error {
+	witnessHash := sha256.Sum256(witnessScript)
+	if !bytes.Equal(witnessHash[:], witnessProgram) {
+		return scriptError(ErrUnsupportedScriptTemplate,
+			"witness script does not match the witness script hash")
+	}
+	return nil
+}
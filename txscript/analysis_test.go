@@ -0,0 +1,137 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/ifishnet/hdfutil"
+)
+
+// TestScriptAnalysis ensures the signature operation costs and maximum
+// satisfaction sizes calculated for the various script templates are correct.
+func TestScriptAnalysis(t *testing.T) {
+	t.Parallel()
+
+	// Create the scripts for the various templates.
+	pubKey := bytes.Repeat([]byte{0x02}, 33)
+	pubKeyHash := hdfutil.Hash160(pubKey)
+	p2pk, _ := payToPubKeyScript(pubKey)
+	p2pkh, _ := payToPubKeyHashScript(pubKeyHash)
+	p2wpkh, _ := payToWitnessPubKeyHashScript(pubKeyHash)
+	multiSig, _ := NewScriptBuilder().AddOp(OP_2).AddData(pubKey).
+		AddData(pubKey).AddData(pubKey).AddOp(OP_3).
+		AddOp(OP_CHECKMULTISIG).Script()
+	p2sh, _ := payToScriptHashScript(hdfutil.Hash160(multiSig))
+	witnessHash := sha256.Sum256(multiSig)
+	p2wsh, _ := payToWitnessScriptHashScript(witnessHash[:])
+	p2shP2wpkh, _ := payToScriptHashScript(hdfutil.Hash160(p2wpkh))
+	nullData, _ := NullDataScript([]byte{0x01})
+
+	tests := []struct {
+		name          string
+		pkScript      []byte
+		redeemScript  []byte
+		witnessScript []byte
+		outputCost    int
+		spendCost     int
+		sigScriptSize int
+		witnessSize   int
+		costErr       error
+		sizeErr       error
+	}{{
+		name:          "pay-to-pubkey",
+		pkScript:      p2pk,
+		outputCost:    4,
+		sigScriptSize: 74,
+	}, {
+		name:          "pay-to-pubkey-hash",
+		pkScript:      p2pkh,
+		outputCost:    4,
+		sigScriptSize: 74 + 66,
+	}, {
+		name:          "bare 2-of-3 multisig",
+		pkScript:      multiSig,
+		outputCost:    MaxPubKeysPerMultiSig * 4,
+		sigScriptSize: 1 + 2*74,
+	}, {
+		name:          "pay-to-script-hash 2-of-3 multisig",
+		pkScript:      p2sh,
+		redeemScript:  multiSig,
+		spendCost:     3 * 4,
+		sigScriptSize: 1 + 2*74 + 2 + len(multiSig),
+	}, {
+		name:        "pay-to-witness-pubkey-hash",
+		pkScript:    p2wpkh,
+		spendCost:   1,
+		witnessSize: 1 + 74 + 34,
+	}, {
+		name:          "pay-to-witness-script-hash 2-of-3 multisig",
+		pkScript:      p2wsh,
+		witnessScript: multiSig,
+		spendCost:     3,
+		witnessSize:   1 + 1 + 2*74 + 1 + len(multiSig),
+	}, {
+		name:          "nested pay-to-witness-pubkey-hash",
+		pkScript:      p2shP2wpkh,
+		redeemScript:  p2wpkh,
+		spendCost:     1,
+		sigScriptSize: 1 + len(p2wpkh),
+		witnessSize:   1 + 74 + 34,
+	}, {
+		name:         "pay-to-script-hash mismatched redeem script",
+		pkScript:     p2sh,
+		redeemScript: p2pkh,
+		costErr:      scriptError(ErrUnsupportedScriptTemplate, ""),
+		sizeErr:      scriptError(ErrUnsupportedScriptTemplate, ""),
+	}, {
+		name:     "pay-to-witness-script-hash missing witness script",
+		pkScript: p2wsh,
+		costErr:  scriptError(ErrUnsupportedScriptTemplate, ""),
+		sizeErr:  scriptError(ErrUnsupportedScriptTemplate, ""),
+	}, {
+		name:     "nulldata",
+		pkScript: nullData,
+		sizeErr:  scriptError(ErrUnsupportedScriptTemplate, ""),
+	}}
+
+	for _, test := range tests {
+		outputCost := OutputSigOpCost(test.pkScript)
+		if outputCost != test.outputCost {
+			t.Errorf("%s: unexpected output sigop cost - got %d, "+
+				"want %d", test.name, outputCost, test.outputCost)
+			continue
+		}
+
+		spendCost, err := SpendSigOpCost(test.pkScript,
+			test.redeemScript, test.witnessScript)
+		if e := tstCheckScriptError(err, test.costErr); e != nil {
+			t.Errorf("%s: SpendSigOpCost: %v", test.name, e)
+			continue
+		}
+		if err == nil && spendCost != test.spendCost {
+			t.Errorf("%s: unexpected spend sigop cost - got %d, "+
+				"want %d", test.name, spendCost, test.spendCost)
+			continue
+		}
+
+		sigScriptSize, witnessSize, err := MaxSatisfactionSize(
+			test.pkScript, test.redeemScript, test.witnessScript)
+		if e := tstCheckScriptError(err, test.sizeErr); e != nil {
+			t.Errorf("%s: MaxSatisfactionSize: %v", test.name, e)
+			continue
+		}
+		if sigScriptSize != test.sigScriptSize ||
+			witnessSize != test.witnessSize {
+
+			t.Errorf("%s: unexpected satisfaction size - got %d/%d, "+
+				"want %d/%d", test.name, sigScriptSize,
+				witnessSize, test.sigScriptSize, test.witnessSize)
+			continue
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"crypto/rand"
+	"math/big"
+	"sync"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/hdfec"
+)
+
+// schnorrBatchEntry is a deferred BIP0340 Schnorr signature check.
+type schnorrBatchEntry struct {
+	sig    [schnorrSigSize]byte
+	msg    [chainhash.HashSize]byte
+	pubKey [schnorrPubKeySize]byte
+}
+
+// BatchVerifier collects the BIP0340 Schnorr signature checks of script engines
+// so they can be verified together after the scripts have been executed instead
+// of one at a time during their execution.  They are verified with a single
+// multi-scalar multiplication of random linear combinations of the signatures,
+// which is considerably faster than verifying them individually.  ECDSA
+// signatures can't be combined that way, so engines always verify them right
+// away, which also lets them make use of the signature cache.
+//
+// An engine with a batch verifier treats every deferred signature check as
+// successful, so the result of executing its scripts is only conclusive when
+// Verify returns true afterwards.  Otherwise, the scripts must be executed
+// again without a batch verifier to find out which of them is invalid.
+//
+// A BatchVerifier is safe for concurrent access, so it may be shared by the
+// engines validating multiple inputs, transactions, or blocks.
+type BatchVerifier struct {
+	mtx     sync.Mutex
+	schnorr []schnorrBatchEntry
+}
+
+// NewBatchVerifier returns a new empty batch verifier.
+func NewBatchVerifier() *BatchVerifier {
+	return &BatchVerifier{}
+}
+
+// addSchnorr defers the check of the passed BIP0340 Schnorr signature of the
+// passed message by the passed x-only public key.  It returns false without
+// deferring the check when the signature, message, or public key has an
+// invalid size since such a signature is invalid regardless.
+func (b *BatchVerifier) addSchnorr(sig, msg, pubKey []byte) bool {
+	if len(sig) != schnorrSigSize || len(msg) != chainhash.HashSize ||
+		len(pubKey) != schnorrPubKeySize {
+
+		return false
+	}
+
+	var entry schnorrBatchEntry
+	copy(entry.sig[:], sig)
+	copy(entry.msg[:], msg)
+	copy(entry.pubKey[:], pubKey)
+
+	b.mtx.Lock()
+	b.schnorr = append(b.schnorr, entry)
+	b.mtx.Unlock()
+	return true
+}
+
+// Len returns the number of signature checks which have been deferred since the
+// batch verifier was created or last verified.
+//
+// This function is safe for concurrent access.
+func (b *BatchVerifier) Len() int {
+	b.mtx.Lock()
+	n := len(b.schnorr)
+	b.mtx.Unlock()
+	return n
+}
+
+// Verify verifies all of the signature checks which have been deferred since
+// the batch verifier was created or last verified and returns whether or not
+// all of the signatures are valid.  The batch verifier is empty afterwards so
+// it can be reused.
+//
+// This function is safe for concurrent access.
+func (b *BatchVerifier) Verify() bool {
+	b.mtx.Lock()
+	schnorr := b.schnorr
+	b.schnorr = nil
+	b.mtx.Unlock()
+
+	return verifySchnorrBatch(schnorr)
+}
+
+// liftXPoint returns the point on the secp256k1 curve with the passed x
+// coordinate and an even y coordinate as defined by BIP0340.  Unlike liftX, it
+// uses the field arithmetic of the public key decompression.
+func liftXPoint(x []byte) (*hdfcec.PublicKey, bool) {
+	var compressed [1 + schnorrPubKeySize]byte
+	compressed[0] = 0x02
+	copy(compressed[1:], x)
+	pubKey, err := hdfcec.ParsePubKey(compressed[:], hdfcec.S256())
+	return pubKey, err == nil
+}
+
+// verifySchnorrBatch returns whether or not all of the passed BIP0340 Schnorr
+// signatures are valid.
+//
+// Rather than checking s*G = R + e*P for every signature, it checks that the sum
+// of a_i*s_i times G is the sum of a_i*R_i + (a_i*e_i)*P_i for a_1 = 1 and
+// random a_2, ..., a_u as specified by BIP0340.  The random scalars prevent
+// invalid signatures from canceling each other out, so the check only passes
+// for invalid signatures with negligible probability.
+func verifySchnorrBatch(entries []schnorrBatchEntry) bool {
+	switch len(entries) {
+	case 0:
+		return true
+	case 1:
+		e := &entries[0]
+		return verifySchnorr(e.sig[:], e.msg[:], e.pubKey[:])
+	}
+
+	curve := hdfcec.S256()
+	xs := make([]*big.Int, 0, 2*len(entries)+1)
+	ys := make([]*big.Int, 0, 2*len(entries)+1)
+	ks := make([][]byte, 0, 2*len(entries)+1)
+	sum := new(big.Int)
+	var random [32]byte
+	for i := range entries {
+		entry := &entries[i]
+
+		// Parse the public key, R, and s the same way verifySchnorr
+		// does.
+		p, ok := liftXPoint(entry.pubKey[:])
+		if !ok {
+			return false
+		}
+		r, ok := liftXPoint(entry.sig[:32])
+		if !ok {
+			return false
+		}
+		s := new(big.Int).SetBytes(entry.sig[32:])
+		if s.Cmp(curve.N) >= 0 {
+			return false
+		}
+
+		// e = int(hash_BIP0340/challenge(bytes(r) || bytes(P) || m)) mod n
+		challenge := taggedHash(tagBIP0340Challenge, entry.sig[:32],
+			entry.pubKey[:], entry.msg[:])
+		e := new(big.Int).SetBytes(challenge[:])
+		e.Mod(e, curve.N)
+
+		a := big.NewInt(1)
+		if i > 0 {
+			if _, err := rand.Read(random[:]); err != nil {
+				return verifySchnorrEach(entries)
+			}
+			a.SetBytes(random[:])
+			a.Mod(a, curve.N)
+		}
+
+		xs = append(xs, r.X, p.X)
+		ys = append(ys, r.Y, p.Y)
+		ks = append(ks, a.Bytes(), e.Mul(e, a).Mod(e, curve.N).Bytes())
+		sum.Add(sum, s.Mul(s, a))
+	}
+
+	// Move the left hand side to the right by adding the negated sum of
+	// the s values times G, so the check passes when the result is the
+	// point at infinity.
+	sum.Mod(sum, curve.N)
+	sum.Sub(curve.N, sum)
+	xs = append(xs, curve.Gx)
+	ys = append(ys, curve.Gy)
+	ks = append(ks, sum.Bytes())
+	x, y := curve.MultiScalarMult(xs, ys, ks)
+	return x.Sign() == 0 && y.Sign() == 0
+}
+
+// verifySchnorrEach returns whether or not all of the passed BIP0340 Schnorr
+// signatures are valid by verifying them individually.
+func verifySchnorrEach(entries []schnorrBatchEntry) bool {
+	for i := range entries {
+		e := &entries[i]
+		if !verifySchnorr(e.sig[:], e.msg[:], e.pubKey[:]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,255 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/hdfec"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// TestBatchVerifierSchnorr ensures batches of BIP0340 Schnorr signatures are
+// only accepted when all of the signatures are valid.
+func TestBatchVerifierSchnorr(t *testing.T) {
+	t.Parallel()
+
+	// Create valid signatures of distinct messages by distinct keys, which
+	// include keys with odd y coordinates.
+	type sigTuple struct{ sig, msg, pubKey []byte }
+	var valid []sigTuple
+	for i := int64(1); i <= 8; i++ {
+		privKey := big.NewInt(0x7e57 * i)
+		msg := chainhash.HashB([]byte{byte(i)})
+		valid = append(valid, sigTuple{signSchnorr(privKey, msg), msg,
+			schnorrPubKey(privKey)})
+	}
+	modified := func(i int, modify func(s *sigTuple)) []sigTuple {
+		tuples := make([]sigTuple, len(valid))
+		copy(tuples, valid)
+		tuple := tuples[i]
+		tuple.sig = append([]byte(nil), tuple.sig...)
+		modify(&tuple)
+		tuples[i] = tuple
+		return tuples
+	}
+
+	tests := []struct {
+		name  string
+		sigs  []sigTuple
+		valid bool
+	}{{
+		name:  "empty batch",
+		valid: true,
+	}, {
+		name:  "single signature",
+		sigs:  valid[:1],
+		valid: true,
+	}, {
+		name:  "all valid",
+		sigs:  valid,
+		valid: true,
+	}, {
+		name: "wrong message",
+		sigs: modified(3, func(s *sigTuple) {
+			s.msg = valid[4].msg
+		}),
+	}, {
+		name: "wrong public key",
+		sigs: modified(0, func(s *sigTuple) {
+			s.pubKey = valid[1].pubKey
+		}),
+	}, {
+		name: "modified s",
+		sigs: modified(7, func(s *sigTuple) {
+			s.sig[63] ^= 0x01
+		}),
+	}, {
+		name: "s not less than order",
+		sigs: modified(5, func(s *sigTuple) {
+			copy(s.sig[32:], hdfcec.S256().N.Bytes())
+		}),
+	}, {
+		name: "r not on curve",
+		sigs: modified(2, func(s *sigTuple) {
+			copy(s.sig[:32], make([]byte, 32))
+		}),
+	}, {
+		name: "public key not on curve",
+		sigs: modified(6, func(s *sigTuple) {
+			s.pubKey = make([]byte, 32)
+		}),
+	}, {
+		// Swapping the s values of two signatures keeps the sum of the
+		// s values, which would cancel out without random scalars.
+		name: "swapped s values",
+		sigs: func() []sigTuple {
+			tuples := modified(1, func(s *sigTuple) {
+				copy(s.sig[32:], valid[2].sig[32:])
+			})
+			tuples[2].sig = append([]byte(nil), valid[2].sig...)
+			copy(tuples[2].sig[32:], valid[1].sig[32:])
+			return tuples
+		}(),
+	}}
+
+	for _, test := range tests {
+		bv := NewBatchVerifier()
+		for _, s := range test.sigs {
+			if !bv.addSchnorr(s.sig, s.msg, s.pubKey) {
+				t.Fatalf("%s: signature not added", test.name)
+			}
+		}
+		if bv.Len() != len(test.sigs) {
+			t.Errorf("%s: mismatched length -- got %d, want %d",
+				test.name, bv.Len(), len(test.sigs))
+		}
+		if valid := bv.Verify(); valid != test.valid {
+			t.Errorf("%s: got %v, want %v", test.name, valid,
+				test.valid)
+		}
+		if bv.Len() != 0 {
+			t.Errorf("%s: batch not empty after verification",
+				test.name)
+		}
+	}
+
+	// Signatures with invalid sizes are rejected right away.
+	bv := NewBatchVerifier()
+	if bv.addSchnorr(valid[0].sig[:63], valid[0].msg, valid[0].pubKey) {
+		t.Fatal("short signature added")
+	}
+	if bv.Len() != 0 {
+		t.Fatal("short signature deferred")
+	}
+}
+
+// TestBatchVerifierEngine ensures engines with a batch verifier defer their
+// signature checks to it.
+func TestBatchVerifierEngine(t *testing.T) {
+	t.Parallel()
+
+	// Sign a key path spend of a taproot output the same way as
+	// TestTaprootKeySpend.
+	curve := hdfcec.S256()
+	privKey := big.NewInt(0x7e57)
+	internalKey := schnorrPubKey(privKey)
+	outputKey, err := ComputeTaprootOutputKey(internalKey, nil)
+	if err != nil {
+		t.Fatalf("ComputeTaprootOutputKey: %v", err)
+	}
+	d := new(big.Int).Set(privKey)
+	if _, py := curve.ScalarBaseMult(d.Bytes()); py.Bit(0) == 1 {
+		d.Sub(curve.N, d)
+	}
+	tweak := taggedHash(tagTapTweak, internalKey)
+	d.Add(d, new(big.Int).SetBytes(tweak[:]))
+	d.Mod(d, curve.N)
+
+	flags := ScriptBip16 | ScriptVerifyWitness | ScriptVerifyTaproot
+	for _, corrupt := range []bool{false, true} {
+		tx, prevOuts := taprootTestTx(payToTaprootScript(outputKey))
+		sigHashes, err := NewTxSigHashesWithPrevOuts(tx, prevOuts)
+		if err != nil {
+			t.Fatalf("NewTxSigHashesWithPrevOuts: %v", err)
+		}
+		hash, err := CalcTaprootSignatureHash(sigHashes, SigHashDefault,
+			tx, 0, prevOuts)
+		if err != nil {
+			t.Fatalf("CalcTaprootSignatureHash: %v", err)
+		}
+		sig := signSchnorr(d, hash)
+		if corrupt {
+			sig[0] ^= 0x01
+		}
+		tx.TxIn[0].Witness = wire.TxWitness{sig}
+
+		// The execution succeeds regardless of the signature since its
+		// check is deferred.
+		prevOut := prevOuts[tx.TxIn[0].PreviousOutPoint]
+		vm, err := NewEngine(prevOut.PkScript, tx, 0, flags, nil,
+			sigHashes, prevOut.Value)
+		if err != nil {
+			t.Fatalf("NewEngine: %v", err)
+		}
+		bv := NewBatchVerifier()
+		vm.SetBatchVerifier(bv)
+		if err := vm.Execute(); err != nil {
+			t.Fatalf("corrupt %v: unexpected error: %v", corrupt, err)
+		}
+		if bv.Len() != 1 {
+			t.Fatalf("corrupt %v: %d deferred signatures, want 1",
+				corrupt, bv.Len())
+		}
+		if valid := bv.Verify(); valid == corrupt {
+			t.Fatalf("corrupt %v: batch verification returned %v",
+				corrupt, valid)
+		}
+	}
+
+	// ECDSA signature checks are not deferred, so their results are
+	// conclusive right away and valid signatures are added to the
+	// signature cache.
+	ecPrivKey, ecPubKey := hdfcec.PrivKeyFromBytes(curve, []byte{0x7e, 0x57})
+	pkScript, err := NewScriptBuilder().
+		AddData(ecPubKey.SerializeCompressed()).AddOp(OP_CHECKSIG).
+		Script()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(0, []byte{OP_TRUE}))
+	for _, corrupt := range []bool{false, true} {
+		sig, err := RawTxInSignature(tx, 0, pkScript, SigHashAll,
+			ecPrivKey)
+		if err != nil {
+			t.Fatalf("RawTxInSignature: %v", err)
+		}
+		if corrupt {
+			sig[len(sig)-2] ^= 0x01
+		}
+		tx.TxIn[0].SignatureScript, err = NewScriptBuilder().
+			AddData(sig).Script()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		flags = ScriptBip16 | ScriptVerifyDERSignatures
+		sigCache := NewSigCache(10)
+		vm, err := NewEngine(pkScript, tx, 0, flags, sigCache, nil, 0)
+		if err != nil {
+			t.Fatalf("NewEngine: %v", err)
+		}
+		bv := NewBatchVerifier()
+		vm.SetBatchVerifier(bv)
+		err = vm.Execute()
+		if (err != nil) != corrupt {
+			t.Fatalf("corrupt %v: unexpected result: %v", corrupt,
+				err)
+		}
+		if bv.Len() != 0 {
+			t.Fatalf("corrupt %v: %d deferred signatures, want 0",
+				corrupt, bv.Len())
+		}
+		parsedSig, err := hdfcec.ParseDERSignature(sig[:len(sig)-1],
+			curve)
+		if err != nil {
+			continue
+		}
+		hash, err := CalcSignatureHash(pkScript, SigHashAll, tx, 0)
+		if err != nil {
+			t.Fatalf("CalcSignatureHash: %v", err)
+		}
+		var sigHash chainhash.Hash
+		copy(sigHash[:], hash)
+		if sigCache.Exists(sigHash, parsedSig, ecPubKey) == corrupt {
+			t.Fatalf("corrupt %v: unexpected signature cache "+
+				"state", corrupt)
+		}
+	}
+}
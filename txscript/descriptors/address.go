@@ -0,0 +1,28 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package descriptors
+
+import (
+	"fmt"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfd/txscript"
+)
+
+// AddressTaproot is a pay-to-taproot address as defined by BIP0341, which is
+// encoded with bech32m as defined by BIP0350.  It implements the hdfutil.Address
+// interface so tr descriptors can be compiled to addresses.
+type AddressTaproot = txscript.AddressTaproot
+
+// NewAddressTaproot returns a new pay-to-taproot address for the passed 32-byte
+// output key on the passed network.
+func NewAddressTaproot(outputKey []byte, params *chaincfg.Params) (*AddressTaproot, error) {
+	if len(outputKey) != 32 {
+		str := fmt.Sprintf("taproot output key must be 32 bytes, got %d",
+			len(outputKey))
+		return nil, descriptorError(ErrInvalidKey, str)
+	}
+	return txscript.NewAddressTaproot(outputKey, params)
+}
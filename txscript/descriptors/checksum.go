@@ -0,0 +1,121 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package descriptors
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// ChecksumLength is the number of characters of a descriptor checksum.
+	ChecksumLength = 8
+
+	// inputCharset is the set of characters allowed in descriptors.  The
+	// position of a character determines the symbols it contributes to the
+	// checksum.
+	inputCharset = "0123456789()[],'/*abcdefgh@:$%{}" +
+		"IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~" +
+		"ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+
+	// checksumCharset is the set of characters checksums are encoded with.
+	checksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+)
+
+// checksumGenerator is the generator of the BCH code the descriptor checksum is
+// based on.
+var checksumGenerator = [5]uint64{
+	0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd,
+}
+
+// polyMod updates the passed checksum state with the passed symbol.
+func polyMod(c uint64, value int) uint64 {
+	top := c >> 35
+	c = (c&0x7ffffffff)<<5 ^ uint64(value)
+	for i, gen := range checksumGenerator {
+		if (top>>uint(i))&1 == 1 {
+			c ^= gen
+		}
+	}
+	return c
+}
+
+// Checksum returns the checksum of the passed descriptor, which must not
+// include a checksum, as defined by BIP0380.
+func Checksum(desc string) (string, error) {
+	c := uint64(1)
+	var class, classCount int
+	for i := 0; i < len(desc); i++ {
+		pos := strings.IndexByte(inputCharset, desc[i])
+		if pos == -1 {
+			str := fmt.Sprintf("invalid character %q at position %d",
+				desc[i], i)
+			return "", descriptorError(ErrInvalidCharacter, str)
+		}
+
+		// Every character contributes its position within its group of
+		// 32 characters, and every three characters additionally
+		// contribute the groups they belong to.
+		c = polyMod(c, pos&31)
+		class = class*3 + pos>>5
+		classCount++
+		if classCount == 3 {
+			c = polyMod(c, class)
+			class, classCount = 0, 0
+		}
+	}
+	if classCount > 0 {
+		c = polyMod(c, class)
+	}
+	for i := 0; i < ChecksumLength; i++ {
+		c = polyMod(c, 0)
+	}
+	c ^= 1
+
+	var checksum [ChecksumLength]byte
+	for i := range checksum {
+		checksum[i] = checksumCharset[(c>>(5*uint(7-i)))&31]
+	}
+	return string(checksum[:]), nil
+}
+
+// AddChecksum returns the passed descriptor, which must not include a
+// checksum, with its checksum appended.
+func AddChecksum(desc string) (string, error) {
+	checksum, err := Checksum(desc)
+	if err != nil {
+		return "", err
+	}
+	return desc + "#" + checksum, nil
+}
+
+// splitChecksum separates the passed descriptor from its checksum and ensures
+// the checksum is valid.  It returns an empty checksum when there is none.
+func splitChecksum(desc string) (string, string, error) {
+	idx := strings.IndexByte(desc, '#')
+	if idx == -1 {
+		if _, err := Checksum(desc); err != nil {
+			return "", "", err
+		}
+		return desc, "", nil
+	}
+
+	desc, checksum := desc[:idx], desc[idx+1:]
+	if len(checksum) != ChecksumLength {
+		str := fmt.Sprintf("checksum %q is not %d characters", checksum,
+			ChecksumLength)
+		return "", "", descriptorError(ErrInvalidChecksum, str)
+	}
+	want, err := Checksum(desc)
+	if err != nil {
+		return "", "", err
+	}
+	if checksum != want {
+		str := fmt.Sprintf("checksum %q does not match the expected "+
+			"checksum %q", checksum, want)
+		return "", "", descriptorError(ErrInvalidChecksum, str)
+	}
+	return desc, checksum, nil
+}
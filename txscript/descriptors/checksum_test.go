@@ -0,0 +1,129 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package descriptors
+
+import (
+	"testing"
+)
+
+// TestChecksum ensures descriptor checksums are computed and validated as
+// defined by BIP0380.
+func TestChecksum(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		desc     string
+		checksum string
+		err      ErrorCode
+		valid    bool
+	}{{
+		name:     "raw script",
+		desc:     "raw(deadbeef)",
+		checksum: "89f8spxm",
+		valid:    true,
+	}, {
+		name:     "compressed key",
+		desc:     "wpkh(0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798)",
+		checksum: "ucxz0gak",
+		valid:    true,
+	}, {
+		name: "key origin and range",
+		desc: "pkh([d34db33f/44'/0'/0']xpub6ERApfZwUNrhLCkDtcHTcxd75Rbz" +
+			"S1ed54G1LkBUHQVHQKqhMkhgbmJbZRkrgZw4koxb5JaHWkY4ALHY2grB" +
+			"GRjaDMzQLcgJvLJuZZvRcEL/1/*)",
+		checksum: "ml40v0wf",
+		valid:    true,
+	}, {
+		name:  "invalid character",
+		desc:  "raw(deadbeef)é",
+		err:   ErrInvalidCharacter,
+		valid: false,
+	}}
+
+	for _, test := range tests {
+		checksum, err := Checksum(test.desc)
+		if !test.valid {
+			if !IsErrorCode(err, test.err) {
+				t.Errorf("%s: mismatched error -- got %v, want %v",
+					test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if checksum != test.checksum {
+			t.Errorf("%s: mismatched checksum -- got %s, want %s",
+				test.name, checksum, test.checksum)
+			continue
+		}
+
+		// Ensure the checksum is appended and that the result splits
+		// back into the descriptor and its checksum.
+		withChecksum, err := AddChecksum(test.desc)
+		if err != nil {
+			t.Errorf("%s: unexpected error adding checksum: %v",
+				test.name, err)
+			continue
+		}
+		if want := test.desc + "#" + test.checksum; withChecksum != want {
+			t.Errorf("%s: mismatched descriptor -- got %s, want %s",
+				test.name, withChecksum, want)
+			continue
+		}
+		desc, checksum, err := splitChecksum(withChecksum)
+		if err != nil {
+			t.Errorf("%s: unexpected error splitting checksum: %v",
+				test.name, err)
+			continue
+		}
+		if desc != test.desc || checksum != test.checksum {
+			t.Errorf("%s: mismatched split -- got %s#%s", test.name,
+				desc, checksum)
+		}
+	}
+}
+
+// TestSplitChecksum ensures descriptors with malformed or mismatched checksums
+// are rejected.
+func TestSplitChecksum(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		desc string
+		err  ErrorCode
+	}{{
+		name: "truncated checksum",
+		desc: "raw(deadbeef)#89f8spx",
+		err:  ErrInvalidChecksum,
+	}, {
+		name: "overlong checksum",
+		desc: "raw(deadbeef)#89f8spxmx",
+		err:  ErrInvalidChecksum,
+	}, {
+		name: "mismatched checksum",
+		desc: "raw(deadbeef)#89f8spxn",
+		err:  ErrInvalidChecksum,
+	}, {
+		name: "checksum of other descriptor",
+		desc: "raw(deadbeee)#89f8spxm",
+		err:  ErrInvalidChecksum,
+	}, {
+		name: "empty checksum",
+		desc: "raw(deadbeef)#",
+		err:  ErrInvalidChecksum,
+	}}
+
+	for _, test := range tests {
+		_, _, err := splitChecksum(test.desc)
+		if !IsErrorCode(err, test.err) {
+			t.Errorf("%s: mismatched error -- got %v, want %v",
+				test.name, err, test.err)
+		}
+	}
+}
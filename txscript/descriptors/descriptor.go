@@ -0,0 +1,638 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package descriptors
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfd/txscript"
+	"github.com/ifishnet/hdfd/txscript/internal/scriptexpr"
+	"github.com/ifishnet/hdfutil"
+)
+
+const (
+	// maxBareMultiSigKeys is the maximum number of keys of a multisig
+	// which is not nested in sh or wsh.  Larger bare multisigs are not
+	// standard.
+	maxBareMultiSigKeys = 3
+
+	// maxMultiSigKeys is the maximum number of keys of a multisig.
+	maxMultiSigKeys = txscript.MaxPubKeysPerMultiSig
+
+	// MaxDeriveRange is the maximum number of addresses DeriveAddresses
+	// derives at once.
+	MaxDeriveRange = 1000000
+)
+
+// scriptContext identifies where a script expression is used, which determines
+// the script functions and keys allowed in it.
+type scriptContext int
+
+const (
+	ctxTop scriptContext = iota
+	ctxSH
+	ctxWSH
+	ctxTapLeaf
+)
+
+// scriptKind identifies the script function of a script expression.
+type scriptKind int
+
+const (
+	kindPK scriptKind = iota
+	kindPKH
+	kindWPKH
+	kindSH
+	kindWSH
+	kindMulti
+	kindSortedMulti
+	kindTR
+	kindAddr
+	kindRaw
+)
+
+// scriptNode is a parsed script expression.
+type scriptNode struct {
+	kind scriptKind
+
+	// keys are the keys of pk, pkh, wpkh, multi, sortedmulti, and tr.
+	keys []*keyExpr
+
+	// threshold is the number of signatures a multisig requires.
+	threshold int
+
+	// sub is the script nested in sh and wsh.
+	sub *scriptNode
+
+	// tree is the script tree of tr, which is nil for key path only
+	// outputs.
+	tree *tapTree
+
+	// addr is the address of addr, and script is the script of raw.
+	addr   hdfutil.Address
+	script []byte
+}
+
+// tapTree is a parsed taproot script tree.  It is either a leaf with a script
+// or a branch with two subtrees.
+type tapTree struct {
+	leaf        *scriptNode
+	left, right *tapTree
+}
+
+// Output holds the scripts a descriptor compiles to at a given index.
+type Output struct {
+	// PkScript is the output script.
+	PkScript []byte
+
+	// RedeemScript is the script committed to by sh descriptors and is nil
+	// otherwise.
+	RedeemScript []byte
+
+	// WitnessScript is the script committed to by wsh descriptors and is
+	// nil otherwise.
+	WitnessScript []byte
+}
+
+// Descriptor is a parsed output descriptor which describes a set of output
+// scripts.  A descriptor which contains extended keys ranging over child keys
+// describes one script per index, while all others describe a single script.
+type Descriptor struct {
+	desc   string
+	root   *scriptNode
+	params *chaincfg.Params
+}
+
+// splitFunc splits the passed expression of the form name(args) into the name
+// and the arguments.
+func splitFunc(s string) (string, string, error) {
+	name, args, ok := scriptexpr.SplitFunc(s)
+	if !ok {
+		str := fmt.Sprintf("expected a script function, got %q", s)
+		return "", "", descriptorError(ErrInvalidSyntax, str)
+	}
+	return name, args, nil
+}
+
+// splitArgs splits the passed arguments at the commas which are not nested in
+// parentheses, brackets, or braces.
+func splitArgs(s string) ([]string, error) {
+	args, err := scriptexpr.SplitArgs(s)
+	if err != nil {
+		return nil, descriptorError(ErrInvalidSyntax, err.Error())
+	}
+	return args, nil
+}
+
+// expectArgs returns an error when the passed number of arguments of the named
+// script function is not the expected number.
+func expectArgs(name string, args []string, want int) error {
+	if len(args) != want {
+		str := fmt.Sprintf("%s expects %d argument(s), got %d", name,
+			want, len(args))
+		return descriptorError(ErrInvalidSyntax, str)
+	}
+	return nil
+}
+
+// contextError returns an error for a script function used in a context it is
+// not allowed in.
+func contextError(name string, ctx scriptContext) error {
+	var where string
+	switch ctx {
+	case ctxTop:
+		where = "at the top level"
+	case ctxSH:
+		where = "in sh"
+	case ctxWSH:
+		where = "in wsh"
+	case ctxTapLeaf:
+		where = "in a taproot script tree"
+	}
+	str := fmt.Sprintf("%s is not allowed %s", name, where)
+	return descriptorError(ErrInvalidContext, str)
+}
+
+// parseScript parses the passed script expression used in the passed context.
+func parseScript(s string, ctx scriptContext, params *chaincfg.Params) (*scriptNode, error) {
+	name, argStr, err := splitFunc(s)
+	if err != nil {
+		return nil, err
+	}
+	args, err := splitArgs(argStr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys in segwit scripts must be compressed, and keys in taproot
+	// script trees must be x-only.
+	keyCtx := keyCtxAny
+	switch ctx {
+	case ctxWSH:
+		keyCtx = keyCtxCompressed
+	case ctxTapLeaf:
+		keyCtx = keyCtxXOnly
+	}
+
+	switch name {
+	case "pk", "pkh", "wpkh":
+		kind := map[string]scriptKind{
+			"pk": kindPK, "pkh": kindPKH, "wpkh": kindWPKH,
+		}[name]
+		if (kind == kindPKH && ctx == ctxTapLeaf) ||
+			(kind == kindWPKH && ctx != ctxTop && ctx != ctxSH) {
+
+			return nil, contextError(name, ctx)
+		}
+		if err := expectArgs(name, args, 1); err != nil {
+			return nil, err
+		}
+		if kind == kindWPKH {
+			keyCtx = keyCtxCompressed
+		}
+		key, err := parseKey(args[0], keyCtx, params)
+		if err != nil {
+			return nil, err
+		}
+		return &scriptNode{kind: kind, keys: []*keyExpr{key}}, nil
+
+	case "sh", "wsh":
+		if (name == "sh" && ctx != ctxTop) ||
+			(name == "wsh" && ctx != ctxTop && ctx != ctxSH) {
+
+			return nil, contextError(name, ctx)
+		}
+		if err := expectArgs(name, args, 1); err != nil {
+			return nil, err
+		}
+		kind, subCtx := kindSH, ctxSH
+		if name == "wsh" {
+			kind, subCtx = kindWSH, ctxWSH
+		}
+		sub, err := parseScript(args[0], subCtx, params)
+		if err != nil {
+			return nil, err
+		}
+		return &scriptNode{kind: kind, sub: sub}, nil
+
+	case "multi", "sortedmulti":
+		if ctx == ctxTapLeaf {
+			return nil, contextError(name, ctx)
+		}
+		return parseMultiSig(name, args, ctx, keyCtx, params)
+
+	case "tr":
+		if ctx != ctxTop {
+			return nil, contextError(name, ctx)
+		}
+		if len(args) != 1 && len(args) != 2 {
+			str := fmt.Sprintf("tr expects 1 or 2 arguments, got %d",
+				len(args))
+			return nil, descriptorError(ErrInvalidSyntax, str)
+		}
+		key, err := parseKey(args[0], keyCtxXOnly, params)
+		if err != nil {
+			return nil, err
+		}
+		node := &scriptNode{kind: kindTR, keys: []*keyExpr{key}}
+		if len(args) == 2 {
+			node.tree, err = parseTapTree(args[1], 0, params)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return node, nil
+
+	case "addr":
+		if ctx != ctxTop {
+			return nil, contextError(name, ctx)
+		}
+		if err := expectArgs(name, args, 1); err != nil {
+			return nil, err
+		}
+		addr, err := hdfutil.DecodeAddress(args[0], params)
+		if err != nil || !addr.IsForNet(params) {
+			str := fmt.Sprintf("%q is not a valid address for network "+
+				"%s", args[0], params.Name)
+			return nil, descriptorError(ErrInvalidAddress, str)
+		}
+		return &scriptNode{kind: kindAddr, addr: addr}, nil
+
+	case "raw":
+		if ctx != ctxTop {
+			return nil, contextError(name, ctx)
+		}
+		if err := expectArgs(name, args, 1); err != nil {
+			return nil, err
+		}
+		script, err := hex.DecodeString(args[0])
+		if err != nil {
+			str := fmt.Sprintf("raw script %q is not hex", args[0])
+			return nil, descriptorError(ErrInvalidSyntax, str)
+		}
+		return &scriptNode{kind: kindRaw, script: script}, nil
+	}
+
+	str := fmt.Sprintf("unknown script function %q", name)
+	return nil, descriptorError(ErrInvalidSyntax, str)
+}
+
+// parseMultiSig parses the arguments of the named multisig script function used
+// in the passed context.
+func parseMultiSig(name string, args []string, ctx scriptContext,
+	keyCtx keyContext, params *chaincfg.Params) (*scriptNode, error) {
+
+	if len(args) < 2 {
+		str := fmt.Sprintf("%s expects a threshold and at least one key",
+			name)
+		return nil, descriptorError(ErrInvalidSyntax, str)
+	}
+	numKeys := len(args) - 1
+	maxKeys := maxMultiSigKeys
+	if ctx == ctxTop {
+		maxKeys = maxBareMultiSigKeys
+	}
+	if numKeys > maxKeys {
+		str := fmt.Sprintf("%s has %d keys, but at most %d are allowed "+
+			"here", name, numKeys, maxKeys)
+		return nil, descriptorError(ErrTooManyKeys, str)
+	}
+	threshold, err := strconv.Atoi(args[0])
+	if err != nil || threshold < 1 || threshold > numKeys {
+		str := fmt.Sprintf("%s threshold %q is not between 1 and %d",
+			name, args[0], numKeys)
+		return nil, descriptorError(ErrInvalidThreshold, str)
+	}
+
+	kind := kindMulti
+	if name == "sortedmulti" {
+		kind = kindSortedMulti
+	}
+	node := &scriptNode{kind: kind, threshold: threshold}
+	for _, arg := range args[1:] {
+		key, err := parseKey(arg, keyCtx, params)
+		if err != nil {
+			return nil, err
+		}
+		node.keys = append(node.keys, key)
+	}
+	return node, nil
+}
+
+// parseTapTree parses the passed taproot script tree at the passed depth.  A
+// tree is either a script expression or two trees in braces.
+func parseTapTree(s string, depth int, params *chaincfg.Params) (*tapTree, error) {
+	if !strings.HasPrefix(s, "{") {
+		leaf, err := parseScript(s, ctxTapLeaf, params)
+		if err != nil {
+			return nil, err
+		}
+		return &tapTree{leaf: leaf}, nil
+	}
+
+	if depth >= txscript.ControlBlockMaxNodeCount {
+		str := fmt.Sprintf("taproot script tree is deeper than %d",
+			txscript.ControlBlockMaxNodeCount)
+		return nil, descriptorError(ErrInvalidSyntax, str)
+	}
+	if !strings.HasSuffix(s, "}") {
+		str := fmt.Sprintf("taproot script tree %q is not closed", s)
+		return nil, descriptorError(ErrInvalidSyntax, str)
+	}
+	branches, err := splitArgs(s[1 : len(s)-1])
+	if err != nil {
+		return nil, err
+	}
+	if len(branches) != 2 {
+		str := fmt.Sprintf("taproot script tree branch has %d children "+
+			"instead of 2", len(branches))
+		return nil, descriptorError(ErrInvalidSyntax, str)
+	}
+	left, err := parseTapTree(branches[0], depth+1, params)
+	if err != nil {
+		return nil, err
+	}
+	right, err := parseTapTree(branches[1], depth+1, params)
+	if err != nil {
+		return nil, err
+	}
+	return &tapTree{left: left, right: right}, nil
+}
+
+// Parse parses the passed output descriptor for the passed network.  The
+// descriptor may end with a checksum, which is then validated.  When
+// requireChecksum is set, descriptors without a checksum are rejected.
+func Parse(desc string, requireChecksum bool, params *chaincfg.Params) (*Descriptor, error) {
+	desc, checksum, err := splitChecksum(desc)
+	if err != nil {
+		return nil, err
+	}
+	if checksum == "" && requireChecksum {
+		str := fmt.Sprintf("descriptor %q does not have a checksum", desc)
+		return nil, descriptorError(ErrMissingChecksum, str)
+	}
+
+	root, err := parseScript(desc, ctxTop, params)
+	if err != nil {
+		return nil, err
+	}
+	return &Descriptor{desc: desc, root: root, params: params}, nil
+}
+
+// String returns the descriptor with its checksum.
+func (d *Descriptor) String() string {
+	// The checksum can't fail since the descriptor was parsed.
+	desc, _ := AddChecksum(d.desc)
+	return desc
+}
+
+// isRange returns whether or not any key of the script expression or of the
+// scripts nested in it ranges over child keys.
+func (n *scriptNode) isRange() bool {
+	for _, key := range n.keys {
+		if key.isRange() {
+			return true
+		}
+	}
+	if n.sub != nil && n.sub.isRange() {
+		return true
+	}
+	return n.tree != nil && n.tree.isRange()
+}
+
+// isRange returns whether or not any script of the tree ranges over child keys.
+func (t *tapTree) isRange() bool {
+	if t.leaf != nil {
+		return t.leaf.isRange()
+	}
+	return t.left.isRange() || t.right.isRange()
+}
+
+// IsRange returns whether or not the descriptor contains extended keys which
+// range over child keys, and thus describes one script per index.
+func (d *Descriptor) IsRange() bool {
+	return d.root.isRange()
+}
+
+// serializeKeys returns the serialized public keys of the script expression at
+// the passed index.
+func (n *scriptNode) serializeKeys(index uint32) ([][]byte, error) {
+	keys := make([][]byte, 0, len(n.keys))
+	for _, key := range n.keys {
+		serialized, err := key.serialize(index)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, serialized)
+	}
+	return keys, nil
+}
+
+// compile returns the script the script expression compiles to at the passed
+// index and records the scripts it commits to in the passed output.
+func (n *scriptNode) compile(index uint32, out *Output) ([]byte, error) {
+	keys, err := n.serializeKeys(index)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := txscript.NewScriptBuilder()
+	switch n.kind {
+	case kindPK:
+		builder.AddData(keys[0]).AddOp(txscript.OP_CHECKSIG)
+
+	case kindPKH:
+		builder.AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160).
+			AddData(hdfutil.Hash160(keys[0])).
+			AddOp(txscript.OP_EQUALVERIFY).
+			AddOp(txscript.OP_CHECKSIG)
+
+	case kindWPKH:
+		builder.AddOp(txscript.OP_0).AddData(hdfutil.Hash160(keys[0]))
+
+	case kindSH:
+		redeemScript, err := n.sub.compile(index, out)
+		if err != nil {
+			return nil, err
+		}
+		if len(redeemScript) > txscript.MaxScriptElementSize {
+			str := fmt.Sprintf("redeem script is %d bytes, which is "+
+				"more than the max allowed %d",
+				len(redeemScript), txscript.MaxScriptElementSize)
+			return nil, descriptorError(ErrScriptTooBig, str)
+		}
+		out.RedeemScript = redeemScript
+		builder.AddOp(txscript.OP_HASH160).
+			AddData(hdfutil.Hash160(redeemScript)).
+			AddOp(txscript.OP_EQUAL)
+
+	case kindWSH:
+		witnessScript, err := n.sub.compile(index, out)
+		if err != nil {
+			return nil, err
+		}
+		if len(witnessScript) > txscript.MaxScriptSize {
+			str := fmt.Sprintf("witness script is %d bytes, which is "+
+				"more than the max allowed %d",
+				len(witnessScript), txscript.MaxScriptSize)
+			return nil, descriptorError(ErrScriptTooBig, str)
+		}
+		out.WitnessScript = witnessScript
+		scriptHash := sha256.Sum256(witnessScript)
+		builder.AddOp(txscript.OP_0).AddData(scriptHash[:])
+
+	case kindMulti, kindSortedMulti:
+		if n.kind == kindSortedMulti {
+			sort.Slice(keys, func(i, j int) bool {
+				return bytes.Compare(keys[i], keys[j]) < 0
+			})
+		}
+		builder.AddInt64(int64(n.threshold))
+		for _, key := range keys {
+			builder.AddData(key)
+		}
+		builder.AddInt64(int64(len(keys))).
+			AddOp(txscript.OP_CHECKMULTISIG)
+
+	case kindTR:
+		var rootHash []byte
+		if n.tree != nil {
+			hash, err := n.tree.hash(index)
+			if err != nil {
+				return nil, err
+			}
+			rootHash = hash
+		}
+		outputKey, err := txscript.ComputeTaprootOutputKey(keys[0],
+			rootHash)
+		if err != nil {
+			return nil, descriptorError(ErrInvalidKey, err.Error())
+		}
+		builder.AddOp(txscript.OP_1).AddData(outputKey)
+
+	case kindAddr:
+		script, err := txscript.PayToAddrScript(n.addr)
+		if err != nil {
+			return nil, descriptorError(ErrInvalidAddress, err.Error())
+		}
+		return script, nil
+
+	case kindRaw:
+		return n.script, nil
+	}
+	return builder.Script()
+}
+
+// hash returns the taproot merkle root of the tree at the passed index.
+func (t *tapTree) hash(index uint32) ([]byte, error) {
+	if t.leaf != nil {
+		var out Output
+		script, err := t.leaf.compile(index, &out)
+		if err != nil {
+			return nil, err
+		}
+		leafHash := txscript.TapLeafHash(txscript.BaseLeafVersion, script)
+		return leafHash[:], nil
+	}
+
+	left, err := t.left.hash(index)
+	if err != nil {
+		return nil, err
+	}
+	right, err := t.right.hash(index)
+	if err != nil {
+		return nil, err
+	}
+	branchHash := txscript.TapBranchHash(left, right)
+	return branchHash[:], nil
+}
+
+// Expand returns the scripts the descriptor compiles to at the passed index.
+// The index is ignored unless the descriptor ranges over child keys.
+func (d *Descriptor) Expand(index uint32) (*Output, error) {
+	var out Output
+	pkScript, err := d.root.compile(index, &out)
+	if err != nil {
+		return nil, err
+	}
+	out.PkScript = pkScript
+	return &out, nil
+}
+
+// addressForScript returns the address of the passed output script.
+func addressForScript(pkScript []byte, params *chaincfg.Params) (hdfutil.Address, error) {
+	class, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript, params)
+	if err == nil && len(addrs) == 1 {
+		switch class {
+		case txscript.PubKeyHashTy, txscript.ScriptHashTy,
+			txscript.WitnessV0PubKeyHashTy,
+			txscript.WitnessV0ScriptHashTy,
+			txscript.WitnessV1TaprootTy:
+
+			return addrs[0], nil
+		}
+	}
+	str := fmt.Sprintf("script %x does not have an address", pkScript)
+	return nil, descriptorError(ErrNoAddress, str)
+}
+
+// Address returns the address of the script the descriptor compiles to at the
+// passed index.  The index is ignored unless the descriptor ranges over child
+// keys.  Descriptors which compile to scripts without an address, such as pk
+// and bare multi, return ErrNoAddress.
+func (d *Descriptor) Address(index uint32) (hdfutil.Address, error) {
+	if d.root.kind == kindAddr {
+		return d.root.addr, nil
+	}
+	out, err := d.Expand(index)
+	if err != nil {
+		return nil, err
+	}
+	return addressForScript(out.PkScript, d.params)
+}
+
+// DeriveAddresses returns the addresses of the scripts the descriptor compiles
+// to at the indexes from start to end inclusive.  Descriptors which do not
+// range over child keys only have a single address, so the range is ignored for
+// them.
+func (d *Descriptor) DeriveAddresses(start, end uint32) ([]hdfutil.Address, error) {
+	if !d.IsRange() {
+		addr, err := d.Address(0)
+		if err != nil {
+			return nil, err
+		}
+		return []hdfutil.Address{addr}, nil
+	}
+	if start > end {
+		str := fmt.Sprintf("range start %d is after range end %d", start,
+			end)
+		return nil, descriptorError(ErrInvalidIndex, str)
+	}
+	if end-start >= MaxDeriveRange {
+		str := fmt.Sprintf("range of %d addresses is more than the max "+
+			"allowed %d", uint64(end-start)+1, MaxDeriveRange)
+		return nil, descriptorError(ErrInvalidIndex, str)
+	}
+
+	addrs := make([]hdfutil.Address, 0, end-start+1)
+	for index := start; ; index++ {
+		addr, err := d.Address(index)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+		if index == end {
+			break
+		}
+	}
+	return addrs, nil
+}
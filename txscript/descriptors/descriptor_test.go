@@ -0,0 +1,433 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package descriptors
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+)
+
+const (
+	// The compressed public keys of the private keys 1, 2, and 3.
+	testKey1 = "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+	testKey2 = "02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5"
+	testKey3 = "02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9"
+
+	// testUncompressedKey1 is the uncompressed public key of private key 1.
+	testUncompressedKey1 = "0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d9" +
+		"59f2815b16f81798483ada7726a3c4655da4fbfc0e1108a8fd17b448a6855419" +
+		"9c47d08ffb10d4b8"
+
+	// The master keys of BIP0032 test vector 1.
+	testXPub = "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ" +
+		"29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"
+	testXPrv = "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiCh" +
+		"kVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+)
+
+// hexToBytes converts the passed hex string into bytes and will panic if there
+// is an error.  This is only provided for the hard-coded constants so errors in
+// the source code can be detected.  It will only (and must only) be called with
+// hard-coded values.
+func hexToBytes(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic("invalid hex in source file: " + s)
+	}
+	return b
+}
+
+// TestExpand ensures descriptors compile to the expected scripts and addresses.
+func TestExpand(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		desc          string
+		pkScript      string
+		redeemScript  string
+		witnessScript string
+		addr          string
+	}{{
+		name:     "pk",
+		desc:     "pk(" + testKey1 + ")",
+		pkScript: "21" + testKey1 + "ac",
+	}, {
+		name:     "pkh with uncompressed key",
+		desc:     "pkh(" + testUncompressedKey1 + ")",
+		pkScript: "76a91491b24bf9f5288532960ac687abb035127b1d28a588ac",
+		addr:     "1EHNa6Q4Jz2uvNExL497mE43ikXhwF6kZm",
+	}, {
+		name:     "wpkh",
+		desc:     "wpkh(" + testKey1 + ")",
+		pkScript: "0014751e76e8199196d454941c45d1b3a323f1433bd6",
+		addr:     "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+	}, {
+		name:         "sh(wpkh)",
+		desc:         "sh(wpkh(" + testKey1 + "))",
+		pkScript:     "a914bcfeb728b584253d5f3f70bcb780e9ef218a68f487",
+		redeemScript: "0014751e76e8199196d454941c45d1b3a323f1433bd6",
+		addr:         "3JvL6Ymt8MVWiCNHC7oWU6nLeHNJKLZGLN",
+	}, {
+		name: "wsh(multi)",
+		desc: "wsh(multi(2," + testKey3 + "," + testKey1 + "," +
+			testKey2 + "))",
+		pkScript: "0020301889f2d77d5de3f84562c68492b10d7edd85a55de980e7cc" +
+			"56013c4d61ed34",
+		witnessScript: "5221" + testKey3 + "21" + testKey1 + "21" +
+			testKey2 + "53ae",
+		addr: "bc1qxqvgnukh04w787z9vtrgfy43p4ldmpd9th5cpe7v2cqncntpa56qgpu0t7",
+	}, {
+		name: "wsh(sortedmulti)",
+		desc: "wsh(sortedmulti(2," + testKey3 + "," + testKey1 + "," +
+			testKey2 + "))",
+		pkScript: "002012c2ffbc6ec1cf5d746dfbd49b1063356212ea55f43023ffc0" +
+			"145934af20c572",
+		witnessScript: "5221" + testKey1 + "21" + testKey2 + "21" +
+			testKey3 + "53ae",
+		addr: "bc1qztp0l0rwc8846ardl02fkyrrx43p96j47scz8l7qz3vnfteqc4eqtfqwcm",
+	}, {
+		name:     "bare multi",
+		desc:     "multi(1," + testKey1 + "," + testKey2 + ")",
+		pkScript: "5121" + testKey1 + "21" + testKey2 + "52ae",
+	}, {
+		name: "tr without script tree",
+		desc: "tr(" + testKey1[2:] + ")",
+		pkScript: "5120da4710964f7852695de2da025290e24af6d8c281de5a0b902b" +
+			"7135fd9fd74d21",
+		addr: "bc1pmfr3p9j00pfxjh0zmgp99y8zftmd3s5pmedqhyptwy6lm87hf5sspknck9",
+	}, {
+		name: "tr with script tree",
+		desc: "tr(" + testKey1[2:] + ",{pk(" + testKey2[2:] + "),pk(" +
+			testKey3[2:] + ")})",
+		pkScript: "512008e5468ea340dc78d04431e7809419a5671fcb08c256f5b8bb" +
+			"fcb54f71b9cea6",
+		addr: "bc1pprj5dr4rgrw835zyx8ncp9qe54n3ljcgcft0tw9mlj657udee6nq008pgf",
+	}, {
+		name: "tr with extended key",
+		desc: "tr(" + testXPub + "/0)",
+		pkScript: "5120ae0d3a1092db9170e0606a1a0ee68750f410b4e79c514883f5" +
+			"2c18bb02ed3c25",
+		addr: "bc1p4cxn5yyjmwghpcrqdgdqae582r6ppd88n3g53ql49svtkqhd8sjs2esumq",
+	}, {
+		name:     "addr",
+		desc:     "addr(bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4)",
+		pkScript: "0014751e76e8199196d454941c45d1b3a323f1433bd6",
+		addr:     "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+	}, {
+		name:     "raw",
+		desc:     "raw(deadbeef)",
+		pkScript: "deadbeef",
+	}}
+
+	for _, test := range tests {
+		desc, err := Parse(test.desc, false, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Errorf("%s: unexpected parse error: %v", test.name, err)
+			continue
+		}
+		if desc.IsRange() {
+			t.Errorf("%s: descriptor unexpectedly ranges", test.name)
+			continue
+		}
+
+		out, err := desc.Expand(0)
+		if err != nil {
+			t.Errorf("%s: unexpected expand error: %v", test.name, err)
+			continue
+		}
+		scripts := []struct {
+			name      string
+			got, want []byte
+		}{
+			{"output script", out.PkScript, hexToBytes(test.pkScript)},
+			{"redeem script", out.RedeemScript,
+				hexToBytes(test.redeemScript)},
+			{"witness script", out.WitnessScript,
+				hexToBytes(test.witnessScript)},
+		}
+		for _, script := range scripts {
+			if !bytes.Equal(script.got, script.want) {
+				t.Errorf("%s: mismatched %s -- got %x, want %x",
+					test.name, script.name, script.got,
+					script.want)
+			}
+		}
+
+		addr, err := desc.Address(0)
+		if test.addr == "" {
+			if !IsErrorCode(err, ErrNoAddress) {
+				t.Errorf("%s: mismatched address error -- got %v, "+
+					"want %v", test.name, err, ErrNoAddress)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected address error: %v", test.name,
+				err)
+			continue
+		}
+		if addr.EncodeAddress() != test.addr {
+			t.Errorf("%s: mismatched address -- got %s, want %s",
+				test.name, addr.EncodeAddress(), test.addr)
+		}
+	}
+}
+
+// TestDeriveAddresses ensures descriptors which range over child keys derive
+// the expected addresses.
+func TestDeriveAddresses(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		desc  string
+		start uint32
+		end   uint32
+		addrs []string
+	}{{
+		name:  "unhardened range",
+		desc:  "wpkh(" + testXPub + "/1/*)",
+		start: 0,
+		end:   2,
+		addrs: []string{
+			"bc1q7zwtzcqsm3k43ha0ac7nl8cz0hqrhckywf6sew",
+			"bc1qf7x2v0de6hvgv6tke54pyzmkc9022wh5j3f6y5",
+			"bc1qa3ht4xx9evh8dp8p66tzftu45zccugw4lnc6nn",
+		},
+	}, {
+		name:  "unhardened range with offset",
+		desc:  "wpkh([d34db33f/84'/0'/0']" + testXPub + "/1/*)",
+		start: 1,
+		end:   2,
+		addrs: []string{
+			"bc1qf7x2v0de6hvgv6tke54pyzmkc9022wh5j3f6y5",
+			"bc1qa3ht4xx9evh8dp8p66tzftu45zccugw4lnc6nn",
+		},
+	}, {
+		name:  "hardened range",
+		desc:  "pkh(" + testXPrv + "/0h/*')",
+		start: 0,
+		end:   1,
+		addrs: []string{
+			"1NnzqqJHuFuh7rJiZ7WK1SeKkgTisMyDZX",
+			"1Fqz4JpQX6gFRa5BRAT1mj5fvrP7YEB1aJ",
+		},
+	}, {
+		name:  "no range",
+		desc:  "wpkh(" + testKey1 + ")",
+		start: 5,
+		end:   10,
+		addrs: []string{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"},
+	}}
+
+	for _, test := range tests {
+		desc, err := Parse(test.desc, false, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Errorf("%s: unexpected parse error: %v", test.name, err)
+			continue
+		}
+		addrs, err := desc.DeriveAddresses(test.start, test.end)
+		if err != nil {
+			t.Errorf("%s: unexpected derive error: %v", test.name, err)
+			continue
+		}
+		if len(addrs) != len(test.addrs) {
+			t.Errorf("%s: mismatched number of addresses -- got %d, "+
+				"want %d", test.name, len(addrs), len(test.addrs))
+			continue
+		}
+		for i, addr := range addrs {
+			if addr.EncodeAddress() != test.addrs[i] {
+				t.Errorf("%s: mismatched address #%d -- got %s, "+
+					"want %s", test.name, i, addr.EncodeAddress(),
+					test.addrs[i])
+			}
+		}
+	}
+
+	// Ensure invalid ranges are rejected.
+	desc, err := Parse("wpkh("+testXPub+"/*)", false, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	if _, err := desc.DeriveAddresses(2, 1); !IsErrorCode(err, ErrInvalidIndex) {
+		t.Errorf("reversed range: mismatched error -- got %v, want %v",
+			err, ErrInvalidIndex)
+	}
+	_, err = desc.DeriveAddresses(0, MaxDeriveRange)
+	if !IsErrorCode(err, ErrInvalidIndex) {
+		t.Errorf("oversized range: mismatched error -- got %v, want %v",
+			err, ErrInvalidIndex)
+	}
+	if _, err := desc.Expand(1 << 31); !IsErrorCode(err, ErrInvalidIndex) {
+		t.Errorf("hardened index: mismatched error -- got %v, want %v",
+			err, ErrInvalidIndex)
+	}
+}
+
+// TestParseErrors ensures invalid descriptors are rejected with the expected
+// error codes.
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+
+	multiKeys := func(n int) string {
+		return strings.Repeat(","+testKey1, n)
+	}
+
+	tests := []struct {
+		name            string
+		desc            string
+		requireChecksum bool
+		err             ErrorCode
+	}{{
+		name:            "missing required checksum",
+		desc:            "raw(deadbeef)",
+		requireChecksum: true,
+		err:             ErrMissingChecksum,
+	}, {
+		name: "invalid checksum",
+		desc: "raw(deadbeef)#89f8spxn",
+		err:  ErrInvalidChecksum,
+	}, {
+		name: "unknown function",
+		desc: "foo(" + testKey1 + ")",
+		err:  ErrInvalidSyntax,
+	}, {
+		name: "unbalanced parentheses",
+		desc: "sh(wpkh(" + testKey1 + ")",
+		err:  ErrInvalidSyntax,
+	}, {
+		name: "too many arguments",
+		desc: "pkh(" + testKey1 + "," + testKey2 + ")",
+		err:  ErrInvalidSyntax,
+	}, {
+		name: "sh nested in sh",
+		desc: "sh(sh(pk(" + testKey1 + ")))",
+		err:  ErrInvalidContext,
+	}, {
+		name: "wpkh nested in wsh",
+		desc: "wsh(wpkh(" + testKey1 + "))",
+		err:  ErrInvalidContext,
+	}, {
+		name: "tr nested in sh",
+		desc: "sh(tr(" + testKey1[2:] + "))",
+		err:  ErrInvalidContext,
+	}, {
+		name: "uncompressed key in wpkh",
+		desc: "wpkh(" + testUncompressedKey1 + ")",
+		err:  ErrInvalidContext,
+	}, {
+		name: "uncompressed key in wsh",
+		desc: "wsh(pk(" + testUncompressedKey1 + "))",
+		err:  ErrInvalidContext,
+	}, {
+		name: "compressed key in tr",
+		desc: "tr(" + testKey1 + ")",
+		err:  ErrInvalidContext,
+	}, {
+		name: "pkh in taproot script tree",
+		desc: "tr(" + testKey1[2:] + ",pkh(" + testKey2[2:] + "))",
+		err:  ErrInvalidContext,
+	}, {
+		name: "invalid public key",
+		desc: "pk(02" + strings.Repeat("0", 63) + "5)",
+		err:  ErrInvalidKey,
+	}, {
+		name: "invalid extended key",
+		desc: "pkh(" + testXPub[:len(testXPub)-1] + "9)",
+		err:  ErrInvalidKey,
+	}, {
+		name: "extended key for other network",
+		desc: "pkh(tpubD6NzVbkrYhZ4XgiXtGrdW5XDAPFCL9h7we1vwNCpn8tGbB" +
+			"cgfVYjXyhWo4E1xkh56hjod1RhGjxbaTLV3X4FyWuejifB9jusQ46QzG87" +
+			"VKp)",
+		err: ErrInvalidKey,
+	}, {
+		name: "invalid key origin fingerprint",
+		desc: "pkh([d34db33/44'/0'/0']" + testXPub + ")",
+		err:  ErrInvalidKeyOrigin,
+	}, {
+		name: "unclosed key origin",
+		desc: "pkh([d34db33f/44'/0'/0'" + testXPub + ")",
+		err:  ErrInvalidSyntax,
+	}, {
+		name: "invalid derivation path element",
+		desc: "pkh(" + testXPub + "/1x/*)",
+		err:  ErrInvalidPath,
+	}, {
+		name: "hardened derivation of public key",
+		desc: "pkh(" + testXPub + "/0h)",
+		err:  ErrInvalidPath,
+	}, {
+		name: "hardened range of public key",
+		desc: "pkh(" + testXPub + "/*')",
+		err:  ErrInvalidPath,
+	}, {
+		name: "zero threshold",
+		desc: "wsh(multi(0," + testKey1 + "))",
+		err:  ErrInvalidThreshold,
+	}, {
+		name: "threshold above number of keys",
+		desc: "wsh(multi(3," + testKey1 + "," + testKey2 + "))",
+		err:  ErrInvalidThreshold,
+	}, {
+		name: "too many keys in bare multi",
+		desc: "multi(1" + multiKeys(4) + ")",
+		err:  ErrTooManyKeys,
+	}, {
+		name: "too many keys in wsh multi",
+		desc: "wsh(multi(1" + multiKeys(21) + "))",
+		err:  ErrTooManyKeys,
+	}, {
+		name: "redeem script too big",
+		desc: "sh(multi(1" + multiKeys(16) + "))",
+		err:  ErrScriptTooBig,
+	}, {
+		name: "address for other network",
+		desc: "addr(tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx)",
+		err:  ErrInvalidAddress,
+	}, {
+		name: "raw script not hex",
+		desc: "raw(deadbeeg)",
+		err:  ErrInvalidSyntax,
+	}}
+
+	for _, test := range tests {
+		// Some errors are only detected when the descriptor is
+		// compiled.
+		desc, err := Parse(test.desc, test.requireChecksum,
+			&chaincfg.MainNetParams)
+		if err == nil {
+			_, err = desc.Expand(0)
+		}
+		if !IsErrorCode(err, test.err) {
+			t.Errorf("%s: mismatched error -- got %v, want %v",
+				test.name, err, test.err)
+		}
+	}
+}
+
+// TestString ensures descriptors are returned with their checksums.
+func TestString(t *testing.T) {
+	t.Parallel()
+
+	const want = "wpkh(" + testKey1 + ")#ucxz0gak"
+	for _, s := range []string{"wpkh(" + testKey1 + ")", want} {
+		desc, err := Parse(s, false, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Errorf("unexpected parse error: %v", err)
+			continue
+		}
+		if desc.String() != want {
+			t.Errorf("mismatched string -- got %s, want %s",
+				desc.String(), want)
+		}
+	}
+}
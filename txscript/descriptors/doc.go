@@ -0,0 +1,54 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package descriptors implements parsing of output script descriptors and
+compiling them into output scripts and addresses.
+
+Output script descriptors, as defined by BIP0380 and the following BIPs, are a
+human-readable language which describes collections of output scripts.  They are
+used by RPCs such as deriveaddresses and scantxoutset to refer to the outputs of
+a wallet without needing to know its private keys.
+
+Supported Script Functions
+
+The following script functions are supported:
+
+  - pk(KEY)                 Pay-to-pubkey (P2PK)
+  - pkh(KEY)                Pay-to-pubkey-hash (P2PKH)
+  - wpkh(KEY)               Pay-to-witness-pubkey-hash (P2WPKH)
+  - sh(SCRIPT)              Pay-to-script-hash (P2SH)
+  - wsh(SCRIPT)             Pay-to-witness-script-hash (P2WSH)
+  - multi(k,KEY,...)        k-of-n multisig with keys in the given order
+  - sortedmulti(k,KEY,...)  k-of-n multisig with keys sorted lexicographically
+  - tr(KEY)                 Pay-to-taproot (P2TR) with only a key path
+  - tr(KEY,TREE)            Pay-to-taproot (P2TR) where TREE is a pk script
+                            or two trees in braces, such as {A,B}
+  - addr(ADDR)              The output script of an address
+  - raw(HEX)                A hex-encoded output script
+
+Key Expressions
+
+A KEY is either a hex-encoded public key or an extended key followed by
+derivation steps, such as xpub.../0/*.  A final * derives the key at the index a
+descriptor is expanded at, which makes the descriptor range over child keys.
+Steps followed by ' or h use hardened derivation and require an extended
+private key.  Every key may be preceded by its origin in brackets, such as
+[d34db33f/44'/0'/0'], which is validated but otherwise ignored.
+
+Keys in wpkh and wsh must be compressed, and keys in tr must be 32-byte x-only
+public keys or extended keys.
+
+Checksums
+
+Descriptors may end with a checksum, such as #89f8spxm, which detects typing
+errors.  Parse validates the checksum when present and can require it, while
+Checksum and AddChecksum compute it.
+
+Errors
+
+Errors returned by this package are of type descriptors.Error, which contains
+an ErrorCode field to programmatically identify the reason for the failure.
+*/
+package descriptors
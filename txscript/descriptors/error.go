@@ -0,0 +1,126 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package descriptors
+
+import (
+	"fmt"
+)
+
+// ErrorCode identifies a kind of descriptor error.
+type ErrorCode int
+
+// These constants are used to identify a specific Error.
+const (
+	// ErrMissingChecksum is returned when a checksum is required but the
+	// descriptor does not have one.
+	ErrMissingChecksum ErrorCode = iota
+
+	// ErrInvalidChecksum is returned when the checksum of a descriptor
+	// is malformed or does not match the descriptor.
+	ErrInvalidChecksum
+
+	// ErrInvalidCharacter is returned when a descriptor contains a
+	// character which is not allowed in descriptors.
+	ErrInvalidCharacter
+
+	// ErrInvalidSyntax is returned when a descriptor does not follow the
+	// descriptor grammar, such as an unknown script function, unbalanced
+	// parentheses, or a wrong number of arguments.
+	ErrInvalidSyntax
+
+	// ErrInvalidContext is returned when a script function or key is used
+	// where it is not allowed, such as sh nested in wsh or an
+	// uncompressed key in a segwit script.
+	ErrInvalidContext
+
+	// ErrInvalidKey is returned when a key expression is not a valid
+	// public key or extended key for the network.
+	ErrInvalidKey
+
+	// ErrInvalidKeyOrigin is returned when the key origin of a key
+	// expression is malformed.
+	ErrInvalidKeyOrigin
+
+	// ErrInvalidPath is returned when a derivation path is malformed or
+	// requires hardened derivation from an extended public key.
+	ErrInvalidPath
+
+	// ErrInvalidThreshold is returned when the threshold of a multisig is
+	// not between one and the number of keys.
+	ErrInvalidThreshold
+
+	// ErrTooManyKeys is returned when a multisig has more keys than allowed
+	// in its context.
+	ErrTooManyKeys
+
+	// ErrScriptTooBig is returned when a compiled script exceeds the
+	// maximum size allowed in its context.
+	ErrScriptTooBig
+
+	// ErrInvalidAddress is returned when the address of an addr descriptor
+	// can't be decoded for the network.
+	ErrInvalidAddress
+
+	// ErrInvalidIndex is returned when a derivation index is out of range.
+	ErrInvalidIndex
+
+	// ErrNoAddress is returned when the script a descriptor compiles to does
+	// not have an address.
+	ErrNoAddress
+
+	// numErrorCodes is the maximum error code number used in tests.
+	numErrorCodes
+)
+
+// Map of ErrorCode values back to their constant names for pretty printing.
+var errorCodeStrings = map[ErrorCode]string{
+	ErrMissingChecksum:  "ErrMissingChecksum",
+	ErrInvalidChecksum:  "ErrInvalidChecksum",
+	ErrInvalidCharacter: "ErrInvalidCharacter",
+	ErrInvalidSyntax:    "ErrInvalidSyntax",
+	ErrInvalidContext:   "ErrInvalidContext",
+	ErrInvalidKey:       "ErrInvalidKey",
+	ErrInvalidKeyOrigin: "ErrInvalidKeyOrigin",
+	ErrInvalidPath:      "ErrInvalidPath",
+	ErrInvalidThreshold: "ErrInvalidThreshold",
+	ErrTooManyKeys:      "ErrTooManyKeys",
+	ErrScriptTooBig:     "ErrScriptTooBig",
+	ErrInvalidAddress:   "ErrInvalidAddress",
+	ErrInvalidIndex:     "ErrInvalidIndex",
+	ErrNoAddress:        "ErrNoAddress",
+}
+
+// String returns the ErrorCode as a human-readable name.
+func (e ErrorCode) String() string {
+	if s := errorCodeStrings[e]; s != "" {
+		return s
+	}
+	return fmt.Sprintf("Unknown ErrorCode (%d)", int(e))
+}
+
+// Error identifies a descriptor-related error.  The caller can use type
+// assertions to access the ErrorCode field to ascertain the specific reason for
+// the failure.
+type Error struct {
+	ErrorCode   ErrorCode
+	Description string
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e Error) Error() string {
+	return e.Description
+}
+
+// descriptorError creates an Error given a set of arguments.
+func descriptorError(c ErrorCode, desc string) Error {
+	return Error{ErrorCode: c, Description: desc}
+}
+
+// IsErrorCode returns whether or not the provided error is a descriptor error
+// with the provided error code.
+func IsErrorCode(err error, c ErrorCode) bool {
+	derr, ok := err.(Error)
+	return ok && derr.ErrorCode == c
+}
@@ -0,0 +1,266 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package descriptors
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ifishnet/hdfd/chaincfg"
+	"github.com/ifishnet/hdfd/hdfec"
+	"github.com/ifishnet/hdfutil/hdkeychain"
+)
+
+// keyContext identifies the kind of public keys a key expression must resolve
+// to where it is used.
+type keyContext int
+
+const (
+	// keyCtxAny allows compressed and uncompressed public keys.
+	keyCtxAny keyContext = iota
+
+	// keyCtxCompressed only allows compressed public keys, which segwit
+	// scripts require.
+	keyCtxCompressed
+
+	// keyCtxXOnly only allows x-only public keys, which taproot requires.
+	keyCtxXOnly
+)
+
+// rangeType identifies whether and how the last derivation step of a key
+// expression is ranged over.
+type rangeType int
+
+const (
+	rangeNone rangeType = iota
+	rangeUnhardened
+	rangeHardened
+)
+
+// keyExpr is a parsed key expression.  It either holds a fixed public key or an
+// extended key along with the derivation steps to the public key.
+type keyExpr struct {
+	ctx keyContext
+
+	// pubKey is the serialized fixed public key.
+	pubKey []byte
+
+	// extKey is the extended key after applying the fixed derivation
+	// steps, and rng is how the remaining step is ranged over.
+	extKey *hdkeychain.ExtendedKey
+	rng    rangeType
+}
+
+// parsePathElement parses the passed derivation path element, which is a
+// number optionally followed by ' or h to denote hardened derivation.
+func parsePathElement(s string) (uint32, error) {
+	hardened := strings.HasSuffix(s, "'") || strings.HasSuffix(s, "h")
+	if hardened {
+		s = s[:len(s)-1]
+	}
+	index, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || index >= hdkeychain.HardenedKeyStart {
+		str := fmt.Sprintf("invalid derivation path element %q", s)
+		return 0, descriptorError(ErrInvalidPath, str)
+	}
+	if hardened {
+		index += hdkeychain.HardenedKeyStart
+	}
+	return uint32(index), nil
+}
+
+// parseKeyOrigin ensures the passed key origin, which is the text between the
+// brackets preceding a key, is an 8 character hex fingerprint optionally
+// followed by a derivation path.
+func parseKeyOrigin(origin string) error {
+	elements := strings.Split(origin, "/")
+	if len(elements[0]) != 8 {
+		str := fmt.Sprintf("key origin fingerprint %q is not 8 hex "+
+			"characters", elements[0])
+		return descriptorError(ErrInvalidKeyOrigin, str)
+	}
+	if _, err := hex.DecodeString(elements[0]); err != nil {
+		str := fmt.Sprintf("key origin fingerprint %q is not hex",
+			elements[0])
+		return descriptorError(ErrInvalidKeyOrigin, str)
+	}
+	for _, element := range elements[1:] {
+		if _, err := parsePathElement(element); err != nil {
+			str := fmt.Sprintf("invalid key origin path: %v", err)
+			return descriptorError(ErrInvalidKeyOrigin, str)
+		}
+	}
+	return nil
+}
+
+// parseFixedKey parses the passed hex-encoded public key for use in the passed
+// context.
+func parseFixedKey(s string, ctx keyContext) (*keyExpr, error) {
+	pubKey, err := hex.DecodeString(s)
+	if err != nil {
+		str := fmt.Sprintf("key %q is neither hex nor an extended key", s)
+		return nil, descriptorError(ErrInvalidKey, str)
+	}
+
+	// X-only public keys are only allowed, and required, in taproot.
+	if ctx == keyCtxXOnly {
+		if len(pubKey) != 32 {
+			str := fmt.Sprintf("key %q is not a 32-byte x-only public "+
+				"key", s)
+			return nil, descriptorError(ErrInvalidContext, str)
+		}
+		compressed := append([]byte{0x02}, pubKey...)
+		if _, err := hdfec.ParsePubKey(compressed, hdfec.S256()); err != nil {
+			str := fmt.Sprintf("key %q is not a valid x-only public "+
+				"key", s)
+			return nil, descriptorError(ErrInvalidKey, str)
+		}
+		return &keyExpr{ctx: ctx, pubKey: pubKey}, nil
+	}
+
+	if len(pubKey) != hdfec.PubKeyBytesLenCompressed &&
+		len(pubKey) != hdfec.PubKeyBytesLenUncompressed {
+
+		str := fmt.Sprintf("key %q is not a compressed or uncompressed "+
+			"public key", s)
+		return nil, descriptorError(ErrInvalidKey, str)
+	}
+	_, err = hdfec.ParsePubKey(pubKey, hdfec.S256())
+	if err != nil || (len(pubKey) == hdfec.PubKeyBytesLenUncompressed &&
+		pubKey[0] != 0x04) {
+
+		str := fmt.Sprintf("key %q is not a valid public key", s)
+		return nil, descriptorError(ErrInvalidKey, str)
+	}
+	if ctx == keyCtxCompressed &&
+		len(pubKey) != hdfec.PubKeyBytesLenCompressed {
+
+		str := fmt.Sprintf("uncompressed key %q is not allowed in "+
+			"segwit scripts", s)
+		return nil, descriptorError(ErrInvalidContext, str)
+	}
+	return &keyExpr{ctx: ctx, pubKey: pubKey}, nil
+}
+
+// parseKey parses the passed key expression for use in the passed context on
+// the passed network.  A key expression is an optional key origin in brackets
+// followed by either a hex-encoded public key or an extended key with optional
+// derivation steps, the last of which may be * or *' to range over child keys.
+func parseKey(s string, ctx keyContext, params *chaincfg.Params) (*keyExpr, error) {
+	if strings.HasPrefix(s, "[") {
+		end := strings.IndexByte(s, ']')
+		if end == -1 {
+			str := fmt.Sprintf("key origin of %q is not closed", s)
+			return nil, descriptorError(ErrInvalidKeyOrigin, str)
+		}
+		if err := parseKeyOrigin(s[1:end]); err != nil {
+			return nil, err
+		}
+		s = s[end+1:]
+	}
+
+	elements := strings.Split(s, "/")
+	if len(elements) == 1 {
+		if _, err := hex.DecodeString(s); err == nil {
+			return parseFixedKey(s, ctx)
+		}
+	}
+
+	extKey, err := hdkeychain.NewKeyFromString(elements[0])
+	if err != nil {
+		str := fmt.Sprintf("key %q is neither hex nor an extended key: %v",
+			elements[0], err)
+		return nil, descriptorError(ErrInvalidKey, str)
+	}
+	if !extKey.IsForNet(params) {
+		str := fmt.Sprintf("extended key %q is not for network %s",
+			elements[0], params.Name)
+		return nil, descriptorError(ErrInvalidKey, str)
+	}
+
+	key := &keyExpr{ctx: ctx}
+	path := elements[1:]
+	if len(path) > 0 {
+		switch path[len(path)-1] {
+		case "*":
+			key.rng = rangeUnhardened
+		case "*'", "*h":
+			key.rng = rangeHardened
+		}
+		if key.rng != rangeNone {
+			path = path[:len(path)-1]
+		}
+	}
+	if key.rng == rangeHardened && !extKey.IsPrivate() {
+		str := fmt.Sprintf("hardened range of %q requires an extended "+
+			"private key", s)
+		return nil, descriptorError(ErrInvalidPath, str)
+	}
+
+	// Apply the fixed derivation steps once, so only the ranged step needs
+	// to be applied for each index.
+	for _, element := range path {
+		index, err := parsePathElement(element)
+		if err != nil {
+			return nil, err
+		}
+		if index >= hdkeychain.HardenedKeyStart && !extKey.IsPrivate() {
+			str := fmt.Sprintf("hardened derivation of %q requires "+
+				"an extended private key", s)
+			return nil, descriptorError(ErrInvalidPath, str)
+		}
+		extKey, err = extKey.Child(index)
+		if err != nil {
+			str := fmt.Sprintf("unable to derive %q: %v", s, err)
+			return nil, descriptorError(ErrInvalidPath, str)
+		}
+	}
+	key.extKey = extKey
+	return key, nil
+}
+
+// isRange returns whether or not the key expression ranges over child keys.
+func (k *keyExpr) isRange() bool {
+	return k.rng != rangeNone
+}
+
+// serialize returns the serialized public key the key expression resolves to
+// at the passed index in the form required by its context.  The index is
+// ignored unless the key expression ranges over child keys.
+func (k *keyExpr) serialize(index uint32) ([]byte, error) {
+	if k.extKey == nil {
+		return k.pubKey, nil
+	}
+
+	extKey := k.extKey
+	if k.isRange() {
+		if index >= hdkeychain.HardenedKeyStart {
+			str := fmt.Sprintf("index %d is not below %d", index,
+				uint32(hdkeychain.HardenedKeyStart))
+			return nil, descriptorError(ErrInvalidIndex, str)
+		}
+		if k.rng == rangeHardened {
+			index += hdkeychain.HardenedKeyStart
+		}
+		var err error
+		extKey, err = extKey.Child(index)
+		if err != nil {
+			str := fmt.Sprintf("unable to derive child %d: %v", index,
+				err)
+			return nil, descriptorError(ErrInvalidIndex, str)
+		}
+	}
+	pubKey, err := extKey.ECPubKey()
+	if err != nil {
+		return nil, descriptorError(ErrInvalidKey, err.Error())
+	}
+	serialized := pubKey.SerializeCompressed()
+	if k.ctx == keyCtxXOnly {
+		serialized = serialized[1:]
+	}
+	return serialized, nil
+}
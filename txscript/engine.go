@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"math/big"
 
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
 	"github.com/ifishnet/hdfd/hdfec"
 	"github.com/ifishnet/hdfd/wire"
 )
@@ -94,6 +95,14 @@ const (
 	// operation whose public key isn't serialized in a compressed format
 	// non-standard.
 	ScriptVerifyWitnessPubKeyType
+
+	// ScriptVerifyTaproot defines whether or not to verify a transaction
+	// output using a version 1 witness program as defined by BIP0341 and
+	// BIP0342.  The sighashes passed to NewEngine must have been created
+	// with NewTxSigHashesWithPrevOuts in order to validate the signatures
+	// of taproot inputs.  This flag should never be used without the
+	// ScriptVerifyWitness flag.
+	ScriptVerifyTaproot
 )
 
 const (
@@ -116,6 +125,33 @@ const (
 // halforder is used to tame ECDSA malleability (see BIP0062).
 var halfOrder = new(big.Int).Rsh(hdfcec.S256().N, 1)
 
+// taprootExecutionCtx houses the state of the engine which is specific to the
+// validation of taproot spends.
+type taprootExecutionCtx struct {
+	// annex is the annex of the witness, if any, including its tag.
+	annex []byte
+
+	// tapscript is whether or not a tapscript of a script path spend is
+	// being executed.
+	tapscript bool
+
+	// tapLeafHash is the leaf hash of the executed tapscript.
+	tapLeafHash chainhash.Hash
+
+	// codeSepPos is the opcode position of the last executed
+	// OP_CODESEPARATOR in the tapscript.
+	codeSepPos uint32
+
+	// sigOpsBudget is the remaining signature operation budget of the
+	// tapscript.
+	sigOpsBudget int32
+
+	// mustSucceed is whether or not the spend is valid without further
+	// execution.  This is the case for validated key path spends, as well
+	// as script path spends which are reserved for future upgrades.
+	mustSucceed bool
+}
+
 // Engine is the virtual machine that executes scripts.
 type Engine struct {
 	scripts         [][]parsedOpcode
@@ -136,6 +172,10 @@ type Engine struct {
 	witnessVersion  int
 	witnessProgram  []byte
 	inputAmount     int64
+	prevOutScript   []byte
+	taprootCtx      *taprootExecutionCtx
+	batchVerifier   *BatchVerifier
+	traceFunc       TraceFunc
 }
 
 // hasFlag returns whether the script engine instance has the passed flag set.
@@ -154,6 +194,12 @@ func (vm *Engine) isBranchExecuting() bool {
 	return vm.condStack[len(vm.condStack)-1] == OpCondTrue
 }
 
+// isTapscript returns whether or not the engine is executing the tapscript of a
+// taproot script path spend.
+func (vm *Engine) isTapscript() bool {
+	return vm.taprootCtx != nil && vm.taprootCtx.tapscript
+}
+
 // executeOpcode peforms execution on the passed opcode.  It takes into account
 // whether or not it is hidden by conditionals, but some rules still must be
 // tested in this case.
@@ -173,9 +219,10 @@ func (vm *Engine) executeOpcode(pop *parsedOpcode) error {
 	}
 
 	// Note that this includes OP_RESERVED which counts as a push operation.
+	// Tapscripts are not limited in their number of operations.
 	if pop.opcode.value > OP_16 {
 		vm.numOps++
-		if vm.numOps > MaxOpsPerScript {
+		if vm.numOps > MaxOpsPerScript && !vm.isTapscript() {
 			str := fmt.Sprintf("exceeded max operation limit of %d",
 				MaxOpsPerScript)
 			return scriptError(ErrTooManyOperations, str)
@@ -329,6 +376,15 @@ func (vm *Engine) verifyWitnessProgram(witness [][]byte) error {
 				len(vm.witnessProgram))
 			return scriptError(ErrWitnessProgramWrongLength, errStr)
 		}
+	} else if vm.isWitnessVersionActive(1) &&
+		vm.hasFlag(ScriptVerifyTaproot) &&
+		len(vm.witnessProgram) == payToTaprootDataSize && !vm.bip16 {
+
+		// Only native version 1 witness programs of this size are
+		// taproot outputs.  All others remain unencumbered.
+		if err := vm.verifyTaprootWitness(witness); err != nil {
+			return err
+		}
 	} else if vm.hasFlag(ScriptVerifyDiscourageUpgradeableWitnessProgram) {
 		errStr := fmt.Sprintf("new witness program versions "+
 			"invalid: %v", vm.witnessProgram)
@@ -341,7 +397,7 @@ func (vm *Engine) verifyWitnessProgram(witness [][]byte) error {
 		vm.witnessProgram = nil
 	}
 
-	if vm.isWitnessVersionActive(0) {
+	if vm.isWitnessVersionActive(0) || vm.isTapscript() {
 		// All elements within the witness stack must not be greater
 		// than the maximum bytes which are allowed to be pushed onto
 		// the stack.
@@ -358,6 +414,184 @@ func (vm *Engine) verifyWitnessProgram(witness [][]byte) error {
 	return nil
 }
 
+// verifyTaprootWitness validates the stored taproot witness program using the
+// passed witness as input as defined by BIP0341.  Key path spends are fully
+// validated here, while the tapscript of a script path spend is set up to be
+// executed as the next script.
+func (vm *Engine) verifyTaprootWitness(witness [][]byte) error {
+	if len(witness) == 0 {
+		return scriptError(ErrWitnessProgramEmpty, "witness "+
+			"program empty passed empty witness")
+	}
+
+	// The signature operation budget of a tapscript depends on the size
+	// of the entire witness including the annex.
+	vm.taprootCtx = &taprootExecutionCtx{
+		codeSepPos: blankCodeSepValue,
+		sigOpsBudget: int32(sigOpsDelta +
+			wire.TxWitness(witness).SerializeSize()),
+	}
+
+	// When there are at least two witness elements and the last one starts
+	// with the annex tag, it is the annex and removed from the witness.
+	if len(witness) >= 2 {
+		last := witness[len(witness)-1]
+		if len(last) > 0 && last[0] == TaprootAnnexTag {
+			vm.taprootCtx.annex = last
+			witness = witness[:len(witness)-1]
+		}
+	}
+
+	// A single remaining element is the signature of a key path spend.
+	if len(witness) == 1 {
+		sig, hashType, err := parseTaprootSignature(witness[0])
+		if err != nil {
+			return err
+		}
+		hash, err := vm.calcTaprootSignatureHash(hashType)
+		if err != nil {
+			return err
+		}
+		if !vm.verifySchnorrSig(sig, hash, vm.witnessProgram) {
+			return scriptError(ErrTaprootSigInvalid,
+				"taproot key path signature is invalid")
+		}
+
+		vm.taprootCtx.mustSucceed = true
+		return nil
+	}
+
+	// Otherwise, this is a script path spend where the last two elements
+	// are the control block and the revealed script.  Ensure the script is
+	// committed to by the output key.
+	controlBlock, err := ParseControlBlock(witness[len(witness)-1])
+	if err != nil {
+		return err
+	}
+	script := witness[len(witness)-2]
+	err = VerifyTaprootLeafCommitment(controlBlock, vm.witnessProgram,
+		script)
+	if err != nil {
+		return err
+	}
+
+	// Only the tapscript leaf version is defined, so scripts with any
+	// other leaf version are left for future soft-forks and succeed.
+	if controlBlock.LeafVersion != BaseLeafVersion {
+		vm.taprootCtx.mustSucceed = true
+		return nil
+	}
+
+	// A tapscript which contains an OP_SUCCESSx opcode succeeds without
+	// being executed, even when the remainder of the script does not
+	// parse.
+	pops, err := parseScript(script)
+	for i := range pops {
+		if isOpSuccess(pops[i].opcode.value) {
+			vm.taprootCtx.mustSucceed = true
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// The initial stack of a tapscript is subject to the stack size limit.
+	stack := witness[:len(witness)-2]
+	if len(stack) > MaxStackSize {
+		str := fmt.Sprintf("initial stack size %d > max allowed %d",
+			len(stack), MaxStackSize)
+		return scriptError(ErrStackOverflow, str)
+	}
+
+	// Set the remaining witness elements as the stack and the tapscript as
+	// the next script to execute.
+	vm.taprootCtx.tapscript = true
+	vm.taprootCtx.tapLeafHash = TapLeafHash(controlBlock.LeafVersion,
+		script)
+	vm.scripts = append(vm.scripts, pops)
+	vm.SetStack(stack)
+	return nil
+}
+
+// witnessSigHashes returns the BIP0143 sighash midstate of the transaction
+// being validated.  When the engine was not provided one, it is computed on the
+// first call and then shared by every signature check performed by the engine.
+func (vm *Engine) witnessSigHashes() *TxSigHashes {
+	if vm.hashCache == nil {
+		vm.hashCache = NewTxSigHashes(&vm.tx)
+	}
+	return vm.hashCache
+}
+
+// calcTaprootSignatureHash returns the taproot signature hash of the input
+// being validated for the passed hash type, which depends on the executed
+// tapscript and the position of the last executed OP_CODESEPARATOR within it
+// for script path spends.
+func (vm *Engine) calcTaprootSignatureHash(hashType SigHashType) ([]byte, error) {
+	opts := taprootSigHashOptions{
+		annex:      vm.taprootCtx.annex,
+		codeSepPos: vm.taprootCtx.codeSepPos,
+	}
+	if vm.taprootCtx.tapscript {
+		opts.tapLeafHash = vm.taprootCtx.tapLeafHash[:]
+	}
+	prevOut := wire.TxOut{Value: vm.inputAmount, PkScript: vm.prevOutScript}
+	return calcTaprootSignatureHash(vm.hashCache, hashType, &vm.tx,
+		vm.txIdx, &prevOut, &opts)
+}
+
+// verifySchnorrSig returns whether or not the passed signature is a valid
+// BIP0340 Schnorr signature of the passed message by the passed x-only public
+// key.  The check is deferred to the batch verifier of the engine when it has
+// one.  Since an invalid Schnorr signature always fails the script, deferring it
+// does not change the execution of valid scripts.
+func (vm *Engine) verifySchnorrSig(sig, msg, pubKey []byte) bool {
+	if vm.batchVerifier != nil {
+		return vm.batchVerifier.addSchnorr(sig, msg, pubKey)
+	}
+	return verifySchnorr(sig, msg, pubKey)
+}
+
+// checkTapscriptSignature performs a signature check within a tapscript as
+// defined by BIP0342.  Any invalid non-empty signature fails the script, so the
+// returned result of the check is whether or not the signature is non-empty.
+// Signature checks with public keys of unknown types are reserved for future
+// soft-forks and succeed.
+func (vm *Engine) checkTapscriptSignature(sig, pubKey []byte) (bool, error) {
+	if len(pubKey) == 0 {
+		return false, scriptError(ErrTaprootPubKeyEmpty,
+			"tapscript signature check with empty public key")
+	}
+	if len(sig) == 0 {
+		return false, nil
+	}
+
+	vm.taprootCtx.sigOpsBudget -= sigOpsDelta
+	if vm.taprootCtx.sigOpsBudget < 0 {
+		return false, scriptError(ErrTaprootMaxSigOps,
+			"tapscript signature operation budget exceeded")
+	}
+
+	if len(pubKey) != schnorrPubKeySize {
+		return true, nil
+	}
+
+	sig, hashType, err := parseTaprootSignature(sig)
+	if err != nil {
+		return false, err
+	}
+	hash, err := vm.calcTaprootSignatureHash(hashType)
+	if err != nil {
+		return false, err
+	}
+	if !vm.verifySchnorrSig(sig, hash, pubKey) {
+		return false, scriptError(ErrTaprootSigInvalid,
+			"tapscript signature is invalid")
+	}
+	return true, nil
+}
+
 // DisasmPC returns the string for the disassembly of the opcode that will be
 // next to execute when Step() is called.
 func (vm *Engine) DisasmPC() (string, error) {
@@ -396,10 +630,18 @@ func (vm *Engine) CheckErrorCondition(finalScript bool) error {
 			"error check when script unfinished")
 	}
 
-	// If we're in version zero witness execution mode, and this was the
-	// final script, then the stack MUST be clean in order to maintain
-	// compatibility with BIP16.
-	if finalScript && vm.isWitnessVersionActive(0) && vm.dstack.Depth() != 1 {
+	// Taproot spends which succeed without further execution, such as
+	// validated key path spends, have no final stack to check.
+	if vm.taprootCtx != nil && vm.taprootCtx.mustSucceed {
+		return nil
+	}
+
+	// If we're in version zero witness or tapscript execution mode, and
+	// this was the final script, then the stack MUST be clean in order to
+	// maintain compatibility with BIP16.
+	if finalScript && (vm.isWitnessVersionActive(0) || vm.isTapscript()) &&
+		vm.dstack.Depth() != 1 {
+
 		return scriptError(ErrEvalFalse, "witness program must "+
 			"have clean stack")
 	}
@@ -445,13 +687,16 @@ func (vm *Engine) Step() (done bool, err error) {
 	if err != nil {
 		return true, err
 	}
+	scriptIdx, opcodeIdx := vm.scriptIdx, vm.scriptOff
 	opcode := &vm.scripts[vm.scriptIdx][vm.scriptOff]
+	executed := vm.isBranchExecuting()
 	vm.scriptOff++
 
 	// Execute the opcode while taking into account several things such as
 	// disabled opcodes, illegal opcodes, maximum allowed operations per
 	// script, maximum script element sizes, and conditionals.
 	err = vm.executeOpcode(opcode)
+	vm.traceStep(scriptIdx, opcodeIdx, opcode, executed, err)
 	if err != nil {
 		return true, err
 	}
@@ -849,6 +1094,16 @@ func (vm *Engine) SetAltStack(data [][]byte) {
 	setStack(&vm.astack, data)
 }
 
+// SetBatchVerifier sets the batch verifier the engine defers its signature
+// checks to.  The BIP0340 Schnorr signature checks of taproot spends are
+// deferred and treated as successful, so a successful execution is only
+// conclusive once the batch verifier verified the deferred signatures.  ECDSA
+// signature checks are not affected.  See BatchVerifier for details.  It must
+// be called before the scripts are executed.
+func (vm *Engine) SetBatchVerifier(batchVerifier *BatchVerifier) {
+	vm.batchVerifier = batchVerifier
+}
+
 // NewEngine returns a new script engine for the provided public key script,
 // transaction, and input index.  The flags modify the behavior of the script
 // engine according to the description provided by each flag.
@@ -883,13 +1138,21 @@ func NewEngine(scriptPubKey []byte, tx *wire.MsgTx, txIdx int, flags ScriptFlags
 	// when it should be. The same goes for segwit which will pull in
 	// additional scripts for execution from the witness stack.
 	vm := Engine{flags: flags, sigCache: sigCache, hashCache: hashCache,
-		inputAmount: inputAmount}
+		inputAmount: inputAmount, prevOutScript: scriptPubKey}
 	if vm.hasFlag(ScriptVerifyCleanStack) && (!vm.hasFlag(ScriptBip16) &&
 		!vm.hasFlag(ScriptVerifyWitness)) {
 		return nil, scriptError(ErrInvalidFlags,
 			"invalid flags combination")
 	}
 
+	// The taproot flag (ScriptVerifyTaproot) is not allowed without the
+	// Segregated Witness (ScriptVerifyWitness) flag since taproot outputs
+	// are witness programs.
+	if vm.hasFlag(ScriptVerifyTaproot) && !vm.hasFlag(ScriptVerifyWitness) {
+		return nil, scriptError(ErrInvalidFlags,
+			"invalid flags combination")
+	}
+
 	// The signature script must only contain data pushes when the
 	// associated flag is set.
 	if vm.hasFlag(ScriptVerifySigPushOnly) && !IsPushOnlyScript(scriptSig) {
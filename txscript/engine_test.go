@@ -152,6 +152,7 @@ func TestInvalidFlagCombinations(t *testing.T) {
 
 	tests := []ScriptFlags{
 		ScriptVerifyCleanStack,
+		ScriptBip16 | ScriptVerifyTaproot,
 	}
 
 	// tx with almost empty scripts.
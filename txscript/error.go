@@ -47,6 +47,25 @@ const (
 	// the provided data exceeds MaxDataCarrierSize.
 	ErrTooMuchNullData
 
+	// ErrUnsupportedScriptTemplate is returned from SpendSigOpCost and
+	// MaxSatisfactionSize when the provided scripts do not form a template
+	// which can be statically analyzed.
+	ErrUnsupportedScriptTemplate
+
+	// ErrMissingPrevOuts is returned when a taproot signature hash is
+	// calculated without the outputs spent by the transaction, which it
+	// commits to.
+	ErrMissingPrevOuts
+
+	// ErrInvalidPsbtInput is returned from SignPsbtInput and
+	// FinalizePsbtInput when the input lacks the spent output or the
+	// scripts it commits to, or when they do not match.
+	ErrInvalidPsbtInput
+
+	// ErrIncompletePsbtInput is returned from FinalizePsbtInput when the
+	// input does not have enough partial signatures to be spent.
+	ErrIncompletePsbtInput
+
 	// ------------------------------------------
 	// Failures related to final execution state.
 	// ------------------------------------------
@@ -338,6 +357,55 @@ const (
 	// serialized in a compressed format.
 	ErrWitnessPubKeyType
 
+	// ----------------------------
+	// Failures related to taproot.
+	// ----------------------------
+
+	// ErrTaprootSigInvalid is returned if ScriptVerifyTaproot is set and a
+	// non-empty Schnorr signature of a taproot spend fails to verify.
+	ErrTaprootSigInvalid
+
+	// ErrInvalidTaprootSigLen is returned if ScriptVerifyTaproot is set and
+	// a taproot signature is neither 64 bytes nor 65 bytes with an explicit
+	// hash type other than SigHashDefault.
+	ErrInvalidTaprootSigLen
+
+	// ErrTaprootPubKeyInvalid is returned if ScriptVerifyTaproot is set and
+	// the internal key of a control block is not a valid x-only public key
+	// or can't be tweaked into a valid output key.
+	ErrTaprootPubKeyInvalid
+
+	// ErrTaprootPubKeyEmpty is returned if ScriptVerifyTaproot is set and
+	// a signature check within a tapscript is executed with an empty
+	// public key.
+	ErrTaprootPubKeyEmpty
+
+	// ErrControlBlockInvalidLength is returned if ScriptVerifyTaproot is
+	// set and the size of the control block of a script path spend is not
+	// 33 bytes plus a multiple of 32 bytes up to the maximum depth of the
+	// script tree.
+	ErrControlBlockInvalidLength
+
+	// ErrTaprootMerkleProofInvalid is returned if ScriptVerifyTaproot is
+	// set and the revealed script of a script path spend is not committed
+	// to by the output key according to its control block.
+	ErrTaprootMerkleProofInvalid
+
+	// ErrTaprootOutputKeyParityMismatch is returned if ScriptVerifyTaproot
+	// is set and the parity of the output key indicated by the control
+	// block of a script path spend is incorrect.
+	ErrTaprootOutputKeyParityMismatch
+
+	// ErrTaprootMaxSigOps is returned if ScriptVerifyTaproot is set and
+	// the signature checks executed by a tapscript exceed its signature
+	// operation budget.
+	ErrTaprootMaxSigOps
+
+	// ErrTapscriptCheckMultisig is returned if ScriptVerifyTaproot is set
+	// and OP_CHECKMULTISIG or OP_CHECKMULTISIGVERIFY is executed within a
+	// tapscript.
+	ErrTapscriptCheckMultisig
+
 	// numErrorCodes is the maximum error code number used in tests.  This
 	// entry MUST be the last entry in the enum.
 	numErrorCodes
@@ -352,6 +420,7 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrNotMultisigScript:                  "ErrNotMultisigScript",
 	ErrTooManyRequiredSigs:                "ErrTooManyRequiredSigs",
 	ErrTooMuchNullData:                    "ErrTooMuchNullData",
+	ErrUnsupportedScriptTemplate:          "ErrUnsupportedScriptTemplate",
 	ErrEarlyReturn:                        "ErrEarlyReturn",
 	ErrEmptyStack:                         "ErrEmptyStack",
 	ErrEvalFalse:                          "ErrEvalFalse",
@@ -409,6 +478,18 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrMinimalIf:                          "ErrMinimalIf",
 	ErrWitnessPubKeyType:                  "ErrWitnessPubKeyType",
 	ErrDiscourageUpgradableWitnessProgram: "ErrDiscourageUpgradableWitnessProgram",
+	ErrMissingPrevOuts:                    "ErrMissingPrevOuts",
+	ErrInvalidPsbtInput:                   "ErrInvalidPsbtInput",
+	ErrIncompletePsbtInput:                "ErrIncompletePsbtInput",
+	ErrTaprootSigInvalid:                  "ErrTaprootSigInvalid",
+	ErrInvalidTaprootSigLen:               "ErrInvalidTaprootSigLen",
+	ErrTaprootPubKeyInvalid:               "ErrTaprootPubKeyInvalid",
+	ErrTaprootPubKeyEmpty:                 "ErrTaprootPubKeyEmpty",
+	ErrControlBlockInvalidLength:          "ErrControlBlockInvalidLength",
+	ErrTaprootMerkleProofInvalid:          "ErrTaprootMerkleProofInvalid",
+	ErrTaprootOutputKeyParityMismatch:     "ErrTaprootOutputKeyParityMismatch",
+	ErrTaprootMaxSigOps:                   "ErrTaprootMaxSigOps",
+	ErrTapscriptCheckMultisig:             "ErrTapscriptCheckMultisig",
 }
 
 // String returns the ErrorCode as a human-readable name.
@@ -22,6 +22,7 @@ func TestErrorCodeStringer(t *testing.T) {
 		{ErrUnsupportedAddress, "ErrUnsupportedAddress"},
 		{ErrTooManyRequiredSigs, "ErrTooManyRequiredSigs"},
 		{ErrTooMuchNullData, "ErrTooMuchNullData"},
+		{ErrUnsupportedScriptTemplate, "ErrUnsupportedScriptTemplate"},
 		{ErrNotMultisigScript, "ErrNotMultisigScript"},
 		{ErrEarlyReturn, "ErrEarlyReturn"},
 		{ErrEmptyStack, "ErrEmptyStack"},
@@ -80,6 +81,18 @@ func TestErrorCodeStringer(t *testing.T) {
 		{ErrMinimalIf, "ErrMinimalIf"},
 		{ErrWitnessPubKeyType, "ErrWitnessPubKeyType"},
 		{ErrDiscourageUpgradableWitnessProgram, "ErrDiscourageUpgradableWitnessProgram"},
+		{ErrMissingPrevOuts, "ErrMissingPrevOuts"},
+		{ErrInvalidPsbtInput, "ErrInvalidPsbtInput"},
+		{ErrIncompletePsbtInput, "ErrIncompletePsbtInput"},
+		{ErrTaprootSigInvalid, "ErrTaprootSigInvalid"},
+		{ErrInvalidTaprootSigLen, "ErrInvalidTaprootSigLen"},
+		{ErrTaprootPubKeyInvalid, "ErrTaprootPubKeyInvalid"},
+		{ErrTaprootPubKeyEmpty, "ErrTaprootPubKeyEmpty"},
+		{ErrControlBlockInvalidLength, "ErrControlBlockInvalidLength"},
+		{ErrTaprootMerkleProofInvalid, "ErrTaprootMerkleProofInvalid"},
+		{ErrTaprootOutputKeyParityMismatch, "ErrTaprootOutputKeyParityMismatch"},
+		{ErrTaprootMaxSigOps, "ErrTaprootMaxSigOps"},
+		{ErrTapscriptCheckMultisig, "ErrTapscriptCheckMultisig"},
 		{0xffff, "Unknown ErrorCode (65535)"},
 	}
 
@@ -11,14 +11,48 @@ import (
 	"github.com/ifishnet/hdfd/wire"
 )
 
+// PrevOutputFetcher is an interface used to supply the outputs spent by the
+// inputs of a transaction, which are committed to by the taproot signature
+// hashes introduced within BIP0341.
+type PrevOutputFetcher interface {
+	// FetchPrevOutput returns the output referenced by the passed
+	// outpoint, or nil when it is unknown.
+	FetchPrevOutput(wire.OutPoint) *wire.TxOut
+}
+
+// MultiPrevOutFetcher is a PrevOutputFetcher backed by a map of the spent
+// outputs keyed by their outpoints.
+type MultiPrevOutFetcher map[wire.OutPoint]*wire.TxOut
+
+// FetchPrevOutput returns the output referenced by the passed outpoint, or nil
+// when it is not in the map.
+//
+// This is part of the PrevOutputFetcher interface.
+func (m MultiPrevOutFetcher) FetchPrevOutput(op wire.OutPoint) *wire.TxOut {
+	return m[op]
+}
+
 // TxSigHashes houses the partial set of sighashes introduced within BIP0143.
 // This partial set of sighashes may be re-used within each input across a
 // transaction when validating all inputs. As a result, validation complexity
 // for SigHashAll can be reduced by a polynomial factor.
+//
+// When created with NewTxSigHashesWithPrevOuts, it additionally houses the
+// partial set of sighashes introduced within BIP0341 which are required to
+// validate taproot inputs.
 type TxSigHashes struct {
 	HashPrevOuts chainhash.Hash
 	HashSequence chainhash.Hash
 	HashOutputs  chainhash.Hash
+
+	// The following are the single SHA256 partial sighashes introduced
+	// within BIP0341.  They are only set when HasV1Hashes is true.
+	HashPrevOutsV1      chainhash.Hash
+	HashSequenceV1      chainhash.Hash
+	HashOutputsV1       chainhash.Hash
+	HashAmountsV1       chainhash.Hash
+	HashScriptPubKeysV1 chainhash.Hash
+	HasV1Hashes         bool
 }
 
 // NewTxSigHashes computes, and returns the cached sighashes of the given
@@ -31,6 +65,35 @@ func NewTxSigHashes(tx *wire.MsgTx) *TxSigHashes {
 	}
 }
 
+// NewTxSigHashesWithPrevOuts computes, and returns the cached sighashes of the
+// given transaction including those which commit to the outputs it spends.  The
+// previous output fetcher must provide all of the outputs spent by the
+// transaction.
+func NewTxSigHashesWithPrevOuts(tx *wire.MsgTx,
+	prevOuts PrevOutputFetcher) (*TxSigHashes, error) {
+
+	hashAmounts, hashScriptPubKeys, err := calcHashSpentOutputsV1(tx,
+		prevOuts)
+	if err != nil {
+		return nil, err
+	}
+
+	// The BIP0143 sighashes are the double SHA256 of the same data, so
+	// they are derived from the single SHA256 ones.
+	h := TxSigHashes{
+		HashPrevOutsV1:      calcHashPrevOutsV1(tx),
+		HashSequenceV1:      calcHashSequenceV1(tx),
+		HashOutputsV1:       calcHashOutputsV1(tx),
+		HashAmountsV1:       hashAmounts,
+		HashScriptPubKeysV1: hashScriptPubKeys,
+		HasV1Hashes:         true,
+	}
+	h.HashPrevOuts = chainhash.HashH(h.HashPrevOutsV1[:])
+	h.HashSequence = chainhash.HashH(h.HashSequenceV1[:])
+	h.HashOutputs = chainhash.HashH(h.HashOutputsV1[:])
+	return &h, nil
+}
+
 // HashCache houses a set of partial sighashes keyed by txid. The set of partial
 // sighashes are those introduced within BIP0143 by the new more efficient
 // sighash digest calculation algorithm. Using this threadsafe shared cache,
@@ -58,6 +121,32 @@ func (h *HashCache) AddSigHashes(tx *wire.MsgTx) {
 	h.Unlock()
 }
 
+// GetOrAddSigHashes returns the cached partial sighashes for the passed
+// transaction, computing and adding them to the HashCache first when they are
+// not already present.  Unlike a separate ContainsHashes and AddSigHashes pair,
+// concurrent callers for the same transaction are all handed the same
+// instance.
+func (h *HashCache) GetOrAddSigHashes(tx *wire.MsgTx) *TxSigHashes {
+	txid := tx.TxHash()
+	h.RLock()
+	item, found := h.sigHashes[txid]
+	h.RUnlock()
+	if found {
+		return item
+	}
+
+	sigHashes := NewTxSigHashes(tx)
+	h.Lock()
+	if item, found := h.sigHashes[txid]; found {
+		h.Unlock()
+		return item
+	}
+	h.sigHashes[txid] = sigHashes
+	h.Unlock()
+
+	return sigHashes
+}
+
 // ContainsHashes returns true if the partial sighashes for the passed
 // transaction currently exist within the HashCache, and false otherwise.
 func (h *HashCache) ContainsHashes(txid *chainhash.Hash) bool {
@@ -6,6 +6,7 @@ package txscript
 
 import (
 	"math/rand"
+	"reflect"
 	"testing"
 	"time"
 
@@ -180,3 +181,33 @@ func TestHashCachePurge(t *testing.T) {
 		}
 	}
 }
+
+// TestHashCacheGetOrAddSigHashes tests that GetOrAddSigHashes adds the partial
+// sighashes of transactions not yet in the hash cache and hands back the same
+// instance on subsequent calls.
+func TestHashCacheGetOrAddSigHashes(t *testing.T) {
+	t.Parallel()
+
+	rand.Seed(time.Now().Unix())
+
+	cache := NewHashCache(10)
+
+	tx, err := genTestTx()
+	if err != nil {
+		t.Fatalf("unable to generate test tx: %v", err)
+	}
+	txid := tx.TxHash()
+
+	sigHashes := cache.GetOrAddSigHashes(tx)
+	if !reflect.DeepEqual(sigHashes, NewTxSigHashes(tx)) {
+		t.Fatalf("partial sighashes don't match: got %v, want %v",
+			spew.Sdump(sigHashes), spew.Sdump(NewTxSigHashes(tx)))
+	}
+	if ok := cache.ContainsHashes(&txid); !ok {
+		t.Fatalf("tx %v wasn't added to the cache", txid)
+	}
+
+	if cache.GetOrAddSigHashes(tx) != sigHashes {
+		t.Fatalf("second call for tx %v returned a new instance", txid)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package scriptexpr provides the tokenizing shared by the parsers of the
+// textual script languages of the txscript packages, such as output
+// descriptors and miniscript, whose expressions are nested function calls of
+// the form name(arg,arg,...).
+package scriptexpr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SplitFunc splits the passed expression of the form name(args) into the name
+// and the arguments.  False is returned when the expression is not of that
+// form.
+func SplitFunc(s string) (string, string, bool) {
+	open := strings.IndexByte(s, '(')
+	if open == -1 || !strings.HasSuffix(s, ")") {
+		return "", "", false
+	}
+	return s[:open], s[open+1 : len(s)-1], true
+}
+
+// SplitArgs splits the passed arguments at the commas which are not nested in
+// parentheses, brackets, or braces.  An error which describes the problem is
+// returned when they are unbalanced.
+func SplitArgs(s string) ([]string, error) {
+	var args []string
+	var depth, start int
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced %q in %q", s[i], s)
+			}
+		case ',':
+			if depth == 0 {
+				args = append(args, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced parentheses in %q", s)
+	}
+	return append(args, s[start:]), nil
+}
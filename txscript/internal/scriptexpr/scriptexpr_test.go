@@ -0,0 +1,74 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package scriptexpr
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestSplitFunc ensures expressions are split into their name and arguments
+// and that malformed expressions are rejected.
+func TestSplitFunc(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr string
+		name string
+		args string
+		ok   bool
+	}{
+		{"pk(A)", "pk", "A", true},
+		{"wsh(and_v(v:pk(A),older(1)))", "wsh", "and_v(v:pk(A),older(1))", true},
+		{"f()", "f", "", true},
+		{"pk", "", "", false},
+		{"pk(A", "", "", false},
+		{"pkA)", "", "", false},
+	}
+
+	for _, test := range tests {
+		name, args, ok := SplitFunc(test.expr)
+		if name != test.name || args != test.args || ok != test.ok {
+			t.Errorf("SplitFunc(%q): got (%q, %q, %v), want "+
+				"(%q, %q, %v)", test.expr, name, args, ok,
+				test.name, test.args, test.ok)
+		}
+	}
+}
+
+// TestSplitArgs ensures arguments are only split at commas which are not
+// nested and that unbalanced arguments are rejected.
+func TestSplitArgs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		args  string
+		split []string
+		valid bool
+	}{
+		{"", []string{""}, true},
+		{"A", []string{"A"}, true},
+		{"2,A,B", []string{"2", "A", "B"}, true},
+		{"or_b(pk(A),s:pk(B)),C", []string{"or_b(pk(A),s:pk(B))", "C"}, true},
+		{"[d34db33f/1,2]A,B", []string{"[d34db33f/1,2]A", "B"}, true},
+		{"A,{pk(B),pk(C)}", []string{"A", "{pk(B),pk(C)}"}, true},
+		{"pk(A))", nil, false},
+		{"pk(A", nil, false},
+		{"A]", nil, false},
+	}
+
+	for _, test := range tests {
+		split, err := SplitArgs(test.args)
+		if (err == nil) != test.valid {
+			t.Errorf("SplitArgs(%q): unexpected error: %v", test.args,
+				err)
+			continue
+		}
+		if !reflect.DeepEqual(split, test.split) {
+			t.Errorf("SplitArgs(%q): got %q, want %q", test.args,
+				split, test.split)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package miniscript
+
+import (
+	"fmt"
+
+	"github.com/ifishnet/hdfd/txscript"
+)
+
+const (
+	// MaxStandardScriptSize is the maximum size of a witness script which
+	// is relayed by default.
+	MaxStandardScriptSize = 3600
+
+	// MaxStandardWitnessItems is the maximum number of witness stack items,
+	// excluding the witness script, which is relayed by default.
+	MaxStandardWitnessItems = 100
+
+	// maxSignatureSize is the maximum size of a DER-encoded signature with
+	// the hash type appended.
+	maxSignatureSize = 72 + 1
+)
+
+// stackSize is the number of items and the serialized size of a witness stack.
+// The serialized size includes the length prefix of every item.
+type stackSize struct {
+	items int
+	size  int
+	ok    bool
+}
+
+// Sizes of the witness stacks of single items.
+var (
+	noStack    = stackSize{}
+	emptyStack = stackSize{ok: true}
+	zeroItem   = stackSize{items: 1, size: 1, ok: true}
+	oneItem    = stackSize{items: 1, size: 2, ok: true}
+	sigItem    = stackSize{items: 1, size: 1 + maxSignatureSize, ok: true}
+	keyItem    = stackSize{items: 1, size: 1 + 33, ok: true}
+	hashItem   = stackSize{items: 1, size: 1 + preimageSize, ok: true}
+)
+
+// plus returns the size of the concatenation of the passed witness stacks,
+// which is only possible when both are.
+func (s stackSize) plus(o stackSize) stackSize {
+	if !s.ok || !o.ok {
+		return noStack
+	}
+	return stackSize{items: s.items + o.items, size: s.size + o.size, ok: true}
+}
+
+// or returns an upper bound of the sizes of the passed alternative witness
+// stacks.
+func (s stackSize) or(o stackSize) stackSize {
+	switch {
+	case !s.ok:
+		return o
+	case !o.ok:
+		return s
+	}
+	if o.items > s.items {
+		s.items = o.items
+	}
+	if o.size > s.size {
+		s.size = o.size
+	}
+	return s
+}
+
+// maxStackSizes returns upper bounds of the sizes of the witness stacks which
+// satisfy and dissatisfy the node.
+func (n *Node) maxStackSizes() (stackSize, stackSize) {
+	var xSat, xDsat, ySat, yDsat, zSat, zDsat stackSize
+	if len(n.subs) > 0 {
+		xSat, xDsat = n.subs[0].maxStackSizes()
+	}
+	if len(n.subs) > 1 {
+		ySat, yDsat = n.subs[1].maxStackSizes()
+	}
+	if len(n.subs) > 2 {
+		zSat, zDsat = n.subs[2].maxStackSizes()
+	}
+
+	switch n.frag {
+	case frag0:
+		return noStack, emptyStack
+	case frag1:
+		return emptyStack, noStack
+	case fragPkK:
+		return sigItem, zeroItem
+	case fragPkH:
+		return sigItem.plus(keyItem), zeroItem.plus(keyItem)
+	case fragOlder, fragAfter:
+		return emptyStack, noStack
+	case fragSha256, fragHash256, fragRipemd160, fragHash160:
+		return hashItem, hashItem
+	case fragAndOr:
+		return ySat.plus(xSat).or(zSat.plus(xDsat)), zDsat.plus(xDsat)
+	case fragAndV:
+		return ySat.plus(xSat), yDsat.plus(xSat)
+	case fragAndB:
+		return ySat.plus(xSat), yDsat.plus(xDsat).or(ySat.plus(xDsat)).
+			or(yDsat.plus(xSat))
+	case fragOrB:
+		return yDsat.plus(xSat).or(ySat.plus(xDsat)).or(ySat.plus(xSat)),
+			yDsat.plus(xDsat)
+	case fragOrC:
+		return xSat.or(ySat.plus(xDsat)), noStack
+	case fragOrD:
+		return xSat.or(ySat.plus(xDsat)), yDsat.plus(xDsat)
+	case fragOrI:
+		return xSat.plus(oneItem).or(ySat.plus(zeroItem)),
+			xDsat.plus(oneItem).or(yDsat.plus(zeroItem))
+	case fragThresh:
+		// Track the largest stacks for every number of satisfied
+		// arguments.
+		sizes := []stackSize{emptyStack}
+		for _, sub := range n.subs {
+			sat, dsat := sub.maxStackSizes()
+			next := make([]stackSize, len(sizes)+1)
+			for j := range next {
+				next[j] = noStack
+				if j < len(sizes) {
+					next[j] = sizes[j].plus(dsat)
+				}
+				if j > 0 {
+					next[j] = next[j].or(sizes[j-1].plus(sat))
+				}
+			}
+			sizes = next
+		}
+		dsat := noStack
+		for j, size := range sizes {
+			if j != int(n.k) {
+				dsat = dsat.or(size)
+			}
+		}
+		return sizes[n.k], dsat
+	case fragMulti:
+		sat := stackSize{
+			items: int(n.k) + 1,
+			size:  1 + int(n.k)*(1+maxSignatureSize),
+			ok:    true,
+		}
+		dsat := stackSize{items: int(n.k) + 1, size: int(n.k) + 1, ok: true}
+		return sat, dsat
+	case fragWrapA, fragWrapS, fragWrapC, fragWrapN:
+		return xSat, xDsat
+	case fragWrapD:
+		return xSat.plus(oneItem), zeroItem
+	case fragWrapV:
+		return xSat, noStack
+	case fragWrapJ:
+		return xSat, zeroItem
+	}
+	return noStack, noStack
+}
+
+// ScriptSize returns the size of the witness script the expression compiles to.
+func (n *Node) ScriptSize() int {
+	return len(n.Script())
+}
+
+// MaxOps returns an upper bound of the number of non-push operations executing
+// the witness script counts towards the limit of txscript.MaxOpsPerScript.
+// Every key of a multi fragment is counted as if it was executed.
+func (n *Node) MaxOps() int {
+	var ops int
+	script := n.Script()
+	for i := 0; i < len(script); i++ {
+		op := script[i]
+		switch {
+		case op >= txscript.OP_DATA_1 && op <= txscript.OP_DATA_75:
+			// The expression only compiles to direct pushes.
+			i += int(op)
+		case op > txscript.OP_16:
+			ops++
+		}
+	}
+	return ops + n.multiSigKeys()
+}
+
+// multiSigKeys returns the total number of keys of the multi fragments in the
+// expression.
+func (n *Node) multiSigKeys() int {
+	keys := 0
+	if n.frag == fragMulti {
+		keys = len(n.keys)
+	}
+	for _, sub := range n.subs {
+		keys += sub.multiSigKeys()
+	}
+	return keys
+}
+
+// MaxWitnessItems returns an upper bound of the number of witness stack items,
+// excluding the witness script, of a satisfaction of the expression.  It is
+// zero when the expression can't be satisfied.
+func (n *Node) MaxWitnessItems() int {
+	sat, _ := n.maxStackSizes()
+	return sat.items
+}
+
+// MaxWitnessSize returns an upper bound of the serialized size of the witness
+// stack items, excluding the witness script, of a satisfaction of the
+// expression.  The size includes the length prefix of every item, but not the
+// number of items.  It is zero when the expression can't be satisfied.
+func (n *Node) MaxWitnessSize() int {
+	sat, _ := n.maxStackSizes()
+	return sat.size
+}
+
+// IsNonMalleable returns whether or not the expression has a non-malleable
+// satisfaction for every combination of available signatures, preimages, and
+// timelocks which allows satisfying it.
+func (n *Node) IsNonMalleable() bool {
+	return n.typ.has(propM)
+}
+
+// RequiresSig returns whether or not every satisfaction of the expression
+// requires a signature, which prevents third parties from spending it.
+func (n *Node) RequiresSig() bool {
+	return n.typ.has(propS)
+}
+
+// HasTimelockMix returns whether or not the expression may require both a
+// height-based and a time-based timelock of the same kind in a single spend,
+// which can't be satisfied.
+func (n *Node) HasTimelockMix() bool {
+	return !n.typ.has(propK)
+}
+
+// CheckSanity returns an error when the expression is not safe to use as the
+// witness script of an output.  That is the case when its script or the
+// witness stacks of its satisfactions exceed the consensus or standardness
+// limits, when it can be satisfied without a signature, when it has malleable
+// satisfactions, or when it mixes timelocks of different units.
+func (n *Node) CheckSanity() error {
+	if size := n.ScriptSize(); size > MaxStandardScriptSize {
+		str := fmt.Sprintf("script size %d exceeds the max standard size "+
+			"%d", size, MaxStandardScriptSize)
+		return miniscriptError(ErrScriptTooBig, str)
+	}
+	if ops := n.MaxOps(); ops > txscript.MaxOpsPerScript {
+		str := fmt.Sprintf("script may execute %d operations, more than "+
+			"the max allowed %d", ops, txscript.MaxOpsPerScript)
+		return miniscriptError(ErrTooManyOps, str)
+	}
+	if items := n.MaxWitnessItems(); items > MaxStandardWitnessItems {
+		str := fmt.Sprintf("satisfaction may need %d witness stack "+
+			"items, more than the max standard %d", items,
+			MaxStandardWitnessItems)
+		return miniscriptError(ErrTooManyWitnessItems, str)
+	}
+	if !n.RequiresSig() {
+		str := "script can be satisfied without a signature"
+		return miniscriptError(ErrSigNotRequired, str)
+	}
+	if !n.IsNonMalleable() {
+		str := "script does not always have a non-malleable satisfaction"
+		return miniscriptError(ErrMalleable, str)
+	}
+	if n.HasTimelockMix() {
+		str := "script mixes height-based and time-based timelocks"
+		return miniscriptError(ErrTimelockMix, str)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package miniscript implements parsing, analysis, and satisfaction of miniscript
+expressions for pay-to-witness-script-hash witness scripts.
+
+Miniscript, as defined by BIP0379, is a language for writing a subset of
+bitcoin scripts in a structured way.  The structure allows tools to analyze the
+spending conditions of a script, its resource usage, and whether it can be
+malleated, and to produce witnesses which satisfy it without knowing anything
+about the script other than its expression.
+
+Fragments and Wrappers
+
+All fragments of BIP0379 which are valid in witness scripts are supported:
+0, 1, pk_k, pk_h, older, after, sha256, hash256, ripemd160, hash160, andor,
+and_v, and_b, or_b, or_c, or_d, or_i, thresh, and multi, as well as the a, s,
+c, d, v, j, and n wrappers.  The pk, pkh, and and_n fragments and the t, l, and
+u wrappers are accepted as shorthands and used when printing expressions.
+Keys are hex-encoded compressed public keys.
+
+Type Checking and Analysis
+
+Parse type-checks expressions according to the type system of BIP0379 and
+rejects those which are not valid or not of the base type B.  A valid
+expression may still be unsafe to use, for instance because it can be spent
+without a signature or because third parties can malleate its witnesses.
+CheckSanity rejects those as well as expressions which exceed the consensus or
+standardness limits on the script size, the number of operations, or the number
+of witness stack items.  The individual properties and resource bounds are
+available through methods such as RequiresSig, IsNonMalleable, MaxOps, and
+MaxWitnessSize.
+
+Satisfaction
+
+Satisfy produces the witness stack items which satisfy an expression given a
+Satisfier, which provides the signatures, hash preimages, and timelock
+information of a spending transaction.  Among the ways to satisfy an
+expression with what is available, it chooses the smallest one third parties
+can't malleate.
+
+Errors
+
+Errors returned by this package are of type miniscript.Error, which contains
+an ErrorCode field to programmatically identify the reason for the failure.
+*/
+package miniscript
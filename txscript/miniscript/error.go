@@ -0,0 +1,135 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package miniscript
+
+import (
+	"fmt"
+)
+
+// ErrorCode identifies a kind of miniscript error.
+type ErrorCode int
+
+// These constants are used to identify a specific Error.
+const (
+	// ErrInvalidSyntax is returned when an expression does not follow the
+	// miniscript grammar, such as unbalanced parentheses, an unknown
+	// wrapper, or a wrong number of arguments.
+	ErrInvalidSyntax ErrorCode = iota
+
+	// ErrUnknownFragment is returned when an expression uses a fragment
+	// which does not exist.
+	ErrUnknownFragment
+
+	// ErrInvalidKey is returned when a key is not a hex-encoded compressed
+	// public key.
+	ErrInvalidKey
+
+	// ErrInvalidHash is returned when the hash of a hash fragment is not
+	// hex or does not have the length of its hash function.
+	ErrInvalidHash
+
+	// ErrInvalidTimelock is returned when the argument of older or after is
+	// not between 1 and 2^31-1.
+	ErrInvalidTimelock
+
+	// ErrInvalidThreshold is returned when the threshold of thresh or multi
+	// is not between one and the number of its arguments, or when multi
+	// has too many keys.
+	ErrInvalidThreshold
+
+	// ErrTypeCheck is returned when the argument of a fragment or wrapper
+	// does not have a type it requires, or when the top-level expression
+	// is not of the base type B.
+	ErrTypeCheck
+
+	// ErrScriptTooBig is returned by CheckSanity when the script exceeds
+	// the maximum standard size of a witness script.
+	ErrScriptTooBig
+
+	// ErrTooManyOps is returned by CheckSanity when the script may execute
+	// more non-push operations than allowed.
+	ErrTooManyOps
+
+	// ErrTooManyWitnessItems is returned by CheckSanity when a satisfaction
+	// may need more witness stack items than standard.
+	ErrTooManyWitnessItems
+
+	// ErrMalleable is returned by CheckSanity when the script does not
+	// always have a non-malleable satisfaction.
+	ErrMalleable
+
+	// ErrSigNotRequired is returned by CheckSanity when the script can be
+	// satisfied without a signature.
+	ErrSigNotRequired
+
+	// ErrTimelockMix is returned by CheckSanity when the script requires
+	// both a height-based and a time-based timelock of the same kind to be
+	// satisfied in a single spend.
+	ErrTimelockMix
+
+	// ErrUnsatisfiable is returned by Satisfy when the available
+	// signatures, preimages, and timelocks are not enough to satisfy the
+	// script.
+	ErrUnsatisfiable
+
+	// ErrMalleableSatisfaction is returned by Satisfy when the only
+	// satisfaction which can be produced is malleable.
+	ErrMalleableSatisfaction
+
+	// numErrorCodes is the maximum error code number used in tests.
+	numErrorCodes
+)
+
+// Map of ErrorCode values back to their constant names for pretty printing.
+var errorCodeStrings = map[ErrorCode]string{
+	ErrInvalidSyntax:         "ErrInvalidSyntax",
+	ErrUnknownFragment:       "ErrUnknownFragment",
+	ErrInvalidKey:            "ErrInvalidKey",
+	ErrInvalidHash:           "ErrInvalidHash",
+	ErrInvalidTimelock:       "ErrInvalidTimelock",
+	ErrInvalidThreshold:      "ErrInvalidThreshold",
+	ErrTypeCheck:             "ErrTypeCheck",
+	ErrScriptTooBig:          "ErrScriptTooBig",
+	ErrTooManyOps:            "ErrTooManyOps",
+	ErrTooManyWitnessItems:   "ErrTooManyWitnessItems",
+	ErrMalleable:             "ErrMalleable",
+	ErrSigNotRequired:        "ErrSigNotRequired",
+	ErrTimelockMix:           "ErrTimelockMix",
+	ErrUnsatisfiable:         "ErrUnsatisfiable",
+	ErrMalleableSatisfaction: "ErrMalleableSatisfaction",
+}
+
+// String returns the ErrorCode as a human-readable name.
+func (e ErrorCode) String() string {
+	if s := errorCodeStrings[e]; s != "" {
+		return s
+	}
+	return fmt.Sprintf("Unknown ErrorCode (%d)", int(e))
+}
+
+// Error identifies a miniscript-related error.  The caller can use type
+// assertions to access the ErrorCode field to ascertain the specific reason for
+// the failure.
+type Error struct {
+	ErrorCode   ErrorCode
+	Description string
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e Error) Error() string {
+	return e.Description
+}
+
+// miniscriptError creates an Error given a set of arguments.
+func miniscriptError(c ErrorCode, desc string) Error {
+	return Error{ErrorCode: c, Description: desc}
+}
+
+// IsErrorCode returns whether or not the provided error is a miniscript error
+// with the provided error code.
+func IsErrorCode(err error, c ErrorCode) bool {
+	merr, ok := err.(Error)
+	return ok && merr.ErrorCode == c
+}
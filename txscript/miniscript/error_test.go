@@ -0,0 +1,81 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package miniscript
+
+import (
+	"testing"
+)
+
+// TestErrorCodeStringer tests the stringized output for the ErrorCode type.
+func TestErrorCodeStringer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in   ErrorCode
+		want string
+	}{
+		{ErrInvalidSyntax, "ErrInvalidSyntax"},
+		{ErrUnknownFragment, "ErrUnknownFragment"},
+		{ErrInvalidKey, "ErrInvalidKey"},
+		{ErrInvalidHash, "ErrInvalidHash"},
+		{ErrInvalidTimelock, "ErrInvalidTimelock"},
+		{ErrInvalidThreshold, "ErrInvalidThreshold"},
+		{ErrTypeCheck, "ErrTypeCheck"},
+		{ErrScriptTooBig, "ErrScriptTooBig"},
+		{ErrTooManyOps, "ErrTooManyOps"},
+		{ErrTooManyWitnessItems, "ErrTooManyWitnessItems"},
+		{ErrMalleable, "ErrMalleable"},
+		{ErrSigNotRequired, "ErrSigNotRequired"},
+		{ErrTimelockMix, "ErrTimelockMix"},
+		{ErrUnsatisfiable, "ErrUnsatisfiable"},
+		{ErrMalleableSatisfaction, "ErrMalleableSatisfaction"},
+		{0xffff, "Unknown ErrorCode (65535)"},
+	}
+
+	// Detect additional error codes that don't have the stringer added.
+	if len(tests)-1 != int(numErrorCodes) {
+		t.Errorf("It appears an error code was added without adding an " +
+			"associated stringer test")
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		result := test.in.String()
+		if result != test.want {
+			t.Errorf("String #%d\n got: %s want: %s", i, result,
+				test.want)
+			continue
+		}
+	}
+}
+
+// TestError tests the error output for the Error type.
+func TestError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in   Error
+		want string
+	}{
+		{
+			Error{Description: "some error"},
+			"some error",
+		},
+		{
+			Error{Description: "human-readable error"},
+			"human-readable error",
+		},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		result := test.in.Error()
+		if result != test.want {
+			t.Errorf("Error #%d\n got: %s want: %s", i, result,
+				test.want)
+			continue
+		}
+	}
+}
@@ -0,0 +1,715 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package miniscript
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ifishnet/hdfd/hdfec"
+	"github.com/ifishnet/hdfd/txscript"
+	"github.com/ifishnet/hdfd/txscript/internal/scriptexpr"
+	"github.com/ifishnet/hdfutil"
+)
+
+// maxMultiSigKeys is the maximum number of keys of a multi fragment.
+const maxMultiSigKeys = 20
+
+// fragment identifies a miniscript fragment or wrapper.
+type fragment int
+
+const (
+	frag0 fragment = iota
+	frag1
+	fragPkK
+	fragPkH
+	fragOlder
+	fragAfter
+	fragSha256
+	fragHash256
+	fragRipemd160
+	fragHash160
+	fragAndOr
+	fragAndV
+	fragAndB
+	fragOrB
+	fragOrC
+	fragOrD
+	fragOrI
+	fragThresh
+	fragMulti
+	fragWrapA
+	fragWrapS
+	fragWrapC
+	fragWrapD
+	fragWrapV
+	fragWrapJ
+	fragWrapN
+)
+
+// fragmentNames are the names of the fragments as they appear in expressions.
+var fragmentNames = map[fragment]string{
+	frag0:         "0",
+	frag1:         "1",
+	fragPkK:       "pk_k",
+	fragPkH:       "pk_h",
+	fragOlder:     "older",
+	fragAfter:     "after",
+	fragSha256:    "sha256",
+	fragHash256:   "hash256",
+	fragRipemd160: "ripemd160",
+	fragHash160:   "hash160",
+	fragAndOr:     "andor",
+	fragAndV:      "and_v",
+	fragAndB:      "and_b",
+	fragOrB:       "or_b",
+	fragOrC:       "or_c",
+	fragOrD:       "or_d",
+	fragOrI:       "or_i",
+	fragThresh:    "thresh",
+	fragMulti:     "multi",
+	fragWrapA:     "a:",
+	fragWrapS:     "s:",
+	fragWrapC:     "c:",
+	fragWrapD:     "d:",
+	fragWrapV:     "v:",
+	fragWrapJ:     "j:",
+	fragWrapN:     "n:",
+}
+
+// wrapperFragments maps the wrapper letters to their fragments.
+var wrapperFragments = map[byte]fragment{
+	'a': fragWrapA,
+	's': fragWrapS,
+	'c': fragWrapC,
+	'd': fragWrapD,
+	'v': fragWrapV,
+	'j': fragWrapJ,
+	'n': fragWrapN,
+}
+
+// hashFragments maps the hash fragments to the hash function they use.
+var hashFragments = map[fragment]HashFunc{
+	fragSha256:    HashSHA256,
+	fragHash256:   HashHASH256,
+	fragRipemd160: HashRIPEMD160,
+	fragHash160:   HashHASH160,
+}
+
+// Node is a parsed and type-checked miniscript expression for use in a
+// pay-to-witness-script-hash witness script.
+type Node struct {
+	frag fragment
+	typ  typeProps
+
+	// k is the threshold of thresh and multi and the timelock of older
+	// and after.
+	k uint32
+
+	// keys are the compressed public keys of pk_k, pk_h, and multi.
+	keys [][]byte
+
+	// hash is the hash of the hash fragments.
+	hash []byte
+
+	// subs are the arguments of the combinators and wrappers.
+	subs []*Node
+}
+
+// newNode returns a new node for the passed fragment after type-checking it.
+func newNode(frag fragment, k uint32, keys [][]byte, hash []byte,
+	subs ...*Node) (*Node, error) {
+
+	n := &Node{frag: frag, k: k, keys: keys, hash: hash, subs: subs}
+	typ, err := computeType(n)
+	if err != nil {
+		return nil, err
+	}
+	n.typ = typ
+	return n, nil
+}
+
+// splitFunc splits the passed expression of the form name(args) into the name
+// and the arguments.
+func splitFunc(s string) (string, string, error) {
+	name, args, ok := scriptexpr.SplitFunc(s)
+	if !ok {
+		str := fmt.Sprintf("expected a fragment, got %q", s)
+		return "", "", miniscriptError(ErrInvalidSyntax, str)
+	}
+	return name, args, nil
+}
+
+// splitArgs splits the passed arguments at the commas which are not nested in
+// parentheses, brackets, or braces.
+func splitArgs(s string) ([]string, error) {
+	args, err := scriptexpr.SplitArgs(s)
+	if err != nil {
+		return nil, miniscriptError(ErrInvalidSyntax, err.Error())
+	}
+	return args, nil
+}
+
+// expectArgs returns an error when the passed number of arguments of the named
+// fragment is not the expected number.
+func expectArgs(name string, args []string, want int) error {
+	if len(args) != want {
+		str := fmt.Sprintf("%s expects %d argument(s), got %d", name,
+			want, len(args))
+		return miniscriptError(ErrInvalidSyntax, str)
+	}
+	return nil
+}
+
+// parseKey parses the passed hex-encoded compressed public key.
+func parseKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(s)
+	if err != nil || len(key) != hdfec.PubKeyBytesLenCompressed {
+		str := fmt.Sprintf("key %q is not a hex-encoded compressed "+
+			"public key", s)
+		return nil, miniscriptError(ErrInvalidKey, str)
+	}
+	if _, err := hdfec.ParsePubKey(key, hdfec.S256()); err != nil {
+		str := fmt.Sprintf("key %q is not a valid public key: %v", s, err)
+		return nil, miniscriptError(ErrInvalidKey, str)
+	}
+	return key, nil
+}
+
+// parseThreshold parses the passed threshold, which must be between one and
+// the passed number of arguments it applies to.
+func parseThreshold(name, s string, n int) (uint32, error) {
+	k, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || k < 1 || k > uint64(n) {
+		str := fmt.Sprintf("%s threshold %q is not between 1 and %d",
+			name, s, n)
+		return 0, miniscriptError(ErrInvalidThreshold, str)
+	}
+	return uint32(k), nil
+}
+
+// parseSubs parses the passed arguments of a combinator.
+func parseSubs(args []string) ([]*Node, error) {
+	subs := make([]*Node, 0, len(args))
+	for _, arg := range args {
+		sub, err := parseNode(arg)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+// parseNode parses the passed expression, which may be prefixed with wrappers.
+func parseNode(s string) (*Node, error) {
+	// Wrappers are the letters before a colon preceding the fragment.  The
+	// wrapper closest to the fragment is applied first.
+	colon := strings.IndexByte(s, ':')
+	open := strings.IndexByte(s, '(')
+	if colon != -1 && (open == -1 || colon < open) {
+		wrappers := s[:colon]
+		if wrappers == "" {
+			str := fmt.Sprintf("missing wrappers before ':' in %q", s)
+			return nil, miniscriptError(ErrInvalidSyntax, str)
+		}
+		n, err := parseNode(s[colon+1:])
+		if err != nil {
+			return nil, err
+		}
+		for i := len(wrappers) - 1; i >= 0; i-- {
+			n, err = applyWrapper(wrappers[i], n)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return n, nil
+	}
+
+	switch s {
+	case "0":
+		return newNode(frag0, 0, nil, nil)
+	case "1":
+		return newNode(frag1, 0, nil, nil)
+	}
+
+	name, argStr, err := splitFunc(s)
+	if err != nil {
+		return nil, err
+	}
+	args, err := splitArgs(argStr)
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case "pk_k", "pk_h", "pk", "pkh":
+		if err := expectArgs(name, args, 1); err != nil {
+			return nil, err
+		}
+		key, err := parseKey(args[0])
+		if err != nil {
+			return nil, err
+		}
+		frag := fragPkK
+		if name == "pk_h" || name == "pkh" {
+			frag = fragPkH
+		}
+		n, err := newNode(frag, 0, [][]byte{key}, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		// The pk and pkh fragments are shorthands for checking the
+		// signature of the key.
+		if name == "pk" || name == "pkh" {
+			return newNode(fragWrapC, 0, nil, nil, n)
+		}
+		return n, nil
+
+	case "older", "after":
+		if err := expectArgs(name, args, 1); err != nil {
+			return nil, err
+		}
+		value, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil || value < 1 || value >= 1<<31 {
+			str := fmt.Sprintf("%s timelock %q is not between 1 and "+
+				"2^31-1", name, args[0])
+			return nil, miniscriptError(ErrInvalidTimelock, str)
+		}
+		frag := fragOlder
+		if name == "after" {
+			frag = fragAfter
+		}
+		return newNode(frag, uint32(value), nil, nil)
+
+	case "sha256", "hash256", "ripemd160", "hash160":
+		if err := expectArgs(name, args, 1); err != nil {
+			return nil, err
+		}
+		frag := map[string]fragment{
+			"sha256": fragSha256, "hash256": fragHash256,
+			"ripemd160": fragRipemd160, "hash160": fragHash160,
+		}[name]
+		size := hashFragments[frag].Size()
+		hash, err := hex.DecodeString(args[0])
+		if err != nil || len(hash) != size {
+			str := fmt.Sprintf("%s hash %q is not %d hex-encoded "+
+				"bytes", name, args[0], size)
+			return nil, miniscriptError(ErrInvalidHash, str)
+		}
+		return newNode(frag, 0, nil, hash)
+
+	case "andor":
+		if err := expectArgs(name, args, 3); err != nil {
+			return nil, err
+		}
+		subs, err := parseSubs(args)
+		if err != nil {
+			return nil, err
+		}
+		return newNode(fragAndOr, 0, nil, nil, subs...)
+
+	case "and_v", "and_b", "and_n", "or_b", "or_c", "or_d", "or_i":
+		if err := expectArgs(name, args, 2); err != nil {
+			return nil, err
+		}
+		subs, err := parseSubs(args)
+		if err != nil {
+			return nil, err
+		}
+
+		// The and_n fragment is a shorthand for andor(X,Y,0).
+		if name == "and_n" {
+			zero, err := newNode(frag0, 0, nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			return newNode(fragAndOr, 0, nil, nil, subs[0], subs[1],
+				zero)
+		}
+		frag := map[string]fragment{
+			"and_v": fragAndV, "and_b": fragAndB, "or_b": fragOrB,
+			"or_c": fragOrC, "or_d": fragOrD, "or_i": fragOrI,
+		}[name]
+		return newNode(frag, 0, nil, nil, subs...)
+
+	case "thresh":
+		if len(args) < 2 {
+			str := "thresh expects a threshold and at least one " +
+				"argument"
+			return nil, miniscriptError(ErrInvalidSyntax, str)
+		}
+		k, err := parseThreshold(name, args[0], len(args)-1)
+		if err != nil {
+			return nil, err
+		}
+		subs, err := parseSubs(args[1:])
+		if err != nil {
+			return nil, err
+		}
+		return newNode(fragThresh, k, nil, nil, subs...)
+
+	case "multi":
+		if len(args) < 2 {
+			str := "multi expects a threshold and at least one key"
+			return nil, miniscriptError(ErrInvalidSyntax, str)
+		}
+		if len(args)-1 > maxMultiSigKeys {
+			str := fmt.Sprintf("multi has %d keys, but at most %d are "+
+				"allowed", len(args)-1, maxMultiSigKeys)
+			return nil, miniscriptError(ErrInvalidThreshold, str)
+		}
+		k, err := parseThreshold(name, args[0], len(args)-1)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([][]byte, 0, len(args)-1)
+		for _, arg := range args[1:] {
+			key, err := parseKey(arg)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		}
+		return newNode(fragMulti, k, keys, nil)
+	}
+
+	str := fmt.Sprintf("unknown fragment %q", name)
+	return nil, miniscriptError(ErrUnknownFragment, str)
+}
+
+// applyWrapper applies the wrapper with the passed letter to the passed node.
+// The t, l, and u wrappers are shorthands for and_v(X,1), or_i(0,X), and
+// or_i(X,0) respectively.
+func applyWrapper(letter byte, n *Node) (*Node, error) {
+	switch letter {
+	case 't', 'l', 'u':
+		frag := frag0
+		if letter == 't' {
+			frag = frag1
+		}
+		constant, err := newNode(frag, 0, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		switch letter {
+		case 't':
+			return newNode(fragAndV, 0, nil, nil, n, constant)
+		case 'l':
+			return newNode(fragOrI, 0, nil, nil, constant, n)
+		default:
+			return newNode(fragOrI, 0, nil, nil, n, constant)
+		}
+	}
+
+	frag, ok := wrapperFragments[letter]
+	if !ok {
+		str := fmt.Sprintf("unknown wrapper %q", letter)
+		return nil, miniscriptError(ErrInvalidSyntax, str)
+	}
+	return newNode(frag, 0, nil, nil, n)
+}
+
+// Parse parses the passed miniscript expression for use in a
+// pay-to-witness-script-hash witness script and type-checks it.  The
+// expression must be of the base type B.
+//
+// Note that a successfully parsed expression is not necessarily safe to use.
+// Call CheckSanity to ensure it is within the resource limits, has
+// non-malleable satisfactions, and requires a signature.
+func Parse(s string) (*Node, error) {
+	n, err := parseNode(s)
+	if err != nil {
+		return nil, err
+	}
+	if !n.typ.has(typeB) {
+		str := fmt.Sprintf("top-level expression must be B, but it is "+
+			"%s", n.typ)
+		return nil, miniscriptError(ErrTypeCheck, str)
+	}
+	return n, nil
+}
+
+// Type returns the letters of the basic type and the properties of the
+// expression as defined by BIP0379, such as "Bondusmk".
+func (n *Node) Type() string {
+	return n.typ.String()
+}
+
+// isConstant returns whether or not the node is the passed constant fragment.
+func (n *Node) isConstant(frag fragment) bool {
+	return n.frag == frag
+}
+
+// isWrapped returns whether or not the string form of the node starts with
+// wrappers, so wrappers applied to it are merged with them.
+func (n *Node) isWrapped() bool {
+	switch n.frag {
+	case fragWrapA, fragWrapS, fragWrapD, fragWrapV, fragWrapJ, fragWrapN:
+		return true
+	case fragWrapC:
+		sub := n.subs[0]
+		return sub.frag != fragPkK && sub.frag != fragPkH
+	case fragAndV:
+		return n.subs[1].isConstant(frag1)
+	case fragOrI:
+		return n.subs[0].isConstant(frag0) ||
+			n.subs[1].isConstant(frag0)
+	}
+	return false
+}
+
+// wrap returns the string form of the passed node with the passed wrapper
+// letter applied.
+func wrap(letter string, n *Node) string {
+	if n.isWrapped() {
+		return letter + n.String()
+	}
+	return letter + ":" + n.String()
+}
+
+// String returns the expression in its canonical form, which uses the pk, pkh,
+// and_n, t, l, and u shorthands where possible.
+func (n *Node) String() string {
+	switch n.frag {
+	case frag0, frag1:
+		return fragmentNames[n.frag]
+
+	case fragPkK, fragPkH:
+		return fmt.Sprintf("%s(%x)", fragmentNames[n.frag], n.keys[0])
+
+	case fragOlder, fragAfter:
+		return fmt.Sprintf("%s(%d)", fragmentNames[n.frag], n.k)
+
+	case fragSha256, fragHash256, fragRipemd160, fragHash160:
+		return fmt.Sprintf("%s(%x)", fragmentNames[n.frag], n.hash)
+
+	case fragMulti:
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "multi(%d", n.k)
+		for _, key := range n.keys {
+			fmt.Fprintf(&sb, ",%x", key)
+		}
+		sb.WriteByte(')')
+		return sb.String()
+
+	case fragWrapC:
+		switch sub := n.subs[0]; sub.frag {
+		case fragPkK:
+			return fmt.Sprintf("pk(%x)", sub.keys[0])
+		case fragPkH:
+			return fmt.Sprintf("pkh(%x)", sub.keys[0])
+		}
+		return wrap("c", n.subs[0])
+
+	case fragWrapA, fragWrapS, fragWrapD, fragWrapV, fragWrapJ, fragWrapN:
+		return wrap(fragmentNames[n.frag][:1], n.subs[0])
+
+	case fragAndV:
+		if n.subs[1].isConstant(frag1) {
+			return wrap("t", n.subs[0])
+		}
+
+	case fragOrI:
+		if n.subs[0].isConstant(frag0) {
+			return wrap("l", n.subs[1])
+		}
+		if n.subs[1].isConstant(frag0) {
+			return wrap("u", n.subs[0])
+		}
+
+	case fragAndOr:
+		if n.subs[2].isConstant(frag0) {
+			return fmt.Sprintf("and_n(%s,%s)", n.subs[0], n.subs[1])
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fragmentNames[n.frag])
+	sb.WriteByte('(')
+	if n.frag == fragThresh {
+		fmt.Fprintf(&sb, "%d,", n.k)
+	}
+	for i, sub := range n.subs {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(sub.String())
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
+
+// appendData appends a push of the passed data, which must not be larger than
+// 75 bytes, to the passed script.
+func appendData(script, data []byte) []byte {
+	script = append(script, txscript.OP_DATA_1-1+byte(len(data)))
+	return append(script, data...)
+}
+
+// appendInt appends a minimally encoded push of the passed number to the passed
+// script.
+func appendInt(script []byte, n int64) []byte {
+	// The script builder can't fail for a single number.
+	push, _ := txscript.NewScriptBuilder().AddInt64(n).Script()
+	return append(script, push...)
+}
+
+// verifyOpcodes maps the opcodes which have a verify variant to it.  The v
+// wrapper replaces a final opcode with its verify variant instead of appending
+// OP_VERIFY.
+var verifyOpcodes = map[byte]byte{
+	txscript.OP_EQUAL:         txscript.OP_EQUALVERIFY,
+	txscript.OP_NUMEQUAL:      txscript.OP_NUMEQUALVERIFY,
+	txscript.OP_CHECKSIG:      txscript.OP_CHECKSIGVERIFY,
+	txscript.OP_CHECKMULTISIG: txscript.OP_CHECKMULTISIGVERIFY,
+}
+
+// appendScript appends the script of the node to the passed script.
+func (n *Node) appendScript(script []byte) []byte {
+	switch n.frag {
+	case frag0:
+		return append(script, txscript.OP_0)
+
+	case frag1:
+		return append(script, txscript.OP_1)
+
+	case fragPkK:
+		return appendData(script, n.keys[0])
+
+	case fragPkH:
+		script = append(script, txscript.OP_DUP, txscript.OP_HASH160)
+		script = appendData(script, hdfutil.Hash160(n.keys[0]))
+		return append(script, txscript.OP_EQUALVERIFY)
+
+	case fragOlder:
+		script = appendInt(script, int64(n.k))
+		return append(script, txscript.OP_CHECKSEQUENCEVERIFY)
+
+	case fragAfter:
+		script = appendInt(script, int64(n.k))
+		return append(script, txscript.OP_CHECKLOCKTIMEVERIFY)
+
+	case fragSha256, fragHash256, fragRipemd160, fragHash160:
+		hashOpcode := map[fragment]byte{
+			fragSha256:    txscript.OP_SHA256,
+			fragHash256:   txscript.OP_HASH256,
+			fragRipemd160: txscript.OP_RIPEMD160,
+			fragHash160:   txscript.OP_HASH160,
+		}[n.frag]
+		script = append(script, txscript.OP_SIZE)
+		script = appendInt(script, preimageSize)
+		script = append(script, txscript.OP_EQUALVERIFY, hashOpcode)
+		script = appendData(script, n.hash)
+		return append(script, txscript.OP_EQUAL)
+
+	case fragAndOr:
+		script = n.subs[0].appendScript(script)
+		script = append(script, txscript.OP_NOTIF)
+		script = n.subs[2].appendScript(script)
+		script = append(script, txscript.OP_ELSE)
+		script = n.subs[1].appendScript(script)
+		return append(script, txscript.OP_ENDIF)
+
+	case fragAndV:
+		script = n.subs[0].appendScript(script)
+		return n.subs[1].appendScript(script)
+
+	case fragAndB:
+		script = n.subs[0].appendScript(script)
+		script = n.subs[1].appendScript(script)
+		return append(script, txscript.OP_BOOLAND)
+
+	case fragOrB:
+		script = n.subs[0].appendScript(script)
+		script = n.subs[1].appendScript(script)
+		return append(script, txscript.OP_BOOLOR)
+
+	case fragOrC:
+		script = n.subs[0].appendScript(script)
+		script = append(script, txscript.OP_NOTIF)
+		script = n.subs[1].appendScript(script)
+		return append(script, txscript.OP_ENDIF)
+
+	case fragOrD:
+		script = n.subs[0].appendScript(script)
+		script = append(script, txscript.OP_IFDUP, txscript.OP_NOTIF)
+		script = n.subs[1].appendScript(script)
+		return append(script, txscript.OP_ENDIF)
+
+	case fragOrI:
+		script = append(script, txscript.OP_IF)
+		script = n.subs[0].appendScript(script)
+		script = append(script, txscript.OP_ELSE)
+		script = n.subs[1].appendScript(script)
+		return append(script, txscript.OP_ENDIF)
+
+	case fragThresh:
+		for i, sub := range n.subs {
+			script = sub.appendScript(script)
+			if i > 0 {
+				script = append(script, txscript.OP_ADD)
+			}
+		}
+		script = appendInt(script, int64(n.k))
+		return append(script, txscript.OP_EQUAL)
+
+	case fragMulti:
+		script = appendInt(script, int64(n.k))
+		for _, key := range n.keys {
+			script = appendData(script, key)
+		}
+		script = appendInt(script, int64(len(n.keys)))
+		return append(script, txscript.OP_CHECKMULTISIG)
+
+	case fragWrapA:
+		script = append(script, txscript.OP_TOALTSTACK)
+		script = n.subs[0].appendScript(script)
+		return append(script, txscript.OP_FROMALTSTACK)
+
+	case fragWrapS:
+		script = append(script, txscript.OP_SWAP)
+		return n.subs[0].appendScript(script)
+
+	case fragWrapC:
+		script = n.subs[0].appendScript(script)
+		return append(script, txscript.OP_CHECKSIG)
+
+	case fragWrapD:
+		script = append(script, txscript.OP_DUP, txscript.OP_IF)
+		script = n.subs[0].appendScript(script)
+		return append(script, txscript.OP_ENDIF)
+
+	case fragWrapV:
+		// The script of the argument ends with an opcode since it is of
+		// type B.
+		script = n.subs[0].appendScript(script)
+		last := len(script) - 1
+		if verify, ok := verifyOpcodes[script[last]]; ok {
+			script[last] = verify
+			return script
+		}
+		return append(script, txscript.OP_VERIFY)
+
+	case fragWrapJ:
+		script = append(script, txscript.OP_SIZE, txscript.OP_0NOTEQUAL,
+			txscript.OP_IF)
+		script = n.subs[0].appendScript(script)
+		return append(script, txscript.OP_ENDIF)
+
+	case fragWrapN:
+		script = n.subs[0].appendScript(script)
+		return append(script, txscript.OP_0NOTEQUAL)
+	}
+	return script
+}
+
+// Script returns the witness script the expression compiles to.
+func (n *Node) Script() []byte {
+	return n.appendScript(nil)
+}
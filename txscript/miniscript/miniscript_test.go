@@ -0,0 +1,470 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package miniscript
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+const (
+	// The compressed public keys of the private keys 1, 2, 3, and 4.
+	testKey1 = "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+	testKey2 = "02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5"
+	testKey3 = "02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9"
+	testKey4 = "02e493dbf1c10d80f3581e4904930b1404cc6c13900ee0758474fa94abe8c4cd13"
+
+	// testKeyHash1 is the hash160 of testKey1.
+	testKeyHash1 = "751e76e8199196d454941c45d1b3a323f1433bd6"
+
+	// testPreimage is a 32-byte preimage along with its hashes.
+	testPreimage  = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	testSha256    = "630dcd2966c4336691125448bbb25b4ff412a49c732db2c8abc1b8581bd710dd"
+	testHash256   = "2f287b4d3d4910f6cada9e1bd1b4648099e8c52c81aa4a6aebfa6fc86f19834e"
+	testRipemd160 = "e6babb9619d7a81272711fc546a16b211dd93957"
+	testHash160   = "ea4beb47def8492389a1e16634795441e1b87245"
+)
+
+// hexToBytes converts the passed hex string into bytes and will panic if there
+// is an error.  This is only provided for the hard-coded constants so errors in
+// the source code can be detected.  It will only (and must only) be called with
+// hard-coded values.
+func hexToBytes(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic("invalid hex in source file: " + s)
+	}
+	return b
+}
+
+// TestParse ensures valid expressions are parsed, typed, compiled, and printed
+// as expected.
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		expr   string
+		str    string // canonical form, same as expr when empty
+		typ    string
+		script string
+	}{{
+		name:   "pk",
+		expr:   "pk(" + testKey1 + ")",
+		typ:    "Bonduesmk",
+		script: "21" + testKey1 + "ac",
+	}, {
+		name:   "pk_k with c wrapper",
+		expr:   "c:pk_k(" + testKey1 + ")",
+		str:    "pk(" + testKey1 + ")",
+		typ:    "Bonduesmk",
+		script: "21" + testKey1 + "ac",
+	}, {
+		name:   "pkh",
+		expr:   "pkh(" + testKey1 + ")",
+		typ:    "Bnduesmk",
+		script: "76a914" + testKeyHash1 + "88ac",
+	}, {
+		name:   "older",
+		expr:   "older(144)",
+		typ:    "Bzfmhk",
+		script: "029000b2",
+	}, {
+		name:   "after",
+		expr:   "after(1231488000)",
+		typ:    "Bzfmik",
+		script: "0400046749b1",
+	}, {
+		name:   "sha256",
+		expr:   "sha256(" + testSha256 + ")",
+		typ:    "Bondumk",
+		script: "82012088a820" + testSha256 + "87",
+	}, {
+		name:   "hash160",
+		expr:   "hash160(" + testHash160 + ")",
+		typ:    "Bondumk",
+		script: "82012088a914" + testHash160 + "87",
+	}, {
+		name: "multi",
+		expr: "multi(2," + testKey1 + "," + testKey2 + "," + testKey3 + ")",
+		typ:  "Bnduesmk",
+		script: "5221" + testKey1 + "21" + testKey2 + "21" + testKey3 +
+			"53ae",
+	}, {
+		name:   "and_v with merged verify",
+		expr:   "and_v(v:pk(" + testKey1 + "),pk(" + testKey2 + "))",
+		typ:    "Bnufsmk",
+		script: "21" + testKey1 + "ad21" + testKey2 + "ac",
+	}, {
+		name: "and_v with equalverify",
+		expr: "and_v(v:sha256(" + testSha256 + "),pk(" + testKey1 + "))",
+		typ:  "Bnusmk",
+		script: "82012088a820" + testSha256 + "8821" + testKey1 +
+			"ac",
+	}, {
+		name:   "and_v with verify",
+		expr:   "and_v(v:older(10),pk(" + testKey1 + "))",
+		typ:    "Bonusmhk",
+		script: "5ab26921" + testKey1 + "ac",
+	}, {
+		name:   "or_d",
+		expr:   "or_d(pk(" + testKey1 + "),older(144))",
+		typ:    "Bofmhk",
+		script: "21" + testKey1 + "ac7364029000b268",
+	}, {
+		name: "andor",
+		expr: "andor(pk(" + testKey1 + "),older(144),pk(" + testKey2 +
+			"))",
+		typ: "Bdesmhk",
+		script: "21" + testKey1 + "ac6421" + testKey2 + "ac67029000b2" +
+			"68",
+	}, {
+		name: "thresh",
+		expr: "thresh(2,pk(" + testKey1 + "),s:pk(" + testKey2 + ")," +
+			"sln:older(10))",
+		typ: "Bdusmhk",
+		script: "21" + testKey1 + "ac7c21" + testKey2 + "ac937c630067" +
+			"5ab292689352" + "87",
+	}, {
+		name:   "and_n",
+		expr:   "and_n(pk(" + testKey1 + "),older(10))",
+		typ:    "Bodesmhk",
+		script: "21" + testKey1 + "ac640067" + "5ab268",
+	}, {
+		name: "t wrapper",
+		expr: "tv:pk(" + testKey1 + ")",
+		typ:  "Bonufsmk",
+		// The t wrapper is useless here, but keeps the type B.
+		script: "21" + testKey1 + "ad51",
+	}, {
+		name: "l and u wrappers",
+		expr: "or_i(l:pk(" + testKey1 + "),u:pk(" + testKey2 + "))",
+		typ:  "Bdusmk",
+		script: "6363006721" + testKey1 + "ac686763" + "21" + testKey2 +
+			"ac670068" + "68",
+	}, {
+		name:   "d and j wrappers",
+		expr:   "and_b(j:pk(" + testKey1 + "),a:dv:older(10))",
+		str:    "and_b(j:pk(" + testKey1 + "),adv:older(10))",
+		typ:    "Bndusmhk",
+		script: "82926321" + testKey1 + "ac686b7663" + "5ab269686c9a",
+	}, {
+		name:   "merged wrappers",
+		expr:   "and_v(vc:pk_k(" + testKey1 + "),pk(" + testKey2 + "))",
+		str:    "and_v(v:pk(" + testKey1 + "),pk(" + testKey2 + "))",
+		typ:    "Bnufsmk",
+		script: "21" + testKey1 + "ad21" + testKey2 + "ac",
+	}}
+
+	for _, test := range tests {
+		n, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		want := test.str
+		if want == "" {
+			want = test.expr
+		}
+		if n.String() != want {
+			t.Errorf("%s: mismatched string -- got %s, want %s",
+				test.name, n.String(), want)
+		}
+		if n.Type() != test.typ {
+			t.Errorf("%s: mismatched type -- got %s, want %s",
+				test.name, n.Type(), test.typ)
+		}
+		wantScript := hexToBytes(test.script)
+		if script := n.Script(); !bytes.Equal(script, wantScript) {
+			t.Errorf("%s: mismatched script -- got %x, want %x",
+				test.name, script, wantScript)
+		}
+
+		// Ensure the canonical form parses to the same expression.
+		n2, err := Parse(n.String())
+		if err != nil {
+			t.Errorf("%s: unexpected error parsing canonical form: "+
+				"%v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(n2.Script(), wantScript) {
+			t.Errorf("%s: canonical form compiles to %x, want %x",
+				test.name, n2.Script(), wantScript)
+		}
+	}
+}
+
+// TestParseErrors ensures invalid expressions are rejected with the expected
+// error codes.
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		expr string
+		err  ErrorCode
+	}{{
+		name: "unbalanced parentheses",
+		expr: "and_v(v:pk(" + testKey1 + "),pk(" + testKey2 + ")",
+		err:  ErrInvalidSyntax,
+	}, {
+		name: "too many arguments",
+		expr: "pk(" + testKey1 + "," + testKey2 + ")",
+		err:  ErrInvalidSyntax,
+	}, {
+		name: "missing wrappers",
+		expr: ":pk(" + testKey1 + ")",
+		err:  ErrInvalidSyntax,
+	}, {
+		name: "unknown wrapper",
+		expr: "x:pk(" + testKey1 + ")",
+		err:  ErrInvalidSyntax,
+	}, {
+		name: "unknown fragment",
+		expr: "pk_x(" + testKey1 + ")",
+		err:  ErrUnknownFragment,
+	}, {
+		name: "uncompressed key",
+		expr: "pk(04" + testKey1[2:] + testKey1[2:] + ")",
+		err:  ErrInvalidKey,
+	}, {
+		name: "invalid key",
+		expr: "pk(02" + strings.Repeat("0", 63) + "5)",
+		err:  ErrInvalidKey,
+	}, {
+		name: "short hash",
+		expr: "sha256(" + testHash160 + ")",
+		err:  ErrInvalidHash,
+	}, {
+		name: "zero timelock",
+		expr: "older(0)",
+		err:  ErrInvalidTimelock,
+	}, {
+		name: "timelock too big",
+		expr: "after(2147483648)",
+		err:  ErrInvalidTimelock,
+	}, {
+		name: "zero threshold",
+		expr: "thresh(0,pk(" + testKey1 + "))",
+		err:  ErrInvalidThreshold,
+	}, {
+		name: "threshold above number of keys",
+		expr: "multi(3," + testKey1 + "," + testKey2 + ")",
+		err:  ErrInvalidThreshold,
+	}, {
+		name: "too many multi keys",
+		expr: "multi(1" + strings.Repeat(","+testKey1, 21) + ")",
+		err:  ErrInvalidThreshold,
+	}, {
+		name: "top-level type V",
+		expr: "v:pk(" + testKey1 + ")",
+		err:  ErrTypeCheck,
+	}, {
+		name: "top-level type K",
+		expr: "pk_k(" + testKey1 + ")",
+		err:  ErrTypeCheck,
+	}, {
+		name: "and_v without V",
+		expr: "and_v(pk(" + testKey1 + "),pk(" + testKey2 + "))",
+		err:  ErrTypeCheck,
+	}, {
+		name: "and_b without W",
+		expr: "and_b(pk(" + testKey1 + "),pk(" + testKey2 + "))",
+		err:  ErrTypeCheck,
+	}, {
+		name: "s wrapper of non-o",
+		expr: "and_b(pk(" + testKey1 + "),s:pkh(" + testKey2 + "))",
+		err:  ErrTypeCheck,
+	}, {
+		name: "or_d without dissatisfiable first argument",
+		expr: "or_d(older(10),pk(" + testKey1 + "))",
+		err:  ErrTypeCheck,
+	}, {
+		name: "or_i with different types",
+		expr: "or_i(pk(" + testKey1 + "),v:pk(" + testKey2 + "))",
+		err:  ErrTypeCheck,
+	}, {
+		name: "thresh with B after the first argument",
+		expr: "thresh(1,pk(" + testKey1 + "),pk(" + testKey2 + "))",
+		err:  ErrTypeCheck,
+	}}
+
+	for _, test := range tests {
+		_, err := Parse(test.expr)
+		if !IsErrorCode(err, test.err) {
+			t.Errorf("%s: mismatched error -- got %v, want %v",
+				test.name, err, test.err)
+		}
+	}
+}
+
+// nest returns an expression which is the passed number of v-wrapped copies of
+// the passed expression combined with and_v around the passed final one.
+func nest(expr string, count int, final string) string {
+	return strings.Repeat("and_v(v:"+expr+",", count) + final +
+		strings.Repeat(")", count)
+}
+
+// TestCheckSanity ensures unsafe expressions and expressions which exceed the
+// resource limits are detected.
+func TestCheckSanity(t *testing.T) {
+	t.Parallel()
+
+	multi20 := "multi(20" + strings.Repeat(","+testKey1, 20) + ")"
+	tests := []struct {
+		name string
+		expr string
+		err  error
+	}{{
+		name: "pk",
+		expr: "pk(" + testKey1 + ")",
+	}, {
+		name: "timelocked multisig",
+		expr: "or_d(multi(2," + testKey1 + "," + testKey2 + "),and_v(" +
+			"v:pk(" + testKey3 + "),older(144)))",
+	}, {
+		name: "no signature required",
+		expr: "or_d(pk(" + testKey1 + "),older(144))",
+		err:  miniscriptError(ErrSigNotRequired, ""),
+	}, {
+		name: "malleable",
+		expr: "and_b(pk(" + testKey1 + "),a:or_i(older(10),older(20)))",
+		err:  miniscriptError(ErrMalleable, ""),
+	}, {
+		name: "timelock mix",
+		expr: "and_v(v:pk(" + testKey1 + "),and_v(v:older(10)," +
+			"older(4194305)))",
+		err: miniscriptError(ErrTimelockMix, ""),
+	}, {
+		name: "script too big",
+		expr: nest(multi20, 6, "pk("+testKey1+")"),
+		err:  miniscriptError(ErrScriptTooBig, ""),
+	}, {
+		name: "too many ops",
+		expr: nest("older(1)", 101, "pk("+testKey1+")"),
+		err:  miniscriptError(ErrTooManyOps, ""),
+	}, {
+		name: "too many witness items",
+		expr: "thresh(1," + multi20 + strings.Repeat(",a:"+multi20, 4) +
+			")",
+		err: miniscriptError(ErrTooManyWitnessItems, ""),
+	}}
+
+	for _, test := range tests {
+		n, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: unexpected parse error: %v", test.name, err)
+			continue
+		}
+		err = n.CheckSanity()
+		if test.err == nil {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+		if !IsErrorCode(err, test.err.(Error).ErrorCode) {
+			t.Errorf("%s: mismatched error -- got %v, want %v",
+				test.name, err, test.err.(Error).ErrorCode)
+		}
+	}
+}
+
+// TestResourceBounds ensures the resource bounds of expressions are computed
+// as expected.
+func TestResourceBounds(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		expr     string
+		ops      int
+		items    int
+		witSize  int
+		nonMall  bool
+		needsSig bool
+	}{{
+		name:     "pk",
+		expr:     "pk(" + testKey1 + ")",
+		ops:      1,
+		items:    1,
+		witSize:  74,
+		nonMall:  true,
+		needsSig: true,
+	}, {
+		name:     "pkh",
+		expr:     "pkh(" + testKey1 + ")",
+		ops:      4,
+		items:    2,
+		witSize:  74 + 34,
+		nonMall:  true,
+		needsSig: true,
+	}, {
+		name:     "multi",
+		expr:     "multi(2," + testKey1 + "," + testKey2 + "," + testKey3 + ")",
+		ops:      1 + 3,
+		items:    3,
+		witSize:  1 + 2*74,
+		nonMall:  true,
+		needsSig: true,
+	}, {
+		// The satisfaction through the timelock needs the
+		// dissatisfaction of the key while the other needs a
+		// signature.
+		name:    "or_d",
+		expr:    "or_d(pk(" + testKey1 + "),older(144))",
+		ops:     5,
+		items:   1,
+		witSize: 74,
+		nonMall: true,
+	}, {
+		name:     "thresh",
+		expr:     "thresh(2,pk(" + testKey1 + "),s:pk(" + testKey2 + "),sln:older(10))",
+		ops:      12,
+		items:    3,
+		witSize:  74 + 74 + 1 + 1,
+		nonMall:  true,
+		needsSig: true,
+	}, {
+		name:    "unsatisfiable",
+		expr:    "and_b(0,a:pk(" + testKey1 + "))",
+		ops:     4,
+		nonMall: true,
+		// The 0 fragment can't be satisfied.
+		needsSig: true,
+	}}
+
+	for _, test := range tests {
+		n, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: unexpected parse error: %v", test.name, err)
+			continue
+		}
+		if ops := n.MaxOps(); ops != test.ops {
+			t.Errorf("%s: mismatched ops -- got %d, want %d",
+				test.name, ops, test.ops)
+		}
+		if items := n.MaxWitnessItems(); items != test.items {
+			t.Errorf("%s: mismatched witness items -- got %d, want %d",
+				test.name, items, test.items)
+		}
+		if size := n.MaxWitnessSize(); size != test.witSize {
+			t.Errorf("%s: mismatched witness size -- got %d, want %d",
+				test.name, size, test.witSize)
+		}
+		if n.IsNonMalleable() != test.nonMall {
+			t.Errorf("%s: mismatched non-malleability -- got %v, "+
+				"want %v", test.name, n.IsNonMalleable(),
+				test.nonMall)
+		}
+		if n.RequiresSig() != test.needsSig {
+			t.Errorf("%s: mismatched signature requirement -- got %v, "+
+				"want %v", test.name, n.RequiresSig(),
+				test.needsSig)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package miniscript
+
+import (
+	"fmt"
+)
+
+// preimageSize is the size of the preimages of the hash fragments.
+const preimageSize = 32
+
+// HashFunc identifies the hash function of a hash fragment.
+type HashFunc int
+
+const (
+	// HashSHA256 is the SHA256 hash function used by sha256.
+	HashSHA256 HashFunc = iota
+
+	// HashHASH256 is the double SHA256 hash function used by hash256.
+	HashHASH256
+
+	// HashRIPEMD160 is the RIPEMD160 hash function used by ripemd160.
+	HashRIPEMD160
+
+	// HashHASH160 is the RIPEMD160 of SHA256 hash function used by hash160.
+	HashHASH160
+)
+
+// Size returns the size of the hashes of the hash function.
+func (h HashFunc) Size() int {
+	switch h {
+	case HashRIPEMD160, HashHASH160:
+		return 20
+	}
+	return 32
+}
+
+// Satisfier provides the signatures, preimages, and timelock information needed
+// to satisfy an expression.
+type Satisfier interface {
+	// Sign returns the signature, with the hash type appended, of the
+	// spending transaction by the private key of the passed compressed
+	// public key and whether or not it is available.
+	Sign(pubKey []byte) ([]byte, bool)
+
+	// Preimage returns the 32-byte preimage of the passed hash under the
+	// passed hash function and whether or not it is available.
+	Preimage(hashFunc HashFunc, hash []byte) ([]byte, bool)
+
+	// CheckOlder returns whether or not the spending input has a relative
+	// timelock which satisfies the passed older argument.
+	CheckOlder(sequence uint32) bool
+
+	// CheckAfter returns whether or not the spending transaction has a lock
+	// time which satisfies the passed after argument.
+	CheckAfter(lockTime uint32) bool
+}
+
+// witness is a witness stack which satisfies or dissatisfies an expression
+// along with the information needed to choose between alternatives.
+type witness struct {
+	// stack are the witness stack items from the bottom to the top.
+	stack [][]byte
+
+	// available is whether or not the witness can be produced at all.
+	available bool
+
+	// hasSig is whether or not the witness contains a signature.
+	hasSig bool
+
+	// malleable is whether or not third parties can turn the witness into
+	// another valid one.
+	malleable bool
+}
+
+// Commonly used witnesses.
+var (
+	unavailable = witness{}
+	emptyWit    = witness{available: true}
+	zeroWit     = witness{stack: [][]byte{nil}, available: true}
+	oneWit      = witness{stack: [][]byte{{1}}, available: true}
+)
+
+// size returns the serialized size of the witness stack items assuming a
+// single byte length prefix.
+func (w witness) size() int {
+	size := 0
+	for _, item := range w.stack {
+		size += 1 + len(item)
+	}
+	return size
+}
+
+// concat returns the witness which has the items of the passed witness on top
+// of those of the witness.
+func (w witness) concat(top witness) witness {
+	if !w.available || !top.available {
+		return unavailable
+	}
+	stack := make([][]byte, 0, len(w.stack)+len(top.stack))
+	stack = append(stack, w.stack...)
+	stack = append(stack, top.stack...)
+	return witness{
+		stack:     stack,
+		available: true,
+		hasSig:    w.hasSig || top.hasSig,
+		malleable: w.malleable || top.malleable,
+	}
+}
+
+// markMalleable returns the witness marked as malleable.  It is used for the
+// non-canonical alternatives, which third parties can always replace with the
+// canonical one.
+func (w witness) markMalleable() witness {
+	w.malleable = true
+	return w
+}
+
+// choose returns the preferred one of the passed alternative witnesses.
+//
+// A witness without a signature is preferred over one with a signature since
+// third parties could replace the latter by the former anyway.  When neither
+// has a signature, third parties can replace either by the other, so the
+// result is malleable.  Otherwise non-malleable witnesses are preferred over
+// malleable ones and smaller witnesses over larger ones.
+func choose(a, b witness) witness {
+	switch {
+	case !a.available:
+		return b
+	case !b.available:
+		return a
+	}
+
+	smaller := a
+	if b.size() < a.size() {
+		smaller = b
+	}
+	switch {
+	case !a.hasSig && !b.hasSig:
+		return smaller.markMalleable()
+	case a.hasSig && !b.hasSig:
+		return b
+	case !a.hasSig && b.hasSig:
+		return a
+	case a.malleable && !b.malleable:
+		return b
+	case !a.malleable && b.malleable:
+		return a
+	}
+	return smaller
+}
+
+// satisfy returns the preferred witnesses which satisfy and dissatisfy the node
+// using the passed satisfier.
+func (n *Node) satisfy(s Satisfier) (witness, witness) {
+	var xSat, xDsat, ySat, yDsat, zSat, zDsat witness
+	if len(n.subs) > 0 && n.frag != fragThresh {
+		xSat, xDsat = n.subs[0].satisfy(s)
+	}
+	if len(n.subs) > 1 && n.frag != fragThresh {
+		ySat, yDsat = n.subs[1].satisfy(s)
+	}
+	if len(n.subs) > 2 {
+		zSat, zDsat = n.subs[2].satisfy(s)
+	}
+
+	switch n.frag {
+	case frag0:
+		return unavailable, emptyWit
+
+	case frag1:
+		return emptyWit, unavailable
+
+	case fragPkK:
+		return signature(s, n.keys[0]), zeroWit
+
+	case fragPkH:
+		key := witness{stack: [][]byte{n.keys[0]}, available: true}
+		return signature(s, n.keys[0]).concat(key), zeroWit.concat(key)
+
+	case fragOlder:
+		if s.CheckOlder(n.k) {
+			return emptyWit, unavailable
+		}
+		return unavailable, unavailable
+
+	case fragAfter:
+		if s.CheckAfter(n.k) {
+			return emptyWit, unavailable
+		}
+		return unavailable, unavailable
+
+	case fragSha256, fragHash256, fragRipemd160, fragHash160:
+		// Any other 32-byte value dissatisfies the hash fragments.
+		dsat := witness{
+			stack:     [][]byte{make([]byte, preimageSize)},
+			available: true,
+		}
+		preimage, ok := s.Preimage(hashFragments[n.frag], n.hash)
+		if !ok || len(preimage) != preimageSize {
+			return unavailable, dsat
+		}
+		sat := witness{stack: [][]byte{preimage}, available: true}
+		return sat, dsat
+
+	case fragAndOr:
+		return choose(ySat.concat(xSat), zSat.concat(xDsat)),
+			zDsat.concat(xDsat)
+
+	case fragAndV:
+		return ySat.concat(xSat), yDsat.concat(xSat)
+
+	case fragAndB:
+		dsat := choose(yDsat.concat(xDsat), choose(
+			ySat.concat(xDsat).markMalleable(),
+			yDsat.concat(xSat).markMalleable()))
+		return ySat.concat(xSat), dsat
+
+	case fragOrB:
+		sat := choose(yDsat.concat(xSat), choose(ySat.concat(xDsat),
+			ySat.concat(xSat).markMalleable()))
+		return sat, yDsat.concat(xDsat)
+
+	case fragOrC:
+		return choose(xSat, ySat.concat(xDsat)), unavailable
+
+	case fragOrD:
+		return choose(xSat, ySat.concat(xDsat)), yDsat.concat(xDsat)
+
+	case fragOrI:
+		return choose(xSat.concat(oneWit), ySat.concat(zeroWit)),
+			choose(xDsat.concat(oneWit), yDsat.concat(zeroWit))
+
+	case fragThresh:
+		return n.satisfyThresh(s)
+
+	case fragMulti:
+		// The signatures must be in the order of the keys and follow
+		// the extra item consumed by OP_CHECKMULTISIG.
+		dsat := witness{stack: make([][]byte, n.k+1), available: true}
+		sat := zeroWit
+		for _, key := range n.keys {
+			if len(sat.stack) == int(n.k)+1 {
+				break
+			}
+			if sig := signature(s, key); sig.available {
+				sat = sat.concat(sig)
+			}
+		}
+		if len(sat.stack) != int(n.k)+1 {
+			return unavailable, dsat
+		}
+		return sat, dsat
+
+	case fragWrapA, fragWrapS, fragWrapC, fragWrapN:
+		return xSat, xDsat
+
+	case fragWrapD:
+		return xSat.concat(oneWit), zeroWit
+
+	case fragWrapV:
+		return xSat, unavailable
+
+	case fragWrapJ:
+		return xSat, zeroWit
+	}
+	return unavailable, unavailable
+}
+
+// satisfyThresh returns the preferred witnesses which satisfy and dissatisfy the
+// thresh node using the passed satisfier.
+func (n *Node) satisfyThresh(s Satisfier) (witness, witness) {
+	// Track the preferred witness for every number of satisfied arguments.
+	// The first argument consumes the top of the stack, so the witnesses
+	// of the arguments are stacked in reverse.
+	wits := []witness{emptyWit}
+	for i := len(n.subs) - 1; i >= 0; i-- {
+		sat, dsat := n.subs[i].satisfy(s)
+		next := make([]witness, len(wits)+1)
+		for j := range next {
+			next[j] = unavailable
+			if j < len(wits) {
+				next[j] = wits[j].concat(dsat)
+			}
+			if j > 0 {
+				next[j] = choose(next[j], wits[j-1].concat(sat))
+			}
+		}
+		wits = next
+	}
+
+	// Dissatisfying more arguments than needed is not canonical.
+	dsat := wits[0]
+	for j := 1; j < len(wits); j++ {
+		if j != int(n.k) {
+			dsat = choose(dsat, wits[j].markMalleable())
+		}
+	}
+	return wits[n.k], dsat
+}
+
+// signature returns the witness with the signature for the passed key.
+func signature(s Satisfier, pubKey []byte) witness {
+	sig, ok := s.Sign(pubKey)
+	if !ok {
+		return unavailable
+	}
+	return witness{stack: [][]byte{sig}, available: true, hasSig: true}
+}
+
+// Satisfy returns the witness stack items, excluding the witness script, which
+// satisfy the expression using the signatures, preimages, and timelocks
+// provided by the passed satisfier.  The items are ordered from the bottom to
+// the top of the stack as they appear in a transaction witness.
+//
+// When there are alternative ways to satisfy the expression, a non-malleable
+// one is chosen, preferring smaller witnesses.  ErrUnsatisfiable is returned
+// when the satisfier does not provide enough to satisfy the expression, and
+// ErrMalleableSatisfaction when third parties could alter the only possible
+// satisfaction.
+func (n *Node) Satisfy(s Satisfier) ([][]byte, error) {
+	sat, _ := n.satisfy(s)
+	if !sat.available {
+		str := fmt.Sprintf("unable to satisfy %s with the available "+
+			"signatures, preimages, and timelocks", n)
+		return nil, miniscriptError(ErrUnsatisfiable, str)
+	}
+	if sat.malleable || !n.IsNonMalleable() {
+		str := fmt.Sprintf("the only satisfaction of %s with the "+
+			"available signatures, preimages, and timelocks is "+
+			"malleable", n)
+		return nil, miniscriptError(ErrMalleableSatisfaction, str)
+	}
+	return sat.stack, nil
+}
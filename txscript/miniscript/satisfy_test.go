@@ -0,0 +1,387 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package miniscript
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/ifishnet/hdfd/hdfec"
+	"github.com/ifishnet/hdfd/txscript"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// testAmount is the amount of the output spent by the test transactions.
+const testAmount = 100000000
+
+// testSatisfier implements the Satisfier interface for the first input of a
+// transaction using a set of private keys and preimages.
+type testSatisfier struct {
+	tx        *wire.MsgTx
+	sigHashes *txscript.TxSigHashes
+	script    []byte
+	keys      map[string]*hdfec.PrivateKey
+	preimages map[string][]byte
+}
+
+// Sign returns the signature of the transaction by the private key of the
+// passed public key when it is known.
+func (s *testSatisfier) Sign(pubKey []byte) ([]byte, bool) {
+	key, ok := s.keys[hex.EncodeToString(pubKey)]
+	if !ok {
+		return nil, false
+	}
+	sig, err := txscript.RawTxInWitnessSignature(s.tx, s.sigHashes, 0,
+		testAmount, s.script, txscript.SigHashAll, key)
+	if err != nil {
+		return nil, false
+	}
+	return sig, true
+}
+
+// Preimage returns the preimage of the passed hash when it is known.
+func (s *testSatisfier) Preimage(hashFunc HashFunc, hash []byte) ([]byte, bool) {
+	preimage, ok := s.preimages[hex.EncodeToString(hash)]
+	return preimage, ok
+}
+
+// CheckOlder returns whether or not the sequence of the input satisfies the
+// passed relative timelock according to the rules of OP_CHECKSEQUENCEVERIFY.
+func (s *testSatisfier) CheckOlder(sequence uint32) bool {
+	txSequence := s.tx.TxIn[0].Sequence
+	if s.tx.Version < 2 || txSequence&wire.SequenceLockTimeDisabled != 0 {
+		return false
+	}
+	if sequence&wire.SequenceLockTimeIsSeconds !=
+		txSequence&wire.SequenceLockTimeIsSeconds {
+
+		return false
+	}
+	return sequence&wire.SequenceLockTimeMask <=
+		txSequence&wire.SequenceLockTimeMask
+}
+
+// CheckAfter returns whether or not the lock time of the transaction satisfies
+// the passed timelock according to the rules of OP_CHECKLOCKTIMEVERIFY.
+func (s *testSatisfier) CheckAfter(lockTime uint32) bool {
+	if (lockTime < txscript.LockTimeThreshold) !=
+		(s.tx.LockTime < txscript.LockTimeThreshold) {
+
+		return false
+	}
+	return lockTime <= s.tx.LockTime &&
+		s.tx.TxIn[0].Sequence != wire.MaxTxInSequenceNum
+}
+
+// TestSatisfy ensures the witnesses produced for expressions are accepted by
+// the script engine and stay within the computed resource bounds.
+func TestSatisfy(t *testing.T) {
+	t.Parallel()
+
+	// Create the private keys 1, 2, 3, and 4 of the test keys.
+	privKeys := make(map[string]*hdfec.PrivateKey)
+	for i := byte(1); i <= 4; i++ {
+		var keyBytes [32]byte
+		keyBytes[31] = i
+		privKey, _ := hdfec.PrivKeyFromBytes(hdfec.S256(), keyBytes[:])
+		pubKey := privKey.PubKey().SerializeCompressed()
+		privKeys[hex.EncodeToString(pubKey)] = privKey
+	}
+	preimage := hexToBytes(testPreimage)
+
+	tests := []struct {
+		name      string
+		expr      string
+		keys      []string
+		preimage  bool
+		sequence  uint32
+		lockTime  uint32
+		numItems  int
+		err       ErrorCode
+		shouldErr bool
+	}{{
+		name:     "pk",
+		expr:     "pk(" + testKey1 + ")",
+		keys:     []string{testKey1},
+		numItems: 1,
+	}, {
+		name:      "pk without key",
+		expr:      "pk(" + testKey1 + ")",
+		keys:      []string{testKey2},
+		err:       ErrUnsatisfiable,
+		shouldErr: true,
+	}, {
+		name:     "pkh",
+		expr:     "pkh(" + testKey1 + ")",
+		keys:     []string{testKey1},
+		numItems: 2,
+	}, {
+		name:     "multi",
+		expr:     "multi(2," + testKey1 + "," + testKey2 + "," + testKey3 + ")",
+		keys:     []string{testKey1, testKey3, testKey4},
+		numItems: 3,
+	}, {
+		name:      "multi without enough keys",
+		expr:      "multi(2," + testKey1 + "," + testKey2 + "," + testKey3 + ")",
+		keys:      []string{testKey2, testKey4},
+		err:       ErrUnsatisfiable,
+		shouldErr: true,
+	}, {
+		name: "or_d through first argument",
+		expr: "or_d(pk(" + testKey1 + "),and_v(v:pk(" + testKey2 + ")," +
+			"older(144)))",
+		keys:     []string{testKey1},
+		numItems: 1,
+	}, {
+		name: "or_d through second argument",
+		expr: "or_d(pk(" + testKey1 + "),and_v(v:pk(" + testKey2 + ")," +
+			"older(144)))",
+		keys:     []string{testKey2},
+		sequence: 144,
+		numItems: 2,
+	}, {
+		name: "or_d with unexpired timelock",
+		expr: "or_d(pk(" + testKey1 + "),and_v(v:pk(" + testKey2 + ")," +
+			"older(144)))",
+		keys:      []string{testKey2},
+		sequence:  143,
+		err:       ErrUnsatisfiable,
+		shouldErr: true,
+	}, {
+		name:     "or_d without signature",
+		expr:     "or_d(pk(" + testKey1 + "),older(144))",
+		sequence: 144,
+		numItems: 1,
+	}, {
+		name:     "and_v with sha256 preimage",
+		expr:     "and_v(v:sha256(" + testSha256 + "),pk(" + testKey1 + "))",
+		keys:     []string{testKey1},
+		preimage: true,
+		numItems: 2,
+	}, {
+		name:      "and_v without preimage",
+		expr:      "and_v(v:sha256(" + testSha256 + "),pk(" + testKey1 + "))",
+		keys:      []string{testKey1},
+		err:       ErrUnsatisfiable,
+		shouldErr: true,
+	}, {
+		name:     "hash256",
+		expr:     "and_v(v:pk(" + testKey1 + "),hash256(" + testHash256 + "))",
+		keys:     []string{testKey1},
+		preimage: true,
+		numItems: 2,
+	}, {
+		name: "ripemd160",
+		expr: "and_v(v:pk(" + testKey1 + "),ripemd160(" + testRipemd160 +
+			"))",
+		keys:     []string{testKey1},
+		preimage: true,
+		numItems: 2,
+	}, {
+		name: "hash160 dissatisfied",
+		expr: "or_d(pk(" + testKey1 + "),and_v(v:pk(" + testKey2 + ")," +
+			"hash160(" + testHash160 + ")))",
+		keys:     []string{testKey1, testKey2},
+		numItems: 1,
+	}, {
+		name: "thresh with timelock",
+		expr: "thresh(2,pk(" + testKey1 + "),s:pk(" + testKey2 + ")," +
+			"sln:older(10))",
+		keys:     []string{testKey2},
+		sequence: 10,
+		numItems: 3,
+	}, {
+		name: "thresh with keys",
+		expr: "thresh(2,pk(" + testKey1 + "),s:pk(" + testKey2 + ")," +
+			"sln:older(10))",
+		keys:     []string{testKey1, testKey2},
+		numItems: 3,
+	}, {
+		name: "andor through first and second arguments",
+		expr: "andor(pk(" + testKey1 + "),older(144),pk(" + testKey2 +
+			"))",
+		keys:     []string{testKey1},
+		sequence: 144,
+		numItems: 1,
+	}, {
+		name: "andor through third argument",
+		expr: "andor(pk(" + testKey1 + "),older(144),pk(" + testKey2 +
+			"))",
+		keys:     []string{testKey2},
+		numItems: 2,
+	}, {
+		name:     "or_i",
+		expr:     "or_i(pk(" + testKey1 + "),pkh(" + testKey2 + "))",
+		keys:     []string{testKey2},
+		numItems: 3,
+	}, {
+		name:     "or_b",
+		expr:     "or_b(pk(" + testKey1 + "),s:pk(" + testKey2 + "))",
+		keys:     []string{testKey2},
+		numItems: 2,
+	}, {
+		name:     "after",
+		expr:     "and_v(v:pk(" + testKey1 + "),after(1231488000))",
+		keys:     []string{testKey1},
+		lockTime: 1231488000,
+		numItems: 1,
+	}, {
+		name:      "after with height lock time",
+		expr:      "and_v(v:pk(" + testKey1 + "),after(1231488000))",
+		keys:      []string{testKey1},
+		lockTime:  700000,
+		err:       ErrUnsatisfiable,
+		shouldErr: true,
+	}, {
+		name:      "malleable satisfaction",
+		expr:      "or_i(older(10),older(20))",
+		sequence:  20,
+		err:       ErrMalleableSatisfaction,
+		shouldErr: true,
+	}}
+
+	for _, test := range tests {
+		n, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: unexpected parse error: %v", test.name, err)
+			continue
+		}
+		script := n.Script()
+		scriptHash := sha256.Sum256(script)
+		pkScript, err := txscript.NewScriptBuilder().AddOp(txscript.OP_0).
+			AddData(scriptHash[:]).Script()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		// Create a transaction spending the output with the sequence and
+		// lock time of the test.  The sequence disables the relative
+		// timelock, but not the lock time, by default.
+		sequence := test.sequence
+		if sequence == 0 {
+			sequence = wire.MaxTxInSequenceNum - 1
+		}
+		tx := wire.NewMsgTx(2)
+		txIn := wire.NewTxIn(&wire.OutPoint{}, nil, nil)
+		txIn.Sequence = sequence
+		tx.AddTxIn(txIn)
+		tx.AddTxOut(wire.NewTxOut(testAmount-1000, pkScript))
+		tx.LockTime = test.lockTime
+
+		satisfier := &testSatisfier{
+			tx:        tx,
+			sigHashes: txscript.NewTxSigHashes(tx),
+			script:    script,
+			keys:      make(map[string]*hdfec.PrivateKey),
+			preimages: make(map[string][]byte),
+		}
+		for _, key := range test.keys {
+			satisfier.keys[key] = privKeys[key]
+		}
+		if test.preimage {
+			for _, hash := range []string{testSha256, testHash256,
+				testRipemd160, testHash160} {
+
+				satisfier.preimages[hash] = preimage
+			}
+		}
+
+		stack, err := n.Satisfy(satisfier)
+		if test.shouldErr {
+			if !IsErrorCode(err, test.err) {
+				t.Errorf("%s: mismatched error -- got %v, want %v",
+					test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if len(stack) != test.numItems {
+			t.Errorf("%s: mismatched number of items -- got %d, want %d",
+				test.name, len(stack), test.numItems)
+		}
+		if len(stack) > n.MaxWitnessItems() {
+			t.Errorf("%s: %d items exceed the max of %d", test.name,
+				len(stack), n.MaxWitnessItems())
+		}
+		var size int
+		for _, item := range stack {
+			size += 1 + len(item)
+		}
+		if size > n.MaxWitnessSize() {
+			t.Errorf("%s: size %d exceeds the max of %d", test.name,
+				size, n.MaxWitnessSize())
+		}
+
+		// Ensure the script engine accepts the witness.
+		tx.TxIn[0].Witness = append(stack, script)
+		vm, err := txscript.NewEngine(pkScript, tx, 0,
+			txscript.StandardVerifyFlags, nil, satisfier.sigHashes,
+			testAmount)
+		if err != nil {
+			t.Errorf("%s: failed to create engine: %v", test.name, err)
+			continue
+		}
+		if err := vm.Execute(); err != nil {
+			t.Errorf("%s: witness rejected: %v", test.name, err)
+		}
+	}
+}
+
+// TestSatisfyMultiOrder ensures the signatures of multi satisfactions are in
+// the order of the keys.
+func TestSatisfyMultiOrder(t *testing.T) {
+	t.Parallel()
+
+	n, err := Parse("multi(2," + testKey2 + "," + testKey1 + ")")
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	s := &orderSatisfier{}
+	stack, err := n.Satisfy(s)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := [][]byte{nil, hexToBytes(testKey2), hexToBytes(testKey1)}
+	if len(stack) != len(want) {
+		t.Fatalf("mismatched number of items -- got %d, want %d",
+			len(stack), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(stack[i], want[i]) {
+			t.Errorf("mismatched item %d -- got %x, want %x", i,
+				stack[i], want[i])
+		}
+	}
+}
+
+// orderSatisfier is a Satisfier which returns the public keys as signatures
+// and nothing else.
+type orderSatisfier struct{}
+
+// Sign returns the passed public key as its signature.
+func (s *orderSatisfier) Sign(pubKey []byte) ([]byte, bool) {
+	return pubKey, true
+}
+
+// Preimage reports that no preimage is available.
+func (s *orderSatisfier) Preimage(HashFunc, []byte) ([]byte, bool) {
+	return nil, false
+}
+
+// CheckOlder reports that no relative timelock is satisfied.
+func (s *orderSatisfier) CheckOlder(uint32) bool {
+	return false
+}
+
+// CheckAfter reports that no lock time is satisfied.
+func (s *orderSatisfier) CheckAfter(uint32) bool {
+	return false
+}
@@ -0,0 +1,427 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package miniscript
+
+import (
+	"fmt"
+
+	"github.com/ifishnet/hdfd/txscript"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// typeProps is a set of the basic type and the properties of an expression as
+// defined by BIP0379.  Exactly one basic type is set for every well-typed
+// expression.
+type typeProps uint32
+
+const (
+	// typeB is the base type.  It takes its inputs from the top of the
+	// stack and pushes a nonzero value when satisfied or an exact zero
+	// otherwise.
+	typeB typeProps = 1 << iota
+
+	// typeV is the verify type.  It takes its inputs from the top of the
+	// stack, continues when satisfied, and aborts otherwise.
+	typeV
+
+	// typeK is the key type.  It takes its inputs from the top of the stack
+	// and pushes a public key whose signature is to be checked.
+	typeK
+
+	// typeW is the wrapped type.  It takes its inputs from one below the
+	// top of the stack and pushes its result like type B on top of it.
+	typeW
+
+	// propZ means the expression always consumes exactly zero stack
+	// elements.
+	propZ
+
+	// propO means the expression always consumes exactly one stack element.
+	propO
+
+	// propN means the expression never requires the top stack element to be
+	// zero when satisfied.
+	propN
+
+	// propD means the expression has an unconditional dissatisfaction.
+	propD
+
+	// propU means the expression pushes exactly one when satisfied.
+	propU
+
+	// propE means the expression has a unique unconditional
+	// dissatisfaction and all conditional ones require a signature.
+	propE
+
+	// propF means the expression is forced, that is, its dissatisfactions
+	// all require a signature.
+	propF
+
+	// propS means every satisfaction of the expression requires a
+	// signature.
+	propS
+
+	// propM means the expression has a non-malleable satisfaction for every
+	// combination of available signatures, preimages, and timelocks.
+	propM
+
+	// propG means the expression contains a relative time timelock.
+	propG
+
+	// propH means the expression contains a relative height timelock.
+	propH
+
+	// propI means the expression contains an absolute time timelock.
+	propI
+
+	// propJ means the expression contains an absolute height timelock.
+	propJ
+
+	// propK means no satisfaction of the expression requires both a
+	// height-based and a time-based timelock of the same kind.
+	propK
+)
+
+// basicTypes is the set of basic types.
+const basicTypes = typeB | typeV | typeK | typeW
+
+// timelockProps is the set of properties identifying the kinds of timelocks an
+// expression contains.
+const timelockProps = propG | propH | propI | propJ
+
+// typeLetters are the letters of the types and properties in the order they
+// are returned by typeProps.String.
+var typeLetters = []struct {
+	prop   typeProps
+	letter byte
+}{
+	{typeB, 'B'}, {typeV, 'V'}, {typeK, 'K'}, {typeW, 'W'},
+	{propZ, 'z'}, {propO, 'o'}, {propN, 'n'}, {propD, 'd'}, {propU, 'u'},
+	{propE, 'e'}, {propF, 'f'}, {propS, 's'}, {propM, 'm'},
+	{propG, 'g'}, {propH, 'h'}, {propI, 'i'}, {propJ, 'j'}, {propK, 'k'},
+}
+
+// String returns the letters of the basic type and properties in the set, such
+// as "Bzudemsk".
+func (t typeProps) String() string {
+	letters := make([]byte, 0, len(typeLetters))
+	for _, tl := range typeLetters {
+		if t&tl.prop != 0 {
+			letters = append(letters, tl.letter)
+		}
+	}
+	return string(letters)
+}
+
+// has returns whether or not all of the passed types and properties are in the
+// set.
+func (t typeProps) has(props typeProps) bool {
+	return t&props == props
+}
+
+// If returns the set when the passed condition is true and the empty set
+// otherwise.
+func (t typeProps) If(cond bool) typeProps {
+	if cond {
+		return t
+	}
+	return 0
+}
+
+// timelockMix returns whether or not the passed sets contain timelocks of the
+// same kind which use different units, which can't both be satisfied by a
+// single spend.
+func timelockMix(x, y typeProps) bool {
+	return (x.has(propG) && y.has(propH)) || (x.has(propH) && y.has(propG)) ||
+		(x.has(propI) && y.has(propJ)) || (x.has(propJ) && y.has(propI))
+}
+
+// typeError returns an error for a fragment whose argument does not have a
+// required type.
+func typeError(n *Node, i int, want string) error {
+	str := fmt.Sprintf("argument %d of %s must be %s, but it is %s", i+1,
+		fragmentNames[n.frag], want, n.subs[i].typ)
+	return miniscriptError(ErrTypeCheck, str)
+}
+
+// computeType returns the basic type and properties of the passed node, whose
+// arguments must already be typed.  It returns ErrTypeCheck when an argument
+// does not have a type the fragment requires.
+func computeType(n *Node) (typeProps, error) {
+	var x, y, z typeProps
+	if len(n.subs) > 0 {
+		x = n.subs[0].typ
+	}
+	if len(n.subs) > 1 {
+		y = n.subs[1].typ
+	}
+	if len(n.subs) > 2 {
+		z = n.subs[2].typ
+	}
+
+	switch n.frag {
+	case frag0:
+		return typeB | propZ | propU | propD | propE | propS | propM |
+			propK, nil
+
+	case frag1:
+		return typeB | propZ | propU | propF | propM | propK, nil
+
+	case fragPkK:
+		return typeK | propO | propN | propD | propU | propE | propS |
+			propM | propK, nil
+
+	case fragPkH:
+		return typeK | propN | propD | propU | propE | propS | propM |
+			propK, nil
+
+	case fragOlder:
+		t := typeB | propZ | propF | propM | propK
+		if n.k&wire.SequenceLockTimeIsSeconds != 0 {
+			return t | propG, nil
+		}
+		return t | propH, nil
+
+	case fragAfter:
+		t := typeB | propZ | propF | propM | propK
+		if n.k >= txscript.LockTimeThreshold {
+			return t | propI, nil
+		}
+		return t | propJ, nil
+
+	case fragSha256, fragHash256, fragRipemd160, fragHash160:
+		return typeB | propO | propN | propD | propU | propM | propK, nil
+
+	case fragMulti:
+		return typeB | propN | propD | propU | propE | propS | propM |
+			propK, nil
+
+	case fragWrapA:
+		if !x.has(typeB) {
+			return 0, typeError(n, 0, "B")
+		}
+		return typeW | x&(propD|propU|propE|propF|propS|propM|
+			timelockProps|propK), nil
+
+	case fragWrapS:
+		if !x.has(typeB | propO) {
+			return 0, typeError(n, 0, "Bo")
+		}
+		return typeW | x&(propD|propU|propE|propF|propS|propM|
+			timelockProps|propK), nil
+
+	case fragWrapC:
+		if !x.has(typeK) {
+			return 0, typeError(n, 0, "K")
+		}
+		return typeB | propU | propS | x&(propO|propN|propD|propE|
+			propF|propM|timelockProps|propK), nil
+
+	case fragWrapD:
+		if !x.has(typeV | propZ) {
+			return 0, typeError(n, 0, "Vz")
+		}
+		return typeB | propO | propN | propD | propE |
+			x&(propS|propM|timelockProps|propK), nil
+
+	case fragWrapV:
+		if !x.has(typeB) {
+			return 0, typeError(n, 0, "B")
+		}
+		return typeV | propF | x&(propZ|propO|propN|propS|propM|
+			timelockProps|propK), nil
+
+	case fragWrapJ:
+		if !x.has(typeB | propN) {
+			return 0, typeError(n, 0, "Bn")
+		}
+		return typeB | propN | propD | propE.If(x.has(propF)) |
+			x&(propO|propU|propS|propM|timelockProps|propK), nil
+
+	case fragWrapN:
+		if !x.has(typeB) {
+			return 0, typeError(n, 0, "B")
+		}
+		return typeB | propU | x&(propZ|propO|propN|propD|propE|
+			propF|propS|propM|timelockProps|propK), nil
+
+	case fragAndV:
+		if !x.has(typeV) {
+			return 0, typeError(n, 0, "V")
+		}
+		if y&(typeB|typeK|typeV) == 0 {
+			return 0, typeError(n, 1, "B, K, or V")
+		}
+		return y&(basicTypes|propU) |
+			propZ.If(x.has(propZ) && y.has(propZ)) |
+			propO.If((x.has(propZ) && y.has(propO)) ||
+				(x.has(propO) && y.has(propZ))) |
+			propN.If(x.has(propN) || (x.has(propZ) && y.has(propN))) |
+			propS.If(x.has(propS) || y.has(propS)) |
+			propF.If(x.has(propS) || y.has(propF)) |
+			propM.If(x.has(propM) && y.has(propM)) |
+			(x|y)&timelockProps |
+			propK.If(x.has(propK) && y.has(propK) &&
+				!timelockMix(x, y)), nil
+
+	case fragAndB:
+		if !x.has(typeB) {
+			return 0, typeError(n, 0, "B")
+		}
+		if !y.has(typeW) {
+			return 0, typeError(n, 1, "W")
+		}
+		return typeB | propU |
+			propZ.If(x.has(propZ) && y.has(propZ)) |
+			propO.If((x.has(propZ) && y.has(propO)) ||
+				(x.has(propO) && y.has(propZ))) |
+			propN.If(x.has(propN) || (x.has(propZ) && y.has(propN))) |
+			propD.If(x.has(propD) && y.has(propD)) |
+			propS.If(x.has(propS) || y.has(propS)) |
+			propF.If((x.has(propF) && y.has(propF)) ||
+				x.has(propS|propF) || y.has(propS|propF)) |
+			propE.If(x.has(propE|propS) && y.has(propE|propS)) |
+			propM.If(x.has(propM) && y.has(propM)) |
+			(x|y)&timelockProps |
+			propK.If(x.has(propK) && y.has(propK) &&
+				!timelockMix(x, y)), nil
+
+	case fragOrB:
+		if !x.has(typeB | propD) {
+			return 0, typeError(n, 0, "Bd")
+		}
+		if !y.has(typeW | propD) {
+			return 0, typeError(n, 1, "Wd")
+		}
+		return typeB | propD | propU |
+			propZ.If(x.has(propZ) && y.has(propZ)) |
+			propO.If((x.has(propZ) && y.has(propO)) ||
+				(x.has(propO) && y.has(propZ))) |
+			propS.If(x.has(propS) && y.has(propS)) |
+			propE.If(x.has(propE) && y.has(propE)) |
+			propM.If(x.has(propM|propE) && y.has(propM|propE) &&
+				(x.has(propS) || y.has(propS))) |
+			(x|y)&timelockProps |
+			propK.If(x.has(propK) && y.has(propK)), nil
+
+	case fragOrC:
+		if !x.has(typeB | propD | propU) {
+			return 0, typeError(n, 0, "Bdu")
+		}
+		if !y.has(typeV) {
+			return 0, typeError(n, 1, "V")
+		}
+		return typeV |
+			propZ.If(x.has(propZ) && y.has(propZ)) |
+			propO.If(x.has(propO) && y.has(propZ)) |
+			propS.If(x.has(propS) && y.has(propS)) |
+			propF.If(x.has(propE) && y.has(propF)) |
+			propM.If(x.has(propM|propE) && y.has(propM) &&
+				(x.has(propS) || y.has(propS))) |
+			(x|y)&timelockProps |
+			propK.If(x.has(propK) && y.has(propK)), nil
+
+	case fragOrD:
+		if !x.has(typeB | propD | propU) {
+			return 0, typeError(n, 0, "Bdu")
+		}
+		if !y.has(typeB) {
+			return 0, typeError(n, 1, "B")
+		}
+		return typeB | y&(propD|propU) |
+			propZ.If(x.has(propZ) && y.has(propZ)) |
+			propO.If(x.has(propO) && y.has(propZ)) |
+			propS.If(x.has(propS) && y.has(propS)) |
+			propF.If(x.has(propE) && y.has(propF)) |
+			propE.If(x.has(propE) && y.has(propE)) |
+			propM.If(x.has(propM|propE) && y.has(propM) &&
+				(x.has(propS) || y.has(propS))) |
+			(x|y)&timelockProps |
+			propK.If(x.has(propK) && y.has(propK)), nil
+
+	case fragOrI:
+		if x&(typeB|typeK|typeV) == 0 || x&basicTypes != y&basicTypes {
+			return 0, typeError(n, 1, fmt.Sprintf("of the same type "+
+				"B, K, or V as argument 1 (%s)", x))
+		}
+		return x&basicTypes |
+			propO.If(x.has(propZ) && y.has(propZ)) |
+			propU.If(x.has(propU) && y.has(propU)) |
+			propD.If(x.has(propD) || y.has(propD)) |
+			propS.If(x.has(propS) && y.has(propS)) |
+			propF.If(x.has(propF) && y.has(propF)) |
+			propE.If((x.has(propE) && y.has(propF)) ||
+				(x.has(propF) && y.has(propE))) |
+			propM.If(x.has(propM) && y.has(propM) &&
+				(x.has(propS) || y.has(propS))) |
+			(x|y)&timelockProps |
+			propK.If(x.has(propK) && y.has(propK)), nil
+
+	case fragAndOr:
+		if !x.has(typeB | propD | propU) {
+			return 0, typeError(n, 0, "Bdu")
+		}
+		if y&(typeB|typeK|typeV) == 0 || y&basicTypes != z&basicTypes {
+			return 0, typeError(n, 2, fmt.Sprintf("of the same type "+
+				"B, K, or V as argument 2 (%s)", y))
+		}
+		return y&basicTypes | z&propD |
+			propZ.If(x.has(propZ) && y.has(propZ) && z.has(propZ)) |
+			propO.If((x.has(propZ) && y.has(propO) && z.has(propO)) ||
+				(x.has(propO) && y.has(propZ) && z.has(propZ))) |
+			propU.If(y.has(propU) && z.has(propU)) |
+			propS.If(z.has(propS) && (x.has(propS) || y.has(propS))) |
+			propF.If(z.has(propF) && (x.has(propS) || y.has(propF))) |
+			propE.If(x.has(propE) && z.has(propE) &&
+				(x.has(propS) || y.has(propF))) |
+			propM.If(x.has(propM|propE) && y.has(propM) &&
+				z.has(propM) && (x.has(propS) || y.has(propS) ||
+				z.has(propS))) |
+			(x|y|z)&timelockProps |
+			propK.If(x.has(propK) && y.has(propK) && z.has(propK) &&
+				!timelockMix(x, y)), nil
+
+	case fragThresh:
+		var numS int
+		allE, allM, allK, allZ := true, true, true, true
+		var numO int
+		var timelocks typeProps
+		for i, sub := range n.subs {
+			want, wantStr := typeW|propD|propU, "Wdu"
+			if i == 0 {
+				want, wantStr = typeB|propD|propU, "Bdu"
+			}
+			if !sub.typ.has(want) {
+				return 0, typeError(n, i, wantStr)
+			}
+			if sub.typ.has(propS) {
+				numS++
+			}
+			allE = allE && sub.typ.has(propE)
+			allM = allM && sub.typ.has(propM)
+			allK = allK && sub.typ.has(propK)
+			if sub.typ.has(propO) {
+				numO++
+			} else if !sub.typ.has(propZ) {
+				allZ = false
+			}
+			if n.k > 1 && timelockMix(timelocks, sub.typ) {
+				allK = false
+			}
+			timelocks |= sub.typ & timelockProps
+		}
+		numSubs := len(n.subs)
+		return typeB | propD | propU | timelocks |
+			propZ.If(allZ && numO == 0) |
+			propO.If(allZ && numO == 1) |
+			propS.If(numS >= numSubs-int(n.k)+1) |
+			propE.If(allE && numS == numSubs) |
+			propM.If(allE && allM && numS >= numSubs-int(n.k)) |
+			propK.If(allK), nil
+	}
+
+	str := fmt.Sprintf("unknown fragment %d", n.frag)
+	return 0, miniscriptError(ErrUnknownFragment, str)
+}
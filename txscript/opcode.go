@@ -225,6 +225,7 @@ const (
 	OP_NOP9                = 0xb8 // 184
 	OP_NOP10               = 0xb9 // 185
 	OP_UNKNOWN186          = 0xba // 186
+	OP_CHECKSIGADD         = 0xba // 186 - AKA OP_UNKNOWN186
 	OP_UNKNOWN187          = 0xbb // 187
 	OP_UNKNOWN188          = 0xbc // 188
 	OP_UNKNOWN189          = 0xbd // 189
@@ -498,6 +499,7 @@ var opcodeArray = [256]opcode{
 	OP_CHECKSIGVERIFY:      {OP_CHECKSIGVERIFY, "OP_CHECKSIGVERIFY", 1, opcodeCheckSigVerify},
 	OP_CHECKMULTISIG:       {OP_CHECKMULTISIG, "OP_CHECKMULTISIG", 1, opcodeCheckMultiSig},
 	OP_CHECKMULTISIGVERIFY: {OP_CHECKMULTISIGVERIFY, "OP_CHECKMULTISIGVERIFY", 1, opcodeCheckMultiSigVerify},
+	OP_CHECKSIGADD:         {OP_CHECKSIGADD, "OP_CHECKSIGADD", 1, opcodeCheckSigAdd},
 
 	// Reserved opcodes.
 	OP_NOP1:  {OP_NOP1, "OP_NOP1", 1, opcodeNop},
@@ -510,7 +512,6 @@ var opcodeArray = [256]opcode{
 	OP_NOP10: {OP_NOP10, "OP_NOP10", 1, opcodeNop},
 
 	// Undefined opcodes.
-	OP_UNKNOWN186: {OP_UNKNOWN186, "OP_UNKNOWN186", 1, opcodeInvalid},
 	OP_UNKNOWN187: {OP_UNKNOWN187, "OP_UNKNOWN187", 1, opcodeInvalid},
 	OP_UNKNOWN188: {OP_UNKNOWN188, "OP_UNKNOWN188", 1, opcodeInvalid},
 	OP_UNKNOWN189: {OP_UNKNOWN189, "OP_UNKNOWN189", 1, opcodeInvalid},
@@ -670,6 +671,20 @@ func (pop *parsedOpcode) alwaysIllegal() bool {
 	}
 }
 
+// isOpSuccess returns whether or not the passed opcode is one of the OP_SUCCESSx
+// opcodes defined by BIP0342.  Tapscripts which contain any of them succeed
+// without being executed, which allows their semantics to be redefined by
+// future soft-forks.
+func isOpSuccess(opcode byte) bool {
+	return opcode == 80 || opcode == 98 ||
+		(opcode >= 126 && opcode <= 129) ||
+		(opcode >= 131 && opcode <= 134) ||
+		(opcode >= 137 && opcode <= 138) ||
+		(opcode >= 141 && opcode <= 142) ||
+		(opcode >= 149 && opcode <= 153) ||
+		(opcode >= 187 && opcode <= 254)
+}
+
 // isConditional returns whether or not the opcode is a conditional opcode which
 // changes the conditional execution stack when executed.
 func (pop *parsedOpcode) isConditional() bool {
@@ -923,18 +938,21 @@ func opcodeNop(op *parsedOpcode, vm *Engine) error {
 // of nuisance malleability, post-segwit for version 0 witness programs, we now
 // require the following: for OP_IF and OP_NOT_IF, the top stack item MUST
 // either be an empty byte slice, or [0x01]. Otherwise, the item at the top of
-// the stack will be popped and interpreted as a boolean.
+// the stack will be popped and interpreted as a boolean.  Within tapscripts,
+// the same requirement is a consensus rule regardless of the flag.
 func popIfBool(vm *Engine) (bool, error) {
 	// When not in witness execution mode, not executing a v0 witness
 	// program, or the minimal if flag isn't set pop the top stack item as
 	// a normal bool.
-	if !vm.isWitnessVersionActive(0) || !vm.hasFlag(ScriptVerifyMinimalIf) {
+	if !vm.isTapscript() && (!vm.isWitnessVersionActive(0) ||
+		!vm.hasFlag(ScriptVerifyMinimalIf)) {
+
 		return vm.dstack.PopBool()
 	}
 
 	// At this point, a v0 witness program is being executed and the minimal
-	// if flag is set, so enforce additional constraints on the top stack
-	// item.
+	// if flag is set, or a tapscript is being executed, so enforce
+	// additional constraints on the top stack item.
 	so, err := vm.dstack.PopByteArray()
 	if err != nil {
 		return false, err
@@ -2020,11 +2038,16 @@ func opcodeHash256(op *parsedOpcode, vm *Engine) error {
 }
 
 // opcodeCodeSeparator stores the current script offset as the most recently
-// seen OP_CODESEPARATOR which is used during signature checking.
+// seen OP_CODESEPARATOR which is used during signature checking.  Within
+// tapscripts, the position of the opcode itself is committed to by signatures
+// instead.
 //
 // This opcode does not change the contents of the data stack.
 func opcodeCodeSeparator(op *parsedOpcode, vm *Engine) error {
 	vm.lastCodeSep = vm.scriptOff
+	if vm.isTapscript() {
+		vm.taprootCtx.codeSepPos = uint32(vm.scriptOff - 1)
+	}
 	return nil
 }
 
@@ -2041,6 +2064,9 @@ func opcodeCodeSeparator(op *parsedOpcode, vm *Engine) error {
 // "script hash" is calculated, the signature is checked using standard
 // cryptographic methods against the provided public key.
 //
+// Within tapscripts, the signature is instead checked as a Schnorr signature of
+// the taproot signature hash as defined by BIP0342.
+//
 // Stack transformation: [... signature pubkey] -> [... bool]
 func opcodeCheckSig(op *parsedOpcode, vm *Engine) error {
 	pkBytes, err := vm.dstack.PopByteArray()
@@ -2053,6 +2079,15 @@ func opcodeCheckSig(op *parsedOpcode, vm *Engine) error {
 		return err
 	}
 
+	if vm.isTapscript() {
+		valid, err := vm.checkTapscriptSignature(fullSigBytes, pkBytes)
+		if err != nil {
+			return err
+		}
+		vm.dstack.PushBool(valid)
+		return nil
+	}
+
 	// The signature actually needs needs to be longer than this, but at
 	// least 1 byte is needed for the hash type below.  The full length is
 	// checked depending on the script flags and upon parsing the signature.
@@ -2091,15 +2126,9 @@ func opcodeCheckSig(op *parsedOpcode, vm *Engine) error {
 	// Generate the signature hash based on the signature hash type.
 	var hash []byte
 	if vm.isWitnessVersionActive(0) {
-		var sigHashes *TxSigHashes
-		if vm.hashCache != nil {
-			sigHashes = vm.hashCache
-		} else {
-			sigHashes = NewTxSigHashes(&vm.tx)
-		}
-
-		hash, err = calcWitnessSignatureHash(subScript, sigHashes, hashType,
-			&vm.tx, vm.txIdx, vm.inputAmount)
+		hash, err = calcWitnessSignatureHash(subScript,
+			vm.witnessSigHashes(), hashType, &vm.tx, vm.txIdx,
+			vm.inputAmount)
 		if err != nil {
 			return err
 		}
@@ -2131,17 +2160,17 @@ func opcodeCheckSig(op *parsedOpcode, vm *Engine) error {
 	}
 
 	var valid bool
-	if vm.sigCache != nil {
-		var sigHash chainhash.Hash
-		copy(sigHash[:], hash)
+	var sigHash chainhash.Hash
+	copy(sigHash[:], hash)
+	switch {
+	case vm.sigCache != nil && vm.sigCache.Exists(sigHash, signature, pubKey):
+		valid = true
 
-		valid = vm.sigCache.Exists(sigHash, signature, pubKey)
-		if !valid && signature.Verify(hash, pubKey) {
+	default:
+		valid = signature.Verify(hash, pubKey)
+		if valid && vm.sigCache != nil {
 			vm.sigCache.Add(sigHash, signature, pubKey)
-			valid = true
 		}
-	} else {
-		valid = signature.Verify(hash, pubKey)
 	}
 
 	if !valid && vm.hasFlag(ScriptVerifyNullFail) && len(sigBytes) > 0 {
@@ -2175,6 +2204,47 @@ type parsedSigInfo struct {
 	parsed          bool
 }
 
+// opcodeCheckSigAdd treats the top 3 items on the stack as a signature, an
+// integer, and a public key, and replaces them with the integer incremented by
+// one when the signature is not empty.  The signature is checked in the same
+// way as by OP_CHECKSIG within tapscripts, so any non-empty signature must be
+// valid.
+//
+// This opcode is only defined within tapscripts, where it replaces
+// OP_CHECKMULTISIG for multisig scripts.  Elsewhere it is invalid.
+//
+// Stack transformation: [... signature n pubkey] -> [... n+success]
+func opcodeCheckSigAdd(op *parsedOpcode, vm *Engine) error {
+	if !vm.isTapscript() {
+		return opcodeInvalid(op, vm)
+	}
+
+	pkBytes, err := vm.dstack.PopByteArray()
+	if err != nil {
+		return err
+	}
+
+	n, err := vm.dstack.PopInt()
+	if err != nil {
+		return err
+	}
+
+	sigBytes, err := vm.dstack.PopByteArray()
+	if err != nil {
+		return err
+	}
+
+	valid, err := vm.checkTapscriptSignature(sigBytes, pkBytes)
+	if err != nil {
+		return err
+	}
+	if valid {
+		n++
+	}
+	vm.dstack.PushInt(n)
+	return nil
+}
+
 // opcodeCheckMultiSig treats the top item on the stack as an integer number of
 // public keys, followed by that many entries as raw data representing the public
 // keys, followed by the integer number of signatures, followed by that many
@@ -2195,6 +2265,13 @@ type parsedSigInfo struct {
 // Stack transformation:
 // [... dummy [sig ...] numsigs [pubkey ...] numpubkeys] -> [... bool]
 func opcodeCheckMultiSig(op *parsedOpcode, vm *Engine) error {
+	// Tapscripts use OP_CHECKSIGADD for multisig instead.
+	if vm.isTapscript() {
+		str := fmt.Sprintf("%s is disabled within tapscripts",
+			op.opcode.name)
+		return scriptError(ErrTapscriptCheckMultisig, str)
+	}
+
 	numKeys, err := vm.dstack.PopInt()
 	if err != nil {
 		return err
@@ -2364,15 +2441,9 @@ func opcodeCheckMultiSig(op *parsedOpcode, vm *Engine) error {
 		// Generate the signature hash based on the signature hash type.
 		var hash []byte
 		if vm.isWitnessVersionActive(0) {
-			var sigHashes *TxSigHashes
-			if vm.hashCache != nil {
-				sigHashes = vm.hashCache
-			} else {
-				sigHashes = NewTxSigHashes(&vm.tx)
-			}
-
-			hash, err = calcWitnessSignatureHash(script, sigHashes, hashType,
-				&vm.tx, vm.txIdx, vm.inputAmount)
+			hash, err = calcWitnessSignatureHash(script,
+				vm.witnessSigHashes(), hashType, &vm.tx, vm.txIdx,
+				vm.inputAmount)
 			if err != nil {
 				return err
 			}
@@ -2434,9 +2505,10 @@ var OpcodeByName = make(map[string]byte)
 
 func init() {
 	// Initialize the opcode name to value map using the contents of the
-	// opcode array.  Also add entries for "OP_FALSE", "OP_TRUE", and
-	// "OP_NOP2" since they are aliases for "OP_0", "OP_1",
-	// and "OP_CHECKLOCKTIMEVERIFY" respectively.
+	// opcode array.  Also add entries for "OP_FALSE", "OP_TRUE",
+	// "OP_NOP2", "OP_NOP3", and "OP_UNKNOWN186" since they are aliases for
+	// "OP_0", "OP_1", "OP_CHECKLOCKTIMEVERIFY", "OP_CHECKSEQUENCEVERIFY",
+	// and "OP_CHECKSIGADD" respectively.
 	for _, op := range opcodeArray {
 		OpcodeByName[op.name] = op.value
 	}
@@ -2444,4 +2516,5 @@ func init() {
 	OpcodeByName["OP_TRUE"] = OP_TRUE
 	OpcodeByName["OP_NOP2"] = OP_CHECKLOCKTIMEVERIFY
 	OpcodeByName["OP_NOP3"] = OP_CHECKSEQUENCEVERIFY
+	OpcodeByName["OP_UNKNOWN186"] = OP_CHECKSIGADD
 }
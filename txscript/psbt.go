@@ -0,0 +1,385 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/ifishnet/hdfd/hdfec"
+	"github.com/ifishnet/hdfd/wire"
+	"github.com/ifishnet/hdfutil"
+)
+
+// Bip32Derivation describes how the public key of a signer involved in an
+// input is derived from a master key as defined by BIP0032.
+type Bip32Derivation struct {
+	// PubKey is the serialized public key which is derived.
+	PubKey []byte
+
+	// MasterKeyFingerprint is the fingerprint of the master key the public
+	// key is derived from.
+	MasterKeyFingerprint uint32
+
+	// Path is the derivation path of the public key from the master key.
+	Path []uint32
+}
+
+// PartialSig is a signature of an input by one of its signers which is
+// combined with the signatures of the other signers when the input is
+// finalized.
+type PartialSig struct {
+	// PubKey is the serialized public key the signature is valid for.
+	PubKey []byte
+
+	// Signature is the serialized ECDSA signature with the hash type
+	// appended to it.
+	Signature []byte
+}
+
+// PsbtInput houses the per-input information of a partially signed
+// transaction as defined by BIP0174 which is needed to sign and finalize the
+// input.
+type PsbtInput struct {
+	// Utxo is the output spent by the input.  Its value is committed to by
+	// the signatures of segwit inputs.
+	Utxo *wire.TxOut
+
+	// RedeemScript is the script committed to by a pay-to-script-hash
+	// output.
+	RedeemScript []byte
+
+	// WitnessScript is the script committed to by a
+	// pay-to-witness-script-hash program, either bare or nested in a
+	// pay-to-script-hash output.
+	WitnessScript []byte
+
+	// Derivations are the derivations of the public keys involved in the
+	// input.  Only the keys of the derivations are requested from the key
+	// provider when signing.
+	Derivations []*Bip32Derivation
+
+	// SigHashType is the hash type the input is signed with.  SigHashAll
+	// is used when it is zero.
+	SigHashType SigHashType
+
+	// PartialSigs are the signatures of the input collected so far.
+	PartialSigs []*PartialSig
+}
+
+// partialSig returns the signature for the passed public key collected so far,
+// or nil when there is none.
+func (in *PsbtInput) partialSig(pubKey []byte) []byte {
+	for _, ps := range in.PartialSigs {
+		if bytes.Equal(ps.PubKey, pubKey) {
+			return ps.Signature
+		}
+	}
+	return nil
+}
+
+// DerivedKeyDB is an interface type provided to SignPsbtInput, it encapsulates
+// any user state required to get the private keys of BIP0032 derivations.
+type DerivedKeyDB interface {
+	// GetDerivedKey returns the private key of the passed derivation, or
+	// nil when the key is not known so the input is not signed with it.
+	GetDerivedKey(*Bip32Derivation) (*hdfcec.PrivateKey, error)
+}
+
+// DerivedKeyClosure implements DerivedKeyDB with a closure.
+type DerivedKeyClosure func(*Bip32Derivation) (*hdfcec.PrivateKey, error)
+
+// GetDerivedKey implements DerivedKeyDB by returning the result of calling the
+// closure.
+func (kc DerivedKeyClosure) GetDerivedKey(derivation *Bip32Derivation) (*hdfcec.PrivateKey, error) {
+	return kc(derivation)
+}
+
+// psbtSpend houses the scripts involved in spending an input of a partially
+// signed transaction.
+type psbtSpend struct {
+	// script is the script the signatures of the input commit to, which is
+	// the witness script, the redeem script, or the spent output script.
+	script []byte
+	pops   []parsedOpcode
+	class  ScriptClass
+
+	// redeemScript and witnessScript are set when the spent output is a
+	// pay-to-script-hash and a pay-to-witness-script-hash, respectively.
+	redeemScript  []byte
+	witnessScript []byte
+
+	// segwit is whether the input is signed with the signature hash
+	// defined within BIP0143.
+	segwit bool
+}
+
+// newPsbtSpend returns the scripts involved in spending the passed input after
+// ensuring the redeem and witness scripts match the spent output and the
+// script the signatures commit to is of a supported template.
+func newPsbtSpend(input *PsbtInput) (*psbtSpend, error) {
+	if input.Utxo == nil {
+		return nil, scriptError(ErrInvalidPsbtInput,
+			"input does not have the output it spends")
+	}
+
+	var spend psbtSpend
+	script := input.Utxo.PkScript
+	if IsPayToScriptHash(script) {
+		if len(input.RedeemScript) == 0 {
+			return nil, scriptError(ErrInvalidPsbtInput,
+				"pay-to-script-hash input does not have a "+
+					"redeem script")
+		}
+		hash := hdfutil.Hash160(input.RedeemScript)
+		if !bytes.Equal(hash, script[2:22]) {
+			str := fmt.Sprintf("redeem script hash %x does not "+
+				"match the spent output script %x", hash, script)
+			return nil, scriptError(ErrInvalidPsbtInput, str)
+		}
+		spend.redeemScript = input.RedeemScript
+		script = input.RedeemScript
+	}
+
+	switch {
+	case IsPayToWitnessPubKeyHash(script):
+		spend.segwit = true
+
+	case IsPayToWitnessScriptHash(script):
+		if len(input.WitnessScript) == 0 {
+			return nil, scriptError(ErrInvalidPsbtInput,
+				"pay-to-witness-script-hash input does not "+
+					"have a witness script")
+		}
+		hash := sha256.Sum256(input.WitnessScript)
+		if !bytes.Equal(hash[:], script[2:]) {
+			str := fmt.Sprintf("witness script hash %x does not "+
+				"match the witness program %x", hash, script[2:])
+			return nil, scriptError(ErrInvalidPsbtInput, str)
+		}
+		spend.witnessScript = input.WitnessScript
+		spend.segwit = true
+		script = input.WitnessScript
+
+	case IsWitnessProgram(script):
+		str := fmt.Sprintf("signing witness program %x is not "+
+			"supported", script)
+		return nil, scriptError(ErrUnsupportedScriptTemplate, str)
+	}
+
+	pops, err := parseScript(script)
+	if err != nil {
+		return nil, err
+	}
+	class := typeOfScript(pops)
+	switch class {
+	case PubKeyTy, PubKeyHashTy, WitnessV0PubKeyHashTy, MultiSigTy:
+	default:
+		str := fmt.Sprintf("signing %s script %x is not supported",
+			class, script)
+		return nil, scriptError(ErrUnsupportedScriptTemplate, str)
+	}
+
+	spend.script = script
+	spend.pops = pops
+	spend.class = class
+	return &spend, nil
+}
+
+// involvesKey returns whether the passed serialized public key is able to sign
+// the script of the spend.
+func (s *psbtSpend) involvesKey(pubKey []byte) bool {
+	switch s.class {
+	case PubKeyTy:
+		return bytes.Equal(s.pops[0].data, pubKey)
+
+	case PubKeyHashTy:
+		return bytes.Equal(s.pops[2].data, hdfutil.Hash160(pubKey))
+
+	case WitnessV0PubKeyHashTy:
+		// Only compressed public keys are standard in witnesses.
+		return len(pubKey) == 33 &&
+			bytes.Equal(s.pops[1].data, hdfutil.Hash160(pubKey))
+
+	case MultiSigTy:
+		for _, pop := range s.pops[1 : len(s.pops)-2] {
+			if bytes.Equal(pop.data, pubKey) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SignPsbtInput signs input idx of the passed transaction with the keys of the
+// derivations of the passed input which are returned by the key database.
+// Derivations whose keys are not involved in the input, which already have a
+// partial signature, or whose key is not known to the key database are
+// skipped.  The new partial signatures are added to the input and returned.
+//
+// The passed sighashes are used to sign segwit inputs and are calculated when
+// nil.  Pay-to-pubkey, pay-to-pubkey-hash, and multisig scripts, either bare or
+// as the script committed to by a pay-to-script-hash or a version 0 witness
+// program, as well as pay-to-witness-pubkey-hash programs, either bare or
+// nested, are supported.  ErrUnsupportedScriptTemplate is returned for all
+// other scripts.
+func SignPsbtInput(tx *wire.MsgTx, idx int, input *PsbtInput,
+	sigHashes *TxSigHashes, kdb DerivedKeyDB) ([]*PartialSig, error) {
+
+	if idx < 0 || idx >= len(tx.TxIn) {
+		str := fmt.Sprintf("transaction input index %d is negative or "+
+			">= %d", idx, len(tx.TxIn))
+		return nil, scriptError(ErrInvalidIndex, str)
+	}
+
+	spend, err := newPsbtSpend(input)
+	if err != nil {
+		return nil, err
+	}
+
+	hashType := input.SigHashType
+	if hashType == 0 {
+		hashType = SigHashAll
+	}
+	if spend.segwit && sigHashes == nil {
+		sigHashes = NewTxSigHashes(tx)
+	}
+
+	var sigs []*PartialSig
+	for _, derivation := range input.Derivations {
+		if !spend.involvesKey(derivation.PubKey) ||
+			input.partialSig(derivation.PubKey) != nil {
+
+			continue
+		}
+
+		key, err := kdb.GetDerivedKey(derivation)
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			continue
+		}
+
+		// Ensure the key belongs to the derivation since a signature
+		// by any other key can't be used to spend the input.
+		pubKey := key.PubKey()
+		if !bytes.Equal(pubKey.SerializeCompressed(), derivation.PubKey) &&
+			!bytes.Equal(pubKey.SerializeUncompressed(),
+				derivation.PubKey) {
+
+			str := fmt.Sprintf("private key does not belong to "+
+				"derived public key %x", derivation.PubKey)
+			return nil, scriptError(ErrInvalidPsbtInput, str)
+		}
+
+		var sig []byte
+		if spend.segwit {
+			sig, err = RawTxInWitnessSignature(tx, sigHashes, idx,
+				input.Utxo.Value, spend.script, hashType, key)
+		} else {
+			sig, err = RawTxInSignature(tx, idx, spend.script,
+				hashType, key)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		partialSig := &PartialSig{
+			PubKey:    derivation.PubKey,
+			Signature: sig,
+		}
+		input.PartialSigs = append(input.PartialSigs, partialSig)
+		sigs = append(sigs, partialSig)
+	}
+
+	return sigs, nil
+}
+
+// FinalizePsbtInput assembles the signature script and witness which spend the
+// passed input from its partial signatures.  ErrIncompletePsbtInput is
+// returned when there are not enough partial signatures.  The signatures are
+// not verified, so the caller should execute the resulting scripts to ensure
+// they are valid.
+func FinalizePsbtInput(input *PsbtInput) ([]byte, wire.TxWitness, error) {
+	spend, err := newPsbtSpend(input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var items [][]byte
+	switch spend.class {
+	case PubKeyTy:
+		sig := input.partialSig(spend.pops[0].data)
+		if sig == nil {
+			return nil, nil, scriptError(ErrIncompletePsbtInput,
+				"input does not have a signature for its "+
+					"public key")
+		}
+		items = [][]byte{sig}
+
+	case PubKeyHashTy, WitnessV0PubKeyHashTy:
+		for _, ps := range input.PartialSigs {
+			if spend.involvesKey(ps.PubKey) {
+				items = [][]byte{ps.Signature, ps.PubKey}
+				break
+			}
+		}
+		if items == nil {
+			return nil, nil, scriptError(ErrIncompletePsbtInput,
+				"input does not have a signature for its "+
+					"public key hash")
+		}
+
+	case MultiSigTy:
+		// The signatures must be in the order of the public keys.  An
+		// additional empty item is needed due to the original bitcoind
+		// bug where OP_CHECKMULTISIG pops an additional item from the
+		// stack.
+		nRequired := asSmallInt(spend.pops[0].opcode)
+		items = make([][]byte, 1, nRequired+1)
+		for _, pop := range spend.pops[1 : len(spend.pops)-2] {
+			if len(items) == nRequired+1 {
+				break
+			}
+			if sig := input.partialSig(pop.data); sig != nil {
+				items = append(items, sig)
+			}
+		}
+		if len(items) != nRequired+1 {
+			str := fmt.Sprintf("input has %d of %d required "+
+				"signatures", len(items)-1, nRequired)
+			return nil, nil, scriptError(ErrIncompletePsbtInput, str)
+		}
+	}
+
+	// Witness programs are satisfied by the witness while the signature
+	// script only pushes the redeem script when they are nested.
+	var witness wire.TxWitness
+	builder := NewScriptBuilder()
+	if spend.segwit {
+		witness = items
+		if spend.witnessScript != nil {
+			witness = append(witness, spend.witnessScript)
+		}
+	} else {
+		for _, item := range items {
+			builder.AddData(item)
+		}
+	}
+	if spend.redeemScript != nil {
+		builder.AddData(spend.redeemScript)
+	}
+	sigScript, err := builder.Script()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(sigScript) == 0 {
+		sigScript = nil
+	}
+
+	return sigScript, witness, nil
+}
@@ -0,0 +1,239 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/hdfec"
+	"github.com/ifishnet/hdfd/wire"
+	"github.com/ifishnet/hdfutil"
+)
+
+// TestSignPsbtInput ensures inputs of the supported templates are signed with
+// the keys of their derivations, that inputs signed by multiple parties are
+// only finalized once enough partial signatures are collected, and that the
+// finalized scripts are valid.
+func TestSignPsbtInput(t *testing.T) {
+	t.Parallel()
+
+	// Create the keys of three signers along with their derivations.
+	var keys []*hdfcec.PrivateKey
+	var derivations []*Bip32Derivation
+	for i := 0; i < 3; i++ {
+		seed := chainhash.HashB([]byte{byte(i)})
+		key, pubKey := hdfcec.PrivKeyFromBytes(hdfcec.S256(), seed)
+		keys = append(keys, key)
+		derivations = append(derivations, &Bip32Derivation{
+			PubKey:               pubKey.SerializeCompressed(),
+			MasterKeyFingerprint: 0x01020304,
+			Path:                 []uint32{0x80000054, 0x80000000, uint32(i)},
+		})
+	}
+	keyDB := func(known ...int) DerivedKeyDB {
+		return DerivedKeyClosure(func(d *Bip32Derivation) (*hdfcec.PrivateKey, error) {
+			for _, i := range known {
+				if d == derivations[i] {
+					return keys[i], nil
+				}
+			}
+			return nil, nil
+		})
+	}
+
+	pubKey := derivations[0].PubKey
+	pubKeyHash := hdfutil.Hash160(pubKey)
+	p2pk, _ := payToPubKeyScript(pubKey)
+	p2pkh, _ := payToPubKeyHashScript(pubKeyHash)
+	p2wpkh, _ := payToWitnessPubKeyHashScript(pubKeyHash)
+	p2shP2wpkh, _ := payToScriptHashScript(hdfutil.Hash160(p2wpkh))
+	multiSig, _ := NewScriptBuilder().AddOp(OP_2).
+		AddData(derivations[0].PubKey).AddData(derivations[1].PubKey).
+		AddData(derivations[2].PubKey).AddOp(OP_3).
+		AddOp(OP_CHECKMULTISIG).Script()
+	multiSigHash := sha256.Sum256(multiSig)
+	p2wsh, _ := payToWitnessScriptHashScript(multiSigHash[:])
+	p2sh, _ := payToScriptHashScript(hdfutil.Hash160(multiSig))
+	p2shP2wsh, _ := payToScriptHashScript(hdfutil.Hash160(p2wsh))
+
+	tests := []struct {
+		name          string
+		pkScript      []byte
+		redeemScript  []byte
+		witnessScript []byte
+		signers       [][]int // key indexes of each signing round
+		numSigs       int
+	}{{
+		name:     "p2pk",
+		pkScript: p2pk,
+		signers:  [][]int{{0}},
+		numSigs:  1,
+	}, {
+		name:     "p2pkh",
+		pkScript: p2pkh,
+		signers:  [][]int{{0}},
+		numSigs:  1,
+	}, {
+		name:     "p2wpkh",
+		pkScript: p2wpkh,
+		signers:  [][]int{{0, 1, 2}},
+		numSigs:  1,
+	}, {
+		name:         "p2sh-p2wpkh",
+		pkScript:     p2shP2wpkh,
+		redeemScript: p2wpkh,
+		signers:      [][]int{{0}},
+		numSigs:      1,
+	}, {
+		name:         "p2sh multisig",
+		pkScript:     p2sh,
+		redeemScript: multiSig,
+		signers:      [][]int{{2}, {0}},
+		numSigs:      2,
+	}, {
+		name:          "p2wsh multisig",
+		pkScript:      p2wsh,
+		witnessScript: multiSig,
+		signers:       [][]int{{1}, {1, 2}},
+		numSigs:       2,
+	}, {
+		name:          "p2sh-p2wsh multisig with all signers",
+		pkScript:      p2shP2wsh,
+		redeemScript:  p2wsh,
+		witnessScript: multiSig,
+		signers:       [][]int{{0, 1, 2}},
+		numSigs:       3,
+	}}
+
+	for _, test := range tests {
+		tx := wire.NewMsgTx(2)
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil, nil))
+		tx.AddTxOut(wire.NewTxOut(90000, p2pkh))
+
+		input := &PsbtInput{
+			Utxo:          wire.NewTxOut(100000, test.pkScript),
+			RedeemScript:  test.redeemScript,
+			WitnessScript: test.witnessScript,
+			Derivations:   derivations,
+		}
+		for round, signers := range test.signers {
+			_, err := SignPsbtInput(tx, 0, input, nil, keyDB(signers...))
+			if err != nil {
+				t.Fatalf("%s: round %d: unexpected signing error: %v",
+					test.name, round, err)
+			}
+
+			// All but the last round must leave the input incomplete.
+			_, _, err = FinalizePsbtInput(input)
+			if round < len(test.signers)-1 {
+				if !IsErrorCode(err, ErrIncompletePsbtInput) {
+					t.Fatalf("%s: round %d: unexpected "+
+						"finalize error: %v", test.name,
+						round, err)
+				}
+			} else if err != nil {
+				t.Fatalf("%s: unexpected finalize error: %v",
+					test.name, err)
+			}
+		}
+		if len(input.PartialSigs) != test.numSigs {
+			t.Fatalf("%s: got %d partial signatures, want %d",
+				test.name, len(input.PartialSigs), test.numSigs)
+		}
+
+		sigScript, witness, err := FinalizePsbtInput(input)
+		if err != nil {
+			t.Fatalf("%s: unexpected finalize error: %v", test.name,
+				err)
+		}
+		tx.TxIn[0].SignatureScript = sigScript
+		tx.TxIn[0].Witness = witness
+
+		vm, err := NewEngine(test.pkScript, tx, 0, StandardVerifyFlags,
+			nil, nil, input.Utxo.Value)
+		if err != nil {
+			t.Fatalf("%s: unable to create engine: %v", test.name,
+				err)
+		}
+		if err := vm.Execute(); err != nil {
+			t.Fatalf("%s: finalized input is invalid: %v",
+				test.name, err)
+		}
+	}
+}
+
+// TestSignPsbtInputErrors ensures inputs which do not have the scripts they
+// commit to, or whose scripts are not supported, are rejected.
+func TestSignPsbtInputErrors(t *testing.T) {
+	t.Parallel()
+
+	pubKeyHash := make([]byte, 20)
+	p2wpkh, _ := payToWitnessPubKeyHashScript(pubKeyHash)
+	p2sh, _ := payToScriptHashScript(hdfutil.Hash160(p2wpkh))
+	p2wsh, _ := payToWitnessScriptHashScript(make([]byte, 32))
+	p2tr, _ := payToWitnessTaprootScript(make([]byte, 32))
+
+	tests := []struct {
+		name  string
+		input *PsbtInput
+		err   ErrorCode
+	}{{
+		name:  "no spent output",
+		input: &PsbtInput{},
+		err:   ErrInvalidPsbtInput,
+	}, {
+		name:  "p2sh without redeem script",
+		input: &PsbtInput{Utxo: wire.NewTxOut(1, p2sh)},
+		err:   ErrInvalidPsbtInput,
+	}, {
+		name: "p2sh with mismatched redeem script",
+		input: &PsbtInput{
+			Utxo:         wire.NewTxOut(1, p2sh),
+			RedeemScript: []byte{OP_TRUE},
+		},
+		err: ErrInvalidPsbtInput,
+	}, {
+		name: "p2wsh with mismatched witness script",
+		input: &PsbtInput{
+			Utxo:          wire.NewTxOut(1, p2wsh),
+			WitnessScript: []byte{OP_TRUE},
+		},
+		err: ErrInvalidPsbtInput,
+	}, {
+		name:  "p2tr",
+		input: &PsbtInput{Utxo: wire.NewTxOut(1, p2tr)},
+		err:   ErrUnsupportedScriptTemplate,
+	}, {
+		name:  "nonstandard script",
+		input: &PsbtInput{Utxo: wire.NewTxOut(1, []byte{OP_TRUE})},
+		err:   ErrUnsupportedScriptTemplate,
+	}}
+
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+	keyDB := DerivedKeyClosure(func(*Bip32Derivation) (*hdfcec.PrivateKey, error) {
+		return nil, nil
+	})
+	for _, test := range tests {
+		_, err := SignPsbtInput(tx, 0, test.input, nil, keyDB)
+		if !IsErrorCode(err, test.err) {
+			t.Errorf("%s: unexpected signing error: got %v, want %v",
+				test.name, err, test.err)
+		}
+		_, _, err = FinalizePsbtInput(test.input)
+		if !IsErrorCode(err, test.err) {
+			t.Errorf("%s: unexpected finalize error: got %v, want %v",
+				test.name, err, test.err)
+		}
+	}
+
+	_, err := SignPsbtInput(tx, 1, &PsbtInput{}, nil, keyDB)
+	if !IsErrorCode(err, ErrInvalidIndex) {
+		t.Errorf("out of range index: unexpected error: got %v, want %v",
+			err, ErrInvalidIndex)
+	}
+}
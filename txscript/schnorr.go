@@ -0,0 +1,110 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"math/big"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/hdfec"
+)
+
+const (
+	// schnorrPubKeySize is the size of a BIP0340 x-only public key.
+	schnorrPubKeySize = 32
+
+	// schnorrSigSize is the size of a BIP0340 Schnorr signature.
+	schnorrSigSize = 64
+)
+
+var (
+	// tagBIP0340Challenge is the tag of the hash used to compute the
+	// challenge of a BIP0340 Schnorr signature.
+	tagBIP0340Challenge = []byte("BIP0340/challenge")
+
+	// curveB is the constant b of the secp256k1 curve equation
+	// y^2 = x^3 + b.
+	curveB = big.NewInt(7)
+)
+
+// liftX returns the point on the secp256k1 curve with the passed x coordinate
+// and an even y coordinate as defined by BIP0340.  It returns false when x is
+// not a valid field element or there is no point with the x coordinate.
+func liftX(x *big.Int) (*big.Int, *big.Int, bool) {
+	curve := hdfcec.S256()
+	if x.Sign() < 0 || x.Cmp(curve.P) >= 0 {
+		return nil, nil, false
+	}
+
+	// Solve y^2 = x^3 + 7 for y.  Since p = 3 mod 4, the square root, if
+	// there is one, is c^((p+1)/4).
+	c := new(big.Int).Exp(x, big.NewInt(3), curve.P)
+	c.Add(c, curveB)
+	c.Mod(c, curve.P)
+	y := new(big.Int).Exp(c, curve.QPlus1Div4(), curve.P)
+	if new(big.Int).Exp(y, big.NewInt(2), curve.P).Cmp(c) != 0 {
+		return nil, nil, false
+	}
+	if y.Bit(0) == 1 {
+		y.Sub(curve.P, y)
+	}
+	return x, y, true
+}
+
+// parseSchnorrPubKey parses the passed BIP0340 x-only public key and returns
+// the point it represents.
+func parseSchnorrPubKey(pubKey []byte) (*big.Int, *big.Int, bool) {
+	if len(pubKey) != schnorrPubKeySize {
+		return nil, nil, false
+	}
+	return liftX(new(big.Int).SetBytes(pubKey))
+}
+
+// serializeSchnorrPubKey returns the BIP0340 x-only serialization of the point
+// with the passed x coordinate.
+func serializeSchnorrPubKey(x *big.Int) []byte {
+	var pubKey [schnorrPubKeySize]byte
+	b := x.Bytes()
+	copy(pubKey[schnorrPubKeySize-len(b):], b)
+	return pubKey[:]
+}
+
+// verifySchnorr returns whether or not the passed signature is a valid BIP0340
+// Schnorr signature of the passed 32-byte message by the passed x-only public
+// key.
+func verifySchnorr(sig, msg, pubKey []byte) bool {
+	if len(sig) != schnorrSigSize || len(msg) != chainhash.HashSize {
+		return false
+	}
+	px, py, ok := parseSchnorrPubKey(pubKey)
+	if !ok {
+		return false
+	}
+
+	curve := hdfcec.S256()
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	if r.Cmp(curve.P) >= 0 || s.Cmp(curve.N) >= 0 {
+		return false
+	}
+
+	// e = int(hash_BIP0340/challenge(bytes(r) || bytes(P) || m)) mod n
+	challenge := taggedHash(tagBIP0340Challenge, sig[:32], pubKey, msg)
+	e := new(big.Int).SetBytes(challenge[:])
+	e.Mod(e, curve.N)
+
+	// R = s*G - e*P
+	sx, sy := curve.ScalarBaseMult(s.Bytes())
+	e.Sub(curve.N, e)
+	ex, ey := curve.ScalarMult(px, py, e.Bytes())
+	rx, ry := curve.Add(sx, sy, ex, ey)
+
+	// The signature is only valid when R is not the point at infinity, has
+	// an even y coordinate, and its x coordinate is r.
+	if rx.Sign() == 0 && ry.Sign() == 0 {
+		return false
+	}
+	return ry.Bit(0) == 0 && rx.Cmp(r) == 0
+}
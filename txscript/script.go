@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/hdfec"
 	"github.com/ifishnet/hdfd/wire"
 )
 
@@ -554,6 +555,41 @@ func CalcWitnessSigHash(script []byte, sigHashes *TxSigHashes, hType SigHashType
 		amt)
 }
 
+// VerifyWitnessSignature returns whether the passed serialized signature, with
+// the hash type appended to it, is a valid BIP0143 signature of the specified
+// input of the transaction by the passed serialized public key.  The passed
+// sighash midstate is shared with the signing functions and the script engine,
+// so a single instance may be used to sign and verify every input of a
+// transaction.  When it is nil, it is computed for this call only.
+func VerifyWitnessSignature(tx *wire.MsgTx, sigHashes *TxSigHashes, idx int,
+	amt int64, subScript, sig, pubKey []byte) (bool, error) {
+
+	if len(sig) == 0 {
+		return false, fmt.Errorf("empty signature")
+	}
+	hashType := SigHashType(sig[len(sig)-1])
+	parsedSig, err := hdfcec.ParseDERSignature(sig[:len(sig)-1],
+		hdfcec.S256())
+	if err != nil {
+		return false, err
+	}
+	parsedPubKey, err := hdfcec.ParsePubKey(pubKey, hdfcec.S256())
+	if err != nil {
+		return false, err
+	}
+
+	if sigHashes == nil {
+		sigHashes = NewTxSigHashes(tx)
+	}
+	hash, err := CalcWitnessSigHash(subScript, sigHashes, hashType, tx, idx,
+		amt)
+	if err != nil {
+		return false, err
+	}
+
+	return parsedSig.Verify(hash, parsedPubKey), nil
+}
+
 // shallowCopyTx creates a shallow copy of the transaction for use when
 // calculating the signature hash.  It is used over the Copy method on the
 // transaction itself since that is a deep copy and therefore does more work and
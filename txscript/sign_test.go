@@ -1714,3 +1714,80 @@ nexttest:
 		}
 	}
 }
+
+// TestWitnessSignatureSharedSigHashes ensures that a single sighash midstate
+// can be shared to sign and verify every pay-to-witness-pubkey-hash input of a
+// transaction both standalone and with the script engine.
+func TestWitnessSignatureSharedSigHashes(t *testing.T) {
+	t.Parallel()
+
+	key, err := hdfcec.NewPrivateKey(hdfcec.S256())
+	if err != nil {
+		t.Fatalf("failed to make privKey: %v", err)
+	}
+	pubKey := key.PubKey().SerializeCompressed()
+	addr, err := hdfutil.NewAddressWitnessPubKeyHash(
+		hdfutil.Hash160(pubKey), &chaincfg.TestNet3Params)
+	if err != nil {
+		t.Fatalf("failed to make address: %v", err)
+	}
+	pkScript, err := PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("failed to make pkscript: %v", err)
+	}
+
+	tx := wire.NewMsgTx(2)
+	for i := 0; i < 3; i++ {
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{Index: uint32(i)},
+			Sequence:         wire.MaxTxInSequenceNum,
+		})
+	}
+	tx.AddTxOut(wire.NewTxOut(1, nil))
+
+	const amt = 100000
+	sigHashes := NewTxSigHashes(tx)
+	for i, txIn := range tx.TxIn {
+		txIn.Witness, err = WitnessSignature(tx, sigHashes, i, amt,
+			pkScript, SigHashAll, key, true)
+		if err != nil {
+			t.Fatalf("failed to sign input %d: %v", i, err)
+		}
+	}
+
+	for i, txIn := range tx.TxIn {
+		for _, hashes := range []*TxSigHashes{sigHashes, nil} {
+			valid, err := VerifyWitnessSignature(tx, hashes, i, amt,
+				pkScript, txIn.Witness[0], txIn.Witness[1])
+			if err != nil {
+				t.Fatalf("failed to verify input %d: %v", i, err)
+			}
+			if !valid {
+				t.Fatalf("signature of input %d is invalid", i)
+			}
+		}
+
+		// The signature must not verify for a different amount.
+		valid, err := VerifyWitnessSignature(tx, sigHashes, i, amt+1,
+			pkScript, txIn.Witness[0], txIn.Witness[1])
+		if err != nil {
+			t.Fatalf("failed to verify input %d: %v", i, err)
+		}
+		if valid {
+			t.Fatalf("signature of input %d is valid for the wrong "+
+				"amount", i)
+		}
+
+		flags := ScriptBip16 | ScriptVerifyWitness
+		for _, hashes := range []*TxSigHashes{sigHashes, nil} {
+			vm, err := NewEngine(pkScript, tx, i, flags, nil, hashes,
+				amt)
+			if err != nil {
+				t.Fatalf("failed to create engine: %v", err)
+			}
+			if err := vm.Execute(); err != nil {
+				t.Fatalf("failed to execute input %d: %v", i, err)
+			}
+		}
+	}
+}
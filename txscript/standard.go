@@ -14,7 +14,9 @@ import (
 
 const (
 	// MaxDataCarrierSize is the maximum number of bytes allowed in pushed
-	// data to be considered a nulldata transaction
+	// data to be considered a nulldata transaction by default.  See
+	// GetScriptClassWithDataCarrierSize to classify scripts with a
+	// different limit.
 	MaxDataCarrierSize = 80
 
 	// StandardVerifyFlags are the script flags which are used when
@@ -58,6 +60,8 @@ const (
 	WitnessV0ScriptHashTy                    // Pay to witness script hash.
 	MultiSigTy                               // Multi signature.
 	NullDataTy                               // Empty data-only (provably prunable).
+	WitnessV1TaprootTy                       // Pay to taproot.
+	WitnessUnknownTy                         // Pay to unknown witness version.
 )
 
 // scriptClassToName houses the human-readable strings which describe each
@@ -71,6 +75,8 @@ var scriptClassToName = []string{
 	WitnessV0ScriptHashTy: "witness_v0_scripthash",
 	MultiSigTy:            "multisig",
 	NullDataTy:            "nulldata",
+	WitnessV1TaprootTy:    "witness_v1_taproot",
+	WitnessUnknownTy:      "witness_unknown",
 }
 
 // String implements the Stringer interface by returning the name of
@@ -138,27 +144,55 @@ func isMultiSig(pops []parsedOpcode) bool {
 	return true
 }
 
-// isNullData returns true if the passed script is a null data transaction,
-// false otherwise.
-func isNullData(pops []parsedOpcode) bool {
-	// A nulldata transaction is either a single OP_RETURN or an
-	// OP_RETURN SMALLDATA (where SMALLDATA is a data push up to
-	// MaxDataCarrierSize bytes).
-	l := len(pops)
-	if l == 1 && pops[0].opcode.value == OP_RETURN {
-		return true
+// isNullData returns true if the passed script is a null data transaction
+// which carries at most maxDataCarrierSize bytes of data, false otherwise.
+func isNullData(pops []parsedOpcode, maxDataCarrierSize int) bool {
+	// A nulldata transaction is an OP_RETURN followed by any number of
+	// data pushes, including small integers, where the pushed data is up
+	// to maxDataCarrierSize bytes in total.
+	if len(pops) == 0 || pops[0].opcode.value != OP_RETURN {
+		return false
+	}
+	if !isPushOnly(pops[1:]) {
+		return false
 	}
 
-	return l == 2 &&
-		pops[0].opcode.value == OP_RETURN &&
-		(isSmallInt(pops[1].opcode) || pops[1].opcode.value <=
-			OP_PUSHDATA4) &&
-		len(pops[1].data) <= MaxDataCarrierSize
+	var size int
+	for _, pop := range pops[1:] {
+		size += len(pop.data)
+	}
+	return size <= maxDataCarrierSize
+}
+
+// isWitnessTaproot returns true if the passed script is a pay-to-taproot
+// transaction, false otherwise.
+func isWitnessTaproot(pops []parsedOpcode) bool {
+	return len(pops) == 2 &&
+		pops[0].opcode.value == OP_1 &&
+		pops[1].opcode.value == OP_DATA_32
+}
+
+// isWitnessUnknown returns true if the passed script is a witness program of a
+// version that is not yet defined, false otherwise.  Version 1 programs which
+// are not 32 bytes are unknown as well since only 32-byte programs are
+// interpreted as taproot outputs.
+func isWitnessUnknown(pops []parsedOpcode) bool {
+	return isWitnessProgram(pops) && pops[0].opcode.value != OP_0 &&
+		!isWitnessTaproot(pops)
 }
 
 // scriptType returns the type of the script being inspected from the known
 // standard types.
 func typeOfScript(pops []parsedOpcode) ScriptClass {
+	return typeOfScriptWithDataCarrierSize(pops, MaxDataCarrierSize)
+}
+
+// typeOfScriptWithDataCarrierSize returns the type of the script being
+// inspected from the known standard types where null data scripts may carry up
+// to the passed number of bytes.
+func typeOfScriptWithDataCarrierSize(pops []parsedOpcode,
+	maxDataCarrierSize int) ScriptClass {
+
 	if isPubkey(pops) {
 		return PubKeyTy
 	} else if isPubkeyHash(pops) {
@@ -171,7 +205,11 @@ func typeOfScript(pops []parsedOpcode) ScriptClass {
 		return WitnessV0ScriptHashTy
 	} else if isMultiSig(pops) {
 		return MultiSigTy
-	} else if isNullData(pops) {
+	} else if isWitnessTaproot(pops) {
+		return WitnessV1TaprootTy
+	} else if isWitnessUnknown(pops) {
+		return WitnessUnknownTy
+	} else if isNullData(pops, maxDataCarrierSize) {
 		return NullDataTy
 	}
 	return NonStandardTy
@@ -188,6 +226,21 @@ func GetScriptClass(script []byte) ScriptClass {
 	return typeOfScript(pops)
 }
 
+// GetScriptClassWithDataCarrierSize returns the class of the script passed
+// where null data scripts may carry up to maxDataCarrierSize bytes of data in
+// total, which allows callers to enforce a data carrier policy other than the
+// default MaxDataCarrierSize.  A size of zero only classifies null data
+// scripts which do not carry any data.
+//
+// NonStandardTy will be returned when the script does not parse.
+func GetScriptClassWithDataCarrierSize(script []byte, maxDataCarrierSize int) ScriptClass {
+	pops, err := parseScript(script)
+	if err != nil {
+		return NonStandardTy
+	}
+	return typeOfScriptWithDataCarrierSize(pops, maxDataCarrierSize)
+}
+
 // expectedInputs returns the number of arguments required by a script.
 // If the script is of unknown type such that the number can not be determined
 // then -1 is returned. We are an internal function and thus assume that class
@@ -212,6 +265,11 @@ func expectedInputs(pops []parsedOpcode, class ScriptClass) int {
 		// Not including script.  That is handled by the caller.
 		return 1
 
+	case WitnessV1TaprootTy:
+		// Only a key path spend, which requires a single signature, can
+		// be determined from the script.
+		return 1
+
 	case MultiSigTy:
 		// Standard multisig has a push a small number for the number
 		// of sigs and number of keys.  Check the first push instruction
@@ -222,7 +280,7 @@ func expectedInputs(pops []parsedOpcode, class ScriptClass) int {
 		// for the extra push that is required to compensate.
 		return asSmallInt(pops[0].opcode) + 1
 
-	case NullDataTy:
+	case NullDataTy, WitnessUnknownTy:
 		fallthrough
 	default:
 		return -1
@@ -410,6 +468,12 @@ func payToWitnessScriptHashScript(scriptHash []byte) ([]byte, error) {
 	return NewScriptBuilder().AddOp(OP_0).AddData(scriptHash).Script()
 }
 
+// payToWitnessTaprootScript creates a new script to pay to a version 1
+// (taproot) witness program.  The passed output key is expected to be valid.
+func payToWitnessTaprootScript(outputKey []byte) ([]byte, error) {
+	return NewScriptBuilder().AddOp(OP_1).AddData(outputKey).Script()
+}
+
 // payToPubkeyScript creates a new script to pay a transaction output to a
 // public key. It is expected that the input is a valid pubkey.
 func payToPubKeyScript(serializedPubKey []byte) ([]byte, error) {
@@ -456,6 +520,12 @@ func PayToAddrScript(addr hdfutil.Address) ([]byte, error) {
 				nilAddrErrStr)
 		}
 		return payToWitnessScriptHashScript(addr.ScriptAddress())
+	case *AddressTaproot:
+		if addr == nil {
+			return nil, scriptError(ErrUnsupportedAddress,
+				nilAddrErrStr)
+		}
+		return payToWitnessTaprootScript(addr.ScriptAddress())
 	}
 
 	str := fmt.Sprintf("unable to generate payment script for unsupported "+
@@ -593,6 +663,17 @@ func ExtractPkScriptAddrs(pkScript []byte, chainParams *chaincfg.Params) (Script
 			addrs = append(addrs, addr)
 		}
 
+	case WitnessV1TaprootTy:
+		// A pay-to-taproot script is of the form:
+		//  OP_1 <32-byte output key>
+		// Therefore, the output key is the second item on the stack.
+		// Skip the output key if it's invalid for some reason.
+		requiredSigs = 1
+		addr, err := NewAddressTaproot(pops[1].data, chainParams)
+		if err == nil {
+			addrs = append(addrs, addr)
+		}
+
 	case MultiSigTy:
 		// A multi-signature script is of the form:
 		//  <numsigs> <pubkey> <pubkey> <pubkey>... <numpubkeys> OP_CHECKMULTISIG
@@ -616,6 +697,10 @@ func ExtractPkScriptAddrs(pkScript []byte, chainParams *chaincfg.Params) (Script
 		// Null data transactions have no addresses or required
 		// signatures.
 
+	case WitnessUnknownTy:
+		// Witness programs of undefined versions have no addresses
+		// since they can't be encoded without knowing their meaning.
+
 	case NonStandardTy:
 		// Don't attempt to extract addresses or required signatures for
 		// nonstandard transactions.
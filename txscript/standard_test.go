@@ -70,6 +70,19 @@ func newAddressScriptHash(scriptHash []byte) hdfutil.Address {
 	return addr
 }
 
+// newAddressTaproot returns a new AddressTaproot from the provided output key.
+// It panics if an error occurs.  This is only used in the tests as a helper
+// since the only way it can fail is if there is an error in the test source
+// code.
+func newAddressTaproot(outputKey []byte) hdfutil.Address {
+	addr, err := NewAddressTaproot(outputKey, &chaincfg.MainNetParams)
+	if err != nil {
+		panic("invalid taproot output key in test source")
+	}
+
+	return addr
+}
+
 // TestExtractPkScriptAddrs ensures that extracting the type, addresses, and
 // number of required signatures from PkScripts works as intended.
 func TestExtractPkScriptAddrs(t *testing.T) {
@@ -326,6 +339,33 @@ func TestExtractPkScriptAddrs(t *testing.T) {
 			reqSigs: 1,
 			class:   MultiSigTy,
 		},
+		{
+			name: "p2tr",
+			script: hexToBytes("51209f96ade4b41d5433f4eda31e1738ec" +
+				"2b36f6e7d1420d94a6af99801a88f7f7ff"),
+			addrs: []hdfutil.Address{
+				newAddressTaproot(hexToBytes("9f96ade4b41d5433" +
+					"f4eda31e1738ec2b36f6e7d1420d94a6af99" +
+					"801a88f7f7ff")),
+			},
+			reqSigs: 1,
+			class:   WitnessV1TaprootTy,
+		},
+		{
+			name:    "witness program of unknown version",
+			script:  hexToBytes("60029f96"),
+			addrs:   nil,
+			reqSigs: 0,
+			class:   WitnessUnknownTy,
+		},
+		{
+			name: "nulldata with multiple pushes",
+			script: hexToBytes("6a0401020304" +
+				"050102030405"),
+			addrs:   nil,
+			reqSigs: 0,
+			class:   NullDataTy,
+		},
 		{
 			name:    "empty script",
 			script:  []byte{},
@@ -636,6 +676,13 @@ func TestPayToAddrScript(t *testing.T) {
 			err)
 	}
 
+	p2trMain, err := NewAddressTaproot(hexToBytes("9f96ade4b41d5433f4ed"+
+		"a31e1738ec2b36f6e7d1420d94a6af99801a88f7f7ff"),
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Unable to create taproot address: %v", err)
+	}
+
 	// Errors used in the tests below defined here for convenience and to
 	// keep the horizontal test size shorter.
 	errUnsupportedAddress := scriptError(ErrUnsupportedAddress, "")
@@ -682,11 +729,19 @@ func TestPayToAddrScript(t *testing.T) {
 				"CHECKSIG",
 			nil,
 		},
+		// pay-to-taproot address on mainnet.
+		{
+			p2trMain,
+			"1 DATA_32 0x9f96ade4b41d5433f4eda31e1738ec2b36f6e7d1" +
+				"420d94a6af99801a88f7f7ff",
+			nil,
+		},
 
 		// Supported address types with nil pointers.
 		{(*hdfutil.AddressPubKeyHash)(nil), "", errUnsupportedAddress},
 		{(*hdfutil.AddressScriptHash)(nil), "", errUnsupportedAddress},
 		{(*hdfutil.AddressPubKey)(nil), "", errUnsupportedAddress},
+		{(*AddressTaproot)(nil), "", errUnsupportedAddress},
 
 		// Unsupported address type.
 		{&bogusAddress{}, "", errUnsupportedAddress},
@@ -968,11 +1023,27 @@ var scriptClassTests = []struct {
 			"962e0ea1f61deb649f6bc3f4cef308",
 		class: NonStandardTy,
 	},
+	{
+		// Nulldata with multiple data pushes.
+		name:   "nulldata multiple pushes",
+		script: "RETURN 4 DATA_2 0x0102 0 DATA_3 0x010203",
+		class:  NullDataTy,
+	},
+	{
+		// Nulldata with multiple data pushes which exceed the max
+		// allowed data to be considered standard in total.
+		name: "nulldata exceed max standard multiple pushes",
+		script: "RETURN DATA_40 0x046708afdb0fe5548271967f1a67130b7105" +
+			"cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef3 " +
+			"DATA_41 0x046708afdb0fe5548271967f1a67130b7105cd6a82" +
+			"8e03909a67962e0ea1f61deb649f6bc3f4cef308",
+		class: NonStandardTy,
+	},
 	{
 		// Almost nulldata, but add an additional opcode after the data
 		// to make it nonstandard.
 		name:   "almost nulldata",
-		script: "RETURN 4 TRUE",
+		script: "RETURN 4 DUP",
 		class:  NonStandardTy,
 	},
 
@@ -1044,6 +1115,30 @@ var scriptClassTests = []struct {
 		script: "0 DATA_32 0x9f96ade4b41d5433f4eda31e1738ec2b36f6e7d1420d94a6af99801a88f7f7ff",
 		class:  WitnessV0ScriptHashTy,
 	},
+	{
+		// A pay to taproot pk script.
+		name:   "Pay To Taproot",
+		script: "1 DATA_32 0x9f96ade4b41d5433f4eda31e1738ec2b36f6e7d1420d94a6af99801a88f7f7ff",
+		class:  WitnessV1TaprootTy,
+	},
+	{
+		// A version 1 witness program which is not 32 bytes.
+		name:   "witness v1 with 20-byte program",
+		script: "1 DATA_20 0x9f96ade4b41d5433f4eda31e1738ec2b36f6e7d1",
+		class:  WitnessUnknownTy,
+	},
+	{
+		// A witness program of an undefined version.
+		name:   "witness v16",
+		script: "16 DATA_2 0x9f96",
+		class:  WitnessUnknownTy,
+	},
+	{
+		// A version 0 witness program of an invalid length.
+		name:   "witness v0 with 16-byte program",
+		script: "0 DATA_16 0x9f96ade4b41d5433f4eda31e1738ec2b",
+		class:  NonStandardTy,
+	},
 }
 
 // TestScriptClass ensures all the scripts in scriptClassTests have the expected
@@ -1062,6 +1157,58 @@ func TestScriptClass(t *testing.T) {
 	}
 }
 
+// TestScriptClassWithDataCarrierSize ensures null data scripts are classified
+// according to the passed data carrier size.
+func TestScriptClassWithDataCarrierSize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		script  string
+		maxSize int
+		class   ScriptClass
+	}{{
+		name:    "no data with zero size",
+		script:  "RETURN",
+		maxSize: 0,
+		class:   NullDataTy,
+	}, {
+		name:    "small ints with zero size",
+		script:  "RETURN 0 1 16",
+		maxSize: 0,
+		class:   NullDataTy,
+	}, {
+		name:    "data with zero size",
+		script:  "RETURN DATA_1 0x01",
+		maxSize: 0,
+		class:   NonStandardTy,
+	}, {
+		name:    "multiple pushes at size",
+		script:  "RETURN DATA_2 0x0102 DATA_3 0x010203",
+		maxSize: 5,
+		class:   NullDataTy,
+	}, {
+		name:    "multiple pushes over size",
+		script:  "RETURN DATA_2 0x0102 DATA_3 0x010203",
+		maxSize: 4,
+		class:   NonStandardTy,
+	}, {
+		name:    "other classes are unaffected",
+		script:  "1 DATA_32 0x9f96ade4b41d5433f4eda31e1738ec2b36f6e7d1420d94a6af99801a88f7f7ff",
+		maxSize: 0,
+		class:   WitnessV1TaprootTy,
+	}}
+
+	for _, test := range tests {
+		script := mustParseShortForm(test.script)
+		class := GetScriptClassWithDataCarrierSize(script, test.maxSize)
+		if class != test.class {
+			t.Errorf("%s: expected %s got %s (script %x)", test.name,
+				test.class, class, script)
+		}
+	}
+}
+
 // TestStringifyClass ensures the script class string returns the expected
 // string for each script class.
 func TestStringifyClass(t *testing.T) {
@@ -1112,6 +1259,16 @@ func TestStringifyClass(t *testing.T) {
 			class:    NullDataTy,
 			stringed: "nulldata",
 		},
+		{
+			name:     "witnesstaproot",
+			class:    WitnessV1TaprootTy,
+			stringed: "witness_v1_taproot",
+		},
+		{
+			name:     "witnessunknown",
+			class:    WitnessUnknownTy,
+			stringed: "witness_unknown",
+		},
 		{
 			name:     "broken",
 			class:    ScriptClass(255),
@@ -0,0 +1,526 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/hdfec"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// SigHashDefault is the signature hash type introduced within BIP0341 which is
+// only valid for taproot signatures.  It signs the same parts of the
+// transaction as SigHashAll, but is implied by omitting the hash type byte from
+// the signature altogether.
+const SigHashDefault SigHashType = 0x00
+
+const (
+	// BaseLeafVersion is the leaf version of the tapscript leaves defined
+	// within BIP0342.
+	BaseLeafVersion = 0xc0
+
+	// TaprootAnnexTag is the first byte of the optional annex which may be
+	// the last element of the witness of a taproot spend.
+	TaprootAnnexTag = 0x50
+
+	// ControlBlockBaseSize is the size of a control block without any
+	// inclusion proof nodes.  It consists of the leaf version and parity
+	// byte followed by the x-only internal key.
+	ControlBlockBaseSize = 33
+
+	// ControlBlockNodeSize is the size of each of the nodes of the
+	// inclusion proof of a control block.
+	ControlBlockNodeSize = 32
+
+	// ControlBlockMaxNodeCount is the maximum number of nodes of the
+	// inclusion proof of a control block, which is the maximum depth of a
+	// taproot script tree.
+	ControlBlockMaxNodeCount = 128
+
+	// ControlBlockMaxSize is the maximum size of a control block.
+	ControlBlockMaxSize = ControlBlockBaseSize +
+		ControlBlockNodeSize*ControlBlockMaxNodeCount
+
+	// payToTaprootDataSize is the size of the witness program's data push
+	// for a pay-to-taproot output.
+	payToTaprootDataSize = 32
+
+	// taprootLeafMask is the mask applied to the first byte of a control
+	// block to obtain the leaf version.  The remaining bit is the parity of
+	// the y coordinate of the output key.
+	taprootLeafMask = 0xfe
+
+	// blankCodeSepValue is the position of the last executed
+	// OP_CODESEPARATOR committed to by tapscript signatures when none was
+	// executed.
+	blankCodeSepValue = math.MaxUint32
+
+	// sigOpsDelta is the amount the signature operation budget of a
+	// tapscript is reduced by for each executed signature check with a
+	// non-empty signature.
+	sigOpsDelta = 50
+)
+
+var (
+	// The following are the tags of the tagged hashes defined within
+	// BIP0341.
+	tagTapLeaf    = []byte("TapLeaf")
+	tagTapBranch  = []byte("TapBranch")
+	tagTapTweak   = []byte("TapTweak")
+	tagTapSighash = []byte("TapSighash")
+)
+
+// taggedHash returns the hash of the passed messages tagged with the passed tag
+// as defined within BIP0340.  That is:
+//
+//	sha256(sha256(tag) || sha256(tag) || msgs...)
+//
+// Tagging the hash ensures hashes computed for different purposes can never
+// collide.
+func taggedHash(tag []byte, msgs ...[]byte) chainhash.Hash {
+	tagHash := sha256.Sum256(tag)
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, msg := range msgs {
+		h.Write(msg)
+	}
+
+	var hash chainhash.Hash
+	copy(hash[:], h.Sum(nil))
+	return hash
+}
+
+// TapLeafHash returns the hash of the taproot script tree leaf with the passed
+// leaf version and script.
+func TapLeafHash(leafVersion byte, script []byte) chainhash.Hash {
+	var b bytes.Buffer
+	b.WriteByte(leafVersion)
+	wire.WriteVarBytes(&b, 0, script)
+	return taggedHash(tagTapLeaf, b.Bytes())
+}
+
+// TapBranchHash returns the hash of the taproot script tree branch with the
+// passed child hashes.  The children are sorted so their order does not matter.
+func TapBranchHash(a, b []byte) chainhash.Hash {
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+	return taggedHash(tagTapBranch, a, b)
+}
+
+// ControlBlock houses the parsed form of the control block which is the last
+// element of the witness of a taproot script path spend, excluding the annex.
+// It proves the revealed script is committed to by the output key.
+type ControlBlock struct {
+	// InternalKey is the x-only internal key the output key is derived
+	// from.
+	InternalKey []byte
+
+	// OutputKeyYIsOdd is whether or not the y coordinate of the output key
+	// is odd.
+	OutputKeyYIsOdd bool
+
+	// LeafVersion is the leaf version of the revealed script.
+	LeafVersion byte
+
+	// InclusionProof is the concatenation of the hashes of the nodes
+	// proving the revealed script is part of the script tree, ordered from
+	// the leaf towards the root.
+	InclusionProof []byte
+}
+
+// ParseControlBlock parses the passed serialized control block.
+func ParseControlBlock(controlBlock []byte) (*ControlBlock, error) {
+	size := len(controlBlock)
+	if size < ControlBlockBaseSize || size > ControlBlockMaxSize ||
+		(size-ControlBlockBaseSize)%ControlBlockNodeSize != 0 {
+
+		str := fmt.Sprintf("control block size %d is invalid", size)
+		return nil, scriptError(ErrControlBlockInvalidLength, str)
+	}
+
+	return &ControlBlock{
+		InternalKey:     controlBlock[1:ControlBlockBaseSize],
+		OutputKeyYIsOdd: controlBlock[0]&^taprootLeafMask == 1,
+		LeafVersion:     controlBlock[0] & taprootLeafMask,
+		InclusionProof:  controlBlock[ControlBlockBaseSize:],
+	}, nil
+}
+
+// RootHash returns the root hash of the script tree committed to by the output
+// key, assuming the passed script is the revealed leaf of the control block.
+func (c *ControlBlock) RootHash(script []byte) chainhash.Hash {
+	hash := TapLeafHash(c.LeafVersion, script)
+	for i := 0; i < len(c.InclusionProof); i += ControlBlockNodeSize {
+		node := c.InclusionProof[i : i+ControlBlockNodeSize]
+		hash = TapBranchHash(hash[:], node)
+	}
+	return hash
+}
+
+// tweakTaprootKey returns the x coordinate and whether or not the y coordinate
+// is odd of the output key which commits to the passed script tree root hash
+// with the passed internal key.  An empty root hash commits to no scripts.
+func tweakTaprootKey(internalKey, rootHash []byte) (*big.Int, bool, error) {
+	px, py, ok := parseSchnorrPubKey(internalKey)
+	if !ok {
+		return nil, false, scriptError(ErrTaprootPubKeyInvalid,
+			"taproot internal key is not a valid x-only public key")
+	}
+
+	// t = int(hash_TapTweak(bytes(P) || rootHash)), which must be less
+	// than the order of the curve.
+	curve := hdfcec.S256()
+	tweak := taggedHash(tagTapTweak, internalKey, rootHash)
+	t := new(big.Int).SetBytes(tweak[:])
+	if t.Cmp(curve.N) >= 0 {
+		return nil, false, scriptError(ErrTaprootPubKeyInvalid,
+			"taproot tweak exceeds the curve order")
+	}
+
+	// Q = P + t*G
+	tgx, tgy := curve.ScalarBaseMult(t.Bytes())
+	qx, qy := curve.Add(px, py, tgx, tgy)
+	if qx.Sign() == 0 && qy.Sign() == 0 {
+		return nil, false, scriptError(ErrTaprootPubKeyInvalid,
+			"taproot output key is the point at infinity")
+	}
+	return qx, qy.Bit(0) == 1, nil
+}
+
+// ComputeTaprootOutputKey returns the x-only output key which commits to the
+// passed script tree root hash with the passed x-only internal key.  An empty
+// root hash produces an output key which can only be spent with the key path.
+func ComputeTaprootOutputKey(internalKey, rootHash []byte) ([]byte, error) {
+	qx, _, err := tweakTaprootKey(internalKey, rootHash)
+	if err != nil {
+		return nil, err
+	}
+	return serializeSchnorrPubKey(qx), nil
+}
+
+// VerifyTaprootLeafCommitment returns an error when the passed script is not
+// committed to by the output key of the passed taproot witness program
+// according to the passed control block.
+func VerifyTaprootLeafCommitment(controlBlock *ControlBlock,
+	witnessProgram, script []byte) error {
+
+	rootHash := controlBlock.RootHash(script)
+	qx, yIsOdd, err := tweakTaprootKey(controlBlock.InternalKey,
+		rootHash[:])
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(serializeSchnorrPubKey(qx), witnessProgram) {
+		return scriptError(ErrTaprootMerkleProofInvalid,
+			"taproot script is not committed to by the output key")
+	}
+	if yIsOdd != controlBlock.OutputKeyYIsOdd {
+		return scriptError(ErrTaprootOutputKeyParityMismatch,
+			"control block output key parity mismatch")
+	}
+	return nil
+}
+
+// calcHashPrevOutsV1 calculates a single SHA256 of all the previous outputs
+// (txid:index) referenced within the passed transaction as defined within
+// BIP0341.
+func calcHashPrevOutsV1(tx *wire.MsgTx) chainhash.Hash {
+	var b bytes.Buffer
+	for _, in := range tx.TxIn {
+		b.Write(in.PreviousOutPoint.Hash[:])
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], in.PreviousOutPoint.Index)
+		b.Write(buf[:])
+	}
+
+	return chainhash.HashH(b.Bytes())
+}
+
+// calcHashSequenceV1 calculates a single SHA256 of the sequence numbers of all
+// the inputs of the passed transaction as defined within BIP0341.
+func calcHashSequenceV1(tx *wire.MsgTx) chainhash.Hash {
+	var b bytes.Buffer
+	for _, in := range tx.TxIn {
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], in.Sequence)
+		b.Write(buf[:])
+	}
+
+	return chainhash.HashH(b.Bytes())
+}
+
+// calcHashOutputsV1 calculates a single SHA256 of all the outputs of the passed
+// transaction encoded using the wire format as defined within BIP0341.
+func calcHashOutputsV1(tx *wire.MsgTx) chainhash.Hash {
+	var b bytes.Buffer
+	for _, out := range tx.TxOut {
+		wire.WriteTxOut(&b, 0, 0, out)
+	}
+
+	return chainhash.HashH(b.Bytes())
+}
+
+// calcHashSpentOutputsV1 calculates a single SHA256 of the amounts and one of
+// the public key scripts of all the outputs spent by the passed transaction as
+// defined within BIP0341.
+func calcHashSpentOutputsV1(tx *wire.MsgTx,
+	prevOuts PrevOutputFetcher) (chainhash.Hash, chainhash.Hash, error) {
+
+	var amounts, scripts bytes.Buffer
+	for i, in := range tx.TxIn {
+		prevOut := prevOuts.FetchPrevOutput(in.PreviousOutPoint)
+		if prevOut == nil {
+			str := fmt.Sprintf("previous output %v spent by input "+
+				"%d is unknown", in.PreviousOutPoint, i)
+			return chainhash.Hash{}, chainhash.Hash{},
+				scriptError(ErrMissingPrevOuts, str)
+		}
+
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], uint64(prevOut.Value))
+		amounts.Write(buf[:])
+		wire.WriteVarBytes(&scripts, 0, prevOut.PkScript)
+	}
+
+	return chainhash.HashH(amounts.Bytes()), chainhash.HashH(scripts.Bytes()),
+		nil
+}
+
+// isValidTaprootSigHash returns whether or not the passed hash type is valid
+// for taproot signatures.
+func isValidTaprootSigHash(hashType SigHashType) bool {
+	switch hashType {
+	case SigHashDefault, SigHashAll, SigHashNone, SigHashSingle,
+		SigHashAll | SigHashAnyOneCanPay,
+		SigHashNone | SigHashAnyOneCanPay,
+		SigHashSingle | SigHashAnyOneCanPay:
+
+		return true
+	}
+	return false
+}
+
+// taprootSigHashOptions houses the parts of the taproot signature hash which
+// depend on how the output is spent.
+type taprootSigHashOptions struct {
+	// annex is the annex of the witness, if any, including its tag.
+	annex []byte
+
+	// tapLeafHash is the hash of the executed tapscript leaf.  It is nil
+	// for key path spends.
+	tapLeafHash []byte
+
+	// codeSepPos is the opcode position of the last executed
+	// OP_CODESEPARATOR in the tapscript, or 0xffffffff when none was
+	// executed.
+	codeSepPos uint32
+}
+
+// calcTaprootSignatureHash computes the sighash digest of a transaction's
+// taproot input as defined within BIP0341 and, for script path spends,
+// BIP0342.  The passed sighashes must include the partial sighashes which
+// commit to the outputs spent by the transaction, and prevOut is the output
+// spent by the input being signed.
+func calcTaprootSignatureHash(sigHashes *TxSigHashes, hashType SigHashType,
+	tx *wire.MsgTx, idx int, prevOut *wire.TxOut,
+	opts *taprootSigHashOptions) ([]byte, error) {
+
+	if !isValidTaprootSigHash(hashType) {
+		str := fmt.Sprintf("invalid taproot hash type 0x%x", hashType)
+		return nil, scriptError(ErrInvalidSigHashType, str)
+	}
+	if idx < 0 || idx >= len(tx.TxIn) {
+		str := fmt.Sprintf("transaction input index %d is negative or "+
+			">= %d", idx, len(tx.TxIn))
+		return nil, scriptError(ErrInvalidIndex, str)
+	}
+	if sigHashes == nil || !sigHashes.HasV1Hashes {
+		return nil, scriptError(ErrMissingPrevOuts, "taproot signature "+
+			"hashes require the previous outputs spent by the "+
+			"transaction")
+	}
+
+	// The output type of the default hash type is the same as for
+	// SigHashAll.
+	outputType := hashType & sigHashMask
+	if outputType == SigHashDefault {
+		outputType = SigHashAll
+	}
+	anyoneCanPay := hashType&SigHashAnyOneCanPay != 0
+	if outputType == SigHashSingle && idx >= len(tx.TxOut) {
+		str := fmt.Sprintf("input %d has no corresponding output for "+
+			"SigHashSingle", idx)
+		return nil, scriptError(ErrInvalidSigHashType, str)
+	}
+
+	var sigMsg bytes.Buffer
+	var buf [8]byte
+
+	// The epoch is followed by the hash type, the version, and the lock
+	// time of the transaction.
+	sigMsg.WriteByte(0x00)
+	sigMsg.WriteByte(byte(hashType))
+	binary.LittleEndian.PutUint32(buf[:4], uint32(tx.Version))
+	sigMsg.Write(buf[:4])
+	binary.LittleEndian.PutUint32(buf[:4], tx.LockTime)
+	sigMsg.Write(buf[:4])
+
+	// Commit to all inputs along with the outputs they spend unless only
+	// the input being signed is committed to.
+	if !anyoneCanPay {
+		sigMsg.Write(sigHashes.HashPrevOutsV1[:])
+		sigMsg.Write(sigHashes.HashAmountsV1[:])
+		sigMsg.Write(sigHashes.HashScriptPubKeysV1[:])
+		sigMsg.Write(sigHashes.HashSequenceV1[:])
+	}
+	if outputType != SigHashNone && outputType != SigHashSingle {
+		sigMsg.Write(sigHashes.HashOutputsV1[:])
+	}
+
+	// The spend type indicates whether the script path is used and whether
+	// an annex is present.
+	var spendType byte
+	if opts.tapLeafHash != nil {
+		spendType |= 0x02
+	}
+	if opts.annex != nil {
+		spendType |= 0x01
+	}
+	sigMsg.WriteByte(spendType)
+
+	txIn := tx.TxIn[idx]
+	if anyoneCanPay {
+		sigMsg.Write(txIn.PreviousOutPoint.Hash[:])
+		binary.LittleEndian.PutUint32(buf[:4], txIn.PreviousOutPoint.Index)
+		sigMsg.Write(buf[:4])
+		wire.WriteTxOut(&sigMsg, 0, 0, prevOut)
+		binary.LittleEndian.PutUint32(buf[:4], txIn.Sequence)
+		sigMsg.Write(buf[:4])
+	} else {
+		binary.LittleEndian.PutUint32(buf[:4], uint32(idx))
+		sigMsg.Write(buf[:4])
+	}
+	if opts.annex != nil {
+		var b bytes.Buffer
+		wire.WriteVarBytes(&b, 0, opts.annex)
+		annexHash := sha256.Sum256(b.Bytes())
+		sigMsg.Write(annexHash[:])
+	}
+	if outputType == SigHashSingle {
+		var b bytes.Buffer
+		wire.WriteTxOut(&b, 0, 0, tx.TxOut[idx])
+		outputHash := sha256.Sum256(b.Bytes())
+		sigMsg.Write(outputHash[:])
+	}
+
+	// Script path spends additionally commit to the executed leaf, the
+	// public key version, and the position of the last executed
+	// OP_CODESEPARATOR.
+	if opts.tapLeafHash != nil {
+		sigMsg.Write(opts.tapLeafHash)
+		sigMsg.WriteByte(0x00)
+		binary.LittleEndian.PutUint32(buf[:4], opts.codeSepPos)
+		sigMsg.Write(buf[:4])
+	}
+
+	hash := taggedHash(tagTapSighash, sigMsg.Bytes())
+	return hash[:], nil
+}
+
+// CalcTaprootSignatureHash computes the sighash digest for the key path spend
+// of the specified taproot input of the target transaction observing the
+// desired sig hash type.  The passed sighashes must have been created with
+// NewTxSigHashesWithPrevOuts, and the previous output fetcher must provide the
+// output spent by the input.
+func CalcTaprootSignatureHash(sigHashes *TxSigHashes, hType SigHashType,
+	tx *wire.MsgTx, idx int, prevOuts PrevOutputFetcher) ([]byte, error) {
+
+	return CalcTaprootSignatureHashWithAnnex(sigHashes, hType, tx, idx,
+		prevOuts, nil)
+}
+
+// CalcTaprootSignatureHashWithAnnex is like CalcTaprootSignatureHash, but also
+// commits to the passed annex, including its tag, of the witness of the input.
+func CalcTaprootSignatureHashWithAnnex(sigHashes *TxSigHashes, hType SigHashType,
+	tx *wire.MsgTx, idx int, prevOuts PrevOutputFetcher,
+	annex []byte) ([]byte, error) {
+
+	if idx < 0 || idx >= len(tx.TxIn) {
+		str := fmt.Sprintf("transaction input index %d is negative or "+
+			">= %d", idx, len(tx.TxIn))
+		return nil, scriptError(ErrInvalidIndex, str)
+	}
+	prevOut := prevOuts.FetchPrevOutput(tx.TxIn[idx].PreviousOutPoint)
+	if prevOut == nil {
+		str := fmt.Sprintf("previous output spent by input %d is "+
+			"unknown", idx)
+		return nil, scriptError(ErrMissingPrevOuts, str)
+	}
+
+	opts := taprootSigHashOptions{annex: annex}
+	return calcTaprootSignatureHash(sigHashes, hType, tx, idx, prevOut,
+		&opts)
+}
+
+// CalcTapscriptSignatureHash computes the sighash digest for the script path
+// spend of the specified taproot input of the target transaction which executes
+// the tapscript leaf with the passed hash observing the desired sig hash type.
+// The signature is assumed to be checked without an OP_CODESEPARATOR having
+// been executed and without an annex.  See CalcTaprootSignatureHash for the
+// requirements of the sighashes and the previous output fetcher.
+func CalcTapscriptSignatureHash(sigHashes *TxSigHashes, hType SigHashType,
+	tx *wire.MsgTx, idx int, prevOuts PrevOutputFetcher,
+	tapLeafHash chainhash.Hash) ([]byte, error) {
+
+	if idx < 0 || idx >= len(tx.TxIn) {
+		str := fmt.Sprintf("transaction input index %d is negative or "+
+			">= %d", idx, len(tx.TxIn))
+		return nil, scriptError(ErrInvalidIndex, str)
+	}
+	prevOut := prevOuts.FetchPrevOutput(tx.TxIn[idx].PreviousOutPoint)
+	if prevOut == nil {
+		str := fmt.Sprintf("previous output spent by input %d is "+
+			"unknown", idx)
+		return nil, scriptError(ErrMissingPrevOuts, str)
+	}
+
+	opts := taprootSigHashOptions{
+		tapLeafHash: tapLeafHash[:],
+		codeSepPos:  blankCodeSepValue,
+	}
+	return calcTaprootSignatureHash(sigHashes, hType, tx, idx, prevOut,
+		&opts)
+}
+
+// parseTaprootSignature splits the passed taproot signature into the Schnorr
+// signature and the hash type.  The hash type byte may only be omitted, in
+// which case SigHashDefault is used, but never be SigHashDefault explicitly.
+func parseTaprootSignature(sig []byte) ([]byte, SigHashType, error) {
+	switch {
+	case len(sig) == schnorrSigSize:
+		return sig, SigHashDefault, nil
+
+	case len(sig) == schnorrSigSize+1 && sig[schnorrSigSize] != 0x00:
+		hashType := SigHashType(sig[schnorrSigSize])
+		if !isValidTaprootSigHash(hashType) {
+			str := fmt.Sprintf("invalid taproot hash type 0x%x",
+				hashType)
+			return nil, 0, scriptError(ErrInvalidSigHashType, str)
+		}
+		return sig[:schnorrSigSize], hashType, nil
+	}
+
+	str := fmt.Sprintf("invalid taproot signature length %d", len(sig))
+	return nil, 0, scriptError(ErrInvalidTaprootSigLen, str)
+}
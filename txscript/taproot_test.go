@@ -0,0 +1,955 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/ifishnet/hdfd/hdfec"
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// signSchnorr returns the BIP0340 Schnorr signature of the passed message by the
+// passed private key using auxiliary randomness of all zeros.
+func signSchnorr(privKey *big.Int, msg []byte) []byte {
+	return signSchnorrAux(privKey, make([]byte, 32), msg)
+}
+
+// signSchnorrAux returns the BIP0340 Schnorr signature of the passed message by
+// the passed private key using the passed 32 bytes of auxiliary randomness.
+func signSchnorrAux(privKey *big.Int, aux, msg []byte) []byte {
+	curve := hdfcec.S256()
+
+	// Negate the private key when its public key has an odd y coordinate
+	// so it matches the x-only public key.
+	d := new(big.Int).Set(privKey)
+	px, py := curve.ScalarBaseMult(d.Bytes())
+	if py.Bit(0) == 1 {
+		d.Sub(curve.N, d)
+	}
+	pubKey := serializeSchnorrPubKey(px)
+
+	// Derive the nonce from the private key masked with the hash of the
+	// auxiliary randomness, the public key, and the message.
+	auxHash := taggedHash([]byte("BIP0340/aux"), aux)
+	var t [32]byte
+	dBytes := d.Bytes()
+	copy(t[32-len(dBytes):], dBytes)
+	for i := range t {
+		t[i] ^= auxHash[i]
+	}
+	nonce := taggedHash([]byte("BIP0340/nonce"), t[:], pubKey, msg)
+	k := new(big.Int).SetBytes(nonce[:])
+	k.Mod(k, curve.N)
+	rx, ry := curve.ScalarBaseMult(k.Bytes())
+	if ry.Bit(0) == 1 {
+		k.Sub(curve.N, k)
+	}
+	r := serializeSchnorrPubKey(rx)
+
+	// s = k + e*d mod n
+	challenge := taggedHash(tagBIP0340Challenge, r, pubKey, msg)
+	e := new(big.Int).SetBytes(challenge[:])
+	e.Mod(e, curve.N)
+	s := e.Mul(e, d)
+	s.Add(s, k)
+	s.Mod(s, curve.N)
+
+	sig := make([]byte, schnorrSigSize)
+	copy(sig, r)
+	sBytes := s.Bytes()
+	copy(sig[schnorrSigSize-len(sBytes):], sBytes)
+	return sig
+}
+
+// schnorrPubKey returns the x-only public key of the passed private key.
+func schnorrPubKey(privKey *big.Int) []byte {
+	px, _ := hdfcec.S256().ScalarBaseMult(privKey.Bytes())
+	return serializeSchnorrPubKey(px)
+}
+
+// TestVerifySchnorr ensures BIP0340 Schnorr signatures are verified correctly.
+func TestVerifySchnorr(t *testing.T) {
+	t.Parallel()
+
+	// The first test vector of BIP0340.
+	privKey := big.NewInt(3)
+	pubKey := hexToBytes("f9308a019258c31049344f85f89d5229b531c845836f9" +
+		"9b08601f113bce036f9")
+	msg := make([]byte, 32)
+	sig := hexToBytes("e907831f80848d1069a5371b402410364bdf1c5f8307b00" +
+		"84c55f1ce2dca821525f66a4a85ea8b71e482a74f382d2ce5ebeee8fdb2172" +
+		"f477df4900d310536c0")
+
+	if !bytes.Equal(schnorrPubKey(privKey), pubKey) {
+		t.Fatalf("unexpected public key %x", schnorrPubKey(privKey))
+	}
+	if got := signSchnorr(privKey, msg); !bytes.Equal(got, sig) {
+		t.Fatalf("unexpected signature %x", got)
+	}
+
+	otherMsg := chainhash.HashB([]byte("other message"))
+	otherKey := big.NewInt(0x1234567890)
+	badS := append([]byte(nil), sig...)
+	copy(badS[32:], hdfcec.S256().N.Bytes())
+	tests := []struct {
+		name   string
+		sig    []byte
+		msg    []byte
+		pubKey []byte
+		valid  bool
+	}{
+		{"test vector", sig, msg, pubKey, true},
+		{"other message", signSchnorr(privKey, otherMsg), otherMsg,
+			pubKey, true},
+		{"odd public key", signSchnorr(otherKey, otherMsg), otherMsg,
+			schnorrPubKey(otherKey), true},
+		{"wrong message", sig, otherMsg, pubKey, false},
+		{"wrong public key", sig, msg, schnorrPubKey(otherKey), false},
+		{"s not less than order", badS, msg, pubKey, false},
+		{"short signature", sig[:63], msg, pubKey, false},
+		{"public key not on curve", sig, msg, make([]byte, 32), false},
+	}
+	for _, test := range tests {
+		valid := verifySchnorr(test.sig, test.msg, test.pubKey)
+		if valid != test.valid {
+			t.Errorf("%s: got %v, want %v", test.name, valid,
+				test.valid)
+		}
+	}
+}
+
+// bip340Test describes a test vector of BIP0340.  Secret keys and auxiliary
+// randomness are only provided for the vectors which are signed.
+type bip340Test struct {
+	index     int
+	comment   string
+	secretKey string
+	auxRand   string
+	publicKey string
+	message   string
+	signature string
+	valid     bool
+}
+
+// bip340Tests are the test vectors of BIP0340 with 32 byte messages, which are
+// the only ones used by taproot.
+var bip340Tests = []bip340Test{
+	{
+		index:     0,
+		secretKey: "0000000000000000000000000000000000000000000000000000000000000003",
+		auxRand:   "0000000000000000000000000000000000000000000000000000000000000000",
+		publicKey: "f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9",
+		message:   "0000000000000000000000000000000000000000000000000000000000000000",
+		signature: "e907831f80848d1069a5371b402410364bdf1c5f8307b0084c55f1ce2dca8215" +
+			"25f66a4a85ea8b71e482a74f382d2ce5ebeee8fdb2172f477df4900d310536c0",
+		valid: true,
+	},
+	{
+		index:     1,
+		secretKey: "b7e151628aed2a6abf7158809cf4f3c762e7160f38b4da56a784d9045190cfef",
+		auxRand:   "0000000000000000000000000000000000000000000000000000000000000001",
+		publicKey: "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+		message:   "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+		signature: "6896bd60eeae296db48a229ff71dfe071bde413e6d43f917dc8dcf8c78de3341" +
+			"8906d11ac976abccb20b091292bff4ea897efcb639ea871cfa95f6de339e4b0a",
+		valid: true,
+	},
+	{
+		index:     2,
+		secretKey: "c90fdaa22168c234c4c6628b80dc1cd129024e088a67cc74020bbea63b14e5c9",
+		auxRand:   "c87aa53824b4d7ae2eb035a2b5bbbccc080e76cdc6d1692c4b0b62d798e6d906",
+		publicKey: "dd308afec5777e13121fa72b9cc1b7cc0139715309b086c960e18fd969774eb8",
+		message:   "7e2d58d8b3bcdf1abadec7829054f90dda9805aab56c77333024b9d0a508b75c",
+		signature: "5831aaeed7b44bb74e5eab94ba9d4294c49bcf2a60728d8b4c200f50dd313c1b" +
+			"ab745879a5ad954a72c45a91c3a51d3c7adea98d82f8481e0e1e03674a6f3fb7",
+		valid: true,
+	},
+	{
+		index:     3,
+		secretKey: "0b432b2677937381aef05bb02a66ecd012773062cf3fa2549e44f58ed2401710",
+		auxRand:   "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+		publicKey: "25d1dff95105f5253c4022f628a996ad3a0d95fbf21d468a1b33f8c160d8f517",
+		message:   "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+		signature: "7eb0509757e246f19449885651611cb965ecc1a187dd51b64fda1edc9637d5ec" +
+			"97582b9cb13db3933705b32ba982af5af25fd78881ebb32771fc5922efc66ea3",
+		valid: true,
+	},
+	{
+		index:     4,
+		publicKey: "d69c3509bb99e412e68b0fe8544e72837dfa30746d8be2aa65975f29d22dc7b9",
+		message:   "4df3c3f68fcc83b27e9d42c90431a72499f17875c81a599b566c9889b9696703",
+		signature: "00000000000000000000003b78ce563f89a0ed9414f5aa28ad0d96d6795f9c63" +
+			"76afb1548af603b3eb45c9f8207dee1060cb71c04e80f593060b07d28308d7f4",
+		valid: true,
+	},
+	{
+		index:     5,
+		comment:   "public key not on the curve",
+		publicKey: "eefdea4cdb677750a420fee807eacf21eb9898ae79b9768766e4faa04a2d4a34",
+		message:   "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+		signature: "6cff5c3ba86c69ea4b7376f31a9bcb4f74c1976089b2d9963da2e5543e177769" +
+			"69e89b4c5564d00349106b8497785dd7d1d713a8ae82b32fa79d5f7fc407d39b",
+		valid: false,
+	},
+	{
+		index:     6,
+		comment:   "has_even_y(R) is false",
+		publicKey: "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+		message:   "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+		signature: "fff97bd5755eeea420453a14355235d382f6472f8568a18b2f057a1460297556" +
+			"3cc27944640ac607cd107ae10923d9ef7a73c643e166be5ebeafa34b1ac553e2",
+		valid: false,
+	},
+	{
+		index:     7,
+		comment:   "negated message",
+		publicKey: "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+		message:   "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+		signature: "1fa62e331edbc21c394792d2ab1100a7b432b013df3f6ff4f99fcb33e0e1515f" +
+			"28890b3edb6e7189b630448b515ce4f8622a954cfe545735aaea5134fccdb2bd",
+		valid: false,
+	},
+	{
+		index:     8,
+		comment:   "negated s value",
+		publicKey: "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+		message:   "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+		signature: "6cff5c3ba86c69ea4b7376f31a9bcb4f74c1976089b2d9963da2e5543e177769" +
+			"961764b3aa9b2ffcb6ef947b6887a226e8d7c93e00c5ed0c1834ff0d0c2e6da6",
+		valid: false,
+	},
+	{
+		index:     9,
+		comment:   "sG - eP is infinite (x(inf) as 0)",
+		publicKey: "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+		message:   "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+		signature: "0000000000000000000000000000000000000000000000000000000000000000" +
+			"123dda8328af9c23a94c1feecfd123ba4fb73476f0d594dcb65c6425bd186051",
+		valid: false,
+	},
+	{
+		index:     10,
+		comment:   "sG - eP is infinite (x(inf) as 1)",
+		publicKey: "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+		message:   "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+		signature: "0000000000000000000000000000000000000000000000000000000000000001" +
+			"7615fbaf5ae28864013c099742deadb4dba87f11ac6754f93780d5a1837cf197",
+		valid: false,
+	},
+	{
+		index:     11,
+		comment:   "sig[0:32] is not an X coordinate on the curve",
+		publicKey: "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+		message:   "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+		signature: "4a298dacae57395a15d0795ddbfd1dcb564da82b0f269bc70a74f8220429ba1d" +
+			"69e89b4c5564d00349106b8497785dd7d1d713a8ae82b32fa79d5f7fc407d39b",
+		valid: false,
+	},
+	{
+		index:     12,
+		comment:   "sig[0:32] is equal to field size",
+		publicKey: "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+		message:   "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+		signature: "fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f" +
+			"69e89b4c5564d00349106b8497785dd7d1d713a8ae82b32fa79d5f7fc407d39b",
+		valid: false,
+	},
+	{
+		index:     13,
+		comment:   "sig[32:64] is equal to curve order",
+		publicKey: "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+		message:   "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+		signature: "6cff5c3ba86c69ea4b7376f31a9bcb4f74c1976089b2d9963da2e5543e177769" +
+			"fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141",
+		valid: false,
+	},
+	{
+		index:     14,
+		comment:   "public key exceeds the field size",
+		publicKey: "fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc30",
+		message:   "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+		signature: "6cff5c3ba86c69ea4b7376f31a9bcb4f74c1976089b2d9963da2e5543e177769" +
+			"69e89b4c5564d00349106b8497785dd7d1d713a8ae82b32fa79d5f7fc407d39b",
+		valid: false,
+	},
+}
+
+// TestBIP0340Vectors ensures the Schnorr signatures of the BIP0340 test vectors
+// are produced and verified as specified.
+func TestBIP0340Vectors(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range bip340Tests {
+		pubKey := hexToBytes(test.publicKey)
+		msg := hexToBytes(test.message)
+		sig := hexToBytes(test.signature)
+
+		if test.secretKey != "" {
+			privKey := new(big.Int).SetBytes(hexToBytes(test.secretKey))
+			if got := schnorrPubKey(privKey); !bytes.Equal(got, pubKey) {
+				t.Errorf("vector %d: unexpected public key %x",
+					test.index, got)
+				continue
+			}
+			got := signSchnorrAux(privKey, hexToBytes(test.auxRand), msg)
+			if !bytes.Equal(got, sig) {
+				t.Errorf("vector %d: unexpected signature %x",
+					test.index, got)
+				continue
+			}
+		}
+
+		if valid := verifySchnorr(sig, msg, pubKey); valid != test.valid {
+			t.Errorf("vector %d (%s): got %v, want %v", test.index,
+				test.comment, valid, test.valid)
+		}
+	}
+}
+
+// TestParseControlBlock ensures control blocks are parsed and their sizes are
+// validated.
+func TestParseControlBlock(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		size  int
+		valid bool
+	}{
+		{"too short", ControlBlockBaseSize - 1, false},
+		{"no nodes", ControlBlockBaseSize, true},
+		{"partial node", ControlBlockBaseSize + 16, false},
+		{"two nodes", ControlBlockBaseSize + 2*ControlBlockNodeSize, true},
+		{"max nodes", ControlBlockMaxSize, true},
+		{"too long", ControlBlockMaxSize + ControlBlockNodeSize, false},
+	}
+	for _, test := range tests {
+		b := make([]byte, test.size)
+		if len(b) > 0 {
+			b[0] = BaseLeafVersion | 0x01
+		}
+		cb, err := ParseControlBlock(b)
+		if !test.valid {
+			if !IsErrorCode(err, ErrControlBlockInvalidLength) {
+				t.Errorf("%s: unexpected error %v", test.name,
+					err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if cb.LeafVersion != BaseLeafVersion || !cb.OutputKeyYIsOdd ||
+			len(cb.InclusionProof) != test.size-ControlBlockBaseSize {
+
+			t.Errorf("%s: unexpected control block %+v", test.name,
+				cb)
+		}
+	}
+}
+
+// taprootTestTx returns a transaction spending the passed taproot output along
+// with the fetcher of the output and an unrelated output it also spends.
+func taprootTestTx(pkScript []byte) (*wire.MsgTx, MultiPrevOutFetcher) {
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: chainhash.Hash{0x01}},
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: chainhash.Hash{0x02}},
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	tx.AddTxOut(wire.NewTxOut(90000, []byte{OP_TRUE}))
+
+	prevOuts := MultiPrevOutFetcher{
+		tx.TxIn[0].PreviousOutPoint: wire.NewTxOut(100000, pkScript),
+		tx.TxIn[1].PreviousOutPoint: wire.NewTxOut(5000, []byte{OP_TRUE}),
+	}
+	return tx, prevOuts
+}
+
+// payToTaprootScript returns a pay-to-taproot script for the passed output
+// key.
+func payToTaprootScript(outputKey []byte) []byte {
+	script, err := NewScriptBuilder().AddOp(OP_1).AddData(outputKey).
+		Script()
+	if err != nil {
+		panic(err)
+	}
+	return script
+}
+
+// executeTaprootSpend validates the first input of the passed transaction with
+// the taproot verification flags.
+func executeTaprootSpend(tx *wire.MsgTx, prevOuts MultiPrevOutFetcher,
+	sigHashes *TxSigHashes) error {
+
+	flags := ScriptBip16 | ScriptVerifyWitness | ScriptVerifyTaproot |
+		ScriptVerifyCleanStack
+	prevOut := prevOuts[tx.TxIn[0].PreviousOutPoint]
+	vm, err := NewEngine(prevOut.PkScript, tx, 0, flags, nil, sigHashes,
+		prevOut.Value)
+	if err != nil {
+		return err
+	}
+	return vm.Execute()
+}
+
+// TestTaprootKeySpend ensures key path spends of taproot outputs are validated
+// according to BIP0341.
+func TestTaprootKeySpend(t *testing.T) {
+	t.Parallel()
+
+	// Tweak the private key the same way as the internal key so it signs
+	// for the output key.
+	curve := hdfcec.S256()
+	privKey := big.NewInt(0x7e57)
+	internalKey := schnorrPubKey(privKey)
+	outputKey, err := ComputeTaprootOutputKey(internalKey, nil)
+	if err != nil {
+		t.Fatalf("ComputeTaprootOutputKey: %v", err)
+	}
+	d := new(big.Int).Set(privKey)
+	if _, py := curve.ScalarBaseMult(d.Bytes()); py.Bit(0) == 1 {
+		d.Sub(curve.N, d)
+	}
+	tweak := taggedHash(tagTapTweak, internalKey)
+	d.Add(d, new(big.Int).SetBytes(tweak[:]))
+	d.Mod(d, curve.N)
+	if !bytes.Equal(schnorrPubKey(d), outputKey) {
+		t.Fatal("tweaked private key does not match output key")
+	}
+
+	annex := []byte{TaprootAnnexTag, 0x01, 0x02}
+	tests := []struct {
+		name     string
+		hashType SigHashType
+		annex    []byte
+		modify   func(sig []byte) []byte
+		noPrev   bool
+		wantErr  ErrorCode
+		wantPass bool
+	}{
+		{name: "default hash type", hashType: SigHashDefault,
+			wantPass: true},
+		{name: "explicit hash type", hashType: SigHashAll,
+			wantPass: true},
+		{name: "anyone can pay single",
+			hashType: SigHashSingle | SigHashAnyOneCanPay,
+			wantPass: true},
+		{name: "annex", hashType: SigHashDefault, annex: annex,
+			wantPass: true},
+		{name: "explicit default hash type", hashType: SigHashDefault,
+			modify: func(sig []byte) []byte {
+				return append(sig, byte(SigHashDefault))
+			},
+			wantErr: ErrInvalidTaprootSigLen},
+		{name: "invalid hash type", hashType: SigHashAll,
+			modify: func(sig []byte) []byte {
+				sig[len(sig)-1] = 0x04
+				return sig
+			},
+			wantErr: ErrInvalidSigHashType},
+		{name: "mismatched hash type", hashType: SigHashAll,
+			modify: func(sig []byte) []byte {
+				sig[len(sig)-1] = byte(SigHashNone)
+				return sig
+			},
+			wantErr: ErrTaprootSigInvalid},
+		{name: "invalid signature", hashType: SigHashDefault,
+			modify: func(sig []byte) []byte {
+				sig[0] ^= 0x01
+				return sig
+			},
+			wantErr: ErrTaprootSigInvalid},
+		{name: "missing previous outputs", hashType: SigHashDefault,
+			noPrev: true, wantErr: ErrMissingPrevOuts},
+	}
+	for _, test := range tests {
+		tx, prevOuts := taprootTestTx(payToTaprootScript(outputKey))
+		sigHashes, err := NewTxSigHashesWithPrevOuts(tx, prevOuts)
+		if err != nil {
+			t.Fatalf("%s: NewTxSigHashesWithPrevOuts: %v",
+				test.name, err)
+		}
+		hash, err := CalcTaprootSignatureHashWithAnnex(sigHashes,
+			test.hashType, tx, 0, prevOuts, test.annex)
+		if err != nil {
+			t.Fatalf("%s: CalcTaprootSignatureHash: %v", test.name,
+				err)
+		}
+		sig := signSchnorr(d, hash)
+		if test.hashType != SigHashDefault {
+			sig = append(sig, byte(test.hashType))
+		}
+		if test.modify != nil {
+			sig = test.modify(sig)
+		}
+		tx.TxIn[0].Witness = wire.TxWitness{sig}
+		if test.annex != nil {
+			tx.TxIn[0].Witness = append(tx.TxIn[0].Witness,
+				test.annex)
+		}
+		if test.noPrev {
+			sigHashes = NewTxSigHashes(tx)
+		}
+
+		err = executeTaprootSpend(tx, prevOuts, sigHashes)
+		if test.wantPass {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name,
+					err)
+			}
+			continue
+		}
+		if !IsErrorCode(err, test.wantErr) {
+			t.Errorf("%s: got error %v, want %v", test.name, err,
+				test.wantErr)
+		}
+	}
+}
+
+// TestTaprootScriptSpend ensures script path spends of taproot outputs are
+// validated according to BIP0341 and their tapscripts are executed according
+// to BIP0342.
+func TestTaprootScriptSpend(t *testing.T) {
+	t.Parallel()
+
+	privKey1, privKey2 := big.NewInt(0x1111), big.NewInt(0x2222)
+	pubKey1, pubKey2 := schnorrPubKey(privKey1), schnorrPubKey(privKey2)
+	internalKey := schnorrPubKey(big.NewInt(0x3333))
+
+	// sigFor returns a signature for the placeholder in a witness.
+	type sigFor struct {
+		privKey *big.Int
+	}
+
+	tests := []struct {
+		name        string
+		script      []byte
+		leafVersion byte
+		witness     []interface{}
+		modifyCB    func(cb []byte) []byte
+		wantErr     ErrorCode
+		wantPass    bool
+	}{{
+		name: "checksig",
+		script: mustParseShortForm("DATA_32 0x" +
+			hex.EncodeToString(pubKey1) + " CHECKSIG"),
+		witness:  []interface{}{sigFor{privKey1}},
+		wantPass: true,
+	}, {
+		name: "checksig with empty signature",
+		script: mustParseShortForm("DATA_32 0x" +
+			hex.EncodeToString(pubKey1) + " CHECKSIG NOT"),
+		witness:  []interface{}{[]byte{}},
+		wantPass: true,
+	}, {
+		name: "checksig with invalid signature",
+		script: mustParseShortForm("DATA_32 0x" +
+			hex.EncodeToString(pubKey1) + " CHECKSIG NOT"),
+		witness: []interface{}{sigFor{privKey2}},
+		wantErr: ErrTaprootSigInvalid,
+	}, {
+		name: "checksig with unknown public key type",
+		script: mustParseShortForm("DATA_33 0x02" +
+			hex.EncodeToString(pubKey1) + " CHECKSIG"),
+		witness:  []interface{}{[]byte{0x01}},
+		wantPass: true,
+	}, {
+		name:    "checksig with empty public key",
+		script:  mustParseShortForm("0 CHECKSIG"),
+		witness: []interface{}{sigFor{privKey1}},
+		wantErr: ErrTaprootPubKeyEmpty,
+	}, {
+		name: "checksigadd 2-of-2",
+		script: mustParseShortForm("DATA_32 0x" +
+			hex.EncodeToString(pubKey1) + " CHECKSIG DATA_32 0x" +
+			hex.EncodeToString(pubKey2) + " CHECKSIGADD 2 " +
+			"NUMEQUAL"),
+		witness:  []interface{}{sigFor{privKey2}, sigFor{privKey1}},
+		wantPass: true,
+	}, {
+		name: "checksigadd 1-of-2",
+		script: mustParseShortForm("DATA_32 0x" +
+			hex.EncodeToString(pubKey1) + " CHECKSIG DATA_32 0x" +
+			hex.EncodeToString(pubKey2) + " CHECKSIGADD 2 " +
+			"NUMEQUAL"),
+		witness: []interface{}{[]byte{}, sigFor{privKey1}},
+		wantErr: ErrEvalFalse,
+	}, {
+		name: "checksig after codeseparator",
+		script: mustParseShortForm("CODESEPARATOR DATA_32 0x" +
+			hex.EncodeToString(pubKey1) + " CHECKSIG"),
+		witness: []interface{}{sigFor{privKey1}},
+		wantErr: ErrTaprootSigInvalid,
+	}, {
+		name: "checkmultisig disabled",
+		script: mustParseShortForm("1 DATA_32 0x" +
+			hex.EncodeToString(pubKey1) + " 1 CHECKMULTISIG"),
+		witness: []interface{}{[]byte{}, sigFor{privKey1}},
+		wantErr: ErrTapscriptCheckMultisig,
+	}, {
+		name:    "non-minimal if",
+		script:  mustParseShortForm("IF 1 ENDIF"),
+		witness: []interface{}{[]byte{0x02}},
+		wantErr: ErrMinimalIf,
+	}, {
+		name:    "unclean stack",
+		script:  mustParseShortForm("1"),
+		witness: []interface{}{[]byte{0x01}},
+		wantErr: ErrEvalFalse,
+	}, {
+		name:     "op success",
+		script:   mustParseShortForm("RETURN 0x50"),
+		wantPass: true,
+	}, {
+		name:     "op success before parse failure",
+		script:   mustParseShortForm("0x50 0x4c"),
+		wantPass: true,
+	}, {
+		name:        "unknown leaf version",
+		script:      mustParseShortForm("RETURN"),
+		leafVersion: 0xc2,
+		wantPass:    true,
+	}, {
+		name:   "wrong parity",
+		script: mustParseShortForm("1"),
+		modifyCB: func(cb []byte) []byte {
+			cb[0] ^= 0x01
+			return cb
+		},
+		wantErr: ErrTaprootOutputKeyParityMismatch,
+	}, {
+		name:   "wrong inclusion proof",
+		script: mustParseShortForm("1"),
+		modifyCB: func(cb []byte) []byte {
+			return append(cb, make([]byte, ControlBlockNodeSize)...)
+		},
+		wantErr: ErrTaprootMerkleProofInvalid,
+	}, {
+		name:   "invalid control block",
+		script: mustParseShortForm("1"),
+		modifyCB: func(cb []byte) []byte {
+			return cb[:ControlBlockBaseSize-1]
+		},
+		wantErr: ErrControlBlockInvalidLength,
+	}}
+	for _, test := range tests {
+		leafVersion := test.leafVersion
+		if leafVersion == 0 {
+			leafVersion = BaseLeafVersion
+		}
+
+		// Commit to the tested script along with another leaf so the
+		// control block includes an inclusion proof.
+		otherLeaf := TapLeafHash(BaseLeafVersion, []byte{OP_RETURN})
+		leafHash := TapLeafHash(leafVersion, test.script)
+		rootHash := TapBranchHash(leafHash[:], otherLeaf[:])
+		qx, yIsOdd, err := tweakTaprootKey(internalKey, rootHash[:])
+		if err != nil {
+			t.Fatalf("%s: tweakTaprootKey: %v", test.name, err)
+		}
+		outputKey := serializeSchnorrPubKey(qx)
+		controlBlock := append([]byte{leafVersion}, internalKey...)
+		if yIsOdd {
+			controlBlock[0] |= 0x01
+		}
+		controlBlock = append(controlBlock, otherLeaf[:]...)
+		if test.modifyCB != nil {
+			controlBlock = test.modifyCB(controlBlock)
+		}
+
+		tx, prevOuts := taprootTestTx(payToTaprootScript(outputKey))
+		sigHashes, err := NewTxSigHashesWithPrevOuts(tx, prevOuts)
+		if err != nil {
+			t.Fatalf("%s: NewTxSigHashesWithPrevOuts: %v",
+				test.name, err)
+		}
+		hash, err := CalcTapscriptSignatureHash(sigHashes,
+			SigHashDefault, tx, 0, prevOuts, leafHash)
+		if err != nil {
+			t.Fatalf("%s: CalcTapscriptSignatureHash: %v",
+				test.name, err)
+		}
+
+		var witness wire.TxWitness
+		for _, item := range test.witness {
+			switch item := item.(type) {
+			case sigFor:
+				witness = append(witness,
+					signSchnorr(item.privKey, hash))
+			case []byte:
+				witness = append(witness, item)
+			}
+		}
+		tx.TxIn[0].Witness = append(witness, test.script, controlBlock)
+
+		err = executeTaprootSpend(tx, prevOuts, sigHashes)
+		if test.wantPass {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name,
+					err)
+			}
+			continue
+		}
+		if !IsErrorCode(err, test.wantErr) {
+			t.Errorf("%s: got error %v, want %v", test.name, err,
+				test.wantErr)
+		}
+	}
+}
+
+// TestTapscriptSigOpsBudget ensures the signature checks of a tapscript are
+// limited by the size of its witness.
+func TestTapscriptSigOpsBudget(t *testing.T) {
+	t.Parallel()
+
+	privKey := big.NewInt(0x4444)
+	pubKey := schnorrPubKey(privKey)
+	internalKey := schnorrPubKey(big.NewInt(0x5555))
+
+	// Each signature check of the script uses the same signature, which is
+	// the only non-script witness element, so the budget is exceeded once
+	// the number of checks outweighs the size of the witness.
+	for _, numChecks := range []int{3, 4} {
+		builder := NewScriptBuilder()
+		for i := 0; i < numChecks; i++ {
+			builder.AddOp(OP_DUP).AddData(pubKey).
+				AddOp(OP_CHECKSIGVERIFY)
+		}
+		script, err := builder.AddOp(OP_DROP).AddOp(OP_TRUE).Script()
+		if err != nil {
+			t.Fatalf("Script: %v", err)
+		}
+
+		leafHash := TapLeafHash(BaseLeafVersion, script)
+		qx, yIsOdd, err := tweakTaprootKey(internalKey, leafHash[:])
+		if err != nil {
+			t.Fatalf("tweakTaprootKey: %v", err)
+		}
+		controlBlock := append([]byte{BaseLeafVersion}, internalKey...)
+		if yIsOdd {
+			controlBlock[0] |= 0x01
+		}
+
+		outputKey := serializeSchnorrPubKey(qx)
+		tx, prevOuts := taprootTestTx(payToTaprootScript(outputKey))
+		sigHashes, err := NewTxSigHashesWithPrevOuts(tx, prevOuts)
+		if err != nil {
+			t.Fatalf("NewTxSigHashesWithPrevOuts: %v", err)
+		}
+		hash, err := CalcTapscriptSignatureHash(sigHashes,
+			SigHashDefault, tx, 0, prevOuts, leafHash)
+		if err != nil {
+			t.Fatalf("CalcTapscriptSignatureHash: %v", err)
+		}
+		tx.TxIn[0].Witness = wire.TxWitness{signSchnorr(privKey, hash),
+			script, controlBlock}
+
+		budget := sigOpsDelta + tx.TxIn[0].Witness.SerializeSize()
+		err = executeTaprootSpend(tx, prevOuts, sigHashes)
+		if numChecks*sigOpsDelta <= budget {
+			if err != nil {
+				t.Errorf("%d checks: unexpected error: %v",
+					numChecks, err)
+			}
+			continue
+		}
+		if !IsErrorCode(err, ErrTaprootMaxSigOps) {
+			t.Errorf("%d checks: got error %v, want %v", numChecks,
+				err, ErrTaprootMaxSigOps)
+		}
+	}
+}
+
+// refTaprootSigMsg returns the message, including the epoch, which is hashed to
+// produce the taproot signature hash of the specified input as it is spelled
+// out in BIP0341 and BIP0342.  Unlike calcTaprootSignatureHash, it serializes
+// every field from scratch instead of using precomputed hashes, so it serves as
+// an independent reference.  A nil leaf hash denotes a key path spend.
+func refTaprootSigMsg(tx *wire.MsgTx, spent []*wire.TxOut, idx int,
+	hashType SigHashType, annex, leafHash []byte, codeSepPos uint32) []byte {
+
+	le32 := func(w *bytes.Buffer, v uint32) {
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], v)
+		w.Write(b[:])
+	}
+	le64 := func(w *bytes.Buffer, v int64) {
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], uint64(v))
+		w.Write(b[:])
+	}
+	sha := func(b []byte) []byte {
+		h := sha256.Sum256(b)
+		return h[:]
+	}
+
+	outputType := hashType & 0x03
+	anyoneCanPay := hashType&0x80 != 0
+
+	var m bytes.Buffer
+	m.WriteByte(0x00)
+	m.WriteByte(byte(hashType))
+	le32(&m, uint32(tx.Version))
+	le32(&m, tx.LockTime)
+	if !anyoneCanPay {
+		var prevouts, amounts, scripts, sequences bytes.Buffer
+		for i, txIn := range tx.TxIn {
+			prevouts.Write(txIn.PreviousOutPoint.Hash[:])
+			le32(&prevouts, txIn.PreviousOutPoint.Index)
+			le64(&amounts, spent[i].Value)
+			wire.WriteVarBytes(&scripts, 0, spent[i].PkScript)
+			le32(&sequences, txIn.Sequence)
+		}
+		m.Write(sha(prevouts.Bytes()))
+		m.Write(sha(amounts.Bytes()))
+		m.Write(sha(scripts.Bytes()))
+		m.Write(sha(sequences.Bytes()))
+	}
+	if outputType != 0x02 && outputType != 0x03 {
+		var outputs bytes.Buffer
+		for _, txOut := range tx.TxOut {
+			wire.WriteTxOut(&outputs, 0, 0, txOut)
+		}
+		m.Write(sha(outputs.Bytes()))
+	}
+
+	var spendType byte
+	if leafHash != nil {
+		spendType = 2
+	}
+	if annex != nil {
+		spendType++
+	}
+	m.WriteByte(spendType)
+	if anyoneCanPay {
+		txIn := tx.TxIn[idx]
+		m.Write(txIn.PreviousOutPoint.Hash[:])
+		le32(&m, txIn.PreviousOutPoint.Index)
+		le64(&m, spent[idx].Value)
+		wire.WriteVarBytes(&m, 0, spent[idx].PkScript)
+		le32(&m, txIn.Sequence)
+	} else {
+		le32(&m, uint32(idx))
+	}
+	if annex != nil {
+		var b bytes.Buffer
+		wire.WriteVarBytes(&b, 0, annex)
+		m.Write(sha(b.Bytes()))
+	}
+	if outputType == 0x03 {
+		var b bytes.Buffer
+		wire.WriteTxOut(&b, 0, 0, tx.TxOut[idx])
+		m.Write(sha(b.Bytes()))
+	}
+	if leafHash != nil {
+		m.Write(leafHash)
+		m.WriteByte(0x00)
+		le32(&m, codeSepPos)
+	}
+	return m.Bytes()
+}
+
+// TestTaprootSigHashReference ensures the taproot signature hashes match those
+// of the reference implementation for all hash types, with and without an
+// annex, and for key path as well as script path spends with and without an
+// executed OP_CODESEPARATOR.
+func TestTaprootSigHashReference(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(0x7e57))
+	randBytes := func(n int) []byte {
+		b := make([]byte, n)
+		rng.Read(b)
+		return b
+	}
+
+	hashTypes := []SigHashType{SigHashDefault, SigHashAll, SigHashNone,
+		SigHashSingle, SigHashAll | SigHashAnyOneCanPay,
+		SigHashNone | SigHashAnyOneCanPay,
+		SigHashSingle | SigHashAnyOneCanPay}
+	for iter := 0; iter < 20; iter++ {
+		tx := wire.NewMsgTx(rng.Int31())
+		tx.LockTime = rng.Uint32()
+		prevOuts := make(MultiPrevOutFetcher)
+		var spent []*wire.TxOut
+		numInputs := 1 + rng.Intn(4)
+		for i := 0; i < numInputs; i++ {
+			var op wire.OutPoint
+			copy(op.Hash[:], randBytes(32))
+			op.Index = rng.Uint32()
+			tx.AddTxIn(&wire.TxIn{PreviousOutPoint: op,
+				Sequence: rng.Uint32()})
+			prevOut := wire.NewTxOut(rng.Int63n(1e15),
+				randBytes(rng.Intn(40)))
+			prevOuts[op] = prevOut
+			spent = append(spent, prevOut)
+		}
+		for i := 0; i < numInputs+1; i++ {
+			tx.AddTxOut(wire.NewTxOut(rng.Int63n(1e15),
+				randBytes(rng.Intn(40))))
+		}
+		sigHashes, err := NewTxSigHashesWithPrevOuts(tx, prevOuts)
+		if err != nil {
+			t.Fatalf("NewTxSigHashesWithPrevOuts: %v", err)
+		}
+
+		idx := rng.Intn(numInputs)
+		annexes := [][]byte{nil, append([]byte{0x50}, randBytes(
+			rng.Intn(300))...)}
+		leafHash := randBytes(32)
+		for _, hashType := range hashTypes {
+			for _, annex := range annexes {
+				tests := []struct {
+					name       string
+					leafHash   []byte
+					codeSepPos uint32
+				}{
+					{"key path", nil, blankCodeSepValue},
+					{"script path", leafHash, blankCodeSepValue},
+					{"script path with codesep", leafHash,
+						rng.Uint32() % 1000},
+				}
+				for _, test := range tests {
+					opts := taprootSigHashOptions{
+						annex:       annex,
+						tapLeafHash: test.leafHash,
+						codeSepPos:  test.codeSepPos,
+					}
+					got, err := calcTaprootSignatureHash(
+						sigHashes, hashType, tx, idx,
+						spent[idx], &opts)
+					if err != nil {
+						t.Fatalf("%s: unexpected error: %v",
+							test.name, err)
+					}
+					want := taggedHash(tagTapSighash,
+						refTaprootSigMsg(tx, spent, idx,
+							hashType, annex,
+							test.leafHash,
+							test.codeSepPos))
+					if !bytes.Equal(got, want[:]) {
+						t.Fatalf("%s: hash type 0x%x, "+
+							"annex %v: got %x, want %x",
+							test.name, hashType,
+							annex != nil, got, want)
+					}
+				}
+			}
+		}
+	}
+}
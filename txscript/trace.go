@@ -0,0 +1,152 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// TraceStep describes a single opcode executed by an engine along with the
+// state of its stacks right after the opcode was executed.
+type TraceStep struct {
+	// ScriptIdx and OpcodeIdx identify the opcode by the index of the
+	// script it is part of and its index within that script.  Index 0 is
+	// the signature script, 1 the public key script, and any following
+	// scripts are redeem or witness scripts.
+	ScriptIdx int
+	OpcodeIdx int
+
+	// Opcode is the disassembly of the opcode.
+	Opcode string
+
+	// Executed is false when the opcode was skipped because it is part of
+	// a conditional branch which is not executed.
+	Executed bool
+
+	// Stack and AltStack are the contents of the data and alternate stack
+	// after the opcode was executed where the last item is the top of the
+	// stack.
+	Stack    [][]byte
+	AltStack [][]byte
+
+	// Err is the error which caused execution to fail at the opcode, if
+	// any.  It is always the last step of a trace.
+	Err error
+}
+
+// String returns a human-readable representation of the trace step which
+// consists of the program counter, the opcode, and the stacks.
+func (s *TraceStep) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%02x:%04x: %s", s.ScriptIdx, s.OpcodeIdx, s.Opcode)
+	if !s.Executed {
+		buf.WriteString(" (not executed)")
+	}
+	if s.Err != nil {
+		fmt.Fprintf(&buf, " failed: %v", s.Err)
+	}
+	buf.WriteByte('\n')
+	writeTraceStack(&buf, "stack", s.Stack)
+	if len(s.AltStack) != 0 {
+		writeTraceStack(&buf, "altstack", s.AltStack)
+	}
+	return buf.String()
+}
+
+// writeTraceStack writes the passed stack, starting with the top item, to the
+// passed buffer with one item per line.
+func writeTraceStack(buf *bytes.Buffer, name string, stack [][]byte) {
+	fmt.Fprintf(buf, "  %s (%d items)\n", name, len(stack))
+	for i := len(stack) - 1; i >= 0; i-- {
+		fmt.Fprintf(buf, "    %02d: %x\n", len(stack)-1-i, stack[i])
+	}
+}
+
+// TraceFunc is a function which is called by an engine for every opcode it
+// executes.  The passed step is not accessed by the engine afterwards, so it
+// may be retained.
+type TraceFunc func(step *TraceStep)
+
+// Trace is the record of all of the opcodes executed by an engine.
+type Trace struct {
+	// Steps are the executed opcodes in the order they were executed.
+	Steps []*TraceStep
+
+	// Err is the result of the execution, which is nil when the scripts
+	// executed successfully.
+	Err error
+}
+
+// String returns a human-readable representation of the trace which lists
+// every executed opcode along with the state of the stacks afterwards.
+func (t *Trace) String() string {
+	var buf bytes.Buffer
+	for _, step := range t.Steps {
+		buf.WriteString(step.String())
+	}
+	if t.Err != nil {
+		fmt.Fprintf(&buf, "execution failed: %v\n", t.Err)
+	} else {
+		buf.WriteString("execution succeeded\n")
+	}
+	return buf.String()
+}
+
+// SetTraceFunc sets a function which is called by the engine with the state of
+// the engine after each opcode it executes.  This is intended for debugging
+// scripts, such as showing why a script fails, and slows down execution
+// considerably, so it must not be set when validating transactions.  A nil
+// function disables tracing.  It must be called before the scripts are
+// executed.
+func (vm *Engine) SetTraceFunc(traceFunc TraceFunc) {
+	vm.traceFunc = traceFunc
+}
+
+// ExecuteWithTrace executes all scripts in the script engine like Execute and
+// returns the record of all of the executed opcodes.  The error of the
+// execution is returned by the Err field of the trace as well.
+func (vm *Engine) ExecuteWithTrace() (*Trace, error) {
+	var trace Trace
+	prevTraceFunc := vm.traceFunc
+	vm.traceFunc = func(step *TraceStep) {
+		trace.Steps = append(trace.Steps, step)
+		if prevTraceFunc != nil {
+			prevTraceFunc(step)
+		}
+	}
+	trace.Err = vm.Execute()
+	vm.traceFunc = prevTraceFunc
+	return &trace, trace.Err
+}
+
+// traceStep calls the trace function of the engine, if any, for the passed
+// opcode located at the passed position which was just executed with the
+// passed result.
+func (vm *Engine) traceStep(scriptIdx, opcodeIdx int, pop *parsedOpcode,
+	executed bool, err error) {
+
+	if vm.traceFunc == nil {
+		return
+	}
+
+	// Copy the stack items since the trace function may retain them.
+	copyStack := func(s *stack) [][]byte {
+		items := getStack(s)
+		for i := range items {
+			items[i] = append([]byte(nil), items[i]...)
+		}
+		return items
+	}
+	vm.traceFunc(&TraceStep{
+		ScriptIdx: scriptIdx,
+		OpcodeIdx: opcodeIdx,
+		Opcode:    pop.print(false),
+		Executed:  executed,
+		Stack:     copyStack(&vm.dstack),
+		AltStack:  copyStack(&vm.astack),
+		Err:       err,
+	})
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ifishnet/hdfd/wire"
+)
+
+// TestExecuteWithTrace ensures the trace of an execution records every opcode
+// of all of the scripts along with the stacks after executing it, including
+// the opcodes of branches which are not executed and the opcode that failed.
+func TestExecuteWithTrace(t *testing.T) {
+	t.Parallel()
+
+	type step struct {
+		scriptIdx, opcodeIdx int
+		opcode               string
+		executed             bool
+		stack                [][]byte
+		failed               bool
+	}
+	tests := []struct {
+		name      string
+		sigScript string
+		pkScript  string
+		steps     []step
+		valid     bool
+	}{{
+		name:      "arithmetic",
+		sigScript: "1 2",
+		pkScript:  "ADD 3 EQUAL",
+		steps: []step{
+			{0, 0, "OP_1", true, [][]byte{{1}}, false},
+			{0, 1, "OP_2", true, [][]byte{{1}, {2}}, false},
+			{1, 0, "OP_ADD", true, [][]byte{{3}}, false},
+			{1, 1, "OP_3", true, [][]byte{{3}, {3}}, false},
+			{1, 2, "OP_EQUAL", true, [][]byte{{1}}, false},
+		},
+		valid: true,
+	}, {
+		name:      "skipped branch",
+		sigScript: "0",
+		pkScript:  "IF 2 ELSE 3 ENDIF",
+		steps: []step{
+			{0, 0, "OP_0", true, [][]byte{nil}, false},
+			{1, 0, "OP_IF", true, [][]byte{}, false},
+			{1, 1, "OP_2", false, [][]byte{}, false},
+			{1, 2, "OP_ELSE", false, [][]byte{}, false},
+			{1, 3, "OP_3", true, [][]byte{{3}}, false},
+			{1, 4, "OP_ENDIF", true, [][]byte{{3}}, false},
+		},
+		valid: true,
+	}, {
+		name:      "failed verify",
+		sigScript: "1 2",
+		pkScript:  "EQUALVERIFY 1",
+		steps: []step{
+			{0, 0, "OP_1", true, [][]byte{{1}}, false},
+			{0, 1, "OP_2", true, [][]byte{{1}, {2}}, false},
+			{1, 0, "OP_EQUALVERIFY", true, [][]byte{}, true},
+		},
+		valid: false,
+	}}
+
+	for _, test := range tests {
+		tx := wire.NewMsgTx(1)
+		tx.AddTxIn(&wire.TxIn{
+			SignatureScript: mustParseShortForm(test.sigScript),
+			Sequence:        wire.MaxTxInSequenceNum,
+		})
+		tx.AddTxOut(wire.NewTxOut(0, nil))
+		vm, err := NewEngine(mustParseShortForm(test.pkScript), tx, 0, 0,
+			nil, nil, 0)
+		if err != nil {
+			t.Fatalf("%s: NewEngine: unexpected error: %v", test.name,
+				err)
+		}
+
+		// The trace function must be called for every step as well.
+		var numCalls int
+		vm.SetTraceFunc(func(*TraceStep) { numCalls++ })
+
+		trace, err := vm.ExecuteWithTrace()
+		if (err == nil) != test.valid || trace.Err != err {
+			t.Errorf("%s: unexpected result: %v (trace: %v)",
+				test.name, err, trace.Err)
+			continue
+		}
+		if len(trace.Steps) != len(test.steps) ||
+			numCalls != len(test.steps) {
+
+			t.Errorf("%s: got %d steps and %d calls, want %d:\n%v",
+				test.name, len(trace.Steps), numCalls,
+				len(test.steps), trace)
+			continue
+		}
+		for i, want := range test.steps {
+			got := trace.Steps[i]
+			if got.ScriptIdx != want.scriptIdx ||
+				got.OpcodeIdx != want.opcodeIdx ||
+				got.Opcode != want.opcode ||
+				got.Executed != want.executed ||
+				!reflect.DeepEqual(got.Stack, want.stack) ||
+				(got.Err != nil) != want.failed {
+
+				t.Errorf("%s: step %d: got %v", test.name, i, got)
+			}
+		}
+
+		// The human-readable trace must mention every opcode.
+		str := trace.String()
+		for _, want := range test.steps {
+			if !strings.Contains(str, want.opcode) {
+				t.Errorf("%s: trace does not contain %s:\n%s",
+					test.name, want.opcode, str)
+			}
+		}
+	}
+}
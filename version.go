@@ -30,6 +30,15 @@ const (
 // contain characters from semanticAlphabet per the semantic versioning spec.
 var appBuild string
 
+// appGitCommit and appBuildDate are defined as variables so they can be set
+// during the build process with '-ldflags "-X main.appGitCommit=foo"' to the
+// git commit the binary was built from and the date it was built on.  They are
+// only reported through the version RPC when set.
+var (
+	appGitCommit string
+	appBuildDate string
+)
+
 // version returns the application version as a properly formed string per the
 // semantic versioning 2.0.0 spec (http://semver.org/).
 func version() string {
@@ -632,3 +632,37 @@ func BenchmarkDoubleHashH(b *testing.B) {
 		_ = chainhash.DoubleHashH(txBytes)
 	}
 }
+
+// BenchmarkDecodeBlock performs a benchmark on how long it takes to decode a
+// block with many transactions when every transaction is individually
+// allocated.
+func BenchmarkDecodeBlock(b *testing.B) {
+	_, buf := arenaTestBlock(b, 1000)
+
+	r := bytes.NewReader(buf)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Seek(0, 0)
+		var msg MsgBlock
+		msg.HdfDecode(r, ProtocolVersion, WitnessEncoding)
+	}
+}
+
+// BenchmarkDecodeBlockArena performs a benchmark on how long it takes to
+// decode a block with many transactions when the storage is carved from a
+// reused arena.
+func BenchmarkDecodeBlockArena(b *testing.B) {
+	_, buf := arenaTestBlock(b, 1000)
+
+	r := bytes.NewReader(buf)
+	arena := NewDecodeArena(3000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Seek(0, 0)
+		arena.Reset()
+		var msg MsgBlock
+		msg.DecodeInto(r, ProtocolVersion, WitnessEncoding, arena)
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Capability identifies a protocol feature which is only available when the
+// protocol version negotiated with a peer is high enough.
+type Capability uint8
+
+const (
+	// CapMultipleAddresses indicates multiple addresses per addr message
+	// are supported.
+	CapMultipleAddresses Capability = iota
+
+	// CapAddrTimestamp indicates addresses include a timestamp.
+	CapAddrTimestamp
+
+	// CapPong indicates ping messages include a nonce and are answered
+	// with pong messages (BIP0031).
+	CapPong
+
+	// CapMemPool indicates the mempool message is supported (BIP0035).
+	CapMemPool
+
+	// CapBloomFilter indicates the bloom filtering messages and the relay
+	// flag of the version message are supported (BIP0037).
+	CapBloomFilter
+
+	// CapReject indicates the reject message is supported.
+	CapReject
+
+	// CapBloomService indicates bloom filtering is only supported by
+	// peers which advertise the SFNodeBloom service flag (BIP0111).
+	CapBloomService
+
+	// CapSendHeaders indicates the sendheaders message is supported
+	// (BIP0130).
+	CapSendHeaders
+
+	// CapFeeFilter indicates the feefilter message is supported
+	// (BIP0133).
+	CapFeeFilter
+
+	// CapCompactBlocks indicates the compact block relay messages are
+	// supported (BIP0152).
+	CapCompactBlocks
+
+	// CapAddrV2 indicates the sendaddrv2 and addrv2 messages are
+	// supported (BIP0155).
+	CapAddrV2
+
+	// CapWTxIdRelay indicates the wtxidrelay message and the MSG_WTX
+	// inventory type are supported (BIP0339).
+	CapWTxIdRelay
+
+	// CapPackageRelay indicates the package relay messages and the
+	// MSG_ANCPKGINFO inventory type are supported (BIP0331).  Package
+	// relay requires wtxid-based transaction relay, so it shares its
+	// protocol version.
+	CapPackageRelay
+
+	// numCapabilities is the total number of capabilities in the
+	// registry.  It MUST be the last constant.
+	numCapabilities
+)
+
+// capabilityInfo houses the details about a capability in the registry.
+type capabilityInfo struct {
+	name       string
+	minVersion uint32
+	commands   []string
+	services   ServiceFlag
+}
+
+// capabilityRegistry maps each capability to the minimum protocol version it
+// was introduced in along with the messages and service flags it introduced.
+// Messages that are not part of any capability are supported by all protocol
+// versions.
+var capabilityRegistry = [numCapabilities]capabilityInfo{
+	CapMultipleAddresses: {
+		name:       "CapMultipleAddresses",
+		minVersion: MultipleAddressVersion,
+	},
+	CapAddrTimestamp: {
+		name:       "CapAddrTimestamp",
+		minVersion: NetAddressTimeVersion,
+	},
+	CapPong: {
+		name:       "CapPong",
+		minVersion: BIP0031Version + 1,
+		commands:   []string{CmdPong},
+	},
+	CapMemPool: {
+		name:       "CapMemPool",
+		minVersion: BIP0035Version,
+		commands:   []string{CmdMemPool},
+	},
+	CapBloomFilter: {
+		name:       "CapBloomFilter",
+		minVersion: BIP0037Version,
+		commands: []string{CmdFilterAdd, CmdFilterClear, CmdFilterLoad,
+			CmdMerkleBlock},
+	},
+	CapReject: {
+		name:       "CapReject",
+		minVersion: RejectVersion,
+		commands:   []string{CmdReject},
+	},
+	CapBloomService: {
+		name:       "CapBloomService",
+		minVersion: BIP0111Version,
+		services:   SFNodeBloom,
+	},
+	CapSendHeaders: {
+		name:       "CapSendHeaders",
+		minVersion: SendHeadersVersion,
+		commands:   []string{CmdSendHeaders},
+	},
+	CapFeeFilter: {
+		name:       "CapFeeFilter",
+		minVersion: FeeFilterVersion,
+		commands:   []string{CmdFeeFilter},
+	},
+	CapCompactBlocks: {
+		name:       "CapCompactBlocks",
+		minVersion: SendCmpctVersion,
+		commands: []string{CmdSendCmpct, CmdCmpctBlock, CmdGetBlockTxn,
+			CmdBlockTxn},
+	},
+	CapAddrV2: {
+		name:       "CapAddrV2",
+		minVersion: AddrV2Version,
+		commands:   []string{CmdSendAddrV2, CmdAddrV2},
+	},
+	CapWTxIdRelay: {
+		name:       "CapWTxIdRelay",
+		minVersion: WTxIdRelayVersion,
+		commands:   []string{CmdWTxIdRelay},
+	},
+	CapPackageRelay: {
+		name:       "CapPackageRelay",
+		minVersion: WTxIdRelayVersion,
+		commands: []string{CmdSendPackages, CmdAncPkgInfo,
+			CmdGetPkgTxns, CmdPkgTxns},
+	},
+}
+
+// commandCapabilities maps the messages introduced by capabilities to the
+// capability that introduced them.
+var commandCapabilities = func() map[string]Capability {
+	m := make(map[string]Capability)
+	for c := range capabilityRegistry {
+		for _, cmd := range capabilityRegistry[c].commands {
+			m[cmd] = Capability(c)
+		}
+	}
+	return m
+}()
+
+// String returns the Capability in human-readable form.
+func (c Capability) String() string {
+	if c < numCapabilities {
+		return capabilityRegistry[c].name
+	}
+	return fmt.Sprintf("Unknown Capability (%d)", uint8(c))
+}
+
+// MinProtocolVersion returns the minimum protocol version which supports the
+// capability.
+func (c Capability) MinProtocolVersion() uint32 {
+	if c < numCapabilities {
+		return capabilityRegistry[c].minVersion
+	}
+	return ^uint32(0)
+}
+
+// Commands returns the commands of the messages introduced by the capability.
+func (c Capability) Commands() []string {
+	if c >= numCapabilities {
+		return nil
+	}
+	commands := capabilityRegistry[c].commands
+	return append([]string(nil), commands...)
+}
+
+// Services returns the service flags whose meaning was introduced or changed
+// by the capability.
+func (c Capability) Services() ServiceFlag {
+	if c < numCapabilities {
+		return capabilityRegistry[c].services
+	}
+	return 0
+}
+
+// CapabilitySet is a set of capabilities.
+type CapabilitySet uint32
+
+// Has returns whether or not the provided capability is in the set.
+func (s CapabilitySet) Has(c Capability) bool {
+	return c < numCapabilities && s&(1<<c) != 0
+}
+
+// SupportsCommand returns whether or not the message with the provided command
+// is supported by the capabilities in the set.  Messages that are not part of
+// any capability are always supported.
+func (s CapabilitySet) SupportsCommand(command string) bool {
+	c, ok := commandCapabilities[command]
+	return !ok || s.Has(c)
+}
+
+// String returns the CapabilitySet in human-readable form.
+func (s CapabilitySet) String() string {
+	if s == 0 {
+		return "none"
+	}
+
+	var names []string
+	for c := Capability(0); c < numCapabilities; c++ {
+		if s.Has(c) {
+			names = append(names, c.String())
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// CapabilitiesForVersion returns the set of capabilities supported by the
+// provided protocol version.
+func CapabilitiesForVersion(pver uint32) CapabilitySet {
+	var s CapabilitySet
+	for c := range capabilityRegistry {
+		if pver >= capabilityRegistry[c].minVersion {
+			s |= 1 << uint(c)
+		}
+	}
+	return s
+}
+
+// Negotiate returns the protocol version to use with a peer which advertised
+// the provided remote protocol version given the provided local protocol
+// version along with the set of capabilities that are available as a result.
+func Negotiate(localVer, remoteVer uint32) (uint32, CapabilitySet) {
+	pver := localVer
+	if remoteVer < pver {
+		pver = remoteVer
+	}
+	return pver, CapabilitiesForVersion(pver)
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestCapabilityStringer tests the stringized output for capabilities and
+// capability sets.
+func TestCapabilityStringer(t *testing.T) {
+	tests := []struct {
+		in   Capability
+		want string
+	}{
+		{CapMultipleAddresses, "CapMultipleAddresses"},
+		{CapAddrTimestamp, "CapAddrTimestamp"},
+		{CapPong, "CapPong"},
+		{CapMemPool, "CapMemPool"},
+		{CapBloomFilter, "CapBloomFilter"},
+		{CapReject, "CapReject"},
+		{CapBloomService, "CapBloomService"},
+		{CapSendHeaders, "CapSendHeaders"},
+		{CapFeeFilter, "CapFeeFilter"},
+		{CapCompactBlocks, "CapCompactBlocks"},
+		{CapAddrV2, "CapAddrV2"},
+		{CapWTxIdRelay, "CapWTxIdRelay"},
+		{CapPackageRelay, "CapPackageRelay"},
+		{0xff, "Unknown Capability (255)"},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		result := test.in.String()
+		if result != test.want {
+			t.Errorf("String #%d\n got: %s want: %s", i, result,
+				test.want)
+		}
+	}
+
+	set := CapabilitiesForVersion(BIP0031Version + 1)
+	want := "CapMultipleAddresses|CapAddrTimestamp|CapPong"
+	if result := set.String(); result != want {
+		t.Errorf("CapabilitySet.String\n got: %s want: %s", result, want)
+	}
+	if result := CapabilitySet(0).String(); result != "none" {
+		t.Errorf("CapabilitySet.String\n got: %s want: none", result)
+	}
+}
+
+// TestNegotiate ensures the negotiated protocol version and capabilities are
+// those of the lower of the local and remote protocol versions.
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name      string
+		localVer  uint32
+		remoteVer uint32
+		wantVer   uint32
+		has       []Capability
+		hasNot    []Capability
+	}{
+		{
+			name:      "both latest",
+			localVer:  ProtocolVersion,
+			remoteVer: ProtocolVersion,
+			wantVer:   ProtocolVersion,
+			has: []Capability{CapMultipleAddresses, CapAddrTimestamp,
+				CapPong, CapMemPool, CapBloomFilter, CapReject,
+				CapBloomService, CapSendHeaders, CapFeeFilter,
+				CapCompactBlocks, CapAddrV2, CapWTxIdRelay,
+				CapPackageRelay},
+		},
+		{
+			name:      "older remote",
+			localVer:  ProtocolVersion,
+			remoteVer: FeeFilterVersion,
+			wantVer:   FeeFilterVersion,
+			has:       []Capability{CapSendHeaders, CapFeeFilter},
+			hasNot: []Capability{CapCompactBlocks, CapAddrV2,
+				CapWTxIdRelay, CapPackageRelay},
+		},
+		{
+			name:      "older local",
+			localVer:  AddrV2Version,
+			remoteVer: ProtocolVersion,
+			wantVer:   AddrV2Version,
+			has:       []Capability{CapAddrV2},
+			hasNot:    []Capability{CapWTxIdRelay, CapPackageRelay},
+		},
+		{
+			name:      "BIP0031 boundary",
+			localVer:  ProtocolVersion,
+			remoteVer: BIP0031Version,
+			wantVer:   BIP0031Version,
+			has:       []Capability{CapAddrTimestamp},
+			hasNot:    []Capability{CapPong, CapMemPool},
+		},
+		{
+			name:      "ancient remote",
+			localVer:  ProtocolVersion,
+			remoteVer: 0,
+			wantVer:   0,
+			hasNot:    []Capability{CapMultipleAddresses},
+		},
+	}
+
+	for _, test := range tests {
+		pver, caps := Negotiate(test.localVer, test.remoteVer)
+		if pver != test.wantVer {
+			t.Errorf("%s: unexpected protocol version - got %d, "+
+				"want %d", test.name, pver, test.wantVer)
+			continue
+		}
+		if caps != CapabilitiesForVersion(pver) {
+			t.Errorf("%s: unexpected capabilities - got %v, want %v",
+				test.name, caps, CapabilitiesForVersion(pver))
+			continue
+		}
+		for _, c := range test.has {
+			if !caps.Has(c) {
+				t.Errorf("%s: missing capability %v", test.name, c)
+			}
+		}
+		for _, c := range test.hasNot {
+			if caps.Has(c) {
+				t.Errorf("%s: unexpected capability %v", test.name,
+					c)
+			}
+		}
+	}
+}
+
+// TestCapabilityRegistry ensures the messages and services introduced by
+// capabilities are reported as expected.
+func TestCapabilityRegistry(t *testing.T) {
+	caps := CapabilitiesForVersion(SendHeadersVersion)
+	tests := []struct {
+		command string
+		want    bool
+	}{
+		{CmdVersion, true},
+		{CmdTx, true},
+		{CmdPong, true},
+		{CmdFilterLoad, true},
+		{CmdSendHeaders, true},
+		{CmdFeeFilter, false},
+		{CmdCmpctBlock, false},
+		{CmdAddrV2, false},
+		{CmdWTxIdRelay, false},
+		{CmdPkgTxns, false},
+	}
+	for _, test := range tests {
+		if got := caps.SupportsCommand(test.command); got != test.want {
+			t.Errorf("SupportsCommand(%q): got %v, want %v",
+				test.command, got, test.want)
+		}
+	}
+
+	wantCmds := []string{CmdSendAddrV2, CmdAddrV2}
+	if cmds := CapAddrV2.Commands(); !reflect.DeepEqual(cmds, wantCmds) {
+		t.Errorf("Commands: got %v, want %v", cmds, wantCmds)
+	}
+	if services := CapBloomService.Services(); services != SFNodeBloom {
+		t.Errorf("Services: got %v, want %v", services, SFNodeBloom)
+	}
+	if pver := CapWTxIdRelay.MinProtocolVersion(); pver != WTxIdRelayVersion {
+		t.Errorf("MinProtocolVersion: got %d, want %d", pver,
+			WTxIdRelayVersion)
+	}
+
+	// Ensure every capability is supported by the latest protocol version.
+	if latest := CapabilitiesForVersion(ProtocolVersion); latest !=
+		1<<numCapabilities-1 {
+
+		t.Errorf("Latest protocol version capabilities: got %v", latest)
+	}
+}
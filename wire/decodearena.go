@@ -0,0 +1,254 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+// DecodeArena houses reusable backing storage for decoding transactions and
+// blocks via the DecodeInto methods of MsgTx and MsgBlock.
+//
+// Decoding a block normally requires several allocations per transaction for
+// the transaction itself, its inputs, outputs, witness stacks, and scripts,
+// which adds up to millions of small allocations the garbage collector must
+// track during the initial block download.  An arena instead carves all of
+// those from a small number of large buffers which are retained and reused
+// after Reset is called, so decoding reaches a steady state where no new
+// memory is allocated at all.
+//
+// IMPORTANT: Messages decoded using an arena refer directly to the memory
+// owned by the arena.  Callers MUST NOT use any messages, or data obtained
+// from them such as scripts, after calling Reset since their contents will
+// be overwritten by subsequent decodes.  Messages that need to outlive the
+// arena must be copied, for example via MsgTx.Copy.
+//
+// A DecodeArena is NOT safe for concurrent access.  The zero value is ready
+// for use.
+type DecodeArena struct {
+	txs       []MsgTx
+	txPtrs    []*MsgTx
+	txIns     []TxIn
+	txInPtrs  []*TxIn
+	txOuts    []TxOut
+	txOutPtrs []*TxOut
+	witnesses [][]byte
+	scripts   []byte
+
+	// The following fields track the total number of items carved from
+	// each of the buffers since the last reset, which may exceed their
+	// capacity when they were replaced with larger buffers while decoding.
+	// They are used to size the buffers so all of the items fit on reset.
+	numTxs       int
+	numTxIns     int
+	numTxOuts    int
+	numWitnesses int
+	numScripts   int
+}
+
+// NewDecodeArena returns a new decode arena with enough storage preallocated
+// to decode a block with roughly the provided number of transactions before
+// needing to grow.
+func NewDecodeArena(numTxs int) *DecodeArena {
+	// Assume two inputs and outputs per transaction along with an average
+	// of 100 bytes of scripts for each of them, which is roughly in line
+	// with the makeup of recent blocks.
+	return &DecodeArena{
+		txs:       make([]MsgTx, 0, numTxs),
+		txPtrs:    make([]*MsgTx, 0, numTxs),
+		txIns:     make([]TxIn, 0, numTxs*2),
+		txInPtrs:  make([]*TxIn, 0, numTxs*2),
+		txOuts:    make([]TxOut, 0, numTxs*2),
+		txOutPtrs: make([]*TxOut, 0, numTxs*2),
+		witnesses: make([][]byte, 0, numTxs*2),
+		scripts:   make([]byte, 0, numTxs*400),
+	}
+}
+
+// Reset makes all of the storage owned by the arena available for reuse by
+// future decodes.  See the type documentation for the implications this has
+// on previously decoded messages.
+//
+// Any buffers that had to be replaced while decoding are replaced once more
+// with buffers large enough to house everything that was decoded since the
+// previous reset, so decoding messages of a similar size again does not
+// require any further allocations.
+func (a *DecodeArena) Reset() {
+	if a.numTxs > cap(a.txs) {
+		a.txs = make([]MsgTx, 0, a.numTxs)
+		a.txPtrs = make([]*MsgTx, 0, a.numTxs)
+	}
+	if a.numTxIns > cap(a.txIns) {
+		a.txIns = make([]TxIn, 0, a.numTxIns)
+		a.txInPtrs = make([]*TxIn, 0, a.numTxIns)
+	}
+	if a.numTxOuts > cap(a.txOuts) {
+		a.txOuts = make([]TxOut, 0, a.numTxOuts)
+		a.txOutPtrs = make([]*TxOut, 0, a.numTxOuts)
+	}
+	if a.numWitnesses > cap(a.witnesses) {
+		a.witnesses = make([][]byte, 0, a.numWitnesses)
+	}
+	if a.numScripts > cap(a.scripts) {
+		a.scripts = make([]byte, 0, a.numScripts)
+	}
+
+	a.txs = a.txs[:0]
+	a.txPtrs = a.txPtrs[:0]
+	a.txIns = a.txIns[:0]
+	a.txInPtrs = a.txInPtrs[:0]
+	a.txOuts = a.txOuts[:0]
+	a.txOutPtrs = a.txOutPtrs[:0]
+	a.witnesses = a.witnesses[:0]
+	a.scripts = a.scripts[:0]
+	a.numTxs = 0
+	a.numTxIns = 0
+	a.numTxOuts = 0
+	a.numWitnesses = 0
+	a.numScripts = 0
+}
+
+// growCap returns the capacity to use for a new buffer that replaces one with
+// the provided capacity when it is unable to house the provided number of
+// additional items.  Buffers at least double in size so the number of times
+// they are replaced while decoding quickly drops to zero.
+func growCap(curCap, n int) int {
+	newCap := curCap * 2
+	if newCap < n {
+		newCap = n
+	}
+	return newCap
+}
+
+// allocTxs returns a slice of pointers to n zeroed transactions.  A nil arena
+// allocates them normally.
+//
+// NOTE: Buffers that are too small are replaced rather than reallocated with
+// their contents copied since previously decoded messages still refer to them.
+func (a *DecodeArena) allocTxs(n uint64) []*MsgTx {
+	if a == nil {
+		txs := make([]MsgTx, n)
+		ptrs := make([]*MsgTx, n)
+		for i := range txs {
+			ptrs[i] = &txs[i]
+		}
+		return ptrs
+	}
+
+	count := int(n)
+	a.numTxs += count
+	if a.txs == nil || len(a.txs)+count > cap(a.txs) {
+		a.txs = make([]MsgTx, 0, growCap(cap(a.txs), count))
+	}
+	if a.txPtrs == nil || len(a.txPtrs)+count > cap(a.txPtrs) {
+		a.txPtrs = make([]*MsgTx, 0, growCap(cap(a.txPtrs), count))
+	}
+	start, ptrStart := len(a.txs), len(a.txPtrs)
+	a.txs = a.txs[:start+count]
+	a.txPtrs = a.txPtrs[:ptrStart+count]
+	ptrs := a.txPtrs[ptrStart : ptrStart+count : ptrStart+count]
+	for i := 0; i < count; i++ {
+		a.txs[start+i] = MsgTx{}
+		ptrs[i] = &a.txs[start+i]
+	}
+	return ptrs
+}
+
+// allocTxIns returns a slice of pointers to n zeroed transaction inputs.  A
+// nil arena allocates them normally.
+func (a *DecodeArena) allocTxIns(n uint64) []*TxIn {
+	if a == nil {
+		txIns := make([]TxIn, n)
+		ptrs := make([]*TxIn, n)
+		for i := range txIns {
+			ptrs[i] = &txIns[i]
+		}
+		return ptrs
+	}
+
+	count := int(n)
+	a.numTxIns += count
+	if a.txIns == nil || len(a.txIns)+count > cap(a.txIns) {
+		a.txIns = make([]TxIn, 0, growCap(cap(a.txIns), count))
+	}
+	if a.txInPtrs == nil || len(a.txInPtrs)+count > cap(a.txInPtrs) {
+		a.txInPtrs = make([]*TxIn, 0, growCap(cap(a.txInPtrs), count))
+	}
+	start, ptrStart := len(a.txIns), len(a.txInPtrs)
+	a.txIns = a.txIns[:start+count]
+	a.txInPtrs = a.txInPtrs[:ptrStart+count]
+	ptrs := a.txInPtrs[ptrStart : ptrStart+count : ptrStart+count]
+	for i := 0; i < count; i++ {
+		a.txIns[start+i] = TxIn{}
+		ptrs[i] = &a.txIns[start+i]
+	}
+	return ptrs
+}
+
+// allocTxOuts returns a slice of pointers to n zeroed transaction outputs.  A
+// nil arena allocates them normally.
+func (a *DecodeArena) allocTxOuts(n uint64) []*TxOut {
+	if a == nil {
+		txOuts := make([]TxOut, n)
+		ptrs := make([]*TxOut, n)
+		for i := range txOuts {
+			ptrs[i] = &txOuts[i]
+		}
+		return ptrs
+	}
+
+	count := int(n)
+	a.numTxOuts += count
+	if a.txOuts == nil || len(a.txOuts)+count > cap(a.txOuts) {
+		a.txOuts = make([]TxOut, 0, growCap(cap(a.txOuts), count))
+	}
+	if a.txOutPtrs == nil || len(a.txOutPtrs)+count > cap(a.txOutPtrs) {
+		a.txOutPtrs = make([]*TxOut, 0, growCap(cap(a.txOutPtrs), count))
+	}
+	start, ptrStart := len(a.txOuts), len(a.txOutPtrs)
+	a.txOuts = a.txOuts[:start+count]
+	a.txOutPtrs = a.txOutPtrs[:ptrStart+count]
+	ptrs := a.txOutPtrs[ptrStart : ptrStart+count : ptrStart+count]
+	for i := 0; i < count; i++ {
+		a.txOuts[start+i] = TxOut{}
+		ptrs[i] = &a.txOuts[start+i]
+	}
+	return ptrs
+}
+
+// allocWitness returns a zeroed witness stack with n items.  A nil arena
+// allocates it normally.
+func (a *DecodeArena) allocWitness(n uint64) [][]byte {
+	if a == nil {
+		return make([][]byte, n)
+	}
+
+	count := int(n)
+	a.numWitnesses += count
+	if a.witnesses == nil || len(a.witnesses)+count > cap(a.witnesses) {
+		a.witnesses = make([][]byte, 0, growCap(cap(a.witnesses), count))
+	}
+	start := len(a.witnesses)
+	a.witnesses = a.witnesses[:start+count]
+	witness := a.witnesses[start : start+count : start+count]
+	for i := range witness {
+		witness[i] = nil
+	}
+	return witness
+}
+
+// allocScripts returns a buffer of n bytes to house the scripts of a
+// transaction.  The contents are not zeroed since the caller overwrites all
+// of them.  A nil arena allocates it normally.
+func (a *DecodeArena) allocScripts(n uint64) []byte {
+	if a == nil {
+		return make([]byte, n)
+	}
+
+	count := int(n)
+	a.numScripts += count
+	if a.scripts == nil || len(a.scripts)+count > cap(a.scripts) {
+		a.scripts = make([]byte, 0, growCap(cap(a.scripts), count))
+	}
+	start := len(a.scripts)
+	a.scripts = a.scripts[:start+count]
+	return a.scripts[start : start+count : start+count]
+}
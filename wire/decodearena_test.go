@@ -0,0 +1,120 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// arenaTestBlock returns a block with the provided number of copies of each of
+// the test transactions along with its serialized bytes.
+func arenaTestBlock(t testing.TB, copies int) (*MsgBlock, []byte) {
+	block := NewMsgBlock(&blockOne.Header)
+	for i := 0; i < copies; i++ {
+		block.AddTransaction(blockOne.Transactions[0])
+		block.AddTransaction(multiTx)
+		block.AddTransaction(multiWitnessTx)
+	}
+
+	var buf bytes.Buffer
+	if err := block.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize: unexpected error: %v", err)
+	}
+	return block, buf.Bytes()
+}
+
+// TestDecodeArena ensures blocks and transactions decoded via an arena are
+// identical to those decoded normally and that the arena storage is reused
+// after it is reset.
+func TestDecodeArena(t *testing.T) {
+	block, blockBytes := arenaTestBlock(t, 10)
+
+	tests := []struct {
+		name  string
+		arena *DecodeArena
+	}{
+		{"zero value", &DecodeArena{}},
+		{"preallocated", NewDecodeArena(1)},
+		{"nil", nil},
+	}
+
+	for _, test := range tests {
+		var msg MsgBlock
+		err := msg.DecodeInto(bytes.NewReader(blockBytes), ProtocolVersion,
+			WitnessEncoding, test.arena)
+		if err != nil {
+			t.Errorf("%s: DecodeInto: unexpected error: %v", test.name,
+				err)
+			continue
+		}
+		if !reflect.DeepEqual(&msg, block) {
+			t.Errorf("%s: mismatched block\ngot: %s want: %s",
+				test.name, spew.Sdump(&msg), spew.Sdump(block))
+			continue
+		}
+		if test.arena == nil {
+			continue
+		}
+
+		// Ensure decoding again after resetting the arena reuses the
+		// existing storage.
+		test.arena.Reset()
+		scriptsCap := cap(test.arena.scripts)
+		txInsCap := cap(test.arena.txIns)
+		var msg2 MsgBlock
+		err = msg2.DecodeInto(bytes.NewReader(blockBytes),
+			ProtocolVersion, WitnessEncoding, test.arena)
+		if err != nil {
+			t.Errorf("%s: DecodeInto: unexpected error: %v", test.name,
+				err)
+			continue
+		}
+		if !reflect.DeepEqual(&msg2, block) {
+			t.Errorf("%s: mismatched block after reset\ngot: %s "+
+				"want: %s", test.name, spew.Sdump(&msg2),
+				spew.Sdump(block))
+			continue
+		}
+		if cap(test.arena.scripts) != scriptsCap ||
+			cap(test.arena.txIns) != txInsCap {
+
+			t.Errorf("%s: arena storage was not reused after reset",
+				test.name)
+			continue
+		}
+	}
+
+	// Ensure a single transaction decoded via an arena is identical to the
+	// original.
+	var witnessTxBuf bytes.Buffer
+	if err := multiWitnessTx.Serialize(&witnessTxBuf); err != nil {
+		t.Fatalf("Serialize: unexpected error: %v", err)
+	}
+	var tx MsgTx
+	err := tx.DecodeInto(&witnessTxBuf, ProtocolVersion, WitnessEncoding,
+		&DecodeArena{})
+	if err != nil {
+		t.Fatalf("DecodeInto: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(&tx, multiWitnessTx) {
+		t.Fatalf("mismatched transaction\ngot: %s want: %s",
+			spew.Sdump(&tx), spew.Sdump(multiWitnessTx))
+	}
+
+	// Ensure truncated blocks are rejected.
+	var msg MsgBlock
+	truncated := blockBytes[:len(blockBytes)-1]
+	err = msg.DecodeInto(bytes.NewReader(truncated), ProtocolVersion,
+		WitnessEncoding, &DecodeArena{})
+	if err != io.ErrUnexpectedEOF && err != io.EOF {
+		t.Fatalf("DecodeInto: unexpected error for truncated block -- "+
+			"got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
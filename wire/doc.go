@@ -158,5 +158,9 @@ This package includes spec changes outlined by the following BIPs:
 	BIP0111	(https://github.com/bitcoin/bips/blob/master/bip-0111.mediawiki)
 	BIP0130 (https://github.com/bitcoin/bips/blob/master/bip-0130.mediawiki)
 	BIP0133 (https://github.com/bitcoin/bips/blob/master/bip-0133.mediawiki)
+	BIP0155 (https://github.com/bitcoin/bips/blob/master/bip-0155.mediawiki)
+	BIP0159 (https://github.com/bitcoin/bips/blob/master/bip-0159.mediawiki)
+	BIP0331 (https://github.com/bitcoin/bips/blob/master/bip-0331.mediawiki)
+	BIP0339 (https://github.com/bitcoin/bips/blob/master/bip-0339.mediawiki)
 */
 package wire
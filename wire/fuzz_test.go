@@ -0,0 +1,278 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package wire
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// fuzzMessage runs a fuzz target which strictly decodes arbitrary payloads as
+// messages of the type associated with the provided command.  The encoding of
+// the empty message as well as the provided messages are used to seed the
+// corpus.
+//
+// Payloads that are accepted and able to be encoded again must encode to a
+// stable canonical form, meaning decoding the encoded message and then
+// encoding it once more must result in the same bytes.  Some messages, such as
+// alerts without a payload, may be decoded but intentionally refuse to encode.
+func fuzzMessage(f *testing.F, command string, seeds ...Message) {
+	emptyMsg, err := makeEmptyMessage(command)
+	if err != nil {
+		f.Fatalf("makeEmptyMessage(%q): unexpected error: %v", command,
+			err)
+	}
+	for _, msg := range append([]Message{emptyMsg}, seeds...) {
+		var buf bytes.Buffer
+		err := msg.HdfEncode(&buf, ProtocolVersion, WitnessEncoding)
+		if err != nil {
+			continue
+		}
+		f.Add(buf.Bytes())
+	}
+
+	encodings := []MessageEncoding{BaseEncoding, WitnessEncoding}
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		for _, enc := range encodings {
+			msg, _ := makeEmptyMessage(command)
+			err := StrictDecode(msg, payload, ProtocolVersion, enc)
+			if err != nil {
+				continue
+			}
+
+			var buf bytes.Buffer
+			err = msg.HdfEncode(&buf, ProtocolVersion, enc)
+			if err != nil {
+				continue
+			}
+			encoded := buf.Bytes()
+
+			msg2, _ := makeEmptyMessage(command)
+			err = StrictDecode(msg2, encoded, ProtocolVersion, enc)
+			if err != nil {
+				t.Fatalf("StrictDecode: unable to decode "+
+					"encoded message: %v", err)
+			}
+			var buf2 bytes.Buffer
+			err = msg2.HdfEncode(&buf2, ProtocolVersion, enc)
+			if err != nil {
+				t.Fatalf("HdfEncode: unable to encode decoded "+
+					"message: %v", err)
+			}
+			if !bytes.Equal(buf2.Bytes(), encoded) {
+				t.Fatalf("unstable encoding\ngot: %x\nwant: %x",
+					buf2.Bytes(), encoded)
+			}
+		}
+	})
+}
+
+// The following fuzz targets strictly decode arbitrary payloads as each of the
+// supported message types.  Run them with go test -fuzz, for example:
+//
+//   go test -run=^$ -fuzz=^FuzzMsgTx$
+
+func FuzzMsgVersion(f *testing.F) {
+	fuzzMessage(f, CmdVersion, baseVersion)
+}
+
+func FuzzMsgVerAck(f *testing.F) {
+	fuzzMessage(f, CmdVerAck)
+}
+
+func FuzzMsgGetAddr(f *testing.F) {
+	fuzzMessage(f, CmdGetAddr)
+}
+
+func FuzzMsgAddr(f *testing.F) {
+	fuzzMessage(f, CmdAddr)
+}
+
+func FuzzMsgGetBlocks(f *testing.F) {
+	fuzzMessage(f, CmdGetBlocks)
+}
+
+func FuzzMsgInv(f *testing.F) {
+	fuzzMessage(f, CmdInv)
+}
+
+func FuzzMsgGetData(f *testing.F) {
+	fuzzMessage(f, CmdGetData)
+}
+
+func FuzzMsgNotFound(f *testing.F) {
+	fuzzMessage(f, CmdNotFound)
+}
+
+func FuzzMsgBlock(f *testing.F) {
+	fuzzMessage(f, CmdBlock, &blockOne)
+}
+
+func FuzzMsgTx(f *testing.F) {
+	fuzzMessage(f, CmdTx, multiTx, multiWitnessTx)
+}
+
+func FuzzMsgGetHeaders(f *testing.F) {
+	fuzzMessage(f, CmdGetHeaders)
+}
+
+func FuzzMsgHeaders(f *testing.F) {
+	fuzzMessage(f, CmdHeaders)
+}
+
+func FuzzMsgPing(f *testing.F) {
+	fuzzMessage(f, CmdPing)
+}
+
+func FuzzMsgPong(f *testing.F) {
+	fuzzMessage(f, CmdPong)
+}
+
+func FuzzMsgAlert(f *testing.F) {
+	alert := NewMsgAlert([]byte{0x01}, []byte{0x02})
+	fuzzMessage(f, CmdAlert, alert)
+}
+
+func FuzzMsgMemPool(f *testing.F) {
+	fuzzMessage(f, CmdMemPool)
+}
+
+func FuzzMsgFilterAdd(f *testing.F) {
+	fuzzMessage(f, CmdFilterAdd)
+}
+
+func FuzzMsgFilterClear(f *testing.F) {
+	fuzzMessage(f, CmdFilterClear)
+}
+
+func FuzzMsgFilterLoad(f *testing.F) {
+	fuzzMessage(f, CmdFilterLoad)
+}
+
+func FuzzMsgMerkleBlock(f *testing.F) {
+	fuzzMessage(f, CmdMerkleBlock, &merkleBlockOne)
+}
+
+func FuzzMsgReject(f *testing.F) {
+	fuzzMessage(f, CmdReject)
+}
+
+func FuzzMsgSendHeaders(f *testing.F) {
+	fuzzMessage(f, CmdSendHeaders)
+}
+
+func FuzzMsgFeeFilter(f *testing.F) {
+	fuzzMessage(f, CmdFeeFilter)
+}
+
+func FuzzMsgGetCFilters(f *testing.F) {
+	fuzzMessage(f, CmdGetCFilters)
+}
+
+func FuzzMsgGetCFHeaders(f *testing.F) {
+	fuzzMessage(f, CmdGetCFHeaders)
+}
+
+func FuzzMsgGetCFCheckpt(f *testing.F) {
+	fuzzMessage(f, CmdGetCFCheckpt)
+}
+
+func FuzzMsgCFilter(f *testing.F) {
+	fuzzMessage(f, CmdCFilter)
+}
+
+func FuzzMsgCFHeaders(f *testing.F) {
+	fuzzMessage(f, CmdCFHeaders)
+}
+
+func FuzzMsgCFCheckpt(f *testing.F) {
+	fuzzMessage(f, CmdCFCheckpt)
+}
+
+func FuzzMsgSendCmpct(f *testing.F) {
+	fuzzMessage(f, CmdSendCmpct)
+}
+
+func FuzzMsgCmpctBlock(f *testing.F) {
+	fuzzMessage(f, CmdCmpctBlock)
+}
+
+func FuzzMsgGetBlockTxn(f *testing.F) {
+	fuzzMessage(f, CmdGetBlockTxn)
+}
+
+func FuzzMsgBlockTxn(f *testing.F) {
+	fuzzMessage(f, CmdBlockTxn)
+}
+
+func FuzzMsgSendAddrV2(f *testing.F) {
+	fuzzMessage(f, CmdSendAddrV2)
+}
+
+func FuzzMsgAddrV2(f *testing.F) {
+	fuzzMessage(f, CmdAddrV2)
+}
+
+func FuzzMsgWTxIdRelay(f *testing.F) {
+	fuzzMessage(f, CmdWTxIdRelay)
+}
+
+func FuzzMsgSendPackages(f *testing.F) {
+	fuzzMessage(f, CmdSendPackages, NewMsgSendPackages(PkgRelayAncestor))
+}
+
+func FuzzMsgAncPkgInfo(f *testing.F) {
+	fuzzMessage(f, CmdAncPkgInfo)
+}
+
+func FuzzMsgGetPkgTxns(f *testing.F) {
+	fuzzMessage(f, CmdGetPkgTxns)
+}
+
+func FuzzMsgPkgTxns(f *testing.F) {
+	fuzzMessage(f, CmdPkgTxns, &MsgPkgTxns{
+		Transactions: []*MsgTx{multiTx, multiWitnessTx},
+	})
+}
+
+func FuzzMsgBulletin(f *testing.F) {
+	fuzzMessage(f, CmdBulletin, &MsgBulletin{
+		ID:         1,
+		Timestamp:  time.Unix(1600000000, 0),
+		Expiration: time.Unix(1600086400, 0),
+		Message:    "bulletin",
+		Signature:  []byte{0x30, 0x06, 0x02, 0x01, 0x01, 0x02, 0x01, 0x01},
+	})
+}
+
+// FuzzReadMessage fuzzes the framing layer by reading arbitrary data as a
+// message in the legacy format with strict decoding enabled.
+func FuzzReadMessage(f *testing.F) {
+	for _, msg := range []Message{NewMsgVerAck(), NewMsgPing(1), multiTx} {
+		var buf bytes.Buffer
+		_, err := WriteMessageWithEncodingN(&buf, msg, ProtocolVersion,
+			MainNet, WitnessEncoding)
+		if err != nil {
+			f.Fatalf("WriteMessageWithEncodingN: unexpected error: %v",
+				err)
+		}
+		f.Add(buf.Bytes())
+	}
+
+	transport := &LegacyTransport{Net: MainNet, StrictDecode: true}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := bytes.NewReader(data)
+		n, _, _, err := transport.ReadMessage(r, ProtocolVersion,
+			WitnessEncoding)
+		if err == nil && n > len(data) {
+			t.Fatalf("read %d bytes from %d bytes of data", n,
+				len(data))
+		}
+	})
+}
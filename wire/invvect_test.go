@@ -22,6 +22,8 @@ func TestInvTypeStringer(t *testing.T) {
 		{InvTypeError, "ERROR"},
 		{InvTypeTx, "MSG_TX"},
 		{InvTypeBlock, "MSG_BLOCK"},
+		{InvTypeWTx, "MSG_WTX"},
+		{InvTypeAncPkgInfo, "MSG_ANCPKGINFO"},
 		{0xffffffff, "Unknown InvType (4294967295)"},
 	}
 
@@ -57,6 +57,20 @@ const (
 	CmdCFilter      = "cfilter"
 	CmdCFHeaders    = "cfheaders"
 	CmdCFCheckpt    = "cfcheckpt"
+	CmdSendCmpct    = "sendcmpct"
+	CmdCmpctBlock   = "cmpctblock"
+	CmdGetBlockTxn  = "getblocktxn"
+	CmdBlockTxn     = "blocktxn"
+	CmdSendAddrV2   = "sendaddrv2"
+	CmdAddrV2       = "addrv2"
+	CmdWTxIdRelay   = "wtxidrelay"
+	CmdSendPackages = "sendpackages"
+	CmdAncPkgInfo   = "ancpkginfo"
+	CmdGetPkgTxns   = "getpkgtxns"
+	CmdPkgTxns      = "pkgtxns"
+	CmdBulletin     = "bulletin"
+	CmdSendCompr    = "sendcompr"
+	CmdCompressed   = "compressed"
 )
 
 // MessageEncoding represents the wire message encoding format to be used.
@@ -180,6 +194,48 @@ func makeEmptyMessage(command string) (Message, error) {
 	case CmdCFCheckpt:
 		msg = &MsgCFCheckpt{}
 
+	case CmdSendCmpct:
+		msg = &MsgSendCmpct{}
+
+	case CmdCmpctBlock:
+		msg = &MsgCmpctBlock{}
+
+	case CmdGetBlockTxn:
+		msg = &MsgGetBlockTxn{}
+
+	case CmdBlockTxn:
+		msg = &MsgBlockTxn{}
+
+	case CmdSendAddrV2:
+		msg = &MsgSendAddrV2{}
+
+	case CmdAddrV2:
+		msg = &MsgAddrV2{}
+
+	case CmdWTxIdRelay:
+		msg = &MsgWTxIdRelay{}
+
+	case CmdSendPackages:
+		msg = &MsgSendPackages{}
+
+	case CmdAncPkgInfo:
+		msg = &MsgAncPkgInfo{}
+
+	case CmdGetPkgTxns:
+		msg = &MsgGetPkgTxns{}
+
+	case CmdPkgTxns:
+		msg = &MsgPkgTxns{}
+
+	case CmdBulletin:
+		msg = &MsgBulletin{}
+
+	case CmdSendCompr:
+		msg = &MsgSendCompr{}
+
+	case CmdCompressed:
+		msg = &MsgCompressed{}
+
 	default:
 		return nil, fmt.Errorf("unhandled command [%s]", command)
 	}
@@ -263,6 +319,30 @@ func WriteMessage(w io.Writer, msg Message, pver uint32, hdfnet BitcoinNet) erro
 func WriteMessageWithEncodingN(w io.Writer, msg Message, pver uint32,
 	hdfnet BitcoinNet, encoding MessageEncoding) (int, error) {
 
+	return writeMessageN(w, msg, pver, hdfnet, encoding, false)
+}
+
+// WriteMessageNoChecksumN writes a bitcoin Message to w in the same manner as
+// WriteMessageWithEncodingN except the payload checksum is not calculated and
+// an all zero checksum is written to the header instead.
+//
+// This must only be used for trusted local connections, such as those over a
+// loopback interface or unix socket, where the transport already guarantees
+// integrity and the remote end has been configured to read messages via
+// ReadMessageNoChecksumN.  Otherwise, the remote peer will reject the message
+// due to the checksum mismatch.
+func WriteMessageNoChecksumN(w io.Writer, msg Message, pver uint32,
+	hdfnet BitcoinNet, encoding MessageEncoding) (int, error) {
+
+	return writeMessageN(w, msg, pver, hdfnet, encoding, true)
+}
+
+// writeMessageN writes a bitcoin Message to w including the necessary header
+// information and returns the number of bytes written.  The payload checksum
+// is only calculated when skipChecksum is false.
+func writeMessageN(w io.Writer, msg Message, pver uint32, hdfnet BitcoinNet,
+	encoding MessageEncoding, skipChecksum bool) (int, error) {
+
 	totalBytes := 0
 
 	// Enforce max command size.
@@ -306,7 +386,9 @@ func WriteMessageWithEncodingN(w io.Writer, msg Message, pver uint32,
 	hdr.magic = hdfnet
 	hdr.command = cmd
 	hdr.length = uint32(lenp)
-	copy(hdr.checksum[:], chainhash.DoubleHashB(payload)[0:4])
+	if !skipChecksum {
+		copy(hdr.checksum[:], chainhash.DoubleHashB(payload)[0:4])
+	}
 
 	// Encode the header for the message.  This is done to a buffer
 	// rather than directly to the writer since writeElements doesn't
@@ -340,6 +422,29 @@ func WriteMessageWithEncodingN(w io.Writer, msg Message, pver uint32,
 func ReadMessageWithEncodingN(r io.Reader, pver uint32, hdfnet BitcoinNet,
 	enc MessageEncoding) (int, Message, []byte, error) {
 
+	return readMessageN(r, pver, hdfnet, enc, false, false)
+}
+
+// ReadMessageNoChecksumN reads, validates, and parses the next bitcoin Message
+// from r in the same manner as ReadMessageWithEncodingN except the payload
+// checksum in the message header is not verified.  This saves a double SHA256
+// of every payload.
+//
+// This must only be used for trusted local connections, such as those over a
+// loopback interface or unix socket, where the transport already guarantees
+// integrity.
+func ReadMessageNoChecksumN(r io.Reader, pver uint32, hdfnet BitcoinNet,
+	enc MessageEncoding) (int, Message, []byte, error) {
+
+	return readMessageN(r, pver, hdfnet, enc, true, false)
+}
+
+// readMessageN reads, validates, and parses the next bitcoin Message from r.
+// The payload checksum is only verified when skipChecksum is false and
+// payloads with trailing bytes are only rejected when strict is true.
+func readMessageN(r io.Reader, pver uint32, hdfnet BitcoinNet,
+	enc MessageEncoding, skipChecksum, strict bool) (int, Message, []byte, error) {
+
 	totalBytes := 0
 	n, hdr, err := readMessageHeader(r)
 	totalBytes += n
@@ -400,18 +505,19 @@ func ReadMessageWithEncodingN(r io.Reader, pver uint32, hdfnet BitcoinNet,
 	}
 
 	// Test checksum.
-	checksum := chainhash.DoubleHashB(payload)[0:4]
-	if !bytes.Equal(checksum[:], hdr.checksum[:]) {
-		str := fmt.Sprintf("payload checksum failed - header "+
-			"indicates %v, but actual checksum is %v.",
-			hdr.checksum, checksum)
-		return totalBytes, nil, nil, messageError("ReadMessage", str)
+	if !skipChecksum {
+		checksum := chainhash.DoubleHashB(payload)[0:4]
+		if !bytes.Equal(checksum[:], hdr.checksum[:]) {
+			str := fmt.Sprintf("payload checksum failed - header "+
+				"indicates %v, but actual checksum is %v.",
+				hdr.checksum, checksum)
+			return totalBytes, nil, nil, messageError("ReadMessage",
+				str)
+		}
 	}
 
-	// Unmarshal message.  NOTE: This must be a *bytes.Buffer since the
-	// MsgVersion HdfDecode function requires it.
-	pr := bytes.NewBuffer(payload)
-	err = msg.HdfDecode(pr, pver, enc)
+	// Unmarshal message.
+	err = decodePayload(msg, payload, pver, enc, strict)
 	if err != nil {
 		return totalBytes, nil, nil, err
 	}
@@ -419,6 +525,44 @@ func ReadMessageWithEncodingN(r io.Reader, pver uint32, hdfnet BitcoinNet,
 	return totalBytes, msg, payload, nil
 }
 
+// decodePayload decodes the provided message payload into msg.  An error is
+// returned when strict is true and the payload contains any bytes beyond the
+// end of the message.
+func decodePayload(msg Message, payload []byte, pver uint32,
+	enc MessageEncoding, strict bool) error {
+
+	// NOTE: This must be a *bytes.Buffer since the MsgVersion HdfDecode
+	// function requires it.
+	pr := bytes.NewBuffer(payload)
+	err := msg.HdfDecode(pr, pver, enc)
+	if err != nil {
+		return err
+	}
+
+	if strict && pr.Len() > 0 {
+		str := fmt.Sprintf("payload of [%s] message has %d trailing "+
+			"bytes", msg.Command(), pr.Len())
+		return messageError("StrictDecode", str)
+	}
+
+	return nil
+}
+
+// StrictDecode decodes the provided message payload into msg in the same
+// manner as HdfDecode except it also rejects payloads that contain any bytes
+// beyond the end of the message.  Together with the rejection of non-canonical
+// variable length integers, which applies to all decoding, this ensures every
+// message that is accepted has exactly one valid encoding.
+//
+// NOTE: Peers running newer software may append fields this package does not
+// know about to some messages, most notably the version message, so strict
+// decoding should only be used when that is not a concern.
+func StrictDecode(msg Message, payload []byte, pver uint32,
+	enc MessageEncoding) error {
+
+	return decodePayload(msg, payload, pver, enc, true)
+}
+
 // ReadMessageN reads, validates, and parses the next bitcoin Message from r for
 // the provided protocol version and bitcoin network.  It returns the number of
 // bytes read in addition to the parsed Message and raw bytes which comprise the
@@ -76,6 +76,23 @@ func TestMessage(t *testing.T) {
 		[]byte("payload"))
 	msgCFHeaders := NewMsgCFHeaders()
 	msgCFCheckpt := NewMsgCFCheckpt(GCSFilterRegular, &chainhash.Hash{}, 0)
+	msgSendCmpct := NewMsgSendCmpct(true, CmpctBlockVersionWTxID)
+	msgCmpctBlock := NewMsgCmpctBlock(bh, 123123)
+	msgGetBlockTxn := NewMsgGetBlockTxn(&chainhash.Hash{})
+	msgBlockTxn := NewMsgBlockTxn(&chainhash.Hash{})
+	msgSendAddrV2 := NewMsgSendAddrV2()
+	msgAddrV2 := NewMsgAddrV2()
+	msgWTxIdRelay := NewMsgWTxIdRelay()
+	msgSendPackages := NewMsgSendPackages(PkgRelayAncestor)
+	msgAncPkgInfo := NewMsgAncPkgInfo()
+	msgGetPkgTxns := NewMsgGetPkgTxns()
+	msgPkgTxns := NewMsgPkgTxns()
+	msgSendCompr := NewMsgSendCompr(CompressionDeflate)
+	msgCompressed, err := NewMsgCompressed(msgCFilter, CompressionDeflate,
+		pver, BaseEncoding)
+	if err != nil {
+		t.Fatalf("NewMsgCompressed: %v", err)
+	}
 
 	tests := []struct {
 		in     Message    // Value to encode
@@ -111,6 +128,20 @@ func TestMessage(t *testing.T) {
 		{msgCFilter, msgCFilter, pver, MainNet, 65},
 		{msgCFHeaders, msgCFHeaders, pver, MainNet, 90},
 		{msgCFCheckpt, msgCFCheckpt, pver, MainNet, 58},
+		{msgSendCmpct, msgSendCmpct, pver, MainNet, 33},
+		{msgCmpctBlock, msgCmpctBlock, pver, MainNet, 114},
+		{msgGetBlockTxn, msgGetBlockTxn, pver, MainNet, 57},
+		{msgBlockTxn, msgBlockTxn, pver, MainNet, 57},
+		{msgSendAddrV2, msgSendAddrV2, pver, MainNet, 24},
+		{msgAddrV2, msgAddrV2, pver, MainNet, 25},
+		{msgWTxIdRelay, msgWTxIdRelay, pver, MainNet, 24},
+		{msgSendPackages, msgSendPackages, pver, MainNet, 32},
+		{msgAncPkgInfo, msgAncPkgInfo, pver, MainNet, 25},
+		{msgGetPkgTxns, msgGetPkgTxns, pver, MainNet, 25},
+		{msgPkgTxns, msgPkgTxns, pver, MainNet, 25},
+		{msgSendCompr, msgSendCompr, pver, MainNet, 32},
+		{msgCompressed, msgCompressed, pver, MainNet, 24 + 1 + 1 +
+			len(CmdCFilter) + 1 + len(msgCompressed.Payload)},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -178,6 +209,124 @@ func TestMessage(t *testing.T) {
 	}
 }
 
+// TestMessageNoChecksum tests the Read/WriteMessageNoChecksumN API used for
+// trusted local connections.
+func TestMessageNoChecksum(t *testing.T) {
+	pver := ProtocolVersion
+	hdfnet := MainNet
+	msg := NewMsgPing(123123)
+
+	// Ensure the header is written with an all zero checksum.
+	var buf bytes.Buffer
+	nw, err := WriteMessageNoChecksumN(&buf, msg, pver, hdfnet, BaseEncoding)
+	if err != nil {
+		t.Fatalf("WriteMessageNoChecksumN: unexpected error %v", err)
+	}
+	if nw != 32 {
+		t.Fatalf("WriteMessageNoChecksumN: unexpected num bytes "+
+			"written - got %d, want %d", nw, 32)
+	}
+	var zeroChecksum [4]byte
+	if !bytes.Equal(buf.Bytes()[20:24], zeroChecksum[:]) {
+		t.Fatalf("WriteMessageNoChecksumN: checksum not zero - got %x",
+			buf.Bytes()[20:24])
+	}
+
+	// Ensure the message is rejected by the normal read path due to the
+	// checksum mismatch.
+	_, _, _, err = ReadMessageWithEncodingN(bytes.NewReader(buf.Bytes()),
+		pver, hdfnet, BaseEncoding)
+	if _, ok := err.(*MessageError); !ok {
+		t.Fatalf("ReadMessageWithEncodingN: expected checksum error, "+
+			"got %v", err)
+	}
+
+	// Ensure the message is accepted when checksums are skipped.
+	nr, readMsg, _, err := ReadMessageNoChecksumN(
+		bytes.NewReader(buf.Bytes()), pver, hdfnet, BaseEncoding)
+	if err != nil {
+		t.Fatalf("ReadMessageNoChecksumN: unexpected error %v", err)
+	}
+	if nr != nw {
+		t.Fatalf("ReadMessageNoChecksumN: unexpected num bytes read - "+
+			"got %d, want %d", nr, nw)
+	}
+	if !reflect.DeepEqual(readMsg, msg) {
+		t.Fatalf("ReadMessageNoChecksumN:\n got: %v want: %v",
+			spew.Sdump(readMsg), spew.Sdump(msg))
+	}
+
+	// Ensure a message with a bad checksum is also accepted when
+	// checksums are skipped.
+	badChecksumBytes := makeHeader(hdfnet, "ping", 8, 0xbeef)
+	badChecksumBytes = append(badChecksumBytes, buf.Bytes()[24:]...)
+	_, readMsg, _, err = ReadMessageNoChecksumN(
+		bytes.NewReader(badChecksumBytes), pver, hdfnet, BaseEncoding)
+	if err != nil {
+		t.Fatalf("ReadMessageNoChecksumN: unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(readMsg, msg) {
+		t.Fatalf("ReadMessageNoChecksumN:\n got: %v want: %v",
+			spew.Sdump(readMsg), spew.Sdump(msg))
+	}
+}
+
+// TestStrictDecode ensures payloads with trailing bytes are only rejected when
+// strict decoding is requested.
+func TestStrictDecode(t *testing.T) {
+	pver := ProtocolVersion
+	hdfnet := MainNet
+	msg := NewMsgInv()
+	msg.AddInvVect(NewInvVect(InvTypeTx, &chainhash.Hash{}))
+
+	var buf bytes.Buffer
+	if err := msg.HdfEncode(&buf, pver, BaseEncoding); err != nil {
+		t.Fatalf("HdfEncode: unexpected error %v", err)
+	}
+	payload := buf.Bytes()
+	trailingPayload := append(append([]byte{}, payload...), 0x00)
+
+	// Ensure payloads without trailing bytes are accepted.
+	var readMsg MsgInv
+	err := StrictDecode(&readMsg, payload, pver, BaseEncoding)
+	if err != nil {
+		t.Fatalf("StrictDecode: unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(&readMsg, msg) {
+		t.Fatalf("StrictDecode:\n got: %v want: %v",
+			spew.Sdump(&readMsg), spew.Sdump(msg))
+	}
+
+	// Ensure payloads with trailing bytes are rejected.
+	err = StrictDecode(&readMsg, trailingPayload, pver, BaseEncoding)
+	if _, ok := err.(*MessageError); !ok {
+		t.Fatalf("StrictDecode: expected trailing bytes error, got %v",
+			err)
+	}
+
+	// Ensure the trailing bytes are only rejected by the legacy transport
+	// when strict decoding is enabled.
+	checksum := chainhash.DoubleHashB(trailingPayload)[0:4]
+	msgBytes := makeHeader(hdfnet, CmdInv, uint32(len(trailingPayload)),
+		binary.LittleEndian.Uint32(checksum))
+	msgBytes = append(msgBytes, trailingPayload...)
+	tests := []struct {
+		transport *LegacyTransport
+		wantErr   bool
+	}{
+		{&LegacyTransport{Net: hdfnet}, false},
+		{&LegacyTransport{Net: hdfnet, StrictDecode: true}, true},
+	}
+	for i, test := range tests {
+		_, _, _, err := test.transport.ReadMessage(
+			bytes.NewReader(msgBytes), pver, BaseEncoding)
+		if _, ok := err.(*MessageError); ok != test.wantErr {
+			t.Errorf("ReadMessage #%d: unexpected error - got %v, "+
+				"want error %v", i, err, test.wantErr)
+		}
+	}
+}
+
 // TestReadMessageWireErrors performs negative tests against wire decoding into
 // concrete messages to confirm error paths work correctly.
 func TestReadMessageWireErrors(t *testing.T) {
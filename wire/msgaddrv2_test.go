@@ -0,0 +1,352 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// torV3PubKey is the public key of the Tor v3 hidden service
+// duckduckgogg42xjoc72x3sjasowoarfbgcmvfimaftt6twagswzczad.onion.
+var torV3PubKey = []byte{
+	0x1d, 0x04, 0xa1, 0xd0, 0x4a, 0x33, 0x8c, 0x6e,
+	0x6a, 0xe9, 0x70, 0xbf, 0xab, 0xee, 0x49, 0x04,
+	0x9d, 0x67, 0x02, 0x25, 0x09, 0x84, 0xca, 0x95,
+	0x0c, 0x01, 0x67, 0x3f, 0x4e, 0xc0, 0x34, 0xad,
+}
+
+// TestAddrV2 tests the MsgAddrV2 API.
+func TestAddrV2(t *testing.T) {
+	pver := ProtocolVersion
+
+	// Ensure the command is expected value.
+	wantCmd := "addrv2"
+	msg := NewMsgAddrV2()
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgAddrV2: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value for latest protocol version.
+	// Num addresses (varInt) + max allowed addresses.
+	wantPayload := uint32(537009)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+
+	// Ensure NetAddressV2s are added properly.
+	na := NewNetAddressV2(time.Now(), SFNodeNetwork, NetIDTorV3,
+		torV3PubKey, 8333)
+	err := msg.AddAddress(na)
+	if err != nil {
+		t.Errorf("AddAddress: %v", err)
+	}
+	if msg.AddrList[0] != na {
+		t.Errorf("AddAddress: wrong address added - got %v, want %v",
+			spew.Sprint(msg.AddrList[0]), spew.Sprint(na))
+	}
+
+	// Ensure the address list is cleared properly.
+	msg.ClearAddresses()
+	if len(msg.AddrList) != 0 {
+		t.Errorf("ClearAddresses: address list is not empty - "+
+			"got %v [%v], want %v", len(msg.AddrList),
+			spew.Sprint(msg.AddrList[0]), 0)
+	}
+
+	// Ensure adding more than the max allowed addresses per message returns
+	// error.
+	for i := 0; i < MaxAddrPerMsg+1; i++ {
+		err = msg.AddAddress(na)
+	}
+	if err == nil {
+		t.Errorf("AddAddress: expected error on too many addresses " +
+			"not received")
+	}
+	err = msg.AddAddresses(na)
+	if err == nil {
+		t.Errorf("AddAddresses: expected error on too many addresses " +
+			"not received")
+	}
+}
+
+// TestAddrV2Wire tests the MsgAddrV2 wire encode and decode for various
+// address networks.
+func TestAddrV2Wire(t *testing.T) {
+	// A few NetAddressV2s of different networks to use for testing.
+	ipv4 := &NetAddressV2{
+		Timestamp: time.Unix(0x495fab29, 0), // 2009-01-03 12:15:05 -0600 CST
+		Services:  SFNodeNetwork,
+		NetworkID: NetIDIPv4,
+		Addr:      []byte{0x7f, 0x00, 0x00, 0x01},
+		Port:      8333,
+	}
+	torV3 := &NetAddressV2{
+		Timestamp: time.Unix(0x495fab29, 0), // 2009-01-03 12:15:05 -0600 CST
+		Services:  SFNodeNetwork | SFNodeWitness,
+		NetworkID: NetIDTorV3,
+		Addr:      torV3PubKey,
+		Port:      8334,
+	}
+	unknown := &NetAddressV2{
+		Timestamp: time.Unix(0x495fab29, 0), // 2009-01-03 12:15:05 -0600 CST
+		Services:  0,
+		NetworkID: NetworkID(0xaa),
+		Addr:      []byte{0x01, 0x02, 0x03},
+		Port:      0,
+	}
+
+	// Empty address message.
+	noAddr := NewMsgAddrV2()
+	noAddrEncoded := []byte{
+		0x00, // Varint for number of addresses
+	}
+
+	// Address message with multiple addresses.
+	multiAddr := NewMsgAddrV2()
+	multiAddr.AddAddresses(ipv4, torV3, unknown)
+	multiAddrEncoded := []byte{
+		0x03,                   // Varint for number of addresses
+		0x29, 0xab, 0x5f, 0x49, // Timestamp
+		0x01,                   // SFNodeNetwork (varInt)
+		0x01,                   // Network ID IPv4
+		0x04,                   // Varint for address length
+		0x7f, 0x00, 0x00, 0x01, // IP 127.0.0.1
+		0x20, 0x8d, // Port 8333 in big-endian
+		0x29, 0xab, 0x5f, 0x49, // Timestamp
+		0x09, // SFNodeNetwork | SFNodeWitness (varInt)
+		0x04, // Network ID TorV3
+		0x20, // Varint for address length
+		0x1d, 0x04, 0xa1, 0xd0, 0x4a, 0x33, 0x8c, 0x6e,
+		0x6a, 0xe9, 0x70, 0xbf, 0xab, 0xee, 0x49, 0x04,
+		0x9d, 0x67, 0x02, 0x25, 0x09, 0x84, 0xca, 0x95,
+		0x0c, 0x01, 0x67, 0x3f, 0x4e, 0xc0, 0x34, 0xad, // Public key
+		0x20, 0x8e, // Port 8334 in big-endian
+		0x29, 0xab, 0x5f, 0x49, // Timestamp
+		0x00,             // No services (varInt)
+		0xaa,             // Unknown network ID
+		0x03,             // Varint for address length
+		0x01, 0x02, 0x03, // Address
+		0x00, 0x00, // Port 0 in big-endian
+	}
+
+	tests := []struct {
+		in   *MsgAddrV2      // Message to encode
+		out  *MsgAddrV2      // Expected decoded message
+		buf  []byte          // Wire encoding
+		pver uint32          // Protocol version for wire encoding
+		enc  MessageEncoding // Message encoding format
+	}{
+		// Latest protocol version with no addresses.
+		{
+			noAddr,
+			noAddr,
+			noAddrEncoded,
+			ProtocolVersion,
+			BaseEncoding,
+		},
+
+		// Latest protocol version with multiple addresses.
+		{
+			multiAddr,
+			multiAddr,
+			multiAddrEncoded,
+			ProtocolVersion,
+			BaseEncoding,
+		},
+
+		// Protocol version AddrV2Version with multiple addresses.
+		{
+			multiAddr,
+			multiAddr,
+			multiAddrEncoded,
+			AddrV2Version,
+			BaseEncoding,
+		},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode the message to wire format.
+		var buf bytes.Buffer
+		err := test.in.HdfEncode(&buf, test.pver, test.enc)
+		if err != nil {
+			t.Errorf("HdfEncode #%d error %v", i, err)
+			continue
+		}
+		if !bytes.Equal(buf.Bytes(), test.buf) {
+			t.Errorf("HdfEncode #%d\n got: %s want: %s", i,
+				spew.Sdump(buf.Bytes()), spew.Sdump(test.buf))
+			continue
+		}
+
+		// Decode the message from wire format.
+		var msg MsgAddrV2
+		rbuf := bytes.NewReader(test.buf)
+		err = msg.HdfDecode(rbuf, test.pver, test.enc)
+		if err != nil {
+			t.Errorf("HdfDecode #%d error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(&msg, test.out) {
+			t.Errorf("HdfDecode #%d\n got: %s want: %s", i,
+				spew.Sdump(msg), spew.Sdump(test.out))
+			continue
+		}
+	}
+}
+
+// TestAddrV2WireErrors performs negative tests against wire encode and decode
+// of MsgAddrV2 to confirm error paths work correctly.
+func TestAddrV2WireErrors(t *testing.T) {
+	pver := ProtocolVersion
+	pverAddrV2 := AddrV2Version - 1
+	wireErr := &MessageError{}
+
+	na := &NetAddressV2{
+		Timestamp: time.Unix(0x495fab29, 0), // 2009-01-03 12:15:05 -0600 CST
+		Services:  SFNodeNetwork,
+		NetworkID: NetIDIPv4,
+		Addr:      []byte{0x7f, 0x00, 0x00, 0x01},
+		Port:      8333,
+	}
+
+	// Address message with a single address.
+	baseAddr := NewMsgAddrV2()
+	baseAddr.AddAddress(na)
+	baseAddrEncoded := []byte{
+		0x01,                   // Varint for number of addresses
+		0x29, 0xab, 0x5f, 0x49, // Timestamp
+		0x01,                   // SFNodeNetwork (varInt)
+		0x01,                   // Network ID IPv4
+		0x04,                   // Varint for address length
+		0x7f, 0x00, 0x00, 0x01, // IP 127.0.0.1
+		0x20, 0x8d, // Port 8333 in big-endian
+	}
+
+	// Message that forces an error by having more than the max allowed
+	// addresses.
+	maxAddr := NewMsgAddrV2()
+	for i := 0; i < MaxAddrPerMsg; i++ {
+		maxAddr.AddAddress(na)
+	}
+	maxAddr.AddrList = append(maxAddr.AddrList, na)
+	maxAddrEncoded := []byte{
+		0xfd, 0xe9, 0x03, // Varint for number of addresses (1001)
+	}
+
+	// Message that forces an error by having an IPv4 address with an
+	// invalid length.
+	badLenAddr := NewMsgAddrV2()
+	badLenAddr.AddAddress(&NetAddressV2{
+		Timestamp: na.Timestamp,
+		NetworkID: NetIDIPv4,
+		Addr:      []byte{0x7f, 0x00, 0x00, 0x00, 0x01},
+	})
+	badLenAddrEncoded := []byte{
+		0x01,                   // Varint for number of addresses
+		0x29, 0xab, 0x5f, 0x49, // Timestamp
+		0x00, // No services (varInt)
+		0x01, // Network ID IPv4
+		0x05, // Varint for address length
+	}
+
+	// Message that forces an error by having an address that exceeds the
+	// max allowed size.
+	bigAddr := NewMsgAddrV2()
+	bigAddr.AddAddress(&NetAddressV2{
+		Timestamp: na.Timestamp,
+		NetworkID: NetworkID(0xaa),
+		Addr:      make([]byte, MaxAddrV2Size+1),
+	})
+	bigAddrEncoded := []byte{
+		0x01,                   // Varint for number of addresses
+		0x29, 0xab, 0x5f, 0x49, // Timestamp
+		0x00,             // No services (varInt)
+		0xaa,             // Unknown network ID
+		0xfd, 0x01, 0x02, // Varint for address length (513)
+	}
+
+	tests := []struct {
+		in       *MsgAddrV2      // Value to encode
+		buf      []byte          // Wire encoding
+		pver     uint32          // Protocol version for wire encoding
+		enc      MessageEncoding // Message encoding format
+		max      int             // Max size of fixed buffer to induce errors
+		writeErr error           // Expected write error
+		readErr  error           // Expected read error
+	}{
+		// Latest protocol version with intentional read/write errors.
+		// Force error in addresses count
+		{baseAddr, baseAddrEncoded, pver, BaseEncoding, 0, io.ErrShortWrite, io.EOF},
+		// Force error in timestamp.
+		{baseAddr, baseAddrEncoded, pver, BaseEncoding, 1, io.ErrShortWrite, io.EOF},
+		// Force error in network ID.
+		{baseAddr, baseAddrEncoded, pver, BaseEncoding, 6, io.ErrShortWrite, io.EOF},
+		// Force error in address.
+		{baseAddr, baseAddrEncoded, pver, BaseEncoding, 8, io.ErrShortWrite, io.EOF},
+		// Force error in port.
+		{baseAddr, baseAddrEncoded, pver, BaseEncoding, 12, io.ErrShortWrite, io.EOF},
+		// Force error with greater than max addresses.
+		{maxAddr, maxAddrEncoded, pver, BaseEncoding, 3, wireErr, wireErr},
+		// Force error with invalid address length.
+		{badLenAddr, badLenAddrEncoded, pver, BaseEncoding, 8, wireErr, wireErr},
+		// Force error with address exceeding the max size.
+		{bigAddr, bigAddrEncoded, pver, BaseEncoding, 10, wireErr, wireErr},
+		// Force error due to unsupported protocol version.
+		{baseAddr, baseAddrEncoded, pverAddrV2, BaseEncoding, 14, wireErr, wireErr},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode to wire format.
+		w := newFixedWriter(test.max)
+		err := test.in.HdfEncode(w, test.pver, test.enc)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.writeErr) {
+			t.Errorf("HdfEncode #%d wrong error got: %v, want: %v",
+				i, err, test.writeErr)
+			continue
+		}
+
+		// For errors which are not of type MessageError, check them for
+		// equality.
+		if _, ok := err.(*MessageError); !ok {
+			if err != test.writeErr {
+				t.Errorf("HdfEncode #%d wrong error got: %v, "+
+					"want: %v", i, err, test.writeErr)
+				continue
+			}
+		}
+
+		// Decode from wire format.
+		var msg MsgAddrV2
+		r := newFixedReader(test.max, test.buf)
+		err = msg.HdfDecode(r, test.pver, test.enc)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.readErr) {
+			t.Errorf("HdfDecode #%d wrong error got: %v, want: %v",
+				i, err, test.readErr)
+			continue
+		}
+
+		// For errors which are not of type MessageError, check them for
+		// equality.
+		if _, ok := err.(*MessageError); !ok {
+			if err != test.readErr {
+				t.Errorf("HdfDecode #%d wrong error got: %v, "+
+					"want: %v", i, err, test.readErr)
+				continue
+			}
+		}
+	}
+}
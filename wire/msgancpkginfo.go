@@ -0,0 +1,145 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+)
+
+// readPkgWTxIds reads a list of up to MaxPackageTxs witness transaction hashes
+// from r as used by the package relay messages.
+func readPkgWTxIds(r io.Reader, pver uint32, funcName string) ([]*chainhash.Hash, error) {
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return nil, err
+	}
+
+	// Limit to max transactions per package.
+	if count > MaxPackageTxs {
+		str := fmt.Sprintf("too many transactions in package "+
+			"[count %d, max %d]", count, MaxPackageTxs)
+		return nil, messageError(funcName, str)
+	}
+
+	// Create a contiguous slice of hashes to deserialize into in order to
+	// reduce the number of allocations.
+	hashes := make([]chainhash.Hash, count)
+	wtxIds := make([]*chainhash.Hash, 0, count)
+	for i := uint64(0); i < count; i++ {
+		hash := &hashes[i]
+		err := readElement(r, hash)
+		if err != nil {
+			return nil, err
+		}
+		wtxIds = append(wtxIds, hash)
+	}
+
+	return wtxIds, nil
+}
+
+// writePkgWTxIds writes a list of up to MaxPackageTxs witness transaction
+// hashes to w as used by the package relay messages.
+func writePkgWTxIds(w io.Writer, pver uint32, wtxIds []*chainhash.Hash, funcName string) error {
+	// Limit to max transactions per package.
+	count := len(wtxIds)
+	if count > MaxPackageTxs {
+		str := fmt.Sprintf("too many transactions in package "+
+			"[count %d, max %d]", count, MaxPackageTxs)
+		return messageError(funcName, str)
+	}
+
+	err := WriteVarInt(w, pver, uint64(count))
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range wtxIds {
+		err := writeElement(w, hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MsgAncPkgInfo implements the Message interface and represents a bitcoin
+// ancpkginfo message.  It is sent in response to a getdata message for a
+// MSG_ANCPKGINFO inventory vector and lists the witness hashes of the
+// transaction identified by it along with all of its unconfirmed ancestors in
+// topological order, so the transaction itself is last (BIP0331).
+//
+// Use the AddWTxId function to build up the list of witness transaction hashes.
+//
+// Package relay requires wtxid-based transaction relay, so this message was
+// not added until protocol versions starting with WTxIdRelayVersion.
+type MsgAncPkgInfo struct {
+	WTxIds []*chainhash.Hash
+}
+
+// AddWTxId adds a witness transaction hash to the message.
+func (msg *MsgAncPkgInfo) AddWTxId(hash *chainhash.Hash) error {
+	if len(msg.WTxIds)+1 > MaxPackageTxs {
+		str := fmt.Sprintf("too many transactions in package "+
+			"[max %v]", MaxPackageTxs)
+		return messageError("MsgAncPkgInfo.AddWTxId", str)
+	}
+
+	msg.WTxIds = append(msg.WTxIds, hash)
+	return nil
+}
+
+// HdfDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgAncPkgInfo) HdfDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < WTxIdRelayVersion {
+		str := fmt.Sprintf("ancpkginfo message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgAncPkgInfo.HdfDecode", str)
+	}
+
+	wtxIds, err := readPkgWTxIds(r, pver, "MsgAncPkgInfo.HdfDecode")
+	if err != nil {
+		return err
+	}
+	msg.WTxIds = wtxIds
+	return nil
+}
+
+// HdfEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgAncPkgInfo) HdfEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < WTxIdRelayVersion {
+		str := fmt.Sprintf("ancpkginfo message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgAncPkgInfo.HdfEncode", str)
+	}
+
+	return writePkgWTxIds(w, pver, msg.WTxIds, "MsgAncPkgInfo.HdfEncode")
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgAncPkgInfo) Command() string {
+	return CmdAncPkgInfo
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgAncPkgInfo) MaxPayloadLength(pver uint32) uint32 {
+	// Num hashes (varInt) + max allowed hashes.
+	return MaxVarIntPayload + (MaxPackageTxs * chainhash.HashSize)
+}
+
+// NewMsgAncPkgInfo returns a new bitcoin ancpkginfo message that conforms to
+// the Message interface.  See MsgAncPkgInfo for details.
+func NewMsgAncPkgInfo() *MsgAncPkgInfo {
+	return &MsgAncPkgInfo{
+		WTxIds: make([]*chainhash.Hash, 0, MaxPackageTxs),
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+)
+
+// pkgWTxIdsMsg describes the messages with a list of package witness
+// transaction hashes, which share the same encoding, so they can be tested
+// together.
+type pkgWTxIdsMsg interface {
+	Message
+	AddWTxId(hash *chainhash.Hash) error
+}
+
+// pkgWTxIdsMsgs returns new instances of each of the messages with a list of
+// package witness transaction hashes.
+func pkgWTxIdsMsgs() []pkgWTxIdsMsg {
+	return []pkgWTxIdsMsg{NewMsgAncPkgInfo(), NewMsgGetPkgTxns()}
+}
+
+// TestPkgWTxIds tests the MsgAncPkgInfo and MsgGetPkgTxns API against the
+// latest protocol version.
+func TestPkgWTxIds(t *testing.T) {
+	pver := ProtocolVersion
+
+	wantCmds := []string{"ancpkginfo", "getpkgtxns"}
+	for i, msg := range pkgWTxIdsMsgs() {
+		// Ensure the command is expected value.
+		if cmd := msg.Command(); cmd != wantCmds[i] {
+			t.Errorf("wrong command - got %v want %v", cmd,
+				wantCmds[i])
+		}
+
+		// Ensure max payload is expected value for latest protocol
+		// version.  Num hashes (varInt) + max allowed hashes.
+		wantPayload := uint32(9 + MaxPackageTxs*chainhash.HashSize)
+		maxPayload := msg.MaxPayloadLength(pver)
+		if maxPayload != wantPayload {
+			t.Errorf("%s: wrong max payload length for protocol "+
+				"version %d - got %v, want %v", msg.Command(),
+				pver, maxPayload, wantPayload)
+		}
+
+		// Ensure hashes are added properly up to the max allowed.
+		for j := 0; j < MaxPackageTxs; j++ {
+			err := msg.AddWTxId(&chainhash.Hash{byte(j)})
+			if err != nil {
+				t.Fatalf("%s: AddWTxId #%d: unexpected error: %v",
+					msg.Command(), j, err)
+			}
+		}
+		err := msg.AddWTxId(&chainhash.Hash{})
+		if _, ok := err.(*MessageError); !ok {
+			t.Errorf("%s: AddWTxId: expected error adding more than "+
+				"max hashes - got %v", msg.Command(), err)
+		}
+	}
+}
+
+// TestPkgWTxIdsWire tests the MsgAncPkgInfo and MsgGetPkgTxns wire encode and
+// decode for various numbers of hashes and protocol versions.
+func TestPkgWTxIdsWire(t *testing.T) {
+	hash1 := chainhash.Hash{0x01}
+	hash2 := chainhash.Hash{0x02}
+
+	noHashesEncoded := []byte{0x00}
+	twoHashesEncoded := []byte{0x02}
+	twoHashesEncoded = append(twoHashesEncoded, hash1[:]...)
+	twoHashesEncoded = append(twoHashesEncoded, hash2[:]...)
+
+	tests := []struct {
+		hashes []*chainhash.Hash // Hashes to add to the messages
+		buf    []byte            // Wire encoding
+		pver   uint32            // Protocol version for wire encoding
+	}{
+		// Latest protocol version with no hashes.
+		{nil, noHashesEncoded, ProtocolVersion},
+
+		// Latest protocol version with multiple hashes.
+		{[]*chainhash.Hash{&hash1, &hash2}, twoHashesEncoded,
+			ProtocolVersion},
+
+		// Protocol version WTxIdRelayVersion with multiple hashes.
+		{[]*chainhash.Hash{&hash1, &hash2}, twoHashesEncoded,
+			WTxIdRelayVersion},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		for _, msg := range pkgWTxIdsMsgs() {
+			for _, hash := range test.hashes {
+				msg.AddWTxId(hash)
+			}
+
+			// Encode the message to wire format.
+			var buf bytes.Buffer
+			err := msg.HdfEncode(&buf, test.pver, BaseEncoding)
+			if err != nil {
+				t.Errorf("HdfEncode #%d (%s) error %v", i,
+					msg.Command(), err)
+				continue
+			}
+			if !bytes.Equal(buf.Bytes(), test.buf) {
+				t.Errorf("HdfEncode #%d (%s)\n got: %s want: %s",
+					i, msg.Command(), spew.Sdump(buf.Bytes()),
+					spew.Sdump(test.buf))
+				continue
+			}
+
+			// Decode the message from wire format.
+			readMsg, _ := makeEmptyMessage(msg.Command())
+			rbuf := bytes.NewReader(test.buf)
+			err = readMsg.HdfDecode(rbuf, test.pver, BaseEncoding)
+			if err != nil {
+				t.Errorf("HdfDecode #%d (%s) error %v", i,
+					msg.Command(), err)
+				continue
+			}
+			var got []*chainhash.Hash
+			switch m := readMsg.(type) {
+			case *MsgAncPkgInfo:
+				got = m.WTxIds
+			case *MsgGetPkgTxns:
+				got = m.WTxIds
+			}
+			if len(got) != len(test.hashes) ||
+				(len(got) > 0 && !reflect.DeepEqual(got, test.hashes)) {
+
+				t.Errorf("HdfDecode #%d (%s)\n got: %s want: %s",
+					i, msg.Command(), spew.Sdump(got),
+					spew.Sdump(test.hashes))
+				continue
+			}
+		}
+	}
+}
+
+// TestPkgWTxIdsWireErrors performs negative tests against wire encode and
+// decode of MsgAncPkgInfo and MsgGetPkgTxns to confirm error paths work
+// correctly.
+func TestPkgWTxIdsWireErrors(t *testing.T) {
+	pver := ProtocolVersion
+	pverNoPkgRelay := WTxIdRelayVersion - 1
+	wireErr := &MessageError{}
+
+	hash := chainhash.Hash{0x01}
+	baseEncoded := append([]byte{0x01}, hash[:]...)
+
+	// Message with more than the max allowed hashes, which can't be built
+	// via AddWTxId.
+	maxHashes := make([]*chainhash.Hash, MaxPackageTxs+1)
+	for i := range maxHashes {
+		maxHashes[i] = &hash
+	}
+	maxEncoded := []byte{MaxPackageTxs + 1}
+
+	tests := []struct {
+		hashes   []*chainhash.Hash // Hashes of the message to encode
+		buf      []byte            // Wire encoding
+		pver     uint32            // Protocol version for wire encoding
+		max      int               // Max size of fixed buffer to induce errors
+		writeErr error             // Expected write error
+		readErr  error             // Expected read error
+	}{
+		// Force error in hash count.
+		{[]*chainhash.Hash{&hash}, baseEncoded, pver, 0, io.ErrShortWrite, io.EOF},
+		// Force error in hash.
+		{[]*chainhash.Hash{&hash}, baseEncoded, pver, 1, io.ErrShortWrite, io.EOF},
+		// Force error due to unsupported protocol version.
+		{[]*chainhash.Hash{&hash}, baseEncoded, pverNoPkgRelay, 33, wireErr, wireErr},
+		// Force error with greater than max hashes.
+		{maxHashes, maxEncoded, pver, 1, wireErr, wireErr},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		msgs := []Message{
+			&MsgAncPkgInfo{WTxIds: test.hashes},
+			&MsgGetPkgTxns{WTxIds: test.hashes},
+		}
+		for _, msg := range msgs {
+			// Encode to wire format.
+			w := newFixedWriter(test.max)
+			err := msg.HdfEncode(w, test.pver, BaseEncoding)
+			if reflect.TypeOf(err) != reflect.TypeOf(test.writeErr) {
+				t.Errorf("HdfEncode #%d (%s) wrong error got: %v, "+
+					"want: %v", i, msg.Command(), err,
+					test.writeErr)
+				continue
+			}
+
+			// For errors which are not of type MessageError, check
+			// them for equality.
+			if _, ok := err.(*MessageError); !ok {
+				if err != test.writeErr {
+					t.Errorf("HdfEncode #%d (%s) wrong error "+
+						"got: %v, want: %v", i, msg.Command(),
+						err, test.writeErr)
+					continue
+				}
+			}
+
+			// Decode from wire format.
+			readMsg, _ := makeEmptyMessage(msg.Command())
+			r := newFixedReader(test.max, test.buf)
+			err = readMsg.HdfDecode(r, test.pver, BaseEncoding)
+			if reflect.TypeOf(err) != reflect.TypeOf(test.readErr) {
+				t.Errorf("HdfDecode #%d (%s) wrong error got: %v, "+
+					"want: %v", i, msg.Command(), err,
+					test.readErr)
+				continue
+			}
+
+			// For errors which are not of type MessageError, check
+			// them for equality.
+			if _, ok := err.(*MessageError); !ok {
+				if err != test.readErr {
+					t.Errorf("HdfDecode #%d (%s) wrong error "+
+						"got: %v, want: %v", i, msg.Command(),
+						err, test.readErr)
+					continue
+				}
+			}
+		}
+	}
+}
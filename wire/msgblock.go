@@ -62,14 +62,87 @@ func (msg *MsgBlock) ClearTransactions() {
 // See Deserialize for decoding blocks stored to disk, such as in a database, as
 // opposed to decoding blocks from the wire.
 func (msg *MsgBlock) HdfDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
-	err := readBlockHeader(r, pver, &msg.Header)
+	return msg.hdfDecode(r, pver, enc, nil)
+}
+
+// DecodeInto decodes r using the bitcoin protocol encoding into the receiver
+// in the same manner as HdfDecode, however, the transactions and all of their
+// inputs, outputs, witness stacks, and scripts are carved from the storage
+// owned by the provided arena rather than being individually allocated.  This
+// drastically reduces the number of allocations, and therefore the garbage
+// collection overhead, of decoding blocks in bulk such as during the initial
+// block download.
+//
+// The decoded block is only valid until the arena is reset.  See DecodeArena
+// for details.
+func (msg *MsgBlock) DecodeInto(r io.Reader, pver uint32, enc MessageEncoding,
+	arena *DecodeArena) error {
+
+	return msg.hdfDecode(r, pver, enc, arena)
+}
+
+// TxStreamFunc defines the signature of the callback invoked by
+// MsgBlock.HdfDecodeTxStream for each transaction in the block along with its
+// index within the block.  Returning an error stops the decoding and causes
+// HdfDecodeTxStream to return the error.
+//
+// The transaction, and all of its inputs, outputs, and scripts, are only valid
+// until the callback returns since the storage is reused for the next
+// transaction.  Callbacks that need to retain a transaction must copy it, for
+// example via MsgTx.Copy.
+type TxStreamFunc func(txIdx int, tx *MsgTx) error
+
+// HdfDecodeTxStream decodes r using the bitcoin protocol encoding in the same
+// manner as HdfDecode, however, rather than adding the transactions to the
+// receiver, each transaction is passed to the provided callback as soon as it
+// is decoded.  Only the header is decoded into the receiver and its
+// transactions are cleared.
+//
+// This allows consumers such as indexers to process the transactions of large
+// blocks without having the entire decoded block in memory at once.
+func (msg *MsgBlock) HdfDecodeTxStream(r io.Reader, pver uint32,
+	enc MessageEncoding, fn TxStreamFunc) error {
+
+	msg.Transactions = nil
+	txCount, err := msg.readHeaderAndTxCount(r, pver,
+		"MsgBlock.HdfDecodeTxStream")
 	if err != nil {
 		return err
 	}
 
+	// Decode each transaction into storage that is reused for the next one
+	// once the callback returns.
+	var arena DecodeArena
+	var tx MsgTx
+	for i := 0; i < int(txCount); i++ {
+		arena.Reset()
+		err := tx.hdfDecode(r, pver, enc, &arena)
+		if err != nil {
+			return err
+		}
+		if err := fn(i, &tx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readHeaderAndTxCount decodes the block header from r into the receiver and
+// returns the number of transactions that follow it.  An error is returned
+// when the number of transactions could not possibly fit into a block.  The
+// function name is only used in the error.
+func (msg *MsgBlock) readHeaderAndTxCount(r io.Reader, pver uint32,
+	funcName string) (uint64, error) {
+
+	err := readBlockHeader(r, pver, &msg.Header)
+	if err != nil {
+		return 0, err
+	}
+
 	txCount, err := ReadVarInt(r, pver)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	// Prevent more transactions than could possibly fit into a block.
@@ -78,17 +151,31 @@ func (msg *MsgBlock) HdfDecode(r io.Reader, pver uint32, enc MessageEncoding) er
 	if txCount > maxTxPerBlock {
 		str := fmt.Sprintf("too many transactions to fit into a block "+
 			"[count %d, max %d]", txCount, maxTxPerBlock)
-		return messageError("MsgBlock.HdfDecode", str)
+		return 0, messageError(funcName, str)
 	}
 
-	msg.Transactions = make([]*MsgTx, 0, txCount)
-	for i := uint64(0); i < txCount; i++ {
-		tx := MsgTx{}
-		err := tx.HdfDecode(r, pver, enc)
+	return txCount, nil
+}
+
+// hdfDecode decodes r using the bitcoin protocol encoding into the receiver
+// while carving all of the storage needed for the transactions from the
+// provided arena.  A nil arena causes the storage to be allocated normally.
+func (msg *MsgBlock) hdfDecode(r io.Reader, pver uint32, enc MessageEncoding,
+	arena *DecodeArena) error {
+
+	txCount, err := msg.readHeaderAndTxCount(r, pver, "MsgBlock.HdfDecode")
+	if err != nil {
+		return err
+	}
+
+	txns := arena.allocTxs(txCount)
+	msg.Transactions = txns[:0]
+	for _, tx := range txns {
+		err := tx.hdfDecode(r, pver, enc, arena)
 		if err != nil {
 			return err
 		}
-		msg.Transactions = append(msg.Transactions, &tx)
+		msg.Transactions = append(msg.Transactions, tx)
 	}
 
 	return nil
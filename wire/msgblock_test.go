@@ -6,6 +6,7 @@ package wire
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"reflect"
 	"testing"
@@ -451,6 +452,91 @@ func TestBlockOverflowErrors(t *testing.T) {
 				"want: %v", i, err, reflect.TypeOf(test.err))
 			continue
 		}
+
+		// Stream the transactions from wire format.
+		r = bytes.NewReader(test.buf)
+		err = msg.HdfDecodeTxStream(r, test.pver, test.enc,
+			func(int, *MsgTx) error { return nil })
+		if reflect.TypeOf(err) != reflect.TypeOf(test.err) {
+			t.Errorf("HdfDecodeTxStream #%d wrong error got: %v, "+
+				"want: %v", i, err, reflect.TypeOf(test.err))
+			continue
+		}
+	}
+}
+
+// TestBlockDecodeTxStream ensures streaming the transactions of a block
+// produces the same header and transactions as decoding the entire block and
+// that errors returned by the callback stop the decoding.
+func TestBlockDecodeTxStream(t *testing.T) {
+	block, blockBytes := arenaTestBlock(t, 10)
+
+	// Ensure the streamed transactions match those in the block.  They are
+	// checked within the callback since they are only valid until it
+	// returns.
+	var msg MsgBlock
+	var numTxns int
+	err := msg.HdfDecodeTxStream(bytes.NewReader(blockBytes),
+		ProtocolVersion, WitnessEncoding, func(txIdx int, tx *MsgTx) error {
+			if txIdx != numTxns {
+				t.Errorf("unexpected tx index -- got %d, want %d",
+					txIdx, numTxns)
+			}
+			numTxns++
+			if txIdx >= len(block.Transactions) {
+				return nil
+			}
+			want := block.Transactions[txIdx]
+			if !reflect.DeepEqual(tx, want) {
+				t.Errorf("mismatched tx %d\ngot: %s want: %s",
+					txIdx, spew.Sdump(tx), spew.Sdump(want))
+			}
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("HdfDecodeTxStream: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(&msg.Header, &block.Header) {
+		t.Errorf("mismatched header\ngot: %s want: %s",
+			spew.Sdump(&msg.Header), spew.Sdump(&block.Header))
+	}
+	if len(msg.Transactions) != 0 {
+		t.Errorf("unexpected transactions in block -- got %d, want 0",
+			len(msg.Transactions))
+	}
+	if numTxns != len(block.Transactions) {
+		t.Errorf("unexpected number of transactions -- got %d, want %d",
+			numTxns, len(block.Transactions))
+	}
+
+	// Ensure an error returned by the callback is returned as is without
+	// decoding any further transactions.
+	errStop := errors.New("stop")
+	var numCalls int
+	err = msg.HdfDecodeTxStream(bytes.NewReader(blockBytes),
+		ProtocolVersion, WitnessEncoding, func(txIdx int, tx *MsgTx) error {
+			numCalls++
+			if txIdx == 2 {
+				return errStop
+			}
+			return nil
+		})
+	if err != errStop {
+		t.Errorf("HdfDecodeTxStream: unexpected error -- got %v, want %v",
+			err, errStop)
+	}
+	if numCalls != 3 {
+		t.Errorf("unexpected number of callbacks -- got %d, want 3",
+			numCalls)
+	}
+
+	// Ensure a truncated block results in an error.
+	err = msg.HdfDecodeTxStream(bytes.NewReader(blockBytes[:len(blockBytes)-1]),
+		ProtocolVersion, WitnessEncoding,
+		func(int, *MsgTx) error { return nil })
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("HdfDecodeTxStream: unexpected error -- got %v, want %v",
+			err, io.ErrUnexpectedEOF)
 	}
 }
 
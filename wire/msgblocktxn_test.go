@@ -0,0 +1,179 @@
+// Copyright (c) 2018 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestBlockTxn tests the MsgBlockTxn API.
+func TestBlockTxn(t *testing.T) {
+	pver := ProtocolVersion
+
+	blockHash := blockOne.BlockHash()
+	msg := NewMsgBlockTxn(&blockHash)
+	if !msg.BlockHash.IsEqual(&blockHash) {
+		t.Errorf("NewMsgBlockTxn: wrong block hash - got %v, want %v",
+			msg.BlockHash, blockHash)
+	}
+
+	// Ensure the command is expected value.
+	wantCmd := "blocktxn"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgBlockTxn: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value for latest protocol version.
+	wantPayload := uint32(MaxBlockPayload)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+
+	// Ensure transactions are added properly.
+	tx := blockOne.Transactions[0].Copy()
+	msg.AddTransaction(tx)
+	if !reflect.DeepEqual(msg.Transactions, []*MsgTx{tx}) {
+		t.Errorf("AddTransaction: wrong transactions - got %v, want %v",
+			spew.Sdump(msg.Transactions), spew.Sdump([]*MsgTx{tx}))
+	}
+}
+
+// TestBlockTxnWire tests the MsgBlockTxn wire encode and decode for various
+// protocol versions.
+func TestBlockTxnWire(t *testing.T) {
+	blockHash := blockOne.BlockHash()
+	blockTxn := NewMsgBlockTxn(&blockHash)
+	blockTxn.AddTransaction(blockOne.Transactions[0])
+
+	// The block one transaction count and transaction bytes are reused
+	// after the block hash.
+	blockTxnEncoded := append(append([]byte{}, blockHash[:]...),
+		blockOneBytes[80:]...)
+
+	tests := []struct {
+		in   *MsgBlockTxn // Message to encode
+		out  *MsgBlockTxn // Expected decoded message
+		buf  []byte       // Wire encoding
+		pver uint32       // Protocol version for wire encoding
+		enc  MessageEncoding
+	}{
+		{blockTxn, blockTxn, blockTxnEncoded, ProtocolVersion, BaseEncoding},
+		{blockTxn, blockTxn, blockTxnEncoded, ProtocolVersion, WitnessEncoding},
+		{blockTxn, blockTxn, blockTxnEncoded, SendCmpctVersion, BaseEncoding},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode the message to wire format.
+		var buf bytes.Buffer
+		err := test.in.HdfEncode(&buf, test.pver, test.enc)
+		if err != nil {
+			t.Errorf("HdfEncode #%d error %v", i, err)
+			continue
+		}
+		if !bytes.Equal(buf.Bytes(), test.buf) {
+			t.Errorf("HdfEncode #%d\n got: %s want: %s", i,
+				spew.Sdump(buf.Bytes()), spew.Sdump(test.buf))
+			continue
+		}
+
+		// Decode the message from wire format.
+		var msg MsgBlockTxn
+		rbuf := bytes.NewReader(test.buf)
+		err = msg.HdfDecode(rbuf, test.pver, test.enc)
+		if err != nil {
+			t.Errorf("HdfDecode #%d error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(&msg, test.out) {
+			t.Errorf("HdfDecode #%d\n got: %s want: %s", i,
+				spew.Sdump(&msg), spew.Sdump(test.out))
+			continue
+		}
+	}
+}
+
+// TestBlockTxnWireErrors performs negative tests against wire encode and
+// decode of MsgBlockTxn to confirm error paths work correctly.
+func TestBlockTxnWireErrors(t *testing.T) {
+	pver := ProtocolVersion
+	pverNoSendCmpct := SendCmpctVersion - 1
+	wireErr := &MessageError{}
+
+	blockHash := blockOne.BlockHash()
+	baseBlockTxn := NewMsgBlockTxn(&blockHash)
+	baseBlockTxn.AddTransaction(blockOne.Transactions[0])
+	baseBlockTxnEncoded := append(append([]byte{}, blockHash[:]...),
+		blockOneBytes[80:]...)
+
+	tests := []struct {
+		in       *MsgBlockTxn // Value to encode
+		buf      []byte       // Wire encoding
+		pver     uint32       // Protocol version for wire encoding
+		max      int          // Max size of fixed buffer to induce errors
+		writeErr error        // Expected write error
+		readErr  error        // Expected read error
+	}{
+		// Force error in block hash.
+		{baseBlockTxn, baseBlockTxnEncoded, pver, 0, io.ErrShortWrite, io.EOF},
+		// Force error in transaction count.
+		{baseBlockTxn, baseBlockTxnEncoded, pver, 32, io.ErrShortWrite, io.EOF},
+		// Force error in transactions.
+		{baseBlockTxn, baseBlockTxnEncoded, pver, 33, io.ErrShortWrite, io.EOF},
+		// Force error due to unsupported protocol version.
+		{baseBlockTxn, baseBlockTxnEncoded, pverNoSendCmpct, 33, wireErr, wireErr},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode to wire format.
+		w := newFixedWriter(test.max)
+		err := test.in.HdfEncode(w, test.pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.writeErr) {
+			t.Errorf("HdfEncode #%d wrong error got: %v, want: %v",
+				i, err, test.writeErr)
+			continue
+		}
+
+		// For errors which are not of type MessageError, check them for
+		// equality.
+		if _, ok := err.(*MessageError); !ok {
+			if err != test.writeErr {
+				t.Errorf("HdfEncode #%d wrong error got: %v, "+
+					"want: %v", i, err, test.writeErr)
+				continue
+			}
+		}
+
+		// Decode from wire format.
+		var msg MsgBlockTxn
+		r := newFixedReader(test.max, test.buf)
+		err = msg.HdfDecode(r, test.pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.readErr) {
+			t.Errorf("HdfDecode #%d wrong error got: %v, want: %v",
+				i, err, test.readErr)
+			continue
+		}
+
+		// For errors which are not of type MessageError, check them for
+		// equality.
+		if _, ok := err.(*MessageError); !ok {
+			if err != test.readErr {
+				t.Errorf("HdfDecode #%d wrong error got: %v, "+
+					"want: %v", i, err, test.readErr)
+				continue
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+)
+
+const (
+	// MaxBulletinMessageSize is the maximum number of bytes the text of a
+	// bulletin may contain.
+	MaxBulletinMessageSize = 1024
+
+	// MaxBulletinSignatureSize is the maximum number of bytes the signature
+	// of a bulletin may contain, which is the size of the largest DER
+	// encoded secp256k1 signature.
+	MaxBulletinSignatureSize = 72
+
+	// maxBulletinPayload is the maximum number of bytes a bulletin message
+	// can be.  It consists of the ID, the timestamp and expiration, and
+	// the message and signature along with their lengths.
+	maxBulletinPayload = 4 + 8 + 8 + MaxVarIntPayload +
+		MaxBulletinMessageSize + MaxVarIntPayload + MaxBulletinSignatureSize
+)
+
+// MsgBulletin implements the Message interface and represents a bulletin
+// message.  It is used by the operators of private networks to broadcast
+// emergency notices to all nodes of the network.  It replaces the deprecated
+// alert message (MsgAlert) which relied on a single hard-coded key.
+//
+// Nodes only relay bulletins that are signed by one of the keys configured for
+// the network, and a bulletin replaces all bulletins with a lower ID.  The
+// signature commits to all of the other fields via SignatureHash.
+//
+// This message is not part of the bitcoin protocol, so it must only be sent to
+// peers which advertise the SFNodeBulletin service flag.
+type MsgBulletin struct {
+	// ID identifies the bulletin.  Bulletins with a higher ID replace the
+	// previous ones.
+	ID uint32
+
+	// Timestamp is the time the bulletin was created.
+	Timestamp time.Time
+
+	// Expiration is the time after which the bulletin is no longer relayed.
+	Expiration time.Time
+
+	// Message is the text of the bulletin.
+	Message string
+
+	// Signature is the DER encoded signature of the bulletin.
+	Signature []byte
+}
+
+// encodeUnsigned encodes all of the fields of the receiver except the signature
+// to w.
+func (msg *MsgBulletin) encodeUnsigned(w io.Writer, pver uint32) error {
+	if len(msg.Message) > MaxBulletinMessageSize {
+		str := fmt.Sprintf("bulletin message is too long [len %d, "+
+			"max %d]", len(msg.Message), MaxBulletinMessageSize)
+		return messageError("MsgBulletin.HdfEncode", str)
+	}
+
+	err := writeElements(w, msg.ID, msg.Timestamp.Unix(),
+		msg.Expiration.Unix())
+	if err != nil {
+		return err
+	}
+	return WriteVarString(w, pver, msg.Message)
+}
+
+// SignatureHash returns the hash of the bulletin the signature commits to.  It
+// is the double sha256 of the serialized bulletin without its signature.
+func (msg *MsgBulletin) SignatureHash() (chainhash.Hash, error) {
+	var buf bytes.Buffer
+	if err := msg.encodeUnsigned(&buf, 0); err != nil {
+		return chainhash.Hash{}, err
+	}
+	return chainhash.DoubleHashH(buf.Bytes()), nil
+}
+
+// HdfDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgBulletin) HdfDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	err := readElements(r, &msg.ID, (*int64Time)(&msg.Timestamp),
+		(*int64Time)(&msg.Expiration))
+	if err != nil {
+		return err
+	}
+
+	message, err := ReadVarBytes(r, pver, MaxBulletinMessageSize,
+		"bulletin message")
+	if err != nil {
+		return err
+	}
+	msg.Message = string(message)
+
+	msg.Signature, err = ReadVarBytes(r, pver, MaxBulletinSignatureSize,
+		"bulletin signature")
+	return err
+}
+
+// HdfEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgBulletin) HdfEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if len(msg.Signature) > MaxBulletinSignatureSize {
+		str := fmt.Sprintf("bulletin signature is too long [len %d, "+
+			"max %d]", len(msg.Signature), MaxBulletinSignatureSize)
+		return messageError("MsgBulletin.HdfEncode", str)
+	}
+
+	if err := msg.encodeUnsigned(w, pver); err != nil {
+		return err
+	}
+	return WriteVarBytes(w, pver, msg.Signature)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgBulletin) Command() string {
+	return CmdBulletin
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgBulletin) MaxPayloadLength(pver uint32) uint32 {
+	return maxBulletinPayload
+}
+
+// NewMsgBulletin returns a new unsigned bulletin message that conforms to the
+// Message interface using the passed parameters.  See MsgBulletin for details.
+func NewMsgBulletin(id uint32, expiration time.Time, message string) *MsgBulletin {
+	return &MsgBulletin{
+		ID:         id,
+		Timestamp:  time.Unix(time.Now().Unix(), 0),
+		Expiration: expiration,
+		Message:    message,
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestBulletin tests the MsgBulletin API.
+func TestBulletin(t *testing.T) {
+	pver := ProtocolVersion
+
+	expiration := time.Unix(1600086400, 0)
+	msg := NewMsgBulletin(1, expiration, "hi")
+	if msg.ID != 1 || msg.Expiration != expiration || msg.Message != "hi" {
+		t.Errorf("NewMsgBulletin: wrong bulletin - got %v", spew.Sdump(msg))
+	}
+
+	// Ensure the command is expected value.
+	wantCmd := "bulletin"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgBulletin: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value for latest protocol version.
+	wantPayload := uint32(1134)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+
+	// Ensure the signature hash commits to all fields except the
+	// signature.
+	hash, err := msg.SignatureHash()
+	if err != nil {
+		t.Fatalf("SignatureHash: unexpected error %v", err)
+	}
+	msg.Signature = []byte{0x30}
+	if hash2, _ := msg.SignatureHash(); hash2 != hash {
+		t.Errorf("SignatureHash: hash commits to signature")
+	}
+	msg.ID++
+	if hash2, _ := msg.SignatureHash(); hash2 == hash {
+		t.Errorf("SignatureHash: hash does not commit to ID")
+	}
+}
+
+// TestBulletinWire tests the MsgBulletin wire encode and decode.
+func TestBulletinWire(t *testing.T) {
+	msg := MsgBulletin{
+		ID:         1,
+		Timestamp:  time.Unix(1600000000, 0),
+		Expiration: time.Unix(1600086400, 0),
+		Message:    "hi",
+		Signature:  []byte{0x30, 0x01, 0x02},
+	}
+	msgEncoded := []byte{
+		0x01, 0x00, 0x00, 0x00, // ID
+		0x00, 0x10, 0x5e, 0x5f, 0x00, 0x00, 0x00, 0x00, // Timestamp
+		0x80, 0x61, 0x5f, 0x5f, 0x00, 0x00, 0x00, 0x00, // Expiration
+		0x02, 0x68, 0x69, // Message
+		0x03, 0x30, 0x01, 0x02, // Signature
+	}
+
+	// Encode the message to wire format.
+	var buf bytes.Buffer
+	err := msg.HdfEncode(&buf, ProtocolVersion, BaseEncoding)
+	if err != nil {
+		t.Fatalf("HdfEncode error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), msgEncoded) {
+		t.Fatalf("HdfEncode\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(msgEncoded))
+	}
+
+	// Decode the message from wire format.
+	var readMsg MsgBulletin
+	rbuf := bytes.NewReader(msgEncoded)
+	err = readMsg.HdfDecode(rbuf, ProtocolVersion, BaseEncoding)
+	if err != nil {
+		t.Fatalf("HdfDecode error %v", err)
+	}
+	if !reflect.DeepEqual(readMsg, msg) {
+		t.Fatalf("HdfDecode\n got: %s want: %s", spew.Sdump(readMsg),
+			spew.Sdump(msg))
+	}
+}
+
+// TestBulletinWireErrors performs negative tests against wire encode and decode
+// of MsgBulletin to confirm error paths work correctly.
+func TestBulletinWireErrors(t *testing.T) {
+	pver := ProtocolVersion
+	wireErr := &MessageError{}
+
+	// Ensure messages and signatures that are too long are rejected.
+	tooLongMsg := MsgBulletin{
+		Message: strings.Repeat("a", MaxBulletinMessageSize+1),
+	}
+	var buf bytes.Buffer
+	err := tooLongMsg.HdfEncode(&buf, pver, BaseEncoding)
+	if reflect.TypeOf(err) != reflect.TypeOf(wireErr) {
+		t.Errorf("HdfEncode: wrong error for long message - got %v", err)
+	}
+	tooLongSig := MsgBulletin{
+		Signature: make([]byte, MaxBulletinSignatureSize+1),
+	}
+	err = tooLongSig.HdfEncode(&buf, pver, BaseEncoding)
+	if reflect.TypeOf(err) != reflect.TypeOf(wireErr) {
+		t.Errorf("HdfEncode: wrong error for long signature - got %v",
+			err)
+	}
+
+	buf.Reset()
+	if err := WriteVarBytes(&buf, pver, tooLongSig.Signature); err != nil {
+		t.Fatalf("WriteVarBytes: unexpected error %v", err)
+	}
+	encoded := append(make([]byte, 20), 0x00)
+	encoded = append(encoded, buf.Bytes()...)
+	var msg MsgBulletin
+	err = msg.HdfDecode(bytes.NewReader(encoded), pver, BaseEncoding)
+	if reflect.TypeOf(err) != reflect.TypeOf(wireErr) {
+		t.Errorf("HdfDecode: wrong error for long signature - got %v",
+			err)
+	}
+
+	// Ensure truncated messages are rejected.
+	err = msg.HdfDecode(bytes.NewReader(encoded[:10]), pver, BaseEncoding)
+	if err == nil {
+		t.Errorf("HdfDecode: accepted truncated message")
+	}
+}
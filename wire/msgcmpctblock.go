@@ -0,0 +1,337 @@
+// Copyright (c) 2018 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+)
+
+const (
+	// ShortTxIDSize is the number of bytes a short transaction id occupies
+	// when serialized in a cmpctblock message.
+	ShortTxIDSize = 6
+
+	// shortTxIDMask is the mask applied to a full SipHash-2-4 result in
+	// order to obtain a short transaction id.
+	shortTxIDMask = (1 << (ShortTxIDSize * 8)) - 1
+
+	// maxCmpctBlockTxIndex is the largest transaction index that may be
+	// referenced by a compact block related message.  BIP0152 specifies
+	// that the differentially encoded indexes must fit into a uint16 once
+	// decoded.
+	maxCmpctBlockTxIndex = math.MaxUint16
+)
+
+// PrefilledTx houses a transaction along with its index in the block that is
+// sent in full as part of a cmpctblock message.  The index is the absolute
+// position of the transaction within the block.  It is only differentially
+// encoded on the wire.
+type PrefilledTx struct {
+	Index uint32
+	Tx    *MsgTx
+}
+
+// MsgCmpctBlock implements the Message interface and represents a bitcoin
+// cmpctblock message.  It is used to relay a block as its header along with
+// short transaction ids for the transactions the receiver likely already has
+// in its mempool and a list of prefilled transactions it likely does not
+// (BIP0152).
+//
+// Use the ShortIDKeys and CalcShortTxID functions to compute the short ids for
+// transactions when reconstructing the block.
+//
+// This message was not added until protocol versions starting with
+// SendCmpctVersion.
+type MsgCmpctBlock struct {
+	Header        BlockHeader
+	Nonce         uint64
+	ShortIDs      []uint64
+	PrefilledTxns []PrefilledTx
+}
+
+// AddShortID adds a short transaction id to the message.  Only the low
+// ShortTxIDSize bytes of the passed id are kept.
+func (msg *MsgCmpctBlock) AddShortID(id uint64) {
+	msg.ShortIDs = append(msg.ShortIDs, id&shortTxIDMask)
+}
+
+// AddPrefilledTx adds a prefilled transaction at the provided absolute block
+// index to the message.  Prefilled transactions must be added in increasing
+// index order.
+func (msg *MsgCmpctBlock) AddPrefilledTx(index uint32, tx *MsgTx) error {
+	numPrefilled := len(msg.PrefilledTxns)
+	if numPrefilled > 0 && msg.PrefilledTxns[numPrefilled-1].Index >= index {
+		str := fmt.Sprintf("prefilled transaction index %d is not "+
+			"greater than previous index %d", index,
+			msg.PrefilledTxns[numPrefilled-1].Index)
+		return messageError("MsgCmpctBlock.AddPrefilledTx", str)
+	}
+	if index > maxCmpctBlockTxIndex {
+		str := fmt.Sprintf("prefilled transaction index %d exceeds max "+
+			"index %d", index, maxCmpctBlockTxIndex)
+		return messageError("MsgCmpctBlock.AddPrefilledTx", str)
+	}
+
+	msg.PrefilledTxns = append(msg.PrefilledTxns, PrefilledTx{
+		Index: index,
+		Tx:    tx,
+	})
+	return nil
+}
+
+// TotalTxns returns the total number of transactions in the block described by
+// the message.
+func (msg *MsgCmpctBlock) TotalTxns() int {
+	return len(msg.ShortIDs) + len(msg.PrefilledTxns)
+}
+
+// ShortIDKeys returns the two SipHash-2-4 keys used to calculate the short
+// transaction ids for the message.  As defined by BIP0152, they are the first
+// two little-endian 64-bit integers of the single SHA256 hash of the
+// serialized block header followed by the little-endian nonce.
+func (msg *MsgCmpctBlock) ShortIDKeys() (uint64, uint64) {
+	return ShortIDKeys(&msg.Header, msg.Nonce)
+}
+
+// ShortIDKeys returns the two SipHash-2-4 keys used to calculate short
+// transaction ids for the provided block header and nonce.  See
+// MsgCmpctBlock.ShortIDKeys for details.
+func ShortIDKeys(header *BlockHeader, nonce uint64) (uint64, uint64) {
+	var buf bytes.Buffer
+	buf.Grow(MaxBlockHeaderPayload + 8)
+	_ = writeBlockHeader(&buf, 0, header)
+	_ = binarySerializer.PutUint64(&buf, littleEndian, nonce)
+
+	hash := chainhash.HashB(buf.Bytes())
+	return littleEndian.Uint64(hash[0:8]), littleEndian.Uint64(hash[8:16])
+}
+
+// CalcShortTxID returns the short transaction id of the passed transaction
+// hash keyed by k0 and k1 as returned by ShortIDKeys.  The hash must be the
+// transaction hash for compact block version 1 and the witness transaction
+// hash for version 2.
+func CalcShortTxID(k0, k1 uint64, txHash *chainhash.Hash) uint64 {
+	return sipHash24(k0, k1, txHash) & shortTxIDMask
+}
+
+// HdfDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) HdfDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < SendCmpctVersion {
+		str := fmt.Sprintf("cmpctblock message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgCmpctBlock.HdfDecode", str)
+	}
+
+	err := readBlockHeader(r, pver, &msg.Header)
+	if err != nil {
+		return err
+	}
+
+	err = readElement(r, &msg.Nonce)
+	if err != nil {
+		return err
+	}
+
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+
+	// Limit to max transactions per block to prevent memory exhaustion
+	// attacks.
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many short ids for message "+
+			"[count %v, max %v]", count, maxTxPerBlock)
+		return messageError("MsgCmpctBlock.HdfDecode", str)
+	}
+
+	var shortID [8]byte
+	msg.ShortIDs = make([]uint64, 0, count)
+	for i := uint64(0); i < count; i++ {
+		_, err := io.ReadFull(r, shortID[:ShortTxIDSize])
+		if err != nil {
+			return err
+		}
+		msg.ShortIDs = append(msg.ShortIDs, littleEndian.Uint64(shortID[:]))
+	}
+
+	count, err = ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many prefilled transactions for "+
+			"message [count %v, max %v]", count, maxTxPerBlock)
+		return messageError("MsgCmpctBlock.HdfDecode", str)
+	}
+
+	// The indexes are differentially encoded, so the absolute index is
+	// rebuilt from the offset to the previous index.
+	msg.PrefilledTxns = make([]PrefilledTx, 0, count)
+	var lastIndex uint64
+	for i := uint64(0); i < count; i++ {
+		diff, err := ReadVarInt(r, pver)
+		if err != nil {
+			return err
+		}
+		index := lastIndex + diff
+		if i > 0 {
+			index++
+		}
+		if diff > maxCmpctBlockTxIndex || index > maxCmpctBlockTxIndex {
+			str := fmt.Sprintf("prefilled transaction index "+
+				"overflow [index %v, max %v]", index,
+				maxCmpctBlockTxIndex)
+			return messageError("MsgCmpctBlock.HdfDecode", str)
+		}
+		lastIndex = index
+
+		tx := MsgTx{}
+		err = tx.HdfDecode(r, pver, enc)
+		if err != nil {
+			return err
+		}
+		msg.PrefilledTxns = append(msg.PrefilledTxns, PrefilledTx{
+			Index: uint32(index),
+			Tx:    &tx,
+		})
+	}
+
+	return nil
+}
+
+// HdfEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) HdfEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < SendCmpctVersion {
+		str := fmt.Sprintf("cmpctblock message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgCmpctBlock.HdfEncode", str)
+	}
+
+	err := writeBlockHeader(w, pver, &msg.Header)
+	if err != nil {
+		return err
+	}
+
+	err = writeElement(w, msg.Nonce)
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarInt(w, pver, uint64(len(msg.ShortIDs)))
+	if err != nil {
+		return err
+	}
+
+	var shortID [8]byte
+	for _, id := range msg.ShortIDs {
+		littleEndian.PutUint64(shortID[:], id)
+		_, err := w.Write(shortID[:ShortTxIDSize])
+		if err != nil {
+			return err
+		}
+	}
+
+	err = WriteVarInt(w, pver, uint64(len(msg.PrefilledTxns)))
+	if err != nil {
+		return err
+	}
+
+	for i, ptx := range msg.PrefilledTxns {
+		diff := uint64(ptx.Index)
+		if i > 0 {
+			prevIndex := msg.PrefilledTxns[i-1].Index
+			if ptx.Index <= prevIndex {
+				str := fmt.Sprintf("prefilled transaction "+
+					"index %d is not greater than previous "+
+					"index %d", ptx.Index, prevIndex)
+				return messageError("MsgCmpctBlock.HdfEncode",
+					str)
+			}
+			diff = uint64(ptx.Index - prevIndex - 1)
+		}
+
+		err := WriteVarInt(w, pver, diff)
+		if err != nil {
+			return err
+		}
+
+		err = ptx.Tx.HdfEncode(w, pver, enc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgCmpctBlock) Command() string {
+	return CmdCmpctBlock
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) MaxPayloadLength(pver uint32) uint32 {
+	// A compact block can never be larger than the full block it
+	// describes.
+	return MaxBlockPayload
+}
+
+// NewMsgCmpctBlock returns a new bitcoin cmpctblock message that conforms to
+// the Message interface using the passed parameters and defaults for the
+// remaining fields.
+func NewMsgCmpctBlock(header *BlockHeader, nonce uint64) *MsgCmpctBlock {
+	return &MsgCmpctBlock{
+		Header:        *header,
+		Nonce:         nonce,
+		ShortIDs:      make([]uint64, 0, defaultTransactionAlloc),
+		PrefilledTxns: make([]PrefilledTx, 0, 1),
+	}
+}
+
+// NewMsgCmpctBlockFromBlock returns a new bitcoin cmpctblock message for the
+// passed block.  The coinbase transaction is prefilled as recommended by
+// BIP0152 and short ids are calculated for all of the remaining transactions
+// according to the provided compact block version.
+func NewMsgCmpctBlockFromBlock(block *MsgBlock, nonce uint64,
+	version uint64) (*MsgCmpctBlock, error) {
+
+	if len(block.Transactions) > maxCmpctBlockTxIndex+1 {
+		str := fmt.Sprintf("too many transactions for compact block "+
+			"[count %d, max %d]", len(block.Transactions),
+			maxCmpctBlockTxIndex+1)
+		return nil, messageError("NewMsgCmpctBlockFromBlock", str)
+	}
+
+	msg := NewMsgCmpctBlock(&block.Header, nonce)
+	k0, k1 := msg.ShortIDKeys()
+	for i, tx := range block.Transactions {
+		if i == 0 {
+			if err := msg.AddPrefilledTx(0, tx); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		var txHash chainhash.Hash
+		if version == CmpctBlockVersionWTxID {
+			txHash = tx.WitnessHash()
+		} else {
+			txHash = tx.TxHash()
+		}
+		msg.AddShortID(CalcShortTxID(k0, k1, &txHash))
+	}
+
+	return msg, nil
+}
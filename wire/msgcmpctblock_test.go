@@ -0,0 +1,283 @@
+// Copyright (c) 2018 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+)
+
+// TestSipHash24 ensures the SipHash-2-4 implementation used for short
+// transaction ids matches the reference test vector for a 32-byte input.
+func TestSipHash24(t *testing.T) {
+	var key [16]byte
+	var msg chainhash.Hash
+	for i := range key {
+		key[i] = byte(i)
+	}
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+
+	k0 := littleEndian.Uint64(key[0:8])
+	k1 := littleEndian.Uint64(key[8:16])
+	want := uint64(0x7127512f72f27cce)
+	if got := sipHash24(k0, k1, &msg); got != want {
+		t.Fatalf("sipHash24: wrong hash - got %x, want %x", got, want)
+	}
+}
+
+// TestCmpctBlockShortIDs ensures the short id keys and short transaction ids
+// are calculated as specified by BIP0152.
+func TestCmpctBlockShortIDs(t *testing.T) {
+	nonce := uint64(0x0123456789abcdef)
+	msg := NewMsgCmpctBlock(&blockOne.Header, nonce)
+
+	k0, k1 := msg.ShortIDKeys()
+	wantK0, wantK1 := uint64(0x59b96d87a741db80), uint64(0x6d747531a0325486)
+	if k0 != wantK0 || k1 != wantK1 {
+		t.Fatalf("ShortIDKeys: wrong keys - got (%x, %x), want (%x, %x)",
+			k0, k1, wantK0, wantK1)
+	}
+
+	txHash := blockOne.Transactions[0].TxHash()
+	wantID := uint64(0x5e52e59005e9)
+	if id := CalcShortTxID(k0, k1, &txHash); id != wantID {
+		t.Fatalf("CalcShortTxID: wrong id - got %x, want %x", id, wantID)
+	}
+
+	// Ensure only the low 6 bytes are kept when adding short ids.
+	msg.AddShortID(0xffff000000000001)
+	if msg.ShortIDs[0] != 1 {
+		t.Fatalf("AddShortID: id not masked - got %x", msg.ShortIDs[0])
+	}
+}
+
+// TestCmpctBlockFromBlock ensures creating a compact block from a full block
+// prefills the coinbase and calculates short ids for the remaining
+// transactions.
+func TestCmpctBlockFromBlock(t *testing.T) {
+	block := blockOne
+	block.Transactions = []*MsgTx{blockOne.Transactions[0], multiTx}
+
+	for _, version := range []uint64{CmpctBlockVersionTxID, CmpctBlockVersionWTxID} {
+		msg, err := NewMsgCmpctBlockFromBlock(&block, 1, version)
+		if err != nil {
+			t.Fatalf("NewMsgCmpctBlockFromBlock: unexpected error %v",
+				err)
+		}
+
+		if msg.TotalTxns() != len(block.Transactions) {
+			t.Fatalf("TotalTxns: wrong count - got %d, want %d",
+				msg.TotalTxns(), len(block.Transactions))
+		}
+		if len(msg.PrefilledTxns) != 1 || msg.PrefilledTxns[0].Index != 0 ||
+			msg.PrefilledTxns[0].Tx != block.Transactions[0] {
+
+			t.Fatalf("NewMsgCmpctBlockFromBlock: coinbase not "+
+				"prefilled - got %v", spew.Sdump(msg.PrefilledTxns))
+		}
+
+		txHash := multiTx.TxHash()
+		if version == CmpctBlockVersionWTxID {
+			txHash = multiTx.WitnessHash()
+		}
+		k0, k1 := msg.ShortIDKeys()
+		wantID := CalcShortTxID(k0, k1, &txHash)
+		if len(msg.ShortIDs) != 1 || msg.ShortIDs[0] != wantID {
+			t.Fatalf("NewMsgCmpctBlockFromBlock: wrong short ids - "+
+				"got %v, want [%x]", msg.ShortIDs, wantID)
+		}
+	}
+}
+
+// TestCmpctBlockWire tests the MsgCmpctBlock wire encode and decode for
+// various protocol versions.
+func TestCmpctBlockWire(t *testing.T) {
+	nonce := uint64(0x0123456789abcdef)
+
+	noTxns := NewMsgCmpctBlock(&blockOne.Header, nonce)
+	noTxnsEncoded := append(append([]byte{}, blockOneBytes[:80]...),
+		0xef, 0xcd, 0xab, 0x89, 0x67, 0x45, 0x23, 0x01, // Nonce
+		0x00, // Varint for number of short ids
+		0x00, // Varint for number of prefilled transactions
+	)
+
+	// Prefilled transactions at indexes 0 and 3 with short ids for the
+	// transactions at indexes 1 and 2.
+	cmpctBlock := NewMsgCmpctBlock(&blockOne.Header, nonce)
+	cmpctBlock.AddShortID(0x5e52e59005e9)
+	cmpctBlock.AddShortID(0x010203040506)
+	cmpctBlock.AddPrefilledTx(0, blockOne.Transactions[0])
+	cmpctBlock.AddPrefilledTx(3, blockOne.Transactions[0])
+	cmpctBlockEncoded := append(append([]byte{}, blockOneBytes[:80]...),
+		0xef, 0xcd, 0xab, 0x89, 0x67, 0x45, 0x23, 0x01, // Nonce
+		0x02,                               // Varint for number of short ids
+		0xe9, 0x05, 0x90, 0xe5, 0x52, 0x5e, // Short id 1
+		0x06, 0x05, 0x04, 0x03, 0x02, 0x01, // Short id 2
+		0x02, // Varint for number of prefilled transactions
+		0x00, // Differential index 0
+	)
+	cmpctBlockEncoded = append(cmpctBlockEncoded, blockOneBytes[81:]...)
+	cmpctBlockEncoded = append(cmpctBlockEncoded, 0x02) // Differential index 3
+	cmpctBlockEncoded = append(cmpctBlockEncoded, blockOneBytes[81:]...)
+
+	tests := []struct {
+		in   *MsgCmpctBlock // Message to encode
+		out  *MsgCmpctBlock // Expected decoded message
+		buf  []byte         // Wire encoding
+		pver uint32         // Protocol version for wire encoding
+		enc  MessageEncoding
+	}{
+		{noTxns, noTxns, noTxnsEncoded, ProtocolVersion, BaseEncoding},
+		{cmpctBlock, cmpctBlock, cmpctBlockEncoded, ProtocolVersion, BaseEncoding},
+		{cmpctBlock, cmpctBlock, cmpctBlockEncoded, ProtocolVersion, WitnessEncoding},
+		{cmpctBlock, cmpctBlock, cmpctBlockEncoded, SendCmpctVersion, BaseEncoding},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode the message to wire format.
+		var buf bytes.Buffer
+		err := test.in.HdfEncode(&buf, test.pver, test.enc)
+		if err != nil {
+			t.Errorf("HdfEncode #%d error %v", i, err)
+			continue
+		}
+		if !bytes.Equal(buf.Bytes(), test.buf) {
+			t.Errorf("HdfEncode #%d\n got: %s want: %s", i,
+				spew.Sdump(buf.Bytes()), spew.Sdump(test.buf))
+			continue
+		}
+
+		// Decode the message from wire format.
+		var msg MsgCmpctBlock
+		rbuf := bytes.NewReader(test.buf)
+		err = msg.HdfDecode(rbuf, test.pver, test.enc)
+		if err != nil {
+			t.Errorf("HdfDecode #%d error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(msg.Header, test.out.Header) ||
+			msg.Nonce != test.out.Nonce ||
+			!reflect.DeepEqual(msg.ShortIDs, test.out.ShortIDs) ||
+			!reflect.DeepEqual(msg.PrefilledTxns, test.out.PrefilledTxns) {
+
+			t.Errorf("HdfDecode #%d\n got: %s want: %s", i,
+				spew.Sdump(&msg), spew.Sdump(test.out))
+			continue
+		}
+	}
+}
+
+// TestCmpctBlockWireErrors performs negative tests against wire encode and
+// decode of MsgCmpctBlock to confirm error paths work correctly.
+func TestCmpctBlockWireErrors(t *testing.T) {
+	pver := ProtocolVersion
+	pverNoSendCmpct := SendCmpctVersion - 1
+	wireErr := &MessageError{}
+
+	baseCmpctBlock := NewMsgCmpctBlock(&blockOne.Header, 1)
+	baseCmpctBlock.AddShortID(0x010203040506)
+	baseCmpctBlock.AddPrefilledTx(0, blockOne.Transactions[0])
+	baseCmpctBlockEncoded := append(append([]byte{}, blockOneBytes[:80]...),
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // Nonce
+		0x01,                               // Varint for number of short ids
+		0x06, 0x05, 0x04, 0x03, 0x02, 0x01, // Short id
+		0x01, // Varint for number of prefilled transactions
+		0x00, // Differential index 0
+	)
+	baseCmpctBlockEncoded = append(baseCmpctBlockEncoded, blockOneBytes[81:]...)
+
+	// Message with prefilled transactions out of order.
+	badOrder := NewMsgCmpctBlock(&blockOne.Header, 1)
+	badOrder.PrefilledTxns = []PrefilledTx{
+		{Index: 1, Tx: blockOne.Transactions[0]},
+		{Index: 1, Tx: blockOne.Transactions[0]},
+	}
+
+	// Message that decodes to a prefilled index which overflows a uint16.
+	overflowEncoded := append(append([]byte{}, blockOneBytes[:80]...),
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // Nonce
+		0x00,                   // Varint for number of short ids
+		0x01,                   // Varint for number of prefilled transactions
+		0xfe, 0x00, 0x00, 0x01, // Differential index 65536
+	)
+
+	tests := []struct {
+		in       *MsgCmpctBlock // Value to encode
+		buf      []byte         // Wire encoding
+		pver     uint32         // Protocol version for wire encoding
+		max      int            // Max size of fixed buffer to induce errors
+		writeErr error          // Expected write error
+		readErr  error          // Expected read error
+	}{
+		// Force error in header.
+		{baseCmpctBlock, baseCmpctBlockEncoded, pver, 0, io.ErrShortWrite, io.EOF},
+		// Force error in nonce.
+		{baseCmpctBlock, baseCmpctBlockEncoded, pver, 80, io.ErrShortWrite, io.EOF},
+		// Force error in short id count.
+		{baseCmpctBlock, baseCmpctBlockEncoded, pver, 88, io.ErrShortWrite, io.EOF},
+		// Force error in short id.
+		{baseCmpctBlock, baseCmpctBlockEncoded, pver, 89, io.ErrShortWrite, io.EOF},
+		// Force error in prefilled transaction count.
+		{baseCmpctBlock, baseCmpctBlockEncoded, pver, 95, io.ErrShortWrite, io.EOF},
+		// Force error in prefilled transaction index.
+		{baseCmpctBlock, baseCmpctBlockEncoded, pver, 96, io.ErrShortWrite, io.EOF},
+		// Force error in prefilled transaction.
+		{baseCmpctBlock, baseCmpctBlockEncoded, pver, 97, io.ErrShortWrite, io.EOF},
+		// Force error due to unsupported protocol version.
+		{baseCmpctBlock, baseCmpctBlockEncoded, pverNoSendCmpct, 97, wireErr, wireErr},
+		// Force error with out of order indexes and index overflow.
+		{badOrder, overflowEncoded, pver, 1000, wireErr, wireErr},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode to wire format.
+		w := newFixedWriter(test.max)
+		err := test.in.HdfEncode(w, test.pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.writeErr) {
+			t.Errorf("HdfEncode #%d wrong error got: %v, want: %v",
+				i, err, test.writeErr)
+			continue
+		}
+
+		// For errors which are not of type MessageError, check them for
+		// equality.
+		if _, ok := err.(*MessageError); !ok {
+			if err != test.writeErr {
+				t.Errorf("HdfEncode #%d wrong error got: %v, "+
+					"want: %v", i, err, test.writeErr)
+				continue
+			}
+		}
+
+		// Decode from wire format.
+		var msg MsgCmpctBlock
+		r := newFixedReader(test.max, test.buf)
+		err = msg.HdfDecode(r, test.pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.readErr) {
+			t.Errorf("HdfDecode #%d wrong error got: %v, want: %v",
+				i, err, test.readErr)
+			continue
+		}
+
+		// For errors which are not of type MessageError, check them for
+		// equality.
+		if _, ok := err.(*MessageError); !ok {
+			if err != test.readErr {
+				t.Errorf("HdfDecode #%d wrong error got: %v, "+
+					"want: %v", i, err, test.readErr)
+				continue
+			}
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// IsCompressible returns whether or not messages with the passed command may
+// be sent by way of a compressed message.  Only messages which are large and
+// compress well, namely blocks and committed filters, are compressible.
+func IsCompressible(command string) bool {
+	switch command {
+	case CmdBlock, CmdCFilter:
+		return true
+	}
+	return false
+}
+
+// MsgCompressed implements the Message interface and represents a bitcoin
+// compressed message.  It wraps the compressed payload of another message,
+// which must be compressible as reported by IsCompressible, and is only sent
+// to peers which signalled support for the compression algorithm by way of a
+// sendcompr message.
+//
+// Compression is an experimental hdfd extension which is not part of the
+// bitcoin protocol.
+type MsgCompressed struct {
+	Algorithm CompressionAlgo
+	Cmd       string
+	Payload   []byte
+}
+
+// HdfDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgCompressed) HdfDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	algo, err := binarySerializer.Uint8(r)
+	if err != nil {
+		return err
+	}
+	msg.Algorithm = CompressionAlgo(algo)
+
+	msg.Cmd, err = ReadVarString(r, pver)
+	if err != nil {
+		return err
+	}
+	if len(msg.Cmd) > CommandSize {
+		str := fmt.Sprintf("compressed message command is too long "+
+			"[len %d, max %d]", len(msg.Cmd), CommandSize)
+		return messageError("MsgCompressed.HdfDecode", str)
+	}
+
+	msg.Payload, err = ReadVarBytes(r, pver, MaxMessagePayload,
+		"compressed payload")
+	return err
+}
+
+// HdfEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgCompressed) HdfEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if len(msg.Cmd) > CommandSize {
+		str := fmt.Sprintf("compressed message command is too long "+
+			"[len %d, max %d]", len(msg.Cmd), CommandSize)
+		return messageError("MsgCompressed.HdfEncode", str)
+	}
+
+	err := binarySerializer.PutUint8(w, uint8(msg.Algorithm))
+	if err != nil {
+		return err
+	}
+	if err := WriteVarString(w, pver, msg.Cmd); err != nil {
+		return err
+	}
+	return WriteVarBytes(w, pver, msg.Payload)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgCompressed) Command() string {
+	return CmdCompressed
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgCompressed) MaxPayloadLength(pver uint32) uint32 {
+	return MaxMessagePayload
+}
+
+// Decompress decompresses the payload of the compressed message and decodes it
+// into the message it wraps.  It returns the wrapped message along with its
+// raw uncompressed payload.
+//
+// An error is returned when the compression algorithm is unknown, the wrapped
+// message is not compressible, the uncompressed payload exceeds the maximum
+// payload length of the wrapped message, or the wrapped message can't be
+// decoded from exactly the uncompressed payload.
+func (msg *MsgCompressed) Decompress(pver uint32, enc MessageEncoding) (Message, []byte, error) {
+	if msg.Algorithm != CompressionDeflate {
+		str := fmt.Sprintf("unsupported compression algorithm %v",
+			msg.Algorithm)
+		return nil, nil, messageError("MsgCompressed.Decompress", str)
+	}
+	if !IsCompressible(msg.Cmd) {
+		str := fmt.Sprintf("message [%s] may not be compressed",
+			msg.Cmd)
+		return nil, nil, messageError("MsgCompressed.Decompress", str)
+	}
+
+	inner, err := makeEmptyMessage(msg.Cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Limit the amount of data that is decompressed to the maximum
+	// payload length of the wrapped message so small payloads which
+	// decompress to huge amounts of data are detected without having to
+	// decompress all of it.
+	maxLen := inner.MaxPayloadLength(pver)
+	if maxLen > MaxMessagePayload {
+		maxLen = MaxMessagePayload
+	}
+	fr := flate.NewReader(bytes.NewReader(msg.Payload))
+	defer fr.Close()
+	payload, err := ioutil.ReadAll(io.LimitReader(fr, int64(maxLen)+1))
+	if err != nil {
+		str := fmt.Sprintf("unable to decompress [%s] payload: %v",
+			msg.Cmd, err)
+		return nil, nil, messageError("MsgCompressed.Decompress", str)
+	}
+	if uint32(len(payload)) > maxLen {
+		str := fmt.Sprintf("decompressed [%s] payload exceeds the "+
+			"maximum length of %d bytes", msg.Cmd, maxLen)
+		return nil, nil, messageError("MsgCompressed.Decompress", str)
+	}
+
+	if err := decodePayload(inner, payload, pver, enc, true); err != nil {
+		return nil, nil, err
+	}
+	return inner, payload, nil
+}
+
+// NewMsgCompressed returns a new bitcoin compressed message that conforms to
+// the Message interface and wraps the passed message compressed with the passed
+// algorithm.  An error is returned when the message is not compressible or the
+// algorithm is unknown.  See MsgCompressed for details.
+func NewMsgCompressed(inner Message, algo CompressionAlgo, pver uint32,
+	enc MessageEncoding) (*MsgCompressed, error) {
+
+	if algo != CompressionDeflate {
+		str := fmt.Sprintf("unsupported compression algorithm %v", algo)
+		return nil, messageError("NewMsgCompressed", str)
+	}
+	if !IsCompressible(inner.Command()) {
+		str := fmt.Sprintf("message [%s] may not be compressed",
+			inner.Command())
+		return nil, messageError("NewMsgCompressed", str)
+	}
+
+	var payload bytes.Buffer
+	if err := inner.HdfEncode(&payload, pver, enc); err != nil {
+		return nil, err
+	}
+
+	var compressed bytes.Buffer
+	fw, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fw.Write(payload.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := fw.Close(); err != nil {
+		return nil, err
+	}
+
+	return &MsgCompressed{
+		Algorithm: algo,
+		Cmd:       inner.Command(),
+		Payload:   compressed.Bytes(),
+	}, nil
+}
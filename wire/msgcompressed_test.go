@@ -0,0 +1,182 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"compress/flate"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+)
+
+// compressRaw returns the passed data compressed with DEFLATE.
+func compressRaw(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		t.Fatalf("flate.NewWriter: %v", err)
+	}
+	if _, err := fw.Write(data); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestCompressed tests compressing messages into and decompressing them from
+// the MsgCompressed message.
+func TestCompressed(t *testing.T) {
+	pver := ProtocolVersion
+
+	filter := bytes.Repeat([]byte{0x01, 0x02, 0x03, 0x04}, 1000)
+	tests := []Message{
+		&blockOne,
+		NewMsgCFilter(GCSFilterRegular, &chainhash.Hash{}, filter),
+	}
+	for i, inner := range tests {
+		msg, err := NewMsgCompressed(inner, CompressionDeflate, pver,
+			WitnessEncoding)
+		if err != nil {
+			t.Fatalf("NewMsgCompressed #%d: %v", i, err)
+		}
+		if msg.Cmd != inner.Command() {
+			t.Fatalf("NewMsgCompressed #%d: wrong command - got %v, "+
+				"want %v", i, msg.Cmd, inner.Command())
+		}
+
+		// Ensure the message survives a round trip through the wire
+		// encoding.
+		var buf bytes.Buffer
+		if err := msg.HdfEncode(&buf, pver, BaseEncoding); err != nil {
+			t.Fatalf("HdfEncode #%d: %v", i, err)
+		}
+		var readMsg MsgCompressed
+		err = readMsg.HdfDecode(&buf, pver, BaseEncoding)
+		if err != nil {
+			t.Fatalf("HdfDecode #%d: %v", i, err)
+		}
+		if !reflect.DeepEqual(&readMsg, msg) {
+			t.Fatalf("HdfDecode #%d\n got: %s want: %s", i,
+				spew.Sdump(&readMsg), spew.Sdump(msg))
+		}
+
+		// Ensure the decompressed message and payload match the
+		// original ones.
+		got, payload, err := readMsg.Decompress(pver, WitnessEncoding)
+		if err != nil {
+			t.Fatalf("Decompress #%d: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, inner) {
+			t.Fatalf("Decompress #%d\n got: %s want: %s", i,
+				spew.Sdump(got), spew.Sdump(inner))
+		}
+		var want bytes.Buffer
+		if err := inner.HdfEncode(&want, pver, WitnessEncoding); err != nil {
+			t.Fatalf("HdfEncode #%d: %v", i, err)
+		}
+		if !bytes.Equal(payload, want.Bytes()) {
+			t.Fatalf("Decompress #%d: unexpected payload", i)
+		}
+	}
+
+	// The repeated filter data must actually be compressed.
+	msg, err := NewMsgCompressed(tests[1], CompressionDeflate, pver,
+		BaseEncoding)
+	if err != nil {
+		t.Fatalf("NewMsgCompressed: %v", err)
+	}
+	if len(msg.Payload) >= len(filter) {
+		t.Fatalf("NewMsgCompressed: payload not compressed - got %d "+
+			"bytes", len(msg.Payload))
+	}
+}
+
+// TestCompressedErrors ensures invalid compressed messages are rejected.
+func TestCompressedErrors(t *testing.T) {
+	pver := ProtocolVersion
+
+	// Only compressible messages and known algorithms are accepted when
+	// creating compressed messages.
+	_, err := NewMsgCompressed(NewMsgPing(1), CompressionDeflate, pver,
+		BaseEncoding)
+	if err == nil {
+		t.Errorf("NewMsgCompressed: expected error for ping message")
+	}
+	_, err = NewMsgCompressed(&blockOne, CompressionAlgo(1), pver,
+		BaseEncoding)
+	if err == nil {
+		t.Errorf("NewMsgCompressed: expected error for unknown " +
+			"algorithm")
+	}
+
+	var cfilter bytes.Buffer
+	err = NewMsgCFilter(GCSFilterRegular, &chainhash.Hash{},
+		[]byte{0x01}).HdfEncode(&cfilter, pver, BaseEncoding)
+	if err != nil {
+		t.Fatalf("HdfEncode: %v", err)
+	}
+	maxFilterLen := (&MsgCFilter{}).MaxPayloadLength(pver)
+
+	tests := []struct {
+		name string
+		msg  MsgCompressed
+	}{
+		{
+			name: "unknown algorithm",
+			msg: MsgCompressed{
+				Algorithm: CompressionAlgo(1),
+				Cmd:       CmdCFilter,
+				Payload:   compressRaw(t, cfilter.Bytes()),
+			},
+		},
+		{
+			name: "not compressible",
+			msg: MsgCompressed{
+				Algorithm: CompressionDeflate,
+				Cmd:       CmdPing,
+				Payload:   compressRaw(t, make([]byte, 8)),
+			},
+		},
+		{
+			name: "invalid deflate data",
+			msg: MsgCompressed{
+				Algorithm: CompressionDeflate,
+				Cmd:       CmdCFilter,
+				Payload:   []byte{0xff, 0xff, 0xff, 0xff},
+			},
+		},
+		{
+			name: "exceeds max payload",
+			msg: MsgCompressed{
+				Algorithm: CompressionDeflate,
+				Cmd:       CmdCFilter,
+				Payload: compressRaw(t,
+					make([]byte, maxFilterLen+1)),
+			},
+		},
+		{
+			name: "trailing bytes",
+			msg: MsgCompressed{
+				Algorithm: CompressionDeflate,
+				Cmd:       CmdCFilter,
+				Payload: compressRaw(t,
+					append(cfilter.Bytes(), 0x00)),
+			},
+		},
+	}
+	for _, test := range tests {
+		_, _, err := test.msg.Decompress(pver, BaseEncoding)
+		if err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+}
@@ -9,6 +9,11 @@ import (
 	"io"
 )
 
+// MaxFeeFilterRate is the maximum minimum fee rate, in satoshi per kilobyte, a
+// feefilter message may request.  It is the maximum number of satoshi that can
+// ever exist since any higher rate would be nonsensical.
+const MaxFeeFilterRate = 21000000 * 100000000
+
 // MsgFeeFilter implements the Message interface and represents a bitcoin
 // feefilter message.  It is used to request the receiving peer does not
 // announce any transactions below the specified minimum fee rate.
@@ -0,0 +1,167 @@
+// Copyright (c) 2018 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+)
+
+// MsgGetBlockTxn implements the Message interface and represents a bitcoin
+// getblocktxn message.  It is used to request the transactions of a block
+// previously announced via a cmpctblock message which the requesting peer was
+// unable to reconstruct from its mempool (BIP0152).
+//
+// The indexes are the absolute positions of the requested transactions within
+// the block and must be in increasing order.  They are only differentially
+// encoded on the wire.
+//
+// This message was not added until protocol versions starting with
+// SendCmpctVersion.
+type MsgGetBlockTxn struct {
+	BlockHash chainhash.Hash
+	Indexes   []uint32
+}
+
+// AddIndex adds a transaction index to the message.  Indexes must be added in
+// increasing order.
+func (msg *MsgGetBlockTxn) AddIndex(index uint32) error {
+	numIndexes := len(msg.Indexes)
+	if numIndexes > 0 && msg.Indexes[numIndexes-1] >= index {
+		str := fmt.Sprintf("transaction index %d is not greater than "+
+			"previous index %d", index, msg.Indexes[numIndexes-1])
+		return messageError("MsgGetBlockTxn.AddIndex", str)
+	}
+	if index > maxCmpctBlockTxIndex {
+		str := fmt.Sprintf("transaction index %d exceeds max index %d",
+			index, maxCmpctBlockTxIndex)
+		return messageError("MsgGetBlockTxn.AddIndex", str)
+	}
+
+	msg.Indexes = append(msg.Indexes, index)
+	return nil
+}
+
+// HdfDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) HdfDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < SendCmpctVersion {
+		str := fmt.Sprintf("getblocktxn message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgGetBlockTxn.HdfDecode", str)
+	}
+
+	err := readElement(r, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+
+	// Limit to max transactions per block to prevent memory exhaustion
+	// attacks.
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many transaction indexes for message "+
+			"[count %v, max %v]", count, maxTxPerBlock)
+		return messageError("MsgGetBlockTxn.HdfDecode", str)
+	}
+
+	// The indexes are differentially encoded, so the absolute index is
+	// rebuilt from the offset to the previous index.
+	msg.Indexes = make([]uint32, 0, count)
+	var lastIndex uint64
+	for i := uint64(0); i < count; i++ {
+		diff, err := ReadVarInt(r, pver)
+		if err != nil {
+			return err
+		}
+		index := lastIndex + diff
+		if i > 0 {
+			index++
+		}
+		if diff > maxCmpctBlockTxIndex || index > maxCmpctBlockTxIndex {
+			str := fmt.Sprintf("transaction index overflow "+
+				"[index %v, max %v]", index,
+				maxCmpctBlockTxIndex)
+			return messageError("MsgGetBlockTxn.HdfDecode", str)
+		}
+		lastIndex = index
+		msg.Indexes = append(msg.Indexes, uint32(index))
+	}
+
+	return nil
+}
+
+// HdfEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) HdfEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < SendCmpctVersion {
+		str := fmt.Sprintf("getblocktxn message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgGetBlockTxn.HdfEncode", str)
+	}
+
+	err := writeElement(w, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarInt(w, pver, uint64(len(msg.Indexes)))
+	if err != nil {
+		return err
+	}
+
+	for i, index := range msg.Indexes {
+		diff := uint64(index)
+		if i > 0 {
+			prevIndex := msg.Indexes[i-1]
+			if index <= prevIndex {
+				str := fmt.Sprintf("transaction index %d is "+
+					"not greater than previous index %d",
+					index, prevIndex)
+				return messageError("MsgGetBlockTxn.HdfEncode",
+					str)
+			}
+			diff = uint64(index - prevIndex - 1)
+		}
+
+		err := WriteVarInt(w, pver, diff)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgGetBlockTxn) Command() string {
+	return CmdGetBlockTxn
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) MaxPayloadLength(pver uint32) uint32 {
+	// Block hash + num indexes (varInt) + max allowed indexes, each of
+	// which is at most a 3 byte varint since they may not exceed a uint16.
+	return chainhash.HashSize + MaxVarIntPayload +
+		(maxCmpctBlockTxIndex+1)*3
+}
+
+// NewMsgGetBlockTxn returns a new bitcoin getblocktxn message that conforms to
+// the Message interface using the passed parameters and defaults for the
+// remaining fields.
+func NewMsgGetBlockTxn(blockHash *chainhash.Hash) *MsgGetBlockTxn {
+	return &MsgGetBlockTxn{
+		BlockHash: *blockHash,
+		Indexes:   make([]uint32, 0),
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2018 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestGetBlockTxn tests the MsgGetBlockTxn API.
+func TestGetBlockTxn(t *testing.T) {
+	pver := ProtocolVersion
+
+	blockHash := blockOne.BlockHash()
+	msg := NewMsgGetBlockTxn(&blockHash)
+	if !msg.BlockHash.IsEqual(&blockHash) {
+		t.Errorf("NewMsgGetBlockTxn: wrong block hash - got %v, want %v",
+			msg.BlockHash, blockHash)
+	}
+
+	// Ensure the command is expected value.
+	wantCmd := "getblocktxn"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgGetBlockTxn: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value for latest protocol version.
+	wantPayload := uint32(196649)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+
+	// Ensure indexes must be added in increasing order.
+	if err := msg.AddIndex(5); err != nil {
+		t.Errorf("AddIndex: unexpected error %v", err)
+	}
+	if err := msg.AddIndex(5); err == nil {
+		t.Errorf("AddIndex: did not receive error for duplicate index")
+	}
+	if err := msg.AddIndex(maxCmpctBlockTxIndex + 1); err == nil {
+		t.Errorf("AddIndex: did not receive error for index overflow")
+	}
+}
+
+// TestGetBlockTxnWire tests the MsgGetBlockTxn wire encode and decode.
+func TestGetBlockTxnWire(t *testing.T) {
+	blockHash := blockOne.BlockHash()
+	noIndexes := NewMsgGetBlockTxn(&blockHash)
+	noIndexesEncoded := append(blockHash[:], 0x00)
+
+	// Indexes 1, 2, 5 and 300 are encoded as the differences 1, 0, 2 and
+	// 294.
+	multiIndexes := NewMsgGetBlockTxn(&blockHash)
+	multiIndexes.AddIndex(1)
+	multiIndexes.AddIndex(2)
+	multiIndexes.AddIndex(5)
+	multiIndexes.AddIndex(300)
+	multiIndexesEncoded := append(append([]byte{}, blockHash[:]...),
+		0x04,             // Varint for number of indexes
+		0x01,             // Index 1
+		0x00,             // Index 2
+		0x02,             // Index 5
+		0xfd, 0x26, 0x01, // Index 300
+	)
+
+	tests := []struct {
+		in   *MsgGetBlockTxn // Message to encode
+		out  *MsgGetBlockTxn // Expected decoded message
+		buf  []byte          // Wire encoding
+		pver uint32          // Protocol version for wire encoding
+	}{
+		{noIndexes, noIndexes, noIndexesEncoded, ProtocolVersion},
+		{multiIndexes, multiIndexes, multiIndexesEncoded, ProtocolVersion},
+		{multiIndexes, multiIndexes, multiIndexesEncoded, SendCmpctVersion},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode the message to wire format.
+		var buf bytes.Buffer
+		err := test.in.HdfEncode(&buf, test.pver, BaseEncoding)
+		if err != nil {
+			t.Errorf("HdfEncode #%d error %v", i, err)
+			continue
+		}
+		if !bytes.Equal(buf.Bytes(), test.buf) {
+			t.Errorf("HdfEncode #%d\n got: %s want: %s", i,
+				spew.Sdump(buf.Bytes()), spew.Sdump(test.buf))
+			continue
+		}
+
+		// Decode the message from wire format.
+		var msg MsgGetBlockTxn
+		rbuf := bytes.NewReader(test.buf)
+		err = msg.HdfDecode(rbuf, test.pver, BaseEncoding)
+		if err != nil {
+			t.Errorf("HdfDecode #%d error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(&msg, test.out) {
+			t.Errorf("HdfDecode #%d\n got: %s want: %s", i,
+				spew.Sdump(&msg), spew.Sdump(test.out))
+			continue
+		}
+	}
+}
+
+// TestGetBlockTxnWireErrors performs negative tests against wire encode and
+// decode of MsgGetBlockTxn to confirm error paths work correctly.
+func TestGetBlockTxnWireErrors(t *testing.T) {
+	pver := ProtocolVersion
+	pverNoSendCmpct := SendCmpctVersion - 1
+	wireErr := &MessageError{}
+
+	blockHash := blockOne.BlockHash()
+	baseGetBlockTxn := NewMsgGetBlockTxn(&blockHash)
+	baseGetBlockTxn.AddIndex(1)
+	baseGetBlockTxnEncoded := append(append([]byte{}, blockHash[:]...),
+		0x01, 0x01)
+
+	// Message with indexes out of order.
+	badOrder := NewMsgGetBlockTxn(&blockHash)
+	badOrder.Indexes = []uint32{2, 1}
+
+	// Message that decodes to an index which overflows a uint16.
+	overflowEncoded := append(append([]byte{}, blockHash[:]...),
+		0x02, 0xfd, 0xff, 0xff, 0x00)
+
+	tests := []struct {
+		in       *MsgGetBlockTxn // Value to encode
+		buf      []byte          // Wire encoding
+		pver     uint32          // Protocol version for wire encoding
+		max      int             // Max size of fixed buffer to induce errors
+		writeErr error           // Expected write error
+		readErr  error           // Expected read error
+	}{
+		// Force error in block hash.
+		{baseGetBlockTxn, baseGetBlockTxnEncoded, pver, 0, io.ErrShortWrite, io.EOF},
+		// Force error in index count.
+		{baseGetBlockTxn, baseGetBlockTxnEncoded, pver, 32, io.ErrShortWrite, io.EOF},
+		// Force error in index.
+		{baseGetBlockTxn, baseGetBlockTxnEncoded, pver, 33, io.ErrShortWrite, io.EOF},
+		// Force error due to unsupported protocol version.
+		{baseGetBlockTxn, baseGetBlockTxnEncoded, pverNoSendCmpct, 34, wireErr, wireErr},
+		// Force error with out of order indexes and index overflow.
+		{badOrder, overflowEncoded, pver, 100, wireErr, wireErr},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode to wire format.
+		w := newFixedWriter(test.max)
+		err := test.in.HdfEncode(w, test.pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.writeErr) {
+			t.Errorf("HdfEncode #%d wrong error got: %v, want: %v",
+				i, err, test.writeErr)
+			continue
+		}
+
+		// For errors which are not of type MessageError, check them for
+		// equality.
+		if _, ok := err.(*MessageError); !ok {
+			if err != test.writeErr {
+				t.Errorf("HdfEncode #%d wrong error got: %v, "+
+					"want: %v", i, err, test.writeErr)
+				continue
+			}
+		}
+
+		// Decode from wire format.
+		var msg MsgGetBlockTxn
+		r := newFixedReader(test.max, test.buf)
+		err = msg.HdfDecode(r, test.pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.readErr) {
+			t.Errorf("HdfDecode #%d wrong error got: %v, want: %v",
+				i, err, test.readErr)
+			continue
+		}
+
+		// For errors which are not of type MessageError, check them for
+		// equality.
+		if _, ok := err.(*MessageError); !ok {
+			if err != test.readErr {
+				t.Errorf("HdfDecode #%d wrong error got: %v, "+
+					"want: %v", i, err, test.readErr)
+				continue
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+)
+
+// MsgGetPkgTxns implements the Message interface and represents a bitcoin
+// getpkgtxns message.  It is used to request the transactions of a package
+// identified by their witness hashes, typically those listed in an ancpkginfo
+// message that are not already known.  The transactions are delivered via a
+// pkgtxns message (MsgPkgTxns) as a whole or not at all (BIP0331).
+//
+// Use the AddWTxId function to build up the list of witness transaction hashes.
+//
+// Package relay requires wtxid-based transaction relay, so this message was
+// not added until protocol versions starting with WTxIdRelayVersion.
+type MsgGetPkgTxns struct {
+	WTxIds []*chainhash.Hash
+}
+
+// AddWTxId adds a witness transaction hash to the message.
+func (msg *MsgGetPkgTxns) AddWTxId(hash *chainhash.Hash) error {
+	if len(msg.WTxIds)+1 > MaxPackageTxs {
+		str := fmt.Sprintf("too many transactions in package "+
+			"[max %v]", MaxPackageTxs)
+		return messageError("MsgGetPkgTxns.AddWTxId", str)
+	}
+
+	msg.WTxIds = append(msg.WTxIds, hash)
+	return nil
+}
+
+// HdfDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgGetPkgTxns) HdfDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < WTxIdRelayVersion {
+		str := fmt.Sprintf("getpkgtxns message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgGetPkgTxns.HdfDecode", str)
+	}
+
+	wtxIds, err := readPkgWTxIds(r, pver, "MsgGetPkgTxns.HdfDecode")
+	if err != nil {
+		return err
+	}
+	msg.WTxIds = wtxIds
+	return nil
+}
+
+// HdfEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgGetPkgTxns) HdfEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < WTxIdRelayVersion {
+		str := fmt.Sprintf("getpkgtxns message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgGetPkgTxns.HdfEncode", str)
+	}
+
+	return writePkgWTxIds(w, pver, msg.WTxIds, "MsgGetPkgTxns.HdfEncode")
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgGetPkgTxns) Command() string {
+	return CmdGetPkgTxns
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgGetPkgTxns) MaxPayloadLength(pver uint32) uint32 {
+	// Num hashes (varInt) + max allowed hashes.
+	return MaxVarIntPayload + (MaxPackageTxs * chainhash.HashSize)
+}
+
+// NewMsgGetPkgTxns returns a new bitcoin getpkgtxns message that conforms to
+// the Message interface.  See MsgGetPkgTxns for details.
+func NewMsgGetPkgTxns() *MsgGetPkgTxns {
+	return &MsgGetPkgTxns{
+		WTxIds: make([]*chainhash.Hash, 0, MaxPackageTxs),
+	}
+}
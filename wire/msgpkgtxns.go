@@ -0,0 +1,122 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+)
+
+// MsgPkgTxns implements the Message interface and represents a bitcoin pkgtxns
+// message.  It is used to deliver all of the transactions requested via a
+// getpkgtxns message (MsgGetPkgTxns) so they can be evaluated together as a
+// package (BIP0331).
+//
+// Use the AddTransaction function to build up the list of transactions.
+//
+// Package relay requires wtxid-based transaction relay, so this message was
+// not added until protocol versions starting with WTxIdRelayVersion.
+type MsgPkgTxns struct {
+	Transactions []*MsgTx
+}
+
+// AddTransaction adds a transaction to the message.
+func (msg *MsgPkgTxns) AddTransaction(tx *MsgTx) error {
+	if len(msg.Transactions)+1 > MaxPackageTxs {
+		str := fmt.Sprintf("too many transactions in package "+
+			"[max %v]", MaxPackageTxs)
+		return messageError("MsgPkgTxns.AddTransaction", str)
+	}
+
+	msg.Transactions = append(msg.Transactions, tx)
+	return nil
+}
+
+// HdfDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgPkgTxns) HdfDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < WTxIdRelayVersion {
+		str := fmt.Sprintf("pkgtxns message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgPkgTxns.HdfDecode", str)
+	}
+
+	txCount, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+
+	// Limit to max transactions per package.
+	if txCount > MaxPackageTxs {
+		str := fmt.Sprintf("too many transactions in package "+
+			"[count %d, max %d]", txCount, MaxPackageTxs)
+		return messageError("MsgPkgTxns.HdfDecode", str)
+	}
+
+	msg.Transactions = make([]*MsgTx, 0, txCount)
+	for i := uint64(0); i < txCount; i++ {
+		tx := MsgTx{}
+		err := tx.HdfDecode(r, pver, enc)
+		if err != nil {
+			return err
+		}
+		msg.Transactions = append(msg.Transactions, &tx)
+	}
+
+	return nil
+}
+
+// HdfEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgPkgTxns) HdfEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < WTxIdRelayVersion {
+		str := fmt.Sprintf("pkgtxns message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgPkgTxns.HdfEncode", str)
+	}
+
+	// Limit to max transactions per package.
+	txCount := len(msg.Transactions)
+	if txCount > MaxPackageTxs {
+		str := fmt.Sprintf("too many transactions in package "+
+			"[count %d, max %d]", txCount, MaxPackageTxs)
+		return messageError("MsgPkgTxns.HdfEncode", str)
+	}
+
+	err := WriteVarInt(w, pver, uint64(txCount))
+	if err != nil {
+		return err
+	}
+
+	for _, tx := range msg.Transactions {
+		err = tx.HdfEncode(w, pver, enc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgPkgTxns) Command() string {
+	return CmdPkgTxns
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgPkgTxns) MaxPayloadLength(pver uint32) uint32 {
+	// A package can never be larger than a block.
+	return MaxBlockPayload
+}
+
+// NewMsgPkgTxns returns a new bitcoin pkgtxns message that conforms to the
+// Message interface.  See MsgPkgTxns for details.
+func NewMsgPkgTxns() *MsgPkgTxns {
+	return &MsgPkgTxns{
+		Transactions: make([]*MsgTx, 0, MaxPackageTxs),
+	}
+}
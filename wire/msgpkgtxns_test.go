@@ -0,0 +1,234 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestPkgTxns tests the MsgPkgTxns API against the latest protocol version.
+func TestPkgTxns(t *testing.T) {
+	pver := ProtocolVersion
+
+	msg := NewMsgPkgTxns()
+
+	// Ensure the command is expected value.
+	wantCmd := "pkgtxns"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgPkgTxns: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value for latest protocol version.
+	wantPayload := uint32(MaxBlockPayload)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+
+	// Ensure transactions are added properly up to the max allowed.
+	tx := multiTx.Copy()
+	if err := msg.AddTransaction(tx); err != nil {
+		t.Fatalf("AddTransaction: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(msg.Transactions, []*MsgTx{tx}) {
+		t.Errorf("AddTransaction: wrong transactions - got %v, want %v",
+			spew.Sdump(msg.Transactions), spew.Sdump([]*MsgTx{tx}))
+	}
+	for i := 1; i < MaxPackageTxs; i++ {
+		if err := msg.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction #%d: unexpected error: %v", i,
+				err)
+		}
+	}
+	err := msg.AddTransaction(tx)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("AddTransaction: expected error adding more than max "+
+			"transactions - got %v", err)
+	}
+}
+
+// TestPkgTxnsWire tests the MsgPkgTxns wire encode and decode for various
+// transactions, encodings, and protocol versions.
+func TestPkgTxnsWire(t *testing.T) {
+	pkgTxns := &MsgPkgTxns{
+		Transactions: []*MsgTx{multiTx, multiWitnessTx},
+	}
+
+	// The witness transaction is encoded without its witness data when the
+	// base encoding is used.
+	baseEncoded := append([]byte{0x02}, multiTxEncoded...)
+	var witnessTxBase bytes.Buffer
+	multiWitnessTx.HdfEncode(&witnessTxBase, ProtocolVersion, BaseEncoding)
+	baseEncoded = append(baseEncoded, witnessTxBase.Bytes()...)
+
+	witnessEncoded := append([]byte{0x02}, multiTxEncoded...)
+	witnessEncoded = append(witnessEncoded, multiWitnessTxEncoded...)
+
+	var baseDecoded MsgTx
+	err := baseDecoded.HdfDecode(bytes.NewReader(witnessTxBase.Bytes()),
+		ProtocolVersion, BaseEncoding)
+	if err != nil {
+		t.Fatalf("HdfDecode: unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		in   *MsgPkgTxns     // Message to encode
+		out  *MsgPkgTxns     // Expected decoded message
+		buf  []byte          // Wire encoding
+		pver uint32          // Protocol version for wire encoding
+		enc  MessageEncoding // Message encoding format
+	}{
+		// Latest protocol version with no transactions.
+		{
+			NewMsgPkgTxns(),
+			NewMsgPkgTxns(),
+			[]byte{0x00},
+			ProtocolVersion,
+			WitnessEncoding,
+		},
+
+		// Latest protocol version with witness encoding.
+		{
+			pkgTxns,
+			pkgTxns,
+			witnessEncoded,
+			ProtocolVersion,
+			WitnessEncoding,
+		},
+
+		// Protocol version WTxIdRelayVersion with base encoding.
+		{
+			pkgTxns,
+			&MsgPkgTxns{Transactions: []*MsgTx{multiTx, &baseDecoded}},
+			baseEncoded,
+			WTxIdRelayVersion,
+			BaseEncoding,
+		},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode the message to wire format.
+		var buf bytes.Buffer
+		err := test.in.HdfEncode(&buf, test.pver, test.enc)
+		if err != nil {
+			t.Errorf("HdfEncode #%d error %v", i, err)
+			continue
+		}
+		if !bytes.Equal(buf.Bytes(), test.buf) {
+			t.Errorf("HdfEncode #%d\n got: %s want: %s", i,
+				spew.Sdump(buf.Bytes()), spew.Sdump(test.buf))
+			continue
+		}
+
+		// Decode the message from wire format.
+		var msg MsgPkgTxns
+		rbuf := bytes.NewReader(test.buf)
+		err = msg.HdfDecode(rbuf, test.pver, test.enc)
+		if err != nil {
+			t.Errorf("HdfDecode #%d error %v", i, err)
+			continue
+		}
+		if len(msg.Transactions) != len(test.out.Transactions) {
+			t.Errorf("HdfDecode #%d wrong number of transactions - "+
+				"got %d, want %d", i, len(msg.Transactions),
+				len(test.out.Transactions))
+			continue
+		}
+		for j, tx := range msg.Transactions {
+			if tx.WitnessHash() != test.out.Transactions[j].WitnessHash() {
+				t.Errorf("HdfDecode #%d\n got: %s want: %s", i,
+					spew.Sdump(tx),
+					spew.Sdump(test.out.Transactions[j]))
+			}
+		}
+	}
+}
+
+// TestPkgTxnsWireErrors performs negative tests against wire encode and decode
+// of MsgPkgTxns to confirm error paths work correctly.
+func TestPkgTxnsWireErrors(t *testing.T) {
+	pver := ProtocolVersion
+	pverNoPkgRelay := WTxIdRelayVersion - 1
+	wireErr := &MessageError{}
+
+	basePkgTxns := &MsgPkgTxns{Transactions: []*MsgTx{multiTx}}
+	basePkgTxnsEncoded := append([]byte{0x01}, multiTxEncoded...)
+
+	// Message with more than the max allowed transactions, which can't be
+	// built via AddTransaction.
+	maxPkgTxns := &MsgPkgTxns{
+		Transactions: make([]*MsgTx, MaxPackageTxs+1),
+	}
+	maxPkgTxnsEncoded := []byte{MaxPackageTxs + 1}
+
+	tests := []struct {
+		in       *MsgPkgTxns // Value to encode
+		buf      []byte      // Wire encoding
+		pver     uint32      // Protocol version for wire encoding
+		max      int         // Max size of fixed buffer to induce errors
+		writeErr error       // Expected write error
+		readErr  error       // Expected read error
+	}{
+		// Force error in transaction count.
+		{basePkgTxns, basePkgTxnsEncoded, pver, 0, io.ErrShortWrite, io.EOF},
+		// Force error in transaction.
+		{basePkgTxns, basePkgTxnsEncoded, pver, 1, io.ErrShortWrite, io.EOF},
+		// Force error due to unsupported protocol version.
+		{basePkgTxns, basePkgTxnsEncoded, pverNoPkgRelay, len(basePkgTxnsEncoded), wireErr, wireErr},
+		// Force error with greater than max transactions.
+		{maxPkgTxns, maxPkgTxnsEncoded, pver, 1, wireErr, wireErr},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode to wire format.
+		w := newFixedWriter(test.max)
+		err := test.in.HdfEncode(w, test.pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.writeErr) {
+			t.Errorf("HdfEncode #%d wrong error got: %v, want: %v",
+				i, err, test.writeErr)
+			continue
+		}
+
+		// For errors which are not of type MessageError, check them for
+		// equality.
+		if _, ok := err.(*MessageError); !ok {
+			if err != test.writeErr {
+				t.Errorf("HdfEncode #%d wrong error got: %v, "+
+					"want: %v", i, err, test.writeErr)
+				continue
+			}
+		}
+
+		// Decode from wire format.
+		var msg MsgPkgTxns
+		r := newFixedReader(test.max, test.buf)
+		err = msg.HdfDecode(r, test.pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.readErr) {
+			t.Errorf("HdfDecode #%d wrong error got: %v, want: %v",
+				i, err, test.readErr)
+			continue
+		}
+
+		// For errors which are not of type MessageError, check them for
+		// equality.
+		if _, ok := err.(*MessageError); !ok {
+			if err != test.readErr {
+				t.Errorf("HdfDecode #%d wrong error got: %v, "+
+					"want: %v", i, err, test.readErr)
+				continue
+			}
+		}
+	}
+}
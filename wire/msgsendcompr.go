@@ -0,0 +1,94 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+)
+
+// CompressionAlgo identifies an algorithm used to compress the payload of a
+// compressed message.
+type CompressionAlgo uint8
+
+// CompressionDeflate identifies the DEFLATE compression algorithm as specified
+// by RFC 1951.
+const CompressionDeflate CompressionAlgo = 0
+
+// Map of compression algorithms back to their constant names for pretty
+// printing.
+var compressionAlgoStrings = map[CompressionAlgo]string{
+	CompressionDeflate: "CompressionDeflate",
+}
+
+// String returns the CompressionAlgo in human-readable form.
+func (a CompressionAlgo) String() string {
+	if s, ok := compressionAlgoStrings[a]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown CompressionAlgo (%d)", uint8(a))
+}
+
+// MsgSendCompr implements the Message interface and represents a bitcoin
+// sendcompr message.  It is used to signal the compression algorithms the
+// sending peer supports for the payloads of block and cfilter messages by way
+// of compressed messages.  It must be sent after the version message and
+// before the verack message, and only to peers which advertise the
+// SFNodeCompression service flag.
+//
+// Compression is an experimental hdfd extension which is not part of the
+// bitcoin protocol.
+type MsgSendCompr struct {
+	// Algorithms is a bit field where bit n is set when the algorithm
+	// with the CompressionAlgo value n is supported.
+	Algorithms uint64
+}
+
+// AddAlgorithm marks the passed compression algorithm as supported.
+func (msg *MsgSendCompr) AddAlgorithm(algo CompressionAlgo) {
+	msg.Algorithms |= 1 << uint(algo)
+}
+
+// HasAlgorithm returns whether or not the passed compression algorithm is
+// marked as supported.
+func (msg *MsgSendCompr) HasAlgorithm(algo CompressionAlgo) bool {
+	return algo < 64 && msg.Algorithms&(1<<uint(algo)) != 0
+}
+
+// HdfDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgSendCompr) HdfDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	return readElement(r, &msg.Algorithms)
+}
+
+// HdfEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgSendCompr) HdfEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	return writeElement(w, msg.Algorithms)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgSendCompr) Command() string {
+	return CmdSendCompr
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgSendCompr) MaxPayloadLength(pver uint32) uint32 {
+	// Algorithms bit field 8 bytes.
+	return 8
+}
+
+// NewMsgSendCompr returns a new bitcoin sendcompr message that conforms to the
+// Message interface and signals support for the passed compression algorithms.
+// See MsgSendCompr for details.
+func NewMsgSendCompr(algos ...CompressionAlgo) *MsgSendCompr {
+	var msg MsgSendCompr
+	for _, algo := range algos {
+		msg.AddAlgorithm(algo)
+	}
+	return &msg
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestSendCompr tests the MsgSendCompr API.
+func TestSendCompr(t *testing.T) {
+	pver := ProtocolVersion
+
+	msg := NewMsgSendCompr(CompressionDeflate)
+	if !msg.HasAlgorithm(CompressionDeflate) {
+		t.Errorf("NewMsgSendCompr: deflate compression not supported")
+	}
+	if msg.HasAlgorithm(CompressionAlgo(1)) {
+		t.Errorf("NewMsgSendCompr: unexpected algorithm supported")
+	}
+	if msg.HasAlgorithm(CompressionAlgo(255)) {
+		t.Errorf("HasAlgorithm: out of range algorithm supported")
+	}
+
+	// Ensure the command is expected value.
+	wantCmd := "sendcompr"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgSendCompr: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value for latest protocol version.
+	wantPayload := uint32(8)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+}
+
+// TestSendComprWire tests the MsgSendCompr wire encode and decode.
+func TestSendComprWire(t *testing.T) {
+	msg := NewMsgSendCompr(CompressionDeflate)
+	msgEncoded := []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+	var buf bytes.Buffer
+	err := msg.HdfEncode(&buf, ProtocolVersion, BaseEncoding)
+	if err != nil {
+		t.Fatalf("HdfEncode error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), msgEncoded) {
+		t.Fatalf("HdfEncode\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(msgEncoded))
+	}
+
+	var readMsg MsgSendCompr
+	err = readMsg.HdfDecode(bytes.NewReader(msgEncoded), ProtocolVersion,
+		BaseEncoding)
+	if err != nil {
+		t.Fatalf("HdfDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readMsg, msg) {
+		t.Fatalf("HdfDecode\n got: %s want: %s", spew.Sdump(&readMsg),
+			spew.Sdump(msg))
+	}
+}
+
+// TestCompressionAlgoStringer tests the stringized output for the
+// CompressionAlgo type.
+func TestCompressionAlgoStringer(t *testing.T) {
+	tests := []struct {
+		in   CompressionAlgo
+		want string
+	}{
+		{CompressionDeflate, "CompressionDeflate"},
+		{0xff, "Unknown CompressionAlgo (255)"},
+	}
+
+	for i, test := range tests {
+		result := test.in.String()
+		if result != test.want {
+			t.Errorf("String #%d\n got: %s want: %s", i, result,
+				test.want)
+		}
+	}
+}
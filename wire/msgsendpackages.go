@@ -0,0 +1,78 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	// PkgRelayAncestor is the package relay version bit which indicates
+	// support for ancestor package relay by way of the ancpkginfo,
+	// getpkgtxns, and pkgtxns messages (BIP0331).
+	PkgRelayAncestor uint64 = 1 << 0
+
+	// MaxPackageTxs is the maximum number of transactions in a package,
+	// which matches the default limit on the number of in-mempool
+	// ancestors of a transaction, including itself.
+	MaxPackageTxs = 25
+)
+
+// MsgSendPackages implements the Message interface and represents a bitcoin
+// sendpackages message.  It is used to signal the versions of package relay the
+// sending peer supports as a bit field (BIP0331).  It must be sent after the
+// version message and before the verack message.
+//
+// Package relay requires wtxid-based transaction relay, so this message was
+// not added until protocol versions starting with WTxIdRelayVersion.
+type MsgSendPackages struct {
+	Versions uint64
+}
+
+// HdfDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgSendPackages) HdfDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < WTxIdRelayVersion {
+		str := fmt.Sprintf("sendpackages message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgSendPackages.HdfDecode", str)
+	}
+
+	return readElement(r, &msg.Versions)
+}
+
+// HdfEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgSendPackages) HdfEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < WTxIdRelayVersion {
+		str := fmt.Sprintf("sendpackages message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgSendPackages.HdfEncode", str)
+	}
+
+	return writeElement(w, msg.Versions)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgSendPackages) Command() string {
+	return CmdSendPackages
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgSendPackages) MaxPayloadLength(pver uint32) uint32 {
+	// Versions bit field 8 bytes.
+	return 8
+}
+
+// NewMsgSendPackages returns a new bitcoin sendpackages message that conforms
+// to the Message interface.  See MsgSendPackages for details.
+func NewMsgSendPackages(versions uint64) *MsgSendPackages {
+	return &MsgSendPackages{
+		Versions: versions,
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestSendPackages tests the MsgSendPackages API against the latest protocol
+// version.
+func TestSendPackages(t *testing.T) {
+	pver := ProtocolVersion
+
+	msg := NewMsgSendPackages(PkgRelayAncestor)
+	if msg.Versions != PkgRelayAncestor {
+		t.Errorf("NewMsgSendPackages: wrong versions - got %v, want %v",
+			msg.Versions, PkgRelayAncestor)
+	}
+
+	// Ensure the command is expected value.
+	wantCmd := "sendpackages"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgSendPackages: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value for latest protocol version.
+	wantPayload := uint32(8)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+}
+
+// TestSendPackagesWire tests the MsgSendPackages wire encode and decode for
+// various protocol versions.
+func TestSendPackagesWire(t *testing.T) {
+	tests := []struct {
+		in   MsgSendPackages // Message to encode
+		out  MsgSendPackages // Expected decoded message
+		buf  []byte          // Wire encoding
+		pver uint32          // Protocol version for wire encoding
+	}{
+		// Latest protocol version.
+		{
+			MsgSendPackages{PkgRelayAncestor},
+			MsgSendPackages{PkgRelayAncestor},
+			[]byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			ProtocolVersion,
+		},
+
+		// Protocol version WTxIdRelayVersion with unknown versions.
+		{
+			MsgSendPackages{0x8000000000000003},
+			MsgSendPackages{0x8000000000000003},
+			[]byte{0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x80},
+			WTxIdRelayVersion,
+		},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode the message to wire format.
+		var buf bytes.Buffer
+		err := test.in.HdfEncode(&buf, test.pver, BaseEncoding)
+		if err != nil {
+			t.Errorf("HdfEncode #%d error %v", i, err)
+			continue
+		}
+		if !bytes.Equal(buf.Bytes(), test.buf) {
+			t.Errorf("HdfEncode #%d\n got: %s want: %s", i,
+				spew.Sdump(buf.Bytes()), spew.Sdump(test.buf))
+			continue
+		}
+
+		// Decode the message from wire format.
+		var msg MsgSendPackages
+		rbuf := bytes.NewReader(test.buf)
+		err = msg.HdfDecode(rbuf, test.pver, BaseEncoding)
+		if err != nil {
+			t.Errorf("HdfDecode #%d error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(msg, test.out) {
+			t.Errorf("HdfDecode #%d\n got: %s want: %s", i,
+				spew.Sdump(msg), spew.Sdump(test.out))
+			continue
+		}
+	}
+}
+
+// TestSendPackagesWireErrors performs negative tests against wire encode and
+// decode of MsgSendPackages to confirm error paths work correctly.
+func TestSendPackagesWireErrors(t *testing.T) {
+	pver := ProtocolVersion
+	pverNoPkgRelay := WTxIdRelayVersion - 1
+	wireErr := &MessageError{}
+
+	baseSendPackages := NewMsgSendPackages(PkgRelayAncestor)
+	baseSendPackagesEncoded := []byte{
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+
+	tests := []struct {
+		in       *MsgSendPackages // Value to encode
+		buf      []byte           // Wire encoding
+		pver     uint32           // Protocol version for wire encoding
+		max      int              // Max size of fixed buffer to induce errors
+		writeErr error            // Expected write error
+		readErr  error            // Expected read error
+	}{
+		// Force error in versions.
+		{baseSendPackages, baseSendPackagesEncoded, pver, 0, io.ErrShortWrite, io.EOF},
+		// Force error due to unsupported protocol version.
+		{baseSendPackages, baseSendPackagesEncoded, pverNoPkgRelay, 8, wireErr, wireErr},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode to wire format.
+		w := newFixedWriter(test.max)
+		err := test.in.HdfEncode(w, test.pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.writeErr) {
+			t.Errorf("HdfEncode #%d wrong error got: %v, want: %v",
+				i, err, test.writeErr)
+			continue
+		}
+
+		// For errors which are not of type MessageError, check them for
+		// equality.
+		if _, ok := err.(*MessageError); !ok {
+			if err != test.writeErr {
+				t.Errorf("HdfEncode #%d wrong error got: %v, "+
+					"want: %v", i, err, test.writeErr)
+				continue
+			}
+		}
+
+		// Decode from wire format.
+		var msg MsgSendPackages
+		r := newFixedReader(test.max, test.buf)
+		err = msg.HdfDecode(r, test.pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.readErr) {
+			t.Errorf("HdfDecode #%d wrong error got: %v, want: %v",
+				i, err, test.readErr)
+			continue
+		}
+
+		// For errors which are not of type MessageError, check them for
+		// equality.
+		if _, ok := err.(*MessageError); !ok {
+			if err != test.readErr {
+				t.Errorf("HdfDecode #%d wrong error got: %v, "+
+					"want: %v", i, err, test.readErr)
+				continue
+			}
+		}
+	}
+}
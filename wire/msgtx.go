@@ -409,6 +409,28 @@ func (msg *MsgTx) Copy() *MsgTx {
 // See Deserialize for decoding transactions stored to disk, such as in a
 // database, as opposed to decoding transactions from the wire.
 func (msg *MsgTx) HdfDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	return msg.hdfDecode(r, pver, enc, nil)
+}
+
+// DecodeInto decodes r using the bitcoin protocol encoding into the receiver
+// in the same manner as HdfDecode, however, the inputs, outputs, witness
+// stacks, and scripts of the transaction are carved from the storage owned by
+// the provided arena rather than being individually allocated.
+//
+// The decoded transaction is only valid until the arena is reset.  See
+// DecodeArena for details.
+func (msg *MsgTx) DecodeInto(r io.Reader, pver uint32, enc MessageEncoding,
+	arena *DecodeArena) error {
+
+	return msg.hdfDecode(r, pver, enc, arena)
+}
+
+// hdfDecode decodes r using the bitcoin protocol encoding into the receiver
+// while carving all of the storage needed for the transaction from the
+// provided arena.  A nil arena causes the storage to be allocated normally.
+func (msg *MsgTx) hdfDecode(r io.Reader, pver uint32, enc MessageEncoding,
+	arena *DecodeArena) error {
+
 	version, err := binarySerializer.Uint32(r, littleEndian)
 	if err != nil {
 		return err
@@ -422,17 +444,22 @@ func (msg *MsgTx) HdfDecode(r io.Reader, pver uint32, enc MessageEncoding) error
 
 	// A count of zero (meaning no TxIn's to the uninitiated) indicates
 	// this is a transaction with witness data.
-	var flag [1]byte
+	//
+	// NOTE: The flag is read via the binary serializer rather than into a
+	// local array since the array would otherwise escape to the heap and
+	// cost an allocation for every decoded transaction.
+	var flag uint8
 	if count == 0 && enc == WitnessEncoding {
 		// Next, we need to read the flag, which is a single byte.
-		if _, err = io.ReadFull(r, flag[:]); err != nil {
+		flag, err = binarySerializer.Uint8(r)
+		if err != nil {
 			return err
 		}
 
 		// At the moment, the flag MUST be 0x01. In the future other
 		// flag types may be supported.
-		if flag[0] != 0x01 {
-			str := fmt.Sprintf("witness tx but flag byte is %x", flag)
+		if flag != 0x01 {
+			str := fmt.Sprintf("witness tx but flag byte is %02x", flag)
 			return messageError("MsgTx.HdfDecode", str)
 		}
 
@@ -485,13 +512,11 @@ func (msg *MsgTx) HdfDecode(r io.Reader, pver uint32, enc MessageEncoding) error
 
 	// Deserialize the inputs.
 	var totalScriptSize uint64
-	txIns := make([]TxIn, count)
-	msg.TxIn = make([]*TxIn, count)
+	msg.TxIn = arena.allocTxIns(count)
 	for i := uint64(0); i < count; i++ {
-		// The pointer is set now in case a script buffer is borrowed
-		// and needs to be returned to the pool on error.
-		ti := &txIns[i]
-		msg.TxIn[i] = ti
+		// The pointer is already set in case a script buffer is
+		// borrowed and needs to be returned to the pool on error.
+		ti := msg.TxIn[i]
 		err = readTxIn(r, pver, msg.Version, ti)
 		if err != nil {
 			returnScriptBuffers()
@@ -518,13 +543,11 @@ func (msg *MsgTx) HdfDecode(r io.Reader, pver uint32, enc MessageEncoding) error
 	}
 
 	// Deserialize the outputs.
-	txOuts := make([]TxOut, count)
-	msg.TxOut = make([]*TxOut, count)
+	msg.TxOut = arena.allocTxOuts(count)
 	for i := uint64(0); i < count; i++ {
-		// The pointer is set now in case a script buffer is borrowed
-		// and needs to be returned to the pool on error.
-		to := &txOuts[i]
-		msg.TxOut[i] = to
+		// The pointer is already set in case a script buffer is
+		// borrowed and needs to be returned to the pool on error.
+		to := msg.TxOut[i]
 		err = readTxOut(r, pver, msg.Version, to)
 		if err != nil {
 			returnScriptBuffers()
@@ -535,7 +558,7 @@ func (msg *MsgTx) HdfDecode(r io.Reader, pver uint32, enc MessageEncoding) error
 
 	// If the transaction's flag byte isn't 0x00 at this point, then one or
 	// more of its inputs has accompanying witness data.
-	if flag[0] != 0 && enc == WitnessEncoding {
+	if flag != 0 && enc == WitnessEncoding {
 		for _, txin := range msg.TxIn {
 			// For each input, the witness is encoded as a stack
 			// with one or more items. Therefore, we first read a
@@ -559,7 +582,7 @@ func (msg *MsgTx) HdfDecode(r io.Reader, pver uint32, enc MessageEncoding) error
 			// Then for witCount number of stack items, each item
 			// has a varint length prefix, followed by the witness
 			// item itself.
-			txin.Witness = make([][]byte, witCount)
+			txin.Witness = arena.allocWitness(witCount)
 			for j := uint64(0); j < witCount; j++ {
 				txin.Witness[j], err = readScript(r, pver,
 					maxWitnessItemSize, "script witness item")
@@ -593,7 +616,7 @@ func (msg *MsgTx) HdfDecode(r io.Reader, pver uint32, enc MessageEncoding) error
 	// scripts in the transaction inputs and outputs no longer point to the
 	// buffers.
 	var offset uint64
-	scripts := make([]byte, totalScriptSize)
+	scripts := arena.allocScripts(totalScriptSize)
 	for i := 0; i < len(msg.TxIn); i++ {
 		// Copy the signature script into the contiguous buffer at the
 		// appropriate offset.
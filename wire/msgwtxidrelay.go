@@ -0,0 +1,62 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+)
+
+// MsgWTxIdRelay implements the Message interface and represents a bitcoin
+// wtxidrelay message.  It is used to signal that the sending peer supports
+// announcing and requesting transactions by their witness hash (wtxid) by way
+// of MSG_WTX inventory vectors rather than by their hash (BIP0339).  It must be
+// sent after the version message and before the verack message.
+//
+// This message has no payload and was not added until protocol versions
+// starting with WTxIdRelayVersion.
+type MsgWTxIdRelay struct{}
+
+// HdfDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgWTxIdRelay) HdfDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < WTxIdRelayVersion {
+		str := fmt.Sprintf("wtxidrelay message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgWTxIdRelay.HdfDecode", str)
+	}
+
+	return nil
+}
+
+// HdfEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgWTxIdRelay) HdfEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < WTxIdRelayVersion {
+		str := fmt.Sprintf("wtxidrelay message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgWTxIdRelay.HdfEncode", str)
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgWTxIdRelay) Command() string {
+	return CmdWTxIdRelay
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgWTxIdRelay) MaxPayloadLength(pver uint32) uint32 {
+	return 0
+}
+
+// NewMsgWTxIdRelay returns a new bitcoin wtxidrelay message that conforms to
+// the Message interface.  See MsgWTxIdRelay for details.
+func NewMsgWTxIdRelay() *MsgWTxIdRelay {
+	return &MsgWTxIdRelay{}
+}
@@ -0,0 +1,346 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// MaxAddrV2Size is the maximum number of bytes an address may have when
+// encoded in an addrv2 message as defined by BIP0155.
+const MaxAddrV2Size = 512
+
+// NetworkID identifies the network an address encoded in an addrv2 message
+// belongs to as defined by BIP0155.
+type NetworkID uint8
+
+// These constants define the network IDs of BIP0155.
+const (
+	// NetIDIPv4 identifies an IPv4 address.
+	NetIDIPv4 NetworkID = 1
+
+	// NetIDIPv6 identifies an IPv6 address.
+	NetIDIPv6 NetworkID = 2
+
+	// NetIDTorV2 identifies a Tor v2 hidden service address.  Tor v2
+	// hidden services have been deprecated by the Tor project, but the
+	// network ID remains reserved.
+	NetIDTorV2 NetworkID = 3
+
+	// NetIDTorV3 identifies a Tor v3 hidden service address.
+	NetIDTorV3 NetworkID = 4
+
+	// NetIDI2P identifies an I2P address.
+	NetIDI2P NetworkID = 5
+
+	// NetIDCJDNS identifies a CJDNS address.
+	NetIDCJDNS NetworkID = 6
+)
+
+// Map of NetworkID values back to their constant names for pretty printing.
+var netIDStrings = map[NetworkID]string{
+	NetIDIPv4:  "IPv4",
+	NetIDIPv6:  "IPv6",
+	NetIDTorV2: "TorV2",
+	NetIDTorV3: "TorV3",
+	NetIDI2P:   "I2P",
+	NetIDCJDNS: "CJDNS",
+}
+
+// String returns the NetworkID in human-readable form.
+func (id NetworkID) String() string {
+	if s, ok := netIDStrings[id]; ok {
+		return s
+	}
+
+	return fmt.Sprintf("Unknown NetworkID (%d)", uint8(id))
+}
+
+// netIDAddrSizes houses the required address sizes of the known network IDs.
+// Addresses with an unknown network ID may have any size up to
+// MaxAddrV2Size.
+var netIDAddrSizes = map[NetworkID]int{
+	NetIDIPv4:  4,
+	NetIDIPv6:  16,
+	NetIDTorV2: 10,
+	NetIDTorV3: 32,
+	NetIDI2P:   32,
+	NetIDCJDNS: 16,
+}
+
+const (
+	// torV3Version is the version byte that is encoded in Tor v3 hidden
+	// service addresses.
+	torV3Version = 0x03
+
+	// torV3ChecksumLen is the number of bytes of the checksum that is
+	// encoded in Tor v3 hidden service addresses.
+	torV3ChecksumLen = 2
+)
+
+// torV3ChecksumPrefix is the constant prefix that is hashed along with the
+// public key and version when calculating the checksum of a Tor v3 hidden
+// service address.
+var torV3ChecksumPrefix = []byte(".onion checksum")
+
+// addrV2Encoding is the base32 encoding used for the textual form of Tor and
+// I2P addresses.
+var addrV2Encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// maxNetAddressV2Payload returns the max payload size for a NetAddressV2.
+func maxNetAddressV2Payload() uint32 {
+	// Timestamp 4 bytes + services (varInt) + network id 1 byte + address
+	// length (varInt) + max address size + port 2 bytes.
+	return 4 + MaxVarIntPayload + 1 + MaxVarIntPayload + MaxAddrV2Size + 2
+}
+
+// NetAddressV2 defines information about a peer on the network as it is
+// relayed in an addrv2 message (BIP0155).  Unlike NetAddress, it is able to
+// represent addresses of networks that do not fit into 16 bytes, such as Tor v3
+// hidden services and I2P.
+type NetAddressV2 struct {
+	// Last time the address was seen.  This is encoded as a uint32 on the
+	// wire and therefore is limited to 2106.
+	Timestamp time.Time
+
+	// Bitfield which identifies the services supported by the address.
+	Services ServiceFlag
+
+	// NetworkID identifies the network the address belongs to and
+	// therefore how Addr is to be interpreted.
+	NetworkID NetworkID
+
+	// Addr is the raw address in the encoding of its network.
+	Addr []byte
+
+	// Port the peer is using.  This is encoded in big endian on the wire
+	// which differs from most everything else.
+	Port uint16
+}
+
+// HasService returns whether the specified service is supported by the address.
+func (na *NetAddressV2) HasService(service ServiceFlag) bool {
+	return na.Services&service == service
+}
+
+// AddService adds service as a supported service by the peer generating the
+// message.
+func (na *NetAddressV2) AddService(service ServiceFlag) {
+	na.Services |= service
+}
+
+// IsKnownNetwork returns whether the network ID of the address is one of the
+// networks defined by BIP0155.
+func (na *NetAddressV2) IsKnownNetwork() bool {
+	_, ok := netIDAddrSizes[na.NetworkID]
+	return ok
+}
+
+// ToLegacy returns the address as a NetAddress along with true when it can be
+// represented by one, which is only the case for IPv4 and IPv6 addresses.
+// Otherwise, nil and false are returned.
+func (na *NetAddressV2) ToLegacy() (*NetAddress, bool) {
+	switch na.NetworkID {
+	case NetIDIPv4, NetIDIPv6:
+		ip := make(net.IP, len(na.Addr))
+		copy(ip, na.Addr)
+		return &NetAddress{
+			Timestamp: na.Timestamp,
+			Services:  na.Services,
+			IP:        ip,
+			Port:      na.Port,
+		}, true
+	}
+
+	return nil, false
+}
+
+// AddrString returns the textual form of the address without the port.  IPv4,
+// IPv6 and CJDNS addresses are returned in their usual notation, Tor addresses
+// as .onion host names and I2P addresses as .b32.i2p host names.
+func (na *NetAddressV2) AddrString() string {
+	switch na.NetworkID {
+	case NetIDIPv4, NetIDIPv6, NetIDCJDNS:
+		return net.IP(na.Addr).String()
+
+	case NetIDTorV2:
+		return strings.ToLower(addrV2Encoding.EncodeToString(na.Addr)) +
+			".onion"
+
+	case NetIDTorV3:
+		// The onion address commits to the public key, a checksum and
+		// the version as defined by the Tor v3 rendezvous spec.
+		addr := make([]byte, 0, len(na.Addr)+torV3ChecksumLen+1)
+		addr = append(addr, na.Addr...)
+		addr = append(addr, torV3Checksum(na.Addr)...)
+		addr = append(addr, torV3Version)
+		return strings.ToLower(addrV2Encoding.EncodeToString(addr)) +
+			".onion"
+
+	case NetIDI2P:
+		return strings.ToLower(addrV2Encoding.EncodeToString(na.Addr)) +
+			".b32.i2p"
+	}
+
+	return fmt.Sprintf("%x", na.Addr)
+}
+
+// torV3Checksum returns the checksum of the provided Tor v3 public key that is
+// encoded in its onion address.
+func torV3Checksum(pubKey []byte) []byte {
+	h := sha3.New256()
+	h.Write(torV3ChecksumPrefix)
+	h.Write(pubKey)
+	h.Write([]byte{torV3Version})
+	return h.Sum(nil)[:torV3ChecksumLen]
+}
+
+// NewNetAddressV2 returns a new NetAddressV2 using the provided timestamp,
+// services, network ID, address, and port.  The timestamp is rounded to single
+// second precision.
+func NewNetAddressV2(timestamp time.Time, services ServiceFlag,
+	netID NetworkID, addr []byte, port uint16) *NetAddressV2 {
+
+	// Limit the timestamp to one second precision since the protocol
+	// doesn't support better.
+	return &NetAddressV2{
+		Timestamp: time.Unix(timestamp.Unix(), 0),
+		Services:  services,
+		NetworkID: netID,
+		Addr:      addr,
+		Port:      port,
+	}
+}
+
+// NetAddressV2FromLegacy returns a new NetAddressV2 that represents the same
+// peer as the provided NetAddress.
+func NetAddressV2FromLegacy(na *NetAddress) *NetAddressV2 {
+	netID := NetIDIPv6
+	addr := []byte(na.IP.To16())
+	if ip4 := na.IP.To4(); ip4 != nil {
+		netID = NetIDIPv4
+		addr = []byte(ip4)
+	}
+	if addr == nil {
+		addr = make([]byte, netIDAddrSizes[NetIDIPv6])
+	}
+
+	ip := make([]byte, len(addr))
+	copy(ip, addr)
+	return &NetAddressV2{
+		Timestamp: na.Timestamp,
+		Services:  na.Services,
+		NetworkID: netID,
+		Addr:      ip,
+		Port:      na.Port,
+	}
+}
+
+// readNetAddressV2 reads an encoded NetAddressV2 from r.
+func readNetAddressV2(r io.Reader, pver uint32, na *NetAddressV2) error {
+	// NOTE: The bitcoin protocol uses a uint32 for the timestamp so it will
+	// stop working somewhere around 2106.
+	err := readElement(r, (*uint32Time)(&na.Timestamp))
+	if err != nil {
+		return err
+	}
+
+	// Unlike NetAddress, the services are encoded as a varInt.
+	services, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+
+	netID, err := binarySerializer.Uint8(r)
+	if err != nil {
+		return err
+	}
+
+	addrLen, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if addrLen > MaxAddrV2Size {
+		str := fmt.Sprintf("address is too large [len %v, max %v]",
+			addrLen, MaxAddrV2Size)
+		return messageError("readNetAddressV2", str)
+	}
+
+	// Addresses of known networks must have the size defined for them.
+	if size, ok := netIDAddrSizes[NetworkID(netID)]; ok &&
+		addrLen != uint64(size) {
+
+		str := fmt.Sprintf("invalid %v address length [len %v, want %v]",
+			NetworkID(netID), addrLen, size)
+		return messageError("readNetAddressV2", str)
+	}
+
+	addr := make([]byte, addrLen)
+	if _, err := io.ReadFull(r, addr); err != nil {
+		return err
+	}
+
+	// Sigh.  Bitcoin protocol mixes little and big endian.
+	port, err := binarySerializer.Uint16(r, bigEndian)
+	if err != nil {
+		return err
+	}
+
+	*na = NetAddressV2{
+		Timestamp: na.Timestamp,
+		Services:  ServiceFlag(services),
+		NetworkID: NetworkID(netID),
+		Addr:      addr,
+		Port:      port,
+	}
+	return nil
+}
+
+// writeNetAddressV2 serializes a NetAddressV2 to w.
+func writeNetAddressV2(w io.Writer, pver uint32, na *NetAddressV2) error {
+	if len(na.Addr) > MaxAddrV2Size {
+		str := fmt.Sprintf("address is too large [len %v, max %v]",
+			len(na.Addr), MaxAddrV2Size)
+		return messageError("writeNetAddressV2", str)
+	}
+	if size, ok := netIDAddrSizes[na.NetworkID]; ok && len(na.Addr) != size {
+		str := fmt.Sprintf("invalid %v address length [len %v, want %v]",
+			na.NetworkID, len(na.Addr), size)
+		return messageError("writeNetAddressV2", str)
+	}
+
+	// NOTE: The bitcoin protocol uses a uint32 for the timestamp so it will
+	// stop working somewhere around 2106.
+	err := writeElement(w, uint32(na.Timestamp.Unix()))
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarInt(w, pver, uint64(na.Services))
+	if err != nil {
+		return err
+	}
+
+	err = binarySerializer.PutUint8(w, uint8(na.NetworkID))
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarBytes(w, pver, na.Addr)
+	if err != nil {
+		return err
+	}
+
+	// Sigh.  Bitcoin protocol mixes little and big endian.
+	return binary.Write(w, bigEndian, na.Port)
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2021 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestNetAddressV2 tests the NetAddressV2 API.
+func TestNetAddressV2(t *testing.T) {
+	i2pAddr := make([]byte, 32)
+	for i := range i2pAddr {
+		i2pAddr[i] = byte(i)
+	}
+
+	tests := []struct {
+		name       string
+		netID      NetworkID
+		addr       []byte
+		wantString string
+		wantLegacy bool
+	}{{
+		name:       "ipv4",
+		netID:      NetIDIPv4,
+		addr:       []byte{0x7f, 0x00, 0x00, 0x01},
+		wantString: "127.0.0.1",
+		wantLegacy: true,
+	}, {
+		name:       "ipv6",
+		netID:      NetIDIPv6,
+		addr:       net.ParseIP("2001:db8::1"),
+		wantString: "2001:db8::1",
+		wantLegacy: true,
+	}, {
+		name:       "tor v3",
+		netID:      NetIDTorV3,
+		addr:       torV3PubKey,
+		wantString: "duckduckgogg42xjoc72x3sjasowoarfbgcmvfimaftt6twagswzczad.onion",
+		wantLegacy: false,
+	}, {
+		name:       "i2p",
+		netID:      NetIDI2P,
+		addr:       i2pAddr,
+		wantString: "aaaqeayeaudaocajbifqydiob4ibceqtcqkrmfyydenbwha5dypq.b32.i2p",
+		wantLegacy: false,
+	}, {
+		name:       "cjdns",
+		netID:      NetIDCJDNS,
+		addr:       net.ParseIP("fc00::1"),
+		wantString: "fc00::1",
+		wantLegacy: false,
+	}}
+
+	for _, test := range tests {
+		na := NewNetAddressV2(time.Now(), SFNodeNetwork, test.netID,
+			test.addr, 8333)
+
+		if !na.IsKnownNetwork() {
+			t.Errorf("%s: network %v is not known", test.name,
+				test.netID)
+			continue
+		}
+		if got := na.AddrString(); got != test.wantString {
+			t.Errorf("%s: unexpected address string -- got %s, "+
+				"want %s", test.name, got, test.wantString)
+			continue
+		}
+
+		legacy, ok := na.ToLegacy()
+		if ok != test.wantLegacy {
+			t.Errorf("%s: unexpected legacy conversion result -- "+
+				"got %v, want %v", test.name, ok, test.wantLegacy)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		// Ensure converting the legacy address back results in the
+		// original address.
+		roundTrip := NetAddressV2FromLegacy(legacy)
+		if !reflect.DeepEqual(roundTrip, na) {
+			t.Errorf("%s: mismatched address after round trip\n "+
+				"got: %s want: %s", test.name,
+				spew.Sdump(roundTrip), spew.Sdump(na))
+			continue
+		}
+	}
+
+	// Ensure unknown networks are reported as such.
+	na := NewNetAddressV2(time.Now(), 0, NetworkID(0xaa), []byte{0x01}, 0)
+	if na.IsKnownNetwork() {
+		t.Errorf("unknown network %v is reported as known", na.NetworkID)
+	}
+}
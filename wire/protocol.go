@@ -13,7 +13,7 @@ import (
 // XXX pedro: we will probably need to bump this.
 const (
 	// ProtocolVersion is the latest protocol version this package supports.
-	ProtocolVersion uint32 = 70013
+	ProtocolVersion uint32 = 70016
 
 	// MultipleAddressVersion is the protocol version which added multiple
 	// addresses per message (pver >= MultipleAddressVersion).
@@ -51,6 +51,19 @@ const (
 	// FeeFilterVersion is the protocol version which added a new
 	// feefilter message.
 	FeeFilterVersion uint32 = 70013
+
+	// SendCmpctVersion is the protocol version which added the compact
+	// block relay messages sendcmpct, cmpctblock, getblocktxn and blocktxn
+	// (BIP0152).
+	SendCmpctVersion uint32 = 70014
+
+	// AddrV2Version is the protocol version which added the sendaddrv2
+	// and addrv2 messages (BIP0155).
+	AddrV2Version uint32 = 70015
+
+	// WTxIdRelayVersion is the protocol version which added the wtxidrelay
+	// message and the MSG_WTX inventory type (BIP0339).
+	WTxIdRelayVersion uint32 = 70016
 )
 
 // ServiceFlag identifies services supported by a bitcoin peer.
@@ -86,18 +99,40 @@ const (
 	// SFNode2X is a flag used to indicate a peer is running the Segwit2X
 	// software.
 	SFNode2X
+
+	// SFNodeNetworkLimited is a flag used to indicate a peer only serves
+	// the most recent blocks, such as is the case for pruned nodes
+	// (BIP0159).  It does not immediately follow the other flags since it
+	// is defined as bit 10.
+	SFNodeNetworkLimited ServiceFlag = 1 << 10
+
+	// SFNodeBulletin is a flag used to indicate a peer relays signed
+	// network bulletins (MsgBulletin).  It is defined as bit 24, which is
+	// reserved for experimental services, since bulletins are not part of
+	// the bitcoin protocol.
+	SFNodeBulletin ServiceFlag = 1 << 24
+
+	// SFNodeCompression is a flag used to indicate a peer supports the
+	// experimental compression of block and cfilter messages by way of the
+	// sendcompr and compressed messages.  It is defined as bit 25, which is
+	// reserved for experimental services, since compression is not part of
+	// the bitcoin protocol.
+	SFNodeCompression ServiceFlag = 1 << 25
 )
 
 // Map of service flags back to their constant names for pretty printing.
 var sfStrings = map[ServiceFlag]string{
-	SFNodeNetwork: "SFNodeNetwork",
-	SFNodeGetUTXO: "SFNodeGetUTXO",
-	SFNodeBloom:   "SFNodeBloom",
-	SFNodeWitness: "SFNodeWitness",
-	SFNodeXthin:   "SFNodeXthin",
-	SFNodeBit5:    "SFNodeBit5",
-	SFNodeCF:      "SFNodeCF",
-	SFNode2X:      "SFNode2X",
+	SFNodeNetwork:        "SFNodeNetwork",
+	SFNodeGetUTXO:        "SFNodeGetUTXO",
+	SFNodeBloom:          "SFNodeBloom",
+	SFNodeWitness:        "SFNodeWitness",
+	SFNodeXthin:          "SFNodeXthin",
+	SFNodeBit5:           "SFNodeBit5",
+	SFNodeCF:             "SFNodeCF",
+	SFNode2X:             "SFNode2X",
+	SFNodeNetworkLimited: "SFNodeNetworkLimited",
+	SFNodeBulletin:       "SFNodeBulletin",
+	SFNodeCompression:    "SFNodeCompression",
 }
 
 // orderedSFStrings is an ordered list of service flags from highest to
@@ -111,6 +146,9 @@ var orderedSFStrings = []ServiceFlag{
 	SFNodeBit5,
 	SFNodeCF,
 	SFNode2X,
+	SFNodeNetworkLimited,
+	SFNodeBulletin,
+	SFNodeCompression,
 }
 
 // String returns the ServiceFlag in human-readable form.
@@ -0,0 +1,101 @@
+// Copyright (c) 2018 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"io"
+)
+
+// Transport describes the framing used to send and receive bitcoin messages
+// over a connection.  It allows callers to switch between the legacy message
+// header format and the BIP0324 v2 encrypted transport without any changes to
+// how the messages themselves are handled.
+//
+// Implementations must allow ReadMessage and WriteMessage to be called
+// concurrently with each other, however, multiple concurrent reads or multiple
+// concurrent writes are not safe.
+type Transport interface {
+	// ReadMessage reads, validates, and parses the next bitcoin message
+	// from r.  It returns the number of bytes read in addition to the
+	// parsed message and the raw message payload.
+	ReadMessage(r io.Reader, pver uint32, enc MessageEncoding) (int, Message, []byte, error)
+
+	// WriteMessage writes a bitcoin message to w including the framing
+	// required by the transport.  It returns the number of bytes written.
+	WriteMessage(w io.Writer, msg Message, pver uint32, enc MessageEncoding) (int, error)
+}
+
+// LegacyTransport implements the Transport interface using the original
+// unencrypted message format where every message is preceded by a 24-byte
+// header consisting of the network magic, the command, the payload length, and
+// the payload checksum.
+type LegacyTransport struct {
+	// Net is the bitcoin network messages are sent on and expected to be
+	// received from.
+	Net BitcoinNet
+
+	// SkipChecksum specifies that message checksums are neither
+	// calculated nor verified.  See ReadMessageNoChecksumN for details.
+	SkipChecksum bool
+
+	// StrictDecode specifies that messages with payloads which contain
+	// trailing bytes are rejected.  See StrictDecode for details.
+	StrictDecode bool
+}
+
+// Ensure LegacyTransport implements the Transport interface.
+var _ Transport = (*LegacyTransport)(nil)
+
+// ReadMessage reads, validates, and parses the next bitcoin message from r
+// using the legacy message format.
+//
+// This is part of the Transport interface implementation.
+func (t *LegacyTransport) ReadMessage(r io.Reader, pver uint32,
+	enc MessageEncoding) (int, Message, []byte, error) {
+
+	return readMessageN(r, pver, t.Net, enc, t.SkipChecksum,
+		t.StrictDecode)
+}
+
+// WriteMessage writes a bitcoin message to w using the legacy message format.
+//
+// This is part of the Transport interface implementation.
+func (t *LegacyTransport) WriteMessage(w io.Writer, msg Message, pver uint32,
+	enc MessageEncoding) (int, error) {
+
+	return writeMessageN(w, msg, pver, t.Net, enc, t.SkipChecksum)
+}
+
+// V1VersionPrefixSize is the number of bytes that make up the prefix of a
+// legacy version message.  See V1VersionPrefix for details.
+const V1VersionPrefixSize = 4 + CommandSize
+
+// V1VersionPrefix returns the first bytes of a version message sent on the
+// provided network using the legacy message format, which is the network
+// magic followed by the padded version command.
+//
+// BIP0324 relies on the fact that these bytes can never be the start of a v2
+// handshake, so a node accepting inbound connections is able to detect peers
+// that do not support the v2 transport and fall back to the legacy transport.
+func V1VersionPrefix(hdfnet BitcoinNet) [V1VersionPrefixSize]byte {
+	var prefix [V1VersionPrefixSize]byte
+	littleEndian.PutUint32(prefix[:4], uint32(hdfnet))
+	copy(prefix[4:], CmdVersion)
+	return prefix
+}
+
+// IsV1VersionPrefix returns whether or not the passed bytes, which are the
+// first bytes received on a new inbound connection, match the prefix of a
+// legacy version message on the provided network.  Fewer than
+// V1VersionPrefixSize bytes may be passed in which case only those bytes are
+// compared.
+func IsV1VersionPrefix(b []byte, hdfnet BitcoinNet) bool {
+	prefix := V1VersionPrefix(hdfnet)
+	if len(b) > len(prefix) {
+		b = b[:len(prefix)]
+	}
+	return bytes.Equal(b, prefix[:len(b)])
+}
@@ -0,0 +1,359 @@
+// Copyright (c) 2018 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+const (
+	// V2LengthFieldSize is the number of bytes used to encode the encrypted
+	// length of the contents of a v2 transport packet.
+	V2LengthFieldSize = 3
+
+	// V2HeaderSize is the number of bytes of the header which precedes the
+	// contents of a v2 transport packet.  The header is encrypted along
+	// with the contents.
+	V2HeaderSize = 1
+
+	// V2MaxContentsLength is the maximum number of bytes the contents of a
+	// v2 transport packet may be since it is limited by the size of the
+	// length field.
+	V2MaxContentsLength = 1<<(V2LengthFieldSize*8) - 1
+
+	// v2IgnoreBit is the bit of a v2 packet header which indicates the
+	// packet is a decoy that must be ignored by the receiver.
+	v2IgnoreBit = 1 << 7
+
+	// v2LongCommandID is the message type id which indicates the command
+	// is encoded as a full 12-byte command rather than a short id.
+	v2LongCommandID = 0
+)
+
+// v2ShortCommands maps the short message type ids defined by BIP0324 to the
+// commands they represent.  Ids that are not listed are either reserved for
+// messages not supported by this package or not yet assigned.
+var v2ShortCommands = map[byte]string{
+	1:  CmdAddr,
+	2:  CmdBlock,
+	3:  CmdBlockTxn,
+	4:  CmdCmpctBlock,
+	5:  CmdFeeFilter,
+	6:  CmdFilterAdd,
+	7:  CmdFilterClear,
+	8:  CmdFilterLoad,
+	9:  CmdGetBlocks,
+	10: CmdGetBlockTxn,
+	11: CmdGetData,
+	12: CmdGetHeaders,
+	13: CmdHeaders,
+	14: CmdInv,
+	15: CmdMemPool,
+	16: CmdMerkleBlock,
+	17: CmdNotFound,
+	18: CmdPing,
+	19: CmdPong,
+	20: CmdSendCmpct,
+	21: CmdTx,
+	22: CmdGetCFilters,
+	23: CmdCFilter,
+	24: CmdGetCFHeaders,
+	25: CmdCFHeaders,
+	26: CmdGetCFCheckpt,
+	27: CmdCFCheckpt,
+}
+
+// v2ShortIDs maps commands to the short message type ids used to encode them
+// in a v2 transport packet.  It is populated from v2ShortCommands.
+var v2ShortIDs = make(map[string]byte, len(v2ShortCommands))
+
+func init() {
+	for id, cmd := range v2ShortCommands {
+		v2ShortIDs[cmd] = id
+	}
+}
+
+// V2Cipher describes the authenticated encryption used to protect v2
+// transport packets sent in a single direction of a connection.
+//
+// The cipher is expected to manage its own nonces and rekeying, which is
+// the case for the FSChaCha20 and FSChaCha20Poly1305 ciphers specified by
+// BIP0324, so every call must be made in the same order on both ends of the
+// connection.  The keys themselves are negotiated by the v2 handshake which is
+// outside of the scope of this package.
+type V2Cipher interface {
+	// CryptLength encrypts or decrypts the V2LengthFieldSize byte length
+	// field of a packet in place.
+	CryptLength(length []byte)
+
+	// Seal encrypts and authenticates plaintext along with the provided
+	// associated data and appends the result to dst.
+	Seal(dst, plaintext, aad []byte) []byte
+
+	// Open decrypts and authenticates ciphertext along with the provided
+	// associated data and appends the result to dst.  An error must be
+	// returned when the ciphertext fails to authenticate.
+	Open(dst, ciphertext, aad []byte) ([]byte, error)
+
+	// Overhead returns the number of bytes Seal adds to the plaintext,
+	// which is the size of the authentication tag.
+	Overhead() int
+}
+
+// V2Transport implements the Transport interface using the BIP0324 v2
+// encrypted transport.  Each message is sent as a packet consisting of the
+// encrypted length of its contents followed by the encrypted and
+// authenticated header and contents.  The contents are the message type,
+// which is either a single byte short id or a zero byte followed by the full
+// 12-byte command, followed by the message payload.  Unlike the legacy
+// format, there is no network magic or checksum since the packets are
+// authenticated by the cipher.
+//
+// Use NewV2Transport to create a new instance once the v2 handshake has
+// established the ciphers for both directions.
+type V2Transport struct {
+	send    V2Cipher
+	recv    V2Cipher
+	sendAAD []byte
+	recvAAD []byte
+
+	// StrictDecode specifies that messages with payloads which contain
+	// trailing bytes are rejected.  See StrictDecode for details.
+	StrictDecode bool
+}
+
+// Ensure V2Transport implements the Transport interface.
+var _ Transport = (*V2Transport)(nil)
+
+// NewV2Transport returns a new v2 transport which encrypts outgoing packets
+// with the send cipher and decrypts incoming packets with the recv cipher.
+//
+// As specified by BIP0324, the garbage sent by each side during the handshake
+// is authenticated as the associated data of the first packet that follows it.
+// The sentGarbage and recvGarbage parameters are the garbage sent and received
+// by the local side, respectively, and may be nil when there was none.
+func NewV2Transport(send, recv V2Cipher, sentGarbage, recvGarbage []byte) *V2Transport {
+	return &V2Transport{
+		send:    send,
+		recv:    recv,
+		sendAAD: sentGarbage,
+		recvAAD: recvGarbage,
+	}
+}
+
+// WritePacket writes a single v2 transport packet with the provided contents
+// to w.  The packet is marked as a decoy which the remote peer will ignore
+// when ignore is true.  It returns the number of bytes written.
+//
+// Most callers will want to use WriteMessage instead, however, this is useful
+// for sending the version packet during the handshake and decoy packets.
+func (t *V2Transport) WritePacket(w io.Writer, contents []byte, ignore bool) (int, error) {
+	if len(contents) > V2MaxContentsLength {
+		str := fmt.Sprintf("packet contents are too large - %d bytes, "+
+			"but max contents length is %d bytes", len(contents),
+			V2MaxContentsLength)
+		return 0, messageError("V2Transport.WritePacket", str)
+	}
+
+	// The packet consists of the encrypted length followed by the
+	// encrypted header and contents along with the authentication tag.
+	packetLen := V2LengthFieldSize + V2HeaderSize + len(contents) +
+		t.send.Overhead()
+	packet := make([]byte, V2LengthFieldSize, packetLen)
+	contentsLen := uint32(len(contents))
+	packet[0] = byte(contentsLen)
+	packet[1] = byte(contentsLen >> 8)
+	packet[2] = byte(contentsLen >> 16)
+	t.send.CryptLength(packet[:V2LengthFieldSize])
+
+	plaintext := make([]byte, V2HeaderSize, V2HeaderSize+len(contents))
+	if ignore {
+		plaintext[0] |= v2IgnoreBit
+	}
+	plaintext = append(plaintext, contents...)
+	packet = t.send.Seal(packet, plaintext, t.sendAAD)
+	t.sendAAD = nil
+
+	return w.Write(packet)
+}
+
+// ReadPacket reads a single v2 transport packet from r and returns the number
+// of bytes read, whether or not the packet is a decoy which must be ignored,
+// and the decrypted contents of the packet.
+//
+// Most callers will want to use ReadMessage instead, however, this is useful
+// for receiving the version packet during the handshake.
+func (t *V2Transport) ReadPacket(r io.Reader) (int, bool, []byte, error) {
+	totalBytes := 0
+	var length [V2LengthFieldSize]byte
+	n, err := io.ReadFull(r, length[:])
+	totalBytes += n
+	if err != nil {
+		return totalBytes, false, nil, err
+	}
+	t.recv.CryptLength(length[:])
+	contentsLen := uint32(length[0]) | uint32(length[1])<<8 |
+		uint32(length[2])<<16
+
+	// NOTE: There is no need to enforce a maximum length here since the
+	// length field is not able to encode more than V2MaxContentsLength
+	// bytes which is already less than MaxMessagePayload.
+	ciphertext := make([]byte, V2HeaderSize+int(contentsLen)+
+		t.recv.Overhead())
+	n, err = io.ReadFull(r, ciphertext)
+	totalBytes += n
+	if err != nil {
+		return totalBytes, false, nil, err
+	}
+
+	plaintext, err := t.recv.Open(ciphertext[:0], ciphertext, t.recvAAD)
+	if err != nil {
+		str := fmt.Sprintf("packet failed to authenticate: %v", err)
+		return totalBytes, false, nil, messageError(
+			"V2Transport.ReadPacket", str)
+	}
+	t.recvAAD = nil
+
+	ignore := plaintext[0]&v2IgnoreBit != 0
+	return totalBytes, ignore, plaintext[V2HeaderSize:], nil
+}
+
+// ReadMessage reads, validates, and parses the next bitcoin message from r
+// using the v2 transport.  Decoy packets are skipped, however, the bytes read
+// for them are included in the returned number of bytes read.
+//
+// This is part of the Transport interface implementation.
+func (t *V2Transport) ReadMessage(r io.Reader, pver uint32,
+	enc MessageEncoding) (int, Message, []byte, error) {
+
+	totalBytes := 0
+	var contents []byte
+	for {
+		n, ignore, packet, err := t.ReadPacket(r)
+		totalBytes += n
+		if err != nil {
+			return totalBytes, nil, nil, err
+		}
+		if !ignore {
+			contents = packet
+			break
+		}
+	}
+
+	// Determine the command from the message type.
+	if len(contents) == 0 {
+		str := "packet does not contain a message type"
+		return totalBytes, nil, nil, messageError("ReadMessage", str)
+	}
+	var command string
+	var payload []byte
+	if id := contents[0]; id == v2LongCommandID {
+		if len(contents) < 1+CommandSize {
+			str := fmt.Sprintf("packet is too short to contain a "+
+				"command [len %d]", len(contents))
+			return totalBytes, nil, nil, messageError("ReadMessage",
+				str)
+		}
+		rawCommand := contents[1 : 1+CommandSize]
+		command = string(bytes.TrimRight(rawCommand, "\x00"))
+		payload = contents[1+CommandSize:]
+	} else {
+		var ok bool
+		command, ok = v2ShortCommands[id]
+		if !ok {
+			str := fmt.Sprintf("unhandled message type id %d", id)
+			return totalBytes, nil, nil, messageError("ReadMessage",
+				str)
+		}
+		payload = contents[1:]
+	}
+
+	// Check for malformed commands.
+	if !utf8.ValidString(command) {
+		str := fmt.Sprintf("invalid command %v", []byte(command))
+		return totalBytes, nil, nil, messageError("ReadMessage", str)
+	}
+
+	// Create struct of appropriate message type based on the command.
+	msg, err := makeEmptyMessage(command)
+	if err != nil {
+		return totalBytes, nil, nil, messageError("ReadMessage",
+			err.Error())
+	}
+
+	// Check for maximum length based on the message type.
+	lenp := uint32(len(payload))
+	mpl := msg.MaxPayloadLength(pver)
+	if lenp > mpl {
+		str := fmt.Sprintf("payload exceeds max length - packet "+
+			"indicates %v bytes, but max payload size for "+
+			"messages of type [%v] is %v.", lenp, command, mpl)
+		return totalBytes, nil, nil, messageError("ReadMessage", str)
+	}
+
+	// Unmarshal message.
+	err = decodePayload(msg, payload, pver, enc, t.StrictDecode)
+	if err != nil {
+		return totalBytes, nil, nil, err
+	}
+
+	return totalBytes, msg, payload, nil
+}
+
+// WriteMessage writes a bitcoin message to w using the v2 transport.  Commands
+// that have a short message type id defined by BIP0324 are encoded with it
+// while all others are encoded with the full command.
+//
+// This is part of the Transport interface implementation.
+func (t *V2Transport) WriteMessage(w io.Writer, msg Message, pver uint32,
+	enc MessageEncoding) (int, error) {
+
+	// Enforce max command size.
+	cmd := msg.Command()
+	if len(cmd) > CommandSize {
+		str := fmt.Sprintf("command [%s] is too long [max %v]",
+			cmd, CommandSize)
+		return 0, messageError("WriteMessage", str)
+	}
+
+	// Encode the message type followed by the message payload.
+	var bw bytes.Buffer
+	if id, ok := v2ShortIDs[cmd]; ok {
+		bw.WriteByte(id)
+	} else {
+		var command [CommandSize]byte
+		copy(command[:], cmd)
+		bw.WriteByte(v2LongCommandID)
+		bw.Write(command[:])
+	}
+	typeLen := bw.Len()
+	err := msg.HdfEncode(&bw, pver, enc)
+	if err != nil {
+		return 0, err
+	}
+	lenp := bw.Len() - typeLen
+
+	// Enforce maximum overall message payload.
+	if lenp > MaxMessagePayload {
+		str := fmt.Sprintf("message payload is too large - encoded "+
+			"%d bytes, but maximum message payload is %d bytes",
+			lenp, MaxMessagePayload)
+		return 0, messageError("WriteMessage", str)
+	}
+
+	// Enforce maximum message payload based on the message type.
+	mpl := msg.MaxPayloadLength(pver)
+	if uint32(lenp) > mpl {
+		str := fmt.Sprintf("message payload is too large - encoded "+
+			"%d bytes, but maximum message payload size for "+
+			"messages of type [%s] is %d.", lenp, cmd, mpl)
+		return 0, messageError("WriteMessage", str)
+	}
+
+	return t.WritePacket(w, bw.Bytes(), false)
+}
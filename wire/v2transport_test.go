@@ -0,0 +1,408 @@
+// Copyright (c) 2018 The ifishnet developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/ifishnet/hdfd/chaincfg/chainhash"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// testV2Cipher is a V2Cipher that is only suitable for testing.  It provides
+// a deterministic keystream and tag derived from the key and a counter so
+// that both ends of a connection stay in sync the same way the real ciphers
+// do.  A zero key disables encryption and produces all zero tags so the
+// resulting packets can be inspected directly.
+type testV2Cipher struct {
+	key     byte
+	counter uint64
+}
+
+// keystream returns n bytes of keystream for the current counter and advances
+// the counter.
+func (c *testV2Cipher) keystream(n int) []byte {
+	stream := make([]byte, n)
+	if c.key != 0 {
+		var seed [9]byte
+		seed[0] = c.key
+		littleEndian.PutUint64(seed[1:], c.counter)
+		hash := chainhash.HashB(seed[:])
+		for i := range stream {
+			stream[i] = hash[i%len(hash)]
+		}
+	}
+	c.counter++
+	return stream
+}
+
+// tag returns the authentication tag for the passed ciphertext and aad.
+func (c *testV2Cipher) tag(ciphertext, aad []byte) []byte {
+	if c.key == 0 {
+		return make([]byte, 16)
+	}
+	data := append([]byte{c.key}, aad...)
+	data = append(data, ciphertext...)
+	return chainhash.HashB(data)[:16]
+}
+
+func (c *testV2Cipher) CryptLength(length []byte) {
+	for i, b := range c.keystream(len(length)) {
+		length[i] ^= b
+	}
+}
+
+func (c *testV2Cipher) Seal(dst, plaintext, aad []byte) []byte {
+	start := len(dst)
+	for i, b := range c.keystream(len(plaintext)) {
+		dst = append(dst, plaintext[i]^b)
+	}
+	return append(dst, c.tag(dst[start:], aad)...)
+}
+
+func (c *testV2Cipher) Open(dst, ciphertext, aad []byte) ([]byte, error) {
+	if len(ciphertext) < c.Overhead() {
+		return nil, errors.New("ciphertext too short")
+	}
+	tagOffset := len(ciphertext) - c.Overhead()
+	tag := c.tag(ciphertext[:tagOffset], aad)
+	if !bytes.Equal(tag, ciphertext[tagOffset:]) {
+		return nil, errors.New("message authentication failed")
+	}
+	for i, b := range c.keystream(tagOffset) {
+		dst = append(dst, ciphertext[i]^b)
+	}
+	return dst, nil
+}
+
+func (c *testV2Cipher) Overhead() int {
+	return 16
+}
+
+// newTestV2Transports returns a pair of v2 transports which are connected to
+// each other using the test cipher.
+func newTestV2Transports(key byte, garbage []byte) (*V2Transport, *V2Transport) {
+	local := NewV2Transport(&testV2Cipher{key: key},
+		&testV2Cipher{key: key + 1}, garbage, nil)
+	remote := NewV2Transport(&testV2Cipher{key: key + 1},
+		&testV2Cipher{key: key}, nil, garbage)
+	return local, remote
+}
+
+// TestV2Transport tests the V2Transport API by sending various messages,
+// including decoy packets, between two transports.
+func TestV2Transport(t *testing.T) {
+	pver := ProtocolVersion
+	enc := BaseEncoding
+
+	tests := []struct {
+		msg   Message // Message to send
+		decoy int     // Number of decoy packets sent before the message
+	}{
+		{NewMsgPing(123123), 0},
+		{NewMsgGetAddr(), 0},
+		{NewMsgFeeFilter(1000), 0},
+		{NewMsgVerAck(), 2},
+		{NewMsgSendHeaders(), 0},
+		{NewMsgGetBlockTxn(&chainhash.Hash{}), 1},
+	}
+
+	local, remote := newTestV2Transports(0x42, []byte("garbage"))
+	var buf bytes.Buffer
+	for i, test := range tests {
+		wantBytes := 0
+		for j := 0; j < test.decoy; j++ {
+			n, err := local.WritePacket(&buf, make([]byte, j*10), true)
+			if err != nil {
+				t.Errorf("WritePacket #%d: %v", i, err)
+				continue
+			}
+			wantBytes += n
+		}
+
+		n, err := local.WriteMessage(&buf, test.msg, pver, enc)
+		if err != nil {
+			t.Errorf("WriteMessage #%d error %v", i, err)
+			continue
+		}
+		wantBytes += n
+
+		n, msg, _, err := remote.ReadMessage(&buf, pver, enc)
+		if err != nil {
+			t.Errorf("ReadMessage #%d error %v, msg %v", i, err,
+				spew.Sdump(msg))
+			continue
+		}
+		if n != wantBytes {
+			t.Errorf("ReadMessage #%d unexpected num bytes read - "+
+				"got %d, want %d", i, n, wantBytes)
+		}
+		if !reflect.DeepEqual(msg, test.msg) {
+			t.Errorf("ReadMessage #%d\n got: %v want: %v", i,
+				spew.Sdump(msg), spew.Sdump(test.msg))
+			continue
+		}
+	}
+}
+
+// TestV2TransportWire tests the v2 transport packet encoding for short and
+// long message types.  It uses a cipher that does not encrypt so the packets
+// can be inspected directly.
+func TestV2TransportWire(t *testing.T) {
+	pver := ProtocolVersion
+	enc := BaseEncoding
+	tag := make([]byte, 16)
+
+	// Ping uses the short message type id 18.
+	ping := NewMsgPing(0x0102030405060708)
+	pingPacket := []byte{
+		0x09, 0x00, 0x00, // Contents length
+		0x00,                                           // Header
+		0x12,                                           // Message type
+		0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01, // Nonce
+	}
+	pingPacket = append(pingPacket, tag...)
+
+	// Verack does not have a short id, so the full command is used.
+	verAck := NewMsgVerAck()
+	verAckPacket := []byte{
+		0x0d, 0x00, 0x00, // Contents length
+		0x00,                                           // Header
+		0x00,                                           // Message type
+		'v', 'e', 'r', 'a', 'c', 'k', 0, 0, 0, 0, 0, 0, // Command
+	}
+	verAckPacket = append(verAckPacket, tag...)
+
+	tests := []struct {
+		msg Message // Message to encode
+		buf []byte  // Wire encoding
+	}{
+		{ping, pingPacket},
+		{verAck, verAckPacket},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		local, remote := newTestV2Transports(0, nil)
+		local.recv.(*testV2Cipher).key = 0
+		remote.send.(*testV2Cipher).key = 0
+
+		var buf bytes.Buffer
+		n, err := local.WriteMessage(&buf, test.msg, pver, enc)
+		if err != nil {
+			t.Errorf("WriteMessage #%d error %v", i, err)
+			continue
+		}
+		if n != len(test.buf) {
+			t.Errorf("WriteMessage #%d unexpected num bytes "+
+				"written - got %d, want %d", i, n, len(test.buf))
+		}
+		if !bytes.Equal(buf.Bytes(), test.buf) {
+			t.Errorf("WriteMessage #%d\n got: %s want: %s", i,
+				spew.Sdump(buf.Bytes()), spew.Sdump(test.buf))
+			continue
+		}
+
+		rbuf := bytes.NewReader(test.buf)
+		n, msg, _, err := remote.ReadMessage(rbuf, pver, enc)
+		if err != nil {
+			t.Errorf("ReadMessage #%d error %v", i, err)
+			continue
+		}
+		if n != len(test.buf) {
+			t.Errorf("ReadMessage #%d unexpected num bytes read - "+
+				"got %d, want %d", i, n, len(test.buf))
+		}
+		if !reflect.DeepEqual(msg, test.msg) {
+			t.Errorf("ReadMessage #%d\n got: %v want: %v", i,
+				spew.Sdump(msg), spew.Sdump(test.msg))
+			continue
+		}
+	}
+}
+
+// TestV2TransportErrors performs negative tests against the v2 transport to
+// confirm error paths work correctly.
+func TestV2TransportErrors(t *testing.T) {
+	pver := ProtocolVersion
+	enc := BaseEncoding
+	tag := make([]byte, 16)
+
+	// packet returns an unencrypted packet with the provided contents.
+	packet := func(contents ...byte) []byte {
+		l := len(contents)
+		p := []byte{byte(l), byte(l >> 8), byte(l >> 16), 0x00}
+		p = append(p, contents...)
+		return append(p, tag...)
+	}
+
+	// Tampered packet.
+	tampered := packet(0x12, 1, 2, 3, 4, 5, 6, 7, 8)
+	tampered[len(tampered)-1] ^= 0x01
+
+	// Long command with an unknown command.
+	unknownCmd := packet(0x00, 'f', 'o', 'o', 0, 0, 0, 0, 0, 0, 0, 0, 0)
+
+	// Payload exceeding the max for the message type.
+	longPing := packet(0x12, 1, 2, 3, 4, 5, 6, 7, 8, 9)
+
+	tests := []struct {
+		buf      []byte // Wire encoding
+		readErr  error  // Expected read error
+		bytesRed int    // Expected num bytes read
+	}{
+		// Truncated length.
+		{[]byte{0x01}, io.ErrUnexpectedEOF, 1},
+		// Truncated contents.
+		{packet(0x12, 1, 2)[:6], io.ErrUnexpectedEOF, 6},
+		// Failed authentication.
+		{tampered, &MessageError{}, len(tampered)},
+		// No message type.
+		{packet(), &MessageError{}, 20},
+		// Truncated long command.
+		{packet(0x00, 'p', 'i'), &MessageError{}, 23},
+		// Unassigned short id.
+		{packet(0xff), &MessageError{}, 21},
+		// Unknown long command.
+		{unknownCmd, &MessageError{}, len(unknownCmd)},
+		// Payload too long for message type.
+		{longPing, &MessageError{}, len(longPing)},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		remote := NewV2Transport(&testV2Cipher{}, &testV2Cipher{}, nil, nil)
+		r := bytes.NewReader(test.buf)
+		n, _, _, err := remote.ReadMessage(r, pver, enc)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.readErr) {
+			t.Errorf("ReadMessage #%d wrong error got: %v <%T>, "+
+				"want: %v <%T>", i, err, err, test.readErr,
+				test.readErr)
+			continue
+		}
+		if n != test.bytesRed {
+			t.Errorf("ReadMessage #%d unexpected num bytes read - "+
+				"got %d, want %d", i, n, test.bytesRed)
+		}
+		if _, ok := err.(*MessageError); !ok && err != test.readErr {
+			t.Errorf("ReadMessage #%d wrong error got: %v <%T>, "+
+				"want: %v <%T>", i, err, err, test.readErr,
+				test.readErr)
+		}
+	}
+
+	// Ensure packets authenticated with the wrong garbage are rejected.
+	local, _ := newTestV2Transports(0x42, []byte("garbage"))
+	_, remote := newTestV2Transports(0x42, []byte("other"))
+	var buf bytes.Buffer
+	if _, err := local.WriteMessage(&buf, NewMsgVerAck(), pver, enc); err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+	_, _, _, err := remote.ReadMessage(&buf, pver, enc)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("ReadMessage with wrong garbage: unexpected error "+
+			"%v <%T>", err, err)
+	}
+
+	// Ensure oversized packet contents are rejected when writing.
+	_, err = local.WritePacket(&buf, make([]byte, V2MaxContentsLength+1),
+		false)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("WritePacket oversized: unexpected error %v <%T>",
+			err, err)
+	}
+}
+
+// TestLegacyTransport tests the LegacyTransport API.
+func TestLegacyTransport(t *testing.T) {
+	pver := ProtocolVersion
+	enc := BaseEncoding
+
+	tests := []struct {
+		transport    LegacyTransport // Transport to use
+		readNet      BitcoinNet      // Network the message is read on
+		skipChecksum bool            // Whether the reader skips checksums
+		err          error           // Expected read error
+	}{
+		{LegacyTransport{Net: MainNet}, MainNet, false, nil},
+		{LegacyTransport{Net: MainNet, SkipChecksum: true}, MainNet,
+			true, nil},
+		{LegacyTransport{Net: MainNet, SkipChecksum: true}, MainNet,
+			false, &MessageError{}},
+		{LegacyTransport{Net: MainNet}, TestNet3, false,
+			&MessageError{}},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		var buf bytes.Buffer
+		msg := NewMsgPing(123123)
+		nw, err := test.transport.WriteMessage(&buf, msg, pver, enc)
+		if err != nil {
+			t.Errorf("WriteMessage #%d error %v", i, err)
+			continue
+		}
+
+		reader := LegacyTransport{
+			Net:          test.readNet,
+			SkipChecksum: test.skipChecksum,
+		}
+		nr, readMsg, _, err := reader.ReadMessage(&buf, pver, enc)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.err) {
+			t.Errorf("ReadMessage #%d wrong error got: %v <%T>, "+
+				"want: %T", i, err, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if nr != nw {
+			t.Errorf("ReadMessage #%d unexpected num bytes read - "+
+				"got %d, want %d", i, nr, nw)
+		}
+		if !reflect.DeepEqual(readMsg, msg) {
+			t.Errorf("ReadMessage #%d\n got: %v want: %v", i,
+				spew.Sdump(readMsg), spew.Sdump(msg))
+		}
+	}
+}
+
+// TestIsV1VersionPrefix ensures the detection of legacy version messages used
+// to fall back to the legacy transport works as expected.
+func TestIsV1VersionPrefix(t *testing.T) {
+	var buf bytes.Buffer
+	msg := NewMsgVersion(&NetAddress{}, &NetAddress{}, 123123, 0)
+	if err := WriteMessage(&buf, msg, ProtocolVersion, MainNet); err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+	versionMsg := buf.Bytes()
+
+	tests := []struct {
+		name string     // Test description
+		b    []byte     // Bytes received
+		net  BitcoinNet // Network to check against
+		want bool       // Expected result
+	}{
+		{"full version message", versionMsg, MainNet, true},
+		{"partial prefix", versionMsg[:5], MainNet, true},
+		{"no bytes", nil, MainNet, true},
+		{"other network", versionMsg, TestNet3, false},
+		{"other command", makeHeader(MainNet, CmdVerAck, 0, 0),
+			MainNet, false},
+		{"random bytes", bytes.Repeat([]byte{0xaa}, 64), MainNet, false},
+	}
+
+	for _, test := range tests {
+		got := IsV1VersionPrefix(test.b, test.net)
+		if got != test.want {
+			t.Errorf("%s: unexpected result - got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+}